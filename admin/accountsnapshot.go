@@ -0,0 +1,284 @@
+package admin
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mjl-/bstore"
+
+	"github.com/mjl-/mox/config"
+	"github.com/mjl-/mox/mlog"
+	"github.com/mjl-/mox/mox-"
+	"github.com/mjl-/mox/store"
+	"github.com/mjl-/mox/webhook"
+)
+
+// AccountSnapshotInfo is stored as "snapshot.json", the first file in an account
+// snapshot.
+type AccountSnapshotInfo struct {
+	Version int // Format of snapshot, currently 1.
+	Account string
+	Created time.Time
+
+	// Configuration of the account when the snapshot was made, used when restoring to
+	// an instance that doesn't have the account configured.
+	Config config.Account
+}
+
+// AccountSnapshot writes a snapshot of an account to w, as gzip-compressed tar
+// file. The snapshot has the message database, including password, sessions and
+// settings, the junk filter and the message files. Login attempts and TLS public
+// keys for the account are not included. The account can be in use while making
+// a snapshot.
+func AccountSnapshot(ctx context.Context, account string, w io.Writer) (rerr error) {
+	log := pkglog.WithContext(ctx)
+	defer func() {
+		if rerr != nil {
+			log.Errorx("making account snapshot", rerr, slog.String("account", account))
+		}
+	}()
+
+	conf, ok := mox.Conf.Account(account)
+	if !ok {
+		return fmt.Errorf("%w: account does not exist", ErrRequest)
+	}
+	acc, err := store.OpenAccount(log, account, false)
+	if err != nil {
+		return fmt.Errorf("open account: %v", err)
+	}
+	defer func() {
+		err := acc.Close()
+		log.Check(err, "closing account after snapshot")
+	}()
+
+	gzw := gzip.NewWriter(w)
+	archiver := store.TarArchiver{Writer: tar.NewWriter(gzw)}
+
+	info := AccountSnapshotInfo{1, account, time.Now(), conf}
+	buf, err := json.MarshalIndent(info, "", "\t")
+	if err != nil {
+		return fmt.Errorf("marshal snapshot info: %v", err)
+	}
+	iw, err := archiver.Create("snapshot.json", int64(len(buf)), info.Created)
+	if err != nil {
+		return fmt.Errorf("adding snapshot info: %v", err)
+	}
+	if _, err := iw.Write(buf); err != nil {
+		return fmt.Errorf("writing snapshot info: %v", err)
+	}
+	if err := iw.Close(); err != nil {
+		return fmt.Errorf("closing snapshot info: %v", err)
+	}
+	if err := acc.Snapshot(ctx, log, archiver); err != nil {
+		return err
+	}
+	if err := archiver.Close(); err != nil {
+		return fmt.Errorf("closing tar: %v", err)
+	}
+	if err := gzw.Close(); err != nil {
+		return fmt.Errorf("closing gzip: %v", err)
+	}
+	log.Info("account snapshot made", slog.String("account", account))
+	return nil
+}
+
+// AccountRestore restores an account from a snapshot made with AccountSnapshot,
+// possibly under a different account name. If the account is not configured, it
+// is added with the configuration from the snapshot. The account must not be in
+// use, e.g. by IMAP or webmail sessions. An existing account data directory is
+// moved into the "tmp" directory of the data directory, its path is returned.
+func AccountRestore(ctx context.Context, account string, r io.Reader) (oldDir string, rerr error) {
+	log := pkglog.WithContext(ctx)
+	defer func() {
+		if rerr != nil {
+			log.Errorx("restoring account snapshot", rerr, slog.String("account", account))
+		}
+	}()
+
+	if account == "" || strings.ContainsAny(account, `/\`) || account == "." || account == ".." {
+		return "", fmt.Errorf("%w: invalid account name", ErrRequest)
+	}
+
+	// Extract to a directory in the data directory, so we can move it into place.
+	tmpdir := mox.DataDirPath("tmp")
+	os.MkdirAll(tmpdir, 0770)
+	dir, err := os.MkdirTemp(tmpdir, "accountrestore-")
+	if err != nil {
+		return "", fmt.Errorf("making temporary directory: %v", err)
+	}
+	defer func() {
+		if dir != "" {
+			err := os.RemoveAll(dir)
+			log.Check(err, "removing temporary directory for restore", slog.String("dir", dir))
+		}
+	}()
+
+	info, err := extractAccountSnapshot(r, dir)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrRequest, err)
+	}
+	if err := checkAccountSnapshot(ctx, log, dir); err != nil {
+		return "", fmt.Errorf("%w: checking snapshot: %v", ErrRequest, err)
+	}
+
+	defer mox.Conf.DynamicLockUnlock()()
+
+	c := mox.Conf.Dynamic
+	if _, ok := c.Accounts[account]; !ok {
+		nc := c
+		nc.Accounts = map[string]config.Account{}
+		for name, a := range c.Accounts {
+			nc.Accounts[name] = a
+		}
+		nc.Accounts[account] = info.Config
+		if err := mox.WriteDynamicLocked(ctx, log, nc); err != nil {
+			return "", fmt.Errorf("%w: adding account with configuration from snapshot: %v", ErrRequest, err)
+		}
+		log.Info("account added from snapshot", slog.String("account", account))
+		adminHookLocked(ctx, log, webhook.Admin{Event: webhook.EventAccountAdded, Account: account})
+	}
+
+	oldDir, err = store.ReplaceAccountDir(log, account, dir)
+	if err != nil {
+		return "", err
+	}
+	dir = ""
+	log.Info("account restored from snapshot",
+		slog.String("account", account),
+		slog.String("snapshotaccount", info.Account),
+		slog.Time("snapshotcreated", info.Created),
+		slog.String("olddir", oldDir))
+	return oldDir, nil
+}
+
+// extractAccountSnapshot extracts the files from a snapshot into dir, returning
+// the snapshot info.
+func extractAccountSnapshot(r io.Reader, dir string) (info AccountSnapshotInfo, rerr error) {
+	gzr, err := gzip.NewReader(r)
+	if err != nil {
+		return info, fmt.Errorf("gzip reader: %v", err)
+	}
+	tr := tar.NewReader(gzr)
+
+	// Only files that we write in a snapshot are allowed.
+	validName := func(name string) bool {
+		switch name {
+		case "index.db", "junkfilter.db", "junkfilter.bloom":
+			return true
+		}
+		t := strings.Split(name, "/")
+		switch {
+		case len(t) == 2 && t[0] == "pack":
+			_, err := strconv.ParseInt(t[1], 10, 64)
+			return err == nil
+		case len(t) == 3 && t[0] == "msg":
+			id, err := strconv.ParseInt(t[2], 10, 64)
+			return err == nil && path.Join(t[1:]...) == filepath.ToSlash(store.MessagePath(id))
+		}
+		return false
+	}
+
+	var haveInfo, haveDB bool
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return info, fmt.Errorf("reading tar: %v", err)
+		}
+		if h.Typeflag != tar.TypeReg {
+			return info, fmt.Errorf("unexpected file type for %q in snapshot", h.Name)
+		}
+
+		if !haveInfo {
+			if h.Name != "snapshot.json" {
+				return info, fmt.Errorf("snapshot does not start with snapshot.json")
+			}
+			if err := json.NewDecoder(io.LimitReader(tr, 1024*1024)).Decode(&info); err != nil {
+				return info, fmt.Errorf("parsing snapshot.json: %v", err)
+			}
+			if info.Version != 1 {
+				return info, fmt.Errorf("unsupported snapshot version %d", info.Version)
+			}
+			haveInfo = true
+			continue
+		}
+
+		if !validName(h.Name) {
+			return info, fmt.Errorf("unexpected file %q in snapshot", h.Name)
+		}
+		haveDB = haveDB || h.Name == "index.db"
+		p := filepath.Join(dir, filepath.FromSlash(h.Name))
+		os.MkdirAll(filepath.Dir(p), 0770)
+		f, err := os.OpenFile(p, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0660)
+		if err != nil {
+			return info, fmt.Errorf("creating file: %v", err)
+		}
+		_, err = io.Copy(f, tr)
+		if xerr := f.Close(); err == nil {
+			err = xerr
+		}
+		if err != nil {
+			return info, fmt.Errorf("writing file %s: %v", h.Name, err)
+		}
+	}
+	if !haveInfo || !haveDB {
+		return info, fmt.Errorf("incomplete snapshot, missing snapshot.json or index.db")
+	}
+	return info, nil
+}
+
+// checkAccountSnapshot checks that the extracted database can be opened and the
+// files for its messages are present.
+func checkAccountSnapshot(ctx context.Context, log mlog.Log, dir string) (rerr error) {
+	opts := bstore.Options{MustExist: true, RegisterLogger: log.Logger}
+	db, err := bstore.Open(ctx, filepath.Join(dir, "index.db"), &opts, store.DBTypes...)
+	if err != nil {
+		return fmt.Errorf("open database: %v", err)
+	}
+	defer func() {
+		err := db.Close()
+		log.Check(err, "closing database from snapshot")
+	}()
+
+	return db.Read(ctx, func(tx *bstore.Tx) error {
+		err := bstore.QueryTx[store.Message](tx).FilterEqual("Expunged", false).ForEach(func(m store.Message) error {
+			if m.PackID != 0 {
+				return nil
+			}
+			size := m.Size - int64(len(m.MsgPrefix))
+			if m.CompressedSize > 0 {
+				size = m.CompressedSize
+			} else if m.Encrypted {
+				size = store.EncryptedFileSize(size)
+			}
+			p := filepath.Join(dir, "msg", store.MessagePath(m.ID))
+			if fi, err := os.Stat(p); err != nil {
+				return fmt.Errorf("message %d: %v", m.ID, err)
+			} else if fi.Size() != size {
+				return fmt.Errorf("message %d: file has size %d, expected %d", m.ID, fi.Size(), size)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		return bstore.QueryTx[store.Pack](tx).ForEach(func(pack store.Pack) error {
+			if _, err := os.Stat(filepath.Join(dir, "pack", strconv.FormatInt(pack.ID, 10))); err != nil {
+				return fmt.Errorf("pack %d: %v", pack.ID, err)
+			}
+			return nil
+		})
+	})
+}
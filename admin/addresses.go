@@ -0,0 +1,189 @@
+package admin
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+
+	"golang.org/x/exp/maps"
+
+	"github.com/mjl-/mox/config"
+	"github.com/mjl-/mox/mox-"
+	"github.com/mjl-/mox/webhook"
+)
+
+// AddressEntry is an address configured for an account, as returned by
+// AddressSearch.
+type AddressEntry struct {
+	Address  string // Email address, or catchall address of the form "@<domain>".
+	Account  string
+	Disabled bool
+}
+
+// AddressSearch returns the configured addresses of accounts that contain query
+// in their address or account name, case-insensitively. An empty query matches
+// all addresses. The addresses are sorted, and the page starting at offset with at
+// most limit entries is returned, along with the total number of matching
+// addresses. For domain admins, only addresses in their domains are returned.
+func AddressSearch(ctx context.Context, query string, offset, limit int) (addresses []AddressEntry, total int, rerr error) {
+	if offset < 0 {
+		return nil, 0, fmt.Errorf("%w: negative offset", ErrRequest)
+	}
+	if limit <= 0 || limit > 1000 {
+		limit = 1000
+	}
+	query = strings.ToLower(query)
+
+	defer mox.Conf.DynamicLockUnlock()()
+
+	var l []AddressEntry
+	for accName, acc := range mox.Conf.Dynamic.Accounts {
+		for addr, dest := range acc.Destinations {
+			if query != "" && !strings.Contains(strings.ToLower(addr), query) && !strings.Contains(strings.ToLower(accName), query) {
+				continue
+			}
+			if checkAddressLocked(ctx, addr) != nil {
+				continue
+			}
+			l = append(l, AddressEntry{addr, accName, dest.Disabled})
+		}
+	}
+	sort.Slice(l, func(i, j int) bool {
+		return l[i].Address < l[j].Address
+	})
+
+	total = len(l)
+	if offset >= total {
+		return []AddressEntry{}, total, nil
+	}
+	return l[offset:min(offset+limit, total)], total, nil
+}
+
+// AddressesMove moves addresses from their current accounts to account, with
+// their destination configuration, and reloads the configuration. Messages
+// already delivered stay in the original account. Either all addresses are moved,
+// or none are.
+func AddressesMove(ctx context.Context, addresses []string, account string) (rerr error) {
+	log := pkglog.WithContext(ctx)
+	defer func() {
+		if rerr != nil {
+			log.Errorx("moving addresses", rerr, slog.Any("addresses", addresses), slog.String("account", account))
+		}
+	}()
+
+	defer mox.Conf.DynamicLockUnlock()()
+
+	c := mox.Conf.Dynamic
+	if _, ok := c.Accounts[account]; !ok {
+		return fmt.Errorf("%w: account does not exist", ErrRequest)
+	}
+	if err := checkAccountLocked(ctx, account); err != nil {
+		return err
+	}
+
+	// Compose new config without modifying existing data structures. If we fail, we
+	// leave no trace. Destinations and FromIDLoginAddresses are replaced for each
+	// changed account.
+	nc := c
+	nc.Accounts = maps.Clone(c.Accounts)
+	changed := map[string]bool{}
+	for _, address := range addresses {
+		ad, ok := mox.Conf.AccountDestinationsLocked[address]
+		if !ok {
+			return fmt.Errorf("%w: address %q does not exist", ErrRequest, address)
+		} else if ad.Account == account {
+			return fmt.Errorf("%w: address %q already belongs to account", ErrRequest, address)
+		}
+		if err := checkAccountLocked(ctx, ad.Account); err != nil {
+			return err
+		}
+
+		src := nc.Accounts[ad.Account]
+		dest, ok := src.Destinations[address]
+		if !ok {
+			return fmt.Errorf("%w: address %q not moved, likely a postmaster/reporting address", ErrRequest, address)
+		}
+		fromIDLoginAddresses, err := addressReleaseLocked(ctx, src, ad, address, "moving")
+		if err != nil {
+			return err
+		}
+		if !changed[ad.Account] {
+			src.Destinations = maps.Clone(src.Destinations)
+			changed[ad.Account] = true
+		}
+		delete(src.Destinations, address)
+		src.FromIDLoginAddresses = fromIDLoginAddresses
+		src.Aliases = nil // Filled when parsing config.
+		nc.Accounts[ad.Account] = src
+
+		dst := nc.Accounts[account]
+		if !changed[account] {
+			dst.Destinations = maps.Clone(dst.Destinations)
+			if dst.Destinations == nil {
+				dst.Destinations = map[string]config.Destination{}
+			}
+			changed[account] = true
+		}
+		dst.Destinations[address] = dest
+		dst.Aliases = nil // Filled when parsing config.
+		nc.Accounts[account] = dst
+	}
+
+	if err := mox.WriteDynamicLocked(ctx, log, nc); err != nil {
+		return fmt.Errorf("writing domains.conf: %w", err)
+	}
+	log.Info("addresses moved", slog.Any("addresses", addresses), slog.String("account", account))
+	for _, address := range addresses {
+		adminHookLocked(ctx, log, webhook.Admin{Event: webhook.EventAddressMoved, Domain: addressDomain(address), Account: account, Address: address})
+	}
+	return nil
+}
+
+// AddressesDisable disables or enables addresses, and reloads the configuration.
+// Disabled addresses are treated as if they don't exist, but keep their
+// destination configuration. Either all addresses are changed, or none are.
+func AddressesDisable(ctx context.Context, addresses []string, disabled bool) (rerr error) {
+	log := pkglog.WithContext(ctx)
+	defer func() {
+		if rerr != nil {
+			log.Errorx("changing disabled for addresses", rerr, slog.Any("addresses", addresses), slog.Bool("disabled", disabled))
+		}
+	}()
+
+	defer mox.Conf.DynamicLockUnlock()()
+
+	c := mox.Conf.Dynamic
+	nc := c
+	nc.Accounts = maps.Clone(c.Accounts)
+	changed := map[string]bool{}
+	for _, address := range addresses {
+		ad, ok := mox.Conf.AccountDestinationsLocked[address]
+		if !ok {
+			return fmt.Errorf("%w: address %q does not exist", ErrRequest, address)
+		}
+		if err := checkAccountLocked(ctx, ad.Account); err != nil {
+			return err
+		}
+
+		acc := nc.Accounts[ad.Account]
+		dest, ok := acc.Destinations[address]
+		if !ok {
+			return fmt.Errorf("%w: address %q not changed, likely a postmaster/reporting address", ErrRequest, address)
+		}
+		if !changed[ad.Account] {
+			acc.Destinations = maps.Clone(acc.Destinations)
+			changed[ad.Account] = true
+		}
+		dest.Disabled = disabled
+		acc.Destinations[address] = dest
+		nc.Accounts[ad.Account] = acc
+	}
+
+	if err := mox.WriteDynamicLocked(ctx, log, nc); err != nil {
+		return fmt.Errorf("writing domains.conf: %w", err)
+	}
+	log.Info("changed disabled for addresses", slog.Any("addresses", addresses), slog.Bool("disabled", disabled))
+	return nil
+}
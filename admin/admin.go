@@ -25,8 +25,10 @@ import (
 	"github.com/mjl-/mox/mlog"
 	"github.com/mjl-/mox/mox-"
 	"github.com/mjl-/mox/mtasts"
+	"github.com/mjl-/mox/queue"
 	"github.com/mjl-/mox/smtp"
 	"github.com/mjl-/mox/store"
+	"github.com/mjl-/mox/webhook"
 )
 
 var pkglog = mlog.New("admin", nil)
@@ -128,6 +130,29 @@ func MakeAccountConfig(addr smtp.Address) config.Account {
 	return account
 }
 
+// applyAccountTemplate changes the new account configuration acc, with initial
+// address addr, with the settings of the account template.
+func applyAccountTemplate(acc *config.Account, addr smtp.Address, template string, t config.AccountTemplate) {
+	acc.Template = template
+	if t.JunkFilter != nil {
+		jf := *t.JunkFilter
+		acc.JunkFilter = &jf
+	}
+	if len(t.Rulesets) > 0 {
+		acc.Destinations[addr.String()] = config.Destination{Rulesets: slices.Clone(t.Rulesets)}
+	}
+	acc.QuotaMessageSize = t.QuotaMessageSize
+	acc.MaxOutgoingMessagesPerDay = t.MaxOutgoingMessagesPerDay
+	acc.MaxFirstTimeRecipientsPerDay = t.MaxFirstTimeRecipientsPerDay
+}
+
+// AccountTemplates returns the names of the account templates, sorted.
+func AccountTemplates() []string {
+	l := maps.Keys(mox.Conf.Static.AccountTemplates)
+	slices.Sort(l)
+	return l
+}
+
 func writeFile(log mlog.Log, path string, data []byte) error {
 	os.MkdirAll(filepath.Dir(path), 0770)
 
@@ -296,6 +321,10 @@ func DKIMAdd(ctx context.Context, domain, selector dns.Domain, algorithm, hash s
 	// Only take lock now, we don't want to hold it while generating a key.
 	defer mox.Conf.DynamicLockUnlock()()
 
+	if err := checkDomainLocked(ctx, domain); err != nil {
+		return err
+	}
+
 	c := mox.Conf.Dynamic
 	d, ok := c.Domains[domain.Name()]
 	if !ok {
@@ -352,6 +381,7 @@ func DKIMAdd(ctx context.Context, domain, selector dns.Domain, algorithm, hash s
 	}
 
 	log.Info("dkim key added", slog.Any("domain", domain), slog.Any("selector", selector))
+	adminHookLocked(ctx, log, webhook.Admin{Event: webhook.EventDKIMAdded, Domain: domain.Name(), Selector: selector.Name()})
 	removePath = "" // Prevent cleanup of key file.
 	return nil
 }
@@ -369,6 +399,10 @@ func DKIMRemove(ctx context.Context, domain, selector dns.Domain) (rerr error) {
 
 	defer mox.Conf.DynamicLockUnlock()()
 
+	if err := checkDomainLocked(ctx, domain); err != nil {
+		return err
+	}
+
 	c := mox.Conf.Dynamic
 	d, ok := c.Domains[domain.Name()]
 	if !ok {
@@ -412,6 +446,7 @@ func DKIMRemove(ctx context.Context, domain, selector dns.Domain) (rerr error) {
 	moveAwayKeys(log, map[string]config.Selector{selector.Name(): sel}, usedKeyPaths)
 
 	log.Info("dkim key removed", slog.Any("domain", domain), slog.Any("selector", selector))
+	adminHookLocked(ctx, log, webhook.Admin{Event: webhook.EventDKIMRemoved, Domain: domain.Name(), Selector: selector.Name()})
 	return nil
 }
 
@@ -424,7 +459,7 @@ func DKIMRemove(ctx context.Context, domain, selector dns.Domain) (rerr error) {
 func DomainAdd(ctx context.Context, disabled bool, domain dns.Domain, accountName string, localpart smtp.Localpart) (rerr error) {
 	log := pkglog.WithContext(ctx)
 	defer func() {
-		if rerr != nil {
+		if rerr != nil && !errors.Is(rerr, mox.ErrDryRun) {
 			log.Errorx("adding domain", rerr,
 				slog.Any("disabled", disabled),
 				slog.Any("domain", domain),
@@ -435,10 +470,19 @@ func DomainAdd(ctx context.Context, disabled bool, domain dns.Domain, accountNam
 
 	defer mox.Conf.DynamicLockUnlock()()
 
+	if err := checkDomainLocked(ctx, domain); err != nil {
+		return err
+	}
+
 	c := mox.Conf.Dynamic
 	if _, ok := c.Domains[domain.Name()]; ok {
 		return fmt.Errorf("%w: domain already present", ErrRequest)
 	}
+	if _, ok := c.Accounts[accountName]; ok {
+		if err := checkAccountLocked(ctx, accountName); err != nil {
+			return err
+		}
+	}
 
 	// Compose new config without modifying existing data structures. If we fail, we
 	// leave no trace.
@@ -447,6 +491,7 @@ func DomainAdd(ctx context.Context, disabled bool, domain dns.Domain, accountNam
 	for name, d := range c.Domains {
 		nc.Domains[name] = d
 	}
+	nc.Accounts = maps.Clone(c.Accounts)
 
 	// Only enable mta-sts for domain if there is a listener with mta-sts.
 	var withMTASTS bool
@@ -495,6 +540,7 @@ func DomainAdd(ctx context.Context, disabled bool, domain dns.Domain, accountNam
 		return fmt.Errorf("writing domains.conf: %w", err)
 	}
 	log.Info("domain added", slog.Any("domain", domain), slog.Bool("disabled", disabled))
+	adminHookLocked(ctx, log, webhook.Admin{Event: webhook.EventDomainAdded, Domain: domain.Name()})
 	cleanupFiles = nil // All good, don't cleanup.
 	return nil
 }
@@ -512,6 +558,10 @@ func DomainRemove(ctx context.Context, domain dns.Domain) (rerr error) {
 
 	defer mox.Conf.DynamicLockUnlock()()
 
+	if err := checkDomainLocked(ctx, domain); err != nil {
+		return err
+	}
+
 	c := mox.Conf.Dynamic
 	domConf, ok := c.Domains[domain.Name()]
 	if !ok {
@@ -551,6 +601,7 @@ func DomainRemove(ctx context.Context, domain dns.Domain) (rerr error) {
 	moveAwayKeys(log, domConf.DKIM.Selectors, usedKeyPaths)
 
 	log.Info("domain removed", slog.Any("domain", domain))
+	adminHookLocked(ctx, log, webhook.Admin{Event: webhook.EventDomainRemoved, Domain: domain.Name()})
 	return nil
 }
 
@@ -603,6 +654,9 @@ func DomainSave(ctx context.Context, domainName string, xmodify func(config *con
 	if !ok {
 		return fmt.Errorf("%w: domain not present", ErrRequest)
 	}
+	if err := checkDomainLocked(ctx, dom.Domain); err != nil {
+		return err
+	}
 
 	if err := xmodify(&dom); err != nil {
 		return err
@@ -638,6 +692,10 @@ func ConfigSave(ctx context.Context, xmodify func(config *config.Dynamic)) (rerr
 
 	defer mox.Conf.DynamicLockUnlock()()
 
+	if err := checkGlobal(ctx); err != nil {
+		return err
+	}
+
 	nc := mox.Conf.Dynamic // Shallow copy.
 	xmodify(&nc)
 
@@ -654,12 +712,15 @@ func ConfigSave(ctx context.Context, xmodify func(config *config.Dynamic)) (rerr
 // The new account does not have a password, so cannot yet log in. Email can be
 // delivered.
 //
+// If template is not empty, the account is configured with the settings of the
+// account template from the static configuration.
+//
 // Catchall addresses are not supported for AccountAdd. Add separately with AddressAdd.
-func AccountAdd(ctx context.Context, account, address string) (rerr error) {
+func AccountAdd(ctx context.Context, account, address, template string) (rerr error) {
 	log := pkglog.WithContext(ctx)
 	defer func() {
 		if rerr != nil {
-			log.Errorx("adding account", rerr, slog.String("account", account), slog.String("address", address))
+			log.Errorx("adding account", rerr, slog.String("account", account), slog.String("address", address), slog.String("template", template))
 		}
 	}()
 
@@ -670,6 +731,10 @@ func AccountAdd(ctx context.Context, account, address string) (rerr error) {
 
 	defer mox.Conf.DynamicLockUnlock()()
 
+	if err := checkDomainLocked(ctx, addr.Domain); err != nil {
+		return err
+	}
+
 	c := mox.Conf.Dynamic
 	if _, ok := c.Accounts[account]; ok {
 		return fmt.Errorf("%w: account already present", ErrRequest)
@@ -686,12 +751,21 @@ func AccountAdd(ctx context.Context, account, address string) (rerr error) {
 	for name, a := range c.Accounts {
 		nc.Accounts[name] = a
 	}
-	nc.Accounts[account] = MakeAccountConfig(addr)
+	acc := MakeAccountConfig(addr)
+	if template != "" {
+		t, ok := mox.Conf.Static.AccountTemplates[template]
+		if !ok {
+			return fmt.Errorf("%w: account template does not exist", ErrRequest)
+		}
+		applyAccountTemplate(&acc, addr, template, t)
+	}
+	nc.Accounts[account] = acc
 
 	if err := mox.WriteDynamicLocked(ctx, log, nc); err != nil {
 		return fmt.Errorf("writing domains.conf: %w", err)
 	}
-	log.Info("account added", slog.String("account", account), slog.Any("address", addr))
+	log.Info("account added", slog.String("account", account), slog.Any("address", addr), slog.String("template", template))
+	adminHookLocked(ctx, log, webhook.Admin{Event: webhook.EventAccountAdded, Account: account, Address: addr.String()})
 	return nil
 }
 
@@ -710,6 +784,9 @@ func AccountRemove(ctx context.Context, account string) (rerr error) {
 	if _, ok := c.Accounts[account]; !ok {
 		return fmt.Errorf("%w: account does not exist", ErrRequest)
 	}
+	if err := checkAccountLocked(ctx, account); err != nil {
+		return err
+	}
 
 	// Compose new config without modifying existing data structures. If we fail, we
 	// leave no trace.
@@ -724,6 +801,7 @@ func AccountRemove(ctx context.Context, account string) (rerr error) {
 	if err := mox.WriteDynamicLocked(ctx, log, nc); err != nil {
 		return fmt.Errorf("writing domains.conf: %w", err)
 	}
+	adminHookLocked(ctx, log, webhook.Admin{Event: webhook.EventAccountRemoved, Account: account})
 
 	odir := filepath.Join(mox.DataDirPath("accounts"), account)
 	tmpdir := filepath.Join(mox.DataDirPath("tmp"), "oldaccount-"+account)
@@ -741,15 +819,47 @@ func AccountRemove(ctx context.Context, account string) (rerr error) {
 		return fmt.Errorf("account removed, but removing tls public keys failed: %v", err)
 	}
 
+	if err := store.OpenPGPKeyRemoveForAccount(context.Background(), account); err != nil {
+		log.Errorx("removing openpgp keys for removed account", err)
+		return fmt.Errorf("account removed, but removing openpgp keys failed: %v", err)
+	}
+
 	if err := store.LoginAttemptRemoveAccount(context.Background(), account); err != nil {
 		log.Errorx("removing historic login attempts for removed account", err)
 		return fmt.Errorf("account removed, but removing historic login attempts failed: %v", err)
 	}
 
+	if err := store.IMAPClientRemoveAccount(context.Background(), account); err != nil {
+		log.Errorx("removing imap clients for removed account", err)
+		return fmt.Errorf("account removed, but removing imap clients failed: %v", err)
+	}
+
 	log.Info("account removed", slog.String("account", account))
 	return nil
 }
 
+// addressDomain returns the domain of an address, or of a catchall address of
+// the form "@<domain>", or of a wildcard address of the form "...@*.<domain>".
+func addressDomain(address string) string {
+	t := strings.Split(address, "@")
+	return strings.TrimPrefix(t[len(t)-1], "*.")
+}
+
+// adminHookLocked schedules a webhook for an admin event, if an admin webhook is
+// configured. The change has already been made, so errors are only logged.
+//
+// Must be called with config lock held.
+func adminHookLocked(ctx context.Context, log mlog.Log, data webhook.Admin) {
+	wh := mox.Conf.Dynamic.AdminWebhook
+	if wh == nil {
+		return
+	}
+	data.Time = time.Now()
+	data.DomainAdmin = DomainAdminName(ctx)
+	err := queue.HookAdmin(ctx, log, *wh, data)
+	log.Check(err, "scheduling webhook for admin event", slog.String("event", string(data.Event)))
+}
+
 // checkAddressAvailable checks that the address after canonicalization is not
 // already configured, and that its localpart does not contain the catchall
 // localpart separator.
@@ -772,7 +882,9 @@ func checkAddressAvailable(addr smtp.Address) error {
 }
 
 // AddressAdd adds an email address to an account and reloads the configuration. If
-// address starts with an @ it is treated as a catchall address for the domain.
+// address starts with an @ it is treated as a catchall address for the domain. If
+// its domain starts with "*.", e.g. "info@*.example.com" or "@*.example.com", it is
+// a wildcard address for all subdomains of the domain.
 func AddressAdd(ctx context.Context, address, account string) (rerr error) {
 	log := pkglog.WithContext(ctx)
 	defer func() {
@@ -788,9 +900,28 @@ func AddressAdd(ctx context.Context, address, account string) (rerr error) {
 	if !ok {
 		return fmt.Errorf("%w: account does not exist", ErrRequest)
 	}
+	if err := checkAccountLocked(ctx, account); err != nil {
+		return err
+	} else if err := checkAddressLocked(ctx, address); err != nil {
+		return err
+	}
 
 	var destAddr string
-	if strings.HasPrefix(address, "@") {
+	if lp, d, ok, err := mox.ParseWildcardAddress(address); ok {
+		if err != nil {
+			return fmt.Errorf("%w: parsing wildcard address: %v", ErrRequest, err)
+		}
+		dc, ok := mox.Conf.Dynamic.Domains[d.Name()]
+		if !ok {
+			return fmt.Errorf("%w: domain does not exist", ErrRequest)
+		} else if dc.LocalpartCatchallSeparator != "" && strings.Contains(string(lp), dc.LocalpartCatchallSeparator) {
+			return fmt.Errorf("%w: localpart cannot include domain catchall separator %s", ErrRequest, dc.LocalpartCatchallSeparator)
+		}
+		destAddr = mox.WildcardAddress(mox.CanonicalLocalpart(lp, dc), d)
+		if _, ok := mox.Conf.AccountDestinationsLocked[destAddr]; ok {
+			return fmt.Errorf("%w: wildcard address already configured", ErrRequest)
+		}
+	} else if strings.HasPrefix(address, "@") {
 		d, err := dns.ParseDomain(address[1:])
 		if err != nil {
 			return fmt.Errorf("%w: parsing domain: %v", ErrRequest, err)
@@ -833,69 +964,40 @@ func AddressAdd(ctx context.Context, address, account string) (rerr error) {
 		return fmt.Errorf("writing domains.conf: %w", err)
 	}
 	log.Info("address added", slog.String("address", address), slog.String("account", account))
+	adminHookLocked(ctx, log, webhook.Admin{Event: webhook.EventAddressAdded, Domain: addressDomain(destAddr), Account: account, Address: destAddr})
 	return nil
 }
 
-// AddressRemove removes an email address and reloads the configuration.
-// Address can be a catchall address for the domain of the form "@<domain>".
+// addressReleaseLocked returns the FromIDLoginAddresses of account a without
+// address, for removing address from the account. An error is returned if a TLS
+// public key of the account references the address as login address. Verb is
+// used in the error message.
 //
-// If the address is member of an alias, remove it from from the alias, unless it
-// is the last member.
-func AddressRemove(ctx context.Context, address string) (rerr error) {
-	log := pkglog.WithContext(ctx)
-	defer func() {
-		if rerr != nil {
-			log.Errorx("removing address", rerr, slog.String("address", address))
-		}
-	}()
-
-	defer mox.Conf.DynamicLockUnlock()()
-
-	ad, ok := mox.Conf.AccountDestinationsLocked[address]
-	if !ok {
-		return fmt.Errorf("%w: address does not exists", ErrRequest)
-	}
-
-	// Compose new config without modifying existing data structures. If we fail, we
-	// leave no trace.
-	a, ok := mox.Conf.Dynamic.Accounts[ad.Account]
-	if !ok {
-		return fmt.Errorf("internal error: cannot find account")
-	}
-	na := a
-	na.Destinations = map[string]config.Destination{}
-	var dropped bool
-	for destAddr, d := range a.Destinations {
-		if destAddr != address {
-			na.Destinations[destAddr] = d
-		} else {
-			dropped = true
-		}
-	}
-	if !dropped {
-		return fmt.Errorf("%w: address not removed, likely a postmaster/reporting address", ErrRequest)
+// Must be called with config lock held.
+func addressReleaseLocked(ctx context.Context, a config.Account, ad mox.AccountDestination, address, verb string) ([]string, error) {
+	if ad.Wildcard {
+		// Wildcard addresses cannot be used as login address.
+		return a.FromIDLoginAddresses, nil
 	}
 
-	// Also remove matching address from FromIDLoginAddresses, composing a new slice.
-	// Refuse if address is referenced in a TLS public key.
 	var dom dns.Domain
 	var pa smtp.Address // For non-catchall addresses (most).
 	var err error
 	if strings.HasPrefix(address, "@") {
 		dom, err = dns.ParseDomain(address[1:])
 		if err != nil {
-			return fmt.Errorf("%w: parsing domain for catchall address: %v", ErrRequest, err)
+			return nil, fmt.Errorf("%w: parsing domain for catchall address: %v", ErrRequest, err)
 		}
 	} else {
 		pa, err = smtp.ParseAddress(address)
 		if err != nil {
-			return fmt.Errorf("%w: parsing address: %v", ErrRequest, err)
+			return nil, fmt.Errorf("%w: parsing address: %v", ErrRequest, err)
 		}
 		dom = pa.Domain
 	}
 	dc, ok := mox.Conf.Dynamic.Domains[dom.Name()]
 	if !ok {
-		return fmt.Errorf("%w: unknown domain in address %q", ErrRequest, address)
+		return nil, fmt.Errorf("%w: unknown domain in address %q", ErrRequest, address)
 	}
 
 	var fromIDLoginAddresses []string
@@ -915,24 +1017,76 @@ func AddressRemove(ctx context.Context, address string) (rerr error) {
 			fromIDLoginAddresses = append(fromIDLoginAddresses, a.FromIDLoginAddresses[i])
 		}
 	}
-	na.FromIDLoginAddresses = fromIDLoginAddresses
 
 	// Refuse if there is still a TLS public key that references this address.
 	tlspubkeys, err := store.TLSPublicKeyList(ctx, ad.Account)
 	if err != nil {
-		return fmt.Errorf("%w: listing tls public keys for account: %v", ErrRequest, err)
+		return nil, fmt.Errorf("%w: listing tls public keys for account: %v", ErrRequest, err)
 	}
 	for _, tpk := range tlspubkeys {
 		a, err := smtp.ParseAddress(tpk.LoginAddress)
 		if err != nil {
-			return fmt.Errorf("%w: parsing address from tls public key: %v", ErrRequest, err)
+			return nil, fmt.Errorf("%w: parsing address from tls public key: %v", ErrRequest, err)
 		}
 		lp := mox.CanonicalLocalpart(a.Localpart, dc)
 		ca := smtp.NewAddress(lp, a.Domain)
 		if xad, ok := mox.Conf.AccountDestinationsLocked[ca.String()]; ok && xad.Localpart == ad.Localpart {
-			return fmt.Errorf("%w: tls public key %q references this address as login address %q, remove the tls public key before removing the address", ErrRequest, tpk.Fingerprint, tpk.LoginAddress)
+			return nil, fmt.Errorf("%w: tls public key %q references this address as login address %q, remove the tls public key before %s the address", ErrRequest, tpk.Fingerprint, tpk.LoginAddress, verb)
 		}
 	}
+	return fromIDLoginAddresses, nil
+}
+
+// AddressRemove removes an email address and reloads the configuration.
+// Address can be a catchall address for the domain of the form "@<domain>".
+//
+// If the address is member of an alias, remove it from from the alias, unless it
+// is the last member.
+func AddressRemove(ctx context.Context, address string) (rerr error) {
+	log := pkglog.WithContext(ctx)
+	defer func() {
+		if rerr != nil && !errors.Is(rerr, mox.ErrDryRun) {
+			log.Errorx("removing address", rerr, slog.String("address", address))
+		}
+	}()
+
+	defer mox.Conf.DynamicLockUnlock()()
+
+	ad, ok := mox.Conf.AccountDestinationsLocked[address]
+	if !ok {
+		return fmt.Errorf("%w: address does not exists", ErrRequest)
+	}
+	if err := checkAccountLocked(ctx, ad.Account); err != nil {
+		return err
+	}
+
+	// Compose new config without modifying existing data structures. If we fail, we
+	// leave no trace.
+	a, ok := mox.Conf.Dynamic.Accounts[ad.Account]
+	if !ok {
+		return fmt.Errorf("internal error: cannot find account")
+	}
+	na := a
+	na.Destinations = map[string]config.Destination{}
+	var dropped bool
+	for destAddr, d := range a.Destinations {
+		if destAddr != address {
+			na.Destinations[destAddr] = d
+		} else {
+			dropped = true
+		}
+	}
+	if !dropped {
+		return fmt.Errorf("%w: address not removed, likely a postmaster/reporting address", ErrRequest)
+	}
+
+	// Also remove matching address from FromIDLoginAddresses, composing a new slice.
+	// Refuse if address is referenced in a TLS public key.
+	var err error
+	na.FromIDLoginAddresses, err = addressReleaseLocked(ctx, a, ad, address, "removing")
+	if err != nil {
+		return err
+	}
 
 	// And remove as member from aliases configured in domains.
 	domains := maps.Clone(mox.Conf.Dynamic.Domains)
@@ -975,11 +1129,17 @@ func AddressRemove(ctx context.Context, address string) (rerr error) {
 		return fmt.Errorf("writing domains.conf: %w", err)
 	}
 	log.Info("address removed", slog.String("address", address), slog.String("account", ad.Account))
+	adminHookLocked(ctx, log, webhook.Admin{Event: webhook.EventAddressRemoved, Domain: addressDomain(address), Account: ad.Account, Address: address})
 	return nil
 }
 
 func AliasAdd(ctx context.Context, addr smtp.Address, alias config.Alias) error {
 	return DomainSave(ctx, addr.Domain.Name(), func(d *config.Domain) error {
+		for _, a := range alias.Addresses {
+			if err := checkAliasMemberLocked(ctx, a); err != nil {
+				return err
+			}
+		}
 		if _, ok := d.Aliases[addr.Localpart.String()]; ok {
 			return fmt.Errorf("%w: alias already present", ErrRequest)
 		}
@@ -1028,6 +1188,11 @@ func AliasAddressesAdd(ctx context.Context, addr smtp.Address, addresses []strin
 		if !ok {
 			return fmt.Errorf("%w: no such alias", ErrRequest)
 		}
+		for _, a := range addresses {
+			if err := checkAliasMemberLocked(ctx, a); err != nil {
+				return err
+			}
+		}
 		alias.Addresses = append(slices.Clone(alias.Addresses), addresses...)
 		alias.ParsedAddresses = nil
 		d.Aliases = maps.Clone(d.Aliases)
@@ -1068,7 +1233,7 @@ func AliasAddressesRemove(ctx context.Context, addr smtp.Address, addresses []st
 func AccountSave(ctx context.Context, account string, xmodify func(acc *config.Account)) (rerr error) {
 	log := pkglog.WithContext(ctx)
 	defer func() {
-		if rerr != nil {
+		if rerr != nil && !errors.Is(rerr, mox.ErrDryRun) {
 			log.Errorx("saving account fields", rerr, slog.String("account", account))
 		}
 	}()
@@ -1080,6 +1245,9 @@ func AccountSave(ctx context.Context, account string, xmodify func(acc *config.A
 	if !ok {
 		return fmt.Errorf("%w: account not present", ErrRequest)
 	}
+	if err := checkAccountLocked(ctx, account); err != nil {
+		return err
+	}
 
 	xmodify(&acc)
 
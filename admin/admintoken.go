@@ -0,0 +1,98 @@
+package admin
+
+import (
+	"context"
+	cryptorand "crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"log/slog"
+	"slices"
+
+	"golang.org/x/exp/maps"
+
+	"github.com/mjl-/mox/config"
+	"github.com/mjl-/mox/mox-"
+)
+
+// AdminTokenHash returns the hash of an admin API token as stored in the config.
+func AdminTokenHash(token string) string {
+	h := sha256.Sum256([]byte(token))
+	return base64.StdEncoding.EncodeToString(h[:])
+}
+
+// AdminTokenAdd adds a new admin API token, returning the token. Only the hash of
+// the token is stored. If functions is non-empty, the token can only call those
+// API functions. If domainAdmin is non-empty, the token has the permissions of
+// that domain admin.
+func AdminTokenAdd(ctx context.Context, name string, functions []string, domainAdmin string) (token string, rerr error) {
+	log := pkglog.WithContext(ctx)
+	defer func() {
+		if rerr != nil {
+			log.Errorx("adding admin token", rerr, slog.String("name", name))
+		}
+	}()
+
+	var buf [24]byte
+	if _, err := cryptorand.Read(buf[:]); err != nil {
+		return "", fmt.Errorf("generating token: %v", err)
+	}
+	token = "moxadmin-" + base64.RawURLEncoding.EncodeToString(buf[:])
+
+	defer mox.Conf.DynamicLockUnlock()()
+
+	if err := checkGlobal(ctx); err != nil {
+		return "", err
+	}
+	c := mox.Conf.Dynamic
+	if _, ok := c.AdminTokens[name]; ok {
+		return "", fmt.Errorf("%w: admin token already exists", ErrRequest)
+	}
+
+	nc := c
+	nc.AdminTokens = maps.Clone(c.AdminTokens)
+	if nc.AdminTokens == nil {
+		nc.AdminTokens = map[string]config.AdminToken{}
+	}
+	nc.AdminTokens[name] = config.AdminToken{
+		TokenHash:   AdminTokenHash(token),
+		Functions:   slices.Clone(functions),
+		DomainAdmin: domainAdmin,
+	}
+
+	if err := mox.WriteDynamicLocked(ctx, log, nc); err != nil {
+		return "", fmt.Errorf("writing domains.conf: %w", err)
+	}
+	log.Info("admin token added", slog.String("name", name), slog.Any("functions", functions), slog.String("domainadmin", domainAdmin))
+	return token, nil
+}
+
+// AdminTokenRemove removes an admin API token. It can no longer be used.
+func AdminTokenRemove(ctx context.Context, name string) (rerr error) {
+	log := pkglog.WithContext(ctx)
+	defer func() {
+		if rerr != nil {
+			log.Errorx("removing admin token", rerr, slog.String("name", name))
+		}
+	}()
+
+	defer mox.Conf.DynamicLockUnlock()()
+
+	if err := checkGlobal(ctx); err != nil {
+		return err
+	}
+	c := mox.Conf.Dynamic
+	if _, ok := c.AdminTokens[name]; !ok {
+		return fmt.Errorf("%w: admin token does not exist", ErrRequest)
+	}
+
+	nc := c
+	nc.AdminTokens = maps.Clone(c.AdminTokens)
+	delete(nc.AdminTokens, name)
+
+	if err := mox.WriteDynamicLocked(ctx, log, nc); err != nil {
+		return fmt.Errorf("writing domains.conf: %w", err)
+	}
+	log.Info("admin token removed", slog.String("name", name))
+	return nil
+}
@@ -0,0 +1,369 @@
+package admin
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// DNSRecordFormats are the formats for DomainRecordsExport. "zone" is the
+// annotated zone file as returned by DomainRecords. "cloudflare" is a JSON array
+// with objects for the Cloudflare API for creating DNS records. "route53" is a
+// JSON change batch for the AWS Route53 API, e.g. for "aws route53
+// change-resource-record-sets". "terraform" has HCL with aws_route53_record
+// resources.
+var DNSRecordFormats = []string{"zone", "cloudflare", "route53", "terraform"}
+
+// DNSRecord is a record from the zone file returned by DomainRecords.
+type DNSRecord struct {
+	Name string // Absolute, with trailing dot.
+	TTL  int
+	Type string   // E.g. "MX", "TXT".
+	Data []string // Fields of the record data, with quoted strings unquoted. For TXT, the strings.
+}
+
+// ParseDomainRecords parses the zone file lines as returned by DomainRecords.
+// Comments, including commented-out records, are skipped.
+func ParseDomainRecords(lines []string) ([]DNSRecord, error) {
+	type token struct {
+		s      string
+		quoted bool
+	}
+
+	// Tokenize into logical lines. Newlines inside parentheses don't end a line.
+	var zlines [][]token
+	var cur []token
+	var paren bool
+	s := strings.Join(lines, "\n") + "\n"
+	for i := 0; i < len(s); {
+		switch c := s[i]; c {
+		case ';':
+			for i < len(s) && s[i] != '\n' {
+				i++
+			}
+		case '\n':
+			if !paren && len(cur) > 0 {
+				zlines = append(zlines, cur)
+				cur = nil
+			}
+			i++
+		case ' ', '\t':
+			i++
+		case '(', ')':
+			paren = c == '('
+			i++
+		case '"':
+			i++
+			var b strings.Builder
+			for i < len(s) && s[i] != '"' {
+				if s[i] == '\\' && i+1 < len(s) {
+					i++
+				}
+				b.WriteByte(s[i])
+				i++
+			}
+			if i == len(s) {
+				return nil, fmt.Errorf("unterminated quoted string")
+			}
+			i++
+			cur = append(cur, token{b.String(), true})
+		default:
+			o := i
+			for i < len(s) && !strings.ContainsRune(" \t\n;()\"", rune(s[i])) {
+				i++
+			}
+			cur = append(cur, token{s[o:i], false})
+		}
+	}
+	if paren {
+		return nil, fmt.Errorf("unterminated parenthesis")
+	}
+
+	var records []DNSRecord
+	ttl := 3600
+	for _, l := range zlines {
+		if l[0].s == "$TTL" {
+			if len(l) != 2 {
+				return nil, fmt.Errorf("bad $TTL directive")
+			}
+			v, err := strconv.Atoi(l[1].s)
+			if err != nil {
+				return nil, fmt.Errorf("parsing $TTL: %v", err)
+			}
+			ttl = v
+			continue
+		}
+		if len(l) < 3 || !strings.HasSuffix(l[0].s, ".") {
+			return nil, fmt.Errorf("unrecognized record starting with %q", l[0].s)
+		}
+		r := DNSRecord{Name: l[0].s, TTL: ttl}
+		l = l[1:]
+		if v, err := strconv.Atoi(l[0].s); err == nil {
+			r.TTL = v
+			l = l[1:]
+		}
+		if len(l) > 0 && l[0].s == "IN" {
+			l = l[1:]
+		}
+		if len(l) < 2 {
+			return nil, fmt.Errorf("missing data for record %q", r.Name)
+		}
+		r.Type = strings.ToUpper(l[0].s)
+		for _, t := range l[1:] {
+			r.Data = append(r.Data, t.s)
+		}
+		records = append(records, r)
+	}
+	return records, nil
+}
+
+// zoneData returns the record data in zone file syntax, with TXT strings split
+// into strings of at most 255 bytes.
+func (r DNSRecord) zoneData() string {
+	quote := func(s string) string {
+		return `"` + strings.ReplaceAll(strings.ReplaceAll(s, `\`, `\\`), `"`, `\"`) + `"`
+	}
+	switch r.Type {
+	case "TXT":
+		var l []string
+		for _, s := range txtChunks(strings.Join(r.Data, "")) {
+			l = append(l, quote(s))
+		}
+		return strings.Join(l, " ")
+	case "CAA":
+		if len(r.Data) == 3 {
+			return r.Data[0] + " " + r.Data[1] + " " + quote(r.Data[2])
+		}
+	}
+	return strings.Join(r.Data, " ")
+}
+
+// txtChunks splits s into strings of at most 255 bytes, the maximum for a single
+// string in a TXT record.
+func txtChunks(s string) []string {
+	l := []string{}
+	for len(s) > 255 {
+		l = append(l, s[:255])
+		s = s[255:]
+	}
+	return append(l, s)
+}
+
+// DomainRecordsExport returns the zone file lines as returned by DomainRecords in
+// one of DNSRecordFormats.
+func DomainRecordsExport(lines []string, format string) (string, error) {
+	if format == "zone" || format == "" {
+		return strings.Join(lines, "\n") + "\n", nil
+	} else if !slices.Contains(DNSRecordFormats, format) {
+		return "", fmt.Errorf("%w: unknown format %q, must be one of %s", ErrRequest, format, strings.Join(DNSRecordFormats, ", "))
+	}
+
+	records, err := ParseDomainRecords(lines)
+	if err != nil {
+		return "", fmt.Errorf("parsing dns records: %v", err)
+	}
+	switch format {
+	case "cloudflare":
+		return exportCloudflare(records)
+	case "route53":
+		return exportRoute53(records)
+	default:
+		return exportTerraform(records), nil
+	}
+}
+
+func exportCloudflare(records []DNSRecord) (string, error) {
+	type record struct {
+		Type     string `json:"type"`
+		Name     string `json:"name"`
+		Content  string `json:"content,omitempty"`
+		Data     any    `json:"data,omitempty"`
+		Priority *int   `json:"priority,omitempty"`
+		TTL      int    `json:"ttl"`
+	}
+
+	atoi := func(r DNSRecord, s string) (int, error) {
+		v, err := strconv.Atoi(s)
+		if err != nil {
+			return 0, fmt.Errorf("parsing number in %s record for %s: %v", r.Type, r.Name, err)
+		}
+		return v, nil
+	}
+
+	l := []record{}
+	for _, r := range records {
+		cr := record{Type: r.Type, Name: strings.TrimSuffix(r.Name, "."), TTL: r.TTL}
+		var err error
+		switch r.Type {
+		case "TXT":
+			cr.Content = strings.Join(r.Data, "")
+		case "MX":
+			if len(r.Data) != 2 {
+				return "", fmt.Errorf("unexpected data for MX record for %s", r.Name)
+			}
+			var pref int
+			pref, err = atoi(r, r.Data[0])
+			cr.Priority = &pref
+			cr.Content = strings.TrimSuffix(r.Data[1], ".")
+		case "CNAME":
+			cr.Content = strings.TrimSuffix(strings.Join(r.Data, ""), ".")
+		case "SRV":
+			if len(r.Data) != 4 {
+				return "", fmt.Errorf("unexpected data for SRV record for %s", r.Name)
+			}
+			var v [3]int
+			for i := range v {
+				if v[i], err = atoi(r, r.Data[i]); err != nil {
+					break
+				}
+			}
+			target := strings.TrimSuffix(r.Data[3], ".")
+			if target == "" {
+				target = "."
+			}
+			cr.Data = map[string]any{"priority": v[0], "weight": v[1], "port": v[2], "target": target}
+		case "CAA":
+			if len(r.Data) != 3 {
+				return "", fmt.Errorf("unexpected data for CAA record for %s", r.Name)
+			}
+			var flags int
+			flags, err = atoi(r, r.Data[0])
+			cr.Data = map[string]any{"flags": flags, "tag": r.Data[1], "value": r.Data[2]}
+		case "TLSA":
+			if len(r.Data) != 4 {
+				return "", fmt.Errorf("unexpected data for TLSA record for %s", r.Name)
+			}
+			var v [3]int
+			for i := range v {
+				if v[i], err = atoi(r, r.Data[i]); err != nil {
+					break
+				}
+			}
+			cr.Data = map[string]any{"usage": v[0], "selector": v[1], "matching_type": v[2], "certificate": r.Data[3]}
+		default:
+			cr.Content = r.zoneData()
+		}
+		if err != nil {
+			return "", err
+		}
+		l = append(l, cr)
+	}
+	return marshalIndent(l)
+}
+
+func exportRoute53(records []DNSRecord) (string, error) {
+	type resourceRecord struct {
+		Value string
+	}
+	type resourceRecordSet struct {
+		Name            string
+		Type            string
+		TTL             int
+		ResourceRecords []resourceRecord
+	}
+	type change struct {
+		Action            string
+		ResourceRecordSet resourceRecordSet
+	}
+	type changeBatch struct {
+		Comment string
+		Changes []change
+	}
+
+	// Route53 has a single record set for all records with the same name and type.
+	batch := changeBatch{Comment: "DNS records generated by mox", Changes: []change{}}
+	index := map[string]int{}
+	for _, r := range records {
+		k := r.Name + " " + r.Type
+		i, ok := index[k]
+		if !ok {
+			i = len(batch.Changes)
+			index[k] = i
+			batch.Changes = append(batch.Changes, change{"UPSERT", resourceRecordSet{r.Name, r.Type, r.TTL, nil}})
+		}
+		rrs := &batch.Changes[i].ResourceRecordSet
+		rrs.ResourceRecords = append(rrs.ResourceRecords, resourceRecord{r.zoneData()})
+	}
+	return marshalIndent(batch)
+}
+
+func exportTerraform(records []DNSRecord) string {
+	hclString := func(s string) string {
+		s = strings.ReplaceAll(s, `\`, `\\`)
+		s = strings.ReplaceAll(s, `"`, `\"`)
+		s = strings.ReplaceAll(s, "${", "$${")
+		s = strings.ReplaceAll(s, "%{", "%%{")
+		return `"` + s + `"`
+	}
+
+	// Records with the same name and type are combined into a single resource, the
+	// aws_route53_record has a record set.
+	type resource struct {
+		record DNSRecord
+		values []string
+	}
+	var resources []*resource
+	index := map[string]*resource{}
+	for _, r := range records {
+		// The provider adds the quotes for TXT records itself. Strings longer than 255
+		// bytes are split with an empty quoted string.
+		value := r.zoneData()
+		if r.Type == "TXT" {
+			value = strings.Join(txtChunks(strings.Join(r.Data, "")), `""`)
+		}
+		k := r.Name + " " + r.Type
+		if res, ok := index[k]; ok {
+			res.values = append(res.values, value)
+			continue
+		}
+		res := &resource{r, []string{value}}
+		index[k] = res
+		resources = append(resources, res)
+	}
+
+	var b bytes.Buffer
+	b.WriteString("# DNS records generated by mox, for aws_route53_record resources.\n\n")
+	b.WriteString("variable \"zone_id\" {\n\tdescription = \"ID of the Route53 hosted zone for the domain.\"\n\ttype        = string\n}\n")
+	names := map[string]bool{}
+	for _, res := range resources {
+		r := res.record
+		// Resource names must start with a letter or underscore, and contain only letters,
+		// digits, underscores and dashes.
+		name := strings.Map(func(c rune) rune {
+			if c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-' {
+				return c
+			}
+			return '_'
+		}, strings.ToLower(strings.TrimSuffix(r.Name, ".")+"_"+r.Type))
+		name = "mox_" + name
+		base := name
+		for i := 2; names[name]; i++ {
+			name = fmt.Sprintf("%s_%d", base, i)
+		}
+		names[name] = true
+
+		var values []string
+		for _, v := range res.values {
+			values = append(values, hclString(v))
+		}
+		fmt.Fprintf(&b, "\nresource \"aws_route53_record\" %s {\n", hclString(name))
+		fmt.Fprintf(&b, "\tzone_id = var.zone_id\n")
+		fmt.Fprintf(&b, "\tname    = %s\n", hclString(r.Name))
+		fmt.Fprintf(&b, "\ttype    = %s\n", hclString(r.Type))
+		fmt.Fprintf(&b, "\tttl     = %d\n", r.TTL)
+		fmt.Fprintf(&b, "\trecords = [%s]\n", strings.Join(values, ", "))
+		b.WriteString("}\n")
+	}
+	return b.String()
+}
+
+func marshalIndent(v any) (string, error) {
+	buf, err := json.MarshalIndent(v, "", "\t")
+	if err != nil {
+		return "", fmt.Errorf("marshal json: %v", err)
+	}
+	return string(buf) + "\n", nil
+}
@@ -0,0 +1,352 @@
+package admin
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func tcheck(t *testing.T, err error, msg string) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("%s: %s", msg, err)
+	}
+}
+
+func tcompare(t *testing.T, got, expect any) {
+	t.Helper()
+	if !reflect.DeepEqual(got, expect) {
+		t.Fatalf("got:\n%#v\nexpected:\n%#v", got, expect)
+	}
+}
+
+func TestParseDomainRecords(t *testing.T) {
+	test := func(lines []string, expect []DNSRecord, expErr bool) {
+		t.Helper()
+		records, err := ParseDomainRecords(lines)
+		if (err != nil) != expErr {
+			t.Fatalf("got err %v, expected error %v", err, expErr)
+		}
+		tcompare(t, records, expect)
+	}
+
+	// Default TTL, comments, blank lines and commented-out records.
+	test([]string{
+		"; Comment",
+		"",
+		"mox.example.  MX 10 mail.mox.example. ; Trailing comment.",
+		";mox.example. MX 20 mail2.mox.example.",
+	}, []DNSRecord{
+		{"mox.example.", 3600, "MX", []string{"10", "mail.mox.example."}},
+	}, false)
+
+	// $TTL applies to following records, explicit TTL and class.
+	test([]string{
+		"mox.example. A 192.0.2.1",
+		"$TTL 300",
+		"mox.example. AAAA 2001:db8::1",
+		"mox.example. 60 IN A 192.0.2.2",
+		"mox.example. IN cname mail.mox.example.",
+	}, []DNSRecord{
+		{"mox.example.", 3600, "A", []string{"192.0.2.1"}},
+		{"mox.example.", 300, "AAAA", []string{"2001:db8::1"}},
+		{"mox.example.", 60, "A", []string{"192.0.2.2"}},
+		{"mox.example.", 300, "CNAME", []string{"mail.mox.example."}},
+	}, false)
+
+	// Parenthesized multi-line records, with comments inside, and quoted strings with
+	// escapes and split TXT strings.
+	test([]string{
+		"sel._domainkey.mox.example. TXT (",
+		`	"v=DKIM1;k=ed25519;" ; First part.`,
+		`	"p=abc" )`,
+		`mox.example. TXT "a \"quoted\" \\ value; not a comment" "(x)"`,
+		"mox.example. CAA 0 issue \"letsencrypt.org\"",
+	}, []DNSRecord{
+		{"sel._domainkey.mox.example.", 3600, "TXT", []string{"v=DKIM1;k=ed25519;", "p=abc"}},
+		{"mox.example.", 3600, "TXT", []string{`a "quoted" \ value; not a comment`, "(x)"}},
+		{"mox.example.", 3600, "CAA", []string{"0", "issue", "letsencrypt.org"}},
+	}, false)
+
+	// Errors.
+	test([]string{`mox.example. TXT "unterminated`}, nil, true)
+	test([]string{"mox.example. TXT (", `"x"`}, nil, true)
+	test([]string{"$TTL"}, nil, true)
+	test([]string{"$TTL bad"}, nil, true)
+	test([]string{"relative MX 10 mail.mox.example."}, nil, true)
+	test([]string{"mox.example. 60 IN MX"}, nil, true)
+}
+
+func TestDomainRecordsExport(t *testing.T) {
+	dkim := "v=DKIM1;k=rsa;p=" + strings.Repeat("MIIBIjANBgkqhkiG9w0BAQEFAAOCAQ8A", 10)
+	lines := []string{
+		"$TTL 300",
+		"",
+		"; Mail exchangers.",
+		"mox.example.                 MX 10 mail.mox.example.",
+		"mox.example.                 MX 20 mail2.mox.example.",
+		"sel._domainkey.mox.example.  TXT (",
+		`	"` + dkim[:255] + `"`,
+		`	"` + dkim[255:] + `" )`,
+		`quote.mox.example. 60 IN TXT "a \"quoted\" \\ value ${x}"`,
+		`mox.example. CAA 0 issue "letsencrypt.org"`,
+		"_25._tcp.mail.mox.example. TLSA 3 1 1 abcdef",
+		"_imaps._tcp.mox.example. SRV 0 1 993 mail.mox.example.",
+		"autoconfig.mox.example. CNAME mail.mox.example.",
+	}
+
+	test := func(format, expect string) {
+		t.Helper()
+		s, err := DomainRecordsExport(lines, format)
+		tcheck(t, err, "export")
+		expect = strings.NewReplacer("<DKIM>", dkim, "<DKIM1>", dkim[:255], "<DKIM2>", dkim[255:]).Replace(expect)
+		if s != expect {
+			t.Fatalf("export %s, got:\n%s\nexpected:\n%s", format, s, expect)
+		}
+	}
+
+	test("zone", strings.Join(lines, "\n")+"\n")
+
+	test("cloudflare", `[
+	{
+		"type": "MX",
+		"name": "mox.example",
+		"content": "mail.mox.example",
+		"priority": 10,
+		"ttl": 300
+	},
+	{
+		"type": "MX",
+		"name": "mox.example",
+		"content": "mail2.mox.example",
+		"priority": 20,
+		"ttl": 300
+	},
+	{
+		"type": "TXT",
+		"name": "sel._domainkey.mox.example",
+		"content": "<DKIM>",
+		"ttl": 300
+	},
+	{
+		"type": "TXT",
+		"name": "quote.mox.example",
+		"content": "a \"quoted\" \\ value ${x}",
+		"ttl": 60
+	},
+	{
+		"type": "CAA",
+		"name": "mox.example",
+		"data": {
+			"flags": 0,
+			"tag": "issue",
+			"value": "letsencrypt.org"
+		},
+		"ttl": 300
+	},
+	{
+		"type": "TLSA",
+		"name": "_25._tcp.mail.mox.example",
+		"data": {
+			"certificate": "abcdef",
+			"matching_type": 1,
+			"selector": 1,
+			"usage": 3
+		},
+		"ttl": 300
+	},
+	{
+		"type": "SRV",
+		"name": "_imaps._tcp.mox.example",
+		"data": {
+			"port": 993,
+			"priority": 0,
+			"target": "mail.mox.example",
+			"weight": 1
+		},
+		"ttl": 300
+	},
+	{
+		"type": "CNAME",
+		"name": "autoconfig.mox.example",
+		"content": "mail.mox.example",
+		"ttl": 300
+	}
+]
+`)
+
+	test("route53", `{
+	"Comment": "DNS records generated by mox",
+	"Changes": [
+		{
+			"Action": "UPSERT",
+			"ResourceRecordSet": {
+				"Name": "mox.example.",
+				"Type": "MX",
+				"TTL": 300,
+				"ResourceRecords": [
+					{
+						"Value": "10 mail.mox.example."
+					},
+					{
+						"Value": "20 mail2.mox.example."
+					}
+				]
+			}
+		},
+		{
+			"Action": "UPSERT",
+			"ResourceRecordSet": {
+				"Name": "sel._domainkey.mox.example.",
+				"Type": "TXT",
+				"TTL": 300,
+				"ResourceRecords": [
+					{
+						"Value": "\"<DKIM1>\" \"<DKIM2>\""
+					}
+				]
+			}
+		},
+		{
+			"Action": "UPSERT",
+			"ResourceRecordSet": {
+				"Name": "quote.mox.example.",
+				"Type": "TXT",
+				"TTL": 60,
+				"ResourceRecords": [
+					{
+						"Value": "\"a \\\"quoted\\\" \\\\ value ${x}\""
+					}
+				]
+			}
+		},
+		{
+			"Action": "UPSERT",
+			"ResourceRecordSet": {
+				"Name": "mox.example.",
+				"Type": "CAA",
+				"TTL": 300,
+				"ResourceRecords": [
+					{
+						"Value": "0 issue \"letsencrypt.org\""
+					}
+				]
+			}
+		},
+		{
+			"Action": "UPSERT",
+			"ResourceRecordSet": {
+				"Name": "_25._tcp.mail.mox.example.",
+				"Type": "TLSA",
+				"TTL": 300,
+				"ResourceRecords": [
+					{
+						"Value": "3 1 1 abcdef"
+					}
+				]
+			}
+		},
+		{
+			"Action": "UPSERT",
+			"ResourceRecordSet": {
+				"Name": "_imaps._tcp.mox.example.",
+				"Type": "SRV",
+				"TTL": 300,
+				"ResourceRecords": [
+					{
+						"Value": "0 1 993 mail.mox.example."
+					}
+				]
+			}
+		},
+		{
+			"Action": "UPSERT",
+			"ResourceRecordSet": {
+				"Name": "autoconfig.mox.example.",
+				"Type": "CNAME",
+				"TTL": 300,
+				"ResourceRecords": [
+					{
+						"Value": "mail.mox.example."
+					}
+				]
+			}
+		}
+	]
+}
+`)
+
+	test("terraform", `# DNS records generated by mox, for aws_route53_record resources.
+
+variable "zone_id" {
+	description = "ID of the Route53 hosted zone for the domain."
+	type        = string
+}
+
+resource "aws_route53_record" "mox_mox_example_mx" {
+	zone_id = var.zone_id
+	name    = "mox.example."
+	type    = "MX"
+	ttl     = 300
+	records = ["10 mail.mox.example.", "20 mail2.mox.example."]
+}
+
+resource "aws_route53_record" "mox_sel__domainkey_mox_example_txt" {
+	zone_id = var.zone_id
+	name    = "sel._domainkey.mox.example."
+	type    = "TXT"
+	ttl     = 300
+	records = ["<DKIM1>\"\"<DKIM2>"]
+}
+
+resource "aws_route53_record" "mox_quote_mox_example_txt" {
+	zone_id = var.zone_id
+	name    = "quote.mox.example."
+	type    = "TXT"
+	ttl     = 60
+	records = ["a \"quoted\" \\ value $${x}"]
+}
+
+resource "aws_route53_record" "mox_mox_example_caa" {
+	zone_id = var.zone_id
+	name    = "mox.example."
+	type    = "CAA"
+	ttl     = 300
+	records = ["0 issue \"letsencrypt.org\""]
+}
+
+resource "aws_route53_record" "mox__25__tcp_mail_mox_example_tlsa" {
+	zone_id = var.zone_id
+	name    = "_25._tcp.mail.mox.example."
+	type    = "TLSA"
+	ttl     = 300
+	records = ["3 1 1 abcdef"]
+}
+
+resource "aws_route53_record" "mox__imaps__tcp_mox_example_srv" {
+	zone_id = var.zone_id
+	name    = "_imaps._tcp.mox.example."
+	type    = "SRV"
+	ttl     = 300
+	records = ["0 1 993 mail.mox.example."]
+}
+
+resource "aws_route53_record" "mox_autoconfig_mox_example_cname" {
+	zone_id = var.zone_id
+	name    = "autoconfig.mox.example."
+	type    = "CNAME"
+	ttl     = 300
+	records = ["mail.mox.example."]
+}
+`)
+
+	_, err := DomainRecordsExport(lines, "bogus")
+	if !errors.Is(err, ErrRequest) {
+		t.Fatalf("got err %v, expected ErrRequest", err)
+	}
+	_, err = DomainRecordsExport([]string{"mox.example. MX bad mail.mox.example."}, "cloudflare")
+	if err == nil {
+		t.Fatalf("got nil error for bad mx preference, expected error")
+	}
+}
@@ -1,21 +1,25 @@
 package admin
 
 import (
+	"context"
 	"crypto"
 	"crypto/ed25519"
 	"crypto/rsa"
 	"crypto/sha256"
 	"crypto/x509"
 	"fmt"
+	"net"
 	"net/url"
 	"sort"
 	"strings"
+	"time"
 
 	"github.com/mjl-/adns"
 
 	"github.com/mjl-/mox/config"
 	"github.com/mjl-/mox/dkim"
 	"github.com/mjl-/mox/dmarc"
+	"github.com/mjl-/mox/dmarcdb"
 	"github.com/mjl-/mox/dns"
 	"github.com/mjl-/mox/mox-"
 	"github.com/mjl-/mox/smtp"
@@ -25,6 +29,111 @@ import (
 
 // todo: find a way to automatically create the dns records as it would greatly simplify setting up email for a domain. we could also dynamically make changes, e.g. providing grace periods after disabling a dkim key, only automatically removing the dkim dns key after a few days. but this requires some kind of api and authentication to the dns server. there doesn't appear to be a single commonly used api for dns management. each of the numerous cloud providers have their own APIs and rather large SKDs to use them. we don't want to link all of them in.
 
+// TLSARecords returns the DANE TLSA records for the MX host of listener l, for
+// host private keys currently used for certificates, and for host private keys
+// that will be used in the future. Records for future keys must be published
+// before the keys are used, so remote mail servers with cached TLSA records can
+// still verify the new certificates.
+//
+// The records are of type DANE-EE (3), with selector SPKI (1) and matching type
+// SHA2-256 (1), i.e. a pin of the public key, which stays valid when certificates
+// are renewed with the same key.
+func TLSARecords(l config.Listener) (current, next []adns.TLSA, rerr error) {
+	if l.TLS == nil {
+		return nil, nil, nil
+	}
+	seen := map[string]bool{}
+	add := func(l []adns.TLSA, keys []crypto.Signer) ([]adns.TLSA, error) {
+		for _, privKey := range keys {
+			spkiBuf, err := x509.MarshalPKIXPublicKey(privKey.Public())
+			if err != nil {
+				return nil, fmt.Errorf("marshal SubjectPublicKeyInfo for DANE record: %v", err)
+			}
+			sum := sha256.Sum256(spkiBuf)
+			r := adns.TLSA{
+				Usage:     adns.TLSAUsageDANEEE,
+				Selector:  adns.TLSASelectorSPKI,
+				MatchType: adns.TLSAMatchTypeSHA256,
+				CertAssoc: sum[:],
+			}
+			if s := r.Record(); !seen[s] {
+				seen[s] = true
+				l = append(l, r)
+			}
+		}
+		return l, nil
+	}
+	var err error
+	if current, err = add(current, l.TLS.HostPrivateECDSAP256Keys); err != nil {
+		return nil, nil, err
+	}
+	if current, err = add(current, l.TLS.HostPrivateRSA2048Keys); err != nil {
+		return nil, nil, err
+	}
+	if next, err = add(next, l.TLS.HostPrivateKeysNext); err != nil {
+		return nil, nil, err
+	}
+	return current, next, nil
+}
+
+// DomainSPFRecord returns the suggested SPF record for a domain. It allows the
+// IPs of this mail server, the MX hosts of the domain and the additional senders
+// configured for the domain, and ends with an "all" mechanism with the configured
+// qualifier, softfail by default. An error is returned if evaluating the record
+// could require more DNS lookups than allowed.
+func DomainSPFRecord(domConf config.Domain) (spf.Record, error) {
+	r := spf.Record{Version: "spf1"}
+	addIP := func(ip net.IP, ones, bits int) {
+		d := spf.Directive{Mechanism: "ip4", IP: ip}
+		if ip.To4() == nil {
+			d.Mechanism = "ip6"
+		}
+		if ones != bits {
+			if d.Mechanism == "ip4" {
+				d.IP4CIDRLen = &ones
+			} else {
+				d.IP6CIDRLen = &ones
+			}
+		}
+		r.Directives = append(r.Directives, d)
+	}
+	for _, ip := range mox.DomainSPFIPs() {
+		addIP(ip, 0, 0)
+	}
+	all := "~"
+	if domConf.SPF != nil {
+		for _, ipnet := range domConf.SPF.ParsedIPs {
+			ones, bits := ipnet.Mask.Size()
+			addIP(ipnet.IP, ones, bits)
+		}
+	}
+	r.Directives = append(r.Directives, spf.Directive{Mechanism: "mx"})
+	if domConf.SPF != nil {
+		for _, d := range domConf.SPF.ParsedIncludes {
+			r.Directives = append(r.Directives, spf.Directive{Mechanism: "include", DomainSpec: d.ASCII})
+		}
+		if domConf.SPF.All != "" {
+			all = domConf.SPF.All
+		}
+	}
+	r.Directives = append(r.Directives, spf.Directive{Qualifier: all, Mechanism: "all"})
+
+	// Mechanisms "include", "a", "mx", "ptr" and "exists" each require a DNS lookup,
+	// at most 10 are allowed. Lookups for included records count towards the limit as
+	// well, but we can't know them without DNS requests. ../rfc/7208:937
+	var lookups int
+	for _, d := range r.Directives {
+		switch d.Mechanism {
+		case "include", "a", "mx", "ptr", "exists":
+			lookups++
+		}
+	}
+	if lookups > 10 {
+		return spf.Record{}, fmt.Errorf("%w: spf record for domain requires %d dns lookups, more than maximum 10", ErrRequest, lookups)
+	}
+	return r, nil
+}
+
 // DomainRecords returns text lines describing DNS records required for configuring
 // a domain.
 //
@@ -44,7 +153,16 @@ func DomainRecords(domConf config.Domain, domain dns.Domain, hasDNSSEC bool, cer
 		"",
 	}
 
-	if public, ok := mox.Conf.Static.Listeners["public"]; ok && public.TLS != nil && (len(public.TLS.HostPrivateRSA2048Keys) > 0 || len(public.TLS.HostPrivateECDSAP256Keys) > 0) {
+	public, ok := mox.Conf.Static.Listeners["public"]
+	var tlsaCurrent, tlsaNext []adns.TLSA
+	if ok {
+		var err error
+		tlsaCurrent, tlsaNext, err = TLSARecords(public)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(tlsaCurrent) > 0 || len(tlsaNext) > 0 {
 		records = append(records,
 			`; DANE: These records indicate that a remote mail server trying to deliver email`,
 			`; with SMTP (TCP port 25) must verify the TLS certificate with DANE-EE (3), based`,
@@ -64,18 +182,7 @@ func DomainRecords(domConf config.Domain, domain dns.Domain, hasDNSSEC bool, cer
 				"; commented out.",
 			)
 		}
-		addTLSA := func(privKey crypto.Signer) error {
-			spkiBuf, err := x509.MarshalPKIXPublicKey(privKey.Public())
-			if err != nil {
-				return fmt.Errorf("marshal SubjectPublicKeyInfo for DANE record: %v", err)
-			}
-			sum := sha256.Sum256(spkiBuf)
-			tlsaRecord := adns.TLSA{
-				Usage:     adns.TLSAUsageDANEEE,
-				Selector:  adns.TLSASelectorSPKI,
-				MatchType: adns.TLSAMatchTypeSHA256,
-				CertAssoc: sum[:],
-			}
+		addTLSA := func(tlsaRecord adns.TLSA) {
 			var s string
 			if hasDNSSEC {
 				s = fmt.Sprintf("_25._tcp.%-*s TLSA %s", 20+len(d)-len("_25._tcp."), h+".", tlsaRecord.Record())
@@ -83,17 +190,19 @@ func DomainRecords(domConf config.Domain, domain dns.Domain, hasDNSSEC bool, cer
 				s = fmt.Sprintf(";; _25._tcp.%-*s TLSA %s", 20+len(d)-len(";; _25._tcp."), h+".", tlsaRecord.Record())
 			}
 			records = append(records, s)
-			return nil
 		}
-		for _, privKey := range public.TLS.HostPrivateECDSAP256Keys {
-			if err := addTLSA(privKey); err != nil {
-				return nil, err
-			}
+		for _, r := range tlsaCurrent {
+			addTLSA(r)
 		}
-		for _, privKey := range public.TLS.HostPrivateRSA2048Keys {
-			if err := addTLSA(privKey); err != nil {
-				return nil, err
-			}
+		if len(tlsaNext) > 0 {
+			records = append(records,
+				";",
+				"; For key rollover: Records for host private keys that will be used for future",
+				"; certificates. Publish them before the keys start being used.",
+			)
+		}
+		for _, r := range tlsaNext {
+			addTLSA(r)
 		}
 		records = append(records, "")
 	}
@@ -168,6 +277,22 @@ func DomainRecords(domConf config.Domain, domain dns.Domain, hasDNSSEC bool, cer
 	}
 	dmarcr := dmarc.DefaultRecord
 	dmarcr.Policy = "reject"
+	var dmarcAdvice string
+	if domConf.DMARC != nil && domConf.DMARC.Policy == "auto" {
+		dmarcr.Policy = "none"
+		if dmarcdb.ReportsDB != nil {
+			advice, err := dmarcdb.DomainAdvice(context.TODO(), domain.Name(), time.Now())
+			if err != nil {
+				return nil, fmt.Errorf("dmarc policy advice: %v", err)
+			}
+			if advice.RecommendedPolicy != "" {
+				dmarcr.Policy = dmarc.Policy(advice.RecommendedPolicy)
+			}
+			dmarcAdvice = advice.Recommendation
+		}
+	} else if domConf.DMARC != nil && domConf.DMARC.Policy != "" {
+		dmarcr.Policy = dmarc.Policy(domConf.DMARC.Policy)
+	}
 	if domConf.DMARC != nil {
 		uri := url.URL{
 			Scheme: "mailto",
@@ -177,18 +302,10 @@ func DomainRecords(domConf config.Domain, domain dns.Domain, hasDNSSEC bool, cer
 			{Address: uri.String(), MaxSize: 10, Unit: "m"},
 		}
 	}
-	dspfr := spf.Record{Version: "spf1"}
-	for _, ip := range mox.DomainSPFIPs() {
-		mech := "ip4"
-		if ip.To4() == nil {
-			mech = "ip6"
-		}
-		dspfr.Directives = append(dspfr.Directives, spf.Directive{Mechanism: mech, IP: ip})
+	dspfr, err := DomainSPFRecord(domConf)
+	if err != nil {
+		return nil, err
 	}
-	dspfr.Directives = append(dspfr.Directives,
-		spf.Directive{Mechanism: "mx"},
-		spf.Directive{Qualifier: "~", Mechanism: "all"},
-	)
 	dspftxt, err := dspfr.Record()
 	if err != nil {
 		return nil, fmt.Errorf("making domain spf record: %v", err)
@@ -197,8 +314,17 @@ func DomainRecords(domConf config.Domain, domain dns.Domain, hasDNSSEC bool, cer
 		"",
 
 		"; Specify the MX host is allowed to send for our domain and for itself (for DSNs).",
-		"; ~all means softfail for anything else, which is done instead of -all to prevent older",
-		"; mail servers from rejecting the message because they never get to looking for a dkim/dmarc pass.",
+	)
+	if domConf.SPF != nil && (len(domConf.SPF.Includes) > 0 || len(domConf.SPF.IPs) > 0) {
+		records = append(records, "; Additional senders configured for the domain are allowed as well.")
+	}
+	if domConf.SPF == nil || domConf.SPF.All == "" || domConf.SPF.All == "~" {
+		records = append(records,
+			"; ~all means softfail for anything else, which is done instead of -all to prevent older",
+			"; mail servers from rejecting the message because they never get to looking for a dkim/dmarc pass.",
+		)
+	}
+	records = append(records,
 		fmt.Sprintf(`%s.                    TXT "%s"`, d, dspftxt),
 		"",
 
@@ -206,6 +332,14 @@ func DomainRecords(domConf config.Domain, domain dns.Domain, hasDNSSEC bool, cer
 		"; should be rejected, and request reports. If you email through mailing lists that",
 		"; strip DKIM-Signature headers and don't rewrite the From header, you may want to",
 		"; set the policy to p=none.",
+	)
+	if domConf.DMARC != nil && domConf.DMARC.Policy == "auto" {
+		records = append(records, "; The policy below is chosen automatically based on incoming DMARC aggregate reports.")
+		if dmarcAdvice != "" {
+			records = append(records, "; Recommendation: "+dmarcAdvice)
+		}
+	}
+	records = append(records,
 		fmt.Sprintf(`_dmarc.%s.             TXT "%s"`, d, dmarcr.String()),
 		"",
 	)
@@ -0,0 +1,124 @@
+package admin
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	cryptorand "crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/mjl-/adns"
+
+	"github.com/mjl-/mox/config"
+	"github.com/mjl-/mox/dns"
+	"github.com/mjl-/mox/mox-"
+)
+
+func TestTLSARecords(t *testing.T) {
+	genKey := func() crypto.Signer {
+		t.Helper()
+		key, err := ecdsa.GenerateKey(elliptic.P256(), cryptorand.Reader)
+		tcheck(t, err, "generate key")
+		return key
+	}
+	record := func(key crypto.Signer) adns.TLSA {
+		t.Helper()
+		buf, err := x509.MarshalPKIXPublicKey(key.Public())
+		tcheck(t, err, "marshal public key")
+		sum := sha256.Sum256(buf)
+		return adns.TLSA{
+			Usage:     adns.TLSAUsageDANEEE,
+			Selector:  adns.TLSASelectorSPKI,
+			MatchType: adns.TLSAMatchTypeSHA256,
+			CertAssoc: sum[:],
+		}
+	}
+
+	check := func(l config.Listener, expCurrent, expNext []adns.TLSA) {
+		t.Helper()
+		current, next, err := TLSARecords(l)
+		tcheck(t, err, "tlsa records")
+		tcompare(t, current, expCurrent)
+		tcompare(t, next, expNext)
+	}
+
+	// No TLS, no records.
+	check(config.Listener{}, nil, nil)
+
+	key1 := genKey()
+	key2 := genKey()
+	key3 := genKey()
+
+	// Without next keys.
+	l := config.Listener{TLS: &config.TLS{HostPrivateECDSAP256Keys: []crypto.Signer{key1, key2}}}
+	check(l, []adns.TLSA{record(key1), record(key2)}, nil)
+
+	// With a next key, in a separate list.
+	l.TLS.HostPrivateKeysNext = []crypto.Signer{key3}
+	check(l, []adns.TLSA{record(key1), record(key2)}, []adns.TLSA{record(key3)})
+
+	// A next key that is already in use is only returned as current key.
+	l.TLS.HostPrivateKeysNext = []crypto.Signer{key2, key3}
+	check(l, []adns.TLSA{record(key1), record(key2)}, []adns.TLSA{record(key3)})
+
+	// Only next keys.
+	l = config.Listener{TLS: &config.TLS{HostPrivateKeysNext: []crypto.Signer{key3}}}
+	check(l, nil, []adns.TLSA{record(key3)})
+}
+
+func TestDomainSPFRecord(t *testing.T) {
+	orig := mox.Conf.Static.Listeners
+	defer func() {
+		mox.Conf.Static.Listeners = orig
+	}()
+	l := config.Listener{IPs: []string{"192.0.2.1", "2001:db8::1", "0.0.0.0"}}
+	l.SMTP.Enabled = true
+	mox.Conf.Static.Listeners = map[string]config.Listener{"public": l}
+
+	check := func(domConf config.Domain, expRecord string) {
+		t.Helper()
+		r, err := DomainSPFRecord(domConf)
+		tcheck(t, err, "domain spf record")
+		txt, err := r.Record()
+		tcheck(t, err, "spf record text")
+		tcompare(t, txt, expRecord)
+	}
+
+	// Only IPs of listeners, unspecified IPs skipped.
+	check(config.Domain{}, "v=spf1 ip4:192.0.2.1 ip6:2001:db8::1 mx ~all")
+
+	// Configured IPs/networks and includes are added, with the all qualifier.
+	_, ipnet4, _ := net.ParseCIDR("198.51.100.0/24")
+	_, ipnet6, _ := net.ParseCIDR("2001:db8:1::/48")
+	spfConf := config.SPF{
+		ParsedIPs: []net.IPNet{
+			{IP: net.ParseIP("203.0.113.1").To4(), Mask: net.CIDRMask(32, 32)},
+			*ipnet4,
+			*ipnet6,
+		},
+		ParsedIncludes: []dns.Domain{{ASCII: "spf.example.com"}, {ASCII: "_spf.example.net"}},
+		All:            "-",
+	}
+	check(config.Domain{SPF: &spfConf}, "v=spf1 ip4:192.0.2.1 ip6:2001:db8::1 ip4:203.0.113.1 ip4:198.51.100.0/24 ip6:2001:db8:1::/48 mx include:spf.example.com include:_spf.example.net -all")
+
+	// With mx and 9 includes, we are at the limit of 10 lookups.
+	spfConf = config.SPF{}
+	for i := range 9 {
+		spfConf.ParsedIncludes = append(spfConf.ParsedIncludes, dns.Domain{ASCII: fmt.Sprintf("spf%d.example", i)})
+	}
+	_, err := DomainSPFRecord(config.Domain{SPF: &spfConf})
+	tcheck(t, err, "domain spf record at lookup limit")
+
+	// One more include exceeds the limit.
+	spfConf.ParsedIncludes = append(spfConf.ParsedIncludes, dns.Domain{ASCII: "spf9.example"})
+	r, err := DomainSPFRecord(config.Domain{SPF: &spfConf})
+	if err == nil || !errors.Is(err, ErrRequest) {
+		t.Fatalf("got err %v, expected ErrRequest for too many lookups", err)
+	}
+	tcompare(t, len(r.Directives), 0)
+}
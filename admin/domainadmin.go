@@ -0,0 +1,248 @@
+package admin
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/exp/maps"
+	"golang.org/x/text/secure/precis"
+
+	"github.com/mjl-/mox/config"
+	"github.com/mjl-/mox/dns"
+	"github.com/mjl-/mox/mox-"
+	"github.com/mjl-/mox/smtp"
+)
+
+type domainAdminCtxKey struct{}
+
+// WithDomainAdmin returns a context for operations by a domain admin. The
+// functions in this package only allow changes to the domains of the domain admin
+// for such contexts, and to accounts with only addresses in those domains.
+// Contexts without domain admin have no restrictions.
+func WithDomainAdmin(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, domainAdminCtxKey{}, name)
+}
+
+// DomainAdminName returns the name of the domain admin for the context, or empty
+// for the global admin.
+func DomainAdminName(ctx context.Context) string {
+	name, _ := ctx.Value(domainAdminCtxKey{}).(string)
+	return name
+}
+
+// DomainAllowed returns whether domain can be managed through ctx.
+func DomainAllowed(ctx context.Context, domain dns.Domain) bool {
+	defer mox.Conf.DynamicLockUnlock()()
+	return checkDomainLocked(ctx, domain) == nil
+}
+
+// AccountAllowed returns whether account can be managed through ctx.
+func AccountAllowed(ctx context.Context, account string) bool {
+	defer mox.Conf.DynamicLockUnlock()()
+	return checkAccountLocked(ctx, account) == nil
+}
+
+// checkGlobal returns an error if ctx is for a domain admin.
+func checkGlobal(ctx context.Context) error {
+	if name := DomainAdminName(ctx); name != "" {
+		return fmt.Errorf("%w: operation not allowed for domain admin %q", ErrRequest, name)
+	}
+	return nil
+}
+
+// checkDomainLocked returns an error if ctx is for a domain admin that cannot
+// manage domain.
+//
+// Must be called with config lock held.
+func checkDomainLocked(ctx context.Context, domain dns.Domain) error {
+	name := DomainAdminName(ctx)
+	if name == "" {
+		return nil
+	}
+	da, ok := mox.Conf.Dynamic.DomainAdmins[name]
+	if !ok {
+		return fmt.Errorf("%w: unknown domain admin %q", ErrRequest, name)
+	}
+	if !slices.Contains(da.DNSDomains, domain) {
+		return fmt.Errorf("%w: domain %s not managed by domain admin %q", ErrRequest, domain, name)
+	}
+	return nil
+}
+
+// checkAccountLocked returns an error if ctx is for a domain admin that cannot
+// manage account, i.e. if the account has its default domain or an address
+// outside the domains of the domain admin.
+//
+// Must be called with config lock held.
+func checkAccountLocked(ctx context.Context, account string) error {
+	if DomainAdminName(ctx) == "" {
+		return nil
+	}
+	acc, ok := mox.Conf.Dynamic.Accounts[account]
+	if !ok {
+		return fmt.Errorf("%w: account does not exist", ErrRequest)
+	}
+	if err := checkDomainLocked(ctx, acc.DNSDomain); err != nil {
+		return err
+	}
+	for addr := range acc.Destinations {
+		if err := checkAddressLocked(ctx, addr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkAddressLocked returns an error if ctx is for a domain admin that cannot
+// manage the domain of address. Address can be a catchall address of the form
+// "@<domain>".
+//
+// Must be called with config lock held.
+func checkAddressLocked(ctx context.Context, address string) error {
+	if DomainAdminName(ctx) == "" {
+		return nil
+	}
+	t := strings.Split(address, "@")
+	d, err := dns.ParseDomain(strings.TrimPrefix(t[len(t)-1], "*."))
+	if err != nil {
+		return fmt.Errorf("%w: parsing domain of address %q: %v", ErrRequest, address, err)
+	}
+	return checkDomainLocked(ctx, d)
+}
+
+// checkAliasMemberLocked returns an error if ctx is for a domain admin that cannot
+// manage the domain of alias member address. Remote members, in domains not
+// configured on this server, are always allowed.
+//
+// Must be called with config lock held.
+func checkAliasMemberLocked(ctx context.Context, address string) error {
+	if DomainAdminName(ctx) == "" {
+		return nil
+	}
+	addr, err := smtp.ParseAddress(address)
+	if err != nil {
+		return fmt.Errorf("%w: parsing address %q: %v", ErrRequest, address, err)
+	}
+	for _, d := range mox.Conf.Dynamic.Domains {
+		if d.Domain == addr.Domain {
+			return checkDomainLocked(ctx, addr.Domain)
+		}
+	}
+	return nil
+}
+
+// DomainAdminAdd adds a domain admin, without password.
+func DomainAdminAdd(ctx context.Context, name string, domains []string) (rerr error) {
+	log := pkglog.WithContext(ctx)
+	defer func() {
+		if rerr != nil {
+			log.Errorx("adding domain admin", rerr, slog.String("name", name))
+		}
+	}()
+
+	defer mox.Conf.DynamicLockUnlock()()
+
+	if err := checkGlobal(ctx); err != nil {
+		return err
+	}
+	c := mox.Conf.Dynamic
+	if _, ok := c.DomainAdmins[name]; ok {
+		return fmt.Errorf("%w: domain admin already exists", ErrRequest)
+	}
+
+	nc := c
+	nc.DomainAdmins = maps.Clone(c.DomainAdmins)
+	if nc.DomainAdmins == nil {
+		nc.DomainAdmins = map[string]config.DomainAdmin{}
+	}
+	nc.DomainAdmins[name] = config.DomainAdmin{Domains: slices.Clone(domains)}
+
+	if err := mox.WriteDynamicLocked(ctx, log, nc); err != nil {
+		return fmt.Errorf("writing domains.conf: %w", err)
+	}
+	log.Info("domain admin added", slog.String("name", name), slog.Any("domains", domains))
+	return nil
+}
+
+// DomainAdminRemove removes a domain admin. Existing sessions of the admin
+// can no longer be used.
+func DomainAdminRemove(ctx context.Context, name string) (rerr error) {
+	log := pkglog.WithContext(ctx)
+	defer func() {
+		if rerr != nil {
+			log.Errorx("removing domain admin", rerr, slog.String("name", name))
+		}
+	}()
+
+	defer mox.Conf.DynamicLockUnlock()()
+
+	if err := checkGlobal(ctx); err != nil {
+		return err
+	}
+	c := mox.Conf.Dynamic
+	if _, ok := c.DomainAdmins[name]; !ok {
+		return fmt.Errorf("%w: domain admin does not exist", ErrRequest)
+	}
+
+	nc := c
+	nc.DomainAdmins = maps.Clone(c.DomainAdmins)
+	delete(nc.DomainAdmins, name)
+
+	if err := mox.WriteDynamicLocked(ctx, log, nc); err != nil {
+		return fmt.Errorf("writing domains.conf: %w", err)
+	}
+	log.Info("domain admin removed", slog.String("name", name))
+	return nil
+}
+
+// DomainAdminSetPassword sets a new password for the domain admin, storing a
+// bcrypt hash in the config.
+func DomainAdminSetPassword(ctx context.Context, name, password string) (rerr error) {
+	log := pkglog.WithContext(ctx)
+	defer func() {
+		if rerr != nil {
+			log.Errorx("setting password for domain admin", rerr, slog.String("name", name))
+		}
+	}()
+
+	if password == "" {
+		return fmt.Errorf("%w: empty password", ErrRequest)
+	}
+	password, err := precis.OpaqueString.String(password)
+	if err != nil {
+		return fmt.Errorf("%w: checking password with \"precis\" requirements: %v", ErrRequest, err)
+	}
+	if err := mox.CheckPassword(password); err != nil {
+		return fmt.Errorf("%w: %v", ErrRequest, err)
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return fmt.Errorf("generating password hash: %v", err)
+	}
+
+	defer mox.Conf.DynamicLockUnlock()()
+
+	if err := checkGlobal(ctx); err != nil {
+		return err
+	}
+	c := mox.Conf.Dynamic
+	da, ok := c.DomainAdmins[name]
+	if !ok {
+		return fmt.Errorf("%w: domain admin does not exist", ErrRequest)
+	}
+	da.PasswordHash = string(hash)
+
+	nc := c
+	nc.DomainAdmins = maps.Clone(c.DomainAdmins)
+	nc.DomainAdmins[name] = da
+
+	if err := mox.WriteDynamicLocked(ctx, log, nc); err != nil {
+		return fmt.Errorf("writing domains.conf: %w", err)
+	}
+	log.Info("domain admin password set", slog.String("name", name))
+	return nil
+}
@@ -0,0 +1,75 @@
+package admin
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"github.com/mjl-/mox/dns"
+	"github.com/mjl-/mox/lookalike"
+)
+
+// LookalikeDomain is a variant of a domain with a typo or similar looking
+// characters, that could be used to impersonate the domain.
+type LookalikeDomain struct {
+	Domain     dns.Domain
+	Kind       string   // See lookalike.Kind*.
+	Registered bool     // Whether the domain has NS records, only if DNS was checked.
+	MX         []string // Hosts from MX records, only if DNS was checked.
+	Error      string   // Error looking up DNS records, other than the domain not existing.
+}
+
+// LookalikeDomains returns lookalike variants of the organizational domain of
+// domain. If checkDNS is set, resolver is used to look up whether the variants are
+// registered and have MX records, with a few lookups at a time.
+func LookalikeDomains(ctx context.Context, resolver dns.Resolver, domain dns.Domain, checkDNS bool) []LookalikeDomain {
+	log := pkglog.WithContext(ctx)
+
+	variants := lookalike.Variants(ctx, log.Logger, domain)
+	l := make([]LookalikeDomain, len(variants))
+	for i, v := range variants {
+		l[i] = LookalikeDomain{Domain: v.Domain, Kind: v.Kind}
+	}
+	if !checkDNS {
+		return l
+	}
+
+	check := func(ld *LookalikeDomain) {
+		name := ld.Domain.ASCII + "."
+		ns, _, err := resolver.LookupNS(ctx, name)
+		if err != nil && !dns.IsNotFound(err) {
+			ld.Error = "ns: " + err.Error()
+			return
+		}
+		ld.Registered = len(ns) > 0
+		if !ld.Registered {
+			return
+		}
+		mxl, _, err := resolver.LookupMX(ctx, name)
+		if err != nil && !dns.IsNotFound(err) {
+			ld.Error = "mx: " + err.Error()
+			return
+		}
+		for _, mx := range mxl {
+			ld.MX = append(ld.MX, strings.TrimSuffix(mx.Host, "."))
+		}
+	}
+
+	var wg sync.WaitGroup
+	work := make(chan *LookalikeDomain)
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ld := range work {
+				check(ld)
+			}
+		}()
+	}
+	for i := range l {
+		work <- &l[i]
+	}
+	close(work)
+	wg.Wait()
+	return l
+}
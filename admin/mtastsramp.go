@@ -0,0 +1,190 @@
+package admin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"runtime/debug"
+	"time"
+
+	"github.com/mjl-/mox/config"
+	"github.com/mjl-/mox/dns"
+	"github.com/mjl-/mox/metrics"
+	"github.com/mjl-/mox/mlog"
+	"github.com/mjl-/mox/mox-"
+	"github.com/mjl-/mox/mtasts"
+	"github.com/mjl-/mox/tlsrpt"
+	"github.com/mjl-/mox/tlsrptdb"
+	"github.com/mjl-/mox/webhook"
+)
+
+// Stages for automatically increasing the MaxAge of an MTA-STS policy. We start
+// short so mistakes in a policy don't linger in caches of remote mail servers for
+// long.
+var mtastsRampStages = []time.Duration{
+	24 * time.Hour,
+	7 * 24 * time.Hour,
+	28 * 24 * time.Hour,
+}
+
+// Format of policy IDs we generate, and that we parse to determine when a policy
+// was last changed.
+const mtastsPolicyIDFormat = "20060102T150405"
+
+// StartMTASTSRamp launches a goroutine that checks once a day whether the MaxAge
+// of MTA-STS policies of domains with MaxAgeRampDays set can be increased to the
+// next stage.
+func StartMTASTSRamp(resolver dns.Resolver) {
+	go func() {
+		log := mlog.New("mtastsramp", nil)
+
+		defer func() {
+			// In case of panic don't take the whole program down.
+			x := recover()
+			if x != nil {
+				log.Error("recover from panic", slog.Any("panic", x))
+				debug.PrintStack()
+				metrics.PanicInc(metrics.Admin)
+			}
+		}()
+
+		timer := time.NewTimer(time.Hour) // Reset below.
+		defer timer.Stop()
+
+		ctx := mox.Shutdown
+
+		for {
+			clog := log.WithCid(mox.Cid())
+			for _, name := range mox.Conf.Domains() {
+				d, ok := mox.Conf.Domain(dns.Domain{ASCII: name})
+				if !ok || d.MTASTS == nil || d.MTASTS.MaxAgeRampDays <= 0 {
+					continue
+				}
+				if err := mtastsRampDomain(ctx, clog, resolver, time.Now(), d); err != nil {
+					clog.Errorx("ramping up mta-sts policy max age", err, slog.String("domain", name))
+				}
+			}
+
+			timer.Reset(24 * time.Hour)
+			select {
+			case <-ctx.Done():
+				log.Info("mta-sts max age ramp shutting down")
+				return
+			case <-timer.C:
+			}
+		}
+	}()
+}
+
+// mtastsNextMaxAge returns the next MaxAge stage for a policy currently at
+// maxAge, or false if the last stage has been reached.
+func mtastsNextMaxAge(maxAge time.Duration) (time.Duration, bool) {
+	for _, d := range mtastsRampStages {
+		if d > maxAge {
+			return d, true
+		}
+	}
+	return 0, false
+}
+
+// mtastsRampDomain increases the MaxAge of the MTA-STS policy of domain d to the
+// next stage if the policy has been unchanged for long enough, the current
+// policy ID has been published in DNS, and TLS reports covering each day since
+// have been received without failures.
+func mtastsRampDomain(ctx context.Context, log mlog.Log, resolver dns.Resolver, now time.Time, d config.Domain) error {
+	sts := d.MTASTS
+	if sts.Mode == mtasts.ModeNone {
+		return nil
+	}
+	maxAge, ok := mtastsNextMaxAge(sts.MaxAge)
+	if !ok {
+		return nil
+	}
+
+	changed, err := time.ParseInLocation(mtastsPolicyIDFormat, sts.PolicyID, time.UTC)
+	if err != nil {
+		log.Debug("policy id not in expected format, not ramping up mta-sts max age", slog.String("domain", d.Domain.Name()), slog.String("policyid", sts.PolicyID))
+		return nil
+	}
+	period := time.Duration(sts.MaxAgeRampDays) * 24 * time.Hour
+	start := now.Add(-period)
+	if changed.After(start) {
+		return nil
+	}
+
+	record, _, err := mtasts.LookupRecord(ctx, log.Logger, resolver, d.Domain)
+	if err != nil {
+		return fmt.Errorf("looking up mta-sts dns record: %v", err)
+	} else if record.ID != sts.PolicyID {
+		log.Info("mta-sts dns record does not have current policy id, not ramping up max age", slog.String("domain", d.Domain.Name()), slog.String("dnsid", record.ID), slog.String("policyid", sts.PolicyID))
+		return nil
+	}
+
+	records, err := tlsrptdb.RecordsPeriodDomain(ctx, start, now, d.Domain)
+	if err != nil {
+		return fmt.Errorf("looking up tls reports: %v", err)
+	}
+	days := map[string]bool{}
+	for _, r := range records {
+		for _, p := range r.Report.Policies {
+			if p.Policy.Type != tlsrpt.STS {
+				continue
+			}
+			if p.Summary.TotalFailureSessionCount > 0 {
+				log.Info("tls reports with mta-sts failures, not ramping up max age", slog.String("domain", d.Domain.Name()), slog.Int64("reportid", r.ID))
+				return nil
+			}
+			days[r.Report.DateRange.Start.UTC().Format("20060102")] = true
+		}
+	}
+	if len(days) < sts.MaxAgeRampDays {
+		log.Debug("not enough days covered by tls reports, not ramping up mta-sts max age", slog.String("domain", d.Domain.Name()), slog.Int("days", len(days)), slog.Int("needed", sts.MaxAgeRampDays))
+		return nil
+	}
+
+	policyID := now.UTC().Format(mtastsPolicyIDFormat)
+	err = DomainSave(ctx, d.Domain.Name(), func(domain *config.Domain) error {
+		if domain.MTASTS == nil || domain.MTASTS.PolicyID != sts.PolicyID {
+			return fmt.Errorf("mta-sts policy changed concurrently")
+		}
+		nsts := *domain.MTASTS
+		nsts.MaxAge = maxAge
+		nsts.PolicyID = policyID
+		domain.MTASTS = &nsts
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("saving domain config: %v", err)
+	}
+	txt := mtasts.Record{Version: "STSv1", ID: policyID}.String()
+	log.Info("mta-sts policy max age increased, update the policy id in the _mta-sts dns txt record",
+		slog.String("domain", d.Domain.Name()),
+		slog.Duration("maxage", maxAge),
+		slog.String("policyid", policyID),
+		slog.String("txtrecord", txt))
+
+	// The admin must update the DNS record. If configured, an admin webhook is
+	// queued, recording the change and allowing automation to act on it.
+	defer mox.Conf.DynamicLockUnlock()()
+	adminHookLocked(ctx, log, webhook.Admin{Event: webhook.EventMTASTSRamp, Domain: d.Domain.Name(), DNSRecord: txt})
+	return nil
+}
+
+// MTASTSRecordPending returns the DNS TXT record for _mta-sts.<domain> that must
+// be published because the record in DNS does not have the policy ID of the
+// configured MTA-STS policy, e.g. after the policy max age was increased
+// automatically. An empty string is returned if the DNS record is up to date, or
+// no policy is configured.
+func MTASTSRecordPending(ctx context.Context, log mlog.Log, resolver dns.Resolver, d config.Domain) (string, error) {
+	if d.MTASTS == nil {
+		return "", nil
+	}
+	record, _, err := mtasts.LookupRecord(ctx, log.Logger, resolver, d.Domain)
+	if err != nil && !errors.Is(err, mtasts.ErrNoRecord) {
+		return "", fmt.Errorf("looking up mta-sts dns record: %v", err)
+	} else if err == nil && record.ID == d.MTASTS.PolicyID {
+		return "", nil
+	}
+	return mtasts.Record{Version: "STSv1", ID: d.MTASTS.PolicyID}.String(), nil
+}
@@ -0,0 +1,261 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mjl-/mox/config"
+	"github.com/mjl-/mox/dns"
+	"github.com/mjl-/mox/mlog"
+	"github.com/mjl-/mox/mox-"
+	"github.com/mjl-/mox/mtasts"
+	"github.com/mjl-/mox/queue"
+	"github.com/mjl-/mox/tlsrpt"
+	"github.com/mjl-/mox/tlsrptdb"
+	"github.com/mjl-/mox/webhook"
+)
+
+var ctxbg = context.Background()
+
+func TestMTASTSNextMaxAge(t *testing.T) {
+	check := func(maxAge, expMaxAge time.Duration, expOK bool) {
+		t.Helper()
+		nmaxAge, ok := mtastsNextMaxAge(maxAge)
+		tcompare(t, nmaxAge, expMaxAge)
+		tcompare(t, ok, expOK)
+	}
+
+	day := 24 * time.Hour
+	check(0, day, true)
+	check(time.Hour, day, true)
+	check(day, 7*day, true)
+	check(3*day, 7*day, true)
+	check(7*day, 28*day, true)
+	check(28*day, 0, false)
+	check(365*day, 0, false)
+}
+
+func TestMTASTSRamp(t *testing.T) {
+	// Work on a copy of the config, the ramp writes domains.conf. An MTA-STS listener
+	// is needed for domains with an MTA-STS policy.
+	dir := t.TempDir()
+	for _, name := range []string{"mox.conf", "domains.conf"} {
+		buf, err := os.ReadFile(filepath.FromSlash("../testdata/webadmin/" + name))
+		tcheck(t, err, "read config")
+		if name == "mox.conf" {
+			buf = []byte(strings.Replace(string(buf), "\t\t\t- 0.0.0.0\n", "\t\t\t- 0.0.0.0\n\t\tMTASTSHTTPS:\n\t\t\tEnabled: true\n\t\t\tNonTLS: true\n", 1))
+		}
+		err = os.WriteFile(filepath.Join(dir, name), buf, 0600)
+		tcheck(t, err, "write config")
+	}
+	mox.ConfigStaticPath = filepath.Join(dir, "mox.conf")
+	mox.ConfigDynamicPath = filepath.Join(dir, "domains.conf")
+	mox.MustLoadConfig(true, false)
+
+	err := tlsrptdb.Init()
+	tcheck(t, err, "tlsrptdb init")
+	defer tlsrptdb.Close()
+
+	// The ramp queues an admin webhook for the pending DNS record change.
+	err = queue.Init()
+	tcheck(t, err, "queue init")
+	defer queue.Shutdown()
+	mox.Conf.Dynamic.AdminWebhook = &config.AdminWebhook{URL: "http://localhost:1234/admin"}
+
+	log := mlog.New("admin", nil)
+	dom := dns.Domain{ASCII: "mox.example"}
+	day := 24 * time.Hour
+	now := time.Date(2024, 3, 20, 12, 0, 0, 0, time.UTC)
+	const policyID = "20240301T000000"
+	bumpedID := now.Format(mtastsPolicyIDFormat)
+
+	setPolicy := func(maxAge time.Duration) {
+		t.Helper()
+		err := DomainSave(ctxbg, dom.Name(), func(d *config.Domain) error {
+			d.MTASTS = &config.MTASTS{
+				PolicyID:       policyID,
+				Mode:           mtasts.ModeEnforce,
+				MaxAge:         maxAge,
+				MX:             []string{"mox.example"},
+				MaxAgeRampDays: 3,
+			}
+			return nil
+		})
+		tcheck(t, err, "save mta-sts policy")
+	}
+
+	resolver := dns.MockResolver{
+		TXT: map[string][]string{
+			"_mta-sts.mox.example.": {"v=STSv1; id=" + policyID},
+		},
+	}
+
+	// Run a ramp check, with d as the domain config passed in, and check the
+	// resulting policy in the config.
+	ramp := func(resolver dns.Resolver, d config.Domain, expMaxAge time.Duration, expPolicyID string) {
+		t.Helper()
+		err := mtastsRampDomain(ctxbg, log, resolver, now, d)
+		tcheck(t, err, "ramp")
+		nd, ok := mox.Conf.Domain(dom)
+		tcompare(t, ok, true)
+		tcompare(t, nd.MTASTS.MaxAge, expMaxAge)
+		tcompare(t, nd.MTASTS.PolicyID, expPolicyID)
+	}
+	current := func() config.Domain {
+		t.Helper()
+		d, ok := mox.Conf.Domain(dom)
+		tcompare(t, ok, true)
+		return d
+	}
+
+	var nreports int
+	addReport := func(start time.Time, failures int64) {
+		t.Helper()
+		nreports++
+		r := tlsrpt.Report{
+			OrganizationName: "remote.example",
+			DateRange:        tlsrpt.TLSRPTDateRange{Start: start, End: start.Add(day - time.Second)},
+			ReportID:         fmt.Sprintf("report%d", nreports),
+			Policies: []tlsrpt.Result{
+				{
+					Policy:  tlsrpt.ResultPolicy{Type: tlsrpt.STS, Domain: dom.Name()},
+					Summary: tlsrpt.Summary{TotalSuccessfulSessionCount: 10, TotalFailureSessionCount: failures},
+				},
+			},
+		}
+		err := tlsrptdb.AddReport(ctxbg, log, dns.Domain{ASCII: "remote.example"}, "tlsrpt@remote.example", false, &r)
+		tcheck(t, err, "add tls report")
+	}
+
+	setPolicy(0)
+
+	// No tls reports yet.
+	ramp(resolver, current(), 0, policyID)
+
+	// Reports for two of the three days is not enough.
+	addReport(now.Add(-2*day).Truncate(day), 0)
+	addReport(now.Add(-day).Truncate(day), 0)
+	ramp(resolver, current(), 0, policyID)
+
+	// Policy ID in dns doesn't match, e.g. not yet updated after policy change.
+	addReport(now.Truncate(day), 0)
+	otherResolver := dns.MockResolver{
+		TXT: map[string][]string{
+			"_mta-sts.mox.example.": {"v=STSv1; id=20240101T000000"},
+		},
+	}
+	ramp(otherResolver, current(), 0, policyID)
+
+	// Missing dns record is an error.
+	err = mtastsRampDomain(ctxbg, log, dns.MockResolver{}, now, current())
+	if err == nil {
+		t.Fatalf("ramp without dns record succeeded, expected error")
+	}
+
+	// Policy changed concurrently, config no longer matches the passed domain.
+	d := current()
+	nsts := *d.MTASTS
+	nsts.PolicyID = "20240201T000000"
+	d.MTASTS = &nsts
+	err = mtastsRampDomain(ctxbg, log, dns.MockResolver{TXT: map[string][]string{"_mta-sts.mox.example.": {"v=STSv1; id=20240201T000000"}}}, now, d)
+	if err == nil {
+		t.Fatalf("ramp with concurrently changed policy succeeded, expected error")
+	}
+	tcompare(t, current().MTASTS.PolicyID, policyID)
+
+	// Policy changed too recently.
+	func() {
+		orig := now
+		defer func() { now = orig }()
+		now = time.Date(2024, 3, 2, 12, 0, 0, 0, time.UTC)
+		ramp(resolver, current(), 0, policyID)
+	}()
+
+	// No webhooks for the checks that didn't ramp.
+	hooks, err := queue.HookList(ctxbg, queue.HookFilter{Event: string(webhook.EventMTASTSRamp)}, queue.HookSort{})
+	tcheck(t, err, "list hooks")
+	tcompare(t, len(hooks), 0)
+
+	// All checks pass, max age goes to the next stage and policy id is updated.
+	ramp(resolver, current(), day, bumpedID)
+	tcompare(t, current().MTASTS.Mode, mtasts.ModeEnforce)
+	tcompare(t, current().MTASTS.MaxAgeRampDays, 3)
+
+	// Admin webhook with the dns record to publish was queued.
+	hooks, err = queue.HookList(ctxbg, queue.HookFilter{Event: string(webhook.EventMTASTSRamp)}, queue.HookSort{})
+	tcheck(t, err, "list hooks")
+	tcompare(t, len(hooks), 1)
+	var data webhook.Admin
+	err = json.Unmarshal([]byte(hooks[0].Payload), &data)
+	tcheck(t, err, "parse webhook payload")
+	tcompare(t, data.Event, webhook.EventMTASTSRamp)
+	tcompare(t, data.Domain, dom.Name())
+	tcompare(t, data.DNSRecord, "v=STSv1; id="+bumpedID)
+
+	// Policy ID was just changed, no further bump.
+	ramp(resolver, current(), day, bumpedID)
+
+	// Stage progression, with policy id reset to an old change time.
+	setPolicy(day)
+	ramp(resolver, current(), 7*day, bumpedID)
+	setPolicy(7 * day)
+	ramp(resolver, current(), 28*day, bumpedID)
+	setPolicy(28 * day)
+	ramp(resolver, current(), 28*day, policyID)
+
+	// Mode none is never ramped.
+	err = DomainSave(ctxbg, dom.Name(), func(d *config.Domain) error {
+		sts := *d.MTASTS
+		sts.Mode = mtasts.ModeNone
+		sts.MaxAge = 0
+		d.MTASTS = &sts
+		return nil
+	})
+	tcheck(t, err, "save mta-sts policy")
+	ramp(resolver, current(), 0, policyID)
+
+	// A report with failures in the period prevents the bump.
+	setPolicy(0)
+	addReport(now.Add(-day).Truncate(day), 1)
+	ramp(resolver, current(), 0, policyID)
+}
+
+func TestMTASTSRecordPending(t *testing.T) {
+	log := mlog.New("admin", nil)
+	const policyID = "20240320T120000"
+	d := config.Domain{
+		Domain: dns.Domain{ASCII: "mox.example"},
+		MTASTS: &config.MTASTS{PolicyID: policyID, Mode: mtasts.ModeEnforce, MaxAge: 24 * time.Hour},
+	}
+
+	check := func(resolver dns.Resolver, d config.Domain, exp string) {
+		t.Helper()
+		txt, err := MTASTSRecordPending(ctxbg, log, resolver, d)
+		tcheck(t, err, "mta-sts record pending")
+		tcompare(t, txt, exp)
+	}
+
+	// DNS record is up to date.
+	check(dns.MockResolver{TXT: map[string][]string{"_mta-sts.mox.example.": {"v=STSv1; id=" + policyID}}}, d, "")
+
+	// DNS record has old policy ID, e.g. after automatic max age increase.
+	check(dns.MockResolver{TXT: map[string][]string{"_mta-sts.mox.example.": {"v=STSv1; id=20240301T000000"}}}, d, "v=STSv1; id="+policyID)
+
+	// No DNS record at all.
+	check(dns.MockResolver{}, d, "v=STSv1; id="+policyID)
+
+	// No MTA-STS policy configured.
+	check(dns.MockResolver{}, config.Domain{Domain: d.Domain}, "")
+
+	// Temporary DNS failure is an error.
+	_, err := MTASTSRecordPending(ctxbg, log, dns.MockResolver{Fail: []string{"txt _mta-sts.mox.example."}}, d)
+	if err == nil {
+		t.Fatalf("mta-sts record pending with dns failure succeeded, expected error")
+	}
+}
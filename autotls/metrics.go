@@ -0,0 +1,66 @@
+package autotls
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/mjl-/mox/mlog"
+)
+
+// Loaded managers by ACME provider name, for gathering metrics.
+var managers = struct {
+	sync.Mutex
+	names map[string]*Manager
+}{names: map[string]*Manager{}}
+
+var metricCertExpiryDesc = prometheus.NewDesc(
+	"mox_autotls_cert_expiry_seconds",
+	"Seconds until expiration of cached certificate, negative if expired.",
+	[]string{
+		"acme", // Name of ACME provider in config.
+		"host",
+	},
+	nil,
+)
+
+// certCollector reports remaining validity of certificates in the caches of all
+// managers on each scrape.
+type certCollector struct{}
+
+func init() {
+	prometheus.MustRegister(certCollector{})
+}
+
+func (certCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- metricCertExpiryDesc
+}
+
+func (certCollector) Collect(ch chan<- prometheus.Metric) {
+	log := mlog.New("autotls", nil)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	managers.Lock()
+	l := map[string]*Manager{}
+	for name, m := range managers.names {
+		l[name] = m
+	}
+	managers.Unlock()
+
+	for name, m := range l {
+		for _, host := range m.Hostnames() {
+			cert, err := m.cachedCert(ctx, host)
+			if err != nil {
+				log.Errorx("get cached certificate for metrics", err, slog.String("acme", name), slog.Any("host", host))
+				continue
+			} else if cert == nil {
+				continue
+			}
+			ch <- prometheus.MustNewConstMetric(metricCertExpiryDesc, prometheus.GaugeValue, time.Until(cert.NotAfter).Seconds(), name, host.ASCII)
+		}
+	}
+}
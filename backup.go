@@ -1,8 +1,11 @@
 package main
 
 import (
+	"bufio"
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
@@ -11,6 +14,7 @@ import (
 	"os"
 	"path/filepath"
 	"runtime"
+	"sort"
 	"strconv"
 	"strings"
 	"syscall"
@@ -19,6 +23,9 @@ import (
 	"github.com/mjl-/bstore"
 
 	"github.com/mjl-/mox/dmarcdb"
+	"github.com/mjl-/mox/eventdb"
+	"github.com/mjl-/mox/greylist"
+	"github.com/mjl-/mox/mlog"
 	"github.com/mjl-/mox/mox-"
 	"github.com/mjl-/mox/moxvar"
 	"github.com/mjl-/mox/mtastsdb"
@@ -32,6 +39,7 @@ func backupctl(ctx context.Context, ctl *ctl) {
 	> "backup"
 	> destdir
 	> "verbose" or ""
+	> "incremental" or ""
 	< stream
 	< "ok" or error
 	*/
@@ -43,6 +51,7 @@ func backupctl(ctx context.Context, ctl *ctl) {
 
 	dstDir := ctl.xread()
 	verbose := ctl.xread() == "verbose"
+	incremental := ctl.xread() == "incremental"
 
 	// Set when an error is encountered. At the end, we warn if set.
 	var incomplete bool
@@ -94,6 +103,25 @@ func backupctl(ctx context.Context, ctl *ctl) {
 		}
 	}
 
+	// For incremental backups, the destination is a repository with a directory per
+	// backup generation, with files deduplicated through hardlinks to content-addressed
+	// files in the objects directory. Message and pack files that haven't changed
+	// since the previous generation are linked from the objects directory, without
+	// reading them.
+	var repoDir string
+	var prevManifest map[string]backupManifestEntry
+	reused := map[string]backupManifestEntry{}   // By manifest path, linked from previous generation.
+	srcStats := map[string]backupManifestEntry{} // By manifest path, size/mtime of source files, without hash.
+	if incremental {
+		repoDir = dstDir
+		dstDir = filepath.Join(repoDir, "generations", time.Now().Format("20060102-150405"))
+		var err error
+		prevManifest, err = backupLatestManifest(repoDir)
+		if err != nil {
+			xwarnx("reading manifest of previous backup generation, making full backup", err)
+		}
+	}
+
 	dstConfigDir := filepath.Join(dstDir, "config")
 	dstDataDir := filepath.Join(dstDir, "data")
 
@@ -317,6 +345,22 @@ func backupctl(ctx context.Context, ctl *ctl) {
 	linkOrCopy := func(srcpath, dstpath string) (bool, error) {
 		ensureDestDir(dstpath)
 
+		if incremental {
+			mp := backupManifestPath(dstDir, dstpath)
+			fi, err := os.Stat(srcpath)
+			if err != nil {
+				return false, err
+			}
+			e, ok := prevManifest[mp]
+			if ok && e.Size == fi.Size() && e.Mtime == fi.ModTime().UnixNano() {
+				if err := os.Link(backupObjectPath(repoDir, e.Hash), dstpath); err == nil {
+					reused[mp] = e
+					return true, nil
+				}
+			}
+			srcStats[mp] = backupManifestEntry{Size: fi.Size(), Mtime: fi.ModTime().UnixNano(), Path: mp}
+		}
+
 		if err := os.Link(srcpath, dstpath); err == nil {
 			return true, nil
 		} else if os.IsNotExist(err) {
@@ -380,6 +424,8 @@ func backupctl(ctx context.Context, ctl *ctl) {
 	backupDB(mtastsdb.DB, "mtasts.db")
 	backupDB(tlsrptdb.ReportDB, "tlsrpt.db")
 	backupDB(tlsrptdb.ResultDB, "tlsrptresult.db")
+	backupDB(eventdb.DB, "events.db")
+	backupDB(greylist.DB, "greylist.db")
 	backupFile("receivedid.key")
 
 	// Acme directory is optional.
@@ -542,6 +588,10 @@ func backupctl(ctx context.Context, ctl *ctl) {
 			if m.ID > maxID {
 				maxID = m.ID
 			}
+			// Packed messages are backed up with their pack file below.
+			if m.PackID != 0 {
+				return nil
+			}
 			mp := store.MessagePath(m.ID)
 			seen[mp] = struct{}{}
 			amp := filepath.Join("accounts", acc.Name, "msg", mp)
@@ -565,6 +615,30 @@ func backupctl(ctx context.Context, ctl *ctl) {
 				slog.Duration("duration", time.Since(tmMsgs)))
 		}
 
+		// Link/copy pack files with compressed data of archived messages. Pack files are
+		// not modified after they are written.
+		seenPacks := map[string]struct{}{}
+		var maxPackID int64
+		err = bstore.QueryDB[store.Pack](ctx, db).ForEach(func(pack store.Pack) error {
+			if pack.ID > maxPackID {
+				maxPackID = pack.ID
+			}
+			pp := filepath.Join("pack", strconv.FormatInt(pack.ID, 10))
+			seenPacks[pp] = struct{}{}
+			app := filepath.Join("accounts", acc.Name, pp)
+			srcpath := filepath.Join(srcDataDir, app)
+			dstpath := filepath.Join(dstDataDir, app)
+			if _, err := linkOrCopy(srcpath, dstpath); err != nil {
+				xerrx("linking/copying account pack file", err, slog.String("srcpath", srcpath), slog.String("dstpath", dstpath))
+			}
+			return nil
+		})
+		if err != nil {
+			xerrx("processing account pack files (not backed up properly)", err)
+		} else {
+			xvlog("account pack files linked/copied", slog.Int("packs", len(seenPacks)))
+		}
+
 		// Read through all files in queue directory and warn about anything we haven't
 		// handled yet. Message files that are newer than we expect from our consistent
 		// database snapshot are ignored.
@@ -592,6 +666,15 @@ func backupctl(ctx context.Context, ctl *ctl) {
 					return nil
 				}
 			}
+			if l[0] == "pack" {
+				if _, ok := seenPacks[p]; ok {
+					return nil
+				}
+				// Skip pack files written since we started on our consistent snapshot.
+				if id, err := strconv.ParseInt(l[len(l)-1], 10, 64); err == nil && len(l) == 2 && id > maxPackID {
+					return nil
+				}
+			}
 			switch p {
 			case "index.db", "junkfilter.db", "junkfilter.bloom":
 				return nil
@@ -640,7 +723,9 @@ func backupctl(ctx context.Context, ctl *ctl) {
 			return nil
 		}
 		p := srcpath[len(srcDataDir)+1:]
-		if p == "queue" || p == "acme" || p == "tmp" {
+		// Message files in msgstore are backed up as part of accounts, their data in the
+		// backup is not deduplicated.
+		if p == "queue" || p == "acme" || p == "tmp" || p == "msgstore" {
 			return fs.SkipDir
 		}
 		l := strings.Split(p, string(filepath.Separator))
@@ -657,7 +742,7 @@ func backupctl(ctx context.Context, ctl *ctl) {
 		}
 
 		switch p {
-		case "auth.db", "dmarcrpt.db", "dmarceval.db", "mtasts.db", "tlsrpt.db", "tlsrptresult.db", "receivedid.key", "ctl":
+		case "auth.db", "dmarcrpt.db", "dmarceval.db", "mtasts.db", "tlsrpt.db", "tlsrptresult.db", "events.db", "greylist.db", "receivedid.key", "ctl":
 			// Already handled.
 			return nil
 		case "lastknownversion": // Optional file, not yet handled.
@@ -673,6 +758,23 @@ func backupctl(ctx context.Context, ctl *ctl) {
 		xvlog("walking other files finished", slog.Duration("duration", time.Since(tmWalk)))
 	}
 
+	if incremental {
+		tmDedup := time.Now()
+		stats, err := backupDeduplicate(ctl.log, repoDir, dstDir, reused, srcStats)
+		if err != nil {
+			xerrx("deduplicating backup generation", err, slog.String("dir", dstDir))
+		} else {
+			xvlog("backup generation deduplicated",
+				slog.String("dir", dstDir),
+				slog.Int("files", stats.Files),
+				slog.Int("unchanged", len(reused)),
+				slog.Int("newobjects", stats.NewObjects),
+				slog.Int64("newsize", stats.NewSize),
+				slog.Int("notlinked", stats.NotLinked),
+				slog.Duration("duration", time.Since(tmDedup)))
+		}
+	}
+
 	xvlog("backup finished", slog.Duration("duration", time.Since(tmStart)))
 
 	writer.xclose()
@@ -683,3 +785,271 @@ func backupctl(ctx context.Context, ctl *ctl) {
 		ctl.xwriteok()
 	}
 }
+
+// backupManifestEntry is a line in the manifest of an incremental backup
+// generation, stored in file "manifest" in the generation directory. The manifest
+// is written after all files of the generation have been stored, a generation
+// without manifest is incomplete.
+type backupManifestEntry struct {
+	Hash  string // Hex sha256 of contents, name of file in the objects directory.
+	Size  int64  // Of the source file, for message and pack files.
+	Mtime int64  // Unix nanoseconds, of the source file for message and pack files.
+	Path  string // Relative to the generation directory, with slashes.
+}
+
+// backupManifestPath returns the path in the manifest for file path in
+// generation directory genDir.
+func backupManifestPath(genDir, path string) string {
+	return filepath.ToSlash(path[len(genDir)+1:])
+}
+
+// backupObjectPath returns the path of a content-addressed file in an incremental
+// backup repository.
+func backupObjectPath(repoDir, hash string) string {
+	return filepath.Join(repoDir, "objects", hash[:2], hash)
+}
+
+// backupGenerations returns the names of generation directories of an incremental
+// backup repository, oldest first.
+func backupGenerations(repoDir string) ([]string, error) {
+	l, err := os.ReadDir(filepath.Join(repoDir, "generations"))
+	if err != nil && os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, e := range l {
+		if e.IsDir() {
+			names = append(names, e.Name())
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// readBackupManifest reads the manifest of a generation, returning entries by
+// path. If the manifest does not exist, the generation is incomplete and an error
+// matching os.IsNotExist is returned.
+func readBackupManifest(genDir string) (map[string]backupManifestEntry, error) {
+	f, err := os.Open(filepath.Join(genDir, "manifest"))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	entries := map[string]backupManifestEntry{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		t := strings.SplitN(scanner.Text(), " ", 4)
+		if len(t) != 4 || len(t[0]) != 2*sha256.Size {
+			return nil, fmt.Errorf("malformed manifest line %q", scanner.Text())
+		}
+		size, err := strconv.ParseInt(t[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("parsing size in manifest line %q: %v", scanner.Text(), err)
+		}
+		mtime, err := strconv.ParseInt(t[2], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("parsing mtime in manifest line %q: %v", scanner.Text(), err)
+		}
+		entries[t[3]] = backupManifestEntry{t[0], size, mtime, t[3]}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading manifest: %v", err)
+	}
+	return entries, nil
+}
+
+// backupLatestManifest returns the manifest of the most recent complete
+// generation, or nil if there is none.
+func backupLatestManifest(repoDir string) (map[string]backupManifestEntry, error) {
+	names, err := backupGenerations(repoDir)
+	if err != nil {
+		return nil, fmt.Errorf("listing backup generations: %v", err)
+	}
+	for i := len(names) - 1; i >= 0; i-- {
+		entries, err := readBackupManifest(filepath.Join(repoDir, "generations", names[i]))
+		if err != nil && os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("generation %s: %v", names[i], err)
+		}
+		return entries, nil
+	}
+	return nil, nil
+}
+
+type backupDedupStats struct {
+	Files      int   // Regular files in generation.
+	NewObjects int   // Files not seen in earlier generations, added to objects directory.
+	NewSize    int64 // Size of new objects.
+	NotLinked  int   // Files with existing object that could not be replaced with a hardlink, e.g. due to link limits.
+}
+
+// backupDeduplicate replaces the regular files in generation directory genDir with
+// hardlinks to files with the same contents in the objects directory of the
+// repository, adding new files to the objects directory, and writes the manifest
+// of the generation. Files in reused are already linked from the objects
+// directory. Sizes and mtimes in srcStats are stored in the manifest instead of
+// those of the copied files.
+func backupDeduplicate(log mlog.Log, repoDir, genDir string, reused, srcStats map[string]backupManifestEntry) (stats backupDedupStats, rerr error) {
+	hashFile := func(path string) (string, error) {
+		f, err := os.Open(path)
+		if err != nil {
+			return "", err
+		}
+		defer f.Close()
+		h := sha256.New()
+		if _, err := io.Copy(h, f); err != nil {
+			return "", err
+		}
+		return hex.EncodeToString(h.Sum(nil)), nil
+	}
+
+	var entries []backupManifestEntry
+	err := filepath.WalkDir(genDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		stats.Files++
+		mp := backupManifestPath(genDir, path)
+		if e, ok := reused[mp]; ok {
+			entries = append(entries, e)
+			return nil
+		}
+
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+		hash, err := hashFile(path)
+		if err != nil {
+			return fmt.Errorf("hashing %s: %v", path, err)
+		}
+		e := backupManifestEntry{hash, fi.Size(), fi.ModTime().UnixNano(), mp}
+		if s, ok := srcStats[mp]; ok {
+			e.Size = s.Size
+			e.Mtime = s.Mtime
+		}
+		entries = append(entries, e)
+
+		op := backupObjectPath(repoDir, hash)
+		if _, err := os.Stat(op); err == nil {
+			// Replace file with hardlink to existing object. If that fails, we keep the
+			// file, the backup is still complete.
+			tmppath := path + ".dedup"
+			if err := os.Link(op, tmppath); err != nil {
+				log.Debugx("linking existing object for backup file, keeping copy", err, slog.String("path", path))
+				stats.NotLinked++
+			} else if err := os.Rename(tmppath, path); err != nil {
+				xerr := os.Remove(tmppath)
+				log.Check(xerr, "removing temporary hardlink to object")
+				return fmt.Errorf("replacing %s with link to object: %v", path, err)
+			}
+			return nil
+		} else if !os.IsNotExist(err) {
+			return fmt.Errorf("stat object: %v", err)
+		}
+		os.MkdirAll(filepath.Dir(op), 0770)
+		if err := os.Link(path, op); err != nil {
+			return fmt.Errorf("adding %s to objects directory: %v", path, err)
+		}
+		stats.NewObjects++
+		stats.NewSize += fi.Size()
+		return nil
+	})
+	if err != nil {
+		return stats, err
+	}
+
+	// Write manifest, marking the generation complete.
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Path < entries[j].Path
+	})
+	var b bytes.Buffer
+	for _, e := range entries {
+		fmt.Fprintf(&b, "%s %d %d %s\n", e.Hash, e.Size, e.Mtime, e.Path)
+	}
+	tmppath := filepath.Join(genDir, "manifest.tmp")
+	if err := os.WriteFile(tmppath, b.Bytes(), 0660); err != nil {
+		return stats, fmt.Errorf("writing manifest: %v", err)
+	}
+	if err := os.Rename(tmppath, filepath.Join(genDir, "manifest")); err != nil {
+		return stats, fmt.Errorf("moving manifest into place: %v", err)
+	}
+	return stats, nil
+}
+
+// backupPrune removes all but the keep most recent complete generations from an
+// incremental backup repository, and all incomplete generations. Objects no longer
+// referenced by any remaining generation are removed. If the most recent
+// generation is incomplete, a backup may be in progress and an error is returned.
+func backupPrune(repoDir string, keep int) (removedGenerations []string, removedObjects int, freed int64, rerr error) {
+	names, err := backupGenerations(repoDir)
+	if err != nil {
+		return nil, 0, 0, fmt.Errorf("listing backup generations: %v", err)
+	}
+
+	if len(names) > 0 {
+		if _, err := os.Stat(filepath.Join(repoDir, "generations", names[len(names)-1], "manifest")); err != nil && os.IsNotExist(err) {
+			return nil, 0, 0, fmt.Errorf("most recent generation %s is incomplete, a backup may be in progress (remove the generation if not)", names[len(names)-1])
+		} else if err != nil {
+			return nil, 0, 0, fmt.Errorf("checking most recent generation: %v", err)
+		}
+	}
+
+	// Determine which generations to keep, from newest to oldest.
+	referenced := map[string]struct{}{}
+	var ncomplete int
+	for i := len(names) - 1; i >= 0; i-- {
+		genDir := filepath.Join(repoDir, "generations", names[i])
+		entries, err := readBackupManifest(genDir)
+		if err != nil && !os.IsNotExist(err) {
+			return removedGenerations, 0, 0, fmt.Errorf("generation %s: %v", names[i], err)
+		}
+		if err == nil && ncomplete < keep {
+			for _, e := range entries {
+				referenced[e.Hash] = struct{}{}
+			}
+			ncomplete++
+			continue
+		}
+		if err := os.RemoveAll(genDir); err != nil {
+			return removedGenerations, 0, 0, fmt.Errorf("removing generation %s: %v", names[i], err)
+		}
+		removedGenerations = append(removedGenerations, names[i])
+	}
+
+	objectsDir := filepath.Join(repoDir, "objects")
+	err = filepath.WalkDir(objectsDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil && os.IsNotExist(err) && path == objectsDir {
+			return fs.SkipDir
+		} else if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		if _, ok := referenced[d.Name()]; ok {
+			return nil
+		}
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if err := os.Remove(path); err != nil {
+			return fmt.Errorf("removing object: %v", err)
+		}
+		removedObjects++
+		freed += fi.Size()
+		return nil
+	})
+	if err != nil {
+		return removedGenerations, removedObjects, freed, fmt.Errorf("removing unreferenced objects: %v", err)
+	}
+	return removedGenerations, removedObjects, freed, nil
+}
@@ -9,12 +9,14 @@ import (
 	"net/url"
 	"reflect"
 	"regexp"
+	"slices"
 	"time"
 
 	"github.com/mjl-/mox/autotls"
 	"github.com/mjl-/mox/dns"
 	"github.com/mjl-/mox/junk"
 	"github.com/mjl-/mox/mtasts"
+	"github.com/mjl-/mox/oauthbearer"
 	"github.com/mjl-/mox/smtp"
 )
 
@@ -65,14 +67,25 @@ type Static struct {
 
 		ParsedLocalpart smtp.Localpart `sconf:"-"`
 	} `sconf:"optional" sconf-doc:"Destination for per-host TLS reports (TLSRPT). TLS reports can be per recipient domain (for MTA-STS), or per MX host (for DANE). The per-domain TLS reporting configuration is in domains.conf. This is the TLS reporting configuration for this host. If absent, no host-based TLSRPT address is configured, and no host TLSRPT DNS record is suggested."`
-	InitialMailboxes InitialMailboxes     `sconf:"optional" sconf-doc:"Mailboxes to create for new accounts. Inbox is always created. Mailboxes can be given a 'special-use' role, which are understood by most mail clients. If absent/empty, the following mailboxes are created: Sent, Archive, Trash, Drafts and Junk."`
-	DefaultMailboxes []string             `sconf:"optional" sconf-doc:"Deprecated in favor of InitialMailboxes. Mailboxes to create when adding an account. Inbox is always created. If no mailboxes are specified, the following are automatically created: Sent, Archive, Trash, Drafts and Junk."`
-	Transports       map[string]Transport `sconf:"optional" sconf-doc:"Transport are mechanisms for delivering messages. Transports can be referenced from Routes in accounts, domains and the global configuration. There is always an implicit/fallback delivery transport doing direct delivery with SMTP from the outgoing message queue. Transports are typically only configured when using smarthosts, i.e. when delivering through another SMTP server. Zero or one transport methods must be set in a transport, never multiple. When using an external party to send email for a domain, keep in mind you may have to add their IP address to your domain's SPF record, and possibly additional DKIM records."`
+	InitialMailboxes InitialMailboxes           `sconf:"optional" sconf-doc:"Mailboxes to create for new accounts. Inbox is always created. Mailboxes can be given a 'special-use' role, which are understood by most mail clients. If absent/empty, the following mailboxes are created: Sent, Archive, Trash, Drafts and Junk."`
+	DefaultMailboxes []string                   `sconf:"optional" sconf-doc:"Deprecated in favor of InitialMailboxes. Mailboxes to create when adding an account. Inbox is always created. If no mailboxes are specified, the following are automatically created: Sent, Archive, Trash, Drafts and Junk."`
+	AccountTemplates map[string]AccountTemplate `sconf:"optional" sconf-doc:"Templates for new accounts, e.g. for different plans offered by a provider. A template can be selected when adding an account. Keys are template names."`
+	Transports       map[string]Transport       `sconf:"optional" sconf-doc:"Transport are mechanisms for delivering messages. Transports can be referenced from Routes in accounts, domains and the global configuration. There is always an implicit/fallback delivery transport doing direct delivery with SMTP from the outgoing message queue. Transports are typically only configured when using smarthosts, i.e. when delivering through another SMTP server. Zero or one transport methods must be set in a transport, never multiple. When using an external party to send email for a domain, keep in mind you may have to add their IP address to your domain's SPF record, and possibly additional DKIM records."`
+	KeepEventsPeriod time.Duration              `sconf:"optional" sconf-doc:"Period to keep events in the lifecycle of messages in the event database, e.g. incoming messages received, junk verdicts, deliveries to mailboxes, and outgoing messages queued, delivery attempts and bounces. Used for tracing messages, the delivery status of outgoing messages, and statistics. Default 720h (30 days)."`
 	// Awkward naming of fields to get intended default behaviour for zero values.
-	NoOutgoingDMARCReports          bool  `sconf:"optional" sconf-doc:"Do not send DMARC reports (aggregate only). By default, aggregate reports on DMARC evaluations are sent to domains if their DMARC policy requests them. Reports are sent at whole hours, with a minimum of 1 hour and maximum of 24 hours, rounded up so a whole number of intervals cover 24 hours, aligned at whole days in UTC. Reports are sent from the postmaster@<mailhostname> address."`
-	NoOutgoingTLSReports            bool  `sconf:"optional" sconf-doc:"Do not send TLS reports. By default, reports about failed SMTP STARTTLS connections and related MTA-STS/DANE policies are sent to domains if their TLSRPT DNS record requests them. Reports covering a 24 hour UTC interval are sent daily. Reports are sent from the postmaster address of the configured domain the mailhostname is in. If there is no such domain, or it does not have DKIM configured, no reports are sent."`
-	OutgoingTLSReportsForAllSuccess bool  `sconf:"optional" sconf-doc:"Also send TLS reports if there were no SMTP STARTTLS connection failures. By default, reports are only sent when at least one failure occurred. If a report is sent, it does always include the successful connection counts as well."`
-	QuotaMessageSize                int64 `sconf:"optional" sconf-doc:"Default maximum total message size in bytes for each individual account, only applicable if greater than zero. Can be overridden per account. Attempting to add new messages to an account beyond its maximum total size will result in an error. Useful to prevent a single account from filling storage. The quota only applies to the email message files, not to any file system overhead and also not the message index database file (account for approximately 15% overhead)."`
+	NoOutgoingDMARCReports          bool                `sconf:"optional" sconf-doc:"Do not send DMARC reports (aggregate only). By default, aggregate reports on DMARC evaluations are sent to domains if their DMARC policy requests them. Reports are sent at whole hours, with a minimum of 1 hour and maximum of 24 hours, rounded up so a whole number of intervals cover 24 hours, aligned at whole days in UTC. Reports are sent from the postmaster@<mailhostname> address."`
+	NoOutgoingTLSReports            bool                `sconf:"optional" sconf-doc:"Do not send TLS reports. By default, reports about failed SMTP STARTTLS connections and related MTA-STS/DANE policies are sent to domains if their TLSRPT DNS record requests them. Reports covering a 24 hour UTC interval are sent daily. Reports are sent from the postmaster address of the configured domain the mailhostname is in. If there is no such domain, or it does not have DKIM configured, no reports are sent."`
+	OutgoingTLSReportsForAllSuccess bool                `sconf:"optional" sconf-doc:"Also send TLS reports if there were no SMTP STARTTLS connection failures. By default, reports are only sent when at least one failure occurred. If a report is sent, it does always include the successful connection counts as well."`
+	QuotaMessageSize                int64               `sconf:"optional" sconf-doc:"Default maximum total message size in bytes for each individual account, only applicable if greater than zero. Can be overridden per account. Attempting to add new messages to an account beyond its maximum total size will result in an error. Useful to prevent a single account from filling storage. The quota only applies to the email message files, not to any file system overhead and also not the message index database file (account for approximately 15% overhead)."`
+	PasswordPolicy                  PasswordPolicy      `sconf:"optional" sconf-doc:"Requirements for new passwords of accounts and domain admins, enforced when passwords are set through the account and admin web interfaces and the command-line. Generated passwords are not checked."`
+	OutgoingHold                    *OutgoingHold       `sconf:"optional" sconf-doc:"Automatically hold outgoing messages of accounts that appear to be compromised, for review by the admin. When a message submitted by an account trips one of the heuristics, a hold rule for the account is added to the queue, causing its queued and newly submitted messages to be held, and a notification is delivered to the postmaster mailbox. The held messages can be released or dropped on the queue page of the admin web interface."`
+	WebSessions                     WebSessions         `sconf:"optional" sconf-doc:"Limits for login sessions of accounts in the webmail and account web interfaces. Sessions of the admin web interface are not affected."`
+	OAuth                           *OAuth              `sconf:"optional" sconf-doc:"If configured, IMAP and SMTP submission accept authentication with OAuth 2.0 bearer tokens through SASL mechanisms OAUTHBEARER and XOAUTH2, for organizations that use single sign-on with an OpenID Connect provider, so users don't need a password per application. Tokens must be JWTs signed by the issuer, for the audience, with the required scopes, and not expired. The email address in the token must be an address of an account. Bearer tokens are only accepted over TLS."`
+	MessageCompression              *MessageCompression `sconf:"optional" sconf-doc:"If configured, message files of new messages are stored gzip-compressed, saving disk space. Compressed messages are decompressed transparently when accessed, the message size as seen by IMAP clients does not change. Can be overridden per account. Existing messages are compressed with \"mox compressmsgs\"."`
+	DeduplicateMessages             bool                `sconf:"optional" sconf-doc:"Store message files with identical data only once, shared between mailboxes and accounts, saving disk space for messages delivered to many recipients, e.g. from mailing lists. New messages are hardlinked to a file named after the SHA-256 hash of the data in the msgstore directory in the data directory. Files in msgstore no longer used by any message are removed daily. Does not apply to compressed or encrypted messages. Only effective if the file system supports hardlinks."`
+	MessageEncryptionKeyFile        string              `sconf:"optional" sconf-doc:"File containing the master key for accounts with MessageEncryption with KeyWrap \"masterkey\", as base64-encoded 32 bytes. The master key protects the message keys of the accounts, stored in the account databases. Keep the file outside the data directory, so a copy of the data directory alone does not expose message contents. Create a key with \"mox messageencryption genkey\". The master key cannot be changed while accounts have message keys wrapped with it. If a relative path, it is relative to the directory of mox.conf."`
+	MessageEncryptionKey            []byte              `sconf:"-" json:"-"`
+	SieveNotifyHTTP                 *SieveNotifyHTTP    `sconf:"optional" sconf-doc:"If configured, sieve scripts of accounts can send notifications with the http, https, ntfy and gotify methods, to the configured hosts. Sieve scripts are managed by account users, so by default only mailto notifications are sent."`
 
 	// All IPs that were explicitly listened on for external SMTP. Only set when there
 	// are no unspecified external SMTP listeners and there is at most one for IPv4 and
@@ -88,6 +101,35 @@ type Static struct {
 	GID uint32 `sconf:"-" json:"-"`
 }
 
+// PasswordPolicy has requirements for new passwords.
+type PasswordPolicy struct {
+	MinLength         int         `sconf:"optional" sconf-doc:"Minimum length of passwords in bytes, after normalization. Default and minimum 8."`
+	MinEntropy        int         `sconf:"optional" sconf-doc:"Minimum estimated entropy of passwords in bits, if greater than zero. The estimate is based on the classes of characters used (lower case, upper case, digits, symbols and other) and the length, with characters that were already used contributing 1 bit. For example, a random 8-character password with distinct lower case letters and digits is estimated at 41 bits. Recommended value: 40."`
+	BreachedFile      string      `sconf:"optional" sconf-doc:"Bloom filter file with breached passwords, refused as new passwords. If a relative path, it is relative to the directory of mox.conf. The filter contains SHA-1 hashes of passwords in upper case hexadecimal, as in the Have I Been Pwned (HIBP) password lists. Passwords not in the filter are always allowed, but some passwords not in the original list are refused due to false positives. Create the file with 'mox passwordfilter make'. The file is read into memory at startup."`
+	BreachedFileK     int         `sconf:"optional" sconf-doc:"Number of bits in the bloom filter for each password, must be the same as when the filter was created. Default 7."`
+	BreachedFileBloom *junk.Bloom `sconf:"-" json:"-"`
+}
+
+// OutgoingHold has the heuristics for detecting compromised accounts by their
+// outgoing messages and logins. Heuristics with zero values are disabled.
+type OutgoingHold struct {
+	MessagesPerHour            int  `sconf:"optional" sconf-doc:"Hold if the account submitted more than this many messages in the past hour, e.g. a sudden spike in volume. Each recipient counts as a message. Should be well below MaxOutgoingMessagesPerDay of the accounts."`
+	FirstTimeRecipientsPerHour int  `sconf:"optional" sconf-doc:"Hold if the messages submitted in the past hour have more than this many first-time recipients, i.e. addresses the account has not sent to before."`
+	NewNetworkLogin            bool `sconf:"optional" sconf-doc:"Hold if a message is submitted over a connection from a network the account did not log in from successfully before the past 24 hours, while it did log in from other networks in the past 30 days. Networks are /16 for IPv4 and /48 for IPv6. Mox has no database with countries of IP addresses, logins from new networks are an approximation of logins from new countries."`
+}
+
+// AccountTemplate holds the settings for accounts added with the template.
+// Settings that are absent/zero use the defaults for new accounts.
+type AccountTemplate struct {
+	Description                  string           `sconf:"optional" sconf-doc:"Free-form description of the template, e.g. the plan."`
+	InitialMailboxes             InitialMailboxes `sconf:"optional" sconf-doc:"Mailboxes to create for new accounts, instead of the global InitialMailboxes. Inbox is always created."`
+	JunkFilter                   *JunkFilter      `sconf:"optional" sconf-doc:"Junk filter settings for new accounts, instead of the default junk filter settings."`
+	Rulesets                     []Ruleset        `sconf:"optional" sconf-doc:"Rulesets for the initial address of new accounts, e.g. for delivering messages from mailing lists to a separate mailbox."`
+	QuotaMessageSize             int64            `sconf:"optional" sconf-doc:"Maximum total message size in bytes for new accounts."`
+	MaxOutgoingMessagesPerDay    int              `sconf:"optional" sconf-doc:"Maximum number of outgoing messages in a 24 hour window for new accounts."`
+	MaxFirstTimeRecipientsPerDay int              `sconf:"optional" sconf-doc:"Maximum number of first-time recipients in outgoing messages in a 24 hour window for new accounts."`
+}
+
 // InitialMailboxes are mailboxes created for a new account.
 type InitialMailboxes struct {
 	SpecialUse SpecialUseMailboxes `sconf:"optional" sconf-doc:"Special-use roles to mailbox to create."`
@@ -107,18 +149,100 @@ type SpecialUseMailboxes struct {
 
 // Dynamic is the parsed form of domains.conf, and is automatically reloaded when changed.
 type Dynamic struct {
-	Domains            map[string]Domain  `sconf-doc:"NOTE: This config file is in 'sconf' format. Indent with tabs. Comments must be on their own line, they don't end a line. Do not escape or quote strings. Details: https://pkg.go.dev/github.com/mjl-/sconf.\n\n\nDomains for which email is accepted. For internationalized domains, use their IDNA names in UTF-8."`
-	Accounts           map[string]Account `sconf-doc:"Accounts represent mox users, each with a password and email address(es) to which email can be delivered (possibly at different domains). Each account has its own on-disk directory holding its messages and index database. An account name is not an email address."`
-	WebDomainRedirects map[string]string  `sconf:"optional" sconf-doc:"Redirect all requests from domain (key) to domain (value). Always redirects to HTTPS. For plain HTTP redirects, use a WebHandler with a WebRedirect."`
-	WebHandlers        []WebHandler       `sconf:"optional" sconf-doc:"Handle webserver requests by serving static files, redirecting, reverse-proxying HTTP(s) or passing the request to an internal service. The first matching WebHandler will handle the request. Built-in system handlers, e.g. for ACME validation, autoconfig and mta-sts always run first. Built-in handlers for admin, account, webmail and webapi are evaluated after all handlers, including webhandlers (allowing for overrides of internal services for some domains). If no handler matches, the response status code is file not found (404). If webserver features are missing, forward the requests to an application that provides the needed functionality itself."`
-	Routes             []Route            `sconf:"optional" sconf-doc:"Routes for delivering outgoing messages through the queue. Each delivery attempt evaluates account routes, domain routes and finally these global routes. The transport of the first matching route is used in the delivery attempt. If no routes match, which is the default with no configured routes, messages are delivered directly from the queue."`
-	MonitorDNSBLs      []string           `sconf:"optional" sconf-doc:"DNS blocklists to periodically check with if IPs we send from are present, without using them for checking incoming deliveries.. Also see DNSBLs in SMTP listeners in mox.conf, which specifies DNSBLs to use both for incoming deliveries and for checking our IPs against. Example DNSBLs: sbl.spamhaus.org, bl.spamcop.net."`
+	Domains            map[string]Domain      `sconf-doc:"NOTE: This config file is in 'sconf' format. Indent with tabs. Comments must be on their own line, they don't end a line. Do not escape or quote strings. Details: https://pkg.go.dev/github.com/mjl-/sconf.\n\n\nDomains for which email is accepted. For internationalized domains, use their IDNA names in UTF-8."`
+	Accounts           map[string]Account     `sconf-doc:"Accounts represent mox users, each with a password and email address(es) to which email can be delivered (possibly at different domains). Each account has its own on-disk directory holding its messages and index database. An account name is not an email address."`
+	WebDomainRedirects map[string]string      `sconf:"optional" sconf-doc:"Redirect all requests from domain (key) to domain (value). Always redirects to HTTPS. For plain HTTP redirects, use a WebHandler with a WebRedirect."`
+	WebHandlers        []WebHandler           `sconf:"optional" sconf-doc:"Handle webserver requests by serving static files, redirecting, reverse-proxying HTTP(s) or passing the request to an internal service. The first matching WebHandler will handle the request. Built-in system handlers, e.g. for ACME validation, autoconfig and mta-sts always run first. Built-in handlers for admin, account, webmail and webapi are evaluated after all handlers, including webhandlers (allowing for overrides of internal services for some domains). If no handler matches, the response status code is file not found (404). If webserver features are missing, forward the requests to an application that provides the needed functionality itself."`
+	Routes             []Route                `sconf:"optional" sconf-doc:"Routes for delivering outgoing messages through the queue. Each delivery attempt evaluates account routes, domain routes and finally these global routes. The transport of the first matching route is used in the delivery attempt. If no routes match, which is the default with no configured routes, messages are delivered directly from the queue."`
+	MonitorDNSBLs      []string               `sconf:"optional" sconf-doc:"DNS blocklists to periodically check with if IPs we send from are present, without using them for checking incoming deliveries.. Also see DNSBLs in SMTP listeners in mox.conf, which specifies DNSBLs to use both for incoming deliveries and for checking our IPs against. Example DNSBLs: sbl.spamhaus.org, bl.spamcop.net."`
+	DomainAdmins       map[string]DomainAdmin `sconf:"optional" sconf-doc:"Admins that can only manage specific domains, and the accounts and addresses within those domains, through the admin web interface. For example for resellers. Keyed by login name, which is entered along with the password when logging in. The global admin logs in with an empty login name."`
+	AdminTokens        map[string]AdminToken  `sconf:"optional" sconf-doc:"API tokens for calling the functions of the admin web API without logging in, for automation such as control panels and provisioning tools. Keyed by token name. Requests are JSON HTTP POST requests to /admin/api/<function>, with a JSON object with field \"params\" holding a list of parameters, and header \"Authorization: Bearer <token>\". See /admin/api/ for the documentation of the functions. Add tokens with \"mox config admintoken add\"."`
+	AdminWebhook       *AdminWebhook          `sconf:"optional" sconf-doc:"Webhook for events about configuration changes made through the admin interfaces (web interface, API, command-line), such as domains, accounts or addresses being added or removed. Useful for keeping external provisioning systems in sync. Webhooks are delivered through the webhook queue, with retries."`
+	IMAPClientRules    []IMAPClientRule       `sconf:"optional" sconf-doc:"Rules for allowing or denying IMAP clients, based on the software details they send with the IMAP ID command, such as name and version. Rules are evaluated in order when a client sends an ID command, and again at login if the ID command was sent before authenticating. The first matching rule determines whether the client is allowed. Clients not matching any rule, and clients not sending an ID command, are allowed. The admin API function IMAPClients lists the details sent by clients in use."`
 
 	WebDNSDomainRedirects map[dns.Domain]dns.Domain `sconf:"-" json:"-"`
 	MonitorDNSBLZones     []dns.Domain              `sconf:"-"`
 	ClientSettingDomains  map[dns.Domain]struct{}   `sconf:"-" json:"-"`
 }
 
+// AddListener adds or replaces listener name, initializing Listeners if needed.
+func (c *Static) AddListener(name string, l Listener) {
+	if c.Listeners == nil {
+		c.Listeners = map[string]Listener{}
+	}
+	c.Listeners[name] = l
+}
+
+// AddDomain adds or replaces domain name, initializing Domains if needed.
+func (c *Dynamic) AddDomain(name string, d Domain) {
+	if c.Domains == nil {
+		c.Domains = map[string]Domain{}
+	}
+	c.Domains[name] = d
+}
+
+// AddAccount adds or replaces account name, initializing Accounts if needed.
+func (c *Dynamic) AddAccount(name string, a Account) {
+	if c.Accounts == nil {
+		c.Accounts = map[string]Account{}
+	}
+	c.Accounts[name] = a
+}
+
+// DomainAdmin is an admin with access to only a subset of the domains.
+type DomainAdmin struct {
+	Domains      []string `sconf-doc:"Domains this admin can manage. Domains do not have to exist yet, the admin can add them. Accounts can only be managed if all their addresses are in these domains."`
+	PasswordHash string   `sconf:"optional" sconf-doc:"Bcrypt hash of the password for logging in. Set with \"mox config domainadmin setpassword\". Without password hash, the admin cannot log in."`
+
+	DNSDomains []dns.Domain `sconf:"-" json:"-"` // Parsed form of Domains.
+}
+
+// AdminToken is an API token for the admin web API, with optional restrictions.
+type AdminToken struct {
+	TokenHash   string   `sconf-doc:"SHA-256 hash of the token, base64-encoded. The token itself is only shown when it is added."`
+	Functions   []string `sconf:"optional" sconf-doc:"Names of admin API functions the token can call, e.g. CheckDomain, DomainAdd, AccountAdd, AddressAdd, QueueList. If empty, all functions can be called, except those for login sessions."`
+	DomainAdmin string   `sconf:"optional" sconf-doc:"If set, the token has the permissions of this domain admin: it can only call functions available to domain admins and only manage the domains of the domain admin."`
+}
+
+// AdminWebhook is a webhook for admin events.
+type AdminWebhook struct {
+	URL           string   `sconf-doc:"URL to POST webhooks to for admin events."`
+	Authorization string   `sconf:"optional" sconf-doc:"If not empty, value of Authorization header to add to HTTP requests."`
+	Secret        string   `sconf:"optional" sconf-doc:"If not empty, HTTP requests have a header X-Mox-Webhook-Signature with value \"sha256=\" followed by the hex-encoded HMAC-SHA256 of the request body, with this secret as key. Receivers can verify the signature to check the payload came from this server."`
+	Events        []string `sconf:"optional" sconf-doc:"Events to send webhooks for. If absent, all events are sent. Valid values: domainadded, domainremoved, accountadded, accountremoved, addressadded, addressremoved, addressmoved, dkimadded, dkimremoved, mtastsramp. DKIM key rotation consists of adding a new key and removing an old key. Event mtastsramp is sent when the MTA-STS policy max age of a domain is increased automatically, and the _mta-sts DNS TXT record must be updated."`
+}
+
+// IMAPClientRule allows or denies IMAP clients based on the parameters of their
+// IMAP ID command.
+type IMAPClientRule struct {
+	ParamsRegexp map[string]string `sconf-doc:"ID parameters (keys) with regular expressions (values) that must all match (substrings of) the values sent by the client for the rule to match. Keys are compared case-insensitively. Common keys: name, version, vendor, os, os-version. Parameters not sent by the client are matched as an empty value. Example: key name with value ^OldMail$ and key version with value ^[0-3]\\."`
+	Accounts     []string          `sconf:"optional" sconf-doc:"If non-empty, the rule only matches for these accounts, after authentication."`
+	Action       string            `sconf-doc:"Either \"allow\" or \"deny\". For denied clients, login fails or, if already authenticated, the connection is closed after an untagged BYE response."`
+	Message      string            `sconf:"optional" sconf-doc:"Message included in the response for denied clients, e.g. asking users to upgrade their email client. If empty, a generic message is used."`
+
+	ParamsRegexpCompiled map[string]*regexp.Regexp `sconf:"-" json:"-"`
+}
+
+type SubmissionAccess struct {
+	Networks                     []string `sconf:"optional" sconf-doc:"If non-empty, only connections from these IP addresses or networks in CIDR notation, e.g. 10.0.0.0/8 or 2001:db8::/32, are served. Connections from other IPs are closed, on ports with plain text SMTP after a response with code 421."`
+	RequireClientCertAndPassword bool     `sconf:"optional" sconf-doc:"Require authentication with both a TLS client certificate and a password-based SASL mechanism for the same account before messages can be submitted. The TLS public key of the client certificate must be registered for the account. SASL mechanism EXTERNAL is not accepted."`
+
+	ParsedNetworks []net.IPNet `sconf:"-" json:"-"`
+}
+
+type ProxyProtocol struct {
+	Networks []string `sconf-doc:"IP addresses or networks in CIDR notation of the load balancers sending a PROXY header, e.g. 10.0.0.0/8 or 2001:db8::/32. Connections from these networks without valid PROXY header are closed."`
+
+	ParsedNetworks []net.IPNet `sconf:"-" json:"-"`
+}
+
+type VRFYEXPN struct {
+	Mode     string   `sconf-doc:"Either \"disabled\", responding with code 502 (command not implemented), \"252\", responding with code 252 without verifying the address or expanding the alias (the default), or \"accurate\", verifying addresses and expanding aliases for clients that have authenticated or connect from Networks, and responding with code 252 to other clients. Authenticated clients outside Networks only get members of aliases that have ListMembers set."`
+	Networks []string `sconf:"optional" sconf-doc:"IP addresses or networks in CIDR notation, e.g. 10.0.0.0/8 or 2001:db8::/32, of internal clients that get accurate responses without authenticating, e.g. for internal tooling."`
+
+	ParsedNetworks []net.IPNet `sconf:"-" json:"-"`
+}
+
 type ACME struct {
 	DirectoryURL           string                  `sconf-doc:"For letsencrypt, use https://acme-v02.api.letsencrypt.org/directory."`
 	RenewBefore            time.Duration           `sconf:"optional" sconf-doc:"How long before expiration to renew the certificate. Default is 30 days."`
@@ -158,8 +282,16 @@ type Listener struct {
 
 		FirstTimeSenderDelay *time.Duration `sconf:"optional" sconf-doc:"Delay before accepting a message from a first-time sender for the destination account. Default: 15s."`
 
+		NullSenderProbesPerHour int `sconf:"optional" sconf-doc:"Maximum number of probes with a null reverse path (MAIL FROM:<>) per hour from a remote IP (or /64 for IPv6). A probe is a transaction with a null reverse path that ends without transferring a message, as used for sender address callout verification and by spammers checking whether addresses exist (resulting in backscatter). Legitimate delivery status notifications transfer a message and are not counted. For the /26 and /21 (IPv4) or /48 and /32 (IPv6) subnets of the remote IP, the limit is 3 and 9 times higher. When the limit is reached, recipients with a null reverse path are rejected with a temporary error. Default: 60. Set to -1 to disable."`
+
 		TLSSessionTicketsDisabled *bool `sconf:"optional" sconf-doc:"Override default setting for enabling TLS session tickets. Disabling session tickets may work around TLS interoperability issues."`
 
+		Greylisting *Greylisting `sconf:"optional" sconf-doc:"If set, incoming deliveries from remote networks (IPv4 /24, IPv6 /64) that are not whitelisted are rejected with a temporary error on first contact, for each combination of remote network, MAIL FROM and RCPT TO address. Legitimate mail servers retry later, many spammers don't. Only applies to local recipients. Remote networks that retry properly, or that deliver a message with a good reputation that passes SPF or DKIM verification, are whitelisted."`
+
+		FingerprintRules []FingerprintRule `sconf:"optional" sconf-doc:"Rules for incoming deliveries based on fingerprints of the connection, to stop spam from botnets that are not (yet) listed in DNSBLs. For each connection, a TLS fingerprint of the TLS client hello (if STARTTLS was used) and an SMTP fingerprint of the commands until the first MAIL FROM are logged at the first MAIL FROM (log line \"fingerprints\"). The first matching rule is applied."`
+
+		ContentFilters []ContentFilter `sconf:"optional" sconf-doc:"External content filters, e.g. for virus scanning with ClamAV, spam filtering with rspamd or custom classifiers. Incoming messages are passed to each filter in order, after the message data has been received, before delivering to local recipients. A filter returns a verdict: accept (possibly with header fields to add or a rewritten message), reject, tempfail or quarantine. Processing stops at the first filter that does not accept the message. A verdict is a JSON object with fields: Action (accept, reject, tempfail or quarantine; default accept), Code, Secode and Text (optional, for the SMTP response for reject and tempfail, e.g. 550, \"7.1\" and \"virus found\"), Headers (optional, header fields to add at the top of the message, e.g. [{\"Name\": \"X-Spam\", \"Value\": \"yes\"}]) and Rewrite (optional, base64-encoded message to deliver instead of the original message)."`
+
 		DNSBLZones []dns.Domain `sconf:"-"`
 	} `sconf:"optional"`
 	Submission struct {
@@ -172,6 +304,10 @@ type Listener struct {
 		Port           int  `sconf:"optional" sconf-doc:"Default 465."`
 		EnabledOnHTTPS bool `sconf:"optional" sconf-doc:"Additionally enable submission on HTTPS port 443 via TLS ALPN. TLS Application Layer Protocol Negotiation allows clients to request a specific protocol from the server as part of the TLS connection setup. When this setting is enabled and a client requests the 'smtp' protocol after TLS, it will be able to talk SMTP to Mox on port 443. This is meant to be useful as a censorship circumvention technique for Delta Chat."`
 	} `sconf:"optional" sconf-doc:"SMTP over TLS for submitting email, by email applications. Requires a TLS config."`
+	SubmissionAccess *SubmissionAccess `sconf:"optional" sconf-doc:"Restrictions for Submission and Submissions on this listener, e.g. for only allowing submission from a VPN or internal network while the SMTP listener for incoming messages stays public."`
+	VRFYEXPN         *VRFYEXPN         `sconf:"optional" sconf-doc:"Behaviour of the VRFY (verify address) and EXPN (expand mailing list) commands for SMTP, Submission and Submissions on this listener. If absent, both commands respond with code 252 without verifying or expanding, not disclosing whether addresses exist."`
+	ProxyProtocol    *ProxyProtocol    `sconf:"optional" sconf-doc:"If set, connections from the configured networks, typically TCP load balancers, must start with a HAProxy PROXY protocol header (version 1 or 2), and the original client address from the header is used instead of the address of the load balancer, e.g. for rate limiting, DNSBL and SPF checks, login restrictions and logging. Applies to all SMTP, submission, IMAP and HTTP ports of this listener. Connections from other addresses are served as regular connections without PROXY header."`
+
 	IMAP struct {
 		Enabled           bool
 		Port              int  `sconf:"optional" sconf-doc:"Default 143."`
@@ -182,15 +318,25 @@ type Listener struct {
 		Port           int  `sconf:"optional" sconf-doc:"Default 993."`
 		EnabledOnHTTPS bool `sconf:"optional" sconf-doc:"Additionally enable IMAP on HTTPS port 443 via TLS ALPN. TLS Application Layer Protocol Negotiation allows clients to request a specific protocol from the server as part of the TLS connection setup. When this setting is enabled and a client requests the 'imap' protocol after TLS, it will be able to talk IMAP to Mox on port 443. This is meant to be useful as a censorship circumvention technique for Delta Chat."`
 	} `sconf:"optional" sconf-doc:"IMAP over TLS for reading email, by email applications. Requires a TLS config."`
-	AccountHTTP  WebService `sconf:"optional" sconf-doc:"Account web interface, for email users wanting to change their accounts, e.g. set new password, set new delivery rulesets. Default path is /."`
-	AccountHTTPS WebService `sconf:"optional" sconf-doc:"Account web interface listener like AccountHTTP, but for HTTPS. Requires a TLS config."`
-	AdminHTTP    WebService `sconf:"optional" sconf-doc:"Admin web interface, for managing domains, accounts, etc. Default path is /admin/. Preferably only enable on non-public IPs. Hint: use 'ssh -L 8080:localhost:80 you@yourmachine' and open http://localhost:8080/admin/, or set up a tunnel (e.g. WireGuard) and add its IP to the mox 'internal' listener."`
-	AdminHTTPS   WebService `sconf:"optional" sconf-doc:"Admin web interface listener like AdminHTTP, but for HTTPS. Requires a TLS config."`
-	WebmailHTTP  WebService `sconf:"optional" sconf-doc:"Webmail client, for reading email. Default path is /webmail/."`
-	WebmailHTTPS WebService `sconf:"optional" sconf-doc:"Webmail client, like WebmailHTTP, but for HTTPS. Requires a TLS config."`
-	WebAPIHTTP   WebService `sconf:"optional" sconf-doc:"Like WebAPIHTTP, but with plain HTTP, without TLS."`
-	WebAPIHTTPS  WebService `sconf:"optional" sconf-doc:"WebAPI, a simple HTTP/JSON-based API for email, with HTTPS (requires a TLS config). Default path is /webapi/."`
-	MetricsHTTP  struct {
+	IMAPReadOnly bool       `sconf:"optional" sconf-doc:"Serve IMAP and IMAPS on this listener in read-only mode, e.g. for an instance that serves mail from a snapshot or backup of the data directory while the primary instance is being migrated or restored, so users keep access to their mail. Users can log in, and list, examine and fetch messages. Mailboxes are always opened read-only, also with SELECT, so messages aren't marked as read. Commands that change messages, flags, mailboxes, subscriptions or metadata fail with response code UNAVAILABLE. An alert about the read-only access is sent after connecting. Only IMAP is affected: Disable SMTP, submission and the web interfaces on the instance to prevent other changes."`
+	IMAPLimits   IMAPLimits `sconf:"optional" sconf-doc:"Limits for IMAP and IMAPS connections on this listener, protecting against excessive memory use. Commands exceeding a limit are rejected with a TOOBIG response code."`
+	ManageSieve  struct {
+		Enabled           bool
+		Port              int  `sconf:"optional" sconf-doc:"Default 4190."`
+		NoRequireSTARTTLS bool `sconf:"optional" sconf-doc:"Allow authentication without STARTTLS. Enable this only when the connection is otherwise encrypted (e.g. through a VPN)."`
+	} `sconf:"optional" sconf-doc:"ManageSieve (RFC 5804) for managing sieve scripts that filter incoming messages, with sieve editors and email applications. Only one script can be active. Starts out in plain text, clients must upgrade to TLS with the STARTTLS command before authenticating. Requires a TLS config, unless NoRequireSTARTTLS is set."`
+	AccountHTTP      WebService `sconf:"optional" sconf-doc:"Account web interface, for email users wanting to change their accounts, e.g. set new password, set new delivery rulesets. Default path is /."`
+	AccountHTTPS     WebService `sconf:"optional" sconf-doc:"Account web interface listener like AccountHTTP, but for HTTPS. Requires a TLS config."`
+	AdminHTTP        WebService `sconf:"optional" sconf-doc:"Admin web interface, for managing domains, accounts, etc. Default path is /admin/. Preferably only enable on non-public IPs. Hint: use 'ssh -L 8080:localhost:80 you@yourmachine' and open http://localhost:8080/admin/, or set up a tunnel (e.g. WireGuard) and add its IP to the mox 'internal' listener."`
+	AdminHTTPS       WebService `sconf:"optional" sconf-doc:"Admin web interface listener like AdminHTTP, but for HTTPS. Requires a TLS config."`
+	WebmailHTTP      WebService `sconf:"optional" sconf-doc:"Webmail client, for reading email. Default path is /webmail/."`
+	WebmailHTTPS     WebService `sconf:"optional" sconf-doc:"Webmail client, like WebmailHTTP, but for HTTPS. Requires a TLS config."`
+	WebAPIHTTP       WebService `sconf:"optional" sconf-doc:"Like WebAPIHTTP, but with plain HTTP, without TLS."`
+	WebAPIHTTPS      WebService `sconf:"optional" sconf-doc:"WebAPI, a simple HTTP/JSON-based API for email, with HTTPS (requires a TLS config). Default path is /webapi/."`
+	JMAPHTTP         WebService `sconf:"optional" sconf-doc:"Like JMAPHTTPS, but with plain HTTP, without TLS."`
+	JMAPHTTPS        WebService `sconf:"optional" sconf-doc:"JMAP (RFC 8620/8621), an HTTP/JSON-based protocol for synchronizing email with email applications, as alternative to IMAP, with HTTPS (requires a TLS config). Mailboxes and messages can be listed, fetched, flagged, moved and removed, changes are pushed to clients with an event source. Sending messages and creating mailboxes are not supported. Clients log in with HTTP basic authentication. The session resource is at path \"session\", and at /.well-known/jmap through a redirect. Default path is /jmap/."`
+	UnsubscribeHTTPS WebService `sconf:"optional" sconf-doc:"One-click unsubscribe links, for List-Unsubscribe headers added to messages forwarded to remote alias members (if enabled for the alias), and to messages sent through the webapi (if requested). Links are signed, no login is needed. A POST request with body \"List-Unsubscribe=One-Click\" unsubscribes directly, a GET request shows a confirmation page. Requests are rate limited per IP. Unsubscribing from an alias removes the address as member, unsubscribing from a webapi message adds the address to the suppression list of the sending account. Links use the hostname of the first listener (by name) that has this enabled. Requires a TLS config. Default path is /unsubscribe/."`
+	MetricsHTTP      struct {
 		Enabled bool
 		Port    int `sconf:"optional" sconf-doc:"Default 8010."`
 	} `sconf:"optional" sconf-doc:"Serve prometheus metrics, for monitoring. You should not enable this on a public IP."`
@@ -208,6 +354,11 @@ type Listener struct {
 		Port    int  `sconf:"optional" sconf-doc:"TLS port, 443 by default. You should only override this if you cannot listen on port 443 directly. MTA-STS requests will be made to port 443, so you'll have to add an external mechanism to get the connection here, e.g. by configuring port forwarding."`
 		NonTLS  bool `sconf:"optional" sconf-doc:"If set, plain HTTP instead of HTTPS is spoken on the configured port. Can be useful when the mta-sts domain is reverse proxied."`
 	} `sconf:"optional" sconf-doc:"Serve MTA-STS policies describing SMTP TLS requirements. Requires a TLS config."`
+	WKDHTTPS struct {
+		Enabled bool
+		Port    int  `sconf:"optional" sconf-doc:"TLS port, 443 by default. You should only override this if you cannot listen on port 443 directly. WKD requests will be made to port 443, so you'll have to add an external mechanism to get the connection here, e.g. by configuring port forwarding."`
+		NonTLS  bool `sconf:"optional" sconf-doc:"If set, plain HTTP instead of HTTPS is spoken on the configured port. Can be useful when the openpgpkey domain is reverse proxied."`
+	} `sconf:"optional" sconf-doc:"Serve OpenPGP keys published by accounts through the Web Key Directory (WKD), for domains with WKD configured. Keys are served at openpgpkey.<domain> and at <domain> itself. Requires a TLS config."`
 	WebserverHTTP struct {
 		Enabled bool
 		Port    int `sconf:"optional" sconf-doc:"Port for plain HTTP (non-TLS) webserver."`
@@ -226,6 +377,69 @@ type WebService struct {
 	Forwarded bool   `sconf:"optional" sconf-doc:"If set, X-Forwarded-* headers are used for the remote IP address for rate limiting and for the \"secure\" status of cookies."`
 }
 
+// WebSessions are limits for login sessions of accounts, as used by the webmail
+// and account web interfaces.
+type WebSessions struct {
+	IdleTimeout   time.Duration `sconf:"optional" sconf-doc:"Sessions that are not used for this long expire. Default 24h."`
+	MaxLifetime   time.Duration `sconf:"optional" sconf-doc:"Sessions expire this long after login, regardless of use, requiring the user to login again. Default 0, no maximum."`
+	MaxPerAccount int           `sconf:"optional" sconf-doc:"Maximum number of sessions per account. When a new session exceeds the maximum, the least recently used session is removed. Default 100."`
+}
+
+// OAuth is the configuration for verifying OAuth 2.0 bearer tokens of an
+// OpenID Connect issuer.
+type OAuth struct {
+	Issuer        string   `sconf-doc:"URL of the OpenID Connect issuer, e.g. https://sso.example.org/realms/example. Must match the \"iss\" claim of tokens exactly. The keys of the issuer are found through its discovery document at <issuer>/.well-known/openid-configuration, unless JWKSURL is set. Must be an https URL."`
+	JWKSURL       string   `sconf:"optional" sconf-doc:"URL of the JSON Web Key Set (JWKS) with the signing keys of the issuer, to use instead of the URL from the discovery document. Must be an https URL."`
+	Audience      string   `sconf-doc:"Value that must be present in the \"aud\" claim of tokens, typically the client ID of the mail clients as registered at the issuer."`
+	Scopes        []string `sconf:"optional" sconf-doc:"Scopes that tokens must have, in the \"scope\" claim (or \"scp\")."`
+	UsernameClaim string   `sconf:"optional" sconf-doc:"Claim in the token with the email address to authenticate as. Default \"email\"."`
+
+	Verifier *oauthbearer.Verifier `sconf:"-" json:"-"`
+}
+
+// IMAPLimits are limits for commands on IMAP connections of a listener.
+type IMAPLimits struct {
+	MaxLineLength            int           `sconf:"optional" sconf-doc:"Maximum length in bytes of a command line, excluding literals. Longer lines cause the connection to be closed. Default 16KB, minimum 1KB."`
+	MaxLiteralSize           int64         `sconf:"optional" sconf-doc:"Maximum size in bytes of a single literal in a command other than APPEND. Literals are held in memory while handling a command. Default 100KB."`
+	MaxCommandLiteralSize    int64         `sconf:"optional" sconf-doc:"Maximum total size in bytes of all literals in a single command other than APPEND. Default 10 times MaxLiteralSize."`
+	MaxCommandLiterals       int           `sconf:"optional" sconf-doc:"Maximum number of literals in a single command. Default 1000."`
+	MaxAppendSize            int64         `sconf:"optional" sconf-doc:"Maximum size in bytes of a message added with APPEND, announced with the APPENDLIMIT capability. Messages are written to a temporary file, not held in memory. Default 0, for no limit other than the quota of the account."`
+	LiteralMinus             bool          `sconf:"optional" sconf-doc:"Announce LITERAL- instead of LITERAL+, limiting non-synchronizing literals to 4096 bytes. Clients must wait for the server before sending larger literals, giving the server a chance to reject too large literals before they are sent."`
+	IdleTimeout              time.Duration `sconf:"optional" sconf-doc:"Time after which an authenticated connection without incoming commands is closed, also for connections in IDLE. The IMAP specification requires at least 30 minutes. Connections that are not authenticated are closed after 30 seconds of inactivity. Default 30m."`
+	MaxLifetime              time.Duration `sconf:"optional" sconf-doc:"Maximum duration of a connection. When reached, the connection is closed with a BYE when the server is waiting for the next command, causing clients to reconnect. Useful for periodically reevaluating credentials and configuration. Default 0, no maximum."`
+	MaxConnections           int           `sconf:"optional" sconf-doc:"Maximum number of open connections for the listener. When a new connection exceeds the maximum, the least recently active connection is closed with a BYE. Limits on the number of connections per IP/network still apply. Default 0, no maximum."`
+	MaxConnectionsPerIP      int           `sconf:"optional" sconf-doc:"Maximum number of open IMAP connections from a single remote IP address, across all listeners. New connections exceeding the maximum are refused with a BYE response with ALERT code. Default 0, for no limit other than the built-in connection limits per IP/network."`
+	MaxConnectionsPerAccount int           `sconf:"optional" sconf-doc:"Maximum number of open authenticated IMAP connections for an account, across all listeners. Authentication on a new connection exceeding the maximum fails with a NO response with ALERT code. Can be overridden per account with MaxIMAPConnections. Default 0, for no limit."`
+}
+
+// FingerprintRule matches incoming SMTP connections by fingerprints, as logged
+// for each connection. At least one of TLS and SMTP must be set, and all set
+// fingerprints must match.
+type FingerprintRule struct {
+	TLS    string `sconf:"optional" sconf-doc:"TLS fingerprint to match, a hexadecimal MD5 hash over the TLS versions, cipher suites, curves, point formats, signature schemes and application protocols from the TLS client hello, similar to JA3."`
+	SMTP   string `sconf:"optional" sconf-doc:"SMTP fingerprint to match, a comma-separated list of commands (as sent by the remote) until and including the first MAIL FROM, without the addresses, with a + suffix if the remote sent more data without waiting for the response. E.g. \"EHLO,STARTTLS,EHLO,MAIL FROM:<\"."`
+	Action string `sconf-doc:"Action for matching connections: reject (reject the MAIL FROM command and close the connection) or slow (respond slowly, keeping bots busy)."`
+}
+
+// ContentFilter is an external program or HTTP endpoint that gives a verdict on
+// incoming messages. Exactly one of Command and URL must be set.
+type ContentFilter struct {
+	Name              string        `sconf-doc:"Name of the filter, for logging and metrics."`
+	Command           []string      `sconf:"optional" sconf-doc:"Command and arguments to run for each message. The message is written to stdin. Details of the SMTP transaction are passed in environment variables: MOX_REMOTE_IP, MOX_EHLO, MOX_MAIL_FROM, MOX_RCPT_TO (addresses separated by spaces) and MOX_TLS (yes or no). The command must write its verdict as JSON to stdout, and exit with status 0."`
+	URL               string        `sconf:"optional" sconf-doc:"HTTP or HTTPS URL to POST each message to, with Content-Type message/rfc822. Details of the SMTP transaction are passed in request headers X-Mox-Remote-IP, X-Mox-EHLO, X-Mox-Mail-From, X-Mox-Rcpt-To (one per recipient) and X-Mox-TLS. The response must have status 200 and the verdict as JSON in the body."`
+	Timeout           time.Duration `sconf:"optional" sconf-doc:"Maximum duration for the filter to return its verdict. Default 30s."`
+	MaxSize           int64         `sconf:"optional" sconf-doc:"Messages larger than this size in bytes are not passed to the filter, and accepted. Default 0, no limit."`
+	OnError           string        `sconf:"optional" sconf-doc:"What to do when the filter fails, times out, or writes a verdict larger than twice the message size plus 64KB: tempfail (reject the message with a temporary error, so the sender retries later) or accept (continue without verdict of this filter). Default tempfail."`
+	QuarantineMailbox string        `sconf:"optional" sconf-doc:"Mailbox to deliver quarantined messages to, instead of their regular destination. Quarantined messages are marked as read and are not processed by sieve scripts or forwarded. Default Junk."`
+}
+
+// Greylisting configures greylisting of incoming deliveries for an SMTP listener.
+type Greylisting struct {
+	Delay           time.Duration `sconf:"optional" sconf-doc:"Minimum time after the first delivery attempt before a retry is accepted. Default 5m."`
+	RetryWindow     time.Duration `sconf:"optional" sconf-doc:"Period after the first delivery attempt in which a retry is accepted. Later attempts are treated as first contact again. Default 24h."`
+	WhitelistPeriod time.Duration `sconf:"optional" sconf-doc:"Period a remote network stays whitelisted after its last delivery. Default 840h (35 days)."`
+}
+
 // Transport is a method to delivery a message. At most one of the fields can
 // be non-nil. The non-nil field represents the type of transport. For a
 // transport with all fields nil, regular email delivery is done.
@@ -287,9 +501,15 @@ type Domain struct {
 	DKIM                       DKIM             `sconf:"optional" sconf-doc:"With DKIM signing, a domain is taking responsibility for (content of) emails it sends, letting receiving mail servers build up a (hopefully positive) reputation of the domain, which can help with mail delivery."`
 	DMARC                      *DMARC           `sconf:"optional" sconf-doc:"With DMARC, a domain publishes, in DNS, a policy on how other mail servers should handle incoming messages with the From-header matching this domain and/or subdomain (depending on the configured alignment). Receiving mail servers use this to build up a reputation of this domain, which can help with mail delivery. A domain can also publish an email address to which reports about DMARC verification results can be sent by verifying mail servers, useful for monitoring. Incoming DMARC reports are automatically parsed, validated, added to metrics and stored in the reporting database for later display in the admin web pages."`
 	MTASTS                     *MTASTS          `sconf:"optional" sconf-doc:"MTA-STS is a mechanism that allows publishing a policy with requirements for WebPKI-verified SMTP STARTTLS connections for email delivered to a domain. Existence of a policy is announced in a DNS TXT record (often unprotected/unverified, MTA-STS's weak spot). If a policy exists, it is fetched with a WebPKI-verified HTTPS request. The policy can indicate that WebPKI-verified SMTP STARTTLS is required, and which MX hosts (optionally with a wildcard pattern) are allowd. MX hosts to deliver to are still taken from DNS (again, not necessarily protected/verified), but messages will only be delivered to domains matching the MX hosts from the published policy. Mail servers look up the MTA-STS policy when first delivering to a domain, then keep a cached copy, periodically checking the DNS record if a new policy is available, and fetching and caching it if so. To update a policy, first serve a new policy with an updated policy ID, then update the DNS record (not the other way around). To remove an enforced policy, publish an updated policy with mode \"none\" for a long enough period so all cached policies have been refreshed (taking DNS TTL and policy max age into account), then remove the policy from DNS, wait for TTL to expire, and stop serving the policy."`
+	WKD                        *WKD             `sconf:"optional" sconf-doc:"Serve OpenPGP public keys that accounts publish for their addresses in this domain through the Web Key Directory (WKD), so mail clients of correspondents can automatically discover the keys for encrypting messages. Keys are requested from openpgpkey.<domain> (\"advanced method\", requires a DNS record for the name pointing to this server), or from <domain> itself (\"direct method\"). Requires a listener with WKDHTTPS enabled."`
+	WellKnown                  *WellKnown       `sconf:"optional" sconf-doc:"Files served under /.well-known/ for the domain, for requests to the domain itself and to the subdomains served by mox (mta-sts, autoconfig, openpgpkey). Served on listeners with WebserverHTTP(S), MTASTSHTTPS, AutoconfigHTTPS or WKDHTTPS enabled, before WebHandlers."`
 	TLSRPT                     *TLSRPT          `sconf:"optional" sconf-doc:"With TLSRPT a domain specifies in DNS where reports about encountered SMTP TLS behaviour should be sent. Useful for monitoring. Incoming TLS reports are automatically parsed, validated, added to metrics and stored in the reporting database for later display in the admin web pages."`
+	SPF                        *SPF             `sconf:"optional" sconf-doc:"Additional mechanisms for the suggested SPF DNS record for the domain. By default, the suggested record allows the IPs of this mail server and the MX hosts of the domain, with a softfail for other IPs. If other mail servers also send email for this domain, e.g. an external email service, they must be added to the SPF record."`
 	Routes                     []Route          `sconf:"optional" sconf-doc:"Routes for delivering outgoing messages through the queue. Each delivery attempt evaluates account routes, these domain routes and finally global routes. The transport of the first matching route is used in the delivery attempt. If no routes match, which is the default with no configured routes, messages are delivered directly from the queue."`
 	Aliases                    map[string]Alias `sconf:"optional" sconf-doc:"Aliases that cause messages to be delivered to one or more locally configured addresses. Keys are localparts (encoded, as they appear in email addresses)."`
+	InboundHeaders             *InboundHeaders  `sconf:"optional" sconf-doc:"Header fields to add to and rewrite in incoming messages for addresses in this domain before delivery, e.g. to mark messages from outside the organization. Messages with a verified message From address (with DMARC-like alignment) in a domain hosted on this server or listed as internal domain are exempt."`
+	LookalikeSenders           string           `sconf:"optional" sconf-doc:"How to handle incoming messages with a message From or SMTP MAIL FROM address at a domain that looks like this domain, with a typo or with similar looking characters, as is common in phishing. Empty for no special handling. With \"junk\", a stricter junk filter threshold is used, as with other suspicious signals, and messages from senders with an existing reputation are still accepted. With \"reject\", messages are rejected. See \"mox config domain lookalikes\" for the recognized variants of a domain. Hosted domains are never treated as lookalike."`
+	SpoofingSurges             string           `sconf:"optional" sconf-doc:"How to handle a sudden surge of incoming messages with a message From address in this domain that fail DMARC, as is common in spoofing campaigns. A surge is detected when the DMARC failures in the past hour are both above a minimum and well above the hourly average of the day before. Incidents are recorded and shown with the DMARC reports in the admin web interface, and the postmaster is notified. Empty to only detect and notify. With \"junk\", a stricter junk filter threshold is used for messages from this domain that fail DMARC during an incident and for a day after. With \"ignore\", surges are not detected."`
 
 	Domain                  dns.Domain `sconf:"-"`
 	ClientSettingsDNSDomain dns.Domain `sconf:"-" json:"-"`
@@ -305,14 +525,16 @@ type Domain struct {
 // todo: add option to require messages sent to an alias have that alias as From or Reply-To address?
 
 type Alias struct {
-	Addresses    []string `sconf-doc:"Expanded addresses to deliver to. These must currently be of addresses of local accounts. To prevent duplicate messages, a member address that is also an explicit recipient in the SMTP transaction will only have the message delivered once. If the address in the message From header is a member, that member also won't receive the message."`
-	PostPublic   bool     `sconf:"optional" sconf-doc:"If true, anyone can send messages to the list. Otherwise only members, based on message From address, which is assumed to be DMARC-like-verified."`
-	ListMembers  bool     `sconf:"optional" sconf-doc:"If true, members can see addresses of members."`
-	AllowMsgFrom bool     `sconf:"optional" sconf-doc:"If true, members are allowed to send messages with this alias address in the message From header."`
+	Addresses       []string `sconf-doc:"Expanded addresses to deliver to. Addresses in domains configured on this server must be of local accounts, and at least one such address must be present: Its junk filtering and reputation decide whether a message is accepted. Addresses in other domains are remote members, a copy of accepted messages is added to the queue for each, with the postmaster address of the domain of the alias as SMTP MAIL FROM. Forwarded copies get a Delivered-To header with the alias address, incoming messages that already have such a header are rejected to prevent loops. To prevent duplicate messages, a member address that is also an explicit recipient in the SMTP transaction will only have the message delivered once. If the address in the message From header is a member, that member also won't receive the message."`
+	PostPublic      bool     `sconf:"optional" sconf-doc:"If true, anyone can send messages to the list. Otherwise only members, based on message From address, which is assumed to be DMARC-like-verified."`
+	ListMembers     bool     `sconf:"optional" sconf-doc:"If true, members can see addresses of members."`
+	AllowMsgFrom    bool     `sconf:"optional" sconf-doc:"If true, members are allowed to send messages with this alias address in the message From header."`
+	ListUnsubscribe bool     `sconf:"optional" sconf-doc:"If true, copies of messages forwarded to remote members get List-Unsubscribe and List-Unsubscribe-Post headers with a one-click unsubscribe link for the member, removing the member from the alias. Requires a listener with UnsubscribeHTTPS enabled."`
 
 	LocalpartStr    string         `sconf:"-"` // In encoded form.
 	Domain          dns.Domain     `sconf:"-"`
-	ParsedAddresses []AliasAddress `sconf:"-"` // Matches addresses.
+	ParsedAddresses []AliasAddress `sconf:"-"` // Local addresses, matching accounts.
+	RemoteAddresses []smtp.Address `sconf:"-"` // Addresses in domains not configured on this server.
 }
 
 type AliasAddress struct {
@@ -326,19 +548,62 @@ type DMARC struct {
 	Domain    string `sconf:"optional" sconf-doc:"Alternative domain for reporting address, for incoming reports. Typically empty, causing the domain wherein this config exists to be used. Can be used to receive reports for domains that aren't fully hosted on this server. Configure such a domain as a hosted domain without making all the DNS changes, and configure this field with a domain that is fully hosted on this server, so the localpart and the domain of this field form a reporting address. Then only update the DMARC DNS record for the not fully hosted domain, ensuring the reporting address is specified in its \"rua\" field as shown in the suggested DNS settings. Unicode name."`
 	Account   string `sconf-doc:"Account to deliver to."`
 	Mailbox   string `sconf-doc:"Mailbox to deliver to, e.g. DMARC."`
+	Policy    string `sconf:"optional" sconf-doc:"Policy for the suggested DMARC DNS record: \"none\", \"quarantine\" or \"reject\" (default). With \"auto\", the policy recommended by the DMARC policy advisor is suggested, based on incoming DMARC aggregate reports: first \"none\", then \"quarantine\" after all sources have sent aligned messages for 30 days, then \"reject\" after another 30 days. The DNS record itself must still be updated."`
 
 	ParsedLocalpart smtp.Localpart `sconf:"-"`
 	DNSDomain       dns.Domain     `sconf:"-"` // Effective domain, always set based on Domain field or Domain where this is configured.
 }
 
+type SPF struct {
+	Includes []string `sconf:"optional" sconf-doc:"Domains whose SPF record is included with an \"include\" mechanism, e.g. of external email services. Each include counts towards the maximum of 10 DNS lookups for SPF evaluation. DNS lookups needed for the included SPF records count as well, so keep the number of includes low. Unicode names."`
+	IPs      []string `sconf:"optional" sconf-doc:"Additional IPv4 and IPv6 addresses or networks in CIDR notation, e.g. 192.0.2.10 or 2001:db8::/32, allowed to send email for the domain, added with \"ip4\" and \"ip6\" mechanisms."`
+	All      string   `sconf:"optional" sconf-doc:"Qualifier for the final \"all\" mechanism, used for IPs that don't match any earlier mechanism: \"~\" for softfail (default), \"-\" for fail, \"?\" for neutral. A softfail is suggested by default so messages aren't rejected by older mail servers before DKIM and DMARC are evaluated."`
+
+	ParsedIncludes []dns.Domain `sconf:"-" json:"-"`
+	ParsedIPs      []net.IPNet  `sconf:"-" json:"-"`
+}
+
+type InboundHeaders struct {
+	SubjectPrefix   string            `sconf:"optional" sconf-doc:"Text to prepend to the Subject header, e.g. \"[EXTERNAL] \". Not added if the subject already starts with the text. Non-ASCII text is added as MIME encoded-word. A message without Subject header gets one. The DKIM signatures of the message, already verified during delivery, typically no longer verify after the change."`
+	Headers         map[string]string `sconf:"optional" sconf-doc:"Header fields to add, with the header field name as key, e.g. X-External with value \"Message from outside the organization.\". Values with non-ASCII text are added as MIME encoded-word."`
+	InternalDomains []string          `sconf:"optional" sconf-doc:"Domains of the organization not hosted on this server whose messages are exempt too, e.g. for departments with their own mail system. Subdomains are not included. Unicode names."`
+
+	ParsedInternalDomains []dns.Domain `sconf:"-" json:"-"`
+}
+
 type MTASTS struct {
-	PolicyID string        `sconf-doc:"Policies are versioned. The version must be specified in the DNS record. If you change a policy, first change it here to update the served policy, then update the DNS record with the updated policy ID."`
-	Mode     mtasts.Mode   `sconf-doc:"If set to \"enforce\", a remote SMTP server will not deliver email to us if it cannot make a WebPKI-verified SMTP STARTTLS connection. In mode \"testing\", deliveries can be done without verified TLS, but errors will be reported through TLS reporting. In mode \"none\", verified TLS is not required, used for phasing out an MTA-STS policy."`
-	MaxAge   time.Duration `sconf-doc:"How long a remote mail server is allowed to cache a policy. Typically 1 or several weeks."`
-	MX       []string      `sconf:"optional" sconf-doc:"List of server names allowed for SMTP. If empty, the configured hostname is set. Host names can contain a wildcard (*) as a leading label (matching a single label, e.g. *.example matches host.example, not sub.host.example)."`
+	PolicyID       string        `sconf-doc:"Policies are versioned. The version must be specified in the DNS record. If you change a policy, first change it here to update the served policy, then update the DNS record with the updated policy ID."`
+	Mode           mtasts.Mode   `sconf-doc:"If set to \"enforce\", a remote SMTP server will not deliver email to us if it cannot make a WebPKI-verified SMTP STARTTLS connection. In mode \"testing\", deliveries can be done without verified TLS, but errors will be reported through TLS reporting. In mode \"none\", verified TLS is not required, used for phasing out an MTA-STS policy."`
+	MaxAge         time.Duration `sconf-doc:"How long a remote mail server is allowed to cache a policy. Typically 1 or several weeks."`
+	MX             []string      `sconf:"optional" sconf-doc:"List of server names allowed for SMTP. If empty, the configured hostname is set. Host names can contain a wildcard (*) as a leading label (matching a single label, e.g. *.example matches host.example, not sub.host.example)."`
+	MaxAgeRampDays int           `sconf:"optional" sconf-doc:"If non-zero, MaxAge is automatically increased in stages, from 1 day to 1 week to 4 weeks. A next stage is only taken after this many days since the previous policy change (as parsed from a PolicyID in the form YYYYMMDDTHHMMSS), with the MTA-STS DNS record having the current PolicyID, and with incoming TLS reports covering each of those days and without reported failures. At each stage, the PolicyID is updated, and the operator should update the DNS record with the new policy ID."`
 	// todo: parse mx as valid mtasts.Policy.MX, with dns.ParseDomain but taking wildcard into account
 }
 
+type WKD struct {
+	Accounts []string `sconf:"optional" sconf-doc:"Accounts that may publish OpenPGP keys for their addresses in this domain. If empty, all accounts with addresses in this domain can publish keys."`
+}
+
+type WellKnown struct {
+	SecurityTXT       *SecurityTXT `sconf:"optional" sconf-doc:"Serve /.well-known/security.txt, with contact information for reporting security vulnerabilities, see RFC 9116."`
+	ChangePasswordURL string       `sconf:"optional" sconf-doc:"If set, /.well-known/change-password redirects to this URL, e.g. the account web interface, so password managers can send users to the page for changing their password."`
+}
+
+// SecurityTXT holds the fields of a security.txt file, RFC 9116. Fields are
+// written in the order below, each value on its own line.
+type SecurityTXT struct {
+	Contact            []string `sconf-doc:"URIs for reporting security vulnerabilities, e.g. mailto:security@example.org, or an https URL. At least one is required."`
+	Expires            string   `sconf-doc:"Date and time after which the information should be considered stale, in RFC 3339 format, e.g. 2026-12-31T23:59:59Z. Recommended to be less than a year in the future."`
+	Encryption         []string `sconf:"optional" sconf-doc:"URIs of keys to use for encrypting reports, e.g. an https URL to an OpenPGP key."`
+	Acknowledgments    []string `sconf:"optional" sconf-doc:"URIs of pages acknowledging reporters."`
+	PreferredLanguages []string `sconf:"optional" sconf-doc:"Language tags for preferred languages for reports, e.g. en."`
+	Canonical          []string `sconf:"optional" sconf-doc:"URIs where the file is located, e.g. https://example.org/.well-known/security.txt."`
+	Policy             []string `sconf:"optional" sconf-doc:"URIs of the security policy for reporting vulnerabilities."`
+	Hiring             []string `sconf:"optional" sconf-doc:"URIs of security-related job openings."`
+
+	ExpiresParsed time.Time `sconf:"-" json:"-"`
+}
+
 type TLSRPT struct {
 	Localpart string `sconf-doc:"Address-part before the @ that accepts TLSRPT reports. Recommended value: tls-reports."`
 	Domain    string `sconf:"optional" sconf-doc:"Alternative domain for reporting address, for incoming reports. Typically empty, causing the domain wherein this config exists to be used. Can be used to receive reports for domains that aren't fully hosted on this server. Configure such a domain as a hosted domain without making all the DNS changes, and configure this field with a domain that is fully hosted on this server, so the localpart and the domain of this field form a reporting address. Then only update the TLSRPT DNS record for the not fully hosted domain, ensuring the reporting address is specified in its \"rua\" field as shown in the suggested DNS settings. Unicode name."`
@@ -363,6 +628,7 @@ type Selector struct {
 	DontSealHeaders  bool             `sconf:"optional" sconf-doc:"If set, don't prevent duplicate headers from being added. Not recommended."`
 	Expiration       string           `sconf:"optional" sconf-doc:"Period a signature is valid after signing, as duration, e.g. 72h. The period should be enough for delivery at the final destination, potentially with several hops/relays. In the order of days at least."`
 	PrivateKeyFile   string           `sconf-doc:"Either an RSA or ed25519 private key file in PKCS8 PEM form."`
+	Retiring         bool             `sconf:"optional" sconf-doc:"Set when the key is scheduled for removal, e.g. during key rotation. A retiring selector is not used for signing new messages, even if listed in Sign. Messages in the queue with a DKIM signature by a retiring selector are signed again with the current signing selectors before their next delivery attempt, so they still have a valid signature after the DNS record for the retiring selector has been removed."`
 
 	Algorithm         string        `sconf:"-"`          // "ed25519", "rsa-*", based on private key.
 	ExpirationSeconds int           `sconf:"-" json:"-"` // Parsed from Expiration.
@@ -375,19 +641,37 @@ type DKIM struct {
 	Sign      []string            `sconf:"optional" sconf-doc:"List of selectors that emails will be signed with."`
 }
 
+// AddSelector adds or replaces selector name, initializing Selectors if needed.
+// If sign is set and the selector isn't in Sign yet, it is added.
+func (d *DKIM) AddSelector(name string, sel Selector, sign bool) {
+	if d.Selectors == nil {
+		d.Selectors = map[string]Selector{}
+	}
+	d.Selectors[name] = sel
+	if sign && !slices.Contains(d.Sign, name) {
+		d.Sign = append(d.Sign, name)
+	}
+}
+
 type Route struct {
 	FromDomain      []string `sconf:"optional" sconf-doc:"Matches if the envelope from domain matches one of the configured domains, or if the list is empty. If a domain starts with a dot, prefixes of the domain also match."`
 	ToDomain        []string `sconf:"optional" sconf-doc:"Like FromDomain, but matching against the envelope to domain."`
 	MinimumAttempts int      `sconf:"optional" sconf-doc:"Matches if at least this many deliveries have already been attempted. This can be used to attempt sending through a smarthost when direct delivery has failed for several times."`
 	Transport       string   `sconf:"The transport used for delivering the message that matches requirements of the above fields."`
+	Failover        []string `sconf:"optional" sconf-doc:"Transports to fail over to, in order, when a delivery attempt with Transport, or the previous transport in this list, fails with an error in one of the classes of FailoverErrors. The attempt with the next transport is made immediately, instead of after the regular backoff, and a permanent error does not cause a DSN to be sent. For failing over from direct delivery, configure Transport as a transport with Direct set. If delivery with the last transport fails, the failure is handled as usual and the next attempt starts again at Transport."`
+	FailoverErrors  []string `sconf:"optional" sconf-doc:"Classes of errors causing failover to the next transport in Failover. Values: connection (errors before an SMTP response was received, e.g. resolving DNS names or dialing), tls (failed TLS handshake or verification), temporary (SMTP response with code 4xx), policy (SMTP response with enhanced status code 4.7.x or 5.7.x, e.g. due to IP reputation or block lists), permanent (SMTP response with code 5xx). Default: connection, tls, policy."`
 
 	// todo future: add ToMX, where we look up the MX record of the destination domain and check (the first, any, all?) mx host against the values in ToMX.
 
-	FromDomainASCII   []string  `sconf:"-"`
-	ToDomainASCII     []string  `sconf:"-"`
-	ResolvedTransport Transport `sconf:"-" json:"-"`
+	FromDomainASCII   []string    `sconf:"-"`
+	ToDomainASCII     []string    `sconf:"-"`
+	ResolvedTransport Transport   `sconf:"-" json:"-"`
+	ResolvedFailover  []Transport `sconf:"-" json:"-"`
 }
 
+// RouteFailoverErrors are the valid values for Route.FailoverErrors.
+var RouteFailoverErrors = []string{"connection", "tls", "temporary", "policy", "permanent"}
+
 // todo: move RejectsMailbox to store.Mailbox.SpecialUse, possibly with "X" prefix?
 
 // note: outgoing hook events are in ../queue/hooks.go, ../mox-/config.go, ../queue.go and ../webapi/gendoc.sh. keep in sync.
@@ -422,12 +706,18 @@ type Account struct {
 	KeepRetiredWebhookPeriod time.Duration    `sconf:"optional" sconf-doc:"Period to keep webhooks retired from the queue (delivered or failed) around. Useful for debugging. The time at which to clean up (remove) is calculated at retire time. E.g. 168h (1 week)."`
 
 	LoginDisabled                string                 `sconf:"optional" sconf-doc:"If non-empty, login attempts on all protocols (e.g. SMTP/IMAP, web interfaces) is rejected with this error message. Useful during migrations. Incoming deliveries for addresses of this account are still accepted as normal."`
+	Suspended                    string                 `sconf:"optional" sconf-doc:"If non-empty, the account is suspended, with this message. Useful for freezing compromised or delinquent accounts without removing them. Login attempts on all protocols are rejected with this message, as with LoginDisabled. Existing IMAP and SMTP submission connections are closed at their next command, e.g. when an IMAP client ends IDLE. Web sessions are removed when suspending through the admin interface or command-line. Incoming deliveries for addresses of this account are rejected with a temporary error, so senders retry later, or with a permanent error if SuspendedReject is set. Members of aliases that are suspended are skipped during delivery."`
+	SuspendedReject              bool                   `sconf:"optional" sconf-doc:"If set, incoming deliveries for a suspended account are rejected with a permanent error instead of a temporary error."`
+	LoginNetworks                []string               `sconf:"optional" sconf-doc:"If non-empty, logins for this account on all protocols (IMAP, SMTP submission, web interfaces, webapi) are only allowed from these IP addresses or networks in CIDR notation, e.g. 10.0.0.0/8 or 2001:db8::/32. Logins from other networks are rejected, and stored as login attempt with result \"networkdenied\". Web sessions are only usable from these networks. Useful for service accounts that only log in from a single server. Mox has no database with countries of IP addresses, logins cannot be restricted by country."`
 	Domain                       string                 `sconf-doc:"Default domain for account. Deprecated behaviour: If a destination is not a full address but only a localpart, this domain is added to form a full address."`
 	Description                  string                 `sconf:"optional" sconf-doc:"Free form description, e.g. full name or alternative contact info."`
 	FullName                     string                 `sconf:"optional" sconf-doc:"Full name, to use in message From header when composing messages in webmail. Can be overridden per destination."`
-	Destinations                 map[string]Destination `sconf:"optional" sconf-doc:"Destinations, keys are email addresses (with IDNA domains). All destinations are allowed for logging in with IMAP/SMTP/webmail. If no destinations are configured, the account can not login. If the address is of the form '@domain', i.e. with localpart missing, it serves as a catchall for the domain, matching all messages that are not explicitly configured. Deprecated behaviour: If the address is not a full address but a localpart, it is combined with Domain to form a full address."`
+	Template                     string                 `sconf:"optional" sconf-doc:"Name of the template from AccountTemplates in mox.conf the account was added with. The initial mailboxes of the template are created when the account is first opened."`
+	Destinations                 map[string]Destination `sconf:"optional" sconf-doc:"Destinations, keys are email addresses (with IDNA domains). All destinations are allowed for logging in with IMAP/SMTP/webmail. If no destinations are configured, the account can not login. If the address is of the form '@domain', i.e. with localpart missing, it serves as a catchall for the domain, matching all messages that are not explicitly configured. If the domain of the address is of the form '*.domain', e.g. 'info@*.example.com' or '@*.example.com', it is a wildcard destination for all subdomains of the configured domain, e.g. for info@tag.example.com or anything@tag.example.com. Wildcard destinations are only used for subdomains that are not configured as domain themselves, with the localpart wildcard taking precedence over the catchall wildcard. Deprecated behaviour: If the address is not a full address but a localpart, it is combined with Domain to form a full address."`
 	SubjectPass                  SubjectPass            `sconf:"optional" sconf-doc:"If configured, messages classified as weakly spam are rejected with instructions to retry delivery, but this time with a signed token added to the subject. During the next delivery attempt, the signed token will bypass the spam filter. Messages with a clear spam signal, such as a known bad reputation, are rejected/delayed without a signed token."`
 	QuotaMessageSize             int64                  `sconf:"optional" sconf-doc:"Default maximum total message size in bytes for the account, overriding any globally configured default maximum size if non-zero. A negative value can be used to have no limit in case there is a limit by default. Attempting to add new messages to an account beyond its maximum total size will result in an error. Useful to prevent a single account from filling storage."`
+	MaxAppendSize                int64                  `sconf:"optional" sconf-doc:"Maximum size in bytes of a message added with IMAP APPEND for this account. The lower of this limit and the MaxAppendSize of the IMAP listener is announced with the APPENDLIMIT capability after authentication, and oversized messages are rejected before their data is read. Default 0, for no account-specific limit."`
+	MaxIMAPConnections           int                    `sconf:"optional" sconf-doc:"Maximum number of open authenticated IMAP connections for this account, across all listeners, overriding MaxConnectionsPerAccount of the IMAP listener limits if non-zero. Protects against misbehaving clients opening many (IDLE) connections. A negative value means no limit. Default 0, using the listener limit."`
 	RejectsMailbox               string                 `sconf:"optional" sconf-doc:"Mail that looks like spam will be rejected, but a copy can be stored temporarily in a mailbox, e.g. Rejects. If mail isn't coming in when you expect, you can look there. The mail still isn't accepted, so the remote mail server may retry (hopefully, if legitimate), or give up (hopefully, if indeed a spammer). Messages are automatically removed from this mailbox, so do not set it to a mailbox that has messages you want to keep."`
 	KeepRejects                  bool                   `sconf:"optional" sconf-doc:"Don't automatically delete mail in the RejectsMailbox listed above. This can be useful, e.g. for future spam training. It can also cause storage to fill up."`
 	AutomaticJunkFlags           AutomaticJunkFlags     `sconf:"optional" sconf-doc:"Automatically set $Junk and $NotJunk flags based on mailbox messages are delivered/moved/copied to. Email clients typically have too limited functionality to conveniently set these flags, especially $NonJunk, but they can all move messages to a different mailbox, so this helps them."`
@@ -435,6 +725,13 @@ type Account struct {
 	MaxOutgoingMessagesPerDay    int                    `sconf:"optional" sconf-doc:"Maximum number of outgoing messages for this account in a 24 hour window. This limits the damage to recipients and the reputation of this mail server in case of account compromise. Default 1000."`
 	MaxFirstTimeRecipientsPerDay int                    `sconf:"optional" sconf-doc:"Maximum number of first-time recipients in outgoing messages for this account in a 24 hour window. This limits the damage to recipients and the reputation of this mail server in case of account compromise. Default 200."`
 	NoFirstTimeSenderDelay       bool                   `sconf:"optional" sconf-doc:"Do not apply a delay to SMTP connections before accepting an incoming message from a first-time sender. Can be useful for accounts that sends automated responses and want instant replies."`
+	DuplicateWindow              *DuplicateWindow       `sconf:"optional" sconf-doc:"If configured, an incoming message with the same Message-ID as a message delivered to the account over SMTP during the configured period is treated as duplicate, e.g. for copies of a message through both a mailing list and directly, or from misbehaving forwarders. Can be overridden per destination."`
+	AutoArchive                  *AutoArchive           `sconf:"optional" sconf-doc:"If configured, messages older than the configured age are moved daily from the configured mailboxes into yearly mailboxes under the archive mailbox, e.g. Archive/2023, keeping frequently used mailboxes small and IMAP clients fast. Moved messages keep their flags, keywords and threads. Archiving can also be started with \"mox autoarchive\"."`
+	ArchiveTier                  *ArchiveTier           `sconf:"optional" sconf-doc:"If configured, the data of messages older than the configured age is moved from an on-disk file per message into compressed pack files holding many messages, saving disk space and inodes. Packed messages are decompressed transparently when accessed. Messages are packed daily, and with \"mox archivepack\". Pack files with mostly removed messages are rewritten at the same time."`
+	MessageCompression           *MessageCompression    `sconf:"optional" sconf-doc:"Compression of message files for this account, overriding the global MessageCompression configuration."`
+	MessageEncryption            *MessageEncryption     `sconf:"optional" sconf-doc:"If configured, message files of new messages are stored encrypted, so a copy of the disk does not directly expose message contents. Messages are decrypted transparently when accessed. Encrypted messages are not compressed, and not moved into pack files of the ArchiveTier. Existing messages are encrypted with \"mox encryptmsgs\". Message metadata in the account database, such as subjects, addresses and the full-text index, is not encrypted."`
+	SubmissionChecks             *SubmissionChecks      `sconf:"optional" sconf-doc:"Sanity checks for messages submitted by this account, through SMTP submission, webmail and webapi. Missing Date and Message-ID headers are always added."`
+	TLSClientAuth                []TLSClientAuth        `sconf:"optional" sconf-doc:"TLS client certificates that authenticate as this account on IMAP and SMTP submission, in addition to those added through the account web interface. For password-less machine clients. Clients authenticate during the TLS handshake, and with IMAP and SMTP AUTH mechanism EXTERNAL to complete the login."`
 	NoCustomPassword             bool                   `sconf:"optional" sconf-doc:"If set, this account cannot set a password of their own choice, but can only set a new randomly generated password, preventing password reuse across services and use of weak passwords. Custom account passwords can be set by the admin."`
 	Routes                       []Route                `sconf:"optional" sconf-doc:"Routes for delivering outgoing messages through the queue. Each delivery attempt evaluates these account routes, domain routes and finally global routes. The transport of the first matching route is used in the delivery attempt. If no routes match, which is the default with no configured routes, messages are delivered directly from the queue."`
 
@@ -443,9 +740,92 @@ type Account struct {
 	NeutralMailbox             *regexp.Regexp `sconf:"-" json:"-"`
 	NotJunkMailbox             *regexp.Regexp `sconf:"-" json:"-"`
 	ParsedFromIDLoginAddresses []smtp.Address `sconf:"-" json:"-"`
+	ParsedLoginNetworks        []net.IPNet    `sconf:"-" json:"-"`
 	Aliases                    []AddressAlias `sconf:"-"`
 }
 
+// TLSClientAuth maps a TLS client certificate to an account. Exactly one of
+// Fingerprint and Subject must be set.
+type TLSClientAuth struct {
+	Fingerprint   string `sconf:"optional" sconf-doc:"Fingerprint of the public key of the certificate: the raw-url-base64-encoded SHA-256 hash of the Subject Public Key Info. The certificate does not have to be signed by a CA, e.g. a self-signed certificate."`
+	Subject       string `sconf:"optional" sconf-doc:"Subject of the certificate, e.g. \"CN=backup,O=Example\", compared exactly against the subject in RFC 2253 form, as shown by \"openssl x509 -noout -subject -nameopt rfc2253\". Only matches certificates that are signed by one of the ClientAuthCAFiles of the TLS config of the listener, and are valid for client authentication."`
+	LoginAddress  string `sconf-doc:"Email address of this account to log in as, e.g. used as username in IMAP and as default From address in SMTP submission."`
+	NoIMAPPreauth bool   `sconf:"optional" sconf-doc:"If set, IMAP connections authenticated with this certificate are not immediately in authenticated state, for clients that do not understand IMAP PREAUTH and will attempt AUTHENTICATE EXTERNAL anyway."`
+}
+
+type DuplicateWindow struct {
+	Period   time.Duration `sconf-doc:"Period during which a message with the same Message-ID is considered a duplicate, e.g. 30m. Zero disables duplicate detection, e.g. to override the account setting for a destination."`
+	Suppress bool          `sconf:"optional" sconf-doc:"If set, duplicate messages are accepted but not stored. By default, duplicates are stored with keyword $Duplicate, so they can be filtered by mail clients."`
+}
+
+type AutoArchive struct {
+	Age         time.Duration `sconf-doc:"Messages received longer ago than this are archived, e.g. 2160h for 90 days."`
+	Mailboxes   []string      `sconf:"optional" sconf-doc:"Mailboxes to archive messages from. Default Inbox. Mailboxes under the archive mailbox are never archived."`
+	Mailbox     string        `sconf:"optional" sconf-doc:"Mailbox under which the yearly mailboxes are created. Default is the mailbox with the special-use archive flag, or Archive if there is none."`
+	SkipUnread  bool          `sconf:"optional" sconf-doc:"Don't archive messages without the seen flag."`
+	SkipFlagged bool          `sconf:"optional" sconf-doc:"Don't archive messages with the flagged flag."`
+}
+
+type ArchiveTier struct {
+	Age            time.Duration `sconf-doc:"Messages received longer ago than this are packed, e.g. 4320h for 180 days."`
+	MaxMessageSize int64         `sconf:"optional" sconf-doc:"Messages larger than this size in bytes are kept in their own on-disk file. Packed messages are decompressed in memory when accessed. Default 1MB."`
+}
+
+// SieveNotifyHTTP configures notifications over HTTP from sieve scripts.
+type SieveNotifyHTTP struct {
+	Hosts           []string `sconf-doc:"Host names that notifications can be sent to, e.g. ntfy.sh. A leading \"*.\" matches subdomains. A single \"*\" allows all hosts."`
+	AllowPrivateIPs bool     `sconf:"optional" sconf-doc:"Allow connections to loopback, private, link-local and unspecified IPs, e.g. for a notification service on the local network. By default, such connections are refused, also when a host name resolves to such an IP."`
+}
+
+type MessageCompression struct {
+	Disabled       bool  `sconf:"optional" sconf-doc:"Don't compress messages, e.g. for an account when compression is configured globally. Already compressed messages stay compressed."`
+	MinMessageSize int64 `sconf:"optional" sconf-doc:"Messages smaller than this size in bytes are stored uncompressed, compressing them would not save disk blocks. Default 4096."`
+	MaxMessageSize int64 `sconf:"optional" sconf-doc:"Messages larger than this size in bytes are stored uncompressed. Compressed messages are decompressed in memory when accessed. Default 1MB."`
+}
+
+type MessageEncryption struct {
+	KeyWrap string `sconf:"optional" sconf-doc:"How the message key of the account is protected: \"masterkey\" (default) encrypts it with the master key from the global MessageEncryptionKeyFile, messages can always be read by mox. \"password\" encrypts it with a key derived from the account password. The message key is unlocked when the account logs in with its password, e.g. with IMAP LOGIN or AUTHENTICATE PLAIN or through the web login form, but not with SCRAM or CRAM-MD5 authentication, or with an existing web session. It stays unlocked until mox stops. Until unlocked, encrypted messages cannot be read, also not for IMAP, webmail, exports or junk filter training, but new messages are delivered encrypted. The message key is created at the first login with password or when the password is set. Setting a new password requires the message key to be unlocked, otherwise existing messages could no longer be read. Changing KeyWrap takes effect at the next login with password."`
+}
+
+type SubmissionChecks struct {
+	RequireTo         bool `sconf:"optional" sconf-doc:"Reject messages without To or Cc header, e.g. with only Bcc recipients."`
+	RequireSubject    bool `sconf:"optional" sconf-doc:"Reject messages without (non-empty) Subject header."`
+	MaxRecipients     int  `sconf:"optional" sconf-doc:"Reject messages with more than this number of recipients. Zero means no limit."`
+	ConfirmRecipients int  `sconf:"optional" sconf-doc:"Messages composed in webmail with more than this number of recipients must be confirmed before being sent, preventing accidental reply-all storms. Zero means no confirmation is needed."`
+}
+
+// LoginDisabledMessage returns a non-empty message if logins are not allowed for
+// the account, either because LoginDisabled is set or the account is suspended.
+func (a Account) LoginDisabledMessage() string {
+	if a.LoginDisabled != "" {
+		return a.LoginDisabled
+	}
+	return a.Suspended
+}
+
+// LoginNetworkAllowed returns whether logins for the account are allowed from ip,
+// based on LoginNetworks.
+func (a Account) LoginNetworkAllowed(ip net.IP) bool {
+	if len(a.ParsedLoginNetworks) == 0 {
+		return true
+	}
+	for _, ipnet := range a.ParsedLoginNetworks {
+		if ipnet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// AddDestination adds or replaces the destination for an email address or
+// localpart, initializing Destinations if needed.
+func (a *Account) AddDestination(addr string, d Destination) {
+	if a.Destinations == nil {
+		a.Destinations = map[string]Destination{}
+	}
+	a.Destinations[addr] = d
+}
+
 type AddressAlias struct {
 	SubscriptionAddress string
 	Alias               Alias    // Without members.
@@ -458,11 +838,14 @@ type JunkFilter struct {
 }
 
 type Destination struct {
-	Mailbox                      string    `sconf:"optional" sconf-doc:"Mailbox to deliver to if none of Rulesets match. Default: Inbox."`
-	Rulesets                     []Ruleset `sconf:"optional" sconf-doc:"Delivery rules based on message and SMTP transaction. You may want to match each mailing list by SMTP MailFrom address, VerifiedDomain and/or List-ID header (typically <listname.example.org> if the list address is listname@example.org), delivering them to their own mailbox."`
-	SMTPError                    string    `sconf:"optional" sconf-doc:"If non-empty, incoming delivery attempts to this destination will be rejected during SMTP RCPT TO with this error response line. Useful when a catchall address is configured for the domain and messages to some addresses should be rejected. The response line must start with an error code. Currently the following error resonse codes are allowed: 421 (temporary local error), 550 (user not found). If the line consists of only an error code, an appropriate error message is added. Rejecting messages with a 4xx code invites later retries by the remote, while 5xx codes should prevent further delivery attempts."`
-	MessageAuthRequiredSMTPError string    `sconf:"optional" sconf-doc:"If non-empty, an additional DMARC-like message authentication check is done for incoming messages, validating the domain in the From-header of the message. Messages without either an aligned SPF or aligned DKIM pass are rejected during the SMTP DATA command with a permanent error code followed by the message in this field. The domain in the message 'From' header is matched in relaxed or strict mode according to the domain's DMARC policy if present, or relaxed mode (organizational instead of exact domain match) otherwise. Useful for autoresponders that don't want to accept messages they don't want to send an automated reply to."`
-	FullName                     string    `sconf:"optional" sconf-doc:"Full name to use in message From header when composing messages coming from this address with webmail."`
+	Mailbox                      string           `sconf:"optional" sconf-doc:"Mailbox to deliver to if none of Rulesets match. Default: Inbox."`
+	Rulesets                     []Ruleset        `sconf:"optional" sconf-doc:"Delivery rules based on message and SMTP transaction. You may want to match each mailing list by SMTP MailFrom address, VerifiedDomain and/or List-ID header (typically <listname.example.org> if the list address is listname@example.org), delivering them to their own mailbox."`
+	SMTPError                    string           `sconf:"optional" sconf-doc:"If non-empty, incoming delivery attempts to this destination will be rejected during SMTP RCPT TO with this error response line. Useful when a catchall address is configured for the domain and messages to some addresses should be rejected. The response line must start with an error code. Currently the following error resonse codes are allowed: 421 (temporary local error), 550 (user not found). If the line consists of only an error code, an appropriate error message is added. Rejecting messages with a 4xx code invites later retries by the remote, while 5xx codes should prevent further delivery attempts."`
+	MessageAuthRequiredSMTPError string           `sconf:"optional" sconf-doc:"If non-empty, an additional DMARC-like message authentication check is done for incoming messages, validating the domain in the From-header of the message. Messages without either an aligned SPF or aligned DKIM pass are rejected during the SMTP DATA command with a permanent error code followed by the message in this field. The domain in the message 'From' header is matched in relaxed or strict mode according to the domain's DMARC policy if present, or relaxed mode (organizational instead of exact domain match) otherwise. Useful for autoresponders that don't want to accept messages they don't want to send an automated reply to."`
+	FullName                     string           `sconf:"optional" sconf-doc:"Full name to use in message From header when composing messages coming from this address with webmail."`
+	Disabled                     bool             `sconf:"optional" sconf-doc:"If set, the address is treated as if it does not exist: Incoming deliveries are rejected as for an unknown user, the address cannot be used to log in, and messages cannot be submitted with the address as message From address. The configuration of the destination is kept, so the address can be enabled again later. Disabled addresses that are members of an alias are skipped during delivery to the alias."`
+	DuplicateWindow              *DuplicateWindow `sconf:"optional" sconf-doc:"Duplicate detection for this destination, overriding the DuplicateWindow of the account."`
+	Forward                      *Forward         `sconf:"optional" sconf-doc:"Forward incoming messages for this address to external addresses. The SMTP MAIL FROM address is rewritten with the sender rewriting scheme (SRS) to an address at the domain of this destination, so SPF verification at the next hop passes, and bounces are sent back to the original sender. Forwarded messages are ARC-sealed and DKIM-signed with the domain of this destination. Messages that were already delivered to this address are not forwarded again, preventing loops. Messages classified as junk are not forwarded. Redirects by sieve scripts and ForwardTo of rulesets are forwarded the same way."`
 
 	DMARCReports     bool `sconf:"-" json:"-"`
 	HostTLSReports   bool `sconf:"-" json:"-"`
@@ -483,12 +866,24 @@ func (d Destination) Equal(o Destination) bool {
 			return false
 		}
 	}
-	return true
+	return (d.Forward == nil) == (o.Forward == nil) && (d.Forward == nil || d.Forward.Equal(*o.Forward))
+}
+
+type Forward struct {
+	To       []string `sconf-doc:"Addresses to forward messages to."`
+	KeepCopy bool     `sconf:"optional" sconf-doc:"Also deliver forwarded messages to the mailbox of this destination."`
+	Disabled bool     `sconf:"optional" sconf-doc:"Temporarily don't forward messages, delivering them to the mailbox of this destination instead. The forwarding addresses are kept, so forwarding can be enabled again later."`
+}
+
+// Equal returns whether f and o are equal.
+func (f Forward) Equal(o Forward) bool {
+	return slices.Equal(f.To, o.To) && f.KeepCopy == o.KeepCopy && f.Disabled == o.Disabled
 }
 
 type Ruleset struct {
 	SMTPMailFromRegexp string            `sconf:"optional" sconf-doc:"Matches if this regular expression matches (a substring of) the SMTP MAIL FROM address (not the message From-header). E.g. '^user@example\\.org$'."`
 	MsgFromRegexp      string            `sconf:"optional" sconf-doc:"Matches if this regular expression matches (a substring of) the single address in the message From header."`
+	MsgToRegexp        string            `sconf:"optional" sconf-doc:"Matches if this regular expression matches (a substring of) one of the addresses in the message To and Cc headers."`
 	VerifiedDomain     string            `sconf:"optional" sconf-doc:"Matches if this domain matches an SPF- and/or DKIM-verified (sub)domain."`
 	HeadersRegexp      map[string]string `sconf:"optional" sconf-doc:"Matches if these header field/value regular expressions all match (substrings of) the message headers. Header fields and valuees are converted to lower case before matching. Whitespace is trimmed from the value before matching. A header field can occur multiple times in a message, only one instance has to match. For mailing lists, you could match on ^list-id$ with the value typically the mailing list address in angled brackets with @ replaced with a dot, e.g. <name\\.lists\\.example\\.org>."`
 	// todo: add a SMTPRcptTo check
@@ -498,11 +893,16 @@ type Ruleset struct {
 	ListAllowDomain        string `sconf:"optional" sconf-doc:"Influences spam filtering only, this option does not change whether a message matches this ruleset. If this domain matches an SPF- and/or DKIM-verified (sub)domain, the message is accepted without further spam checks, such as a junk filter or DMARC reject evaluation. DMARC rejects should not apply for mailing lists that are not configured to rewrite the From-header of messages that don't have a passing DKIM signature of the From-domain. Otherwise, by rejecting messages, you may be automatically unsubscribed from the mailing list. The assumption is that mailing lists do their own spam filtering/moderation."`
 	AcceptRejectsToMailbox string `sconf:"optional" sconf-doc:"Influences spam filtering only, this option does not change whether a message matches this ruleset. If a message is classified as spam, it isn't rejected during the SMTP transaction (the normal behaviour), but accepted during the SMTP transaction and delivered to the specified mailbox. The specified mailbox is not automatically cleaned up like the account global Rejects mailbox, unless set to that Rejects mailbox."`
 
-	Mailbox string `sconf-doc:"Mailbox to deliver to if this ruleset matches."`
-	Comment string `sconf:"optional" sconf-doc:"Free-form comments."`
+	Mailbox   string   `sconf:"optional" sconf-doc:"Mailbox to deliver to if this ruleset matches. Required unless Discard is set."`
+	Seen      bool     `sconf:"optional" sconf-doc:"Mark the delivered message as read."`
+	Keywords  []string `sconf:"optional" sconf-doc:"Keywords to add to the delivered message, e.g. to label newsletters. Must be lower case, without spaces."`
+	ForwardTo []string `sconf:"optional" sconf-doc:"Addresses to forward the message to, in addition to delivering it to Mailbox, unless Discard is set. The message is forwarded like messages for destinations with Forward configured: the SMTP MAIL FROM address is rewritten with the sender rewriting scheme (SRS) to an address at the domain of the recipient, so SPF verification at the next hop passes and delivery failures are reported to the original sender. Forwarded messages are ARC-sealed and DKIM-signed with the domain of the recipient. Messages that were already delivered to the recipient address are not forwarded again, preventing loops. Only for messages delivered over SMTP, not for messages classified as junk."`
+	Discard   bool     `sconf:"optional" sconf-doc:"Accept the message, but do not store it, e.g. for messages that are only forwarded. Mailbox must not be set."`
+	Comment   string   `sconf:"optional" sconf-doc:"Free-form comments."`
 
 	SMTPMailFromRegexpCompiled *regexp.Regexp      `sconf:"-" json:"-"`
 	MsgFromRegexpCompiled      *regexp.Regexp      `sconf:"-" json:"-"`
+	MsgToRegexpCompiled        *regexp.Regexp      `sconf:"-" json:"-"`
 	VerifiedDNSDomain          dns.Domain          `sconf:"-"`
 	HeadersRegexpCompiled      [][2]*regexp.Regexp `sconf:"-" json:"-"`
 	ListAllowDNSDomain         dns.Domain          `sconf:"-"`
@@ -510,7 +910,10 @@ type Ruleset struct {
 
 // Equal returns whether r and o are equal, only looking at their user-changeable fields.
 func (r Ruleset) Equal(o Ruleset) bool {
-	if r.SMTPMailFromRegexp != o.SMTPMailFromRegexp || r.MsgFromRegexp != o.MsgFromRegexp || r.VerifiedDomain != o.VerifiedDomain || r.IsForward != o.IsForward || r.ListAllowDomain != o.ListAllowDomain || r.AcceptRejectsToMailbox != o.AcceptRejectsToMailbox || r.Mailbox != o.Mailbox || r.Comment != o.Comment {
+	if r.SMTPMailFromRegexp != o.SMTPMailFromRegexp || r.MsgFromRegexp != o.MsgFromRegexp || r.MsgToRegexp != o.MsgToRegexp || r.VerifiedDomain != o.VerifiedDomain || r.IsForward != o.IsForward || r.ListAllowDomain != o.ListAllowDomain || r.AcceptRejectsToMailbox != o.AcceptRejectsToMailbox || r.Mailbox != o.Mailbox || r.Seen != o.Seen || r.Discard != o.Discard || r.Comment != o.Comment {
+		return false
+	}
+	if !slices.Equal(r.Keywords, o.Keywords) || !slices.Equal(r.ForwardTo, o.ForwardTo) {
 		return false
 	}
 	if !reflect.DeepEqual(r.HeadersRegexp, o.HeadersRegexp) {
@@ -525,16 +928,20 @@ type KeyCert struct {
 }
 
 type TLS struct {
-	ACME                string    `sconf:"optional" sconf-doc:"Name of provider from top-level configuration to use for ACME, e.g. letsencrypt."`
-	KeyCerts            []KeyCert `sconf:"optional" sconf-doc:"Keys and certificates to use for this listener. The files are opened by the privileged root process and passed to the unprivileged mox process, so no special permissions are required on the files. If the private key will not be replaced when refreshing certificates, also consider adding the private key to HostPrivateKeyFiles and configuring DANE TLSA DNS records."`
-	MinVersion          string    `sconf:"optional" sconf-doc:"Minimum TLS version. Default: TLSv1.2."`
-	HostPrivateKeyFiles []string  `sconf:"optional" sconf-doc:"Private keys used for ACME certificates. Specified explicitly so DANE TLSA DNS records can be generated, even before the certificates are requested. DANE is a mechanism to authenticate remote TLS certificates based on a public key or certificate specified in DNS, protected with DNSSEC. DANE is opportunistic and attempted when delivering SMTP with STARTTLS. The private key files must be in PEM format. PKCS8 is recommended, but PKCS1 and EC private keys are recognized as well. Only RSA 2048 bit and ECDSA P-256 keys are currently used. The first of each is used when requesting new certificates through ACME."`
+	ACME                    string    `sconf:"optional" sconf-doc:"Name of provider from top-level configuration to use for ACME, e.g. letsencrypt."`
+	KeyCerts                []KeyCert `sconf:"optional" sconf-doc:"Keys and certificates to use for this listener. The files are opened by the privileged root process and passed to the unprivileged mox process, so no special permissions are required on the files. If the private key will not be replaced when refreshing certificates, also consider adding the private key to HostPrivateKeyFiles and configuring DANE TLSA DNS records."`
+	MinVersion              string    `sconf:"optional" sconf-doc:"Minimum TLS version. Default: TLSv1.2."`
+	HostPrivateKeyFiles     []string  `sconf:"optional" sconf-doc:"Private keys used for ACME certificates. Specified explicitly so DANE TLSA DNS records can be generated, even before the certificates are requested. DANE is a mechanism to authenticate remote TLS certificates based on a public key or certificate specified in DNS, protected with DNSSEC. DANE is opportunistic and attempted when delivering SMTP with STARTTLS. The private key files must be in PEM format. PKCS8 is recommended, but PKCS1 and EC private keys are recognized as well. Only RSA 2048 bit and ECDSA P-256 keys are currently used. The first of each is used when requesting new certificates through ACME."`
+	HostPrivateKeyFilesNext []string  `sconf:"optional" sconf-doc:"Private keys to roll over to, in the same format as HostPrivateKeyFiles. DANE TLSA DNS records are generated for these keys too, but they are not used for certificates yet. To roll over to a new key: Add it here, publish the updated DANE records, and wait until the TTL of the previous TLSA records has expired. Then move the key to the front of HostPrivateKeyFiles, so it is used for new certificates. Once all certificates have been renewed with the new key, remove the old key from HostPrivateKeyFiles and its TLSA record from DNS."`
+	ClientAuthCAFiles       []string  `sconf:"optional" sconf-doc:"CA certificates in PEM format, for verifying TLS client certificates on IMAP and SMTP submission connections. Client certificates that chain to one of these CAs can authenticate as the account that has the certificate subject configured in its TLSClientAuth. Without CA files, only client certificates mapped by public key fingerprint, in TLSClientAuth of an account or through the account web interface, can authenticate."`
 
 	Config                   *tls.Config     `sconf:"-" json:"-"` // TLS config for non-ACME-verification connections, i.e. SMTP and IMAP, and not port 443. Connections without SNI will use a certificate for the hostname of the listener, connections with an SNI hostname that isn't allowed will be rejected.
 	ConfigFallback           *tls.Config     `sconf:"-" json:"-"` // Like Config, but uses the certificate for the listener hostname when the requested SNI hostname is not allowed, instead of causing the connection to fail.
 	ACMEConfig               *tls.Config     `sconf:"-" json:"-"` // TLS config that handles ACME verification, for serving on port 443.
 	HostPrivateRSA2048Keys   []crypto.Signer `sconf:"-" json:"-"` // Private keys for new TLS certificates for listener host name, for new certificates with ACME, and for DANE records.
 	HostPrivateECDSAP256Keys []crypto.Signer `sconf:"-" json:"-"`
+	HostPrivateKeysNext      []crypto.Signer `sconf:"-" json:"-"` // Only for DANE records, for key rollover.
+	ClientAuthCAs            *x509.CertPool  `sconf:"-" json:"-"` // Parsed ClientAuthCAFiles, nil if none.
 }
 
 // todo: we could implement matching WebHandler.Domain as IPs too
@@ -217,6 +217,25 @@ See https://pkg.go.dev/github.com/mjl-/sconf for details.
 				HostPrivateKeyFiles:
 					-
 
+				# Private keys to roll over to, in the same format as HostPrivateKeyFiles. DANE
+				# TLSA DNS records are generated for these keys too, but they are not used for
+				# certificates yet. To roll over to a new key: Add it here, publish the updated
+				# DANE records, and wait until the TTL of the previous TLSA records has expired.
+				# Then move the key to the front of HostPrivateKeyFiles, so it is used for new
+				# certificates. Once all certificates have been renewed with the new key, remove
+				# the old key from HostPrivateKeyFiles and its TLSA record from DNS. (optional)
+				HostPrivateKeyFilesNext:
+					-
+
+				# CA certificates in PEM format, for verifying TLS client certificates on IMAP and
+				# SMTP submission connections. Client certificates that chain to one of these CAs
+				# can authenticate as the account that has the certificate subject configured in
+				# its TLSClientAuth. Without CA files, only client certificates mapped by public
+				# key fingerprint, in TLSClientAuth of an account or through the account web
+				# interface, can authenticate. (optional)
+				ClientAuthCAFiles:
+					-
+
 			# Maximum size in bytes for incoming and outgoing messages. Default is 100MB.
 			# (optional)
 			SMTPMaxMessageSize: 0
@@ -262,10 +281,116 @@ See https://pkg.go.dev/github.com/mjl-/sconf for details.
 				# account. Default: 15s. (optional)
 				FirstTimeSenderDelay: 0s
 
+				# Maximum number of probes with a null reverse path (MAIL FROM:<>) per hour from a
+				# remote IP (or /64 for IPv6). A probe is a transaction with a null reverse path
+				# that ends without transferring a message, as used for sender address callout
+				# verification and by spammers checking whether addresses exist (resulting in
+				# backscatter). Legitimate delivery status notifications transfer a message and
+				# are not counted. For the /26 and /21 (IPv4) or /48 and /32 (IPv6) subnets of the
+				# remote IP, the limit is 3 and 9 times higher. When the limit is reached,
+				# recipients with a null reverse path are rejected with a temporary error.
+				# Default: 60. Set to -1 to disable. (optional)
+				NullSenderProbesPerHour: 0
+
 				# Override default setting for enabling TLS session tickets. Disabling session
 				# tickets may work around TLS interoperability issues. (optional)
 				TLSSessionTicketsDisabled: false
 
+				# If set, incoming deliveries from remote networks (IPv4 /24, IPv6 /64) that are
+				# not whitelisted are rejected with a temporary error on first contact, for each
+				# combination of remote network, MAIL FROM and RCPT TO address. Legitimate mail
+				# servers retry later, many spammers don't. Only applies to local recipients.
+				# Remote networks that retry properly, or that deliver a message with a good
+				# reputation that passes SPF or DKIM verification, are whitelisted. (optional)
+				Greylisting:
+
+					# Minimum time after the first delivery attempt before a retry is accepted.
+					# Default 5m. (optional)
+					Delay: 0s
+
+					# Period after the first delivery attempt in which a retry is accepted. Later
+					# attempts are treated as first contact again. Default 24h. (optional)
+					RetryWindow: 0s
+
+					# Period a remote network stays whitelisted after its last delivery. Default 840h
+					# (35 days). (optional)
+					WhitelistPeriod: 0s
+
+				# Rules for incoming deliveries based on fingerprints of the connection, to stop
+				# spam from botnets that are not (yet) listed in DNSBLs. For each connection, a
+				# TLS fingerprint of the TLS client hello (if STARTTLS was used) and an SMTP
+				# fingerprint of the commands until the first MAIL FROM are logged at the first
+				# MAIL FROM (log line "fingerprints"). The first matching rule is applied.
+				# (optional)
+				FingerprintRules:
+					-
+
+						# TLS fingerprint to match, a hexadecimal MD5 hash over the TLS versions, cipher
+						# suites, curves, point formats, signature schemes and application protocols from
+						# the TLS client hello, similar to JA3. (optional)
+						TLS:
+
+						# SMTP fingerprint to match, a comma-separated list of commands (as sent by the
+						# remote) until and including the first MAIL FROM, without the addresses, with a +
+						# suffix if the remote sent more data without waiting for the response. E.g.
+						# "EHLO,STARTTLS,EHLO,MAIL FROM:<". (optional)
+						SMTP:
+
+						# Action for matching connections: reject (reject the MAIL FROM command and close
+						# the connection) or slow (respond slowly, keeping bots busy).
+						Action:
+
+				# External content filters, e.g. for virus scanning with ClamAV, spam filtering
+				# with rspamd or custom classifiers. Incoming messages are passed to each filter
+				# in order, after the message data has been received, before delivering to local
+				# recipients. A filter returns a verdict: accept (possibly with header fields to
+				# add or a rewritten message), reject, tempfail or quarantine. Processing stops at
+				# the first filter that does not accept the message. A verdict is a JSON object
+				# with fields: Action (accept, reject, tempfail or quarantine; default accept),
+				# Code, Secode and Text (optional, for the SMTP response for reject and tempfail,
+				# e.g. 550, "7.1" and "virus found"), Headers (optional, header fields to add at
+				# the top of the message, e.g. [{"Name": "X-Spam", "Value": "yes"}]) and Rewrite
+				# (optional, base64-encoded message to deliver instead of the original message).
+				# (optional)
+				ContentFilters:
+					-
+
+						# Name of the filter, for logging and metrics.
+						Name:
+
+						# Command and arguments to run for each message. The message is written to stdin.
+						# Details of the SMTP transaction are passed in environment variables:
+						# MOX_REMOTE_IP, MOX_EHLO, MOX_MAIL_FROM, MOX_RCPT_TO (addresses separated by
+						# spaces) and MOX_TLS (yes or no). The command must write its verdict as JSON to
+						# stdout, and exit with status 0. (optional)
+						Command:
+							-
+
+						# HTTP or HTTPS URL to POST each message to, with Content-Type message/rfc822.
+						# Details of the SMTP transaction are passed in request headers X-Mox-Remote-IP,
+						# X-Mox-EHLO, X-Mox-Mail-From, X-Mox-Rcpt-To (one per recipient) and X-Mox-TLS.
+						# The response must have status 200 and the verdict as JSON in the body.
+						# (optional)
+						URL:
+
+						# Maximum duration for the filter to return its verdict. Default 30s. (optional)
+						Timeout: 0s
+
+						# Messages larger than this size in bytes are not passed to the filter, and
+						# accepted. Default 0, no limit. (optional)
+						MaxSize: 0
+
+						# What to do when the filter fails, times out, or writes a verdict larger than
+						# twice the message size plus 64KB: tempfail (reject the message with a temporary
+						# error, so the sender retries later) or accept (continue without verdict of this
+						# filter). Default tempfail. (optional)
+						OnError:
+
+						# Mailbox to deliver quarantined messages to, instead of their regular
+						# destination. Quarantined messages are marked as read and are not processed by
+						# sieve scripts or forwarded. Default Junk. (optional)
+						QuarantineMailbox:
+
 			# SMTP for submitting email, e.g. by email applications. Starts out in plain text,
 			# can be upgraded to TLS with the STARTTLS command. Prefer using Submissions which
 			# is always a TLS connection. (optional)
@@ -295,6 +420,59 @@ See https://pkg.go.dev/github.com/mjl-/sconf for details.
 				# technique for Delta Chat. (optional)
 				EnabledOnHTTPS: false
 
+			# Restrictions for Submission and Submissions on this listener, e.g. for only
+			# allowing submission from a VPN or internal network while the SMTP listener for
+			# incoming messages stays public. (optional)
+			SubmissionAccess:
+
+				# If non-empty, only connections from these IP addresses or networks in CIDR
+				# notation, e.g. 10.0.0.0/8 or 2001:db8::/32, are served. Connections from other
+				# IPs are closed, on ports with plain text SMTP after a response with code 421.
+				# (optional)
+				Networks:
+					-
+
+				# Require authentication with both a TLS client certificate and a password-based
+				# SASL mechanism for the same account before messages can be submitted. The TLS
+				# public key of the client certificate must be registered for the account. SASL
+				# mechanism EXTERNAL is not accepted. (optional)
+				RequireClientCertAndPassword: false
+
+			# Behaviour of the VRFY (verify address) and EXPN (expand mailing list) commands
+			# for SMTP, Submission and Submissions on this listener. If absent, both commands
+			# respond with code 252 without verifying or expanding, not disclosing whether
+			# addresses exist. (optional)
+			VRFYEXPN:
+
+				# Either "disabled", responding with code 502 (command not implemented), "252",
+				# responding with code 252 without verifying the address or expanding the alias
+				# (the default), or "accurate", verifying addresses and expanding aliases for
+				# clients that have authenticated or connect from Networks, and responding with
+				# code 252 to other clients. Authenticated clients outside Networks only get
+				# members of aliases that have ListMembers set.
+				Mode:
+
+				# IP addresses or networks in CIDR notation, e.g. 10.0.0.0/8 or 2001:db8::/32, of
+				# internal clients that get accurate responses without authenticating, e.g. for
+				# internal tooling. (optional)
+				Networks:
+					-
+
+			# If set, connections from the configured networks, typically TCP load balancers,
+			# must start with a HAProxy PROXY protocol header (version 1 or 2), and the
+			# original client address from the header is used instead of the address of the
+			# load balancer, e.g. for rate limiting, DNSBL and SPF checks, login restrictions
+			# and logging. Applies to all SMTP, submission, IMAP and HTTP ports of this
+			# listener. Connections from other addresses are served as regular connections
+			# without PROXY header. (optional)
+			ProxyProtocol:
+
+				# IP addresses or networks in CIDR notation of the load balancers sending a PROXY
+				# header, e.g. 10.0.0.0/8 or 2001:db8::/32. Connections from these networks
+				# without valid PROXY header are closed.
+				Networks:
+					-
+
 			# IMAP for reading email, by email applications. Starts out in plain text, can be
 			# upgraded to TLS with the STARTTLS command. Prefer using IMAPS instead which is
 			# always a TLS connection. (optional)
@@ -324,6 +502,93 @@ See https://pkg.go.dev/github.com/mjl-/sconf for details.
 				# technique for Delta Chat. (optional)
 				EnabledOnHTTPS: false
 
+			# Serve IMAP and IMAPS on this listener in read-only mode, e.g. for an instance
+			# that serves mail from a snapshot or backup of the data directory while the
+			# primary instance is being migrated or restored, so users keep access to their
+			# mail. Users can log in, and list, examine and fetch messages. Mailboxes are
+			# always opened read-only, also with SELECT, so messages aren't marked as read.
+			# Commands that change messages, flags, mailboxes, subscriptions or metadata fail
+			# with response code UNAVAILABLE. An alert about the read-only access is sent
+			# after connecting. Only IMAP is affected: Disable SMTP, submission and the web
+			# interfaces on the instance to prevent other changes. (optional)
+			IMAPReadOnly: false
+
+			# Limits for IMAP and IMAPS connections on this listener, protecting against
+			# excessive memory use. Commands exceeding a limit are rejected with a TOOBIG
+			# response code. (optional)
+			IMAPLimits:
+
+				# Maximum length in bytes of a command line, excluding literals. Longer lines
+				# cause the connection to be closed. Default 16KB, minimum 1KB. (optional)
+				MaxLineLength: 0
+
+				# Maximum size in bytes of a single literal in a command other than APPEND.
+				# Literals are held in memory while handling a command. Default 100KB. (optional)
+				MaxLiteralSize: 0
+
+				# Maximum total size in bytes of all literals in a single command other than
+				# APPEND. Default 10 times MaxLiteralSize. (optional)
+				MaxCommandLiteralSize: 0
+
+				# Maximum number of literals in a single command. Default 1000. (optional)
+				MaxCommandLiterals: 0
+
+				# Maximum size in bytes of a message added with APPEND, announced with the
+				# APPENDLIMIT capability. Messages are written to a temporary file, not held in
+				# memory. Default 0, for no limit other than the quota of the account. (optional)
+				MaxAppendSize: 0
+
+				# Announce LITERAL- instead of LITERAL+, limiting non-synchronizing literals to
+				# 4096 bytes. Clients must wait for the server before sending larger literals,
+				# giving the server a chance to reject too large literals before they are sent.
+				# (optional)
+				LiteralMinus: false
+
+				# Time after which an authenticated connection without incoming commands is
+				# closed, also for connections in IDLE. The IMAP specification requires at least
+				# 30 minutes. Connections that are not authenticated are closed after 30 seconds
+				# of inactivity. Default 30m. (optional)
+				IdleTimeout: 0s
+
+				# Maximum duration of a connection. When reached, the connection is closed with a
+				# BYE when the server is waiting for the next command, causing clients to
+				# reconnect. Useful for periodically reevaluating credentials and configuration.
+				# Default 0, no maximum. (optional)
+				MaxLifetime: 0s
+
+				# Maximum number of open connections for the listener. When a new connection
+				# exceeds the maximum, the least recently active connection is closed with a BYE.
+				# Limits on the number of connections per IP/network still apply. Default 0, no
+				# maximum. (optional)
+				MaxConnections: 0
+
+				# Maximum number of open IMAP connections from a single remote IP address, across
+				# all listeners. New connections exceeding the maximum are refused with a BYE
+				# response with ALERT code. Default 0, for no limit other than the built-in
+				# connection limits per IP/network. (optional)
+				MaxConnectionsPerIP: 0
+
+				# Maximum number of open authenticated IMAP connections for an account, across all
+				# listeners. Authentication on a new connection exceeding the maximum fails with a
+				# NO response with ALERT code. Can be overridden per account with
+				# MaxIMAPConnections. Default 0, for no limit. (optional)
+				MaxConnectionsPerAccount: 0
+
+			# ManageSieve (RFC 5804) for managing sieve scripts that filter incoming messages,
+			# with sieve editors and email applications. Only one script can be active. Starts
+			# out in plain text, clients must upgrade to TLS with the STARTTLS command before
+			# authenticating. Requires a TLS config, unless NoRequireSTARTTLS is set.
+			# (optional)
+			ManageSieve:
+				Enabled: false
+
+				# Default 4190. (optional)
+				Port: 0
+
+				# Allow authentication without STARTTLS. Enable this only when the connection is
+				# otherwise encrypted (e.g. through a VPN). (optional)
+				NoRequireSTARTTLS: false
+
 			# Account web interface, for email users wanting to change their accounts, e.g.
 			# set new password, set new delivery rulesets. Default path is /. (optional)
 			AccountHTTP:
@@ -453,6 +718,65 @@ See https://pkg.go.dev/github.com/mjl-/sconf for details.
 				# limiting and for the "secure" status of cookies. (optional)
 				Forwarded: false
 
+			# Like JMAPHTTPS, but with plain HTTP, without TLS. (optional)
+			JMAPHTTP:
+				Enabled: false
+
+				# Default 80 for HTTP and 443 for HTTPS. See Hostname at Listener for hostname
+				# matching behaviour. (optional)
+				Port: 0
+
+				# Path to serve requests on. (optional)
+				Path:
+
+				# If set, X-Forwarded-* headers are used for the remote IP address for rate
+				# limiting and for the "secure" status of cookies. (optional)
+				Forwarded: false
+
+			# JMAP (RFC 8620/8621), an HTTP/JSON-based protocol for synchronizing email with
+			# email applications, as alternative to IMAP, with HTTPS (requires a TLS config).
+			# Mailboxes and messages can be listed, fetched, flagged, moved and removed,
+			# changes are pushed to clients with an event source. Sending messages and
+			# creating mailboxes are not supported. Clients log in with HTTP basic
+			# authentication. The session resource is at path "session", and at
+			# /.well-known/jmap through a redirect. Default path is /jmap/. (optional)
+			JMAPHTTPS:
+				Enabled: false
+
+				# Default 80 for HTTP and 443 for HTTPS. See Hostname at Listener for hostname
+				# matching behaviour. (optional)
+				Port: 0
+
+				# Path to serve requests on. (optional)
+				Path:
+
+				# If set, X-Forwarded-* headers are used for the remote IP address for rate
+				# limiting and for the "secure" status of cookies. (optional)
+				Forwarded: false
+
+			# One-click unsubscribe links, for List-Unsubscribe headers added to messages
+			# forwarded to remote alias members (if enabled for the alias), and to messages
+			# sent through the webapi (if requested). Links are signed, no login is needed. A
+			# POST request with body "List-Unsubscribe=One-Click" unsubscribes directly, a GET
+			# request shows a confirmation page. Requests are rate limited per IP.
+			# Unsubscribing from an alias removes the address as member, unsubscribing from a
+			# webapi message adds the address to the suppression list of the sending account.
+			# Links use the hostname of the first listener (by name) that has this enabled.
+			# Requires a TLS config. Default path is /unsubscribe/. (optional)
+			UnsubscribeHTTPS:
+				Enabled: false
+
+				# Default 80 for HTTP and 443 for HTTPS. See Hostname at Listener for hostname
+				# matching behaviour. (optional)
+				Port: 0
+
+				# Path to serve requests on. (optional)
+				Path:
+
+				# If set, X-Forwarded-* headers are used for the remote IP address for rate
+				# limiting and for the "secure" status of cookies. (optional)
+				Forwarded: false
+
 			# Serve prometheus metrics, for monitoring. You should not enable this on a public
 			# IP. (optional)
 			MetricsHTTP:
@@ -499,6 +823,22 @@ See https://pkg.go.dev/github.com/mjl-/sconf for details.
 				# useful when the mta-sts domain is reverse proxied. (optional)
 				NonTLS: false
 
+			# Serve OpenPGP keys published by accounts through the Web Key Directory (WKD),
+			# for domains with WKD configured. Keys are served at openpgpkey.<domain> and at
+			# <domain> itself. Requires a TLS config. (optional)
+			WKDHTTPS:
+				Enabled: false
+
+				# TLS port, 443 by default. You should only override this if you cannot listen on
+				# port 443 directly. WKD requests will be made to port 443, so you'll have to add
+				# an external mechanism to get the connection here, e.g. by configuring port
+				# forwarding. (optional)
+				Port: 0
+
+				# If set, plain HTTP instead of HTTPS is spoken on the configured port. Can be
+				# useful when the openpgpkey domain is reverse proxied. (optional)
+				NonTLS: false
+
 			# All configured WebHandlers will serve on an enabled listener. (optional)
 			WebserverHTTP:
 				Enabled: false
@@ -575,6 +915,182 @@ See https://pkg.go.dev/github.com/mjl-/sconf for details.
 	DefaultMailboxes:
 		-
 
+	# Templates for new accounts, e.g. for different plans offered by a provider. A
+	# template can be selected when adding an account. Keys are template names.
+	# (optional)
+	AccountTemplates:
+		x:
+
+			# Free-form description of the template, e.g. the plan. (optional)
+			Description:
+
+			# Mailboxes to create for new accounts, instead of the global InitialMailboxes.
+			# Inbox is always created. (optional)
+			InitialMailboxes:
+
+				# Special-use roles to mailbox to create. (optional)
+				SpecialUse:
+
+					# (optional)
+					Sent:
+
+					# (optional)
+					Archive:
+
+					# (optional)
+					Trash:
+
+					# (optional)
+					Draft:
+
+					# (optional)
+					Junk:
+
+				# Regular, non-special-use mailboxes to create. (optional)
+				Regular:
+					-
+
+			# Junk filter settings for new accounts, instead of the default junk filter
+			# settings. (optional)
+			JunkFilter:
+
+				# Approximate spaminess score between 0 and 1 above which emails are rejected as
+				# spam. Each delivery attempt adds a little noise to make it slightly harder for
+				# spammers to identify words that strongly indicate non-spaminess and use it to
+				# bypass the filter. E.g. 0.95.
+				Threshold: 0.000000
+				Params:
+
+					# Track ham/spam ranking for single words. (optional)
+					Onegrams: false
+
+					# Track ham/spam ranking for each two consecutive words. (optional)
+					Twograms: false
+
+					# Track ham/spam ranking for each three consecutive words. (optional)
+					Threegrams: false
+
+					# Maximum power a word (combination) can have. If spaminess is 0.99, and max power
+					# is 0.1, spaminess of the word will be set to 0.9. Similar for ham words.
+					MaxPower: 0.000000
+
+					# Number of most spammy/hammy words to use for calculating probability. E.g. 10.
+					TopWords: 0
+
+					# Ignore words that are this much away from 0.5 haminess/spaminess. E.g. 0.1,
+					# causing word (combinations) of 0.4 to 0.6 to be ignored. (optional)
+					IgnoreWords: 0.000000
+
+					# Occurrences in word database until a word is considered rare and its influence
+					# in calculating probability reduced. E.g. 1 or 2. (optional)
+					RareWords: 0
+
+			# Rulesets for the initial address of new accounts, e.g. for delivering messages
+			# from mailing lists to a separate mailbox. (optional)
+			Rulesets:
+				-
+
+					# Matches if this regular expression matches (a substring of) the SMTP MAIL FROM
+					# address (not the message From-header). E.g. '^user@example\.org$'. (optional)
+					SMTPMailFromRegexp:
+
+					# Matches if this regular expression matches (a substring of) the single address
+					# in the message From header. (optional)
+					MsgFromRegexp:
+
+					# Matches if this regular expression matches (a substring of) one of the addresses
+					# in the message To and Cc headers. (optional)
+					MsgToRegexp:
+
+					# Matches if this domain matches an SPF- and/or DKIM-verified (sub)domain.
+					# (optional)
+					VerifiedDomain:
+
+					# Matches if these header field/value regular expressions all match (substrings
+					# of) the message headers. Header fields and valuees are converted to lower case
+					# before matching. Whitespace is trimmed from the value before matching. A header
+					# field can occur multiple times in a message, only one instance has to match. For
+					# mailing lists, you could match on ^list-id$ with the value typically the mailing
+					# list address in angled brackets with @ replaced with a dot, e.g.
+					# <name\.lists\.example\.org>. (optional)
+					HeadersRegexp:
+						x:
+
+					# Influences spam filtering only, this option does not change whether a message
+					# matches this ruleset. Can only be used together with SMTPMailFromRegexp and
+					# VerifiedDomain. SMTPMailFromRegexp must be set to the address used to deliver
+					# the forwarded message, e.g. '^user(|\+.*)@forward\.example$'. Changes to junk
+					# analysis: 1. Messages are not rejected for failing a DMARC policy, because a
+					# legitimate forwarded message without valid/intact/aligned DKIM signature would
+					# be rejected because any verified SPF domain will be 'unaligned', of the
+					# forwarding mail server. 2. The sending mail server IP address, and sending EHLO
+					# and MAIL FROM domains and matching DKIM domain aren't used in future
+					# reputation-based spam classifications (but other verified DKIM domains are)
+					# because the forwarding server is not a useful spam signal for future messages.
+					# (optional)
+					IsForward: false
+
+					# Influences spam filtering only, this option does not change whether a message
+					# matches this ruleset. If this domain matches an SPF- and/or DKIM-verified
+					# (sub)domain, the message is accepted without further spam checks, such as a junk
+					# filter or DMARC reject evaluation. DMARC rejects should not apply for mailing
+					# lists that are not configured to rewrite the From-header of messages that don't
+					# have a passing DKIM signature of the From-domain. Otherwise, by rejecting
+					# messages, you may be automatically unsubscribed from the mailing list. The
+					# assumption is that mailing lists do their own spam filtering/moderation.
+					# (optional)
+					ListAllowDomain:
+
+					# Influences spam filtering only, this option does not change whether a message
+					# matches this ruleset. If a message is classified as spam, it isn't rejected
+					# during the SMTP transaction (the normal behaviour), but accepted during the SMTP
+					# transaction and delivered to the specified mailbox. The specified mailbox is not
+					# automatically cleaned up like the account global Rejects mailbox, unless set to
+					# that Rejects mailbox. (optional)
+					AcceptRejectsToMailbox:
+
+					# Mailbox to deliver to if this ruleset matches. Required unless Discard is set.
+					# (optional)
+					Mailbox:
+
+					# Mark the delivered message as read. (optional)
+					Seen: false
+
+					# Keywords to add to the delivered message, e.g. to label newsletters. Must be
+					# lower case, without spaces. (optional)
+					Keywords:
+						-
+
+					# Addresses to forward the message to, in addition to delivering it to Mailbox,
+					# unless Discard is set. The message is forwarded like messages for destinations
+					# with Forward configured: the SMTP MAIL FROM address is rewritten with the sender
+					# rewriting scheme (SRS) to an address at the domain of the recipient, so SPF
+					# verification at the next hop passes and delivery failures are reported to the
+					# original sender. Forwarded messages are ARC-sealed and DKIM-signed with the
+					# domain of the recipient. Messages that were already delivered to the recipient
+					# address are not forwarded again, preventing loops. Only for messages delivered
+					# over SMTP, not for messages classified as junk. (optional)
+					ForwardTo:
+						-
+
+					# Accept the message, but do not store it, e.g. for messages that are only
+					# forwarded. Mailbox must not be set. (optional)
+					Discard: false
+
+					# Free-form comments. (optional)
+					Comment:
+
+			# Maximum total message size in bytes for new accounts. (optional)
+			QuotaMessageSize: 0
+
+			# Maximum number of outgoing messages in a 24 hour window for new accounts.
+			# (optional)
+			MaxOutgoingMessagesPerDay: 0
+
+			# Maximum number of first-time recipients in outgoing messages in a 24 hour window
+			# for new accounts. (optional)
+			MaxFirstTimeRecipientsPerDay: 0
+
 	# Transport are mechanisms for delivering messages. Transports can be referenced
 	# from Routes in accounts, domains and the global configuration. There is always
 	# an implicit/fallback delivery transport doing direct delivery with SMTP from the
@@ -717,6 +1233,13 @@ See https://pkg.go.dev/github.com/mjl-/sconf for details.
 				# remote SMTP servers. (optional)
 				DisableIPv6: false
 
+	# Period to keep events in the lifecycle of messages in the event database, e.g.
+	# incoming messages received, junk verdicts, deliveries to mailboxes, and outgoing
+	# messages queued, delivery attempts and bounces. Used for tracing messages, the
+	# delivery status of outgoing messages, and statistics. Default 720h (30 days).
+	# (optional)
+	KeepEventsPeriod: 0s
+
 	# Do not send DMARC reports (aggregate only). By default, aggregate reports on
 	# DMARC evaluations are sent to domains if their DMARC policy requests them.
 	# Reports are sent at whole hours, with a minimum of 1 hour and maximum of 24
@@ -748,6 +1271,159 @@ See https://pkg.go.dev/github.com/mjl-/sconf for details.
 	# (optional)
 	QuotaMessageSize: 0
 
+	# Requirements for new passwords of accounts and domain admins, enforced when
+	# passwords are set through the account and admin web interfaces and the
+	# command-line. Generated passwords are not checked. (optional)
+	PasswordPolicy:
+
+		# Minimum length of passwords in bytes, after normalization. Default and minimum
+		# 8. (optional)
+		MinLength: 0
+
+		# Minimum estimated entropy of passwords in bits, if greater than zero. The
+		# estimate is based on the classes of characters used (lower case, upper case,
+		# digits, symbols and other) and the length, with characters that were already
+		# used contributing 1 bit. For example, a random 8-character password with
+		# distinct lower case letters and digits is estimated at 41 bits. Recommended
+		# value: 40. (optional)
+		MinEntropy: 0
+
+		# Bloom filter file with breached passwords, refused as new passwords. If a
+		# relative path, it is relative to the directory of mox.conf. The filter contains
+		# SHA-1 hashes of passwords in upper case hexadecimal, as in the Have I Been Pwned
+		# (HIBP) password lists. Passwords not in the filter are always allowed, but some
+		# passwords not in the original list are refused due to false positives. Create
+		# the file with 'mox passwordfilter make'. The file is read into memory at
+		# startup. (optional)
+		BreachedFile:
+
+		# Number of bits in the bloom filter for each password, must be the same as when
+		# the filter was created. Default 7. (optional)
+		BreachedFileK: 0
+
+	# Automatically hold outgoing messages of accounts that appear to be compromised,
+	# for review by the admin. When a message submitted by an account trips one of the
+	# heuristics, a hold rule for the account is added to the queue, causing its
+	# queued and newly submitted messages to be held, and a notification is delivered
+	# to the postmaster mailbox. The held messages can be released or dropped on the
+	# queue page of the admin web interface. (optional)
+	OutgoingHold:
+
+		# Hold if the account submitted more than this many messages in the past hour,
+		# e.g. a sudden spike in volume. Each recipient counts as a message. Should be
+		# well below MaxOutgoingMessagesPerDay of the accounts. (optional)
+		MessagesPerHour: 0
+
+		# Hold if the messages submitted in the past hour have more than this many
+		# first-time recipients, i.e. addresses the account has not sent to before.
+		# (optional)
+		FirstTimeRecipientsPerHour: 0
+
+		# Hold if a message is submitted over a connection from a network the account did
+		# not log in from successfully before the past 24 hours, while it did log in from
+		# other networks in the past 30 days. Networks are /16 for IPv4 and /48 for IPv6.
+		# Mox has no database with countries of IP addresses, logins from new networks are
+		# an approximation of logins from new countries. (optional)
+		NewNetworkLogin: false
+
+	# Limits for login sessions of accounts in the webmail and account web interfaces.
+	# Sessions of the admin web interface are not affected. (optional)
+	WebSessions:
+
+		# Sessions that are not used for this long expire. Default 24h. (optional)
+		IdleTimeout: 0s
+
+		# Sessions expire this long after login, regardless of use, requiring the user to
+		# login again. Default 0, no maximum. (optional)
+		MaxLifetime: 0s
+
+		# Maximum number of sessions per account. When a new session exceeds the maximum,
+		# the least recently used session is removed. Default 100. (optional)
+		MaxPerAccount: 0
+
+	# If configured, IMAP and SMTP submission accept authentication with OAuth 2.0
+	# bearer tokens through SASL mechanisms OAUTHBEARER and XOAUTH2, for organizations
+	# that use single sign-on with an OpenID Connect provider, so users don't need a
+	# password per application. Tokens must be JWTs signed by the issuer, for the
+	# audience, with the required scopes, and not expired. The email address in the
+	# token must be an address of an account. Bearer tokens are only accepted over
+	# TLS. (optional)
+	OAuth:
+
+		# URL of the OpenID Connect issuer, e.g. https://sso.example.org/realms/example.
+		# Must match the "iss" claim of tokens exactly. The keys of the issuer are found
+		# through its discovery document at <issuer>/.well-known/openid-configuration,
+		# unless JWKSURL is set. Must be an https URL.
+		Issuer:
+
+		# URL of the JSON Web Key Set (JWKS) with the signing keys of the issuer, to use
+		# instead of the URL from the discovery document. Must be an https URL. (optional)
+		JWKSURL:
+
+		# Value that must be present in the "aud" claim of tokens, typically the client ID
+		# of the mail clients as registered at the issuer.
+		Audience:
+
+		# Scopes that tokens must have, in the "scope" claim (or "scp"). (optional)
+		Scopes:
+			-
+
+		# Claim in the token with the email address to authenticate as. Default "email".
+		# (optional)
+		UsernameClaim:
+
+	# If configured, message files of new messages are stored gzip-compressed, saving
+	# disk space. Compressed messages are decompressed transparently when accessed,
+	# the message size as seen by IMAP clients does not change. Can be overridden per
+	# account. Existing messages are compressed with "mox compressmsgs". (optional)
+	MessageCompression:
+
+		# Don't compress messages, e.g. for an account when compression is configured
+		# globally. Already compressed messages stay compressed. (optional)
+		Disabled: false
+
+		# Messages smaller than this size in bytes are stored uncompressed, compressing
+		# them would not save disk blocks. Default 4096. (optional)
+		MinMessageSize: 0
+
+		# Messages larger than this size in bytes are stored uncompressed. Compressed
+		# messages are decompressed in memory when accessed. Default 1MB. (optional)
+		MaxMessageSize: 0
+
+	# Store message files with identical data only once, shared between mailboxes and
+	# accounts, saving disk space for messages delivered to many recipients, e.g. from
+	# mailing lists. New messages are hardlinked to a file named after the SHA-256
+	# hash of the data in the msgstore directory in the data directory. Files in
+	# msgstore no longer used by any message are removed daily. Does not apply to
+	# compressed or encrypted messages. Only effective if the file system supports
+	# hardlinks. (optional)
+	DeduplicateMessages: false
+
+	# File containing the master key for accounts with MessageEncryption with KeyWrap
+	# "masterkey", as base64-encoded 32 bytes. The master key protects the message
+	# keys of the accounts, stored in the account databases. Keep the file outside the
+	# data directory, so a copy of the data directory alone does not expose message
+	# contents. Create a key with "mox messageencryption genkey". The master key
+	# cannot be changed while accounts have message keys wrapped with it. If a
+	# relative path, it is relative to the directory of mox.conf. (optional)
+	MessageEncryptionKeyFile:
+
+	# If configured, sieve scripts of accounts can send notifications with the http,
+	# https, ntfy and gotify methods, to the configured hosts. Sieve scripts are
+	# managed by account users, so by default only mailto notifications are sent.
+	# (optional)
+	SieveNotifyHTTP:
+
+		# Host names that notifications can be sent to, e.g. ntfy.sh. A leading "*."
+		# matches subdomains. A single "*" allows all hosts.
+		Hosts:
+			-
+
+		# Allow connections to loopback, private, link-local and unspecified IPs, e.g. for
+		# a notification service on the local network. By default, such connections are
+		# refused, also when a host name resolves to such an IP. (optional)
+		AllowPrivateIPs: false
+
 # domains.conf
 
 	# NOTE: This config file is in 'sconf' format. Indent with tabs. Comments must be
@@ -832,6 +1508,14 @@ See https://pkg.go.dev/github.com/mjl-/sconf for details.
 						# Either an RSA or ed25519 private key file in PKCS8 PEM form.
 						PrivateKeyFile:
 
+						# Set when the key is scheduled for removal, e.g. during key rotation. A retiring
+						# selector is not used for signing new messages, even if listed in Sign. Messages
+						# in the queue with a DKIM signature by a retiring selector are signed again with
+						# the current signing selectors before their next delivery attempt, so they still
+						# have a valid signature after the DNS record for the retiring selector has been
+						# removed. (optional)
+						Retiring: false
+
 				# List of selectors that emails will be signed with. (optional)
 				Sign:
 					-
@@ -868,6 +1552,14 @@ See https://pkg.go.dev/github.com/mjl-/sconf for details.
 				# Mailbox to deliver to, e.g. DMARC.
 				Mailbox:
 
+				# Policy for the suggested DMARC DNS record: "none", "quarantine" or "reject"
+				# (default). With "auto", the policy recommended by the DMARC policy advisor is
+				# suggested, based on incoming DMARC aggregate reports: first "none", then
+				# "quarantine" after all sources have sent aligned messages for 30 days, then
+				# "reject" after another 30 days. The DNS record itself must still be updated.
+				# (optional)
+				Policy:
+
 			# MTA-STS is a mechanism that allows publishing a policy with requirements for
 			# WebPKI-verified SMTP STARTTLS connections for email delivered to a domain.
 			# Existence of a policy is announced in a DNS TXT record (often
@@ -909,6 +1601,79 @@ See https://pkg.go.dev/github.com/mjl-/sconf for details.
 				MX:
 					-
 
+				# If non-zero, MaxAge is automatically increased in stages, from 1 day to 1 week
+				# to 4 weeks. A next stage is only taken after this many days since the previous
+				# policy change (as parsed from a PolicyID in the form YYYYMMDDTHHMMSS), with the
+				# MTA-STS DNS record having the current PolicyID, and with incoming TLS reports
+				# covering each of those days and without reported failures. At each stage, the
+				# PolicyID is updated, and the operator should update the DNS record with the new
+				# policy ID. (optional)
+				MaxAgeRampDays: 0
+
+			# Serve OpenPGP public keys that accounts publish for their addresses in this
+			# domain through the Web Key Directory (WKD), so mail clients of correspondents
+			# can automatically discover the keys for encrypting messages. Keys are requested
+			# from openpgpkey.<domain> ("advanced method", requires a DNS record for the name
+			# pointing to this server), or from <domain> itself ("direct method"). Requires a
+			# listener with WKDHTTPS enabled. (optional)
+			WKD:
+
+				# Accounts that may publish OpenPGP keys for their addresses in this domain. If
+				# empty, all accounts with addresses in this domain can publish keys. (optional)
+				Accounts:
+					-
+
+			# Files served under /.well-known/ for the domain, for requests to the domain
+			# itself and to the subdomains served by mox (mta-sts, autoconfig, openpgpkey).
+			# Served on listeners with WebserverHTTP(S), MTASTSHTTPS, AutoconfigHTTPS or
+			# WKDHTTPS enabled, before WebHandlers. (optional)
+			WellKnown:
+
+				# Serve /.well-known/security.txt, with contact information for reporting security
+				# vulnerabilities, see RFC 9116. (optional)
+				SecurityTXT:
+
+					# URIs for reporting security vulnerabilities, e.g. mailto:security@example.org,
+					# or an https URL. At least one is required.
+					Contact:
+						-
+
+					# Date and time after which the information should be considered stale, in RFC
+					# 3339 format, e.g. 2026-12-31T23:59:59Z. Recommended to be less than a year in
+					# the future.
+					Expires:
+
+					# URIs of keys to use for encrypting reports, e.g. an https URL to an OpenPGP key.
+					# (optional)
+					Encryption:
+						-
+
+					# URIs of pages acknowledging reporters. (optional)
+					Acknowledgments:
+						-
+
+					# Language tags for preferred languages for reports, e.g. en. (optional)
+					PreferredLanguages:
+						-
+
+					# URIs where the file is located, e.g.
+					# https://example.org/.well-known/security.txt. (optional)
+					Canonical:
+						-
+
+					# URIs of the security policy for reporting vulnerabilities. (optional)
+					Policy:
+						-
+
+					# URIs of security-related job openings. (optional)
+					Hiring:
+						-
+
+				# If set, /.well-known/change-password redirects to this URL, e.g. the account web
+				# interface, so password managers can send users to the page for changing their
+				# password. (optional)
+				ChangePasswordURL:
+
 			# With TLSRPT a domain specifies in DNS where reports about encountered SMTP TLS
 			# behaviour should be sent. Useful for monitoring. Incoming TLS reports are
 			# automatically parsed, validated, added to metrics and stored in the reporting
@@ -936,6 +1701,32 @@ See https://pkg.go.dev/github.com/mjl-/sconf for details.
 				# Mailbox to deliver to, e.g. TLSRPT.
 				Mailbox:
 
+			# Additional mechanisms for the suggested SPF DNS record for the domain. By
+			# default, the suggested record allows the IPs of this mail server and the MX
+			# hosts of the domain, with a softfail for other IPs. If other mail servers also
+			# send email for this domain, e.g. an external email service, they must be added
+			# to the SPF record. (optional)
+			SPF:
+
+				# Domains whose SPF record is included with an "include" mechanism, e.g. of
+				# external email services. Each include counts towards the maximum of 10 DNS
+				# lookups for SPF evaluation. DNS lookups needed for the included SPF records
+				# count as well, so keep the number of includes low. Unicode names. (optional)
+				Includes:
+					-
+
+				# Additional IPv4 and IPv6 addresses or networks in CIDR notation, e.g. 192.0.2.10
+				# or 2001:db8::/32, allowed to send email for the domain, added with "ip4" and
+				# "ip6" mechanisms. (optional)
+				IPs:
+					-
+
+				# Qualifier for the final "all" mechanism, used for IPs that don't match any
+				# earlier mechanism: "~" for softfail (default), "-" for fail, "?" for neutral. A
+				# softfail is suggested by default so messages aren't rejected by older mail
+				# servers before DKIM and DMARC are evaluated. (optional)
+				All:
+
 			# Routes for delivering outgoing messages through the queue. Each delivery attempt
 			# evaluates account routes, these domain routes and finally global routes. The
 			# transport of the first matching route is used in the delivery attempt. If no
@@ -960,17 +1751,43 @@ See https://pkg.go.dev/github.com/mjl-/sconf for details.
 					MinimumAttempts: 0
 					Transport:
 
+					# Transports to fail over to, in order, when a delivery attempt with Transport, or
+					# the previous transport in this list, fails with an error in one of the classes
+					# of FailoverErrors. The attempt with the next transport is made immediately,
+					# instead of after the regular backoff, and a permanent error does not cause a DSN
+					# to be sent. For failing over from direct delivery, configure Transport as a
+					# transport with Direct set. If delivery with the last transport fails, the
+					# failure is handled as usual and the next attempt starts again at Transport.
+					# (optional)
+					Failover:
+						-
+
+					# Classes of errors causing failover to the next transport in Failover. Values:
+					# connection (errors before an SMTP response was received, e.g. resolving DNS
+					# names or dialing), tls (failed TLS handshake or verification), temporary (SMTP
+					# response with code 4xx), policy (SMTP response with enhanced status code 4.7.x
+					# or 5.7.x, e.g. due to IP reputation or block lists), permanent (SMTP response
+					# with code 5xx). Default: connection, tls, policy. (optional)
+					FailoverErrors:
+						-
+
 			# Aliases that cause messages to be delivered to one or more locally configured
 			# addresses. Keys are localparts (encoded, as they appear in email addresses).
 			# (optional)
 			Aliases:
 				x:
 
-					# Expanded addresses to deliver to. These must currently be of addresses of local
-					# accounts. To prevent duplicate messages, a member address that is also an
-					# explicit recipient in the SMTP transaction will only have the message delivered
-					# once. If the address in the message From header is a member, that member also
-					# won't receive the message.
+					# Expanded addresses to deliver to. Addresses in domains configured on this server
+					# must be of local accounts, and at least one such address must be present: Its
+					# junk filtering and reputation decide whether a message is accepted. Addresses in
+					# other domains are remote members, a copy of accepted messages is added to the
+					# queue for each, with the postmaster address of the domain of the alias as SMTP
+					# MAIL FROM. Forwarded copies get a Delivered-To header with the alias address,
+					# incoming messages that already have such a header are rejected to prevent loops.
+					# To prevent duplicate messages, a member address that is also an explicit
+					# recipient in the SMTP transaction will only have the message delivered once. If
+					# the address in the message From header is a member, that member also won't
+					# receive the message.
 					Addresses:
 						-
 
@@ -985,6 +1802,57 @@ See https://pkg.go.dev/github.com/mjl-/sconf for details.
 					# message From header. (optional)
 					AllowMsgFrom: false
 
+					# If true, copies of messages forwarded to remote members get List-Unsubscribe and
+					# List-Unsubscribe-Post headers with a one-click unsubscribe link for the member,
+					# removing the member from the alias. Requires a listener with UnsubscribeHTTPS
+					# enabled. (optional)
+					ListUnsubscribe: false
+
+			# Header fields to add to and rewrite in incoming messages for addresses in this
+			# domain before delivery, e.g. to mark messages from outside the organization.
+			# Messages with a verified message From address (with DMARC-like alignment) in a
+			# domain hosted on this server or listed as internal domain are exempt. (optional)
+			InboundHeaders:
+
+				# Text to prepend to the Subject header, e.g. "[EXTERNAL] ". Not added if the
+				# subject already starts with the text. Non-ASCII text is added as MIME
+				# encoded-word. A message without Subject header gets one. The DKIM signatures of
+				# the message, already verified during delivery, typically no longer verify after
+				# the change. (optional)
+				SubjectPrefix:
+
+				# Header fields to add, with the header field name as key, e.g. X-External with
+				# value "Message from outside the organization.". Values with non-ASCII text are
+				# added as MIME encoded-word. (optional)
+				Headers:
+					x:
+
+				# Domains of the organization not hosted on this server whose messages are exempt
+				# too, e.g. for departments with their own mail system. Subdomains are not
+				# included. Unicode names. (optional)
+				InternalDomains:
+					-
+
+			# How to handle incoming messages with a message From or SMTP MAIL FROM address at
+			# a domain that looks like this domain, with a typo or with similar looking
+			# characters, as is common in phishing. Empty for no special handling. With
+			# "junk", a stricter junk filter threshold is used, as with other suspicious
+			# signals, and messages from senders with an existing reputation are still
+			# accepted. With "reject", messages are rejected. See "mox config domain
+			# lookalikes" for the recognized variants of a domain. Hosted domains are never
+			# treated as lookalike. (optional)
+			LookalikeSenders:
+
+			# How to handle a sudden surge of incoming messages with a message From address in
+			# this domain that fail DMARC, as is common in spoofing campaigns. A surge is
+			# detected when the DMARC failures in the past hour are both above a minimum and
+			# well above the hourly average of the day before. Incidents are recorded and
+			# shown with the DMARC reports in the admin web interface, and the postmaster is
+			# notified. Empty to only detect and notify. With "junk", a stricter junk filter
+			# threshold is used for messages from this domain that fail DMARC during an
+			# incident and for a day after. With "ignore", surges are not detected. (optional)
+			SpoofingSurges:
+
 	# Accounts represent mox users, each with a password and email address(es) to
 	# which email can be delivered (possibly at different domains). Each account has
 	# its own on-disk directory holding its messages and index database. An account
@@ -1047,6 +1915,31 @@ See https://pkg.go.dev/github.com/mjl-/sconf for details.
 			# (optional)
 			LoginDisabled:
 
+			# If non-empty, the account is suspended, with this message. Useful for freezing
+			# compromised or delinquent accounts without removing them. Login attempts on all
+			# protocols are rejected with this message, as with LoginDisabled. Existing IMAP
+			# and SMTP submission connections are closed at their next command, e.g. when an
+			# IMAP client ends IDLE. Web sessions are removed when suspending through the
+			# admin interface or command-line. Incoming deliveries for addresses of this
+			# account are rejected with a temporary error, so senders retry later, or with a
+			# permanent error if SuspendedReject is set. Members of aliases that are suspended
+			# are skipped during delivery. (optional)
+			Suspended:
+
+			# If set, incoming deliveries for a suspended account are rejected with a
+			# permanent error instead of a temporary error. (optional)
+			SuspendedReject: false
+
+			# If non-empty, logins for this account on all protocols (IMAP, SMTP submission,
+			# web interfaces, webapi) are only allowed from these IP addresses or networks in
+			# CIDR notation, e.g. 10.0.0.0/8 or 2001:db8::/32. Logins from other networks are
+			# rejected, and stored as login attempt with result "networkdenied". Web sessions
+			# are only usable from these networks. Useful for service accounts that only log
+			# in from a single server. Mox has no database with countries of IP addresses,
+			# logins cannot be restricted by country. (optional)
+			LoginNetworks:
+				-
+
 			# Default domain for account. Deprecated behaviour: If a destination is not a full
 			# address but only a localpart, this domain is added to form a full address.
 			Domain:
@@ -1058,13 +1951,23 @@ See https://pkg.go.dev/github.com/mjl-/sconf for details.
 			# be overridden per destination. (optional)
 			FullName:
 
+			# Name of the template from AccountTemplates in mox.conf the account was added
+			# with. The initial mailboxes of the template are created when the account is
+			# first opened. (optional)
+			Template:
+
 			# Destinations, keys are email addresses (with IDNA domains). All destinations are
 			# allowed for logging in with IMAP/SMTP/webmail. If no destinations are
 			# configured, the account can not login. If the address is of the form '@domain',
 			# i.e. with localpart missing, it serves as a catchall for the domain, matching
-			# all messages that are not explicitly configured. Deprecated behaviour: If the
-			# address is not a full address but a localpart, it is combined with Domain to
-			# form a full address. (optional)
+			# all messages that are not explicitly configured. If the domain of the address is
+			# of the form '*.domain', e.g. 'info@*.example.com' or '@*.example.com', it is a
+			# wildcard destination for all subdomains of the configured domain, e.g. for
+			# info@tag.example.com or anything@tag.example.com. Wildcard destinations are only
+			# used for subdomains that are not configured as domain themselves, with the
+			# localpart wildcard taking precedence over the catchall wildcard. Deprecated
+			# behaviour: If the address is not a full address but a localpart, it is combined
+			# with Domain to form a full address. (optional)
 			Destinations:
 				x:
 
@@ -1086,6 +1989,10 @@ See https://pkg.go.dev/github.com/mjl-/sconf for details.
 							# in the message From header. (optional)
 							MsgFromRegexp:
 
+							# Matches if this regular expression matches (a substring of) one of the addresses
+							# in the message To and Cc headers. (optional)
+							MsgToRegexp:
+
 							# Matches if this domain matches an SPF- and/or DKIM-verified (sub)domain.
 							# (optional)
 							VerifiedDomain:
@@ -1133,9 +2040,34 @@ See https://pkg.go.dev/github.com/mjl-/sconf for details.
 							# that Rejects mailbox. (optional)
 							AcceptRejectsToMailbox:
 
-							# Mailbox to deliver to if this ruleset matches.
+							# Mailbox to deliver to if this ruleset matches. Required unless Discard is set.
+							# (optional)
 							Mailbox:
 
+							# Mark the delivered message as read. (optional)
+							Seen: false
+
+							# Keywords to add to the delivered message, e.g. to label newsletters. Must be
+							# lower case, without spaces. (optional)
+							Keywords:
+								-
+
+							# Addresses to forward the message to, in addition to delivering it to Mailbox,
+							# unless Discard is set. The message is forwarded like messages for destinations
+							# with Forward configured: the SMTP MAIL FROM address is rewritten with the sender
+							# rewriting scheme (SRS) to an address at the domain of the recipient, so SPF
+							# verification at the next hop passes and delivery failures are reported to the
+							# original sender. Forwarded messages are ARC-sealed and DKIM-signed with the
+							# domain of the recipient. Messages that were already delivered to the recipient
+							# address are not forwarded again, preventing loops. Only for messages delivered
+							# over SMTP, not for messages classified as junk. (optional)
+							ForwardTo:
+								-
+
+							# Accept the message, but do not store it, e.g. for messages that are only
+							# forwarded. Mailbox must not be set. (optional)
+							Discard: false
+
 							# Free-form comments. (optional)
 							Comment:
 
@@ -1165,6 +2097,50 @@ See https://pkg.go.dev/github.com/mjl-/sconf for details.
 					# address with webmail. (optional)
 					FullName:
 
+					# If set, the address is treated as if it does not exist: Incoming deliveries are
+					# rejected as for an unknown user, the address cannot be used to log in, and
+					# messages cannot be submitted with the address as message From address. The
+					# configuration of the destination is kept, so the address can be enabled again
+					# later. Disabled addresses that are members of an alias are skipped during
+					# delivery to the alias. (optional)
+					Disabled: false
+
+					# Duplicate detection for this destination, overriding the DuplicateWindow of the
+					# account. (optional)
+					DuplicateWindow:
+
+						# Period during which a message with the same Message-ID is considered a
+						# duplicate, e.g. 30m. Zero disables duplicate detection, e.g. to override the
+						# account setting for a destination.
+						Period: 0s
+
+						# If set, duplicate messages are accepted but not stored. By default, duplicates
+						# are stored with keyword $Duplicate, so they can be filtered by mail clients.
+						# (optional)
+						Suppress: false
+
+					# Forward incoming messages for this address to external addresses. The SMTP MAIL
+					# FROM address is rewritten with the sender rewriting scheme (SRS) to an address
+					# at the domain of this destination, so SPF verification at the next hop passes,
+					# and bounces are sent back to the original sender. Forwarded messages are
+					# ARC-sealed and DKIM-signed with the domain of this destination. Messages that
+					# were already delivered to this address are not forwarded again, preventing
+					# loops. Messages classified as junk are not forwarded. Redirects by sieve scripts
+					# and ForwardTo of rulesets are forwarded the same way. (optional)
+					Forward:
+
+						# Addresses to forward messages to.
+						To:
+							-
+
+						# Also deliver forwarded messages to the mailbox of this destination. (optional)
+						KeepCopy: false
+
+						# Temporarily don't forward messages, delivering them to the mailbox of this
+						# destination instead. The forwarding addresses are kept, so forwarding can be
+						# enabled again later. (optional)
+						Disabled: false
+
 			# If configured, messages classified as weakly spam are rejected with instructions
 			# to retry delivery, but this time with a signed token added to the subject.
 			# During the next delivery attempt, the signed token will bypass the spam filter.
@@ -1182,6 +2158,20 @@ See https://pkg.go.dev/github.com/mjl-/sconf for details.
 			# Useful to prevent a single account from filling storage. (optional)
 			QuotaMessageSize: 0
 
+			# Maximum size in bytes of a message added with IMAP APPEND for this account. The
+			# lower of this limit and the MaxAppendSize of the IMAP listener is announced with
+			# the APPENDLIMIT capability after authentication, and oversized messages are
+			# rejected before their data is read. Default 0, for no account-specific limit.
+			# (optional)
+			MaxAppendSize: 0
+
+			# Maximum number of open authenticated IMAP connections for this account, across
+			# all listeners, overriding MaxConnectionsPerAccount of the IMAP listener limits
+			# if non-zero. Protects against misbehaving clients opening many (IDLE)
+			# connections. A negative value means no limit. Default 0, using the listener
+			# limit. (optional)
+			MaxIMAPConnections: 0
+
 			# Mail that looks like spam will be rejected, but a copy can be stored temporarily
 			# in a mailbox, e.g. Rejects. If mail isn't coming in when you expect, you can
 			# look there. The mail still isn't accepted, so the remote mail server may retry
@@ -1271,6 +2261,150 @@ See https://pkg.go.dev/github.com/mjl-/sconf for details.
 			# responses and want instant replies. (optional)
 			NoFirstTimeSenderDelay: false
 
+			# If configured, an incoming message with the same Message-ID as a message
+			# delivered to the account over SMTP during the configured period is treated as
+			# duplicate, e.g. for copies of a message through both a mailing list and
+			# directly, or from misbehaving forwarders. Can be overridden per destination.
+			# (optional)
+			DuplicateWindow:
+
+				# Period during which a message with the same Message-ID is considered a
+				# duplicate, e.g. 30m. Zero disables duplicate detection, e.g. to override the
+				# account setting for a destination.
+				Period: 0s
+
+				# If set, duplicate messages are accepted but not stored. By default, duplicates
+				# are stored with keyword $Duplicate, so they can be filtered by mail clients.
+				# (optional)
+				Suppress: false
+
+			# If configured, messages older than the configured age are moved daily from the
+			# configured mailboxes into yearly mailboxes under the archive mailbox, e.g.
+			# Archive/2023, keeping frequently used mailboxes small and IMAP clients fast.
+			# Moved messages keep their flags, keywords and threads. Archiving can also be
+			# started with "mox autoarchive". (optional)
+			AutoArchive:
+
+				# Messages received longer ago than this are archived, e.g. 2160h for 90 days.
+				Age: 0s
+
+				# Mailboxes to archive messages from. Default Inbox. Mailboxes under the archive
+				# mailbox are never archived. (optional)
+				Mailboxes:
+					-
+
+				# Mailbox under which the yearly mailboxes are created. Default is the mailbox
+				# with the special-use archive flag, or Archive if there is none. (optional)
+				Mailbox:
+
+				# Don't archive messages without the seen flag. (optional)
+				SkipUnread: false
+
+				# Don't archive messages with the flagged flag. (optional)
+				SkipFlagged: false
+
+			# If configured, the data of messages older than the configured age is moved from
+			# an on-disk file per message into compressed pack files holding many messages,
+			# saving disk space and inodes. Packed messages are decompressed transparently
+			# when accessed. Messages are packed daily, and with "mox archivepack". Pack files
+			# with mostly removed messages are rewritten at the same time. (optional)
+			ArchiveTier:
+
+				# Messages received longer ago than this are packed, e.g. 4320h for 180 days.
+				Age: 0s
+
+				# Messages larger than this size in bytes are kept in their own on-disk file.
+				# Packed messages are decompressed in memory when accessed. Default 1MB.
+				# (optional)
+				MaxMessageSize: 0
+
+			# Compression of message files for this account, overriding the global
+			# MessageCompression configuration. (optional)
+			MessageCompression:
+
+				# Don't compress messages, e.g. for an account when compression is configured
+				# globally. Already compressed messages stay compressed. (optional)
+				Disabled: false
+
+				# Messages smaller than this size in bytes are stored uncompressed, compressing
+				# them would not save disk blocks. Default 4096. (optional)
+				MinMessageSize: 0
+
+				# Messages larger than this size in bytes are stored uncompressed. Compressed
+				# messages are decompressed in memory when accessed. Default 1MB. (optional)
+				MaxMessageSize: 0
+
+			# If configured, message files of new messages are stored encrypted, so a copy of
+			# the disk does not directly expose message contents. Messages are decrypted
+			# transparently when accessed. Encrypted messages are not compressed, and not
+			# moved into pack files of the ArchiveTier. Existing messages are encrypted with
+			# "mox encryptmsgs". Message metadata in the account database, such as subjects,
+			# addresses and the full-text index, is not encrypted. (optional)
+			MessageEncryption:
+
+				# How the message key of the account is protected: "masterkey" (default) encrypts
+				# it with the master key from the global MessageEncryptionKeyFile, messages can
+				# always be read by mox. "password" encrypts it with a key derived from the
+				# account password. The message key is unlocked when the account logs in with its
+				# password, e.g. with IMAP LOGIN or AUTHENTICATE PLAIN or through the web login
+				# form, but not with SCRAM or CRAM-MD5 authentication, or with an existing web
+				# session. It stays unlocked until mox stops. Until unlocked, encrypted messages
+				# cannot be read, also not for IMAP, webmail, exports or junk filter training, but
+				# new messages are delivered encrypted. The message key is created at the first
+				# login with password or when the password is set. Setting a new password requires
+				# the message key to be unlocked, otherwise existing messages could no longer be
+				# read. Changing KeyWrap takes effect at the next login with password. (optional)
+				KeyWrap:
+
+			# Sanity checks for messages submitted by this account, through SMTP submission,
+			# webmail and webapi. Missing Date and Message-ID headers are always added.
+			# (optional)
+			SubmissionChecks:
+
+				# Reject messages without To or Cc header, e.g. with only Bcc recipients.
+				# (optional)
+				RequireTo: false
+
+				# Reject messages without (non-empty) Subject header. (optional)
+				RequireSubject: false
+
+				# Reject messages with more than this number of recipients. Zero means no limit.
+				# (optional)
+				MaxRecipients: 0
+
+				# Messages composed in webmail with more than this number of recipients must be
+				# confirmed before being sent, preventing accidental reply-all storms. Zero means
+				# no confirmation is needed. (optional)
+				ConfirmRecipients: 0
+
+			# TLS client certificates that authenticate as this account on IMAP and SMTP
+			# submission, in addition to those added through the account web interface. For
+			# password-less machine clients. Clients authenticate during the TLS handshake,
+			# and with IMAP and SMTP AUTH mechanism EXTERNAL to complete the login. (optional)
+			TLSClientAuth:
+				-
+
+					# Fingerprint of the public key of the certificate: the raw-url-base64-encoded
+					# SHA-256 hash of the Subject Public Key Info. The certificate does not have to be
+					# signed by a CA, e.g. a self-signed certificate. (optional)
+					Fingerprint:
+
+					# Subject of the certificate, e.g. "CN=backup,O=Example", compared exactly against
+					# the subject in RFC 2253 form, as shown by "openssl x509 -noout -subject -nameopt
+					# rfc2253". Only matches certificates that are signed by one of the
+					# ClientAuthCAFiles of the TLS config of the listener, and are valid for client
+					# authentication. (optional)
+					Subject:
+
+					# Email address of this account to log in as, e.g. used as username in IMAP and as
+					# default From address in SMTP submission.
+					LoginAddress:
+
+					# If set, IMAP connections authenticated with this certificate are not immediately
+					# in authenticated state, for clients that do not understand IMAP PREAUTH and will
+					# attempt AUTHENTICATE EXTERNAL anyway. (optional)
+					NoIMAPPreauth: false
+
 			# If set, this account cannot set a password of their own choice, but can only set
 			# a new randomly generated password, preventing password reuse across services and
 			# use of weak passwords. Custom account passwords can be set by the admin.
@@ -1301,6 +2435,26 @@ See https://pkg.go.dev/github.com/mjl-/sconf for details.
 					MinimumAttempts: 0
 					Transport:
 
+					# Transports to fail over to, in order, when a delivery attempt with Transport, or
+					# the previous transport in this list, fails with an error in one of the classes
+					# of FailoverErrors. The attempt with the next transport is made immediately,
+					# instead of after the regular backoff, and a permanent error does not cause a DSN
+					# to be sent. For failing over from direct delivery, configure Transport as a
+					# transport with Direct set. If delivery with the last transport fails, the
+					# failure is handled as usual and the next attempt starts again at Transport.
+					# (optional)
+					Failover:
+						-
+
+					# Classes of errors causing failover to the next transport in Failover. Values:
+					# connection (errors before an SMTP response was received, e.g. resolving DNS
+					# names or dialing), tls (failed TLS handshake or verification), temporary (SMTP
+					# response with code 4xx), policy (SMTP response with enhanced status code 4.7.x
+					# or 5.7.x, e.g. due to IP reputation or block lists), permanent (SMTP response
+					# with code 5xx). Default: connection, tls, policy. (optional)
+					FailoverErrors:
+						-
+
 	# Redirect all requests from domain (key) to domain (value). Always redirects to
 	# HTTPS. For plain HTTP redirects, use a WebHandler with a WebRedirect. (optional)
 	WebDomainRedirects:
@@ -1462,6 +2616,26 @@ See https://pkg.go.dev/github.com/mjl-/sconf for details.
 			MinimumAttempts: 0
 			Transport:
 
+			# Transports to fail over to, in order, when a delivery attempt with Transport, or
+			# the previous transport in this list, fails with an error in one of the classes
+			# of FailoverErrors. The attempt with the next transport is made immediately,
+			# instead of after the regular backoff, and a permanent error does not cause a DSN
+			# to be sent. For failing over from direct delivery, configure Transport as a
+			# transport with Direct set. If delivery with the last transport fails, the
+			# failure is handled as usual and the next attempt starts again at Transport.
+			# (optional)
+			Failover:
+				-
+
+			# Classes of errors causing failover to the next transport in Failover. Values:
+			# connection (errors before an SMTP response was received, e.g. resolving DNS
+			# names or dialing), tls (failed TLS handshake or verification), temporary (SMTP
+			# response with code 4xx), policy (SMTP response with enhanced status code 4.7.x
+			# or 5.7.x, e.g. due to IP reputation or block lists), permanent (SMTP response
+			# with code 5xx). Default: connection, tls, policy. (optional)
+			FailoverErrors:
+				-
+
 	# DNS blocklists to periodically check with if IPs we send from are present,
 	# without using them for checking incoming deliveries.. Also see DNSBLs in SMTP
 	# listeners in mox.conf, which specifies DNSBLs to use both for incoming
@@ -1470,6 +2644,105 @@ See https://pkg.go.dev/github.com/mjl-/sconf for details.
 	MonitorDNSBLs:
 		-
 
+	# Admins that can only manage specific domains, and the accounts and addresses
+	# within those domains, through the admin web interface. For example for
+	# resellers. Keyed by login name, which is entered along with the password when
+	# logging in. The global admin logs in with an empty login name. (optional)
+	DomainAdmins:
+		x:
+
+			# Domains this admin can manage. Domains do not have to exist yet, the admin can
+			# add them. Accounts can only be managed if all their addresses are in these
+			# domains.
+			Domains:
+				-
+
+			# Bcrypt hash of the password for logging in. Set with "mox config domainadmin
+			# setpassword". Without password hash, the admin cannot log in. (optional)
+			PasswordHash:
+
+	# API tokens for calling the functions of the admin web API without logging in,
+	# for automation such as control panels and provisioning tools. Keyed by token
+	# name. Requests are JSON HTTP POST requests to /admin/api/<function>, with a JSON
+	# object with field "params" holding a list of parameters, and header
+	# "Authorization: Bearer <token>". See /admin/api/ for the documentation of the
+	# functions. Add tokens with "mox config admintoken add". (optional)
+	AdminTokens:
+		x:
+
+			# SHA-256 hash of the token, base64-encoded. The token itself is only shown when
+			# it is added.
+			TokenHash:
+
+			# Names of admin API functions the token can call, e.g. CheckDomain, DomainAdd,
+			# AccountAdd, AddressAdd, QueueList. If empty, all functions can be called, except
+			# those for login sessions. (optional)
+			Functions:
+				-
+
+			# If set, the token has the permissions of this domain admin: it can only call
+			# functions available to domain admins and only manage the domains of the domain
+			# admin. (optional)
+			DomainAdmin:
+
+	# Webhook for events about configuration changes made through the admin interfaces
+	# (web interface, API, command-line), such as domains, accounts or addresses being
+	# added or removed. Useful for keeping external provisioning systems in sync.
+	# Webhooks are delivered through the webhook queue, with retries. (optional)
+	AdminWebhook:
+
+		# URL to POST webhooks to for admin events.
+		URL:
+
+		# If not empty, value of Authorization header to add to HTTP requests. (optional)
+		Authorization:
+
+		# If not empty, HTTP requests have a header X-Mox-Webhook-Signature with value
+		# "sha256=" followed by the hex-encoded HMAC-SHA256 of the request body, with this
+		# secret as key. Receivers can verify the signature to check the payload came from
+		# this server. (optional)
+		Secret:
+
+		# Events to send webhooks for. If absent, all events are sent. Valid values:
+		# domainadded, domainremoved, accountadded, accountremoved, addressadded,
+		# addressremoved, addressmoved, dkimadded, dkimremoved, mtastsramp. DKIM key
+		# rotation consists of adding a new key and removing an old key. Event mtastsramp
+		# is sent when the MTA-STS policy max age of a domain is increased automatically,
+		# and the _mta-sts DNS TXT record must be updated. (optional)
+		Events:
+			-
+
+	# Rules for allowing or denying IMAP clients, based on the software details they
+	# send with the IMAP ID command, such as name and version. Rules are evaluated in
+	# order when a client sends an ID command, and again at login if the ID command
+	# was sent before authenticating. The first matching rule determines whether the
+	# client is allowed. Clients not matching any rule, and clients not sending an ID
+	# command, are allowed. The admin API function IMAPClients lists the details sent
+	# by clients in use. (optional)
+	IMAPClientRules:
+		-
+
+			# ID parameters (keys) with regular expressions (values) that must all match
+			# (substrings of) the values sent by the client for the rule to match. Keys are
+			# compared case-insensitively. Common keys: name, version, vendor, os, os-version.
+			# Parameters not sent by the client are matched as an empty value. Example: key
+			# name with value ^OldMail$ and key version with value ^[0-3]\.
+			ParamsRegexp:
+				x:
+
+			# If non-empty, the rule only matches for these accounts, after authentication.
+			# (optional)
+			Accounts:
+				-
+
+			# Either "allow" or "deny". For denied clients, login fails or, if already
+			# authenticated, the connection is closed after an untagged BYE response.
+			Action:
+
+			# Message included in the response for denied clients, e.g. asking users to
+			# upgrade their email client. If empty, a generic message is used. (optional)
+			Message:
+
 # Examples
 
 Mox includes configuration files to illustrate common setups. You can see these
@@ -368,6 +368,9 @@ func servectlcmd(ctx context.Context, ctl *ctl, cid int64, shutdown func()) {
 		account := ctl.xread()
 		pw := ctl.xread()
 
+		err := mox.CheckPassword(pw)
+		ctl.xcheck(err, "checking password")
+
 		acc, err := store.OpenAccount(log, account, false)
 		ctl.xcheck(err, "open account")
 		defer func() {
@@ -384,6 +387,33 @@ func servectlcmd(ctx context.Context, ctl *ctl, cid int64, shutdown func()) {
 		acc = nil
 		ctl.xwriteok()
 
+	case "setaccountpasswordhash":
+		/* protocol:
+		> "setaccountpasswordhash"
+		> account
+		> password hash
+		< "ok" or error
+		*/
+
+		account := ctl.xread()
+		passwordHash := ctl.xread()
+
+		acc, err := store.OpenAccount(log, account, false)
+		ctl.xcheck(err, "open account")
+		defer func() {
+			if acc != nil {
+				err := acc.Close()
+				log.Check(err, "closing account after setting password hash")
+			}
+		}()
+
+		err = acc.SetPasswordHash(log, passwordHash)
+		ctl.xcheck(err, "setting password hash")
+		err = acc.Close()
+		ctl.xcheck(err, "closing account")
+		acc = nil
+		ctl.xwriteok()
+
 	case "queueholdruleslist":
 		/* protocol:
 		> "queueholdruleslist"
@@ -407,6 +437,9 @@ func servectlcmd(ctx context.Context, ctl *ctl, cid int64, shutdown func()) {
 			if hr.RecipientDomain != zerodom {
 				elems = append(elems, fmt.Sprintf("sender domain %q", hr.RecipientDomain.Name()))
 			}
+			if hr.Reason != "" {
+				elems = append(elems, fmt.Sprintf("reason %q", hr.Reason))
+			}
 			if len(elems) == 0 {
 				fmt.Fprintf(xw, "id %d: all messages\n", hr.ID)
 			} else {
@@ -959,9 +992,85 @@ func servectlcmd(ctx context.Context, ctl *ctl, cid int64, shutdown func()) {
 		}
 		xw.xclose()
 
-	case "importmaildir", "importmbox":
-		mbox := cmd == "importmbox"
-		importctl(ctx, ctl, mbox)
+	case "importmaildir", "importmbox", "importmboxo", "importmboxrd", "importmboxcl", "importmboxcl2", "importpst", "importdbox", "importmh", "importbabyl":
+		importctl(ctx, ctl, strings.TrimPrefix(cmd, "import"))
+
+	case "importimap":
+		importimapctl(ctx, ctl)
+
+	case "importjobs":
+		/* protocol:
+		> "importjobs"
+		> account
+		< "ok" or error
+		< stream
+		*/
+		account := ctl.xread()
+		acc, err := store.OpenAccount(log, account, false)
+		ctl.xcheck(err, "open account")
+		defer func() {
+			err := acc.Close()
+			log.Check(err, "closing account")
+		}()
+		jobs, err := acc.ImportJobList(ctx)
+		ctl.xcheck(err, "listing import jobs")
+		ctl.xwriteok()
+		xw := ctl.writer()
+		fmt.Fprintf(xw, "# id, kind, source, mailbox, done/total, imported, skipped, position, started, updated, finished (%d)\n", len(jobs))
+		for _, j := range jobs {
+			finished := "-"
+			if !j.Finished.IsZero() {
+				finished = j.Finished.Format(time.RFC3339)
+			}
+			fmt.Fprintf(xw, "%d\t%s\t%q\t%q\t%d/%d\t%d\t%d\t%q\t%s\t%s\t%s\n", j.ID, j.Kind, j.Source, j.Mailbox, j.Done, j.Total, j.Imported, j.Skipped, j.Position, j.Started.Format(time.RFC3339), j.Updated.Format(time.RFC3339), finished)
+		}
+		xw.xclose()
+
+	case "importjobrm":
+		/* protocol:
+		> "importjobrm"
+		> account
+		> id
+		< "ok" or error
+		*/
+		account := ctl.xread()
+		id, err := strconv.ParseInt(ctl.xread(), 10, 64)
+		ctl.xcheck(err, "parsing id")
+		acc, err := store.OpenAccount(log, account, false)
+		ctl.xcheck(err, "open account")
+		defer func() {
+			err := acc.Close()
+			log.Check(err, "closing account")
+		}()
+		err = acc.ImportJobRemove(ctx, id)
+		ctl.xcheck(err, "removing import job")
+		ctl.xwriteok()
+
+	case "importsources":
+		/* protocol:
+		> "importsources"
+		> account
+		> mailbox (empty for all mailboxes)
+		< "ok" or error
+		< stream
+		*/
+		account := ctl.xread()
+		mailbox := ctl.xread()
+		acc, err := store.OpenAccount(log, account, false)
+		ctl.xcheck(err, "open account")
+		defer func() {
+			err := acc.Close()
+			log.Check(err, "closing account")
+		}()
+		l, err := acc.ImportSourceList(ctx, mailbox)
+		ctl.xcheck(err, "listing import sources")
+		ctl.xwriteok()
+		xw := ctl.writer()
+		fmt.Fprintf(xw, "# mailbox, uid, kind, source, position, imported (%d)\n", len(l))
+		for _, ms := range l {
+			fmt.Fprintf(xw, "%q\t%d\t%s\t%q\t%q\t%s\n", ms.Mailbox, ms.UID, ms.Kind, ms.Source, ms.Position, ms.Imported.Format(time.RFC3339))
+		}
+		xw.xclose()
 
 	case "domainadd":
 		/* protocol:
@@ -1033,14 +1142,57 @@ func servectlcmd(ctx context.Context, ctl *ctl, cid int64, shutdown func()) {
 		> "accountadd"
 		> account
 		> address
+		> template
 		< "ok" or error
 		*/
 		account := ctl.xread()
 		address := ctl.xread()
-		err := admin.AccountAdd(ctx, account, address)
+		template := ctl.xread()
+		err := admin.AccountAdd(ctx, account, address, template)
 		ctl.xcheck(err, "adding account")
 		ctl.xwriteok()
 
+	case "accountsnapshot":
+		/* protocol:
+		> "accountsnapshot"
+		> account
+		< "ok" or error
+		< stream
+		< "ok" or error
+		*/
+		account := ctl.xread()
+		if _, ok := mox.Conf.Account(account); !ok {
+			ctl.xerror("account does not exist")
+		}
+		ctl.xwriteok()
+		w := ctl.writer()
+		err := admin.AccountSnapshot(ctx, account, w)
+		w.xclose()
+		ctl.xcheck(err, "making account snapshot")
+		ctl.xwriteok()
+
+	case "accountrestore":
+		/* protocol:
+		> "accountrestore"
+		> account
+		< "ok" or error
+		> stream
+		< "ok" or error
+		< old account data directory, or empty
+		*/
+		account := ctl.xread()
+		f, err := store.CreateMessageTemp(log, "ctl-accountrestore")
+		ctl.xcheck(err, "creating temporary file")
+		defer store.CloseRemoveTempFile(log, f, "account snapshot")
+		ctl.xwriteok()
+		ctl.xstreamto(f)
+		_, err = f.Seek(0, 0)
+		ctl.xcheck(err, "seek to start of snapshot")
+		oldDir, err := admin.AccountRestore(ctx, account, f)
+		ctl.xcheck(err, "restoring account")
+		ctl.xwriteok()
+		ctl.xwrite(oldDir)
+
 	case "accountrm":
 		/* protocol:
 		> "accountrm"
@@ -1092,6 +1244,50 @@ func servectlcmd(ctx context.Context, ctl *ctl, cid int64, shutdown func()) {
 		ctl.xcheck(err, "enabling account")
 		ctl.xwriteok()
 
+	case "accountsuspend":
+		/* protocol:
+		> "accountsuspend"
+		> account
+		> message
+		> reject ("true" or "false")
+		< "ok" or error
+		*/
+		account := ctl.xread()
+		message := ctl.xread()
+		reject := ctl.xread() == "true"
+
+		acc, err := store.OpenAccount(log, account, false)
+		ctl.xcheck(err, "open account")
+		defer func() {
+			err := acc.Close()
+			log.Check(err, "closing account")
+		}()
+
+		err = admin.AccountSave(ctx, account, func(acc *config.Account) {
+			acc.Suspended = message
+			acc.SuspendedReject = reject
+		})
+		ctl.xcheck(err, "saving account")
+
+		err = acc.SessionsClear(ctx, ctl.log)
+		ctl.xcheck(err, "clearing active web sessions")
+
+		ctl.xwriteok()
+
+	case "accountresume":
+		/* protocol:
+		> "accountresume"
+		> account
+		< "ok" or error
+		*/
+		account := ctl.xread()
+		err := admin.AccountSave(ctx, account, func(acc *config.Account) {
+			acc.Suspended = ""
+			acc.SuspendedReject = false
+		})
+		ctl.xcheck(err, "resuming account")
+		ctl.xwriteok()
+
 	case "tlspubkeylist":
 		/* protocol:
 		> "tlspubkeylist"
@@ -1363,6 +1559,114 @@ func servectlcmd(ctx context.Context, ctl *ctl, cid int64, shutdown func()) {
 		ctl.xcheck(err, "removing addresses to alias")
 		ctl.xwriteok()
 
+	case "domainadminlist":
+		/* protocol:
+		> "domainadminlist"
+		< "ok"
+		< stream
+		*/
+		ctl.xwriteok()
+		xw := ctl.writer()
+		admins := mox.Conf.DomainAdmins()
+		var names []string
+		for name := range admins {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Fprintf(xw, "%s\t%s\n", name, strings.Join(admins[name].Domains, ","))
+		}
+		xw.xclose()
+
+	case "domainadminadd":
+		/* protocol:
+		> "domainadminadd"
+		> name
+		> domains as json
+		< "ok" or error
+		*/
+		name := ctl.xread()
+		line := ctl.xread()
+		var domains []string
+		xparseJSON(ctl, line, &domains)
+		err := admin.DomainAdminAdd(ctx, name, domains)
+		ctl.xcheck(err, "adding domain admin")
+		ctl.xwriteok()
+
+	case "domainadminrm":
+		/* protocol:
+		> "domainadminrm"
+		> name
+		< "ok" or error
+		*/
+		name := ctl.xread()
+		err := admin.DomainAdminRemove(ctx, name)
+		ctl.xcheck(err, "removing domain admin")
+		ctl.xwriteok()
+
+	case "domainadminsetpassword":
+		/* protocol:
+		> "domainadminsetpassword"
+		> name
+		> password
+		< "ok" or error
+		*/
+		name := ctl.xread()
+		pw := ctl.xread()
+		err := admin.DomainAdminSetPassword(ctx, name, pw)
+		ctl.xcheck(err, "setting domain admin password")
+		ctl.xwriteok()
+
+	case "admintokenlist":
+		/* protocol:
+		> "admintokenlist"
+		< "ok"
+		< stream
+		*/
+		ctl.xwriteok()
+		xw := ctl.writer()
+		tokens := mox.Conf.AdminTokens()
+		var names []string
+		for name := range tokens {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			at := tokens[name]
+			fmt.Fprintf(xw, "%s\t%s\t%s\n", name, at.DomainAdmin, strings.Join(at.Functions, ","))
+		}
+		xw.xclose()
+
+	case "admintokenadd":
+		/* protocol:
+		> "admintokenadd"
+		> name
+		> functions as json
+		> domainadmin
+		< "ok" or error
+		< token
+		*/
+		name := ctl.xread()
+		line := ctl.xread()
+		var functions []string
+		xparseJSON(ctl, line, &functions)
+		domainAdmin := ctl.xread()
+		token, err := admin.AdminTokenAdd(ctx, name, functions, domainAdmin)
+		ctl.xcheck(err, "adding admin token")
+		ctl.xwriteok()
+		ctl.xwrite(token)
+
+	case "admintokenrm":
+		/* protocol:
+		> "admintokenrm"
+		> name
+		< "ok" or error
+		*/
+		name := ctl.xread()
+		err := admin.AdminTokenRemove(ctx, name)
+		ctl.xcheck(err, "removing admin token")
+		ctl.xwriteok()
+
 	case "loglevels":
 		/* protocol:
 		> "loglevels"
@@ -1485,6 +1789,41 @@ func servectlcmd(ctx context.Context, ctl *ctl, cid int64, shutdown func()) {
 		}
 		ctl.xwriteok()
 
+	case "mailboxreadonly":
+		/* protocol:
+		> "mailboxreadonly"
+		> account
+		> mailbox
+		> "true" or "false"
+		< "ok" or error
+		*/
+		account := ctl.xread()
+		mailbox := ctl.xread()
+		readonly := ctl.xread() == "true"
+		acc, err := store.OpenAccount(log, account, false)
+		ctl.xcheck(err, "open account")
+		defer func() {
+			if acc != nil {
+				err := acc.Close()
+				log.Check(err, "closing account after changing mailbox read-only")
+			}
+		}()
+
+		acc.WithWLock(func() {
+			err = acc.DB.Write(ctx, func(tx *bstore.Tx) error {
+				mb, err := acc.MailboxFind(tx, mailbox)
+				if err != nil {
+					return fmt.Errorf("looking up mailbox: %v", err)
+				} else if mb == nil {
+					return store.ErrUnknownMailbox
+				}
+				mb.ReadOnly = readonly
+				return tx.Update(mb)
+			})
+		})
+		ctl.xcheck(err, "setting mailbox read-only")
+		ctl.xwriteok()
+
 	case "recalculatemailboxcounts":
 		/* protocol:
 		> "recalculatemailboxcounts"
@@ -1594,6 +1933,12 @@ func servectlcmd(ctx context.Context, ctl *ctl, cid int64, shutdown func()) {
 							lastID = m.ID
 							n++
 
+							// Sizes of packed, compressed and encrypted messages were checked while
+							// packing, compressing or encrypting.
+							if m.PackID != 0 || m.CompressedSize > 0 || m.Encrypted {
+								return nil
+							}
+
 							p := acc.MessagePath(m.ID)
 							st, err := os.Stat(p)
 							if err != nil {
@@ -1822,6 +2167,255 @@ func servectlcmd(ctx context.Context, ctl *ctl, cid int64, shutdown func()) {
 		}
 		w.xclose()
 
+	case "archivepack":
+		/* protocol:
+		> "archivepack"
+		> account or empty
+		< "ok" or error
+		< stream
+		*/
+
+		accountOpt := ctl.xread()
+		ctl.xwriteok()
+		w := ctl.writer()
+
+		xarchivePack := func(accName string) {
+			acc, err := store.OpenAccount(log, accName, false)
+			ctl.xcheck(err, "open account")
+			defer func() {
+				err := acc.Close()
+				log.Check(err, "closing account after archive packing")
+			}()
+
+			stats, err := acc.ArchivePack(ctx, log)
+			ctl.xcheck(err, "archive packing")
+			_, err = fmt.Fprintf(w, "Packed %d message(s) of %d bytes total, wrote %d pack file(s), repacked %d and removed %d pack file(s).\n", stats.Packed, stats.PackedSize, stats.PackFiles, stats.Repacked, stats.PacksRemoved)
+			ctl.xcheck(err, "write")
+		}
+
+		if accountOpt != "" {
+			xarchivePack(accountOpt)
+		} else {
+			for _, accName := range mox.Conf.Accounts() {
+				_, err := fmt.Fprintf(w, "Archive packing account %s...\n", accName)
+				ctl.xcheck(err, "write")
+				xarchivePack(accName)
+			}
+		}
+		w.xclose()
+
+	case "autoarchive":
+		/* protocol:
+		> "autoarchive"
+		> account or empty
+		< "ok" or error
+		< stream
+		*/
+
+		accountOpt := ctl.xread()
+		ctl.xwriteok()
+		w := ctl.writer()
+
+		xautoArchive := func(accName string, skipDisabled bool) {
+			acc, err := store.OpenAccount(log, accName, false)
+			ctl.xcheck(err, "open account")
+			defer func() {
+				err := acc.Close()
+				log.Check(err, "closing account after auto archiving")
+			}()
+
+			stats, err := acc.AutoArchive(ctx, log)
+			if skipDisabled && errors.Is(err, store.ErrAutoArchiveDisabled) {
+				_, err := fmt.Fprintln(w, "Auto archiving not enabled, skipping.")
+				ctl.xcheck(err, "write")
+				return
+			}
+			ctl.xcheck(err, "auto archiving")
+			_, err = fmt.Fprintf(w, "Archived %d message(s).\n", stats.Archived)
+			ctl.xcheck(err, "write")
+		}
+
+		if accountOpt != "" {
+			xautoArchive(accountOpt, false)
+		} else {
+			for _, accName := range mox.Conf.Accounts() {
+				_, err := fmt.Fprintf(w, "Auto archiving account %s...\n", accName)
+				ctl.xcheck(err, "write")
+				xautoArchive(accName, true)
+			}
+		}
+		w.xclose()
+
+	case "compressmsgs":
+		/* protocol:
+		> "compressmsgs"
+		> account or empty
+		< "ok" or error
+		< stream
+		*/
+
+		accountOpt := ctl.xread()
+		ctl.xwriteok()
+		w := ctl.writer()
+
+		xcompressMsgs := func(accName string, skipDisabled bool) {
+			acc, err := store.OpenAccount(log, accName, false)
+			ctl.xcheck(err, "open account")
+			defer func() {
+				err := acc.Close()
+				log.Check(err, "closing account after compressing messages")
+			}()
+
+			stats, err := acc.CompressMessages(ctx, log)
+			if skipDisabled && errors.Is(err, store.ErrCompressionDisabled) {
+				_, err := fmt.Fprintln(w, "Message compression not enabled, skipping.")
+				ctl.xcheck(err, "write")
+				return
+			}
+			ctl.xcheck(err, "compressing messages")
+			_, err = fmt.Fprintf(w, "Compressed %d message(s) from %d to %d bytes total, skipped %d message(s) that did not compress.\n", stats.Compressed, stats.Size, stats.CompressedSize, stats.Skipped)
+			ctl.xcheck(err, "write")
+		}
+
+		if accountOpt != "" {
+			xcompressMsgs(accountOpt, false)
+		} else {
+			for _, accName := range mox.Conf.Accounts() {
+				_, err := fmt.Fprintf(w, "Compressing messages for account %s...\n", accName)
+				ctl.xcheck(err, "write")
+				xcompressMsgs(accName, true)
+			}
+		}
+		w.xclose()
+
+	case "encryptmsgs":
+		/* protocol:
+		> "encryptmsgs"
+		> account or empty
+		< "ok" or error
+		< stream
+		*/
+
+		accountOpt := ctl.xread()
+		ctl.xwriteok()
+		w := ctl.writer()
+
+		xencryptMsgs := func(accName string, skipDisabled bool) {
+			acc, err := store.OpenAccount(log, accName, false)
+			ctl.xcheck(err, "open account")
+			defer func() {
+				err := acc.Close()
+				log.Check(err, "closing account after encrypting messages")
+			}()
+
+			stats, err := acc.EncryptMessages(ctx, log)
+			if skipDisabled && errors.Is(err, store.ErrMessageEncryptionDisabled) {
+				_, err := fmt.Fprintln(w, "Message encryption not enabled, skipping.")
+				ctl.xcheck(err, "write")
+				return
+			}
+			ctl.xcheck(err, "encrypting messages")
+			_, err = fmt.Fprintf(w, "Encrypted %d message(s) with %d bytes total.\n", stats.Encrypted, stats.Size)
+			ctl.xcheck(err, "write")
+		}
+
+		if accountOpt != "" {
+			xencryptMsgs(accountOpt, false)
+		} else {
+			for _, accName := range mox.Conf.Accounts() {
+				_, err := fmt.Fprintf(w, "Encrypting messages for account %s...\n", accName)
+				ctl.xcheck(err, "write")
+				xencryptMsgs(accName, true)
+			}
+		}
+		w.xclose()
+
+	case "textindexrebuild":
+		/* protocol:
+		> "textindexrebuild"
+		> account or empty
+		< "ok" or error
+		< stream
+		*/
+
+		accountOpt := ctl.xread()
+		ctl.xwriteok()
+		w := ctl.writer()
+
+		xrebuild := func(accName string) {
+			acc, err := store.OpenAccount(log, accName, false)
+			ctl.xcheck(err, "open account")
+			defer func() {
+				err := acc.Close()
+				log.Check(err, "closing account after rebuilding text index")
+			}()
+
+			stats, err := acc.TextIndexRebuild(ctx, log)
+			ctl.xcheck(err, "rebuilding text index")
+			_, err = fmt.Fprintf(w, "Indexed %d message(s), skipped %d message(s) that could not be indexed.\n", stats.Indexed, stats.Skipped)
+			ctl.xcheck(err, "write")
+		}
+
+		if accountOpt != "" {
+			xrebuild(accountOpt)
+		} else {
+			for _, accName := range mox.Conf.Accounts() {
+				_, err := fmt.Fprintf(w, "Rebuilding text index for account %s...\n", accName)
+				ctl.xcheck(err, "write")
+				xrebuild(accName)
+			}
+		}
+		w.xclose()
+
+	case "fsck":
+		/* protocol:
+		> "fsck"
+		> account or empty
+		> repair ("true" or "false")
+		< "ok" or error
+		< stream
+		*/
+
+		accountOpt := ctl.xread()
+		repair := ctl.xread() == "true"
+		ctl.xwriteok()
+		w := ctl.writer()
+
+		xfsck := func(accName string) {
+			acc, err := store.OpenAccount(log, accName, false)
+			ctl.xcheck(err, "open account")
+			defer func() {
+				err := acc.Close()
+				log.Check(err, "closing account after fsck")
+			}()
+
+			problems, err := acc.Fsck(ctx, log, repair)
+			ctl.xcheck(err, "checking account")
+			for _, p := range problems {
+				var repaired string
+				if p.Repaired {
+					repaired = " (repaired)"
+				}
+				_, err := fmt.Fprintf(w, "%s: %s%s\n", p.Kind, p.Text, repaired)
+				ctl.xcheck(err, "write")
+			}
+			if len(problems) == 0 {
+				_, err := fmt.Fprintln(w, "No problems found.")
+				ctl.xcheck(err, "write")
+			}
+		}
+
+		if accountOpt != "" {
+			xfsck(accountOpt)
+		} else {
+			for _, accName := range mox.Conf.Accounts() {
+				_, err := fmt.Fprintf(w, "Checking account %s...\n", accName)
+				ctl.xcheck(err, "write")
+				xfsck(accName)
+			}
+		}
+		w.xclose()
+
 	case "backup":
 		backupctl(ctx, ctl)
 
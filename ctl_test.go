@@ -13,12 +13,18 @@ import (
 	"net"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/mjl-/bstore"
+
 	"github.com/mjl-/mox/config"
 	"github.com/mjl-/mox/dmarcdb"
 	"github.com/mjl-/mox/dns"
+	"github.com/mjl-/mox/eventdb"
+	"github.com/mjl-/mox/greylist"
 	"github.com/mjl-/mox/imapclient"
 	"github.com/mjl-/mox/mlog"
 	"github.com/mjl-/mox/mox-"
@@ -89,6 +95,11 @@ func TestCtl(t *testing.T) {
 		ctlcmdSetaccountpassword(ctl, "mjl", "test4321")
 	})
 
+	// "setaccountpasswordhash"
+	testctl(func(ctl *ctl) {
+		ctlcmdSetaccountpasswordhash(ctl, "mjl", "{SHA512-CRYPT}$6$saltstring$svn8UoSVapNtMuq1ukKS4tPQd8iKwSMHWjl/O817G3uBnIFNjnQJuesI68u4OTLiBFdcbYEdFCoEOfaS35inz1")
+	})
+
 	testctl(func(ctl *ctl) {
 		ctlcmdQueueHoldrulesList(ctl)
 	})
@@ -264,12 +275,192 @@ func TestCtl(t *testing.T) {
 
 	// "importmbox"
 	testctl(func(ctl *ctl) {
-		ctlcmdImport(ctl, true, "mjl", "inbox", "testdata/importtest.mbox")
+		ctlcmdImport(ctl, "mbox", "mjl", "inbox", "testdata/importtest.mbox", "", false, false, false)
+	})
+
+	// "importmbox" again with deduplication, all messages are skipped.
+	func() {
+		acc, err := store.OpenAccount(pkglog, "mjl", false)
+		tcheck(t, err, "open account")
+		defer func() {
+			acc.Close()
+			acc.CheckClosed()
+		}()
+		count := func() int {
+			t.Helper()
+			var n int
+			err := acc.DB.Read(ctxbg, func(tx *bstore.Tx) error {
+				mb, err := acc.MailboxFind(tx, "Inbox")
+				if err != nil {
+					return err
+				}
+				n, err = bstore.QueryTx[store.Message](tx).FilterNonzero(store.Message{MailboxID: mb.ID}).FilterEqual("Expunged", false).Count()
+				return err
+			})
+			tcheck(t, err, "count messages")
+			return n
+		}
+		n := count()
+		testctl(func(ctl *ctl) {
+			ctlcmdImport(ctl, "mbox", "mjl", "inbox", "testdata/importtest.mbox", "mailbox", false, false, false)
+		})
+		if nn := count(); nn != n {
+			t.Fatalf("got %d messages after import with deduplication, expected %d", nn, n)
+		}
+	}()
+
+	// "importmbox" as dry run, nothing is changed.
+	testctl(func(ctl *ctl) {
+		ctlcmdImport(ctl, "mbox", "mjl", "DryRun", "testdata/importtest.mbox", "", true, false, false)
+	})
+	func() {
+		acc, err := store.OpenAccount(pkglog, "mjl", false)
+		tcheck(t, err, "open account")
+		defer func() {
+			acc.Close()
+			acc.CheckClosed()
+		}()
+		err = acc.DB.Read(ctxbg, func(tx *bstore.Tx) error {
+			mb, err := acc.MailboxFind(tx, "DryRun")
+			if err == nil && mb != nil {
+				t.Fatalf("mailbox created during dry run")
+			}
+			return err
+		})
+		tcheck(t, err, "looking up mailbox")
+	}()
+
+	// "importmbox" continuing an interrupted import job, skipping the first message.
+	total, err := importCount(pkglog, "mbox", "testdata/importtest.mbox")
+	tcheck(t, err, "counting messages")
+	func() {
+		f, err := os.Open("testdata/importtest.mbox")
+		tcheck(t, err, "open mbox")
+		defer f.Close()
+		mr := store.NewMboxReader(pkglog, store.CreateMessageTemp, "testdata/importtest.mbox", f, store.MboxAuto)
+		_, msgf, position, err := mr.Next()
+		tcheck(t, err, "reading first message")
+		store.CloseRemoveTempFile(pkglog, msgf, "test message")
+
+		acc, err := store.OpenAccount(pkglog, "mjl", false)
+		tcheck(t, err, "open account")
+		defer func() {
+			acc.Close()
+			acc.CheckClosed()
+		}()
+		job := store.ImportJob{Kind: "mbox", Source: "testdata/importtest.mbox", Mailbox: "Resumed", Total: total, Done: 1, Imported: 1, Position: position, Updated: time.Now()}
+		err = acc.DB.Insert(ctxbg, &job)
+		tcheck(t, err, "insert import job")
+	}()
+	testctl(func(ctl *ctl) {
+		ctlcmdImport(ctl, "mbox", "mjl", "Resumed", "testdata/importtest.mbox", "", false, false, false)
+	})
+	func() {
+		acc, err := store.OpenAccount(pkglog, "mjl", false)
+		tcheck(t, err, "open account")
+		defer func() {
+			acc.Close()
+			acc.CheckClosed()
+		}()
+		err = acc.DB.Read(ctxbg, func(tx *bstore.Tx) error {
+			mb, err := acc.MailboxFind(tx, "Resumed")
+			tcheck(t, err, "looking up mailbox")
+			if mb == nil || mb.Total != int64(total-1) {
+				t.Fatalf("got mailbox %v, expected %d messages", mb, total-1)
+			}
+			return nil
+		})
+		tcheck(t, err, "checking mailbox")
+		jobs, err := acc.ImportJobList(ctxbg)
+		tcheck(t, err, "listing import jobs")
+		for _, j := range jobs {
+			if j.Finished.IsZero() || j.Done != total {
+				t.Fatalf("import job not finished or incomplete: %#v", j)
+			}
+		}
+	}()
+
+	// "importjobs"
+	testctl(func(ctl *ctl) {
+		ctlcmdImportJobs(ctl, "mjl")
+	})
+
+	// "importjobrm"
+	testctl(func(ctl *ctl) {
+		ctlcmdImportJobRemove(ctl, "mjl", 1)
 	})
 
 	// "importmaildir"
 	testctl(func(ctl *ctl) {
-		ctlcmdImport(ctl, false, "mjl", "inbox", "testdata/importtest.maildir")
+		ctlcmdImport(ctl, "maildir", "mjl", "inbox", "testdata/importtest.maildir", "", false, true, false)
+	})
+
+	// "importmbox" with junk filter training, messages in Spam without flag from the
+	// source are marked as junk.
+	testctl(func(ctl *ctl) {
+		ctlcmdImport(ctl, "mbox", "mjl", "Spam", "testdata/importtest.mbox", "", false, false, true)
+	})
+	func() {
+		acc, err := store.OpenAccount(pkglog, "mjl", false)
+		tcheck(t, err, "open account")
+		defer func() {
+			acc.Close()
+			acc.CheckClosed()
+		}()
+		err = acc.DB.Read(ctxbg, func(tx *bstore.Tx) error {
+			mb, err := acc.MailboxFind(tx, "Spam")
+			tcheck(t, err, "looking up mailbox")
+			var njunk int
+			q := bstore.QueryTx[store.Message](tx).FilterNonzero(store.Message{MailboxID: mb.ID})
+			err = q.ForEach(func(m store.Message) error {
+				if m.TrainedJunk == nil || *m.TrainedJunk != m.Junk {
+					t.Fatalf("message not trained according to junk flag: %#v", m)
+				}
+				if m.Junk {
+					njunk++
+				}
+				return nil
+			})
+			if err == nil && njunk == 0 {
+				t.Fatalf("no messages marked as junk")
+			}
+			return err
+		})
+		tcheck(t, err, "checking messages")
+	}()
+
+	// "importsources"
+	testctl(func(ctl *ctl) {
+		ctlcmdImportSources(ctl, "mjl", "")
+	})
+	testctl(func(ctl *ctl) {
+		ctlcmdImportSources(ctl, "mjl", "inbox")
+	})
+
+	// "importpst"
+	testctl(func(ctl *ctl) {
+		ctlcmdImport(ctl, "pst", "mjl", "", "testdata/importtest.pst", "", false, false, false)
+	})
+	testctl(func(ctl *ctl) {
+		ctlcmdImport(ctl, "pst", "mjl", "Outlook", "testdata/importtest.pst", "", false, false, false)
+	})
+
+	// "importdbox"
+	testctl(func(ctl *ctl) {
+		ctlcmdImport(ctl, "dbox", "mjl", "", "testdata/importtest.sdbox", "", false, false, false)
+	})
+	testctl(func(ctl *ctl) {
+		ctlcmdImport(ctl, "dbox", "mjl", "Dovecot", "testdata/importtest.mdbox", "", false, false, false)
+	})
+
+	// "importmh"
+	testctl(func(ctl *ctl) {
+		ctlcmdImport(ctl, "mh", "mjl", "inbox", "testdata/importtest.mh", "", false, false, false)
+	})
+
+	// "importbabyl"
+	testctl(func(ctl *ctl) {
+		ctlcmdImport(ctl, "babyl", "mjl", "Rmail", "testdata/importtest.babyl", "", false, false, false)
 	})
 
 	// "domainadd"
@@ -279,7 +470,38 @@ func TestCtl(t *testing.T) {
 
 	// "accountadd"
 	testctl(func(ctl *ctl) {
-		ctlcmdConfigAccountAdd(ctl, "mjl2", "mjl2@mox2.example")
+		ctlcmdConfigAccountAdd(ctl, "mjl2", "mjl2@mox2.example", "")
+	})
+
+	// "accountadd" with template.
+	testctl(func(ctl *ctl) {
+		ctlcmdConfigAccountAdd(ctl, "tpl", "tpl@mox2.example", "small")
+	})
+	func() {
+		accConf, _ := mox.Conf.Account("tpl")
+		if accConf.Template != "small" || accConf.QuotaMessageSize != 1024*1024 {
+			t.Fatalf("account not configured with template, template %q, quota %d", accConf.Template, accConf.QuotaMessageSize)
+		}
+		acc, err := store.OpenAccount(pkglog, "tpl", false)
+		tcheck(t, err, "open account")
+		defer func() {
+			acc.Close()
+			acc.CheckClosed()
+		}()
+		var names []string
+		err = acc.DB.Read(ctxbg, func(tx *bstore.Tx) error {
+			return bstore.QueryTx[store.Mailbox](tx).ForEach(func(mb store.Mailbox) error {
+				names = append(names, mb.Name)
+				return nil
+			})
+		})
+		tcheck(t, err, "list mailboxes")
+		if !slices.Equal(names, []string{"Inbox", "Sent", "Lists"}) {
+			t.Fatalf("got mailboxes %v, expected Inbox, Sent, Lists", names)
+		}
+	}()
+	testctl(func(ctl *ctl) {
+		ctlcmdConfigAccountRemove(ctl, "tpl")
 	})
 
 	// "addressadd"
@@ -301,6 +523,42 @@ func TestCtl(t *testing.T) {
 		ctlcmdConfigAddressRemove(ctl, "mjl3@mox2.example")
 	})
 
+	// "accountsnapshot"
+	snapshotPath := filepath.FromSlash("testdata/ctl/data/tmp/mjl2-snapshot.tgz")
+	testctl(func(ctl *ctl) {
+		ctlcmdConfigAccountSnapshot(ctl, "mjl2", snapshotPath)
+	})
+	countMessages := func(account string) int {
+		t.Helper()
+		acc, err := store.OpenAccount(pkglog, account, false)
+		tcheck(t, err, "open account")
+		defer func() {
+			acc.Close()
+			acc.CheckClosed()
+		}()
+		n, err := bstore.QueryDB[store.Message](ctxbg, acc.DB).FilterEqual("Expunged", false).Count()
+		tcheck(t, err, "count messages")
+		return n
+	}
+	nmsgs := countMessages("mjl2")
+	if nmsgs == 0 {
+		t.Fatalf("no messages in account for snapshot")
+	}
+	restoreSnapshot := func(account string) {
+		t.Helper()
+		f, err := os.Open(snapshotPath)
+		tcheck(t, err, "open snapshot")
+		defer f.Close()
+		testctl(func(ctl *ctl) {
+			ctlcmdConfigAccountRestore(ctl, account, f)
+		})
+	}
+	// "accountrestore" over existing account.
+	restoreSnapshot("mjl2")
+	if n := countMessages("mjl2"); n != nmsgs {
+		t.Fatalf("got %d messages after restore, expected %d", n, nmsgs)
+	}
+
 	// "accountdisabled"
 	testctl(func(ctl *ctl) {
 		ctlcmdConfigAccountDisabled(ctl, "mjl2", "testing")
@@ -309,11 +567,33 @@ func TestCtl(t *testing.T) {
 		ctlcmdConfigAccountDisabled(ctl, "mjl2", "")
 	})
 
+	// "accountsuspend"
+	testctl(func(ctl *ctl) {
+		ctlcmdConfigAccountSuspend(ctl, "mjl2", "testing", true)
+	})
+	// "accountresume"
+	testctl(func(ctl *ctl) {
+		ctlcmdConfigAccountResume(ctl, "mjl2")
+	})
+
 	// "accountrm"
 	testctl(func(ctl *ctl) {
 		ctlcmdConfigAccountRemove(ctl, "mjl2")
 	})
 
+	// "accountrestore" for account that is not configured, adding it with the
+	// configuration from the snapshot.
+	restoreSnapshot("mjl2")
+	if _, ok := mox.Conf.Account("mjl2"); !ok {
+		t.Fatalf("account not added by restore")
+	}
+	if n := countMessages("mjl2"); n != nmsgs {
+		t.Fatalf("got %d messages after restore, expected %d", n, nmsgs)
+	}
+	testctl(func(ctl *ctl) {
+		ctlcmdConfigAccountRemove(ctl, "mjl2")
+	})
+
 	// "domaindisabled"
 	testctl(func(ctl *ctl) {
 		ctlcmdConfigDomainDisabled(ctl, dns.Domain{ASCII: "mox2.example"}, true)
@@ -362,6 +642,41 @@ func TestCtl(t *testing.T) {
 		ctlcmdConfigAliasRemove(ctl, "support@mox.example")
 	})
 
+	// "domainadminadd"
+	testctl(func(ctl *ctl) {
+		ctlcmdConfigDomainadminAdd(ctl, "reseller", []string{"mox.example"})
+	})
+
+	// "domainadminsetpassword"
+	testctl(func(ctl *ctl) {
+		ctlcmdConfigDomainadminSetpassword(ctl, "reseller", "test4321")
+	})
+
+	// "domainadminlist"
+	testctl(func(ctl *ctl) {
+		ctlcmdConfigDomainadminList(ctl)
+	})
+
+	// "admintokenadd"
+	testctl(func(ctl *ctl) {
+		ctlcmdConfigAdmintokenAdd(ctl, "provisioning", []string{"DomainAdd", "AccountAdd"}, "reseller")
+	})
+
+	// "admintokenlist"
+	testctl(func(ctl *ctl) {
+		ctlcmdConfigAdmintokenList(ctl)
+	})
+
+	// "admintokenrm"
+	testctl(func(ctl *ctl) {
+		ctlcmdConfigAdmintokenRemove(ctl, "provisioning")
+	})
+
+	// "domainadminrm"
+	testctl(func(ctl *ctl) {
+		ctlcmdConfigDomainadminRemove(ctl, "reseller")
+	})
+
 	// accounttlspubkeyadd
 	certDER := fakeCert(t)
 	testctl(func(ctl *ctl) {
@@ -413,13 +728,34 @@ func TestCtl(t *testing.T) {
 	})
 
 	// Export data, import it again
-	xcmdExport(true, false, []string{filepath.FromSlash("testdata/ctl/data/tmp/export/mbox/"), filepath.FromSlash("testdata/ctl/data/accounts/mjl")}, &cmd{log: pkglog})
-	xcmdExport(false, false, []string{filepath.FromSlash("testdata/ctl/data/tmp/export/maildir/"), filepath.FromSlash("testdata/ctl/data/accounts/mjl")}, &cmd{log: pkglog})
+	xcmdExport(store.ExportMbox, false, []string{filepath.FromSlash("testdata/ctl/data/tmp/export/mbox/"), filepath.FromSlash("testdata/ctl/data/accounts/mjl")}, store.ExportFilter{}, &cmd{log: pkglog})
+	xcmdExport(store.ExportMaildir, false, []string{filepath.FromSlash("testdata/ctl/data/tmp/export/maildir/"), filepath.FromSlash("testdata/ctl/data/accounts/mjl")}, store.ExportFilter{}, &cmd{log: pkglog})
 	testctl(func(ctl *ctl) {
-		ctlcmdImport(ctl, true, "mjl", "inbox", filepath.FromSlash("testdata/ctl/data/tmp/export/mbox/Inbox.mbox"))
+		ctlcmdImport(ctl, "mbox", "mjl", "inbox", filepath.FromSlash("testdata/ctl/data/tmp/export/mbox/Inbox.mbox"), "", false, false, false)
 	})
 	testctl(func(ctl *ctl) {
-		ctlcmdImport(ctl, false, "mjl", "inbox", filepath.FromSlash("testdata/ctl/data/tmp/export/maildir/Inbox"))
+		ctlcmdImport(ctl, "maildir", "mjl", "inbox", filepath.FromSlash("testdata/ctl/data/tmp/export/maildir/Inbox"), "", false, false, false)
+	})
+
+	// "mailboxreadonly"
+	testctl(func(ctl *ctl) {
+		ctlcmdMailboxReadonly(ctl, "mjl", "Inbox", true)
+	})
+	func() {
+		acc, err := store.OpenAccount(pkglog, "mjl", false)
+		tcheck(t, err, "open account")
+		defer func() {
+			acc.Close()
+			acc.CheckClosed()
+		}()
+		mb, err := bstore.QueryDB[store.Mailbox](ctxbg, acc.DB).FilterNonzero(store.Mailbox{Name: "Inbox"}).Get()
+		tcheck(t, err, "get mailbox")
+		if !mb.ReadOnly {
+			t.Fatalf("mailbox not read-only")
+		}
+	}()
+	testctl(func(ctl *ctl) {
+		ctlcmdMailboxReadonly(ctl, "mjl", "Inbox", false)
 	})
 
 	// "recalculatemailboxcounts"
@@ -494,6 +830,59 @@ func TestCtl(t *testing.T) {
 		ctlcmdReassignthreads(ctl, "")
 	})
 
+	// "encryptmsgs", not enabled for any account.
+	testctl(func(ctl *ctl) {
+		ctlcmdEncryptmsgs(ctl, "")
+	})
+
+	// "textindexrebuild"
+	testctl(func(ctl *ctl) {
+		ctlcmdTextindexrebuild(ctl, "mjl")
+	})
+	testctl(func(ctl *ctl) {
+		ctlcmdTextindexrebuild(ctl, "")
+	})
+
+	// "fsck"
+	testctl(func(ctl *ctl) {
+		ctlcmdFsck(ctl, "mjl", false)
+	})
+	testctl(func(ctl *ctl) {
+		ctlcmdFsck(ctl, "", true)
+	})
+
+	// "compressmsgs", compressing the messages that get smaller, before packing them
+	// below.
+	testctl(func(ctl *ctl) {
+		ctlcmdCompressmsgs(ctl, "")
+	})
+	accConf, _ := mox.Conf.Account("mjl")
+	accConf.MessageCompression = &config.MessageCompression{MinMessageSize: 1}
+	mox.Conf.Dynamic.Accounts["mjl"] = accConf
+	testctl(func(ctl *ctl) {
+		ctlcmdCompressmsgs(ctl, "mjl")
+	})
+
+	// "autoarchive", not enabled for any account.
+	testctl(func(ctl *ctl) {
+		ctlcmdAutoarchive(ctl, "")
+	})
+
+	// "archivepack", with all messages of the account old enough to be packed, so the
+	// backup below includes pack files.
+	accConf, _ = mox.Conf.Account("mjl")
+	accConf.ArchiveTier = &config.ArchiveTier{Age: time.Nanosecond}
+	mox.Conf.Dynamic.Accounts["mjl"] = accConf
+	testctl(func(ctl *ctl) {
+		ctlcmdArchivepack(ctl, "mjl")
+	})
+	testctl(func(ctl *ctl) {
+		ctlcmdArchivepack(ctl, "")
+	})
+	if l, err := os.ReadDir(filepath.FromSlash("testdata/ctl/data/accounts/mjl/pack")); err != nil || len(l) == 0 {
+		t.Fatalf("no pack files after archivepack: %v", err)
+	}
+
 	// "backup", backup account.
 	err = dmarcdb.Init()
 	tcheck(t, err, "dmarcdb init")
@@ -504,11 +893,17 @@ func TestCtl(t *testing.T) {
 	err = tlsrptdb.Init()
 	tcheck(t, err, "tlsrptdb init")
 	defer tlsrptdb.Close()
+	err = eventdb.Init()
+	tcheck(t, err, "eventdb init")
+	defer eventdb.Close()
+	err = greylist.Init()
+	tcheck(t, err, "greylist init")
+	defer greylist.Close()
 	testctl(func(ctl *ctl) {
 		os.RemoveAll("testdata/ctl/data/tmp/backup")
 		err := os.WriteFile("testdata/ctl/data/receivedid.key", make([]byte, 16), 0600)
 		tcheck(t, err, "writing receivedid.key")
-		ctlcmdBackup(ctl, filepath.FromSlash("testdata/ctl/data/tmp/backup"), false)
+		ctlcmdBackup(ctl, filepath.FromSlash("testdata/ctl/data/tmp/backup"), false, false)
 	})
 
 	// Verify the backup.
@@ -518,6 +913,71 @@ func TestCtl(t *testing.T) {
 	}
 	cmdVerifydata(&xcmd)
 
+	// Incremental backups. The second generation links the message and pack files of
+	// the first.
+	os.RemoveAll("testdata/ctl/data/tmp/backuprepo")
+	repoDir := filepath.FromSlash("testdata/ctl/data/tmp/backuprepo")
+	testctl(func(ctl *ctl) {
+		ctlcmdBackup(ctl, repoDir, false, true)
+	})
+	time.Sleep(time.Second) // Generations are named by time, with seconds.
+	testctl(func(ctl *ctl) {
+		ctlcmdBackup(ctl, repoDir, false, true)
+	})
+	gens, err := backupGenerations(repoDir)
+	tcheck(t, err, "listing backup generations")
+	if len(gens) != 2 {
+		t.Fatalf("got %d backup generations, expected 2", len(gens))
+	}
+	var nmsgfiles int
+	for _, gen := range gens {
+		entries, err := readBackupManifest(filepath.Join(repoDir, "generations", gen))
+		tcheck(t, err, "reading manifest")
+		for p, e := range entries {
+			if !strings.HasPrefix(p, "data/accounts/") || !strings.Contains(p, "/msg/") && !strings.Contains(p, "/pack/") {
+				continue
+			}
+			nmsgfiles++
+			fi0, err := os.Stat(filepath.Join(repoDir, "generations", gen, filepath.FromSlash(p)))
+			tcheck(t, err, "stat message file in generation")
+			fi1, err := os.Stat(backupObjectPath(repoDir, e.Hash))
+			tcheck(t, err, "stat object")
+			if !os.SameFile(fi0, fi1) {
+				t.Fatalf("file %s in generation %s is not linked to object", p, gen)
+			}
+		}
+	}
+	if nmsgfiles == 0 {
+		t.Fatalf("no message or pack files in backup generations")
+	}
+	xcmd = cmd{
+		flag:     flag.NewFlagSet("", flag.ExitOnError),
+		flagArgs: []string{filepath.Join(repoDir, "generations", gens[1], "data")},
+	}
+	cmdVerifydata(&xcmd)
+
+	// Pruning removes the first generation, and the objects only it references.
+	entries0, err := readBackupManifest(filepath.Join(repoDir, "generations", gens[0]))
+	tcheck(t, err, "reading manifest")
+	entries1, err := readBackupManifest(filepath.Join(repoDir, "generations", gens[1]))
+	tcheck(t, err, "reading manifest")
+	unreferenced := map[string]bool{}
+	for _, e := range entries0 {
+		unreferenced[e.Hash] = true
+	}
+	for _, e := range entries1 {
+		delete(unreferenced, e.Hash)
+	}
+	removed, nobjects, _, err := backupPrune(repoDir, 1)
+	tcheck(t, err, "pruning backup repository")
+	if len(removed) != 1 || removed[0] != gens[0] || nobjects != len(unreferenced) {
+		t.Fatalf("prune removed generations %v and %d objects, expected %s and %d objects", removed, nobjects, gens[0], len(unreferenced))
+	}
+	for _, e := range entries1 {
+		_, err := os.Stat(backupObjectPath(repoDir, e.Hash))
+		tcheck(t, err, "stat object after prune")
+	}
+
 	// IMAP connection.
 	testctl(func(ctl *ctl) {
 		a, b := net.Pipe()
@@ -0,0 +1,287 @@
+package dbox
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mjl-/mox/mlog"
+	"github.com/mjl-/mox/store"
+)
+
+var pkglog = mlog.New("dbox", nil)
+
+func tcheck(t *testing.T, err error, msg string) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("%s: %s", msg, err)
+	}
+}
+
+var testTime = time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+func testMessage(subject string) string {
+	return "From: <mjl@mox.example>\nTo: <mjl@mox.example>\nSubject: " + subject + "\n\nhello\n"
+}
+
+// testDboxMessage is a message in a dbox file, with its metadata lines.
+type testDboxMessage struct {
+	data     string
+	metadata []string
+}
+
+// dboxFileData returns a dbox file with the messages, like written by dovecot.
+func dboxFileData(msgs ...testDboxMessage) []byte {
+	s := fmt.Sprintf("2 M1e C%x\n", testTime.Unix())
+	for _, m := range msgs {
+		s += fmt.Sprintf("\x01\x02N %08x %016x\n", 0, len(m.data))
+		s += m.data
+		s += magicPost
+		for _, md := range m.metadata {
+			s += md + "\n"
+		}
+		s += "\n"
+	}
+	return []byte(s)
+}
+
+func testGUID(b byte) [16]byte {
+	var guid [16]byte
+	guid[0] = 0xaa
+	guid[15] = b
+	return guid
+}
+
+func guidMetadata(guid [16]byte) string {
+	return "G" + hex.EncodeToString(guid[:])
+}
+
+var receivedMetadata = fmt.Sprintf("R%x", testTime.Unix())
+
+// indexData returns a dovecot.index file with a keywords and guid extension.
+// Records have the guid at offset 8, and the keyword bits at offset 24.
+func indexData(keywords []string, records []indexRecord) []byte {
+	const recSize = 32
+	buf := make([]byte, indexBaseHeaderSize)
+	buf[0] = 7
+	buf[1] = 3
+	binary.LittleEndian.PutUint16(buf[2:], indexBaseHeaderSize)
+	binary.LittleEndian.PutUint32(buf[8:], recSize)
+	buf[12] = indexCompatLittleEndian
+	binary.LittleEndian.PutUint32(buf[32:], uint32(len(records)))
+
+	addExt := func(name string, data []byte, recOffset, extRecSize int) {
+		h := make([]byte, 16)
+		binary.LittleEndian.PutUint32(h, uint32(len(data)))
+		binary.LittleEndian.PutUint16(h[8:], uint16(recOffset))
+		binary.LittleEndian.PutUint16(h[10:], uint16(extRecSize))
+		binary.LittleEndian.PutUint16(h[14:], uint16(len(name)))
+		buf = append(buf, h...)
+		buf = append(buf, name...)
+		buf = append(buf, make([]byte, align8(len(buf))-len(buf))...)
+		buf = append(buf, data...)
+		buf = append(buf, make([]byte, align8(len(buf))-len(buf))...)
+	}
+
+	var kwHdr, names []byte
+	kwHdr = binary.LittleEndian.AppendUint32(kwHdr, uint32(len(keywords)))
+	for _, kw := range keywords {
+		kwHdr = binary.LittleEndian.AppendUint32(kwHdr, 0)
+		kwHdr = binary.LittleEndian.AppendUint32(kwHdr, uint32(len(names)))
+		names = append(append(names, kw...), 0)
+	}
+	addExt("guid", nil, 8, 16)
+	addExt("keywords", append(kwHdr, names...), 24, 4)
+	binary.LittleEndian.PutUint32(buf[4:], uint32(len(buf)))
+
+	for _, r := range records {
+		rec := make([]byte, recSize)
+		binary.LittleEndian.PutUint32(rec, r.uid)
+		rec[4] = r.flags
+		copy(rec[8:], r.guid[:])
+		for _, kw := range r.keywords {
+			i := slices.Index(keywords, kw)
+			rec[24+i/8] |= 1 << (i % 8)
+		}
+		buf = append(buf, rec...)
+	}
+	return buf
+}
+
+var testKeywords = []string{"$Forwarded", "Label1", "$Junk", "NonJunk"}
+
+func writeTestFiles(t *testing.T, dir string, files map[string][]byte) {
+	t.Helper()
+	for name, data := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		err := os.MkdirAll(filepath.Dir(p), 0770)
+		tcheck(t, err, "mkdir")
+		err = os.WriteFile(p, data, 0660)
+		tcheck(t, err, "write file")
+	}
+}
+
+// writeTestSdbox writes an sdbox directory. The directory
+// testdata/importtest.sdbox was written by TestSdbox with environment variable
+// MOX_WRITE_TESTDBOX set.
+func writeTestSdbox(t *testing.T, dir string) {
+	msg := func(subject string) []byte {
+		return dboxFileData(testDboxMessage{testMessage(subject), []string{receivedMetadata}})
+	}
+	writeTestFiles(t, dir, map[string][]byte{
+		"mailboxes/INBOX/dbox-Mails/u.1": msg("first"),
+		"mailboxes/INBOX/dbox-Mails/u.2": msg("second"),
+		// Not yet in index.
+		"mailboxes/INBOX/dbox-Mails/u.10": msg("third"),
+		"mailboxes/INBOX/dbox-Mails/dovecot.index": indexData(testKeywords, []indexRecord{
+			{uid: 1, flags: indexSeen | indexFlagged, keywords: []string{"$Forwarded", "Label1"}},
+			{uid: 2, flags: indexAnswered, keywords: []string{"Label1"}},
+		}),
+		"mailboxes/INBOX/dbox-Mails/dovecot.index.log": {},
+		// Without index.
+		"mailboxes/Archive/2020/dbox-Mails/u.5": msg("archived"),
+		// Mailbox name "Été" in modified UTF-7.
+		"mailboxes/&AMk-t&AOk-/dbox-Mails/u.1": msg("summer"),
+		"mailboxes/&AMk-t&AOk-/dbox-Mails/u.2": []byte("2 M1e C0\nbogus\n"),
+	})
+}
+
+// writeTestMdbox writes an mdbox directory, see writeTestSdbox.
+func writeTestMdbox(t *testing.T, dir string) {
+	msg := func(subject string, metadata ...string) testDboxMessage {
+		return testDboxMessage{testMessage(subject), append([]string{receivedMetadata}, metadata...)}
+	}
+	writeTestFiles(t, dir, map[string][]byte{
+		"storage/m.1": dboxFileData(
+			msg("first", guidMetadata(testGUID(1)), "BINBOX"),
+			// Copied to Archive.
+			msg("copied", guidMetadata(testGUID(2)), "BINBOX"),
+			// Not in an index, in original mailbox.
+			msg("trash", guidMetadata(testGUID(3)), "BTrash"),
+			// Not in an index, skipped.
+			msg("expunged", guidMetadata(testGUID(4))),
+		),
+		"storage/m.2":               dboxFileData(msg("archived", guidMetadata(testGUID(5)), "BArchive")),
+		"storage/dovecot.map.index": {},
+		"mailboxes/INBOX/dbox-Mails/dovecot.index": indexData(testKeywords, []indexRecord{
+			{uid: 1, flags: indexSeen, guid: testGUID(1)},
+			{uid: 2, flags: indexSeen, guid: testGUID(2)},
+		}),
+		"mailboxes/Archive/dbox-Mails/dovecot.index": indexData(testKeywords, []indexRecord{
+			{uid: 1, flags: indexDeleted, keywords: []string{"NonJunk"}, guid: testGUID(5)},
+			{uid: 2, flags: indexFlagged, guid: testGUID(2)},
+		}),
+	})
+}
+
+type testResult struct {
+	mailbox string
+	m       *store.Message
+	data    string
+}
+
+func readAll(t *testing.T, dir string) []testResult {
+	t.Helper()
+	tmpdir := t.TempDir()
+	createTemp := func(log mlog.Log, pattern string) (*os.File, error) {
+		return os.CreateTemp(tmpdir, pattern)
+	}
+	r, err := NewReader(pkglog, createTemp, dir)
+	tcheck(t, err, "new reader")
+	var results []testResult
+	for {
+		m, f, _, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		tcheck(t, err, "next")
+		data, err := os.ReadFile(f.Name())
+		tcheck(t, err, "read message")
+		store.CloseRemoveTempFile(pkglog, f, "test message")
+		if int64(len(data)) != m.Size {
+			t.Fatalf("size %d, file has %d bytes", m.Size, len(data))
+		}
+		results = append(results, testResult{r.Mailbox(), m, string(data)})
+	}
+	return results
+}
+
+func checkResults(t *testing.T, results []testResult, exp []testResult) {
+	t.Helper()
+	if len(results) != len(exp) {
+		t.Fatalf("got %d messages, expected %d", len(results), len(exp))
+	}
+	for i, r := range results {
+		e := exp[i]
+		if r.mailbox != e.mailbox || r.m.Flags != e.m.Flags || !slices.Equal(r.m.Keywords, e.m.Keywords) || !r.m.Received.Equal(testTime) {
+			t.Fatalf("message %d: got mailbox %q, flags %v, keywords %v, received %v, expected mailbox %q, flags %v, keywords %v", i, r.mailbox, r.m.Flags, r.m.Keywords, r.m.Received, e.mailbox, e.m.Flags, e.m.Keywords)
+		}
+		if !strings.Contains(r.data, "Subject: "+e.data+"\r\n") || strings.Contains(strings.ReplaceAll(r.data, "\r\n", ""), "\n") {
+			t.Fatalf("message %d: unexpected data %q, expected subject %q", i, r.data, e.data)
+		}
+	}
+}
+
+func TestSdbox(t *testing.T) {
+	dir := t.TempDir()
+	writeTestSdbox(t, dir)
+	if os.Getenv("MOX_WRITE_TESTDBOX") != "" {
+		p := filepath.FromSlash("../testdata/importtest.sdbox")
+		os.RemoveAll(p)
+		writeTestSdbox(t, p)
+	}
+
+	results := readAll(t, dir)
+	checkResults(t, results, []testResult{
+		{"Été", &store.Message{}, "summer"},
+		{"Archive/2020", &store.Message{}, "archived"},
+		{"Inbox", &store.Message{Flags: store.Flags{Seen: true, Flagged: true, Forwarded: true}, Keywords: []string{"label1"}}, "first"},
+		{"Inbox", &store.Message{Flags: store.Flags{Answered: true}, Keywords: []string{"label1"}}, "second"},
+		{"Inbox", &store.Message{}, "third"},
+	})
+
+	// Not a dbox directory.
+	_, err := NewReader(pkglog, nil, t.TempDir())
+	if !errors.Is(err, ErrFormat) {
+		t.Fatalf("got err %v, expected ErrFormat", err)
+	}
+}
+
+func TestMdbox(t *testing.T) {
+	dir := t.TempDir()
+	writeTestMdbox(t, dir)
+	if os.Getenv("MOX_WRITE_TESTDBOX") != "" {
+		p := filepath.FromSlash("../testdata/importtest.mdbox")
+		os.RemoveAll(p)
+		writeTestMdbox(t, p)
+	}
+
+	results := readAll(t, dir)
+	checkResults(t, results, []testResult{
+		{"Inbox", &store.Message{Flags: store.Flags{Seen: true}}, "first"},
+		{"Archive", &store.Message{Flags: store.Flags{Flagged: true}}, "copied"},
+		{"Inbox", &store.Message{Flags: store.Flags{Seen: true}}, "copied"},
+		{"Trash", &store.Message{}, "trash"},
+		{"Archive", &store.Message{Flags: store.Flags{Deleted: true, Notjunk: true}}, "archived"},
+	})
+}
+
+func TestIndexCorrupt(t *testing.T) {
+	buf := indexData(testKeywords, []indexRecord{{uid: 1}})
+	p := filepath.Join(t.TempDir(), "dovecot.index")
+	for _, n := range []int{10, indexBaseHeaderSize + 10, len(buf) - 1} {
+		err := os.WriteFile(p, buf[:n], 0660)
+		tcheck(t, err, "write index")
+		if _, err := readIndex(p); !errors.Is(err, errCorrupt) {
+			t.Fatalf("truncated index at %d bytes: got err %v, expected errCorrupt", n, err)
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package dbox
+
+// Parsing of dbox files, used by both sdbox (one message per file) and mdbox
+// (multiple messages per file). A file starts with a header line, followed by
+// messages. Each message has a message header, the message data, and metadata
+// lines, ending with an empty line.
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrFormat      = errors.New("not a dbox mail directory")
+	ErrUnsupported = errors.New("unsupported dbox mail directory")
+	errCorrupt     = errors.New("corrupt dbox file")
+)
+
+const (
+	magicPre  = "\x01\x02"
+	magicPost = "\n\x01\x03\n"
+
+	// Minimum message header size: magic, type 'N', space, old v1 uid as 8 hex
+	// characters, space, message size as 16 hex characters, newline.
+	minMsgHeaderSize = 30
+)
+
+// Metadata keys.
+const (
+	metaGUID         = 'G'
+	metaReceivedTime = 'R'
+	metaExtRef       = 'X'
+	metaOrigMailbox  = 'B'
+)
+
+// dboxFile reads messages from a dbox file.
+type dboxFile struct {
+	r             *bufio.Reader
+	offset        int64 // Of next message.
+	msgHeaderSize int
+}
+
+// dboxMessage is a message read from a dbox file.
+type dboxMessage struct {
+	offset   int64           // Of message header in file.
+	metadata map[byte]string // Key is first character of metadata line.
+}
+
+// openFile reads the file header, e.g. "2 M1e C65a1b2c3".
+func openFile(r io.Reader) (*dboxFile, error) {
+	br := bufio.NewReader(r)
+	line, err := br.ReadString('\n')
+	if err != nil {
+		return nil, fmt.Errorf("%w: reading file header: %v", errCorrupt, err)
+	}
+	t := strings.Split(strings.TrimSuffix(line, "\n"), " ")
+	if t[0] != "2" {
+		return nil, fmt.Errorf("%w: unknown dbox file version %q", ErrUnsupported, t[0])
+	}
+	df := &dboxFile{r: br, offset: int64(len(line))}
+	for _, s := range t[1:] {
+		if !strings.HasPrefix(s, "M") {
+			continue
+		}
+		v, err := strconv.ParseUint(s[1:], 16, 16)
+		if err != nil {
+			return nil, fmt.Errorf("%w: bad message header size %q", errCorrupt, s)
+		}
+		df.msgHeaderSize = int(v)
+	}
+	if df.msgHeaderSize < minMsgHeaderSize {
+		return nil, fmt.Errorf("%w: missing or bad message header size", errCorrupt)
+	}
+	return df, nil
+}
+
+// next reads the next message, writing its data to w with bare newlines
+// converted to CRLF, and returning the number of bytes written. Returns io.EOF
+// at the end of the file.
+func (df *dboxFile) next(w io.Writer) (dboxMessage, int64, error) {
+	dm := dboxMessage{offset: df.offset, metadata: map[byte]string{}}
+
+	hdr := make([]byte, df.msgHeaderSize)
+	if n, err := io.ReadFull(df.r, hdr); err == io.EOF {
+		return dm, 0, io.EOF
+	} else if err != nil {
+		return dm, 0, fmt.Errorf("%w: reading message header: %v", errCorrupt, err)
+	} else {
+		df.offset += int64(n)
+	}
+	if string(hdr[:2]) != magicPre || hdr[2] != 'N' {
+		return dm, 0, fmt.Errorf("%w: bad message header at offset %d", errCorrupt, dm.offset)
+	}
+	size, err := strconv.ParseInt(string(hdr[13:29]), 16, 64)
+	if err != nil {
+		return dm, 0, fmt.Errorf("%w: bad message size at offset %d", errCorrupt, dm.offset)
+	}
+
+	n, err := copyCRLF(w, io.LimitReader(df.r, size))
+	if err != nil {
+		return dm, 0, err
+	}
+	df.offset += size
+
+	post := make([]byte, len(magicPost))
+	if _, err := io.ReadFull(df.r, post); err != nil || string(post) != magicPost {
+		return dm, 0, fmt.Errorf("%w: missing metadata after message at offset %d", errCorrupt, dm.offset)
+	}
+	df.offset += int64(len(post))
+
+	for {
+		line, err := df.r.ReadString('\n')
+		if err != nil {
+			return dm, 0, fmt.Errorf("%w: reading metadata of message at offset %d: %v", errCorrupt, dm.offset, err)
+		}
+		df.offset += int64(len(line))
+		line = strings.TrimSuffix(line, "\n")
+		if line == "" {
+			break
+		}
+		dm.metadata[line[0]] = line[1:]
+	}
+	return dm, n, nil
+}
+
+// copyCRLF copies r to w, changing bare \n into \r\n, like the maildir reader
+// in package store.
+func copyCRLF(w io.Writer, r io.Reader) (int64, error) {
+	br := bufio.NewReader(r)
+	bw := bufio.NewWriter(w)
+	var size int64
+	for {
+		line, err := br.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return 0, fmt.Errorf("reading message: %v", err)
+		}
+		if len(line) > 0 {
+			if bytes.HasSuffix(line, []byte("\n")) && !bytes.HasSuffix(line, []byte("\r\n")) {
+				line = append(line[:len(line)-1], "\r\n"...)
+			}
+			if n, err := bw.Write(line); err != nil {
+				return 0, fmt.Errorf("writing message: %v", err)
+			} else {
+				size += int64(n)
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+	}
+	if err := bw.Flush(); err != nil {
+		return 0, fmt.Errorf("writing message: %v", err)
+	}
+	return size, nil
+}
@@ -0,0 +1,140 @@
+package dbox
+
+// Parsing of the dovecot.index file of a mailbox, for the flags and keywords of
+// messages, and for mdbox the message GUIDs. The index consists of a header,
+// extension headers, and a record for each message. Records start with the uid
+// and flags, followed by data for extensions like keywords and GUIDs.
+//
+// Dovecot first writes changes to dovecot.index.log, and only periodically
+// writes them to dovecot.index. We only read dovecot.index.
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+)
+
+const (
+	indexBaseHeaderSize     = 120
+	indexCompatLittleEndian = 0x01
+)
+
+// Message flags in index records.
+const (
+	indexAnswered = 0x01
+	indexFlagged  = 0x02
+	indexDeleted  = 0x04
+	indexSeen     = 0x08
+	indexDraft    = 0x10
+)
+
+// indexRecord is a message in a mailbox index.
+type indexRecord struct {
+	uid      uint32
+	flags    byte
+	keywords []string // As stored, not normalized.
+	guid     [16]byte // Zero if index has no "guid" extension.
+}
+
+// readIndex reads the records from dovecot.index file p.
+func readIndex(p string) ([]indexRecord, error) {
+	buf, err := os.ReadFile(p)
+	if err != nil {
+		return nil, err
+	}
+	if len(buf) < indexBaseHeaderSize {
+		return nil, fmt.Errorf("%w: index file too small", errCorrupt)
+	}
+	if buf[0] != 7 {
+		return nil, fmt.Errorf("%w: index version %d", ErrUnsupported, buf[0])
+	}
+	if buf[12]&indexCompatLittleEndian == 0 {
+		return nil, fmt.Errorf("%w: big-endian index", ErrUnsupported)
+	}
+	baseSize := int(binary.LittleEndian.Uint16(buf[2:]))
+	hdrSize := int(binary.LittleEndian.Uint32(buf[4:]))
+	recSize := int(binary.LittleEndian.Uint32(buf[8:]))
+	count := int(binary.LittleEndian.Uint32(buf[32:]))
+	if baseSize < indexBaseHeaderSize || hdrSize < baseSize || hdrSize > len(buf) || recSize < 5 || count > (len(buf)-hdrSize)/recSize {
+		return nil, fmt.Errorf("%w: bad index header", errCorrupt)
+	}
+
+	// Extension headers, each followed by its name and its data, both aligned to 8
+	// bytes.
+	var kwNames []string
+	kwOffset, kwSize := -1, 0
+	guidOffset := -1
+	for o := baseSize; o+16 <= hdrSize; {
+		extHdrSize := int(binary.LittleEndian.Uint32(buf[o:]))
+		recOffset := int(binary.LittleEndian.Uint16(buf[o+8:]))
+		extRecSize := int(binary.LittleEndian.Uint16(buf[o+10:]))
+		nameSize := int(binary.LittleEndian.Uint16(buf[o+14:]))
+		name := o + 16
+		data := align8(name + nameSize)
+		if data+extHdrSize > hdrSize || recOffset+extRecSize > recSize {
+			return nil, fmt.Errorf("%w: bad index extension header", errCorrupt)
+		}
+		switch string(buf[name : name+nameSize]) {
+		case "keywords":
+			kwNames, err = parseIndexKeywords(buf[data : data+extHdrSize])
+			if err != nil {
+				return nil, err
+			}
+			kwOffset, kwSize = recOffset, extRecSize
+		case "guid":
+			if extRecSize == 16 {
+				guidOffset = recOffset
+			}
+		}
+		o = data + align8(extHdrSize)
+	}
+
+	records := make([]indexRecord, count)
+	for i := range records {
+		rec := buf[hdrSize+i*recSize : hdrSize+(i+1)*recSize]
+		r := indexRecord{uid: binary.LittleEndian.Uint32(rec), flags: rec[4]}
+		if kwOffset >= 0 {
+			bits := rec[kwOffset : kwOffset+kwSize]
+			for j, kw := range kwNames {
+				if j/8 < len(bits) && bits[j/8]&(1<<(j%8)) != 0 {
+					r.keywords = append(r.keywords, kw)
+				}
+			}
+		}
+		if guidOffset >= 0 {
+			copy(r.guid[:], rec[guidOffset:guidOffset+16])
+		}
+		records[i] = r
+	}
+	return records, nil
+}
+
+// parseIndexKeywords parses the header of the keywords extension: a count, a
+// record with a name offset for each keyword, and the NUL-terminated names.
+func parseIndexKeywords(buf []byte) ([]string, error) {
+	if len(buf) < 4 {
+		return nil, fmt.Errorf("%w: bad keywords extension header", errCorrupt)
+	}
+	n := int(binary.LittleEndian.Uint32(buf))
+	if n > (len(buf)-4)/8 {
+		return nil, fmt.Errorf("%w: bad keywords extension header", errCorrupt)
+	}
+	names := buf[4+n*8:]
+	l := make([]string, n)
+	for i := range l {
+		o := int(binary.LittleEndian.Uint32(buf[4+i*8+4:]))
+		if o >= len(names) {
+			return nil, fmt.Errorf("%w: bad keyword name offset", errCorrupt)
+		}
+		end := o
+		for end < len(names) && names[end] != 0 {
+			end++
+		}
+		l[i] = string(names[o:end])
+	}
+	return l, nil
+}
+
+func align8(v int) int {
+	return (v + 7) &^ 7
+}
@@ -0,0 +1,439 @@
+// Package dbox reads messages from Dovecot sdbox and mdbox mail directories, for
+// importing them into an account.
+//
+// Both formats keep a directory per mailbox below "mailboxes/", with a
+// "dbox-Mails" directory holding the dovecot.index file with the flags and
+// keywords of the messages. With sdbox, each message is in its own file
+// "u.<uid>" in the dbox-Mails directory. With mdbox, messages of all mailboxes
+// are stored in files "m.<n>" in "storage/", and are matched by GUID with the
+// messages in the mailbox indexes.
+package dbox
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mjl-/mox/mlog"
+	"github.com/mjl-/mox/store"
+)
+
+// Reader reads messages from an sdbox or mdbox directory, implementing
+// store.MsgSource.
+type Reader struct {
+	log        mlog.Log
+	createTemp func(log mlog.Log, pattern string) (*os.File, error)
+	mailbox    string // Mailbox of message last returned by Next.
+
+	// For sdbox.
+	mailboxes []mailbox // Mailboxes still to read.
+	cur       *mailbox  // Mailbox currently being read, its files in uids.
+	uids      []uint32
+	records   map[uint32]indexRecord
+
+	// For mdbox.
+	mdbox      bool
+	storage    []string // Storage files still to read.
+	sf         *os.File // Storage file currently being read.
+	df         *dboxFile
+	placements map[[16]byte][]placement // By message GUID.
+	pending    []pendingMessage         // Copies of the last read message for other mailboxes.
+}
+
+type mailbox struct {
+	name string // With "/" as hierarchy separator.
+	dir  string // The dbox-Mails directory.
+}
+
+// placement of an mdbox message in a mailbox.
+type placement struct {
+	mailbox string
+	record  indexRecord
+}
+
+type pendingMessage struct {
+	m       *store.Message
+	f       *os.File
+	pos     string
+	mailbox string
+}
+
+// NewReader returns a reader for the sdbox or mdbox directory root, i.e. the
+// directory with the "mailboxes" directory. For mdbox, the mailbox indexes are
+// read immediately.
+func NewReader(log mlog.Log, createTemp func(log mlog.Log, pattern string) (*os.File, error), root string) (*Reader, error) {
+	if fi, err := os.Stat(filepath.Join(root, "mailboxes")); err != nil || !fi.IsDir() {
+		return nil, fmt.Errorf("%w: no directory mailboxes", ErrFormat)
+	}
+
+	mr := &Reader{log: log, createTemp: createTemp}
+	var err error
+	mr.mailboxes, err = findMailboxes(filepath.Join(root, "mailboxes"))
+	if err != nil {
+		return nil, fmt.Errorf("listing mailboxes: %w", err)
+	}
+
+	storage := filepath.Join(root, "storage")
+	if fi, err := os.Stat(storage); err != nil || !fi.IsDir() {
+		return mr, nil
+	}
+
+	mr.mdbox = true
+	mr.storage, err = listFiles(storage, "m.")
+	if err != nil {
+		return nil, fmt.Errorf("listing storage files: %w", err)
+	}
+	mr.placements = map[[16]byte][]placement{}
+	for _, mb := range mr.mailboxes {
+		for _, r := range mr.readIndex(mb) {
+			if r.guid != [16]byte{} {
+				mr.placements[r.guid] = append(mr.placements[r.guid], placement{mb.name, r})
+			}
+		}
+	}
+	return mr, nil
+}
+
+// Mailbox returns the mailbox name for the message last returned by Next.
+func (mr *Reader) Mailbox() string {
+	return mr.mailbox
+}
+
+// findMailboxes returns the mailboxes below dir, with names decoded from
+// modified UTF-7.
+func findMailboxes(dir string) ([]mailbox, error) {
+	var l []mailbox
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() || d.Name() != "dbox-Mails" {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, filepath.Dir(p))
+		if err != nil {
+			return err
+		}
+		if rel != "." {
+			l = append(l, mailbox{mailboxName(filepath.ToSlash(rel)), p})
+		}
+		return fs.SkipDir
+	})
+	return l, err
+}
+
+// mailboxName returns the mailbox name for the path of a mailbox directory
+// relative to the mailboxes directory.
+func mailboxName(rel string) string {
+	t := strings.Split(rel, "/")
+	for i, s := range t {
+		if name, err := utf7decode(s); err == nil {
+			t[i] = name
+		}
+	}
+	if strings.EqualFold(t[0], "Inbox") {
+		t[0] = "Inbox"
+	}
+	return strings.Join(t, "/")
+}
+
+// listFiles returns the files in dir named prefix followed by a number, ordered
+// by that number.
+func listFiles(dir, prefix string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	type file struct {
+		name string
+		n    uint64
+	}
+	var l []file
+	for _, e := range entries {
+		if !strings.HasPrefix(e.Name(), prefix) || e.IsDir() {
+			continue
+		}
+		if n, err := strconv.ParseUint(e.Name()[len(prefix):], 10, 32); err == nil {
+			l = append(l, file{e.Name(), n})
+		}
+	}
+	slices.SortFunc(l, func(a, b file) int {
+		return int(a.n) - int(b.n)
+	})
+	names := make([]string, len(l))
+	for i, f := range l {
+		names[i] = filepath.Join(dir, f.name)
+	}
+	return names, nil
+}
+
+// readIndex reads the index of a mailbox. Errors are logged, the messages are
+// still imported, without flags and keywords.
+func (mr *Reader) readIndex(mb mailbox) []indexRecord {
+	records, err := readIndex(filepath.Join(mb.dir, "dovecot.index"))
+	if err != nil {
+		mr.log.Infox("reading mailbox index, continuing without flags and keywords", err, slog.String("mailbox", mb.name))
+	}
+	return records
+}
+
+// Next returns the next message. The file is a temporary file and must be
+// removed/consumed. The third return value is the position in the dbox
+// directory, the file name with the message offset for mdbox. Messages that
+// cannot be read are logged and skipped.
+func (mr *Reader) Next() (*store.Message, *os.File, string, error) {
+	if mr.mdbox {
+		return mr.nextMdbox()
+	}
+	return mr.nextSdbox()
+}
+
+func (mr *Reader) nextSdbox() (*store.Message, *os.File, string, error) {
+	for {
+		for mr.cur == nil || len(mr.uids) == 0 {
+			if len(mr.mailboxes) == 0 {
+				return nil, nil, "", io.EOF
+			}
+			mb := mr.mailboxes[0]
+			mr.mailboxes = mr.mailboxes[1:]
+			files, err := listFiles(mb.dir, "u.")
+			if err != nil {
+				return nil, nil, mb.dir, fmt.Errorf("listing messages: %w", err)
+			}
+			mr.uids = nil
+			for _, f := range files {
+				uid, _ := strconv.ParseUint(filepath.Base(f)[len("u."):], 10, 32)
+				mr.uids = append(mr.uids, uint32(uid))
+			}
+			mr.records = map[uint32]indexRecord{}
+			for _, r := range mr.readIndex(mb) {
+				mr.records[r.uid] = r
+			}
+			mr.cur = &mb
+		}
+
+		uid := mr.uids[0]
+		mr.uids = mr.uids[1:]
+		p := filepath.Join(mr.cur.dir, fmt.Sprintf("u.%d", uid))
+		m, mf, err := mr.sdboxMessage(p, mr.records[uid])
+		if err != nil {
+			if errors.Is(err, errCorrupt) || errors.Is(err, ErrUnsupported) {
+				mr.log.Errorx("reading message from dbox file, skipping", err, slog.String("path", p))
+				continue
+			}
+			return nil, nil, p, err
+		}
+		mr.mailbox = mr.cur.name
+		return m, mf, p, nil
+	}
+}
+
+// sdboxMessage reads the message in file p and writes it to a temporary file.
+func (mr *Reader) sdboxMessage(p string, r indexRecord) (*store.Message, *os.File, error) {
+	sf, err := os.Open(p)
+	if err != nil {
+		return nil, nil, fmt.Errorf("open message file: %v", err)
+	}
+	defer func() {
+		err := sf.Close()
+		mr.log.Check(err, "closing message file")
+	}()
+	df, err := openFile(sf)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	f, err := mr.createTemp(mr.log, "dboxreader")
+	if err != nil {
+		return nil, nil, err
+	}
+	defer func() {
+		if f != nil {
+			store.CloseRemoveTempFile(mr.log, f, "message file after error")
+		}
+	}()
+
+	dm, size, err := df.next(f)
+	if err == io.EOF {
+		return nil, nil, fmt.Errorf("%w: no message in file", errCorrupt)
+	} else if err != nil {
+		return nil, nil, err
+	}
+	m, err := dm.message(r, size)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	mf := f
+	f = nil
+	return m, mf, nil
+}
+
+func (mr *Reader) nextMdbox() (*store.Message, *os.File, string, error) {
+	for {
+		if len(mr.pending) > 0 {
+			pm := mr.pending[0]
+			mr.pending = mr.pending[1:]
+			mr.mailbox = pm.mailbox
+			return pm.m, pm.f, pm.pos, nil
+		}
+
+		if mr.df == nil {
+			if len(mr.storage) == 0 {
+				return nil, nil, "", io.EOF
+			}
+			p := mr.storage[0]
+			mr.storage = mr.storage[1:]
+			sf, err := os.Open(p)
+			if err != nil {
+				return nil, nil, p, fmt.Errorf("open storage file: %v", err)
+			}
+			df, err := openFile(sf)
+			if err != nil {
+				xerr := sf.Close()
+				mr.log.Check(xerr, "closing storage file")
+				if errors.Is(err, errCorrupt) || errors.Is(err, ErrUnsupported) {
+					mr.log.Errorx("reading storage file, skipping", err, slog.String("path", p))
+					continue
+				}
+				return nil, nil, p, err
+			}
+			mr.sf = sf
+			mr.df = df
+		}
+
+		if err := mr.readMdboxMessage(); err == io.EOF || err != nil && errors.Is(err, errCorrupt) {
+			if err != io.EOF {
+				// We cannot find the next message after a corrupt message.
+				mr.log.Errorx("reading message from storage file, skipping remainder of file", err, slog.String("path", mr.sf.Name()))
+			}
+			err := mr.sf.Close()
+			mr.log.Check(err, "closing storage file")
+			mr.sf = nil
+			mr.df = nil
+		} else if err != nil {
+			return nil, nil, mr.sf.Name(), err
+		}
+	}
+}
+
+// readMdboxMessage reads the next message from the current storage file, and
+// adds it as pending message for each mailbox it is in. Messages that are not
+// in any mailbox index are placed in their original mailbox, if known, and
+// skipped otherwise.
+func (mr *Reader) readMdboxMessage() error {
+	f, err := mr.createTemp(mr.log, "dboxreader")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if f != nil {
+			store.CloseRemoveTempFile(mr.log, f, "message file")
+		}
+	}()
+
+	dm, size, err := mr.df.next(f)
+	if err != nil {
+		return err
+	}
+	pos := fmt.Sprintf("%s:%d", mr.sf.Name(), dm.offset)
+
+	var guid [16]byte
+	if buf, err := hex.DecodeString(dm.metadata[metaGUID]); err == nil && len(buf) == len(guid) {
+		copy(guid[:], buf)
+	}
+	placements := mr.placements[guid]
+	if guid == [16]byte{} || len(placements) == 0 {
+		name := dm.metadata[metaOrigMailbox]
+		if name == "" {
+			mr.log.Info("message not in any mailbox index and without original mailbox, skipping", slog.String("position", pos))
+			return nil
+		}
+		mr.log.Debug("message not in any mailbox index, using original mailbox", slog.String("position", pos), slog.String("mailbox", name))
+		placements = []placement{{mailbox: name}}
+	}
+
+	for i, pl := range placements {
+		m, err := dm.message(pl.record, size)
+		if err != nil {
+			if errors.Is(err, ErrUnsupported) {
+				mr.log.Errorx("reading message from storage file, skipping", err, slog.String("position", pos))
+				return nil
+			}
+			return err
+		}
+		mf := f
+		if i < len(placements)-1 {
+			// Each mailbox gets its own copy.
+			mf, err = mr.createTemp(mr.log, "dboxreader")
+			if err != nil {
+				return err
+			}
+			if _, err := io.Copy(mf, io.NewSectionReader(f, 0, size)); err != nil {
+				store.CloseRemoveTempFile(mr.log, mf, "message file")
+				return fmt.Errorf("copying message: %v", err)
+			}
+		} else {
+			f = nil
+		}
+		mr.pending = append(mr.pending, pendingMessage{m, mf, pos, pl.mailbox})
+	}
+	return nil
+}
+
+// message returns a store.Message for a message read from a dbox file, with
+// flags and keywords from index record r.
+func (dm dboxMessage) message(r indexRecord, size int64) (*store.Message, error) {
+	if _, ok := dm.metadata[metaExtRef]; ok {
+		return nil, fmt.Errorf("%w: message with attachments stored externally", ErrUnsupported)
+	}
+	var received time.Time
+	if v, err := strconv.ParseInt(dm.metadata[metaReceivedTime], 16, 64); err == nil {
+		received = time.Unix(v, 0)
+	}
+	flags, keywords := flagsKeywords(r)
+	return &store.Message{Received: received, Flags: flags, Keywords: keywords, Size: size}, nil
+}
+
+// flagsKeywords returns the flags and keywords for an index record, with
+// keywords for well-known flags turned into flags, like for maildir imports.
+// Invalid keywords are ignored.
+func flagsKeywords(r indexRecord) (store.Flags, []string) {
+	flags := store.Flags{
+		Answered: r.flags&indexAnswered != 0,
+		Flagged:  r.flags&indexFlagged != 0,
+		Deleted:  r.flags&indexDeleted != 0,
+		Seen:     r.flags&indexSeen != 0,
+		Draft:    r.flags&indexDraft != 0,
+	}
+	var keywords []string
+	for _, kw := range r.keywords {
+		kw = strings.ToLower(kw)
+		switch kw {
+		case "$forwarded", "forwarded":
+			flags.Forwarded = true
+		case "$junk", "junk":
+			flags.Junk = true
+		case "$notjunk", "notjunk", "nonjunk":
+			flags.Notjunk = true
+		case "$mdnsent", "mdnsent":
+			flags.MDNSent = true
+		case "$phishing", "phishing":
+			flags.Phishing = true
+		default:
+			if store.CheckKeyword(kw) == nil && !slices.Contains(keywords, kw) {
+				keywords = append(keywords, kw)
+			}
+		}
+	}
+	return flags, keywords
+}
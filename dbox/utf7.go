@@ -0,0 +1,61 @@
+package dbox
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"unicode/utf16"
+)
+
+// Dovecot stores mailbox directory names in modified UTF-7, as used by IMAP
+// without UTF8=ACCEPT, like in ../imapserver/utf7.go. We only need to decode.
+// ../rfc/3501:1050
+
+var utf7encoding = base64.NewEncoding("ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+,").WithPadding(base64.NoPadding)
+
+var errUTF7 = errors.New("invalid modified utf-7")
+
+func utf7decode(s string) (string, error) {
+	var r string
+	var shifted bool
+	var b string
+
+	for _, c := range s {
+		if !shifted {
+			if c == '&' {
+				shifted = true
+			} else {
+				r += string(c)
+			}
+			continue
+		}
+
+		if c != '-' {
+			b += string(c)
+			continue
+		}
+
+		shifted = false
+		if b == "" {
+			r += "&"
+			continue
+		}
+		buf, err := utf7encoding.DecodeString(b)
+		if err != nil {
+			return "", fmt.Errorf("%w: %q: %v", errUTF7, b, err)
+		}
+		b = ""
+		if len(buf)%2 != 0 {
+			return "", fmt.Errorf("%w: odd-sized data", errUTF7)
+		}
+		x := make([]uint16, len(buf)/2)
+		for i := range x {
+			x[i] = uint16(buf[2*i])<<8 | uint16(buf[2*i+1])
+		}
+		r += string(utf16.Decode(x))
+	}
+	if shifted {
+		return "", fmt.Errorf("%w: unfinished shift", errUTF7)
+	}
+	return r, nil
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/mjl-/adns"
+
+	"github.com/mjl-/mox/dns"
+	"github.com/mjl-/mox/mlog"
+	"github.com/mjl-/mox/mtasts"
+	"github.com/mjl-/mox/smtpclient"
+)
+
+// dialTarget is a destination host for a delivery, with its IPs and DANE details
+// as a delivery attempt from the queue would use them, see queue/direct.go.
+type dialTarget struct {
+	Host         dns.IPDomain
+	ExpandedHost dns.Domain // After following CNAMEs.
+	IPs          []net.IP
+
+	// Whether the path to the host, including its IPs, is DNSSEC-secure. Required
+	// for DANE.
+	Authentic bool
+
+	// Whether TLSA records exist for the host. If so, STARTTLS is required.
+	DANE bool
+
+	// Usable TLSA records. If DANE is set but there are no usable records, TLS is
+	// required but the certificate not verified.
+	DANERecords    []adns.TLSA
+	TLSABaseDomain dns.Domain
+
+	// Names allowed in the TLS certificate, the first is used for SNI.
+	TLSHostnames []dns.Domain
+}
+
+// gatherDialTarget resolves the IPs of host, and looks up DANE TLSA records if the
+// path to the host is DNSSEC-secure. The other parameters are as returned by
+// smtpclient.GatherDestinations. Used by "mox dialcheck" and "mox dane dialmx".
+func gatherDialTarget(ctx context.Context, log mlog.Log, resolver dns.Resolver, dialedIPs map[string][]net.IP, haveMX, origNextHopAuthentic, expandedNextHopAuthentic bool, origNextHop, expandedNextHop dns.Domain, host dns.IPDomain) (dialTarget, error) {
+	t := dialTarget{Host: host, ExpandedHost: host.Domain, TLSHostnames: []dns.Domain{host.Domain}}
+
+	authentic, expandedAuthentic, expandedHost, ips, _, err := smtpclient.GatherIPs(ctx, log.Logger, resolver, "ip", host, dialedIPs)
+	if err != nil {
+		return t, fmt.Errorf("resolving ips: %v", err)
+	}
+	t.ExpandedHost = expandedHost
+	t.IPs = ips
+	t.Authentic = authentic && origNextHopAuthentic && (!haveMX || expandedNextHopAuthentic) && host.IsDomain()
+	if !t.Authentic {
+		return t, nil
+	}
+
+	// Look for TLSA records in either the expanded host, or otherwise the original
+	// host. ../rfc/7672:912
+	t.DANE, t.DANERecords, t.TLSABaseDomain, err = smtpclient.GatherTLSA(ctx, log.Logger, resolver, host.Domain, expandedNextHopAuthentic && expandedAuthentic, expandedHost)
+	if err != nil && t.DANE {
+		return t, fmt.Errorf("looking up dane tlsa records: %v", err)
+	} else if t.DANE {
+		// Based on CNAMEs followed and DNSSEC-secure status, we must allow up to 4 host
+		// names.
+		t.TLSHostnames = smtpclient.GatherTLSANames(haveMX, expandedNextHopAuthentic, expandedAuthentic, origNextHop, expandedNextHop, host.Domain, t.TLSABaseDomain)
+	}
+	return t, nil
+}
+
+// dialSMTP connects to an IP of target and initializes an SMTP session, with
+// EHLO and STARTTLS depending on tlsMode. The TLS certificate is verified with
+// the DANE records of target if any, and with PKIX if tlsPKIX is set. The TLSA
+// record that verified the certificate is returned.
+func dialSMTP(ctx context.Context, log mlog.Log, target dialTarget, port int, dialedIPs map[string][]net.IP, tlsMode smtpclient.TLSMode, tlsPKIX bool, ehloDomain dns.Domain, rootCAs *x509.CertPool) (*smtpclient.Client, net.IP, adns.TLSA, error) {
+	dialer := &net.Dialer{Timeout: 30 * time.Second}
+	conn, remoteIP, err := smtpclient.Dial(ctx, log.Logger, dialer, target.Host, target.IPs, port, dialedIPs, nil)
+	if err != nil {
+		return nil, nil, adns.TLSA{}, fmt.Errorf("dial: %v", err)
+	}
+
+	var verifiedRecord adns.TLSA
+	opts := smtpclient.Opts{
+		DANERecords:        target.DANERecords,
+		DANEMoreHostnames:  target.TLSHostnames[1:],
+		DANEVerifiedRecord: &verifiedRecord,
+		RootCAs:            rootCAs,
+	}
+	sc, err := smtpclient.New(ctx, log.Logger, conn, tlsMode, tlsPKIX, ehloDomain, target.TLSHostnames[0], opts)
+	if err != nil {
+		conn.Close()
+		return nil, remoteIP, adns.TLSA{}, err
+	}
+	return sc, remoteIP, verifiedRecord, nil
+}
+
+// dialcheck writes to w how a message to domain origNextHop would be delivered,
+// see cmdDialcheck. It returns whether a host was found that a delivery would be
+// attempted to. An error is returned if delivery would fail before trying hosts.
+func dialcheck(ctx context.Context, log mlog.Log, w io.Writer, resolver dns.Resolver, origNextHop, ehloDomain dns.Domain, port int, requireTLS, all bool) (delivering bool, rerr error) {
+	haveMX, origNextHopAuthentic, expandedNextHopAuthentic, expandedNextHop, hosts, permanent, err := smtpclient.GatherDestinations(ctx, log.Logger, resolver, dns.IPDomain{Domain: origNextHop})
+	if err != nil {
+		status := "temporary"
+		if permanent {
+			status = "permanent"
+		}
+		return false, fmt.Errorf("gathering destinations: %v (%s failure, delivery would fail)", err, status)
+	}
+	fmt.Fprintf(w, "domain %s, dnssec-secure %v\n", origNextHop, origNextHopAuthentic)
+	if expandedNextHop != origNextHop {
+		fmt.Fprintf(w, "followed cnames to %s, dnssec-secure %v\n", expandedNextHop, expandedNextHopAuthentic)
+	}
+	if haveMX {
+		fmt.Fprintf(w, "mx records found\n")
+	} else {
+		fmt.Fprintf(w, "no mx records found, delivering to domain directly\n")
+	}
+	var l []string
+	for _, h := range hosts {
+		l = append(l, h.String())
+	}
+	fmt.Fprintf(w, "destination hosts, in order: %s\n", strings.Join(l, ", "))
+
+	record, policy, _, err := mtasts.Get(ctx, log.Logger, resolver, origNextHop)
+	if err != nil && !errors.Is(err, mtasts.ErrNoRecord) {
+		if requireTLS {
+			return false, fmt.Errorf("mta-sts lookup: %v (delivery would be postponed)", err)
+		}
+		fmt.Fprintf(w, "mta-sts lookup: %v (delivery would be postponed, unless message has header tls-required: no)\n", err)
+	} else if record == nil {
+		fmt.Fprintf(w, "no mta-sts policy\n")
+	}
+	if policy != nil {
+		var mxl []string
+		for _, mx := range policy.MX {
+			mxl = append(mxl, mx.LogString())
+		}
+		fmt.Fprintf(w, "mta-sts policy: mode %s, mx %s\n", policy.Mode, strings.Join(mxl, ", "))
+	}
+	enforceMTASTS := policy != nil && policy.Mode == mtasts.ModeEnforce
+
+	dialedIPs := map[string][]net.IP{}
+	for _, host := range hosts {
+		fmt.Fprintf(w, "\nhost %s\n", host)
+
+		if policy != nil && policy.Mode != mtasts.ModeNone && !policy.Matches(host.Domain) {
+			if enforceMTASTS {
+				fmt.Fprintf(w, "host does not match mta-sts policy in mode enforce, skipping\n")
+				continue
+			}
+			fmt.Fprintf(w, "host does not match mta-sts policy, but it is not enforced, continuing\n")
+		}
+
+		tlsMode := smtpclient.TLSOpportunistic
+		tlsPKIX := false
+		if enforceMTASTS {
+			tlsMode = smtpclient.TLSRequiredStartTLS
+			tlsPKIX = true
+		}
+
+		target, err := gatherDialTarget(ctx, log, resolver, dialedIPs, haveMX, origNextHopAuthentic, expandedNextHopAuthentic, origNextHop, expandedNextHop, host)
+		if host.IsDomain() && target.ExpandedHost != host.Domain {
+			fmt.Fprintf(w, "followed cnames to %s\n", target.ExpandedHost)
+		}
+		if target.IPs != nil {
+			fmt.Fprintf(w, "ips: %s\n", target.IPs)
+		}
+		if err != nil {
+			fmt.Fprintf(w, "%v, skipping\n", err)
+			continue
+		}
+		if !target.Authentic {
+			fmt.Fprintf(w, "destination not dnssec-secure, not looking up dane tlsa records\n")
+		} else if !target.DANE {
+			fmt.Fprintf(w, "no dane tlsa records\n")
+		} else {
+			tlsMode = smtpclient.TLSRequiredStartTLS
+			if len(target.DANERecords) == 0 {
+				fmt.Fprintf(w, "only unusable dane tlsa records, requiring tls without verification with dane\n")
+			} else {
+				var rl []string
+				for _, r := range target.DANERecords {
+					rl = append(rl, r.String())
+				}
+				fmt.Fprintf(w, "dane tlsa records at %s: %s\n", target.TLSABaseDomain, strings.Join(rl, "; "))
+			}
+		}
+
+		if requireTLS && !(target.DANE && len(target.DANERecords) > 0) && !enforceMTASTS {
+			fmt.Fprintf(w, "requiretls requires dane or mta-sts with mode enforce, skipping\n")
+			continue
+		}
+
+		var verification []string
+		if tlsPKIX {
+			verification = append(verification, "pkix (mta-sts)")
+		}
+		if len(target.DANERecords) > 0 {
+			verification = append(verification, "dane")
+		}
+		if len(verification) == 0 {
+			verification = append(verification, "none")
+		}
+		fmt.Fprintf(w, "tls mode %s, verification with %s\n", tlsMode, strings.Join(verification, " and "))
+
+		dial := func(tlsMode smtpclient.TLSMode, tlsPKIX bool) (*smtpclient.Client, error) {
+			dctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+			defer cancel()
+			sc, remoteIP, verifiedRecord, err := dialSMTP(dctx, log, target, port, dialedIPs, tlsMode, tlsPKIX, ehloDomain, nil)
+			if remoteIP != nil {
+				fmt.Fprintf(w, "connected to %s\n", remoteIP)
+			}
+			if err != nil {
+				return nil, err
+			}
+			if cs := sc.TLSConnectionState(); cs != nil {
+				fmt.Fprintf(w, "tls %s, cipher suite %s\n", tls.VersionName(cs.Version), tls.CipherSuiteName(cs.CipherSuite))
+				if len(target.DANERecords) > 0 {
+					fmt.Fprintf(w, "tls verified with dane tlsa record: %s\n", verifiedRecord)
+				}
+			} else {
+				fmt.Fprintf(w, "no tls\n")
+			}
+			if ext := sc.Extensions(); ext != nil {
+				fmt.Fprintf(w, "ehlo extensions: %s\n", strings.Join(ext, ", "))
+			} else {
+				fmt.Fprintf(w, "no ehlo support, only helo\n")
+			}
+			if requireTLS && !sc.SupportsRequireTLS() {
+				fmt.Fprintf(w, "server does not support requiretls, delivery would fail\n")
+			}
+			return sc, nil
+		}
+
+		sc, err := dial(tlsMode, tlsPKIX)
+		// Like the queue, we fall back to plain text for opportunistic tls.
+		if err != nil && errors.Is(err, smtpclient.ErrTLS) && !enforceMTASTS && tlsMode == smtpclient.TLSOpportunistic && !target.DANE {
+			fmt.Fprintf(w, "tls failed: %v, trying again without tls\n", err)
+			sc, err = dial(smtpclient.TLSSkip, false)
+		}
+		if err != nil {
+			fmt.Fprintf(w, "smtp session: %v, skipping\n", err)
+			continue
+		}
+		err = sc.Close()
+		log.Check(err, "closing smtp session")
+
+		if !delivering {
+			delivering = true
+			fmt.Fprintf(w, "delivery would be attempted to this host\n")
+		}
+		if !all {
+			return true, nil
+		}
+	}
+	if !delivering {
+		fmt.Fprintf(w, "\nno remaining destinations, delivery would fail\n")
+	}
+	return delivering, nil
+}
@@ -0,0 +1,171 @@
+//go:build !integration
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	cryptorand "crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"math/big"
+	"net"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mjl-/adns"
+
+	"github.com/mjl-/mox/dns"
+)
+
+// Test dialcheck against a local smtp server, with opportunistic tls, and with
+// dane.
+func TestDialcheck(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), cryptorand.Reader)
+	tcheck(t, err, "generate key")
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		DNSNames:     []string{"mail.example.org"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	certBuf, err := x509.CreateCertificate(cryptorand.Reader, template, template, key.Public(), key)
+	tcheck(t, err, "create certificate")
+	cert := tls.Certificate{Certificate: [][]byte{certBuf}, PrivateKey: key}
+	spkiBuf, err := x509.MarshalPKIXPublicKey(key.Public())
+	tcheck(t, err, "marshal public key")
+	spkiSum := sha256.Sum256(spkiBuf)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	tcheck(t, err, "listen")
+	defer ln.Close()
+	port := ln.Addr().(*net.TCPAddr).Port
+
+	// Minimal smtp server, with starttls if enabled.
+	var starttls atomic.Bool
+	serve := func(conn net.Conn, starttls bool) {
+		defer conn.Close()
+		var c net.Conn = conn
+		br := bufio.NewReader(c)
+		write := func(s string) {
+			c.Write([]byte(strings.ReplaceAll(s, "\n", "\r\n")))
+		}
+		write("220 mail.example.org ESMTP\n")
+		for {
+			line, err := br.ReadString('\n')
+			if err != nil {
+				return
+			}
+			cmd := strings.ToUpper(strings.SplitN(strings.TrimSpace(line), " ", 2)[0])
+			switch {
+			case cmd == "EHLO" && starttls:
+				write("250-mail.example.org\n250-PIPELINING\n250-STARTTLS\n250 8BITMIME\n")
+			case cmd == "EHLO":
+				write("250-mail.example.org\n250-PIPELINING\n250 8BITMIME\n")
+			case cmd == "STARTTLS" && starttls:
+				write("220 go ahead\n")
+				tlsConn := tls.Server(conn, &tls.Config{Certificates: []tls.Certificate{cert}})
+				if err := tlsConn.Handshake(); err != nil {
+					return
+				}
+				c = tlsConn
+				br = bufio.NewReader(c)
+				starttls = false
+			case cmd == "QUIT":
+				write("221 bye\n")
+				return
+			default:
+				write("500 unknown command\n")
+			}
+		}
+	}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serve(conn, starttls.Load())
+		}
+	}()
+
+	resolver := dns.MockResolver{
+		MX: map[string][]*net.MX{
+			"example.org.": {{Host: "mail.example.org.", Pref: 10}},
+		},
+		A: map[string][]string{
+			"mail.example.org.": {"127.0.0.1"},
+		},
+	}
+	ehloDomain := dns.Domain{ASCII: "mox.example"}
+	domain := dns.Domain{ASCII: "example.org"}
+
+	check := func(requireTLS bool, expDelivering bool, expOutput ...string) {
+		t.Helper()
+		var out bytes.Buffer
+		delivering, err := dialcheck(ctxbg, pkglog, &out, resolver, domain, ehloDomain, port, requireTLS, false)
+		tcheck(t, err, "dialcheck")
+		if delivering != expDelivering {
+			t.Fatalf("got delivering %v, expected %v, output:\n%s", delivering, expDelivering, out.String())
+		}
+		for _, s := range expOutput {
+			if !strings.Contains(out.String(), s) {
+				t.Fatalf("output does not contain %q:\n%s", s, out.String())
+			}
+		}
+	}
+
+	// No dnssec, server without starttls.
+	check(false, true,
+		"destination hosts, in order: mail.example.org\n",
+		"no mta-sts policy\n",
+		"destination not dnssec-secure, not looking up dane tlsa records\n",
+		"tls mode opportunistic, verification with none\n",
+		"no tls\n",
+		"ehlo extensions: PIPELINING, 8BITMIME\n",
+		"delivery would be attempted to this host\n",
+	)
+
+	// Without dane or mta-sts, requiretls cannot be used.
+	check(true, false,
+		"requiretls requires dane or mta-sts with mode enforce, skipping\n",
+		"no remaining destinations, delivery would fail\n",
+	)
+
+	// With dnssec and tlsa record, starttls is required and verified with dane.
+	starttls.Store(true)
+	resolver.AllAuthentic = true
+	tlsaRecord := adns.TLSA{
+		Usage:     adns.TLSAUsageDANEEE,
+		Selector:  adns.TLSASelectorSPKI,
+		MatchType: adns.TLSAMatchTypeSHA256,
+		CertAssoc: spkiSum[:],
+	}
+	resolver.TLSA = map[string][]adns.TLSA{
+		"_25._tcp.mail.example.org.": {tlsaRecord},
+	}
+	check(false, true,
+		"domain example.org, dnssec-secure true\n",
+		"dane tlsa records at mail.example.org: "+tlsaRecord.String()+"\n",
+		"tls mode requiredstarttls, verification with dane\n",
+		"tls verified with dane tlsa record: "+tlsaRecord.String()+"\n",
+		"delivery would be attempted to this host\n",
+	)
+
+	// A tlsa record that doesn't match the certificate fails verification, there is
+	// no fallback to plain text.
+	badRecord := tlsaRecord
+	badRecord.CertAssoc = make([]byte, sha256.Size)
+	resolver.TLSA = map[string][]adns.TLSA{
+		"_25._tcp.mail.example.org.": {badRecord},
+	}
+	check(false, false,
+		"smtp session: ",
+		"no remaining destinations, delivery would fail\n",
+	)
+}
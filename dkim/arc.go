@@ -0,0 +1,661 @@
+package dkim
+
+// ARC, Authenticated Received Chain, RFC 8617.
+//
+// Intermediaries that forward a message, e.g. for aliases or mailing lists,
+// modify the message or change the SMTP envelope, breaking SPF and often DKIM. With
+// ARC, each intermediary records the authentication results it evaluated, signs
+// the message and seals the chain. Downstream receivers can validate the chain and
+// decide to trust the authentication results of the intermediaries, e.g. to
+// override a DMARC failure.
+//
+// An ARC set consists of three headers with the same instance number:
+// ARC-Authentication-Results, ARC-Message-Signature (a DKIM-Signature) and
+// ARC-Seal (a signature over all ARC headers up to and including its own set).
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	cryptorand "crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/mjl-/mox/dns"
+	"github.com/mjl-/mox/message"
+	"github.com/mjl-/mox/mlog"
+	"github.com/mjl-/mox/moxio"
+)
+
+// ARCStatus is the result of validating an ARC chain. It is also used for the
+// chain validation status "cv" in ARC-Seal headers.
+type ARCStatus string
+
+// ../rfc/8617
+
+const (
+	ARCNone ARCStatus = "none" // Message has no ARC sets.
+	ARCPass ARCStatus = "pass" // All ARC sets are present and valid.
+	ARCFail ARCStatus = "fail" // Chain is invalid, or an intermediary indicated the chain failed.
+)
+
+// ARCMaxInstance is the maximum number of ARC sets in a message.
+const ARCMaxInstance = 50
+
+// ARC errors.
+var (
+	ErrARCStructure = errors.New("dkim: arc: invalid chain structure")
+	ErrARCChain     = errors.New("dkim: arc: chain validation status fail")
+	ErrARCSeal      = errors.New("dkim: arc: seal verification failed")
+	ErrARCSignature = errors.New("dkim: arc: message signature verification failed")
+)
+
+var (
+	errARCSealHeader  = errors.New("not ARC-Seal header")
+	errARCSealHeaders = errors.New("signed headers (h=) not allowed in ARC-Seal")
+	errARCSealCV      = errors.New("unknown chain validation status (cv=)")
+)
+
+// ARCResult is the result of validating the ARC chain of a message.
+type ARCResult struct {
+	Status   ARCStatus
+	Instance int          // Highest instance in the chain, 0 if the message has no ARC sets.
+	Sealers  []dns.Domain // For ARCPass, the domains that sealed the ARC sets, starting with instance 1.
+	Err      error        // For ARCFail, the details, can be checked with errors.Is.
+}
+
+// Seal is an ARC-Seal header.
+type Seal struct {
+	Instance        int        // Field "i".
+	AlgorithmSign   string     // "rsa" or "ed25519". Field "a".
+	AlgorithmHash   string     // "sha256". Field "a".
+	Signature       []byte     // Field "b".
+	ChainValidation ARCStatus  // Field "cv".
+	Domain          dns.Domain // Field "d".
+	Selector        dns.Domain // Field "s".
+	SignTime        int64      // Unix epoch. -1 if unset. Field "t".
+}
+
+// Header returns the ARC-Seal header in string form, including trailing \r\n.
+func (s *Seal) Header() string {
+	w := &message.HeaderWriter{}
+	w.Addf("", "ARC-Seal: i=%d;", s.Instance)
+	w.Addf(" ", "a=%s-%s;", s.AlgorithmSign, s.AlgorithmHash)
+	if s.SignTime >= 0 {
+		w.Addf(" ", "t=%d;", s.SignTime)
+	}
+	w.Addf(" ", "cv=%s;", s.ChainValidation)
+	w.Addf(" ", "d=%s;", s.Domain.ASCII)
+	w.Addf(" ", "s=%s;", s.Selector.ASCII)
+	w.Addf(" ", "b=")
+	if len(s.Signature) > 0 {
+		w.AddWrap([]byte(base64.StdEncoding.EncodeToString(s.Signature)), false)
+	}
+	w.Add("\r\n")
+	return w.String()
+}
+
+// parseSeal parses an ARC-Seal header, returning the header with the value for
+// "b=" removed, for verifying the seal.
+func parseSeal(buf []byte, smtputf8 bool) (seal *Seal, verifySig []byte, err error) {
+	defer func() {
+		if x := recover(); x == nil {
+			return
+		} else if xerr, ok := x.(error); ok {
+			seal = nil
+			verifySig = nil
+			err = xerr
+		} else {
+			panic(x)
+		}
+	}()
+
+	xerrorf := func(format string, args ...any) {
+		panic(fmt.Errorf(format, args...))
+	}
+
+	if !bytes.HasSuffix(buf, []byte("\r\n")) {
+		xerrorf("%w", errSigMissingCRLF)
+	}
+	buf = buf[:len(buf)-2]
+
+	seal = &Seal{SignTime: -1}
+	seen := map[string]struct{}{}
+	p := parser{s: string(buf), smtputf8: smtputf8}
+	name := p.xhdrName(false)
+	if !strings.EqualFold(name, "ARC-Seal") {
+		xerrorf("%w", errARCSealHeader)
+	}
+	p.wsp()
+	p.xtake(":")
+	p.wsp()
+	for {
+		p.fws()
+		k := p.xtagName()
+		p.fws()
+		p.xtake("=")
+		// Special case for "b", see parseSig.
+		if k != "b" {
+			p.fws()
+		}
+		if _, ok := seen[k]; ok {
+			xerrorf("%w: %q", errSigDuplicateTag, k)
+		}
+		seen[k] = struct{}{}
+
+		switch k {
+		case "i":
+			seal.Instance = int(p.xnumber(2))
+		case "a":
+			seal.AlgorithmSign, seal.AlgorithmHash = p.xalgorithm()
+		case "b":
+			p.drop = true
+			p.fws()
+			seal.Signature = p.xbase64()
+			p.fws()
+			p.drop = false
+		case "cv":
+			cv := ARCStatus(strings.ToLower(p.xtakefn1(false, func(c rune, i int) bool { return isalpha(c) })))
+			switch cv {
+			case ARCNone, ARCPass, ARCFail:
+			default:
+				xerrorf("%w: %q", errARCSealCV, cv)
+			}
+			seal.ChainValidation = cv
+		case "d":
+			seal.Domain = p.xdomain()
+		case "s":
+			seal.Selector = p.xselector()
+		case "t":
+			seal.SignTime = p.xtimestamp()
+		case "h":
+			// ../rfc/8617
+			xerrorf("%w", errARCSealHeaders)
+		default:
+			// Unknown fields must be ignored.
+			p.xchar()
+			for !p.empty() && !p.hasPrefix(";") {
+				p.xchar()
+			}
+		}
+		p.fws()
+
+		if p.empty() {
+			break
+		}
+		p.xtake(";")
+		if p.empty() {
+			break
+		}
+	}
+
+	for _, req := range []string{"i", "a", "b", "cv", "d", "s"} {
+		if _, ok := seen[req]; !ok {
+			xerrorf("%w: %q", errSigMissingTag, req)
+		}
+	}
+	return seal, []byte(p.tracked), nil
+}
+
+// arcInstance parses the instance from an ARC-Authentication-Results header.
+func arcInstance(buf []byte) (instance int, err error) {
+	defer func() {
+		if x := recover(); x == nil {
+			return
+		} else if xerr, ok := x.(error); ok {
+			instance = 0
+			err = xerr
+		} else {
+			panic(x)
+		}
+	}()
+
+	p := parser{s: strings.TrimSuffix(string(buf), "\r\n")}
+	p.xhdrName(false)
+	p.wsp()
+	p.xtake(":")
+	p.fws()
+	p.xtake("i")
+	p.fws()
+	p.xtake("=")
+	p.fws()
+	instance = int(p.xnumber(2))
+	p.fws()
+	p.xtake(";")
+	return instance, nil
+}
+
+// arcSet is a parsed ARC set, with raw headers.
+type arcSet struct {
+	aar          header
+	ams          header
+	amsSig       *Sig
+	amsVerifySig []byte
+	seal         header
+	sealSig      *Seal
+	sealVerify   []byte
+}
+
+// parseARCSets parses the ARC headers and checks the structure of the chain. The
+// returned sets are ordered by instance, starting at 1.
+func parseARCSets(hdrs []header, smtputf8 bool) ([]arcSet, error) {
+	sets := map[int]*arcSet{}
+	get := func(instance int) (*arcSet, error) {
+		if instance < 1 || instance > ARCMaxInstance {
+			return nil, fmt.Errorf("%w: instance %d out of range", ErrARCStructure, instance)
+		}
+		s := sets[instance]
+		if s == nil {
+			s = &arcSet{}
+			sets[instance] = s
+		}
+		return s, nil
+	}
+
+	for _, h := range hdrs {
+		switch h.lkey {
+		case "arc-authentication-results":
+			instance, err := arcInstance(h.raw)
+			if err != nil {
+				return nil, fmt.Errorf("%w: parsing ARC-Authentication-Results: %s", ErrARCStructure, err)
+			}
+			s, err := get(instance)
+			if err != nil {
+				return nil, err
+			} else if s.aar.raw != nil {
+				return nil, fmt.Errorf("%w: multiple ARC-Authentication-Results for instance %d", ErrARCStructure, instance)
+			}
+			s.aar = h
+		case "arc-message-signature":
+			sig, instance, verifySig, err := parseSig(h.raw, smtputf8, true)
+			if err != nil {
+				return nil, fmt.Errorf("%w: parsing ARC-Message-Signature: %s", ErrARCStructure, err)
+			}
+			s, err := get(instance)
+			if err != nil {
+				return nil, err
+			} else if s.ams.raw != nil {
+				return nil, fmt.Errorf("%w: multiple ARC-Message-Signature for instance %d", ErrARCStructure, instance)
+			}
+			s.ams = h
+			s.amsSig = sig
+			s.amsVerifySig = verifySig
+		case "arc-seal":
+			seal, verifySig, err := parseSeal(h.raw, smtputf8)
+			if err != nil {
+				return nil, fmt.Errorf("%w: parsing ARC-Seal: %s", ErrARCStructure, err)
+			}
+			s, err := get(seal.Instance)
+			if err != nil {
+				return nil, err
+			} else if s.seal.raw != nil {
+				return nil, fmt.Errorf("%w: multiple ARC-Seal for instance %d", ErrARCStructure, seal.Instance)
+			}
+			s.seal = h
+			s.sealSig = seal
+			s.sealVerify = verifySig
+		}
+	}
+
+	l := make([]arcSet, len(sets))
+	for i := range l {
+		s := sets[i+1]
+		if s == nil {
+			return nil, fmt.Errorf("%w: missing ARC set for instance %d", ErrARCStructure, i+1)
+		} else if s.aar.raw == nil || s.ams.raw == nil || s.seal.raw == nil {
+			return nil, fmt.Errorf("%w: incomplete ARC set for instance %d", ErrARCStructure, i+1)
+		}
+		l[i] = *s
+	}
+	return l, nil
+}
+
+// sealHash calculates the hash for an ARC-Seal over the headers of the ARC sets,
+// in relaxed canonicalization. The last header is the ARC-Seal being signed or
+// verified, with empty "b=" value and without trailing crlf.
+func sealHash(h hash.Hash, hdrs [][]byte) ([]byte, error) {
+	for i, hdr := range hdrs {
+		ch, err := relaxedCanonicalHeaderWithoutCRLF(string(hdr))
+		if err != nil {
+			return nil, fmt.Errorf("canonicalizing header: %w", err)
+		}
+		if i < len(hdrs)-1 {
+			ch += "\r\n"
+		}
+		h.Write([]byte(ch))
+	}
+	return h.Sum(nil), nil
+}
+
+// sealHeaders returns the headers to hash for the ARC-Seal of the last set.
+func sealHeaders(sets []arcSet) [][]byte {
+	var l [][]byte
+	for i, s := range sets {
+		l = append(l, s.aar.raw, s.ams.raw)
+		if i < len(sets)-1 {
+			l = append(l, s.seal.raw)
+		} else {
+			l = append(l, s.sealVerify)
+		}
+	}
+	return l
+}
+
+// ARCVerify validates the ARC chain of a message.
+//
+// Only the ARC-Message-Signature of the most recent ARC set is verified, along
+// with all ARC-Seals, as required for validating the chain.
+//
+// If the headers of the message cannot be parsed, an error is returned. Otherwise
+// the result, including validation failures, is returned in ARCResult.
+func ARCVerify(ctx context.Context, elog *slog.Logger, resolver dns.Resolver, smtputf8 bool, r io.ReaderAt) (result ARCResult, rerr error) {
+	log := mlog.New("dkim", elog)
+	start := timeNow()
+	defer func() {
+		err := rerr
+		if err == nil {
+			err = result.Err
+		}
+		log.Debugx("arc verify result", err,
+			slog.Bool("smtputf8", smtputf8),
+			slog.Any("status", result.Status),
+			slog.Int("instance", result.Instance),
+			slog.Duration("duration", time.Since(start)))
+	}()
+
+	hdrs, bodyOffset, err := parseHeaders(bufio.NewReader(&moxio.AtReader{R: r}))
+	if err != nil {
+		return ARCResult{}, fmt.Errorf("%w: %s", ErrHeaderMalformed, err)
+	}
+
+	xfail := func(err error) (ARCResult, error) {
+		return ARCResult{Status: ARCFail, Instance: result.Instance, Err: err}, nil
+	}
+
+	sets, err := parseARCSets(hdrs, smtputf8)
+	if err != nil {
+		return xfail(err)
+	} else if len(sets) == 0 {
+		return ARCResult{Status: ARCNone}, nil
+	}
+	result.Instance = len(sets)
+
+	// ../rfc/8617
+	for i, s := range sets {
+		cv := s.sealSig.ChainValidation
+		if cv == ARCFail {
+			return xfail(fmt.Errorf("%w: at instance %d", ErrARCChain, i+1))
+		} else if i == 0 && cv != ARCNone || i > 0 && cv != ARCPass {
+			return xfail(fmt.Errorf("%w: chain validation status %q for instance %d", ErrARCStructure, cv, i+1))
+		}
+	}
+
+	// Verify the most recent ARC-Message-Signature.
+	last := sets[len(sets)-1]
+	sig := last.amsSig
+	for _, h := range sig.SignedHeaders {
+		if strings.EqualFold(h, "arc-seal") {
+			return xfail(fmt.Errorf("%w: ARC-Seal must not be signed", ErrARCSignature))
+		}
+	}
+	h, canonHeaderSimple, canonDataSimple, err := checkSignatureParams(ctx, log, sig, true)
+	if err != nil {
+		return xfail(fmt.Errorf("%w: %w", ErrARCSignature, err))
+	}
+	body := func() ([]byte, error) {
+		br := bufio.NewReader(&moxio.AtReader{R: r, Offset: int64(bodyOffset)})
+		return bodyHash(h.New(), canonDataSimple, br)
+	}
+	status, _, _, err := verifySignature(ctx, log.Logger, resolver, sig, h, canonHeaderSimple, canonDataSimple, hdrs, last.amsVerifySig, body, true)
+	if err != nil {
+		return xfail(fmt.Errorf("%w: %w", ErrARCSignature, err))
+	} else if status != StatusPass {
+		return xfail(fmt.Errorf("%w: status %s", ErrARCSignature, status))
+	}
+
+	// Verify all seals, starting with the most recent.
+	for i := len(sets); i > 0; i-- {
+		if err := verifySeal(ctx, log, resolver, sets[:i]); err != nil {
+			return xfail(fmt.Errorf("%w: instance %d: %w", ErrARCSeal, i, err))
+		}
+	}
+
+	result.Status = ARCPass
+	for _, s := range sets {
+		result.Sealers = append(result.Sealers, s.sealSig.Domain)
+	}
+	return result, nil
+}
+
+// verifySeal verifies the ARC-Seal of the last set.
+func verifySeal(ctx context.Context, log mlog.Log, resolver dns.Resolver, sets []arcSet) error {
+	seal := sets[len(sets)-1].sealSig
+
+	h, ok := algHash(seal.AlgorithmHash)
+	if !ok {
+		return fmt.Errorf("%w: %q", ErrHashAlgorithmUnknown, seal.AlgorithmHash)
+	}
+
+	cache := DefaultCache
+	name := recordName(seal.Selector, seal.Domain)
+	var record *Record
+	var txt string
+	var err error
+	if cr, ok := cache.lookup(name); ok {
+		record, txt, err = cr.record, cr.txt, cr.err
+	} else {
+		var status Status
+		var authentic bool
+		status, record, txt, authentic, err = Lookup(ctx, log.Logger, resolver, seal.Selector, seal.Domain)
+		cache.add(name, status, record, txt, authentic, err)
+	}
+	if err != nil {
+		return err
+	}
+
+	if len(record.Hashes) > 0 {
+		ok := false
+		for _, rh := range record.Hashes {
+			if strings.EqualFold(rh, seal.AlgorithmHash) {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return fmt.Errorf("%w: dkim dns record expects one of %q, seal uses %q", ErrHashAlgNotAllowed, strings.Join(record.Hashes, ","), seal.AlgorithmHash)
+		}
+	}
+	if !strings.EqualFold(record.Key, seal.AlgorithmSign) {
+		return fmt.Errorf("%w: dkim dns record requires algorithm %q, seal has %q", ErrSigAlgMismatch, record.Key, seal.AlgorithmSign)
+	}
+	if record.PublicKey == nil {
+		return ErrKeyRevoked
+	} else if rsaKey, ok := record.PublicKey.(*rsa.PublicKey); ok && rsaKey.N.BitLen() < 1024 {
+		return ErrWeakKey
+	}
+	if !record.ServiceAllowed("email") {
+		return ErrKeyNotForEmail
+	}
+
+	dh, err := sealHash(h.New(), sealHeaders(sets))
+	if err != nil {
+		return err
+	}
+	if cache.isVerified(txt, dh, seal.Signature) {
+		return nil
+	}
+	switch k := record.PublicKey.(type) {
+	case *rsa.PublicKey:
+		if err := rsa.VerifyPKCS1v15(k, h, dh, seal.Signature); err != nil {
+			return fmt.Errorf("%w: rsa verification: %s", ErrSigVerify, err)
+		}
+	case ed25519.PublicKey:
+		if ok := ed25519.Verify(k, dh, seal.Signature); !ok {
+			return fmt.Errorf("%w: ed25519 verification", ErrSigVerify)
+		}
+	default:
+		return fmt.Errorf("%w: unrecognized signature algorithm %q", ErrSigAlgorithmUnknown, record.Key)
+	}
+	cache.addVerified(txt, dh, seal.Signature)
+	return nil
+}
+
+// ARCSeal returns the headers of a new ARC set for a message that is being
+// forwarded: an ARC-Seal, ARC-Message-Signature and ARC-Authentication-Results
+// header, to be prepended to the message.
+//
+// The instance of the new set is one higher than the ARC sets present in msg.
+// The existing ARC chain, if any, must have been validated with ARCVerify,
+// with status ARCPass, it is sealed with chain validation status "pass". The
+// authentication results are those evaluated for the incoming message.
+//
+// The ARC-Message-Signature signs the headers configured in the selector.
+// ARC-Seal headers are never signed.
+func ARCSeal(ctx context.Context, elog *slog.Logger, domain dns.Domain, sel Selector, authResults message.AuthResults, smtputf8 bool, msg io.ReaderAt) (headers string, rerr error) {
+	log := mlog.New("dkim", elog)
+	start := timeNow()
+	defer func() {
+		log.Debugx("arc seal result", rerr,
+			slog.Any("domain", domain),
+			slog.Any("selector", sel.Domain),
+			slog.Bool("smtputf8", smtputf8),
+			slog.Duration("duration", time.Since(start)))
+	}()
+
+	hdrs, bodyOffset, err := parseHeaders(bufio.NewReader(&moxio.AtReader{R: msg}))
+	if err != nil {
+		return "", fmt.Errorf("%w: %s", ErrHeaderMalformed, err)
+	}
+	sets, err := parseARCSets(hdrs, smtputf8)
+	if err != nil {
+		return "", err
+	}
+	instance := len(sets) + 1
+	if instance > ARCMaxInstance {
+		return "", fmt.Errorf("%w: already at maximum of %d instances", ErrARCStructure, ARCMaxInstance)
+	}
+	cv := ARCPass
+	if instance == 1 {
+		cv = ARCNone
+	}
+
+	var algSign string
+	switch sel.PrivateKey.(type) {
+	case *rsa.PrivateKey:
+		algSign = "rsa"
+	case ed25519.PrivateKey:
+		algSign = "ed25519"
+	default:
+		return "", fmt.Errorf("internal error, unknown pivate key %T", sel.PrivateKey)
+	}
+
+	sign := func(h crypto.Hash, dh []byte) ([]byte, error) {
+		switch key := sel.PrivateKey.(type) {
+		case *rsa.PrivateKey:
+			return key.Sign(cryptorand.Reader, dh, h)
+		case ed25519.PrivateKey:
+			// See Sign.
+			return key.Sign(cryptorand.Reader, dh, crypto.Hash(0))
+		}
+		panic("missing case")
+	}
+
+	// ARC-Message-Signature, like a DKIM-Signature.
+	sig := newSigWithDefaults()
+	sig.AlgorithmSign = algSign
+	sig.AlgorithmHash = sel.Hash
+	sig.Domain = domain
+	sig.Selector = sel.Domain
+	var signHeaders []string
+	for _, h := range sel.Headers {
+		if !strings.EqualFold(h, "arc-seal") {
+			signHeaders = append(signHeaders, h)
+		}
+	}
+	sig.SignedHeaders = append([]string{}, signHeaders...)
+	if sel.SealHeaders {
+		counts := map[string]int{}
+		for _, h := range hdrs {
+			counts[h.lkey]++
+		}
+		for _, h := range signHeaders {
+			for j := counts[strings.ToLower(h)]; j > 0; j-- {
+				sig.SignedHeaders = append(sig.SignedHeaders, h)
+			}
+		}
+	}
+	sig.SignTime = timeNow().Unix()
+	sig.Canonicalization = "simple"
+	if sel.HeaderRelaxed {
+		sig.Canonicalization = "relaxed"
+	}
+	sig.Canonicalization += "/"
+	if sel.BodyRelaxed {
+		sig.Canonicalization += "relaxed"
+	} else {
+		sig.Canonicalization += "simple"
+	}
+
+	h, hok := algHash(sig.AlgorithmHash)
+	if !hok {
+		return "", fmt.Errorf("unrecognized hash algorithm %q", sig.AlgorithmHash)
+	}
+	br := bufio.NewReader(&moxio.AtReader{R: msg, Offset: int64(bodyOffset)})
+	sig.BodyHash, err = bodyHash(h.New(), !sel.BodyRelaxed, br)
+	if err != nil {
+		return "", err
+	}
+	amsFirst := fmt.Sprintf("ARC-Message-Signature: i=%d;", instance)
+	amsh, err := sig.header(amsFirst)
+	if err != nil {
+		return "", err
+	}
+	dh, err := dataHash(h.New(), !sel.HeaderRelaxed, sig, hdrs, []byte(strings.TrimSuffix(amsh, "\r\n")))
+	if err != nil {
+		return "", err
+	}
+	sig.Signature, err = sign(h, dh)
+	if err != nil {
+		return "", fmt.Errorf("signing data: %v", err)
+	}
+	amsh, err = sig.header(amsFirst)
+	if err != nil {
+		return "", err
+	}
+
+	// ARC-Seal, over all ARC sets, including the new set.
+	aarh := authResults.ARCHeader(instance)
+	seal := &Seal{
+		Instance:        instance,
+		AlgorithmSign:   algSign,
+		AlgorithmHash:   "sha256",
+		ChainValidation: cv,
+		Domain:          domain,
+		Selector:        sel.Domain,
+		SignTime:        sig.SignTime,
+	}
+	sets = append(sets, arcSet{
+		aar:        header{raw: []byte(aarh)},
+		ams:        header{raw: []byte(amsh)},
+		sealVerify: []byte(strings.TrimSuffix(seal.Header(), "\r\n")),
+	})
+	dh, err = sealHash(crypto.SHA256.New(), sealHeaders(sets))
+	if err != nil {
+		return "", err
+	}
+	seal.Signature, err = sign(crypto.SHA256, dh)
+	if err != nil {
+		return "", fmt.Errorf("signing seal: %v", err)
+	}
+
+	return seal.Header() + amsh + aarh, nil
+}
@@ -0,0 +1,146 @@
+package dkim
+
+import (
+	"context"
+	"crypto/ed25519"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/mjl-/mox/dns"
+	"github.com/mjl-/mox/message"
+)
+
+func TestARC(t *testing.T) {
+	msg := strings.ReplaceAll(`From: <remote@remote.example>
+To: <list@mox.example>
+Subject: test
+Message-ID: <arc@remote.example>
+
+test
+`, "\n", "\r\n")
+
+	rsaKey := getRSAKey(t)
+	ed25519Key := ed25519.NewKeyFromSeed(make([]byte, 32))
+
+	headers := strings.Split("From,To,Subject,Message-ID", ",")
+	selrsa := Selector{
+		Hash:          "sha256",
+		HeaderRelaxed: true,
+		BodyRelaxed:   true,
+		PrivateKey:    rsaKey,
+		Headers:       headers,
+		SealHeaders:   true,
+		Domain:        dns.Domain{ASCII: "arcrsa"},
+	}
+	seled25519 := Selector{
+		Hash:       "sha256",
+		PrivateKey: ed25519Key,
+		Headers:    headers,
+		Domain:     dns.Domain{ASCII: "arced25519"},
+	}
+
+	makeRecord := func(k string, publicKey any) string {
+		tr := &Record{
+			Version:   "DKIM1",
+			Key:       k,
+			PublicKey: publicKey,
+		}
+		txt, err := tr.Record()
+		if err != nil {
+			t.Fatalf("making dns txt record: %s", err)
+		}
+		return txt
+	}
+	resolver := dns.MockResolver{
+		TXT: map[string][]string{
+			"arcrsa._domainkey.mox.example.":         {makeRecord("rsa", rsaKey.Public())},
+			"arced25519._domainkey.forward.example.": {makeRecord("ed25519", ed25519Key.Public())},
+		},
+	}
+
+	ctx := context.Background()
+
+	verify := func(msg string, expStatus ARCStatus, expInstance int, expErr error) ARCResult {
+		t.Helper()
+		result, err := ARCVerify(ctx, pkglog.Logger, resolver, false, strings.NewReader(msg))
+		if err != nil {
+			t.Fatalf("arc verify: %v", err)
+		}
+		if result.Status != expStatus || result.Instance != expInstance || (expErr == nil) != (result.Err == nil) || expErr != nil && !errors.Is(result.Err, expErr) {
+			t.Fatalf("arc verify: got %v, expected status %s, instance %d, err %v\nmessage:\n%s", result, expStatus, expInstance, expErr, msg)
+		}
+		return result
+	}
+
+	verify(msg, ARCNone, 0, nil)
+
+	authResults := message.AuthResults{
+		Hostname: "mox.example",
+		Methods: []message.AuthMethod{
+			{Method: "spf", Result: "pass", Props: []message.AuthProp{message.MakeAuthProp("smtp", "mailfrom", "remote.example", true, "")}},
+		},
+	}
+
+	seal := func(msg string, domain string, sel Selector) string {
+		t.Helper()
+		headers, err := ARCSeal(ctx, pkglog.Logger, dns.Domain{ASCII: domain}, sel, authResults, false, strings.NewReader(msg))
+		if err != nil {
+			t.Fatalf("arc seal: %v", err)
+		}
+		return headers + msg
+	}
+
+	msg1 := seal(msg, "mox.example", selrsa)
+	if !strings.HasPrefix(msg1, "ARC-Seal: i=1; a=rsa-sha256;") || !strings.Contains(msg1, "cv=none;") || !strings.Contains(msg1, "\r\nARC-Message-Signature: i=1;") || !strings.Contains(msg1, "\r\nARC-Authentication-Results: i=1; mox.example;") {
+		t.Fatalf("unexpected arc headers:\n%s", msg1)
+	}
+	verify(msg1, ARCPass, 1, nil)
+
+	// Modifying the message after sealing invalidates the message signature.
+	verify(strings.Replace(msg1, "Subject: test", "Subject: changed", 1), ARCFail, 1, ErrARCSignature)
+
+	// Modifying the authentication results invalidates the seal.
+	verify(strings.Replace(msg1, "spf=pass", "spf=fail", 1), ARCFail, 1, ErrARCSeal)
+
+	// Second instance, with a modified message, e.g. by a mailing list. The chain
+	// passes because the seal of the first instance still validates.
+	msg1b := "List-Id: <list.mox.example>\r\n" + strings.Replace(msg1, "\r\n\r\ntest\r\n", "\r\n\r\ntest\r\n--\r\nfooter\r\n", 1)
+	msg2 := seal(msg1b, "forward.example", seled25519)
+	if !strings.Contains(msg2, "ARC-Seal: i=2; a=ed25519-sha256;") || !strings.Contains(msg2, "cv=pass;") {
+		t.Fatalf("unexpected arc headers:\n%s", msg2)
+	}
+	result := verify(msg2, ARCPass, 2, nil)
+	if len(result.Sealers) != 2 || result.Sealers[0].ASCII != "mox.example" || result.Sealers[1].ASCII != "forward.example" {
+		t.Fatalf("unexpected sealers %v", result.Sealers)
+	}
+
+	// Removing an ARC header breaks the chain.
+	verify(strings.Replace(msg2, "ARC-Authentication-Results: i=1;", "X-Removed: i=1;", 1), ARCFail, 0, ErrARCStructure)
+
+	// Chain with status fail.
+	verify(strings.Replace(msg2, "cv=pass;", "cv=fail;", 1), ARCFail, 2, ErrARCChain)
+
+	// Sealing a message with an invalid chain fails.
+	_, err := ARCSeal(ctx, pkglog.Logger, dns.Domain{ASCII: "mox.example"}, selrsa, authResults, false, strings.NewReader("ARC-Seal: i=2; a=rsa-sha256; cv=pass; d=mox.example; s=arcrsa; b=\r\n"+msg))
+	if !errors.Is(err, ErrARCStructure) {
+		t.Fatalf("arc seal: got err %v, expected ErrARCStructure", err)
+	}
+}
+
+func TestParseSeal(t *testing.T) {
+	test := func(s string, expErr error) {
+		t.Helper()
+		_, _, err := parseSeal([]byte(s), false)
+		if (err == nil) != (expErr == nil) || expErr != nil && !errors.Is(err, expErr) {
+			t.Fatalf("parsing seal %q: got err %v, expected %v", s, err, expErr)
+		}
+	}
+	test("ARC-Seal: i=1; a=rsa-sha256; t=1; cv=none; d=mox.example; s=test; b=dGVzdAo=\r\n", nil)
+	test("ARC-Seal: i=1; a=rsa-sha256; cv=none; d=mox.example; s=test; b=dGVzdAo=", errSigMissingCRLF)
+	test("DKIM-Signature: i=1; a=rsa-sha256; cv=none; d=mox.example; s=test; b=dGVzdAo=\r\n", errARCSealHeader)
+	test("ARC-Seal: i=1; a=rsa-sha256; cv=none; d=mox.example; s=test\r\n", errSigMissingTag)
+	test("ARC-Seal: i=1; a=rsa-sha256; cv=bogus; d=mox.example; s=test; b=dGVzdAo=\r\n", errARCSealCV)
+	test("ARC-Seal: i=1; a=rsa-sha256; cv=none; d=mox.example; s=test; h=from; b=dGVzdAo=\r\n", errARCSealHeaders)
+	test("ARC-Seal: i=1; i=1; a=rsa-sha256; cv=none; d=mox.example; s=test; b=dGVzdAo=\r\n", errSigDuplicateTag)
+}
@@ -0,0 +1,149 @@
+package dkim
+
+import (
+	"crypto/sha256"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/mjl-/mox/dns"
+)
+
+// DefaultCache is used by Verify for DKIM records and verified signatures, if
+// set. Mox sets it when serving, so bursts of similar messages, e.g. from
+// mailing lists, don't require a DNS lookup and public key operation for each
+// message.
+var DefaultCache *Cache
+
+// Cache holds recently looked up DKIM records and signatures that verified. The
+// DNS resolver does not expose the TTL of records, so records are cached for a
+// fixed lifetime, which should be well below typical TTLs of DKIM records. Only
+// successful lookups and lookups for non-existent records are cached, not
+// temporary errors.
+//
+// A Cache is safe for concurrent use.
+type Cache struct {
+	lifetime time.Duration
+	size     int
+
+	mutex      sync.Mutex
+	records    map[string]cachedRecord         // Keyed by DNS name.
+	signatures map[[sha256.Size]byte]time.Time // Hash over record, data hash and signature, to expiration time.
+}
+
+type cachedRecord struct {
+	status    Status
+	record    *Record
+	txt       string
+	authentic bool
+	err       error
+	expires   time.Time
+}
+
+// NewCache returns a new cache that keeps records and verified signatures for
+// lifetime, and at most size of each.
+func NewCache(lifetime time.Duration, size int) *Cache {
+	return &Cache{
+		lifetime:   lifetime,
+		size:       max(size, 1),
+		records:    map[string]cachedRecord{},
+		signatures: map[[sha256.Size]byte]time.Time{},
+	}
+}
+
+// lookup returns a cached lookup result for name, if present.
+func (c *Cache) lookup(name string) (cr cachedRecord, ok bool) {
+	if c == nil {
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	cr, ok = c.records[name]
+	if ok && !timeNow().Before(cr.expires) {
+		delete(c.records, name)
+		ok = false
+	} else if ok {
+		MetricCacheHit.IncLabels("record")
+	}
+	return
+}
+
+// add adds the result of a lookup, unless it is a temporary error.
+func (c *Cache) add(name string, status Status, record *Record, txt string, authentic bool, err error) {
+	if c == nil || err != nil && !errors.Is(err, ErrNoRecord) {
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	now := timeNow()
+	if len(c.records) >= c.size {
+		for k, cr := range c.records {
+			if !now.Before(cr.expires) {
+				delete(c.records, k)
+			}
+		}
+		if len(c.records) >= c.size {
+			c.records = map[string]cachedRecord{}
+		}
+	}
+	c.records[name] = cachedRecord{status, record, txt, authentic, err, now.Add(c.lifetime)}
+}
+
+func signatureKey(txt string, dh, signature []byte) (k [sha256.Size]byte) {
+	h := sha256.New()
+	h.Write([]byte(txt))
+	h.Write([]byte{0})
+	h.Write(dh)
+	h.Write([]byte{0})
+	h.Write(signature)
+	copy(k[:], h.Sum(nil))
+	return
+}
+
+// isVerified returns whether signature over data hash dh was recently verified
+// with the key in DKIM record txt.
+func (c *Cache) isVerified(txt string, dh, signature []byte) bool {
+	if c == nil {
+		return false
+	}
+	k := signatureKey(txt, dh, signature)
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	expires, ok := c.signatures[k]
+	if ok && !timeNow().Before(expires) {
+		delete(c.signatures, k)
+		ok = false
+	} else if ok {
+		MetricCacheHit.IncLabels("signature")
+	}
+	return ok
+}
+
+// addVerified marks a signature over data hash dh as verified with the key in
+// DKIM record txt.
+func (c *Cache) addVerified(txt string, dh, signature []byte) {
+	if c == nil {
+		return
+	}
+	k := signatureKey(txt, dh, signature)
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	now := timeNow()
+	if len(c.signatures) >= c.size {
+		for k, expires := range c.signatures {
+			if !now.Before(expires) {
+				delete(c.signatures, k)
+			}
+		}
+		if len(c.signatures) >= c.size {
+			c.signatures = map[[sha256.Size]byte]time.Time{}
+		}
+	}
+	c.signatures[k] = now.Add(c.lifetime)
+}
+
+// recordName returns the DNS name for the DKIM record for selector and domain.
+func recordName(selector, domain dns.Domain) string {
+	return selector.ASCII + "._domainkey." + domain.ASCII + "."
+}
@@ -0,0 +1,87 @@
+package dkim
+
+import (
+	"context"
+	"crypto/ed25519"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mjl-/mox/dns"
+)
+
+func TestCache(t *testing.T) {
+	message := strings.ReplaceAll(`Message-ID: <427999f6-114f-e59c-631e-ab2a5f6bfe4c@ueber.net>
+Date: Fri, 10 Dec 2021 20:09:08 +0100
+To: mechiel@ueber.net
+From: Mechiel Lukkien <mechiel@ueber.net>
+Subject: test
+
+test
+`, "\n", "\r\n")
+
+	key := ed25519.NewKeyFromSeed(make([]byte, 32))
+	sel := Selector{
+		Hash:       "sha256",
+		PrivateKey: key,
+		Headers:    strings.Split("From,To,Subject,Date,Message-ID", ","),
+		Domain:     dns.Domain{ASCII: "test"},
+	}
+	ctx := context.Background()
+	headers, err := Sign(ctx, pkglog.Logger, "mjl", dns.Domain{ASCII: "mox.example"}, []Selector{sel}, false, strings.NewReader(message))
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	tr := &Record{Version: "DKIM1", Key: "ed25519", PublicKey: key.Public()}
+	txt, err := tr.Record()
+	if err != nil {
+		t.Fatalf("making dns txt record: %s", err)
+	}
+	resolver := dns.MockResolver{
+		TXT: map[string][]string{
+			"test._domainkey.mox.example.": {txt},
+		},
+	}
+
+	now := time.Now()
+	timeNow = func() time.Time { return now }
+	DefaultCache = NewCache(time.Minute, 10)
+	defer func() {
+		timeNow = time.Now
+		DefaultCache = nil
+	}()
+
+	verify := func(resolver dns.Resolver, msg string, expStatus Status, expErr error) {
+		t.Helper()
+		results, err := Verify(ctx, pkglog.Logger, resolver, false, policyOK, strings.NewReader(msg), false)
+		if err != nil {
+			t.Fatalf("verify: %v", err)
+		}
+		if len(results) != 1 || results[0].Status != expStatus || (expErr == nil) != (results[0].Err == nil) || expErr != nil && !errors.Is(results[0].Err, expErr) {
+			t.Fatalf("verify: got %v, expected status %s, err %v", results, expStatus, expErr)
+		}
+	}
+
+	verify(resolver, headers+message, StatusPass, nil)
+
+	// Record and verified signature are cached, no DNS lookup needed.
+	verify(dns.MockResolver{}, headers+message, StatusPass, nil)
+
+	// The body hash is still verified, even though the signature is cached.
+	verify(dns.MockResolver{}, headers+strings.Replace(message, "test\r\n\r\n", "test\r\n\r\nmodified ", 1), StatusFail, ErrBodyhashMismatch)
+
+	// After the lifetime, the record is looked up again.
+	now = now.Add(time.Minute)
+	verify(dns.MockResolver{}, headers+message, StatusPermerror, ErrNoRecord)
+
+	// Non-existent records are cached too.
+	verify(resolver, headers+message, StatusPermerror, ErrNoRecord)
+	now = now.Add(time.Minute)
+	verify(resolver, headers+message, StatusPass, nil)
+
+	// Temporary errors are not cached.
+	now = now.Add(time.Minute)
+	verify(dns.MockResolver{Fail: []string{"txt test._domainkey.mox.example."}}, headers+message, StatusTemperror, ErrDNS)
+	verify(resolver, headers+message, StatusPass, nil)
+}
@@ -7,6 +7,9 @@
 // match a domain in a From header. Receiving mail servers can build a spaminess
 // reputation based on domains that signed the message, along with other
 // mechanisms.
+//
+// The package also validates and seals ARC chains (Authenticated Received
+// Chain, RFC 8617), which build on DKIM signatures.
 package dkim
 
 import (
@@ -37,8 +40,9 @@ import (
 var Localserve bool
 
 var (
-	MetricSign   stub.CounterVec   = stub.CounterVecIgnore{}
-	MetricVerify stub.HistogramVec = stub.HistogramVecIgnore{}
+	MetricSign     stub.CounterVec   = stub.CounterVecIgnore{}
+	MetricVerify   stub.HistogramVec = stub.HistogramVecIgnore{}
+	MetricCacheHit stub.CounterVec   = stub.CounterVecIgnore{}
 )
 
 var timeNow = time.Now // Replaced during tests.
@@ -286,7 +290,7 @@ func Lookup(ctx context.Context, elog *slog.Logger, resolver dns.Resolver, selec
 			slog.Duration("duration", time.Since(start)))
 	}()
 
-	name := selector.ASCII + "._domainkey." + domain.ASCII + "."
+	name := recordName(selector, domain)
 	records, lookupResult, err := dns.WithPackage(resolver, "dkim").LookupTXT(ctx, name)
 	if dns.IsNotFound(err) {
 		// ../rfc/6376:2608
@@ -379,7 +383,15 @@ func Verify(ctx context.Context, elog *slog.Logger, resolver dns.Resolver, smtpu
 		return nil, fmt.Errorf("%w: %s", ErrHeaderMalformed, err)
 	}
 
-	// todo: reuse body hashes and possibly verify signatures in parallel. and start the dns lookup immediately. ../rfc/6376:2697
+	// todo: possibly verify signatures in parallel. and start the dns lookup immediately. ../rfc/6376:2697
+
+	// Body hashes are reused for signatures with the same canonicalization and hash
+	// algorithm.
+	type hashKey struct {
+		simple bool
+		hash   crypto.Hash
+	}
+	bodyHashes := map[hashKey][]byte{}
 
 	for _, h := range hdrs {
 		if h.lkey != "dkim-signature" {
@@ -394,7 +406,7 @@ func Verify(ctx context.Context, elog *slog.Logger, resolver dns.Resolver, smtpu
 			continue
 		}
 
-		h, canonHeaderSimple, canonDataSimple, err := checkSignatureParams(ctx, log, sig)
+		h, canonHeaderSimple, canonDataSimple, err := checkSignatureParams(ctx, log, sig, false)
 		if err != nil {
 			results = append(results, Result{StatusPermerror, sig, nil, false, err})
 			continue
@@ -407,17 +419,30 @@ func Verify(ctx context.Context, elog *slog.Logger, resolver dns.Resolver, smtpu
 			continue
 		}
 
-		br := bufio.NewReader(&moxio.AtReader{R: r, Offset: int64(bodyOffset)})
-		status, txt, authentic, err := verifySignature(ctx, log.Logger, resolver, sig, h, canonHeaderSimple, canonDataSimple, hdrs, verifySig, br, ignoreTestMode)
-		results = append(results, Result{status, sig, txt, authentic, err})
+		body := func() ([]byte, error) {
+			hk := hashKey{canonDataSimple, h}
+			if bh, ok := bodyHashes[hk]; ok {
+				return bh, nil
+			}
+			br := bufio.NewReader(&moxio.AtReader{R: r, Offset: int64(bodyOffset)})
+			bh, err := bodyHash(h.New(), canonDataSimple, br)
+			if err == nil {
+				bodyHashes[hk] = bh
+			}
+			return bh, err
+		}
+		status, record, authentic, err := verifySignature(ctx, log.Logger, resolver, sig, h, canonHeaderSimple, canonDataSimple, hdrs, verifySig, body, ignoreTestMode)
+		results = append(results, Result{status, sig, record, authentic, err})
 	}
 	return results, nil
 }
 
 // check if signature is acceptable.
 // Only looks at the signature parameters, not at the DNS record.
-func checkSignatureParams(ctx context.Context, log mlog.Log, sig *Sig) (hash crypto.Hash, canonHeaderSimple, canonBodySimple bool, rerr error) {
+// For an ARC-Message-Signature, arc must be set.
+func checkSignatureParams(ctx context.Context, log mlog.Log, sig *Sig, arc bool) (hash crypto.Hash, canonHeaderSimple, canonBodySimple bool, rerr error) {
 	// "From" header is required, ../rfc/6376:2122 ../rfc/6376:2546
+	// Not for ARC, ../rfc/8617
 	var from bool
 	for _, h := range sig.SignedHeaders {
 		if strings.EqualFold(h, "from") {
@@ -425,7 +450,7 @@ func checkSignatureParams(ctx context.Context, log mlog.Log, sig *Sig) (hash cry
 			break
 		}
 	}
-	if !from {
+	if !from && !arc {
 		return 0, false, false, fmt.Errorf(`%w: required "from" header not signed`, ErrFrom)
 	}
 
@@ -493,20 +518,34 @@ func checkSignatureParams(ctx context.Context, log mlog.Log, sig *Sig) (hash cry
 	return h, canonHeaderSimple, canonBodySimple, nil
 }
 
-// lookup the public key in the DNS and verify the signature.
-func verifySignature(ctx context.Context, elog *slog.Logger, resolver dns.Resolver, sig *Sig, hash crypto.Hash, canonHeaderSimple, canonDataSimple bool, hdrs []header, verifySig []byte, body *bufio.Reader, ignoreTestMode bool) (Status, *Record, bool, error) {
-	// ../rfc/6376:2604
-	status, record, _, authentic, err := Lookup(ctx, elog, resolver, sig.Selector, sig.Domain)
+// lookup the public key in the DNS, or in DefaultCache, and verify the signature.
+func verifySignature(ctx context.Context, elog *slog.Logger, resolver dns.Resolver, sig *Sig, hash crypto.Hash, canonHeaderSimple, canonDataSimple bool, hdrs []header, verifySig []byte, body func() ([]byte, error), ignoreTestMode bool) (Status, *Record, bool, error) {
+	cache := DefaultCache
+	name := recordName(sig.Selector, sig.Domain)
+	var status Status
+	var record *Record
+	var txt string
+	var authentic bool
+	var err error
+	if cr, ok := cache.lookup(name); ok {
+		status, record, txt, authentic, err = cr.status, cr.record, cr.txt, cr.authentic, cr.err
+	} else {
+		// ../rfc/6376:2604
+		status, record, txt, authentic, err = Lookup(ctx, elog, resolver, sig.Selector, sig.Domain)
+		cache.add(name, status, record, txt, authentic, err)
+	}
 	if err != nil {
 		// todo: for temporary errors, we could pass on information so caller returns a 4.7.5 ecode, ../rfc/6376:2777
 		return status, nil, authentic, err
 	}
-	status, err = verifySignatureRecord(record, sig, hash, canonHeaderSimple, canonDataSimple, hdrs, verifySig, body, ignoreTestMode)
+	status, err = verifySignatureRecord(cache, record, txt, sig, hash, canonHeaderSimple, canonDataSimple, hdrs, verifySig, body, ignoreTestMode)
 	return status, record, authentic, err
 }
 
-// verify a DKIM signature given the record from dns and signature from the email message.
-func verifySignatureRecord(r *Record, sig *Sig, hash crypto.Hash, canonHeaderSimple, canonDataSimple bool, hdrs []header, verifySig []byte, body *bufio.Reader, ignoreTestMode bool) (rstatus Status, rerr error) {
+// verify a DKIM signature given the record from dns and signature from the email
+// message. If cache is not nil, it is used to skip verifying signatures that
+// recently verified.
+func verifySignatureRecord(cache *Cache, r *Record, txt string, sig *Sig, hash crypto.Hash, canonHeaderSimple, canonDataSimple bool, hdrs []header, verifySig []byte, body func() ([]byte, error), ignoreTestMode bool) (rstatus Status, rerr error) {
 	if !ignoreTestMode {
 		// ../rfc/6376:1558
 		y := false
@@ -583,20 +622,23 @@ func verifySignatureRecord(r *Record, sig *Sig, hash crypto.Hash, canonHeaderSim
 		return StatusPermerror, fmt.Errorf("calculating data hash: %w", err)
 	}
 
-	switch k := r.PublicKey.(type) {
-	case *rsa.PublicKey:
-		if err := rsa.VerifyPKCS1v15(k, hash, dh, sig.Signature); err != nil {
-			return StatusFail, fmt.Errorf("%w: rsa verification: %s", ErrSigVerify, err)
-		}
-	case ed25519.PublicKey:
-		if ok := ed25519.Verify(k, dh, sig.Signature); !ok {
-			return StatusFail, fmt.Errorf("%w: ed25519 verification", ErrSigVerify)
+	if !cache.isVerified(txt, dh, sig.Signature) {
+		switch k := r.PublicKey.(type) {
+		case *rsa.PublicKey:
+			if err := rsa.VerifyPKCS1v15(k, hash, dh, sig.Signature); err != nil {
+				return StatusFail, fmt.Errorf("%w: rsa verification: %s", ErrSigVerify, err)
+			}
+		case ed25519.PublicKey:
+			if ok := ed25519.Verify(k, dh, sig.Signature); !ok {
+				return StatusFail, fmt.Errorf("%w: ed25519 verification", ErrSigVerify)
+			}
+		default:
+			return StatusPermerror, fmt.Errorf("%w: unrecognized signature algorithm %q", ErrSigAlgorithmUnknown, r.Key)
 		}
-	default:
-		return StatusPermerror, fmt.Errorf("%w: unrecognized signature algorithm %q", ErrSigAlgorithmUnknown, r.Key)
+		cache.addVerified(txt, dh, sig.Signature)
 	}
 
-	bh, err := bodyHash(hash.New(), canonDataSimple, body)
+	bh, err := body()
 	if err != nil {
 		// Any error is likely some internal error, hence temporary error.
 		return StatusTemperror, fmt.Errorf("calculating body hash: %w", err)
@@ -77,10 +77,16 @@ func (s Sig) Algorithm() string {
 // Header returns the DKIM-Signature header in string form, to be prepended to a
 // message, including DKIM-Signature field name and trailing \r\n.
 func (s *Sig) Header() (string, error) {
+	return s.header(fmt.Sprintf("DKIM-Signature: v=%d;", s.Version))
+}
+
+// header returns the signature header, starting with first, which holds the field
+// name and the first tag.
+func (s *Sig) header(first string) (string, error) {
 	// ../rfc/6376:1021
 	// todo: make a higher-level writer that accepts pairs, and only folds to next line when needed.
 	w := &message.HeaderWriter{}
-	w.Addf("", "DKIM-Signature: v=%d;", s.Version)
+	w.Add("", first)
 	// Domain names must always be in ASCII. ../rfc/6376:1115 ../rfc/6376:1187 ../rfc/6376:1303
 	w.Addf(" ", "d=%s;", s.Domain.ASCII)
 	w.Addf(" ", "s=%s;", s.Selector.ASCII)
@@ -173,6 +179,7 @@ func packQpHdrValue(s string) string {
 
 var (
 	errSigHeader         = errors.New("not DKIM-Signature header")
+	errARCHeader         = errors.New("not ARC-Message-Signature header")
 	errSigDuplicateTag   = errors.New("duplicate tag")
 	errSigMissingCRLF    = errors.New("missing crlf at end")
 	errSigExpired        = errors.New("signature timestamp (t=) must be before signature expiration (x=)")
@@ -182,6 +189,13 @@ var (
 	errSigBodyHash       = errors.New("bad body hash size given algorithm")
 )
 
+// ParseSignature parses a DKIM-Signature header field, including the field name
+// and ending in crlf, as it occurs in a message.
+func ParseSignature(buf []byte, smtputf8 bool) (*Sig, error) {
+	sig, _, err := parseSignature(buf, smtputf8)
+	return sig, err
+}
+
 // parseSignatures returns the parsed form of a DKIM-Signature header.
 //
 // buf must end in crlf, as it should have occurred in the mail message.
@@ -189,11 +203,21 @@ var (
 // The dkim signature with signature left empty ("b=") and without trailing
 // crlf is returned, for use in verification.
 func parseSignature(buf []byte, smtputf8 bool) (sig *Sig, verifySig []byte, err error) {
+	sig, _, verifySig, err = parseSig(buf, smtputf8, false)
+	return
+}
+
+// parseSig parses a DKIM-Signature header, or if arc is set, an
+// ARC-Message-Signature header. The latter has the same syntax, but has an ARC
+// instance number in the "i" tag instead of an identity, and no "v" tag.
+// ../rfc/8617
+func parseSig(buf []byte, smtputf8, arc bool) (sig *Sig, instance int, verifySig []byte, err error) {
 	defer func() {
 		if x := recover(); x == nil {
 			return
 		} else if xerr, ok := x.(error); ok {
 			sig = nil
+			instance = 0
 			verifySig = nil
 			err = xerr
 		} else {
@@ -214,8 +238,10 @@ func parseSignature(buf []byte, smtputf8 bool) (sig *Sig, verifySig []byte, err
 	seen := map[string]struct{}{}
 	p := parser{s: string(buf), smtputf8: smtputf8}
 	name := p.xhdrName(false)
-	if !strings.EqualFold(name, "DKIM-Signature") {
+	if !arc && !strings.EqualFold(name, "DKIM-Signature") {
 		xerrorf("%w", errSigHeader)
+	} else if arc && !strings.EqualFold(name, "ARC-Message-Signature") {
+		xerrorf("%w", errARCHeader)
 	}
 	p.wsp()
 	p.xtake(":")
@@ -241,17 +267,21 @@ func parseSignature(buf []byte, smtputf8 bool) (sig *Sig, verifySig []byte, err
 		seen[k] = struct{}{}
 
 		// ../rfc/6376:1021
-		switch k {
-		case "v":
+		switch {
+		case k == "i" && arc:
+			// ../rfc/8617
+			instance = int(p.xnumber(2))
+		case k == "v" && !arc:
+			// For ARC-Message-Signature, "v" is not defined and handled as unknown tag. ../rfc/8617
 			// ../rfc/6376:1025
 			ds.Version = int(p.xnumber(10))
 			if ds.Version != 1 {
 				xerrorf("%w: version %d", errSigUnknownVersion, ds.Version)
 			}
-		case "a":
+		case k == "a":
 			// ../rfc/6376:1038
 			ds.AlgorithmSign, ds.AlgorithmHash = p.xalgorithm()
-		case "b":
+		case k == "b":
 			// ../rfc/6376:1054
 			// To calculate the hash, we have to feed the DKIM-Signature header to the hash
 			// function, but with the value for "b=" (the signature) left out. The parser
@@ -270,39 +300,39 @@ func parseSignature(buf []byte, smtputf8 bool) (sig *Sig, verifySig []byte, err
 			ds.Signature = p.xbase64()
 			p.fws()
 			p.drop = false
-		case "bh":
+		case k == "bh":
 			// ../rfc/6376:1076
 			ds.BodyHash = p.xbase64()
-		case "c":
+		case k == "c":
 			// ../rfc/6376:1088
 			ds.Canonicalization = p.xcanonical()
 			// ../rfc/6376:810
-		case "d":
+		case k == "d":
 			// ../rfc/6376:1105
 			ds.Domain = p.xdomain()
-		case "h":
+		case k == "h":
 			// ../rfc/6376:1134
 			ds.SignedHeaders = p.xsignedHeaderFields()
-		case "i":
+		case k == "i":
 			// ../rfc/6376:1171
 			id := p.xauid()
 			ds.Identity = &id
-		case "l":
+		case k == "l":
 			// ../rfc/6376:1244
 			ds.Length = p.xbodyLength()
-		case "q":
+		case k == "q":
 			// ../rfc/6376:1268
 			ds.QueryMethods = p.xqueryMethods()
-		case "s":
+		case k == "s":
 			// ../rfc/6376:1300
 			ds.Selector = p.xselector()
-		case "t":
+		case k == "t":
 			// ../rfc/6376:1310
 			ds.SignTime = p.xtimestamp()
-		case "x":
+		case k == "x":
 			// ../rfc/6376:1327
 			ds.ExpireTime = p.xtimestamp()
-		case "z":
+		case k == "z":
 			// ../rfc/6376:1361
 			ds.CopiedHeaders = p.xcopiedHeaderFields()
 		default:
@@ -325,6 +355,9 @@ func parseSignature(buf []byte, smtputf8 bool) (sig *Sig, verifySig []byte, err
 
 	// ../rfc/6376:2532
 	required := []string{"v", "a", "b", "bh", "d", "h", "s"}
+	if arc {
+		required[0] = "i"
+	}
 	for _, req := range required {
 		if _, ok := seen[req]; !ok {
 			xerrorf("%w: %q", errSigMissingTag, req)
@@ -349,5 +382,5 @@ func parseSignature(buf []byte, smtputf8 bool) (sig *Sig, verifySig []byte, err
 		xerrorf("%w: identity domain %q not under domain %q", errSigIdentityDomain, ds.Identity.Domain.ASCII, ds.Domain.ASCII)
 	}
 
-	return ds, []byte(p.tracked), nil
+	return ds, instance, []byte(p.tracked), nil
 }
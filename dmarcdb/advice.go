@@ -0,0 +1,146 @@
+package dmarcdb
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/mjl-/mox/dmarcrpt"
+)
+
+// Parameters for the DMARC policy advisor.
+const (
+	advicePeriod      = 30 * 24 * time.Hour // Reports in this period are analyzed.
+	adviceMinCoverage = 28 * 24 * time.Hour // Reports must span at least this period before a stricter policy is recommended.
+	adviceMaxFraction = 0.01                // Maximum fraction of unaligned messages, e.g. due to forwarding, for a stricter policy.
+	adviceMaxSources  = 10                  // Maximum number of unaligned sources returned.
+)
+
+// Advice is a recommendation for the DMARC policy of one of our domains, based on
+// incoming DMARC aggregate reports.
+type Advice struct {
+	Domain string
+
+	// Period covered by the analyzed reports.
+	Start time.Time
+	End   time.Time
+
+	Reports   int
+	Messages  int
+	Unaligned int // Messages without aligned DKIM pass and without aligned SPF pass.
+
+	// Sources of unaligned messages, most messages first.
+	UnalignedSources []AdviceSource
+
+	// Policy and percentage as published in the most recent report, and the
+	// recommended policy. The recommended policy is empty when there is not enough
+	// information for a recommendation.
+	PublishedPolicy     dmarcrpt.Disposition
+	PublishedPercentage int
+	RecommendedPolicy   dmarcrpt.Disposition
+
+	// Human-readable recommendation.
+	Recommendation string
+}
+
+// AdviceSource is an IP that sent messages that were not aligned.
+type AdviceSource struct {
+	IP       string
+	Messages int
+}
+
+// DomainAdvice analyzes the reports for domain of the past 30 days and returns a
+// recommendation for its DMARC policy. A stricter policy is only recommended when
+// reports span nearly the whole period, and nearly all messages had an aligned
+// DKIM or SPF pass.
+func DomainAdvice(ctx context.Context, domain string, now time.Time) (Advice, error) {
+	a := Advice{Domain: domain}
+
+	reports, err := RecordsPeriodDomain(ctx, now.Add(-advicePeriod), now, domain)
+	if err != nil {
+		return a, fmt.Errorf("fetching reports: %v", err)
+	}
+
+	var latestEnd int64
+	sources := map[string]int{}
+	for _, r := range reports {
+		dr := r.ReportMetadata.DateRange
+		begin := time.Unix(dr.Begin, 0)
+		end := time.Unix(dr.End, 0)
+		if a.Start.IsZero() || begin.Before(a.Start) {
+			a.Start = begin
+		}
+		if end.After(a.End) {
+			a.End = end
+		}
+		if dr.End >= latestEnd {
+			latestEnd = dr.End
+			a.PublishedPolicy = r.PolicyPublished.Policy
+			a.PublishedPercentage = r.PolicyPublished.Percentage
+		}
+		a.Reports++
+
+		for _, record := range r.Records {
+			n := record.Row.Count
+			a.Messages += n
+			pe := record.Row.PolicyEvaluated
+			if pe.DKIM != dmarcrpt.DMARCPass && pe.SPF != dmarcrpt.DMARCPass {
+				a.Unaligned += n
+				sources[record.Row.SourceIP] += n
+			}
+		}
+	}
+
+	for ip, n := range sources {
+		a.UnalignedSources = append(a.UnalignedSources, AdviceSource{ip, n})
+	}
+	sort.Slice(a.UnalignedSources, func(i, j int) bool {
+		si, sj := a.UnalignedSources[i], a.UnalignedSources[j]
+		if si.Messages != sj.Messages {
+			return si.Messages > sj.Messages
+		}
+		return si.IP < sj.IP
+	})
+	if len(a.UnalignedSources) > adviceMaxSources {
+		a.UnalignedSources = a.UnalignedSources[:adviceMaxSources]
+	}
+
+	days := int(a.End.Sub(a.Start) / (24 * time.Hour))
+	switch {
+	case a.Reports == 0 || a.Messages == 0:
+		a.Recommendation = "No DMARC aggregate reports with messages for the past 30 days. Ensure the DMARC DNS record requests aggregate reports with a reporting address (rua), and start with policy p=none until reports have been received."
+		return a, nil
+	case a.End.Sub(a.Start) < adviceMinCoverage:
+		a.RecommendedPolicy = a.PublishedPolicy
+		a.Recommendation = fmt.Sprintf("Reports only cover %d days, keep the current policy until reports cover at least 28 days.", days)
+		return a, nil
+	case float64(a.Unaligned) > adviceMaxFraction*float64(a.Messages):
+		a.RecommendedPolicy = a.PublishedPolicy
+		a.Recommendation = fmt.Sprintf("%d of %d messages (%.1f%%) from %d sources did not have an aligned DKIM or SPF pass. Ensure all legitimate sources sign messages with DKIM for the domain or are in its SPF record before moving to a stricter policy.", a.Unaligned, a.Messages, 100*float64(a.Unaligned)/float64(a.Messages), len(sources))
+		return a, nil
+	}
+
+	var aligned string
+	if a.Unaligned == 0 {
+		aligned = fmt.Sprintf("All sources aligned for %d days", days)
+	} else {
+		aligned = fmt.Sprintf("All but %d of %d messages aligned for %d days, the remainder is likely forwarded", a.Unaligned, a.Messages, days)
+	}
+	switch a.PublishedPolicy {
+	case dmarcrpt.DispositionQuarantine:
+		a.RecommendedPolicy = dmarcrpt.DispositionReject
+		a.Recommendation = aligned + ", safe to move from p=quarantine to p=reject."
+	case dmarcrpt.DispositionReject:
+		a.RecommendedPolicy = dmarcrpt.DispositionReject
+		if a.PublishedPercentage > 0 && a.PublishedPercentage < 100 {
+			a.Recommendation = fmt.Sprintf("%s, safe to apply p=reject to all messages instead of pct=%d.", aligned, a.PublishedPercentage)
+		} else {
+			a.Recommendation = aligned + ", p=reject is already the strictest policy."
+		}
+	default:
+		a.RecommendedPolicy = dmarcrpt.DispositionQuarantine
+		a.Recommendation = aligned + ", safe to move from p=none to p=quarantine."
+	}
+	return a, nil
+}
@@ -0,0 +1,99 @@
+package dmarcdb
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mjl-/mox/dmarcrpt"
+	"github.com/mjl-/mox/dns"
+	"github.com/mjl-/mox/mox-"
+)
+
+func TestDomainAdvice(t *testing.T) {
+	mox.Shutdown = ctxbg
+	mox.ConfigStaticPath = filepath.FromSlash("../testdata/dmarcdb/mox.conf")
+	mox.MustLoadConfig(true, false)
+
+	os.Remove(mox.DataDirPath("dmarcrpt.db"))
+	err := Init()
+	tcheckf(t, err, "init")
+	defer func() {
+		err := Close()
+		tcheckf(t, err, "close")
+	}()
+
+	now := time.Now()
+
+	// Add a daily report for a day, ndays ago, with aligned and unaligned messages.
+	addReport := func(ndays int, policy dmarcrpt.Disposition, aligned, unaligned int) {
+		t.Helper()
+		end := now.Add(-time.Duration(ndays) * 24 * time.Hour)
+		feedback := &dmarcrpt.Feedback{
+			ReportMetadata: dmarcrpt.ReportMetadata{
+				OrgName:   "remote.example",
+				ReportID:  end.Format(time.RFC3339),
+				DateRange: dmarcrpt.DateRange{Begin: end.Add(-24 * time.Hour).Unix(), End: end.Unix()},
+			},
+			PolicyPublished: dmarcrpt.PolicyPublished{Domain: "example.org", Policy: policy, Percentage: 100},
+		}
+		if aligned > 0 {
+			feedback.Records = append(feedback.Records, dmarcrpt.ReportRecord{
+				Row: dmarcrpt.Row{
+					SourceIP:        "10.0.0.1",
+					Count:           aligned,
+					PolicyEvaluated: dmarcrpt.PolicyEvaluated{Disposition: dmarcrpt.DispositionNone, DKIM: dmarcrpt.DMARCPass, SPF: dmarcrpt.DMARCFail},
+				},
+			})
+		}
+		if unaligned > 0 {
+			feedback.Records = append(feedback.Records, dmarcrpt.ReportRecord{
+				Row: dmarcrpt.Row{
+					SourceIP:        "10.0.0.2",
+					Count:           unaligned,
+					PolicyEvaluated: dmarcrpt.PolicyEvaluated{Disposition: dmarcrpt.DispositionNone, DKIM: dmarcrpt.DMARCFail, SPF: dmarcrpt.DMARCFail},
+				},
+			})
+		}
+		err := AddReport(ctxbg, feedback, dns.Domain{ASCII: "remote.example"})
+		tcheckf(t, err, "add report")
+	}
+
+	checkAdvice := func(expPolicy dmarcrpt.Disposition, expUnaligned int) {
+		t.Helper()
+		a, err := DomainAdvice(ctxbg, "example.org", now)
+		tcheckf(t, err, "advice")
+		if a.RecommendedPolicy != expPolicy || a.Unaligned != expUnaligned {
+			t.Fatalf("got recommended policy %q, unaligned %d, expected %q, %d (%s)", a.RecommendedPolicy, a.Unaligned, expPolicy, expUnaligned, a.Recommendation)
+		}
+	}
+
+	// No reports, no recommendation.
+	checkAdvice("", 0)
+
+	// Reports only for a few days, keep policy.
+	addReport(0, dmarcrpt.DispositionNone, 10, 0)
+	addReport(2, dmarcrpt.DispositionNone, 10, 0)
+	checkAdvice(dmarcrpt.DispositionNone, 0)
+
+	// Reports covering the period, all aligned, move to quarantine.
+	addReport(29, dmarcrpt.DispositionNone, 10, 0)
+	checkAdvice(dmarcrpt.DispositionQuarantine, 0)
+
+	// Too many unaligned messages, keep policy.
+	addReport(1, dmarcrpt.DispositionNone, 10, 5)
+	checkAdvice(dmarcrpt.DispositionNone, 5)
+
+	// Reports older than 30 days aren't used.
+	addReport(40, dmarcrpt.DispositionNone, 0, 100)
+	checkAdvice(dmarcrpt.DispositionNone, 5)
+
+	// Most recent report has the current policy.
+	addReport(3, dmarcrpt.DispositionQuarantine, 10, 0)
+	a, err := DomainAdvice(ctxbg, "example.org", now)
+	tcheckf(t, err, "advice")
+	if a.Reports != 5 || len(a.UnalignedSources) != 1 || a.PublishedPolicy != dmarcrpt.DispositionNone {
+		t.Fatalf("got %d reports, unaligned sources %v, policy %q, expected 5 reports, 1 unaligned source and policy none", a.Reports, a.UnalignedSources, a.PublishedPolicy)
+	}
+}
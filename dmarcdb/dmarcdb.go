@@ -19,6 +19,7 @@ import (
 
 	"github.com/mjl-/bstore"
 
+	"github.com/mjl-/mox/metrics"
 	"github.com/mjl-/mox/mlog"
 	"github.com/mjl-/mox/mox-"
 	"github.com/mjl-/mox/moxvar"
@@ -62,6 +63,11 @@ func Close() error {
 	return nil
 }
 
+func init() {
+	metrics.DatabaseSize("dmarcrpt", func() string { return mox.DataDirPath("dmarcrpt.db") })
+	metrics.DatabaseSize("dmarceval", func() string { return mox.DataDirPath("dmarceval.db") })
+}
+
 func openReportsDB(ctx context.Context, log mlog.Log) (*bstore.DB, error) {
 	p := mox.DataDirPath("dmarcrpt.db")
 	os.MkdirAll(filepath.Dir(p), 0770)
@@ -0,0 +1,337 @@
+package dmarcdb
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/mjl-/bstore"
+
+	"github.com/mjl-/mox/dns"
+	"github.com/mjl-/mox/message"
+	"github.com/mjl-/mox/mlog"
+	"github.com/mjl-/mox/mox-"
+	"github.com/mjl-/mox/moxvar"
+	"github.com/mjl-/mox/smtp"
+	"github.com/mjl-/mox/store"
+)
+
+// Parameters for detecting surges of incoming messages that fail DMARC with a
+// message From address in one of our domains.
+const (
+	spoofWindow      = time.Hour      // Failures in this period are compared against the baseline.
+	spoofBaseline    = 24 * time.Hour // Period before the window for the average hourly failures.
+	spoofMinMessages = 20             // Minimum failures in the window for a surge.
+	spoofFactor      = 5              // Failures in the window must be this many times the hourly average.
+	spoofProtect     = 24 * time.Hour // An incident ends this long after the last surge.
+	spoofMaxSources  = 10             // Maximum number of sources kept for an incident.
+)
+
+var metricSpoofIncident = promauto.NewCounter(
+	prometheus.CounterOpts{
+		Name: "mox_dmarcdb_spoof_incident_total",
+		Help: "Number of detected surges of incoming messages failing DMARC for hosted domains.",
+	},
+)
+
+// SpoofIncident is a period with a surge of incoming messages that claim to be
+// from one of our domains in the message From header, but fail DMARC. Typically a
+// spoofing campaign.
+type SpoofIncident struct {
+	ID     int64
+	Domain string `bstore:"nonzero,index Domain+Start"` // Unicode.
+
+	// First and most recent detection of the surge. The incident ends a day after
+	// the most recent detection.
+	Start time.Time `bstore:"nonzero"`
+	End   time.Time `bstore:"nonzero"`
+
+	Messages int     // Messages failing DMARC during the incident, including those in the hour before the start.
+	Baseline float64 // Average failures per hour in the day before the incident.
+
+	// Whether a stricter junk filter threshold was used for failing messages during
+	// the incident.
+	Protected bool
+
+	// Sources of failing messages during the incident, most messages first.
+	Sources []AdviceSource
+}
+
+// spoofTracker keeps recent DMARC failures for a domain.
+type spoofTracker struct {
+	minutes  map[int64]int  // Unix minute to failures, for window and baseline.
+	incident *SpoofIncident // Active incident, if any.
+	sources  map[string]int // Of active incident.
+	saved    time.Time      // Last time the active incident was written to the database.
+	loaded   bool           // Whether a recent incident was looked up in the database.
+}
+
+var (
+	spoofMutex    sync.Mutex
+	spoofTrackers = map[string]*spoofTracker{} // By unicode domain.
+)
+
+// SpoofAdd registers an incoming message with a message From address in domain
+// d, hosted on this server, that failed DMARC. A surge of failures starts an
+// incident, which is stored and about which the postmaster is notified.
+//
+// SpoofAdd returns whether a stricter junk filter threshold must be used for the
+// message, i.e. whether an incident is active and the domain is configured to
+// protect against spoofing.
+func SpoofAdd(ctx context.Context, log mlog.Log, d dns.Domain, remoteIP string) (protect bool) {
+	return spoofAdd(ctx, log, d, remoteIP, time.Now())
+}
+
+func spoofAdd(ctx context.Context, log mlog.Log, d dns.Domain, remoteIP string, now time.Time) (protect bool) {
+	dc, ok := mox.Conf.Domain(d)
+	if !ok || dc.SpoofingSurges == "ignore" {
+		return false
+	}
+
+	var notify *SpoofIncident
+	defer func() {
+		if notify != nil {
+			spoofNotify(log, *notify)
+		}
+	}()
+
+	spoofMutex.Lock()
+	defer spoofMutex.Unlock()
+
+	domain := d.Name()
+	t := spoofTrackers[domain]
+	if t == nil {
+		t = &spoofTracker{minutes: map[int64]int{}}
+		spoofTrackers[domain] = t
+	}
+
+	// After a restart, continue a recent incident.
+	if !t.loaded {
+		t.loaded = true
+		q := bstore.QueryDB[SpoofIncident](ctx, ReportsDB)
+		q.FilterNonzero(SpoofIncident{Domain: domain})
+		q.FilterGreater("End", now.Add(-spoofProtect))
+		q.SortDesc("End")
+		si, err := q.Get()
+		if err == nil {
+			t.incident = &si
+			t.sources = map[string]int{}
+			for _, src := range si.Sources {
+				t.sources[src.IP] = src.Messages
+			}
+			t.saved = now
+		} else if err != bstore.ErrAbsent {
+			log.Errorx("looking up recent spoofing incident", err, slog.String("domain", domain))
+		}
+	}
+
+	minute := now.Unix() / 60
+	t.minutes[minute]++
+	var window, baseline int
+	windowStart := minute - int64(spoofWindow/time.Minute)
+	baselineStart := windowStart - int64(spoofBaseline/time.Minute)
+	for m, n := range t.minutes {
+		if m <= baselineStart {
+			delete(t.minutes, m)
+		} else if m <= windowStart {
+			baseline += n
+		} else {
+			window += n
+		}
+	}
+	hourly := float64(baseline) / (float64(spoofBaseline) / float64(time.Hour))
+	surge := window >= spoofMinMessages && float64(window) >= spoofFactor*max(hourly, 1)
+
+	if t.incident != nil && now.Sub(t.incident.End) > spoofProtect {
+		t.incident.Sources = spoofSources(t.sources)
+		err := ReportsDB.Update(ctx, t.incident)
+		log.Check(err, "storing ended spoofing incident", slog.String("domain", domain))
+		t.incident = nil
+	}
+
+	if t.incident == nil {
+		if !surge {
+			return false
+		}
+		t.incident = &SpoofIncident{
+			Domain:    domain,
+			Start:     now,
+			End:       now,
+			Messages:  window - 1, // Current message is added below.
+			Baseline:  hourly,
+			Protected: dc.SpoofingSurges == "junk",
+		}
+		t.sources = map[string]int{}
+		t.saved = time.Time{}
+		metricSpoofIncident.Inc()
+		log.Info("surge of messages failing dmarc for hosted domain, starting spoofing incident",
+			slog.String("domain", domain),
+			slog.Int("messages", window),
+			slog.Float64("baseline", hourly))
+	}
+	if surge {
+		t.incident.End = now
+	}
+	t.incident.Messages++
+	t.sources[remoteIP]++
+
+	if t.saved.IsZero() {
+		t.incident.Sources = spoofSources(t.sources)
+		if err := ReportsDB.Insert(ctx, t.incident); err != nil {
+			log.Errorx("storing spoofing incident", err, slog.String("domain", domain))
+		} else {
+			x := *t.incident
+			notify = &x
+		}
+		t.saved = now
+	} else if now.Sub(t.saved) >= time.Minute {
+		t.incident.Sources = spoofSources(t.sources)
+		err := ReportsDB.Update(ctx, t.incident)
+		log.Check(err, "updating spoofing incident", slog.String("domain", domain))
+		t.saved = now
+	}
+
+	return t.incident.Protected
+}
+
+// spoofSources returns the sources with most messages first.
+func spoofSources(sources map[string]int) []AdviceSource {
+	var l []AdviceSource
+	for ip, n := range sources {
+		l = append(l, AdviceSource{ip, n})
+	}
+	sort.Slice(l, func(i, j int) bool {
+		if l[i].Messages != l[j].Messages {
+			return l[i].Messages > l[j].Messages
+		}
+		return l[i].IP < l[j].IP
+	})
+	if len(l) > spoofMaxSources {
+		l = l[:spoofMaxSources]
+	}
+	return l
+}
+
+// SpoofIncidents returns incidents overlapping with the period, for the domain
+// (unicode) or all domains if empty. The most recent incident is first. Active
+// incidents are returned with their current state.
+func SpoofIncidents(ctx context.Context, start, end time.Time, domain string) ([]SpoofIncident, error) {
+	q := bstore.QueryDB[SpoofIncident](ctx, ReportsDB)
+	if domain != "" {
+		q.FilterNonzero(SpoofIncident{Domain: domain})
+	}
+	q.FilterLess("Start", end)
+	q.SortDesc("Start")
+	var l []SpoofIncident
+	err := q.ForEach(func(si SpoofIncident) error {
+		spoofMutex.Lock()
+		if t := spoofTrackers[si.Domain]; t != nil && t.incident != nil && t.incident.ID == si.ID {
+			si = *t.incident
+			si.Sources = spoofSources(t.sources)
+		}
+		spoofMutex.Unlock()
+		if !si.End.Before(start) {
+			l = append(l, si)
+		}
+		return nil
+	})
+	return l, err
+}
+
+// spoofNotify delivers a message about the incident to the postmaster mailbox.
+// Errors are logged.
+func spoofNotify(log mlog.Log, si SpoofIncident) {
+	postmaster := smtp.Address{Localpart: "postmaster", Domain: mox.Conf.Static.HostnameDomain}
+	protection := "Messages from the domain that fail DMARC are handled as usual."
+	if si.Protected {
+		protection = "During the incident, and for a day after, a stricter junk filter threshold is\nused for messages from the domain that fail DMARC."
+	}
+	text := fmt.Sprintf(`A surge of incoming messages with a From address in domain %s that fail
+DMARC was detected. This is typical for a spoofing campaign, impersonating the
+domain. Recipients may receive phishing messages that appear to come from the
+domain.
+
+Messages failing DMARC in the past hour: %d
+Average per hour in the day before: %.1f
+
+%s
+
+Details are shown with the DMARC reports for the domain in the admin web
+interface. If the DMARC policy of the domain is not "reject" yet, consider
+making it stricter.
+`, si.Domain, si.Messages, si.Baseline, protection)
+
+	var msgBuf bytes.Buffer
+	err := func() (rerr error) {
+		xc := message.NewComposer(&msgBuf, 1024*1024, false)
+		defer func() {
+			x := recover()
+			if x == nil {
+				return
+			}
+			if err, ok := x.(error); ok && errors.Is(err, message.ErrCompose) {
+				rerr = err
+				return
+			}
+			panic(x)
+		}()
+		xc.HeaderAddrs("From", []message.NameAddress{{DisplayName: "mox", Address: postmaster}})
+		xc.HeaderAddrs("To", []message.NameAddress{{Address: postmaster}})
+		xc.Subject(fmt.Sprintf("Surge of messages failing DMARC for domain %s", si.Domain))
+		xc.Header("Message-Id", fmt.Sprintf("<%s>", mox.MessageIDGen(false)))
+		xc.Header("Date", time.Now().Format(message.RFC5322Z))
+		xc.Header("Auto-Submitted", "auto-generated")
+		xc.Header("User-Agent", "mox/"+moxvar.Version)
+		xc.Header("MIME-Version", "1.0")
+		body, ct, cte := xc.TextPart("plain", text)
+		xc.Header("Content-Type", ct)
+		xc.Header("Content-Transfer-Encoding", cte)
+		xc.Line()
+		xc.Write(body)
+		xc.Flush()
+		return nil
+	}()
+	if err != nil {
+		log.Errorx("composing spoofing incident notification", err)
+		return
+	}
+
+	acc, err := store.OpenAccount(log, mox.Conf.Static.Postmaster.Account, false)
+	if err != nil {
+		log.Errorx("open postmaster account for spoofing incident notification", err)
+		return
+	}
+	defer func() {
+		err := acc.Close()
+		log.Check(err, "closing postmaster account")
+	}()
+
+	msgFile, err := store.CreateMessageTemp(log, "dmarcdb-spoofnotify")
+	if err != nil {
+		log.Errorx("creating temporary message file for spoofing incident notification", err)
+		return
+	}
+	defer store.CloseRemoveTempFile(log, msgFile, "spoofing incident notification")
+	if _, err := msgFile.Write(msgBuf.Bytes()); err != nil {
+		log.Errorx("writing spoofing incident notification", err)
+		return
+	}
+
+	m := store.Message{
+		Received:  time.Now(),
+		Size:      int64(msgBuf.Len()),
+		MsgPrefix: []byte{},
+	}
+	acc.WithWLock(func() {
+		err := acc.DeliverMailbox(log, mox.Conf.Static.Postmaster.Mailbox, &m, msgFile)
+		log.Check(err, "delivering spoofing incident notification to postmaster mailbox")
+	})
+}
@@ -0,0 +1,138 @@
+package dmarcdb
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mjl-/bstore"
+
+	"github.com/mjl-/mox/dns"
+	"github.com/mjl-/mox/mlog"
+	"github.com/mjl-/mox/mox-"
+	"github.com/mjl-/mox/store"
+)
+
+func TestSpoof(t *testing.T) {
+	log := mlog.New("dmarcdb", nil)
+	mox.Shutdown = ctxbg
+	mox.ConfigStaticPath = filepath.FromSlash("../testdata/dmarcdb/mox.conf")
+	mox.MustLoadConfig(true, false)
+
+	os.Remove(mox.DataDirPath("dmarcrpt.db"))
+	os.RemoveAll(mox.DataDirPath("accounts"))
+	err := Init()
+	tcheckf(t, err, "init")
+	defer func() {
+		err := Close()
+		tcheckf(t, err, "close")
+	}()
+	defer store.Switchboard()()
+	spoofTrackers = map[string]*spoofTracker{}
+
+	d := dns.Domain{ASCII: "mox.example"}
+	setSurges := func(s string) {
+		dom := mox.Conf.Dynamic.Domains[d.Name()]
+		dom.SpoofingSurges = s
+		mox.Conf.Dynamic.Domains[d.Name()] = dom
+	}
+
+	tcompare := func(got, exp any) {
+		t.Helper()
+		if got != exp {
+			t.Fatalf("got %v, expected %v", got, exp)
+		}
+	}
+
+	// Baseline of one failure per hour during a day.
+	now := time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 24; i++ {
+		protect := spoofAdd(ctxbg, log, d, "10.0.0.1", now)
+		tcompare(protect, false)
+		now = now.Add(time.Hour)
+	}
+
+	// A surge of failures, the 20th in the past hour starts an incident.
+	for i := 0; i < 19; i++ {
+		spoofAdd(ctxbg, log, d, "10.0.0.2", now)
+		now = now.Add(time.Minute)
+	}
+	l, err := SpoofIncidents(ctxbg, now.Add(-48*time.Hour), now, "")
+	tcheckf(t, err, "spoof incidents")
+	tcompare(len(l), 0)
+	protect := spoofAdd(ctxbg, log, d, "10.0.0.2", now)
+	tcompare(protect, false)
+	incidentStart := now
+
+	l, err = SpoofIncidents(ctxbg, now.Add(-48*time.Hour), now.Add(time.Minute), "mox.example")
+	tcheckf(t, err, "spoof incidents")
+	tcompare(len(l), 1)
+	si := l[0]
+	tcompare(si.Messages, 20)
+	tcompare(si.Baseline, 1.0)
+	tcompare(si.Protected, false)
+	tcompare(len(si.Sources), 1)
+	tcompare(si.Sources[0], AdviceSource{"10.0.0.2", 1})
+
+	// Active incident is returned with current state.
+	spoofAdd(ctxbg, log, d, "10.0.0.2", now.Add(time.Second))
+	l, err = SpoofIncidents(ctxbg, now.Add(-48*time.Hour), now.Add(time.Minute), "mox.example")
+	tcheckf(t, err, "spoof incidents")
+	tcompare(l[0].Messages, 21)
+	tcompare(l[0].Sources[0], AdviceSource{"10.0.0.2", 2})
+
+	// Incident ends a day after the last surge. A new surge with stricter junk
+	// filtering results in a protected incident.
+	now = now.Add(3 * 24 * time.Hour)
+	setSurges("junk")
+	spoofAdd(ctxbg, log, d, "10.0.0.3", now)
+	for i := 0; i < 18; i++ {
+		protect = spoofAdd(ctxbg, log, d, "10.0.0.3", now)
+		tcompare(protect, false)
+	}
+	protect = spoofAdd(ctxbg, log, d, "10.0.0.3", now)
+	tcompare(protect, true)
+
+	l, err = SpoofIncidents(ctxbg, incidentStart.Add(-time.Hour), now.Add(time.Minute), "")
+	tcheckf(t, err, "spoof incidents")
+	tcompare(len(l), 2)
+	tcompare(l[0].Protected, true)
+	tcompare(l[1].Protected, false)
+	tcompare(l[1].End.Equal(incidentStart.Add(time.Second)), true)
+
+	l, err = SpoofIncidents(ctxbg, incidentStart.Add(-time.Hour), incidentStart.Add(time.Hour), "")
+	tcheckf(t, err, "spoof incidents")
+	tcompare(len(l), 1)
+
+	l, err = SpoofIncidents(ctxbg, incidentStart.Add(-time.Hour), now.Add(time.Minute), "other.example")
+	tcheckf(t, err, "spoof incidents")
+	tcompare(len(l), 0)
+
+	// With "ignore", failures are not registered.
+	setSurges("ignore")
+	protect = spoofAdd(ctxbg, log, d, "10.0.0.3", now)
+	tcompare(protect, false)
+	setSurges("")
+
+	// Postmaster was notified about both incidents.
+	acc, err := store.OpenAccount(log, "mjl", false)
+	tcheckf(t, err, "open account")
+	defer func() {
+		err := acc.Close()
+		tcheckf(t, err, "closing account")
+		acc.CheckClosed()
+	}()
+	err = acc.DB.Read(ctxbg, func(tx *bstore.Tx) error {
+		mb, err := acc.MailboxFind(tx, "postmaster")
+		tcheckf(t, err, "find postmaster mailbox")
+		if mb == nil {
+			t.Fatalf("missing postmaster mailbox")
+		}
+		n, err := bstore.QueryTx[store.Message](tx).FilterNonzero(store.Message{MailboxID: mb.ID}).Count()
+		tcheckf(t, err, "count messages")
+		tcompare(n, 2)
+		return nil
+	})
+	tcheckf(t, err, "read account")
+}
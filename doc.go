@@ -23,6 +23,7 @@ any parameters. Followed by the help and usage information for each command.
 	mox quickstart [-skipdial] [-existing-webserver] [-hostname host] user@domain [user | uid]
 	mox stop
 	mox setaccountpassword account
+	mox setaccountpasswordhash account
 	mox setadminpassword
 	mox loglevels [level [pkg]]
 	mox queue holdrules list
@@ -49,30 +50,46 @@ any parameters. Followed by the help and usage information for each command.
 	mox queue webhook print id
 	mox queue webhook retired list [filtersortflags]
 	mox queue webhook retired print id
-	mox import maildir accountname mailboxname maildir
-	mox import mbox accountname mailboxname mbox
-	mox export maildir [-single] dst-dir account-path [mailbox]
-	mox export mbox [-single] dst-dir account-path [mailbox]
+	mox import maildir [-dedup mailbox|account] [-dryrun] [-keepsource] [-trainjunk] accountname mailboxname maildir
+	mox import mbox [-dialect mboxo|mboxrd|mboxcl|mboxcl2] [-dedup mailbox|account] [-dryrun] [-keepsource] [-trainjunk] accountname mailboxname mbox
+	mox import imap [-starttls | -insecure] [-skipverify] [-keepsource] [-trainjunk] accountname address username
+	mox import pst [-prefix mailbox] [-dedup mailbox|account] [-dryrun] [-keepsource] [-trainjunk] accountname pstfile
+	mox import dbox [-prefix mailbox] [-dedup mailbox|account] [-dryrun] [-keepsource] [-trainjunk] accountname dboxdir
+	mox import mh [-dedup mailbox|account] [-dryrun] [-keepsource] [-trainjunk] accountname mailboxname mhdir
+	mox import babyl [-dedup mailbox|account] [-dryrun] [-keepsource] [-trainjunk] accountname mailboxname babylfile
+	mox import jobs accountname
+	mox import jobrm accountname id
+	mox import sources accountname [mailbox]
+	mox export maildir [-single] [-since yyyy-mm-dd] [-before yyyy-mm-dd] [-flags flags] [-notflags flags] dst-dir account-path [mailbox ...]
+	mox export mbox [-single] [-since yyyy-mm-dd] [-before yyyy-mm-dd] [-flags flags] [-notflags flags] dst-dir account-path [mailbox ...]
+	mox export eml [-single] [-since yyyy-mm-dd] [-before yyyy-mm-dd] [-flags flags] [-notflags flags] dst-dir account-path [mailbox ...]
+	mox mailbox readonly account mailbox true|false
 	mox localserve
 	mox help [command ...]
+	mox backup prune -keep n repodir
 	mox backup destdir
 	mox verifydata data-dir
 	mox licenses
 	mox config test
 	mox config dnscheck domain
-	mox config dnsrecords domain
+	mox config dnsrecords [-format zone|cloudflare|route53|terraform] domain
 	mox config describe-domains >domains.conf
 	mox config describe-static >mox.conf
-	mox config account add account address
+	mox config account add [-template name] account address
 	mox config account rm account
 	mox config account disable account message
 	mox config account enable account
+	mox config account suspend [-reject] account message
+	mox config account resume account
+	mox config account snapshot account dst.tgz
+	mox config account restore account src.tgz
 	mox config address add address account
 	mox config address rm address
 	mox config domain add [-disabled] domain account [localpart]
 	mox config domain rm domain
 	mox config domain disable domain
 	mox config domain enable domain
+	mox config domain lookalikes [-dns] domain
 	mox config tlspubkey list [account]
 	mox config tlspubkey get fingerprint
 	mox config tlspubkey add address [name] < cert.pem
@@ -85,6 +102,13 @@ any parameters. Followed by the help and usage information for each command.
 	mox config alias rm alias@domain
 	mox config alias addaddr alias@domain rcpt1@domain ...
 	mox config alias rmaddr alias@domain rcpt1@domain ...
+	mox config domainadmin list
+	mox config domainadmin add name domain ...
+	mox config domainadmin rm name
+	mox config domainadmin setpassword name
+	mox config admintoken list
+	mox config admintoken add [-domainadmin name] name [function ...]
+	mox config admintoken rm name
 	mox config describe-sendmail >/etc/moxsubmit.conf
 	mox config printservice >mox.service
 	mox config ensureacmehostprivatekeys
@@ -96,6 +120,7 @@ any parameters. Followed by the help and usage information for each command.
 	mox dane dial host:port
 	mox dane dialmx domain [destination-host]
 	mox dane makerecord usage selector matchtype [certificate.pem | publickey.pem | privatekey.pem]
+	mox dialcheck domain
 	mox dns lookup [ptr | mx | cname | ips | a | aaaa | ns | txt | srv | tlsa] name
 	mox dkim gened25519 >$selector._domainkey.$domain.ed25519.privatekey.pkcs8.pem
 	mox dkim genrsa >$selector._domainkey.$domain.rsa2048.privatekey.pkcs8.pem
@@ -111,6 +136,8 @@ any parameters. Followed by the help and usage information for each command.
 	mox dnsbl checkhealth zone
 	mox mtasts lookup domain
 	mox rdap domainage domain
+	mox passwordfilter make size file
+	mox passwordfilter check file
 	mox retrain [accountname]
 	mox sendmail [-Fname] [ignoredflags] [-t] [<message]
 	mox spf check domain ip
@@ -130,6 +157,13 @@ any parameters. Followed by the help and usage information for each command.
 	mox recalculatemailboxcounts account
 	mox message parse message.eml
 	mox reassignthreads [account]
+	mox archivepack [account]
+	mox autoarchive [account]
+	mox compressmsgs [account]
+	mox encryptmsgs [account]
+	mox messageencryption genkey >messageencryption.key
+	mox textindexrebuild [account]
+	mox fsck [-repair] [account]
 
 # mox serve
 
@@ -216,6 +250,23 @@ for an account.
 
 	usage: mox setaccountpassword account
 
+# mox setaccountpasswordhash
+
+Set the password of an account to a password hash from another system.
+
+The password hash is read from stdin. Useful when migrating accounts from other
+mail servers, without knowing the passwords. Supported are bcrypt, argon2i,
+argon2id, sha256-crypt and sha512-crypt hashes in crypt format, e.g. starting
+with "$2y$", "$argon2id$" or "$6$", optionally prefixed with the scheme as used
+by Dovecot, e.g. "{SHA512-CRYPT}".
+
+Until the first successful login, only authentication mechanisms with a plain
+text password (IMAP LOGIN, SASL PLAIN, HTTP basic authentication) can be used.
+At the first successful login, the password is set again with the hashes and
+derived secrets mox uses for all authentication mechanisms.
+
+	usage: mox setaccountpasswordhash account
+
 # mox setadminpassword
 
 Set a new admin password, for the web interface.
@@ -693,29 +744,61 @@ The retired webhook is printed to stdout as JSON.
 
 Import a maildir into an account.
 
-The mbox/maildir archive is accessed and imported by the running mox process, so
-it must have access to the archive files. The default suggested systemd service
-file isolates mox from most of the file system, with only the "data/" directory
-accessible, so you may want to put the mbox/maildir archive files in a
-directory like "data/import/" to make it available to mox.
+The mbox/maildir/pst/dbox/mh/babyl archive is accessed and imported by the running mox process,
+so it must have access to the archive files. The default suggested systemd
+service file isolates mox from most of the file system, with only the "data/"
+directory accessible, so you may want to put the archive files in a directory
+like "data/import/" to make it available to mox.
 
 By default, messages will train the junk filter based on their flags and, if
-"automatic junk flags" configuration is set, based on mailbox naming.
+"automatic junk flags" configuration is set, based on mailbox naming. With
+-trainjunk, messages without junk/nonjunk flag are marked and trained as junk
+if they are in the Junk mailbox or a mailbox starting with "junk" or "spam",
+and as not junk if they are in other mailboxes, except for trash and drafts
+mailboxes. A freshly migrated account then starts with a useful junk filter.
+The account must have a junk filter configured.
 
 If the destination mailbox is the Sent mailbox, the recipients of the messages
 are added to the message metadata, causing later incoming messages from these
 recipients to be accepted, unless other reputation signals prevent that.
 
 Users can also import mailboxes/messages through the account web page by
-uploading a zip or tgz file with mbox and/or maildirs.
-
-Messages are imported even if already present. Importing messages twice will
-result in duplicate messages.
+uploading a zip or tgz file with mbox and/or maildirs, or a pst file.
+
+By default, messages are imported even if already present, and importing
+messages twice results in duplicate messages. With -dedup mailbox or -dedup
+account, messages already present in the target mailbox or in any mailbox of the
+account are skipped. Messages are matched by Message-ID, or by their full
+contents if they have no Message-ID.
+
+Messages are committed to the account in batches of 1000. The progress of the
+import is stored in the account as an import job, see "mox import jobs". If an
+import is interrupted, e.g. by a crash, running the same command again with the
+same account, mailbox name and source continues after the last committed
+message. The source must not change in the meantime.
+
+With -keepsource, the position of each imported message in the source, e.g. the
+file and line number for mbox or the file name for maildir, is recorded in the
+account, for cross-referencing and verifying a migration. See "mox import
+sources".
+
+With -dryrun, all messages are read and parsed, but nothing is changed in the
+account. A report is printed with message counts per mailbox, the number of
+messages with each flag and keyword, the messages that could not be parsed, and
+the disk space the messages would use.
 
 Mailbox flags, like "seen", "answered", will be imported. An optional
 dovecot-keywords file can specify additional flags, like Forwarded/Junk/NotJunk.
 
-	usage: mox import maildir accountname mailboxname maildir
+	usage: mox import maildir [-dedup mailbox|account] [-dryrun] [-keepsource] [-trainjunk] accountname mailboxname maildir
+	  -dedup string
+	    	skip messages already present in the target "mailbox" or in the "account"
+	  -dryrun
+	    	only parse the messages and print a report, without importing
+	  -keepsource
+	    	record the position in the source of each imported message, see import sources
+	  -trainjunk
+	    	train the junk filter with messages in junk/spam mailboxes as junk, and messages in other mailboxes as not junk
 
 # mox import mbox
 
@@ -723,43 +806,437 @@ Import an mbox into an account.
 
 Using mbox is not recommended, maildir is a better defined format.
 
-The mbox/maildir archive is accessed and imported by the running mox process, so
-it must have access to the archive files. The default suggested systemd service
-file isolates mox from most of the file system, with only the "data/" directory
-accessible, so you may want to put the mbox/maildir archive files in a
-directory like "data/import/" to make it available to mox.
+Mbox files come in dialects that differ in how messages are separated and how
+lines starting with "From " in messages are quoted. By default, messages are
+separated by "From " lines after an empty line, or by the size in a
+Content-Length header if the next message starts right after it, and quoted
+lines like ">From " and ">>From " have one ">" removed (as in mboxrd). With
+-dialect, messages are read as mboxo (only ">From " is unquoted), mboxrd,
+mboxcl (like mboxo, with Content-Length headers) or mboxcl2 (with
+Content-Length headers, no quoting). For mboxcl and mboxcl2, a Content-Length
+header that does not match the start of the next message is an error.
+
+The mbox/maildir/pst/dbox/mh/babyl archive is accessed and imported by the running mox process,
+so it must have access to the archive files. The default suggested systemd
+service file isolates mox from most of the file system, with only the "data/"
+directory accessible, so you may want to put the archive files in a directory
+like "data/import/" to make it available to mox.
+
+By default, messages will train the junk filter based on their flags and, if
+"automatic junk flags" configuration is set, based on mailbox naming. With
+-trainjunk, messages without junk/nonjunk flag are marked and trained as junk
+if they are in the Junk mailbox or a mailbox starting with "junk" or "spam",
+and as not junk if they are in other mailboxes, except for trash and drafts
+mailboxes. A freshly migrated account then starts with a useful junk filter.
+The account must have a junk filter configured.
+
+If the destination mailbox is the Sent mailbox, the recipients of the messages
+are added to the message metadata, causing later incoming messages from these
+recipients to be accepted, unless other reputation signals prevent that.
+
+Users can also import mailboxes/messages through the account web page by
+uploading a zip or tgz file with mbox and/or maildirs, or a pst file.
+
+By default, messages are imported even if already present, and importing
+messages twice results in duplicate messages. With -dedup mailbox or -dedup
+account, messages already present in the target mailbox or in any mailbox of the
+account are skipped. Messages are matched by Message-ID, or by their full
+contents if they have no Message-ID.
+
+Messages are committed to the account in batches of 1000. The progress of the
+import is stored in the account as an import job, see "mox import jobs". If an
+import is interrupted, e.g. by a crash, running the same command again with the
+same account, mailbox name and source continues after the last committed
+message. The source must not change in the meantime.
+
+With -keepsource, the position of each imported message in the source, e.g. the
+file and line number for mbox or the file name for maildir, is recorded in the
+account, for cross-referencing and verifying a migration. See "mox import
+sources".
+
+With -dryrun, all messages are read and parsed, but nothing is changed in the
+account. A report is printed with message counts per mailbox, the number of
+messages with each flag and keyword, the messages that could not be parsed, and
+the disk space the messages would use.
+
+	usage: mox import mbox [-dialect mboxo|mboxrd|mboxcl|mboxcl2] [-dedup mailbox|account] [-dryrun] [-keepsource] [-trainjunk] accountname mailboxname mbox
+	  -dedup string
+	    	skip messages already present in the target "mailbox" or in the "account"
+	  -dialect string
+	    	mbox dialect, instead of detecting content-length and unquoting like mboxrd
+	  -dryrun
+	    	only parse the messages and print a report, without importing
+	  -keepsource
+	    	record the position in the source of each imported message, see import sources
+	  -trainjunk
+	    	train the junk filter with messages in junk/spam mailboxes as junk, and messages in other mailboxes as not junk
+
+# mox import imap
+
+Import all mailboxes of an account on a remote IMAP server into an account.
+
+The address is the host and port of the remote IMAP server, e.g.
+imap.example.org:993. The password for the remote account is read from stdin.
+The connection to the remote server is made by the running mox process.
+
+All mailboxes are imported, with their hierarchy. Message flags, keywords and
+received times are preserved. Messages are imported in batches, and the progress
+is stored in the account. If the import is interrupted, running the same command
+again continues where it left off. Running the command again later imports only
+messages that were added to the remote mailboxes in the meantime. If the
+UIDVALIDITY of a remote mailbox has changed, all its messages are imported
+again.
+
+With -keepsource, the remote mailbox, as IMAP URL with UIDVALIDITY, and the UID
+of each imported message are recorded in the account. See "mox import sources".
+
+By default, messages will train the junk filter based on their flags and, if
+"automatic junk flags" configuration is set, based on mailbox naming. With
+-trainjunk, messages are also marked and trained as junk or not junk based on
+their mailbox, as with file imports, see "mox help import maildir".
+
+	usage: mox import imap [-starttls | -insecure] [-skipverify] [-keepsource] [-trainjunk] accountname address username
+	  -insecure
+	    	do not use tls at all, only for testing or trusted networks
+	  -keepsource
+	    	record the position in the source of each imported message, see import sources
+	  -skipverify
+	    	do not verify the tls certificate of the remote server
+	  -starttls
+	    	connect without tls and switch to tls with starttls, instead of connecting with tls immediately
+	  -trainjunk
+	    	train the junk filter with messages in junk/spam mailboxes as junk, and messages in other mailboxes as not junk
+
+# mox import pst
+
+Import a Microsoft Outlook PST or OST file into an account.
+
+All mail folders in the file are imported, with their hierarchy, as mailboxes
+with the same names. Folders with contacts, calendar items, etc. are skipped.
+The read, flagged, answered, forwarded and draft states of messages are imported
+as message flags. Messages are reconstructed from the information in the file,
+using the original message headers when present. With -prefix, the mailboxes
+are created below the given mailbox.
+
+Both the older ANSI and newer Unicode formats are supported, without encryption
+or with the default "compressible" encryption. Files with "high" encryption
+cannot be imported.
+
+The mbox/maildir/pst/dbox/mh/babyl archive is accessed and imported by the running mox process,
+so it must have access to the archive files. The default suggested systemd
+service file isolates mox from most of the file system, with only the "data/"
+directory accessible, so you may want to put the archive files in a directory
+like "data/import/" to make it available to mox.
+
+By default, messages will train the junk filter based on their flags and, if
+"automatic junk flags" configuration is set, based on mailbox naming. With
+-trainjunk, messages without junk/nonjunk flag are marked and trained as junk
+if they are in the Junk mailbox or a mailbox starting with "junk" or "spam",
+and as not junk if they are in other mailboxes, except for trash and drafts
+mailboxes. A freshly migrated account then starts with a useful junk filter.
+The account must have a junk filter configured.
+
+If the destination mailbox is the Sent mailbox, the recipients of the messages
+are added to the message metadata, causing later incoming messages from these
+recipients to be accepted, unless other reputation signals prevent that.
+
+Users can also import mailboxes/messages through the account web page by
+uploading a zip or tgz file with mbox and/or maildirs, or a pst file.
+
+By default, messages are imported even if already present, and importing
+messages twice results in duplicate messages. With -dedup mailbox or -dedup
+account, messages already present in the target mailbox or in any mailbox of the
+account are skipped. Messages are matched by Message-ID, or by their full
+contents if they have no Message-ID.
+
+Messages are committed to the account in batches of 1000. The progress of the
+import is stored in the account as an import job, see "mox import jobs". If an
+import is interrupted, e.g. by a crash, running the same command again with the
+same account, mailbox name and source continues after the last committed
+message. The source must not change in the meantime.
+
+With -keepsource, the position of each imported message in the source, e.g. the
+file and line number for mbox or the file name for maildir, is recorded in the
+account, for cross-referencing and verifying a migration. See "mox import
+sources".
+
+With -dryrun, all messages are read and parsed, but nothing is changed in the
+account. A report is printed with message counts per mailbox, the number of
+messages with each flag and keyword, the messages that could not be parsed, and
+the disk space the messages would use.
+
+	usage: mox import pst [-prefix mailbox] [-dedup mailbox|account] [-dryrun] [-keepsource] [-trainjunk] accountname pstfile
+	  -dedup string
+	    	skip messages already present in the target "mailbox" or in the "account"
+	  -dryrun
+	    	only parse the messages and print a report, without importing
+	  -keepsource
+	    	record the position in the source of each imported message, see import sources
+	  -prefix string
+	    	mailbox under which to create the mailboxes for the folders in the pst file
+	  -trainjunk
+	    	train the junk filter with messages in junk/spam mailboxes as junk, and messages in other mailboxes as not junk
+
+# mox import dbox
+
+Import a Dovecot sdbox or mdbox directory into an account.
+
+The dboxdir is the directory with the "mailboxes" directory, and for mdbox the
+"storage" directory. All mailboxes are imported, with the same names. With
+-prefix, the mailboxes are created below the given mailbox.
+
+Message flags and keywords are read from the dovecot.index file of each
+mailbox, and the received time from the message metadata. Dovecot writes recent
+changes to dovecot.index.log first, and only later to dovecot.index. The log
+file is not read, so the most recent flag changes may not be imported. For mdbox, messages are matched to mailboxes through the index.
+Messages that are not in any index are imported into their original mailbox, if
+it was stored with the message. Run "doveadm purge" first to prevent importing
+expunged messages. Messages with attachments stored separately, with Dovecot's
+mail_attachment_dir, and compressed files cannot be imported.
+
+The mbox/maildir/pst/dbox/mh/babyl archive is accessed and imported by the running mox process,
+so it must have access to the archive files. The default suggested systemd
+service file isolates mox from most of the file system, with only the "data/"
+directory accessible, so you may want to put the archive files in a directory
+like "data/import/" to make it available to mox.
+
+By default, messages will train the junk filter based on their flags and, if
+"automatic junk flags" configuration is set, based on mailbox naming. With
+-trainjunk, messages without junk/nonjunk flag are marked and trained as junk
+if they are in the Junk mailbox or a mailbox starting with "junk" or "spam",
+and as not junk if they are in other mailboxes, except for trash and drafts
+mailboxes. A freshly migrated account then starts with a useful junk filter.
+The account must have a junk filter configured.
+
+If the destination mailbox is the Sent mailbox, the recipients of the messages
+are added to the message metadata, causing later incoming messages from these
+recipients to be accepted, unless other reputation signals prevent that.
+
+Users can also import mailboxes/messages through the account web page by
+uploading a zip or tgz file with mbox and/or maildirs, or a pst file.
+
+By default, messages are imported even if already present, and importing
+messages twice results in duplicate messages. With -dedup mailbox or -dedup
+account, messages already present in the target mailbox or in any mailbox of the
+account are skipped. Messages are matched by Message-ID, or by their full
+contents if they have no Message-ID.
+
+Messages are committed to the account in batches of 1000. The progress of the
+import is stored in the account as an import job, see "mox import jobs". If an
+import is interrupted, e.g. by a crash, running the same command again with the
+same account, mailbox name and source continues after the last committed
+message. The source must not change in the meantime.
+
+With -keepsource, the position of each imported message in the source, e.g. the
+file and line number for mbox or the file name for maildir, is recorded in the
+account, for cross-referencing and verifying a migration. See "mox import
+sources".
+
+With -dryrun, all messages are read and parsed, but nothing is changed in the
+account. A report is printed with message counts per mailbox, the number of
+messages with each flag and keyword, the messages that could not be parsed, and
+the disk space the messages would use.
+
+	usage: mox import dbox [-prefix mailbox] [-dedup mailbox|account] [-dryrun] [-keepsource] [-trainjunk] accountname dboxdir
+	  -dedup string
+	    	skip messages already present in the target "mailbox" or in the "account"
+	  -dryrun
+	    	only parse the messages and print a report, without importing
+	  -keepsource
+	    	record the position in the source of each imported message, see import sources
+	  -prefix string
+	    	mailbox under which to create the mailboxes
+	  -trainjunk
+	    	train the junk filter with messages in junk/spam mailboxes as junk, and messages in other mailboxes as not junk
+
+# mox import mh
+
+Import an MH folder into an account.
+
+MH folders are used by nmh, mh-e and Claws Mail. Messages are the files with a
+numeric name in the folder directory. Subfolders are not imported, import them
+separately.
+
+Flags are read from the sequences in the .mh_sequences file: Messages not in
+the "unseen" sequence are marked as seen, and sequences "flagged" and "replied"
+set the flagged and answered flags. Other sequences, except "cur", are imported
+as keywords. The received time is taken from the file modification time.
+
+The mbox/maildir/pst/dbox/mh/babyl archive is accessed and imported by the running mox process,
+so it must have access to the archive files. The default suggested systemd
+service file isolates mox from most of the file system, with only the "data/"
+directory accessible, so you may want to put the archive files in a directory
+like "data/import/" to make it available to mox.
+
+By default, messages will train the junk filter based on their flags and, if
+"automatic junk flags" configuration is set, based on mailbox naming. With
+-trainjunk, messages without junk/nonjunk flag are marked and trained as junk
+if they are in the Junk mailbox or a mailbox starting with "junk" or "spam",
+and as not junk if they are in other mailboxes, except for trash and drafts
+mailboxes. A freshly migrated account then starts with a useful junk filter.
+The account must have a junk filter configured.
+
+If the destination mailbox is the Sent mailbox, the recipients of the messages
+are added to the message metadata, causing later incoming messages from these
+recipients to be accepted, unless other reputation signals prevent that.
+
+Users can also import mailboxes/messages through the account web page by
+uploading a zip or tgz file with mbox and/or maildirs, or a pst file.
+
+By default, messages are imported even if already present, and importing
+messages twice results in duplicate messages. With -dedup mailbox or -dedup
+account, messages already present in the target mailbox or in any mailbox of the
+account are skipped. Messages are matched by Message-ID, or by their full
+contents if they have no Message-ID.
+
+Messages are committed to the account in batches of 1000. The progress of the
+import is stored in the account as an import job, see "mox import jobs". If an
+import is interrupted, e.g. by a crash, running the same command again with the
+same account, mailbox name and source continues after the last committed
+message. The source must not change in the meantime.
+
+With -keepsource, the position of each imported message in the source, e.g. the
+file and line number for mbox or the file name for maildir, is recorded in the
+account, for cross-referencing and verifying a migration. See "mox import
+sources".
+
+With -dryrun, all messages are read and parsed, but nothing is changed in the
+account. A report is printed with message counts per mailbox, the number of
+messages with each flag and keyword, the messages that could not be parsed, and
+the disk space the messages would use.
+
+	usage: mox import mh [-dedup mailbox|account] [-dryrun] [-keepsource] [-trainjunk] accountname mailboxname mhdir
+	  -dedup string
+	    	skip messages already present in the target "mailbox" or in the "account"
+	  -dryrun
+	    	only parse the messages and print a report, without importing
+	  -keepsource
+	    	record the position in the source of each imported message, see import sources
+	  -trainjunk
+	    	train the junk filter with messages in junk/spam mailboxes as junk, and messages in other mailboxes as not junk
+
+# mox import babyl
+
+Import an Emacs Rmail Babyl file into an account.
+
+The unseen, answered, forwarded and deleted attributes of messages are imported
+as flags, and labels as keywords. For messages reformatted by Rmail, the
+original message header is imported.
+
+The mbox/maildir/pst/dbox/mh/babyl archive is accessed and imported by the running mox process,
+so it must have access to the archive files. The default suggested systemd
+service file isolates mox from most of the file system, with only the "data/"
+directory accessible, so you may want to put the archive files in a directory
+like "data/import/" to make it available to mox.
 
 By default, messages will train the junk filter based on their flags and, if
-"automatic junk flags" configuration is set, based on mailbox naming.
+"automatic junk flags" configuration is set, based on mailbox naming. With
+-trainjunk, messages without junk/nonjunk flag are marked and trained as junk
+if they are in the Junk mailbox or a mailbox starting with "junk" or "spam",
+and as not junk if they are in other mailboxes, except for trash and drafts
+mailboxes. A freshly migrated account then starts with a useful junk filter.
+The account must have a junk filter configured.
 
 If the destination mailbox is the Sent mailbox, the recipients of the messages
 are added to the message metadata, causing later incoming messages from these
 recipients to be accepted, unless other reputation signals prevent that.
 
 Users can also import mailboxes/messages through the account web page by
-uploading a zip or tgz file with mbox and/or maildirs.
+uploading a zip or tgz file with mbox and/or maildirs, or a pst file.
+
+By default, messages are imported even if already present, and importing
+messages twice results in duplicate messages. With -dedup mailbox or -dedup
+account, messages already present in the target mailbox or in any mailbox of the
+account are skipped. Messages are matched by Message-ID, or by their full
+contents if they have no Message-ID.
+
+Messages are committed to the account in batches of 1000. The progress of the
+import is stored in the account as an import job, see "mox import jobs". If an
+import is interrupted, e.g. by a crash, running the same command again with the
+same account, mailbox name and source continues after the last committed
+message. The source must not change in the meantime.
+
+With -keepsource, the position of each imported message in the source, e.g. the
+file and line number for mbox or the file name for maildir, is recorded in the
+account, for cross-referencing and verifying a migration. See "mox import
+sources".
+
+With -dryrun, all messages are read and parsed, but nothing is changed in the
+account. A report is printed with message counts per mailbox, the number of
+messages with each flag and keyword, the messages that could not be parsed, and
+the disk space the messages would use.
+
+	usage: mox import babyl [-dedup mailbox|account] [-dryrun] [-keepsource] [-trainjunk] accountname mailboxname babylfile
+	  -dedup string
+	    	skip messages already present in the target "mailbox" or in the "account"
+	  -dryrun
+	    	only parse the messages and print a report, without importing
+	  -keepsource
+	    	record the position in the source of each imported message, see import sources
+	  -trainjunk
+	    	train the junk filter with messages in junk/spam mailboxes as junk, and messages in other mailboxes as not junk
+
+# mox import jobs
+
+List the import jobs of an account, with their progress.
+
+Imports from files or directories, such as with "mox import mbox", are tracked as
+jobs. Jobs without finish time are still running, or were interrupted and can be
+continued by running the same import command again.
 
-Messages are imported even if already present. Importing messages twice will
-result in duplicate messages.
+	usage: mox import jobs accountname
 
-	usage: mox import mbox accountname mailboxname mbox
+# mox import jobrm
+
+Remove an import job of an account.
+
+Messages already imported are not removed. An interrupted import of which the
+job is removed is not continued: Running the import command again starts at the
+first message, importing messages again.
+
+	usage: mox import jobrm accountname id
+
+# mox import sources
+
+List the recorded sources of imported messages of an account.
+
+Sources are only recorded for imports with -keepsource. For each message, its
+mailbox, UID, the kind of import, the source as given to the import command (or
+the IMAP URL of the remote mailbox), and the position of the message in the
+source are printed, e.g. file and line number for mbox, file name for maildir,
+UID for IMAP. Sources of messages that have been removed are not printed.
+Sources follow messages that are moved to another mailbox, but not copies.
+
+	usage: mox import sources accountname [mailbox]
 
 # mox export maildir
 
-Export one or all mailboxes from an account in maildir format.
+Export one, some or all mailboxes from an account in maildir format.
 
 Export bypasses a running mox instance. It opens the account mailbox/message
 database file directly. This may block if a running mox instance also has the
 database open, e.g. for IMAP connections. To export from a running instance, use
 the accounts web page or webmail.
 
-	usage: mox export maildir [-single] dst-dir account-path [mailbox]
+Messages can be selected by the date they were received, and by flags and
+keywords they must or must not have. Flags are separated by spaces, e.g.
+"\Seen $Junk".
+
+	usage: mox export maildir [-single] [-since yyyy-mm-dd] [-before yyyy-mm-dd] [-flags flags] [-notflags flags] dst-dir account-path [mailbox ...]
+	  -before string
+	    	only export messages received before this date
+	  -flags string
+	    	only export messages with all these flags/keywords
+	  -notflags string
+	    	only export messages without any of these flags/keywords, e.g. \Deleted
+	  -since string
+	    	only export messages received on or after this date
 	  -single
-	    	export single mailbox, without any children. disabled if mailbox isn't specified.
+	    	export single mailboxes, without any children. disabled if no mailbox is specified.
 
 # mox export mbox
 
-Export messages from one or all mailboxes in an account in mbox format.
+Export messages from one, some or all mailboxes in an account in mbox format.
 
 Using mbox is not recommended. Maildir is a better format.
 
@@ -772,9 +1249,63 @@ For mbox export, "mboxrd" is used where message lines starting with the magic
 "From " string are escaped by prepending a >. All ">*From " are escaped,
 otherwise reconstructing the original could lose a ">".
 
-	usage: mox export mbox [-single] dst-dir account-path [mailbox]
+Messages can be selected by the date they were received, and by flags and
+keywords they must or must not have. Flags are separated by spaces, e.g.
+"\Seen $Junk".
+
+	usage: mox export mbox [-single] [-since yyyy-mm-dd] [-before yyyy-mm-dd] [-flags flags] [-notflags flags] dst-dir account-path [mailbox ...]
+	  -before string
+	    	only export messages received before this date
+	  -flags string
+	    	only export messages with all these flags/keywords
+	  -notflags string
+	    	only export messages without any of these flags/keywords, e.g. \Deleted
+	  -since string
+	    	only export messages received on or after this date
+	  -single
+	    	export single mailboxes, without any children. disabled if no mailbox is specified.
+
+# mox export eml
+
+Export messages from one, some or all mailboxes in an account as .eml files.
+
+Each mailbox is exported as a directory, with a file for each message, named
+after the time the message was received and its ID. Messages are stored as
+they were received, with CRLF line endings. Flags are not exported.
+
+Export bypasses a running mox instance. It opens the account mailbox/message
+database file directly. This may block if a running mox instance also has the
+database open, e.g. for IMAP connections. To export from a running instance, use
+the accounts web page.
+
+Messages can be selected by the date they were received, and by flags and
+keywords they must or must not have. Flags are separated by spaces, e.g.
+"\Seen $Junk".
+
+	usage: mox export eml [-single] [-since yyyy-mm-dd] [-before yyyy-mm-dd] [-flags flags] [-notflags flags] dst-dir account-path [mailbox ...]
+	  -before string
+	    	only export messages received before this date
+	  -flags string
+	    	only export messages with all these flags/keywords
+	  -notflags string
+	    	only export messages without any of these flags/keywords, e.g. \Deleted
+	  -since string
+	    	only export messages received on or after this date
 	  -single
-	    	export single mailbox, without any children. disabled if mailbox isn't specified.
+	    	export single mailboxes, without any children. disabled if no mailbox is specified.
+
+# mox mailbox readonly
+
+Mark a mailbox as read-only for IMAP clients, or as writable again.
+
+A read-only mailbox is opened like with EXAMINE, also by SELECT, with an empty
+PERMANENTFLAGS list. Flags cannot be changed and messages cannot be expunged.
+Adding messages with APPEND, COPY or MOVE fails with response code NOPERM.
+Useful for archives that should not change. Messages are still delivered to the
+mailbox if rulesets specify it. IMAP sessions that have the mailbox selected
+notice the change when selecting the mailbox again.
+
+	usage: mox mailbox readonly account mailbox true|false
 
 # mox localserve
 
@@ -823,6 +1354,25 @@ If a single command matches, its usage and full help text is printed.
 
 	usage: mox help [command ...]
 
+# mox backup prune
+
+Remove old generations from an incremental backup repository.
+
+The most recent n complete generations are kept. Incomplete generations, e.g.
+from an interrupted backup, are removed. Files in the objects directory that are
+no longer referenced by any kept generation are removed.
+
+If the most recent generation is incomplete, a backup may be in progress and
+nothing is removed. Do not run prune while an incremental backup to the
+repository is in progress.
+
+Prune works on the files in the backup repository only, it does not need a
+running mox instance.
+
+	usage: mox backup prune -keep n repodir
+	  -keep int
+	    	number of most recent complete generations to keep, must be at least 1
+
 # mox backup
 
 Creates a backup of the config and data directory.
@@ -866,7 +1416,23 @@ This can change the backup files (e.g. upgrade database files, move away
 unrecognized message files), so you should make a new backup before actually
 upgrading.
 
+With -incremental, destdir is a backup repository that holds multiple backup
+generations. Each backup is stored in a new directory
+<destdir>/generations/<yyyymmdd-hhmmss>, with the same config and data
+directories as a regular backup. Files are deduplicated by content: They are
+stored once in <destdir>/objects, named by their SHA-256 hash, and hardlinked
+into each generation. Message and pack files that haven't changed since the
+previous generation, according to the "manifest" file in the generation
+directory, are linked from the objects directory without reading or copying
+them again. Other files, such as databases, are copied and hashed each time,
+and deduplicated when unchanged. The destination directory must be on a file system that supports
+hardlinks. Because files are shared between generations, do not modify files in
+a generation, e.g. with "mox verifydata -fix", make a copy with "cp -r" first.
+Use "mox backup prune" to remove old generations.
+
 	usage: mox backup destdir
+	  -incremental
+	    	make incremental backup as new generation in backup repository destdir
 	  -verbose
 	    	print progress
 
@@ -925,7 +1491,16 @@ The zone file can be imported into existing DNS software. You should review the
 DNS records, especially if your domain previously/currently has email
 configured.
 
-	usage: mox config dnsrecords domain
+With -format, the records are printed in a format for a DNS provider instead:
+"cloudflare" for JSON with objects for the Cloudflare API for creating DNS
+records, "route53" for a JSON change batch for the AWS Route53 API (e.g. for
+"aws route53 change-resource-record-sets"), and "terraform" for HCL with
+aws_route53_record resources. Commented-out records in the zone file are not
+included.
+
+	usage: mox config dnsrecords [-format zone|cloudflare|route53|terraform] domain
+	  -format string
+	    	output format: zone, cloudflare, route53, terraform (default "zone")
 
 # mox config describe-domains
 
@@ -960,7 +1535,13 @@ Add an account with an email address and reload the configuration.
 Email can be delivered to this address/account. A password has to be configured
 explicitly, see the setaccountpassword command.
 
-	usage: mox config account add account address
+With -template, the account is configured with the settings of the template
+from AccountTemplates in mox.conf, e.g. with different initial mailboxes, junk
+filter settings, rulesets or quota.
+
+	usage: mox config account add [-template name] account address
+	  -template string
+	    	name of account template to use for the settings of the new account
 
 # mox config account rm
 
@@ -993,6 +1574,62 @@ Login attempts by the user no long result in an error message.
 
 	usage: mox config account enable account
 
+# mox config account suspend
+
+Suspend an account, e.g. when it is compromised or delinquent.
+
+Login attempts are rejected with the message, as with disabled logins, and
+active web sessions are removed. Incoming email for the account is rejected
+with a temporary error, or a permanent error with -reject. Aliases skip
+suspended accounts as members.
+
+Message must be non-empty, ascii-only without control characters including
+newline, and maximum 256 characters because it is used in SMTP/IMAP.
+
+	usage: mox config account suspend [-reject] account message
+	  -reject
+	    	reject incoming email with a permanent error instead of a temporary error
+
+# mox config account resume
+
+Resume a suspended account.
+
+Logins and incoming email are accepted again, unless logins are disabled.
+
+	usage: mox config account resume account
+
+# mox config account snapshot
+
+Write a snapshot of an account to a file.
+
+The snapshot is a gzip-compressed tar file with the account configuration, the
+message database (including the password, login sessions and settings), the
+junk filter and all message files. It can be restored with "mox config account
+restore", on the same or another mox instance. Login attempts and TLS public
+keys for the account are not part of the snapshot.
+
+The account can be in use while making a snapshot. Messages delivered while
+making the snapshot may not be included.
+
+	usage: mox config account snapshot account dst.tgz
+
+# mox config account restore
+
+Restore an account from a snapshot.
+
+The snapshot must have been made with "mox config account snapshot", possibly of
+an account with a different name or on another mox instance. If the account
+does not exist, it is added with the configuration from the snapshot. Its
+addresses must be for configured domains, and must not be in use by other
+accounts.
+
+The account must not be in use during the restore, e.g. for IMAP connections or
+webmail sessions. An existing data directory of the account is moved into the
+"tmp" directory of the data directory, its path is printed. It can be removed
+once the restored account has been verified.
+
+	usage: mox config account restore account src.tgz
+
 # mox config address add
 
 Adds an address to an account and reloads the configuration.
@@ -1000,6 +1637,10 @@ Adds an address to an account and reloads the configuration.
 If address starts with a @ (i.e. a missing localpart), this is a catchall
 address for the domain.
 
+If the domain of the address starts with "*.", e.g. info@*.example.com or
+@*.example.com, this is a wildcard address for all subdomains of the domain,
+e.g. for info@tag.example.com, or anything@tag.example.com.
+
 	usage: mox config address add address account
 
 # mox config address rm
@@ -1052,6 +1693,22 @@ Incoming/outgoing messages involving this domain will be accepted again.
 
 	usage: mox config domain enable domain
 
+# mox config domain lookalikes
+
+List lookalike domains of a domain.
+
+Lookalike domains have typical typos, or characters that look similar. They
+can be used in phishing messages that impersonate the domain. Incoming messages
+from lookalikes of a hosted domain can be rejected or treated as junk with the
+LookalikeSenders field in the domain configuration.
+
+With -dns, DNS is queried for each lookalike to check if it is registered, and
+the MX records of registered lookalikes are printed.
+
+	usage: mox config domain lookalikes [-dns] domain
+	  -dns
+	    	look up whether lookalikes are registered and their mx records
+
 # mox config tlspubkey list
 
 List TLS public keys for TLS client certificate authentication.
@@ -1159,6 +1816,71 @@ Remove addresses from alias (list).
 
 	usage: mox config alias rmaddr alias@domain rcpt1@domain ...
 
+# mox config domainadmin list
+
+List domain admins and the domains they manage.
+
+	usage: mox config domainadmin list
+
+# mox config domainadmin add
+
+Add a domain admin that can only manage the listed domains.
+
+A domain admin logs in to the admin web interface with its name and password.
+It can manage the listed domains, and the accounts and addresses in those
+domains. The domains do not have to exist yet, the domain admin can add them.
+Accounts with addresses outside the listed domains cannot be managed. Set a
+password with "mox config domainadmin setpassword".
+
+	usage: mox config domainadmin add name domain ...
+
+# mox config domainadmin rm
+
+Remove a domain admin. Its existing sessions can no longer be used.
+
+	usage: mox config domainadmin rm name
+
+# mox config domainadmin setpassword
+
+Set a new password for a domain admin.
+
+The password is read from stdin. Its bcrypt hash is stored in the domain admin
+config in domains.conf.
+
+	usage: mox config domainadmin setpassword name
+
+# mox config admintoken list
+
+List admin API tokens, with their domain admin and allowed functions.
+
+	usage: mox config admintoken list
+
+# mox config admintoken add
+
+Add an admin API token and print it.
+
+The token can be used to call the admin web API functions without logging in,
+by sending JSON HTTP POST requests to /admin/api/<function> with header
+"Authorization: Bearer <token>". The request body is a JSON object with field
+"params" holding the list of parameters. The functions are documented at
+/admin/api/.
+
+If functions are listed, the token can only call those functions. With
+-domainadmin, the token has the permissions of that domain admin.
+
+Only a hash of the token is stored in domains.conf, the token is only printed
+once.
+
+	usage: mox config admintoken add [-domainadmin name] name [function ...]
+	  -domainadmin string
+	    	restrict token to the permissions of this domain admin
+
+# mox config admintoken rm
+
+Remove an admin API token. It can no longer be used.
+
+	usage: mox config admintoken rm name
+
 # mox config describe-sendmail
 
 Describe configuration for mox when invoked as sendmail.
@@ -1312,6 +2034,38 @@ key (pkcs#8, pkcs#1 or ec private key) is used.
 
 	usage: mox dane makerecord usage selector matchtype [certificate.pem | publickey.pem | privatekey.pem]
 
+# mox dialcheck
+
+Check how a message to a domain would be delivered, without sending a message.
+
+The same steps as for delivery attempts from the queue are taken: CNAMEs for the
+domain are followed and MX records looked up to find the destination hosts. The
+MTA-STS policy for the domain is fetched, and DANE TLSA records are looked up
+for each host with DNSSEC-verified IPs. The resulting TLS requirements are
+printed. Each host is dialed, and the SMTP session is initialized with EHLO and
+STARTTLS (if applicable), after which the TLS details and announced extensions
+are printed. The connection is closed with QUIT, no MAIL FROM command is sent.
+
+Like the queue, hosts are checked until one accepts the SMTP session, the host a
+delivery would be attempted to. Use -all to check all hosts.
+
+The MTA-STS policy is always fetched, not taken from the cache of the queue, and
+the system certificate pool is used for verification. Delivery attempts by the
+queue can make different decisions based on a previously cached MTA-STS policy,
+and a configured certificate pool, source IPs and transports.
+
+Unlike "mox dane dialmx", hosts without DANE are checked too, with MTA-STS and
+opportunistic TLS as the queue would use, and the session is not connected to
+stdin/stdout.
+
+	usage: mox dialcheck domain
+	  -all
+	    	check all destination hosts, instead of stopping at the first host a delivery would be attempted to
+	  -ehlohostname string
+	    	hostname to send in smtp ehlo command (default "localhost")
+	  -requiretls
+	    	check as if delivering a message that requires verified tls, with the smtp requiretls extension
+
 # mox dns lookup
 
 Lookup DNS name of given type.
@@ -1475,6 +2229,39 @@ automation.
 
 	usage: mox rdap domainage domain
 
+# mox passwordfilter make
+
+Make a bloom filter file with breached passwords, for the password policy.
+
+The passwords are read from stdin, one per line. By default, each line must have
+an SHA-1 hash in hexadecimal, optionally followed by a colon and a count, as in
+the Have I Been Pwned (HIBP) password lists. With -plain, lines are plain text
+passwords.
+
+The size is the size of the file in bytes, and must be a power of two, e.g.
+67108864 (64MiB). The larger the file, the fewer false positives, i.e.
+non-breached passwords being refused. With the default k of 7, a filter with 10
+bits per password has a false positive rate of approximately 1%.
+
+The file can be configured in the PasswordPolicy in mox.conf.
+
+	usage: mox passwordfilter make size file
+	  -k int
+	    	number of bits in the bloom filter per password (default 7)
+	  -plain
+	    	lines on stdin are plain text passwords instead of sha-1 hashes
+
+# mox passwordfilter check
+
+Check if a password is present in a breached password bloom filter file.
+
+The password is read from stdin. The exit code is 1 if the password is present in
+the filter, possibly as false positive.
+
+	usage: mox passwordfilter check file
+	  -k int
+	    	number of bits in the bloom filter per password (default 7)
+
 # mox retrain
 
 Recreate and retrain the junk filter for the account or all accounts.
@@ -1697,6 +2484,115 @@ ancestors. If the direct parent already wasn't available while matching, this is
 stored as the message having a "missing link" to its stored ancestors.
 
 	usage: mox reassignthreads [account]
+
+# mox archivepack
+
+Move old messages into compressed pack files, and repack pack files.
+
+For all accounts, or optionally only the specified account.
+
+Messages received longer ago than the age configured in the ArchiveTier of an
+account are moved from their own on-disk file into compressed pack files with
+many messages. Pack files in which most data is for removed messages are
+rewritten, also for accounts that no longer have an ArchiveTier configured.
+
+Packing is also done automatically once a day for accounts with an ArchiveTier.
+
+	usage: mox archivepack [account]
+
+# mox autoarchive
+
+Move old messages into yearly archive mailboxes.
+
+For all accounts with AutoArchive configured, or optionally only the specified
+account.
+
+Messages received longer ago than the age configured in the AutoArchive of an
+account are moved from the configured mailboxes, by default Inbox, into
+mailboxes named after the year the message was received, under the archive
+mailbox, e.g. Archive/2023. Missing mailboxes are created. Moved messages keep
+their flags, keywords and threads.
+
+Archiving is also done automatically once a day for accounts with AutoArchive.
+
+	usage: mox autoarchive [account]
+
+# mox compressmsgs
+
+Compress the on-disk files of existing messages.
+
+For all accounts with message compression enabled, or optionally only the
+specified account.
+
+With MessageCompression configured, globally or for an account, new messages are
+stored compressed. This command compresses the files of messages delivered
+before compression was enabled. Messages outside the configured size range,
+messages in pack files, and messages that don't become smaller are left as is.
+The message sizes reported to IMAP clients don't change.
+
+	usage: mox compressmsgs [account]
+
+# mox encryptmsgs
+
+Encrypt the on-disk files of existing messages.
+
+For all accounts with message encryption enabled, or optionally only the
+specified account.
+
+With MessageEncryption configured for an account, new messages are stored
+encrypted. This command encrypts the files of messages delivered before
+encryption was enabled. Compressed messages are stored encrypted without
+compression. Messages in pack files are left as is. For accounts with the
+message key protected by the password, the account must have logged in with its
+password since mox started.
+
+	usage: mox encryptmsgs [account]
+
+# mox messageencryption genkey
+
+Generate a master key for message encryption.
+
+The key is written to standard output, as base64-encoded 32 random bytes. Write
+it to a file, and configure the file as MessageEncryptionKeyFile in mox.conf.
+Keep a copy of the key in a safe place: Without it, encrypted messages of
+accounts with MessageEncryption using the master key cannot be read.
+
+	usage: mox messageencryption genkey >messageencryption.key
+
+# mox textindexrebuild
+
+Rebuild the full-text search index of messages.
+
+For all accounts, or optionally only the specified account.
+
+The text index holds the words of each message, and is used by IMAP SEARCH and
+webmail searches to skip messages that cannot match, without reading them. New
+messages are indexed at delivery. This command indexes messages delivered before
+the index existed, and can be used to recover from an inconsistent index.
+Messages without index are searched by reading the message, also while the
+rebuild is in progress.
+
+	usage: mox textindexrebuild [account]
+
+# mox fsck
+
+Check consistency of message database, message files, mailbox counts and UIDs.
+
+For all accounts, or optionally only the specified account.
+
+Checks for messages in the database without message file, for files in the
+message directory without message in the database, for incorrect mailbox
+message counts and total message size, for mailbox UIDNext values not above the
+highest UID in the mailbox, and for an account next UIDValidity not above the
+UIDValidity of its mailboxes.
+
+With -repair, problems are fixed: Messages without file are marked expunged,
+files without message are removed, and counts and UID values are corrected. The
+account is locked during the check. Make a backup before repairing.
+
+	usage: mox fsck [-repair] [account]
+	  -repair
+	    	fix problems that are found
 */
 package main
 
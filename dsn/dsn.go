@@ -75,6 +75,12 @@ type Message struct {
 	// Original message or headers to include in DSN as third MIME part.
 	// Optional. Only used for generating DSNs, not set for parsed DNSs.
 	Original []byte
+
+	// Whether to include all of Original, instead of only its headers. Set for the
+	// DSN extension parameter RET=FULL. If Original has 8bit data and the DSN is
+	// composed without smtputf8, only the headers are included.
+	// ../rfc/3461
+	OriginalFull bool
 }
 
 // Action is a field in a DSN.
@@ -144,7 +150,6 @@ func (m *Message) Compose(log mlog.Log, smtputf8 bool) ([]byte, error) {
 	// - 2. message/delivery-status;
 	// - 3. (optional) original message (either in full, or only headers).
 
-	// todo future: add option to send full message. but only do so if the message is <100kb.
 	// todo future: possibly write to a file directly, instead of building up message in memory.
 
 	// If message does not require smtputf8, we are never generating a utf-8 DSN.
@@ -302,9 +307,26 @@ func (m *Message) Compose(log mlog.Log, smtputf8 bool) ([]byte, error) {
 		}
 	}
 
-	// We include only the header of the original message.
-	// todo: add the textual version of the original message, if it exists and isn't too large.
-	if m.Original != nil {
+	if m.Original != nil && m.OriginalFull && (smtputf8 || !has8bit(m.Original)) {
+		origHdr := textproto.MIMEHeader{}
+		if smtputf8 {
+			// ../rfc/6533
+			origHdr.Set("Content-Type", "message/global")
+			origHdr.Set("Content-Transfer-Encoding", "8BIT")
+		} else {
+			// ../rfc/3464
+			origHdr.Set("Content-Type", "message/rfc822")
+			origHdr.Set("Content-Transfer-Encoding", "7BIT")
+		}
+		origp, err := mp.CreatePart(origHdr)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := origp.Write(m.Original); err != nil {
+			return nil, err
+		}
+	} else if m.Original != nil {
+		// We include only the header of the original message.
 		headers, err := message.ReadHeaders(bufio.NewReader(bytes.NewReader(m.Original)))
 		if err != nil && errors.Is(err, message.ErrHeaderSeparator) {
 			// Whole data is a header.
@@ -312,7 +334,7 @@ func (m *Message) Compose(log mlog.Log, smtputf8 bool) ([]byte, error) {
 		} else if err != nil {
 			return nil, err
 		}
-		// Else, this is a whole message. We still only include the headers. todo: include the whole body.
+		// Else, this is a whole message. We still only include the headers.
 
 		origHdr := textproto.MIMEHeader{}
 		if smtputf8 {
@@ -368,6 +390,15 @@ func (m *Message) Compose(log mlog.Log, smtputf8 bool) ([]byte, error) {
 	return data, nil
 }
 
+func has8bit(buf []byte) bool {
+	for _, b := range buf {
+		if b >= 0x80 {
+			return true
+		}
+	}
+	return false
+}
+
 type errWriter struct {
 	w   *bytes.Buffer
 	err error
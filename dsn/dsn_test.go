@@ -116,6 +116,18 @@ func TestDSN(t *testing.T) {
 	tcompare(t, pmsg.Recipients[0].FinalRecipient, m.Recipients[0].FinalRecipient)
 	// todo: test more fields
 
+	m.OriginalFull = true
+	m.Original = []byte("Subject: test\r\n\r\nbody\r\n")
+	msgbuf, err = m.Compose(log, false)
+	if err != nil {
+		t.Fatalf("composing dsn with full original: %v", err)
+	}
+	_, part = tparseMessage(t, msgbuf, 3)
+	tcheckType(t, &part.Parts[2], "message", "rfc822", "7bit")
+	tcompareReader(t, part.Parts[2].Reader(), m.Original)
+	m.OriginalFull = false
+	m.Original = []byte("Subject: test\r\n")
+
 	msgbufutf8, err := m.Compose(log, true)
 	if err != nil {
 		t.Fatalf("composing dsn with utf-8: %v", err)
@@ -180,6 +192,25 @@ func TestDSN(t *testing.T) {
 	tcompareReader(t, part.Parts[2].Reader(), m.Original)
 	tcompare(t, pmsg.Recipients[0].FinalRecipient, m.Recipients[0].FinalRecipient)
 
+	// Full original message, with 8bit data only included with utf-8 support.
+	m.Original = []byte("Subject: tést\r\n\r\nbødy\r\n")
+	m.OriginalFull = true
+	m.OriginalEnvelopeID = "envid"
+	msgbufutf8, err = m.Compose(log, true)
+	if err != nil {
+		t.Fatalf("composing utf-8 dsn with full original: %v", err)
+	}
+	pmsg, part = tparseMessage(t, msgbufutf8, 3)
+	tcheckType(t, &part.Parts[2], "message", "global", "8bit")
+	tcompareReader(t, part.Parts[2].Reader(), m.Original)
+	tcompare(t, pmsg.OriginalEnvelopeID, "envid")
+	msgbuf, err = m.Compose(log, false)
+	if err != nil {
+		t.Fatalf("composing utf-8 dsn with full original without utf-8 support: %v", err)
+	}
+	_, part = tparseMessage(t, msgbuf, 3)
+	tcheckType(t, &part.Parts[2], "text", "rfc822-headers", "base64")
+
 	// Now a message without 3rd multipart.
 	m.Original = nil
 	msgbufutf8, err = m.Compose(log, true)
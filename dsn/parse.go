@@ -299,6 +299,13 @@ func parseDateTime(s string) (time.Time, error) {
 	return time.Parse(message.RFC5322Z, s)
 }
 
+// ParseOriginalRecipient parses the value of an ORCPT parameter of the SMTP DSN
+// extension (after xtext decoding), with address type "rfc822" or "utf-8", for use
+// as OriginalRecipient in a DSN. ../rfc/3461
+func ParseOriginalRecipient(orcpt string) (smtp.Path, error) {
+	return parseAddress(orcpt, true)
+}
+
 func parseAddress(s string, utf8 bool) (smtp.Path, error) {
 	s = removeComments(s)
 	t := strings.SplitN(s, ";", 2)
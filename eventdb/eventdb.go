@@ -0,0 +1,281 @@
+// Package eventdb stores events in the lifecycle of messages, such as incoming
+// messages being received and delivered, and outgoing messages being queued,
+// delivery attempts and bounces.
+//
+// The events are used for tracing messages, for the delivery status of outgoing
+// messages, and for statistics. Events are removed after a configurable period.
+package eventdb
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/mjl-/bstore"
+
+	"github.com/mjl-/mox/message"
+	"github.com/mjl-/mox/metrics"
+	"github.com/mjl-/mox/mlog"
+	"github.com/mjl-/mox/mox-"
+	"github.com/mjl-/mox/moxvar"
+)
+
+var (
+	DBTypes = []any{Event{}} // Types stored in DB.
+	DB      *bstore.DB       // Exported for backups.
+)
+
+// Kind of event.
+type Kind string
+
+const (
+	// Incoming message received over SMTP for a local recipient.
+	KindReceived Kind = "received"
+
+	// Junk verdict for an incoming message. Success indicates the message was
+	// accepted, Detail holds the reason for the verdict.
+	KindJunkVerdict Kind = "junkverdict"
+
+	// Incoming message delivered to a mailbox of a local account.
+	KindDelivered Kind = "delivered"
+
+	// Outgoing message added to the queue.
+	KindQueued Kind = "queued"
+
+	// Delivery attempt of an outgoing message from the queue that failed
+	// temporarily. Another attempt will be made later.
+	KindAttempt Kind = "attempt"
+
+	// Outgoing message delivered to the next hop.
+	KindSent Kind = "sent"
+
+	// Outgoing message failed permanently, a DSN is delivered to the sender.
+	KindBounced Kind = "bounced"
+)
+
+// Event is a single event in the lifecycle of a message.
+type Event struct {
+	ID   int64
+	Time time.Time `bstore:"default now,index"`
+	Kind Kind      `bstore:"nonzero"`
+
+	// Canonical Message-ID, lower-case, without <>. Can be empty. For tracing a
+	// message across incoming and outgoing deliveries.
+	MessageID string `bstore:"index"`
+
+	// For outgoing messages, the ID of the message in the queue. Zero for incoming
+	// messages.
+	QueueMsgID int64 `bstore:"index"`
+
+	// Account the message was delivered to (for incoming messages), or sent from (for
+	// outgoing messages).
+	Account string `bstore:"index"`
+
+	Mailbox   string // Mailbox for KindDelivered.
+	Sender    string // SMTP MAIL FROM address.
+	Recipient string // SMTP RCPT TO address.
+	RemoteIP  string // For incoming messages.
+	Success   bool   // For KindJunkVerdict, whether the message was accepted.
+	Code      int    // SMTP response code, for outgoing messages.
+	Secode    string // Enhanced status code, for outgoing messages.
+	Detail    string // E.g. junk verdict reason, or error message.
+}
+
+func init() {
+	metrics.DatabaseSize("events", func() string { return mox.DataDirPath("events.db") })
+}
+
+// Init opens the database.
+func Init() error {
+	if DB != nil {
+		return fmt.Errorf("already initialized")
+	}
+
+	log := mlog.New("eventdb", nil)
+	p := mox.DataDirPath("events.db")
+	os.MkdirAll(filepath.Dir(p), 0770)
+	opts := bstore.Options{Timeout: 5 * time.Second, Perm: 0660, RegisterLogger: moxvar.RegisterLogger(p, log.Logger)}
+	var err error
+	DB, err = bstore.Open(mox.Shutdown, p, &opts, DBTypes...)
+	return err
+}
+
+// Close closes the database.
+func Close() error {
+	if err := DB.Close(); err != nil {
+		return fmt.Errorf("closing db: %w", err)
+	}
+	DB = nil
+	return nil
+}
+
+// canonicalMessageID returns the canonical form of a Message-ID header value, or
+// of an already canonical Message-ID.
+func canonicalMessageID(s string) string {
+	if !strings.HasPrefix(strings.TrimSpace(s), "<") {
+		return strings.ToLower(s)
+	}
+	if mid, _, err := message.MessageIDCanonical(s); err == nil {
+		return mid
+	}
+	return strings.ToLower(s)
+}
+
+// Add stores events. Failures to store events are logged, not returned: they
+// must not interfere with processing messages. If the database wasn't
+// initialized, e.g. in tests, the events are ignored.
+func Add(ctx context.Context, log mlog.Log, events ...Event) {
+	if DB == nil || len(events) == 0 {
+		return
+	}
+	err := DB.Write(ctx, func(tx *bstore.Tx) error {
+		for _, e := range events {
+			e.ID = 0
+			e.MessageID = canonicalMessageID(e.MessageID)
+			if e.Time.IsZero() {
+				e.Time = time.Now()
+			}
+			if err := tx.Insert(&e); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	log.Check(err, "adding message lifecycle events")
+}
+
+// EventFilter selects events to list. Zero fields are ignored.
+type EventFilter struct {
+	Max        int // Maximum number of events to return. Default 1000.
+	Start      time.Time
+	End        time.Time
+	Kinds      []Kind
+	MessageID  string // Message-ID, with or without <>.
+	QueueMsgID int64
+	Account    string
+	Address    string // Matches sender or recipient address.
+}
+
+func (f EventFilter) apply(q *bstore.Query[Event]) {
+	if f.MessageID != "" {
+		q.FilterNonzero(Event{MessageID: canonicalMessageID(f.MessageID)})
+	}
+	if f.QueueMsgID != 0 {
+		q.FilterNonzero(Event{QueueMsgID: f.QueueMsgID})
+	}
+	if f.Account != "" {
+		q.FilterNonzero(Event{Account: f.Account})
+	}
+	if !f.Start.IsZero() {
+		q.FilterGreaterEqual("Time", f.Start)
+	}
+	if !f.End.IsZero() {
+		q.FilterLess("Time", f.End)
+	}
+	if len(f.Kinds) > 0 {
+		q.FilterFn(func(e Event) bool { return slices.Contains(f.Kinds, e.Kind) })
+	}
+	if f.Address != "" {
+		addr := strings.ToLower(f.Address)
+		q.FilterFn(func(e Event) bool {
+			return strings.ToLower(e.Sender) == addr || strings.ToLower(e.Recipient) == addr
+		})
+	}
+}
+
+// List returns events matching filter, oldest first. If more events match than
+// the maximum, the most recent events are returned.
+func List(ctx context.Context, filter EventFilter) ([]Event, error) {
+	max := filter.Max
+	if max <= 0 {
+		max = 1000
+	}
+	q := bstore.QueryDB[Event](ctx, DB)
+	filter.apply(q)
+	q.SortDesc("ID")
+	q.Limit(max)
+	l, err := q.List()
+	if err != nil {
+		return nil, err
+	}
+	slices.Reverse(l)
+	return l, nil
+}
+
+// Trace returns all events for a message, by its Message-ID, across incoming
+// and outgoing deliveries.
+func Trace(ctx context.Context, messageID string) ([]Event, error) {
+	if canonicalMessageID(messageID) == "" {
+		return nil, fmt.Errorf("missing message-id")
+	}
+	return List(ctx, EventFilter{MessageID: messageID})
+}
+
+// DeliveryStatus returns events for an outgoing message in the queue, or retired
+// from the queue. If account is not empty, only events for messages sent from
+// that account are returned.
+func DeliveryStatus(ctx context.Context, account string, queueMsgID int64) ([]Event, error) {
+	if queueMsgID <= 0 {
+		return nil, fmt.Errorf("missing queue message id")
+	}
+	return List(ctx, EventFilter{Account: account, QueueMsgID: queueMsgID})
+}
+
+// Stats returns the number of events per kind between start and end.
+func Stats(ctx context.Context, start, end time.Time) (map[Kind]int, error) {
+	counts := map[Kind]int{}
+	q := bstore.QueryDB[Event](ctx, DB)
+	EventFilter{Start: start, End: end}.apply(q)
+	err := q.ForEach(func(e Event) error {
+		counts[e.Kind]++
+		return nil
+	})
+	return counts, err
+}
+
+// Start starts a goroutine that periodically removes events older than the
+// configured period.
+func Start() {
+	go func() {
+		log := mlog.New("eventdb", nil)
+
+		defer func() {
+			x := recover()
+			if x != nil {
+				log.Error("unhandled panic in eventdb cleanup", slog.Any("x", x))
+				debug.PrintStack()
+				metrics.PanicInc(metrics.Eventdb)
+			}
+		}()
+
+		timer := time.NewTimer(time.Minute)
+		for {
+			select {
+			case <-mox.Shutdown.Done():
+				return
+			case <-timer.C:
+			}
+
+			cleanup(log)
+			timer.Reset(time.Hour)
+		}
+	}()
+}
+
+func cleanup(log mlog.Log) {
+	keep := mox.Conf.Static.KeepEventsPeriod
+	if keep <= 0 {
+		keep = 30 * 24 * time.Hour
+	}
+	n, err := bstore.QueryDB[Event](mox.Shutdown, DB).FilterLess("Time", time.Now().Add(-keep)).Delete()
+	log.Check(err, "removing old events")
+	if n > 0 {
+		log.Debug("cleaned up old events", slog.Int("count", n))
+	}
+}
@@ -0,0 +1,106 @@
+package eventdb
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/mjl-/mox/mlog"
+	"github.com/mjl-/mox/mox-"
+)
+
+var ctxbg = context.Background()
+var pkglog = mlog.New("eventdb", nil)
+
+func tcheckf(t *testing.T, err error, format string, args ...any) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("%s: %s", fmt.Sprintf(format, args...), err)
+	}
+}
+
+func TestEvents(t *testing.T) {
+	mox.Shutdown = ctxbg
+	mox.Conf.Static.DataDir = filepath.FromSlash("../testdata/eventdb/data")
+	os.RemoveAll(mox.Conf.Static.DataDir)
+
+	// Without database, events are ignored.
+	Add(ctxbg, pkglog, Event{Kind: KindQueued})
+
+	err := Init()
+	tcheckf(t, err, "init")
+	defer Close()
+
+	now := time.Now()
+	old := now.Add(-40 * 24 * time.Hour)
+	Add(ctxbg, pkglog,
+		Event{Time: old, Kind: KindReceived, MessageID: "<Old@mox.example>", Account: "mjl"},
+		Event{Kind: KindReceived, MessageID: "<Test@Mox.example>", Account: "mjl", Sender: "remote@remote.example", Recipient: "mjl@mox.example"},
+		Event{Kind: KindJunkVerdict, MessageID: "<Test@Mox.example>", Account: "mjl", Success: true, Detail: "no-bad-signals"},
+		Event{Kind: KindDelivered, MessageID: "<Test@Mox.example>", Account: "mjl", Mailbox: "Inbox"},
+		Event{Kind: KindQueued, MessageID: "<Test@Mox.example>", QueueMsgID: 1, Account: "mjl", Recipient: "other@remote.example"},
+		Event{Kind: KindAttempt, QueueMsgID: 1, Account: "mjl", Code: 451, Detail: "try again"},
+		Event{Kind: KindSent, QueueMsgID: 1, Account: "mjl", Code: 250},
+	)
+
+	kinds := func(l []Event) []Kind {
+		var r []Kind
+		for _, e := range l {
+			r = append(r, e.Kind)
+		}
+		return r
+	}
+
+	// Message-ID is canonicalized, both for storing and for matching.
+	l, err := Trace(ctxbg, "test@mox.example")
+	tcheckf(t, err, "trace")
+	if got, exp := kinds(l), []Kind{KindReceived, KindJunkVerdict, KindDelivered, KindQueued}; !reflect.DeepEqual(got, exp) {
+		t.Fatalf("trace, got %v, expected %v", got, exp)
+	}
+	_, err = Trace(ctxbg, "")
+	if err == nil {
+		t.Fatalf("trace without message-id succeeded")
+	}
+
+	l, err = DeliveryStatus(ctxbg, "mjl", 1)
+	tcheckf(t, err, "delivery status")
+	if got, exp := kinds(l), []Kind{KindQueued, KindAttempt, KindSent}; !reflect.DeepEqual(got, exp) {
+		t.Fatalf("delivery status, got %v, expected %v", got, exp)
+	}
+	l, err = DeliveryStatus(ctxbg, "other", 1)
+	tcheckf(t, err, "delivery status for other account")
+	if len(l) != 0 {
+		t.Fatalf("delivery status for other account, got %d events, expected 0", len(l))
+	}
+
+	l, err = List(ctxbg, EventFilter{Address: "OTHER@remote.example"})
+	tcheckf(t, err, "list by address")
+	if got, exp := kinds(l), []Kind{KindQueued}; !reflect.DeepEqual(got, exp) {
+		t.Fatalf("list by address, got %v, expected %v", got, exp)
+	}
+
+	// Most recent events are returned when limited.
+	l, err = List(ctxbg, EventFilter{Max: 2})
+	tcheckf(t, err, "list with max")
+	if got, exp := kinds(l), []Kind{KindAttempt, KindSent}; !reflect.DeepEqual(got, exp) {
+		t.Fatalf("list with max, got %v, expected %v", got, exp)
+	}
+
+	stats, err := Stats(ctxbg, now.Add(-time.Hour), now.Add(time.Hour))
+	tcheckf(t, err, "stats")
+	if exp := map[Kind]int{KindReceived: 1, KindJunkVerdict: 1, KindDelivered: 1, KindQueued: 1, KindAttempt: 1, KindSent: 1}; !reflect.DeepEqual(stats, exp) {
+		t.Fatalf("stats, got %v, expected %v", stats, exp)
+	}
+
+	// Old event is removed with the default retention period.
+	cleanup(pkglog)
+	l, err = List(ctxbg, EventFilter{})
+	tcheckf(t, err, "list after cleanup")
+	if len(l) != 6 {
+		t.Fatalf("list after cleanup, got %d events, expected 6", len(l))
+	}
+}
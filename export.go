@@ -4,6 +4,7 @@ import (
 	"context"
 	"log"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/mjl-/bstore"
@@ -12,23 +13,24 @@ import (
 )
 
 func cmdExportMaildir(c *cmd) {
-	c.params = "[-single] dst-dir account-path [mailbox]"
-	c.help = `Export one or all mailboxes from an account in maildir format.
+	c.params = "[-single] [-since yyyy-mm-dd] [-before yyyy-mm-dd] [-flags flags] [-notflags flags] dst-dir account-path [mailbox ...]"
+	c.help = `Export one, some or all mailboxes from an account in maildir format.
 
 Export bypasses a running mox instance. It opens the account mailbox/message
 database file directly. This may block if a running mox instance also has the
 database open, e.g. for IMAP connections. To export from a running instance, use
 the accounts web page or webmail.
+
+Messages can be selected by the date they were received, and by flags and
+keywords they must or must not have. Flags are separated by spaces, e.g.
+"\Seen $Junk".
 `
-	var single bool
-	c.flag.BoolVar(&single, "single", false, "export single mailbox, without any children. disabled if mailbox isn't specified.")
-	args := c.Parse()
-	xcmdExport(false, single, args, c)
+	exportCmd(store.ExportMaildir, c)
 }
 
 func cmdExportMbox(c *cmd) {
-	c.params = "[-single] dst-dir account-path [mailbox]"
-	c.help = `Export messages from one or all mailboxes in an account in mbox format.
+	c.params = "[-single] [-since yyyy-mm-dd] [-before yyyy-mm-dd] [-flags flags] [-notflags flags] dst-dir account-path [mailbox ...]"
+	c.help = `Export messages from one, some or all mailboxes in an account in mbox format.
 
 Using mbox is not recommended. Maildir is a better format.
 
@@ -40,24 +42,75 @@ the accounts web page or webmail.
 For mbox export, "mboxrd" is used where message lines starting with the magic
 "From " string are escaped by prepending a >. All ">*From " are escaped,
 otherwise reconstructing the original could lose a ">".
+
+Messages can be selected by the date they were received, and by flags and
+keywords they must or must not have. Flags are separated by spaces, e.g.
+"\Seen $Junk".
 `
+	exportCmd(store.ExportMbox, c)
+}
+
+func cmdExportEML(c *cmd) {
+	c.params = "[-single] [-since yyyy-mm-dd] [-before yyyy-mm-dd] [-flags flags] [-notflags flags] dst-dir account-path [mailbox ...]"
+	c.help = `Export messages from one, some or all mailboxes in an account as .eml files.
+
+Each mailbox is exported as a directory, with a file for each message, named
+after the time the message was received and its ID. Messages are stored as
+they were received, with CRLF line endings. Flags are not exported.
+
+Export bypasses a running mox instance. It opens the account mailbox/message
+database file directly. This may block if a running mox instance also has the
+database open, e.g. for IMAP connections. To export from a running instance, use
+the accounts web page.
+
+Messages can be selected by the date they were received, and by flags and
+keywords they must or must not have. Flags are separated by spaces, e.g.
+"\Seen $Junk".
+`
+	exportCmd(store.ExportEML, c)
+}
+
+// exportCmd parses the flags and arguments shared by the export commands and
+// exports.
+func exportCmd(format store.ExportFormat, c *cmd) {
 	var single bool
-	c.flag.BoolVar(&single, "single", false, "export single mailbox, without any children. disabled if mailbox isn't specified.")
+	var since, before, flags, notflags string
+	c.flag.BoolVar(&single, "single", false, "export single mailboxes, without any children. disabled if no mailbox is specified.")
+	c.flag.StringVar(&since, "since", "", "only export messages received on or after this date")
+	c.flag.StringVar(&before, "before", "", "only export messages received before this date")
+	c.flag.StringVar(&flags, "flags", "", "only export messages with all these flags/keywords")
+	c.flag.StringVar(&notflags, "notflags", "", "only export messages without any of these flags/keywords, e.g. \\Deleted")
 	args := c.Parse()
-	xcmdExport(true, single, args, c)
+
+	var filter store.ExportFilter
+	parseDate := func(s, what string) time.Time {
+		if s == "" {
+			return time.Time{}
+		}
+		t, err := time.ParseInLocation("2006-01-02", s, time.Local)
+		xcheckf(err, "parsing %s date", what)
+		return t
+	}
+	filter.Since = parseDate(since, "since")
+	filter.Before = parseDate(before, "before")
+	var err error
+	filter.Flags, filter.Keywords, err = store.ParseFlagsKeywords(strings.Fields(flags))
+	xcheckf(err, "parsing flags")
+	filter.NotFlags, filter.NotKeywords, err = store.ParseFlagsKeywords(strings.Fields(notflags))
+	xcheckf(err, "parsing notflags")
+
+	xcmdExport(format, single, args, filter, c)
 }
 
-func xcmdExport(mbox, single bool, args []string, c *cmd) {
-	if len(args) != 2 && len(args) != 3 {
+func xcmdExport(format store.ExportFormat, single bool, args []string, filter store.ExportFilter, c *cmd) {
+	if len(args) < 2 {
 		c.Usage()
 	}
 
 	dst := args[0]
 	accountDir := args[1]
-	var mailbox string
-	if len(args) == 3 {
-		mailbox = args[2]
-	} else {
+	mailboxes := args[2:]
+	if len(mailboxes) == 0 {
 		single = false
 	}
 
@@ -72,7 +125,7 @@ func xcmdExport(mbox, single bool, args []string, c *cmd) {
 	}()
 
 	a := store.DirArchiver{Dir: dst}
-	err = store.ExportMessages(context.Background(), c.log, db, accountDir, a, !mbox, mailbox, !single)
+	err = store.ExportMessages(context.Background(), c.log, db, accountDir, a, format, mailboxes, !single, filter)
 	xcheckf(err, "exporting messages")
 	err = a.Close()
 	xcheckf(err, "closing archiver")
@@ -0,0 +1,297 @@
+// Package greylist implements greylisting of incoming SMTP deliveries.
+//
+// On first contact, a delivery attempt for a combination of remote network,
+// MAIL FROM and RCPT TO address (a "tuple") is rejected with a temporary error.
+// Legitimate mail servers retry after a while, at which point the remote network
+// is whitelisted. Many spammers don't retry. Remote networks that deliver messages
+// with a good reputation are whitelisted as well.
+package greylist
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/mjl-/bstore"
+
+	"github.com/mjl-/mox/config"
+	"github.com/mjl-/mox/metrics"
+	"github.com/mjl-/mox/mlog"
+	"github.com/mjl-/mox/mox-"
+	"github.com/mjl-/mox/moxvar"
+)
+
+var (
+	DBTypes = []any{Tuple{}, Host{}} // Types stored in DB.
+	DB      *bstore.DB               // Exported for backups.
+)
+
+// Defaults for fields of config.Greylisting.
+const (
+	DelayDefault           = 5 * time.Minute
+	RetryWindowDefault     = 24 * time.Hour
+	WhitelistPeriodDefault = 35 * 24 * time.Hour
+)
+
+// Tuple is a delivery attempt from a remote network that isn't whitelisted.
+type Tuple struct {
+	ID       int64
+	Subnet   string    `bstore:"unique Subnet+MailFrom+RcptTo,nonzero"` // E.g. "192.0.2.0/24" or "2001:db8::/64".
+	MailFrom string    // Lower-case, empty for null reverse path.
+	RcptTo   string    `bstore:"nonzero"` // Lower-case.
+	First    time.Time // Start of the current retry window.
+	Last     time.Time // Most recent attempt.
+	Attempts int
+	Expires  time.Time `bstore:"index"` // End of the retry window, removed after.
+}
+
+// Host is a whitelisted remote network.
+type Host struct {
+	Subnet  string    // E.g. "192.0.2.0/24" or "2001:db8::/64".
+	Reason  string    // Reason for whitelisting, e.g. "retry" or "reputation".
+	Created time.Time `bstore:"default now"`
+	Expires time.Time `bstore:"index"`
+}
+
+// Result of a greylisting check.
+type Result string
+
+const (
+	// Remote network is whitelisted.
+	Whitelisted Result = "whitelisted"
+
+	// Retry within the window of a greylisted tuple, remote network has been
+	// whitelisted.
+	Retried Result = "retried"
+
+	// First contact, or retry before the delay passed. Delivery must be rejected
+	// with a temporary error.
+	Greylisted Result = "greylisted"
+)
+
+func init() {
+	metrics.DatabaseSize("greylist", func() string { return mox.DataDirPath("greylist.db") })
+}
+
+// Init opens the database.
+func Init() error {
+	if DB != nil {
+		return fmt.Errorf("already initialized")
+	}
+
+	log := mlog.New("greylist", nil)
+	p := mox.DataDirPath("greylist.db")
+	os.MkdirAll(filepath.Dir(p), 0770)
+	opts := bstore.Options{Timeout: 5 * time.Second, Perm: 0660, RegisterLogger: moxvar.RegisterLogger(p, log.Logger)}
+	var err error
+	DB, err = bstore.Open(mox.Shutdown, p, &opts, DBTypes...)
+	return err
+}
+
+// Close closes the database.
+func Close() error {
+	if err := DB.Close(); err != nil {
+		return fmt.Errorf("closing db: %w", err)
+	}
+	DB = nil
+	return nil
+}
+
+// Subnet returns the remote network for ip, as used for greylisting: the /24 for
+// IPv4, the /64 for IPv6.
+func Subnet(ip net.IP) string {
+	if ip4 := ip.To4(); ip4 != nil {
+		n := net.IPNet{IP: ip4.Mask(net.CIDRMask(24, 32)), Mask: net.CIDRMask(24, 32)}
+		return n.String()
+	}
+	n := net.IPNet{IP: ip.Mask(net.CIDRMask(64, 128)), Mask: net.CIDRMask(64, 128)}
+	return n.String()
+}
+
+func durationDefault(v, def time.Duration) time.Duration {
+	if v <= 0 {
+		return def
+	}
+	return v
+}
+
+// Check evaluates a delivery attempt from ip for the mailFrom and rcptTo
+// addresses. Whitelisted networks have their whitelisting extended. For networks
+// that aren't whitelisted, first contact is recorded and Greylisted is returned
+// until a retry after the configured delay.
+//
+// If the database isn't initialized, e.g. in tests, Whitelisted is returned.
+func Check(ctx context.Context, log mlog.Log, conf config.Greylisting, ip net.IP, mailFrom, rcptTo string, now time.Time) (result Result, rerr error) {
+	if DB == nil {
+		return Whitelisted, nil
+	}
+
+	delay := durationDefault(conf.Delay, DelayDefault)
+	window := durationDefault(conf.RetryWindow, RetryWindowDefault)
+	whitelistPeriod := durationDefault(conf.WhitelistPeriod, WhitelistPeriodDefault)
+
+	subnet := Subnet(ip)
+	mailFrom = strings.ToLower(mailFrom)
+	rcptTo = strings.ToLower(rcptTo)
+
+	err := DB.Write(ctx, func(tx *bstore.Tx) error {
+		h := Host{Subnet: subnet}
+		err := tx.Get(&h)
+		if err == nil && h.Expires.After(now) {
+			// Only write when extending substantially, to prevent a write for each delivery.
+			if expires := now.Add(whitelistPeriod); expires.Sub(h.Expires) > time.Hour {
+				h.Expires = expires
+				if err := tx.Update(&h); err != nil {
+					return fmt.Errorf("extending whitelisted network: %w", err)
+				}
+			}
+			result = Whitelisted
+			return nil
+		} else if err != nil && !errors.Is(err, bstore.ErrAbsent) {
+			return fmt.Errorf("looking up whitelisted network: %w", err)
+		}
+
+		t, err := bstore.QueryTx[Tuple](tx).FilterNonzero(Tuple{Subnet: subnet, RcptTo: rcptTo}).FilterEqual("MailFrom", mailFrom).Get()
+		if errors.Is(err, bstore.ErrAbsent) {
+			t = Tuple{Subnet: subnet, MailFrom: mailFrom, RcptTo: rcptTo, First: now, Last: now, Attempts: 1, Expires: now.Add(window)}
+			if err := tx.Insert(&t); err != nil {
+				return fmt.Errorf("inserting tuple: %w", err)
+			}
+			result = Greylisted
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("looking up tuple: %w", err)
+		}
+
+		t.Last = now
+		t.Attempts++
+		if now.Sub(t.First) < delay {
+			// Too early, the retry window doesn't start again.
+			result = Greylisted
+			if err := tx.Update(&t); err != nil {
+				return fmt.Errorf("updating tuple: %w", err)
+			}
+			return nil
+		} else if !now.Before(t.Expires) {
+			// Retry window has passed, treat as first contact.
+			t.First = now
+			t.Attempts = 1
+			t.Expires = now.Add(window)
+			result = Greylisted
+			if err := tx.Update(&t); err != nil {
+				return fmt.Errorf("updating tuple: %w", err)
+			}
+			return nil
+		}
+
+		// Proper retry. Whitelist the network, the tuples for it are no longer needed.
+		if err := whitelist(tx, subnet, "retry", now, whitelistPeriod); err != nil {
+			return err
+		}
+		if _, err := bstore.QueryTx[Tuple](tx).FilterNonzero(Tuple{Subnet: subnet}).Delete(); err != nil {
+			return fmt.Errorf("removing tuples for whitelisted network: %w", err)
+		}
+		result = Retried
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	log.Debug("greylist check",
+		slog.String("subnet", subnet),
+		slog.String("mailfrom", mailFrom),
+		slog.String("rcptto", rcptTo),
+		slog.String("result", string(result)))
+	return result, nil
+}
+
+// Whitelist whitelists the remote network of ip, e.g. after delivery of a message
+// with a good reputation.
+//
+// If the database isn't initialized, e.g. in tests, Whitelist does nothing.
+func Whitelist(ctx context.Context, log mlog.Log, conf config.Greylisting, ip net.IP, reason string, now time.Time) error {
+	if DB == nil {
+		return nil
+	}
+	whitelistPeriod := durationDefault(conf.WhitelistPeriod, WhitelistPeriodDefault)
+	subnet := Subnet(ip)
+	err := DB.Write(ctx, func(tx *bstore.Tx) error {
+		if err := whitelist(tx, subnet, reason, now, whitelistPeriod); err != nil {
+			return err
+		}
+		if _, err := bstore.QueryTx[Tuple](tx).FilterNonzero(Tuple{Subnet: subnet}).Delete(); err != nil {
+			return fmt.Errorf("removing tuples for whitelisted network: %w", err)
+		}
+		return nil
+	})
+	if err == nil {
+		log.Debug("greylist whitelisted network", slog.String("subnet", subnet), slog.String("reason", reason))
+	}
+	return err
+}
+
+func whitelist(tx *bstore.Tx, subnet, reason string, now time.Time, period time.Duration) error {
+	h := Host{Subnet: subnet}
+	err := tx.Get(&h)
+	if errors.Is(err, bstore.ErrAbsent) {
+		h = Host{Subnet: subnet, Reason: reason, Created: now, Expires: now.Add(period)}
+		if err := tx.Insert(&h); err != nil {
+			return fmt.Errorf("inserting whitelisted network: %w", err)
+		}
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("looking up whitelisted network: %w", err)
+	}
+	h.Reason = reason
+	h.Expires = now.Add(period)
+	if err := tx.Update(&h); err != nil {
+		return fmt.Errorf("updating whitelisted network: %w", err)
+	}
+	return nil
+}
+
+// Start starts a goroutine that periodically removes expired tuples and
+// whitelisted networks.
+func Start() {
+	go func() {
+		log := mlog.New("greylist", nil)
+
+		defer func() {
+			x := recover()
+			if x != nil {
+				log.Error("unhandled panic in greylist cleanup", slog.Any("x", x))
+				debug.PrintStack()
+				metrics.PanicInc(metrics.Greylist)
+			}
+		}()
+
+		timer := time.NewTimer(time.Minute)
+		for {
+			select {
+			case <-mox.Shutdown.Done():
+				return
+			case <-timer.C:
+			}
+
+			cleanup(log, time.Now())
+			timer.Reset(time.Hour)
+		}
+	}()
+}
+
+func cleanup(log mlog.Log, now time.Time) {
+	nt, err := bstore.QueryDB[Tuple](mox.Shutdown, DB).FilterLess("Expires", now).Delete()
+	log.Check(err, "removing expired greylist tuples")
+	nh, err := bstore.QueryDB[Host](mox.Shutdown, DB).FilterLess("Expires", now).Delete()
+	log.Check(err, "removing expired whitelisted networks")
+	if nt > 0 || nh > 0 {
+		log.Debug("cleaned up greylist", slog.Int("tuples", nt), slog.Int("hosts", nh))
+	}
+}
@@ -0,0 +1,112 @@
+package greylist
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mjl-/bstore"
+
+	"github.com/mjl-/mox/config"
+	"github.com/mjl-/mox/mlog"
+	"github.com/mjl-/mox/mox-"
+)
+
+var ctxbg = context.Background()
+var pkglog = mlog.New("greylist", nil)
+
+func tcheckf(t *testing.T, err error, format string, args ...any) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("%s: %s", fmt.Sprintf(format, args...), err)
+	}
+}
+
+func TestSubnet(t *testing.T) {
+	test := func(ip, exp string) {
+		t.Helper()
+		if s := Subnet(net.ParseIP(ip)); s != exp {
+			t.Fatalf("subnet for %s: got %q, expected %q", ip, s, exp)
+		}
+	}
+	test("192.0.2.10", "192.0.2.0/24")
+	test("::ffff:192.0.2.10", "192.0.2.0/24")
+	test("2001:db8:1:2:3:4:5:6", "2001:db8:1:2::/64")
+}
+
+func TestGreylist(t *testing.T) {
+	mox.Shutdown = ctxbg
+	mox.Conf.Static.DataDir = filepath.FromSlash("../testdata/greylist/data")
+	os.RemoveAll(mox.Conf.Static.DataDir)
+
+	conf := config.Greylisting{}
+	ip := net.ParseIP("192.0.2.10")
+	now := time.Now()
+
+	check := func(ip net.IP, mailFrom, rcptTo string, now time.Time, exp Result) {
+		t.Helper()
+		r, err := Check(ctxbg, pkglog, conf, ip, mailFrom, rcptTo, now)
+		tcheckf(t, err, "check")
+		if r != exp {
+			t.Fatalf("got result %q, expected %q", r, exp)
+		}
+	}
+
+	// Without database, everything is allowed.
+	check(ip, "remote@example.org", "mjl@mox.example", now, Whitelisted)
+
+	err := Init()
+	tcheckf(t, err, "init")
+	defer Close()
+
+	// First contact, and retry before the delay.
+	check(ip, "remote@example.org", "mjl@mox.example", now, Greylisted)
+	check(ip, "remote@example.org", "mjl@mox.example", now.Add(time.Minute), Greylisted)
+
+	// Retry after the retry window is first contact again.
+	check(ip, "remote@example.org", "mjl@mox.example", now.Add(25*time.Hour), Greylisted)
+
+	// Proper retry, from another IP in the same network, with differently cased
+	// addresses.
+	check(net.ParseIP("192.0.2.11"), "Remote@example.org", "MJL@mox.example", now.Add(25*time.Hour+10*time.Minute), Retried)
+	n, err := bstore.QueryDB[Tuple](ctxbg, DB).Count()
+	tcheckf(t, err, "count tuples")
+	if n != 0 {
+		t.Fatalf("got %d tuples after whitelisting, expected 0", n)
+	}
+
+	// Network is whitelisted, also for other addresses, and including null reverse path.
+	check(ip, "", "other@mox.example", now.Add(26*time.Hour), Whitelisted)
+
+	// Other networks are still greylisted.
+	ip2 := net.ParseIP("2001:db8::1")
+	check(ip2, "", "mjl@mox.example", now, Greylisted)
+
+	// Whitelisting, e.g. due to reputation, removes tuples.
+	err = Whitelist(ctxbg, pkglog, conf, ip2, "reputation", now)
+	tcheckf(t, err, "whitelist")
+	check(ip2, "", "mjl@mox.example", now, Whitelisted)
+	h := Host{Subnet: "2001:db8::/64"}
+	err = DB.Get(ctxbg, &h)
+	tcheckf(t, err, "get whitelisted network")
+	if h.Reason != "reputation" {
+		t.Fatalf("got reason %q, expected reputation", h.Reason)
+	}
+
+	// After the whitelist period, the network is greylisted again.
+	check(ip2, "", "mjl@mox.example", now.Add(36*24*time.Hour), Greylisted)
+
+	// Cleanup removes expired whitelisted networks and tuples.
+	cleanup(pkglog, now.Add(40*24*time.Hour))
+	nt, err := bstore.QueryDB[Tuple](ctxbg, DB).Count()
+	tcheckf(t, err, "count tuples")
+	nh, err := bstore.QueryDB[Host](ctxbg, DB).Count()
+	tcheckf(t, err, "count hosts")
+	if nt != 0 || nh != 0 {
+		t.Fatalf("got %d tuples and %d hosts after cleanup, expected none", nt, nh)
+	}
+}
@@ -0,0 +1,197 @@
+package http
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/mjl-/mox/admin"
+	"github.com/mjl-/mox/mlog"
+	"github.com/mjl-/mox/mox-"
+	"github.com/mjl-/mox/queue"
+	"github.com/mjl-/mox/ratelimit"
+	"github.com/mjl-/mox/smtp"
+	"github.com/mjl-/mox/webapi"
+	"github.com/mjl-/mox/webauth"
+)
+
+var metricUnsubscribe = promauto.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "mox_unsubscribe_total",
+		Help: "Number of one-click unsubscribe requests.",
+	},
+	[]string{
+		"kind",   // "alias", "account", or empty for invalid tokens.
+		"result", // "ok", "confirm", "badtoken", "error"
+	},
+)
+
+// Unsubscribe requests are rare per IP. Both confirmation pages and actual
+// unsubscribes count, as do requests with invalid tokens.
+var limiterUnsubscribe = &ratelimit.Limiter{
+	WindowLimits: []ratelimit.WindowLimit{
+		{
+			Window: time.Minute,
+			Limits: [...]int64{10, 30, 90},
+		},
+		{
+			Window: time.Hour,
+			Limits: [...]int64{100, 300, 900},
+		},
+	},
+}
+
+// unsubscribeHandler returns a handler for one-click unsubscribe links, for
+// which the path is a token from mox.UnsubscribeToken. A POST with body
+// "List-Unsubscribe=One-Click", as sent by mail clients for messages with a
+// List-Unsubscribe-Post header, unsubscribes. A GET shows a page with a button
+// that does the same POST, so link scanners that follow URLs in messages don't
+// unsubscribe users.
+func unsubscribeHandler(isForwarded bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		log := pkglog.WithContext(r.Context())
+
+		ip := webauth.RemoteIP(log, isForwarded, r)
+		if ip == nil {
+			http.Error(w, "500 - internal server error - cannot find remote ip", http.StatusInternalServerError)
+			return
+		}
+		if !limiterUnsubscribe.Add(ip, time.Now(), 1) {
+			http.Error(w, "429 - too many requests", http.StatusTooManyRequests)
+			return
+		}
+
+		if r.Method != "GET" && r.Method != "POST" {
+			http.Error(w, "405 - method not allowed - use get or post", http.StatusMethodNotAllowed)
+			return
+		}
+
+		token := r.URL.Path
+		u, err := mox.ParseUnsubscribeToken(token)
+		if err != nil {
+			log.Infox("unsubscribe request with invalid token", err, slog.Any("remoteip", ip))
+			metricUnsubscribe.WithLabelValues("", "badtoken").Inc()
+			http.Error(w, "400 - bad request - invalid unsubscribe link", http.StatusBadRequest)
+			return
+		}
+		kind := "alias"
+		if u.Account != "" {
+			kind = "account"
+		}
+		log = log.With(slog.String("kind", kind), slog.String("address", u.Address), slog.Any("remoteip", ip))
+		if u.Alias != "" {
+			log = log.With(slog.String("alias", u.Alias))
+		} else {
+			log = log.With(slog.String("account", u.Account))
+		}
+
+		if r.Method == "GET" {
+			metricUnsubscribe.WithLabelValues(kind, "confirm").Inc()
+			writeUnsubscribePage(w, fmt.Sprintf(`<p>Unsubscribe <b>%s</b>?</p>
+<form method="POST">
+<input type="hidden" name="List-Unsubscribe" value="One-Click" />
+<button type="submit">Unsubscribe</button>
+</form>
+`, html.EscapeString(u.Address)))
+			return
+		}
+
+		buf, err := io.ReadAll(io.LimitReader(r.Body, 1024))
+		if err != nil || strings.TrimSpace(string(buf)) != "List-Unsubscribe=One-Click" {
+			http.Error(w, `400 - bad request - body must be "List-Unsubscribe=One-Click"`, http.StatusBadRequest)
+			return
+		}
+
+		if err := unsubscribe(r, log, u); err != nil {
+			log.Errorx("unsubscribe", err)
+			metricUnsubscribe.WithLabelValues(kind, "error").Inc()
+			http.Error(w, "500 - internal server error - unsubscribe failed, try again later", http.StatusInternalServerError)
+			return
+		}
+		log.Info("unsubscribed through one-click link")
+		metricUnsubscribe.WithLabelValues(kind, "ok").Inc()
+		writeUnsubscribePage(w, fmt.Sprintf("<p><b>%s</b> has been unsubscribed.</p>\n", html.EscapeString(u.Address)))
+	})
+}
+
+func writeUnsubscribePage(w http.ResponseWriter, body string) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache, max-age=0")
+	fmt.Fprintf(w, `<!doctype html>
+<html>
+<head>
+<meta charset="utf-8" />
+<meta name="viewport" content="width=device-width, initial-scale=1" />
+<title>Unsubscribe</title>
+</head>
+<body>
+%s</body>
+</html>
+`, body)
+}
+
+// unsubscribe removes the address as member from the alias, or adds it to the
+// suppression list of the account. Unsubscribing an address that is no longer
+// a member, or is already suppressed, is not an error: Links can be used
+// multiple times.
+func unsubscribe(r *http.Request, log mlog.Log, u mox.Unsubscribe) error {
+	addr, err := smtp.ParseAddress(u.Address)
+	if err != nil {
+		return fmt.Errorf("parsing address: %v", err)
+	}
+
+	if u.Account != "" {
+		if _, ok := mox.Conf.Account(u.Account); !ok {
+			log.Info("unsubscribe for account that no longer exists")
+			return nil
+		}
+		if sup, err := queue.SuppressionLookup(r.Context(), u.Account, addr.Path()); err != nil {
+			return fmt.Errorf("looking up suppression: %v", err)
+		} else if sup != nil {
+			return nil
+		}
+		sup := webapi.Suppression{
+			Account: u.Account,
+			Manual:  true,
+			Reason:  "unsubscribed through one-click link",
+		}
+		if err := queue.SuppressionAdd(r.Context(), addr.Path(), &sup); err != nil {
+			return fmt.Errorf("adding suppression: %v", err)
+		}
+		return nil
+	}
+
+	aliasAddr, err := smtp.ParseAddress(u.Alias)
+	if err != nil {
+		return fmt.Errorf("parsing alias address: %v", err)
+	}
+	dom, ok := mox.Conf.Domain(aliasAddr.Domain)
+	if !ok {
+		log.Info("unsubscribe for alias in domain that no longer exists")
+		return nil
+	}
+	alias, ok := dom.Aliases[aliasAddr.Localpart.String()]
+	if !ok {
+		log.Info("unsubscribe for alias that no longer exists")
+		return nil
+	}
+	// Find the address as configured, it may be written differently.
+	var member string
+	for _, s := range alias.Addresses {
+		if a, err := smtp.ParseAddress(s); err == nil && strings.EqualFold(a.String(), addr.String()) {
+			member = s
+			break
+		}
+	}
+	if member == "" {
+		return nil
+	}
+	return admin.AliasAddressesRemove(r.Context(), aliasAddr, []string{member})
+}
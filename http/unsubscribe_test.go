@@ -0,0 +1,121 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/mjl-/mox/mox-"
+	"github.com/mjl-/mox/queue"
+	"github.com/mjl-/mox/smtp"
+	"github.com/mjl-/mox/store"
+)
+
+func TestUnsubscribe(t *testing.T) {
+	os.RemoveAll("../testdata/unsubscribe/data")
+	mox.ConfigStaticPath = filepath.FromSlash("../testdata/unsubscribe/mox.conf")
+	mox.ConfigDynamicPath = filepath.Join(filepath.Dir(mox.ConfigStaticPath), "domains.conf")
+	mox.MustLoadConfig(true, false)
+
+	// Unsubscribing from the alias changes domains.conf.
+	origConf, err := os.ReadFile(mox.ConfigDynamicPath)
+	tcheck(t, err, "read domains.conf")
+	defer func() {
+		err := os.WriteFile(mox.ConfigDynamicPath, origConf, 0660)
+		tcheck(t, err, "restore domains.conf")
+	}()
+
+	err = store.Init(context.Background())
+	tcheck(t, err, "store init")
+	defer func() {
+		err := store.Close()
+		tcheck(t, err, "store close")
+	}()
+	err = queue.Init()
+	tcheck(t, err, "queue init")
+	defer queue.Shutdown()
+
+	handler := http.StripPrefix("/unsubscribe/", unsubscribeHandler(false))
+
+	test := func(method, target, body string, expCode int) string {
+		t.Helper()
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rw := httptest.NewRecorder()
+		handler.ServeHTTP(rw, req)
+		if rw.Code != expCode {
+			t.Fatalf("%s %s: got status %d, expected %d, body %q", method, target, rw.Code, expCode, rw.Body.String())
+		}
+		return rw.Body.String()
+	}
+
+	aliasURL, ok := mox.UnsubscribeURL(mox.Unsubscribe{Alias: "list@mox.example", Address: "remote@remote.example"})
+	if !ok {
+		t.Fatalf("no unsubscribe url")
+	}
+	if !strings.HasPrefix(aliasURL, "https://mox.example:1443/unsubscribe/") {
+		t.Fatalf("unexpected unsubscribe url %q", aliasURL)
+	}
+	hdrs := mox.UnsubscribeHeaders(mox.Unsubscribe{Alias: "list@mox.example", Address: "remote@remote.example"})
+	if hdrs != "List-Unsubscribe: <"+aliasURL+">\r\nList-Unsubscribe-Post: List-Unsubscribe=One-Click\r\n" {
+		t.Fatalf("unexpected unsubscribe headers %q", hdrs)
+	}
+
+	// Modified token.
+	token := strings.TrimPrefix(aliasURL, "https://mox.example:1443/unsubscribe/")
+	badToken := mox.UnsubscribeToken(mox.Unsubscribe{Alias: "list@mox.example", Address: "other@remote.example"})
+	badToken = badToken[:10] + token[10:]
+	test("POST", "/unsubscribe/"+badToken, "List-Unsubscribe=One-Click", http.StatusBadRequest)
+	test("GET", "/unsubscribe/bogus", "", http.StatusBadRequest)
+
+	// GET only shows confirmation, doesn't change anything.
+	if s := test("GET", "/unsubscribe/"+token, "", http.StatusOK); !strings.Contains(s, "remote@remote.example") {
+		t.Fatalf("confirmation page does not mention address: %q", s)
+	}
+	test("POST", "/unsubscribe/"+token, "", http.StatusBadRequest)
+	test("PUT", "/unsubscribe/"+token, "List-Unsubscribe=One-Click", http.StatusMethodNotAllowed)
+	alias := mox.Conf.Dynamic.Domains["mox.example"].Aliases["list"]
+	if len(alias.Addresses) != 3 {
+		t.Fatalf("alias changed before unsubscribe: %v", alias.Addresses)
+	}
+
+	// Member is removed, address compared case-insensitively. Repeating is fine.
+	test("POST", "/unsubscribe/"+token, "List-Unsubscribe=One-Click", http.StatusOK)
+	alias = mox.Conf.Dynamic.Domains["mox.example"].Aliases["list"]
+	if !slices.Equal(alias.Addresses, []string{"mjl@mox.example", "other@remote.example"}) {
+		t.Fatalf("unexpected alias members after unsubscribe: %v", alias.Addresses)
+	}
+	test("POST", "/unsubscribe/"+token, "List-Unsubscribe=One-Click", http.StatusOK)
+
+	// Unsubscribe from messages of an account, adding to suppression list.
+	token = mox.UnsubscribeToken(mox.Unsubscribe{Account: "mjl", Address: "rcpt@remote.example"})
+	test("POST", "/unsubscribe/"+token, "List-Unsubscribe=One-Click", http.StatusOK)
+	test("POST", "/unsubscribe/"+token, "List-Unsubscribe=One-Click", http.StatusOK)
+	addr, err := smtp.ParseAddress("rcpt@remote.example")
+	tcheck(t, err, "parse address")
+	sup, err := queue.SuppressionLookup(context.Background(), "mjl", addr.Path())
+	tcheck(t, err, "lookup suppression")
+	if sup == nil || sup.Reason != "unsubscribed through one-click link" {
+		t.Fatalf("unexpected suppression %v", sup)
+	}
+
+	// Requests are rate limited per IP.
+	var limited bool
+	for range 20 {
+		req := httptest.NewRequest("GET", "/unsubscribe/"+token, nil)
+		rw := httptest.NewRecorder()
+		handler.ServeHTTP(rw, req)
+		if rw.Code == http.StatusTooManyRequests {
+			limited = true
+			break
+		}
+	}
+	if !limited {
+		t.Fatalf("requests not rate limited")
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"compress/gzip"
 	"context"
 	"crypto/tls"
+	"errors"
 	"fmt"
 	"io"
 	golog "log"
@@ -36,11 +37,13 @@ import (
 	"github.com/mjl-/mox/imapserver"
 	"github.com/mjl-/mox/mlog"
 	"github.com/mjl-/mox/mox-"
+	"github.com/mjl-/mox/proxyproto"
 	"github.com/mjl-/mox/ratelimit"
 	"github.com/mjl-/mox/smtpserver"
 	"github.com/mjl-/mox/webaccount"
 	"github.com/mjl-/mox/webadmin"
 	"github.com/mjl-/mox/webapisrv"
+	"github.com/mjl-/mox/webjmap"
 	"github.com/mjl-/mox/webmail"
 )
 
@@ -540,6 +543,15 @@ func redirectToTrailingSlash(srv *serve, hostMatch func(dns.IPDomain) bool, name
 	}
 }
 
+// jmapWellKnown redirects /.well-known/jmap to the JMAP session resource, for
+// service discovery. ../rfc/8620
+func jmapWellKnown(srv *serve, hostMatch func(dns.IPDomain) bool, path string) {
+	handler := mox.SafeHeaders(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, path+"session", http.StatusTemporaryRedirect)
+	}))
+	srv.ServiceHandle("jmap", hostMatch, "/.well-known/jmap", handler)
+}
+
 // Listen binds to sockets for HTTP listeners, including those required for ACME to
 // generate TLS certificates. It stores the listeners so Serve can start serving them.
 func Listen() {
@@ -624,6 +636,16 @@ func portServes(name string, l config.Listener) map[int]*serve {
 		}
 	}
 
+	// Serve well-known files configured for domains, e.g. security.txt, on servers for
+	// the domain and its subdomains, if not already added.
+	ensureWellKnown := func(srv *serve) {
+		if !slices.Contains(srv.Kinds, "wellknown") {
+			srv.Kinds = append(srv.Kinds, "wellknown")
+			srv.SystemHandle("securitytxt", securityTXTMatch, "/.well-known/security.txt", mox.SafeHeaders(http.HandlerFunc(securityTXTHandle)))
+			srv.SystemHandle("changepassword", changePasswordMatch, "/.well-known/change-password", mox.SafeHeaders(http.HandlerFunc(changePasswordHandle)))
+		}
+	}
+
 	if l.TLS != nil && l.TLS.ACME != "" && (l.SMTP.Enabled && !l.SMTP.NoSTARTTLS || l.Submissions.Enabled || l.IMAPS.Enabled) {
 		port := config.Port(mox.Conf.Static.ACME[l.TLS.ACME].Port, 443)
 		ensureServe(true, port, "acme-tls-alpn-01", false)
@@ -727,6 +749,41 @@ func portServes(name string, l config.Listener) map[int]*serve {
 		srv.ServiceHandle("webapi", accountHostMatch, path, handler)
 		redirectToTrailingSlash(srv, accountHostMatch, "webapi", path)
 	}
+	if l.JMAPHTTP.Enabled {
+		port := config.Port(l.JMAPHTTP.Port, 80)
+		path := "/jmap/"
+		if l.JMAPHTTP.Path != "" {
+			path = l.JMAPHTTP.Path
+		}
+		srv := ensureServe(false, port, "jmap-http at "+path, true)
+		handler := mox.SafeHeaders(http.StripPrefix(path[:len(path)-1], webjmap.NewServer(path, l.JMAPHTTP.Forwarded)))
+		srv.ServiceHandle("jmap", accountHostMatch, path, handler)
+		redirectToTrailingSlash(srv, accountHostMatch, "jmap", path)
+		jmapWellKnown(srv, accountHostMatch, path)
+		ensureACMEHTTP01(srv)
+	}
+	if l.JMAPHTTPS.Enabled {
+		port := config.Port(l.JMAPHTTPS.Port, 443)
+		path := "/jmap/"
+		if l.JMAPHTTPS.Path != "" {
+			path = l.JMAPHTTPS.Path
+		}
+		srv := ensureServe(true, port, "jmap-https at "+path, true)
+		handler := mox.SafeHeaders(http.StripPrefix(path[:len(path)-1], webjmap.NewServer(path, l.JMAPHTTPS.Forwarded)))
+		srv.ServiceHandle("jmap", accountHostMatch, path, handler)
+		redirectToTrailingSlash(srv, accountHostMatch, "jmap", path)
+		jmapWellKnown(srv, accountHostMatch, path)
+	}
+	if l.UnsubscribeHTTPS.Enabled {
+		port := config.Port(l.UnsubscribeHTTPS.Port, 443)
+		path := "/unsubscribe/"
+		if l.UnsubscribeHTTPS.Path != "" {
+			path = l.UnsubscribeHTTPS.Path
+		}
+		srv := ensureServe(true, port, "unsubscribe-https at "+path, false)
+		handler := mox.SafeHeaders(http.StripPrefix(path, unsubscribeHandler(l.UnsubscribeHTTPS.Forwarded)))
+		srv.ServiceHandle("unsubscribe", listenerHostMatch, path, handler)
+	}
 
 	if l.WebmailHTTP.Enabled {
 		port := config.Port(l.WebmailHTTP.Port, 80)
@@ -811,6 +868,7 @@ func portServes(name string, l config.Listener) map[int]*serve {
 		srv.SystemHandle("autodiscover", autoconfigMatch, "/autodiscover/autodiscover.xml", mox.SafeHeaders(http.HandlerFunc(autodiscoverHandle)))
 		srv.SystemHandle("mobileconfig", autoconfigMatch, "/profile.mobileconfig", mox.SafeHeaders(http.HandlerFunc(mobileconfigHandle)))
 		srv.SystemHandle("mobileconfigqrcodepng", autoconfigMatch, "/profile.mobileconfig.qrcode.png", mox.SafeHeaders(http.HandlerFunc(mobileconfigQRCodeHandle)))
+		ensureWellKnown(srv)
 	}
 	if l.MTASTSHTTPS.Enabled {
 		port := config.Port(l.MTASTSHTTPS.Port, 443)
@@ -827,6 +885,16 @@ func portServes(name string, l config.Listener) map[int]*serve {
 			return strings.HasPrefix(dom.ASCII, "mta-sts.")
 		}
 		srv.SystemHandle("mtasts", mtastsMatch, "/.well-known/mta-sts.txt", mox.SafeHeaders(http.HandlerFunc(mtastsPolicyHandle)))
+		ensureWellKnown(srv)
+	}
+	if l.WKDHTTPS.Enabled {
+		port := config.Port(l.WKDHTTPS.Port, 443)
+		srv := ensureServe(!l.WKDHTTPS.NonTLS, port, "wkd-https", false)
+		if l.WKDHTTPS.NonTLS {
+			ensureACMEHTTP01(srv)
+		}
+		srv.SystemHandle("wkd", wkdMatch, "/.well-known/openpgpkey/", mox.SafeHeaders(http.HandlerFunc(wkdHandle)))
+		ensureWellKnown(srv)
 	}
 	if l.PprofHTTP.Enabled {
 		// Importing net/http/pprof registers handlers on the default serve mux.
@@ -842,12 +910,14 @@ func portServes(name string, l config.Listener) map[int]*serve {
 		port := config.Port(l.WebserverHTTP.Port, 80)
 		srv := ensureServe(false, port, "webserver-http", false)
 		srv.Webserver = true
+		ensureWellKnown(srv)
 		ensureACMEHTTP01(srv)
 	}
 	if l.WebserverHTTPS.Enabled {
 		port := config.Port(l.WebserverHTTPS.Port, 443)
 		srv := ensureServe(true, port, "webserver-https", false)
 		srv.Webserver = true
+		ensureWellKnown(srv)
 	}
 
 	if l.TLS != nil && l.TLS.ACME != "" {
@@ -941,6 +1011,9 @@ func listen1(ip string, port int, tlsConfig *tls.Config, name string, kinds []st
 		if err != nil {
 			pkglog.Fatalx("http: listen", err, slog.Any("addr", addr))
 		}
+		if pp := mox.Conf.Static.Listeners[name].ProxyProtocol; pp != nil {
+			ln = &proxyproto.Listener{Listener: ln, Networks: pp.ParsedNetworks, Timeout: 30 * time.Second}
+		}
 	} else {
 		protocol = "https"
 		if os.Getuid() == 0 {
@@ -953,6 +1026,9 @@ func listen1(ip string, port int, tlsConfig *tls.Config, name string, kinds []st
 		if err != nil {
 			pkglog.Fatalx("https: listen", err, slog.String("addr", addr))
 		}
+		if pp := mox.Conf.Static.Listeners[name].ProxyProtocol; pp != nil {
+			ln = &proxyproto.Listener{Listener: ln, Networks: pp.ParsedNetworks, Timeout: 30 * time.Second}
+		}
 		ln = tls.NewListener(ln, tlsConfig)
 	}
 
@@ -974,6 +1050,10 @@ func listen1(ip string, port int, tlsConfig *tls.Config, name string, kinds []st
 	}
 	serve := func() {
 		err := server.Serve(ln)
+		if errors.Is(err, net.ErrClosed) {
+			// Listener closed with mox.CloseListeners.
+			return
+		}
 		pkglog.Fatalx(protocol+": serve", err)
 	}
 	servers = append(servers, serve)
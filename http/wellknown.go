@@ -0,0 +1,100 @@
+package http
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/mjl-/mox/config"
+	"github.com/mjl-/mox/dns"
+	"github.com/mjl-/mox/mox-"
+)
+
+// wellKnownDomain returns the WellKnown config of the domain for host, which is
+// either a configured domain or one of the subdomains served by mox for a domain.
+func wellKnownDomain(host dns.Domain) *config.WellKnown {
+	if host.IsZero() {
+		return nil
+	}
+	for _, prefix := range []string{"mta-sts.", "autoconfig.", "openpgpkey."} {
+		if strings.HasPrefix(host.ASCII, prefix) {
+			host.ASCII = strings.TrimPrefix(host.ASCII, prefix)
+			host.Unicode = strings.TrimPrefix(host.Unicode, prefix)
+			break
+		}
+	}
+	dc, ok := mox.Conf.Domain(host)
+	if !ok || dc.Disabled {
+		return nil
+	}
+	return dc.WellKnown
+}
+
+// requestDomain returns the domain from the host of the request, without port.
+func requestDomain(r *http.Request) dns.Domain {
+	host := r.Host
+	if nhost, _, err := net.SplitHostPort(host); err == nil {
+		host = nhost
+	}
+	d, _ := dns.ParseDomain(host)
+	return d
+}
+
+func securityTXTMatch(ipdom dns.IPDomain) bool {
+	wk := wellKnownDomain(ipdom.Domain)
+	return wk != nil && wk.SecurityTXT != nil
+}
+
+func changePasswordMatch(ipdom dns.IPDomain) bool {
+	wk := wellKnownDomain(ipdom.Domain)
+	return wk != nil && wk.ChangePasswordURL != ""
+}
+
+// securityTXTHandle serves a security.txt file composed from the domain config.
+func securityTXTHandle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" && r.Method != "HEAD" {
+		http.Error(w, "405 - method not allowed - get or head required", http.StatusMethodNotAllowed)
+		return
+	}
+	wk := wellKnownDomain(requestDomain(r))
+	if wk == nil || wk.SecurityTXT == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	_, _ = w.Write([]byte(securityTXT(*wk.SecurityTXT)))
+}
+
+// securityTXT returns the contents of a security.txt file, RFC 9116.
+func securityTXT(st config.SecurityTXT) string {
+	var b strings.Builder
+	add := func(k string, l []string) {
+		for _, v := range l {
+			fmt.Fprintf(&b, "%s: %s\n", k, v)
+		}
+	}
+	add("Contact", st.Contact)
+	add("Expires", []string{st.ExpiresParsed.UTC().Format(time.RFC3339)})
+	add("Encryption", st.Encryption)
+	add("Acknowledgments", st.Acknowledgments)
+	if len(st.PreferredLanguages) > 0 {
+		add("Preferred-Languages", []string{strings.Join(st.PreferredLanguages, ", ")})
+	}
+	add("Canonical", st.Canonical)
+	add("Policy", st.Policy)
+	add("Hiring", st.Hiring)
+	return b.String()
+}
+
+// changePasswordHandle redirects to the configured page for changing passwords.
+func changePasswordHandle(w http.ResponseWriter, r *http.Request) {
+	wk := wellKnownDomain(requestDomain(r))
+	if wk == nil || wk.ChangePasswordURL == "" {
+		http.NotFound(w, r)
+		return
+	}
+	http.Redirect(w, r, wk.ChangePasswordURL, http.StatusFound)
+}
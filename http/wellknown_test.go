@@ -0,0 +1,50 @@
+package http
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/mjl-/mox/mox-"
+)
+
+func TestWellKnown(t *testing.T) {
+	mox.ConfigStaticPath = filepath.FromSlash("../testdata/web/mox.conf")
+	mox.ConfigDynamicPath = filepath.Join(filepath.Dir(mox.ConfigStaticPath), "domains.conf")
+	mox.MustLoadConfig(true, false)
+
+	portSrvs := portServes("local", mox.Conf.Static.Listeners["local"])
+	srv := portSrvs[80]
+
+	test := func(target string, expCode int, expHeaders map[string]string, expContent string) {
+		t.Helper()
+
+		req := httptest.NewRequest("GET", target, nil)
+		rw := httptest.NewRecorder()
+		rw.Body = &bytes.Buffer{}
+		srv.ServeHTTP(rw, req)
+		resp := rw.Result()
+		if resp.StatusCode != expCode {
+			t.Fatalf("%s: got statuscode %d, expected %d", target, resp.StatusCode, expCode)
+		}
+		for k, v := range expHeaders {
+			if xv := resp.Header.Get(k); xv != v {
+				t.Fatalf("%s: got header %q: %q, expected %q", target, k, xv, v)
+			}
+		}
+		if expContent != "" && rw.Body.String() != expContent {
+			t.Fatalf("%s: got response data %q, expected %q", target, rw.Body.String(), expContent)
+		}
+	}
+
+	const securityTXT = "Contact: mailto:security@mox.example\nExpires: 2030-01-01T00:00:00Z\nPreferred-Languages: en, nl\n"
+	test("http://mox.example/.well-known/security.txt", http.StatusOK, map[string]string{"Content-Type": "text/plain; charset=utf-8"}, securityTXT)
+	test("http://mta-sts.mox.example/.well-known/security.txt", http.StatusOK, nil, securityTXT)
+	test("http://openpgpkey.mox.example/.well-known/security.txt", http.StatusOK, nil, securityTXT)
+	test("http://mox.example/.well-known/change-password", http.StatusFound, map[string]string{"Location": "https://mail.mox.example/"}, "")
+	// Domain without well-known files.
+	test("http://other.example/.well-known/security.txt", http.StatusNotFound, nil, "")
+	test("http://other.example/.well-known/change-password", http.StatusNotFound, nil, "")
+}
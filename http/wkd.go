@@ -0,0 +1,121 @@
+package http
+
+import (
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/mjl-/mox/dns"
+	"github.com/mjl-/mox/mlog"
+	"github.com/mjl-/mox/mox-"
+	"github.com/mjl-/mox/smtp"
+	"github.com/mjl-/mox/store"
+)
+
+// wkdMatch returns whether the host is for a domain with WKD, either
+// "openpgpkey.<domain>" for the advanced method or "<domain>" for the direct
+// method.
+func wkdMatch(ipdom dns.IPDomain) bool {
+	dom := ipdom.Domain
+	if dom.IsZero() {
+		return false
+	}
+	if strings.HasPrefix(dom.ASCII, "openpgpkey.") {
+		dom.ASCII = strings.TrimPrefix(dom.ASCII, "openpgpkey.")
+		dom.Unicode = strings.TrimPrefix(dom.Unicode, "openpgpkey.")
+	}
+	dc, ok := mox.Conf.Domain(dom)
+	return ok && dc.WKD != nil
+}
+
+// wkdHandle serves the WKD policy file and OpenPGP keys published by accounts.
+func wkdHandle(w http.ResponseWriter, r *http.Request) {
+	log := func() mlog.Log {
+		return pkglog.WithContext(r.Context())
+	}
+
+	if r.Method != "GET" && r.Method != "HEAD" {
+		http.Error(w, "405 - method not allowed - get or head required", http.StatusMethodNotAllowed)
+		return
+	}
+
+	host := strings.ToLower(r.Host)
+	if nhost, _, err := net.SplitHostPort(host); err == nil {
+		// Only relevant for when host has a port.
+		host = nhost
+	}
+	path := strings.TrimPrefix(r.URL.Path, "/.well-known/openpgpkey/")
+	if strings.HasPrefix(host, "openpgpkey.") {
+		// Advanced method, path starts with the domain.
+		host = strings.TrimPrefix(host, "openpgpkey.")
+		t := strings.SplitN(path, "/", 2)
+		if len(t) != 2 || !strings.EqualFold(t[0], host) {
+			http.NotFound(w, r)
+			return
+		}
+		path = t[1]
+	}
+	domain, err := dns.ParseDomain(host)
+	if err != nil {
+		log().Debugx("wkd request: bad domain", err, slog.String("host", host))
+		http.NotFound(w, r)
+		return
+	}
+	if dc, ok := mox.Conf.Domain(domain); !ok || dc.WKD == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	// Keys can be fetched by web-based mail clients.
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	if path == "policy" {
+		// We don't announce any policy options, the file indicates WKD support.
+		w.Header().Set("Content-Type", "text/plain")
+		return
+	}
+	hash, ok := strings.CutPrefix(path, "hu/")
+	if !ok || hash == "" || strings.Contains(hash, "/") {
+		http.NotFound(w, r)
+		return
+	}
+
+	keys, err := store.OpenPGPKeyLookup(r.Context(), domain.ASCII, hash)
+	if err != nil {
+		log().Errorx("looking up openpgp keys", err)
+		http.Error(w, "500 - internal server error", http.StatusInternalServerError)
+		return
+	}
+	// With case-sensitive localparts, multiple addresses can have the same hash. The
+	// "l" parameter holds the original localpart.
+	if lp := r.URL.Query().Get("l"); lp != "" && len(keys) > 1 {
+		var l []store.OpenPGPKey
+		for _, k := range keys {
+			if addr, err := smtp.ParseAddress(k.Address); err == nil && string(addr.Localpart) == lp {
+				l = append(l, k)
+			}
+		}
+		keys = l
+	}
+	var data []byte
+	for _, k := range keys {
+		addr, err := smtp.ParseAddress(k.Address)
+		if err == nil {
+			err = store.OpenPGPKeyAllowed(k.Account, addr)
+		}
+		if err != nil {
+			// Address may have been removed from account, or policy changed.
+			log().Debugx("not serving openpgp key", err, slog.String("address", k.Address), slog.String("account", k.Account))
+			continue
+		}
+		data = append(data, k.KeyData...)
+	}
+	if len(data) == 0 {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Cache-Control", "no-cache, max-age=0")
+	_, _ = w.Write(data)
+}
@@ -0,0 +1,93 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mjl-/mox/config"
+	"github.com/mjl-/mox/dns"
+	"github.com/mjl-/mox/mox-"
+	"github.com/mjl-/mox/smtp"
+	"github.com/mjl-/mox/store"
+	"github.com/mjl-/mox/wkd"
+)
+
+func TestWKD(t *testing.T) {
+	os.RemoveAll("../testdata/web/data")
+	mox.ConfigStaticPath = filepath.FromSlash("../testdata/web/mox.conf")
+	mox.ConfigDynamicPath = filepath.Join(filepath.Dir(mox.ConfigStaticPath), "domains.conf")
+	mox.MustLoadConfig(true, false)
+
+	err := store.Init(context.Background())
+	tcheck(t, err, "store init")
+	defer func() {
+		err := store.Close()
+		tcheck(t, err, "store close")
+	}()
+
+	// Minimal key, with public key and user id packet. Signatures aren't checked.
+	pubkey := "\x04\x00\x00\x00\x00\x16fake-key-material"
+	uid := "mjl@mox.example"
+	keyData := append([]byte{0xc6, byte(len(pubkey))}, pubkey...)
+	keyData = append(append(keyData, 0xcd, byte(len(uid))), uid...)
+	k, err := store.ParseOpenPGPKey("mjl@mox.example", keyData)
+	tcheck(t, err, "parse key")
+	k.Account = "mjl"
+	err = store.OpenPGPKeyAllowed(k.Account, smtp.NewAddress("mjl", dns.Domain{ASCII: "mox.example"}))
+	tcheck(t, err, "key allowed")
+	err = store.OpenPGPKeySave(context.Background(), &k)
+	tcheck(t, err, "save key")
+
+	_, err = store.ParseOpenPGPKey("other@mox.example", keyData)
+	if err == nil {
+		t.Fatalf("parsed key for address without user id")
+	}
+
+	portSrvs := portServes("local", mox.Conf.Static.Listeners["local"])
+	srv := portSrvs[80]
+
+	test := func(method, target string, expCode int, expContent []byte) {
+		t.Helper()
+
+		req := httptest.NewRequest(method, target, nil)
+		rw := httptest.NewRecorder()
+		rw.Body = &bytes.Buffer{}
+		srv.ServeHTTP(rw, req)
+		resp := rw.Result()
+		if resp.StatusCode != expCode {
+			t.Fatalf("%s %s: got statuscode %d, expected %d", method, target, resp.StatusCode, expCode)
+		}
+		if expContent != nil && !bytes.Equal(rw.Body.Bytes(), expContent) {
+			t.Fatalf("%s %s: got response data %q, expected %q", method, target, rw.Body.Bytes(), expContent)
+		}
+	}
+
+	hash := wkd.Hash("mjl")
+	test("GET", "http://openpgpkey.mox.example/.well-known/openpgpkey/mox.example/policy", http.StatusOK, []byte{})
+	test("GET", "http://mox.example/.well-known/openpgpkey/policy", http.StatusOK, []byte{})
+	test("GET", "http://openpgpkey.mox.example/.well-known/openpgpkey/mox.example/hu/"+hash+"?l=mjl", http.StatusOK, keyData)
+	test("GET", "http://mox.example/.well-known/openpgpkey/hu/"+hash, http.StatusOK, keyData)
+	test("POST", "http://mox.example/.well-known/openpgpkey/hu/"+hash, http.StatusMethodNotAllowed, nil)
+	test("GET", "http://mox.example/.well-known/openpgpkey/hu/"+wkd.Hash("other"), http.StatusNotFound, nil)
+	test("GET", "http://openpgpkey.mox.example/.well-known/openpgpkey/other.example/hu/"+hash, http.StatusNotFound, nil)
+	// Domain without WKD.
+	test("GET", "http://openpgpkey.other.example/.well-known/openpgpkey/other.example/policy", http.StatusNotFound, nil)
+
+	// Keys are no longer served when the account is not allowed to publish.
+	dc := mox.Conf.Dynamic.Domains["mox.example"]
+	orig := dc.WKD
+	dc.WKD = &config.WKD{Accounts: []string{"other"}}
+	mox.Conf.Dynamic.Domains["mox.example"] = dc
+	test("GET", "http://mox.example/.well-known/openpgpkey/hu/"+hash, http.StatusNotFound, nil)
+	dc.WKD = orig
+	mox.Conf.Dynamic.Domains["mox.example"] = dc
+
+	err = store.OpenPGPKeyRemove(context.Background(), "mjl", "mjl@mox.example")
+	tcheck(t, err, "remove key")
+	test("GET", "http://mox.example/.well-known/openpgpkey/hu/"+hash, http.StatusNotFound, nil)
+}
@@ -2,6 +2,7 @@ package imapclient
 
 import (
 	"bufio"
+	"bytes"
 	"crypto/tls"
 	"encoding/base64"
 	"fmt"
@@ -116,6 +117,17 @@ func (c *Conn) AuthenticateSCRAM(method string, h func() hash.Hash, username, pa
 	return c.ResponseOK()
 }
 
+// Unauthenticate returns the connection to the not authenticated state with the
+// UNAUTHENTICATE command, after which it can be authenticated again, possibly as
+// another user. Enabled capabilities are reset.
+func (c *Conn) Unauthenticate() (untagged []Untagged, result Result, rerr error) {
+	defer c.recover(&rerr)
+	untagged, result, rerr = c.Transactf("unauthenticate")
+	c.xcheck(rerr)
+	c.CapEnabled = map[Capability]struct{}{}
+	return untagged, result, nil
+}
+
 // Enable enables capabilities for use with the connection, verifying the server has indeed enabled them.
 func (c *Conn) Enable(capabilities ...string) (untagged []Untagged, result Result, rerr error) {
 	defer c.recover(&rerr)
@@ -224,7 +236,12 @@ func (c *Conn) Append(mailbox string, flags []string, received *time.Time, messa
 	if received != nil {
 		date = ` "` + received.Format("_2-Jan-2006 15:04:05 -0700") + `"`
 	}
-	return c.Transactf("append %s (%s)%s {%d+}\r\n%s", astring(mailbox), strings.Join(flags, " "), date, len(message), message)
+	// Message data with NUL bytes must be sent as literal8, with BINARY. ../rfc/3516
+	var lit8 string
+	if bytes.IndexByte(message, 0) >= 0 {
+		lit8 = "~"
+	}
+	return c.Transactf("append %s (%s)%s %s{%d+}\r\n%s", astring(mailbox), strings.Join(flags, " "), date, lit8, len(message), message)
 }
 
 // note: No idle command. Idle is better implemented by writing the request and reading and handling the responses as they come in.
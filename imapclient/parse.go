@@ -5,6 +5,7 @@ import (
 	"io"
 	"strconv"
 	"strings"
+	"time"
 )
 
 func (c *Conn) recorded() string {
@@ -187,12 +188,15 @@ func (c *Conn) xrespCode() (string, CodeArg) {
 	case "PERMANENTFLAGS":
 		l := []string{} // Must be non-nil.
 		if c.space() {
+			// List can be empty, e.g. for mailboxes where flags cannot be changed. ../rfc/9051
 			c.xtake("(")
-			l = []string{c.xflagPerm()}
-			for c.space() {
+			if !c.take(')') {
 				l = append(l, c.xflagPerm())
+				for c.space() {
+					l = append(l, c.xflagPerm())
+				}
+				c.xtake(")")
 			}
-			c.xtake(")")
 		}
 		codeArg = CodeList{W, l}
 	case "UIDNEXT", "UIDVALIDITY", "UNSEEN":
@@ -202,8 +206,8 @@ func (c *Conn) xrespCode() (string, CodeArg) {
 		c.xspace()
 		destUIDValidity := c.xnzuint32()
 		c.xspace()
-		uid := c.xnzuint32()
-		codeArg = CodeAppendUID{destUIDValidity, uid}
+		uids := c.xuidrange()
+		codeArg = CodeAppendUID{destUIDValidity, uids}
 	case "COPYUID":
 		c.xspace()
 		destUIDValidity := c.xnzuint32()
@@ -503,6 +507,34 @@ func (c *Conn) xuntagged() Untagged {
 		c.xcrlf()
 		return r
 
+	case "SORT":
+		// ../rfc/5256:651
+		var r UntaggedSort
+		for c.space() {
+			// ../rfc/7162:1101
+			if c.take('(') {
+				c.xtake("MODSEQ")
+				c.xspace()
+				r.ModSeq = c.xint64()
+				c.xtake(")")
+				break
+			}
+			r.Nums = append(r.Nums, c.xnzuint32())
+		}
+		c.xcrlf()
+		return r
+
+	case "THREAD":
+		// ../rfc/5256:658
+		var r UntaggedThread
+		if c.space() {
+			for c.peek('(') {
+				r = append(r, c.xthreadList())
+			}
+		}
+		c.xcrlf()
+		return r
+
 	case "ESEARCH":
 		r := c.xesearchResponse()
 		c.xcrlf()
@@ -752,6 +784,19 @@ func (c *Conn) xmsgatt1() FetchAttr {
 		modseq := c.xint64()
 		c.xtake(")")
 		return FetchModSeq(modseq)
+
+	case "SAVEDATE":
+		// ../rfc/8514
+		c.xspace()
+		var t *time.Time
+		if c.peek('"') {
+			x, err := time.Parse("_2-Jan-2006 15:04:05 -0700", c.xquoted())
+			c.xcheckf(err, "parsing savedate")
+			t = &x
+		} else {
+			c.xtake("nil")
+		}
+		return FetchSaveDate{t}
 	}
 	c.xerrorf("unknown fetch attribute %q", f)
 	panic("not reached")
@@ -1348,6 +1393,34 @@ func (c *Conn) xneedDisabled(msg string, caps ...Capability) {
 	}
 }
 
+// ../rfc/5256:668
+func (c *Conn) xthreadList() (r Thread) {
+	c.xtake("(")
+	if c.peek('(') {
+		// Missing parent with multiple children.
+		for c.peek('(') {
+			r.Children = append(r.Children, c.xthreadList())
+		}
+		c.xtake(")")
+		return
+	}
+	r.Num = c.xnzuint32()
+	t := &r
+	for !c.take(')') {
+		c.xspace()
+		if c.peek('(') {
+			for c.peek('(') {
+				t.Children = append(t.Children, c.xthreadList())
+			}
+			c.xtake(")")
+			return
+		}
+		t.Children = []Thread{{Num: c.xnzuint32()}}
+		t = &t.Children[0]
+	}
+	return
+}
+
 // ../rfc/9051:6546
 // Already consumed: "ESEARCH"
 func (c *Conn) xesearchResponse() (r UntaggedEsearch) {
@@ -1418,6 +1491,59 @@ func (c *Conn) xesearchResponse() (r UntaggedEsearch) {
 			c.xspace()
 			r.ModSeq = c.xint64()
 
+		// ../rfc/5267
+		case "PARTIAL":
+			if r.Partial != nil {
+				c.xerrorf("duplicate PARTIAL in ESEARCH")
+			}
+			c.xspace()
+			c.xtake("(")
+			var p EsearchPartial
+			p.First = c.xnzuint32()
+			c.xtake(":")
+			p.Last = c.xnzuint32()
+			c.xspace()
+			if !c.peek('n') && !c.peek('N') {
+				p.Result = c.xsequenceSet()
+			} else {
+				c.xtake("NIL")
+			}
+			c.xtake(")")
+			r.Partial = &p
+
+		// ../rfc/6203
+		case "RELEVANCY":
+			if r.Relevancy != nil {
+				c.xerrorf("duplicate RELEVANCY in ESEARCH")
+			}
+			c.xspace()
+			c.xtake("(")
+			for {
+				score := c.xnzuint32()
+				if score > 100 {
+					c.xerrorf("relevancy score %d above 100", score)
+				}
+				r.Relevancy = append(r.Relevancy, uint8(score))
+				if !c.space() {
+					break
+				}
+			}
+			c.xtake(")")
+
+		case "ADDTO", "REMOVETO":
+			c.xspace()
+			c.xtake("(")
+			var u EsearchContextUpdate
+			u.Position = c.xuint32()
+			c.xspace()
+			u.Set = c.xsequenceSet()
+			c.xtake(")")
+			if W == "ADDTO" {
+				r.AddTo = append(r.AddTo, u)
+			} else {
+				r.RemoveTo = append(r.RemoveTo, u)
+			}
+
 		default:
 			// Validate ../rfc/9051:7090
 			for i, b := range []byte(w) {
@@ -4,35 +4,45 @@ import (
 	"bufio"
 	"fmt"
 	"strings"
+	"time"
 )
 
 // Capability is a known string for with the ENABLED and CAPABILITY command.
 type Capability string
 
 const (
-	CapIMAP4rev1      Capability = "IMAP4rev1"
-	CapIMAP4rev2      Capability = "IMAP4rev2"
-	CapLoginDisabled  Capability = "LOGINDISABLED"
-	CapStarttls       Capability = "STARTTLS"
-	CapAuthPlain      Capability = "AUTH=PLAIN"
-	CapLiteralPlus    Capability = "LITERAL+"
-	CapLiteralMinus   Capability = "LITERAL-"
-	CapIdle           Capability = "IDLE"
-	CapNamespace      Capability = "NAMESPACE"
-	CapBinary         Capability = "BINARY"
-	CapUnselect       Capability = "UNSELECT"
-	CapUidplus        Capability = "UIDPLUS"
-	CapEsearch        Capability = "ESEARCH"
-	CapEnable         Capability = "ENABLE"
-	CapSave           Capability = "SAVE"
-	CapListExtended   Capability = "LIST-EXTENDED"
-	CapSpecialUse     Capability = "SPECIAL-USE"
-	CapMove           Capability = "MOVE"
-	CapUTF8Only       Capability = "UTF8=ONLY"
-	CapUTF8Accept     Capability = "UTF8=ACCEPT"
-	CapID             Capability = "ID"              // ../rfc/2971:80
-	CapMetadata       Capability = "METADATA"        // ../rfc/5464:124
-	CapMetadataServer Capability = "METADATA-SERVER" // ../rfc/5464:124
+	CapIMAP4rev1            Capability = "IMAP4rev1"
+	CapIMAP4rev2            Capability = "IMAP4rev2"
+	CapLoginDisabled        Capability = "LOGINDISABLED"
+	CapStarttls             Capability = "STARTTLS"
+	CapAuthPlain            Capability = "AUTH=PLAIN"
+	CapLiteralPlus          Capability = "LITERAL+"
+	CapLiteralMinus         Capability = "LITERAL-"
+	CapIdle                 Capability = "IDLE"
+	CapNamespace            Capability = "NAMESPACE"
+	CapBinary               Capability = "BINARY"
+	CapUnselect             Capability = "UNSELECT"
+	CapUidplus              Capability = "UIDPLUS"
+	CapEsearch              Capability = "ESEARCH"
+	CapEnable               Capability = "ENABLE"
+	CapSave                 Capability = "SAVE"
+	CapListExtended         Capability = "LIST-EXTENDED"
+	CapSpecialUse           Capability = "SPECIAL-USE"
+	CapMove                 Capability = "MOVE"
+	CapUTF8Only             Capability = "UTF8=ONLY"
+	CapUTF8Accept           Capability = "UTF8=ACCEPT"
+	CapID                   Capability = "ID"                    // ../rfc/2971:80
+	CapMetadata             Capability = "METADATA"              // ../rfc/5464:124
+	CapMetadataServer       Capability = "METADATA-SERVER"       // ../rfc/5464:124
+	CapContextSearch        Capability = "CONTEXT=SEARCH"        // ../rfc/5267
+	CapSort                 Capability = "SORT"                  // ../rfc/5256
+	CapThreadOrderedSubject Capability = "THREAD=ORDEREDSUBJECT" // ../rfc/5256
+	CapThreadReferences     Capability = "THREAD=REFERENCES"     // ../rfc/5256
+	CapSearchFuzzy          Capability = "SEARCH=FUZZY"          // ../rfc/6203
+	CapMultiAppend          Capability = "MULTIAPPEND"           // ../rfc/3502
+	CapCatenate             Capability = "CATENATE"              // ../rfc/4469
+	CapSaveDate             Capability = "SAVEDATE"              // ../rfc/8514
+	CapUnauthenticate       Capability = "UNAUTHENTICATE"        // ../rfc/8437
 )
 
 // Status is the tagged final result of a command.
@@ -106,11 +116,11 @@ func (c CodeUint) CodeString() string {
 // "APPENDUID" response code.
 type CodeAppendUID struct {
 	UIDValidity uint32
-	UID         uint32
+	UIDs        NumRange // Single UID, or range for MULTIAPPEND with multiple messages.
 }
 
 func (c CodeAppendUID) CodeString() string {
-	return fmt.Sprintf("APPENDUID %d %d", c.UIDValidity, c.UID)
+	return fmt.Sprintf("APPENDUID %d %s", c.UIDValidity, c.UIDs.String())
 }
 
 // "COPYUID" response code.
@@ -224,6 +234,22 @@ type UntaggedSearchModSeq struct {
 	Nums   []uint32
 	ModSeq int64
 }
+
+// ../rfc/5256:651 ../rfc/7162:1101
+type UntaggedSort struct {
+	Nums   []uint32
+	ModSeq int64 // Only set for searches with MODSEQ.
+}
+
+// ../rfc/5256:658
+type UntaggedThread []Thread
+
+// Thread is a message in a THREAD response with its replies. Num is 0 for a
+// missing parent of multiple messages.
+type Thread struct {
+	Num      uint32
+	Children []Thread
+}
 type UntaggedStatus struct {
 	Mailbox string
 	Attrs   map[StatusAttr]int64 // Upper case status attributes.
@@ -286,9 +312,28 @@ type UntaggedEsearch struct {
 	All        NumSet
 	Count      *uint32
 	ModSeq     int64
+	Partial    *EsearchPartial
+	Relevancy  []uint8 // Scores for matching messages, 1-100. ../rfc/6203
+	AddTo      []EsearchContextUpdate
+	RemoveTo   []EsearchContextUpdate
 	Exts       []EsearchDataExt
 }
 
+// EsearchPartial is the window of results returned for the PARTIAL return option.
+type EsearchPartial struct {
+	// ../rfc/5267
+	First, Last uint32
+	Result      NumSet // Zero if NIL.
+}
+
+// EsearchContextUpdate is a change to the result of a search with the UPDATE
+// return option.
+type EsearchContextUpdate struct {
+	// ../rfc/5267
+	Position uint32 // Always 0 for unsorted searches.
+	Set      NumSet
+}
+
 // UntaggedVanished is used in QRESYNC to send UIDs that have been removed.
 type UntaggedVanished struct {
 	Earlier bool
@@ -601,3 +646,10 @@ func (f FetchUID) Attr() string { return "UID" }
 type FetchModSeq int64
 
 func (f FetchModSeq) Attr() string { return "MODSEQ" }
+
+// "SAVEDATE" fetch response. ../rfc/8514
+type FetchSaveDate struct {
+	SaveDate *time.Time // nil means absent for message.
+}
+
+func (f FetchSaveDate) Attr() string { return "SAVEDATE" }
@@ -0,0 +1,515 @@
+// Package imapimport imports messages from a remote IMAP server into an account,
+// e.g. for migrating from another mail server.
+//
+// All mailboxes are imported, with their hierarchy, message flags/keywords and
+// internal dates. Messages are imported in batches. After each batch, the
+// progress is stored in the account database, so an interrupted import can be
+// continued by starting it again.
+package imapimport
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"golang.org/x/exp/maps"
+
+	"github.com/mjl-/bstore"
+
+	"github.com/mjl-/mox/imapclient"
+	"github.com/mjl-/mox/junk"
+	"github.com/mjl-/mox/message"
+	"github.com/mjl-/mox/mlog"
+	"github.com/mjl-/mox/store"
+)
+
+// Number of messages fetched and delivered per transaction.
+const batchSize = 100
+
+// Remote holds the connection and login parameters of the remote IMAP server.
+type Remote struct {
+	Address       string // Host and port, e.g. "imap.example.org:993".
+	STARTTLS      bool   // Connect without TLS and switch to TLS with STARTTLS. Otherwise, TLS is used immediately, unless Insecure is set.
+	Insecure      bool   // Do not use TLS at all. Only for testing or trusted networks.
+	TLSSkipVerify bool   // Do not verify the TLS certificate of the remote server.
+	Username      string
+	Password      string
+}
+
+// Progress is called after each batch of imported messages, with the local
+// mailbox name and the number of messages imported into it during this import.
+type Progress func(mailbox string, imported int)
+
+// Import connects to the remote server, and imports all its mailboxes into the
+// account. Messages already imported during an earlier import from the same
+// remote address and username are skipped. If the UIDVALIDITY of a remote
+// mailbox changed since, the mailbox is imported again.
+//
+// If keepSource is set, the remote mailbox and UID of each imported message are
+// recorded as store.ImportSource. If trainJunk is set, messages without junk or
+// nonjunk flag are marked based on their mailbox, see store.Message.JunkFlagsForImport,
+// and trained. The account must have a junk filter.
+//
+// The total number of messages imported is returned, also on error.
+func Import(ctx context.Context, log mlog.Log, acc *store.Account, remote Remote, keepSource, trainJunk bool, progress Progress) (total int, rerr error) {
+	host, _, err := net.SplitHostPort(remote.Address)
+	if err != nil {
+		return 0, fmt.Errorf("parsing remote address: %v", err)
+	}
+	tlsConfig := &tls.Config{
+		ServerName:         host,
+		InsecureSkipVerify: remote.TLSSkipVerify,
+	}
+
+	dialer := &net.Dialer{Timeout: 30 * time.Second}
+	var conn net.Conn
+	if remote.STARTTLS || remote.Insecure {
+		conn, err = dialer.DialContext(ctx, "tcp", remote.Address)
+	} else {
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: tlsConfig}).DialContext(ctx, "tcp", remote.Address)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("dial remote: %v", err)
+	}
+
+	c, err := imapclient.New(conn, false)
+	if err != nil {
+		conn.Close()
+		return 0, fmt.Errorf("imap greeting: %v", err)
+	}
+	defer func() {
+		_, _, err := c.Logout()
+		log.Check(err, "imap logout")
+		err = c.Close()
+		log.Check(err, "closing imap connection")
+	}()
+
+	if remote.STARTTLS {
+		if _, _, err := c.Starttls(tlsConfig); err != nil {
+			return 0, fmt.Errorf("starttls: %v", err)
+		}
+	}
+	if !c.Preauth {
+		if _, _, err := c.Login(remote.Username, remote.Password); err != nil {
+			return 0, fmt.Errorf("login: %v", err)
+		}
+	}
+
+	return importConn(ctx, log, acc, c, remote.Address, remote.Username, keepSource, trainJunk, progress)
+}
+
+// importConn imports all mailboxes through an authenticated IMAP connection.
+// Address and username identify the import state in the account database.
+func importConn(ctx context.Context, log mlog.Log, acc *store.Account, c *imapclient.Conn, address, username string, keepSource, trainJunk bool, progress Progress) (total int, rerr error) {
+	if err := acc.ThreadingWait(log); err != nil {
+		return 0, fmt.Errorf("waiting for account thread upgrade: %v", err)
+	}
+
+	if _, _, err := c.Capability(); err != nil {
+		return 0, fmt.Errorf("capability: %v", err)
+	}
+	// With UTF8=ACCEPT, mailbox names are UTF-8 instead of modified UTF-7.
+	_, utf8 := c.CapAvailable[imapclient.CapUTF8Accept]
+	if utf8 {
+		if _, _, err := c.Enable(string(imapclient.CapUTF8Accept)); err != nil {
+			return 0, fmt.Errorf("enable utf8=accept: %v", err)
+		}
+	}
+
+	untagged, _, err := c.List("*")
+	if err != nil {
+		return 0, fmt.Errorf("listing mailboxes: %v", err)
+	}
+
+	jf, _, err := acc.OpenJunkFilter(ctx, log)
+	if err != nil && !errors.Is(err, store.ErrNoJunkFilter) {
+		return 0, fmt.Errorf("open junk filter: %v", err)
+	}
+	defer func() {
+		if jf != nil {
+			err := jf.Close()
+			log.Check(err, "closing junk filter after import")
+		}
+	}()
+	if trainJunk && jf == nil {
+		return 0, fmt.Errorf("account has no junk filter configured for training")
+	}
+
+	for _, ut := range untagged {
+		l, ok := ut.(imapclient.UntaggedList)
+		if !ok {
+			continue
+		}
+		if slices.ContainsFunc(l.Flags, func(f string) bool {
+			return strings.EqualFold(f, `\Noselect`) || strings.EqualFold(f, `\NonExistent`)
+		}) {
+			continue
+		}
+
+		name, err := localMailboxName(l.Mailbox, l.Separator, utf8)
+		if err != nil {
+			log.Infox("skipping remote mailbox with invalid name", err, slog.String("mailbox", l.Mailbox))
+			continue
+		}
+		n, err := importMailbox(ctx, log, acc, jf, c, address, username, l.Mailbox, name, keepSource, trainJunk, progress)
+		total += n
+		if err != nil {
+			return total, fmt.Errorf("importing mailbox %q: %v", name, err)
+		}
+	}
+	return total, nil
+}
+
+// sourceURL returns an IMAP URL for the remote mailbox of state, with its
+// UIDVALIDITY as in RFC 5092, for recording the source of imported messages.
+func sourceURL(state *store.IMAPImport) string {
+	return fmt.Sprintf("imap://%s@%s/%s;UIDVALIDITY=%d", url.PathEscape(state.Username), state.Address, url.PathEscape(state.Mailbox), state.UIDValidity)
+}
+
+// localMailboxName returns the name for a local mailbox for a remote mailbox name
+// with hierarchy separator sep.
+func localMailboxName(name string, sep byte, utf8 bool) (string, error) {
+	if !utf8 {
+		var err error
+		name, err = utf7decode(name)
+		if err != nil {
+			return "", err
+		}
+	}
+	if sep != 0 && sep != '/' {
+		name = strings.ReplaceAll(name, string(sep), "/")
+	}
+	if strings.EqualFold(name, "inbox") {
+		name = "Inbox"
+	}
+	name, _, err := store.CheckMailboxName(name, true)
+	return name, err
+}
+
+// importMailbox imports the messages of a remote mailbox not yet imported, in
+// batches.
+func importMailbox(ctx context.Context, log mlog.Log, acc *store.Account, jf *junk.Filter, c *imapclient.Conn, address, username, remoteName, name string, keepSource, trainJunk bool, progress Progress) (imported int, rerr error) {
+	untagged, _, err := c.Examine(remoteName)
+	if err != nil {
+		return 0, fmt.Errorf("examine: %v", err)
+	}
+	var uidValidity uint32
+	for _, ut := range untagged {
+		if r, ok := ut.(imapclient.UntaggedResult); ok {
+			if code, ok := r.CodeArg.(imapclient.CodeUint); ok && code.Code == "UIDVALIDITY" {
+				uidValidity = code.Num
+			}
+		}
+	}
+	if uidValidity == 0 {
+		return 0, fmt.Errorf("missing uidvalidity")
+	}
+
+	// Get or create import state, and ensure the local mailbox exists, also when
+	// the remote mailbox is empty.
+	var state store.IMAPImport
+	acc.WithWLock(func() {
+		err = acc.DB.Write(ctx, func(tx *bstore.Tx) error {
+			q := bstore.QueryTx[store.IMAPImport](tx)
+			q.FilterNonzero(store.IMAPImport{Address: address, Username: username, Mailbox: remoteName})
+			state, err = q.Get()
+			if err == bstore.ErrAbsent {
+				state = store.IMAPImport{Address: address, Username: username, Mailbox: remoteName, UIDValidity: uidValidity, Updated: time.Now()}
+				err = tx.Insert(&state)
+			} else if err == nil && state.UIDValidity != uidValidity {
+				log.Info("uidvalidity of remote mailbox changed, importing again", slog.String("mailbox", remoteName))
+				state.UIDValidity = uidValidity
+				state.LastUID = 0
+				state.Updated = time.Now()
+				err = tx.Update(&state)
+			}
+			if err != nil {
+				return fmt.Errorf("import state: %v", err)
+			}
+
+			_, changes, err := acc.MailboxEnsure(tx, name, true)
+			if err != nil {
+				return fmt.Errorf("ensuring mailbox: %v", err)
+			}
+			store.BroadcastChanges(acc, changes)
+			return nil
+		})
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	untagged, _, err = c.Transactf("uid search uid %d:*", state.LastUID+1)
+	if err != nil {
+		return 0, fmt.Errorf("searching new messages: %v", err)
+	}
+	var uids []uint32
+	for _, ut := range untagged {
+		if l, ok := ut.(imapclient.UntaggedSearch); ok {
+			for _, uid := range l {
+				// With "n:*", servers return the last message, even if its uid is lower.
+				if uid > state.LastUID {
+					uids = append(uids, uid)
+				}
+			}
+		}
+	}
+	slices.Sort(uids)
+
+	for len(uids) > 0 {
+		if err := ctx.Err(); err != nil {
+			return imported, err
+		}
+		batch := uids[:min(batchSize, len(uids))]
+		uids = uids[len(batch):]
+		n, err := importBatch(ctx, log, acc, jf, c, &state, name, batch, keepSource, trainJunk)
+		imported += n
+		if err != nil {
+			return imported, err
+		}
+		if progress != nil {
+			progress(name, imported)
+		}
+	}
+	return imported, nil
+}
+
+// importBatch fetches the messages with uids from the selected mailbox and
+// delivers them into the local mailbox in a single transaction, along with an
+// update of the import state. If keepSource is set, the source of each message is
+// recorded.
+func importBatch(ctx context.Context, log mlog.Log, acc *store.Account, jf *junk.Filter, c *imapclient.Conn, state *store.IMAPImport, name string, uids []uint32, keepSource, trainJunk bool) (imported int, rerr error) {
+	uidStrs := make([]string, len(uids))
+	for i, uid := range uids {
+		uidStrs[i] = fmt.Sprintf("%d", uid)
+	}
+	untagged, _, err := c.Transactf("uid fetch %s (uid flags internaldate body.peek[])", strings.Join(uidStrs, ","))
+	if err != nil {
+		return 0, fmt.Errorf("fetching messages: %v", err)
+	}
+
+	// Write the messages to temporary files before starting the transaction.
+	type fetched struct {
+		m   *store.Message
+		f   *os.File
+		uid uint32
+	}
+	var msgs []fetched
+	defer func() {
+		for _, fm := range msgs {
+			if fm.f != nil {
+				store.CloseRemoveTempFile(log, fm.f, "imported message")
+			}
+		}
+	}()
+	var lastUID uint32
+	for _, ut := range untagged {
+		fetch, ok := ut.(imapclient.UntaggedFetch)
+		if !ok {
+			continue
+		}
+		var uid uint32
+		var flagList []string
+		var received time.Time
+		var body *string
+		for _, a := range fetch.Attrs {
+			switch x := a.(type) {
+			case imapclient.FetchUID:
+				uid = uint32(x)
+			case imapclient.FetchFlags:
+				flagList = x
+			case imapclient.FetchInternalDate:
+				// ../rfc/9051:6800
+				received, err = time.Parse("_2-Jan-2006 15:04:05 -0700", string(x))
+				if err != nil {
+					log.Infox("parsing internal date of remote message, continuing", err, slog.String("internaldate", string(x)))
+				}
+			case imapclient.FetchBody:
+				if x.Section == "" {
+					body = &x.Body
+				}
+			}
+		}
+		if uid == 0 || body == nil {
+			continue
+		}
+		lastUID = max(lastUID, uid)
+
+		// Recent is not a flag that can be set, and other unknown system flags are
+		// skipped as well.
+		flagList = slices.DeleteFunc(flagList, func(f string) bool {
+			return strings.HasPrefix(f, `\`) && !slices.Contains([]string{`\seen`, `\answered`, `\flagged`, `\deleted`, `\draft`}, strings.ToLower(f))
+		})
+		flags, keywords, err := store.ParseFlagsKeywords(flagList)
+		if err != nil {
+			log.Infox("parsing flags of remote message, continuing without flags", err, slog.Any("flags", flagList))
+			flags, keywords = store.Flags{}, nil
+		}
+
+		f, err := store.CreateMessageTemp(log, "imapimport")
+		if err != nil {
+			return 0, fmt.Errorf("creating temp file: %v", err)
+		}
+		msgs = append(msgs, fetched{&store.Message{Received: received, Flags: flags, Keywords: keywords, Size: int64(len(*body))}, f, uid})
+		if _, err := f.Write([]byte(*body)); err != nil {
+			return 0, fmt.Errorf("writing temp file: %v", err)
+		}
+	}
+
+	var deliveredIDs []int64
+	defer func() {
+		// If we didn't commit, remove the delivered message files.
+		for _, id := range deliveredIDs {
+			p := acc.MessagePath(id)
+			err := os.Remove(p)
+			log.Check(err, "removing message file after import error", slog.String("path", p))
+		}
+	}()
+
+	acc.WithWLock(func() {
+		var changes []store.Change
+		err = acc.DB.Write(ctx, func(tx *bstore.Tx) error {
+			mb, nchanges, err := acc.MailboxEnsure(tx, name, true)
+			if err != nil {
+				return fmt.Errorf("ensuring mailbox: %v", err)
+			}
+			changes = append(changes, nchanges...)
+
+			conf, _ := acc.Conf()
+			du := store.DiskUsage{ID: 1}
+			if err := tx.Get(&du); err != nil {
+				return fmt.Errorf("get disk usage: %v", err)
+			}
+			maxSize := acc.QuotaMessageSize()
+			var addSize int64
+
+			modseq, err := acc.NextModSeq(tx)
+			if err != nil {
+				return fmt.Errorf("assigning next modseq: %v", err)
+			}
+
+			keywords := map[string]bool{}
+			for i, fm := range msgs {
+				m := fm.m
+				addSize += m.Size
+				if maxSize > 0 && du.MessageSize+addSize > maxSize {
+					return fmt.Errorf("account over maximum total message size %d", maxSize)
+				}
+
+				// Parse message and store parsed information for later fast retrieval.
+				p, err := message.EnsurePart(log.Logger, false, fm.f, m.Size)
+				if err != nil {
+					log.Infox("parsing message, continuing", err, slog.String("mailbox", name))
+				}
+				m.ParsedBuf, err = json.Marshal(p)
+				if err != nil {
+					return fmt.Errorf("marshal parsed message structure: %v", err)
+				}
+				p.SetReaderAt(store.FileMsgReader(m.MsgPrefix, fm.f))
+				m.PrepareThreading(log, &p)
+
+				if m.Received.IsZero() {
+					if p.Envelope != nil && !p.Envelope.Date.IsZero() {
+						m.Received = p.Envelope.Date
+					} else {
+						m.Received = time.Now()
+					}
+				}
+
+				// We set the junk flags and train ourselves, like other imports, to prevent
+				// opening and saving the junk filter for each message.
+				m.JunkFlagsForMailbox(mb, conf)
+				if trainJunk {
+					m.JunkFlagsForImport(mb)
+				}
+				if jf != nil && m.NeedsTraining() {
+					if words, err := jf.ParseMessage(p); err != nil {
+						log.Infox("parsing message for updating junk filter, continuing", err)
+					} else if err := jf.Train(ctx, !m.Junk, words); err != nil {
+						return fmt.Errorf("training junk filter: %v", err)
+					} else {
+						m.TrainedJunk = &m.Junk
+					}
+				}
+
+				m.MailboxID = mb.ID
+				m.MailboxOrigID = mb.ID
+				m.CreateSeq = modseq
+				m.ModSeq = modseq
+				mb.Add(m.MailboxCounts())
+				for _, kw := range m.Keywords {
+					keywords[kw] = true
+				}
+
+				const sync = false
+				const notrain = true
+				const nothreads = true
+				const updateDiskUsage = false
+				if err := acc.DeliverMessage(log, tx, m, fm.f, sync, notrain, nothreads, updateDiskUsage); err != nil {
+					return fmt.Errorf("delivering message: %v", err)
+				}
+				deliveredIDs = append(deliveredIDs, m.ID)
+				changes = append(changes, m.ChangeAddUID())
+				if keepSource {
+					src := store.ImportSource{MessageID: m.ID, Kind: "imap", Source: sourceURL(state), Position: fmt.Sprintf("%d", fm.uid)}
+					if err := tx.Insert(&src); err != nil {
+						return fmt.Errorf("recording source of message: %v", err)
+					}
+				}
+				store.CloseRemoveTempFile(log, fm.f, "imported message")
+				msgs[i].f = nil
+			}
+
+			if len(deliveredIDs) > 0 {
+				if err := acc.AssignThreads(ctx, log, tx, deliveredIDs[0], 0, io.Discard); err != nil {
+					return fmt.Errorf("assigning messages to threads: %v", err)
+				}
+			}
+
+			// Get mailbox again, uidnext is updated by delivery.
+			mc := mb.MailboxCounts
+			if err := tx.Get(&mb); err != nil {
+				return fmt.Errorf("get mailbox: %v", err)
+			}
+			mb.MailboxCounts = mc
+			var kwChanged bool
+			mb.Keywords, kwChanged = store.MergeKeywords(mb.Keywords, maps.Keys(keywords))
+			if kwChanged {
+				changes = append(changes, mb.ChangeKeywords())
+			}
+			if err := tx.Update(&mb); err != nil {
+				return fmt.Errorf("updating mailbox counts and keywords: %v", err)
+			}
+			changes = append(changes, mb.ChangeCounts())
+
+			if err := acc.AddMessageSize(log, tx, addSize); err != nil {
+				return fmt.Errorf("updating disk usage: %v", err)
+			}
+
+			// Messages no longer in the remote mailbox are skipped next time too.
+			state.LastUID = max(state.LastUID, lastUID, uids[len(uids)-1])
+			state.Imported += len(deliveredIDs)
+			state.Updated = time.Now()
+			if err := tx.Update(state); err != nil {
+				return fmt.Errorf("updating import state: %v", err)
+			}
+			return nil
+		})
+		if err == nil {
+			imported = len(deliveredIDs)
+			deliveredIDs = nil
+			store.BroadcastChanges(acc, changes)
+		}
+	})
+	return imported, err
+}
@@ -0,0 +1,166 @@
+package imapimport
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mjl-/bstore"
+
+	"github.com/mjl-/mox/imapclient"
+	"github.com/mjl-/mox/imapserver"
+	"github.com/mjl-/mox/mlog"
+	"github.com/mjl-/mox/mox-"
+	"github.com/mjl-/mox/store"
+)
+
+var ctxbg = context.Background()
+var pkglog = mlog.New("imapimport", nil)
+
+func tcheck(t *testing.T, err error, msg string) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("%s: %s", msg, err)
+	}
+}
+
+var testMessage = strings.ReplaceAll(`From: <mjl@mox.example>
+To: <other@mox.example>
+Subject: test
+Message-Id: <test@mox.example>
+
+test email
+`, "\n", "\r\n")
+
+func TestImport(t *testing.T) {
+	mox.Context = ctxbg
+	mox.ConfigStaticPath = filepath.FromSlash("../testdata/imapimport/mox.conf")
+	mox.MustLoadConfig(true, false)
+	os.RemoveAll("../testdata/imapimport/data")
+	err := store.Init(ctxbg)
+	tcheck(t, err, "store init")
+	defer store.Close()
+	defer store.Switchboard()()
+
+	acc, err := store.OpenAccount(pkglog, "other", false)
+	tcheck(t, err, "open account")
+	defer func() {
+		err := acc.Close()
+		pkglog.Check(err, "closing account")
+		acc.CheckClosed()
+	}()
+
+	// Connect to our own imap server as the remote server, preauthenticated as mjl.
+	serverConn, clientConn := net.Pipe()
+	go imapserver.ServeConnPreauth("test", 1, serverConn, "mjl@mox.example")
+	c, err := imapclient.New(clientConn, false)
+	tcheck(t, err, "new client")
+	defer c.Close()
+	if !c.Preauth {
+		t.Fatalf("connection not preauthenticated")
+	}
+
+	received := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	_, _, err = c.Append("Inbox", []string{`\Seen`, "custom"}, &received, []byte(testMessage))
+	tcheck(t, err, "append")
+	_, _, err = c.Create("Archive/2020")
+	tcheck(t, err, "create")
+	_, _, err = c.Append("Archive/2020", []string{`\Flagged`, "$Junk"}, nil, []byte(testMessage))
+	tcheck(t, err, "append")
+	_, _, err = c.Create("Empty")
+	tcheck(t, err, "create")
+
+	checkMessages := func(mailbox string, exp int) []store.Message {
+		t.Helper()
+		q := bstore.QueryDB[store.Mailbox](ctxbg, acc.DB)
+		q.FilterNonzero(store.Mailbox{Name: mailbox})
+		mb, err := q.Get()
+		tcheck(t, err, "get mailbox")
+		qm := bstore.QueryDB[store.Message](ctxbg, acc.DB)
+		qm.FilterNonzero(store.Message{MailboxID: mb.ID})
+		qm.FilterEqual("Expunged", false)
+		l, err := qm.List()
+		tcheck(t, err, "list messages")
+		if len(l) != exp {
+			t.Fatalf("got %d messages in mailbox %q, expected %d", len(l), mailbox, exp)
+		}
+		if mb.Total != int64(exp) {
+			t.Fatalf("got mailbox total %d, expected %d", mb.Total, exp)
+		}
+		return l
+	}
+
+	var progressed []string
+	progress := func(mailbox string, imported int) {
+		progressed = append(progressed, mailbox)
+	}
+
+	total, err := importConn(ctxbg, pkglog, acc, c, "mox.example:143", "mjl", true, false, progress)
+	tcheck(t, err, "import")
+	if total != 2 {
+		t.Fatalf("imported %d messages, expected 2", total)
+	}
+	slices.Sort(progressed)
+	if !slices.Equal(progressed, []string{"Archive/2020", "Inbox"}) {
+		t.Fatalf("got progress for mailboxes %v", progressed)
+	}
+
+	l := checkMessages("Inbox", 1)
+	if !l[0].Seen || !slices.Equal(l[0].Keywords, []string{"custom"}) || !l[0].Received.Equal(received) {
+		t.Fatalf("inbox message has flags %v, keywords %v, received %v, expected seen, custom and %v", l[0].Flags, l[0].Keywords, l[0].Received, received)
+	}
+	l = checkMessages("Archive/2020", 1)
+	if !l[0].Flagged || !l[0].Junk {
+		t.Fatalf("archive message has flags %v, expected flagged and junk", l[0].Flags)
+	}
+	checkMessages("Archive", 0)
+	checkMessages("Empty", 0)
+
+	// Sources were recorded.
+	sources, err := acc.ImportSourceList(ctxbg, "")
+	tcheck(t, err, "list import sources")
+	if len(sources) != 2 || sources[1].Mailbox != "Inbox" || sources[1].Kind != "imap" || !strings.HasPrefix(sources[1].Source, "imap://mjl@mox.example:143/") || sources[1].Position == "" {
+		t.Fatalf("got import sources %#v, expected 2 for imap", sources)
+	}
+
+	// Importing again only imports new messages.
+	_, _, err = c.Append("Inbox", nil, nil, []byte(testMessage))
+	tcheck(t, err, "append")
+	total, err = importConn(ctxbg, pkglog, acc, c, "mox.example:143", "mjl", false, false, nil)
+	tcheck(t, err, "import again")
+	if total != 1 {
+		t.Fatalf("imported %d messages on second import, expected 1", total)
+	}
+	checkMessages("Inbox", 2)
+
+	// A different remote account has its own state.
+	total, err = importConn(ctxbg, pkglog, acc, c, "mox.example:143", "mjl2", false, false, nil)
+	tcheck(t, err, "import for other remote account")
+	if total != 3 {
+		t.Fatalf("imported %d messages for other remote account, expected 3", total)
+	}
+	checkMessages("Inbox", 4)
+
+	_, _, err = c.Logout()
+	tcheck(t, err, "logout")
+}
+
+func TestUTF7Decode(t *testing.T) {
+	check := func(s, exp string, expErr bool) {
+		t.Helper()
+		r, err := utf7decode(s)
+		if (err != nil) != expErr || r != exp {
+			t.Fatalf("utf7decode(%q): got %q, %v, expected %q, error %v", s, r, err, exp, expErr)
+		}
+	}
+	check("plain", "plain", false)
+	check("a&-b", "a&b", false)
+	check("&AOk-t&AOk-", "été", false)
+	check("&2D3eAQ-", "\U0001f601", false)
+	check("&AOk", "", true)
+}
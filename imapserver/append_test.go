@@ -1,9 +1,12 @@
 package imapserver
 
 import (
+	"strings"
 	"testing"
 
+	"github.com/mjl-/mox/config"
 	"github.com/mjl-/mox/imapclient"
+	"github.com/mjl-/mox/mox-"
 )
 
 func TestAppend(t *testing.T) {
@@ -46,7 +49,7 @@ func TestAppend(t *testing.T) {
 
 	tc2.transactf("ok", "append inbox (\\Seen Label1 $label2) \" 1-Jan-2022 10:10:00 +0100\" {1+}\r\nx")
 	tc2.xuntagged(imapclient.UntaggedExists(1))
-	tc2.xcodeArg(imapclient.CodeAppendUID{UIDValidity: 1, UID: 1})
+	tc2.xcodeArg(imapclient.CodeAppendUID{UIDValidity: 1, UIDs: imapclient.NumRange{First: 1}})
 
 	tc.transactf("ok", "noop")
 	uid1 := imapclient.FetchUID(1)
@@ -57,11 +60,11 @@ func TestAppend(t *testing.T) {
 
 	tc2.transactf("ok", "append inbox (\\Seen) \" 1-Jan-2022 10:10:00 +0100\" UTF8 ({47+}\r\ncontent-type: just completely invalid;;\r\n\r\ntest)")
 	tc2.xuntagged(imapclient.UntaggedExists(2))
-	tc2.xcodeArg(imapclient.CodeAppendUID{UIDValidity: 1, UID: 2})
+	tc2.xcodeArg(imapclient.CodeAppendUID{UIDValidity: 1, UIDs: imapclient.NumRange{First: 2}})
 
 	tc2.transactf("ok", "append inbox (\\Seen) \" 1-Jan-2022 10:10:00 +0100\" UTF8 ({31+}\r\ncontent-type: text/plain;\n\ntest)")
 	tc2.xuntagged(imapclient.UntaggedExists(3))
-	tc2.xcodeArg(imapclient.CodeAppendUID{UIDValidity: 1, UID: 3})
+	tc2.xcodeArg(imapclient.CodeAppendUID{UIDValidity: 1, UIDs: imapclient.NumRange{First: 3}})
 
 	// Messages that we cannot parse are marked as application/octet-stream. Perhaps
 	// the imap client knows how to deal with them.
@@ -90,3 +93,227 @@ func TestAppend(t *testing.T) {
 	tclimit.transactf("no", "append inbox (\\Seen Label1 $label2) \" 1-Jan-2022 10:10:00 +0100\" {1+}\r\nx")
 	tclimit.xcode("OVERQUOTA")
 }
+
+func TestMultiAppend(t *testing.T) {
+	defer mockUIDValidity()()
+
+	tc := start(t)
+	defer tc.close()
+
+	tc2 := startNoSwitchboard(t) // note: connection will break.
+	defer tc2.close()
+
+	tc.client.Login("mjl@mox.example", password0)
+	tc.client.Select("inbox")
+	tc2.client.Login("mjl@mox.example", password0)
+
+	tc2.transactf("bad", "append inbox {1+}\r\nx (\\Seen)") // Missing literal for second message.
+
+	tc.transactf("ok", "append inbox {1+}\r\nx (\\Seen) \" 1-Jan-2022 10:10:00 +0100\" {1+}\r\ny {1+}\r\nz")
+	tc.xuntagged(imapclient.UntaggedExists(3))
+	last := uint32(3)
+	tc.xcodeArg(imapclient.CodeAppendUID{UIDValidity: 1, UIDs: imapclient.NumRange{First: 1, Last: &last}})
+
+	tc.transactf("ok", "uid fetch 1:3 flags")
+	tc.xuntagged(
+		imapclient.UntaggedFetch{Seq: 1, Attrs: []imapclient.FetchAttr{imapclient.FetchUID(1), imapclient.FetchFlags(nil)}},
+		imapclient.UntaggedFetch{Seq: 2, Attrs: []imapclient.FetchAttr{imapclient.FetchUID(2), imapclient.FetchFlags{`\Seen`}}},
+		imapclient.UntaggedFetch{Seq: 3, Attrs: []imapclient.FetchAttr{imapclient.FetchUID(3), imapclient.FetchFlags(nil)}},
+	)
+
+	// Either all or none of the messages are added.
+	tclimit := startArgs(t, false, false, true, true, "limit")
+	defer tclimit.close()
+	tclimit.client.Login("limit@mox.example", password0)
+	tclimit.client.Select("inbox")
+	tclimit.transactf("no", "append inbox {1+}\r\nx {1+}\r\ny")
+	tclimit.xcode("OVERQUOTA")
+	tclimit.transactf("ok", "status inbox (messages)")
+	tclimit.xuntagged(imapclient.UntaggedStatus{Mailbox: "Inbox", Attrs: map[imapclient.StatusAttr]int64{"MESSAGES": 0}})
+}
+
+func TestCatenate(t *testing.T) {
+	defer mockUIDValidity()()
+
+	tc := start(t)
+	defer tc.close()
+
+	tc.client.Login("mjl@mox.example", password0)
+	tc.client.Select("inbox")
+
+	msg := "Subject: test\r\n\r\nbody\r\n"
+	tc.transactf("ok", "append inbox {%d+}\r\n%s", len(msg), msg)
+
+	xfetchBody := func(uid uint32, exp string) {
+		t.Helper()
+		tc.transactf("ok", "uid fetch %d body.peek[]", uid)
+		tc.xuntagged(imapclient.UntaggedFetch{Seq: uid, Attrs: []imapclient.FetchAttr{imapclient.FetchUID(uid), imapclient.FetchBody{RespAttr: "BODY[]", Body: exp}}})
+	}
+
+	tc.transactf("ok", "append inbox catenate (text {16+}\r\nSubject: new\r\n\r\n url \"/INBOX;UIDVALIDITY=1/;UID=1/;SECTION=TEXT\" url \"imap://mjl%%40mox.example@localhost/Inbox/;UID=1/;PARTIAL=9.4\")")
+	tc.xcodeArg(imapclient.CodeAppendUID{UIDValidity: 1, UIDs: imapclient.NumRange{First: 2}})
+	xfetchBody(2, "Subject: new\r\n\r\nbody\r\ntest")
+
+	// Multiple messages with catenate and regular literal.
+	tc.transactf("ok", "append inbox catenate (url \"/Inbox/;UID=2/;SECTION=HEADER\" text {1+}\r\nx) {1+}\r\ny")
+	last := uint32(4)
+	tc.xcodeArg(imapclient.CodeAppendUID{UIDValidity: 1, UIDs: imapclient.NumRange{First: 3, Last: &last}})
+	xfetchBody(3, "Subject: new\r\n\r\nx")
+
+	xbadurl := func(url string) {
+		t.Helper()
+		tc.xcodeArg(imapclient.CodeOther{Code: "BADURL", Args: []string{url}})
+	}
+
+	tc.transactf("no", "append inbox catenate (url \"/Inbox/;UID=10\" text {1+}\r\nx)") // Unknown message.
+	xbadurl("/Inbox/;UID=10")
+	tc.transactf("no", `append inbox catenate (url "/Inbox;UIDVALIDITY=2/;UID=1")`) // Wrong uidvalidity.
+	xbadurl("/Inbox;UIDVALIDITY=2/;UID=1")
+	tc.transactf("no", `append inbox catenate (url "/Bogus/;UID=1")`) // Unknown mailbox.
+	xbadurl("/Bogus/;UID=1")
+	tc.transactf("no", `append inbox catenate (url "imap://other@localhost/Inbox/;UID=1")`) // Other user.
+	xbadurl("imap://other@localhost/Inbox/;UID=1")
+	tc.transactf("no", `append inbox catenate (url "/Inbox/;UID=1/;SECTION=BOGUS")`) // Bad section.
+	xbadurl("/Inbox/;UID=1/;SECTION=BOGUS")
+	tc.transactf("no", `append inbox catenate (url "/Inbox/;UID=bad" text {1}`) // Sync literal after bad url.
+	xbadurl("/Inbox/;UID=bad")
+
+	tc.transactf("bad", "append inbox catenate ()")
+	tc.transactf("ok", "noop")
+	tc.xuntagged()
+}
+
+func TestAppendBinary(t *testing.T) {
+	defer mockUIDValidity()()
+
+	tc := start(t)
+	defer tc.close()
+
+	tc.client.Login("mjl@mox.example", password0)
+	tc.client.Select("inbox")
+
+	// Message with a binary part containing a NUL byte, and a base64 part.
+	msg := strings.ReplaceAll(`MIME-Version: 1.0
+Content-Type: multipart/mixed; boundary=x
+
+--x
+Content-Type: application/octet-stream
+Content-Transfer-Encoding: binary
+
+a`+"\x00"+`b
+--x
+Content-Type: text/plain
+Content-Transfer-Encoding: base64
+
+aGVsbG8=
+--x--
+`, "\n", "\r\n")
+	tc.transactf("ok", "append inbox ~{%d+}\r\n%s", len(msg), msg)
+	tc.xcodeArg(imapclient.CodeAppendUID{UIDValidity: 1, UIDs: imapclient.NumRange{First: 1}})
+
+	// Decoded data with a NUL byte is returned as literal8.
+	tc.transactf("ok", "fetch 1 binary.peek[1]")
+	tc.xuntagged(imapclient.UntaggedFetch{Seq: 1, Attrs: []imapclient.FetchAttr{imapclient.FetchUID(1), imapclient.FetchBinary{RespAttr: "BINARY[1]", Parts: []uint32{1}, Data: "a\x00b"}}})
+	tc.transactf("ok", "fetch 1 binary.peek[2]")
+	tc.xuntagged(imapclient.UntaggedFetch{Seq: 1, Attrs: []imapclient.FetchAttr{imapclient.FetchUID(1), imapclient.FetchBinary{RespAttr: "BINARY[2]", Parts: []uint32{2}, Data: "hello"}}})
+	tc.transactf("ok", "fetch 1 binary.size[2]")
+	tc.xuntagged(imapclient.UntaggedFetch{Seq: 1, Attrs: []imapclient.FetchAttr{imapclient.FetchUID(1), imapclient.FetchBinarySize{RespAttr: "BINARY.SIZE[2]", Parts: []uint32{2}, Size: 5}}})
+
+	// Literal8 in catenate.
+	tc.transactf("ok", "append inbox catenate (text ~{5+}\r\nx\x00y\r\n)")
+	tc.xcodeArg(imapclient.CodeAppendUID{UIDValidity: 1, UIDs: imapclient.NumRange{First: 2}})
+
+	// Client uses literal8 for messages with NUL bytes.
+	_, result, err := tc.client.Append("inbox", nil, nil, []byte(msg))
+	tcheck(t, err, "append")
+	if exp := (imapclient.CodeAppendUID{UIDValidity: 1, UIDs: imapclient.NumRange{First: 3}}); result.CodeArg != exp {
+		t.Fatalf("got code argument %v, expected %v", result.CodeArg, exp)
+	}
+}
+
+func TestAppendLimitAccount(t *testing.T) {
+	tc := start(t)
+	defer tc.close()
+
+	accConf, _ := mox.Conf.Account("mjl")
+	defer func() {
+		mox.Conf.Dynamic.Accounts["mjl"] = accConf
+	}()
+	nconf := accConf
+	nconf.MaxAppendSize = 10
+	mox.Conf.Dynamic.Accounts["mjl"] = nconf
+
+	// Before authentication, the limit of the listener applies.
+	tc.transactf("ok", "capability")
+	if _, ok := tc.client.CapAvailable["APPENDLIMIT=9223372036854775807"]; !ok {
+		t.Fatalf("missing capability for listener append limit")
+	}
+
+	tc.client.Login("mjl@mox.example", password0)
+	tc.transactf("ok", "capability")
+	if _, ok := tc.client.CapAvailable["APPENDLIMIT=10"]; !ok {
+		t.Fatalf("missing capability for account append limit")
+	}
+	tc.transactf("ok", "status inbox (appendlimit)")
+	tc.xuntagged(imapclient.UntaggedStatus{Mailbox: "Inbox", Attrs: map[imapclient.StatusAttr]int64{imapclient.StatusAppendLimit: 10}})
+
+	// Rejected before the literal is sent.
+	tc.transactf("no", "append inbox {11}")
+	tc.xcode("TOOBIG")
+	tc.transactf("ok", "append inbox {10+}\r\n0123456789")
+	tc.transactf("no", "append inbox catenate (text {5+}\r\n01234 text {6+}\r\n012345)")
+	tc.xcode("TOOBIG")
+}
+
+// Test configurable limits for command lines and literals.
+func TestLimits(t *testing.T) {
+	defer mockUIDValidity()()
+
+	setLimits := func() error {
+		mox.Conf.Static.Listeners["test"] = config.Listener{
+			IMAPLimits: config.IMAPLimits{
+				MaxLineLength:  1024,
+				MaxLiteralSize: 10,
+				MaxAppendSize:  100,
+				LiteralMinus:   true,
+			},
+		}
+		return nil
+	}
+	tc := startArgsMore(t, true, false, nil, nil, true, false, true, "mjl", setLimits)
+	defer tc.close()
+
+	tc.client.Login("mjl@mox.example", password0)
+	tc.transactf("ok", "capability")
+	if _, ok := tc.client.CapAvailable["LITERAL-"]; !ok {
+		t.Fatalf("missing capability LITERAL-")
+	}
+	if _, ok := tc.client.CapAvailable["APPENDLIMIT=100"]; !ok {
+		t.Fatalf("missing capability APPENDLIMIT=100")
+	}
+	tc.client.Select("inbox")
+
+	// Rejected before the client sends the message.
+	tc.transactf("no", "append inbox {101}")
+	tc.xcode("TOOBIG")
+
+	tc.transactf("ok", "append inbox {100+}\r\n%s", strings.Repeat("x", 100))
+	tc.xuntagged(imapclient.UntaggedExists(1))
+
+	// Literals in other commands.
+	tc.transactf("no", "search text {11}")
+	tc.xcode("TOOBIG")
+	tc.transactf("ok", "search text {10+}\r\n0123456789")
+
+	// Too long command line, connection is closed.
+	tc2 := startArgsMore(t, false, false, nil, nil, true, false, false, "mjl", setLimits)
+	defer tc2.close()
+	tc2.client.Login("mjl@mox.example", password0)
+	tc2.conn.Write([]byte("x0 noop " + strings.Repeat("x", 1024) + "\r\n"))
+	tc2.waitDone()
+
+	// Non-synchronizing literal larger than allowed with LITERAL- aborts the connection.
+	tc.transactf("bad", "append inbox {4097+}")
+	tc.xcode("TOOBIG")
+	tc.waitDone()
+}
@@ -2,16 +2,24 @@ package imapserver
 
 import (
 	"context"
+	"crypto/ed25519"
 	"crypto/hmac"
 	"crypto/md5"
+	cryptorand "crypto/rand"
 	"crypto/sha1"
 	"crypto/sha256"
 	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
 	"encoding/base64"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"hash"
+	"math/big"
 	"net"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
 	"strings"
@@ -20,7 +28,9 @@ import (
 
 	"golang.org/x/text/secure/precis"
 
+	"github.com/mjl-/mox/config"
 	"github.com/mjl-/mox/mox-"
+	"github.com/mjl-/mox/oauthbearer"
 	"github.com/mjl-/mox/scram"
 	"github.com/mjl-/mox/store"
 )
@@ -103,6 +113,55 @@ func TestLoginDisabled(t *testing.T) {
 	tc.xcode("AUTHENTICATIONFAILED")
 }
 
+func TestLoginNetworks(t *testing.T) {
+	tc := start(t)
+	defer tc.close()
+
+	// Connections in tests are from 127.0.0.10.
+	accConf, _ := mox.Conf.Account("mjl")
+	defer func() {
+		mox.Conf.Dynamic.Accounts["mjl"] = accConf
+	}()
+	nconf := accConf
+	nconf.ParsedLoginNetworks = []net.IPNet{{IP: net.ParseIP("192.0.2.0").To4(), Mask: net.CIDRMask(24, 32)}}
+	mox.Conf.Dynamic.Accounts["mjl"] = nconf
+
+	tc.transactf("no", "authenticate plain %s", base64.StdEncoding.EncodeToString([]byte("\u0000mjl@mox.example\u0000"+password0)))
+	tc.xcode("")
+	tc.transactf("no", "login mjl@mox.example {%d+}\r\n%s", len(password0), password0)
+	tc.xcode("")
+	// Bad password still results in regular authentication failure.
+	tc.transactf("no", "login mjl@mox.example bogus")
+	tc.xcode("AUTHENTICATIONFAILED")
+
+	nconf.ParsedLoginNetworks = append(nconf.ParsedLoginNetworks, net.IPNet{IP: net.ParseIP("127.0.0.0").To4(), Mask: net.CIDRMask(8, 32)})
+	mox.Conf.Dynamic.Accounts["mjl"] = nconf
+	tc.client.Login("mjl@mox.example", password0)
+}
+
+// Sessions authenticated before the account was suspended are closed at the next
+// command.
+func TestSuspendedSession(t *testing.T) {
+	tc := start(t)
+	defer tc.close()
+
+	tc.client.Login("mjl@mox.example", password0)
+	tc.transactf("ok", "noop")
+
+	accConf, _ := mox.Conf.Account("mjl")
+	defer func() {
+		mox.Conf.Dynamic.Accounts["mjl"] = accConf
+	}()
+	nconf := accConf
+	nconf.Suspended = "frozen"
+	mox.Conf.Dynamic.Accounts["mjl"] = nconf
+
+	_, err := fmt.Fprintf(tc.conn, "x noop\r\n")
+	tc.check(err, "write command")
+	tc.readprefixline("* BYE account suspended: frozen")
+	tc.waitDone()
+}
+
 func TestAuthenticateSCRAMSHA1(t *testing.T) {
 	testAuthenticateSCRAM(t, false, "SCRAM-SHA-1", sha1.New)
 }
@@ -386,3 +445,159 @@ func TestAuthenticateTLSClientCert(t *testing.T) {
 		t.Fatalf("got err %#v, expected tls 'bad certificate' alert", err)
 	}
 }
+
+func TestAuthenticateTLSClientCertConfig(t *testing.T) {
+	// CA, and client certificate signed by it.
+	caKey := ed25519.NewKeyFromSeed(make([]byte, ed25519.SeedSize))
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "ca"},
+		NotBefore:             time.Now().Add(-time.Minute),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	caBuf, err := x509.CreateCertificate(cryptorand.Reader, caTemplate, caTemplate, caKey.Public(), caKey)
+	tcheck(t, err, "create ca certificate")
+	caCert, err := x509.ParseCertificate(caBuf)
+	tcheck(t, err, "parse ca certificate")
+
+	clientKey := ed25519.NewKeyFromSeed(append(make([]byte, ed25519.SeedSize-1), 1))
+	clientTemplate := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "backup", Organization: []string{"Mox"}},
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	clientBuf, err := x509.CreateCertificate(cryptorand.Reader, clientTemplate, caCert, clientKey.Public(), caKey)
+	tcheck(t, err, "create client certificate")
+	clientConfig := tls.Config{
+		InsecureSkipVerify: true,
+		Certificates:       []tls.Certificate{{Certificate: [][]byte{clientBuf}, PrivateKey: clientKey}},
+	}
+
+	// Map subject to account in config, for listener with the CA.
+	configure := func(ta config.TLSClientAuth) func() error {
+		return func() error {
+			clientCAs := x509.NewCertPool()
+			clientCAs.AddCert(caCert)
+			mox.Conf.Static.Listeners["test"] = config.Listener{TLS: &config.TLS{ClientAuthCAs: clientCAs}}
+			accConf := mox.Conf.Dynamic.Accounts["mjl"]
+			accConf.TLSClientAuth = []config.TLSClientAuth{ta}
+			mox.Conf.Dynamic.Accounts["mjl"] = accConf
+			return nil
+		}
+	}
+
+	// Preauth with subject.
+	tc := startArgsMore(t, true, true, nil, &clientConfig, false, true, true, "mjl", configure(config.TLSClientAuth{Subject: "CN=backup,O=Mox", LoginAddress: "mjl@mox.example"}))
+	if !tc.client.Preauth {
+		t.Fatalf("not preauthentication while configured for tls client certificate subject")
+	}
+	tc.client.Select("inbox")
+	tc.close()
+
+	// Without preauth, with external authentication as other address.
+	tc = startArgsMore(t, true, true, nil, &clientConfig, false, true, true, "mjl", configure(config.TLSClientAuth{Subject: "CN=backup,O=Mox", LoginAddress: "móx@mox.example", NoIMAPPreauth: true}))
+	if tc.client.Preauth {
+		t.Fatalf("preauthentication while not configured for tls client certificate")
+	}
+	tc.transactf("ok", "authenticate external ")
+	tc.close()
+
+	// By fingerprint.
+	clientCert, err := x509.ParseCertificate(clientBuf)
+	tcheck(t, err, "parse client certificate")
+	fpbuf := sha256.Sum256(clientCert.RawSubjectPublicKeyInfo)
+	fp := base64.RawURLEncoding.EncodeToString(fpbuf[:])
+	tc = startArgsMore(t, true, true, nil, &clientConfig, false, true, true, "mjl", configure(config.TLSClientAuth{Fingerprint: fp, LoginAddress: "mjl@mox.example"}))
+	if !tc.client.Preauth {
+		t.Fatalf("not preauthentication while configured for tls client certificate fingerprint")
+	}
+	tc.close()
+}
+
+func TestAuthenticateOAuth(t *testing.T) {
+	key := ed25519.NewKeyFromSeed(make([]byte, ed25519.SeedSize))
+	jwks := fmt.Sprintf(`{"keys": [{"kty": "OKP", "crv": "Ed25519", "kid": "test", "x": "%s"}]}`, base64.RawURLEncoding.EncodeToString(key.Public().(ed25519.PublicKey)))
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, jwks)
+	}))
+	defer ts.Close()
+
+	const issuer = "https://sso.mox.example"
+	oc := &config.OAuth{
+		Verifier: &oauthbearer.Verifier{Issuer: issuer, JWKSURL: ts.URL, Audience: "mox", Scopes: []string{"email"}},
+	}
+	// Config is loaded when starting.
+	startOAuth := func() *testconn {
+		tc := start(t)
+		mox.Conf.Static.OAuth = oc
+		return tc
+	}
+	defer func() {
+		mox.Conf.Static.OAuth = nil
+	}()
+
+	token := func(email, scope string) string {
+		header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg": "EdDSA", "kid": "test"}`))
+		claims := fmt.Sprintf(`{"iss": "%s", "aud": "mox", "exp": %d, "scope": "%s", "email": "%s"}`, issuer, time.Now().Add(time.Hour).Unix(), scope, email)
+		data := header + "." + base64.RawURLEncoding.EncodeToString([]byte(claims))
+		return data + "." + base64.RawURLEncoding.EncodeToString(ed25519.Sign(key, []byte(data)))
+	}
+	oauthbearer := func(authzid, token string) string {
+		return base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf("n,a=%s,\x01auth=Bearer %s\x01\x01", authzid, token)))
+	}
+	xoauth2 := func(user, token string) string {
+		return base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf("user=%s\x01auth=Bearer %s\x01\x01", user, token)))
+	}
+
+	tc := startOAuth()
+	tc.transactf("ok", "capability")
+	if _, ok := tc.client.CapAvailable["AUTH=OAUTHBEARER"]; !ok {
+		t.Fatalf("missing capability AUTH=OAUTHBEARER")
+	}
+	tc.transactf("bad", "authenticate oauthbearer %s", base64.StdEncoding.EncodeToString([]byte("n,,\x01\x01"))) // Missing auth.
+	tc.transactf("ok", "authenticate oauthbearer %s", oauthbearer("", token("mjl@mox.example", "email")))
+	tc.close()
+
+	// Authorization identity for other address of same account.
+	tc = startOAuth()
+	tc.transactf("ok", "authenticate xoauth2 %s", xoauth2("móx@mox.example", token("mjl@mox.example", "openid email")))
+	tc.close()
+
+	tc = startOAuth()
+	defer tc.close()
+
+	// Failures get an error challenge, and fail after the client responds.
+	xfail := func(mech, resp, expStatus string) {
+		t.Helper()
+		tc.cmdf("", "authenticate %s %s", mech, resp)
+		line, err := tc.client.Readline()
+		tcheck(t, err, "read line")
+		buf, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(line, "+ "))
+		tcheck(t, err, "decode error challenge")
+		var x struct{ Status string }
+		err = json.Unmarshal(buf, &x)
+		tcheck(t, err, "parse error challenge")
+		if x.Status != expStatus {
+			t.Fatalf("got status %q, expected %q", x.Status, expStatus)
+		}
+		if mech == "oauthbearer" {
+			tc.writelinef("%s", base64.StdEncoding.EncodeToString([]byte("\x01")))
+		} else {
+			tc.writelinef("")
+		}
+		tc.readstatus("no")
+		tc.xcode("AUTHENTICATIONFAILED")
+	}
+	xfail("oauthbearer", oauthbearer("", token("mjl@mox.example", "openid")), "insufficient_scope")
+	xfail("oauthbearer", oauthbearer("", token("mjl@mox.example", "email")+"x"), "invalid_token")
+	xfail("oauthbearer", oauthbearer("other@mox.example", token("mjl@mox.example", "email")), "invalid_token")
+	xfail("oauthbearer", oauthbearer("", token("unknown@other.example", "email")), "invalid_token")
+	xfail("xoauth2", xoauth2("mjl@mox.example", "bogus"), "401")
+
+	tc.transactf("ok", "authenticate oauthbearer %s", oauthbearer("mjl@mox.example", token("mjl@mox.example", "email")))
+}
@@ -0,0 +1,219 @@
+package imapserver
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/mjl-/bstore"
+
+	"github.com/mjl-/mox/moxio"
+	"github.com/mjl-/mox/store"
+)
+
+// xappendCatenate parses the parts of a CATENATE for APPEND, starting after the
+// opening parenthesis, and writes the message data to w. Literal data is read
+// with xreadLiteral. Data for URLs is looked up in this account.
+//
+// If a URL cannot be used, it is stored in badURL and further data is not
+// written. Remaining parts are still parsed, non-synchronizing literals are
+// read and discarded, so an error can be returned with the literals consumed.
+// A synchronizing literal after a bad URL results in an immediate error.
+func (c *conn) xappendCatenate(p *parser, xreadLiteral func(size int64, sync bool, w io.Writer), w io.Writer, badURL *string) {
+	// Request syntax: ../rfc/4469
+	for i := 0; ; i++ {
+		if i > 0 {
+			if p.take(")") {
+				return
+			}
+			p.xspace()
+		}
+
+		if p.take("URL ") {
+			u := p.xastring()
+			if *badURL != "" {
+				continue
+			}
+			if err := c.catenateURL(u, w); err != nil {
+				c.log.Debugx("catenate url", err, slog.String("url", u))
+				*badURL = u
+			}
+			continue
+		}
+
+		p.xtake("TEXT ")
+		// Literal8 is allowed with BINARY. ../rfc/4469
+		size, sync := p.xliteralSize(true, false)
+		if appendSize := c.appendLimit(); appendSize > 0 && size > appendSize {
+			// ../rfc/7889:139
+			p.xliteralTooBig(sync, fmt.Sprintf("text size %d is larger than allowed %d", size, appendSize))
+		}
+		if *badURL != "" {
+			if sync {
+				// ../rfc/4469
+				xusercodeErrorf("BADURL "+*badURL, "cannot use url for catenate")
+			}
+			xreadLiteral(size, sync, io.Discard)
+		} else {
+			xreadLiteral(size, sync, w)
+		}
+	}
+}
+
+// catenateURL writes the message data referenced by IMAP URL u, either absolute
+// or relative to this server, to w. Only messages in the account of the
+// connection can be referenced. URLAUTH is not supported.
+//
+// Example: /INBOX;UIDVALIDITY=1/;UID=2/;SECTION=1.TEXT/;PARTIAL=0.1024
+func (c *conn) catenateURL(u string, w io.Writer) (rerr error) {
+	// URL syntax: ../rfc/5092
+	defer func() {
+		x := recover()
+		if x == nil {
+			return
+		}
+		switch err := x.(type) {
+		case userError:
+			rerr = err
+		case syntaxError:
+			rerr = err
+		case attrError:
+			rerr = err
+		default:
+			panic(x)
+		}
+	}()
+
+	path := u
+	if rest, ok := strings.CutPrefix(strings.ToLower(u), "imap://"); ok {
+		rest = u[len(u)-len(rest):]
+		authority, p, ok := strings.Cut(rest, "/")
+		if !ok {
+			xuserErrorf("missing path in url")
+		}
+		if userinfo, _, ok := strings.Cut(authority, "@"); ok {
+			user, _, _ := strings.Cut(userinfo, ";")
+			if user != "" {
+				user, err := url.PathUnescape(user)
+				if err != nil {
+					xuserErrorf("parsing user in url: %v", err)
+				}
+				if user != c.username {
+					xuserErrorf("url for other user")
+				}
+			}
+		}
+		path = "/" + p
+	} else if !strings.HasPrefix(u, "/") {
+		xuserErrorf("url must be absolute imap url or absolute path")
+	}
+
+	unescape := func(s string) string {
+		s, err := url.PathUnescape(s)
+		if err != nil {
+			xuserErrorf("parsing url: %v", err)
+		}
+		return s
+	}
+
+	segs := strings.Split(path[1:], "/")
+	name, params, _ := strings.Cut(segs[0], ";")
+	name = unescape(name)
+	var uidvalidity uint32
+	if params != "" {
+		k, v, _ := strings.Cut(params, "=")
+		if !strings.EqualFold(k, "UIDVALIDITY") {
+			xuserErrorf("unknown mailbox parameter %q in url", k)
+		}
+		n, err := strconv.ParseUint(v, 10, 32)
+		if err != nil || n == 0 {
+			xuserErrorf("bad uidvalidity in url")
+		}
+		uidvalidity = uint32(n)
+	}
+
+	var uid uint32
+	var section *sectionSpec
+	var urlPartial *partial
+	for _, seg := range segs[1:] {
+		k, v, ok := strings.Cut(seg, "=")
+		if !ok || !strings.HasPrefix(k, ";") {
+			xuserErrorf("bad parameter %q in url", seg)
+		}
+		v = unescape(v)
+		switch strings.ToUpper(k[1:]) {
+		case "UID":
+			if uid != 0 || section != nil || urlPartial != nil {
+				xuserErrorf("unexpected uid in url")
+			}
+			n, err := strconv.ParseUint(v, 10, 32)
+			if err != nil || n == 0 {
+				xuserErrorf("bad uid in url")
+			}
+			uid = uint32(n)
+		case "SECTION":
+			if uid == 0 || section != nil || urlPartial != nil {
+				xuserErrorf("unexpected section in url")
+			}
+			sp := newParser("["+v+"]", c)
+			section = sp.xsection()
+			sp.xempty()
+		case "PARTIAL":
+			if uid == 0 || urlPartial != nil {
+				xuserErrorf("unexpected partial in url")
+			}
+			o, l, hasLength := strings.Cut(v, ".")
+			offset, err := strconv.ParseUint(o, 10, 32)
+			if err != nil {
+				xuserErrorf("bad partial offset in url")
+			}
+			urlPartial = &partial{offset: uint32(offset), count: math.MaxUint32}
+			if hasLength {
+				count, err := strconv.ParseUint(l, 10, 32)
+				if err != nil || count == 0 {
+					xuserErrorf("bad partial length in url")
+				}
+				urlPartial.count = uint32(count)
+			}
+		default:
+			xuserErrorf("unsupported parameter %q in url", k)
+		}
+	}
+	if uid == 0 {
+		xuserErrorf("missing uid in url")
+	}
+
+	name = xcheckmailboxname(name, true)
+	c.xdbread(func(tx *bstore.Tx) {
+		mb := c.xmailbox(tx, name, "")
+		if uidvalidity != 0 && mb.UIDValidity != uidvalidity {
+			xuserErrorf("uidvalidity does not match")
+		}
+
+		cmd := &fetchCmd{conn: c, mailboxID: mb.ID, uid: store.UID(uid), tx: tx}
+		defer func() {
+			if cmd.msgr != nil {
+				err := cmd.msgr.Close()
+				c.xsanity(err, "closing messagereader")
+			}
+		}()
+		msgr, part := cmd.xensureParsed()
+
+		var r io.Reader
+		if section == nil || section.msgtext == nil && section.part == nil {
+			r = &moxio.AtReader{R: msgr}
+		} else {
+			r = cmd.xsection(section, part)
+		}
+		if urlPartial != nil {
+			r = cmd.xpartialReader(urlPartial, r)
+		}
+		_, err := io.Copy(w, r)
+		xcheckf(err, "copying message data for url")
+	})
+	return nil
+}
@@ -0,0 +1,222 @@
+package imapserver
+
+import (
+	"errors"
+	"log/slog"
+	"net"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Connection is an open IMAP connection, as listed in the admin interface.
+type Connection struct {
+	CID        int64
+	Listener   string
+	RemoteIP   string
+	TLS        bool
+	Start      time.Time
+	LastActive time.Time // Start of most recent command, or of connection.
+	State      string    // "notauthenticated", "authenticated" or "selected".
+	Username   string    // As used for authentication, empty before.
+	Account    string    // Empty before authentication.
+	Command    string    // Currently executing, empty while waiting for a command. Lower case.
+}
+
+type connEntry struct {
+	Connection
+	nc net.Conn // Original connection, for setting deadlines.
+
+	// If set, the connection is being closed by us and this is the text for the BYE
+	// response.
+	closeReason string
+}
+
+// Open connections, for listing in the admin interface, for closing the least
+// recently active connection when a listener has too many connections, and for
+// closing connections on request of the admin.
+var connections = struct {
+	sync.Mutex
+	m map[int64]*connEntry // By cid.
+}{m: map[int64]*connEntry{}}
+
+// ErrConnectionUnknown is returned by ConnectionClose for a connection that is
+// not (or no longer) open.
+var ErrConnectionUnknown = errors.New("unknown connection")
+
+// connRegister adds the connection to the table. If the listener has more than
+// its maximum number of connections, the least recently active other connection
+// is closed. If the remote IP already has its maximum number of connections, the
+// connection is not added and false is returned.
+func connRegister(c *conn, nc net.Conn, listenerName string) bool {
+	connections.Lock()
+	defer connections.Unlock()
+
+	if c.limits.maxConnectionsIP > 0 {
+		ip := c.remoteIP.String()
+		var n int
+		for _, e := range connections.m {
+			if e.RemoteIP == ip && e.closeReason == "" {
+				n++
+			}
+		}
+		if n >= c.limits.maxConnectionsIP {
+			return false
+		}
+	}
+
+	now := time.Now()
+	connections.m[c.cid] = &connEntry{
+		Connection: Connection{
+			CID:        c.cid,
+			Listener:   listenerName,
+			RemoteIP:   c.remoteIP.String(),
+			TLS:        c.tls,
+			Start:      now,
+			LastActive: now,
+			State:      c.state.String(),
+		},
+		nc: nc,
+	}
+
+	if c.limits.maxConnections <= 0 {
+		return true
+	}
+	var n int
+	var oldest *connEntry
+	for _, e := range connections.m {
+		if e.Listener != listenerName || e.closeReason != "" {
+			continue
+		}
+		n++
+		if e.CID != c.cid && (oldest == nil || e.LastActive.Before(oldest.LastActive)) {
+			oldest = e
+		}
+	}
+	if n > c.limits.maxConnections && oldest != nil {
+		c.log.Info("too many connections for listener, closing least recently active connection", slog.Int64("closecid", oldest.CID), slog.Int("maxconnections", c.limits.maxConnections))
+		connClose(oldest, "too many connections, closing least recently active connection")
+	}
+	return true
+}
+
+// connAccountReserve returns whether the connection can authenticate for the
+// account without exceeding max open connections for the account. If so, the
+// account is set on the table entry, so concurrent authentications count it.
+func connAccountReserve(cid int64, accountName string, max int) bool {
+	connections.Lock()
+	defer connections.Unlock()
+
+	var n int
+	for _, e := range connections.m {
+		if e.CID != cid && e.Account == accountName && e.closeReason == "" {
+			n++
+		}
+	}
+	if n >= max {
+		return false
+	}
+	if e := connections.m[cid]; e != nil {
+		e.Account = accountName
+	}
+	return true
+}
+
+// connUnregister removes the connection from the table.
+func connUnregister(cid int64) {
+	connections.Lock()
+	defer connections.Unlock()
+	delete(connections.m, cid)
+}
+
+// connClose marks the connection as closing and sets a deadline in the past,
+// causing the connection goroutine to write a BYE and close the connection.
+//
+// Must be called with connections lock held.
+func connClose(e *connEntry, reason string) {
+	e.closeReason = reason
+	e.nc.SetDeadline(time.Now()) // Error not actionable.
+}
+
+// connUpdate updates the table entry for the connection with the current state
+// and command.
+func (c *conn) connUpdate() {
+	connections.Lock()
+	defer connections.Unlock()
+
+	e := connections.m[c.cid]
+	if e == nil {
+		return
+	}
+	e.TLS = c.tls
+	e.State = c.state.String()
+	e.Username = c.username
+	e.Account = ""
+	if c.account != nil {
+		e.Account = c.account.Name
+	}
+	e.Command = c.cmd
+	if c.cmd != "" {
+		e.LastActive = c.cmdStart
+	}
+}
+
+// setReadDeadline sets the read deadline on the connection, or a deadline in the
+// past if the connection is being closed. Done with the connections lock held, so
+// a concurrent close isn't undone.
+func (c *conn) setReadDeadline(deadline time.Time) error {
+	connections.Lock()
+	defer connections.Unlock()
+
+	if e := connections.m[c.cid]; e != nil && e.closeReason != "" {
+		deadline = time.Now()
+	}
+	return c.conn.SetReadDeadline(deadline)
+}
+
+// byeReason returns the text for a BYE response after reading from the
+// connection failed with a deadline.
+func (c *conn) byeReason() string {
+	connections.Lock()
+	var reason string
+	if e := connections.m[c.cid]; e != nil {
+		reason = e.closeReason
+	}
+	connections.Unlock()
+	if reason != "" {
+		return reason
+	}
+	if c.limits.maxLifetime > 0 && time.Since(c.start) >= c.limits.maxLifetime {
+		return "maximum connection lifetime reached, please reconnect"
+	}
+	return "inactive"
+}
+
+// ConnectionList returns the open IMAP connections, ordered by connection ID.
+func ConnectionList() []Connection {
+	connections.Lock()
+	defer connections.Unlock()
+
+	l := make([]Connection, 0, len(connections.m))
+	for _, e := range connections.m {
+		l = append(l, e.Connection)
+	}
+	sort.Slice(l, func(i, j int) bool {
+		return l[i].CID < l[j].CID
+	})
+	return l
+}
+
+// ConnectionClose closes the connection with connection ID cid, after writing a
+// BYE with reason. A command in progress is aborted.
+func ConnectionClose(cid int64, reason string) error {
+	connections.Lock()
+	defer connections.Unlock()
+
+	e := connections.m[cid]
+	if e == nil {
+		return ErrConnectionUnknown
+	}
+	connClose(e, reason)
+	return nil
+}
@@ -0,0 +1,136 @@
+package imapserver
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mjl-/mox/config"
+	"github.com/mjl-/mox/mox-"
+)
+
+func TestConnections(t *testing.T) {
+	tc := start(t)
+	defer tc.close()
+	cid := connCounter
+
+	tc.client.Login("mjl@mox.example", password0)
+	tc.transactf("ok", "noop")
+
+	l := ConnectionList()
+	var found bool
+	for _, c := range l {
+		if c.CID != cid {
+			continue
+		}
+		found = true
+		if c.Listener != "test" || c.Account != "mjl" || c.Username != "mjl@mox.example" || c.State != "authenticated" || c.RemoteIP != "127.0.0.10" {
+			t.Fatalf("unexpected connection %#v", c)
+		}
+	}
+	if !found {
+		t.Fatalf("connection not listed")
+	}
+
+	// Close by admin.
+	err := ConnectionClose(cid, "closed by test")
+	tcheck(t, err, "close connection")
+	tc.readprefixline("* BYE closed by test")
+	tc.waitDone()
+	err = ConnectionClose(cid, "closed by test")
+	if !errors.Is(err, ErrConnectionUnknown) {
+		t.Fatalf("closing closed connection, got %v, expected ErrConnectionUnknown", err)
+	}
+}
+
+func TestConnectionLimits(t *testing.T) {
+	tc1 := start(t)
+	defer tc1.close()
+
+	setLimits := func(il config.IMAPLimits) func() error {
+		return func() error {
+			mox.Conf.Static.Listeners["test"] = config.Listener{IMAPLimits: il}
+			return nil
+		}
+	}
+
+	// Idle timeout, also applies to IDLE.
+	tc := startArgsMore(t, false, false, nil, nil, true, false, true, "mjl", setLimits(config.IMAPLimits{IdleTimeout: 250 * time.Millisecond}))
+	tc.client.Login("mjl@mox.example", password0)
+	tc.client.Select("inbox")
+	tc.cmdf("", "idle")
+	tc.readprefixline("+ ")
+	tc.readprefixline("* BYE inactive")
+	tc.waitDone()
+	tc.close()
+
+	// Maximum lifetime, regardless of activity.
+	tc = startArgsMore(t, false, false, nil, nil, true, false, true, "mjl", setLimits(config.IMAPLimits{MaxLifetime: 500 * time.Millisecond}))
+	tc.client.Login("mjl@mox.example", password0)
+	tc.transactf("ok", "noop")
+	tc.readprefixline("* BYE maximum connection lifetime reached")
+	tc.waitDone()
+	tc.close()
+
+	// Too many connections for listener, least recently active connection is closed.
+	limits := setLimits(config.IMAPLimits{MaxConnections: 2})
+	tc2 := startArgsMore(t, false, false, nil, nil, true, false, true, "mjl", limits)
+	defer tc2.close()
+	tc1.transactf("ok", "noop")
+	tc3 := startArgsMore(t, false, false, nil, nil, true, false, true, "mjl", limits)
+	defer tc3.close()
+	tc2.readprefixline("* BYE too many connections")
+	tc2.waitDone()
+	tc1.transactf("ok", "noop")
+	tc3.transactf("ok", "noop")
+}
+
+func TestConnectionLimitsIPAccount(t *testing.T) {
+	tc1 := start(t)
+	defer tc1.close()
+	tc1.client.Login("mjl@mox.example", password0)
+
+	setLimits := func(il config.IMAPLimits) func() error {
+		return func() error {
+			mox.Conf.Static.Listeners["test"] = config.Listener{IMAPLimits: il}
+			return nil
+		}
+	}
+
+	// Too many connections for account.
+	tc2 := startArgsMore(t, false, false, nil, nil, true, false, true, "mjl", setLimits(config.IMAPLimits{MaxConnectionsPerAccount: 1}))
+	defer tc2.close()
+	tc2.transactf("no", `login "mjl@mox.example" "%s"`, password0)
+	tc2.xcode("ALERT")
+
+	// Account can override the listener limit.
+	accConf := mox.Conf.Dynamic.Accounts["mjl"]
+	accConf.MaxIMAPConnections = 2
+	mox.Conf.Dynamic.Accounts["mjl"] = accConf
+	tc2.transactf("ok", `login "mjl@mox.example" "%s"`, password0)
+
+	// Too many connections from IP, new connection is refused with an alert.
+	setLimits(config.IMAPLimits{MaxConnectionsPerIP: 2})()
+	serverConn, clientConn := net.Pipe()
+	defer clientConn.Close()
+	done := make(chan struct{})
+	connCounter++
+	cid := connCounter
+	go func() {
+		defer serverConn.Close()
+		serve("test", cid, nil, serverConn, false, true, false, "")
+		close(done)
+	}()
+	line, err := bufio.NewReader(clientConn).ReadString('\n')
+	tcheck(t, err, "read greeting")
+	if !strings.HasPrefix(line, "* BYE [ALERT] too many open connections from your ip") {
+		t.Fatalf("got greeting %q, expected bye with alert", line)
+	}
+	<-done
+
+	tc1.transactf("ok", "noop")
+	tc2.transactf("ok", "noop")
+}
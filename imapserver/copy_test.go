@@ -2,8 +2,11 @@ package imapserver
 
 import (
 	"testing"
+	"time"
 
+	"github.com/mjl-/mox/config"
 	"github.com/mjl-/mox/imapclient"
+	"github.com/mjl-/mox/mox-"
 )
 
 func TestCopy(t *testing.T) {
@@ -70,3 +73,46 @@ func TestCopy(t *testing.T) {
 	tclimit.transactf("no", "copy 1:* Trash")
 	tclimit.xcode("OVERQUOTA")
 }
+
+// Copies of messages in a pack file share the compressed data, and have no file
+// to remove when expunged.
+func TestCopyPacked(t *testing.T) {
+	defer mockUIDValidity()()
+	tc := start(t)
+	defer tc.close()
+
+	tc.client.Login("mjl@mox.example", password0)
+	received := time.Now().Add(-48 * time.Hour)
+	tc.client.Append("inbox", nil, &received, []byte(exampleMsg))
+
+	accConf, _ := tc.account.Conf()
+	accConf.ArchiveTier = &config.ArchiveTier{Age: time.Hour}
+	mox.Conf.Dynamic.Accounts["mjl"] = accConf
+	stats, err := tc.account.ArchivePack(ctxbg, pkglog)
+	tcheck(t, err, "archive pack")
+	if stats.Packed != 1 {
+		t.Fatalf("packed %d messages, expected 1", stats.Packed)
+	}
+
+	body := imapclient.FetchBody{RespAttr: "BODY[]", Body: exampleMsg}
+
+	tc.client.Select("inbox")
+	tc.transactf("ok", "copy 1 Trash")
+	tc.transactf("ok", "fetch 1 body.peek[]")
+	tc.xuntagged(imapclient.UntaggedFetch{Seq: 1, Attrs: []imapclient.FetchAttr{imapclient.FetchUID(1), body}})
+	tc.client.StoreFlagsSet("1", true, `\Deleted`)
+	tc.client.Expunge()
+
+	tc.client.Select("Trash")
+	tc.transactf("ok", "fetch 1 body.peek[]")
+	tc.xuntagged(imapclient.UntaggedFetch{Seq: 1, Attrs: []imapclient.FetchAttr{imapclient.FetchUID(1), body}})
+	tc.client.StoreFlagsSet("1", true, `\Deleted`)
+	tc.client.Expunge()
+
+	// Pack file is no longer needed.
+	stats, err = tc.account.ArchivePack(ctxbg, pkglog)
+	tcheck(t, err, "archive pack")
+	if stats.PacksRemoved != 1 {
+		t.Fatalf("removed %d pack files, expected 1", stats.PacksRemoved)
+	}
+}
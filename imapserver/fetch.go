@@ -404,6 +404,15 @@ func (cmd *fetchCmd) xprocessAtt(a fetchAtt) []token {
 		m := cmd.xensureMessage()
 		return []token{bare("INTERNALDATE"), dquote(m.Received.Format("_2-Jan-2006 15:04:05 -0700"))}
 
+	case "SAVEDATE":
+		// ../rfc/8514
+		m := cmd.xensureMessage()
+		var savedate token = nilt
+		if m.SaveDate != nil {
+			savedate = dquote(m.SaveDate.Format("_2-Jan-2006 15:04:05 -0700"))
+		}
+		return []token{bare("SAVEDATE"), savedate}
+
 	case "BODYSTRUCTURE":
 		_, part := cmd.xensureParsed()
 		bs := xbodystructure(part, true)
@@ -620,7 +629,7 @@ func (cmd *fetchCmd) xbinary(a fetchAtt) (string, token) {
 		if a.partial != nil {
 			r = cmd.xpartialReader(a.partial, r)
 		}
-		return cmd.sectionRespField(a), readerSyncliteral{r}
+		return cmd.sectionRespField(a), readerSyncliteral{r, true}
 	}
 
 	p := part
@@ -643,7 +652,7 @@ func (cmd *fetchCmd) xbinary(a fetchAtt) (string, token) {
 	if a.partial != nil {
 		r = cmd.xpartialReader(a.partial, r)
 	}
-	return cmd.sectionRespField(a), readerSyncliteral{r}
+	return cmd.sectionRespField(a), readerSyncliteral{r, true}
 }
 
 func (cmd *fetchCmd) xpartialReader(partial *partial, r io.Reader) io.Reader {
@@ -692,9 +701,9 @@ func (cmd *fetchCmd) xbody(a fetchAtt) (string, token) {
 		if n != int64(a.partial.offset) {
 			return respField, syncliteral("") // ../rfc/3501:3143 ../rfc/9051:4418
 		}
-		return respField, readerSyncliteral{io.LimitReader(sr, int64(a.partial.count))}
+		return respField, readerSyncliteral{io.LimitReader(sr, int64(a.partial.count)), false}
 	}
-	return respField, readerSyncliteral{sr}
+	return respField, readerSyncliteral{sr, false}
 }
 
 func (cmd *fetchCmd) xpartnumsDeref(nums []uint32, p *message.Part) *message.Part {
@@ -3,10 +3,13 @@ package imapserver
 import (
 	"bytes"
 	"fmt"
+	"slices"
 	"strings"
 
 	"github.com/mjl-/bstore"
 
+	"github.com/mjl-/mox/mox-"
+	"github.com/mjl-/mox/smtp"
 	"github.com/mjl-/mox/store"
 )
 
@@ -101,55 +104,35 @@ func (c *conn) cmdGetmetadata(tag, cmd string, p *parser) {
 				q.FilterNonzero(store.Annotation{MailboxID: mb.ID})
 			}
 
-			err := q.ForEach(func(a store.Annotation) error {
-				// ../rfc/5464:516
-				switch optDepth {
-				case "", "0":
-					if _, ok := entryNames[a.Key]; !ok {
-						return nil
-					}
-				case "1", "INFINITY":
-					// Go through all keys, matching depth.
-					if _, ok := entryNames[a.Key]; ok {
-						break
-					}
-					var match bool
-					for s := range entryNames {
-						prefix := s
-						if s != "/" {
-							prefix += "/"
-						}
-						if !strings.HasPrefix(a.Key, prefix) {
-							continue
-						}
-						if optDepth == "INFINITY" {
-							match = true
-							break
-						}
-						suffix := a.Key[len(prefix):]
-						t := strings.SplitN(suffix, "/", 2)
-						if len(t) == 1 {
-							match = true
-							break
-						}
-					}
-					if !match {
-						return nil
-					}
-				default:
-					xcheckf(fmt.Errorf("%q", optDepth), "missing case for depth")
+			add := func(a store.Annotation) {
+				if !metadataMatch(a.Key, entryNames, optDepth) {
+					return
 				}
-
 				if optMaxSize >= 0 && int64(len(a.Value)) > optMaxSize {
 					longentries = max(longentries, len(a.Value))
 				} else {
 					annotations = append(annotations, a)
 				}
+			}
+
+			err := q.ForEach(func(a store.Annotation) error {
+				add(a)
 				return nil
 			})
 			xcheckf(err, "looking up annotations")
+
+			// Server annotations are not stored, they are the same for all accounts.
+			if mailboxName == "" {
+				for _, a := range serverAnnotations() {
+					add(a)
+				}
+			}
 		})
 	})
+	// Return entries in a stable order, the query does not guarantee one.
+	slices.SortFunc(annotations, func(a, b store.Annotation) int {
+		return strings.Compare(a.Key, b.Key)
+	})
 
 	// Response syntax: ../rfc/5464:807 ../rfc/5464:778
 	// We can only send untagged responses when we have any matches.
@@ -178,10 +161,58 @@ func (c *conn) cmdGetmetadata(tag, cmd string, p *parser) {
 	}
 }
 
+// metadataMatch returns whether an annotation with key is requested through
+// entryNames and depth.
+func metadataMatch(key string, entryNames map[string]struct{}, depth string) bool {
+	// ../rfc/5464:516
+	if _, ok := entryNames[key]; ok {
+		return true
+	}
+	switch depth {
+	case "", "0":
+		return false
+	case "1", "INFINITY":
+		// Go through all keys, matching depth.
+		for s := range entryNames {
+			prefix := s
+			if s != "/" {
+				prefix += "/"
+			}
+			if !strings.HasPrefix(key, prefix) {
+				continue
+			}
+			if depth == "INFINITY" {
+				return true
+			}
+			suffix := key[len(prefix):]
+			t := strings.SplitN(suffix, "/", 2)
+			if len(t) == 1 {
+				return true
+			}
+		}
+		return false
+	default:
+		xcheckf(fmt.Errorf("%q", depth), "missing case for depth")
+		panic("not reached")
+	}
+}
+
+// serverAnnotations returns the shared server annotations, derived from the
+// configuration. They cannot be changed with SETMETADATA.
+func serverAnnotations() []store.Annotation {
+	// ../rfc/5464
+	postmaster := smtp.NewAddress("postmaster", mox.Conf.Static.HostnameDomain)
+	return []store.Annotation{
+		{Key: "/shared/admin", IsString: true, Value: []byte("mailto:" + postmaster.String())},
+	}
+}
+
 // Set metadata annotation, per mailbox or globally.
 //
-// We only implement private annotations, not shared annotations. We don't
-// currently have a mechanism for determining if the user should have access.
+// Mailboxes are only accessible by their account, which has all rights, so both
+// private and shared mailbox annotations can be set. Shared annotations are
+// visible to all sessions with access to the mailbox. Shared server annotations
+// are the same for all accounts and cannot be changed.
 //
 // State: Authenticated and selected.
 func (c *conn) cmdSetmetadata(tag, cmd string, p *parser) {
@@ -210,20 +241,32 @@ func (c *conn) cmdSetmetadata(tag, cmd string, p *parser) {
 
 	// Additional checks on entry names.
 	for _, a := range l {
-		// We only allow /private/* entry names, so check early and fail if we see anything
-		// else (the only other option is /shared/* at this moment).
+		// We only allow /private/* and /shared/* entry names, so check early and fail if
+		// we see anything else.
 		// ../rfc/5464:217
-		if !strings.HasPrefix(a.Key, "/private/") {
+		var scope string
+		if strings.HasPrefix(a.Key, "/private/") {
+			scope = "private"
+		} else if strings.HasPrefix(a.Key, "/shared/") {
+			scope = "shared"
+		} else {
 			// ../rfc/5464:346
-			xuserErrorf("only /private/* entry names allowed")
+			xuserErrorf("only /private/* and /shared/* entry names allowed")
+		}
+
+		// Server annotations in /shared/ are not per account, users are not allowed to
+		// change them. ../rfc/5464 ../rfc/5530
+		if scope == "shared" && mailboxName == "" {
+			xusercodeErrorf("NOPERM", "shared server annotations cannot be changed")
 		}
 
-		// We also enforce that /private/vendor/ is followed by at least 2 elements.
-		// ../rfc/5464:234
-		if a.Key == "/private/vendor" || strings.HasPrefix(a.Key, "/private/vendor/") {
+		// We also enforce that /private/vendor/ and /shared/vendor/ are followed by at
+		// least 2 elements. ../rfc/5464:234
+		vendor := "/" + scope + "/vendor"
+		if a.Key == vendor || strings.HasPrefix(a.Key, vendor+"/") {
 			t := strings.SplitN(a.Key[1:], "/", 4)
 			if len(t) < 4 {
-				xuserErrorf("entry names starting with /private/vendor must have at least 4 components")
+				xuserErrorf("entry names starting with %s must have at least 4 components", vendor)
 			}
 		}
 	}
@@ -39,8 +39,31 @@ func TestMetadata(t *testing.T) {
 		},
 	})
 
+	// Shared mailbox annotations are separate from private annotations.
+	tc.transactf("ok", `setmetadata inbox (/shared/comment "shared value")`)
+	tc.transactf("ok", `getmetadata inbox (/private/comment /shared/comment)`)
+	tc.xuntagged(imapclient.UntaggedMetadataAnnotations{
+		Mailbox: "Inbox",
+		Annotations: []imapclient.Annotation{
+			{Key: "/private/comment", IsString: true, Value: []byte("mailbox value")},
+			{Key: "/shared/comment", IsString: true, Value: []byte("shared value")},
+		},
+	})
+	tc.transactf("ok", `setmetadata inbox (/shared/comment nil)`)
+
+	// Shared server annotations come from the configuration.
+	tc.transactf("ok", `getmetadata (depth infinity) "" (/shared)`)
+	tc.xuntagged(imapclient.UntaggedMetadataAnnotations{
+		Mailbox: "",
+		Annotations: []imapclient.Annotation{
+			{Key: "/shared/admin", IsString: true, Value: []byte("mailto:postmaster@mox.example")},
+		},
+	})
+
 	tc.transactf("no", `setmetadata doesnotexist (/private/comment "test")`) // Bad mailbox.
-	tc.transactf("no", `setmetadata Inbox (/shared/comment "")`)             // /shared/ not implemented.
+	tc.transactf("no", `setmetadata "" (/shared/comment "")`)                // Shared server annotations cannot be changed.
+	tc.xcode("NOPERM")
+	tc.transactf("no", `setmetadata Inbox (/shared/vendor/stillbad "")`) // /*/vendor must have more components.
 	tc.transactf("no", `setmetadata Inbox (/badprefix/comment "")`)
 	tc.transactf("no", `setmetadata Inbox (/private/vendor "")`)          // /*/vendor must have more components.
 	tc.transactf("no", `setmetadata Inbox (/private/vendor/stillbad "")`) // /*/vendor must have more components.
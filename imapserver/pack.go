@@ -1,6 +1,7 @@
 package imapserver
 
 import (
+	"bytes"
 	"fmt"
 	"io"
 
@@ -124,9 +125,18 @@ func (t readerSizeSyncliteral) writeTo(c *conn, w io.Writer) {
 	}
 }
 
-// data from reader without known size.
+// data from reader without known size. If lit8 is set and the data contains a
+// NUL byte, it is written as literal8, as used for BINARY. ../rfc/3516
 type readerSyncliteral struct {
-	r io.Reader
+	r    io.Reader
+	lit8 bool
+}
+
+func (t readerSyncliteral) prefix(buf []byte) string {
+	if t.lit8 && bytes.IndexByte(buf, 0) >= 0 {
+		return "~"
+	}
+	return ""
 }
 
 func (t readerSyncliteral) pack(c *conn) string {
@@ -134,7 +144,7 @@ func (t readerSyncliteral) pack(c *conn) string {
 	if err != nil {
 		panic(err)
 	}
-	return fmt.Sprintf("{%d}\r\n", len(buf)) + string(buf)
+	return fmt.Sprintf("%s{%d}\r\n", t.prefix(buf), len(buf)) + string(buf)
 }
 
 func (t readerSyncliteral) writeTo(c *conn, w io.Writer) {
@@ -142,7 +152,7 @@ func (t readerSyncliteral) writeTo(c *conn, w io.Writer) {
 	if err != nil {
 		panic(err)
 	}
-	fmt.Fprintf(w, "{%d}\r\n", len(buf))
+	fmt.Fprintf(w, "%s{%d}\r\n", t.prefix(buf), len(buf))
 	defer c.xtrace(mlog.LevelTracedata)()
 	_, err = w.Write(buf)
 	if err != nil {
@@ -575,7 +575,8 @@ func (p *parser) xsectionBinary() (r []uint32) {
 var fetchAttWords = []string{
 	"ENVELOPE", "FLAGS", "INTERNALDATE", "RFC822.SIZE", "BODYSTRUCTURE", "UID", "BODY.PEEK", "BODY", "BINARY.PEEK", "BINARY.SIZE", "BINARY",
 	"RFC822.HEADER", "RFC822.TEXT", "RFC822", // older IMAP
-	"MODSEQ", // CONDSTORE extension.
+	"MODSEQ",   // CONDSTORE extension.
+	"SAVEDATE", // SAVEDATE extension.
 }
 
 // ../rfc/9051:6557 ../rfc/3501:4751 ../rfc/7162:2483
@@ -755,43 +756,47 @@ func (p *parser) xliteralSize(lit8 bool, checkSize bool) (size int64, sync bool)
 	p.xtake("}")
 	p.xempty()
 
+	if !sync && p.conn.limits.literalMinus && size > literalMinusMax {
+		// ../rfc/7888:178
+		p.xliteralTooBig(sync, fmt.Sprintf("non-synchronizing literal size %d is larger than allowed %d with LITERAL-", size, literalMinusMax))
+	}
+
 	if checkSize {
 		// ../rfc/7888:249
-		var errmsg string
-		const (
-			litSizeMax      = 100 * 1024
-			totalLitSizeMax = 10 * litSizeMax
-			litMax          = 1000
-		)
+		lim := p.conn.limits
 		p.literalSize += size
 		p.literals++
-		if size > litSizeMax {
-			errmsg = fmt.Sprintf("max literal size %d is larger than allowed %d", size, litSizeMax)
-		} else if p.literalSize > totalLitSizeMax {
-			errmsg = fmt.Sprintf("max total literal size for command %d is larger than allowed %d", p.literalSize, totalLitSizeMax)
-		} else if p.literals > litMax {
-			errmsg = fmt.Sprintf("max literals for command %d is larger than allowed %d", p.literals, litMax)
-		}
-		if errmsg != "" {
-			// ../rfc/9051:357 ../rfc/3501:347
-			err := errors.New("literal too big: " + errmsg)
-			if sync {
-				errmsg = ""
-			} else {
-				errmsg = "* BYE [ALERT] " + errmsg
-			}
-			panic(syntaxError{errmsg, "TOOBIG", err.Error(), err})
+		if size > lim.literalSize {
+			p.xliteralTooBig(sync, fmt.Sprintf("max literal size %d is larger than allowed %d", size, lim.literalSize))
+		} else if p.literalSize > lim.commandLiteralSize {
+			p.xliteralTooBig(sync, fmt.Sprintf("max total literal size for command %d is larger than allowed %d", p.literalSize, lim.commandLiteralSize))
+		} else if p.literals > lim.commandLiterals {
+			p.xliteralTooBig(sync, fmt.Sprintf("max literals for command %d is larger than allowed %d", p.literals, lim.commandLiterals))
 		}
 	}
 
 	return size, sync
 }
 
+// xliteralTooBig aborts the command for a literal that is too big. For a
+// synchronizing literal, the client hasn't sent the literal yet, and we respond
+// with NO. For a non-synchronizing literal, the client is already sending the
+// data, so we respond with BAD and close the connection.
+func (p *parser) xliteralTooBig(sync bool, errmsg string) {
+	if sync {
+		// ../rfc/9051:357 ../rfc/3501:347
+		xusercodeErrorf("TOOBIG", "literal too big: %s", errmsg)
+	}
+	err := errors.New("literal too big: " + errmsg)
+	panic(syntaxError{"* BYE [ALERT] " + errmsg, "TOOBIG", err.Error(), err})
+}
+
 var searchKeyWords = []string{
 	"ALL", "ANSWERED", "BCC",
 	"BEFORE", "BODY",
 	"CC", "DELETED", "FLAGGED",
 	"FROM", "KEYWORD",
+	"OLDER", "YOUNGER", // WITHIN extension, before OLD for matching.
 	"NEW", "OLD", "ON", "RECENT", "SEEN",
 	"SINCE", "SUBJECT",
 	"TEXT", "TO",
@@ -804,9 +809,12 @@ var searchKeyWords = []string{
 	"SENTSINCE", "SMALLER",
 	"UID", "UNDRAFT",
 	"MODSEQ", // CONDSTORE extension.
+	"FUZZY",  // SEARCH=FUZZY extension.
+	"SAVEDATESUPPORTED",
+	"SAVEDBEFORE", "SAVEDON", "SAVEDSINCE", // SAVEDATE extension.
 }
 
-// ../rfc/9051:6923 ../rfc/3501:4957, MODSEQ ../rfc/7162:2492
+// ../rfc/9051:6923 ../rfc/3501:4957, MODSEQ ../rfc/7162:2492, OLDER/YOUNGER ../rfc/5032:153
 // differences: rfc 9051 removes NEW, OLD, RECENT and makes SMALLER and LARGER number64 instead of number.
 func (p *parser) xsearchKey() *searchKey {
 	if p.take("(") {
@@ -849,6 +857,10 @@ func (p *parser) xsearchKey() *searchKey {
 	case "KEYWORD":
 		p.xspace()
 		sk.atom = p.xatom()
+	case "OLDER", "YOUNGER":
+		// ../rfc/5032:81
+		p.xspace()
+		sk.number = int64(p.xnznumber())
 	case "NEW":
 	case "OLD":
 	case "ON":
@@ -901,6 +913,11 @@ func (p *parser) xsearchKey() *searchKey {
 	case "SENTSINCE":
 		p.xspace()
 		sk.date = p.xdate()
+	case "SAVEDATESUPPORTED":
+		// ../rfc/8514
+	case "SAVEDBEFORE", "SAVEDON", "SAVEDSINCE":
+		p.xspace()
+		sk.date = p.xdate()
 	case "SMALLER":
 		p.xspace()
 		sk.number = p.xnumber64()
@@ -927,6 +944,10 @@ func (p *parser) xsearchKey() *searchKey {
 		sk.clientModseq = &v
 		// MODSEQ is a CONDSTORE-enabling parameter. ../rfc/7162:377
 		p.conn.enabled[capCondstore] = true
+	case "FUZZY":
+		// ../rfc/6203
+		p.xspace()
+		sk.searchKey = p.xsearchKey()
 	default:
 		p.xerrorf("missing case for op %q", sk.op)
 	}
@@ -952,6 +973,46 @@ func (sk searchKey) hasModseq() bool {
 	return false
 }
 
+// cacheKey returns a string representation of the search key, for use in the
+// search result cache. The second return value is false if the search key cannot
+// be cached because its result depends on the time (OLDER/YOUNGER) or on the saved
+// search result ("$").
+func (sk searchKey) cacheKey() (string, bool) {
+	var b strings.Builder
+	var xwrite func(sk searchKey) bool
+	xwrite = func(sk searchKey) bool {
+		if sk.seqSet != nil && sk.seqSet.searchResult || sk.uidSet.searchResult || sk.op == "OLDER" || sk.op == "YOUNGER" {
+			return false
+		}
+		fmt.Fprintf(&b, "(%q %q %q %d %q %d", sk.op, sk.headerField, sk.astring, sk.date.Unix(), sk.atom, sk.number)
+		if sk.seqSet != nil {
+			fmt.Fprintf(&b, " seq %s", sk.seqSet.String())
+		}
+		if sk.op == "UID" {
+			fmt.Fprintf(&b, " uid %s", sk.uidSet.String())
+		}
+		if sk.clientModseq != nil {
+			fmt.Fprintf(&b, " modseq %d", *sk.clientModseq)
+		}
+		for _, ssk := range sk.searchKeys {
+			if !xwrite(ssk) {
+				return false
+			}
+		}
+		for _, ssk := range []*searchKey{sk.searchKey, sk.searchKey2} {
+			if ssk != nil && !xwrite(*ssk) {
+				return false
+			}
+		}
+		b.WriteString(")")
+		return true
+	}
+	if !xwrite(sk) {
+		return "", false
+	}
+	return b.String(), true
+}
+
 // ../rfc/9051:6489 ../rfc/3501:4692
 func (p *parser) xdateDay() int {
 	d := p.xdigit()
@@ -29,8 +29,8 @@ func TestQuota1(t *testing.T) {
 	tc.transactf("ok", `getquota ""`)
 	tc.xuntagged()
 
-	// Check that we get a DELETED-STORAGE status attribute with value 0, also if
-	// messages are marked deleted. We don't go through the trouble.
+	// Check that we get a DELETED-STORAGE status attribute, with value 0 for an
+	// empty mailbox.
 	tc.transactf("ok", "status inbox (DELETED-STORAGE)")
 	tc.xuntagged(imapclient.UntaggedStatus{Mailbox: "Inbox", Attrs: map[imapclient.StatusAttr]int64{imapclient.StatusDeletedStorage: 0}})
 
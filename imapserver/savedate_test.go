@@ -0,0 +1,70 @@
+package imapserver
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mjl-/mox/imapclient"
+)
+
+func TestSaveDate(t *testing.T) {
+	tc := start(t)
+	defer tc.close()
+
+	tc.client.Login("mjl@mox.example", password0)
+	tc.transactf("ok", "capability")
+	if _, ok := tc.client.CapAvailable[imapclient.CapSaveDate]; !ok {
+		t.Fatalf("missing capability SAVEDATE")
+	}
+
+	received := time.Date(2020, time.January, 1, 10, 0, 0, 0, time.UTC)
+	tc.client.Append("inbox", nil, &received, []byte(exampleMsg))
+	tc.client.Select("inbox")
+
+	xsavedate := func() time.Time {
+		t.Helper()
+		tc.transactf("ok", "fetch 1 savedate")
+		if len(tc.lastUntagged) != 1 {
+			t.Fatalf("got %v, expected single untagged fetch", tc.lastUntagged)
+		}
+		fetch, ok := tc.lastUntagged[0].(imapclient.UntaggedFetch)
+		if !ok || len(fetch.Attrs) != 2 {
+			t.Fatalf("got %v, expected fetch with uid and savedate", tc.lastUntagged[0])
+		}
+		sd, ok := fetch.Attrs[1].(imapclient.FetchSaveDate)
+		if !ok || sd.SaveDate == nil {
+			t.Fatalf("got %v, expected savedate", fetch.Attrs[1])
+		}
+		return *sd.SaveDate
+	}
+
+	// Save date is the time of the append, not the received time.
+	now := time.Now()
+	saved := xsavedate()
+	if saved.Before(now.Add(-time.Minute)) || saved.After(now.Add(time.Minute)) {
+		t.Fatalf("got savedate %v, expected around %v", saved, now)
+	}
+
+	today := now.Format("2-Jan-2006")
+	tc.transactf("ok", "search savedatesupported")
+	tc.xsearch(1)
+	tc.transactf("ok", "search savedon %s", today)
+	tc.xsearch(1)
+	tc.transactf("ok", "search savedsince %s", today)
+	tc.xsearch(1)
+	tc.transactf("ok", "search savedbefore %s", today)
+	tc.xsearch()
+	tc.transactf("ok", "search before %s", today) // Received time.
+	tc.xsearch(1)
+
+	// Copy and move set a new save date.
+	tc.transactf("ok", "copy 1 Trash")
+	tc.client.Select("Trash")
+	xsavedate()
+	tc.transactf("ok", "move 1 Archive")
+	tc.client.Select("Archive")
+	xsavedate()
+
+	tc.transactf("bad", "search savedbefore")
+	tc.transactf("bad", "search savedon baddate")
+}
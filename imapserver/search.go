@@ -4,7 +4,9 @@ import (
 	"fmt"
 	"log/slog"
 	"net/textproto"
+	"slices"
 	"strings"
+	"time"
 
 	"github.com/mjl-/bstore"
 
@@ -21,25 +23,42 @@ func (c *conn) cmdxSearch(isUID bool, tag, cmd string, p *parser) {
 	// Syntax: ../rfc/9051:6918 ../rfc/4466:611 ../rfc/3501:4954
 
 	// We will respond with ESEARCH instead of SEARCH if "RETURN" is present or for IMAP4rev2.
-	var eargs map[string]bool // Options except SAVE. Nil means old-style SEARCH response.
+	var eargs map[string]bool // Options except SAVE, UPDATE and CONTEXT. Nil means old-style SEARCH response.
 	var save bool             // For SAVE option. Kept separately for easier handling of MIN/MAX later.
+	var update bool           // For UPDATE option, the client gets notified of changes to the result. ../rfc/5267
+	var partial *partialRange // For PARTIAL option, only the matches in this window are returned. ../rfc/5267
 
 	// IMAP4rev2 always returns ESEARCH, even with absent RETURN.
 	if c.enabled[capIMAP4rev2] {
 		eargs = map[string]bool{}
 	}
-	// ../rfc/9051:6967
+	// ../rfc/9051:6967 ../rfc/5267
 	if p.take(" RETURN (") {
 		eargs = map[string]bool{}
 
-		for !p.take(")") {
-			if len(eargs) > 0 || save {
+		for i := 0; !p.take(")"); i++ {
+			if i > 0 {
 				p.xspace()
 			}
-			if w, ok := p.takelist("MIN", "MAX", "ALL", "COUNT", "SAVE"); ok {
-				if w == "SAVE" {
+			if w, ok := p.takelist("MIN", "MAX", "ALL", "COUNT", "SAVE", "CONTEXT", "UPDATE", "PARTIAL", "RELEVANCY"); ok {
+				switch w {
+				case "SAVE":
 					save = true
-				} else {
+				case "CONTEXT":
+					// Hint that the client may want an UPDATE or PARTIAL later, nothing to do. ../rfc/5267
+				case "UPDATE":
+					update = true
+				case "PARTIAL":
+					p.xspace()
+					first := p.xnznumber()
+					p.xtake(":")
+					last := p.xnznumber()
+					if first > last {
+						first, last = last, first
+					}
+					partial = &partialRange{first, last}
+					eargs[w] = true
+				default:
 					eargs[w] = true
 				}
 			} else {
@@ -52,68 +71,30 @@ func (c *conn) cmdxSearch(isUID bool, tag, cmd string, p *parser) {
 	if eargs != nil && len(eargs) == 0 && !save {
 		eargs["ALL"] = true
 	}
+	if eargs["ALL"] && eargs["PARTIAL"] {
+		// ../rfc/5267
+		xsyntaxErrorf("cannot combine ALL and PARTIAL return options")
+	}
+	if update && save {
+		// Updates would not be reflected in the saved result.
+		xsyntaxErrorf("cannot combine UPDATE and SAVE return options")
+	}
 
-	// If UTF8=ACCEPT is enabled, we should not accept any charset. We are a bit more
-	// relaxed (reasonable?) and still allow US-ASCII and UTF-8. ../rfc/6855:198
 	if p.take(" CHARSET ") {
-		charset := strings.ToUpper(p.xastring())
-		if charset != "US-ASCII" && charset != "UTF-8" {
-			// ../rfc/3501:2771 ../rfc/9051:3836
-			xusercodeErrorf("BADCHARSET", "only US-ASCII and UTF-8 supported")
-		}
+		xcheckSearchCharset(p.xastring())
 	}
 	p.xspace()
-	sk := &searchKey{
-		searchKeys: []searchKey{*p.xsearchKey()},
-	}
-	for !p.empty() {
-		p.xspace()
-		sk.searchKeys = append(sk.searchKeys, *p.xsearchKey())
-	}
+	sk := p.xsearchProgram()
+
+	// Determined before we rewrite the search key for word searches below.
+	cacheKey, cacheable := sk.cacheKey()
 
 	// Even in case of error, we ensure search result is changed.
 	if save {
 		c.searchResult = []store.UID{}
 	}
 
-	// We gather word and not-word searches from the top-level, turn them
-	// into a WordSearch for a more efficient search.
-	// todo optimize: also gather them out of AND searches.
-	var textWords, textNotWords, bodyWords, bodyNotWords []string
-	n := 0
-	for _, xsk := range sk.searchKeys {
-		switch xsk.op {
-		case "BODY":
-			bodyWords = append(bodyWords, xsk.astring)
-			continue
-		case "TEXT":
-			textWords = append(textWords, xsk.astring)
-			continue
-		case "NOT":
-			switch xsk.searchKey.op {
-			case "BODY":
-				bodyNotWords = append(bodyNotWords, xsk.searchKey.astring)
-				continue
-			case "TEXT":
-				textNotWords = append(textNotWords, xsk.searchKey.astring)
-				continue
-			}
-		}
-		sk.searchKeys[n] = xsk
-		n++
-	}
-	// We may be left with an empty but non-nil sk.searchKeys, which is important for
-	// matching.
-	sk.searchKeys = sk.searchKeys[:n]
-	var bodySearch, textSearch *store.WordSearch
-	if len(bodyWords) > 0 || len(bodyNotWords) > 0 {
-		ws := store.PrepareWordSearch(bodyWords, bodyNotWords)
-		bodySearch = &ws
-	}
-	if len(textWords) > 0 || len(textNotWords) > 0 {
-		ws := store.PrepareWordSearch(textWords, textNotWords)
-		textSearch = &ws
-	}
+	bodySearch, textSearch := searchWordsPrepare(sk)
 
 	// Note: we only hold the account rlock for verifying the mailbox at the start.
 	c.account.RLock()
@@ -133,35 +114,62 @@ func (c *conn) cmdxSearch(isUID bool, tag, cmd string, p *parser) {
 		max = 1
 	}
 
+	// With only MIN and/or MAX, we don't search all messages, and don't use the
+	// cache, also because a saved result must only have the MIN and/or MAX messages.
+	// With UPDATE, we need the full result to send changes to it later.
+	onlyMinMax := len(eargs) > 0 && min+max == len(eargs) && !update
+	if onlyMinMax {
+		cacheable = false
+	}
+	// Relevancy scores are not cached.
+	if eargs["RELEVANCY"] {
+		cacheable = false
+	}
+
 	var expungeIssued bool
 	var maxModSeq store.ModSeq
 
 	var uids []store.UID
+	var relevancy []int // For RELEVANCY return option, for each uid.
 	c.xdbread(func(tx *bstore.Tx) {
 		c.xmailboxID(tx, c.mailboxID) // Validate.
 		runlock()
 		runlock = func() {}
 
+		var lastModSeq store.ModSeq
+		if cacheable {
+			var err error
+			lastModSeq, err = c.account.LastModSeq(tx)
+			xcheckf(err, "get last modseq")
+			if e, ok := c.searchCacheGet(cacheKey, lastModSeq); ok {
+				uids = slices.Clone(e.uids)
+				maxModSeq = e.maxModSeq
+				return
+			}
+		}
 		// Normal forward search when we don't have MAX only.
 		var lastIndex = -1
-		if eargs == nil || max == 0 || len(eargs) != 1 {
+		if eargs == nil || max == 0 || len(eargs) != 1 || update {
 			for i, uid := range c.uids {
 				lastIndex = i
-				if match, modseq := c.searchMatch(tx, msgseq(i+1), uid, *sk, bodySearch, textSearch, &expungeIssued); match {
+				if match, modseq, score := c.searchMatch(tx, msgseq(i+1), uid, *sk, bodySearch, textSearch, &expungeIssued); match {
 					uids = append(uids, uid)
+					if eargs["RELEVANCY"] {
+						relevancy = append(relevancy, score)
+					}
 					if modseq > maxModSeq {
 						maxModSeq = modseq
 					}
-					if min == 1 && min+max == len(eargs) {
+					if min == 1 && onlyMinMax {
 						break
 					}
 				}
 			}
 		}
 		// And reverse search for MAX if we have only MAX or MAX combined with MIN.
-		if max == 1 && (len(eargs) == 1 || min+max == len(eargs)) {
+		if max == 1 && onlyMinMax {
 			for i := len(c.uids) - 1; i > lastIndex; i-- {
-				if match, modseq := c.searchMatch(tx, msgseq(i+1), c.uids[i], *sk, bodySearch, textSearch, &expungeIssued); match {
+				if match, modseq, _ := c.searchMatch(tx, msgseq(i+1), c.uids[i], *sk, bodySearch, textSearch, &expungeIssued); match {
 					uids = append(uids, c.uids[i])
 					if modseq > maxModSeq {
 						maxModSeq = modseq
@@ -170,8 +178,16 @@ func (c *conn) cmdxSearch(isUID bool, tag, cmd string, p *parser) {
 				}
 			}
 		}
+
+		if cacheable && !expungeIssued {
+			c.searchCachePut(searchCacheEntry{cacheKey, lastModSeq, slices.Clone(uids), maxModSeq})
+		}
 	})
 
+	if update {
+		c.searchUpdateAdd(tag, isUID, *sk, bodySearch, textSearch, uids)
+	}
+
 	if eargs == nil {
 		// In IMAP4rev1, an untagged SEARCH response is required. ../rfc/3501:2728
 		if len(uids) == 0 {
@@ -231,8 +247,8 @@ func (c *conn) cmdxSearch(isUID bool, tag, cmd string, p *parser) {
 			// NOTE: we are converting UIDs to msgseq in the uids slice (if needed) while
 			// keeping the "uids" name!
 			if !isUID {
-				// If searchResult is hanging on to the slice, we need to work on a copy.
-				if save {
+				// If searchResult or an update is hanging on to the slice, we need to work on a copy.
+				if save || update {
 					nuids := make([]store.UID, len(uids))
 					copy(nuids, uids)
 					uids = nuids
@@ -255,6 +271,31 @@ func (c *conn) cmdxSearch(isUID bool, tag, cmd string, p *parser) {
 			if eargs["ALL"] && len(uids) > 0 {
 				resp += fmt.Sprintf(" ALL %s", compactUIDSet(uids).String())
 			}
+			if partial != nil {
+				// ../rfc/5267
+				result := "NIL"
+				if int(partial.first) <= len(uids) {
+					last := len(uids)
+					if int(partial.last) < last {
+						last = int(partial.last)
+					}
+					result = compactUIDSet(uids[partial.first-1 : last]).String()
+					if relevancy != nil {
+						relevancy = relevancy[partial.first-1 : last]
+					}
+				} else {
+					relevancy = nil
+				}
+				resp += fmt.Sprintf(" PARTIAL (%d:%d %s)", partial.first, partial.last, result)
+			}
+			// Scores for the returned messages, in the same order. ../rfc/6203
+			if eargs["RELEVANCY"] && len(relevancy) > 0 {
+				l := make([]string, len(relevancy))
+				for i, score := range relevancy {
+					l[i] = fmt.Sprintf("%d", score)
+				}
+				resp += fmt.Sprintf(" RELEVANCY (%s)", strings.Join(l, " "))
+			}
 
 			// Interaction between ESEARCH and CONDSTORE: ../rfc/7162:1211 ../rfc/4731:273
 			// Summary: send the highest modseq of the returned messages.
@@ -273,6 +314,218 @@ func (c *conn) cmdxSearch(isUID bool, tag, cmd string, p *parser) {
 	}
 }
 
+// xcheckSearchCharset checks the charset of a search program is supported.
+func xcheckSearchCharset(charset string) {
+	// If UTF8=ACCEPT is enabled, we should not accept any charset. We are a bit more
+	// relaxed (reasonable?) and still allow US-ASCII and UTF-8. ../rfc/6855:198
+	charset = strings.ToUpper(charset)
+	if charset != "US-ASCII" && charset != "UTF-8" {
+		// ../rfc/3501:2771 ../rfc/9051:3836
+		xusercodeErrorf("BADCHARSET", "only US-ASCII and UTF-8 supported")
+	}
+}
+
+// xsearchProgram parses one or more space-separated search keys until the end of
+// the command.
+func (p *parser) xsearchProgram() *searchKey {
+	sk := &searchKey{
+		searchKeys: []searchKey{*p.xsearchKey()},
+	}
+	for !p.empty() {
+		p.xspace()
+		sk.searchKeys = append(sk.searchKeys, *p.xsearchKey())
+	}
+	return sk
+}
+
+// searchWordsPrepare takes the word and not-word searches out of the top-level of
+// the search key, turning them into a WordSearch for a more efficient search.
+func searchWordsPrepare(sk *searchKey) (bodySearch, textSearch *store.WordSearch) {
+	// todo optimize: also gather them out of AND searches.
+	var textWords, textNotWords, bodyWords, bodyNotWords []string
+	n := 0
+	for _, xsk := range sk.searchKeys {
+		switch xsk.op {
+		case "BODY":
+			bodyWords = append(bodyWords, xsk.astring)
+			continue
+		case "TEXT":
+			textWords = append(textWords, xsk.astring)
+			continue
+		case "NOT":
+			switch xsk.searchKey.op {
+			case "BODY":
+				bodyNotWords = append(bodyNotWords, xsk.searchKey.astring)
+				continue
+			case "TEXT":
+				textNotWords = append(textNotWords, xsk.searchKey.astring)
+				continue
+			}
+		}
+		sk.searchKeys[n] = xsk
+		n++
+	}
+	// We may be left with an empty but non-nil sk.searchKeys, which is important for
+	// matching.
+	sk.searchKeys = sk.searchKeys[:n]
+	if len(bodyWords) > 0 || len(bodyNotWords) > 0 {
+		ws := store.PrepareWordSearch(bodyWords, bodyNotWords)
+		bodySearch = &ws
+	}
+	if len(textWords) > 0 || len(textNotWords) > 0 {
+		ws := store.PrepareWordSearch(textWords, textNotWords)
+		textSearch = &ws
+	}
+	return
+}
+
+// Maximum number of recent search results kept per connection.
+const searchCacheMax = 10
+
+type searchCacheEntry struct {
+	key        string       // From searchKey.cacheKey.
+	lastModSeq store.ModSeq // Of account when search was done.
+	uids       []store.UID  // All matching messages.
+	maxModSeq  store.ModSeq // Highest modseq of matching messages.
+}
+
+// searchCacheGet returns a cached search result for the search key, if any and
+// still valid for the account modseq.
+func (c *conn) searchCacheGet(key string, lastModSeq store.ModSeq) (searchCacheEntry, bool) {
+	for _, e := range c.searchCache {
+		if e.key == key && e.lastModSeq == lastModSeq {
+			metricSearchCache.WithLabelValues("hit").Inc()
+			return e, true
+		}
+	}
+	metricSearchCache.WithLabelValues("miss").Inc()
+	return searchCacheEntry{}, false
+}
+
+// searchCachePut adds a search result to the cache, replacing an older result for
+// the same search key and removing the oldest entry if the cache is full.
+func (c *conn) searchCachePut(ne searchCacheEntry) {
+	c.searchCache = slices.DeleteFunc(c.searchCache, func(e searchCacheEntry) bool {
+		return e.key == ne.key
+	})
+	if len(c.searchCache) >= searchCacheMax {
+		c.searchCache = slices.Delete(c.searchCache, 0, 1)
+	}
+	c.searchCache = append(c.searchCache, ne)
+}
+
+// Maximum number of searches with UPDATE return option kept per connection.
+const searchUpdatesMax = 10
+
+// partialRange is the window of results requested with the PARTIAL return
+// option, 1-based and inclusive.
+type partialRange struct {
+	first, last uint32
+}
+
+// searchUpdate is a search with the UPDATE return option. While the mailbox is
+// selected, the client is notified of messages added to or removed from the
+// result. ../rfc/5267
+type searchUpdate struct {
+	tag        string
+	isUID      bool
+	sk         searchKey
+	bodySearch *store.WordSearch
+	textSearch *store.WordSearch
+	uids       []store.UID // Current result, sorted.
+}
+
+// searchUpdateAdd registers a search for sending updates, replacing an earlier
+// search with the same tag. If too many searches are registered, the client is
+// told no updates will be sent.
+func (c *conn) searchUpdateAdd(tag string, isUID bool, sk searchKey, bodySearch, textSearch *store.WordSearch, uids []store.UID) {
+	c.searchUpdates = slices.DeleteFunc(c.searchUpdates, func(su searchUpdate) bool {
+		return su.tag == tag
+	})
+	if len(c.searchUpdates) >= searchUpdatesMax {
+		// ../rfc/5267
+		c.bwritelinef(`* NO [NOUPDATE "%s"] too many searches with updates`, tag)
+		return
+	}
+	c.searchUpdates = append(c.searchUpdates, searchUpdate{tag, isUID, sk, bodySearch, textSearch, slices.Clone(uids)})
+}
+
+// searchUpdatesRemove removes an expunged message from the results of searches
+// with updates. The client learns about the removal through the EXPUNGE or
+// VANISHED response, so no REMOVETO is sent.
+func (c *conn) searchUpdatesRemove(uid store.UID) {
+	for i, su := range c.searchUpdates {
+		if j, ok := slices.BinarySearch(su.uids, uid); ok {
+			c.searchUpdates[i].uids = slices.Delete(su.uids, j, j+1)
+		}
+	}
+}
+
+// xsearchUpdates evaluates the searches with updates for messages that were added
+// to the session or had their flags changed, and writes untagged ESEARCH responses
+// with ADDTO and REMOVETO for changes to the results. Unsorted search results have
+// no meaningful position, so we always send position 0.
+func (c *conn) xsearchUpdates(uids []store.UID) {
+	if len(c.searchUpdates) == 0 || len(uids) == 0 {
+		return
+	}
+	uids = slices.Clone(uids)
+	slices.Sort(uids)
+	uids = slices.Compact(uids)
+
+	adds := make([][]store.UID, len(c.searchUpdates))
+	removes := make([][]store.UID, len(c.searchUpdates))
+	c.xdbread(func(tx *bstore.Tx) {
+		for _, uid := range uids {
+			seq := c.sequence(uid)
+			if seq <= 0 {
+				continue
+			}
+			for i, su := range c.searchUpdates {
+				var expungeIssued bool
+				match, _, _ := c.searchMatch(tx, seq, uid, su.sk, su.bodySearch, su.textSearch, &expungeIssued)
+				_, have := slices.BinarySearch(su.uids, uid)
+				if match && !have {
+					adds[i] = append(adds[i], uid)
+				} else if !match && have {
+					removes[i] = append(removes[i], uid)
+				}
+			}
+		}
+	})
+
+	for i := range c.searchUpdates {
+		su := &c.searchUpdates[i]
+		write := func(op string, l []store.UID) {
+			if len(l) == 0 {
+				return
+			}
+			nums := slices.Clone(l)
+			if !su.isUID {
+				for j, uid := range nums {
+					nums[j] = store.UID(c.xsequence(uid))
+				}
+			}
+			var uidstr string
+			if su.isUID {
+				uidstr = " UID"
+			}
+			// ../rfc/5267
+			c.bwritelinef(`* ESEARCH (TAG "%s")%s %s (0 %s)`, su.tag, uidstr, op, compactUIDSet(nums).String())
+		}
+		for _, uid := range removes[i] {
+			j, _ := slices.BinarySearch(su.uids, uid)
+			su.uids = slices.Delete(su.uids, j, j+1)
+		}
+		write("REMOVETO", removes[i])
+		for _, uid := range adds[i] {
+			j, _ := slices.BinarySearch(su.uids, uid)
+			su.uids = slices.Insert(su.uids, j, uid)
+		}
+		write("ADDTO", adds[i])
+	}
+}
+
 type search struct {
 	c             *conn
 	tx            *bstore.Tx
@@ -283,9 +536,13 @@ type search struct {
 	p             *message.Part
 	expungeIssued *bool
 	hasModseq     bool
+	fuzzyScores   []int // Relevancy of matching FUZZY search keys.
 }
 
-func (c *conn) searchMatch(tx *bstore.Tx, seq msgseq, uid store.UID, sk searchKey, bodySearch, textSearch *store.WordSearch, expungeIssued *bool) (bool, store.ModSeq) {
+// searchMatch returns whether the message matches the search key, and if so its
+// modseq (if the search key has a modseq) and relevancy score between 1 and 100.
+// Messages matched without FUZZY search keys have relevancy 100.
+func (c *conn) searchMatch(tx *bstore.Tx, seq msgseq, uid store.UID, sk searchKey, bodySearch, textSearch *store.WordSearch, expungeIssued *bool) (bool, store.ModSeq, int) {
 	s := search{c: c, tx: tx, seq: seq, uid: uid, expungeIssued: expungeIssued, hasModseq: sk.hasModseq()}
 	defer func() {
 		if s.mr != nil {
@@ -297,7 +554,7 @@ func (c *conn) searchMatch(tx *bstore.Tx, seq msgseq, uid store.UID, sk searchKe
 	return s.match(sk, bodySearch, textSearch)
 }
 
-func (s *search) match(sk searchKey, bodySearch, textSearch *store.WordSearch) (match bool, modseq store.ModSeq) {
+func (s *search) match(sk searchKey, bodySearch, textSearch *store.WordSearch) (match bool, modseq store.ModSeq, relevancy int) {
 	// Instead of littering all the cases in match0 with calls to get modseq, we do it once
 	// here in case of a match.
 	defer func() {
@@ -307,11 +564,21 @@ func (s *search) match(sk searchKey, bodySearch, textSearch *store.WordSearch) (
 			}
 			modseq = s.m.ModSeq
 		}
+		if match {
+			relevancy = 100
+			if len(s.fuzzyScores) > 0 {
+				var total int
+				for _, score := range s.fuzzyScores {
+					total += score
+				}
+				relevancy = total / len(s.fuzzyScores)
+			}
+		}
 	}()
 
 	match = s.match0(sk)
 	if match && bodySearch != nil {
-		if !s.xensurePart() {
+		if !s.xmatchIndex(bodySearch) || !s.xensurePart() {
 			match = false
 			return
 		}
@@ -320,7 +587,7 @@ func (s *search) match(sk searchKey, bodySearch, textSearch *store.WordSearch) (
 		xcheckf(err, "search words in bodies")
 	}
 	if match && textSearch != nil {
-		if !s.xensurePart() {
+		if !s.xmatchIndex(textSearch) || !s.xensurePart() {
 			match = false
 			return
 		}
@@ -349,6 +616,17 @@ func (s *search) xensureMessage() bool {
 	return true
 }
 
+// xmatchIndex returns whether the message may match the word search according
+// to the text index, i.e. if the message must be searched.
+func (s *search) xmatchIndex(ws *store.WordSearch) bool {
+	if !s.xensureMessage() {
+		return false
+	}
+	match, err := ws.MatchIndex(s.tx, s.m.ID)
+	xcheckf(err, "checking text index")
+	return match
+}
+
 // ensure message, reader and part are loaded. returns whether that was
 // successful.
 func (s *search) xensurePart() bool {
@@ -379,8 +657,11 @@ func (s *search) match0(sk searchKey) bool {
 	// Difference between sk.searchKeys nil and length 0 is important. Because we take
 	// out word/notword searches, the list may be empty but non-nil.
 	if sk.searchKeys != nil {
+		n := len(s.fuzzyScores)
 		for _, ssk := range sk.searchKeys {
 			if !s.match0(ssk) {
+				// Scores of FUZZY keys in a non-matching group don't count.
+				s.fuzzyScores = s.fuzzyScores[:n]
 				return false
 			}
 		}
@@ -419,11 +700,18 @@ func (s *search) match0(sk searchKey) bool {
 		// We do not implement the RECENT flag. All messages are not recent.
 		return false
 	case "NOT":
+		// Scores of FUZZY keys that matched don't count when negated.
+		n := len(s.fuzzyScores)
+		defer func() {
+			s.fuzzyScores = s.fuzzyScores[:n]
+		}()
 		return !s.match0(*sk.searchKey)
 	case "OR":
 		return s.match0(*sk.searchKey) || s.match0(*sk.searchKey2)
 	case "UID":
 		return sk.uidSet.containsUID(s.uid, c.uids, c.searchResult)
+	case "FUZZY":
+		return s.matchFuzzy(*sk.searchKey)
 	}
 
 	// Parsed part.
@@ -507,6 +795,32 @@ func (s *search) match0(sk searchKey) bool {
 			return rdt >= skdt
 		}
 		panic("missing case")
+	case "SAVEDATESUPPORTED":
+		// All mailboxes support save dates. ../rfc/8514
+		return true
+	case "SAVEDBEFORE", "SAVEDON", "SAVEDSINCE":
+		// Messages saved before we kept save dates are matched by their internal date.
+		// ../rfc/8514
+		saved := s.m.Received
+		if s.m.SaveDate != nil {
+			saved = *s.m.SaveDate
+		}
+		skdt := sk.date.Format("2006-01-02")
+		sdt := saved.Format("2006-01-02")
+		switch sk.op {
+		case "SAVEDBEFORE":
+			return sdt < skdt
+		case "SAVEDON":
+			return sdt == skdt
+		case "SAVEDSINCE":
+			return sdt >= skdt
+		}
+		panic("missing case")
+	case "OLDER":
+		// ../rfc/5032:81
+		return time.Since(s.m.Received) >= time.Duration(sk.number)*time.Second
+	case "YOUNGER":
+		return time.Since(s.m.Received) < time.Duration(sk.number)*time.Second
 	case "LARGER":
 		return s.m.Size > sk.number
 	case "SMALLER":
@@ -530,7 +844,11 @@ func (s *search) match0(sk searchKey) bool {
 		// nested.
 		// todo optimize: handle deeper nested word/not-word searches more efficiently.
 		headerToo := sk.op == "TEXT"
-		match, err := store.PrepareWordSearch([]string{sk.astring}, nil).MatchPart(s.c.log, s.p, headerToo)
+		ws := store.PrepareWordSearch([]string{sk.astring}, nil)
+		if !s.xmatchIndex(&ws) {
+			return false
+		}
+		match, err := ws.MatchPart(s.c.log, s.p, headerToo)
 		xcheckf(err, "word search")
 		return match
 	case "CC":
@@ -574,3 +892,81 @@ func (s *search) match0(sk searchKey) bool {
 	}
 	panic(serverError{fmt.Errorf("missing case for search key op %q", sk.op)})
 }
+
+// matchFuzzy evaluates the search key of a FUZZY search key, matching text
+// approximately, and records the relevancy score. Search keys without text have
+// no approximate form and are evaluated as usual. ../rfc/6203
+func (s *search) matchFuzzy(sk searchKey) bool {
+	// Text in headers of the envelope, decoded.
+	envelopeText := func(env *message.Envelope) []string {
+		var addrs []message.Address
+		switch sk.op {
+		case "SUBJECT":
+			return []string{env.Subject}
+		case "BCC":
+			addrs = env.BCC
+		case "CC":
+			addrs = env.CC
+		case "FROM":
+			addrs = env.From
+		case "TO":
+			addrs = env.To
+		}
+		var l []string
+		for _, a := range addrs {
+			l = append(l, a.Name+" "+a.User+"@"+a.Host)
+		}
+		return l
+	}
+
+	var score int
+	switch sk.op {
+	case "BODY", "TEXT":
+		if !s.xensureMessage() {
+			return false
+		}
+		fs := store.PrepareFuzzySearch(sk.astring)
+		var indexed bool
+		var err error
+		score, indexed, err = fs.MatchIndex(s.tx, s.m.ID)
+		xcheckf(err, "fuzzy search in text index")
+		if !indexed {
+			// Messages without text index are searched regularly.
+			if !s.match0(sk) {
+				return false
+			}
+			score = 100
+		}
+	case "BCC", "CC", "FROM", "SUBJECT", "TO":
+		if !s.xensurePart() || s.p.Envelope == nil {
+			return false
+		}
+		fs := store.PrepareFuzzySearch(sk.astring)
+		for _, text := range envelopeText(s.p.Envelope) {
+			score = max(score, fs.MatchText(text))
+		}
+	case "HEADER":
+		if !s.xensurePart() {
+			return false
+		}
+		h, err := s.p.Header()
+		if err != nil {
+			s.c.log.Errorx("parsing header for fuzzy search", err, slog.Any("uid", s.uid))
+			return false
+		}
+		fs := store.PrepareFuzzySearch(sk.astring)
+		for _, v := range h.Values(textproto.CanonicalMIMEHeaderKey(sk.headerField)) {
+			score = max(score, fs.MatchText(v))
+		}
+	default:
+		if !s.match0(sk) {
+			return false
+		}
+		score = 100
+	}
+	if score == 0 {
+		return false
+	}
+	s.fuzzyScores = append(s.fuzzyScores, score)
+	return true
+}
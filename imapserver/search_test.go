@@ -233,6 +233,15 @@ func TestSearch(t *testing.T) {
 	tc.transactf("ok", `search undraft`)
 	tc.xsearch(1, 2)
 
+	// All messages have a received time in the past.
+	tc.transactf("ok", `search older 1`)
+	tc.xsearch(1, 2, 3)
+	tc.transactf("ok", `search younger 1`)
+	tc.xsearch()
+	tc.transactf("ok", `search or younger 3600 uid 6`)
+	tc.xsearch(2)
+	tc.transactf("bad", `search older 0`) // Must be non-zero.
+
 	tc.transactf("no", `search charset unknown text "mox"`)
 	tc.transactf("ok", `search charset us-ascii text "mox"`)
 	tc.xsearch(2, 3)
@@ -355,7 +364,7 @@ func TestSearch(t *testing.T) {
 		tcheck(t, err, "read line")
 		if expok && !strings.HasPrefix(line, "+") {
 			tcheck(t, fmt.Errorf("no continuation after writing size: %s", line), "sending literal")
-		} else if !expok && !strings.HasPrefix(line, "x0 BAD [TOOBIG]") {
+		} else if !expok && !strings.HasPrefix(line, "x0 NO [TOOBIG]") {
 			tcheck(t, fmt.Errorf("got line %s", line), "expected TOOBIG error")
 		}
 		if !expok {
@@ -419,3 +428,217 @@ func esearchall0(ss string) imapclient.NumSet {
 	}
 	return seqset
 }
+
+// Test that repeated searches that may be answered from the cache still reflect
+// changes to messages.
+func TestSearchCache(t *testing.T) {
+	tc := start(t)
+	defer tc.close()
+
+	tc2 := startNoSwitchboard(t)
+	defer tc2.close()
+
+	tc.client.Login("mjl@mox.example", password0)
+	tc.client.Select("inbox")
+	tc2.client.Login("mjl@mox.example", password0)
+	tc2.client.Select("inbox")
+
+	tc.client.Append("inbox", nil, nil, []byte(exampleMsg))
+	tc.client.Append("inbox", nil, nil, []byte(exampleMsg))
+
+	tc.transactf("ok", "search seen")
+	tc.xsearch()
+	tc.transactf("ok", "search seen")
+	tc.xsearch()
+
+	// Change in this session.
+	tc.client.StoreFlagsAdd("1", true, `\Seen`)
+	tc.transactf("ok", "search seen")
+	tc.xsearch(1)
+	tc.transactf("ok", "uid search seen")
+	tc.xsearch(1)
+
+	// Change in other session.
+	tc2.transactf("ok", "noop")
+	tc2.client.StoreFlagsAdd("2", true, `\Seen`)
+	tc.transactf("ok", "noop")
+	tc.transactf("ok", "search seen")
+	tc.xsearch(1, 2)
+
+	// New message in session.
+	tc2.client.Append("inbox", []string{`\Seen`}, nil, []byte(exampleMsg))
+	tc.transactf("ok", "noop")
+	tc.transactf("ok", "search seen")
+	tc.xsearch(1, 2, 3)
+
+	// Removed message.
+	tc.client.StoreFlagsAdd("1", true, `\Deleted`)
+	tc.client.Expunge()
+	tc.transactf("ok", "search seen")
+	tc.xsearch(1, 2)
+}
+
+// Test the PARTIAL and UPDATE return options of CONTEXT=SEARCH.
+func TestSearchContext(t *testing.T) {
+	tc := start(t)
+	defer tc.close()
+
+	tc2 := startNoSwitchboard(t)
+	defer tc2.close()
+
+	tc.client.Login("mjl@mox.example", password0)
+	tc.client.Select("inbox")
+	tc2.client.Login("mjl@mox.example", password0)
+	tc2.client.Select("inbox")
+
+	for i := 0; i < 5; i++ {
+		tc.client.Append("inbox", nil, nil, []byte(exampleMsg))
+	}
+	tc.client.StoreFlagsAdd("1,3", true, `\Seen`)
+
+	// Window of results.
+	tc.transactf("ok", "search return (partial 1:2) all")
+	tc.xesearch(imapclient.UntaggedEsearch{Partial: &imapclient.EsearchPartial{First: 1, Last: 2, Result: esearchall0("1:2")}})
+	count := uint32(5)
+	tc.transactf("ok", "uid search return (count partial 10:4) all")
+	tc.xesearch(imapclient.UntaggedEsearch{UID: true, Count: &count, Partial: &imapclient.EsearchPartial{First: 4, Last: 10, Result: esearchall0("4:5")}})
+	tc.transactf("ok", "search return (partial 6:10) all")
+	tc.xesearch(imapclient.UntaggedEsearch{Partial: &imapclient.EsearchPartial{First: 6, Last: 10}})
+	tc.transactf("bad", "search return (all partial 1:2) all") // Cannot combine.
+	tc.transactf("bad", "search return (partial 0:2) all")     // Must be non-zero.
+	tc.transactf("bad", "search return (update save) all")     // Cannot combine.
+
+	// Context is just a hint.
+	tc.transactf("ok", "search return (context count) seen")
+	count = 2
+	tc.xesearch(imapclient.UntaggedEsearch{Count: &count})
+
+	tc.transactf("ok", "search return (update) seen")
+	updateTag := tc.client.LastTag
+	tc.xesearch(imapclient.UntaggedEsearch{All: esearchall0("1,3")})
+
+	xupdate := func(addTo, removeTo string) {
+		t.Helper()
+		exp := imapclient.UntaggedEsearch{Correlator: updateTag}
+		if addTo != "" {
+			exp.AddTo = []imapclient.EsearchContextUpdate{{Position: 0, Set: esearchall0(addTo)}}
+		}
+		if removeTo != "" {
+			exp.RemoveTo = []imapclient.EsearchContextUpdate{{Position: 0, Set: esearchall0(removeTo)}}
+		}
+		tc.xuntaggedOpt(false, exp)
+	}
+
+	// Change in this session.
+	tc.transactf("ok", `store 2 +flags \Seen`)
+	xupdate("2", "")
+
+	// Change in other session.
+	tc2.transactf("ok", "noop")
+	tc2.client.StoreFlagsClear("1", true, `\Seen`)
+	tc.transactf("ok", "noop")
+	xupdate("", "1")
+
+	// New message from other session.
+	tc2.client.Append("inbox", []string{`\Seen`}, nil, []byte(exampleMsg))
+	tc.transactf("ok", "noop")
+	xupdate("6", "")
+
+	// Expunged messages are only announced with EXPUNGE.
+	tc.client.StoreFlagsAdd("3", true, `\Deleted`)
+	tc.transactf("ok", "expunge")
+	tc.xuntagged(imapclient.UntaggedExpunge(3))
+
+	// Sequence numbers reflect expunge.
+	tc.transactf("ok", `store 5 -flags \Seen`)
+	xupdate("", "5")
+
+	tc.transactf("ok", `cancelupdate "%s"`, updateTag)
+	tc.transactf("ok", `store 5 +flags \Seen`)
+	tc.xuntagged(imapclient.UntaggedFetch{Seq: 5, Attrs: []imapclient.FetchAttr{imapclient.FetchUID(6), imapclient.FetchFlags{`\Seen`}}})
+	tc.transactf("bad", `cancelupdate "%s"`, updateTag)
+
+	// Updates for uid search.
+	tc.transactf("ok", "uid search return (update count) unseen")
+	updateTag = tc.client.LastTag
+	count = 3
+	tc.xesearch(imapclient.UntaggedEsearch{UID: true, Count: &count})
+	tc.transactf("ok", `store 2 -flags \Seen`)
+	tc.xuntaggedOpt(false, imapclient.UntaggedEsearch{Correlator: updateTag, UID: true, AddTo: []imapclient.EsearchContextUpdate{{Position: 0, Set: esearchall0("2")}}})
+
+	// Limited number of searches with updates.
+	for i := 1; i < searchUpdatesMax; i++ {
+		tc.transactf("ok", "search return (update) all")
+	}
+	tc.transactf("ok", "search return (update) all")
+	tc.xuntaggedOpt(false, imapclient.UntaggedResult{Status: imapclient.NO, RespText: imapclient.RespText{Code: "NOUPDATE", CodeArg: imapclient.CodeOther{Code: "NOUPDATE", Args: []string{fmt.Sprintf(`"%s"`, tc.client.LastTag)}}, More: "too many searches with updates"}})
+
+	// Updates stop when another mailbox is selected.
+	tc.client.Select("inbox")
+	tc.transactf("bad", `cancelupdate "%s"`, updateTag)
+}
+
+func TestSearchFuzzy(t *testing.T) {
+	tc := start(t)
+	defer tc.close()
+	tc.client.Login("mjl@mox.example", password0)
+	tc.client.Select("inbox")
+
+	tc.client.Append("inbox", nil, nil, []byte(exampleMsg))
+	tc.client.Append("inbox", nil, nil, []byte(searchMsg))
+	tc.client.Append("inbox", []string{`\Answered`}, nil, []byte(searchMsg))
+
+	relevancy := func(ss string, scores ...uint8) imapclient.UntaggedEsearch {
+		return imapclient.UntaggedEsearch{All: esearchall0(ss), Relevancy: scores}
+	}
+
+	// Typo in word.
+	tc.transactf("ok", `search fuzzy text "tomorow"`)
+	tc.xsearch(1)
+	tc.transactf("ok", `search return (all relevancy) fuzzy text "tomorow"`)
+	tc.xesearch(relevancy("1", 80))
+	tc.transactf("ok", `search return (all relevancy) fuzzy text "blurdyblop"`)
+	tc.xesearch(relevancy("1", 80))
+	tc.transactf("ok", `search return (count relevancy) fuzzy text "tomorow"`)
+	count := uint32(1)
+	tc.xesearch(imapclient.UntaggedEsearch{Count: &count, Relevancy: []uint8{80}})
+
+	// Exact matches.
+	tc.transactf("ok", `search return (all relevancy) fuzzy text "meeting"`)
+	tc.xesearch(relevancy("1", 100))
+	tc.transactf("ok", `search return (all relevancy) fuzzy body "plian text"`)
+	tc.xesearch(relevancy("1:3", 90, 90, 90))
+
+	// Short words must match exactly or as substring.
+	tc.transactf("ok", `search fuzzy text "jeo"`)
+	tc.xsearch()
+	tc.transactf("ok", `search fuzzy text "oe"`)
+	tc.xsearch(1)
+
+	// All words must match.
+	tc.transactf("ok", `search fuzzy text "tomorow bogus"`)
+	tc.xsearch()
+
+	tc.transactf("ok", `search return (all relevancy) or fuzzy subject "meting" fuzzy from "mjl"`)
+	tc.xesearch(relevancy("1:3", 80, 100, 100))
+	tc.transactf("ok", `search return (all relevancy) fuzzy header "Reply-To" "norepyl"`)
+	tc.xesearch(relevancy("2:3", 80, 80))
+	tc.transactf("ok", `search not fuzzy text "tomorow"`)
+	tc.xsearch(2, 3)
+
+	// Search keys without text match as usual.
+	tc.transactf("ok", `search return (all relevancy) fuzzy answered`)
+	tc.xesearch(relevancy("3", 100))
+	tc.transactf("ok", `search return (all relevancy) subject "mox"`)
+	tc.xesearch(relevancy("2:3", 100, 100))
+
+	tc.transactf("ok", `search return (partial 2:3 relevancy) or fuzzy subject "meting" fuzzy from "mjl"`)
+	tc.xesearch(imapclient.UntaggedEsearch{Partial: &imapclient.EsearchPartial{First: 2, Last: 3, Result: esearchall0("2:3")}, Relevancy: []uint8{100, 100}})
+
+	tc.transactf("ok", `sort (relevancy) utf-8 or fuzzy subject "meting" fuzzy from "mjl"`)
+	tc.xuntagged(imapclient.UntaggedSort{Nums: []uint32{2, 3, 1}})
+	tc.transactf("ok", `sort (reverse relevancy) utf-8 or fuzzy subject "meting" fuzzy from "mjl"`)
+	tc.xuntagged(imapclient.UntaggedSort{Nums: []uint32{1, 2, 3}})
+
+	tc.transactf("bad", `search fuzzy`)
+}
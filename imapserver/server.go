@@ -28,7 +28,7 @@ non-ASCII UTF-8. Until that's enabled, we do use UTF-7 for mailbox names. See
 - todo: do not return binary data for a fetch body. at least not for imap4rev1. we should be encoding it as base64?
 - todo: on expunge we currently remove the message even if other sessions still have a reference to the uid. if they try to query the uid, they'll get an error. we could be nicer and only actually remove the message when the last reference has gone. we could add a new flag to store.Message marking the message as expunged, not give new session access to such messages, and make store remove them at startup, and clean them when the last session referencing the session goes. however, it will get much more complicated. renaming messages would need special handling. and should we do the same for removed mailboxes?
 - todo: try to recover from syntax errors when the last command line ends with a }, i.e. a literal. we currently abort the entire connection. we may want to read some amount of literal data and continue with a next command.
-- todo future: more extensions: OBJECTID, MULTISEARCH, REPLACE, NOTIFY, CATENATE, MULTIAPPEND, SORT, THREAD, CREATE-SPECIAL-USE.
+- todo future: more extensions: OBJECTID, MULTISEARCH, REPLACE, NOTIFY, CREATE-SPECIAL-USE.
 */
 
 import (
@@ -74,6 +74,8 @@ import (
 	"github.com/mjl-/mox/mox-"
 	"github.com/mjl-/mox/moxio"
 	"github.com/mjl-/mox/moxvar"
+	"github.com/mjl-/mox/oauthbearer"
+	"github.com/mjl-/mox/proxyproto"
 	"github.com/mjl-/mox/ratelimit"
 	"github.com/mjl-/mox/scram"
 	"github.com/mjl-/mox/store"
@@ -100,6 +102,24 @@ var (
 			"result", // ok, panic, ioerror, badsyntax, servererror, usererror, error
 		},
 	)
+	metricIMAPConnectionsState = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "mox_imap_connections_state",
+			Help: "Open IMAP connections by protocol state.",
+		},
+		[]string{
+			"state", // notauthenticated, authenticated, selected
+		},
+	)
+	metricSearchCache = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "mox_imap_search_cache_total",
+			Help: "Lookups of search results in the per-connection cache for repeated searches.",
+		},
+		[]string{
+			"result", // hit, miss
+		},
+	)
 )
 
 var limiterConnectionrate, limiterConnections *ratelimit.Limiter
@@ -135,7 +155,7 @@ var authFailDelay = time.Second  // After authentication failure.
 
 // Capabilities (extensions) the server supports. Connections will add a few more, e.g. STARTTLS, LOGINDISABLED, AUTH=PLAIN.
 // ENABLE: ../rfc/5161
-// LITERAL+: ../rfc/7888
+// LITERAL+ or LITERAL- (if configured): ../rfc/7888
 // IDLE: ../rfc/2177
 // SASL-IR: ../rfc/4959
 // BINARY: ../rfc/3516
@@ -153,18 +173,27 @@ var authFailDelay = time.Second  // After authentication failure.
 // AUTH=SCRAM-SHA-256-PLUS and AUTH=SCRAM-SHA-256: ../rfc/7677 ../rfc/5802
 // AUTH=SCRAM-SHA-1-PLUS and AUTH=SCRAM-SHA-1: ../rfc/5802
 // AUTH=CRAM-MD5: ../rfc/2195
-// APPENDLIMIT, we support the max possible size, 1<<63 - 1: ../rfc/7889:129
+// AUTH=OAUTHBEARER and AUTH=XOAUTH2, if configured: ../rfc/7628
+// APPENDLIMIT, configurable per listener and account, by default the max possible size, 1<<63 - 1: ../rfc/7889:129
 // CONDSTORE: ../rfc/7162:411
 // QRESYNC: ../rfc/7162:1323
 // STATUS=SIZE: ../rfc/8438 ../rfc/9051:8024
 // QUOTA QUOTA=RES-STORAGE: ../rfc/9208:111
 // METADATA: ../rfc/5464
+// WITHIN: ../rfc/5032
+// CONTEXT=SEARCH: ../rfc/5267
+// SORT, THREAD=ORDEREDSUBJECT, THREAD=REFERENCES: ../rfc/5256
+// SEARCH=FUZZY: ../rfc/6203
+// MULTIAPPEND: ../rfc/3502
+// CATENATE: ../rfc/4469
+// SAVEDATE: ../rfc/8514
+// UNAUTHENTICATE: ../rfc/8437
 //
 // We always announce support for SCRAM PLUS-variants, also on connections without
 // TLS. The client should not be selecting PLUS variants on non-TLS connections,
 // instead opting to do the bare SCRAM variant without indicating the server claims
 // to support the PLUS variant (skipping the server downgrade detection check).
-const serverCapabilities = "IMAP4rev2 IMAP4rev1 ENABLE LITERAL+ IDLE SASL-IR BINARY UNSELECT UIDPLUS ESEARCH SEARCHRES MOVE UTF8=ACCEPT LIST-EXTENDED SPECIAL-USE LIST-STATUS AUTH=SCRAM-SHA-256-PLUS AUTH=SCRAM-SHA-256 AUTH=SCRAM-SHA-1-PLUS AUTH=SCRAM-SHA-1 AUTH=CRAM-MD5 ID APPENDLIMIT=9223372036854775807 CONDSTORE QRESYNC STATUS=SIZE QUOTA QUOTA=RES-STORAGE METADATA"
+const serverCapabilities = "IMAP4rev2 IMAP4rev1 ENABLE IDLE SASL-IR BINARY UNSELECT UIDPLUS ESEARCH SEARCHRES MOVE UTF8=ACCEPT LIST-EXTENDED SPECIAL-USE LIST-STATUS AUTH=SCRAM-SHA-256-PLUS AUTH=SCRAM-SHA-256 AUTH=SCRAM-SHA-1-PLUS AUTH=SCRAM-SHA-1 AUTH=CRAM-MD5 ID CONDSTORE QRESYNC STATUS=SIZE QUOTA QUOTA=RES-STORAGE METADATA WITHIN CONTEXT=SEARCH SORT THREAD=ORDEREDSUBJECT THREAD=REFERENCES SEARCH=FUZZY MULTIAPPEND CATENATE SAVEDATE UNAUTHENTICATE"
 
 type conn struct {
 	cid               int64
@@ -178,15 +207,19 @@ type conn struct {
 	bw                *bufio.Writer      // To remote, with TLS added in case of TLS.
 	tr                *moxio.TraceReader // Kept to change trace level when reading/writing cmd/auth/data.
 	tw                *moxio.TraceWriter
-	slow              bool        // If set, reads are done with a 1 second sleep, and writes are done 1 byte at a time, to keep spammers busy.
-	lastlog           time.Time   // For printing time since previous log line.
-	baseTLSConfig     *tls.Config // Base TLS config to use for handshake.
+	slow              bool           // If set, reads are done with a 1 second sleep, and writes are done 1 byte at a time, to keep spammers busy.
+	lastlog           time.Time      // For printing time since previous log line.
+	baseTLSConfig     *tls.Config    // Base TLS config to use for handshake.
+	clientAuthCAs     *x509.CertPool // For verifying client certificates matched by subject. Nil if none.
 	remoteIP          net.IP
 	noRequireSTARTTLS bool
 	cmd               string // Currently executing, for deciding to applyChanges and logging.
 	cmdMetric         string // Currently executing, for metrics.
 	cmdStart          time.Time
-	ncmds             int // Number of commands processed. Used to abort connection when first incoming command is unknown/invalid.
+	start             time.Time // Of connection, for the maximum lifetime.
+	ncmds             int       // Number of commands processed. Used to abort connection when first incoming command is unknown/invalid.
+	limits            limits
+	readOnlyMode      bool // If set, the listener only allows reading, e.g. for an instance serving a replica during maintenance.
 	log               mlog.Log
 	enabled           map[capability]bool // All upper-case.
 
@@ -198,11 +231,28 @@ type conn struct {
 	// ../rfc/5182:13 ../rfc/9051:4040
 	searchResult []store.UID
 
+	// Results of recent searches in the selected mailbox, for quickly answering
+	// repeated identical searches, a common pattern for clients. Cleared when the
+	// messages in the session change or another mailbox is selected. Entries are only
+	// used when the account has not been modified since.
+	searchCache []searchCacheEntry
+
+	// Searches with the UPDATE return option in the selected mailbox, for which we
+	// send changes to the results. Cleared by CANCELUPDATE and when another mailbox
+	// is selected.
+	searchUpdates []searchUpdate
+
 	// Set during authentication, typically picked up by the ID command that
 	// immediately follows, or will be flushed after any other command after
 	// authentication instead.
 	loginAttempt *store.LoginAttempt
 
+	// Parameters of the last ID command, for evaluating IMAP client rules at login if
+	// the ID command was sent before authenticating, and for the client inventory.
+	clientID       map[string]string
+	clientIDValues string // For LoginAttempt.UserAgent.
+	clientRecorded bool   // Whether client was added to inventory for the current login.
+
 	// Only set when connection has been authenticated. These can be set even when
 	// c.state is stateNotAuthenticated, for TLS client certificate authentication. In
 	// that case, credentials aren't used until the authentication command with the
@@ -244,6 +294,26 @@ const (
 	stateSelected
 )
 
+func (s state) String() string {
+	switch s {
+	case stateNotAuthenticated:
+		return "notauthenticated"
+	case stateAuthenticated:
+		return "authenticated"
+	case stateSelected:
+		return "selected"
+	}
+	return fmt.Sprintf("state%d", s)
+}
+
+// setState changes the protocol state of the connection, keeping the gauge of
+// connections by state up to date.
+func (c *conn) setState(s state) {
+	metricIMAPConnectionsState.WithLabelValues(c.state.String()).Dec()
+	c.state = s
+	metricIMAPConnectionsState.WithLabelValues(c.state.String()).Inc()
+}
+
 func stateCommands(cmds ...string) map[string]struct{} {
 	r := map[string]struct{}{}
 	for _, cmd := range cmds {
@@ -255,8 +325,11 @@ func stateCommands(cmds ...string) map[string]struct{} {
 var (
 	commandsStateAny              = stateCommands("capability", "noop", "logout", "id")
 	commandsStateNotAuthenticated = stateCommands("starttls", "authenticate", "login")
-	commandsStateAuthenticated    = stateCommands("enable", "select", "examine", "create", "delete", "rename", "subscribe", "unsubscribe", "list", "namespace", "status", "append", "idle", "lsub", "getquotaroot", "getquota", "getmetadata", "setmetadata")
-	commandsStateSelected         = stateCommands("close", "unselect", "expunge", "search", "fetch", "store", "copy", "move", "uid expunge", "uid search", "uid fetch", "uid store", "uid copy", "uid move")
+	commandsStateAuthenticated    = stateCommands("enable", "select", "examine", "create", "delete", "rename", "subscribe", "unsubscribe", "list", "namespace", "status", "append", "idle", "lsub", "getquotaroot", "getquota", "getmetadata", "setmetadata", "unauthenticate")
+	commandsStateSelected         = stateCommands("close", "unselect", "expunge", "search", "fetch", "store", "copy", "move", "uid expunge", "uid search", "uid fetch", "uid store", "uid copy", "uid move", "cancelupdate", "sort", "uid sort", "thread", "uid thread")
+
+	// Commands that change the account, rejected on listeners in read-only mode.
+	commandsModify = stateCommands("create", "delete", "rename", "subscribe", "unsubscribe", "append", "setmetadata", "expunge", "uid expunge", "store", "uid store", "copy", "uid copy", "move", "uid move")
 )
 
 var commands = map[string]func(c *conn, tag, cmd string, p *parser){
@@ -272,41 +345,47 @@ var commands = map[string]func(c *conn, tag, cmd string, p *parser){
 	"login":        (*conn).cmdLogin,
 
 	// Authenticated and selected.
-	"enable":       (*conn).cmdEnable,
-	"select":       (*conn).cmdSelect,
-	"examine":      (*conn).cmdExamine,
-	"create":       (*conn).cmdCreate,
-	"delete":       (*conn).cmdDelete,
-	"rename":       (*conn).cmdRename,
-	"subscribe":    (*conn).cmdSubscribe,
-	"unsubscribe":  (*conn).cmdUnsubscribe,
-	"list":         (*conn).cmdList,
-	"lsub":         (*conn).cmdLsub,
-	"namespace":    (*conn).cmdNamespace,
-	"status":       (*conn).cmdStatus,
-	"append":       (*conn).cmdAppend,
-	"idle":         (*conn).cmdIdle,
-	"getquotaroot": (*conn).cmdGetquotaroot,
-	"getquota":     (*conn).cmdGetquota,
-	"getmetadata":  (*conn).cmdGetmetadata,
-	"setmetadata":  (*conn).cmdSetmetadata,
+	"enable":         (*conn).cmdEnable,
+	"select":         (*conn).cmdSelect,
+	"examine":        (*conn).cmdExamine,
+	"create":         (*conn).cmdCreate,
+	"delete":         (*conn).cmdDelete,
+	"rename":         (*conn).cmdRename,
+	"subscribe":      (*conn).cmdSubscribe,
+	"unsubscribe":    (*conn).cmdUnsubscribe,
+	"list":           (*conn).cmdList,
+	"lsub":           (*conn).cmdLsub,
+	"namespace":      (*conn).cmdNamespace,
+	"status":         (*conn).cmdStatus,
+	"append":         (*conn).cmdAppend,
+	"idle":           (*conn).cmdIdle,
+	"getquotaroot":   (*conn).cmdGetquotaroot,
+	"getquota":       (*conn).cmdGetquota,
+	"getmetadata":    (*conn).cmdGetmetadata,
+	"setmetadata":    (*conn).cmdSetmetadata,
+	"unauthenticate": (*conn).cmdUnauthenticate,
 
 	// Selected.
-	"check":       (*conn).cmdCheck,
-	"close":       (*conn).cmdClose,
-	"unselect":    (*conn).cmdUnselect,
-	"expunge":     (*conn).cmdExpunge,
-	"uid expunge": (*conn).cmdUIDExpunge,
-	"search":      (*conn).cmdSearch,
-	"uid search":  (*conn).cmdUIDSearch,
-	"fetch":       (*conn).cmdFetch,
-	"uid fetch":   (*conn).cmdUIDFetch,
-	"store":       (*conn).cmdStore,
-	"uid store":   (*conn).cmdUIDStore,
-	"copy":        (*conn).cmdCopy,
-	"uid copy":    (*conn).cmdUIDCopy,
-	"move":        (*conn).cmdMove,
-	"uid move":    (*conn).cmdUIDMove,
+	"check":        (*conn).cmdCheck,
+	"close":        (*conn).cmdClose,
+	"unselect":     (*conn).cmdUnselect,
+	"expunge":      (*conn).cmdExpunge,
+	"uid expunge":  (*conn).cmdUIDExpunge,
+	"search":       (*conn).cmdSearch,
+	"uid search":   (*conn).cmdUIDSearch,
+	"cancelupdate": (*conn).cmdCancelupdate,
+	"sort":         (*conn).cmdSort,
+	"uid sort":     (*conn).cmdUIDSort,
+	"thread":       (*conn).cmdThread,
+	"uid thread":   (*conn).cmdUIDThread,
+	"fetch":        (*conn).cmdFetch,
+	"uid fetch":    (*conn).cmdUIDFetch,
+	"store":        (*conn).cmdStore,
+	"uid store":    (*conn).cmdUIDStore,
+	"copy":         (*conn).cmdCopy,
+	"uid copy":     (*conn).cmdUIDCopy,
+	"move":         (*conn).cmdMove,
+	"uid move":     (*conn).cmdUIDMove,
 }
 
 var errIO = errors.New("io error")             // For read/write errors and errors that should close the connection.
@@ -372,6 +451,9 @@ func listen1(protocol, listenerName, ip string, port int, tlsConfig *tls.Config,
 	if err != nil {
 		log.Fatalx("imap: listen for imap", err, slog.String("protocol", protocol), slog.String("listener", listenerName))
 	}
+	if pp := mox.Conf.Static.Listeners[listenerName].ProxyProtocol; pp != nil {
+		ln = &proxyproto.Listener{Listener: ln, Networks: pp.ParsedNetworks, Timeout: 30 * time.Second}
+	}
 
 	// Each listener gets its own copy of the config, so session keys between different
 	// ports on same listener aren't shared. We rotate session keys explicitly in this
@@ -385,7 +467,9 @@ func listen1(protocol, listenerName, ip string, port int, tlsConfig *tls.Config,
 	serve := func() {
 		for {
 			conn, err := ln.Accept()
-			if err != nil {
+			if err != nil && errors.Is(err, net.ErrClosed) {
+				return
+			} else if err != nil {
 				log.Infox("imap: accept", err, slog.String("protocol", protocol), slog.String("listener", listenerName))
 				continue
 			}
@@ -447,10 +531,12 @@ func (c *conn) xdbread(fn func(tx *bstore.Tx)) {
 // Does not remove messages marked for deletion.
 func (c *conn) unselect() {
 	if c.state == stateSelected {
-		c.state = stateAuthenticated
+		c.setState(stateAuthenticated)
 	}
 	c.mailboxID = 0
 	c.uids = nil
+	c.searchCache = nil
+	c.searchUpdates = nil
 }
 
 func (c *conn) setSlow(on bool) {
@@ -501,7 +587,76 @@ func (c *conn) xtrace(level slog.Level) func() {
 
 // Cache of line buffers for reading commands.
 // QRESYNC recommends 8k max line lengths. ../rfc/7162:2159
-var bufpool = moxio.NewBufpool(8, 16*1024)
+// Bufpools for reading command lines, keyed by maximum line length, which can be
+// configured per listener.
+var bufpools = struct {
+	sync.Mutex
+	m map[int]*moxio.Bufpool
+}{m: map[int]*moxio.Bufpool{}}
+
+// Maximum size of non-synchronizing literals with LITERAL-. ../rfc/7888:172
+const literalMinusMax = 4096
+
+// limits for commands on a connection, from the IMAPLimits of the listener, with
+// defaults applied.
+type limits struct {
+	literalSize        int64 // For a single literal, except for APPEND.
+	commandLiteralSize int64 // For all literals in a command, except for APPEND.
+	commandLiterals    int
+	appendSize         int64 // Zero means no limit.
+	literalMinus       bool
+	bufpool            *moxio.Bufpool
+	idleTimeout        time.Duration // For authenticated connections.
+	maxLifetime        time.Duration // Zero means no limit.
+	maxConnections     int           // For the listener, zero means no limit.
+	maxConnectionsIP   int           // For a remote IP, zero means no limit.
+	maxConnectionsAcc  int           // For an account, zero means no limit. Can be overridden by account config.
+}
+
+func listenerLimits(listenerName string) limits {
+	var il config.IMAPLimits
+	if l, ok := mox.Conf.Static.Listeners[listenerName]; ok {
+		il = l.IMAPLimits
+	}
+
+	lim := limits{
+		literalSize:       100 * 1024,
+		commandLiterals:   1000,
+		appendSize:        il.MaxAppendSize,
+		literalMinus:      il.LiteralMinus,
+		idleTimeout:       30 * time.Minute,
+		maxLifetime:       il.MaxLifetime,
+		maxConnections:    il.MaxConnections,
+		maxConnectionsIP:  il.MaxConnectionsPerIP,
+		maxConnectionsAcc: il.MaxConnectionsPerAccount,
+	}
+	if il.IdleTimeout > 0 {
+		lim.idleTimeout = il.IdleTimeout
+	}
+	if il.MaxLiteralSize > 0 {
+		lim.literalSize = il.MaxLiteralSize
+	}
+	lim.commandLiteralSize = 10 * lim.literalSize
+	if il.MaxCommandLiteralSize > 0 {
+		lim.commandLiteralSize = il.MaxCommandLiteralSize
+	}
+	if il.MaxCommandLiterals > 0 {
+		lim.commandLiterals = il.MaxCommandLiterals
+	}
+
+	lineMax := 16 * 1024
+	if il.MaxLineLength > 0 {
+		lineMax = il.MaxLineLength
+	}
+	bufpools.Lock()
+	defer bufpools.Unlock()
+	lim.bufpool = bufpools.m[lineMax]
+	if lim.bufpool == nil {
+		lim.bufpool = moxio.NewBufpool(8, lineMax)
+		bufpools.m[lineMax] = lim.bufpool
+	}
+	return lim
+}
 
 // read line from connection, not going through line channel.
 func (c *conn) readline0() (string, error) {
@@ -509,18 +664,23 @@ func (c *conn) readline0() (string, error) {
 		mox.Sleep(mox.Context, badClientDelay)
 	}
 
-	d := 30 * time.Minute
+	d := c.limits.idleTimeout
 	if c.state == stateNotAuthenticated {
 		d = 30 * time.Second
 	}
-	err := c.conn.SetReadDeadline(time.Now().Add(d))
+	deadline := time.Now().Add(d)
+	if c.limits.maxLifetime > 0 && c.start.Add(c.limits.maxLifetime).Before(deadline) {
+		deadline = c.start.Add(c.limits.maxLifetime)
+	}
+	err := c.setReadDeadline(deadline)
 	c.log.Check(err, "setting read deadline")
 
-	line, err := bufpool.Readline(c.log, c.br)
+	line, err := c.limits.bufpool.Readline(c.log, c.br)
 	if err != nil && errors.Is(err, moxio.ErrLineTooLong) {
 		return "", fmt.Errorf("%s (%w)", err, errProtocol)
 	} else if err != nil {
-		return "", fmt.Errorf("%s (%w)", err, errIO)
+		// Keep the underlying error, callers check for deadlines.
+		return "", fmt.Errorf("%w (%w)", err, errIO)
 	}
 	return line, nil
 }
@@ -536,6 +696,15 @@ func (c *conn) lineChan() chan lineErr {
 	return c.line
 }
 
+// writeBye writes a BYE response after reading failed with a deadline, due to
+// inactivity, the maximum lifetime of the connection, or because we are closing
+// the connection.
+func (c *conn) writeBye() {
+	err := c.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	c.log.Check(err, "setting write deadline")
+	c.writelinef("* BYE %s", c.byeReason())
+}
+
 // readline from either the c.line channel, or otherwise read from connection.
 func (c *conn) readline(readCmd bool) string {
 	var line string
@@ -549,9 +718,7 @@ func (c *conn) readline(readCmd bool) string {
 	}
 	if err != nil {
 		if readCmd && errors.Is(err, os.ErrDeadlineExceeded) {
-			err := c.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
-			c.log.Check(err, "setting write deadline")
-			c.writelinef("* BYE inactive")
+			c.writeBye()
 		}
 		if !errors.Is(err, errIO) && !errors.Is(err, errProtocol) {
 			err = fmt.Errorf("%s (%w)", err, errIO)
@@ -584,8 +751,8 @@ func (c *conn) writeresultf(format string, args ...any) {
 // write buffered tagged command response, but first write pending changes.
 func (c *conn) bwriteresultf(format string, args ...any) {
 	switch c.cmd {
-	case "fetch", "store", "search":
-		// ../rfc/9051:5862 ../rfc/7162:2033
+	case "fetch", "store", "search", "sort", "thread":
+		// ../rfc/9051:5862 ../rfc/7162:2033 ../rfc/5256:554
 	default:
 		if c.comm != nil {
 			c.applyChanges(c.comm.Get(), false)
@@ -688,8 +855,14 @@ func serve(listenerName string, cid int64, tlsConfig *tls.Config, nc net.Conn, x
 		remoteIP:          remoteIP,
 		noRequireSTARTTLS: noRequireSTARTTLS,
 		enabled:           map[capability]bool{},
+		limits:            listenerLimits(listenerName),
+		readOnlyMode:      mox.Conf.Static.Listeners[listenerName].IMAPReadOnly,
 		cmd:               "(greeting)",
 		cmdStart:          time.Now(),
+		start:             time.Now(),
+	}
+	if l, ok := mox.Conf.Static.Listeners[listenerName]; ok && l.TLS != nil {
+		c.clientAuthCAs = l.TLS.ClientAuthCAs
 	}
 	var logmutex sync.Mutex
 	c.log = mlog.New("imapserver", nil).WithFunc(func() []slog.Attr {
@@ -719,6 +892,9 @@ func serve(listenerName string, cid int64, tlsConfig *tls.Config, nc net.Conn, x
 	if viaHTTPS {
 		tcpconn = nc.(*tls.Conn).NetConn()
 	}
+	if pc, ok := tcpconn.(*proxyproto.Conn); ok {
+		tcpconn = pc.NetConn()
+	}
 	if tc, ok := tcpconn.(*net.TCPConn); ok {
 		if err := tc.SetKeepAlivePeriod(5 * time.Minute); err != nil {
 			c.log.Errorx("setting keepalive period", err)
@@ -734,8 +910,10 @@ func serve(listenerName string, cid int64, tlsConfig *tls.Config, nc net.Conn, x
 		slog.Bool("viahttps", viaHTTPS),
 		slog.String("listener", listenerName))
 
+	metricIMAPConnectionsState.WithLabelValues(c.state.String()).Inc()
 	defer func() {
 		c.conn.Close()
+		metricIMAPConnectionsState.WithLabelValues(c.state.String()).Dec()
 
 		if c.account != nil {
 			c.comm.Unregister()
@@ -796,6 +974,13 @@ func serve(listenerName string, cid int64, tlsConfig *tls.Config, nc net.Conn, x
 	mox.Connections.Register(nc, "imap", listenerName)
 	defer mox.Connections.Unregister(nc)
 
+	if !connRegister(c, nc, listenerName) {
+		c.log.Info("refusing connection due to too many open connections from ip", slog.Any("remoteip", c.remoteIP), slog.Int("maxconnections", c.limits.maxConnectionsIP))
+		c.writelinef("* BYE [ALERT] too many open connections from your ip, maximum %d", c.limits.maxConnectionsIP)
+		return
+	}
+	defer connUnregister(c.cid)
+
 	if preauthAddress != "" {
 		acc, _, _, err := store.OpenEmail(c.log, preauthAddress, false)
 		if err != nil {
@@ -808,8 +993,16 @@ func serve(listenerName string, cid int64, tlsConfig *tls.Config, nc net.Conn, x
 		c.comm = store.RegisterComm(c.account)
 	}
 
+	// Authenticated with TLS client certificate.
+	if c.account != nil && !c.noPreauth && preauthAddress == "" {
+		if max, ok := c.accountConnectionsAllowed(c.account); !ok {
+			c.log.Info("refusing connection due to too many open connections for account", slog.String("account", c.account.Name), slog.Int("maxconnections", max))
+			c.writelinef("* BYE [ALERT] too many open connections for account, maximum %d", max)
+			return
+		}
+	}
 	if c.account != nil && !c.noPreauth {
-		c.state = stateAuthenticated
+		c.setState(stateAuthenticated)
 		c.writelinef("* PREAUTH [CAPABILITY %s] mox imap welcomes %s", c.capabilities(), c.username)
 	} else {
 		c.writelinef("* OK [CAPABILITY %s] mox imap", c.capabilities())
@@ -827,6 +1020,7 @@ func serve(listenerName string, cid int64, tlsConfig *tls.Config, nc net.Conn, x
 	for {
 		c.command()
 		c.xflush() // For flushing errors, or possibly commands that did not flush explicitly.
+		c.connUpdate()
 
 		// After an authentication command, we will have a c.loginAttempt. We typically get
 		// an "ID" command with the user-agent immediately after. So we wait for one more
@@ -870,13 +1064,15 @@ func (c *conn) newLoginAttempt(useTLS bool, authMech string) {
 	}
 
 	c.loginAttempt = &store.LoginAttempt{
-		RemoteIP: c.remoteIP.String(),
-		LocalIP:  localIP,
-		TLS:      store.LoginAttemptTLS(state),
-		Protocol: "imap",
-		AuthMech: authMech,
-		Result:   store.AuthError, // Replaced by caller.
-	}
+		RemoteIP:  c.remoteIP.String(),
+		LocalIP:   localIP,
+		TLS:       store.LoginAttemptTLS(state),
+		Protocol:  "imap",
+		UserAgent: c.clientIDValues,
+		AuthMech:  authMech,
+		Result:    store.AuthError, // Replaced by caller.
+	}
+	c.clientRecorded = false
 }
 
 // makeTLSConfig makes a new tls config that is bound to the connection for
@@ -914,21 +1110,25 @@ func (c *conn) tlsClientAuthVerifyPeerCert(rawCerts [][]byte, verifiedChains [][
 		return nil
 	}
 
-	cert, err := x509.ParseCertificate(rawCerts[0])
-	if err != nil {
-		c.log.Debugx("parsing tls client certificate", err)
-		return err
+	certs := make([]*x509.Certificate, len(rawCerts))
+	for i, raw := range rawCerts {
+		cert, err := x509.ParseCertificate(raw)
+		if err != nil {
+			c.log.Debugx("parsing tls client certificate", err)
+			return err
+		}
+		certs[i] = cert
 	}
-	if err := c.tlsClientAuthVerifyPeerCertParsed(cert); err != nil {
+	if err := c.tlsClientAuthVerifyPeerCertParsed(certs); err != nil {
 		c.log.Debugx("verifying tls client certificate", err)
 		return fmt.Errorf("verifying client certificate: %w", err)
 	}
 	return nil
 }
 
-// tlsClientAuthVerifyPeerCertParsed verifies a client certificate. Called both for
-// fresh and resumed TLS connections.
-func (c *conn) tlsClientAuthVerifyPeerCertParsed(cert *x509.Certificate) error {
+// tlsClientAuthVerifyPeerCertParsed verifies a client certificate chain, with the
+// leaf certificate first. Called both for fresh and resumed TLS connections.
+func (c *conn) tlsClientAuthVerifyPeerCertParsed(certs []*x509.Certificate) error {
 	if c.account != nil {
 		return fmt.Errorf("cannot authenticate with tls client certificate after previous authentication")
 	}
@@ -977,10 +1177,10 @@ func (c *conn) tlsClientAuthVerifyPeerCertParsed(cert *x509.Certificate) error {
 		}
 	}()
 
-	shabuf := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	shabuf := sha256.Sum256(certs[0].RawSubjectPublicKeyInfo)
 	fp := base64.RawURLEncoding.EncodeToString(shabuf[:])
 	c.loginAttempt.TLSPubKeyFingerprint = fp
-	pubKey, err := store.TLSPublicKeyGet(context.TODO(), fp)
+	pubKey, err := store.TLSPublicKeyFind(context.TODO(), certs, c.clientAuthCAs)
 	if err != nil {
 		if err == bstore.ErrAbsent {
 			c.loginAttempt.Result = store.AuthBadCredentials
@@ -1014,6 +1214,11 @@ func (c *conn) tlsClientAuthVerifyPeerCertParsed(cert *x509.Certificate) error {
 		return fmt.Errorf("tls client public key %s is for account %s, but email address %s is for account %s", fp, pubKey.Account, pubKey.LoginAddress, acc.Name)
 	}
 
+	if accConf, ok := acc.Conf(); ok && checkLoginDisabled && !accConf.LoginNetworkAllowed(c.remoteIP) {
+		c.loginAttempt.Result = store.AuthNetworkDenied
+		return fmt.Errorf("tls client public key %s for account %s: %w", fp, acc.Name, store.ErrLoginNetwork)
+	}
+
 	c.loginAttempt.Result = store.AuthSuccess
 
 	c.authFailed = 0
@@ -1050,7 +1255,7 @@ func (c *conn) xtlsHandshakeAndAuthenticate(conn net.Conn) {
 	cs := tlsConn.ConnectionState()
 	if cs.DidResume && len(cs.PeerCertificates) > 0 {
 		// Verify client after session resumption.
-		err := c.tlsClientAuthVerifyPeerCertParsed(cs.PeerCertificates[0])
+		err := c.tlsClientAuthVerifyPeerCertParsed(cs.PeerCertificates)
 		if err != nil {
 			c.bwritelinef("* BYE [ALERT] Error verifying client certificate after TLS session resumption: %s", err)
 			panic(fmt.Errorf("tls verify client certificate after resumption: %s (%w)", err, errIO))
@@ -1185,12 +1390,23 @@ func (c *conn) command() {
 	default:
 	}
 
+	// Sessions authenticated before the account was suspended end at their next
+	// command.
+	if c.account != nil {
+		if accConf, ok := c.account.Conf(); ok && accConf.Suspended != "" {
+			c.log.Info("account suspended, closing connection", slog.String("account", c.account.Name))
+			c.writelinef("* BYE account suspended: %s", accConf.Suspended)
+			panic(errIO)
+		}
+	}
+
 	fn := commands[cmdlow]
 	if fn == nil {
 		xsyntaxErrorf("unknown command %q", cmd)
 	}
 	c.cmdMetric = c.cmd
 	c.ncmds++
+	c.connUpdate()
 
 	// Check if command is allowed in this state.
 	if _, ok1 := commandsStateAny[cmdlow]; ok1 {
@@ -1203,6 +1419,11 @@ func (c *conn) command() {
 		xserverErrorf("unrecognized command")
 	}
 
+	// Listeners in read-only mode only serve existing data.
+	if _, ok := commandsModify[cmdlow]; ok && c.readOnlyMode {
+		xusercodeErrorf("UNAVAILABLE", "read-only access during maintenance, changes are not possible")
+	}
+
 	fn(c, tag, cmd, p)
 }
 
@@ -1309,6 +1530,8 @@ func (c *conn) sequenceRemove(seq msgseq, uid store.UID) {
 	}
 	copy(c.uids[i:], c.uids[i+1:])
 	c.uids = c.uids[:len(c.uids)-1]
+	c.searchCache = nil
+	c.searchUpdatesRemove(uid)
 	if sanityChecks {
 		checkUIDs(c.uids)
 	}
@@ -1325,6 +1548,7 @@ func (c *conn) uidAppend(uid store.UID) {
 		xserverErrorf("new uid %d is smaller than last uid %d (%w)", uid, c.uids[len(c.uids)-1], errProtocol)
 	}
 	c.uids = append(c.uids, uid)
+	c.searchCache = nil
 	if sanityChecks {
 		checkUIDs(c.uids)
 	}
@@ -1504,6 +1728,15 @@ func (c *conn) xmailbox(tx *bstore.Tx, name string, missingErrCode string) store
 	return *mb
 }
 
+// xcheckWritable returns a NOPERM error if mailbox mb or its messages cannot be
+// changed by IMAP clients.
+func xcheckWritable(mb store.Mailbox) {
+	if err := mb.CheckWritable(); err != nil {
+		// ../rfc/5530
+		xusercodeErrorf("NOPERM", "%s", err)
+	}
+}
+
 // Lookup mailbox by ID.
 // If the mailbox does not exist, panic is called with a user error.
 // Must be called with account rlock held.
@@ -1566,6 +1799,10 @@ func (c *conn) applyChanges(changes []store.Change, initial bool) {
 	qresync := c.enabled[capQresync]
 	condstore := c.enabled[capCondstore]
 
+	// Added messages and messages with changed flags, to check against searches with
+	// updates.
+	var updated []store.UID
+
 	i := 0
 	for i < len(changes) {
 		// First process all new uids. So we only send a single EXISTS.
@@ -1597,6 +1834,7 @@ func (c *conn) applyChanges(changes []store.Change, initial bool) {
 					modseqStr = fmt.Sprintf(" MODSEQ (%d)", add.ModSeq.Client())
 				}
 				c.bwritelinef("* %d FETCH (UID %d FLAGS %s%s)", seq, add.UID, flaglist(add.Flags, add.Keywords).pack(c), modseqStr)
+				updated = append(updated, add.UID)
 			}
 			continue
 		}
@@ -1644,6 +1882,7 @@ func (c *conn) applyChanges(changes []store.Change, initial bool) {
 					modseqStr = fmt.Sprintf(" MODSEQ (%d)", ch.ModSeq.Client())
 				}
 				c.bwritelinef("* %d FETCH (UID %d FLAGS %s%s)", seq, ch.UID, flaglist(ch.Flags, ch.Keywords).pack(c), modseqStr)
+				updated = append(updated, ch.UID)
 			}
 		case store.ChangeRemoveMailbox:
 			// Only announce \NonExistent to modern clients, otherwise they may ignore the
@@ -1670,6 +1909,8 @@ func (c *conn) applyChanges(changes []store.Change, initial bool) {
 			panic(fmt.Sprintf("internal error, missing case for %#v", change))
 		}
 	}
+
+	c.xsearchUpdates(updated)
 }
 
 // Capability returns the capabilities this server implements and currently has
@@ -1689,10 +1930,34 @@ func (c *conn) cmdCapability(tag, cmd string, p *parser) {
 	c.ok(tag, cmd)
 }
 
+// appendLimit returns the maximum size of a message added with APPEND, zero for
+// no limit. The limit of the listener applies, and once authenticated, the limit
+// of the account if it is lower.
+func (c *conn) appendLimit() int64 {
+	size := c.limits.appendSize
+	if c.account != nil {
+		conf, _ := c.account.Conf()
+		if conf.MaxAppendSize > 0 && (size == 0 || conf.MaxAppendSize < size) {
+			size = conf.MaxAppendSize
+		}
+	}
+	return size
+}
+
 // capabilities returns non-empty string with available capabilities based on connection state.
 // For use in cmdCapability and untagged OK responses on connection start, login and authenticate.
 func (c *conn) capabilities() string {
 	caps := serverCapabilities
+	if c.limits.literalMinus {
+		caps += " LITERAL-"
+	} else {
+		caps += " LITERAL+"
+	}
+	if appendSize := c.appendLimit(); appendSize > 0 {
+		caps += fmt.Sprintf(" APPENDLIMIT=%d", appendSize)
+	} else {
+		caps += " APPENDLIMIT=9223372036854775807"
+	}
 	// ../rfc/9051:1238
 	// We only allow starting without TLS when explicitly configured, in violation of RFC.
 	if !c.tls && c.baseTLSConfig != nil {
@@ -1700,6 +1965,10 @@ func (c *conn) capabilities() string {
 	}
 	if c.tls || c.noRequireSTARTTLS {
 		caps += " AUTH=PLAIN"
+		if mox.Conf.Static.OAuth != nil {
+			// ../rfc/7628
+			caps += " AUTH=OAUTHBEARER AUTH=XOAUTH2"
+		}
 	} else {
 		caps += " LOGINDISABLED"
 	}
@@ -1731,7 +2000,7 @@ func (c *conn) cmdLogout(tag, cmd string, p *parser) {
 	p.xempty()
 
 	c.unselect()
-	c.state = stateNotAuthenticated
+	c.setState(stateNotAuthenticated)
 	// Response syntax: ../rfc/9051:6886 ../rfc/3501:4935
 	c.bwritelinef("* BYE thanks")
 	c.ok(tag, cmd)
@@ -1769,23 +2038,149 @@ func (c *conn) cmdID(tag, cmd string, p *parser) {
 	}
 	p.xempty()
 
+	c.clientID = params
+	c.clientIDValues = strings.Join(values, " ")
+
+	// Evaluate the IMAP client rules, and add the client to the inventory if we are
+	// authenticated. Otherwise, that happens at login.
+	var accountName string
+	if c.state != stateNotAuthenticated {
+		accountName = c.account.Name
+	}
+	denyMsg := clientDeniedMessage(accountName, params)
+	if accountName != "" {
+		c.recordClient(accountName, denyMsg != "")
+	}
+
 	// The ID command is typically sent immediately after authentication. So we've
 	// prepared the LoginAttempt and write it now.
 	if c.loginAttempt != nil {
-		c.loginAttempt.UserAgent = strings.Join(values, " ")
+		c.loginAttempt.UserAgent = c.clientIDValues
 		store.LoginAttemptAdd(context.Background(), c.log, *c.loginAttempt)
 		c.loginAttempt = nil
 	}
 
-	// We just log the client id.
 	c.log.Info("client id", slog.Any("params", params))
 
+	if denyMsg != "" {
+		c.log.Info("imap client denied by rule, closing connection", slog.String("account", accountName))
+		c.writelinef("* BYE %s", denyMsg)
+		panic(cleanClose)
+	}
+
 	// Response syntax: ../rfc/2971:243
 	// We send our name and version. ../rfc/2971:193
 	c.bwritelinef(`* ID ("name" "mox" "version" %s)`, string0(moxvar.Version).pack(c))
 	c.ok(tag, cmd)
 }
 
+// clientDeniedMessage returns a non-empty message if the first IMAP client rule
+// that matches the ID parameters denies the client. Rules for specific accounts
+// only match if accountName is set.
+func clientDeniedMessage(accountName string, params map[string]string) string {
+	if params == nil {
+		return ""
+	}
+	lparams := map[string]string{}
+	for k, v := range params {
+		lparams[strings.ToLower(k)] = v
+	}
+Rules:
+	for _, r := range mox.Conf.IMAPClientRules() {
+		if len(r.Accounts) > 0 && !slices.Contains(r.Accounts, accountName) {
+			continue
+		}
+		for k, re := range r.ParamsRegexpCompiled {
+			if !re.MatchString(lparams[k]) {
+				continue Rules
+			}
+		}
+		if r.Action != "deny" {
+			return ""
+		} else if r.Message != "" {
+			return r.Message
+		}
+		return "email client software not allowed, contact your administrator"
+	}
+	return ""
+}
+
+// xcheckLoginNetwork fails a login if the account has LoginNetworks configured
+// and the client is not connecting from one of those networks.
+func (c *conn) xcheckLoginNetwork(account *store.Account) {
+	if accConf, ok := account.Conf(); ok && !accConf.LoginNetworkAllowed(c.remoteIP) {
+		c.loginAttempt.Result = store.AuthNetworkDenied
+		c.log.Info("account login from network not allowed", slog.String("account", account.Name), slog.Any("remote", c.remoteIP))
+		// As with login disabled, no AUTHENTICATIONFAILED code, clients could prompt for
+		// a different password.
+		xuserErrorf("%s", store.ErrLoginNetwork)
+	}
+}
+
+// xcheckAuthLockout fails authentication if there were too many failed attempts
+// from the remote IP, or for the account if accountName is non-empty.
+func (c *conn) xcheckAuthLockout(accountName string) {
+	if err := store.AuthLockoutCheck(context.TODO(), c.remoteIP, accountName); errors.Is(err, store.ErrAuthLockedOut) {
+		c.xauthLockedOut(accountName, err)
+	} else {
+		xcheckf(err, "checking authentication lockout")
+	}
+}
+
+// xauthLockedOut fails an authentication attempt refused due to a lockout. As
+// with login disabled, no AUTHENTICATIONFAILED code, clients could prompt for a
+// different password.
+func (c *conn) xauthLockedOut(accountName string, err error) {
+	c.loginAttempt.Result = store.AuthLockedOut
+	c.log.Info("authentication refused due to lockout", slog.String("account", accountName), slog.Any("remote", c.remoteIP))
+	xuserErrorf("%s", err)
+}
+
+// xcheckClientRules fails a login if the client sent an ID command before
+// authenticating and is denied by the IMAP client rules for the account.
+func (c *conn) xcheckClientRules(accountName string) {
+	if msg := clientDeniedMessage(accountName, c.clientID); msg != "" {
+		c.recordClient(accountName, true)
+		c.loginAttempt.Result = store.AuthClientDenied
+		c.log.Info("imap client denied by rule", slog.String("account", accountName))
+		xuserErrorf("%s", msg)
+	}
+}
+
+// accountConnectionsAllowed returns whether the connection can authenticate for
+// the account, and the maximum number of connections for the account.
+func (c *conn) accountConnectionsAllowed(acc *store.Account) (int, bool) {
+	max := c.limits.maxConnectionsAcc
+	if accConf, ok := acc.Conf(); ok && accConf.MaxIMAPConnections != 0 {
+		max = accConf.MaxIMAPConnections
+	}
+	if max <= 0 {
+		return max, true
+	}
+	return max, connAccountReserve(c.cid, acc.Name, max)
+}
+
+// xcheckAccountConnections fails authentication if the account already has its
+// maximum number of open connections.
+func (c *conn) xcheckAccountConnections(acc *store.Account) {
+	if max, ok := c.accountConnectionsAllowed(acc); !ok {
+		c.loginAttempt.Result = store.AuthTooManyConns
+		c.log.Info("imap authentication refused due to too many open connections for account", slog.String("account", acc.Name), slog.Int("maxconnections", max))
+		xusercodeErrorf("ALERT", "too many open connections for account, maximum %d", max)
+	}
+}
+
+// recordClient adds the client that sent an ID command to the inventory of IMAP
+// clients, once per login.
+func (c *conn) recordClient(accountName string, denied bool) {
+	if c.clientID == nil || c.clientRecorded {
+		return
+	}
+	c.clientRecorded = true
+	err := store.IMAPClientAdd(context.Background(), accountName, c.clientID, denied)
+	c.log.Check(err, "adding imap client to inventory")
+}
+
 // STARTTLS enables TLS on the connection, after a plain text start.
 // Only allowed if TLS isn't already enabled, either through connecting to a
 // TLS-enabled TCP port, or a previous STARTTLS command.
@@ -1865,6 +2260,8 @@ func (c *conn) cmdAuthenticate(tag, cmd string, p *parser) {
 		}
 	}()
 
+	c.xcheckAuthLockout("")
+
 	// Request syntax: ../rfc/9051:6341 ../rfc/3501:4561
 	p.xspace()
 	authType := p.xatom()
@@ -1953,6 +2350,8 @@ func (c *conn) cmdAuthenticate(tag, cmd string, p *parser) {
 				c.loginAttempt.Result = store.AuthBadCredentials
 				c.log.Info("authentication failed", slog.String("username", username))
 				xusercodeErrorf("AUTHENTICATIONFAILED", "bad credentials")
+			} else if errors.Is(err, store.ErrAuthLockedOut) {
+				c.xauthLockedOut(c.loginAttempt.AccountName, err)
 			}
 			xusercodeErrorf("", "error")
 		}
@@ -1985,6 +2384,7 @@ func (c *conn) cmdAuthenticate(tag, cmd string, p *parser) {
 			}
 			xserverErrorf("looking up address: %v", err)
 		}
+		c.xcheckAuthLockout(account.Name)
 		var ipadhash, opadhash hash.Hash
 		account.WithRLock(func() {
 			err := account.DB.Read(context.TODO(), func(tx *bstore.Tx) error {
@@ -2065,6 +2465,7 @@ func (c *conn) cmdAuthenticate(tag, cmd string, p *parser) {
 		if ss.Authorization != "" && ss.Authorization != username {
 			xuserErrorf("authentication with authorization for different user not supported")
 		}
+		c.xcheckAuthLockout(account.Name)
 		var xscram store.SCRAM
 		account.WithRLock(func() {
 			err := account.DB.Read(context.TODO(), func(tx *bstore.Tx) error {
@@ -2121,6 +2522,56 @@ func (c *conn) cmdAuthenticate(tag, cmd string, p *parser) {
 		// The message should be empty. todo: should we require it is empty?
 		xreadContinuation()
 
+	case "OAUTHBEARER", "XOAUTH2":
+		c.loginAttempt.AuthMech = strings.ToLower(authType)
+		xoauth2 := c.loginAttempt.AuthMech == "xoauth2"
+
+		oc := mox.Conf.Static.OAuth
+		if oc == nil {
+			xuserErrorf("method not supported")
+		}
+		if !c.noRequireSTARTTLS && !c.tls {
+			// ../rfc/7628
+			xusercodeErrorf("PRIVACYREQUIRED", "tls required for login")
+		}
+
+		// Bearer token is a credential, mark as traceauth.
+		defer c.xtrace(mlog.LevelTraceauth)()
+		buf := xreadInitial()
+		c.xtrace(mlog.LevelTrace) // Restore.
+		var token string
+		var err error
+		if xoauth2 {
+			username, token, err = oauthbearer.ParseXOAuth2(buf)
+		} else {
+			username, token, err = oauthbearer.ParseOAuthBearer(buf)
+		}
+		if err != nil {
+			c.loginAttempt.Result = store.AuthBadProtocol
+			xsyntaxErrorf("%s", err)
+		}
+		username = norm.NFC.String(username)
+		c.loginAttempt.LoginAddress = username
+
+		var address string
+		account, c.loginAttempt.AccountName, address, err = store.OpenEmailOAuth(context.TODO(), c.log, username, token)
+		if err != nil {
+			if errors.Is(err, store.ErrUnknownCredentials) {
+				c.loginAttempt.Result = store.AuthBadCredentials
+				c.log.Infox("failed authentication attempt", err, slog.String("username", username), slog.Any("remote", c.remoteIP))
+				// Client must respond to the error challenge, after which we fail the
+				// authentication. ../rfc/7628
+				c.writelinef("+ %s", base64.StdEncoding.EncodeToString(oc.Verifier.ErrorChallenge(xoauth2, err)))
+				xreadContinuation()
+				xusercodeErrorf("AUTHENTICATIONFAILED", "bad credentials")
+			} else if errors.Is(err, store.ErrAuthLockedOut) {
+				c.xauthLockedOut(c.loginAttempt.AccountName, err)
+			}
+			xserverErrorf("verifying token: %v", err)
+		}
+		username = address
+		c.loginAttempt.LoginAddress = username
+
 	case "EXTERNAL":
 		c.loginAttempt.AuthMech = "external"
 
@@ -2151,12 +2602,15 @@ func (c *conn) cmdAuthenticate(tag, cmd string, p *parser) {
 
 	if accConf, ok := account.Conf(); !ok {
 		xserverErrorf("cannot get account config")
-	} else if accConf.LoginDisabled != "" {
+	} else if msg := accConf.LoginDisabledMessage(); msg != "" {
 		c.loginAttempt.Result = store.AuthLoginDisabled
 		c.log.Info("account login disabled", slog.String("username", username))
 		// No AUTHENTICATIONFAILED code, clients could prompt users for different password.
-		xuserErrorf("%w: %s", store.ErrLoginDisabled, accConf.LoginDisabled)
+		xuserErrorf("%w: %s", store.ErrLoginDisabled, msg)
 	}
+	c.xcheckLoginNetwork(account)
+	c.xcheckClientRules(account.Name)
+	c.xcheckAccountConnections(account)
 
 	// We may already have TLS credentials. They won't have been enabled, or we could
 	// get here due to the state machine that doesn't allow authentication while being
@@ -2194,7 +2648,9 @@ func (c *conn) cmdAuthenticate(tag, cmd string, p *parser) {
 	c.loginAttempt.LoginAddress = c.username
 	c.loginAttempt.Result = store.AuthSuccess
 	c.authFailed = 0
-	c.state = stateAuthenticated
+	c.setState(stateAuthenticated)
+	c.recordClient(c.account.Name, false)
+	c.bwriteReadOnlyAlert()
 	c.writeresultf("%s OK [CAPABILITY %s] authenticate done", tag, c.capabilities())
 }
 
@@ -2228,6 +2684,8 @@ func (c *conn) cmdLogin(tag, cmd string, p *parser) {
 		xusercodeErrorf("PRIVACYREQUIRED", "tls required for login")
 	}
 
+	c.xcheckAuthLockout("")
+
 	// For many failed auth attempts, slow down verification attempts.
 	if c.authFailed > 3 && authFailDelay > 0 {
 		mox.Sleep(mox.Context, time.Duration(c.authFailed-3)*authFailDelay)
@@ -2257,6 +2715,8 @@ func (c *conn) cmdLogin(tag, cmd string, p *parser) {
 			// but may cause email clients to suppress the message since we are not yet
 			// authenticated. So we don't send anything. ../rfc/9051:4940
 			xuserErrorf("%s", err)
+		} else if errors.Is(err, store.ErrAuthLockedOut) {
+			c.xauthLockedOut(accName, err)
 		}
 		xusercodeErrorf(code, "login failed")
 	}
@@ -2266,6 +2726,9 @@ func (c *conn) cmdLogin(tag, cmd string, p *parser) {
 			c.log.Check(err, "close account")
 		}
 	}()
+	c.xcheckLoginNetwork(account)
+	c.xcheckClientRules(account.Name)
+	c.xcheckAccountConnections(account)
 
 	// We may already have TLS credentials. They won't have been enabled, or we could
 	// get here due to the state machine that doesn't allow authentication while being
@@ -2302,10 +2765,20 @@ func (c *conn) cmdLogin(tag, cmd string, p *parser) {
 	c.loginAttempt.Result = store.AuthSuccess
 	c.authFailed = 0
 	c.setSlow(false)
-	c.state = stateAuthenticated
+	c.setState(stateAuthenticated)
+	c.recordClient(c.account.Name, false)
+	c.bwriteReadOnlyAlert()
 	c.writeresultf("%s OK [CAPABILITY %s] login done", tag, c.capabilities())
 }
 
+// bwriteReadOnlyAlert writes an alert about read-only access after login, for
+// listeners in read-only mode.
+func (c *conn) bwriteReadOnlyAlert() {
+	if c.readOnlyMode {
+		c.bwritelinef("* OK [ALERT] Read-only access during maintenance, changes are not possible.")
+	}
+}
+
 // Enable explicitly opts in to an extension. A server can typically send new kinds
 // of responses to a client. Most extensions do not require an ENABLE because a
 // client implicitly opts in to new response syntax by making a requests that uses
@@ -2515,7 +2988,12 @@ func (c *conn) cmdSelectExamine(isselect bool, tag, cmd string, p *parser) {
 		flags = " " + strings.Join(mb.Keywords, " ")
 	}
 	c.bwritelinef(`* FLAGS (\Seen \Answered \Flagged \Deleted \Draft $Forwarded $Junk $NotJunk $Phishing $MDNSent%s)`, flags)
-	c.bwritelinef(`* OK [PERMANENTFLAGS (\Seen \Answered \Flagged \Deleted \Draft $Forwarded $Junk $NotJunk $Phishing $MDNSent \*)] x`)
+	if mb.ReadOnly {
+		// No flags can be changed. ../rfc/9051
+		c.bwritelinef(`* OK [PERMANENTFLAGS ()] x`)
+	} else {
+		c.bwritelinef(`* OK [PERMANENTFLAGS (\Seen \Answered \Flagged \Deleted \Draft $Forwarded $Junk $NotJunk $Phishing $MDNSent \*)] x`)
+	}
 	if !c.enabled[capIMAP4rev2] {
 		c.bwritelinef(`* 0 RECENT`)
 	}
@@ -2672,7 +3150,10 @@ func (c *conn) cmdSelectExamine(isselect bool, tag, cmd string, p *parser) {
 		}
 	}
 
-	if isselect {
+	// In read-only mode, and for read-only mailboxes, select opens mailboxes
+	// read-only like examine, so fetching messages doesn't set the \Seen flag, and
+	// store and expunge fail.
+	if isselect && !c.readOnlyMode && !mb.ReadOnly {
 		c.bwriteresultf("%s OK [READ-WRITE] x", tag)
 		c.readonly = false
 	} else {
@@ -2680,8 +3161,10 @@ func (c *conn) cmdSelectExamine(isselect bool, tag, cmd string, p *parser) {
 		c.readonly = true
 	}
 	c.mailboxID = mb.ID
-	c.state = stateSelected
+	c.setState(stateSelected)
 	c.searchResult = nil
+	c.searchCache = nil
+	c.searchUpdates = nil
 	c.xflush()
 }
 
@@ -2747,7 +3230,7 @@ func (c *conn) cmdDelete(tag, cmd string, p *parser) {
 	name = xcheckmailboxname(name, false)
 
 	// Messages to remove after having broadcasted the removal of messages.
-	var removeMessageIDs []int64
+	var removeMessages []store.Message
 
 	c.account.WithWLock(func() {
 		var mb store.Mailbox
@@ -2755,10 +3238,11 @@ func (c *conn) cmdDelete(tag, cmd string, p *parser) {
 
 		c.xdbwrite(func(tx *bstore.Tx) {
 			mb = c.xmailbox(tx, name, "NONEXISTENT")
+			xcheckWritable(mb)
 
 			var hasChildren bool
 			var err error
-			changes, removeMessageIDs, hasChildren, err = c.account.MailboxDelete(context.TODO(), c.log, tx, mb)
+			changes, removeMessages, hasChildren, err = c.account.MailboxDelete(context.TODO(), c.log, tx, mb)
 			if hasChildren {
 				xusercodeErrorf("HASCHILDREN", "mailbox has a child, only leaf mailboxes can be deleted")
 			}
@@ -2768,8 +3252,11 @@ func (c *conn) cmdDelete(tag, cmd string, p *parser) {
 		c.broadcast(changes)
 	})
 
-	for _, mID := range removeMessageIDs {
-		p := c.account.MessagePath(mID)
+	for _, m := range removeMessages {
+		if m.PackID != 0 {
+			continue
+		}
+		p := c.account.MessagePath(m.ID)
 		err := os.Remove(p)
 		c.log.Check(err, "removing message file for mailbox delete", slog.String("path", p))
 	}
@@ -2804,6 +3291,7 @@ func (c *conn) cmdRename(tag, cmd string, p *parser) {
 
 		c.xdbwrite(func(tx *bstore.Tx) {
 			srcMB := c.xmailbox(tx, src, "NONEXISTENT")
+			xcheckWritable(srcMB)
 
 			// Inbox is very special. Unlike other mailboxes, its children are not moved. And
 			// unlike a regular move, its messages are moved to a newly created mailbox. We do
@@ -2914,6 +3402,9 @@ func (c *conn) cmdRename(tag, cmd string, p *parser) {
 				xusercodeErrorf("NONEXISTENT", "%s", err)
 			} else if alreadyExists {
 				xusercodeErrorf("ALREADYEXISTS", "%s", err)
+			} else if errors.Is(err, store.ErrMailboxReadOnly) {
+				// A child mailbox is read-only.
+				xusercodeErrorf("NOPERM", "%s", err)
 			}
 			xcheckf(err, "renaming mailbox")
 		})
@@ -3132,19 +3623,20 @@ func (c *conn) xstatusLine(tx *bstore.Tx, mb store.Mailbox, attrs []string) stri
 			status = append(status, A, "0")
 		case "APPENDLIMIT":
 			// ../rfc/7889:255
-			status = append(status, A, "NIL")
+			if appendSize := c.appendLimit(); appendSize > 0 {
+				status = append(status, A, fmt.Sprintf("%d", appendSize))
+			} else {
+				status = append(status, A, "NIL")
+			}
 		case "HIGHESTMODSEQ":
 			// ../rfc/7162:366
 			status = append(status, A, fmt.Sprintf("%d", c.xhighestModSeq(tx, mb.ID).Client()))
 		case "DELETED-STORAGE":
 			// ../rfc/9208:394
 			// How much storage space could be reclaimed by expunging messages with the
-			// \Deleted flag. We could keep track of this number and return it efficiently.
-			// Calculating it each time can be slow, and we don't know if clients request it.
-			// Clients are not likely to set the deleted flag without immediately expunging
-			// nowadays. Let's wait for something to need it to go through the trouble, and
-			// always return 0 for now.
-			status = append(status, A, "0")
+			// \Deleted flag. We return the sum of the message sizes, kept in the mailbox
+			// counts.
+			status = append(status, A, fmt.Sprintf("%d", mb.DeletedSize))
 		default:
 			xsyntaxErrorf("unknown attribute %q", a)
 		}
@@ -3175,126 +3667,177 @@ func flaglist(fl store.Flags, keywords []string) listspace {
 	return l
 }
 
-// Append adds a message to a mailbox.
+// Append adds one or more messages to a mailbox. With multiple messages
+// (MULTIAPPEND), either all or none are added. A message can be composed of
+// literals and (parts of) existing messages (CATENATE).
 //
 // State: Authenticated and selected.
 func (c *conn) cmdAppend(tag, cmd string, p *parser) {
-	// Command: ../rfc/9051:3406 ../rfc/6855:204 ../rfc/3501:2527
+	// Command: ../rfc/9051:3406 ../rfc/6855:204 ../rfc/3501:2527 ../rfc/3502 ../rfc/4469
 	// Examples: ../rfc/9051:3482 ../rfc/3501:2589
 
-	// Request syntax: ../rfc/9051:6325 ../rfc/6855:219 ../rfc/3501:4547
+	// Request syntax: ../rfc/9051:6325 ../rfc/6855:219 ../rfc/3501:4547 ../rfc/3502 ../rfc/4469
 	p.xspace()
 	name := p.xmailbox()
-	p.xspace()
-	var storeFlags store.Flags
-	var keywords []string
-	if p.hasPrefix("(") {
-		// Error must be a syntax error, to properly abort the connection due to literal.
-		var err error
-		storeFlags, keywords, err = store.ParseFlagsKeywords(p.xflagList())
-		if err != nil {
-			xsyntaxErrorf("parsing flags: %v", err)
-		}
-		p.xspace()
-	}
-	var tm time.Time
-	if p.hasPrefix(`"`) {
-		tm = p.xdateTime()
-		p.xspace()
-	} else {
-		tm = time.Now()
-	}
-	// todo: only with utf8 should we we accept message headers with utf-8. we currently always accept them.
-	// todo: this is only relevant if we also support the CATENATE extension?
-	// ../rfc/6855:204
-	utf8 := p.take("UTF8 (")
-	size, sync := p.xliteralSize(utf8, false)
 
-	name = xcheckmailboxname(name, true)
-	c.xdbread(func(tx *bstore.Tx) {
-		c.xmailbox(tx, name, "TRYCREATE")
-	})
-	if sync {
-		c.writelinef("+ ")
+	// Message to append, with data read into a temporary file.
+	type appendMsg struct {
+		storeFlags store.Flags
+		keywords   []string
+		tm         time.Time
+		file       *os.File
+		mw         *message.Writer
+		m          store.Message
 	}
-
-	// Read the message into a temporary file.
-	msgFile, err := store.CreateMessageTemp(c.log, "imap-append")
-	xcheckf(err, "creating temp file for message")
+	var appends []*appendMsg
 	defer func() {
-		p := msgFile.Name()
-		err := msgFile.Close()
-		c.xsanity(err, "closing APPEND temporary file")
-		err = os.Remove(p)
-		c.xsanity(err, "removing APPEND temporary file")
+		for _, a := range appends {
+			if a.file == nil {
+				continue
+			}
+			p := a.file.Name()
+			err := a.file.Close()
+			c.xsanity(err, "closing APPEND temporary file")
+			err = os.Remove(p)
+			c.xsanity(err, "removing APPEND temporary file")
+		}
 	}()
-	defer c.xtrace(mlog.LevelTracedata)()
-	mw := message.NewWriter(msgFile)
-	msize, err := io.Copy(mw, io.LimitReader(c.br, size))
-	c.xtrace(mlog.LevelTrace) // Restore.
-	if err != nil {
-		// Cannot use xcheckf due to %w handling of errIO.
-		panic(fmt.Errorf("reading literal message: %s (%w)", err, errIO))
+
+	// The mailbox is checked before the first literal is read, so a client can
+	// create the mailbox and try again without sending the message.
+	var mailboxChecked bool
+	xreadLiteral := func(size int64, sync bool, w io.Writer) {
+		if !mailboxChecked {
+			name = xcheckmailboxname(name, true)
+			c.xdbread(func(tx *bstore.Tx) {
+				mb := c.xmailbox(tx, name, "TRYCREATE")
+				xcheckWritable(mb)
+			})
+			mailboxChecked = true
+		}
+		c.xappendLiteral(p, size, sync, w)
 	}
-	if msize != size {
-		xserverErrorf("read %d bytes for message, expected %d (%w)", msize, size, errIO)
+
+	appendSize := c.appendLimit()
+	var badURL string // First URL in a CATENATE that could not be used.
+	for {
+		p.xspace()
+		a := &appendMsg{}
+		appends = append(appends, a)
+
+		if p.hasPrefix("(") {
+			// Error must be a syntax error, to properly abort the connection due to literal.
+			var err error
+			a.storeFlags, a.keywords, err = store.ParseFlagsKeywords(p.xflagList())
+			if err != nil {
+				xsyntaxErrorf("parsing flags: %v", err)
+			}
+			p.xspace()
+		}
+		if p.hasPrefix(`"`) {
+			a.tm = p.xdateTime()
+			p.xspace()
+		} else {
+			a.tm = time.Now()
+		}
+
+		var err error
+		a.file, err = store.CreateMessageTemp(c.log, "imap-append")
+		xcheckf(err, "creating temp file for message")
+		a.mw = message.NewWriter(a.file)
+
+		if p.take("CATENATE (") {
+			c.xappendCatenate(p, xreadLiteral, a.mw, &badURL)
+		} else {
+			// todo: only with utf8 should we we accept message headers with utf-8. we currently always accept them.
+			// ../rfc/6855:204
+			utf8 := p.take("UTF8 (")
+			// With BINARY, a literal8 is allowed for message data, which can contain NUL
+			// bytes and unencoded binary parts. ../rfc/3516
+			size, sync := p.xliteralSize(true, false)
+			if appendSize > 0 && size > appendSize {
+				// ../rfc/7889:139
+				p.xliteralTooBig(sync, fmt.Sprintf("message size %d is larger than allowed %d", size, appendSize))
+			}
+			xreadLiteral(size, sync, a.mw)
+			if utf8 {
+				p.xtake(")")
+			}
+		}
+
+		// More messages for MULTIAPPEND. ../rfc/3502
+		if p.empty() {
+			break
+		}
 	}
 
-	if utf8 {
-		line := c.readline(false)
-		np := newParser(line, c)
-		np.xtake(")")
-		np.xempty()
-	} else {
-		line := c.readline(false)
-		np := newParser(line, c)
-		np.xempty()
+	// Only fail after all literals of the command have been read.
+	if badURL != "" {
+		// ../rfc/4469
+		xusercodeErrorf("BADURL "+badURL, "cannot use url for catenate")
 	}
-	p.xempty()
-	if !sync {
-		name = xcheckmailboxname(name, true)
+	for _, a := range appends {
+		if appendSize > 0 && a.mw.Size > appendSize {
+			// ../rfc/4469 ../rfc/7889:139
+			xusercodeErrorf("TOOBIG", "message size %d is larger than allowed %d", a.mw.Size, appendSize)
+		}
 	}
+	name = xcheckmailboxname(name, true)
 
 	var mb store.Mailbox
-	var m store.Message
 	var pendingChanges []store.Change
 
 	c.account.WithWLock(func() {
 		var changes []store.Change
 		c.xdbwrite(func(tx *bstore.Tx) {
 			mb = c.xmailbox(tx, name, "TRYCREATE")
+			xcheckWritable(mb)
 
 			// Ensure keywords are stored in mailbox.
 			var mbKwChanged bool
-			mb.Keywords, mbKwChanged = store.MergeKeywords(mb.Keywords, keywords)
+			for _, a := range appends {
+				var changed bool
+				mb.Keywords, changed = store.MergeKeywords(mb.Keywords, a.keywords)
+				mbKwChanged = mbKwChanged || changed
+			}
 			if mbKwChanged {
 				changes = append(changes, mb.ChangeKeywords())
 			}
 
-			m = store.Message{
-				MailboxID:     mb.ID,
-				MailboxOrigID: mb.ID,
-				Received:      tm,
-				Flags:         storeFlags,
-				Keywords:      keywords,
-				Size:          mw.Size,
+			var totalSize int64
+			for _, a := range appends {
+				totalSize += a.mw.Size
 			}
-
-			ok, maxSize, err := c.account.CanAddMessageSize(tx, m.Size)
+			ok, maxSize, err := c.account.CanAddMessageSize(tx, totalSize)
 			xcheckf(err, "checking quota")
 			if !ok {
 				// ../rfc/9051:5155 ../rfc/9208:472
 				xusercodeErrorf("OVERQUOTA", "account over maximum total message size %d", maxSize)
 			}
 
-			mb.Add(m.MailboxCounts())
+			for _, a := range appends {
+				a.m = store.Message{
+					MailboxID:     mb.ID,
+					MailboxOrigID: mb.ID,
+					Received:      a.tm,
+					Flags:         a.storeFlags,
+					Keywords:      a.keywords,
+					Size:          a.mw.Size,
+				}
 
-			// Update mailbox before delivering, which updates uidnext which we mustn't overwrite.
-			err = tx.Update(&mb)
-			xcheckf(err, "updating mailbox counts")
+				mb.Add(a.m.MailboxCounts())
+
+				// Update mailbox before delivering, which updates uidnext which we mustn't overwrite.
+				err = tx.Update(&mb)
+				xcheckf(err, "updating mailbox counts")
+
+				err = c.account.DeliverMessage(c.log, tx, &a.m, a.file, true, false, false, true)
+				xcheckf(err, "delivering message")
 
-			err = c.account.DeliverMessage(c.log, tx, &m, msgFile, true, false, false, true)
-			xcheckf(err, "delivering message")
+				// Get the new uidnext for the next message.
+				err = tx.Get(&mb)
+				xcheckf(err, "get mailbox")
+			}
 		})
 
 		// Fetch pending changes, possibly with new UIDs, so we can apply them before adding our own new UID.
@@ -3303,18 +3846,82 @@ func (c *conn) cmdAppend(tag, cmd string, p *parser) {
 		}
 
 		// Broadcast the change to other connections.
-		changes = append(changes, m.ChangeAddUID(), mb.ChangeCounts())
+		for _, a := range appends {
+			changes = append(changes, a.m.ChangeAddUID())
+		}
+		changes = append(changes, mb.ChangeCounts())
 		c.broadcast(changes)
 	})
 
+	uids := make([]store.UID, len(appends))
+	for i, a := range appends {
+		uids[i] = a.m.UID
+	}
+
 	if c.mailboxID == mb.ID {
 		c.applyChanges(pendingChanges, false)
-		c.uidAppend(m.UID)
+		for _, uid := range uids {
+			c.uidAppend(uid)
+		}
 		// todo spec: with condstore/qresync, is there a mechanism to the client know the modseq for the appended uid? in theory an untagged fetch with the modseq after the OK APPENDUID could make sense, but this probably isn't allowed.
 		c.bwritelinef("* %d EXISTS", len(c.uids))
+		c.xsearchUpdates(uids)
+	}
+
+	// ../rfc/4315:289 ../rfc/3502
+	c.writeresultf("%s OK [APPENDUID %d %s] appended", tag, mb.UIDValidity, compactUIDSet(uids).String())
+}
+
+// xappendLiteral reads a literal with message data for APPEND into w, and
+// continues parsing with the line following the literal.
+func (c *conn) xappendLiteral(p *parser, size int64, sync bool, w io.Writer) {
+	if sync {
+		c.writelinef("+ ")
+	}
+
+	defer c.xtrace(mlog.LevelTracedata)()
+	n, err := io.Copy(w, io.LimitReader(c.br, size))
+	c.xtrace(mlog.LevelTrace) // Restore.
+	if err != nil {
+		// Cannot use xcheckf due to %w handling of errIO.
+		panic(fmt.Errorf("reading literal message: %s (%w)", err, errIO))
 	}
+	if n != size {
+		xserverErrorf("read %d bytes for message, expected %d (%w)", n, size, errIO)
+	}
+
+	line := c.readline(false)
+	p.orig, p.upper, p.o = line, toUpper(line), 0
+}
+
+// Unauthenticate returns the connection to the not authenticated state, as if
+// it was just established, except that TLS stays active. The selected mailbox is
+// closed without removing messages marked for deletion, the account is released
+// and enabled extensions are reset. The client can then authenticate again,
+// possibly as another user. Credentials from a TLS client certificate are
+// released as well, so the EXTERNAL mechanism cannot be used anymore.
+//
+// State: Authenticated and selected.
+func (c *conn) cmdUnauthenticate(tag, cmd string, p *parser) {
+	// Command: ../rfc/8437
+
+	// Request syntax: ../rfc/8437
+	p.xempty()
+
+	c.unselect()
+	c.searchResult = nil
+	c.enabled = map[capability]bool{}
+
+	c.comm.Unregister()
+	c.comm = nil
+	err := c.account.Close()
+	c.xsanity(err, "close account")
+	c.account = nil
+	c.username = ""
+	c.noPreauth = false
 
-	c.writeresultf("%s OK [APPENDUID %d %d] appended", tag, mb.UIDValidity, m.UID)
+	c.setState(stateNotAuthenticated)
+	c.ok(tag, cmd)
 }
 
 // Idle makes a client wait until the server sends untagged updates, e.g. about
@@ -3337,6 +3944,10 @@ wait:
 		select {
 		case le := <-c.lineChan():
 			c.line = nil
+			if le.err != nil && errors.Is(le.err, os.ErrDeadlineExceeded) {
+				c.writeBye()
+				panic(le.err)
+			}
 			xcheckf(le.err, "get line")
 			line = le.line
 			break wait
@@ -3482,6 +4093,9 @@ func (c *conn) cmdClose(tag, cmd string, p *parser) {
 
 	defer func() {
 		for _, m := range remove {
+			if m.PackID != 0 {
+				continue
+			}
 			p := c.account.MessagePath(m.ID)
 			err := os.Remove(p)
 			c.xsanity(err, "removing message file for expunge for close")
@@ -3556,6 +4170,9 @@ func (c *conn) xexpunge(uidSet *numSet, missingMailboxOK bool) (remove []store.M
 			_, err = qmr.Delete()
 			xcheckf(err, "removing message recipients")
 
+			_, err = bstore.QueryTx[store.TextIndex](tx).FilterIDs(removeIDs).Delete()
+			xcheckf(err, "removing text index")
+
 			qm = bstore.QueryTx[store.Message](tx)
 			qm.FilterIDs(removeIDs)
 			n, err := qm.UpdateNonzero(store.Message{Expunged: true, ModSeq: modseq})
@@ -3658,6 +4275,9 @@ func (c *conn) cmdxExpunge(tag, cmd string, uidSet *numSet) {
 
 	defer func() {
 		for _, m := range remove {
+			if m.PackID != 0 {
+				continue
+			}
 			p := c.account.MessagePath(m.ID)
 			err := os.Remove(p)
 			c.xsanity(err, "removing message file for expunge")
@@ -3700,6 +4320,55 @@ func (c *conn) cmdUIDSearch(tag, cmd string, p *parser) {
 	c.cmdxSearch(true, tag, cmd, p)
 }
 
+// State: Selected
+func (c *conn) cmdSort(tag, cmd string, p *parser) {
+	c.cmdxSort(false, tag, cmd, p)
+}
+
+// State: Selected
+func (c *conn) cmdUIDSort(tag, cmd string, p *parser) {
+	c.cmdxSort(true, tag, cmd, p)
+}
+
+// State: Selected
+func (c *conn) cmdThread(tag, cmd string, p *parser) {
+	c.cmdxThread(false, tag, cmd, p)
+}
+
+// State: Selected
+func (c *conn) cmdUIDThread(tag, cmd string, p *parser) {
+	c.cmdxThread(true, tag, cmd, p)
+}
+
+// Cancelupdate stops sending updates for searches started with the UPDATE return
+// option.
+//
+// State: Selected
+func (c *conn) cmdCancelupdate(tag, cmd string, p *parser) {
+	// Command: ../rfc/5267
+
+	// Request syntax: ../rfc/5267
+	var tags []string
+	for {
+		p.xspace()
+		tags = append(tags, p.xstring())
+		if p.empty() {
+			break
+		}
+	}
+
+	for _, t := range tags {
+		n := len(c.searchUpdates)
+		c.searchUpdates = slices.DeleteFunc(c.searchUpdates, func(su searchUpdate) bool {
+			return su.tag == t
+		})
+		if len(c.searchUpdates) == n {
+			xsyntaxErrorf("no search with updates for tag %q", t)
+		}
+	}
+	c.ok(tag, cmd)
+}
+
 // State: Selected
 func (c *conn) cmdFetch(tag, cmd string, p *parser) {
 	c.cmdxFetch(false, tag, cmd, p)
@@ -3803,6 +4472,7 @@ func (c *conn) cmdxCopy(isUID bool, tag, cmd string, p *parser) {
 		c.xdbwrite(func(tx *bstore.Tx) {
 			mbSrc := c.xmailboxID(tx, c.mailboxID) // Validate.
 			mbDst = c.xmailbox(tx, name, "TRYCREATE")
+			xcheckWritable(mbDst)
 			if mbDst.ID == mbSrc.ID {
 				xuserErrorf("cannot copy to currently selected mailbox")
 			}
@@ -3852,6 +4522,7 @@ func (c *conn) cmdxCopy(isUID bool, tag, cmd string, p *parser) {
 			nmsgs := make([]store.Message, len(xmsgs))
 
 			conf, _ := c.account.Conf()
+			now := time.Now()
 
 			mbKeywords := map[string]struct{}{}
 
@@ -3868,6 +4539,7 @@ func (c *conn) cmdxCopy(isUID bool, tag, cmd string, p *parser) {
 				m.UID = uidFirst + store.UID(i)
 				m.CreateSeq = modseq
 				m.ModSeq = modseq
+				m.SaveDate = &now
 				m.MailboxID = mbDst.ID
 				if m.IsReject && m.MailboxDestinedID != 0 {
 					// Incorrectly delivered to Rejects mailbox. Adjust MailboxOrigID so this message
@@ -3901,6 +4573,16 @@ func (c *conn) cmdxCopy(isUID bool, tag, cmd string, p *parser) {
 					xcheckf(err, "inserting message recipient")
 				}
 
+				ti := store.TextIndex{ID: origID}
+				err = tx.Get(&ti)
+				if err == nil {
+					ti.ID = m.ID
+					err = tx.Insert(&ti)
+					xcheckf(err, "inserting text index")
+				} else if err != bstore.ErrAbsent {
+					xcheckf(err, "get text index")
+				}
+
 				mbDst.Add(m.MailboxCounts())
 			}
 
@@ -3912,6 +4594,10 @@ func (c *conn) cmdxCopy(isUID bool, tag, cmd string, p *parser) {
 			// Copy message files to new message ID's.
 			syncDirs := map[string]struct{}{}
 			for i := range origMsgIDs {
+				// Copies of packed messages share the compressed data in the pack file.
+				if nmsgs[i].PackID != 0 {
+					continue
+				}
 				src := c.account.MessagePath(origMsgIDs[i])
 				dst := c.account.MessagePath(newMsgIDs[i])
 				dstdir := filepath.Dir(dst)
@@ -3984,6 +4670,7 @@ func (c *conn) cmdxMove(isUID bool, tag, cmd string, p *parser) {
 		c.xdbwrite(func(tx *bstore.Tx) {
 			mbSrc = c.xmailboxID(tx, c.mailboxID) // Validate.
 			mbDst = c.xmailbox(tx, name, "TRYCREATE")
+			xcheckWritable(mbDst)
 			if mbDst.ID == c.mailboxID {
 				xuserErrorf("cannot move to currently selected mailbox")
 			}
@@ -3996,6 +4683,7 @@ func (c *conn) cmdxMove(isUID bool, tag, cmd string, p *parser) {
 			uidFirst := mbDst.UIDNext
 			uidnext := uidFirst
 			mbDst.UIDNext += store.UID(len(uids))
+			now := time.Now()
 
 			// Assign a new modseq, for the new records and for the expunged records.
 			var err error
@@ -4046,6 +4734,7 @@ func (c *conn) cmdxMove(isUID bool, tag, cmd string, p *parser) {
 				mbDst.Add(m.MailboxCounts())
 				m.UID = uidnext
 				m.ModSeq = modseq
+				m.SaveDate = &now
 				m.JunkFlagsForMailbox(mbDst, conf)
 				uidnext++
 				err := tx.Update(m)
@@ -4329,6 +5018,16 @@ func (c *conn) cmdxStore(isUID bool, tag, cmd string, p *parser) {
 	// notification will get the flags to the client.
 	// ../rfc/7162:630 ../rfc/3501:3233
 
+	// Changed flags can add messages to or remove messages from results of searches
+	// with updates.
+	if len(c.searchUpdates) > 0 {
+		uids := make([]store.UID, len(updated))
+		for i, m := range updated {
+			uids[i] = m.UID
+		}
+		c.xsearchUpdates(uids)
+	}
+
 	if len(changed) == 0 {
 		c.ok(tag, cmd)
 		return
@@ -12,10 +12,14 @@ import (
 	"os"
 	"path/filepath"
 	"reflect"
+	"regexp"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/mjl-/bstore"
+
+	"github.com/mjl-/mox/config"
 	"github.com/mjl-/mox/imapclient"
 	"github.com/mjl-/mox/mlog"
 	"github.com/mjl-/mox/mox-"
@@ -682,6 +686,58 @@ func TestID(t *testing.T) {
 	tc.transactf("bad", `id ("name" "mox" "name" "mox")`) // Duplicate field.
 }
 
+func TestIDClientRules(t *testing.T) {
+	tc := start(t)
+	defer tc.close()
+	tc2 := startNoSwitchboard(t)
+	defer tc2.close()
+
+	// Set after start, which loads the config.
+	mox.Conf.Dynamic.IMAPClientRules = []config.IMAPClientRule{
+		{
+			ParamsRegexpCompiled: map[string]*regexp.Regexp{"name": regexp.MustCompile("^oldclient$")},
+			Accounts:             []string{"mjl"},
+			Action:               "deny",
+			Message:              "please upgrade",
+		},
+		{
+			ParamsRegexpCompiled: map[string]*regexp.Regexp{"name": regexp.MustCompile("^badclient$")},
+			Action:               "deny",
+		},
+	}
+	defer func() {
+		mox.Conf.Dynamic.IMAPClientRules = nil
+	}()
+
+	// Rule for account only applies after login, the login fails.
+	tc.transactf("ok", `id ("name" "oldclient" "version" "1.0")`)
+	tc.transactf("no", `login mjl@mox.example "%s"`, password0)
+	if !strings.HasSuffix(tc.lastResult.More, "please upgrade") {
+		t.Fatalf("got login result %v, expected message", tc.lastResult)
+	}
+
+	// Allowed client after login, and other ID params are fine.
+	tc.transactf("ok", `id ("name" "goodclient" "Version" "2.0" "os" "test")`)
+	tc.client.Login("mjl@mox.example", password0)
+	tc.transactf("ok", `id ("name" "goodclient" "Version" "2.0" "os" "test")`) // Not counted again.
+
+	l, err := store.IMAPClientList(ctxbg, "mjl")
+	tcheck(t, err, "list imap clients")
+	if len(l) != 2 {
+		t.Fatalf("got %d imap clients, expected 2", len(l))
+	}
+	if c := l[0]; c.Name != "goodclient" || c.Version != "2.0" || c.OS != "test" || c.Count != 1 || c.Denied != 0 || c.Params["version"] != "2.0" {
+		t.Fatalf("unexpected imap client %#v", c)
+	}
+	if c := l[1]; c.Name != "oldclient" || c.Count != 1 || c.Denied != 1 {
+		t.Fatalf("unexpected denied imap client %#v", c)
+	}
+
+	// Denied for all accounts, connection is closed.
+	tc2.cmdf("tag1", `id ("name" "badclient")`)
+	tc2.readprefixline("* BYE email client software not allowed")
+}
+
 func TestSequence(t *testing.T) {
 	tc := start(t)
 	defer tc.close()
@@ -734,3 +790,120 @@ func DisabledTestReference(t *testing.T) {
 	tc2.transactf("ok", "fetch 1 rfc822.size")
 	tc.xuntagged(imapclient.UntaggedFetch{Seq: 1, Attrs: []imapclient.FetchAttr{imapclient.FetchRFC822Size(len(exampleMsg))}})
 }
+
+// Test listener in read-only mode, e.g. for an instance serving a replica during
+// maintenance.
+func TestReadOnlyMode(t *testing.T) {
+	defer mockUIDValidity()()
+	tc := start(t)
+	defer tc.close()
+	tc.client.Login("mjl@mox.example", password0)
+	tc.client.Append("inbox", nil, nil, []byte(exampleMsg))
+
+	setReadOnly := func() error {
+		mox.Conf.Static.Listeners["test"] = config.Listener{IMAPReadOnly: true}
+		return nil
+	}
+	tc2 := startArgsMore(t, false, false, nil, nil, true, false, false, "mjl", setReadOnly)
+	defer tc2.close()
+
+	// Alert after login.
+	tc2.transactf("ok", `login mjl@mox.example "%s"`, password0)
+	tc2.xuntagged(imapclient.UntaggedResult{Status: imapclient.OK, RespText: imapclient.RespText{Code: "ALERT", More: "Read-only access during maintenance, changes are not possible."}})
+
+	// Select opens the mailbox read-only, fetching doesn't mark as read.
+	tc2.transactf("ok", "select inbox")
+	tc2.xcode("READ-ONLY")
+	tc2.transactf("ok", "fetch 1 body[]")
+	tc2.transactf("ok", "fetch 1 flags")
+	tc2.xuntagged(imapclient.UntaggedFetch{Seq: 1, Attrs: []imapclient.FetchAttr{imapclient.FetchUID(1), imapclient.FetchFlags(nil)}})
+	tc2.transactf("ok", `list "" "*"`)
+	tc2.transactf("ok", "status inbox (messages)")
+	tc2.transactf("ok", "search all")
+
+	// Changes are not possible.
+	for _, cmd := range []string{
+		`store 1 +flags (\Seen)`,
+		`uid store 1 +flags (\Seen)`,
+		"copy 1 Trash",
+		"move 1 Trash",
+		"expunge",
+		"uid expunge 1",
+		"create newbox",
+		"delete Trash",
+		"rename Trash Bin",
+		"subscribe inbox",
+		"unsubscribe inbox",
+		"append inbox {1}",
+		`setmetadata inbox (/private/comment "test")`,
+	} {
+		tc2.transactf("no", "%s", cmd)
+		tc2.xcode("UNAVAILABLE")
+	}
+
+	// The regular listener can still change the account.
+	tc.client.Select("inbox")
+	tc.transactf("ok", `store 1 +flags (\Seen)`)
+}
+
+// Test mailbox marked read-only, e.g. an archive that should not change.
+func TestReadOnlyMailbox(t *testing.T) {
+	defer mockUIDValidity()()
+	tc := start(t)
+	defer tc.close()
+	tc.client.Login("mjl@mox.example", password0)
+	tc.client.Append("inbox", nil, nil, []byte(exampleMsg))
+	tc.client.Append("Archive", nil, nil, []byte(exampleMsg))
+
+	err := tc.account.DB.Write(ctxbg, func(tx *bstore.Tx) error {
+		mb, err := tc.account.MailboxFind(tx, "Archive")
+		tcheck(t, err, "find mailbox")
+		mb.ReadOnly = true
+		return tx.Update(mb)
+	})
+	tcheck(t, err, "marking mailbox read-only")
+
+	// Select opens the mailbox read-only, without permanent flags.
+	tc.transactf("ok", "select Archive")
+	tc.xcode("READ-ONLY")
+	tc.xuntaggedOpt(false, imapclient.UntaggedResult{Status: imapclient.OK, RespText: imapclient.RespText{Code: "PERMANENTFLAGS", CodeArg: imapclient.CodeList{Code: "PERMANENTFLAGS", Args: []string{}}, More: "x"}})
+	tc.transactf("ok", "fetch 1 body[]")
+	tc.transactf("ok", "fetch 1 flags")
+	tc.xuntagged(imapclient.UntaggedFetch{Seq: 1, Attrs: []imapclient.FetchAttr{imapclient.FetchUID(1), imapclient.FetchFlags(nil)}})
+
+	tc.transactf("no", `store 1 +flags (\Seen)`)
+	tc.transactf("no", "expunge")
+	tc.transactf("no", "move 1 inbox")
+
+	// Messages can be copied from the mailbox, but not to it.
+	tc.transactf("ok", "copy 1 inbox")
+
+	tc.client.Select("inbox")
+	tc.transactf("no", "copy 1 Archive")
+	tc.xcode("NOPERM")
+	tc.transactf("no", "move 1 Archive")
+	tc.xcode("NOPERM")
+	tc.transactf("no", "append Archive {1}")
+	tc.xcode("NOPERM")
+
+	// Read-only mailbox cannot be renamed or deleted, also not through a parent.
+	tc.transactf("no", "rename Archive Archive2")
+	tc.xcode("NOPERM")
+	tc.transactf("no", "delete Archive")
+	tc.xcode("NOPERM")
+	tc.transactf("ok", "create Parent/Child")
+	err = tc.account.DB.Write(ctxbg, func(tx *bstore.Tx) error {
+		mb, err := tc.account.MailboxFind(tx, "Parent/Child")
+		tcheck(t, err, "find mailbox")
+		mb.ReadOnly = true
+		return tx.Update(mb)
+	})
+	tcheck(t, err, "marking mailbox read-only")
+	tc.transactf("no", "rename Parent Parent2")
+	tc.xcode("NOPERM")
+	tc.transactf("ok", "list \"\" \"Parent*\"")
+	tc.xuntagged(
+		imapclient.UntaggedList{Separator: '/', Mailbox: "Parent"},
+		imapclient.UntaggedList{Separator: '/', Mailbox: "Parent/Child"},
+	)
+}
@@ -0,0 +1,388 @@
+package imapserver
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/mjl-/bstore"
+
+	"github.com/mjl-/mox/message"
+	"github.com/mjl-/mox/store"
+)
+
+// sortMsg is a message matching the search program of a SORT or THREAD command,
+// with the stored data used for sorting and threading.
+type sortMsg struct {
+	seq       msgseq
+	uid       store.UID
+	m         store.Message
+	env       message.Envelope // Zero if message has no parsed envelope.
+	sentDate  time.Time        // From Date header, or received time if absent. ../rfc/5256:171
+	relevancy int              // For FUZZY search keys, 100 otherwise. ../rfc/6203
+}
+
+// num returns the message sequence number or UID for the response.
+func (sm sortMsg) num(isUID bool) uint32 {
+	if isUID {
+		return uint32(sm.uid)
+	}
+	return uint32(sm.seq)
+}
+
+// xsortMatches returns the messages in the selected mailbox matching the search
+// key, in mailbox order. The returned modseq is the highest modseq of the matching
+// messages.
+func (c *conn) xsortMatches(sk *searchKey) (msgs []sortMsg, maxModSeq store.ModSeq, expungeIssued bool) {
+	bodySearch, textSearch := searchWordsPrepare(sk)
+
+	// Note: we only hold the account rlock for verifying the mailbox at the start.
+	c.account.RLock()
+	runlock := c.account.RUnlock
+	// Note: in a defer because we replace it below.
+	defer func() {
+		runlock()
+	}()
+
+	c.xdbread(func(tx *bstore.Tx) {
+		c.xmailboxID(tx, c.mailboxID) // Validate.
+		runlock()
+		runlock = func() {}
+
+		type seqScore struct {
+			seq       msgseq
+			relevancy int
+		}
+		seqs := map[store.UID]seqScore{}
+		for i, uid := range c.uids {
+			if match, _, relevancy := c.searchMatch(tx, msgseq(i+1), uid, *sk, bodySearch, textSearch, &expungeIssued); match {
+				seqs[uid] = seqScore{msgseq(i + 1), relevancy}
+			}
+		}
+		if len(seqs) == 0 {
+			return
+		}
+
+		// Fetch the matching messages in one go for their stored envelope and threading
+		// data.
+		q := bstore.QueryTx[store.Message](tx)
+		q.FilterNonzero(store.Message{MailboxID: c.mailboxID})
+		q.FilterEqual("Expunged", false)
+		err := q.ForEach(func(m store.Message) error {
+			ss, ok := seqs[m.UID]
+			if !ok {
+				return nil
+			}
+			sm := sortMsg{seq: ss.seq, uid: m.UID, m: m, sentDate: m.Received, relevancy: ss.relevancy}
+			// Only the envelope of the parsed message is needed.
+			var partialPart struct {
+				Envelope *message.Envelope
+			}
+			if m.ParsedBuf == nil {
+				c.log.Info("missing parsed message, sorting with empty envelope", slog.Any("uid", m.UID))
+			} else if err := json.Unmarshal(m.ParsedBuf, &partialPart); err != nil {
+				c.log.Errorx("unmarshal parsed message for envelope, sorting with empty envelope", err, slog.Any("uid", m.UID))
+			} else if partialPart.Envelope != nil {
+				sm.env = *partialPart.Envelope
+				if !sm.env.Date.IsZero() {
+					sm.sentDate = sm.env.Date
+				}
+			}
+			if m.ModSeq > maxModSeq {
+				maxModSeq = m.ModSeq
+			}
+			msgs = append(msgs, sm)
+			return nil
+		})
+		xcheckf(err, "listing messages")
+	})
+
+	slices.SortFunc(msgs, func(a, b sortMsg) int {
+		return cmp.Compare(a.seq, b.seq)
+	})
+	return
+}
+
+// sortCriterion is a sort key from a SORT command, optionally reversed.
+type sortCriterion struct {
+	key     string // Upper case, e.g. "ARRIVAL", "SUBJECT", "RELEVANCY".
+	reverse bool
+}
+
+// sortAddress returns the mailbox (localpart) of the first address, lower case
+// for comparison. ../rfc/5256:193
+func sortAddress(l []message.Address) string {
+	if len(l) == 0 {
+		return ""
+	}
+	return strings.ToLower(l[0].User)
+}
+
+// compare compares two messages by the criterion.
+func (sc sortCriterion) compare(a, b sortMsg) int {
+	var r int
+	switch sc.key {
+	case "ARRIVAL":
+		r = a.m.Received.Compare(b.m.Received)
+	case "CC":
+		r = strings.Compare(sortAddress(a.env.CC), sortAddress(b.env.CC))
+	case "DATE":
+		r = a.sentDate.Compare(b.sentDate)
+	case "FROM":
+		r = strings.Compare(sortAddress(a.env.From), sortAddress(b.env.From))
+	case "SIZE":
+		r = cmp.Compare(a.m.Size, b.m.Size)
+	case "SUBJECT":
+		// SubjectBase is the lower-cased base subject. ../rfc/5256:90
+		r = strings.Compare(a.m.SubjectBase, b.m.SubjectBase)
+	case "TO":
+		r = strings.Compare(sortAddress(a.env.To), sortAddress(b.env.To))
+	case "RELEVANCY":
+		// Most relevant first. ../rfc/6203
+		r = cmp.Compare(b.relevancy, a.relevancy)
+	default:
+		panic(serverError{fmt.Errorf("missing case for sort key %q", sc.key)})
+	}
+	if sc.reverse {
+		r = -r
+	}
+	return r
+}
+
+// Sort returns the messages matching the search program, ordered by the sort
+// criteria.
+//
+// State: Selected
+func (c *conn) cmdxSort(isUID bool, tag, cmd string, p *parser) {
+	// Command: ../rfc/5256:124
+	// Examples: ../rfc/5256:568
+	// Syntax: ../rfc/5256:651
+
+	p.xspace()
+	p.xtake("(")
+	var criteria []sortCriterion
+	for {
+		var sc sortCriterion
+		if p.take("REVERSE ") {
+			sc.reverse = true
+		}
+		sc.key = p.xtakelist("ARRIVAL", "CC", "DATE", "FROM", "SIZE", "SUBJECT", "TO", "RELEVANCY")
+		criteria = append(criteria, sc)
+		if p.take(")") {
+			break
+		}
+		p.xspace()
+	}
+	p.xspace()
+	xcheckSearchCharset(p.xastring())
+	p.xspace()
+	sk := p.xsearchProgram()
+
+	msgs, maxModSeq, expungeIssued := c.xsortMatches(sk)
+
+	// Messages that compare equal keep their mailbox order. ../rfc/5256:146
+	slices.SortStableFunc(msgs, func(a, b sortMsg) int {
+		for _, sc := range criteria {
+			if r := sc.compare(a, b); r != 0 {
+				return r
+			}
+		}
+		return 0
+	})
+
+	// All numbers go in a single response, since the order matters.
+	var b strings.Builder
+	b.WriteString("* SORT")
+	for _, sm := range msgs {
+		fmt.Fprintf(&b, " %d", sm.num(isUID))
+	}
+	if sk.hasModseq() && len(msgs) > 0 {
+		// ../rfc/7162:1101
+		fmt.Fprintf(&b, " (MODSEQ %d)", maxModSeq.Client())
+	}
+	c.bwritelinef("%s", b.String())
+
+	if expungeIssued {
+		// ../rfc/9051:5102
+		c.writeresultf("%s OK [EXPUNGEISSUED] done", tag)
+	} else {
+		c.ok(tag, cmd)
+	}
+}
+
+// threadNode is a message in a THREAD response, with its replies. A node without
+// message represents a missing common parent of its children.
+type threadNode struct {
+	msg      *sortMsg
+	children []*threadNode
+}
+
+// date returns the date for ordering threads and siblings: the sent date of the
+// message, or for a missing parent the date of its first child. ../rfc/5256:345
+func (n *threadNode) date() time.Time {
+	if n.msg == nil {
+		return n.children[0].date()
+	}
+	return n.msg.sentDate
+}
+
+// sortThreadNodes orders the nodes and their descendants by date, keeping the
+// existing order for nodes with the same date.
+func sortThreadNodes(l []*threadNode) {
+	for _, n := range l {
+		sortThreadNodes(n.children)
+	}
+	slices.SortStableFunc(l, func(a, b *threadNode) int {
+		return a.date().Compare(b.date())
+	})
+}
+
+// write writes the node and its descendants without the surrounding parentheses.
+// ../rfc/5256:668
+func (n *threadNode) write(b *strings.Builder, isUID bool) {
+	if n.msg != nil {
+		fmt.Fprintf(b, "%d", n.msg.num(isUID))
+		if len(n.children) == 0 {
+			return
+		}
+		b.WriteString(" ")
+		if len(n.children) == 1 {
+			n.children[0].write(b, isUID)
+			return
+		}
+	}
+	for _, cn := range n.children {
+		b.WriteString("(")
+		cn.write(b, isUID)
+		b.WriteString(")")
+	}
+}
+
+// threadOrderedSubject groups messages with the same base subject into a thread,
+// with the earliest message as parent of the others. ../rfc/5256:273
+func threadOrderedSubject(msgs []sortMsg) []*threadNode {
+	slices.SortStableFunc(msgs, func(a, b sortMsg) int {
+		if r := strings.Compare(a.m.SubjectBase, b.m.SubjectBase); r != 0 {
+			return r
+		}
+		return a.sentDate.Compare(b.sentDate)
+	})
+	var roots []*threadNode
+	for i := range msgs {
+		if i > 0 && msgs[i].m.SubjectBase == msgs[i-1].m.SubjectBase {
+			root := roots[len(roots)-1]
+			root.children = append(root.children, &threadNode{msg: &msgs[i]})
+		} else {
+			roots = append(roots, &threadNode{msg: &msgs[i]})
+		}
+	}
+	slices.SortStableFunc(roots, func(a, b *threadNode) int {
+		return a.date().Compare(b.date())
+	})
+	return roots
+}
+
+// threadReferences builds threads from the threading data stored for messages at
+// delivery, which is based on the Message-ID, In-Reply-To and References headers
+// and the base subject, like the REFERENCES algorithm. A message becomes a child
+// of its closest ancestor that is in the result. Messages from the same thread
+// without common ancestor in the result are grouped under a missing parent.
+// ../rfc/5256:300
+func threadReferences(msgs []sortMsg) []*threadNode {
+	nodes := map[int64]*threadNode{}
+	for i := range msgs {
+		nodes[msgs[i].m.ID] = &threadNode{msg: &msgs[i]}
+	}
+
+	var roots []*threadNode
+	for i := range msgs {
+		n := nodes[msgs[i].m.ID]
+		var parent *threadNode
+		for _, id := range msgs[i].m.ThreadParentIDs {
+			if parent = nodes[id]; parent != nil {
+				break
+			}
+		}
+		if parent != nil {
+			parent.children = append(parent.children, n)
+		} else {
+			roots = append(roots, n)
+		}
+	}
+
+	// Group roots from the same thread. ThreadID is 0 if threading has not been
+	// assigned (yet).
+	var l []*threadNode
+	groups := map[int64]*threadNode{}
+	for _, n := range roots {
+		threadID := n.msg.m.ThreadID
+		if threadID == 0 {
+			l = append(l, n)
+			continue
+		}
+		if g, ok := groups[threadID]; !ok {
+			groups[threadID] = n
+			l = append(l, n)
+		} else if g.msg != nil {
+			// Second root of this thread, turn first into a missing parent.
+			ng := *g
+			*g = threadNode{children: []*threadNode{&ng, n}}
+		} else {
+			g.children = append(g.children, n)
+		}
+	}
+
+	sortThreadNodes(l)
+	return l
+}
+
+// Thread returns the messages matching the search program, organized in threads
+// by the requested algorithm.
+//
+// State: Selected
+func (c *conn) cmdxThread(isUID bool, tag, cmd string, p *parser) {
+	// Command: ../rfc/5256:207
+	// Examples: ../rfc/5256:595
+	// Syntax: ../rfc/5256:651
+
+	p.xspace()
+	// Unsupported algorithms result in a BAD response. ../rfc/5256:235
+	algorithm := p.xtakelist("ORDEREDSUBJECT", "REFERENCES")
+	p.xspace()
+	xcheckSearchCharset(p.xastring())
+	p.xspace()
+	sk := p.xsearchProgram()
+
+	msgs, _, expungeIssued := c.xsortMatches(sk)
+
+	var threads []*threadNode
+	switch algorithm {
+	case "ORDEREDSUBJECT":
+		threads = threadOrderedSubject(msgs)
+	case "REFERENCES":
+		threads = threadReferences(msgs)
+	}
+
+	var b strings.Builder
+	b.WriteString("* THREAD")
+	if len(threads) > 0 {
+		b.WriteString(" ")
+	}
+	for _, n := range threads {
+		b.WriteString("(")
+		n.write(&b, isUID)
+		b.WriteString(")")
+	}
+	c.bwritelinef("%s", b.String())
+
+	if expungeIssued {
+		// ../rfc/9051:5102
+		c.writeresultf("%s OK [EXPUNGEISSUED] done", tag)
+	} else {
+		c.ok(tag, cmd)
+	}
+}
@@ -0,0 +1,133 @@
+package imapserver
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mjl-/mox/imapclient"
+)
+
+func sortTestMsg(date, from, to, subject, msgID, inReplyTo string) string {
+	msg := fmt.Sprintf("Date: %s\nFrom: <%s>\n", date, from)
+	if to != "" {
+		msg += fmt.Sprintf("To: <%s>\n", to)
+	}
+	msg += fmt.Sprintf("Subject: %s\nMessage-Id: <%s>\n", subject, msgID)
+	if inReplyTo != "" {
+		msg += fmt.Sprintf("In-Reply-To: <%s>\n", inReplyTo)
+	}
+	msg += "\ntest\n"
+	return strings.ReplaceAll(msg, "\n", "\r\n")
+}
+
+func TestSortThread(t *testing.T) {
+	tc := start(t)
+	defer tc.close()
+	tc.client.Login("mjl@mox.example", password0)
+	tc.client.Select("inbox")
+
+	msgs := []string{
+		sortTestMsg("Mon, 3 Jan 2022 10:00:00 +0100", "b@mox.example", "z@mox.example", "hello", "1@mox.example", ""),
+		sortTestMsg("Sat, 1 Jan 2022 10:00:00 +0100", "a@mox.example", "y@mox.example", "Re: hello", "2@mox.example", "1@mox.example"),
+		sortTestMsg("Sun, 2 Jan 2022 10:00:00 +0100", "c@mox.example", "x@mox.example", "other", "3@mox.example", ""),
+		sortTestMsg("Tue, 4 Jan 2022 10:00:00 +0100", "a@mox.example", "", "Re: hello", "4@mox.example", "2@mox.example"),
+		sortTestMsg("Wed, 5 Jan 2022 10:00:00 +0100", "d@mox.example", "", "Re: hello", "5@mox.example", "1@mox.example"),
+	}
+	// Received in reverse order.
+	for i, msg := range msgs {
+		received := time.Date(2022, time.February, 10-i, 10, 0, 0, 0, time.UTC)
+		tc.client.Append("inbox", nil, &received, []byte(msg))
+	}
+
+	xsort := func(nums ...uint32) {
+		t.Helper()
+		tc.xuntagged(imapclient.UntaggedSort{Nums: nums})
+	}
+
+	tc.transactf("ok", "sort (date) utf-8 all")
+	xsort(2, 3, 1, 4, 5)
+
+	tc.transactf("ok", "uid sort (date) utf-8 all")
+	xsort(2, 3, 1, 4, 5)
+
+	tc.transactf("ok", "sort (arrival) us-ascii all")
+	xsort(5, 4, 3, 2, 1)
+
+	tc.transactf("ok", "sort (reverse arrival) utf-8 all")
+	xsort(1, 2, 3, 4, 5)
+
+	tc.transactf("ok", "sort (from date) utf-8 all")
+	xsort(2, 4, 1, 3, 5)
+
+	tc.transactf("ok", "sort (subject reverse date) utf-8 all")
+	xsort(5, 4, 1, 2, 3)
+
+	// Missing To sorts first, in mailbox order.
+	tc.transactf("ok", "sort (to) utf-8 all")
+	xsort(4, 5, 3, 2, 1)
+
+	tc.transactf("ok", `sort (date) utf-8 subject "hello" not from "d@"`)
+	xsort(2, 1, 4)
+
+	tc.transactf("ok", `sort (date) utf-8 subject "bogus"`)
+	xsort()
+
+	tc.transactf("no", "sort (date) iso-8859-2 all")       // Charset not supported.
+	tc.transactf("bad", "sort (bogus) utf-8 all")          // Unknown sort key.
+	tc.transactf("bad", "sort () utf-8 all")               // At least one sort key.
+	tc.transactf("bad", "sort (date) utf-8")               // Search program required.
+	tc.transactf("bad", "thread bogus utf-8 all")          // Unknown algorithm.
+	tc.transactf("bad", "thread references utf-8")         // Search program required.
+	tc.transactf("no", "thread references iso-8859-2 all") // Charset not supported.
+
+	xthread := func(threads ...imapclient.Thread) {
+		t.Helper()
+		tc.xuntagged(imapclient.UntaggedThread(threads))
+	}
+
+	tc.transactf("ok", "thread orderedsubject utf-8 all")
+	xthread(
+		imapclient.Thread{Num: 2, Children: []imapclient.Thread{{Num: 1}, {Num: 4}, {Num: 5}}},
+		imapclient.Thread{Num: 3},
+	)
+
+	tc.transactf("ok", "thread references utf-8 all")
+	xthread(
+		imapclient.Thread{Num: 3},
+		imapclient.Thread{Num: 1, Children: []imapclient.Thread{{Num: 2, Children: []imapclient.Thread{{Num: 4}}}, {Num: 5}}},
+	)
+
+	tc.transactf("ok", "uid thread references utf-8 all")
+	xthread(
+		imapclient.Thread{Num: 3},
+		imapclient.Thread{Num: 1, Children: []imapclient.Thread{{Num: 2, Children: []imapclient.Thread{{Num: 4}}}, {Num: 5}}},
+	)
+
+	// Without the root message, replies are grouped under a missing parent.
+	tc.transactf("ok", `thread references utf-8 not header message-id "<1@mox.example>"`)
+	xthread(
+		imapclient.Thread{Children: []imapclient.Thread{{Num: 2, Children: []imapclient.Thread{{Num: 4}}}, {Num: 5}}},
+		imapclient.Thread{Num: 3},
+	)
+
+	tc.transactf("ok", `thread references utf-8 subject "bogus"`)
+	xthread()
+
+	// Remove first message, sequence numbers shift but UIDs don't.
+	tc.client.StoreFlagsSet("1", true, `\Deleted`)
+	tc.client.Expunge()
+
+	tc.transactf("ok", "sort (date) utf-8 all")
+	xsort(1, 2, 3, 4)
+
+	tc.transactf("ok", "uid sort (date) utf-8 all")
+	xsort(2, 3, 4, 5)
+
+	tc.transactf("ok", "thread orderedsubject utf-8 all")
+	xthread(
+		imapclient.Thread{Num: 1, Children: []imapclient.Thread{{Num: 3}, {Num: 4}}},
+		imapclient.Thread{Num: 2},
+	)
+}
@@ -66,4 +66,16 @@ func TestStatus(t *testing.T) {
 		},
 	})
 
+	// Size of messages with \Deleted flag, the storage that expunge would reclaim.
+	tc.transactf("ok", "status inbox (deleted-storage)")
+	tc.xuntagged(imapclient.UntaggedStatus{Mailbox: "Inbox", Attrs: map[imapclient.StatusAttr]int64{imapclient.StatusDeletedStorage: 4}})
+
+	tc.client.StoreFlagsClear("1", true, `\Deleted`)
+	tc.transactf("ok", "status inbox (deleted size deleted-storage)")
+	tc.xuntagged(imapclient.UntaggedStatus{Mailbox: "Inbox", Attrs: map[imapclient.StatusAttr]int64{imapclient.StatusDeleted: 0, imapclient.StatusSize: 4, imapclient.StatusDeletedStorage: 0}})
+
+	tc.client.StoreFlagsSet("1", true, `\Deleted`)
+	tc.client.Expunge()
+	tc.transactf("ok", "status inbox (deleted size deleted-storage)")
+	tc.xuntagged(imapclient.UntaggedStatus{Mailbox: "Inbox", Attrs: map[imapclient.StatusAttr]int64{imapclient.StatusDeleted: 0, imapclient.StatusSize: 0, imapclient.StatusDeletedStorage: 0}})
 }
@@ -0,0 +1,50 @@
+package imapserver
+
+import (
+	"testing"
+
+	"github.com/mjl-/mox/imapclient"
+	"github.com/mjl-/mox/store"
+)
+
+func TestUnauthenticate(t *testing.T) {
+	tc := start(t)
+	defer tc.close()
+
+	acc, err := store.OpenAccount(pkglog, "limit", false)
+	tcheck(t, err, "open account")
+	defer func() {
+		err := acc.Close()
+		tcheck(t, err, "close account")
+	}()
+	err = acc.SetPassword(pkglog, password0)
+	tcheck(t, err, "set password")
+
+	tc.transactf("no", "unauthenticate") // Not authenticated.
+
+	tc.client.Login("mjl@mox.example", password0)
+	tc.client.Enable("IMAP4rev2")
+	tc.client.Select("inbox")
+	tc.client.Append("inbox", nil, nil, []byte(exampleMsg))
+	tc.client.StoreFlagsAdd("1", true, `\Deleted`)
+
+	tc.transactf("bad", "unauthenticate bogus") // Leftover data.
+	tc.transactf("ok", "unauthenticate")
+	tc.transactf("no", "fetch 1 all")            // Not selected.
+	tc.transactf("no", "status inbox (uidnext)") // Not authenticated.
+
+	// Authenticate as another user on the same connection.
+	tc.client.Login("limit@mox.example", password0)
+	tc.transactf("ok", "status inbox (messages)")
+	tc.xuntagged(imapclient.UntaggedStatus{Mailbox: "Inbox", Attrs: map[imapclient.StatusAttr]int64{imapclient.StatusMessages: 0}})
+
+	// Message marked as deleted was not removed while unauthenticating.
+	tc.client.Unauthenticate()
+	tc.client.Login("mjl@mox.example", password0)
+	tc.transactf("ok", "status inbox (messages)")
+	tc.xuntagged(imapclient.UntaggedStatus{Mailbox: "Inbox", Attrs: map[imapclient.StatusAttr]int64{imapclient.StatusMessages: 1}})
+
+	// Enabled extensions were reset, so untagged responses are IMAP4rev1.
+	tc.transactf("ok", "select inbox")
+	tc.xuntaggedOpt(false, imapclient.UntaggedRecent(0))
+}
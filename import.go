@@ -2,6 +2,7 @@ package main
 
 import (
 	"bufio"
+	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
@@ -12,43 +13,90 @@ import (
 	"net"
 	"os"
 	"path/filepath"
+	"runtime"
 	"runtime/debug"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"golang.org/x/exp/maps"
 
+	"github.com/mjl-/bstore"
+
 	"github.com/mjl-/mox/config"
+	"github.com/mjl-/mox/dbox"
+	"github.com/mjl-/mox/imapimport"
 	"github.com/mjl-/mox/message"
 	"github.com/mjl-/mox/metrics"
+	"github.com/mjl-/mox/mlog"
 	"github.com/mjl-/mox/mox-"
+	"github.com/mjl-/mox/pst"
 	"github.com/mjl-/mox/store"
 )
 
 // todo: add option to trust imported messages, causing us to look at Authentication-Results and Received-SPF headers and add eg verified spf/dkim/dmarc domains to our store, to jumpstart reputation.
 
-const importCommonHelp = `The mbox/maildir archive is accessed and imported by the running mox process, so
-it must have access to the archive files. The default suggested systemd service
-file isolates mox from most of the file system, with only the "data/" directory
-accessible, so you may want to put the mbox/maildir archive files in a
-directory like "data/import/" to make it available to mox.
+const importCommonHelp = `The mbox/maildir/pst/dbox/mh/babyl archive is accessed and imported by the running mox process,
+so it must have access to the archive files. The default suggested systemd
+service file isolates mox from most of the file system, with only the "data/"
+directory accessible, so you may want to put the archive files in a directory
+like "data/import/" to make it available to mox.
 
 By default, messages will train the junk filter based on their flags and, if
-"automatic junk flags" configuration is set, based on mailbox naming.
+"automatic junk flags" configuration is set, based on mailbox naming. With
+-trainjunk, messages without junk/nonjunk flag are marked and trained as junk
+if they are in the Junk mailbox or a mailbox starting with "junk" or "spam",
+and as not junk if they are in other mailboxes, except for trash and drafts
+mailboxes. A freshly migrated account then starts with a useful junk filter.
+The account must have a junk filter configured.
 
 If the destination mailbox is the Sent mailbox, the recipients of the messages
 are added to the message metadata, causing later incoming messages from these
 recipients to be accepted, unless other reputation signals prevent that.
 
 Users can also import mailboxes/messages through the account web page by
-uploading a zip or tgz file with mbox and/or maildirs.
-
-Messages are imported even if already present. Importing messages twice will
-result in duplicate messages.
+uploading a zip or tgz file with mbox and/or maildirs, or a pst file.
+
+By default, messages are imported even if already present, and importing
+messages twice results in duplicate messages. With -dedup mailbox or -dedup
+account, messages already present in the target mailbox or in any mailbox of the
+account are skipped. Messages are matched by Message-ID, or by their full
+contents if they have no Message-ID.
+
+Messages are committed to the account in batches of 1000. The progress of the
+import is stored in the account as an import job, see "mox import jobs". If an
+import is interrupted, e.g. by a crash, running the same command again with the
+same account, mailbox name and source continues after the last committed
+message. The source must not change in the meantime.
+
+With -keepsource, the position of each imported message in the source, e.g. the
+file and line number for mbox or the file name for maildir, is recorded in the
+account, for cross-referencing and verifying a migration. See "mox import
+sources".
+
+With -dryrun, all messages are read and parsed, but nothing is changed in the
+account. A report is printed with message counts per mailbox, the number of
+messages with each flag and keyword, the messages that could not be parsed, and
+the disk space the messages would use.
 `
 
+const importDedupUsage = `skip messages already present in the target "mailbox" or in the "account"`
+const importDryRunUsage = "only parse the messages and print a report, without importing"
+const importKeepSourceUsage = "record the position in the source of each imported message, see import sources"
+const importTrainJunkUsage = "train the junk filter with messages in junk/spam mailboxes as junk, and messages in other mailboxes as not junk"
+
 func cmdImportMaildir(c *cmd) {
-	c.params = "accountname mailboxname maildir"
+	c.params = "[-dedup mailbox|account] [-dryrun] [-keepsource] [-trainjunk] accountname mailboxname maildir"
+	var dedup string
+	c.flag.StringVar(&dedup, "dedup", "", importDedupUsage)
+	var dryRun bool
+	c.flag.BoolVar(&dryRun, "dryrun", false, importDryRunUsage)
+	var keepSource bool
+	c.flag.BoolVar(&keepSource, "keepsource", false, importKeepSourceUsage)
+	var trainJunk bool
+	c.flag.BoolVar(&trainJunk, "trainjunk", false, importTrainJunkUsage)
 	c.help = `Import a maildir into an account.
 
 ` + importCommonHelp + `
@@ -60,46 +108,425 @@ dovecot-keywords file can specify additional flags, like Forwarded/Junk/NotJunk.
 		c.Usage()
 	}
 	mustLoadConfig()
-	ctlcmdImport(xctl(), false, args[0], args[1], args[2])
+	ctlcmdImport(xctl(), "maildir", args[0], args[1], args[2], dedup, dryRun, keepSource, trainJunk)
 }
 
 func cmdImportMbox(c *cmd) {
-	c.params = "accountname mailboxname mbox"
+	c.params = "[-dialect mboxo|mboxrd|mboxcl|mboxcl2] [-dedup mailbox|account] [-dryrun] [-keepsource] [-trainjunk] accountname mailboxname mbox"
+	var dialect string
+	c.flag.StringVar(&dialect, "dialect", "", "mbox dialect, instead of detecting content-length and unquoting like mboxrd")
+	var dedup string
+	c.flag.StringVar(&dedup, "dedup", "", importDedupUsage)
+	var dryRun bool
+	c.flag.BoolVar(&dryRun, "dryrun", false, importDryRunUsage)
+	var keepSource bool
+	c.flag.BoolVar(&keepSource, "keepsource", false, importKeepSourceUsage)
+	var trainJunk bool
+	c.flag.BoolVar(&trainJunk, "trainjunk", false, importTrainJunkUsage)
 	c.help = `Import an mbox into an account.
 
 Using mbox is not recommended, maildir is a better defined format.
 
+Mbox files come in dialects that differ in how messages are separated and how
+lines starting with "From " in messages are quoted. By default, messages are
+separated by "From " lines after an empty line, or by the size in a
+Content-Length header if the next message starts right after it, and quoted
+lines like ">From " and ">>From " have one ">" removed (as in mboxrd). With
+-dialect, messages are read as mboxo (only ">From " is unquoted), mboxrd,
+mboxcl (like mboxo, with Content-Length headers) or mboxcl2 (with
+Content-Length headers, no quoting). For mboxcl and mboxcl2, a Content-Length
+header that does not match the start of the next message is an error.
+
+` + importCommonHelp
+	args := c.Parse()
+	if len(args) != 3 {
+		c.Usage()
+	}
+	kind := "mbox"
+	if dialect != "" {
+		if !slices.Contains(store.MboxDialects, store.MboxDialect(dialect)) {
+			c.Usage()
+		}
+		kind = dialect
+	}
+	mustLoadConfig()
+	ctlcmdImport(xctl(), kind, args[0], args[1], args[2], dedup, dryRun, keepSource, trainJunk)
+}
+
+func cmdImportPST(c *cmd) {
+	c.params = "[-prefix mailbox] [-dedup mailbox|account] [-dryrun] [-keepsource] [-trainjunk] accountname pstfile"
+	var prefix, dedup string
+	c.flag.StringVar(&dedup, "dedup", "", importDedupUsage)
+	var dryRun bool
+	c.flag.BoolVar(&dryRun, "dryrun", false, importDryRunUsage)
+	var keepSource bool
+	c.flag.BoolVar(&keepSource, "keepsource", false, importKeepSourceUsage)
+	var trainJunk bool
+	c.flag.BoolVar(&trainJunk, "trainjunk", false, importTrainJunkUsage)
+	c.flag.StringVar(&prefix, "prefix", "", "mailbox under which to create the mailboxes for the folders in the pst file")
+	c.help = `Import a Microsoft Outlook PST or OST file into an account.
+
+All mail folders in the file are imported, with their hierarchy, as mailboxes
+with the same names. Folders with contacts, calendar items, etc. are skipped.
+The read, flagged, answered, forwarded and draft states of messages are imported
+as message flags. Messages are reconstructed from the information in the file,
+using the original message headers when present. With -prefix, the mailboxes
+are created below the given mailbox.
+
+Both the older ANSI and newer Unicode formats are supported, without encryption
+or with the default "compressible" encryption. Files with "high" encryption
+cannot be imported.
+
+` + importCommonHelp
+	args := c.Parse()
+	if len(args) != 2 {
+		c.Usage()
+	}
+	mustLoadConfig()
+	ctlcmdImport(xctl(), "pst", args[0], prefix, args[1], dedup, dryRun, keepSource, trainJunk)
+}
+
+func cmdImportDbox(c *cmd) {
+	c.params = "[-prefix mailbox] [-dedup mailbox|account] [-dryrun] [-keepsource] [-trainjunk] accountname dboxdir"
+	var prefix, dedup string
+	c.flag.StringVar(&dedup, "dedup", "", importDedupUsage)
+	var dryRun bool
+	c.flag.BoolVar(&dryRun, "dryrun", false, importDryRunUsage)
+	var keepSource bool
+	c.flag.BoolVar(&keepSource, "keepsource", false, importKeepSourceUsage)
+	var trainJunk bool
+	c.flag.BoolVar(&trainJunk, "trainjunk", false, importTrainJunkUsage)
+	c.flag.StringVar(&prefix, "prefix", "", "mailbox under which to create the mailboxes")
+	c.help = `Import a Dovecot sdbox or mdbox directory into an account.
+
+The dboxdir is the directory with the "mailboxes" directory, and for mdbox the
+"storage" directory. All mailboxes are imported, with the same names. With
+-prefix, the mailboxes are created below the given mailbox.
+
+Message flags and keywords are read from the dovecot.index file of each
+mailbox, and the received time from the message metadata. Dovecot writes recent
+changes to dovecot.index.log first, and only later to dovecot.index. The log
+file is not read, so the most recent flag changes may not be imported. For mdbox, messages are matched to mailboxes through the index.
+Messages that are not in any index are imported into their original mailbox, if
+it was stored with the message. Run "doveadm purge" first to prevent importing
+expunged messages. Messages with attachments stored separately, with Dovecot's
+mail_attachment_dir, and compressed files cannot be imported.
+
+` + importCommonHelp
+	args := c.Parse()
+	if len(args) != 2 {
+		c.Usage()
+	}
+	mustLoadConfig()
+	ctlcmdImport(xctl(), "dbox", args[0], prefix, args[1], dedup, dryRun, keepSource, trainJunk)
+}
+
+func cmdImportMH(c *cmd) {
+	c.params = "[-dedup mailbox|account] [-dryrun] [-keepsource] [-trainjunk] accountname mailboxname mhdir"
+	var dedup string
+	c.flag.StringVar(&dedup, "dedup", "", importDedupUsage)
+	var dryRun bool
+	c.flag.BoolVar(&dryRun, "dryrun", false, importDryRunUsage)
+	var keepSource bool
+	c.flag.BoolVar(&keepSource, "keepsource", false, importKeepSourceUsage)
+	var trainJunk bool
+	c.flag.BoolVar(&trainJunk, "trainjunk", false, importTrainJunkUsage)
+	c.help = `Import an MH folder into an account.
+
+MH folders are used by nmh, mh-e and Claws Mail. Messages are the files with a
+numeric name in the folder directory. Subfolders are not imported, import them
+separately.
+
+Flags are read from the sequences in the .mh_sequences file: Messages not in
+the "unseen" sequence are marked as seen, and sequences "flagged" and "replied"
+set the flagged and answered flags. Other sequences, except "cur", are imported
+as keywords. The received time is taken from the file modification time.
+
+` + importCommonHelp
+	args := c.Parse()
+	if len(args) != 3 {
+		c.Usage()
+	}
+	mustLoadConfig()
+	ctlcmdImport(xctl(), "mh", args[0], args[1], args[2], dedup, dryRun, keepSource, trainJunk)
+}
+
+func cmdImportBabyl(c *cmd) {
+	c.params = "[-dedup mailbox|account] [-dryrun] [-keepsource] [-trainjunk] accountname mailboxname babylfile"
+	var dedup string
+	c.flag.StringVar(&dedup, "dedup", "", importDedupUsage)
+	var dryRun bool
+	c.flag.BoolVar(&dryRun, "dryrun", false, importDryRunUsage)
+	var keepSource bool
+	c.flag.BoolVar(&keepSource, "keepsource", false, importKeepSourceUsage)
+	var trainJunk bool
+	c.flag.BoolVar(&trainJunk, "trainjunk", false, importTrainJunkUsage)
+	c.help = `Import an Emacs Rmail Babyl file into an account.
+
+The unseen, answered, forwarded and deleted attributes of messages are imported
+as flags, and labels as keywords. For messages reformatted by Rmail, the
+original message header is imported.
+
 ` + importCommonHelp
 	args := c.Parse()
 	if len(args) != 3 {
 		c.Usage()
 	}
 	mustLoadConfig()
-	ctlcmdImport(xctl(), true, args[0], args[1], args[2])
+	ctlcmdImport(xctl(), "babyl", args[0], args[1], args[2], dedup, dryRun, keepSource, trainJunk)
+}
+
+func cmdImportJobs(c *cmd) {
+	c.params = "accountname"
+	c.help = `List the import jobs of an account, with their progress.
+
+Imports from files or directories, such as with "mox import mbox", are tracked as
+jobs. Jobs without finish time are still running, or were interrupted and can be
+continued by running the same import command again.
+`
+	args := c.Parse()
+	if len(args) != 1 {
+		c.Usage()
+	}
+	mustLoadConfig()
+	ctlcmdImportJobs(xctl(), args[0])
+}
+
+func ctlcmdImportJobs(ctl *ctl, account string) {
+	ctl.xwrite("importjobs")
+	ctl.xwrite(account)
+	ctl.xreadok()
+	ctl.xstreamto(os.Stdout)
+}
+
+func cmdImportJobRemove(c *cmd) {
+	c.params = "accountname id"
+	c.help = `Remove an import job of an account.
+
+Messages already imported are not removed. An interrupted import of which the
+job is removed is not continued: Running the import command again starts at the
+first message, importing messages again.
+`
+	args := c.Parse()
+	if len(args) != 2 {
+		c.Usage()
+	}
+	id, err := strconv.ParseInt(args[1], 10, 64)
+	xcheckf(err, "parsing id")
+	mustLoadConfig()
+	ctlcmdImportJobRemove(xctl(), args[0], id)
+}
+
+func ctlcmdImportJobRemove(ctl *ctl, account string, id int64) {
+	ctl.xwrite("importjobrm")
+	ctl.xwrite(account)
+	ctl.xwrite(fmt.Sprintf("%d", id))
+	ctl.xreadok()
+}
+
+func cmdImportSources(c *cmd) {
+	c.params = "accountname [mailbox]"
+	c.help = `List the recorded sources of imported messages of an account.
+
+Sources are only recorded for imports with -keepsource. For each message, its
+mailbox, UID, the kind of import, the source as given to the import command (or
+the IMAP URL of the remote mailbox), and the position of the message in the
+source are printed, e.g. file and line number for mbox, file name for maildir,
+UID for IMAP. Sources of messages that have been removed are not printed.
+Sources follow messages that are moved to another mailbox, but not copies.
+`
+	args := c.Parse()
+	if len(args) != 1 && len(args) != 2 {
+		c.Usage()
+	}
+	var mailbox string
+	if len(args) == 2 {
+		mailbox = args[1]
+	}
+	mustLoadConfig()
+	ctlcmdImportSources(xctl(), args[0], mailbox)
+}
+
+func ctlcmdImportSources(ctl *ctl, account, mailbox string) {
+	ctl.xwrite("importsources")
+	ctl.xwrite(account)
+	ctl.xwrite(mailbox)
+	ctl.xreadok()
+	ctl.xstreamto(os.Stdout)
+}
+
+func cmdImportIMAP(c *cmd) {
+	c.params = "[-starttls | -insecure] [-skipverify] [-keepsource] [-trainjunk] accountname address username"
+	var starttls, insecure, skipVerify, keepSource, trainJunk bool
+	c.flag.BoolVar(&starttls, "starttls", false, "connect without tls and switch to tls with starttls, instead of connecting with tls immediately")
+	c.flag.BoolVar(&insecure, "insecure", false, "do not use tls at all, only for testing or trusted networks")
+	c.flag.BoolVar(&skipVerify, "skipverify", false, "do not verify the tls certificate of the remote server")
+	c.flag.BoolVar(&keepSource, "keepsource", false, importKeepSourceUsage)
+	c.flag.BoolVar(&trainJunk, "trainjunk", false, importTrainJunkUsage)
+	c.help = `Import all mailboxes of an account on a remote IMAP server into an account.
+
+The address is the host and port of the remote IMAP server, e.g.
+imap.example.org:993. The password for the remote account is read from stdin.
+The connection to the remote server is made by the running mox process.
+
+All mailboxes are imported, with their hierarchy. Message flags, keywords and
+received times are preserved. Messages are imported in batches, and the progress
+is stored in the account. If the import is interrupted, running the same command
+again continues where it left off. Running the command again later imports only
+messages that were added to the remote mailboxes in the meantime. If the
+UIDVALIDITY of a remote mailbox has changed, all its messages are imported
+again.
+
+With -keepsource, the remote mailbox, as IMAP URL with UIDVALIDITY, and the UID
+of each imported message are recorded in the account. See "mox import sources".
+
+By default, messages will train the junk filter based on their flags and, if
+"automatic junk flags" configuration is set, based on mailbox naming. With
+-trainjunk, messages are also marked and trained as junk or not junk based on
+their mailbox, as with file imports, see "mox help import maildir".
+`
+	args := c.Parse()
+	if len(args) != 3 || starttls && insecure {
+		c.Usage()
+	}
+	mustLoadConfig()
+
+	fmt.Fprintf(os.Stderr, "password: ")
+	scanner := bufio.NewScanner(os.Stdin)
+	scanner.Scan()
+	xcheckf(scanner.Err(), "reading password from stdin")
+	password := scanner.Text()
+
+	mode := "tls"
+	if starttls {
+		mode = "starttls"
+	} else if insecure {
+		mode = "insecure"
+	}
+	ctlcmdImportIMAP(xctl(), args[0], imapimport.Remote{
+		Address:       args[1],
+		STARTTLS:      starttls,
+		Insecure:      insecure,
+		TLSSkipVerify: skipVerify,
+		Username:      args[2],
+		Password:      password,
+	}, mode, keepSource, trainJunk)
+}
+
+func ctlcmdImportIMAP(ctl *ctl, account string, remote imapimport.Remote, mode string, keepSource, trainJunk bool) {
+	ctl.xwrite("importimap")
+	ctl.xwrite(account)
+	ctl.xwrite(remote.Address)
+	ctl.xwrite(mode)
+	ctl.xwrite(fmt.Sprintf("%v", remote.TLSSkipVerify))
+	ctl.xwrite(remote.Username)
+	ctl.xwrite(remote.Password)
+	ctl.xwrite(fmt.Sprintf("%v", keepSource))
+	ctl.xwrite(fmt.Sprintf("%v", trainJunk))
+	ctl.xreadok()
+	fmt.Fprintln(os.Stderr, "importing...")
+	for {
+		line := ctl.xread()
+		if strings.HasPrefix(line, "progress ") {
+			fmt.Fprintf(os.Stderr, "%s...\n", line[len("progress "):])
+			continue
+		}
+		if line != "ok" {
+			log.Fatalf("import, expected ok, got %q", line)
+		}
+		break
+	}
+	count := ctl.xread()
+	fmt.Fprintf(os.Stderr, "%s imported\n", count)
+}
+
+func importimapctl(ctx context.Context, ctl *ctl) {
+	/* protocol:
+	> "importimap"
+	> account
+	> address (host:port of remote server)
+	> mode ("tls", "starttls" or "insecure")
+	> skipverify ("true" or "false")
+	> username
+	> password
+	> keepsource ("true" or "false")
+	> trainjunk ("true" or "false")
+	< "ok" or error
+	< "progress" mailbox count (zero or more times, after each batch)
+	< "ok" when done, or error
+	< count (of total imported messages, only if not error)
+	*/
+	account := ctl.xread()
+	remote := imapimport.Remote{Address: ctl.xread()}
+	switch mode := ctl.xread(); mode {
+	case "tls":
+	case "starttls":
+		remote.STARTTLS = true
+	case "insecure":
+		remote.Insecure = true
+	default:
+		ctl.xcheck(fmt.Errorf("unknown mode %q", mode), "parsing mode")
+	}
+	remote.TLSSkipVerify = ctl.xread() == "true"
+	remote.Username = ctl.xread()
+	remote.Password = ctl.xread()
+	keepSource := ctl.xread() == "true"
+	trainJunk := ctl.xread() == "true"
+
+	ctl.log.Info("importing messages from imap server",
+		slog.String("account", account),
+		slog.String("address", remote.Address),
+		slog.String("username", remote.Username),
+		slog.Bool("keepsource", keepSource),
+		slog.Bool("trainjunk", trainJunk))
+
+	a, err := store.OpenAccount(ctl.log, account, false)
+	ctl.xcheck(err, "opening account")
+	defer func() {
+		err := a.Close()
+		ctl.log.Check(err, "closing account after import")
+	}()
+	ctl.xwriteok()
+
+	n, err := imapimport.Import(ctx, ctl.log, a, remote, keepSource, trainJunk, func(mailbox string, imported int) {
+		ctl.xwrite(fmt.Sprintf("progress %s %d", mailbox, imported))
+	})
+	ctl.log.Info("imported messages from imap server", slog.Int("count", n))
+	ctl.xcheck(err, "importing from imap server")
+	ctl.xwriteok()
+	ctl.xwrite(fmt.Sprintf("%d", n))
 }
 
 func cmdXImportMaildir(c *cmd) {
 	c.unlisted = true
-	c.params = "accountdir mailboxname maildir"
+	c.params = "[-dedup mailbox|account] [-dryrun] [-keepsource] [-trainjunk] accountdir mailboxname maildir"
 	c.help = `Import a maildir into an account by directly accessing the data directory.
 
 
 See "mox help import maildir" for details.
 `
-	xcmdXImport(false, c)
+	xcmdXImport("maildir", c)
 }
 
 func cmdXImportMbox(c *cmd) {
 	c.unlisted = true
-	c.params = "accountdir mailboxname mbox"
+	c.params = "[-dedup mailbox|account] [-dryrun] [-keepsource] [-trainjunk] accountdir mailboxname mbox"
 	c.help = `Import an mbox into an account by directly accessing the data directory.
 
 See "mox help import mbox" for details.
 `
-	xcmdXImport(true, c)
+	xcmdXImport("mbox", c)
 }
 
-func xcmdXImport(mbox bool, c *cmd) {
+func xcmdXImport(kind string, c *cmd) {
+	var dedup string
+	c.flag.StringVar(&dedup, "dedup", "", importDedupUsage)
+	var dryRun bool
+	c.flag.BoolVar(&dryRun, "dryrun", false, importDryRunUsage)
+	var keepSource bool
+	c.flag.BoolVar(&keepSource, "keepsource", false, importKeepSourceUsage)
+	var trainJunk bool
+	c.flag.BoolVar(&trainJunk, "trainjunk", false, importTrainJunkUsage)
 	args := c.Parse()
 	if len(args) != 3 {
 		c.Usage()
@@ -127,28 +554,51 @@ func xcmdXImport(mbox bool, c *cmd) {
 	serverctl := ctl{conn: sconn, r: bufio.NewReader(sconn), log: c.log}
 	go servectlcmd(context.Background(), &serverctl, 0, func() {})
 
-	ctlcmdImport(&clientctl, mbox, account, args[1], args[2])
+	ctlcmdImport(&clientctl, kind, account, args[1], args[2], dedup, dryRun, keepSource, trainJunk)
 }
 
-func ctlcmdImport(ctl *ctl, mbox bool, account, mailbox, src string) {
-	if mbox {
-		ctl.xwrite("importmbox")
-	} else {
-		ctl.xwrite("importmaildir")
-	}
+// ctlcmdImport imports from src of kind "maildir", "mbox", "pst", "dbox", "mh" or
+// "babyl", or an mbox dialect like "mboxrd" for an mbox file read as that dialect. For pst and dbox, mailbox is the optional prefix for the mailboxes in src.
+// If dedup is "mailbox" or "account", messages already present are skipped. If
+// dryRun is set, no messages are imported, a report is printed instead. If
+// keepSource is set, the position in the source of imported messages is recorded.
+// If trainJunk is set, messages are marked as junk or not junk based on their
+// mailbox, and trained.
+func ctlcmdImport(ctl *ctl, kind, account, mailbox, src, dedup string, dryRun, keepSource, trainJunk bool) {
+	ctl.xwrite("import" + kind)
 	ctl.xwrite(account)
 	if strings.EqualFold(mailbox, "Inbox") {
 		mailbox = "Inbox"
 	}
 	ctl.xwrite(mailbox)
 	ctl.xwrite(src)
+	ctl.xwrite(dedup)
+	ctl.xwrite(fmt.Sprintf("%v", dryRun))
+	ctl.xwrite(fmt.Sprintf("%v", keepSource))
+	ctl.xwrite(fmt.Sprintf("%v", trainJunk))
 	ctl.xreadok()
-	fmt.Fprintln(os.Stderr, "importing...")
+	var jobID int64
+	var done, total int
+	_, err := fmt.Sscanf(ctl.xread(), "%d %d %d", &jobID, &done, &total)
+	xcheckf(err, "parsing import job")
+	if done > 0 {
+		fmt.Fprintf(os.Stderr, "continuing interrupted import job %d at message %d of %d...\n", jobID, done+1, total)
+	} else if jobID != 0 {
+		fmt.Fprintf(os.Stderr, "importing %d messages, job %d...\n", total, jobID)
+	} else {
+		fmt.Fprintln(os.Stderr, "importing...")
+	}
 	for {
 		line := ctl.xread()
 		if strings.HasPrefix(line, "progress ") {
-			n := line[len("progress "):]
-			fmt.Fprintf(os.Stderr, "%s...\n", n)
+			var n, total int
+			_, err := fmt.Sscanf(line, "progress %d %d", &n, &total)
+			xcheckf(err, "parsing progress")
+			if total > 0 {
+				fmt.Fprintf(os.Stderr, "%d/%d...\n", n, total)
+			} else {
+				fmt.Fprintf(os.Stderr, "%d...\n", n)
+			}
 			continue
 		}
 		if line != "ok" {
@@ -157,38 +607,50 @@ func ctlcmdImport(ctl *ctl, mbox bool, account, mailbox, src string) {
 		break
 	}
 	count := ctl.xread()
-	fmt.Fprintf(os.Stderr, "%s imported\n", count)
+	skipped := ctl.xread()
+	if dryRun {
+		fmt.Fprintf(os.Stderr, "%s messages parsed, %s duplicates would be skipped, nothing imported\n", count, skipped)
+		ctl.xstreamto(os.Stdout)
+		return
+	}
+	fmt.Fprintf(os.Stderr, "%s imported, %s duplicates skipped\n", count, skipped)
 }
 
-func importctl(ctx context.Context, ctl *ctl, mbox bool) {
+func importctl(ctx context.Context, ctl *ctl, kind string) {
 	/* protocol:
-	> "importmaildir" or "importmbox"
+	> "importmaildir", "importmbox", "importpst", "importdbox", "importmh" or "importbabyl", or "import" with an mbox dialect, e.g. "importmboxrd"
 	> account
-	> mailbox
-	> src (mbox file or maildir directory)
+	> mailbox (for pst and dbox, prefix for mailboxes, can be empty)
+	> src (mbox file, maildir directory, pst file, dbox directory, mh directory or babyl file)
+	> dedup ("", "mailbox" or "account")
+	> dryrun ("true" or "false")
+	> keepsource ("true" or "false")
+	> trainjunk ("true" or "false")
 	< "ok" or error
-	< "progress" count (zero or more times, once for every 1000 messages)
+	< job id, messages done and total, separated by space (done is non-zero when continuing an interrupted import, all zero for dryrun)
+	< "progress" done total (zero or more times, once for every 1000 messages, total is zero for dryrun)
 	< "ok" when done, or error
-	< count (of total imported messages, only if not error)
+	< count (of messages imported by this command, only if not error)
+	< skipped (count of duplicate messages skipped by this command, only if not error)
+	< stream (report, only for dryrun)
 	*/
 	account := ctl.xread()
 	mailbox := ctl.xread()
 	src := ctl.xread()
+	dedupScope := ctl.xread()
+	dryRun := ctl.xread() == "true"
+	keepSource := ctl.xread() == "true"
+	trainJunk := ctl.xread() == "true"
 
-	kind := "maildir"
-	if mbox {
-		kind = "mbox"
-	}
 	ctl.log.Info("importing messages",
 		slog.String("kind", kind),
 		slog.String("account", account),
 		slog.String("mailbox", mailbox),
-		slog.String("source", src))
-
-	var err error
-	var mboxf *os.File
-	var mdnewf, mdcurf *os.File
-	var msgreader store.MsgSource
+		slog.String("source", src),
+		slog.String("dedup", dedupScope),
+		slog.Bool("dryrun", dryRun),
+		slog.Bool("keepsource", keepSource),
+		slog.Bool("trainjunk", trainJunk))
 
 	// Open account, creating a database file if it doesn't exist yet. It must be known
 	// in the configuration file.
@@ -204,40 +666,67 @@ func importctl(ctx context.Context, ctl *ctl, mbox bool) {
 	err = a.ThreadingWait(ctl.log)
 	ctl.xcheck(err, "waiting for account thread upgrade")
 
-	defer func() {
-		if mboxf != nil {
-			err := mboxf.Close()
-			ctl.log.Check(err, "closing mbox file after import")
-		}
-		if mdnewf != nil {
-			err := mdnewf.Close()
-			ctl.log.Check(err, "closing maildir new after import")
-		}
-		if mdcurf != nil {
-			err := mdcurf.Close()
-			ctl.log.Check(err, "closing maildir cur after import")
-		}
-	}()
+	dedup, err := store.NewImportDedup(a, dedupScope)
+	ctl.xcheck(err, "checking dedup scope")
+
+	if conf, _ := a.Conf(); trainJunk && conf.JunkFilter == nil {
+		ctl.xcheck(errors.New("account has no junk filter configured"), "checking junk filter for training")
+	}
 
 	// Messages don't always have a junk flag set. We'll assume anything in a mailbox
 	// starting with junk or spam is junk mail.
 
-	// First check if we can access the mbox/maildir.
+	// First check if we can access the mbox/maildir/pst/dbox/mh/babyl.
 	// Mox needs to be able to access those files, the user running the import command
 	// may be a different user who can access the files.
-	if mbox {
-		mboxf, err = os.Open(src)
-		ctl.xcheck(err, "open mbox file")
-		msgreader = store.NewMboxReader(ctl.log, store.CreateMessageTemp, src, mboxf)
-	} else {
-		mdnewf, err = os.Open(filepath.Join(src, "new"))
-		ctl.xcheck(err, "open subdir new of maildir")
-		mdcurf, err = os.Open(filepath.Join(src, "cur"))
-		ctl.xcheck(err, "open subdir cur of maildir")
-		msgreader = store.NewMaildirReader(ctl.log, store.CreateMessageTemp, mdnewf, mdcurf)
+	msgreader, mailboxreader, closeSource, err := importSource(ctl.log, kind, src)
+	ctl.xcheck(err, "opening import source")
+	defer closeSource()
+
+	// Continue an interrupted import of the same source into the same mailbox, or
+	// start a new job after counting the messages. A dry run doesn't keep track of
+	// progress.
+	var job store.ImportJob
+	if !dryRun {
+		q := bstore.QueryDB[store.ImportJob](ctx, a.DB)
+		q.FilterNonzero(store.ImportJob{Kind: kind, Source: src})
+		q.FilterEqual("Mailbox", mailbox)
+		q.FilterEqual("Finished", time.Time{})
+		q.SortDesc("Started")
+		q.Limit(1)
+		job, err = q.Get()
+		if err == bstore.ErrAbsent {
+			total, err := importCount(ctl.log, kind, src)
+			ctl.xcheck(err, "counting messages")
+			job = store.ImportJob{Kind: kind, Source: src, Mailbox: mailbox, Total: total, Updated: time.Now()}
+			err = a.DB.Insert(ctx, &job)
+			ctl.xcheck(err, "adding import job")
+		} else {
+			ctl.xcheck(err, "looking up import job")
+		}
+	}
+
+	// Skip the messages committed by the interrupted import. We verify the position of
+	// the last of those messages, so we don't continue with a changed source.
+	if job.Done > 0 {
+		ctl.log.Info("continuing interrupted import", slog.Int64("job", job.ID), slog.Int("done", job.Done), slog.Int("total", job.Total))
+		var position string
+		for i := range job.Done {
+			_, msgf, origPath, err := msgreader.Next()
+			if err == io.EOF {
+				err = fmt.Errorf("source has %d messages, expected at least %d", i, job.Done)
+			}
+			ctl.xcheck(err, "skipping messages already imported")
+			store.CloseRemoveTempFile(ctl.log, msgf, "message already imported")
+			position = origPath
+		}
+		if position != job.Position {
+			ctl.xcheck(fmt.Errorf("last imported message was at %q, now at %q, remove import job %d to import from the start", job.Position, position, job.ID), "source changed since interrupted import")
+		}
 	}
 
-	tx, err := a.DB.Begin(ctx, true)
+	// A dry run only reads from the account, the transaction is rolled back.
+	tx, err := a.DB.Begin(ctx, !dryRun)
 	ctl.xcheck(err, "begin transaction")
 	defer func() {
 		if tx != nil {
@@ -248,8 +737,10 @@ func importctl(ctx context.Context, ctl *ctl, mbox bool) {
 
 	// All preparations done. Good to go.
 	ctl.xwriteok()
+	ctl.xwrite(fmt.Sprintf("%d %d %d", job.ID, job.Done, job.Total))
 
-	// We will be delivering messages. If we fail halfway, we need to remove the created msg files.
+	// We will be delivering messages. If we fail halfway, we need to remove the
+	// created msg files of the batch that wasn't committed.
 	var deliveredIDs []int64
 
 	defer func() {
@@ -277,7 +768,7 @@ func importctl(ctx context.Context, ctl *ctl, mbox bool) {
 
 	var changes []store.Change
 
-	var modseq store.ModSeq // Assigned on first delivered messages, used for all messages.
+	var modseq store.ModSeq // Assigned on first delivered message of a batch, used for all messages in the batch.
 
 	xdeliver := func(m *store.Message, mf *os.File) {
 		// todo: possibly set dmarcdomain to the domain of the from address? at least for non-spams that have been seen. otherwise user would start without any reputations. the assumption would be that the user has accepted email and deemed it legit, coming from the indicated sender.
@@ -293,16 +784,60 @@ func importctl(ctx context.Context, ctl *ctl, mbox bool) {
 		changes = append(changes, m.ChangeAddUID())
 	}
 
-	// todo: one goroutine for reading messages, one for parsing the message, one adding to database, one for junk filter training.
-	n := 0
-	a.WithWLock(func() {
-		// Ensure mailbox exists.
-		var mb store.Mailbox
-		mb, changes, err = a.MailboxEnsure(tx, mailbox, true)
-		ctl.xcheck(err, "ensuring mailbox exists")
+	report := importReport{mailboxes: map[string]*importReportMailbox{}, flags: map[string]int{}}
 
-		// We ensure keywords in messages make it to the mailbox as well.
-		mailboxKeywords := map[string]bool{}
+	// Messages are committed in batches, with the progress of the job.
+	const batchSize = 1000
+
+	n := 0    // Messages imported by this command, or parsed for a dry run.
+	done := 0 // Messages read from the source by this command, including skipped messages.
+	var position string
+	imported, skipped := job.Imported, job.Skipped
+	withLock := a.WithWLock
+	if dryRun {
+		withLock = a.WithRLock
+	}
+	withLock(func() {
+		// Mailboxes we import into. We ensure keywords in messages make it to the
+		// mailbox as well.
+		type importMailbox struct {
+			mb       store.Mailbox
+			keywords map[string]bool
+		}
+		mailboxes := map[string]*importMailbox{}
+		var mailboxNames []string // In order of first use.
+		xmailbox := func(name string) *importMailbox {
+			if imb, ok := mailboxes[name]; ok {
+				return imb
+			}
+			var mb store.Mailbox
+			if dryRun {
+				xmb, err := a.MailboxFind(tx, name)
+				ctl.xcheck(err, "looking up mailbox")
+				if xmb != nil {
+					mb = *xmb
+				} else {
+					// Mailboxes that would be created get a negative ID, so no existing messages
+					// are found when checking for duplicates.
+					mb = store.Mailbox{ID: -int64(len(mailboxes) + 1), Name: name}
+				}
+				report.mailbox(name, xmb == nil)
+			} else {
+				var nchanges []store.Change
+				mb, nchanges, err = a.MailboxEnsure(tx, name, true)
+				ctl.xcheck(err, "ensuring mailbox exists")
+				changes = append(changes, nchanges...)
+			}
+			imb := &importMailbox{mb, map[string]bool{}}
+			mailboxes[name] = imb
+			mailboxNames = append(mailboxNames, name)
+			return imb
+		}
+
+		// Ensure mailbox exists, also when there are no messages.
+		if mailboxreader == nil {
+			xmailbox(mailbox)
+		}
 
 		jf, _, err := a.OpenJunkFilter(ctx, ctl.log)
 		if err != nil && !errors.Is(err, store.ErrNoJunkFilter) {
@@ -323,44 +858,120 @@ func importctl(ctx context.Context, ctl *ctl, mbox bool) {
 		err = tx.Get(&du)
 		ctl.xcheck(err, "get disk usage")
 
-		process := func(m *store.Message, msgf *os.File, origPath string) {
-			defer store.CloseRemoveTempFile(ctl.log, msgf, "message to import")
+		// Finish the current batch: assign threads, update the mailboxes, disk usage and
+		// the job, and commit. Unless this is the final batch, a new transaction is
+		// started.
+		xcommit := func(final bool) {
+			if len(deliveredIDs) > 0 {
+				err = a.AssignThreads(ctx, ctl.log, tx, deliveredIDs[0], 0, io.Discard)
+				ctl.xcheck(err, "assigning messages to threads")
+			}
 
-			addSize += m.Size
-			if maxSize > 0 && du.MessageSize+addSize > maxSize {
-				ctl.xcheck(fmt.Errorf("account over maximum total message size %d", maxSize), "checking quota")
+			for _, name := range mailboxNames {
+				imb := mailboxes[name]
+				mb := imb.mb
+
+				// Get mailbox again, uidnext is likely updated.
+				mc := mb.MailboxCounts
+				err = tx.Get(&mb)
+				ctl.xcheck(err, "get mailbox")
+				mb.MailboxCounts = mc
+
+				// If there are any new keywords, update the mailbox.
+				var mbKwChanged bool
+				mb.Keywords, mbKwChanged = store.MergeKeywords(mb.Keywords, maps.Keys(imb.keywords))
+				if mbKwChanged {
+					changes = append(changes, mb.ChangeKeywords())
+				}
+
+				err = tx.Update(&mb)
+				ctl.xcheck(err, "updating message counts and keywords in mailbox")
+				changes = append(changes, mb.ChangeCounts())
+				imb.mb = mb
 			}
 
-			for _, kw := range m.Keywords {
-				mailboxKeywords[kw] = true
+			err = a.AddMessageSize(ctl.log, tx, addSize)
+			ctl.xcheck(err, "updating total message size")
+
+			job.Done += done
+			job.Imported = imported
+			job.Skipped = skipped
+			if done > 0 {
+				job.Position = position
 			}
-			mb.Add(m.MailboxCounts())
+			job.Updated = time.Now()
+			if final {
+				job.Finished = job.Updated
+			}
+			err = tx.Update(&job)
+			ctl.xcheck(err, "updating import job")
 
-			// Parse message and store parsed information for later fast retrieval.
-			p, err := message.EnsurePart(ctl.log.Logger, false, msgf, m.Size)
-			if err != nil {
-				ctl.log.Infox("parsing message, continuing", err, slog.String("path", origPath))
+			// The junk filter is saved before committing. If the commit fails, the filter has
+			// been trained with messages that will be imported again, which is harmless.
+			if jf != nil {
+				err = jf.Save()
+				ctl.xcheck(err, "saving junk filter")
 			}
-			m.ParsedBuf, err = json.Marshal(p)
-			ctl.xcheck(err, "marshal parsed message structure")
 
-			// Set fields needed for future threading. By doing it now, DeliverMessage won't
-			// have to parse the Part again.
-			p.SetReaderAt(store.FileMsgReader(m.MsgPrefix, msgf))
-			m.PrepareThreading(ctl.log, &p)
+			err = tx.Commit()
+			ctl.xcheck(err, "commit")
+			tx = nil
+			ctl.log.Debug("committed import batch", slog.Int64("job", job.ID), slog.Int("delivered", len(deliveredIDs)), slog.Int("done", job.Done))
+			deliveredIDs = nil
+			store.BroadcastChanges(a, changes)
+			changes = nil
+			modseq = 0
+			du.MessageSize += addSize
+			addSize = 0
+			done = 0
+
+			if !final {
+				tx, err = a.DB.Begin(ctx, true)
+				ctl.xcheck(err, "begin transaction")
+			}
+		}
 
-			if m.Received.IsZero() {
-				if p.Envelope != nil && !p.Envelope.Date.IsZero() {
-					m.Received = p.Envelope.Date
-				} else {
-					m.Received = time.Now()
+		// Messages have been read and parsed by the pipeline, they are delivered in order
+		// of the source.
+		process := func(im *importMsg, imb *importMailbox) {
+			defer store.CloseRemoveTempFile(ctl.log, im.f, "message to import")
+			m, msgf, origPath, p, perr := im.m, im.f, im.origPath, im.part, im.perr
+
+			m.MailboxID = imb.mb.ID
+			m.MailboxOrigID = imb.mb.ID
+			if dedup != nil {
+				dup, err := dedup.Duplicate(tx, m, msgf)
+				ctl.xcheck(err, "checking for duplicate message")
+				if dup {
+					skipped++
+					return
 				}
 			}
 
+			addSize += m.Size
+			if maxSize > 0 && du.MessageSize+addSize > maxSize {
+				ctl.xcheck(fmt.Errorf("account over maximum total message size %d", maxSize), "checking quota")
+			}
+
+			for _, kw := range m.Keywords {
+				imb.keywords[kw] = true
+			}
+			imb.mb.Add(m.MailboxCounts())
+
 			// We set the flags that Deliver would set now and train ourselves. This prevents
 			// Deliver from training, which would open the junk filter, change it, and write it
 			// back to disk, for each message (slow).
-			m.JunkFlagsForMailbox(mb, conf)
+			m.JunkFlagsForMailbox(imb.mb, conf)
+			if trainJunk {
+				m.JunkFlagsForImport(imb.mb)
+			}
+
+			if dryRun {
+				report.add(imb.mb.Name, m, origPath, perr)
+				n++
+				return
+			}
+
 			if jf != nil && m.NeedsTraining() {
 				if words, err := jf.ParseMessage(p); err != nil {
 					ctl.log.Infox("parsing message for updating junk filter", err, slog.String("parse", ""), slog.String("path", origPath))
@@ -377,67 +988,382 @@ func importctl(ctx context.Context, ctl *ctl, mbox bool) {
 				ctl.xcheck(err, "assigning next modseq")
 			}
 
-			m.MailboxID = mb.ID
-			m.MailboxOrigID = mb.ID
 			m.CreateSeq = modseq
 			m.ModSeq = modseq
 			xdeliver(m, msgf)
-
+			if keepSource {
+				err := tx.Insert(&store.ImportSource{MessageID: m.ID, Kind: kind, Source: src, Position: origPath})
+				ctl.xcheck(err, "recording source of message")
+			}
 			n++
-			if n%1000 == 0 {
-				ctl.xwrite(fmt.Sprintf("progress %d", n))
+			imported++
+		}
+
+		msgs, stopPipeline := importPipeline(ctl.log, msgreader, mailboxreader)
+		defer stopPipeline()
+
+		for count := job.Done + 1; ; count++ {
+			im, ok := <-msgs
+			if !ok {
+				break
+			}
+			<-im.ready
+			ctl.xcheck(im.err, "reading next message")
+
+			name := mailbox
+			if mailboxreader != nil {
+				name = im.mailbox
+				if mailbox != "" {
+					name = mailbox + "/" + name
+				}
+				name, _, err = store.CheckMailboxName(name, true)
+				if err != nil {
+					store.CloseRemoveTempFile(ctl.log, im.f, "message to import")
+					ctl.xcheck(err, "checking mailbox name")
+				}
+			}
+			process(im, xmailbox(name))
+			done++
+			position = im.origPath
+
+			if count%batchSize == 0 {
+				if !dryRun {
+					xcommit(false)
+				}
+				ctl.xwrite(fmt.Sprintf("progress %d %d", count, job.Total))
 			}
 		}
 
+		if dryRun {
+			report.diskUsage = du.MessageSize
+			report.quota = maxSize
+			err = tx.Rollback()
+			ctl.log.Check(err, "rolling back transaction for dry run")
+			tx = nil
+			return
+		}
+
+		xcommit(true)
+		ctl.log.Info("delivered messages through import", slog.Int("count", n), slog.Int64("job", job.ID))
+	})
+
+	err = a.Close()
+	ctl.xcheck(err, "closing account")
+	a = nil
+
+	ctl.xwriteok()
+	ctl.xwrite(fmt.Sprintf("%d", n))
+	var nskipped int
+	if dedup != nil {
+		nskipped = dedup.Skipped
+	}
+	ctl.xwrite(fmt.Sprintf("%d", nskipped))
+	if dryRun {
+		var b bytes.Buffer
+		report.write(&b)
+		ctl.xstreamfrom(&b)
+	}
+}
+
+// importMsg is a message read and parsed by the import pipeline.
+type importMsg struct {
+	m        *store.Message
+	f        *os.File
+	origPath string
+	mailbox  string // From mailboxreader at time of reading, if any.
+	err      error  // Reading the message failed. Stops the import.
+
+	read func() (*store.Message, *os.File, error) // For store.MsgSourceDeferred, called by a worker.
+
+	part  message.Part
+	perr  error         // Parsing the message failed. The message is still imported.
+	ready chan struct{} // Closed when the fields above are set.
+}
+
+// prepare parses the message and sets fields of the message that don't depend on
+// the account.
+func (im *importMsg) prepare(log mlog.Log) {
+	// Parse message and store parsed information for later fast retrieval.
+	im.part, im.perr = message.EnsurePart(log.Logger, false, im.f, im.m.Size)
+	if im.perr != nil {
+		log.Infox("parsing message, continuing", im.perr, slog.String("path", im.origPath))
+	}
+	im.m.ParsedBuf, im.err = json.Marshal(im.part)
+	if im.err != nil {
+		im.err = fmt.Errorf("marshal parsed message structure: %v", im.err)
+		return
+	}
+
+	// Set fields needed for future threading. By doing it now, DeliverMessage won't
+	// have to parse the Part again.
+	im.part.SetReaderAt(store.FileMsgReader(im.m.MsgPrefix, im.f))
+	im.m.PrepareThreading(log, &im.part)
+
+	if im.m.Received.IsZero() {
+		if im.part.Envelope != nil && !im.part.Envelope.Date.IsZero() {
+			im.m.Received = im.part.Envelope.Date
+		} else {
+			im.m.Received = time.Now()
+		}
+	}
+}
+
+// importPipeline reads messages from msgreader in a goroutine, and parses them
+// with a bounded number of parallel workers. For sources implementing
+// store.MsgSourceDeferred, messages are also read and converted by the workers.
+// Messages are returned on the channel in order of the source, and must be waited
+// on through their ready channel. The channel is closed after the last message, or
+// after a message with a read error. Calling stop ends the pipeline and removes
+// temporary files of messages not yet returned.
+func importPipeline(log mlog.Log, msgreader store.MsgSource, mailboxreader interface{ Mailbox() string }) (msgs <-chan *importMsg, stop func()) {
+	nworkers := min(runtime.GOMAXPROCS(0), 8)
+	ordered := make(chan *importMsg, 4*nworkers)
+	work := make(chan *importMsg, 4*nworkers)
+	quit := make(chan struct{})
+	var wg sync.WaitGroup
+
+	for range nworkers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for im := range work {
+				if im.read != nil {
+					im.m, im.f, im.err = im.read()
+				}
+				if im.err == nil {
+					im.prepare(log)
+				}
+				close(im.ready)
+			}
+		}()
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer close(work)
+		defer close(ordered)
+
+		dr, _ := msgreader.(store.MsgSourceDeferred)
 		for {
-			m, msgf, origPath, err := msgreader.Next()
-			if err == io.EOF {
-				break
+			im := &importMsg{ready: make(chan struct{})}
+			if dr != nil {
+				im.origPath, im.read, im.err = dr.NextDeferred()
+			} else {
+				im.m, im.f, im.origPath, im.err = msgreader.Next()
+			}
+			if im.err == io.EOF {
+				return
 			}
-			ctl.xcheck(err, "reading next message")
+			if im.err == nil && mailboxreader != nil {
+				im.mailbox = mailboxreader.Mailbox()
+			}
+			if im.err != nil {
+				close(im.ready)
+			}
+			select {
+			case ordered <- im:
+			case <-quit:
+				if im.f != nil {
+					store.CloseRemoveTempFile(log, im.f, "message to import")
+				}
+				return
+			}
+			if im.err != nil {
+				return
+			}
+			select {
+			case work <- im:
+			case <-quit:
+				// Message is in ordered, its resources are cleaned up by stop.
+				close(im.ready)
+				return
+			}
+		}
+	}()
 
-			process(m, msgf, origPath)
+	stop = func() {
+		close(quit)
+		wg.Wait()
+		for im := range ordered {
+			if im.f != nil {
+				store.CloseRemoveTempFile(log, im.f, "message to import")
+			}
 		}
+	}
+	return ordered, stop
+}
 
-		// Match threads.
-		if len(deliveredIDs) > 0 {
-			err = a.AssignThreads(ctx, ctl.log, tx, deliveredIDs[0], 0, io.Discard)
-			ctl.xcheck(err, "assigning messages to threads")
+// importSource opens the messages of kind at src for reading. For sources with
+// multiple mailboxes, mailboxreader returns the mailbox of the last message read.
+// The returned close function closes any files opened for the source.
+func importSource(log mlog.Log, kind, src string) (msgreader store.MsgSource, mailboxreader interface{ Mailbox() string }, close func(), rerr error) {
+	var files []*os.File
+	closeFiles := func() {
+		for _, f := range files {
+			err := f.Close()
+			log.Check(err, "closing import source", slog.String("path", f.Name()))
+		}
+	}
+	defer func() {
+		if rerr != nil {
+			closeFiles()
 		}
+	}()
+	open := func(p string) (*os.File, error) {
+		f, err := os.Open(p)
+		if err == nil {
+			files = append(files, f)
+		}
+		return f, err
+	}
 
-		// Get mailbox again, uidnext is likely updated.
-		mc := mb.MailboxCounts
-		err = tx.Get(&mb)
-		ctl.xcheck(err, "get mailbox")
-		mb.MailboxCounts = mc
+	switch kind {
+	case "mbox", string(store.MboxO), string(store.MboxRD), string(store.MboxCL), string(store.MboxCL2):
+		f, err := open(src)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("open mbox file: %v", err)
+		}
+		dialect := store.MboxAuto
+		if kind != "mbox" {
+			dialect = store.MboxDialect(kind)
+		}
+		msgreader = store.NewMboxReader(log, store.CreateMessageTemp, src, f, dialect)
+	case "maildir":
+		newf, err := open(filepath.Join(src, "new"))
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("open subdir new of maildir: %v", err)
+		}
+		curf, err := open(filepath.Join(src, "cur"))
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("open subdir cur of maildir: %v", err)
+		}
+		msgreader = store.NewMaildirReader(log, store.CreateMessageTemp, newf, curf)
+	case "pst":
+		f, err := open(src)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("open pst file: %v", err)
+		}
+		pstreader, err := pst.NewReader(log, store.CreateMessageTemp, f)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("reading pst file: %v", err)
+		}
+		msgreader, mailboxreader = pstreader, pstreader
+	case "dbox":
+		dboxreader, err := dbox.NewReader(log, store.CreateMessageTemp, src)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("reading dbox directory: %v", err)
+		}
+		msgreader, mailboxreader = dboxreader, dboxreader
+	case "mh":
+		mhreader, err := store.NewMHReader(log, store.CreateMessageTemp, src)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("reading mh folder: %v", err)
+		}
+		msgreader = mhreader
+	case "babyl":
+		f, err := open(src)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("open babyl file: %v", err)
+		}
+		msgreader = store.NewBabylReader(log, store.CreateMessageTemp, src, f)
+	default:
+		return nil, nil, nil, fmt.Errorf("unknown kind %q", kind)
+	}
+	return msgreader, mailboxreader, closeFiles, nil
+}
 
-		// If there are any new keywords, update the mailbox.
-		var mbKwChanged bool
-		mb.Keywords, mbKwChanged = store.MergeKeywords(mb.Keywords, maps.Keys(mailboxKeywords))
-		if mbKwChanged {
-			changes = append(changes, mb.ChangeKeywords())
+// importCount returns the number of messages in the source, for reporting
+// progress. The messages are read and discarded.
+func importCount(log mlog.Log, kind, src string) (int, error) {
+	msgreader, _, closeSource, err := importSource(log, kind, src)
+	if err != nil {
+		return 0, err
+	}
+	defer closeSource()
+	var n int
+	for {
+		_, msgf, _, err := msgreader.Next()
+		if err == io.EOF {
+			return n, nil
+		} else if err != nil {
+			return n, err
 		}
+		store.CloseRemoveTempFile(log, msgf, "counted message")
+		n++
+	}
+}
 
-		err = tx.Update(&mb)
-		ctl.xcheck(err, "updating message counts and keywords in mailbox")
-		changes = append(changes, mb.ChangeCounts())
+// importReport describes the messages parsed in a dry run of an import.
+type importReport struct {
+	mailboxes    map[string]*importReportMailbox
+	mailboxNames []string       // In order of first use.
+	flags        map[string]int // Flag or keyword to number of messages.
+	unparseable  []string       // Source path and parse error.
+	size         int64          // Total size of all messages.
+	diskUsage    int64          // Current total size of messages in account.
+	quota        int64          // Maximum total size of messages, 0 for unlimited.
+}
 
-		err = a.AddMessageSize(ctl.log, tx, addSize)
-		xcheckf(err, "updating total message size")
+type importReportMailbox struct {
+	new      bool // Mailbox does not exist yet.
+	messages int
+	size     int64
+}
 
-		err = tx.Commit()
-		ctl.xcheck(err, "commit")
-		tx = nil
-		ctl.log.Info("delivered messages through import", slog.Int("count", len(deliveredIDs)))
-		deliveredIDs = nil
+func (r *importReport) mailbox(name string, isNew bool) {
+	r.mailboxes[name] = &importReportMailbox{new: isNew}
+	r.mailboxNames = append(r.mailboxNames, name)
+}
 
-		store.BroadcastChanges(a, changes)
-	})
+func (r *importReport) add(mailbox string, m *store.Message, origPath string, parseErr error) {
+	rmb := r.mailboxes[mailbox]
+	rmb.messages++
+	rmb.size += m.Size
+	r.size += m.Size
+	for _, f := range m.Flags.Strings() {
+		r.flags[f]++
+	}
+	for _, kw := range m.Keywords {
+		r.flags[kw]++
+	}
+	if parseErr != nil {
+		r.unparseable = append(r.unparseable, fmt.Sprintf("%s: %v", origPath, parseErr))
+	}
+}
 
-	err = a.Close()
-	ctl.xcheck(err, "closing account")
-	a = nil
+func (r *importReport) write(w io.Writer) {
+	fmt.Fprintln(w, "Mailboxes:")
+	for _, name := range r.mailboxNames {
+		rmb := r.mailboxes[name]
+		var isNew string
+		if rmb.new {
+			isNew = " (new)"
+		}
+		fmt.Fprintf(w, "\t%s%s: %d messages, %d bytes\n", name, isNew, rmb.messages, rmb.size)
+	}
 
-	ctl.xwriteok()
-	ctl.xwrite(fmt.Sprintf("%d", n))
+	fmt.Fprintln(w, "\nMessages with flags and keywords:")
+	if len(r.flags) == 0 {
+		fmt.Fprintln(w, "\t(none)")
+	}
+	flags := maps.Keys(r.flags)
+	slices.Sort(flags)
+	for _, f := range flags {
+		fmt.Fprintf(w, "\t%s: %d\n", f, r.flags[f])
+	}
+
+	fmt.Fprintf(w, "\nUnparseable messages, would be imported without message structure: %d\n", len(r.unparseable))
+	for _, s := range r.unparseable {
+		fmt.Fprintf(w, "\t%s\n", s)
+	}
+
+	fmt.Fprintf(w, "\nEstimated disk usage: %d bytes, account total would be %d bytes", r.size, r.diskUsage+r.size)
+	if r.quota > 0 {
+		fmt.Fprintf(w, " of maximum %d bytes", r.quota)
+		if r.diskUsage+r.size > r.quota {
+			fmt.Fprint(w, ", import would fail")
+		}
+	}
+	fmt.Fprintln(w)
 }
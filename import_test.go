@@ -0,0 +1,78 @@
+//go:build !integration
+
+package main
+
+import (
+	"os"
+	"slices"
+	"testing"
+
+	"github.com/mjl-/mox/mox-"
+	"github.com/mjl-/mox/store"
+)
+
+func TestImportPipeline(t *testing.T) {
+	// Temporary message files are created in testdata/importpipeline/tmp.
+	os.RemoveAll("testdata/importpipeline")
+	defer os.RemoveAll("testdata/importpipeline")
+	origPath, origDataDir := mox.ConfigStaticPath, mox.Conf.Static.DataDir
+	defer func() {
+		mox.ConfigStaticPath, mox.Conf.Static.DataDir = origPath, origDataDir
+	}()
+	mox.ConfigStaticPath = "testdata/importpipeline/mox.conf"
+	mox.Conf.Static.DataDir = "."
+	checkTemp := func() {
+		t.Helper()
+		l, err := os.ReadDir("testdata/importpipeline/tmp")
+		tcheck(t, err, "list temporary files")
+		if len(l) != 0 {
+			t.Fatalf("temporary files left behind: %v", l)
+		}
+	}
+
+	for _, kind := range []string{"mbox", "maildir"} {
+		src := "testdata/importtest." + kind
+
+		// Messages are returned in order of the source.
+		var exp []string
+		msgreader, _, closeSource, err := importSource(pkglog, kind, src)
+		tcheck(t, err, "open source")
+		for {
+			_, f, origPath, err := msgreader.Next()
+			if err != nil {
+				break
+			}
+			store.CloseRemoveTempFile(pkglog, f, "test message")
+			exp = append(exp, origPath)
+		}
+		closeSource()
+
+		msgreader, _, closeSource, err = importSource(pkglog, kind, src)
+		tcheck(t, err, "open source")
+		msgs, stop := importPipeline(pkglog, msgreader, nil)
+		var got []string
+		for im := range msgs {
+			<-im.ready
+			tcheck(t, im.err, "reading message")
+			if im.m.ParsedBuf == nil || im.m.Received.IsZero() {
+				t.Fatalf("message not prepared: %#v", im.m)
+			}
+			store.CloseRemoveTempFile(pkglog, im.f, "test message")
+			got = append(got, im.origPath)
+		}
+		stop()
+		closeSource()
+		checkTemp()
+		if len(got) == 0 || !slices.Equal(got, exp) {
+			t.Fatalf("%s: got messages %v, expected %v", kind, got, exp)
+		}
+
+		// Stopping early doesn't leave temporary files behind.
+		msgreader, _, closeSource, err = importSource(pkglog, kind, src)
+		tcheck(t, err, "open source")
+		_, stop = importPipeline(pkglog, msgreader, nil)
+		stop()
+		closeSource()
+		checkTemp()
+	}
+}
@@ -357,6 +357,12 @@ func writeLocalConfig(log mlog.Log, dir, ip string) (rerr error) {
 	local.WebAPIHTTPS.Enabled = true
 	local.WebAPIHTTPS.Port = 1443
 	local.WebAPIHTTPS.Path = "/webapi/"
+	local.JMAPHTTP.Enabled = true
+	local.JMAPHTTP.Port = 1080
+	local.JMAPHTTP.Path = "/jmap/"
+	local.JMAPHTTPS.Enabled = true
+	local.JMAPHTTPS.Port = 1443
+	local.JMAPHTTPS.Path = "/jmap/"
 	local.AdminHTTP.Enabled = true
 	local.AdminHTTP.Port = 1080
 	local.AdminHTTPS.Enabled = true
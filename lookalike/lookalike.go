@@ -0,0 +1,171 @@
+// Package lookalike generates and recognizes lookalike domains: Domains that
+// differ from a domain by a typical typo, or by characters that look similar
+// (homoglyphs), as used in phishing messages that impersonate a domain.
+//
+// Variants are made of the organizational domain, e.g. "example.com" for
+// "mail.example.com": Of its first label with typos and homoglyphs, and with a
+// few common other top-level domains.
+package lookalike
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"sync"
+
+	"github.com/mjl-/mox/dns"
+	"github.com/mjl-/mox/publicsuffix"
+)
+
+// Kinds of variants.
+const (
+	KindOmission      = "omission"      // Character left out, "exmple.com".
+	KindRepetition    = "repetition"    // Character repeated, "exxample.com".
+	KindTransposition = "transposition" // Adjacent characters swapped, "exmaple.com".
+	KindReplacement   = "replacement"   // Character replaced by an adjacent key on a keyboard, "exanple.com".
+	KindHyphenation   = "hyphenation"   // Hyphen added, "ex-ample.com".
+	KindHomoglyph     = "homoglyph"     // Character(s) replaced by similar looking character(s), "examp1e.com", or with a cyrillic "а".
+	KindTLD           = "tld"           // Other top-level domain, "example.net".
+)
+
+// Variant is a lookalike domain.
+type Variant struct {
+	Domain dns.Domain
+	Kind   string
+}
+
+// Keys adjacent on a QWERTY keyboard.
+var adjacentKeys = map[rune]string{
+	'1': "2q", '2': "13qw", '3': "24we", '4': "35er", '5': "46rt", '6': "57ty", '7': "68yu", '8': "79ui", '9': "80io", '0': "9op",
+	'q': "12wa", 'w': "23qeas", 'e': "34wrsd", 'r': "45etdf", 't': "56ryfg", 'y': "67tugh", 'u': "78yihj", 'i': "89uojk", 'o': "90ipkl", 'p': "0ol",
+	'a': "qwsz", 's': "weadzx", 'd': "erfsxc", 'f': "rtgdcv", 'g': "tyhfvb", 'h': "yujgbn", 'j': "uikhnm", 'k': "iolmj", 'l': "opk",
+	'z': "asx", 'x': "sdzc", 'c': "dfxv", 'v': "fgcb", 'b': "ghvn", 'n': "hjbm", 'm': "jkn",
+}
+
+// Characters, or sequences, that look like others.
+var homoglyphs = map[string][]string{
+	"a":  {"а", "á", "à", "ä"}, // Cyrillic a, and accented.
+	"b":  {"6"},
+	"c":  {"с"}, // Cyrillic.
+	"d":  {"cl"},
+	"e":  {"е", "é", "è"}, // Cyrillic e, and accented.
+	"g":  {"q", "9"},
+	"h":  {"һ"}, // Cyrillic shha.
+	"i":  {"1", "l", "і", "í"},
+	"j":  {"ј"}, // Cyrillic je.
+	"l":  {"1", "i"},
+	"m":  {"rn", "nn"},
+	"o":  {"0", "о", "ó", "ö"}, // Zero, Cyrillic o, and accented.
+	"p":  {"р"},                // Cyrillic er.
+	"q":  {"g"},
+	"s":  {"5", "ѕ"}, // Five, Cyrillic dze.
+	"u":  {"v", "ü"},
+	"v":  {"u"},
+	"w":  {"vv"},
+	"x":  {"х"}, // Cyrillic ha.
+	"y":  {"у"}, // Cyrillic u.
+	"z":  {"2"},
+	"0":  {"o"},
+	"1":  {"l", "i"},
+	"5":  {"s"},
+	"cl": {"d"},
+	"nn": {"m"},
+	"rn": {"m"},
+	"vv": {"w"},
+}
+
+// Top-level domains that are commonly registered as alternative for a domain.
+var otherTLDs = []string{"com", "net", "org", "co", "io", "info", "biz"}
+
+// Variants returns lookalike domains of the organizational domain of d. The
+// organizational domain itself is not included. Variants that are not valid
+// domain names are skipped.
+func Variants(ctx context.Context, elog *slog.Logger, d dns.Domain) []Variant {
+	org := publicsuffix.Lookup(ctx, elog, d)
+	label, suffix, ok := strings.Cut(org.Name(), ".")
+	if !ok {
+		return nil
+	}
+
+	var l []Variant
+	seen := map[string]bool{org.Name(): true}
+	add := func(kind, label, suffix string) {
+		if label == "" || strings.HasPrefix(label, "-") || strings.HasSuffix(label, "-") {
+			return
+		}
+		name := label + "." + suffix
+		if seen[name] {
+			return
+		}
+		seen[name] = true
+		vd, err := dns.ParseDomain(name)
+		if err != nil || vd.ASCII == org.ASCII {
+			return
+		}
+		l = append(l, Variant{vd, kind})
+	}
+
+	r := []rune(label)
+	for i := range r {
+		if len(r) > 1 {
+			add(KindOmission, string(r[:i])+string(r[i+1:]), suffix)
+		}
+	}
+	for i := range r {
+		add(KindRepetition, string(r[:i+1])+string(r[i:]), suffix)
+	}
+	for i := 0; i+1 < len(r); i++ {
+		if r[i] != r[i+1] {
+			add(KindTransposition, string(r[:i])+string(r[i+1])+string(r[i])+string(r[i+2:]), suffix)
+		}
+	}
+	for i, c := range r {
+		for _, k := range adjacentKeys[c] {
+			add(KindReplacement, string(r[:i])+string(k)+string(r[i+1:]), suffix)
+		}
+	}
+	for i := 1; i < len(r); i++ {
+		if r[i-1] != '-' && r[i] != '-' {
+			add(KindHyphenation, string(r[:i])+"-"+string(r[i:]), suffix)
+		}
+	}
+	for i := range r {
+		for n := 1; n <= 2 && i+n <= len(r); n++ {
+			for _, repl := range homoglyphs[string(r[i:i+n])] {
+				add(KindHomoglyph, string(r[:i])+repl+string(r[i+n:]), suffix)
+			}
+		}
+	}
+	for _, tld := range otherTLDs {
+		add(KindTLD, label, tld)
+	}
+	return l
+}
+
+// Cache of variants by domain, for Match. Keyed by ASCII names, domains in
+// messages may only have the ASCII form set.
+var cache = struct {
+	sync.Mutex
+	variants map[string]map[string]string
+}{variants: map[string]map[string]string{}}
+
+// Match returns whether the organizational domain of d is a variant of the
+// organizational domain of own, as returned by Variants, and the kind of variant.
+// Variants of own are cached.
+func Match(ctx context.Context, elog *slog.Logger, d, own dns.Domain) (kind string, ok bool) {
+	ownOrg := publicsuffix.Lookup(ctx, elog, own)
+	cache.Lock()
+	kinds, ok := cache.variants[ownOrg.ASCII]
+	cache.Unlock()
+	if !ok {
+		kinds = map[string]string{}
+		for _, v := range Variants(ctx, elog, ownOrg) {
+			kinds[v.Domain.ASCII] = v.Kind
+		}
+		cache.Lock()
+		cache.variants[ownOrg.ASCII] = kinds
+		cache.Unlock()
+	}
+	kind, ok = kinds[publicsuffix.Lookup(ctx, elog, d).ASCII]
+	return kind, ok
+}
@@ -0,0 +1,53 @@
+package lookalike
+
+import (
+	"context"
+	"testing"
+
+	"github.com/mjl-/mox/dns"
+	"github.com/mjl-/mox/mlog"
+)
+
+var pkglog = mlog.New("lookalike", nil)
+
+func TestVariants(t *testing.T) {
+	ctx := context.Background()
+
+	l := Variants(ctx, pkglog.Logger, dns.Domain{ASCII: "mail.example.com"})
+	kinds := map[string]string{}
+	for _, v := range l {
+		kinds[v.Domain.Name()] = v.Kind
+	}
+	exp := map[string]string{
+		"exmple.com":   KindOmission,
+		"exxample.com": KindRepetition,
+		"exmaple.com":  KindTransposition,
+		"exanple.com":  KindReplacement,
+		"ex-ample.com": KindHyphenation,
+		"examp1e.com":  KindHomoglyph,
+		"exarnple.com": KindHomoglyph,
+		"еxample.com":  KindHomoglyph, // Cyrillic е.
+		"example.net":  KindTLD,
+	}
+	for name, kind := range exp {
+		if kinds[name] != kind {
+			t.Fatalf("variant %s: got kind %q, expected %q", name, kinds[name], kind)
+		}
+	}
+	if _, ok := kinds["example.com"]; ok {
+		t.Fatalf("domain itself is a variant")
+	}
+
+	match := func(d, own string, expKind string) {
+		t.Helper()
+		kind, ok := Match(ctx, pkglog.Logger, dns.Domain{ASCII: d}, dns.Domain{ASCII: own})
+		if ok != (expKind != "") || kind != expKind {
+			t.Fatalf("match %s for %s: got %q, %v, expected %q", d, own, kind, ok, expKind)
+		}
+	}
+	match("examp1e.com", "example.com", KindHomoglyph)
+	match("mail.exmaple.com", "example.com", KindTransposition)
+	match("xn--xample-2of.com", "example.com", KindHomoglyph)
+	match("example.com", "example.com", "")
+	match("other.com", "example.com", "")
+}
@@ -54,6 +54,7 @@ import (
 	"github.com/mjl-/mox/dmarcrpt"
 	"github.com/mjl-/mox/dns"
 	"github.com/mjl-/mox/dnsbl"
+	"github.com/mjl-/mox/junk"
 	"github.com/mjl-/mox/message"
 	"github.com/mjl-/mox/mlog"
 	"github.com/mjl-/mox/mox-"
@@ -104,6 +105,7 @@ var commands = []struct {
 	{"quickstart", cmdQuickstart},
 	{"stop", cmdStop},
 	{"setaccountpassword", cmdSetaccountpassword},
+	{"setaccountpasswordhash", cmdSetaccountpasswordhash},
 	{"setadminpassword", cmdSetadminpassword},
 	{"loglevels", cmdLoglevels},
 	{"queue holdrules list", cmdQueueHoldrulesList},
@@ -132,10 +134,21 @@ var commands = []struct {
 	{"queue webhook retired print", cmdQueueHookRetiredPrint},
 	{"import maildir", cmdImportMaildir},
 	{"import mbox", cmdImportMbox},
+	{"import imap", cmdImportIMAP},
+	{"import pst", cmdImportPST},
+	{"import dbox", cmdImportDbox},
+	{"import mh", cmdImportMH},
+	{"import babyl", cmdImportBabyl},
+	{"import jobs", cmdImportJobs},
+	{"import jobrm", cmdImportJobRemove},
+	{"import sources", cmdImportSources},
 	{"export maildir", cmdExportMaildir},
 	{"export mbox", cmdExportMbox},
+	{"export eml", cmdExportEML},
+	{"mailbox readonly", cmdMailboxReadonly},
 	{"localserve", cmdLocalserve},
 	{"help", cmdHelp},
+	{"backup prune", cmdBackupPrune},
 	{"backup", cmdBackup},
 	{"verifydata", cmdVerifydata},
 	{"licenses", cmdLicenses},
@@ -149,12 +162,17 @@ var commands = []struct {
 	{"config account rm", cmdConfigAccountRemove},
 	{"config account disable", cmdConfigAccountDisable},
 	{"config account enable", cmdConfigAccountEnable},
+	{"config account suspend", cmdConfigAccountSuspend},
+	{"config account resume", cmdConfigAccountResume},
+	{"config account snapshot", cmdConfigAccountSnapshot},
+	{"config account restore", cmdConfigAccountRestore},
 	{"config address add", cmdConfigAddressAdd},
 	{"config address rm", cmdConfigAddressRemove},
 	{"config domain add", cmdConfigDomainAdd},
 	{"config domain rm", cmdConfigDomainRemove},
 	{"config domain disable", cmdConfigDomainDisable},
 	{"config domain enable", cmdConfigDomainEnable},
+	{"config domain lookalikes", cmdConfigDomainLookalikes},
 	{"config tlspubkey list", cmdConfigTlspubkeyList},
 	{"config tlspubkey get", cmdConfigTlspubkeyGet},
 	{"config tlspubkey add", cmdConfigTlspubkeyAdd},
@@ -167,6 +185,13 @@ var commands = []struct {
 	{"config alias rm", cmdConfigAliasRemove},
 	{"config alias addaddr", cmdConfigAliasAddaddr},
 	{"config alias rmaddr", cmdConfigAliasRemoveaddr},
+	{"config domainadmin list", cmdConfigDomainadminList},
+	{"config domainadmin add", cmdConfigDomainadminAdd},
+	{"config domainadmin rm", cmdConfigDomainadminRemove},
+	{"config domainadmin setpassword", cmdConfigDomainadminSetpassword},
+	{"config admintoken list", cmdConfigAdmintokenList},
+	{"config admintoken add", cmdConfigAdmintokenAdd},
+	{"config admintoken rm", cmdConfigAdmintokenRemove},
 
 	{"config describe-sendmail", cmdConfigDescribeSendmail},
 	{"config printservice", cmdConfigPrintservice},
@@ -183,6 +208,7 @@ var commands = []struct {
 	{"dane dial", cmdDANEDial},
 	{"dane dialmx", cmdDANEDialmx},
 	{"dane makerecord", cmdDANEMakeRecord},
+	{"dialcheck", cmdDialcheck},
 	{"dns lookup", cmdDNSLookup},
 	{"dkim gened25519", cmdDKIMGened25519},
 	{"dkim genrsa", cmdDKIMGenrsa},
@@ -198,6 +224,8 @@ var commands = []struct {
 	{"dnsbl checkhealth", cmdDNSBLCheckhealth},
 	{"mtasts lookup", cmdMTASTSLookup},
 	{"rdap domainage", cmdRDAPDomainage},
+	{"passwordfilter make", cmdPasswordfilterMake},
+	{"passwordfilter check", cmdPasswordfilterCheck},
 	{"retrain", cmdRetrain},
 	{"sendmail", cmdSendmail},
 	{"spf check", cmdSPFCheck},
@@ -218,6 +246,13 @@ var commands = []struct {
 	{"recalculatemailboxcounts", cmdRecalculateMailboxCounts},
 	{"message parse", cmdMessageParse},
 	{"reassignthreads", cmdReassignthreads},
+	{"archivepack", cmdArchivepack},
+	{"autoarchive", cmdAutoarchive},
+	{"compressmsgs", cmdCompressmsgs},
+	{"encryptmsgs", cmdEncryptmsgs},
+	{"messageencryption genkey", cmdMessageencryptionGenkey},
+	{"textindexrebuild", cmdTextindexrebuild},
+	{"fsck", cmdFsck},
 
 	// Not listed.
 	{"helpall", cmdHelpall},
@@ -800,6 +835,44 @@ func ctlcmdConfigDomainDisabled(ctl *ctl, d dns.Domain, disabled bool) {
 	ctl.xreadok()
 }
 
+func cmdConfigDomainLookalikes(c *cmd) {
+	c.params = "[-dns] domain"
+	c.help = `List lookalike domains of a domain.
+
+Lookalike domains have typical typos, or characters that look similar. They
+can be used in phishing messages that impersonate the domain. Incoming messages
+from lookalikes of a hosted domain can be rejected or treated as junk with the
+LookalikeSenders field in the domain configuration.
+
+With -dns, DNS is queried for each lookalike to check if it is registered, and
+the MX records of registered lookalikes are printed.
+`
+	var checkDNS bool
+	c.flag.BoolVar(&checkDNS, "dns", false, "look up whether lookalikes are registered and their mx records")
+	args := c.Parse()
+	if len(args) != 1 {
+		c.Usage()
+	}
+
+	d := xparseDomain(args[0], "domain")
+	l := admin.LookalikeDomains(context.Background(), dns.StrictResolver{Pkg: "lookalike"}, d, checkDNS)
+	if !checkDNS {
+		fmt.Printf("%-30s %s\n", "Domain", "Kind")
+		for _, ld := range l {
+			fmt.Printf("%-30s %s\n", ld.Domain, ld.Kind)
+		}
+		return
+	}
+	fmt.Printf("%-30s %-14s %-10s %s\n", "Domain", "Kind", "Registered", "MX")
+	for _, ld := range l {
+		mx := strings.Join(ld.MX, ",")
+		if ld.Error != "" {
+			mx = "error: " + ld.Error
+		}
+		fmt.Printf("%-30s %-14s %-10v %s\n", ld.Domain, ld.Kind, ld.Registered, mx)
+	}
+}
+
 func cmdConfigAliasList(c *cmd) {
 	c.params = "domain"
 	c.help = `Show aliases (lists) for domain.`
@@ -946,26 +1019,188 @@ func ctlcmdConfigAliasRmaddr(ctl *ctl, alias string, addresses []string) {
 	ctl.xreadok()
 }
 
+func cmdConfigDomainadminList(c *cmd) {
+	c.help = `List domain admins and the domains they manage.`
+	if len(c.Parse()) != 0 {
+		c.Usage()
+	}
+
+	mustLoadConfig()
+	ctlcmdConfigDomainadminList(xctl())
+}
+
+func ctlcmdConfigDomainadminList(ctl *ctl) {
+	ctl.xwrite("domainadminlist")
+	ctl.xreadok()
+	ctl.xstreamto(os.Stdout)
+}
+
+func cmdConfigDomainadminAdd(c *cmd) {
+	c.params = "name domain ..."
+	c.help = `Add a domain admin that can only manage the listed domains.
+
+A domain admin logs in to the admin web interface with its name and password.
+It can manage the listed domains, and the accounts and addresses in those
+domains. The domains do not have to exist yet, the domain admin can add them.
+Accounts with addresses outside the listed domains cannot be managed. Set a
+password with "mox config domainadmin setpassword".
+`
+	args := c.Parse()
+	if len(args) < 2 {
+		c.Usage()
+	}
+
+	mustLoadConfig()
+	ctlcmdConfigDomainadminAdd(xctl(), args[0], args[1:])
+}
+
+func ctlcmdConfigDomainadminAdd(ctl *ctl, name string, domains []string) {
+	ctl.xwrite("domainadminadd")
+	ctl.xwrite(name)
+	xctlwriteJSON(ctl, domains)
+	ctl.xreadok()
+}
+
+func cmdConfigDomainadminRemove(c *cmd) {
+	c.params = "name"
+	c.help = `Remove a domain admin. Its existing sessions can no longer be used.`
+	args := c.Parse()
+	if len(args) != 1 {
+		c.Usage()
+	}
+
+	mustLoadConfig()
+	ctlcmdConfigDomainadminRemove(xctl(), args[0])
+}
+
+func ctlcmdConfigDomainadminRemove(ctl *ctl, name string) {
+	ctl.xwrite("domainadminrm")
+	ctl.xwrite(name)
+	ctl.xreadok()
+}
+
+func cmdConfigDomainadminSetpassword(c *cmd) {
+	c.params = "name"
+	c.help = `Set a new password for a domain admin.
+
+The password is read from stdin. Its bcrypt hash is stored in the domain admin
+config in domains.conf.
+`
+	args := c.Parse()
+	if len(args) != 1 {
+		c.Usage()
+	}
+	mustLoadConfig()
+
+	pw := xreadpassword()
+
+	ctlcmdConfigDomainadminSetpassword(xctl(), args[0], pw)
+}
+
+func ctlcmdConfigDomainadminSetpassword(ctl *ctl, name, password string) {
+	ctl.xwrite("domainadminsetpassword")
+	ctl.xwrite(name)
+	ctl.xwrite(password)
+	ctl.xreadok()
+}
+
+func cmdConfigAdmintokenList(c *cmd) {
+	c.help = `List admin API tokens, with their domain admin and allowed functions.`
+	if len(c.Parse()) != 0 {
+		c.Usage()
+	}
+
+	mustLoadConfig()
+	ctlcmdConfigAdmintokenList(xctl())
+}
+
+func ctlcmdConfigAdmintokenList(ctl *ctl) {
+	ctl.xwrite("admintokenlist")
+	ctl.xreadok()
+	ctl.xstreamto(os.Stdout)
+}
+
+func cmdConfigAdmintokenAdd(c *cmd) {
+	c.params = "[-domainadmin name] name [function ...]"
+	c.help = `Add an admin API token and print it.
+
+The token can be used to call the admin web API functions without logging in,
+by sending JSON HTTP POST requests to /admin/api/<function> with header
+"Authorization: Bearer <token>". The request body is a JSON object with field
+"params" holding the list of parameters. The functions are documented at
+/admin/api/.
+
+If functions are listed, the token can only call those functions. With
+-domainadmin, the token has the permissions of that domain admin.
+
+Only a hash of the token is stored in domains.conf, the token is only printed
+once.
+`
+	var domainAdmin string
+	c.flag.StringVar(&domainAdmin, "domainadmin", "", "restrict token to the permissions of this domain admin")
+	args := c.Parse()
+	if len(args) < 1 {
+		c.Usage()
+	}
+
+	mustLoadConfig()
+	ctlcmdConfigAdmintokenAdd(xctl(), args[0], args[1:], domainAdmin)
+}
+
+func ctlcmdConfigAdmintokenAdd(ctl *ctl, name string, functions []string, domainAdmin string) {
+	ctl.xwrite("admintokenadd")
+	ctl.xwrite(name)
+	xctlwriteJSON(ctl, functions)
+	ctl.xwrite(domainAdmin)
+	ctl.xreadok()
+	fmt.Println(ctl.xread())
+}
+
+func cmdConfigAdmintokenRemove(c *cmd) {
+	c.params = "name"
+	c.help = `Remove an admin API token. It can no longer be used.`
+	args := c.Parse()
+	if len(args) != 1 {
+		c.Usage()
+	}
+
+	mustLoadConfig()
+	ctlcmdConfigAdmintokenRemove(xctl(), args[0])
+}
+
+func ctlcmdConfigAdmintokenRemove(ctl *ctl, name string) {
+	ctl.xwrite("admintokenrm")
+	ctl.xwrite(name)
+	ctl.xreadok()
+}
+
 func cmdConfigAccountAdd(c *cmd) {
-	c.params = "account address"
+	c.params = "[-template name] account address"
 	c.help = `Add an account with an email address and reload the configuration.
 
 Email can be delivered to this address/account. A password has to be configured
 explicitly, see the setaccountpassword command.
+
+With -template, the account is configured with the settings of the template
+from AccountTemplates in mox.conf, e.g. with different initial mailboxes, junk
+filter settings, rulesets or quota.
 `
+	var template string
+	c.flag.StringVar(&template, "template", "", "name of account template to use for the settings of the new account")
 	args := c.Parse()
 	if len(args) != 2 {
 		c.Usage()
 	}
 
 	mustLoadConfig()
-	ctlcmdConfigAccountAdd(xctl(), args[0], args[1])
+	ctlcmdConfigAccountAdd(xctl(), args[0], args[1], template)
 }
 
-func ctlcmdConfigAccountAdd(ctl *ctl, account, address string) {
+func ctlcmdConfigAccountAdd(ctl *ctl, account, address, template string) {
 	ctl.xwrite("accountadd")
 	ctl.xwrite(account)
 	ctl.xwrite(address)
+	ctl.xwrite(template)
 	ctl.xreadok()
 	fmt.Printf("account added, set a password with \"mox setaccountpassword %s\"\n", account)
 }
@@ -1041,6 +1276,146 @@ func ctlcmdConfigAccountDisabled(ctl *ctl, account, loginDisabled string) {
 	ctl.xreadok()
 }
 
+func cmdConfigAccountSuspend(c *cmd) {
+	c.params = "[-reject] account message"
+	c.help = `Suspend an account, e.g. when it is compromised or delinquent.
+
+Login attempts are rejected with the message, as with disabled logins, and
+active web sessions are removed. Incoming email for the account is rejected
+with a temporary error, or a permanent error with -reject. Aliases skip
+suspended accounts as members.
+
+Message must be non-empty, ascii-only without control characters including
+newline, and maximum 256 characters because it is used in SMTP/IMAP.
+`
+	var reject bool
+	c.flag.BoolVar(&reject, "reject", false, "reject incoming email with a permanent error instead of a temporary error")
+	args := c.Parse()
+	if len(args) != 2 {
+		c.Usage()
+	}
+	if args[1] == "" {
+		log.Fatalf("message must be non-empty")
+	}
+
+	mustLoadConfig()
+	ctlcmdConfigAccountSuspend(xctl(), args[0], args[1], reject)
+	fmt.Println("account suspended")
+}
+
+func ctlcmdConfigAccountSuspend(ctl *ctl, account, message string, reject bool) {
+	ctl.xwrite("accountsuspend")
+	ctl.xwrite(account)
+	ctl.xwrite(message)
+	ctl.xwrite(fmt.Sprintf("%v", reject))
+	ctl.xreadok()
+}
+
+func cmdConfigAccountResume(c *cmd) {
+	c.params = "account"
+	c.help = `Resume a suspended account.
+
+Logins and incoming email are accepted again, unless logins are disabled.
+`
+	args := c.Parse()
+	if len(args) != 1 {
+		c.Usage()
+	}
+
+	mustLoadConfig()
+	ctlcmdConfigAccountResume(xctl(), args[0])
+	fmt.Println("account resumed")
+}
+
+func ctlcmdConfigAccountResume(ctl *ctl, account string) {
+	ctl.xwrite("accountresume")
+	ctl.xwrite(account)
+	ctl.xreadok()
+}
+
+func cmdConfigAccountSnapshot(c *cmd) {
+	c.params = "account dst.tgz"
+	c.help = `Write a snapshot of an account to a file.
+
+The snapshot is a gzip-compressed tar file with the account configuration, the
+message database (including the password, login sessions and settings), the
+junk filter and all message files. It can be restored with "mox config account
+restore", on the same or another mox instance. Login attempts and TLS public
+keys for the account are not part of the snapshot.
+
+The account can be in use while making a snapshot. Messages delivered while
+making the snapshot may not be included.
+`
+	args := c.Parse()
+	if len(args) != 2 {
+		c.Usage()
+	}
+
+	mustLoadConfig()
+	ctlcmdConfigAccountSnapshot(xctl(), args[0], args[1])
+}
+
+func ctlcmdConfigAccountSnapshot(ctl *ctl, account, dst string) {
+	f, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0660)
+	xcheckf(err, "creating destination file")
+	defer func() {
+		if f != nil {
+			f.Close()
+			os.Remove(dst)
+		}
+	}()
+
+	ctl.xwrite("accountsnapshot")
+	ctl.xwrite(account)
+	ctl.xreadok()
+	ctl.xstreamto(f)
+	ctl.xreadok()
+	err = f.Close()
+	f = nil
+	xcheckf(err, "closing destination file")
+	fmt.Println("account snapshot written")
+}
+
+func cmdConfigAccountRestore(c *cmd) {
+	c.params = "account src.tgz"
+	c.help = `Restore an account from a snapshot.
+
+The snapshot must have been made with "mox config account snapshot", possibly of
+an account with a different name or on another mox instance. If the account
+does not exist, it is added with the configuration from the snapshot. Its
+addresses must be for configured domains, and must not be in use by other
+accounts.
+
+The account must not be in use during the restore, e.g. for IMAP connections or
+webmail sessions. An existing data directory of the account is moved into the
+"tmp" directory of the data directory, its path is printed. It can be removed
+once the restored account has been verified.
+`
+	args := c.Parse()
+	if len(args) != 2 {
+		c.Usage()
+	}
+
+	mustLoadConfig()
+	f, err := os.Open(args[1])
+	xcheckf(err, "open snapshot")
+	defer f.Close()
+	ctlcmdConfigAccountRestore(xctl(), args[0], f)
+}
+
+func ctlcmdConfigAccountRestore(ctl *ctl, account string, r io.Reader) {
+	ctl.xwrite("accountrestore")
+	ctl.xwrite(account)
+	ctl.xreadok()
+	ctl.xstreamfrom(r)
+	ctl.xreadok()
+	oldDir := ctl.xread()
+	fmt.Println("account restored")
+	if oldDir != "" {
+		fmt.Printf("previous account data directory moved to %s\n", oldDir)
+	}
+}
+
 func cmdConfigTlspubkeyList(c *cmd) {
 	c.params = "[account]"
 	c.help = `List TLS public keys for TLS client certificate authentication.
@@ -1241,6 +1616,10 @@ func cmdConfigAddressAdd(c *cmd) {
 
 If address starts with a @ (i.e. a missing localpart), this is a catchall
 address for the domain.
+
+If the domain of the address starts with "*.", e.g. info@*.example.com or
+@*.example.com, this is a wildcard address for all subdomains of the domain,
+e.g. for info@tag.example.com, or anything@tag.example.com.
 `
 	args := c.Parse()
 	if len(args) != 2 {
@@ -1282,13 +1661,22 @@ func ctlcmdConfigAddressRemove(ctl *ctl, address string) {
 }
 
 func cmdConfigDNSRecords(c *cmd) {
-	c.params = "domain"
+	c.params = "[-format zone|cloudflare|route53|terraform] domain"
 	c.help = `Prints annotated DNS records as zone file that should be created for the domain.
 
 The zone file can be imported into existing DNS software. You should review the
 DNS records, especially if your domain previously/currently has email
 configured.
+
+With -format, the records are printed in a format for a DNS provider instead:
+"cloudflare" for JSON with objects for the Cloudflare API for creating DNS
+records, "route53" for a JSON change batch for the AWS Route53 API (e.g. for
+"aws route53 change-resource-record-sets"), and "terraform" for HCL with
+aws_route53_record resources. Commented-out records in the zone file are not
+included.
 `
+	var format string
+	c.flag.StringVar(&format, "format", "zone", "output format: "+strings.Join(admin.DNSRecordFormats, ", "))
 	args := c.Parse()
 	if len(args) != 1 {
 		c.Usage()
@@ -1323,7 +1711,9 @@ configured.
 
 	records, err := admin.DomainRecords(domConf, d, result.Authentic, certIssuerDomainName, acmeAccountURI)
 	xcheckf(err, "records")
-	fmt.Print(strings.Join(records, "\n") + "\n")
+	out, err := admin.DomainRecordsExport(records, format)
+	xcheckf(err, "export records")
+	fmt.Print(out)
 }
 
 func cmdConfigDNSCheck(c *cmd) {
@@ -1713,10 +2103,25 @@ backup, then use the new mox binary to run "mox verifydata <backupdir>/data".
 This can change the backup files (e.g. upgrade database files, move away
 unrecognized message files), so you should make a new backup before actually
 upgrading.
+
+With -incremental, destdir is a backup repository that holds multiple backup
+generations. Each backup is stored in a new directory
+<destdir>/generations/<yyyymmdd-hhmmss>, with the same config and data
+directories as a regular backup. Files are deduplicated by content: They are
+stored once in <destdir>/objects, named by their SHA-256 hash, and hardlinked
+into each generation. Message and pack files that haven't changed since the
+previous generation, according to the "manifest" file in the generation
+directory, are linked from the objects directory without reading or copying
+them again. Other files, such as databases, are copied and hashed each time,
+and deduplicated when unchanged. The destination directory must be on a file system that supports
+hardlinks. Because files are shared between generations, do not modify files in
+a generation, e.g. with "mox verifydata -fix", make a copy with "cp -r" first.
+Use "mox backup prune" to remove old generations.
 `
 
-	var verbose bool
+	var verbose, incremental bool
 	c.flag.BoolVar(&verbose, "verbose", false, "print progress")
+	c.flag.BoolVar(&incremental, "incremental", false, "make incremental backup as new generation in backup repository destdir")
 	args := c.Parse()
 	if len(args) != 1 {
 		c.Usage()
@@ -1726,10 +2131,10 @@ upgrading.
 	dstDataDir, err := filepath.Abs(args[0])
 	xcheckf(err, "making path absolute")
 
-	ctlcmdBackup(xctl(), dstDataDir, verbose)
+	ctlcmdBackup(xctl(), dstDataDir, verbose, incremental)
 }
 
-func ctlcmdBackup(ctl *ctl, dstDataDir string, verbose bool) {
+func ctlcmdBackup(ctl *ctl, dstDataDir string, verbose, incremental bool) {
 	ctl.xwrite("backup")
 	ctl.xwrite(dstDataDir)
 	if verbose {
@@ -1737,10 +2142,45 @@ func ctlcmdBackup(ctl *ctl, dstDataDir string, verbose bool) {
 	} else {
 		ctl.xwrite("")
 	}
+	if incremental {
+		ctl.xwrite("incremental")
+	} else {
+		ctl.xwrite("")
+	}
 	ctl.xstreamto(os.Stdout)
 	ctl.xreadok()
 }
 
+func cmdBackupPrune(c *cmd) {
+	c.params = "-keep n repodir"
+	c.help = `Remove old generations from an incremental backup repository.
+
+The most recent n complete generations are kept. Incomplete generations, e.g.
+from an interrupted backup, are removed. Files in the objects directory that are
+no longer referenced by any kept generation are removed.
+
+If the most recent generation is incomplete, a backup may be in progress and
+nothing is removed. Do not run prune while an incremental backup to the
+repository is in progress.
+
+Prune works on the files in the backup repository only, it does not need a
+running mox instance.
+`
+	var keep int
+	c.flag.IntVar(&keep, "keep", 0, "number of most recent complete generations to keep, must be at least 1")
+	args := c.Parse()
+	if len(args) != 1 || keep < 1 {
+		c.Usage()
+	}
+
+	gens, nobjects, freed, err := backupPrune(args[0], keep)
+	for _, g := range gens {
+		fmt.Printf("removed generation %s\n", g)
+	}
+	xcheckf(err, "pruning backup repository")
+	fmt.Printf("removed %d unreferenced objects, %d bytes\n", nobjects, freed)
+}
+
 func cmdSetadminpassword(c *cmd) {
 	c.help = `Set a new admin password, for the web interface.
 
@@ -1830,6 +2270,45 @@ func ctlcmdSetaccountpassword(ctl *ctl, account, password string) {
 	ctl.xreadok()
 }
 
+func cmdSetaccountpasswordhash(c *cmd) {
+	c.params = "account"
+	c.help = `Set the password of an account to a password hash from another system.
+
+The password hash is read from stdin. Useful when migrating accounts from other
+mail servers, without knowing the passwords. Supported are bcrypt, argon2i,
+argon2id, sha256-crypt and sha512-crypt hashes in crypt format, e.g. starting
+with "$2y$", "$argon2id$" or "$6$", optionally prefixed with the scheme as used
+by Dovecot, e.g. "{SHA512-CRYPT}".
+
+Until the first successful login, only authentication mechanisms with a plain
+text password (IMAP LOGIN, SASL PLAIN, HTTP basic authentication) can be used.
+At the first successful login, the password is set again with the hashes and
+derived secrets mox uses for all authentication mechanisms.
+`
+	args := c.Parse()
+	if len(args) != 1 {
+		c.Usage()
+	}
+	mustLoadConfig()
+
+	scanner := bufio.NewScanner(os.Stdin)
+	scanner.Scan()
+	xcheckf(scanner.Err(), "reading stdin")
+	hash := strings.TrimSpace(scanner.Text())
+	if hash == "" {
+		log.Fatalf("no password hash in stdin")
+	}
+
+	ctlcmdSetaccountpasswordhash(xctl(), args[0], hash)
+}
+
+func ctlcmdSetaccountpasswordhash(ctl *ctl, account, passwordHash string) {
+	ctl.xwrite("setaccountpasswordhash")
+	ctl.xwrite(account)
+	ctl.xwrite(passwordHash)
+	ctl.xreadok()
+}
+
 func cmdDeliver(c *cmd) {
 	c.unlisted = true
 	c.params = "address < message"
@@ -2018,72 +2497,43 @@ sharing most of its code.
 
 		log.Printf("attempting to connect to %s", host)
 
-		authentic, expandedAuthentic, expandedHost, ips, _, err := smtpclient.GatherIPs(ctxbg, c.log.Logger, resolver, "ip", host, dialedIPs)
+		target, err := gatherDialTarget(ctxbg, c.log, resolver, dialedIPs, haveMX, origNextHopAuthentic, expandedNextHopAuthentic, origNextHop, expandedNextHop, host)
 		if err != nil {
-			log.Printf("resolving ips for %s: %v, skipping", host, err)
+			log.Printf("%s: %v, skipping", host, err)
 			continue
 		}
-		if !authentic {
+		if !target.Authentic {
 			log.Printf("no dnssec for ips of %s, skipping", host)
 			continue
 		}
-		if !expandedAuthentic {
-			log.Printf("no dnssec for cname-followed ips of %s, skipping", host)
-			continue
-		}
-		if expandedHost != host.Domain {
-			log.Printf("host %s cname-expanded to %s", host, expandedHost)
+		if target.ExpandedHost != host.Domain {
+			log.Printf("host %s cname-expanded to %s", host, target.ExpandedHost)
 		}
-		log.Printf("host %s resolved to ips %s, looking up tlsa records", host, ips)
+		log.Printf("host %s resolved to ips %s", host, target.IPs)
 
-		daneRequired, daneRecords, tlsaBaseDomain, err := smtpclient.GatherTLSA(ctxbg, c.log.Logger, resolver, host.Domain, expandedAuthentic, expandedHost)
-		if err != nil {
-			log.Printf("looking up tlsa records: %s, skipping", err)
+		if !target.DANE {
+			log.Printf("host %s has no tlsa records, skipping", target.ExpandedHost)
 			continue
-		}
-		tlsMode := smtpclient.TLSRequiredStartTLS
-		if len(daneRecords) == 0 {
-			if !daneRequired {
-				log.Printf("host %s has no tlsa records, skipping", expandedHost)
-				continue
-			}
+		} else if len(target.DANERecords) == 0 {
 			log.Printf("warning: only unusable tlsa records found, continuing with required tls without certificate verification")
-			daneRecords = nil
 		} else {
 			var l []string
-			for _, r := range daneRecords {
+			for _, r := range target.DANERecords {
 				l = append(l, r.String())
 			}
 			log.Printf("tlsa records: %s", strings.Join(l, "; "))
 		}
 
-		tlsHostnames := smtpclient.GatherTLSANames(haveMX, expandedNextHopAuthentic, expandedAuthentic, origNextHop, expandedNextHop, host.Domain, tlsaBaseDomain)
 		var l []string
-		for _, name := range tlsHostnames {
+		for _, name := range target.TLSHostnames {
 			l = append(l, name.String())
 		}
 		log.Printf("gathered valid tls certificate names for potential verification with dane-ta: %s", strings.Join(l, ", "))
 
-		dialer := &net.Dialer{Timeout: 5 * time.Second}
-		conn, _, err := smtpclient.Dial(ctxbg, c.log.Logger, dialer, dns.IPDomain{Domain: expandedHost}, ips, 25, dialedIPs, nil)
-		if err != nil {
-			log.Printf("dial %s: %v, skipping", expandedHost, err)
-			continue
-		}
-		log.Printf("connected to %s, %s, starting smtp session with ehlo and starttls with dane verification", expandedHost, conn.RemoteAddr())
-
-		var verifiedRecord adns.TLSA
-		opts := smtpclient.Opts{
-			DANERecords:        daneRecords,
-			DANEMoreHostnames:  tlsHostnames[1:],
-			DANEVerifiedRecord: &verifiedRecord,
-			RootCAs:            mox.Conf.Static.TLS.CertPool,
-		}
-		tlsPKIX := false
-		sc, err := smtpclient.New(ctxbg, c.log.Logger, conn, tlsMode, tlsPKIX, ehloDomain, tlsHostnames[0], opts)
+		log.Printf("connecting to %s, starting smtp session with ehlo and starttls with dane verification", target.ExpandedHost)
+		sc, _, verifiedRecord, err := dialSMTP(ctxbg, c.log, target, 25, dialedIPs, smtpclient.TLSRequiredStartTLS, false, ehloDomain, mox.Conf.Static.TLS.CertPool)
 		if err != nil {
 			log.Printf("setting up smtp session: %v, skipping", err)
-			conn.Close()
 			continue
 		}
 
@@ -2106,6 +2556,52 @@ sharing most of its code.
 	log.Fatalf("no remaining destinations")
 }
 
+func cmdDialcheck(c *cmd) {
+	c.params = "domain"
+	var ehloHostname string
+	var requireTLS, all bool
+	c.flag.StringVar(&ehloHostname, "ehlohostname", "localhost", "hostname to send in smtp ehlo command")
+	c.flag.BoolVar(&requireTLS, "requiretls", false, "check as if delivering a message that requires verified tls, with the smtp requiretls extension")
+	c.flag.BoolVar(&all, "all", false, "check all destination hosts, instead of stopping at the first host a delivery would be attempted to")
+	c.help = `Check how a message to a domain would be delivered, without sending a message.
+
+The same steps as for delivery attempts from the queue are taken: CNAMEs for the
+domain are followed and MX records looked up to find the destination hosts. The
+MTA-STS policy for the domain is fetched, and DANE TLSA records are looked up
+for each host with DNSSEC-verified IPs. The resulting TLS requirements are
+printed. Each host is dialed, and the SMTP session is initialized with EHLO and
+STARTTLS (if applicable), after which the TLS details and announced extensions
+are printed. The connection is closed with QUIT, no MAIL FROM command is sent.
+
+Like the queue, hosts are checked until one accepts the SMTP session, the host a
+delivery would be attempted to. Use -all to check all hosts.
+
+The MTA-STS policy is always fetched, not taken from the cache of the queue, and
+the system certificate pool is used for verification. Delivery attempts by the
+queue can make different decisions based on a previously cached MTA-STS policy,
+and a configured certificate pool, source IPs and transports.
+
+Unlike "mox dane dialmx", hosts without DANE are checked too, with MTA-STS and
+opportunistic TLS as the queue would use, and the session is not connected to
+stdin/stdout.
+`
+	args := c.Parse()
+	if len(args) != 1 {
+		c.Usage()
+	}
+
+	ehloDomain, err := dns.ParseDomain(ehloHostname)
+	xcheckf(err, "parsing ehlo hostname")
+	origNextHop := xparseDomain(args[0], "domain")
+
+	delivering, err := dialcheck(context.Background(), c.log, os.Stdout, dns.StrictResolver{}, origNextHop, ehloDomain, 25, requireTLS, all)
+	if err != nil {
+		log.Fatalf("%v", err)
+	} else if !delivering {
+		os.Exit(1)
+	}
+}
+
 func cmdDANEMakeRecord(c *cmd) {
 	c.params = "usage selector matchtype [certificate.pem | publickey.pem | privatekey.pem]"
 	c.help = `Print TLSA record for given certificate/key and parameters.
@@ -3046,6 +3542,96 @@ automation.
 	fmt.Println(s)
 }
 
+func cmdPasswordfilterMake(c *cmd) {
+	c.params = "size file"
+	var k int
+	var plain bool
+	c.flag.IntVar(&k, "k", 7, "number of bits in the bloom filter per password")
+	c.flag.BoolVar(&plain, "plain", false, "lines on stdin are plain text passwords instead of sha-1 hashes")
+	c.help = `Make a bloom filter file with breached passwords, for the password policy.
+
+The passwords are read from stdin, one per line. By default, each line must have
+an SHA-1 hash in hexadecimal, optionally followed by a colon and a count, as in
+the Have I Been Pwned (HIBP) password lists. With -plain, lines are plain text
+passwords.
+
+The size is the size of the file in bytes, and must be a power of two, e.g.
+67108864 (64MiB). The larger the file, the fewer false positives, i.e.
+non-breached passwords being refused. With the default k of 7, a filter with 10
+bits per password has a false positive rate of approximately 1%.
+
+The file can be configured in the PasswordPolicy in mox.conf.
+`
+	args := c.Parse()
+	if len(args) != 2 {
+		c.Usage()
+	}
+
+	size, err := strconv.ParseInt(args[0], 10, 32)
+	xcheckf(err, "parsing size")
+	bloom, err := junk.NewBloom(make([]byte, size), k)
+	xcheckf(err, "making bloom filter")
+
+	var n int
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if plain {
+			pw, err := precis.OpaqueString.String(line)
+			if err != nil {
+				continue
+			}
+			bloom.Add(mox.BreachedPasswordKey(pw))
+		} else {
+			hash, _, _ := strings.Cut(strings.TrimSpace(line), ":")
+			if len(hash) != 40 {
+				log.Fatalf("line %d: not an sha-1 hash in hexadecimal", n+1)
+			}
+			bloom.Add(strings.ToUpper(hash))
+		}
+		n++
+	}
+	xcheckf(scanner.Err(), "reading passwords")
+
+	if _, err := os.Stat(args[1]); err == nil {
+		log.Fatalf("file %s already exists", args[1])
+	}
+	err = bloom.Write(args[1])
+	xcheckf(err, "writing bloom filter")
+	fmt.Printf("added %d passwords, %.1f%% of bits set\n", n, 100*float64(bloom.Ones())/float64(8*size))
+}
+
+func cmdPasswordfilterCheck(c *cmd) {
+	c.params = "file"
+	var k int
+	c.flag.IntVar(&k, "k", 7, "number of bits in the bloom filter per password")
+	c.help = `Check if a password is present in a breached password bloom filter file.
+
+The password is read from stdin. The exit code is 1 if the password is present in
+the filter, possibly as false positive.
+`
+	args := c.Parse()
+	if len(args) != 1 {
+		c.Usage()
+	}
+
+	buf, err := os.ReadFile(args[0])
+	xcheckf(err, "reading bloom filter")
+	bloom, err := junk.NewBloom(buf, k)
+	xcheckf(err, "parsing bloom filter")
+
+	scanner := bufio.NewScanner(os.Stdin)
+	scanner.Scan()
+	xcheckf(scanner.Err(), "reading stdin")
+	pw, err := precis.OpaqueString.String(scanner.Text())
+	xcheckf(err, `password not allowed by "precis"`)
+	if bloom.Has(mox.BreachedPasswordKey(pw)) {
+		fmt.Println("password is breached")
+		os.Exit(1)
+	}
+	fmt.Println("password not found")
+}
+
 func cmdRetrain(c *cmd) {
 	c.params = "[accountname]"
 	c.help = `Recreate and retrain the junk filter for the account or all accounts.
@@ -3670,6 +4256,34 @@ func ctlcmdRecalculateMailboxCounts(ctl *ctl, account string) {
 	ctl.xstreamto(os.Stdout)
 }
 
+func cmdMailboxReadonly(c *cmd) {
+	c.params = "account mailbox true|false"
+	c.help = `Mark a mailbox as read-only for IMAP clients, or as writable again.
+
+A read-only mailbox is opened like with EXAMINE, also by SELECT, with an empty
+PERMANENTFLAGS list. Flags cannot be changed and messages cannot be expunged.
+Adding messages with APPEND, COPY or MOVE fails with response code NOPERM.
+Useful for archives that should not change. Messages are still delivered to the
+mailbox if rulesets specify it. IMAP sessions that have the mailbox selected
+notice the change when selecting the mailbox again.
+`
+	args := c.Parse()
+	if len(args) != 3 || args[2] != "true" && args[2] != "false" {
+		c.Usage()
+	}
+
+	mustLoadConfig()
+	ctlcmdMailboxReadonly(xctl(), args[0], args[1], args[2] == "true")
+}
+
+func ctlcmdMailboxReadonly(ctl *ctl, account, mailbox string, readonly bool) {
+	ctl.xwrite("mailboxreadonly")
+	ctl.xwrite(account)
+	ctl.xwrite(mailbox)
+	ctl.xwrite(fmt.Sprintf("%v", readonly))
+	ctl.xreadok()
+}
+
 func cmdMessageParse(c *cmd) {
 	c.params = "message.eml"
 	c.help = "Parse message, print JSON representation."
@@ -3780,6 +4394,232 @@ func ctlcmdReassignthreads(ctl *ctl, account string) {
 	ctl.xstreamto(os.Stdout)
 }
 
+func cmdArchivepack(c *cmd) {
+	c.params = "[account]"
+	c.help = `Move old messages into compressed pack files, and repack pack files.
+
+For all accounts, or optionally only the specified account.
+
+Messages received longer ago than the age configured in the ArchiveTier of an
+account are moved from their own on-disk file into compressed pack files with
+many messages. Pack files in which most data is for removed messages are
+rewritten, also for accounts that no longer have an ArchiveTier configured.
+
+Packing is also done automatically once a day for accounts with an ArchiveTier.
+`
+	args := c.Parse()
+	if len(args) > 1 {
+		c.Usage()
+	}
+
+	mustLoadConfig()
+	var account string
+	if len(args) == 1 {
+		account = args[0]
+	}
+	ctlcmdArchivepack(xctl(), account)
+}
+
+func ctlcmdArchivepack(ctl *ctl, account string) {
+	ctl.xwrite("archivepack")
+	ctl.xwrite(account)
+	ctl.xreadok()
+	ctl.xstreamto(os.Stdout)
+}
+
+func cmdAutoarchive(c *cmd) {
+	c.params = "[account]"
+	c.help = `Move old messages into yearly archive mailboxes.
+
+For all accounts with AutoArchive configured, or optionally only the specified
+account.
+
+Messages received longer ago than the age configured in the AutoArchive of an
+account are moved from the configured mailboxes, by default Inbox, into
+mailboxes named after the year the message was received, under the archive
+mailbox, e.g. Archive/2023. Missing mailboxes are created. Moved messages keep
+their flags, keywords and threads.
+
+Archiving is also done automatically once a day for accounts with AutoArchive.
+`
+	args := c.Parse()
+	if len(args) > 1 {
+		c.Usage()
+	}
+
+	mustLoadConfig()
+	var account string
+	if len(args) == 1 {
+		account = args[0]
+	}
+	ctlcmdAutoarchive(xctl(), account)
+}
+
+func ctlcmdAutoarchive(ctl *ctl, account string) {
+	ctl.xwrite("autoarchive")
+	ctl.xwrite(account)
+	ctl.xreadok()
+	ctl.xstreamto(os.Stdout)
+}
+
+func cmdCompressmsgs(c *cmd) {
+	c.params = "[account]"
+	c.help = `Compress the on-disk files of existing messages.
+
+For all accounts with message compression enabled, or optionally only the
+specified account.
+
+With MessageCompression configured, globally or for an account, new messages are
+stored compressed. This command compresses the files of messages delivered
+before compression was enabled. Messages outside the configured size range,
+messages in pack files, and messages that don't become smaller are left as is.
+The message sizes reported to IMAP clients don't change.
+`
+	args := c.Parse()
+	if len(args) > 1 {
+		c.Usage()
+	}
+
+	mustLoadConfig()
+	var account string
+	if len(args) == 1 {
+		account = args[0]
+	}
+	ctlcmdCompressmsgs(xctl(), account)
+}
+
+func ctlcmdCompressmsgs(ctl *ctl, account string) {
+	ctl.xwrite("compressmsgs")
+	ctl.xwrite(account)
+	ctl.xreadok()
+	ctl.xstreamto(os.Stdout)
+}
+
+func cmdEncryptmsgs(c *cmd) {
+	c.params = "[account]"
+	c.help = `Encrypt the on-disk files of existing messages.
+
+For all accounts with message encryption enabled, or optionally only the
+specified account.
+
+With MessageEncryption configured for an account, new messages are stored
+encrypted. This command encrypts the files of messages delivered before
+encryption was enabled. Compressed messages are stored encrypted without
+compression. Messages in pack files are left as is. For accounts with the
+message key protected by the password, the account must have logged in with its
+password since mox started.
+`
+	args := c.Parse()
+	if len(args) > 1 {
+		c.Usage()
+	}
+
+	mustLoadConfig()
+	var account string
+	if len(args) == 1 {
+		account = args[0]
+	}
+	ctlcmdEncryptmsgs(xctl(), account)
+}
+
+func ctlcmdEncryptmsgs(ctl *ctl, account string) {
+	ctl.xwrite("encryptmsgs")
+	ctl.xwrite(account)
+	ctl.xreadok()
+	ctl.xstreamto(os.Stdout)
+}
+
+func cmdMessageencryptionGenkey(c *cmd) {
+	c.params = ">messageencryption.key"
+	c.help = `Generate a master key for message encryption.
+
+The key is written to standard output, as base64-encoded 32 random bytes. Write
+it to a file, and configure the file as MessageEncryptionKeyFile in mox.conf.
+Keep a copy of the key in a safe place: Without it, encrypted messages of
+accounts with MessageEncryption using the master key cannot be read.
+`
+	if len(c.Parse()) != 0 {
+		c.Usage()
+	}
+
+	buf := make([]byte, 32)
+	cryptorand.Read(buf)
+	_, err := fmt.Println(base64.StdEncoding.EncodeToString(buf))
+	xcheckf(err, "writing key")
+}
+
+func cmdTextindexrebuild(c *cmd) {
+	c.params = "[account]"
+	c.help = `Rebuild the full-text search index of messages.
+
+For all accounts, or optionally only the specified account.
+
+The text index holds the words of each message, and is used by IMAP SEARCH and
+webmail searches to skip messages that cannot match, without reading them. New
+messages are indexed at delivery. This command indexes messages delivered before
+the index existed, and can be used to recover from an inconsistent index.
+Messages without index are searched by reading the message, also while the
+rebuild is in progress.
+`
+	args := c.Parse()
+	if len(args) > 1 {
+		c.Usage()
+	}
+
+	mustLoadConfig()
+	var account string
+	if len(args) == 1 {
+		account = args[0]
+	}
+	ctlcmdTextindexrebuild(xctl(), account)
+}
+
+func ctlcmdTextindexrebuild(ctl *ctl, account string) {
+	ctl.xwrite("textindexrebuild")
+	ctl.xwrite(account)
+	ctl.xreadok()
+	ctl.xstreamto(os.Stdout)
+}
+
+func cmdFsck(c *cmd) {
+	c.params = "[-repair] [account]"
+	c.help = `Check consistency of message database, message files, mailbox counts and UIDs.
+
+For all accounts, or optionally only the specified account.
+
+Checks for messages in the database without message file, for files in the
+message directory without message in the database, for incorrect mailbox
+message counts and total message size, for mailbox UIDNext values not above the
+highest UID in the mailbox, and for an account next UIDValidity not above the
+UIDValidity of its mailboxes.
+
+With -repair, problems are fixed: Messages without file are marked expunged,
+files without message are removed, and counts and UID values are corrected. The
+account is locked during the check. Make a backup before repairing.
+`
+	var repair bool
+	c.flag.BoolVar(&repair, "repair", false, "fix problems that are found")
+	args := c.Parse()
+	if len(args) > 1 {
+		c.Usage()
+	}
+
+	mustLoadConfig()
+	var account string
+	if len(args) == 1 {
+		account = args[0]
+	}
+	ctlcmdFsck(xctl(), account, repair)
+}
+
+func ctlcmdFsck(ctl *ctl, account string, repair bool) {
+	ctl.xwrite("fsck")
+	ctl.xwrite(account)
+	ctl.xwrite(fmt.Sprintf("%v", repair))
+	ctl.xreadok()
+	ctl.xstreamto(os.Stdout)
+}
+
 func cmdIMAPServe(c *cmd) {
 	c.params = "preauth-address"
 	c.help = `Initiate a preauthenticated IMAP connection on file descriptor 0.
@@ -0,0 +1,973 @@
+// Package managesieve implements a ManageSieve server, for managing the sieve
+// scripts of an account with sieve editors and email applications.
+//
+// Scripts are stored in the account database. Only one script can be active, it
+// is evaluated when delivering incoming messages, see package sieve. Only SASL
+// mechanism PLAIN is supported, and only after STARTTLS, unless the listener is
+// configured to not require it.
+//
+// See ../rfc/5804.
+package managesieve
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net"
+	"os"
+	"runtime/debug"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/exp/maps"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/mjl-/mox/config"
+	"github.com/mjl-/mox/metrics"
+	"github.com/mjl-/mox/mlog"
+	"github.com/mjl-/mox/mox-"
+	"github.com/mjl-/mox/moxio"
+	"github.com/mjl-/mox/proxyproto"
+	"github.com/mjl-/mox/ratelimit"
+	"github.com/mjl-/mox/sieve"
+	"github.com/mjl-/mox/store"
+)
+
+var (
+	metricConnection = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "mox_managesieve_connection_total",
+			Help: "Incoming ManageSieve connections.",
+		},
+	)
+	metricCommands = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "mox_managesieve_command_duration_seconds",
+			Help:    "ManageSieve command duration and result codes in seconds.",
+			Buckets: []float64{0.001, 0.005, 0.01, 0.05, 0.100, 0.5, 1, 5, 10, 20},
+		},
+		[]string{
+			"cmd",
+			"result", // ok, panic, ioerror, badsyntax, usererror, error
+		},
+	)
+)
+
+var limiterConnectionrate, limiterConnections *ratelimit.Limiter
+
+func init() {
+	// Also called by tests, so they don't trigger the rate limiter.
+	limitersInit()
+}
+
+func limitersInit() {
+	mox.LimitersInit()
+	limiterConnectionrate = &ratelimit.Limiter{
+		WindowLimits: []ratelimit.WindowLimit{
+			{
+				Window: time.Minute,
+				Limits: [...]int64{60, 180, 540},
+			},
+		},
+	}
+	limiterConnections = &ratelimit.Limiter{
+		WindowLimits: []ratelimit.WindowLimit{
+			{
+				Window: time.Duration(math.MaxInt64), // All of time.
+				Limits: [...]int64{10, 30, 90},
+			},
+		},
+	}
+}
+
+// Delay after authentication failure. Tests set it to zero.
+var authFailDelay = time.Second
+
+// Limits for scripts of an account, and for command lines.
+const (
+	maxScripts    = 100
+	maxScriptSize = 1024 * 1024
+	maxNameSize   = 255 // Servers must allow at least 128 bytes. ../rfc/5804
+	maxLineLength = 8 * 1024
+)
+
+// Buffers for reading command lines.
+var bufpool = moxio.NewBufpool(8, maxLineLength)
+
+var (
+	errIO       = errors.New("io error")       // For read/write errors and errors that should close the connection.
+	errProtocol = errors.New("protocol error") // For protocol errors for which a stack trace should not be printed.
+)
+
+var cleanClose struct{} // Sentinel value for panic/recover indicating clean close of connection.
+
+// noError results in a NO response, with an optional response code.
+type noError struct {
+	code string // E.g. NONEXISTENT, ACTIVE, QUOTA/MAXSIZE.
+	err  error
+}
+
+func (e noError) Error() string { return e.err.Error() }
+func (e noError) Unwrap() error { return e.err }
+
+// syntaxError results in a NO response for a command with bad arguments.
+type syntaxError struct {
+	err error
+}
+
+func (e syntaxError) Error() string { return e.err.Error() }
+func (e syntaxError) Unwrap() error { return e.err }
+
+func xnoErrorf(code, format string, args ...any) {
+	panic(noError{code, fmt.Errorf(format, args...)})
+}
+
+func xsyntaxErrorf(format string, args ...any) {
+	panic(syntaxError{fmt.Errorf(format, args...)})
+}
+
+// xprotocolErrorf closes the connection with a BYE, e.g. for malformed commands
+// after which we cannot find the start of the next command.
+func xprotocolErrorf(format string, args ...any) {
+	panic(fmt.Errorf("%s (%w)", fmt.Sprintf(format, args...), errProtocol))
+}
+
+func xcheckf(err error, format string, args ...any) {
+	if err != nil {
+		panic(fmt.Errorf("%s: %w", fmt.Sprintf(format, args...), err))
+	}
+}
+
+type conn struct {
+	cid               int64
+	conn              net.Conn
+	tls               bool // Whether STARTTLS has been done.
+	noRequireSTARTTLS bool
+	baseTLSConfig     *tls.Config
+	remoteIP          net.IP
+	tr                *moxio.TraceReader
+	tw                *moxio.TraceWriter
+	br                *bufio.Reader
+	bw                *bufio.Writer
+	lastlog           time.Time
+	log               mlog.Log
+	authFailed        int // Number of failed authentication attempts, for slowing down.
+
+	// Set after authentication.
+	username string // Email address.
+	account  *store.Account
+
+	cmd      string // Current command, for logging and metrics.
+	cmdStart time.Time
+}
+
+// Listen initializes all managesieve listeners for the configuration, and stores
+// them for Serve to start them.
+func Listen() {
+	names := maps.Keys(mox.Conf.Static.Listeners)
+	sort.Strings(names)
+	for _, name := range names {
+		listener := mox.Conf.Static.Listeners[name]
+		if !listener.ManageSieve.Enabled {
+			continue
+		}
+
+		var tlsConfig *tls.Config
+		if listener.TLS != nil {
+			tlsConfig = listener.TLS.Config
+		}
+		port := config.Port(listener.ManageSieve.Port, 4190)
+		for _, ip := range listener.IPs {
+			listen1(name, ip, port, tlsConfig, listener.ManageSieve.NoRequireSTARTTLS)
+		}
+	}
+}
+
+var servers []func()
+
+func listen1(listenerName, ip string, port int, tlsConfig *tls.Config, noRequireSTARTTLS bool) {
+	log := mlog.New("managesieve", nil)
+	addr := net.JoinHostPort(ip, fmt.Sprintf("%d", port))
+	if os.Getuid() == 0 {
+		log.Print("listening for managesieve",
+			slog.String("listener", listenerName),
+			slog.String("addr", addr))
+	}
+	network := mox.Network(ip)
+	ln, err := mox.Listen(network, addr)
+	if err != nil {
+		log.Fatalx("managesieve: listen for managesieve", err, slog.String("listener", listenerName))
+	}
+	if pp := mox.Conf.Static.Listeners[listenerName].ProxyProtocol; pp != nil {
+		ln = &proxyproto.Listener{Listener: ln, Networks: pp.ParsedNetworks, Timeout: 30 * time.Second}
+	}
+
+	// Each listener gets its own copy of the config, with its own session ticket
+	// key rotation, like for imap.
+	if tlsConfig != nil {
+		tlsConfig = tlsConfig.Clone()
+		mox.StartTLSSessionTicketKeyRefresher(mox.Shutdown, log, tlsConfig)
+	}
+
+	serve := func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil && errors.Is(err, net.ErrClosed) {
+				return
+			} else if err != nil {
+				log.Infox("managesieve: accept", err, slog.String("listener", listenerName))
+				continue
+			}
+
+			metricConnection.Inc()
+			go serve(listenerName, mox.Cid(), tlsConfig, conn, noRequireSTARTTLS)
+		}
+	}
+
+	servers = append(servers, serve)
+}
+
+// Serve starts serving on all listeners, launching a goroutine per listener.
+func Serve() {
+	for _, serve := range servers {
+		go serve()
+	}
+	servers = nil
+}
+
+// serve handles a connection. The connection is closed before returning.
+func serve(listenerName string, cid int64, tlsConfig *tls.Config, nc net.Conn, noRequireSTARTTLS bool) {
+	var remoteIP net.IP
+	if a, ok := nc.RemoteAddr().(*net.TCPAddr); ok {
+		remoteIP = a.IP
+	} else {
+		// For net.Pipe, during tests.
+		remoteIP = net.ParseIP("127.0.0.10")
+	}
+
+	c := &conn{
+		cid:               cid,
+		conn:              nc,
+		noRequireSTARTTLS: noRequireSTARTTLS,
+		baseTLSConfig:     tlsConfig,
+		remoteIP:          remoteIP,
+		lastlog:           time.Now(),
+		cmd:               "(greeting)",
+		cmdStart:          time.Now(),
+	}
+	var logmutex sync.Mutex
+	c.log = mlog.New("managesieve", nil).WithFunc(func() []slog.Attr {
+		logmutex.Lock()
+		defer logmutex.Unlock()
+		now := time.Now()
+		l := []slog.Attr{
+			slog.Int64("cid", c.cid),
+			slog.Duration("delta", now.Sub(c.lastlog)),
+		}
+		c.lastlog = now
+		if c.username != "" {
+			l = append(l, slog.String("username", c.username))
+		}
+		return l
+	})
+	c.setConn(nc)
+
+	c.log.Info("new connection",
+		slog.Any("remote", c.conn.RemoteAddr()),
+		slog.Any("local", c.conn.LocalAddr()),
+		slog.String("listener", listenerName))
+
+	defer func() {
+		c.conn.Close()
+
+		if c.account != nil {
+			err := c.account.Close()
+			c.log.Check(err, "close account")
+			c.account = nil
+		}
+
+		x := recover()
+		if x == nil || x == cleanClose {
+			c.log.Info("connection closed")
+		} else if err, ok := x.(error); ok && isClosed(err) {
+			c.log.Infox("connection closed", err)
+		} else {
+			c.log.Error("unhandled panic", slog.Any("err", x))
+			debug.PrintStack()
+			metrics.PanicInc(metrics.Managesieve)
+		}
+	}()
+
+	select {
+	case <-mox.Shutdown.Done():
+		c.writeBye("mox shutting down")
+		return
+	default:
+	}
+
+	if !limiterConnectionrate.Add(c.remoteIP, time.Now(), 1) {
+		c.writeBye("connection rate from your ip or network too high, slow down please")
+		return
+	}
+
+	// If remote IP/network resulted in too many authentication failures, refuse to serve.
+	if !mox.LimiterFailedAuth.CanAdd(c.remoteIP, time.Now(), 1) {
+		metrics.AuthenticationRatelimitedInc("managesieve")
+		c.log.Debug("refusing connection due to many auth failures", slog.Any("remoteip", c.remoteIP))
+		c.writeBye("too many auth failures")
+		return
+	}
+
+	if !limiterConnections.Add(c.remoteIP, time.Now(), 1) {
+		c.log.Debug("refusing connection due to many open connections", slog.Any("remoteip", c.remoteIP))
+		c.writeBye("too many open connections from your ip or network")
+		return
+	}
+	defer limiterConnections.Add(c.remoteIP, time.Now(), -1)
+
+	// We register and unregister the original connection, in case c.conn is
+	// replaced with a TLS connection later on.
+	mox.Connections.Register(nc, "managesieve", listenerName)
+	defer mox.Connections.Unregister(nc)
+
+	// Greeting is the capabilities followed by OK. ../rfc/5804
+	c.bwriteCapabilities()
+	c.bwriteResponse("OK", "", "mox managesieve ready")
+	c.xflush()
+
+	for {
+		c.command()
+	}
+}
+
+// isClosed returns whether i/o failed, typically because the connection is closed.
+func isClosed(err error) bool {
+	return errors.Is(err, errIO) || errors.Is(err, errProtocol) || moxio.IsClosed(err)
+}
+
+// setConn sets the (new) connection, and the tracing readers/writers around it.
+func (c *conn) setConn(nc net.Conn) {
+	c.conn = nc
+	c.tr = moxio.NewTraceReader(c.log, "C: ", c.conn)
+	c.br = bufio.NewReader(c.tr)
+	c.tw = moxio.NewTraceWriter(c.log, "S: ", c.conn)
+	c.bw = bufio.NewWriter(c.tw)
+}
+
+func (c *conn) xtrace(level slog.Level) func() {
+	c.xflush()
+	c.tr.SetTrace(level)
+	c.tw.SetTrace(level)
+	return func() {
+		c.xflush()
+		c.tr.SetTrace(mlog.LevelTrace)
+		c.tw.SetTrace(mlog.LevelTrace)
+	}
+}
+
+func (c *conn) xflush() {
+	err := c.conn.SetWriteDeadline(time.Now().Add(5 * time.Minute))
+	c.log.Check(err, "setting write deadline")
+	if err := c.bw.Flush(); err != nil {
+		panic(fmt.Errorf("flush: %s (%w)", err, errIO))
+	}
+}
+
+func (c *conn) bwritelinef(format string, args ...any) {
+	fmt.Fprintf(c.bw, format+"\r\n", args...)
+}
+
+// bwriteResponse writes an OK, NO or BYE response, with optional response code
+// and message.
+func (c *conn) bwriteResponse(kind, code, msg string) {
+	line := kind
+	if code != "" {
+		line += " (" + code + ")"
+	}
+	if msg != "" {
+		line += " " + quoted(msg)
+	}
+	c.bwritelinef("%s", line)
+}
+
+// writeBye writes a BYE response, ignoring errors because we are closing the
+// connection.
+func (c *conn) writeBye(msg string) {
+	err := c.conn.SetWriteDeadline(time.Now().Add(5 * time.Second))
+	c.log.Check(err, "setting write deadline")
+	c.bwriteResponse("BYE", "", msg)
+	err = c.bw.Flush()
+	c.log.Check(err, "writing bye")
+}
+
+// quoted returns s as quoted string. Line endings are replaced with a space, they
+// cannot be represented in a quoted string.
+func quoted(s string) string {
+	s = strings.NewReplacer("\r\n", " ", "\r", " ", "\n", " ").Replace(s)
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+func (c *conn) bwriteCapabilities() {
+	c.bwritelinef(`"IMPLEMENTATION" "mox"`)
+	// Without TLS, we don't offer any mechanism, clients must use STARTTLS first.
+	var sasl string
+	if c.tls || c.noRequireSTARTTLS {
+		sasl = "PLAIN"
+	}
+	c.bwritelinef(`"SASL" %s`, quoted(sasl))
+	c.bwritelinef(`"SIEVE" %s`, quoted(strings.Join(sieve.Extensions, " ")))
+	if slices.Contains(sieve.Extensions, "enotify") {
+		c.bwritelinef(`"NOTIFY" %s`, quoted(strings.Join(sieve.Methods(), " ")))
+	}
+	if !c.tls && c.baseTLSConfig != nil {
+		c.bwritelinef(`"STARTTLS"`)
+	}
+	if c.account != nil {
+		c.bwritelinef(`"OWNER" %s`, quoted(c.username))
+	}
+	c.bwritelinef(`"VERSION" "1.0"`)
+}
+
+// xreadline reads a line, without crlf. Unauthenticated connections must be
+// quicker to send their commands.
+func (c *conn) xreadline() string {
+	d := 30 * time.Minute
+	if c.account == nil {
+		d = 30 * time.Second
+	}
+	err := c.conn.SetReadDeadline(time.Now().Add(d))
+	c.log.Check(err, "setting read deadline")
+
+	line, err := bufpool.Readline(c.log, c.br)
+	if err != nil && errors.Is(err, moxio.ErrLineTooLong) {
+		panic(fmt.Errorf("%s (%w)", err, errProtocol))
+	} else if err != nil {
+		panic(fmt.Errorf("%s (%w)", err, errIO))
+	}
+	return line
+}
+
+// xreadWords reads a line with words: atoms (command names and numbers), quoted
+// strings and literals. Literals can only appear at the end of a line, the command
+// continues on the line after the literal data.
+//
+// If a literal is larger than allowed for scripts, its data is discarded and
+// tooLarge is set.
+func (c *conn) xreadWords() (words []string, tooLarge bool) {
+	line := c.xreadline()
+	for {
+		line = strings.TrimLeft(line, " ")
+		if line == "" {
+			return
+		}
+
+		switch line[0] {
+		case '"':
+			var s strings.Builder
+			i := 1
+			for {
+				if i >= len(line) {
+					xprotocolErrorf("unterminated quoted string")
+				}
+				ch := line[i]
+				i++
+				if ch == '"' {
+					break
+				} else if ch == '\\' {
+					if i >= len(line) || line[i] != '"' && line[i] != '\\' {
+						xprotocolErrorf("bad escape in quoted string")
+					}
+					ch = line[i]
+					i++
+				}
+				s.WriteByte(ch)
+			}
+			words = append(words, s.String())
+			line = line[i:]
+
+		case '{':
+			// Literal, "{size+}" for non-synchronizing literal as sent by clients. We also
+			// accept "{size}", without sending a continuation. ../rfc/5804
+			if !strings.HasSuffix(line, "}") {
+				xprotocolErrorf("literal must be at end of line")
+			}
+			s := strings.TrimSuffix(line[1:len(line)-1], "+")
+			size, err := strconv.ParseInt(s, 10, 64)
+			if err != nil || size < 0 || s != fmt.Sprintf("%d", size) {
+				xprotocolErrorf("bad literal size %q", s)
+			}
+			if size > maxScriptSize {
+				tooLarge = true
+				if _, err := io.CopyN(io.Discard, c.br, size); err != nil {
+					panic(fmt.Errorf("discarding literal: %s (%w)", err, errIO))
+				}
+				words = append(words, "")
+			} else {
+				buf := make([]byte, size)
+				if _, err := io.ReadFull(c.br, buf); err != nil {
+					panic(fmt.Errorf("reading literal: %s (%w)", err, errIO))
+				}
+				words = append(words, string(buf))
+			}
+			line = c.xreadline()
+
+		default:
+			i := strings.IndexByte(line, ' ')
+			if i < 0 {
+				i = len(line)
+			}
+			atom := line[:i]
+			if strings.ContainsAny(atom, `"{}\`) {
+				xprotocolErrorf("bad atom %q", atom)
+			}
+			words = append(words, atom)
+			line = line[i:]
+		}
+
+		if line != "" && line[0] != ' ' {
+			xprotocolErrorf("missing space after argument")
+		}
+	}
+}
+
+// command reads and handles a single command.
+func (c *conn) command() {
+	c.cmd = "(reading)"
+	c.cmdStart = time.Now()
+	cmdMetric := "(unrecognized)"
+
+	defer func() {
+		result := "ok"
+		defer func() {
+			metricCommands.WithLabelValues(cmdMetric, result).Observe(float64(time.Since(c.cmdStart)) / float64(time.Second))
+		}()
+
+		x := recover()
+		if x == cleanClose {
+			panic(x)
+		}
+		logFields := []slog.Attr{
+			slog.String("cmd", c.cmd),
+			slog.Duration("duration", time.Since(c.cmdStart)),
+		}
+
+		err, ok := x.(error)
+		if x == nil {
+			c.log.Debug("command done", logFields...)
+			c.xflush()
+			return
+		} else if !ok {
+			result = "panic"
+			panic(x)
+		}
+
+		var nerr noError
+		var serr syntaxError
+		if isClosed(err) {
+			result = "ioerror"
+			if errors.Is(err, errProtocol) {
+				c.writeBye(err.Error())
+			}
+			panic(err)
+		} else if errors.As(err, &serr) {
+			result = "badsyntax"
+			c.log.Debugx("command syntax error", err, logFields...)
+			c.bwriteResponse("NO", "", err.Error())
+		} else if errors.As(err, &nerr) {
+			result = "usererror"
+			c.log.Debugx("command result", err, logFields...)
+			c.bwriteResponse("NO", nerr.code, err.Error())
+		} else {
+			result = "error"
+			c.log.Errorx("command error", err, logFields...)
+			c.bwriteResponse("NO", "", "error processing command")
+		}
+		c.xflush()
+	}()
+
+	words, tooLarge := c.xreadWords()
+	c.cmdStart = time.Now()
+	if len(words) == 0 {
+		c.cmd = "(empty)"
+		xsyntaxErrorf("missing command")
+	}
+	c.cmd = strings.ToUpper(words[0])
+	fn, ok := commands[c.cmd]
+	if !ok {
+		xsyntaxErrorf("unknown command %q", words[0])
+	}
+	cmdMetric = strings.ToLower(c.cmd)
+	if c.account == nil && !commandsNotAuthenticated[c.cmd] {
+		xnoErrorf("", "not authenticated")
+	}
+	if tooLarge {
+		xnoErrorf("QUOTA/MAXSIZE", "script too large, maximum %d bytes", maxScriptSize)
+	}
+	fn(c, words[1:])
+}
+
+var commands = map[string]func(c *conn, args []string){
+	"CAPABILITY":   (*conn).cmdCapability,
+	"LOGOUT":       (*conn).cmdLogout,
+	"NOOP":         (*conn).cmdNoop,
+	"STARTTLS":     (*conn).cmdStarttls,
+	"AUTHENTICATE": (*conn).cmdAuthenticate,
+	"HAVESPACE":    (*conn).cmdHavespace,
+	"PUTSCRIPT":    (*conn).cmdPutscript,
+	"CHECKSCRIPT":  (*conn).cmdCheckscript,
+	"LISTSCRIPTS":  (*conn).cmdListscripts,
+	"SETACTIVE":    (*conn).cmdSetactive,
+	"GETSCRIPT":    (*conn).cmdGetscript,
+	"DELETESCRIPT": (*conn).cmdDeletescript,
+	"RENAMESCRIPT": (*conn).cmdRenamescript,
+}
+
+// Commands allowed before authentication.
+var commandsNotAuthenticated = map[string]bool{
+	"CAPABILITY":   true,
+	"LOGOUT":       true,
+	"NOOP":         true,
+	"STARTTLS":     true,
+	"AUTHENTICATE": true,
+}
+
+func xargs(args []string, n int) {
+	if len(args) != n {
+		xsyntaxErrorf("expected %d arguments, got %d", n, len(args))
+	}
+}
+
+// xcheckName checks a script name. ../rfc/5804
+func xcheckName(name string) {
+	if name == "" {
+		xnoErrorf("", "empty script name")
+	} else if len(name) > maxNameSize {
+		xnoErrorf("", "script name too long, maximum %d bytes", maxNameSize)
+	} else if !utf8.ValidString(name) {
+		xnoErrorf("", "script name must be utf-8")
+	}
+	for _, r := range name {
+		if unicode.IsControl(r) || r == '\u2028' || r == '\u2029' {
+			xnoErrorf("", "script name cannot contain control characters")
+		}
+	}
+}
+
+// xcheckScript parses script, and fails the command if it is not valid.
+func xcheckScript(script string) {
+	if !utf8.ValidString(script) {
+		xnoErrorf("", "script must be utf-8")
+	}
+	if _, err := sieve.Parse(script); err != nil {
+		xnoErrorf("", "invalid script: %v", err)
+	}
+}
+
+// xcheckSieveError fails the command with a response code for sieve script errors
+// from the store.
+func xcheckSieveError(err error, format string, args ...any) {
+	if errors.Is(err, store.ErrSieveScriptNotFound) {
+		xnoErrorf("NONEXISTENT", "%s", err)
+	} else if errors.Is(err, store.ErrSieveScriptActive) {
+		xnoErrorf("ACTIVE", "%s", err)
+	} else if errors.Is(err, store.ErrSieveScriptExists) {
+		xnoErrorf("ALREADYEXISTS", "%s", err)
+	} else if errors.Is(err, store.ErrSieveScript) {
+		xnoErrorf("", "%s", err)
+	}
+	xcheckf(err, format, args...)
+}
+
+func (c *conn) cmdCapability(args []string) {
+	xargs(args, 0)
+	c.bwriteCapabilities()
+	c.bwriteResponse("OK", "", "")
+}
+
+func (c *conn) cmdLogout(args []string) {
+	xargs(args, 0)
+	c.bwriteResponse("OK", "", "bye")
+	c.xflush()
+	panic(cleanClose)
+}
+
+func (c *conn) cmdNoop(args []string) {
+	if len(args) > 1 {
+		xsyntaxErrorf("expected at most 1 argument")
+	}
+	var code string
+	if len(args) == 1 {
+		code = "TAG " + quoted(args[0])
+	}
+	c.bwriteResponse("OK", code, "done")
+}
+
+func (c *conn) cmdStarttls(args []string) {
+	xargs(args, 0)
+	if c.tls {
+		xnoErrorf("", "tls already active")
+	} else if c.account != nil {
+		xnoErrorf("", "already authenticated")
+	} else if c.baseTLSConfig == nil {
+		xnoErrorf("", "starttls not available")
+	}
+	// Commands sent after STARTTLS but before the handshake could be injected by an
+	// attacker, we don't allow them.
+	if c.br.Buffered() > 0 {
+		xprotocolErrorf("data after starttls command")
+	}
+
+	c.bwriteResponse("OK", "", "begin tls negotiation")
+	c.xflush()
+
+	tlsConn := tls.Server(c.conn, c.baseTLSConfig.Clone())
+	ctx, cancel := context.WithTimeout(mox.Context, time.Minute)
+	defer cancel()
+	c.log.Debug("starting tls server handshake")
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		panic(fmt.Errorf("tls handshake: %s (%w)", err, errIO))
+	}
+	cancel()
+	cs := tlsConn.ConnectionState()
+	c.log.Debug("tls handshake completed",
+		slog.String("version", tls.VersionName(cs.Version)),
+		slog.String("ciphersuite", tls.CipherSuiteName(cs.CipherSuite)),
+		slog.String("sni", cs.ServerName))
+	c.setConn(tlsConn)
+	c.tls = true
+
+	// Capabilities must be sent again after the handshake. ../rfc/5804
+	c.bwriteCapabilities()
+	c.bwriteResponse("OK", "", "tls active")
+}
+
+func (c *conn) cmdAuthenticate(args []string) {
+	if c.account != nil {
+		xnoErrorf("", "already authenticated")
+	}
+	if len(args) != 1 && len(args) != 2 {
+		xsyntaxErrorf("expected mechanism and optional initial response")
+	}
+	if !strings.EqualFold(args[0], "PLAIN") {
+		xnoErrorf("", "unsupported mechanism, only PLAIN is supported")
+	}
+	if !c.tls && !c.noRequireSTARTTLS {
+		xnoErrorf("ENCRYPT-NEEDED", "authentication requires tls, use starttls")
+	}
+
+	// For many failed auth attempts, slow down verification attempts.
+	if c.authFailed > 3 && authFailDelay > 0 {
+		mox.Sleep(mox.Context, time.Duration(c.authFailed-3)*authFailDelay)
+	}
+	c.authFailed++ // Reset on success.
+
+	var state *tls.ConnectionState
+	if tc, ok := c.conn.(*tls.Conn); ok {
+		v := tc.ConnectionState()
+		state = &v
+	}
+	localIP, _, _ := net.SplitHostPort(c.conn.LocalAddr().String())
+	la := store.LoginAttempt{
+		RemoteIP: c.remoteIP.String(),
+		LocalIP:  localIP,
+		TLS:      store.LoginAttemptTLS(state),
+		Protocol: "managesieve",
+		AuthMech: "plain",
+		Result:   store.AuthError, // Replaced below.
+	}
+	defer func() {
+		store.LoginAttemptAdd(context.Background(), c.log, la)
+	}()
+
+	var resp string
+	if len(args) == 2 {
+		resp = args[1]
+	} else {
+		// Continuation is an empty string, the response a string. ../rfc/5804
+		c.bwritelinef(`""`)
+		restore := c.xtrace(mlog.LevelTraceauth)
+		words, _ := c.xreadWords()
+		restore()
+		if len(words) != 1 {
+			xsyntaxErrorf("expected single string with authentication response")
+		}
+		resp = words[0]
+		if resp == "*" {
+			la.Result = store.AuthAborted
+			xnoErrorf("", "authentication aborted")
+		}
+	}
+
+	buf, err := base64.StdEncoding.DecodeString(resp)
+	if err != nil {
+		la.Result = store.AuthBadProtocol
+		xsyntaxErrorf("bad base64 in authentication response: %v", err)
+	}
+	// ../rfc/4616:67
+	t := strings.Split(string(buf), "\u0000")
+	if len(t) != 3 {
+		la.Result = store.AuthBadProtocol
+		xsyntaxErrorf("bad plain authentication response")
+	}
+	authz, username, password := t[0], t[1], t[2]
+	if authz != "" && authz != username {
+		la.Result = store.AuthBadProtocol
+		xnoErrorf("", "cannot assume other role")
+	}
+	la.LoginAddress = username
+
+	t0 := time.Now()
+	authLockedOut := func(err error) {
+		la.Result = store.AuthLockedOut
+		c.log.Info("authentication refused due to lockout", slog.String("account", la.AccountName), slog.Any("remote", c.remoteIP))
+		xnoErrorf("", "%s", err)
+	}
+	if err := store.AuthLockoutCheck(context.TODO(), c.remoteIP, ""); errors.Is(err, store.ErrAuthLockedOut) {
+		authLockedOut(err)
+	} else {
+		xcheckf(err, "checking authentication lockout")
+	}
+
+	acc, accName, err := store.OpenEmailAuth(c.log, username, password, true)
+	la.AccountName = accName
+	if errors.Is(err, store.ErrAuthLockedOut) {
+		authLockedOut(err)
+	} else if err != nil {
+		mox.LimiterFailedAuth.Add(c.remoteIP, t0, 1)
+		if errors.Is(err, mox.ErrDomainNotFound) || errors.Is(err, mox.ErrAddressNotFound) || errors.Is(err, store.ErrUnknownCredentials) {
+			la.Result = store.AuthBadCredentials
+			c.log.Info("authentication failed", slog.String("username", username), slog.Any("remote", c.remoteIP))
+			xnoErrorf("", "bad credentials")
+		} else if errors.Is(err, store.ErrLoginDisabled) {
+			la.Result = store.AuthLoginDisabled
+			c.log.Info("account login disabled", slog.String("username", username))
+			xnoErrorf("", "%s", err)
+		}
+		xcheckf(err, "verifying credentials")
+	}
+	if accConf, ok := acc.Conf(); ok && !accConf.LoginNetworkAllowed(c.remoteIP) {
+		la.Result = store.AuthNetworkDenied
+		c.log.Info("account login from network not allowed", slog.String("account", acc.Name), slog.Any("remoteip", c.remoteIP))
+		err := acc.Close()
+		c.log.Check(err, "closing account")
+		xnoErrorf("", "%s", store.ErrLoginNetwork)
+	}
+
+	la.Result = store.AuthSuccess
+	mox.LimiterFailedAuth.Reset(c.remoteIP, t0)
+	c.authFailed = 0
+	c.account = acc
+	c.username = username
+	c.bwriteResponse("OK", "", "authenticated")
+}
+
+func (c *conn) cmdHavespace(args []string) {
+	xargs(args, 2)
+	name := args[0]
+	xcheckName(name)
+	size, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil || size < 0 {
+		xsyntaxErrorf("bad size %q", args[1])
+	}
+	if size > maxScriptSize {
+		xnoErrorf("QUOTA/MAXSIZE", "script too large, maximum %d bytes", maxScriptSize)
+	}
+	c.xcheckScriptCount(name)
+	c.bwriteResponse("OK", "", "")
+}
+
+// xcheckScriptCount fails if a script with name would exceed the maximum number of
+// scripts.
+func (c *conn) xcheckScriptCount(name string) {
+	l, err := c.account.SieveScripts(context.TODO())
+	xcheckf(err, "listing scripts")
+	exists := slices.ContainsFunc(l, func(ss store.SieveScript) bool { return ss.Name == name })
+	if !exists && len(l) >= maxScripts {
+		xnoErrorf("QUOTA/MAXSCRIPTS", "too many scripts, maximum %d", maxScripts)
+	}
+}
+
+func (c *conn) cmdPutscript(args []string) {
+	xargs(args, 2)
+	name, script := args[0], args[1]
+	xcheckName(name)
+	c.xcheckScriptCount(name)
+	xcheckScript(script)
+	err := c.account.SieveScriptPut(context.TODO(), name, script)
+	xcheckSieveError(err, "saving script")
+	c.log.Info("sieve script saved", slog.String("name", name))
+	c.bwriteResponse("OK", "", "")
+}
+
+func (c *conn) cmdCheckscript(args []string) {
+	xargs(args, 1)
+	xcheckScript(args[0])
+	c.bwriteResponse("OK", "", "")
+}
+
+func (c *conn) cmdListscripts(args []string) {
+	xargs(args, 0)
+	l, err := c.account.SieveScripts(context.TODO())
+	xcheckf(err, "listing scripts")
+	for _, ss := range l {
+		if ss.Active {
+			c.bwritelinef("%s ACTIVE", quoted(ss.Name))
+		} else {
+			c.bwritelinef("%s", quoted(ss.Name))
+		}
+	}
+	c.bwriteResponse("OK", "", "")
+}
+
+func (c *conn) cmdSetactive(args []string) {
+	xargs(args, 1)
+	// Empty name deactivates all scripts.
+	name := args[0]
+	if name != "" {
+		xcheckName(name)
+	}
+	err := c.account.SieveScriptSetActive(context.TODO(), name)
+	xcheckSieveError(err, "setting active script")
+	c.log.Info("active sieve script set", slog.String("name", name))
+	c.bwriteResponse("OK", "", "")
+}
+
+func (c *conn) cmdGetscript(args []string) {
+	xargs(args, 1)
+	ss, err := c.account.SieveScriptGet(context.TODO(), args[0])
+	xcheckSieveError(err, "get script")
+	c.bwritelinef("{%d}", len(ss.Script))
+	c.bwritelinef("%s", ss.Script)
+	c.bwriteResponse("OK", "", "")
+}
+
+func (c *conn) cmdDeletescript(args []string) {
+	xargs(args, 1)
+	err := c.account.SieveScriptDelete(context.TODO(), args[0])
+	xcheckSieveError(err, "deleting script")
+	c.log.Info("sieve script deleted", slog.String("name", args[0]))
+	c.bwriteResponse("OK", "", "")
+}
+
+func (c *conn) cmdRenamescript(args []string) {
+	xargs(args, 2)
+	xcheckName(args[1])
+	err := c.account.SieveScriptRename(context.TODO(), args[0], args[1])
+	xcheckSieveError(err, "renaming script")
+	c.log.Info("sieve script renamed", slog.String("name", args[0]), slog.String("newname", args[1]))
+	c.bwriteResponse("OK", "", "")
+}
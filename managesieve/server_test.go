@@ -0,0 +1,304 @@
+package managesieve
+
+import (
+	"bufio"
+	"context"
+	"crypto/ed25519"
+	cryptorand "crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mjl-/mox/mlog"
+	"github.com/mjl-/mox/mox-"
+	"github.com/mjl-/mox/store"
+)
+
+var ctxbg = context.Background()
+var pkglog = mlog.New("managesieve", nil)
+
+const password0 = "tést    " // NFD and various unicode spaces.
+
+func init() {
+	authFailDelay = 0
+}
+
+func tcheck(t *testing.T, err error, msg string) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("%s: %s", msg, err)
+	}
+}
+
+type testconn struct {
+	t          *testing.T
+	conn       net.Conn
+	br         *bufio.Reader
+	done       chan struct{}
+	acc        *store.Account
+	switchStop func()
+}
+
+func start(t *testing.T, noRequireSTARTTLS bool) *testconn {
+	limitersInit() // Reset rate limiters.
+
+	mox.Context = ctxbg
+	mox.ConfigStaticPath = filepath.FromSlash("../testdata/managesieve/mox.conf")
+	mox.MustLoadConfig(true, false)
+	store.Close() // May not be open, we ignore error.
+	os.RemoveAll("../testdata/managesieve/data")
+	err := store.Init(ctxbg)
+	tcheck(t, err, "store init")
+	acc, err := store.OpenAccount(pkglog, "mjl", false)
+	tcheck(t, err, "open account")
+	err = acc.SetPassword(pkglog, password0)
+	tcheck(t, err, "set password")
+	switchStop := store.Switchboard()
+
+	serverConn, clientConn := net.Pipe()
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{fakeCert(t)},
+	}
+	done := make(chan struct{})
+	go func() {
+		serve("test", 1, tlsConfig, serverConn, noRequireSTARTTLS)
+		close(done)
+	}()
+	tc := &testconn{t: t, conn: clientConn, br: bufio.NewReader(clientConn), done: done, acc: acc, switchStop: switchStop}
+	return tc
+}
+
+func (tc *testconn) close() {
+	tc.t.Helper()
+	tc.conn.Close()
+	<-tc.done
+	err := tc.acc.Close()
+	tcheck(tc.t, err, "close account")
+	tc.acc.CheckClosed()
+	tc.switchStop()
+	err = store.Close()
+	tcheck(tc.t, err, "store close")
+}
+
+func fakeCert(t *testing.T) tls.Certificate {
+	privKey := ed25519.NewKeyFromSeed(make([]byte, ed25519.SeedSize)) // Fake key, don't use this for real!
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1), // Required field...
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	localCertBuf, err := x509.CreateCertificate(cryptorand.Reader, template, template, privKey.Public(), privKey)
+	tcheck(t, err, "making certificate")
+	cert, err := x509.ParseCertificate(localCertBuf)
+	tcheck(t, err, "parsing generated certificate")
+	return tls.Certificate{
+		Certificate: [][]byte{localCertBuf},
+		PrivateKey:  privKey,
+		Leaf:        cert,
+	}
+}
+
+func (tc *testconn) readline() string {
+	tc.t.Helper()
+	line, err := tc.br.ReadString('\n')
+	tcheck(tc.t, err, "read line")
+	return strings.TrimSuffix(line, "\r\n")
+}
+
+// readResponse reads lines until an OK, NO or BYE response, returning the lines
+// before it, with literals inlined, and the response line.
+func (tc *testconn) readResponse() (lines []string, result string) {
+	tc.t.Helper()
+	for {
+		line := tc.readline()
+		if strings.HasPrefix(line, "OK") || strings.HasPrefix(line, "NO") || strings.HasPrefix(line, "BYE") {
+			return lines, line
+		}
+		if strings.HasPrefix(line, "{") && strings.HasSuffix(line, "}") {
+			size, err := strconv.Atoi(line[1 : len(line)-1])
+			tcheck(tc.t, err, "parse literal size")
+			buf := make([]byte, size)
+			_, err = io.ReadFull(tc.br, buf)
+			tcheck(tc.t, err, "read literal")
+			line = string(buf)
+			if s := tc.readline(); s != "" {
+				tc.t.Fatalf("got %q after literal, expected empty line", s)
+			}
+		}
+		lines = append(lines, line)
+	}
+}
+
+func (tc *testconn) writelinef(format string, args ...any) {
+	tc.t.Helper()
+	_, err := fmt.Fprintf(tc.conn, format+"\r\n", args...)
+	tcheck(tc.t, err, "write")
+}
+
+// transactf writes a command and checks the response starts with expResult.
+func (tc *testconn) transactf(expResult string, format string, args ...any) []string {
+	tc.t.Helper()
+	tc.writelinef(format, args...)
+	lines, result := tc.readResponse()
+	if !strings.HasPrefix(result, expResult) {
+		tc.t.Fatalf("got result %q, expected %q", result, expResult)
+	}
+	return lines
+}
+
+func plainResponse(username, password string) string {
+	return base64.StdEncoding.EncodeToString([]byte("\u0000" + username + "\u0000" + password))
+}
+
+func hasLine(lines []string, prefix string) bool {
+	for _, l := range lines {
+		if strings.HasPrefix(l, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestStarttls(t *testing.T) {
+	tc := start(t, false)
+	defer tc.close()
+
+	lines, result := tc.readResponse()
+	if !strings.HasPrefix(result, "OK") || !hasLine(lines, `"STARTTLS"`) || !hasLine(lines, `"SASL" ""`) || !hasLine(lines, `"SIEVE" "body `) {
+		t.Fatalf("bad greeting %q %q", lines, result)
+	}
+
+	// Authentication requires TLS.
+	tc.transactf("NO (ENCRYPT-NEEDED)", `AUTHENTICATE "PLAIN" "%s"`, plainResponse("mjl@mox.example", password0))
+	tc.transactf("NO", "LISTSCRIPTS")
+
+	tc.transactf("OK", "STARTTLS")
+	tlsConn := tls.Client(tc.conn, &tls.Config{InsecureSkipVerify: true})
+	err := tlsConn.Handshake()
+	tcheck(t, err, "tls handshake")
+	tc.conn = tlsConn
+	tc.br = bufio.NewReader(tlsConn)
+
+	lines, result = tc.readResponse()
+	if !strings.HasPrefix(result, "OK") || hasLine(lines, `"STARTTLS"`) || !hasLine(lines, `"SASL" "PLAIN"`) {
+		t.Fatalf("bad capabilities after starttls %q %q", lines, result)
+	}
+	tc.transactf("NO", "STARTTLS")
+
+	tc.transactf("NO", `AUTHENTICATE "PLAIN" "%s"`, plainResponse("mjl@mox.example", "badpassword"))
+	tc.transactf("NO", `AUTHENTICATE "SCRAM-SHA-256"`)
+	tc.transactf("OK", `AUTHENTICATE "PLAIN" "%s"`, plainResponse("mjl@mox.example", password0))
+	lines = tc.transactf("OK", "CAPABILITY")
+	if !hasLine(lines, `"OWNER" "mjl@mox.example"`) {
+		t.Fatalf("missing owner in capabilities, %q", lines)
+	}
+	tc.transactf("NO", `AUTHENTICATE "PLAIN" "%s"`, plainResponse("mjl@mox.example", password0))
+	tc.transactf("OK", "LOGOUT")
+}
+
+func TestScripts(t *testing.T) {
+	tc := start(t, true)
+	defer tc.close()
+
+	_, result := tc.readResponse()
+	if !strings.HasPrefix(result, "OK") {
+		t.Fatalf("bad greeting %q", result)
+	}
+
+	// Authentication with continuation, aborted and successful.
+	tc.writelinef(`AUTHENTICATE "PLAIN"`)
+	if line := tc.readline(); line != `""` {
+		t.Fatalf("got %q, expected empty continuation", line)
+	}
+	tc.transactf("NO", `"*"`)
+	tc.writelinef(`AUTHENTICATE "PLAIN"`)
+	tc.readline()
+	resp := plainResponse("mjl@mox.example", password0)
+	tc.transactf("OK", "{%d+}\r\n%s", len(resp), resp)
+
+	tc.transactf("OK (TAG \"x\")", `NOOP "x"`)
+	tc.transactf("NO", "BOGUS")
+	tc.transactf("NO", "LISTSCRIPTS extra")
+
+	lines := tc.transactf("OK", "LISTSCRIPTS")
+	if len(lines) != 0 {
+		t.Fatalf("got scripts %q, expected none", lines)
+	}
+
+	const script = "require [\"fileinto\"];\r\nif header :contains \"subject\" \"test\" {\r\n\tfileinto \"Test\";\r\n}\r\n"
+	tc.transactf("OK", "CHECKSCRIPT {%d+}\r\n%s", len(script), script)
+	tc.transactf("NO", `CHECKSCRIPT "bogus;"`)
+	tc.transactf("NO", `PUTSCRIPT "bad" "bogus;"`)
+	tc.transactf("NO", `PUTSCRIPT "" "keep;"`)
+	tc.transactf("OK", "PUTSCRIPT \"test\" {%d+}\r\n%s", len(script), script)
+	tc.transactf("OK", `PUTSCRIPT "other" "keep;"`)
+	tc.transactf("OK", `HAVESPACE "new" 1000`)
+	tc.transactf("NO (QUOTA/MAXSIZE)", `HAVESPACE "new" %d`, maxScriptSize+1)
+	tc.transactf("NO (QUOTA/MAXSIZE)", "PUTSCRIPT \"large\" {%d+}\r\n%s", maxScriptSize+1, strings.Repeat("x", maxScriptSize+1))
+
+	lines = tc.transactf("OK", "LISTSCRIPTS")
+	if strings.Join(lines, ",") != `"other","test"` {
+		t.Fatalf("got scripts %q", lines)
+	}
+
+	tc.transactf("NO (NONEXISTENT)", `SETACTIVE "missing"`)
+	tc.transactf("OK", `SETACTIVE "test"`)
+	lines = tc.transactf("OK", "LISTSCRIPTS")
+	if strings.Join(lines, ",") != `"other","test" ACTIVE` {
+		t.Fatalf("got scripts %q", lines)
+	}
+	ss, err := tc.acc.SieveScriptActive(ctxbg)
+	tcheck(t, err, "get active script")
+	if ss == nil || ss.Name != "test" || ss.Script != script {
+		t.Fatalf("unexpected active script %#v", ss)
+	}
+
+	lines = tc.transactf("OK", `GETSCRIPT "test"`)
+	if len(lines) != 1 || lines[0] != script {
+		t.Fatalf("got script %q, expected %q", lines, script)
+	}
+	tc.transactf("NO (NONEXISTENT)", `GETSCRIPT "missing"`)
+
+	tc.transactf("NO (ACTIVE)", `DELETESCRIPT "test"`)
+	tc.transactf("NO (ALREADYEXISTS)", `RENAMESCRIPT "test" "other"`)
+	tc.transactf("NO (NONEXISTENT)", `RENAMESCRIPT "missing" "new"`)
+	tc.transactf("OK", `RENAMESCRIPT "test" "renamed"`)
+	lines = tc.transactf("OK", "LISTSCRIPTS")
+	if strings.Join(lines, ",") != `"other","renamed" ACTIVE` {
+		t.Fatalf("got scripts %q", lines)
+	}
+
+	// Replacing the active script keeps it active.
+	tc.transactf("OK", `PUTSCRIPT "renamed" "discard;"`)
+	ss, err = tc.acc.SieveScriptActive(ctxbg)
+	tcheck(t, err, "get active script")
+	if ss == nil || ss.Name != "renamed" || ss.Script != "discard;" {
+		t.Fatalf("unexpected active script %#v", ss)
+	}
+
+	tc.transactf("OK", `SETACTIVE ""`)
+	ss, err = tc.acc.SieveScriptActive(ctxbg)
+	tcheck(t, err, "get active script")
+	if ss != nil {
+		t.Fatalf("unexpected active script %#v", ss)
+	}
+	tc.transactf("OK", `DELETESCRIPT "renamed"`)
+	tc.transactf("NO (NONEXISTENT)", `DELETESCRIPT "renamed"`)
+	lines = tc.transactf("OK", "LISTSCRIPTS")
+	if strings.Join(lines, ",") != `"other"` {
+		t.Fatalf("got scripts %q", lines)
+	}
+
+	// Malformed command closes the connection.
+	tc.transactf("BYE", `GETSCRIPT "unterminated`)
+}
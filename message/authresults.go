@@ -61,6 +61,17 @@ func MakeAuthProp(typ, property, value string, isAddrLike bool, Comment string)
 // Header returns an Authentication-Results header, possibly spanning multiple
 // lines, always ending in crlf.
 func (h AuthResults) Header() string {
+	return h.header("Authentication-Results:")
+}
+
+// ARCHeader returns an ARC-Authentication-Results header for an ARC set with the
+// instance number, possibly spanning multiple lines, always ending in crlf.
+// ../rfc/8617
+func (h AuthResults) ARCHeader(instance int) string {
+	return h.header(fmt.Sprintf("ARC-Authentication-Results: i=%d;", instance))
+}
+
+func (h AuthResults) header(first string) string {
 	// Escaping of values: ../rfc/8601:684 ../rfc/2045:661
 
 	optComment := func(s string) string {
@@ -71,7 +82,7 @@ func (h AuthResults) Header() string {
 	}
 
 	w := &HeaderWriter{}
-	w.Add("", "Authentication-Results:"+optComment(h.Comment)+" "+value(h.Hostname, false)+";")
+	w.Add("", first+optComment(h.Comment)+" "+value(h.Hostname, false)+";")
 	for i, m := range h.Methods {
 		w.Newline()
 
@@ -23,6 +23,12 @@ func TestAuthResultsPack(t *testing.T) {
 	if s != exp {
 		t.Fatalf("got %q, expected %q", s, exp)
 	}
+
+	s = authRes.ARCHeader(2)
+	const arcExp = "ARC-Authentication-Results: i=2; (xn--mx-lka.example) møx.example;\r\n\tdkim=pass header.d=møx.example (xn--mx-lka.example)\r\n"
+	if s != arcExp {
+		t.Fatalf("got %q, expected %q", s, arcExp)
+	}
 }
 
 func TestAuthResultsParse(t *testing.T) {
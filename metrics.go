@@ -96,6 +96,15 @@ func init() {
 			"key",
 		},
 	)}
+	dkim.MetricCacheHit = counterVec{promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "mox_dkim_cache_hit_total",
+			Help: "DKIM verifications using a cached DNS record or cached signature verification, label type is record or signature.",
+		},
+		[]string{
+			"type",
+		},
+	)}
 	dkim.MetricVerify = histogramVec{
 		promauto.NewHistogramVec(
 			prometheus.HistogramOpts{
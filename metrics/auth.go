@@ -16,7 +16,7 @@ var (
 			"kind",    // submission, imap, webmail, webapi, webaccount, webadmin (formerly httpaccount, httpadmin)
 			"variant", // login, plain, scram-sha-256, scram-sha-1, cram-md5, weblogin, websessionuse, httpbasic, tlsclientauth.
 			// todo: we currently only use badcreds, but known baduser can be helpful
-			"result", // ok, baduser, badpassword, badcreds, badchanbind, error, aborted, badprotocol, logindisabled; see ../store/loginattempt.go:/AuthResult.
+			"result", // ok, baduser, badpassword, badcreds, badchanbind, error, aborted, badprotocol, logindisabled, networkdenied, clientdenied, lockedout, toomanyconns; see ../store/loginattempt.go:/AuthResult.
 		},
 	)
 
@@ -29,6 +29,16 @@ var (
 			"kind", // submission, imap, httpaccount, httpadmin
 		},
 	)
+
+	metricAuthLockout = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "mox_authentication_lockouts_total",
+			Help: "Authentication lockouts started or extended due to many failures.",
+		},
+		[]string{
+			"kind", // ip, account
+		},
+	)
 )
 
 func AuthenticationInc(kind, variant, result string) {
@@ -38,3 +48,7 @@ func AuthenticationInc(kind, variant, result string) {
 func AuthenticationRatelimitedInc(kind string) {
 	metricAuthRatelimited.WithLabelValues(kind).Inc()
 }
+
+func AuthenticationLockoutInc(kind string) {
+	metricAuthLockout.WithLabelValues(kind).Inc()
+}
@@ -0,0 +1,30 @@
+package metrics
+
+import (
+	"os"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// DatabaseSize registers a gauge with the size of a database file, e.g. "queue"
+// or "dmarcrpt". Path is called when gathering metrics, so the data directory does
+// not have to be known yet when registering. A missing file has size zero.
+func DatabaseSize(database string, path func() string) {
+	promauto.NewGaugeFunc(
+		prometheus.GaugeOpts{
+			Name: "mox_database_size_bytes",
+			Help: "Size of database file on disk.",
+			ConstLabels: prometheus.Labels{
+				"database": database,
+			},
+		},
+		func() float64 {
+			fi, err := os.Stat(path())
+			if err != nil {
+				return 0
+			}
+			return float64(fi.Size())
+		},
+	)
+}
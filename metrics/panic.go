@@ -18,11 +18,15 @@ var metricPanic = promauto.NewCounterVec(
 type Panic string
 
 const (
+	Admin            Panic = "admin"
 	Ctl              Panic = "ctl"
 	Import           Panic = "import"
 	Serve            Panic = "serve"
 	Imapserver       Panic = "imapserver"
+	Managesieve      Panic = "managesieve"
 	Dmarcdb          Panic = "dmarcdb"
+	Eventdb          Panic = "eventdb"
+	Greylist         Panic = "greylist"
 	Mtastsdb         Panic = "mtastsdb"
 	Queue            Panic = "queue"
 	Smtpclient       Panic = "smtpclient"
@@ -36,6 +40,7 @@ const (
 	Store            Panic = "store"
 	Webadmin         Panic = "webadmin"
 	Webapi           Panic = "webapi"
+	Webjmap          Panic = "webjmap"
 	Webmailsendevent Panic = "webmailsendevent"
 	Webmail          Panic = "webmail"
 	Webmailrequest   Panic = "webmailrequest"
@@ -47,11 +52,15 @@ func init() {
 	// Ensure the panic counts are initialized to 0, so the query for change also picks
 	// up the first panic.
 	names := []Panic{
+		Admin,
 		Ctl,
 		Import,
 		Serve,
 		Imapserver,
+		Managesieve,
 		Mtastsdb,
+		Eventdb,
+		Greylist,
 		Queue,
 		Smtpclient,
 		Smtpserver,
@@ -61,6 +70,7 @@ func init() {
 		Importmanage,
 		Importmessages,
 		Webadmin,
+		Webjmap,
 		Webmailsendevent,
 		Webmail,
 		Webmailrequest,
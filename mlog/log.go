@@ -65,6 +65,7 @@ type LogStringer interface {
 
 var lowestLevel atomic.Int32                     // For quick initial check.
 var config atomic.Pointer[map[string]slog.Level] // For secondary complete check for match.
+var destination atomic.Pointer[slog.Handler]     // If set, records are passed on instead of written to stderr.
 
 func init() {
 	SetConfig(map[string]slog.Level{"": LevelDebug})
@@ -82,6 +83,19 @@ func SetConfig(c map[string]slog.Level) {
 	config.Store(&c)
 }
 
+// SetHandler sets a handler that log records are passed to instead of being
+// written to stderr, e.g. when mox is embedded in another program. Only records
+// matching the log levels set with SetConfig are passed on. Attributes are
+// flattened: "pkg" attributes come first, and group names are prefixed to
+// attribute keys. A nil handler restores writing to stderr.
+func SetHandler(h slog.Handler) {
+	if h == nil {
+		destination.Store(nil)
+	} else {
+		destination.Store(&h)
+	}
+}
+
 var (
 	// When the configured log level is any of the Trace levels, all protocol messages
 	// are printed. But protocol "data" (like an email message in the SMTP DATA
@@ -363,9 +377,40 @@ func (h *handler) Handle(ctx context.Context, r slog.Record) error {
 	} else if hideAuth {
 		r.Message = "***"
 	}
+	if dst := destination.Load(); dst != nil {
+		return h.forward(ctx, *dst, r)
+	}
 	return h.write(l, r)
 }
 
+// forward passes record r to handler dst, with the attributes of h.
+func (h *handler) forward(ctx context.Context, dst slog.Handler, r slog.Record) error {
+	if !dst.Enabled(ctx, r.Level) {
+		return nil
+	}
+	nr := slog.NewRecord(r.Time, r.Level, r.Message, r.PC)
+	for _, pkg := range h.Pkgs {
+		nr.AddAttrs(slog.String("pkg", pkg))
+	}
+	add := func(a slog.Attr) {
+		a.Key = h.Group + a.Key
+		nr.AddAttrs(a)
+	}
+	r.Attrs(func(a slog.Attr) bool {
+		add(a)
+		return true
+	})
+	for _, a := range h.Attrs {
+		add(a)
+	}
+	if h.Fn != nil {
+		for _, a := range h.Fn() {
+			add(a)
+		}
+	}
+	return dst.Handle(ctx, nr)
+}
+
 // Reuse buffers to format log lines into.
 var logBuffersStore [32][256]byte
 var logBuffers = make(chan []byte, 200)
@@ -9,6 +9,7 @@ import (
 	"crypto/elliptic"
 	cryptorand "crypto/rand"
 	"crypto/rsa"
+	"crypto/sha256"
 	"crypto/tls"
 	"crypto/x509"
 	"encoding/base64"
@@ -17,6 +18,7 @@ import (
 	"fmt"
 	"io"
 	"log/slog"
+	"maps"
 	"net"
 	"net/http"
 	"net/url"
@@ -41,10 +43,12 @@ import (
 	"github.com/mjl-/mox/config"
 	"github.com/mjl-/mox/dkim"
 	"github.com/mjl-/mox/dns"
+	"github.com/mjl-/mox/junk"
 	"github.com/mjl-/mox/message"
 	"github.com/mjl-/mox/mlog"
 	"github.com/mjl-/mox/moxio"
 	"github.com/mjl-/mox/mtasts"
+	"github.com/mjl-/mox/oauthbearer"
 	"github.com/mjl-/mox/smtp"
 )
 
@@ -101,6 +105,7 @@ type AccountDestination struct {
 	Localpart   smtp.Localpart // In original casing as written in config file.
 	Account     string
 	Destination config.Destination
+	Wildcard    bool // If destination for all subdomains of its domain, see WildcardAddress.
 }
 
 // LogLevelSet sets a new log level for pkg. An empty pkg sets the default log
@@ -205,6 +210,38 @@ func (c *Config) Domains() (l []string) {
 	return l
 }
 
+// DomainAdmins returns the configured domain admins by login name.
+func (c *Config) DomainAdmins() (m map[string]config.DomainAdmin) {
+	c.withDynamicLock(func() {
+		m = maps.Clone(c.Dynamic.DomainAdmins)
+	})
+	return
+}
+
+// DomainAdmin returns the config for a domain admin by login name.
+func (c *Config) DomainAdmin(name string) (da config.DomainAdmin, ok bool) {
+	c.withDynamicLock(func() {
+		da, ok = c.Dynamic.DomainAdmins[name]
+	})
+	return
+}
+
+// AdminTokens returns the configured admin API tokens by name.
+func (c *Config) AdminTokens() (m map[string]config.AdminToken) {
+	c.withDynamicLock(func() {
+		m = maps.Clone(c.Dynamic.AdminTokens)
+	})
+	return
+}
+
+// IMAPClientRules returns the configured rules for IMAP clients.
+func (c *Config) IMAPClientRules() (l []config.IMAPClientRule) {
+	c.withDynamicLock(func() {
+		l = c.Dynamic.IMAPClientRules
+	})
+	return
+}
+
 func (c *Config) Accounts() (l []string) {
 	c.withDynamicLock(func() {
 		for name := range c.Dynamic.Accounts {
@@ -218,7 +255,7 @@ func (c *Config) AccountsDisabled() (all, disabled []string) {
 	c.withDynamicLock(func() {
 		for name, conf := range c.Dynamic.Accounts {
 			all = append(all, name)
-			if conf.LoginDisabled != "" {
+			if conf.LoginDisabledMessage() != "" {
 				disabled = append(disabled, name)
 			}
 		}
@@ -276,6 +313,27 @@ func (c *Config) Account(name string) (acc config.Account, ok bool) {
 	return
 }
 
+// TLSClientAuth returns the account and its configured TLS client certificate
+// mapping matching the public key fingerprint, or if subject is non-empty, the
+// certificate subject. Subject must only be set for certificates verified against
+// the client auth CAs of the listener.
+func (c *Config) TLSClientAuth(fingerprint, subject string) (accName string, ta config.TLSClientAuth, ok bool) {
+	c.withDynamicLock(func() {
+		// Fingerprints take precedence over subjects.
+		for _, bySubject := range []bool{false, true} {
+			for name, acc := range c.Dynamic.Accounts {
+				for _, xta := range acc.TLSClientAuth {
+					if !bySubject && xta.Fingerprint != "" && xta.Fingerprint == fingerprint || bySubject && xta.Subject != "" && xta.Subject == subject {
+						accName, ta, ok = name, xta, true
+						return
+					}
+				}
+			}
+		}
+	})
+	return
+}
+
 func (c *Config) AccountDestination(addr string) (accDest AccountDestination, alias *config.Alias, ok bool) {
 	c.withDynamicLock(func() {
 		accDest, ok = c.AccountDestinationsLocked[addr]
@@ -354,6 +412,15 @@ func (c *Config) allowACMEHosts(log mlog.Log, checkACMEHosts bool) {
 				}
 			}
 
+			if l.WKDHTTPS.Enabled && dom.WKD != nil && !l.WKDHTTPS.NonTLS {
+				d, err := dns.ParseDomain("openpgpkey." + dom.Domain.ASCII)
+				if err != nil {
+					log.Errorx("parsing openpgpkey domain", err, slog.Any("domain", dom.Domain))
+				} else {
+					hostnames[d] = struct{}{}
+				}
+			}
+
 			if dom.ClientSettingsDomain != "" {
 				hostnames[dom.ClientSettingsDNSDomain] = struct{}{}
 			}
@@ -385,7 +452,9 @@ func (c *Config) allowACMEHosts(log mlog.Log, checkACMEHosts bool) {
 // WriteDynamicLocked prepares an updated internal state for the new dynamic
 // config, then writes it to disk and activates it.
 //
-// Returns ErrConfig if the configuration is not valid.
+// Returns ErrConfig if the configuration is not valid. For a context from
+// WithDryRun, the changes are described in its ConfigPreview and ErrDryRun is
+// returned.
 //
 // Must be called with config lock held.
 func WriteDynamicLocked(ctx context.Context, log mlog.Log, c config.Dynamic) error {
@@ -398,6 +467,13 @@ func WriteDynamicLocked(ctx context.Context, log mlog.Log, c config.Dynamic) err
 		return fmt.Errorf("%w: %s", ErrConfig, strings.Join(errstrs, "; "))
 	}
 
+	if preview, ok := ctx.Value(dryRunCtxKey{}).(*ConfigPreview); ok {
+		if err := previewLocked(preview, c, accDests, aliases); err != nil {
+			return err
+		}
+		return ErrDryRun
+	}
+
 	var b bytes.Buffer
 	err := sconf.Write(&b, c)
 	if err != nil {
@@ -541,6 +617,24 @@ func ParseConfig(ctx context.Context, log mlog.Log, p string, checkOnly, doLoadT
 	return c, errs
 }
 
+// CheckConfig checks a static and dynamic configuration constructed in Go, e.g.
+// by provisioning tools, without first writing them to mox.conf and
+// domains.conf. Dir is the configuration directory that relative paths in the
+// configuration, such as for TLS and DKIM private keys, are resolved against. Key
+// and certificate files are read. Derived fields are set in the maps of the
+// configurations, which are otherwise left unchanged.
+func CheckConfig(ctx context.Context, log mlog.Log, dir string, static config.Static, dynamic config.Dynamic) (errs []error) {
+	c := &Config{Static: static}
+	if c.Static.DataDir == "" {
+		c.Static.DataDir = "."
+	}
+	if xerrs := PrepareStaticConfig(ctx, log, filepath.Join(dir, "mox.conf"), c, true, true); len(xerrs) > 0 {
+		return xerrs
+	}
+	_, _, errs = prepareDynamicConfig(ctx, log, filepath.Join(dir, "domains.conf"), c.Static, &dynamic)
+	return errs
+}
+
 // PrepareStaticConfig parses the static config file and prepares data structures
 // for starting mox. If checkOnly is set no substantial changes are made, like
 // creating an ACME registration.
@@ -818,6 +912,45 @@ func PrepareStaticConfig(ctx context.Context, log mlog.Log, configFile string, c
 					continue
 				}
 			}
+			for _, privKeyFile := range l.TLS.HostPrivateKeyFilesNext {
+				keyPath := configDirPath(configFile, privKeyFile)
+				privKey, err := loadPrivateKeyFile(keyPath)
+				if err != nil {
+					addListenerErrorf("parsing next host private key for DANE: %v", err)
+					continue
+				}
+				switch k := privKey.(type) {
+				case *rsa.PrivateKey:
+					if k.N.BitLen() != 2048 {
+						addListenerErrorf("next host private key %s for DANE: need rsa key with 2048 bits, not %d", keyPath, k.N.BitLen())
+						continue
+					}
+				case *ecdsa.PrivateKey:
+					if k.Curve != elliptic.P256() {
+						addListenerErrorf("next host private key %s for DANE: unrecognized ecdsa curve, need P-256", keyPath)
+						continue
+					}
+				default:
+					addListenerErrorf("next host private key %s for DANE: unrecognized key type %T", keyPath, privKey)
+					continue
+				}
+				l.TLS.HostPrivateKeysNext = append(l.TLS.HostPrivateKeysNext, privKey)
+			}
+			l.TLS.ClientAuthCAs = nil
+			for _, caFile := range l.TLS.ClientAuthCAFiles {
+				caPath := configDirPath(configFile, caFile)
+				buf, err := os.ReadFile(caPath)
+				if err != nil {
+					addListenerErrorf("reading client auth ca file: %v", err)
+					continue
+				}
+				if l.TLS.ClientAuthCAs == nil {
+					l.TLS.ClientAuthCAs = x509.NewCertPool()
+				}
+				if !l.TLS.ClientAuthCAs.AppendCertsFromPEM(buf) {
+					addListenerErrorf("no certificates in client auth ca file %s", caPath)
+				}
+			}
 			if l.TLS.ACME != "" && (len(l.TLS.HostPrivateRSA2048Keys) == 0) != (len(l.TLS.HostPrivateECDSAP256Keys) == 0) {
 				log.Warn("uncommon configuration with either only an RSA 2048 or ECDSA P256 host private key for DANE/ACME certificates; this ACME implementation can retrieve certificates for both type of keys, it is recommended to set either both or none; continuing")
 			}
@@ -854,6 +987,7 @@ func PrepareStaticConfig(ctx context.Context, log mlog.Log, configFile string, c
 				}
 			}
 			needtls("IMAPS", l.IMAPS.Enabled)
+			needtls("ManageSieve", l.ManageSieve.Enabled && !l.ManageSieve.NoRequireSTARTTLS)
 			needtls("SMTP", l.SMTP.Enabled && !l.SMTP.NoSTARTTLS)
 			needtls("Submissions", l.Submissions.Enabled)
 			needtls("Submission", l.Submission.Enabled && !l.Submission.NoRequireSTARTTLS)
@@ -861,11 +995,19 @@ func PrepareStaticConfig(ctx context.Context, log mlog.Log, configFile string, c
 			needtls("AdminHTTPS", l.AdminHTTPS.Enabled)
 			needtls("AutoconfigHTTPS", l.AutoconfigHTTPS.Enabled && !l.AutoconfigHTTPS.NonTLS)
 			needtls("MTASTSHTTPS", l.MTASTSHTTPS.Enabled && !l.MTASTSHTTPS.NonTLS)
+			needtls("WKDHTTPS", l.WKDHTTPS.Enabled && !l.WKDHTTPS.NonTLS)
 			needtls("WebserverHTTPS", l.WebserverHTTPS.Enabled)
 			if len(needsTLS) > 0 {
 				addListenerErrorf("no tls config specified, but requires tls for %s", strings.Join(needsTLS, ", "))
 			}
 		}
+		il := l.IMAPLimits
+		if il.MaxLineLength != 0 && il.MaxLineLength < 1024 {
+			addListenerErrorf("imap limit MaxLineLength must be at least 1024")
+		}
+		if il.MaxLiteralSize < 0 || il.MaxCommandLiteralSize < 0 || il.MaxCommandLiterals < 0 || il.MaxAppendSize < 0 || il.IdleTimeout < 0 || il.MaxLifetime < 0 || il.MaxConnections < 0 || il.MaxConnectionsPerIP < 0 || il.MaxConnectionsPerAccount < 0 {
+			addListenerErrorf("imap limits cannot be negative")
+		}
 		if l.AutoconfigHTTPS.Enabled && l.MTASTSHTTPS.Enabled && l.AutoconfigHTTPS.Port == l.MTASTSHTTPS.Port && l.AutoconfigHTTPS.NonTLS != l.MTASTSHTTPS.NonTLS {
 			addListenerErrorf("autoconfig and mta-sts enabled on same port but with both http and https")
 		}
@@ -892,6 +1034,32 @@ func PrepareStaticConfig(ctx context.Context, log mlog.Log, configFile string, c
 				}
 			}
 		}
+		for _, r := range l.SMTP.FingerprintRules {
+			if r.TLS == "" && r.SMTP == "" {
+				addListenerErrorf("fingerprint rule must have TLS and/or SMTP fingerprint")
+			}
+			if r.Action != "reject" && r.Action != "slow" {
+				addListenerErrorf("fingerprint rule has unknown action %q, must be reject or slow", r.Action)
+			}
+		}
+		for _, f := range l.SMTP.ContentFilters {
+			if f.Name == "" {
+				addListenerErrorf("content filter must have a name")
+			}
+			if (len(f.Command) == 0) == (f.URL == "") {
+				addListenerErrorf("content filter %q must have exactly one of command or url", f.Name)
+			} else if f.URL != "" {
+				if u, err := url.Parse(f.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+					addListenerErrorf("content filter %q has invalid url %q, must be http or https", f.Name, f.URL)
+				}
+			}
+			if f.Timeout < 0 || f.MaxSize < 0 {
+				addListenerErrorf("content filter %q has negative timeout or max size", f.Name)
+			}
+			if f.OnError != "" && f.OnError != "tempfail" && f.OnError != "accept" {
+				addListenerErrorf("content filter %q has unknown onerror %q, must be tempfail or accept", f.Name, f.OnError)
+			}
+		}
 		for _, s := range l.SMTP.DNSBLs {
 			d, err := dns.ParseDomain(s)
 			if err != nil {
@@ -900,6 +1068,59 @@ func PrepareStaticConfig(ctx context.Context, log mlog.Log, configFile string, c
 			}
 			l.SMTP.DNSBLZones = append(l.SMTP.DNSBLZones, d)
 		}
+		if sa := l.SubmissionAccess; sa != nil {
+			if !l.Submission.Enabled && !l.Submissions.Enabled {
+				addListenerErrorf("submission access configured without submission enabled")
+			}
+			sa.ParsedNetworks = nil
+			for _, s := range sa.Networks {
+				if ipnet, err := parseIPNetwork(s); err != nil {
+					addListenerErrorf("parsing submission access network: %v", err)
+				} else {
+					sa.ParsedNetworks = append(sa.ParsedNetworks, ipnet)
+				}
+			}
+			if sa.RequireClientCertAndPassword && l.TLS == nil {
+				addListenerErrorf("submission access requiring client certificate needs a TLS config")
+			}
+		}
+		if pp := l.ProxyProtocol; pp != nil {
+			if len(pp.Networks) == 0 {
+				addListenerErrorf("proxy protocol requires networks of load balancers")
+			}
+			pp.ParsedNetworks = nil
+			for _, s := range pp.Networks {
+				if ipnet, err := parseIPNetwork(s); err != nil {
+					addListenerErrorf("parsing proxy protocol network: %v", err)
+				} else {
+					pp.ParsedNetworks = append(pp.ParsedNetworks, ipnet)
+				}
+			}
+		}
+		if l.IMAPReadOnly && !l.IMAP.Enabled && !l.IMAPS.Enabled {
+			addListenerErrorf("IMAP read-only mode configured without IMAP or IMAPS enabled")
+		}
+		if ve := l.VRFYEXPN; ve != nil {
+			switch ve.Mode {
+			case "disabled", "252", "accurate":
+			default:
+				addListenerErrorf("unknown VRFYEXPN mode %q, must be disabled, 252 or accurate", ve.Mode)
+			}
+			if len(ve.Networks) > 0 && ve.Mode != "accurate" {
+				addListenerErrorf("VRFYEXPN networks only apply to mode accurate")
+			}
+			ve.ParsedNetworks = nil
+			for _, s := range ve.Networks {
+				if ipnet, err := parseIPNetwork(s); err != nil {
+					addListenerErrorf("parsing VRFYEXPN network: %v", err)
+				} else {
+					ve.ParsedNetworks = append(ve.ParsedNetworks, ipnet)
+				}
+			}
+			if !l.SMTP.Enabled && !l.Submission.Enabled && !l.Submissions.Enabled {
+				addListenerErrorf("VRFYEXPN configured without smtp or submission enabled")
+			}
+		}
 		if l.IPsNATed && len(l.NATIPs) > 0 {
 			addListenerErrorf("both IPsNATed and NATIPs configued (remove deprecated IPsNATed)")
 		}
@@ -922,6 +1143,9 @@ func PrepareStaticConfig(ctx context.Context, log mlog.Log, configFile string, c
 		checkPath("AdminHTTPS", l.AdminHTTPS.Enabled, l.AdminHTTPS.Path)
 		c.Listeners[name] = l
 	}
+	for _, err := range checkListenerPorts(c.Listeners) {
+		addErrorf("%w", err)
+	}
 	if haveUnspecifiedSMTPListener {
 		c.SpecifiedSMTPListenIPs = nil
 	}
@@ -934,23 +1158,35 @@ func PrepareStaticConfig(ctx context.Context, log mlog.Log, configFile string, c
 	for _, mb := range c.DefaultMailboxes {
 		checkMailboxNormf(mb, "default mailbox")
 	}
-	checkSpecialUseMailbox := func(nameOpt string) {
-		if nameOpt != "" {
-			checkMailboxNormf(nameOpt, "special-use initial mailbox")
-			if strings.EqualFold(nameOpt, "inbox") {
-				addErrorf("initial mailbox cannot be set to Inbox (Inbox is always created)")
+	// Prefix is for error messages about account templates.
+	checkInitialMailboxes := func(prefix string, mailboxes config.InitialMailboxes) {
+		checkSpecialUseMailbox := func(nameOpt string) {
+			if nameOpt != "" {
+				checkMailboxNormf(nameOpt, "%sspecial-use initial mailbox", prefix)
+				if strings.EqualFold(nameOpt, "inbox") {
+					addErrorf("%sinitial mailbox cannot be set to Inbox (Inbox is always created)", prefix)
+				}
+			}
+		}
+		checkSpecialUseMailbox(mailboxes.SpecialUse.Archive)
+		checkSpecialUseMailbox(mailboxes.SpecialUse.Draft)
+		checkSpecialUseMailbox(mailboxes.SpecialUse.Junk)
+		checkSpecialUseMailbox(mailboxes.SpecialUse.Sent)
+		checkSpecialUseMailbox(mailboxes.SpecialUse.Trash)
+		for _, name := range mailboxes.Regular {
+			checkMailboxNormf(name, "%sregular initial mailbox", prefix)
+			if strings.EqualFold(name, "inbox") {
+				addErrorf("%sinitial regular mailbox cannot be set to Inbox (Inbox is always created)", prefix)
 			}
 		}
 	}
-	checkSpecialUseMailbox(c.InitialMailboxes.SpecialUse.Archive)
-	checkSpecialUseMailbox(c.InitialMailboxes.SpecialUse.Draft)
-	checkSpecialUseMailbox(c.InitialMailboxes.SpecialUse.Junk)
-	checkSpecialUseMailbox(c.InitialMailboxes.SpecialUse.Sent)
-	checkSpecialUseMailbox(c.InitialMailboxes.SpecialUse.Trash)
-	for _, name := range c.InitialMailboxes.Regular {
-		checkMailboxNormf(name, "regular initial mailbox")
-		if strings.EqualFold(name, "inbox") {
-			addErrorf("initial regular mailbox cannot be set to Inbox (Inbox is always created)")
+	checkInitialMailboxes("", c.InitialMailboxes)
+
+	for name, t := range c.AccountTemplates {
+		prefix := fmt.Sprintf("account template %s: ", name)
+		checkInitialMailboxes(prefix, t.InitialMailboxes)
+		if t.QuotaMessageSize < 0 || t.MaxOutgoingMessagesPerDay < 0 || t.MaxFirstTimeRecipientsPerDay < 0 {
+			addErrorf("%slimits cannot be negative", prefix)
 		}
 	}
 
@@ -1070,6 +1306,86 @@ func PrepareStaticConfig(ctx context.Context, log mlog.Log, configFile string, c
 		}
 	}
 
+	pp := &c.PasswordPolicy
+	if pp.MinLength == 0 {
+		pp.MinLength = 8
+	} else if pp.MinLength < 8 {
+		addErrorf("password policy minimum length cannot be lower than 8")
+	}
+	if pp.MinEntropy < 0 {
+		addErrorf("password policy minimum entropy cannot be negative")
+	}
+	if pp.BreachedFileK == 0 {
+		pp.BreachedFileK = 7
+	}
+	if pp.BreachedFile != "" {
+		p := configDirPath(configFile, pp.BreachedFile)
+		if buf, err := os.ReadFile(p); err != nil {
+			addErrorf("reading breached password filter file: %v", err)
+		} else if pp.BreachedFileBloom, err = junk.NewBloom(buf, pp.BreachedFileK); err != nil {
+			addErrorf("loading breached password filter file %s: %v", p, err)
+		}
+	}
+
+	if oh := c.OutgoingHold; oh != nil && (oh.MessagesPerHour < 0 || oh.FirstTimeRecipientsPerHour < 0) {
+		addErrorf("outgoing hold limits cannot be negative")
+	}
+	if mc := c.MessageCompression; mc != nil && (mc.MinMessageSize < 0 || mc.MaxMessageSize < 0) {
+		addErrorf("message compression min and max message size cannot be negative")
+	}
+	if c.MessageEncryptionKeyFile != "" {
+		p := configDirPath(configFile, c.MessageEncryptionKeyFile)
+		if buf, err := os.ReadFile(p); err != nil {
+			addErrorf("reading message encryption key file: %v", err)
+		} else if key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(buf))); err != nil {
+			addErrorf("parsing message encryption key file %s: %v", p, err)
+		} else if len(key) != 32 {
+			addErrorf("message encryption key in %s must be 32 bytes, got %d", p, len(key))
+		} else {
+			c.MessageEncryptionKey = key
+		}
+	}
+	if sn := c.SieveNotifyHTTP; sn != nil {
+		if len(sn.Hosts) == 0 {
+			addErrorf("sieve notify http requires at least one host")
+		}
+		for i, h := range sn.Hosts {
+			sn.Hosts[i] = strings.TrimSuffix(strings.ToLower(h), ".")
+			if h == "" {
+				addErrorf("empty host in sieve notify http hosts")
+			}
+		}
+	}
+	if ws := c.WebSessions; ws.IdleTimeout < 0 || ws.MaxLifetime < 0 || ws.MaxPerAccount < 0 {
+		addErrorf("web session limits cannot be negative")
+	}
+	if oc := c.OAuth; oc != nil {
+		checkHTTPS := func(what, s string) {
+			if u, err := url.Parse(s); err != nil {
+				addErrorf("parsing oauth %s: %v", what, err)
+			} else if u.Scheme != "https" || u.Host == "" {
+				addErrorf("oauth %s must be an https url", what)
+			}
+		}
+		checkHTTPS("issuer", oc.Issuer)
+		if oc.JWKSURL != "" {
+			checkHTTPS("jwks url", oc.JWKSURL)
+		}
+		if oc.Audience == "" {
+			addErrorf("oauth audience is required")
+		}
+		if oc.UsernameClaim == "" {
+			oc.UsernameClaim = "email"
+		}
+		oc.Verifier = &oauthbearer.Verifier{
+			Issuer:        oc.Issuer,
+			JWKSURL:       oc.JWKSURL,
+			Audience:      oc.Audience,
+			Scopes:        oc.Scopes,
+			UsernameClaim: oc.UsernameClaim,
+		}
+	}
+
 	// Load CA certificate pool.
 	if c.TLS.CA != nil {
 		if c.TLS.CA.AdditionalToSystem {
@@ -1096,6 +1412,113 @@ func PrepareStaticConfig(ctx context.Context, log mlog.Log, configFile string, c
 	return
 }
 
+// listenerPorts returns the ports a listener serves on, with their protocol, e.g.
+// "smtp", "imaps" or "https". Web services can share a port, but only if they all
+// use either plain HTTP or HTTPS. Other protocols need their own port.
+func listenerPorts(l config.Listener) (ports map[int]string, errs []error) {
+	ports = map[int]string{}
+	add := func(enabled bool, kind string, port int, protocol string) {
+		if !enabled {
+			return
+		}
+		if p, ok := ports[port]; ok && (p != protocol || p != "http" && p != "https") {
+			errs = append(errs, fmt.Errorf("%s on port %d, but port is already used for %s", kind, port, p))
+			return
+		}
+		ports[port] = protocol
+	}
+	add(l.SMTP.Enabled, "SMTP", config.Port(l.SMTP.Port, 25), "smtp")
+	add(l.Submission.Enabled, "Submission", config.Port(l.Submission.Port, 587), "submission")
+	add(l.Submissions.Enabled, "Submissions", config.Port(l.Submissions.Port, 465), "submissions")
+	add(l.IMAP.Enabled, "IMAP", config.Port(l.IMAP.Port, 143), "imap")
+	add(l.IMAPS.Enabled, "IMAPS", config.Port(l.IMAPS.Port, 993), "imaps")
+	add(l.ManageSieve.Enabled, "ManageSieve", config.Port(l.ManageSieve.Port, 4190), "managesieve")
+
+	web := func(enabled bool, kind string, port int, https bool) {
+		protocol := "http"
+		if https {
+			protocol = "https"
+		}
+		add(enabled, kind, port, protocol)
+	}
+	web(l.Submissions.Enabled && l.Submissions.EnabledOnHTTPS, "Submissions on HTTPS", 443, true)
+	web(l.IMAPS.Enabled && l.IMAPS.EnabledOnHTTPS, "IMAPS on HTTPS", 443, true)
+	web(l.AccountHTTP.Enabled, "AccountHTTP", config.Port(l.AccountHTTP.Port, 80), false)
+	web(l.AccountHTTPS.Enabled, "AccountHTTPS", config.Port(l.AccountHTTPS.Port, 443), true)
+	web(l.AdminHTTP.Enabled, "AdminHTTP", config.Port(l.AdminHTTP.Port, 80), false)
+	web(l.AdminHTTPS.Enabled, "AdminHTTPS", config.Port(l.AdminHTTPS.Port, 443), true)
+	web(l.WebmailHTTP.Enabled, "WebmailHTTP", config.Port(l.WebmailHTTP.Port, 80), false)
+	web(l.WebmailHTTPS.Enabled, "WebmailHTTPS", config.Port(l.WebmailHTTPS.Port, 443), true)
+	web(l.WebAPIHTTP.Enabled, "WebAPIHTTP", config.Port(l.WebAPIHTTP.Port, 80), false)
+	web(l.WebAPIHTTPS.Enabled, "WebAPIHTTPS", config.Port(l.WebAPIHTTPS.Port, 443), true)
+	web(l.JMAPHTTP.Enabled, "JMAPHTTP", config.Port(l.JMAPHTTP.Port, 80), false)
+	web(l.JMAPHTTPS.Enabled, "JMAPHTTPS", config.Port(l.JMAPHTTPS.Port, 443), true)
+	web(l.UnsubscribeHTTPS.Enabled, "UnsubscribeHTTPS", config.Port(l.UnsubscribeHTTPS.Port, 443), true)
+	web(l.MetricsHTTP.Enabled, "MetricsHTTP", config.Port(l.MetricsHTTP.Port, 8010), false)
+	web(l.PprofHTTP.Enabled, "PprofHTTP", config.Port(l.PprofHTTP.Port, 8011), false)
+	web(l.AutoconfigHTTPS.Enabled, "AutoconfigHTTPS", config.Port(l.AutoconfigHTTPS.Port, 443), !l.AutoconfigHTTPS.NonTLS)
+	web(l.MTASTSHTTPS.Enabled, "MTASTSHTTPS", config.Port(l.MTASTSHTTPS.Port, 443), !l.MTASTSHTTPS.NonTLS)
+	web(l.WKDHTTPS.Enabled, "WKDHTTPS", config.Port(l.WKDHTTPS.Port, 443), !l.WKDHTTPS.NonTLS)
+	web(l.WebserverHTTP.Enabled, "WebserverHTTP", config.Port(l.WebserverHTTP.Port, 80), false)
+	web(l.WebserverHTTPS.Enabled, "WebserverHTTPS", config.Port(l.WebserverHTTPS.Port, 443), true)
+	return
+}
+
+// checkListenerPorts checks that services within a listener don't conflict on a
+// port, and that listeners don't listen on the same IP and port, which would
+// fail at startup. An unspecified IP, like 0.0.0.0, overlaps with all IPs of the
+// same family.
+func checkListenerPorts(listeners map[string]config.Listener) (errs []error) {
+	type listenerPort struct {
+		name  string
+		ip    net.IP
+		ports map[int]string
+	}
+	var l []listenerPort
+	var names []string
+	for name := range listeners {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		lis := listeners[name]
+		ports, xerrs := listenerPorts(lis)
+		for _, err := range xerrs {
+			errs = append(errs, fmt.Errorf("listener %s: %w", name, err))
+		}
+		for _, ipstr := range lis.IPs {
+			if ip := net.ParseIP(ipstr); ip != nil {
+				l = append(l, listenerPort{name, ip, ports})
+			}
+		}
+	}
+
+	overlap := func(a, b net.IP) bool {
+		if (a.To4() == nil) != (b.To4() == nil) {
+			return false
+		}
+		return a.Equal(b) || a.IsUnspecified() || b.IsUnspecified()
+	}
+	for i, a := range l {
+		for _, b := range l[i+1:] {
+			if a.name == b.name || !overlap(a.ip, b.ip) {
+				continue
+			}
+			var ports []int
+			for port := range a.ports {
+				if _, ok := b.ports[port]; ok {
+					ports = append(ports, port)
+				}
+			}
+			sort.Ints(ports)
+			for _, port := range ports {
+				errs = append(errs, fmt.Errorf("listeners %s and %s both use port %d on overlapping ips %s and %s", a.name, b.name, port, a.ip, b.ip))
+			}
+		}
+	}
+	return errs
+}
+
 // PrepareDynamicConfig parses the dynamic config file given a static file.
 func ParseDynamicConfig(ctx context.Context, log mlog.Log, dynamicPath string, static config.Static) (c config.Dynamic, mtime time.Time, accDests map[string]AccountDestination, aliases map[string]config.Alias, errs []error) {
 	addErrorf := func(format string, args ...any) {
@@ -1121,6 +1544,41 @@ func ParseDynamicConfig(ctx context.Context, log mlog.Log, dynamicPath string, s
 	return c, fi.ModTime(), accDests, aliases, errs
 }
 
+// parseIPNetwork parses an IP network in CIDR notation, or a single IP address.
+func parseIPNetwork(s string) (net.IPNet, error) {
+	if !strings.Contains(s, "/") {
+		ip := net.ParseIP(s)
+		if ip == nil {
+			return net.IPNet{}, fmt.Errorf("invalid ip %q", s)
+		} else if ip.To4() != nil {
+			return net.IPNet{IP: ip.To4(), Mask: net.CIDRMask(32, 32)}, nil
+		}
+		return net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}, nil
+	}
+	_, ipnet, err := net.ParseCIDR(s)
+	if err != nil {
+		return net.IPNet{}, fmt.Errorf("parsing network %q: %v", s, err)
+	}
+	return *ipnet, nil
+}
+
+// Header fields that cannot be added with InboundHeaders, because messages may
+// have at most one, or because they are part of the MIME structure.
+var inboundHeadersReserved = map[string]bool{
+	"date":         true,
+	"from":         true,
+	"sender":       true,
+	"reply-to":     true,
+	"to":           true,
+	"cc":           true,
+	"bcc":          true,
+	"message-id":   true,
+	"in-reply-to":  true,
+	"references":   true,
+	"subject":      true,
+	"mime-version": true,
+}
+
 func prepareDynamicConfig(ctx context.Context, log mlog.Log, dynamicPath string, static config.Static, c *config.Dynamic) (accDests map[string]AccountDestination, aliases map[string]config.Alias, errs []error) {
 	addErrorf := func(format string, args ...any) {
 		errs = append(errs, fmt.Errorf(format, args...))
@@ -1157,14 +1615,17 @@ func prepareDynamicConfig(ctx context.Context, log mlog.Log, dynamicPath string,
 			Mailbox:        static.HostTLSRPT.Mailbox,
 			HostTLSReports: true,
 		}
-		accDests[addrFull] = AccountDestination{false, static.HostTLSRPT.ParsedLocalpart, static.HostTLSRPT.Account, dest}
+		accDests[addrFull] = AccountDestination{false, static.HostTLSRPT.ParsedLocalpart, static.HostTLSRPT.Account, dest, false}
 	}
 
-	var haveSTSListener, haveWebserverListener bool
+	var haveSTSListener, haveWKDListener, haveWebserverListener bool
 	for _, l := range static.Listeners {
 		if l.MTASTSHTTPS.Enabled {
 			haveSTSListener = true
 		}
+		if l.WKDHTTPS.Enabled {
+			haveWKDListener = true
+		}
 		if l.WebserverHTTP.Enabled || l.WebserverHTTPS.Enabled {
 			haveWebserverListener = true
 		}
@@ -1200,6 +1661,22 @@ func prepareDynamicConfig(ctx context.Context, log mlog.Log, dynamicPath string,
 			if !ok {
 				addErrorf("%s: route references undefined transport %s", descr, routes[i].Transport)
 			}
+			routes[i].ResolvedFailover = nil
+			for _, name := range routes[i].Failover {
+				t, ok := static.Transports[name]
+				if !ok {
+					addErrorf("%s: route references undefined failover transport %s", descr, name)
+				}
+				routes[i].ResolvedFailover = append(routes[i].ResolvedFailover, t)
+			}
+			for _, s := range routes[i].FailoverErrors {
+				if !slices.Contains(config.RouteFailoverErrors, s) {
+					addErrorf("%s: unknown failover error class %q, must be one of %s", descr, s, strings.Join(config.RouteFailoverErrors, ", "))
+				}
+			}
+			if len(routes[i].FailoverErrors) > 0 && len(routes[i].Failover) == 0 {
+				addErrorf("%s: route has FailoverErrors but no Failover transports", descr)
+			}
 		}
 	}
 
@@ -1230,9 +1707,11 @@ func prepareDynamicConfig(ctx context.Context, log mlog.Log, dynamicPath string,
 			c.ClientSettingDomains[csd] = struct{}{}
 		}
 
-		for _, sign := range domain.DKIM.Sign {
+		for i, sign := range domain.DKIM.Sign {
 			if _, ok := domain.DKIM.Selectors[sign]; !ok {
 				addDomainErrorf("unknown selector %s for signing", sign)
+			} else if slices.Contains(domain.DKIM.Sign[:i], sign) {
+				addDomainErrorf("duplicate selector %s for signing", sign)
 			}
 		}
 		for name, sel := range domain.DKIM.Selectors {
@@ -1341,6 +1820,118 @@ func prepareDynamicConfig(ctx context.Context, log mlog.Log, dynamicPath string,
 			default:
 				addDomainErrorf("invalid mtasts mode %q", sts.Mode)
 			}
+			if sts.MaxAgeRampDays < 0 {
+				addDomainErrorf("MTA-STS MaxAgeRampDays must be >= 0")
+			}
+		}
+
+		if domain.WKD != nil && !haveWKDListener {
+			addDomainErrorf("WKD enabled, but there is no listener for WKD")
+		}
+
+		if wk := domain.WellKnown; wk != nil {
+			if st := wk.SecurityTXT; st != nil {
+				if len(st.Contact) == 0 {
+					addDomainErrorf("security.txt requires at least one Contact")
+				}
+				expires, err := time.Parse(time.RFC3339, st.Expires)
+				if err != nil {
+					addDomainErrorf("parsing security.txt Expires %q: %v", st.Expires, err)
+				}
+				st.ExpiresParsed = expires
+				for _, l := range [][]string{st.Contact, st.Encryption, st.Acknowledgments, st.Canonical, st.Policy, st.Hiring} {
+					for _, s := range l {
+						if u, err := url.Parse(s); err != nil || u.Scheme == "" {
+							addDomainErrorf("invalid security.txt URI %q, must be absolute", s)
+						}
+					}
+				}
+				for _, s := range st.PreferredLanguages {
+					if s == "" || strings.ContainsAny(s, ", \t\r\n") {
+						addDomainErrorf("invalid security.txt preferred language %q", s)
+					}
+				}
+			}
+			if wk.ChangePasswordURL != "" {
+				if u, err := url.Parse(wk.ChangePasswordURL); err != nil || u.Scheme != "https" && u.Scheme != "http" {
+					addDomainErrorf("invalid ChangePasswordURL %q, must be an http or https URL", wk.ChangePasswordURL)
+				}
+			}
+		}
+
+		if domain.SPF != nil {
+			spf := domain.SPF
+			spf.ParsedIncludes = nil
+			spf.ParsedIPs = nil
+			for _, s := range spf.Includes {
+				incdom, err := dns.ParseDomain(s)
+				if err != nil {
+					addDomainErrorf("parsing SPF include domain %q: %v", s, err)
+					continue
+				}
+				spf.ParsedIncludes = append(spf.ParsedIncludes, incdom)
+			}
+			for _, s := range spf.IPs {
+				if !strings.Contains(s, "/") {
+					if ip := net.ParseIP(s); ip == nil {
+						addDomainErrorf("parsing SPF IP %q", s)
+					} else if ip.To4() != nil {
+						spf.ParsedIPs = append(spf.ParsedIPs, net.IPNet{IP: ip.To4(), Mask: net.CIDRMask(32, 32)})
+					} else {
+						spf.ParsedIPs = append(spf.ParsedIPs, net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)})
+					}
+					continue
+				}
+				_, ipnet, err := net.ParseCIDR(s)
+				if err != nil {
+					addDomainErrorf("parsing SPF IP network %q: %v", s, err)
+					continue
+				}
+				spf.ParsedIPs = append(spf.ParsedIPs, *ipnet)
+			}
+			switch spf.All {
+			case "", "~", "-", "?":
+			default:
+				addDomainErrorf("invalid SPF qualifier %q for all mechanism, must be empty, \"~\", \"-\" or \"?\"", spf.All)
+			}
+		}
+
+		if domain.InboundHeaders != nil {
+			ih := domain.InboundHeaders
+			if strings.ContainsAny(ih.SubjectPrefix, "\r\n") {
+				addDomainErrorf("inbound headers subject prefix cannot contain newlines")
+			}
+			for k, v := range ih.Headers {
+				if k == "" || strings.IndexFunc(k, func(c rune) bool { return c <= ' ' || c >= 0x7f || c == ':' }) >= 0 {
+					addDomainErrorf("invalid inbound header field name %q", k)
+				}
+				if inboundHeadersReserved[strings.ToLower(k)] || strings.HasPrefix(strings.ToLower(k), "content-") {
+					addDomainErrorf("inbound header field %q not allowed, it can only occur once or is part of the message structure", k)
+				}
+				if strings.ContainsAny(v, "\r\n") {
+					addDomainErrorf("inbound header field %q cannot contain newlines", k)
+				}
+			}
+			ih.ParsedInternalDomains = nil
+			for _, s := range ih.InternalDomains {
+				id, err := dns.ParseDomain(s)
+				if err != nil {
+					addDomainErrorf("parsing inbound headers internal domain %q: %v", s, err)
+					continue
+				}
+				ih.ParsedInternalDomains = append(ih.ParsedInternalDomains, id)
+			}
+		}
+
+		switch domain.LookalikeSenders {
+		case "", "junk", "reject":
+		default:
+			addDomainErrorf("invalid LookalikeSenders %q, must be empty, \"junk\" or \"reject\"", domain.LookalikeSenders)
+		}
+		switch domain.SpoofingSurges {
+		case "", "junk", "ignore":
+		default:
+			addDomainErrorf("invalid SpoofingSurges %q, must be empty, \"junk\" or \"ignore\"", domain.SpoofingSurges)
 		}
 
 		checkRoutes("routes for domain", domain.Routes)
@@ -1351,6 +1942,10 @@ func prepareDynamicConfig(ctx context.Context, log mlog.Log, dynamicPath string,
 	// To determine ReportsOnly.
 	domainHasAddress := map[string]bool{}
 
+	// Fingerprints and subjects of tls client auth, to account name, to prevent
+	// duplicates.
+	tlsClientAuths := map[string]string{}
+
 	// Validate email addresses.
 	for accName, acc := range c.Accounts {
 		addAccountErrorf := func(format string, args ...any) {
@@ -1368,13 +1963,15 @@ func prepareDynamicConfig(ctx context.Context, log mlog.Log, dynamicPath string,
 		}
 		checkMailboxNormf(acc.RejectsMailbox, "rejects mailbox", addErrorf)
 
-		if len(acc.LoginDisabled) > 256 {
-			addAccountErrorf("message for disabled login must be <256 characters")
-		}
-		for _, c := range acc.LoginDisabled {
-			// For IMAP and SMTP. IMAP only allows UTF8 after "ENABLE IMAPrev2".
-			if c < ' ' || c >= 0x7f {
-				addAccountErrorf("message cannot contain control characters including newlines, and must be ascii-only")
+		for _, msg := range []string{acc.LoginDisabled, acc.Suspended} {
+			if len(msg) > 256 {
+				addAccountErrorf("message for disabled login or suspended account must be <256 characters")
+			}
+			for _, c := range msg {
+				// For IMAP and SMTP. IMAP only allows UTF8 after "ENABLE IMAPrev2".
+				if c < ' ' || c >= 0x7f {
+					addAccountErrorf("message cannot contain control characters including newlines, and must be ascii-only")
+				}
 			}
 		}
 
@@ -1416,6 +2013,78 @@ func prepareDynamicConfig(ctx context.Context, log mlog.Log, dynamicPath string,
 			}
 		}
 
+		if acc.MaxAppendSize < 0 {
+			addAccountErrorf("max append size must be >= 0")
+		}
+		if sc := acc.SubmissionChecks; sc != nil && (sc.MaxRecipients < 0 || sc.ConfirmRecipients < 0) {
+			addAccountErrorf("submission checks MaxRecipients and ConfirmRecipients must be >= 0")
+		}
+		if dw := acc.DuplicateWindow; dw != nil && dw.Period < 0 {
+			addAccountErrorf("duplicate window period must be >= 0")
+		}
+		if aa := acc.AutoArchive; aa != nil {
+			if aa.Age <= 0 {
+				addAccountErrorf("auto archive age must be > 0")
+			}
+			for _, name := range append(slices.Clone(aa.Mailboxes), aa.Mailbox) {
+				checkMailboxNormf(name, "auto archive mailbox", addAccountErrorf)
+			}
+			if strings.EqualFold(aa.Mailbox, "inbox") {
+				addAccountErrorf("auto archive mailbox cannot be inbox")
+			}
+		}
+		if at := acc.ArchiveTier; at != nil && (at.Age <= 0 || at.MaxMessageSize < 0) {
+			addAccountErrorf("archive tier age must be > 0 and max message size >= 0")
+		}
+		if mc := acc.MessageCompression; mc != nil && (mc.MinMessageSize < 0 || mc.MaxMessageSize < 0) {
+			addAccountErrorf("message compression min and max message size cannot be negative")
+		}
+		if me := acc.MessageEncryption; me != nil {
+			switch me.KeyWrap {
+			case "", "masterkey":
+				if static.MessageEncryptionKeyFile == "" {
+					addAccountErrorf("message encryption with master key requires MessageEncryptionKeyFile in static config")
+				}
+			case "password":
+			default:
+				addAccountErrorf("message encryption key wrap must be empty, \"masterkey\" or \"password\", not %q", me.KeyWrap)
+			}
+		}
+		acc.ParsedLoginNetworks = nil
+		for _, s := range acc.LoginNetworks {
+			if ipnet, err := parseIPNetwork(s); err != nil {
+				addAccountErrorf("login networks: %v", err)
+			} else {
+				acc.ParsedLoginNetworks = append(acc.ParsedLoginNetworks, ipnet)
+			}
+		}
+
+		for i, ta := range acc.TLSClientAuth {
+			if (ta.Fingerprint == "") == (ta.Subject == "") {
+				addAccountErrorf("tls client auth %d: exactly one of fingerprint and subject must be set", i)
+			}
+			if ta.Fingerprint != "" {
+				if buf, err := base64.RawURLEncoding.DecodeString(ta.Fingerprint); err != nil || len(buf) != sha256.Size {
+					addAccountErrorf("tls client auth %d: fingerprint must be raw-url-base64-encoded sha-256 hash", i)
+				}
+			}
+			key := "fingerprint " + ta.Fingerprint
+			if ta.Subject != "" {
+				key = "subject " + ta.Subject
+			}
+			if prev, ok := tlsClientAuths[key]; ok {
+				addAccountErrorf("tls client auth %d: %s already configured for account %q", i, key, prev)
+			} else {
+				tlsClientAuths[key] = accName
+			}
+			// Whether the address belongs to the account is checked during authentication.
+			if a, err := smtp.ParseAddress(ta.LoginAddress); err != nil {
+				addAccountErrorf("tls client auth %d: invalid login address %q: %v", i, ta.LoginAddress, err)
+			} else if _, ok := c.Domains[a.Domain.Name()]; !ok {
+				addAccountErrorf("tls client auth %d: unknown domain in login address %q", i, ta.LoginAddress)
+			}
+		}
+
 		acc.ParsedFromIDLoginAddresses = make([]smtp.Address, len(acc.FromIDLoginAddresses))
 		for i, s := range acc.FromIDLoginAddresses {
 			a, err := smtp.ParseAddress(s)
@@ -1474,6 +2143,10 @@ func prepareDynamicConfig(ctx context.Context, log mlog.Log, dynamicPath string,
 
 			checkMailboxNormf(dest.Mailbox, "destination mailbox", addDestErrorf)
 
+			if dw := dest.DuplicateWindow; dw != nil && dw.Period < 0 {
+				addDestErrorf("duplicate window period must be >= 0")
+			}
+
 			if dest.SMTPError != "" {
 				if len(dest.SMTPError) > 256 {
 					addDestErrorf("smtp error must be smaller than 256 bytes")
@@ -1524,12 +2197,41 @@ func prepareDynamicConfig(ctx context.Context, log mlog.Log, dynamicPath string,
 				}
 			}
 
+			if fw := dest.Forward; fw != nil {
+				if len(fw.To) == 0 {
+					addDestErrorf("forward must have at least one address")
+				}
+				for _, s := range fw.To {
+					if _, err := smtp.ParseAddress(s); err != nil {
+						addDestErrorf("invalid forward address %q: %v", s, err)
+					}
+				}
+				if dest.SMTPError != "" {
+					addDestErrorf("cannot have both SMTPError and Forward")
+				}
+			}
+
 			for i, rs := range dest.Rulesets {
 				addRulesetErrorf := func(format string, args ...any) {
 					addDestErrorf("ruleset %d: %s", i+1, fmt.Sprintf(format, args...))
 				}
 
 				checkMailboxNormf(rs.Mailbox, "ruleset mailbox", addRulesetErrorf)
+				if rs.Discard && rs.Mailbox != "" {
+					addRulesetErrorf("ruleset cannot have both Discard and Mailbox")
+				} else if !rs.Discard && rs.Mailbox == "" {
+					addRulesetErrorf("ruleset must have Mailbox, unless Discard is set")
+				}
+				for _, kw := range rs.Keywords {
+					if kw == "" || strings.ToLower(kw) != kw || strings.ContainsFunc(kw, func(c rune) bool { return c <= ' ' || c > 0x7e || strings.ContainsRune(`(){%*"\]`, c) }) {
+						addRulesetErrorf("invalid keyword %q, must be lower-case ascii without spaces and without any of these characters: (){%%*\"\\]", kw)
+					}
+				}
+				for _, s := range rs.ForwardTo {
+					if _, err := smtp.ParseAddress(s); err != nil {
+						addRulesetErrorf("invalid ForwardTo address %q: %v", s, err)
+					}
+				}
 
 				n := 0
 
@@ -1549,6 +2251,14 @@ func prepareDynamicConfig(ctx context.Context, log mlog.Log, dynamicPath string,
 					}
 					c.Accounts[accName].Destinations[addrName].Rulesets[i].MsgFromRegexpCompiled = r
 				}
+				if rs.MsgToRegexp != "" {
+					n++
+					r, err := regexp.Compile(rs.MsgToRegexp)
+					if err != nil {
+						addRulesetErrorf("invalid MsgTo regular expression: %v", err)
+					}
+					c.Accounts[accName].Destinations[addrName].Rulesets[i].MsgToRegexpCompiled = r
+				}
 				if rs.VerifiedDomain != "" {
 					n++
 					d, err := dns.ParseDomain(rs.VerifiedDomain)
@@ -1605,6 +2315,29 @@ func prepareDynamicConfig(ctx context.Context, log mlog.Log, dynamicPath string,
 				}
 			}
 
+			// Wildcard destination for all subdomains of a domain.
+			if lp, d, ok, err := ParseWildcardAddress(addrName); ok {
+				if err != nil {
+					addDestErrorf("parsing wildcard address: %v", err)
+					continue
+				}
+				dc, ok := c.Domains[d.Name()]
+				if !ok {
+					addDestErrorf("unknown domain for wildcard address")
+					continue
+				}
+				if dc.LocalpartCatchallSeparator != "" && strings.Contains(string(lp), dc.LocalpartCatchallSeparator) {
+					addDestErrorf("localpart of wildcard address includes domain catchall separator %s", dc.LocalpartCatchallSeparator)
+				}
+				domainHasAddress[d.Name()] = true
+				addrFull := WildcardAddress(CanonicalLocalpart(lp, dc), d)
+				if _, ok := accDests[addrFull]; ok {
+					addDestErrorf("duplicate canonicalized wildcard destination address %s", addrFull)
+				}
+				accDests[addrFull] = AccountDestination{lp == "", lp, accName, dest, true}
+				continue
+			}
+
 			// Catchall destination for domain.
 			if strings.HasPrefix(addrName, "@") {
 				d, err := dns.ParseDomain(addrName[1:])
@@ -1620,7 +2353,7 @@ func prepareDynamicConfig(ctx context.Context, log mlog.Log, dynamicPath string,
 				if _, ok := accDests[addrFull]; ok {
 					addDestErrorf("duplicate canonicalized catchall destination address %s", addrFull)
 				}
-				accDests[addrFull] = AccountDestination{true, "", accName, dest}
+				accDests[addrFull] = AccountDestination{true, "", accName, dest, false}
 				continue
 			}
 
@@ -1661,7 +2394,7 @@ func prepareDynamicConfig(ctx context.Context, log mlog.Log, dynamicPath string,
 			if _, ok := accDests[addrFull]; ok {
 				addDestErrorf("duplicate canonicalized destination address %s", addrFull)
 			}
-			accDests[addrFull] = AccountDestination{false, origLP, accName, dest}
+			accDests[addrFull] = AccountDestination{false, origLP, accName, dest, false}
 		}
 
 		for lp, addr := range replaceLocalparts {
@@ -1728,6 +2461,11 @@ func prepareDynamicConfig(ctx context.Context, log mlog.Log, dynamicPath string,
 		if addrdom == domain.Domain {
 			domainHasAddress[addrdom.Name()] = true
 		}
+		switch dmarc.Policy {
+		case "", "none", "quarantine", "reject", "auto":
+		default:
+			addDomainErrorf("invalid DMARC policy %q, must be empty, none, quarantine, reject or auto", dmarc.Policy)
+		}
 
 		domain.DMARC.ParsedLocalpart = lp
 		domain.DMARC.DNSDomain = addrdom
@@ -1738,7 +2476,7 @@ func prepareDynamicConfig(ctx context.Context, log mlog.Log, dynamicPath string,
 			DMARCReports: true,
 		}
 		checkMailboxNormf(dmarc.Mailbox, "DMARC mailbox for account", addDomainErrorf)
-		accDests[addrFull] = AccountDestination{false, lp, dmarc.Account, dest}
+		accDests[addrFull] = AccountDestination{false, lp, dmarc.Account, dest, false}
 	}
 
 	// Set TLSRPT destinations.
@@ -1785,7 +2523,19 @@ func prepareDynamicConfig(ctx context.Context, log mlog.Log, dynamicPath string,
 			DomainTLSReports: true,
 		}
 		checkMailboxNormf(tlsrpt.Mailbox, "TLSRPT mailbox", addDomainErrorf)
-		accDests[addrFull] = AccountDestination{false, lp, tlsrpt.Account, dest}
+		accDests[addrFull] = AccountDestination{false, lp, tlsrpt.Account, dest, false}
+	}
+
+	// Check accounts that may publish OpenPGP keys through WKD.
+	for d, domain := range c.Domains {
+		if domain.WKD == nil {
+			continue
+		}
+		for _, accName := range domain.WKD.Accounts {
+			if _, ok := c.Accounts[accName]; !ok {
+				addErrorf("domain %s: WKD account %q does not exist", d, accName)
+			}
+		}
 	}
 
 	// Set ReportsOnly for domains, based on whether we have seen addresses (possibly
@@ -1796,6 +2546,10 @@ func prepareDynamicConfig(ctx context.Context, log mlog.Log, dynamicPath string,
 	}
 
 	// Aliases, per domain. Also add references to accounts.
+	localDomains := map[dns.Domain]bool{}
+	for _, domain := range c.Domains {
+		localDomains[domain.Domain] = true
+	}
 	for d, domain := range c.Domains {
 		for lpstr, a := range domain.Aliases {
 			addAliasErrorf := func(format string, args ...any) {
@@ -1839,19 +2593,27 @@ func prepareDynamicConfig(ctx context.Context, log mlog.Log, dynamicPath string,
 					continue
 				}
 				dastr := da.Pack(true)
-				accDest, ok := accDests[dastr]
-				if !ok {
-					addAliasErrorf("references non-existent address %q", destAddr)
-					continue
-				}
 				if seen[dastr] {
 					addAliasErrorf("duplicate address %q", destAddr)
 					continue
 				}
 				seen[dastr] = true
+				if !localDomains[da.Domain] {
+					a.RemoteAddresses = append(a.RemoteAddresses, da)
+					continue
+				}
+				accDest, ok := accDests[dastr]
+				if !ok {
+					addAliasErrorf("references non-existent address %q", destAddr)
+					continue
+				}
 				aa := config.AliasAddress{Address: da, AccountName: accDest.Account, Destination: accDest.Destination}
 				a.ParsedAddresses = append(a.ParsedAddresses, aa)
 			}
+			if len(a.ParsedAddresses) == 0 && len(a.RemoteAddresses) > 0 {
+				addAliasErrorf("alias %q needs at least one address of a local account", addr)
+				continue
+			}
 			a.Domain = domain.Domain
 			c.Domains[d].Aliases[lpstr] = a
 			aliases[addr] = a
@@ -1860,18 +2622,22 @@ func prepareDynamicConfig(ctx context.Context, log mlog.Log, dynamicPath string,
 				acc := c.Accounts[aa.AccountName]
 				var addrs []string
 				if a.ListMembers {
-					addrs = make([]string, len(a.ParsedAddresses))
-					for i := range a.ParsedAddresses {
-						addrs[i] = a.ParsedAddresses[i].Address.Pack(true)
+					addrs = make([]string, 0, len(a.ParsedAddresses)+len(a.RemoteAddresses))
+					for _, maa := range a.ParsedAddresses {
+						addrs = append(addrs, maa.Address.Pack(true))
+					}
+					for _, ra := range a.RemoteAddresses {
+						addrs = append(addrs, ra.Pack(true))
 					}
 				}
 				// Keep the non-sensitive fields.
 				accAlias := config.Alias{
-					PostPublic:   a.PostPublic,
-					ListMembers:  a.ListMembers,
-					AllowMsgFrom: a.AllowMsgFrom,
-					LocalpartStr: a.LocalpartStr,
-					Domain:       a.Domain,
+					PostPublic:      a.PostPublic,
+					ListMembers:     a.ListMembers,
+					AllowMsgFrom:    a.AllowMsgFrom,
+					ListUnsubscribe: a.ListUnsubscribe,
+					LocalpartStr:    a.LocalpartStr,
+					Domain:          a.Domain,
 				}
 				acc.Aliases = append(acc.Aliases, config.AddressAlias{SubscriptionAddress: aa.Address.Pack(true), Alias: accAlias, MemberAddresses: addrs})
 				c.Accounts[aa.AccountName] = acc
@@ -2040,6 +2806,85 @@ func prepareDynamicConfig(ctx context.Context, log mlog.Log, dynamicPath string,
 		c.MonitorDNSBLZones = append(c.MonitorDNSBLZones, d)
 	}
 
+	for name, da := range c.DomainAdmins {
+		if name == "" || strings.ContainsAny(name, " \t\r\n") {
+			addErrorf("domain admin %q: name must be non-empty and cannot contain whitespace", name)
+		}
+		if len(da.Domains) == 0 {
+			addErrorf("domain admin %q: at least one domain required", name)
+		}
+		da.DNSDomains = nil
+		for _, s := range da.Domains {
+			d, err := dns.ParseDomain(s)
+			if err != nil {
+				addErrorf("domain admin %q: parsing domain %q: %v", name, s, err)
+				continue
+			}
+			if slices.Contains(da.DNSDomains, d) {
+				addErrorf("domain admin %q: duplicate domain %s", name, d)
+				continue
+			}
+			da.DNSDomains = append(da.DNSDomains, d)
+		}
+		c.DomainAdmins[name] = da
+	}
+
+	for name, at := range c.AdminTokens {
+		if name == "" || strings.ContainsAny(name, " \t\r\n") {
+			addErrorf("admin token %q: name must be non-empty and cannot contain whitespace", name)
+		}
+		if buf, err := base64.StdEncoding.DecodeString(at.TokenHash); err != nil || len(buf) != sha256.Size {
+			addErrorf("admin token %q: token hash must be base64-encoded sha-256 hash", name)
+		}
+		if at.DomainAdmin != "" {
+			if _, ok := c.DomainAdmins[at.DomainAdmin]; !ok {
+				addErrorf("admin token %q: unknown domain admin %q", name, at.DomainAdmin)
+			}
+		}
+	}
+
+	for i, r := range c.IMAPClientRules {
+		if len(r.ParamsRegexp) == 0 {
+			addErrorf("imap client rule %d: at least one parameter required", i)
+		}
+		r.ParamsRegexpCompiled = map[string]*regexp.Regexp{}
+		for k, v := range r.ParamsRegexp {
+			re, err := regexp.Compile(v)
+			if err != nil {
+				addErrorf("imap client rule %d: invalid regexp %q for parameter %q: %v", i, v, k, err)
+				continue
+			}
+			r.ParamsRegexpCompiled[strings.ToLower(k)] = re
+		}
+		for _, accName := range r.Accounts {
+			if _, ok := c.Accounts[accName]; !ok {
+				addErrorf("imap client rule %d: unknown account %q", i, accName)
+			}
+		}
+		if r.Action != "allow" && r.Action != "deny" {
+			addErrorf("imap client rule %d: action must be allow or deny", i)
+		}
+		c.IMAPClientRules[i] = r
+	}
+
+	if c.AdminWebhook != nil {
+		u, err := url.Parse(c.AdminWebhook.URL)
+		if err == nil && (u.Scheme != "http" && u.Scheme != "https") {
+			err = errors.New("scheme must be http or https")
+		}
+		if err != nil {
+			addErrorf("parsing admin hook url %q: %v", c.AdminWebhook.URL, err)
+		}
+
+		// note: admin hook events are in ../webhook/webhook.go and ../config/config.go too. keep in sync.
+		adminHookEvents := []string{"domainadded", "domainremoved", "accountadded", "accountremoved", "addressadded", "addressremoved", "addressmoved", "dkimadded", "dkimremoved", "mtastsramp"}
+		for _, e := range c.AdminWebhook.Events {
+			if !slices.Contains(adminHookEvents, e) {
+				addErrorf("unknown admin hook event %q", e)
+			}
+		}
+	}
+
 	return
 }
 
@@ -0,0 +1,215 @@
+package mox
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	cryptorand "crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mjl-/mox/config"
+)
+
+func TestCheckConfig(t *testing.T) {
+	dir := t.TempDir()
+
+	_, key, err := ed25519.GenerateKey(cryptorand.Reader)
+	if err != nil {
+		t.Fatalf("generating key: %v", err)
+	}
+	buf, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatalf("marshal key: %v", err)
+	}
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: buf})
+	if err := os.WriteFile(filepath.Join(dir, "dkim.pem"), keyPEM, 0600); err != nil {
+		t.Fatalf("writing key: %v", err)
+	}
+
+	makeConfig := func() (config.Static, config.Dynamic) {
+		static := config.Static{
+			DataDir:  "data",
+			User:     "1000",
+			LogLevel: "info",
+			Hostname: "mox.example",
+		}
+		static.Postmaster.Account = "mjl"
+		static.Postmaster.Mailbox = "postmaster"
+		public := config.Listener{IPs: []string{"0.0.0.0"}}
+		public.SMTP.Enabled = true
+		public.SMTP.NoSTARTTLS = true
+		static.AddListener("public", public)
+		internal := config.Listener{IPs: []string{"127.0.0.1"}}
+		internal.AccountHTTP.Enabled = true
+		internal.AdminHTTP.Enabled = true
+		internal.MetricsHTTP.Enabled = true
+		static.AddListener("internal", internal)
+
+		var domain config.Domain
+		domain.DKIM.AddSelector("sel1", config.Selector{PrivateKeyFile: "dkim.pem"}, true)
+		domain.DKIM.AddSelector("sel1", config.Selector{PrivateKeyFile: "dkim.pem"}, true)
+		var dynamic config.Dynamic
+		dynamic.AddDomain("mox.example", domain)
+		acc := config.Account{Domain: "mox.example"}
+		acc.AddDestination("mjl@mox.example", config.Destination{})
+		dynamic.AddAccount("mjl", acc)
+		return static, dynamic
+	}
+
+	check := func(static config.Static, dynamic config.Dynamic, expErr string) {
+		t.Helper()
+		errs := CheckConfig(context.Background(), pkglog, dir, static, dynamic)
+		if expErr == "" {
+			if len(errs) != 0 {
+				t.Fatalf("got errors %v, expected none", errs)
+			}
+			return
+		}
+		for _, err := range errs {
+			if strings.Contains(err.Error(), expErr) {
+				return
+			}
+		}
+		t.Fatalf("got errors %v, expected error containing %q", errs, expErr)
+	}
+
+	static, dynamic := makeConfig()
+	check(static, dynamic, "")
+
+	// Plain HTTP and HTTPS on the same port.
+	static, dynamic = makeConfig()
+	l := static.Listeners["internal"]
+	l.TLS = &config.TLS{KeyCerts: []config.KeyCert{{CertFile: "none.pem", KeyFile: "none.pem"}}}
+	l.AdminHTTPS.Enabled = true
+	l.AdminHTTPS.Port = 80
+	static.AddListener("internal", l)
+	check(static, dynamic, "listener internal: AdminHTTPS on port 80, but port is already used for http")
+
+	// SMTP and IMAP on the same port.
+	static, dynamic = makeConfig()
+	l = static.Listeners["public"]
+	l.IMAP.Enabled = true
+	l.IMAP.Port = 25
+	l.IMAP.NoRequireSTARTTLS = true
+	static.AddListener("public", l)
+	check(static, dynamic, "listener public: IMAP on port 25, but port is already used for smtp")
+
+	// Unspecified IP overlaps with the internal listener.
+	static, dynamic = makeConfig()
+	l = static.Listeners["public"]
+	l.MetricsHTTP.Enabled = true
+	static.AddListener("public", l)
+	check(static, dynamic, "listeners internal and public both use port 8010 on overlapping ips 127.0.0.1 and 0.0.0.0")
+
+	// Different ports on the same IP are fine.
+	l.MetricsHTTP.Port = 8012
+	static.AddListener("public", l)
+	check(static, dynamic, "")
+
+	// Duplicate selector in Sign.
+	static, dynamic = makeConfig()
+	domain := dynamic.Domains["mox.example"]
+	domain.DKIM.Sign = append(domain.DKIM.Sign, "sel1")
+	dynamic.AddDomain("mox.example", domain)
+	check(static, dynamic, "duplicate selector sel1 for signing")
+
+	// Unknown selector.
+	domain.DKIM.Sign = []string{"sel2"}
+	dynamic.AddDomain("mox.example", domain)
+	check(static, dynamic, "unknown selector sel2 for signing")
+}
+
+func TestHostPrivateKeyFilesNext(t *testing.T) {
+	dir := t.TempDir()
+
+	writeKey := func(name string, key any) {
+		t.Helper()
+		buf, err := x509.MarshalPKCS8PrivateKey(key)
+		if err != nil {
+			t.Fatalf("marshal key: %v", err)
+		}
+		keyPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: buf})
+		if err := os.WriteFile(filepath.Join(dir, name), keyPEM, 0600); err != nil {
+			t.Fatalf("writing key: %v", err)
+		}
+	}
+	genECDSA := func(curve elliptic.Curve) *ecdsa.PrivateKey {
+		t.Helper()
+		key, err := ecdsa.GenerateKey(curve, cryptorand.Reader)
+		if err != nil {
+			t.Fatalf("generating key: %v", err)
+		}
+		return key
+	}
+	writeKey("current.pem", genECDSA(elliptic.P256()))
+	writeKey("next.pem", genECDSA(elliptic.P256()))
+	writeKey("p384.pem", genECDSA(elliptic.P384()))
+	_, edkey, err := ed25519.GenerateKey(cryptorand.Reader)
+	if err != nil {
+		t.Fatalf("generating key: %v", err)
+	}
+	writeKey("ed25519.pem", edkey)
+
+	prepare := func(next ...string) (*config.TLS, []error) {
+		t.Helper()
+		static := config.Static{
+			DataDir:  "data",
+			User:     "1000",
+			LogLevel: "info",
+			Hostname: "mox.example",
+		}
+		l := config.Listener{IPs: []string{"0.0.0.0"}}
+		l.SMTP.Enabled = true
+		l.TLS = &config.TLS{
+			KeyCerts:                []config.KeyCert{{CertFile: "none.pem", KeyFile: "none.pem"}},
+			HostPrivateKeyFiles:     []string{"current.pem"},
+			HostPrivateKeyFilesNext: next,
+		}
+		static.AddListener("public", l)
+		c := &Config{Static: static}
+		errs := PrepareStaticConfig(context.Background(), pkglog, filepath.Join(dir, "mox.conf"), c, true, false)
+		return c.Static.Listeners["public"].TLS, errs
+	}
+
+	// Without next keys.
+	tlsConfig, errs := prepare()
+	if len(errs) != 0 {
+		t.Fatalf("got errors %v, expected none", errs)
+	}
+	if len(tlsConfig.HostPrivateECDSAP256Keys) != 1 || len(tlsConfig.HostPrivateKeysNext) != 0 {
+		t.Fatalf("got %d current and %d next keys, expected 1 and 0", len(tlsConfig.HostPrivateECDSAP256Keys), len(tlsConfig.HostPrivateKeysNext))
+	}
+
+	// Next keys are loaded separately, and not used as current keys.
+	tlsConfig, errs = prepare("next.pem")
+	if len(errs) != 0 {
+		t.Fatalf("got errors %v, expected none", errs)
+	}
+	if len(tlsConfig.HostPrivateECDSAP256Keys) != 1 || len(tlsConfig.HostPrivateKeysNext) != 1 {
+		t.Fatalf("got %d current and %d next keys, expected 1 and 1", len(tlsConfig.HostPrivateECDSAP256Keys), len(tlsConfig.HostPrivateKeysNext))
+	}
+	if tlsConfig.HostPrivateECDSAP256Keys[0].(*ecdsa.PrivateKey).Equal(tlsConfig.HostPrivateKeysNext[0]) {
+		t.Fatalf("next key is same as current key")
+	}
+
+	// Unusable next keys are errors, unlike for current keys.
+	check := func(next, expErr string) {
+		t.Helper()
+		_, errs := prepare(next)
+		for _, err := range errs {
+			if strings.Contains(err.Error(), expErr) {
+				return
+			}
+		}
+		t.Fatalf("got errors %v, expected error containing %q", errs, expErr)
+	}
+	check("missing.pem", "parsing next host private key for DANE")
+	check("p384.pem", "unrecognized ecdsa curve, need P-256")
+	check("ed25519.pem", "unrecognized key type ed25519.PrivateKey")
+}
@@ -3,22 +3,29 @@ package mox
 import (
 	"bytes"
 	"context"
+	"crypto/rsa"
 	"fmt"
+	"io"
 	"strings"
 	"time"
 
 	"github.com/mjl-/mox/config"
 	"github.com/mjl-/mox/dkim"
 	"github.com/mjl-/mox/dns"
+	"github.com/mjl-/mox/message"
 	"github.com/mjl-/mox/mlog"
 	"github.com/mjl-/mox/smtp"
 )
 
-// DKIMSelectors returns the selectors to use for signing.
+// DKIMSelectors returns the selectors to use for signing. Retiring selectors are
+// skipped.
 func DKIMSelectors(dkimConf config.DKIM) []dkim.Selector {
 	var l []dkim.Selector
 	for _, sign := range dkimConf.Sign {
 		sel := dkimConf.Selectors[sign]
+		if sel.Retiring {
+			continue
+		}
 		s := dkim.Selector{
 			Hash:          sel.HashEffective,
 			HeaderRelaxed: sel.Canonicalization.HeaderRelaxed,
@@ -67,3 +74,46 @@ func DKIMSign(ctx context.Context, log mlog.Log, from smtp.Path, smtputf8 bool,
 	}
 	return "", nil
 }
+
+// ARCSeal looks up the configuration for domain, or a parent domain like
+// DKIMSign, and uses its first RSA DKIM selector to generate the headers of a new
+// ARC set for a message that is being forwarded. The authResults are those
+// evaluated for the incoming message, and chain is the validation result of its
+// ARC chain.
+//
+// If the chain failed or is at its maximum length, or the domain has no RSA DKIM
+// selector (ARC only specifies rsa-sha256), an empty string and nil error are
+// returned.
+func ARCSeal(ctx context.Context, log mlog.Log, domain dns.Domain, chain dkim.ARCResult, authResults message.AuthResults, smtputf8 bool, msg io.ReaderAt) (string, error) {
+	if chain.Status == dkim.ARCFail || chain.Instance >= dkim.ARCMaxInstance {
+		return "", nil
+	}
+
+	fd := domain
+	var zerodom dns.Domain
+	for fd != zerodom {
+		confDom, ok := Conf.Domain(fd)
+		if !ok {
+			var nfd dns.Domain
+			_, nfd.ASCII, _ = strings.Cut(fd.ASCII, ".")
+			_, nfd.Unicode, _ = strings.Cut(fd.Unicode, ".")
+			fd = nfd
+			continue
+		}
+
+		for _, sel := range DKIMSelectors(confDom.DKIM) {
+			if _, ok := sel.PrivateKey.(*rsa.PrivateKey); !ok {
+				continue
+			}
+			// ../rfc/8617
+			sel.Hash = "sha256"
+			arcHeaders, err := dkim.ARCSeal(ctx, log.Logger, fd, sel, authResults, smtputf8, msg)
+			if err != nil {
+				return "", fmt.Errorf("arc seal for domain %s: %v", fd, err)
+			}
+			return arcHeaders, nil
+		}
+		return "", nil
+	}
+	return "", nil
+}
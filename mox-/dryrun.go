@@ -0,0 +1,236 @@
+package mox
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/mjl-/sconf"
+
+	"github.com/mjl-/mox/config"
+)
+
+// ErrDryRun is returned by WriteDynamicLocked for a context from WithDryRun,
+// after the ConfigPreview has been filled in. Callers handle it like any other
+// error, rolling back any other changes they made.
+var ErrDryRun = errors.New("dry run, config not written")
+
+// ConfigPreview describes the changes a new dynamic config would make, as
+// determined by a dry run.
+type ConfigPreview struct {
+	Diff      string   // Unified diff of domains.conf, both old and new as written by mox.
+	Accounts  []string // Accounts added, removed or with changed configuration.
+	Addresses []string // Addresses and aliases added, removed, or with changed destination or members.
+}
+
+type dryRunCtxKey struct{}
+
+// WithDryRun returns a context for a change of the dynamic config that only
+// validates and describes the new config in preview, without writing it. See
+// ErrDryRun.
+func WithDryRun(ctx context.Context, preview *ConfigPreview) context.Context {
+	return context.WithValue(ctx, dryRunCtxKey{}, preview)
+}
+
+// previewLocked fills preview with the changes from the current dynamic config
+// to the validated new config c.
+func previewLocked(preview *ConfigPreview, c config.Dynamic, accDests map[string]AccountDestination, aliases map[string]config.Alias) error {
+	render := func(v any) (string, error) {
+		var b bytes.Buffer
+		err := sconf.Write(&b, v)
+		return b.String(), err
+	}
+
+	old, err := render(Conf.Dynamic)
+	if err != nil {
+		return fmt.Errorf("writing current config: %v", err)
+	}
+	nc, err := render(c)
+	if err != nil {
+		return fmt.Errorf("writing new config: %v", err)
+	}
+	preview.Diff = unifiedDiff("domains.conf", old, nc)
+
+	accounts := map[string]bool{}
+	for name, acc := range Conf.Dynamic.Accounts {
+		if nacc, ok := c.Accounts[name]; !ok {
+			accounts[name] = true
+		} else {
+			a, err := render(acc)
+			if err != nil {
+				return fmt.Errorf("writing account config: %v", err)
+			}
+			na, err := render(nacc)
+			if err != nil {
+				return fmt.Errorf("writing account config: %v", err)
+			}
+			accounts[name] = a != na
+		}
+	}
+	for name := range c.Accounts {
+		if _, ok := Conf.Dynamic.Accounts[name]; !ok {
+			accounts[name] = true
+		}
+	}
+
+	addrs := map[string]bool{}
+	for addr, ad := range Conf.AccountDestinationsLocked {
+		nad, ok := accDests[addr]
+		addrs[addr] = !ok || nad.Account != ad.Account || !nad.Destination.Equal(ad.Destination)
+	}
+	for addr := range accDests {
+		if _, ok := Conf.AccountDestinationsLocked[addr]; !ok {
+			addrs[addr] = true
+		}
+	}
+	for addr, a := range Conf.aliases {
+		na, ok := aliases[addr]
+		addrs[addr] = addrs[addr] || !ok || !slices.Equal(na.Addresses, a.Addresses)
+	}
+	for addr := range aliases {
+		if _, ok := Conf.aliases[addr]; !ok {
+			addrs[addr] = true
+		}
+	}
+
+	preview.Accounts = trueKeys(accounts)
+	preview.Addresses = trueKeys(addrs)
+	return nil
+}
+
+func trueKeys(m map[string]bool) []string {
+	l := []string{}
+	for k, v := range m {
+		if v {
+			l = append(l, k)
+		}
+	}
+	slices.Sort(l)
+	return l
+}
+
+// unifiedDiff returns a unified diff with 3 lines of context between old and new,
+// or an empty string if they are the same.
+func unifiedDiff(name, old, new string) string {
+	if old == new {
+		return ""
+	}
+	lines := func(s string) []string {
+		l := strings.SplitAfter(s, "\n")
+		if l[len(l)-1] == "" {
+			l = l[:len(l)-1]
+		}
+		return l
+	}
+	a := lines(old)
+	b := lines(new)
+
+	// Changes are typically in few places in a large file. We only compute the
+	// longest common subsequence for the lines between the common prefix and
+	// suffix. If that is still too large, the lines in between are all changed.
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	ma := a[prefix : len(a)-suffix]
+	mb := b[prefix : len(b)-suffix]
+
+	// ops has an element for each line in the combined output: ' ' for unchanged,
+	// '-' for removed and '+' for added.
+	ops := make([]byte, 0, len(a)+len(b))
+	for range prefix {
+		ops = append(ops, ' ')
+	}
+	if len(ma)*len(mb) > 4*1024*1024 {
+		ops = append(ops, bytes.Repeat([]byte{'-'}, len(ma))...)
+		ops = append(ops, bytes.Repeat([]byte{'+'}, len(mb))...)
+	} else {
+		// lcs[i][j] is the length of the longest common subsequence of ma[i:] and mb[j:].
+		lcs := make([][]int32, len(ma)+1)
+		for i := range lcs {
+			lcs[i] = make([]int32, len(mb)+1)
+		}
+		for i := len(ma) - 1; i >= 0; i-- {
+			for j := len(mb) - 1; j >= 0; j-- {
+				if ma[i] == mb[j] {
+					lcs[i][j] = lcs[i+1][j+1] + 1
+				} else {
+					lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+				}
+			}
+		}
+		i, j := 0, 0
+		for i < len(ma) || j < len(mb) {
+			if i < len(ma) && j < len(mb) && ma[i] == mb[j] {
+				ops = append(ops, ' ')
+				i++
+				j++
+			} else if j == len(mb) || i < len(ma) && lcs[i+1][j] >= lcs[i][j+1] {
+				ops = append(ops, '-')
+				i++
+			} else {
+				ops = append(ops, '+')
+				j++
+			}
+		}
+	}
+	for range suffix {
+		ops = append(ops, ' ')
+	}
+
+	const ncontext = 3
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "--- %s\n+++ %s\n", name, name)
+	// Line index into a and b for each op.
+	ai := make([]int, len(ops)+1)
+	bi := make([]int, len(ops)+1)
+	for k, op := range ops {
+		ai[k+1], bi[k+1] = ai[k], bi[k]
+		if op != '+' {
+			ai[k+1]++
+		}
+		if op != '-' {
+			bi[k+1]++
+		}
+	}
+	for k := 0; k < len(ops); {
+		if ops[k] == ' ' {
+			k++
+			continue
+		}
+		// Extend hunk while changes are within 2*ncontext lines of each other.
+		start := max(0, k-ncontext)
+		end := k
+		for n := k; n < len(ops); n++ {
+			if ops[n] != ' ' {
+				end = n + 1
+			} else if n-end >= 2*ncontext {
+				break
+			}
+		}
+		end = min(len(ops), end+ncontext)
+		fmt.Fprintf(&sb, "@@ -%d,%d +%d,%d @@\n", ai[start]+1, ai[end]-ai[start], bi[start]+1, bi[end]-bi[start])
+		for n := start; n < end; n++ {
+			var line string
+			if ops[n] == '+' {
+				line = b[bi[n]]
+			} else {
+				line = a[ai[n]]
+			}
+			sb.WriteByte(ops[n])
+			sb.WriteString(line)
+			if !strings.HasSuffix(line, "\n") {
+				sb.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+		k = end
+	}
+	return sb.String()
+}
@@ -87,6 +87,7 @@ func Listen(network, addr string) (net.Listener, error) {
 		if err != nil {
 			return nil, fmt.Errorf("making network listener from file descriptor for address %s: %v", addr, err)
 		}
+		listeners = append(listeners, ln)
 		return ln, nil
 	}
 
@@ -111,9 +112,24 @@ func Listen(network, addr string) (net.Listener, error) {
 		}
 		passedListeners[addr] = f
 	}
+	listeners = append(listeners, ln)
 	return ln, err
 }
 
+// Network listeners returned by Listen, for CloseListeners.
+var listeners []net.Listener
+
+// CloseListeners closes all network listeners returned by Listen, for stopping
+// mox when it is embedded in another program. Servers stop accepting new
+// connections on closed listeners.
+func CloseListeners() {
+	for _, ln := range listeners {
+		err := ln.Close()
+		pkglog.Check(err, "closing network listener")
+	}
+	listeners = nil
+}
+
 // Open a privileged file, such as a TLS private key. When running as root
 // (during startup), the file is opened and the file descriptor is stored.
 // These file descriptors are passed to the unprivileged process. When in the
@@ -2,6 +2,7 @@ package mox
 
 import (
 	"errors"
+	"fmt"
 	"strings"
 
 	"github.com/mjl-/mox/config"
@@ -55,7 +56,9 @@ func LookupAddress(localpart smtp.Localpart, domain dns.Domain, allowPostmaster,
 	}
 
 	d, ok := Conf.Domain(domain)
-	if !ok || d.ReportsOnly {
+	if !ok {
+		return lookupWildcard(localpart, domain, checkDomainDisabled)
+	} else if d.ReportsOnly {
 		// For ReportsOnly, we also return ErrDomainNotFound, so this domain isn't
 		// considered local/authoritative during delivery.
 		return "", nil, "", config.Destination{}, ErrDomainNotFound
@@ -82,9 +85,82 @@ func LookupAddress(localpart smtp.Localpart, domain dns.Domain, allowPostmaster,
 		}
 		canonical = "@" + domain.Name()
 	}
+	if accAddr.Destination.Disabled {
+		return "", nil, "", config.Destination{}, ErrAddressNotFound
+	}
 	return accAddr.Account, nil, canonical, accAddr.Destination, nil
 }
 
+// lookupWildcard looks up the account for localpart and domain through wildcard
+// destinations of the nearest configured parent domain, first for the localpart,
+// then for any localpart. Domain itself is not configured.
+func lookupWildcard(localpart smtp.Localpart, domain dns.Domain, checkDomainDisabled bool) (accountName string, alias *config.Alias, canonicalAddress string, dest config.Destination, rerr error) {
+	name := domain.ASCII
+	for {
+		_, parent, found := strings.Cut(name, ".")
+		if !found || !strings.Contains(parent, ".") {
+			return "", nil, "", config.Destination{}, ErrDomainNotFound
+		}
+		name = parent
+
+		pd, err := dns.ParseDomain(parent)
+		if err != nil {
+			return "", nil, "", config.Destination{}, ErrDomainNotFound
+		}
+		d, ok := Conf.Domain(pd)
+		if !ok {
+			continue
+		} else if d.ReportsOnly {
+			return "", nil, "", config.Destination{}, ErrDomainNotFound
+		} else if d.Disabled && checkDomainDisabled {
+			return "", nil, "", config.Destination{}, ErrDomainDisabled
+		}
+
+		lp := CanonicalLocalpart(localpart, d)
+		for _, canonical := range []string{WildcardAddress(lp, pd), WildcardAddress("", pd)} {
+			accAddr, a, ok := Conf.AccountDestination(canonical)
+			if !ok || a != nil {
+				continue
+			} else if accAddr.Destination.Disabled {
+				return "", nil, "", config.Destination{}, ErrAddressNotFound
+			}
+			return accAddr.Account, nil, canonical, accAddr.Destination, nil
+		}
+		return "", nil, "", config.Destination{}, ErrDomainNotFound
+	}
+}
+
+// WildcardAddress returns the wildcard destination address for localpart at all
+// subdomains of domain, "localpart@*.domain", or "@*.domain" for any localpart at
+// all subdomains.
+func WildcardAddress(localpart smtp.Localpart, domain dns.Domain) string {
+	var lp string
+	if localpart != "" {
+		lp = localpart.String()
+	}
+	return lp + "@*." + domain.Name()
+}
+
+// ParseWildcardAddress parses a wildcard destination address as returned by
+// WildcardAddress. If s is not a wildcard address, ok is false.
+func ParseWildcardAddress(s string) (localpart smtp.Localpart, domain dns.Domain, ok bool, rerr error) {
+	i := strings.LastIndex(s, "@")
+	if i < 0 || !strings.HasPrefix(s[i+1:], "*.") {
+		return "", dns.Domain{}, false, nil
+	}
+	if i > 0 {
+		localpart, rerr = smtp.ParseLocalpart(s[:i])
+		if rerr != nil {
+			return "", dns.Domain{}, true, fmt.Errorf("parsing localpart: %w", rerr)
+		}
+	}
+	domain, rerr = dns.ParseDomain(s[i+len("@*."):])
+	if rerr != nil {
+		return "", dns.Domain{}, true, fmt.Errorf("parsing domain: %w", rerr)
+	}
+	return localpart, domain, true, nil
+}
+
 // CanonicalLocalpart returns the canonical localpart, removing optional catchall
 // separator, and optionally lower-casing the string.
 func CanonicalLocalpart(localpart smtp.Localpart, d config.Domain) smtp.Localpart {
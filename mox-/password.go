@@ -2,6 +2,13 @@ package mox
 
 import (
 	cryptorand "crypto/rand"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"strings"
+
+	"golang.org/x/text/secure/precis"
 )
 
 func GeneratePassword() string {
@@ -21,3 +28,88 @@ func GeneratePassword() string {
 	}
 	return s
 }
+
+// CheckPassword returns an error if password does not meet the password policy
+// from the static config. Used for new passwords set by users and admins.
+func CheckPassword(password string) error {
+	pp := Conf.Static.PasswordPolicy
+
+	password, err := precis.OpaqueString.String(password)
+	if err != nil {
+		return fmt.Errorf(`password not allowed by "precis"`)
+	}
+	if len(password) < max(pp.MinLength, 8) {
+		return fmt.Errorf("password must be at least %d characters long", max(pp.MinLength, 8))
+	}
+	if pp.MinEntropy > 0 {
+		if bits := PasswordEntropy(password); bits < pp.MinEntropy {
+			return fmt.Errorf("password too weak, estimated at %d bits of entropy, need %d, try a longer password with more kinds of characters", bits, pp.MinEntropy)
+		}
+	}
+	if pp.BreachedFileBloom != nil && pp.BreachedFileBloom.Has(BreachedPasswordKey(password)) {
+		return fmt.Errorf("password found in list of breached passwords, choose another password")
+	}
+	return nil
+}
+
+// PasswordEntropy returns an estimate of the entropy in bits of password. Each
+// character contributes the number of bits needed for the character classes used
+// in the password (lower case, upper case, digits, ASCII symbols, other). A
+// character that was already used earlier in the password contributes only 1
+// bit.
+func PasswordEntropy(password string) int {
+	var lower, upper, digit, symbol, other bool
+	for _, c := range password {
+		switch {
+		case c >= 'a' && c <= 'z':
+			lower = true
+		case c >= 'A' && c <= 'Z':
+			upper = true
+		case c >= '0' && c <= '9':
+			digit = true
+		case c > ' ' && c < 0x7f:
+			symbol = true
+		default:
+			other = true
+		}
+	}
+	var pool float64
+	if lower {
+		pool += 26
+	}
+	if upper {
+		pool += 26
+	}
+	if digit {
+		pool += 10
+	}
+	if symbol {
+		pool += 33
+	}
+	if other {
+		pool += 100
+	}
+	if pool == 0 {
+		return 0
+	}
+
+	seen := map[rune]bool{}
+	var bits float64
+	for _, c := range password {
+		if seen[c] {
+			bits++
+		} else {
+			seen[c] = true
+			bits += math.Log2(pool)
+		}
+	}
+	return int(bits)
+}
+
+// BreachedPasswordKey returns the key for password in a breached password bloom
+// filter: the SHA-1 hash of the password in upper case hexadecimal, as in the
+// Have I Been Pwned password lists.
+func BreachedPasswordKey(password string) string {
+	h := sha1.Sum([]byte(password))
+	return strings.ToUpper(hex.EncodeToString(h[:]))
+}
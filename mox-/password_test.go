@@ -0,0 +1,44 @@
+package mox
+
+import (
+	"testing"
+
+	"github.com/mjl-/mox/config"
+	"github.com/mjl-/mox/junk"
+)
+
+func TestCheckPassword(t *testing.T) {
+	defer func() {
+		Conf.Static.PasswordPolicy = config.PasswordPolicy{}
+	}()
+
+	entropy := func(pw string, exp int) {
+		t.Helper()
+		if bits := PasswordEntropy(pw); bits != exp {
+			t.Fatalf("entropy for %q: got %d, expected %d", pw, bits, exp)
+		}
+	}
+	entropy("", 0)
+	entropy("abcdefg1", 41)
+	entropy("aaaaaaaa", 11)
+	entropy("Ab1!", 26)
+
+	bloom, err := junk.NewBloom(make([]byte, 1024), 7)
+	if err != nil {
+		t.Fatalf("new bloom: %v", err)
+	}
+	bloom.Add(BreachedPasswordKey("breached123"))
+	Conf.Static.PasswordPolicy = config.PasswordPolicy{MinLength: 10, MinEntropy: 40, BreachedFileBloom: bloom}
+
+	check := func(pw string, expOK bool) {
+		t.Helper()
+		err := CheckPassword(pw)
+		if (err == nil) != expOK {
+			t.Fatalf("check password %q: got err %v, expected ok %v", pw, err, expOK)
+		}
+	}
+	check("short1234", false)
+	check("aaaaaaaaaaaa", false)
+	check("breached123", false)
+	check("notbreached1", true)
+}
@@ -21,11 +21,14 @@ func init() {
 }
 
 // ReceivedIDInit sets an AES key (must be 16 bytes) and random buffer (must be
-// 8 bytes) for use by ReceivedID.
+// 8 bytes) for use by ReceivedID. The keys for unsubscribe tokens and SRS
+// addresses are derived from them too.
 func ReceivedIDInit(key, rand []byte) error {
 	var err error
 	idCipher, err = aes.NewCipher(key)
 	idRand = rand
+	unsubscribeKeyInit(key, rand)
+	srsKeyInit(key, rand)
 	return err
 }
 
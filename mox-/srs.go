@@ -0,0 +1,32 @@
+package mox
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"time"
+
+	"github.com/mjl-/mox/dns"
+	"github.com/mjl-/mox/smtp"
+	"github.com/mjl-/mox/srs"
+)
+
+// HMAC key for SRS addresses, derived from the key for received IDs like the
+// unsubscribe key, so addresses remain valid across restarts.
+var srsKey []byte
+
+func srsKeyInit(key, rand []byte) {
+	mac := hmac.New(sha256.New, append(append([]byte{}, key...), rand...))
+	mac.Write([]byte("srs"))
+	srsKey = mac.Sum(nil)
+}
+
+// SRSForward returns the SMTP MAIL FROM address for forwarding a message from
+// "from" through domain.
+func SRSForward(from smtp.Path, domain dns.Domain) smtp.Path {
+	return srs.Forward(srsKey, from, domain, time.Now())
+}
+
+// SRSReverse returns the address to send a bounce for an SRS localpart to.
+func SRSReverse(localpart smtp.Localpart) (smtp.Path, error) {
+	return srs.Reverse(srsKey, localpart, time.Now())
+}
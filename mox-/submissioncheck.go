@@ -0,0 +1,32 @@
+package mox
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/mjl-/mox/config"
+)
+
+// ErrSubmissionCheck is returned by SubmissionCheck for messages that don't pass
+// the submission checks of an account.
+var ErrSubmissionCheck = errors.New("submission check failed")
+
+// SubmissionCheck returns an error if a message with the given properties does not
+// pass the account submission checks. The ConfirmRecipients threshold is not
+// checked, only webmail can ask for confirmation. A nil checks passes.
+func SubmissionCheck(checks *config.SubmissionChecks, hasTo bool, subject string, nrecipients int) error {
+	if checks == nil {
+		return nil
+	}
+	if checks.RequireTo && !hasTo {
+		return fmt.Errorf("%w: message must have a To or Cc header", ErrSubmissionCheck)
+	}
+	if checks.RequireSubject && strings.TrimSpace(subject) == "" {
+		return fmt.Errorf("%w: message must have a subject", ErrSubmissionCheck)
+	}
+	if checks.MaxRecipients > 0 && nrecipients > checks.MaxRecipients {
+		return fmt.Errorf("%w: message has %d recipients, more than maximum %d", ErrSubmissionCheck, nrecipients, checks.MaxRecipients)
+	}
+	return nil
+}
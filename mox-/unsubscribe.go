@@ -0,0 +1,121 @@
+package mox
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/mjl-/mox/config"
+)
+
+// Unsubscribe is the request encoded in a signed one-click unsubscribe link, as
+// used in List-Unsubscribe headers of messages for aliases and messages sent
+// through the webapi. Exactly one of Alias and Account is set.
+type Unsubscribe struct {
+	Alias   string // Canonical address of alias, Address is removed as member.
+	Account string // Account that sent the message, Address is added to its suppression list.
+	Address string // Address of recipient that unsubscribes.
+}
+
+// HMAC key for unsubscribe tokens, derived from the key for received IDs, so it
+// remains stable across restarts.
+var unsubscribeKey []byte
+
+func unsubscribeKeyInit(key, rand []byte) {
+	mac := hmac.New(sha256.New, append(append([]byte{}, key...), rand...))
+	mac.Write([]byte("unsubscribe"))
+	unsubscribeKey = mac.Sum(nil)
+}
+
+func unsubscribeMAC(payload []byte) []byte {
+	mac := hmac.New(sha256.New, unsubscribeKey)
+	mac.Write(payload)
+	return mac.Sum(nil)[:16]
+}
+
+// UnsubscribeToken returns a signed token for u, for use in an unsubscribe URL.
+// Tokens don't expire.
+func UnsubscribeToken(u Unsubscribe) string {
+	kind, target := "a", u.Alias
+	if u.Account != "" {
+		kind, target = "c", u.Account
+	}
+	payload := []byte(kind + "\x00" + target + "\x00" + u.Address)
+	buf := append(unsubscribeMAC(payload), payload...)
+	return base64.RawURLEncoding.EncodeToString(buf)
+}
+
+// ErrUnsubscribeToken is returned by ParseUnsubscribeToken for malformed or
+// forged tokens.
+var ErrUnsubscribeToken = errors.New("invalid unsubscribe token")
+
+// ParseUnsubscribeToken verifies the signature of a token generated by
+// UnsubscribeToken and returns the request.
+func ParseUnsubscribeToken(token string) (Unsubscribe, error) {
+	buf, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil || len(buf) < 16 {
+		return Unsubscribe{}, ErrUnsubscribeToken
+	}
+	mac, payload := buf[:16], buf[16:]
+	if !hmac.Equal(mac, unsubscribeMAC(payload)) {
+		return Unsubscribe{}, ErrUnsubscribeToken
+	}
+	t := strings.Split(string(payload), "\x00")
+	if len(t) != 3 || t[1] == "" || t[2] == "" {
+		return Unsubscribe{}, ErrUnsubscribeToken
+	}
+	switch t[0] {
+	case "a":
+		return Unsubscribe{Alias: t[1], Address: t[2]}, nil
+	case "c":
+		return Unsubscribe{Account: t[1], Address: t[2]}, nil
+	}
+	return Unsubscribe{}, ErrUnsubscribeToken
+}
+
+// UnsubscribeURL returns a one-click unsubscribe URL for u, served by the first
+// listener (by name) with UnsubscribeHTTPS enabled. If no such listener exists,
+// false is returned.
+func UnsubscribeURL(u Unsubscribe) (string, bool) {
+	names := make([]string, 0, len(Conf.Static.Listeners))
+	for name := range Conf.Static.Listeners {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		l := Conf.Static.Listeners[name]
+		if !l.UnsubscribeHTTPS.Enabled {
+			continue
+		}
+		host := Conf.Static.HostnameDomain.ASCII
+		if l.HostnameDomain.ASCII != "" {
+			host = l.HostnameDomain.ASCII
+		}
+		if port := config.Port(l.UnsubscribeHTTPS.Port, 443); port != 443 {
+			host = fmt.Sprintf("%s:%d", host, port)
+		}
+		path := "/unsubscribe/"
+		if l.UnsubscribeHTTPS.Path != "" {
+			path = l.UnsubscribeHTTPS.Path
+		}
+		u := url.URL{Scheme: "https", Host: host, Path: path + UnsubscribeToken(u)}
+		return u.String(), true
+	}
+	return "", false
+}
+
+// UnsubscribeHeaders returns List-Unsubscribe and List-Unsubscribe-Post headers
+// for one-click unsubscribe for u, or an empty string if no listener serves
+// unsubscribe requests.
+func UnsubscribeHeaders(u Unsubscribe) string {
+	s, ok := UnsubscribeURL(u)
+	if !ok {
+		return ""
+	}
+	return "List-Unsubscribe: <" + s + ">\r\nList-Unsubscribe-Post: List-Unsubscribe=One-Click\r\n"
+}
@@ -0,0 +1,18 @@
+//go:build !windows
+
+package moxio
+
+import (
+	"os"
+	"syscall"
+)
+
+// LinkCount returns the number of hard links to the file described by fi. If the
+// number is not available, ok is false.
+func LinkCount(fi os.FileInfo) (n int, ok bool) {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, false
+	}
+	return int(st.Nlink), true
+}
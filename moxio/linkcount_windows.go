@@ -0,0 +1,12 @@
+package moxio
+
+import (
+	"os"
+)
+
+// LinkCount returns the number of hard links to the file described by fi. Not
+// available on Windows, ok is always false.
+func LinkCount(fi os.FileInfo) (n int, ok bool) {
+	// todo: use GetFileInformationByHandle for the number of links on windows?
+	return 0, false
+}
@@ -0,0 +1,336 @@
+// Package moxserver runs mox as part of another Go program, e.g. for appliances
+// built on mox that manage its configuration themselves.
+//
+// A Server is created with New from a configuration in Go structs, and started
+// and stopped with Start and Stop. Log records can be passed to a custom
+// slog.Handler. Metrics are registered with the default Prometheus registry, see
+// prometheus.DefaultGatherer, which can be combined with a registry of the
+// embedding program with prometheus.Gatherers.
+//
+// Mox keeps its configuration, databases and listeners in global state, so only
+// one Server can run in a process, and it cannot be started again after Stop.
+// Privileges are not dropped, mox does not handle signals, and the ctl unix domain
+// socket used by the mox subcommands is not available.
+//
+// The "mox serve" and "mox localserve" commands start mox through Listen and
+// Serve.
+package moxserver
+
+import (
+	"context"
+	cryptorand "crypto/rand"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/mjl-/sconf"
+
+	"github.com/mjl-/mox/admin"
+	"github.com/mjl-/mox/config"
+	"github.com/mjl-/mox/dkim"
+	"github.com/mjl-/mox/dmarcdb"
+	"github.com/mjl-/mox/dns"
+	"github.com/mjl-/mox/eventdb"
+	"github.com/mjl-/mox/greylist"
+	"github.com/mjl-/mox/http"
+	"github.com/mjl-/mox/imapserver"
+	"github.com/mjl-/mox/managesieve"
+	"github.com/mjl-/mox/mlog"
+	"github.com/mjl-/mox/mox-"
+	"github.com/mjl-/mox/mtastsdb"
+	"github.com/mjl-/mox/queue"
+	"github.com/mjl-/mox/smtpserver"
+	"github.com/mjl-/mox/store"
+	"github.com/mjl-/mox/tlsrptdb"
+	"github.com/mjl-/mox/tlsrptsend"
+)
+
+var pkglog = mlog.New("moxserver", nil)
+
+// Config for New.
+type Config struct {
+	// Directory to write the static and dynamic configuration to, as mox.conf and
+	// domains.conf. Relative paths in the configuration, such as DataDir, are
+	// relative to this directory. Changes to the dynamic configuration while running,
+	// e.g. through the admin web interface, are written to domains.conf, see
+	// Server.DynamicConfig.
+	Dir string
+
+	// Static configuration. If User is empty, the user of the current process is
+	// used.
+	Static config.Static
+
+	Dynamic config.Dynamic
+
+	// If set, log records are passed to this handler instead of written to stderr.
+	// Log levels from the configuration still apply.
+	LogHandler slog.Handler
+}
+
+// Server is a mox instance, created with New.
+type Server struct {
+	log     mlog.Log
+	started bool
+	stopped bool
+}
+
+// New writes the configuration to files in cfg.Dir, and loads and checks it.
+// Listeners, databases and other processes are only started by Start.
+func New(ctx context.Context, cfg Config) (*Server, error) {
+	if cfg.Dir == "" {
+		return nil, fmt.Errorf("missing directory for configuration")
+	}
+	if cfg.LogHandler != nil {
+		mlog.SetHandler(cfg.LogHandler)
+	}
+	log := pkglog.WithContext(ctx)
+
+	if cfg.Static.User == "" {
+		cfg.Static.User = fmt.Sprintf("%d", os.Getuid())
+	}
+	if err := os.MkdirAll(cfg.Dir, 0770); err != nil {
+		return nil, fmt.Errorf("creating config directory: %v", err)
+	}
+	write := func(name string, v any) error {
+		f, err := os.CreateTemp(cfg.Dir, name+"-*")
+		if err != nil {
+			return fmt.Errorf("creating temporary file for %s: %v", name, err)
+		}
+		defer func() {
+			if f != nil {
+				err := f.Close()
+				log.Check(err, "closing temporary config file")
+				err = os.Remove(f.Name())
+				log.Check(err, "removing temporary config file")
+			}
+		}()
+		if err := f.Chmod(0660); err != nil {
+			return fmt.Errorf("setting permissions of %s: %v", name, err)
+		}
+		if err := sconf.Write(f, v); err != nil {
+			return fmt.Errorf("writing %s: %v", name, err)
+		}
+		if err := f.Close(); err != nil {
+			return fmt.Errorf("closing %s: %v", name, err)
+		}
+		if err := os.Rename(f.Name(), filepath.Join(cfg.Dir, name)); err != nil {
+			return fmt.Errorf("renaming %s: %v", name, err)
+		}
+		f = nil
+		return nil
+	}
+	if err := write("mox.conf", cfg.Static); err != nil {
+		return nil, err
+	}
+	if err := write("domains.conf", cfg.Dynamic); err != nil {
+		return nil, err
+	}
+
+	mox.ConfigStaticPath = filepath.Join(cfg.Dir, "mox.conf")
+	mox.ConfigDynamicPath = filepath.Join(cfg.Dir, "domains.conf")
+	mox.FilesImmediate = true
+	if errs := mox.LoadConfig(ctx, log, true, false); len(errs) > 0 {
+		return nil, fmt.Errorf("loading config: %w", errors.Join(errs...))
+	}
+	return &Server{log: log}, nil
+}
+
+// Start starts the listeners, databases and processes like the delivery queue,
+// then returns. Failing to listen on a configured address is fatal to the
+// process, as with "mox serve".
+func (s *Server) Start(ctx context.Context) error {
+	if s.started {
+		return fmt.Errorf("already started")
+	}
+	s.started = true
+
+	// Initialize key and random buffer for creating opaque SMTP transaction IDs.
+	if err := os.MkdirAll(mox.DataDirPath("."), 0770); err != nil {
+		return fmt.Errorf("creating data directory: %v", err)
+	}
+	recvidpath := mox.DataDirPath("receivedid.key")
+	recvidbuf, err := os.ReadFile(recvidpath)
+	if err != nil || len(recvidbuf) != 16+8 {
+		recvidbuf = make([]byte, 16+8)
+		if _, err := cryptorand.Read(recvidbuf); err != nil {
+			return fmt.Errorf("reading random recvid data: %v", err)
+		}
+		if err := os.WriteFile(recvidpath, recvidbuf, 0660); err != nil {
+			return fmt.Errorf("writing %s: %v", recvidpath, err)
+		}
+	}
+	if err := mox.ReceivedIDInit(recvidbuf[:16], recvidbuf[16:]); err != nil {
+		return fmt.Errorf("init receivedid: %v", err)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	Listen()
+	if err := Serve(true, !mox.Conf.Static.NoOutgoingDMARCReports, !mox.Conf.Static.NoOutgoingTLSReports); err != nil {
+		return err
+	}
+	s.log.Print("ready to serve")
+	return nil
+}
+
+// Stop shuts down mox: Listeners are closed, and active connections and
+// operations get time to finish until ctx is done, after which they are aborted.
+// Databases are closed. An error is returned if connections had to be aborted.
+func (s *Server) Stop(ctx context.Context) error {
+	if !s.started || s.stopped {
+		return fmt.Errorf("not running")
+	}
+	s.stopped = true
+
+	mox.CloseListeners()
+	err := Shutdown(ctx, s.log)
+	mox.ContextCancel()
+
+	// Wait for the queue processes to stop, so we can close its database.
+	for range 4 {
+		select {
+		case <-queueDone:
+		case <-time.After(time.Second):
+			s.log.Error("queue did not stop in time, closing databases")
+		}
+	}
+	if switchboardStop != nil {
+		switchboardStop()
+		switchboardStop = nil
+	}
+
+	queue.Shutdown()
+	closeDB := func(name string, fn func() error) {
+		xerr := fn()
+		s.log.Check(xerr, "closing database", slog.String("db", name))
+	}
+	closeDB("store", store.Close)
+	closeDB("mtastsdb", mtastsdb.Close)
+	closeDB("tlsrptdb", tlsrptdb.Close)
+	closeDB("dmarcdb", dmarcdb.Close)
+	closeDB("eventdb", eventdb.Close)
+	closeDB("greylist", greylist.Close)
+	mlog.SetHandler(nil)
+	return err
+}
+
+// DynamicConfig returns the current dynamic configuration, including changes made
+// while running.
+func (s *Server) DynamicConfig() config.Dynamic {
+	return mox.Conf.DynamicConfig()
+}
+
+// Listen prepares network listeners for all configured listeners. When running
+// as root, the listeners can be passed to an unprivileged process started with
+// mox.ForkExecUnprivileged, which calls Listen again.
+func Listen() {
+	smtpserver.Listen()
+	imapserver.Listen()
+	managesieve.Listen()
+	http.Listen()
+}
+
+var queueDone chan struct{} // Goroutines for messages and webhooks, and cleaners.
+var switchboardStop func()  // For Stop.
+
+// Serve initializes all packages, starts serving on the listeners prepared by
+// Listen, starts the queue and the switchboard, then returns.
+func Serve(mtastsdbRefresher, sendDMARCReports, sendTLSReports bool) error {
+	if err := mtastsdb.Init(mtastsdbRefresher); err != nil {
+		return fmt.Errorf("mtastsdb init: %s", err)
+	}
+
+	if err := tlsrptdb.Init(); err != nil {
+		return fmt.Errorf("tlsrptdb init: %s", err)
+	}
+
+	if err := dmarcdb.Init(); err != nil {
+		return fmt.Errorf("dmarcdb init: %s", err)
+	}
+
+	if err := eventdb.Init(); err != nil {
+		return fmt.Errorf("eventdb init: %s", err)
+	}
+
+	if err := greylist.Init(); err != nil {
+		return fmt.Errorf("greylist init: %s", err)
+	}
+
+	if err := store.Init(mox.Context); err != nil {
+		return fmt.Errorf("store init: %s", err)
+	}
+
+	// Cache DKIM records and verified signatures for bursts of similar incoming
+	// messages, e.g. from mailing lists.
+	dkim.DefaultCache = dkim.NewCache(5*time.Minute, 1000)
+
+	queueDone = make(chan struct{})
+	if err := queue.Start(dns.StrictResolver{Pkg: "queue"}, queueDone); err != nil {
+		return fmt.Errorf("queue start: %s", err)
+	}
+
+	if sendDMARCReports {
+		dmarcdb.Start(dns.StrictResolver{Pkg: "dmarcdb"})
+	}
+
+	if sendTLSReports {
+		tlsrptsend.Start(dns.StrictResolver{Pkg: "tlsrptsend"})
+	}
+
+	eventdb.Start()
+	greylist.Start()
+
+	admin.StartMTASTSRamp(dns.StrictResolver{Pkg: "mtastsramp"})
+
+	store.StartAuthCache()
+	store.StartArchivePacker(mox.Shutdown)
+	store.StartAutoArchiver(mox.Shutdown)
+	smtpserver.Serve()
+	imapserver.Serve()
+	managesieve.Serve()
+	http.Serve()
+
+	switchboardStop = store.Switchboard()
+	return nil
+}
+
+// Shutdown initiates a graceful shutdown: New connections and commands are
+// rejected, and active connections get time to finish until ctx is done. Then
+// pending operations are canceled and connections are aborted. An error is
+// returned if connections had to be aborted.
+func Shutdown(ctx context.Context, log mlog.Log) error {
+	// We indicate we are shutting down. Causes new connections and new SMTP commands
+	// to be rejected. Should stop active connections pretty quickly.
+	mox.ShutdownCancel()
+
+	// Now we are going to wait for all connections to be gone, up to a timeout.
+	done := mox.Connections.Done()
+	second := time.Tick(time.Second)
+	select {
+	case <-done:
+		log.Print("connections shutdown, waiting until 1 second passed")
+		<-second
+		return nil
+
+	case <-ctx.Done():
+		// We now cancel all pending operations, and set an immediate deadline on sockets.
+		// Should get us a clean shutdown relatively quickly.
+		mox.ContextCancel()
+		mox.Connections.Shutdown()
+
+		second := time.Tick(time.Second)
+		select {
+		case <-done:
+			log.Print("no more connections, shutdown is clean, waiting until 1 second passed")
+			<-second // Still wait for second, giving processes like imports a chance to clean up.
+			return nil
+		case <-second:
+			log.Print("shutting down with pending sockets")
+			return fmt.Errorf("shutting down with pending connections")
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package moxserver
+
+import (
+	"bufio"
+	"context"
+	"log/slog"
+	"net"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mjl-/mox/config"
+)
+
+var ctxbg = context.Background()
+
+type testHandler struct {
+	sync.Mutex
+	msgs []string
+}
+
+func (h *testHandler) Enabled(ctx context.Context, level slog.Level) bool { return true }
+func (h *testHandler) WithAttrs(attrs []slog.Attr) slog.Handler           { return h }
+func (h *testHandler) WithGroup(name string) slog.Handler                 { return h }
+func (h *testHandler) Handle(ctx context.Context, r slog.Record) error {
+	h.Lock()
+	defer h.Unlock()
+	h.msgs = append(h.msgs, r.Message)
+	return nil
+}
+
+func tcheck(t *testing.T, err error, msg string) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("%s: %s", msg, err)
+	}
+}
+
+func TestServer(t *testing.T) {
+	// Find a free port for the SMTP listener.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	tcheck(t, err, "listen")
+	port := ln.Addr().(*net.TCPAddr).Port
+	ln.Close()
+
+	dir := t.TempDir()
+	var static config.Static
+	static.DataDir = "data"
+	static.LogLevel = "info"
+	static.Hostname = "mox.example"
+	static.Postmaster.Account = "mjl"
+	static.Postmaster.Mailbox = "postmaster"
+	static.NoOutgoingDMARCReports = true
+	static.NoOutgoingTLSReports = true
+	listener := config.Listener{IPs: []string{"127.0.0.1"}}
+	listener.SMTP.Enabled = true
+	listener.SMTP.Port = port
+	listener.SMTP.NoSTARTTLS = true
+	static.Listeners = map[string]config.Listener{"local": listener}
+	dynamic := config.Dynamic{
+		Domains: map[string]config.Domain{"mox.example": {}},
+		Accounts: map[string]config.Account{
+			"mjl": {
+				Domain:       "mox.example",
+				Destinations: map[string]config.Destination{"mjl@mox.example": {}},
+			},
+		},
+	}
+
+	h := &testHandler{}
+	s, err := New(ctxbg, Config{Dir: filepath.Join(dir, "config"), Static: static, Dynamic: dynamic, LogHandler: h})
+	tcheck(t, err, "new server")
+	err = s.Start(ctxbg)
+	tcheck(t, err, "start")
+
+	if _, ok := s.DynamicConfig().Accounts["mjl"]; !ok {
+		t.Fatalf("account missing in dynamic config")
+	}
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	tcheck(t, err, "dial smtp")
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	tcheck(t, err, "read smtp greeting")
+	if !strings.HasPrefix(line, "220 mox.example ") {
+		t.Fatalf("got smtp greeting %q", line)
+	}
+	conn.Close()
+
+	ctx, cancel := context.WithTimeout(ctxbg, 3*time.Second)
+	defer cancel()
+	err = s.Stop(ctx)
+	tcheck(t, err, "stop")
+
+	// Listener is closed.
+	if conn, err := net.Dial("tcp", ln.Addr().String()); err == nil {
+		conn.Close()
+		t.Fatalf("smtp listener still accepting connections after stop")
+	}
+
+	h.Lock()
+	defer h.Unlock()
+	if len(h.msgs) == 0 {
+		t.Fatalf("no log messages passed to handler")
+	}
+}
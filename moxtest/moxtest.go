@@ -0,0 +1,329 @@
+// Package moxtest runs a mox instance in the current process for integration
+// tests, with a temporary configuration and data directory.
+//
+// Messages can be delivered over SMTP as if by a remote mail server, or be
+// submitted with authentication. The resulting messages in mailboxes of accounts,
+// and in the outgoing queue, can be inspected. The queue is not started,
+// submitted messages stay in the queue.
+//
+// Mox keeps its configuration and databases in global state, so only one Server
+// can run at a time in a process, and tests using a Server cannot run in parallel.
+//
+// Mox does not implement LMTP, messages are delivered over SMTP.
+package moxtest
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/mjl-/bstore"
+
+	"github.com/mjl-/mox/dmarcdb"
+	"github.com/mjl-/mox/dns"
+	"github.com/mjl-/mox/mlog"
+	"github.com/mjl-/mox/mox-"
+	"github.com/mjl-/mox/queue"
+	"github.com/mjl-/mox/sasl"
+	"github.com/mjl-/mox/smtp"
+	"github.com/mjl-/mox/smtpclient"
+	"github.com/mjl-/mox/smtpserver"
+	"github.com/mjl-/mox/store"
+	"github.com/mjl-/mox/tlsrptdb"
+)
+
+var pkglog = mlog.New("moxtest", nil)
+
+// Account is an account in the configuration of a Server.
+type Account struct {
+	Name     string
+	Address  string // Email address of the account. Its domain is added to the configuration.
+	Password string // For authentication with Submit, optional.
+}
+
+// Options for Start. Zero values are replaced by defaults.
+type Options struct {
+	Hostname string    // Hostname of the mox instance. Default "mox.example".
+	Accounts []Account // Default a single account "mjl" with address "mjl@mox.example" and password "testtest".
+	LogLevel string    // Default "info".
+}
+
+// Server is a mox instance started with Start.
+type Server struct {
+	Dir            string // With "config" and "data" directories. Removed after the test.
+	SMTPAddr       string // Address of the SMTP listener for delivery, e.g. "127.0.0.1:12345".
+	SubmissionAddr string // Address of the SMTP listener for submission, without TLS.
+
+	t          testing.TB
+	mu         sync.Mutex // For resolver.
+	resolver   dns.MockResolver
+	listeners  []net.Listener
+	wg         sync.WaitGroup
+	switchStop func()
+}
+
+// Start writes a configuration to a temporary directory, starts mox with it and
+// returns the Server. The Server is stopped and the directory removed when the
+// test completes. Failures are fatal to the test.
+func Start(t testing.TB, opts Options) *Server {
+	t.Helper()
+
+	if opts.Hostname == "" {
+		opts.Hostname = "mox.example"
+	}
+	if len(opts.Accounts) == 0 {
+		opts.Accounts = []Account{{Name: "mjl", Address: "mjl@" + opts.Hostname, Password: "testtest"}}
+	}
+	if opts.LogLevel == "" {
+		opts.LogLevel = "info"
+	}
+
+	s := &Server{Dir: t.TempDir(), t: t}
+	configDir := filepath.Join(s.Dir, "config")
+	err := os.Mkdir(configDir, 0770)
+	s.xcheckf(err, "creating config directory")
+
+	uid := os.Getuid()
+	if uid < 0 {
+		uid = 1000
+	}
+	static := fmt.Sprintf(`DataDir: ../data
+User: %d
+LogLevel: %s
+Hostname: %s
+Postmaster:
+	Account: %s
+	Mailbox: postmaster
+Listeners:
+	local: nil
+`, uid, opts.LogLevel, opts.Hostname, opts.Accounts[0].Name)
+	err = os.WriteFile(filepath.Join(configDir, "mox.conf"), []byte(static), 0660)
+	s.xcheckf(err, "writing mox.conf")
+
+	var domains []string
+	var accounts strings.Builder
+	for _, acc := range opts.Accounts {
+		addr, err := smtp.ParseAddress(acc.Address)
+		s.xcheckf(err, "parsing address of account %q", acc.Name)
+		dom := addr.Domain.Name()
+		if !slices.Contains(domains, dom) {
+			domains = append(domains, dom)
+		}
+		fmt.Fprintf(&accounts, "\t%s:\n\t\tDomain: %s\n\t\tDestinations:\n\t\t\t%s: nil\n", acc.Name, dom, addr.String())
+	}
+	var dynamic strings.Builder
+	dynamic.WriteString("Domains:\n")
+	for _, dom := range domains {
+		fmt.Fprintf(&dynamic, "\t%s: nil\n", dom)
+	}
+	dynamic.WriteString("Accounts:\n")
+	dynamic.WriteString(accounts.String())
+	err = os.WriteFile(filepath.Join(configDir, "domains.conf"), []byte(dynamic.String()), 0660)
+	s.xcheckf(err, "writing domains.conf")
+
+	mox.ConfigStaticPath = filepath.Join(configDir, "mox.conf")
+	mox.ConfigDynamicPath = filepath.Join(configDir, "domains.conf")
+	if errs := mox.LoadConfig(context.Background(), pkglog, false, false); len(errs) > 0 {
+		t.Fatalf("loading config: %v", errs)
+	}
+
+	err = store.Init(mox.Context)
+	s.xcheckf(err, "store init")
+	err = dmarcdb.Init()
+	s.xcheckf(err, "dmarcdb init")
+	err = tlsrptdb.Init()
+	s.xcheckf(err, "tlsrptdb init")
+	err = queue.Init()
+	s.xcheckf(err, "queue init")
+	s.switchStop = store.Switchboard()
+	t.Cleanup(s.stop)
+
+	for _, acc := range opts.Accounts {
+		if acc.Password == "" {
+			continue
+		}
+		a, err := store.OpenAccount(pkglog, acc.Name, false)
+		s.xcheckf(err, "open account %q", acc.Name)
+		err = a.SetPassword(pkglog, acc.Password)
+		s.xcheckf(err, "setting password for account %q", acc.Name)
+		err = a.Close()
+		s.xcheckf(err, "closing account %q", acc.Name)
+	}
+
+	s.SMTPAddr = s.listen(false)
+	s.SubmissionAddr = s.listen(true)
+	return s
+}
+
+func (s *Server) xcheckf(err error, format string, args ...any) {
+	s.t.Helper()
+	if err != nil {
+		s.t.Fatalf("%s: %s", fmt.Sprintf(format, args...), err)
+	}
+}
+
+// listen starts a listener on a random port on localhost, serving SMTP for
+// delivery or submission.
+func (s *Server) listen(submission bool) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	s.xcheckf(err, "listen")
+	s.listeners = append(s.listeners, ln)
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			s.mu.Lock()
+			resolver := s.resolver
+			s.mu.Unlock()
+			s.wg.Add(1)
+			go func() {
+				defer s.wg.Done()
+				smtpserver.ServeConn("local", conn, resolver, submission)
+			}()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+// SetResolver sets the resolver for DNS lookups by connections made after the
+// call, e.g. for SPF, DKIM and DMARC. By default, all lookups fail with "not
+// found". Deliveries are rejected if the domain of the MAIL FROM address has no
+// MX or A/AAAA record.
+func (s *Server) SetResolver(resolver dns.MockResolver) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.resolver = resolver
+}
+
+func (s *Server) stop() {
+	for _, ln := range s.listeners {
+		err := ln.Close()
+		pkglog.Check(err, "closing listener")
+	}
+	s.wg.Wait()
+	s.switchStop()
+	queue.Shutdown()
+	err := tlsrptdb.Close()
+	pkglog.Check(err, "closing tlsrptdb")
+	err = dmarcdb.Close()
+	pkglog.Check(err, "closing dmarcdb")
+	err = store.Close()
+	pkglog.Check(err, "closing store")
+	mox.ShutdownCancel()
+	mox.ContextCancel()
+}
+
+// send connects to addr and delivers msg over SMTP, with authentication if
+// username is set.
+func (s *Server) send(addr, username, password, mailFrom string, rcptTo []string, msg []byte) error {
+	ctx := context.Background()
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("dial: %v", err)
+	}
+	var opts smtpclient.Opts
+	if username != "" {
+		opts.Auth = func(mechanisms []string, cs *tls.ConnectionState) (sasl.Client, error) {
+			return sasl.NewClientPlain(username, password), nil
+		}
+	}
+	ourHostname := dns.Domain{ASCII: "localhost"}
+	c, err := smtpclient.New(ctx, pkglog.Logger, conn, smtpclient.TLSSkip, false, ourHostname, mox.Conf.Static.HostnameDomain, opts)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("smtp handshake: %w", err)
+	}
+	defer func() {
+		err := c.Close()
+		pkglog.Check(err, "closing smtp client")
+	}()
+	resps, err := c.DeliverMultiple(ctx, mailFrom, rcptTo, int64(len(msg)), strings.NewReader(string(msg)), true, true, false)
+	if err != nil {
+		return err
+	}
+	for i, resp := range resps {
+		if resp.Err != nil {
+			return fmt.Errorf("recipient %s: %w", rcptTo[i], resp.Err)
+		}
+	}
+	return nil
+}
+
+// Deliver delivers msg over SMTP from mailFrom to the recipients, as if by a
+// remote mail server. The message must have CRLF line endings. The returned error
+// is from the SMTP transaction, e.g. a smtpclient.Error.
+func (s *Server) Deliver(mailFrom string, rcptTo []string, msg []byte) error {
+	return s.send(s.SMTPAddr, "", "", mailFrom, rcptTo, msg)
+}
+
+// Submit submits msg over SMTP, authenticating with username and password. The
+// message is added to the queue.
+func (s *Server) Submit(username, password, mailFrom string, rcptTo []string, msg []byte) error {
+	return s.send(s.SubmissionAddr, username, password, mailFrom, rcptTo, msg)
+}
+
+// Message is a message in a mailbox, with its contents.
+type Message struct {
+	store.Message
+	Data []byte
+}
+
+// Messages returns the messages in a mailbox of an account, in order of
+// delivery. Failures are fatal to the test.
+func (s *Server) Messages(account, mailbox string) []Message {
+	s.t.Helper()
+
+	acc, err := store.OpenAccount(pkglog, account, false)
+	s.xcheckf(err, "open account")
+	defer func() {
+		err := acc.Close()
+		pkglog.Check(err, "closing account")
+	}()
+
+	var l []Message
+	err = acc.DB.Read(context.Background(), func(tx *bstore.Tx) error {
+		mb, err := acc.MailboxFind(tx, mailbox)
+		if err != nil {
+			return fmt.Errorf("looking up mailbox: %v", err)
+		} else if mb == nil {
+			return fmt.Errorf("mailbox %q not found", mailbox)
+		}
+		q := bstore.QueryTx[store.Message](tx)
+		q.FilterNonzero(store.Message{MailboxID: mb.ID})
+		q.FilterEqual("Expunged", false)
+		q.SortAsc("UID")
+		return q.ForEach(func(m store.Message) error {
+			mr := acc.MessageReader(m)
+			data, err := io.ReadAll(mr)
+			mr.Close()
+			if err != nil {
+				return fmt.Errorf("reading message %d: %v", m.ID, err)
+			}
+			l = append(l, Message{m, data})
+			return nil
+		})
+	})
+	s.xcheckf(err, "listing messages in mailbox %q of account %q", mailbox, account)
+	return l
+}
+
+// Queue returns the messages in the outgoing queue. Failures are fatal to the
+// test.
+func (s *Server) Queue() []queue.Msg {
+	s.t.Helper()
+	l, err := queue.List(context.Background(), queue.Filter{}, queue.Sort{})
+	s.xcheckf(err, "listing queue")
+	return l
+}
@@ -0,0 +1,49 @@
+package moxtest
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/mjl-/mox/dns"
+	"github.com/mjl-/mox/smtp"
+	"github.com/mjl-/mox/smtpclient"
+)
+
+func TestServer(t *testing.T) {
+	s := Start(t, Options{})
+	s.SetResolver(dns.MockResolver{
+		A: map[string][]string{"remote.example.": {"127.0.0.1"}},
+	})
+
+	msg := strings.ReplaceAll(`From: <remote@remote.example>
+To: <mjl@mox.example>
+Subject: test
+
+test email
+`, "\n", "\r\n")
+
+	err := s.Deliver("remote@remote.example", []string{"mjl@mox.example"}, []byte(msg))
+	if err != nil {
+		t.Fatalf("deliver: %v", err)
+	}
+	l := s.Messages("mjl", "Inbox")
+	if len(l) != 1 || !strings.HasSuffix(string(l[0].Data), msg) {
+		t.Fatalf("got messages %v, expected 1 with delivered message", l)
+	}
+
+	var cerr smtpclient.Error
+	err = s.Submit("mjl@mox.example", "bad", "mjl@mox.example", []string{"remote@remote.example"}, []byte(msg))
+	if !errors.As(err, &cerr) || cerr.Code != smtp.C535AuthBadCreds {
+		t.Fatalf("got err %v, expected smtp error for bad credentials", err)
+	}
+
+	err = s.Submit("mjl@mox.example", "testtest", "mjl@mox.example", []string{"remote@remote.example"}, []byte(strings.ReplaceAll(msg, "remote@remote.example", "mjl@mox.example")))
+	if err != nil {
+		t.Fatalf("submit: %v", err)
+	}
+	ql := s.Queue()
+	if len(ql) != 1 || ql[0].Recipient().String() != "remote@remote.example" {
+		t.Fatalf("got queue %v, expected 1 message", ql)
+	}
+}
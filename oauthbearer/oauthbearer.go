@@ -0,0 +1,164 @@
+// Package oauthbearer implements the server side of the OAUTHBEARER (RFC 7628)
+// and XOAUTH2 SASL mechanisms, with verification of OAuth 2.0 bearer tokens.
+//
+// Tokens must be JSON Web Tokens (JWTs), signed by an OpenID Connect issuer. The
+// signing keys are fetched as a JSON Web Key Set (JWKS), at the URL found
+// through the discovery document of the issuer. Tokens must be for the
+// configured audience, have the required scopes and must not be expired. The
+// identity to authenticate as is taken from a claim in the token, typically
+// "email".
+//
+// XOAUTH2 is a non-standard mechanism that predates OAUTHBEARER, but is still
+// commonly used by mail clients.
+package oauthbearer
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrSyntax is returned for malformed SASL messages.
+var ErrSyntax = errors.New("oauthbearer: malformed message")
+
+// ParseOAuthBearer parses the initial client response of OAUTHBEARER, returning
+// the optional authorization identity and the bearer token.
+//
+// Example: "n,a=user@example.org,\x01host=mail.example.org\x01port=993\x01auth=Bearer token\x01\x01".
+func ParseOAuthBearer(buf []byte) (authzid, token string, rerr error) {
+	// ../rfc/7628
+	s := string(buf)
+	gs2, rest, ok := strings.Cut(s, "\x01")
+	if !ok {
+		return "", "", fmt.Errorf("%w: missing separator after gs2 header", ErrSyntax)
+	}
+
+	// We don't support channel binding. The "y" flag indicates the client supports it,
+	// but thinks the server does not, which is correct. ../rfc/7628 ../rfc/5801
+	t := strings.Split(gs2, ",")
+	if len(t) != 3 || t[2] != "" {
+		return "", "", fmt.Errorf("%w: bad gs2 header", ErrSyntax)
+	}
+	if t[0] != "n" && t[0] != "y" {
+		return "", "", fmt.Errorf("%w: channel binding not supported", ErrSyntax)
+	}
+	if t[1] != "" {
+		a, ok := strings.CutPrefix(t[1], "a=")
+		if !ok {
+			return "", "", fmt.Errorf("%w: bad authzid in gs2 header", ErrSyntax)
+		}
+		// ../rfc/5801
+		if strings.Contains(strings.NewReplacer("=2C", "", "=3D", "").Replace(a), "=") {
+			return "", "", fmt.Errorf("%w: bad escape in authzid", ErrSyntax)
+		}
+		authzid = strings.NewReplacer("=2C", ",", "=3D", "=").Replace(a)
+	}
+
+	auth, err := parseKeyValues(rest)
+	if err != nil {
+		return "", "", err
+	}
+	return authzid, auth, nil
+}
+
+// ParseXOAuth2 parses the initial client response of XOAUTH2, returning the user
+// and the bearer token.
+//
+// Example: "user=user@example.org\x01auth=Bearer token\x01\x01".
+//
+// See https://developers.google.com/gmail/imap/xoauth2-protocol.
+func ParseXOAuth2(buf []byte) (user, token string, rerr error) {
+	s := string(buf)
+	first, rest, ok := strings.Cut(s, "\x01")
+	if !ok {
+		return "", "", fmt.Errorf("%w: missing separator after user", ErrSyntax)
+	}
+	user, ok = strings.CutPrefix(first, "user=")
+	if !ok || user == "" {
+		return "", "", fmt.Errorf("%w: missing user", ErrSyntax)
+	}
+	token, err := parseKeyValues(rest)
+	if err != nil {
+		return "", "", err
+	}
+	return user, token, nil
+}
+
+// parseKeyValues parses the key/value pairs of a client response, each ending
+// with \x01, followed by a final \x01, and returns the token from the "auth"
+// pair. Other pairs, such as host and port, are ignored.
+func parseKeyValues(s string) (token string, rerr error) {
+	// ../rfc/7628
+	s, ok := strings.CutSuffix(s, "\x01")
+	if !ok || s != "" && !strings.HasSuffix(s, "\x01") {
+		return "", fmt.Errorf("%w: missing final separator", ErrSyntax)
+	}
+	var auth string
+	var haveAuth bool
+	for _, kv := range strings.Split(strings.TrimSuffix(s, "\x01"), "\x01") {
+		k, v, ok := strings.Cut(kv, "=")
+		if !ok || k == "" {
+			return "", fmt.Errorf("%w: bad key/value pair", ErrSyntax)
+		}
+		for _, c := range k {
+			if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z') {
+				return "", fmt.Errorf("%w: bad key %q", ErrSyntax, k)
+			}
+		}
+		if k == "auth" {
+			if haveAuth {
+				return "", fmt.Errorf("%w: duplicate auth", ErrSyntax)
+			}
+			auth = v
+			haveAuth = true
+		}
+	}
+	if !haveAuth {
+		return "", fmt.Errorf("%w: missing auth", ErrSyntax)
+	}
+
+	// ../rfc/7628 ../rfc/6750
+	scheme, token, ok := strings.Cut(auth, " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", fmt.Errorf("%w: auth must be bearer token", ErrSyntax)
+	}
+	token = strings.TrimLeft(token, " ")
+	if token == "" {
+		return "", fmt.Errorf("%w: empty token", ErrSyntax)
+	}
+	return token, nil
+}
+
+// ErrorChallenge returns the JSON message the server sends to the client as
+// challenge when authentication fails, for OAUTHBEARER, or XOAUTH2 if xoauth2 is
+// set. Err is the error from Verify. The client must respond, with "\x01" for
+// OAUTHBEARER and an empty message for XOAUTH2, after which the server fails the
+// authentication.
+func (v *Verifier) ErrorChallenge(xoauth2 bool, err error) []byte {
+	scope := strings.Join(v.Scopes, " ")
+	var x any
+	if xoauth2 {
+		x = struct {
+			Status  string `json:"status"`
+			Schemes string `json:"schemes"`
+			Scope   string `json:"scope,omitempty"`
+		}{"401", "bearer", scope}
+	} else {
+		// ../rfc/7628
+		status := "invalid_token"
+		if errors.Is(err, ErrInsufficientScope) {
+			status = "insufficient_scope"
+		}
+		x = struct {
+			Status              string `json:"status"`
+			Scope               string `json:"scope,omitempty"`
+			OpenIDConfiguration string `json:"openid-configuration,omitempty"`
+		}{status, scope, v.discoveryURL()}
+	}
+	buf, err := json.Marshal(x)
+	if err != nil {
+		panic(fmt.Sprintf("marshal error challenge: %v", err))
+	}
+	return buf
+}
@@ -0,0 +1,228 @@
+package oauthbearer
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	cryptorand "crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mjl-/mox/mlog"
+)
+
+var ctxbg = context.Background()
+var pkglog = mlog.New("oauthbearer", nil)
+
+func tcheck(t *testing.T, err error, msg string) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("%s: %s", msg, err)
+	}
+}
+
+func TestParse(t *testing.T) {
+	test := func(xoauth2 bool, msg string, expUser, expToken string, expErr error) {
+		t.Helper()
+		var user, token string
+		var err error
+		if xoauth2 {
+			user, token, err = ParseXOAuth2([]byte(msg))
+		} else {
+			user, token, err = ParseOAuthBearer([]byte(msg))
+		}
+		if (err == nil) != (expErr == nil) || err != nil && !errors.Is(err, expErr) {
+			t.Fatalf("got err %v, expected %v", err, expErr)
+		}
+		if user != expUser || token != expToken {
+			t.Fatalf("got user %q, token %q, expected %q, %q", user, token, expUser, expToken)
+		}
+	}
+
+	test(false, "n,a=user@example.org,\x01host=mail.example.org\x01port=993\x01auth=Bearer tok\x01\x01", "user@example.org", "tok", nil)
+	test(false, "n,,\x01auth=bearer tok\x01\x01", "", "tok", nil)
+	test(false, "y,a=a=2Cb=3D,\x01auth=Bearer tok\x01\x01", "a,b=", "tok", nil)
+	test(false, "p=tls-unique,,\x01auth=Bearer tok\x01\x01", "", "", ErrSyntax) // No channel binding.
+	test(false, "n,a=a=2Xb,\x01auth=Bearer tok\x01\x01", "", "", ErrSyntax)     // Bad escape.
+	test(false, "n,,\x01auth=Bearer tok\x01", "", "", ErrSyntax)                // Missing final separator.
+	test(false, "n,,\x01host=x\x01\x01", "", "", ErrSyntax)                     // Missing auth.
+	test(false, "n,,\x01auth=Basic dXNlcg==\x01\x01", "", "", ErrSyntax)        // Not bearer.
+	test(false, "\x01", "", "", ErrSyntax)                                      // Response to error challenge.
+
+	test(true, "user=user@example.org\x01auth=Bearer tok\x01\x01", "user@example.org", "tok", nil)
+	test(true, "auth=Bearer tok\x01\x01", "", "", ErrSyntax)
+	test(true, "user=user@example.org\x01auth=Bearer \x01\x01", "", "", ErrSyntax)
+}
+
+// sign returns a signed JWT with claims.
+func sign(t *testing.T, alg, kid string, key crypto.Signer, claims map[string]any) string {
+	t.Helper()
+	header, err := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	tcheck(t, err, "marshal header")
+	payload, err := json.Marshal(claims)
+	tcheck(t, err, "marshal claims")
+	data := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+
+	var sig []byte
+	switch k := key.(type) {
+	case ed25519.PrivateKey:
+		sig = ed25519.Sign(k, []byte(data))
+	case *rsa.PrivateKey:
+		h := sha256.Sum256([]byte(data))
+		if alg == "PS256" {
+			sig, err = rsa.SignPSS(cryptorand.Reader, k, crypto.SHA256, h[:], &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+		} else {
+			sig, err = rsa.SignPKCS1v15(cryptorand.Reader, k, crypto.SHA256, h[:])
+		}
+		tcheck(t, err, "sign")
+	case *ecdsa.PrivateKey:
+		h := sha256.Sum256([]byte(data))
+		r, s, err := ecdsa.Sign(cryptorand.Reader, k, h[:])
+		tcheck(t, err, "sign")
+		sig = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	}
+	return data + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func TestVerify(t *testing.T) {
+	edkey := ed25519.NewKeyFromSeed(make([]byte, ed25519.SeedSize))
+	rsakey, err := rsa.GenerateKey(cryptorand.Reader, 2048)
+	tcheck(t, err, "generate rsa key")
+	eckey, err := ecdsa.GenerateKey(elliptic.P256(), cryptorand.Reader)
+	tcheck(t, err, "generate ec key")
+	otherkey := ed25519.NewKeyFromSeed(append(make([]byte, ed25519.SeedSize-1), 1))
+
+	b64 := base64.RawURLEncoding.EncodeToString
+	keys := []map[string]string{
+		{"kty": "OKP", "crv": "Ed25519", "kid": "ed", "x": b64(edkey.Public().(ed25519.PublicKey))},
+		{"kty": "RSA", "kid": "rsa", "n": b64(rsakey.N.Bytes()), "e": b64(big.NewInt(int64(rsakey.E)).Bytes())},
+		{"kty": "EC", "crv": "P-256", "kid": "ec", "x": b64(eckey.X.FillBytes(make([]byte, 32))), "y": b64(eckey.Y.FillBytes(make([]byte, 32)))},
+		{"kty": "oct", "kid": "symmetric", "k": "c2VjcmV0"}, // Skipped.
+	}
+	var fetches int
+	var issuer string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{"issuer": issuer, "jwks_uri": issuer + "/jwks"})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		fetches++
+		json.NewEncoder(w).Encode(map[string]any{"keys": keys})
+	})
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+	issuer = ts.URL
+
+	v := &Verifier{
+		Issuer:   issuer,
+		Audience: "mox",
+		Scopes:   []string{"email"},
+	}
+
+	now := time.Now()
+	claims := func() map[string]any {
+		return map[string]any{
+			"iss":   issuer,
+			"aud":   []string{"other", "mox"},
+			"exp":   now.Add(time.Hour).Unix(),
+			"nbf":   now.Unix(),
+			"scope": "openid email",
+			"email": "mjl@mox.example",
+		}
+	}
+
+	test := func(token string, expUser string, expErr error) {
+		t.Helper()
+		user, err := v.Verify(ctxbg, pkglog, token)
+		if (err == nil) != (expErr == nil) || err != nil && !errors.Is(err, expErr) {
+			t.Fatalf("got err %v, expected %v", err, expErr)
+		}
+		if user != expUser {
+			t.Fatalf("got user %q, expected %q", user, expUser)
+		}
+	}
+
+	test(sign(t, "EdDSA", "ed", edkey, claims()), "mjl@mox.example", nil)
+	test(sign(t, "RS256", "rsa", rsakey, claims()), "mjl@mox.example", nil)
+	test(sign(t, "PS256", "rsa", rsakey, claims()), "mjl@mox.example", nil)
+	test(sign(t, "ES256", "ec", eckey, claims()), "mjl@mox.example", nil)
+	test(sign(t, "EdDSA", "", edkey, claims()), "mjl@mox.example", nil) // Without key id.
+	if fetches != 1 {
+		t.Fatalf("got %d key fetches, expected 1", fetches)
+	}
+
+	// Signature by other key, or with key of other type.
+	test(sign(t, "EdDSA", "ed", otherkey, claims()), "", ErrInvalidToken)
+	test(sign(t, "RS256", "ed", rsakey, claims()), "", ErrInvalidToken)
+	test(sign(t, "none", "ed", edkey, claims()), "", ErrInvalidToken)
+
+	// Unknown key id does not cause immediate fetch.
+	test(sign(t, "EdDSA", "unknown", edkey, claims()), "", ErrInvalidToken)
+	if fetches != 1 {
+		t.Fatalf("got %d key fetches, expected 1", fetches)
+	}
+
+	c := claims()
+	c["iss"] = "https://other.example"
+	test(sign(t, "EdDSA", "ed", edkey, c), "", ErrInvalidToken)
+
+	c = claims()
+	c["aud"] = "other"
+	test(sign(t, "EdDSA", "ed", edkey, c), "", ErrInvalidToken)
+
+	c = claims()
+	c["exp"] = now.Add(-2 * time.Minute).Unix()
+	test(sign(t, "EdDSA", "ed", edkey, c), "", ErrInvalidToken)
+	c["exp"] = now.Add(-30 * time.Second).Unix() // Within clock skew.
+	test(sign(t, "EdDSA", "ed", edkey, c), "mjl@mox.example", nil)
+	delete(c, "exp")
+	test(sign(t, "EdDSA", "ed", edkey, c), "", ErrInvalidToken)
+
+	c = claims()
+	c["nbf"] = now.Add(2 * time.Minute).Unix()
+	test(sign(t, "EdDSA", "ed", edkey, c), "", ErrInvalidToken)
+
+	c = claims()
+	c["scope"] = "openid"
+	test(sign(t, "EdDSA", "ed", edkey, c), "", ErrInsufficientScope)
+	delete(c, "scope")
+	c["scp"] = []string{"email"}
+	test(sign(t, "EdDSA", "ed", edkey, c), "mjl@mox.example", nil)
+
+	c = claims()
+	delete(c, "email")
+	c["preferred_username"] = "other@mox.example"
+	test(sign(t, "EdDSA", "ed", edkey, c), "", ErrInvalidToken)
+	v.UsernameClaim = "preferred_username"
+	test(sign(t, "EdDSA", "ed", edkey, c), "other@mox.example", nil)
+
+	test("bogus", "", ErrInvalidToken)
+	test("a.b.c", "", ErrInvalidToken)
+
+	var x map[string]string
+	err = json.Unmarshal(v.ErrorChallenge(false, fmt.Errorf("%w: test", ErrInsufficientScope)), &x)
+	tcheck(t, err, "parse error challenge")
+	if x["status"] != "insufficient_scope" || x["scope"] != "email" || x["openid-configuration"] != issuer+"/.well-known/openid-configuration" {
+		t.Fatalf("unexpected error challenge %v", x)
+	}
+
+	// Verifier with explicit key set url and issuer that is down.
+	v = &Verifier{Issuer: "https://localhost:1", JWKSURL: issuer + "/jwks", Audience: "mox"}
+	c = claims()
+	c["iss"] = v.Issuer
+	test(sign(t, "EdDSA", "ed", edkey, c), "mjl@mox.example", nil)
+	if fetches != 2 {
+		t.Fatalf("got %d key fetches, expected 2", fetches)
+	}
+}
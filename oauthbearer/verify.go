@@ -0,0 +1,450 @@
+package oauthbearer
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mjl-/mox/mlog"
+)
+
+// Errors returned by Verify for tokens that are not valid. Other errors, e.g.
+// for failing to fetch the keys of the issuer, are temporary.
+var (
+	ErrInvalidToken      = errors.New("oauthbearer: invalid token")
+	ErrInsufficientScope = errors.New("oauthbearer: insufficient scope")
+)
+
+// Tokens can be used slightly before and after their validity period, to
+// account for clock skew.
+const clockSkew = time.Minute
+
+// Keys are fetched again after keysMaxAge, or when a token has an unknown key
+// id and the keys were fetched longer than keysMinAge ago.
+const (
+	keysMaxAge = time.Hour
+	keysMinAge = time.Minute
+)
+
+// Verifier verifies bearer tokens issued by an OpenID Connect issuer. Keys of the
+// issuer are fetched when needed and cached. A Verifier can be used
+// concurrently.
+type Verifier struct {
+	Issuer        string       // E.g. https://sso.example.org, must match the "iss" claim.
+	JWKSURL       string       // Optional. If empty, found through discovery document of Issuer.
+	Audience      string       // Must be present in the "aud" claim.
+	Scopes        []string     // Required scopes, from the "scope" or "scp" claim.
+	UsernameClaim string       // Claim with the identity. If empty, "email" is used.
+	HTTPClient    *http.Client // Optional, defaults to http.DefaultClient.
+
+	sync.Mutex
+	keys        []jwk // Parsed keys, with key set.
+	keysFetched time.Time
+}
+
+// jwk is a JSON Web Key. ../rfc/7517
+type jwk struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+
+	// RSA. ../rfc/7518
+	N string `json:"n"`
+	E string `json:"e"`
+
+	// EC and OKP. ../rfc/7518 ../rfc/8037
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+
+	key crypto.PublicKey
+}
+
+func (v *Verifier) discoveryURL() string {
+	return strings.TrimSuffix(v.Issuer, "/") + "/.well-known/openid-configuration"
+}
+
+func (v *Verifier) httpClient() *http.Client {
+	if v.HTTPClient != nil {
+		return v.HTTPClient
+	}
+	return http.DefaultClient
+}
+
+// Verify checks that token is a valid JWT signed by the issuer, for the audience,
+// with the required scopes, and within its validity period. Verify returns the
+// value of the username claim.
+//
+// Errors for tokens that are not valid wrap ErrInvalidToken or
+// ErrInsufficientScope.
+func (v *Verifier) Verify(ctx context.Context, log mlog.Log, token string) (username string, rerr error) {
+	invalid := func(format string, args ...any) (string, error) {
+		return "", fmt.Errorf("%w: %s", ErrInvalidToken, fmt.Sprintf(format, args...))
+	}
+
+	// JWS compact serialization. ../rfc/7515
+	t := strings.Split(token, ".")
+	if len(t) != 3 {
+		return invalid("token must have 3 dot-separated parts, got %d", len(t))
+	}
+	headerBuf, err := base64.RawURLEncoding.DecodeString(t[0])
+	if err != nil {
+		return invalid("decoding header: %v", err)
+	}
+	var header struct {
+		Alg  string   `json:"alg"`
+		Kid  string   `json:"kid"`
+		Crit []string `json:"crit"`
+	}
+	if err := json.Unmarshal(headerBuf, &header); err != nil {
+		return invalid("parsing header: %v", err)
+	}
+	if len(header.Crit) > 0 {
+		// ../rfc/7515
+		return invalid("unsupported critical header parameters %v", header.Crit)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(t[2])
+	if err != nil {
+		return invalid("decoding signature: %v", err)
+	}
+
+	keys, err := v.lookupKeys(ctx, log, header.Kid)
+	if err != nil {
+		return "", err
+	}
+	signed := []byte(t[0] + "." + t[1])
+	var verified bool
+	for _, k := range keys {
+		if k.Alg != "" && k.Alg != header.Alg {
+			continue
+		}
+		if ok, err := verifySignature(header.Alg, k.key, signed, sig); err != nil {
+			return invalid("%v", err)
+		} else if ok {
+			verified = true
+			break
+		}
+	}
+	if !verified {
+		return invalid("signature not valid for keys of issuer")
+	}
+
+	claimsBuf, err := base64.RawURLEncoding.DecodeString(t[1])
+	if err != nil {
+		return invalid("decoding claims: %v", err)
+	}
+	var claims map[string]any
+	if err := json.Unmarshal(claimsBuf, &claims); err != nil {
+		return invalid("parsing claims: %v", err)
+	}
+
+	// ../rfc/7519
+	if iss, _ := claims["iss"].(string); iss != v.Issuer {
+		return invalid("token from issuer %q, expected %q", iss, v.Issuer)
+	}
+
+	// ../rfc/7519
+	var aud []string
+	switch x := claims["aud"].(type) {
+	case string:
+		aud = []string{x}
+	case []any:
+		for _, e := range x {
+			if s, ok := e.(string); ok {
+				aud = append(aud, s)
+			}
+		}
+	}
+	if !slices.Contains(aud, v.Audience) {
+		return invalid("token for audience %v, expected %q", aud, v.Audience)
+	}
+
+	// ../rfc/7519
+	now := time.Now()
+	exp, ok := claims["exp"].(float64)
+	if !ok {
+		return invalid("missing expiration time")
+	} else if expt := time.Unix(int64(exp), 0); now.After(expt.Add(clockSkew)) {
+		return invalid("token expired at %s", expt.UTC().Format(time.RFC3339))
+	}
+	if nbf, ok := claims["nbf"].(float64); ok {
+		if nbft := time.Unix(int64(nbf), 0); now.Before(nbft.Add(-clockSkew)) {
+			return invalid("token not valid before %s", nbft.UTC().Format(time.RFC3339))
+		}
+	}
+
+	// Scopes are typically in "scope", space-separated. ../rfc/8693
+	// Some issuers use "scp", as string or array.
+	var scopes []string
+	for _, k := range []string{"scope", "scp"} {
+		switch x := claims[k].(type) {
+		case string:
+			scopes = append(scopes, strings.Fields(x)...)
+		case []any:
+			for _, e := range x {
+				if s, ok := e.(string); ok {
+					scopes = append(scopes, s)
+				}
+			}
+		}
+	}
+	for _, s := range v.Scopes {
+		if !slices.Contains(scopes, s) {
+			return "", fmt.Errorf("%w: missing scope %q", ErrInsufficientScope, s)
+		}
+	}
+
+	claim := v.UsernameClaim
+	if claim == "" {
+		claim = "email"
+	}
+	username, _ = claims[claim].(string)
+	if username == "" {
+		return invalid("missing username claim %q", claim)
+	}
+	return username, nil
+}
+
+// verifySignature checks the signature of data with key for alg. An error is
+// returned for unsupported algorithms. Keys of a type not matching alg are not
+// valid.
+func verifySignature(alg string, key crypto.PublicKey, data, sig []byte) (bool, error) {
+	// ../rfc/7518
+	var h crypto.Hash
+	switch alg {
+	case "RS256", "PS256", "ES256":
+		h = crypto.SHA256
+	case "RS384", "PS384", "ES384":
+		h = crypto.SHA384
+	case "RS512", "PS512", "ES512":
+		h = crypto.SHA512
+	case "EdDSA":
+		// ../rfc/8037
+		k, ok := key.(ed25519.PublicKey)
+		return ok && ed25519.Verify(k, data, sig), nil
+	default:
+		// Including "none", which we never accept. ../rfc/7518
+		return false, fmt.Errorf("unsupported signature algorithm %q", alg)
+	}
+	hh := h.New()
+	hh.Write(data)
+	digest := hh.Sum(nil)
+
+	switch alg[0] {
+	case 'R':
+		k, ok := key.(*rsa.PublicKey)
+		return ok && rsa.VerifyPKCS1v15(k, h, digest, sig) == nil, nil
+	case 'P':
+		// ../rfc/7518
+		k, ok := key.(*rsa.PublicKey)
+		return ok && rsa.VerifyPSS(k, h, digest, sig, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash}) == nil, nil
+	default:
+		// Signature is concatenation of R and S, each the size of the curve. ../rfc/7518
+		k, ok := key.(*ecdsa.PublicKey)
+		if !ok {
+			return false, nil
+		}
+		size := (k.Curve.Params().BitSize + 7) / 8
+		if alg != map[int]string{32: "ES256", 48: "ES384", 66: "ES512"}[size] || len(sig) != 2*size {
+			return false, nil
+		}
+		r := new(big.Int).SetBytes(sig[:size])
+		s := new(big.Int).SetBytes(sig[size:])
+		return ecdsa.Verify(k, digest, r, s), nil
+	}
+}
+
+// lookupKeys returns the keys that can have been used to sign a token with key
+// id kid, fetching the keys of the issuer if needed. If kid is empty, all keys
+// are returned.
+func (v *Verifier) lookupKeys(ctx context.Context, log mlog.Log, kid string) ([]jwk, error) {
+	v.Lock()
+	defer v.Unlock()
+
+	match := func() []jwk {
+		var l []jwk
+		for _, k := range v.keys {
+			if kid == "" || k.Kid == kid {
+				l = append(l, k)
+			}
+		}
+		return l
+	}
+
+	// Fetch keys if we don't have them yet, if they are old, or if the token has an
+	// unknown key id, e.g. after a key rollover at the issuer. We don't fetch more
+	// often than once a minute, tokens with unknown key ids could be sent by anyone.
+	l := match()
+	age := time.Since(v.keysFetched)
+	if v.keysFetched.IsZero() || age > keysMaxAge || len(l) == 0 && age > keysMinAge {
+		keys, err := v.fetchKeys(ctx, log)
+		if err != nil && len(v.keys) == 0 {
+			return nil, err
+		} else if err != nil {
+			log.Errorx("fetching keys of oauth issuer, continuing with previous keys", err, slog.String("issuer", v.Issuer))
+		} else {
+			v.keys = keys
+		}
+		v.keysFetched = time.Now()
+		l = match()
+	}
+	if len(l) == 0 {
+		return nil, fmt.Errorf("%w: no key with id %q at issuer", ErrInvalidToken, kid)
+	}
+	return l, nil
+}
+
+// fetchKeys fetches the JSON Web Key Set of the issuer, looking up its URL in the
+// discovery document first if needed.
+func (v *Verifier) fetchKeys(ctx context.Context, log mlog.Log) ([]jwk, error) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	jwksURL := v.JWKSURL
+	if jwksURL == "" {
+		// See OpenID Connect Discovery 1.0, section 4.
+		var disco struct {
+			Issuer  string `json:"issuer"`
+			JWKSURI string `json:"jwks_uri"`
+		}
+		if err := v.fetchJSON(ctx, v.discoveryURL(), &disco); err != nil {
+			return nil, fmt.Errorf("fetching openid configuration: %w", err)
+		}
+		if disco.Issuer != v.Issuer {
+			return nil, fmt.Errorf("openid configuration is for issuer %q, expected %q", disco.Issuer, v.Issuer)
+		}
+		if disco.JWKSURI == "" {
+			return nil, fmt.Errorf("openid configuration has no jwks_uri")
+		}
+		jwksURL = disco.JWKSURI
+	}
+
+	// ../rfc/7517
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := v.fetchJSON(ctx, jwksURL, &set); err != nil {
+		return nil, fmt.Errorf("fetching keys: %w", err)
+	}
+	var keys []jwk
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		var err error
+		k.key, err = k.publicKey()
+		if err != nil {
+			// Issuers may have keys of types we don't know, skip them.
+			log.Debugx("skipping key of oauth issuer", err, slog.String("kid", k.Kid))
+			continue
+		}
+		keys = append(keys, k)
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no usable keys at %s", jwksURL)
+	}
+	log.Debug("fetched keys of oauth issuer", slog.String("issuer", v.Issuer), slog.Int("nkeys", len(keys)))
+	return keys, nil
+}
+
+func (v *Verifier) fetchJSON(ctx context.Context, url string, dst any) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return fmt.Errorf("http request: %v", err)
+	}
+	resp, err := v.httpClient().Do(req)
+	if err != nil {
+		return fmt.Errorf("http get: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("http status %s, expected 200 ok", resp.Status)
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1024*1024)).Decode(dst); err != nil {
+		return fmt.Errorf("parsing json: %v", err)
+	}
+	return nil
+}
+
+// publicKey parses the public key of a JWK.
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	b64 := func(s string) (*big.Int, error) {
+		buf, err := base64.RawURLEncoding.DecodeString(s)
+		if err != nil || len(buf) == 0 {
+			return nil, fmt.Errorf("bad base64url value")
+		}
+		return new(big.Int).SetBytes(buf), nil
+	}
+
+	switch k.Kty {
+	case "RSA":
+		n, err := b64(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("rsa modulus: %v", err)
+		}
+		e, err := b64(k.E)
+		if err != nil || !e.IsInt64() || e.Int64() > 1<<31-1 {
+			return nil, fmt.Errorf("bad rsa exponent")
+		}
+		if n.BitLen() < 2048 {
+			return nil, fmt.Errorf("rsa key too small, %d bits", n.BitLen())
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := b64(k.X)
+		if err != nil {
+			return nil, fmt.Errorf("ec x: %v", err)
+		}
+		y, err := b64(k.Y)
+		if err != nil {
+			return nil, fmt.Errorf("ec y: %v", err)
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, fmt.Errorf("ec point not on curve")
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		buf, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil || len(buf) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("bad ed25519 public key")
+		}
+		return ed25519.PublicKey(buf), nil
+
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
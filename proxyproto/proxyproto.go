@@ -0,0 +1,258 @@
+// Package proxyproto implements the receiving side of the HAProxy PROXY protocol,
+// versions 1 (text) and 2 (binary).
+//
+// A TCP load balancer or proxy that does not terminate the application protocol
+// sends a PROXY header at the start of each connection, with the addresses of the
+// original client connection. Servers behind the load balancer can use these
+// addresses instead of the address of the load balancer, e.g. for rate limiting,
+// DNSBL and SPF checks and logging.
+//
+// See https://www.haproxy.org/download/2.9/doc/proxy-protocol.txt.
+package proxyproto
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrHeader is returned for missing or malformed PROXY headers.
+var ErrHeader = errors.New("proxyproto: bad header")
+
+// Signature at the start of a version 2 header.
+var signatureV2 = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+// Header is a parsed PROXY header.
+type Header struct {
+	Version int // 1 or 2.
+
+	// For connections made by the proxy itself, e.g. for health checks, indicated
+	// with command LOCAL in version 2 and protocol UNKNOWN in version 1. Also set
+	// for version 2 headers with address families other than TCP over IPv4/IPv6.
+	// The addresses are not set, the addresses of the connection itself apply.
+	Local bool
+
+	Source      *net.TCPAddr // Original client.
+	Destination *net.TCPAddr // Address the client connected to, at the proxy.
+}
+
+// ReadHeader reads a version 1 or 2 header from r. Data following the header
+// remains in r.
+func ReadHeader(r *bufio.Reader) (Header, error) {
+	buf, err := r.Peek(len(signatureV2))
+	if err != nil && len(buf) < len("PROXY ") {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return Header{}, fmt.Errorf("%w: reading: %v", ErrHeader, err)
+	}
+	if bytes.HasPrefix(buf, []byte("PROXY ")) {
+		return readHeaderV1(r)
+	} else if bytes.Equal(buf, signatureV2) {
+		return readHeaderV2(r)
+	}
+	return Header{}, fmt.Errorf("%w: no proxy header", ErrHeader)
+}
+
+// Example: "PROXY TCP4 192.0.2.1 198.51.100.1 56324 25\r\n".
+func readHeaderV1(r *bufio.Reader) (Header, error) {
+	var line []byte
+	for {
+		buf, err := r.ReadSlice('\n')
+		line = append(line, buf...)
+		// Header is at most 107 bytes, including crlf.
+		if len(line) > 107 {
+			return Header{}, fmt.Errorf("%w: version 1 header too long", ErrHeader)
+		} else if err == bufio.ErrBufferFull {
+			continue
+		} else if err != nil {
+			return Header{}, fmt.Errorf("%w: reading version 1 header: %v", ErrHeader, err)
+		}
+		break
+	}
+	s, ok := strings.CutSuffix(string(line), "\r\n")
+	if !ok {
+		return Header{}, fmt.Errorf("%w: version 1 header must end with crlf", ErrHeader)
+	}
+	t := strings.Split(s, " ")
+	if len(t) >= 2 && t[1] == "UNKNOWN" {
+		// Remainder of the line must be ignored.
+		return Header{Version: 1, Local: true}, nil
+	}
+	if len(t) != 6 || t[1] != "TCP4" && t[1] != "TCP6" {
+		return Header{}, fmt.Errorf("%w: version 1 header must have protocol TCP4 or TCP6 with addresses and ports", ErrHeader)
+	}
+	parseAddr := func(ipstr, portstr string) (*net.TCPAddr, error) {
+		ip := net.ParseIP(ipstr)
+		if ip == nil || strings.Contains(ipstr, ":") != (t[1] == "TCP6") {
+			return nil, fmt.Errorf("%w: bad %s address %q", ErrHeader, t[1], ipstr)
+		}
+		port, err := strconv.ParseUint(portstr, 10, 16)
+		if err != nil || portstr != fmt.Sprintf("%d", port) {
+			return nil, fmt.Errorf("%w: bad port %q", ErrHeader, portstr)
+		}
+		return &net.TCPAddr{IP: ip, Port: int(port)}, nil
+	}
+	src, err := parseAddr(t[2], t[4])
+	if err != nil {
+		return Header{}, err
+	}
+	dst, err := parseAddr(t[3], t[5])
+	if err != nil {
+		return Header{}, err
+	}
+	return Header{Version: 1, Source: src, Destination: dst}, nil
+}
+
+func readHeaderV2(r *bufio.Reader) (Header, error) {
+	var fixed [16]byte
+	if _, err := io.ReadFull(r, fixed[:]); err != nil {
+		return Header{}, fmt.Errorf("%w: reading version 2 header: %v", ErrHeader, err)
+	}
+	if fixed[12]>>4 != 2 {
+		return Header{}, fmt.Errorf("%w: unknown version %d", ErrHeader, fixed[12]>>4)
+	}
+	cmd := fixed[12] & 0x0f
+	if cmd > 1 {
+		return Header{}, fmt.Errorf("%w: unknown command %d", ErrHeader, cmd)
+	}
+	family := fixed[13]
+	size := int(binary.BigEndian.Uint16(fixed[14:]))
+	// Addresses and optional TLVs, which we don't need.
+	data := make([]byte, size)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return Header{}, fmt.Errorf("%w: reading version 2 addresses: %v", ErrHeader, err)
+	}
+
+	// LOCAL, connection by the proxy itself. Address family is ignored.
+	if cmd == 0 {
+		return Header{Version: 2, Local: true}, nil
+	}
+
+	var iplen int
+	switch family {
+	case 0x11: // TCP over IPv4.
+		iplen = net.IPv4len
+	case 0x21: // TCP over IPv6.
+		iplen = net.IPv6len
+	default:
+		// Unspecified, UDP or unix socket, the addresses must be ignored.
+		return Header{Version: 2, Local: true}, nil
+	}
+	if size < 2*iplen+4 {
+		return Header{}, fmt.Errorf("%w: version 2 address block too short", ErrHeader)
+	}
+	src := &net.TCPAddr{
+		IP:   net.IP(slices.Clone(data[:iplen])),
+		Port: int(binary.BigEndian.Uint16(data[2*iplen:])),
+	}
+	dst := &net.TCPAddr{
+		IP:   net.IP(slices.Clone(data[iplen : 2*iplen])),
+		Port: int(binary.BigEndian.Uint16(data[2*iplen+2:])),
+	}
+	return Header{Version: 2, Source: src, Destination: dst}, nil
+}
+
+// Listener wraps a net.Listener. Connections from Networks must start with a
+// PROXY header, connections from other addresses are returned as is, so clients
+// can still connect directly.
+type Listener struct {
+	net.Listener
+	Networks []net.IPNet   // Addresses of proxies.
+	Timeout  time.Duration // For reading the header. No timeout if zero.
+}
+
+// Accept returns the next connection, wrapped in a Conn if it is from a proxy.
+// The header is read on first use of the Conn, so a slow proxy does not block
+// accepting new connections.
+func (l *Listener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	if a, ok := conn.RemoteAddr().(*net.TCPAddr); ok && slices.ContainsFunc(l.Networks, func(ipnet net.IPNet) bool { return ipnet.Contains(a.IP) }) {
+		return &Conn{Conn: conn, timeout: l.Timeout}, nil
+	}
+	return conn, nil
+}
+
+// Conn is a connection from a proxy. The PROXY header is read on the first call
+// to Read, RemoteAddr or LocalAddr, which return the addresses of the original
+// connection. If the header cannot be read, the connection is closed and Read
+// returns the error.
+type Conn struct {
+	net.Conn
+	timeout time.Duration
+
+	once   sync.Once
+	br     *bufio.Reader
+	header Header
+	err    error
+}
+
+func (c *Conn) init() {
+	c.once.Do(func() {
+		c.br = bufio.NewReader(c.Conn)
+		if c.timeout > 0 {
+			c.err = c.Conn.SetReadDeadline(time.Now().Add(c.timeout))
+		}
+		if c.err == nil {
+			c.header, c.err = ReadHeader(c.br)
+		}
+		if c.err == nil && c.timeout > 0 {
+			c.err = c.Conn.SetReadDeadline(time.Time{})
+		}
+		if c.err != nil {
+			c.Conn.Close()
+		}
+	})
+}
+
+// Header returns the PROXY header, reading it if needed.
+func (c *Conn) Header() (Header, error) {
+	c.init()
+	return c.header, c.err
+}
+
+// Read reads data following the PROXY header.
+func (c *Conn) Read(buf []byte) (int, error) {
+	c.init()
+	if c.err != nil {
+		return 0, c.err
+	}
+	return c.br.Read(buf)
+}
+
+// RemoteAddr returns the address of the original client, or of the proxy for
+// LOCAL connections and when the header could not be read.
+func (c *Conn) RemoteAddr() net.Addr {
+	c.init()
+	if c.header.Source != nil {
+		return c.header.Source
+	}
+	return c.Conn.RemoteAddr()
+}
+
+// LocalAddr returns the address the original client connected to, or the local
+// address of the connection from the proxy.
+func (c *Conn) LocalAddr() net.Addr {
+	c.init()
+	if c.header.Destination != nil {
+		return c.header.Destination
+	}
+	return c.Conn.LocalAddr()
+}
+
+// NetConn returns the underlying connection from the proxy.
+func (c *Conn) NetConn() net.Conn {
+	return c.Conn
+}
@@ -0,0 +1,130 @@
+package proxyproto
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadHeader(t *testing.T) {
+	test := func(data string, expHeader Header, expRest string, expErr error) {
+		t.Helper()
+		r := bufio.NewReader(strings.NewReader(data))
+		h, err := ReadHeader(r)
+		if (err == nil) != (expErr == nil) || err != nil && !errors.Is(err, expErr) {
+			t.Fatalf("got err %v, expected %v", err, expErr)
+		}
+		if err != nil {
+			return
+		}
+		if h.Version != expHeader.Version || h.Local != expHeader.Local || h.Source.String() != expHeader.Source.String() || h.Destination.String() != expHeader.Destination.String() {
+			t.Fatalf("got header %#v, expected %#v", h, expHeader)
+		}
+		rest, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatalf("reading rest: %v", err)
+		}
+		if string(rest) != expRest {
+			t.Fatalf("got rest %q, expected %q", rest, expRest)
+		}
+	}
+
+	src4 := &net.TCPAddr{IP: net.ParseIP("192.0.2.1"), Port: 56324}
+	dst4 := &net.TCPAddr{IP: net.ParseIP("198.51.100.1"), Port: 25}
+	src6 := &net.TCPAddr{IP: net.ParseIP("2001:db8::1"), Port: 56324}
+	dst6 := &net.TCPAddr{IP: net.ParseIP("2001:db8::2"), Port: 993}
+
+	// Version 1.
+	test("PROXY TCP4 192.0.2.1 198.51.100.1 56324 25\r\nEHLO x\r\n", Header{Version: 1, Source: src4, Destination: dst4}, "EHLO x\r\n", nil)
+	test("PROXY TCP6 2001:db8::1 2001:db8::2 56324 993\r\n", Header{Version: 1, Source: src6, Destination: dst6}, "", nil)
+	test("PROXY UNKNOWN\r\nx", Header{Version: 1, Local: true}, "x", nil)
+	test("PROXY UNKNOWN ignored 1 2 3\r\n", Header{Version: 1, Local: true}, "", nil)
+	test("PROXY TCP4 2001:db8::1 198.51.100.1 56324 25\r\n", Header{}, "", ErrHeader)
+	test("PROXY TCP6 192.0.2.1 2001:db8::2 56324 25\r\n", Header{}, "", ErrHeader)
+	test("PROXY TCP4 192.0.2.1 198.51.100.1 056324 25\r\n", Header{}, "", ErrHeader)
+	test("PROXY TCP4 192.0.2.1 198.51.100.1 65536 25\r\n", Header{}, "", ErrHeader)
+	test("PROXY TCP4 192.0.2.1 198.51.100.1 56324\r\n", Header{}, "", ErrHeader)
+	test("PROXY TCP4 192.0.2.1 198.51.100.1 56324 25\n", Header{}, "", ErrHeader)
+	test("PROXY UNKNOWN "+strings.Repeat("x", 100)+"\r\n", Header{}, "", ErrHeader)
+	test("PROXY TCP4 192.0.2.1", Header{}, "", ErrHeader)
+
+	// Version 2.
+	v2 := func(verCmd, family byte, addrs ...byte) string {
+		return string(signatureV2) + string([]byte{verCmd, family, 0, byte(len(addrs))}) + string(addrs)
+	}
+	addrs4 := []byte{192, 0, 2, 1, 198, 51, 100, 1, 0xdc, 0x04, 0, 25}
+	test(v2(0x21, 0x11, addrs4...)+"rest", Header{Version: 2, Source: src4, Destination: dst4}, "rest", nil)
+	test(v2(0x21, 0x11, append(addrs4, 0x04, 0, 1, 'x')...), Header{Version: 2, Source: src4, Destination: dst4}, "", nil) // With TLV.
+	addrs6 := append(append([]byte{}, src6.IP...), dst6.IP...)
+	addrs6 = append(addrs6, 0xdc, 0x04, 0x03, 0xe1)
+	test(v2(0x21, 0x21, addrs6...), Header{Version: 2, Source: src6, Destination: dst6}, "", nil)
+	test(v2(0x20, 0x00)+"x", Header{Version: 2, Local: true}, "x", nil)                  // LOCAL.
+	test(v2(0x21, 0x31, make([]byte, 216)...), Header{Version: 2, Local: true}, "", nil) // Unix socket.
+	test(v2(0x21, 0x11, addrs4[:8]...), Header{}, "", ErrHeader)
+	test(v2(0x11, 0x11, addrs4...), Header{}, "", ErrHeader)
+	test(v2(0x22, 0x11, addrs4...), Header{}, "", ErrHeader)
+	test(string(signatureV2)+"\x21\x11\x00\x0c\xc0", Header{}, "", ErrHeader)
+
+	test("EHLO x\r\n", Header{}, "", ErrHeader)
+	test("", Header{}, "", ErrHeader)
+}
+
+func TestListener(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer ln.Close()
+
+	test := func(networks []net.IPNet, data string, expRemote, expRead string) {
+		t.Helper()
+		pln := &Listener{Listener: ln, Networks: networks, Timeout: time.Second}
+
+		errc := make(chan error, 1)
+		go func() {
+			conn, err := net.Dial("tcp", ln.Addr().String())
+			if err == nil {
+				_, err = conn.Write([]byte(data))
+				conn.Close()
+			}
+			errc <- err
+		}()
+
+		conn, err := pln.Accept()
+		if err != nil {
+			t.Fatalf("accept: %v", err)
+		}
+		defer conn.Close()
+		if err := <-errc; err != nil {
+			t.Fatalf("dial and write: %v", err)
+		}
+		remote := conn.RemoteAddr().(*net.TCPAddr).IP.String()
+		if remote != expRemote {
+			t.Fatalf("got remote %s, expected %s", remote, expRemote)
+		}
+		buf, err := io.ReadAll(conn)
+		if expRead == "" {
+			if !errors.Is(err, ErrHeader) {
+				t.Fatalf("got err %v, expected ErrHeader", err)
+			}
+		} else if err != nil {
+			t.Fatalf("read: %v", err)
+		} else if string(buf) != expRead {
+			t.Fatalf("got %q, expected %q", buf, expRead)
+		}
+	}
+
+	local := []net.IPNet{{IP: net.ParseIP("127.0.0.0").To4(), Mask: net.CIDRMask(8, 32)}}
+	other := []net.IPNet{{IP: net.ParseIP("192.0.2.0").To4(), Mask: net.CIDRMask(24, 32)}}
+	header := "PROXY TCP4 192.0.2.1 198.51.100.1 56324 25\r\n"
+
+	test(local, header+"EHLO x\r\n", "192.0.2.1", "EHLO x\r\n")
+	test(local, "PROXY UNKNOWN\r\nx", "127.0.0.1", "x")
+	test(local, "EHLO x\r\n", "127.0.0.1", "")
+	// Not from proxy, header is not parsed.
+	test(other, header, "127.0.0.1", header)
+}
@@ -0,0 +1,407 @@
+package pst
+
+// The lists, tables and properties (LTP) layer: heap-on-node, b-tree-on-heap,
+// property contexts and table contexts. See [MS-PST] section 2.3.
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding/charmap"
+)
+
+// Property types.
+const (
+	ptypInt16    = 0x0002
+	ptypInt32    = 0x0003
+	ptypFloat32  = 0x0004
+	ptypFloat64  = 0x0005
+	ptypCurrency = 0x0006
+	ptypAppTime  = 0x0007
+	ptypErrCode  = 0x000A
+	ptypBoolean  = 0x000B
+	ptypObject   = 0x000D
+	ptypInt64    = 0x0014
+	ptypString8  = 0x001E
+	ptypString   = 0x001F
+	ptypTime     = 0x0040
+	ptypBinary   = 0x0102
+)
+
+// heap is a heap-on-node, with allocations in one or more data blocks.
+type heap struct {
+	n         *node
+	blocks    [][]byte
+	clientSig byte   // 0xBC for property context, 0x7C for table context.
+	userRoot  uint32 // HID of the client root structure.
+}
+
+func (n *node) heap() (*heap, error) {
+	blocks, err := n.f.dataBlocks(n.bidData)
+	if err != nil {
+		return nil, err
+	}
+	if len(blocks) == 0 || len(blocks[0]) < 12 || blocks[0][2] != 0xEC {
+		return nil, fmt.Errorf("%w: bad heap", errCorrupt)
+	}
+	b := blocks[0]
+	return &heap{n, blocks, b[3], binary.LittleEndian.Uint32(b[4:])}, nil
+}
+
+// get returns the heap allocation for hid.
+func (h *heap) get(hid uint32) ([]byte, error) {
+	if hid&0x1f != 0 {
+		return nil, fmt.Errorf("%w: bad heap id %#x", errCorrupt, hid)
+	}
+	index := int(hid>>5) & 0x7ff
+	bi := int(hid >> 16)
+	if bi >= len(h.blocks) {
+		return nil, fmt.Errorf("%w: bad heap id %#x", errCorrupt, hid)
+	}
+	b := h.blocks[bi]
+	if len(b) < 2 {
+		return nil, fmt.Errorf("%w: bad heap block", errCorrupt)
+	}
+	ibHnpm := int(binary.LittleEndian.Uint16(b))
+	if ibHnpm+4 > len(b) {
+		return nil, fmt.Errorf("%w: bad heap page map", errCorrupt)
+	}
+	cAlloc := int(binary.LittleEndian.Uint16(b[ibHnpm:]))
+	o := ibHnpm + 4 + 2*index
+	if index == 0 || index > cAlloc || o+2 > len(b) {
+		return nil, fmt.Errorf("%w: bad heap id %#x", errCorrupt, hid)
+	}
+	start := int(binary.LittleEndian.Uint16(b[o-2:]))
+	end := int(binary.LittleEndian.Uint16(b[o:]))
+	if start > end || end > ibHnpm {
+		return nil, fmt.Errorf("%w: bad heap allocation", errCorrupt)
+	}
+	return b[start:end], nil
+}
+
+// hnidData returns the data for hnid, either from the heap or from a subnode.
+func (h *heap) hnidData(hnid uint32) ([]byte, error) {
+	if hnid == 0 {
+		return nil, nil
+	}
+	if hnid&0x1f == 0 {
+		return h.get(hnid)
+	}
+	sn, err := h.n.subnode(hnid)
+	if err != nil {
+		return nil, err
+	}
+	return sn.f.data(sn.bidData)
+}
+
+// bthRecords returns all leaf records, of key and data, of the b-tree-on-heap with
+// header at hid.
+func (h *heap) bthRecords(hid uint32) (keySize, dataSize int, records [][]byte, rerr error) {
+	hdr, err := h.get(hid)
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	if len(hdr) < 8 || hdr[0] != 0xB5 {
+		return 0, 0, nil, fmt.Errorf("%w: bad b-tree on heap", errCorrupt)
+	}
+	keySize, dataSize = int(hdr[1]), int(hdr[2])
+	levels := int(hdr[3])
+	root := binary.LittleEndian.Uint32(hdr[4:])
+	if keySize == 0 || dataSize == 0 {
+		return 0, 0, nil, fmt.Errorf("%w: bad b-tree on heap", errCorrupt)
+	}
+
+	var walk func(hid uint32, level int) error
+	walk = func(hid uint32, level int) error {
+		buf, err := h.get(hid)
+		if err != nil {
+			return err
+		}
+		size := keySize + dataSize
+		if level > 0 {
+			size = keySize + 4
+		}
+		for ; len(buf) >= size; buf = buf[size:] {
+			if level == 0 {
+				records = append(records, buf[:size])
+			} else if err := walk(binary.LittleEndian.Uint32(buf[keySize:]), level-1); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if root != 0 {
+		if err := walk(root, levels); err != nil {
+			return 0, 0, nil, err
+		}
+	}
+	return keySize, dataSize, records, nil
+}
+
+// prop is a property value, with raw data depending on its type.
+type prop struct {
+	typ   uint16
+	value []byte
+}
+
+// props are properties by property id.
+type props map[uint16]prop
+
+// fixedSize returns the size of values of fixed-size property types, or 0 for
+// variable-size types.
+func fixedSize(typ uint16) int {
+	switch typ {
+	case ptypInt16:
+		return 2
+	case ptypInt32, ptypFloat32, ptypErrCode:
+		return 4
+	case ptypBoolean:
+		return 1
+	case ptypFloat64, ptypCurrency, ptypAppTime, ptypInt64, ptypTime:
+		return 8
+	}
+	return 0
+}
+
+// propContext reads the properties of the property context of node n.
+func (n *node) propContext() (props, error) {
+	h, err := n.heap()
+	if err != nil {
+		return nil, err
+	}
+	if h.clientSig != 0xBC {
+		return nil, fmt.Errorf("%w: not a property context", errCorrupt)
+	}
+	keySize, dataSize, records, err := h.bthRecords(h.userRoot)
+	if err != nil {
+		return nil, err
+	}
+	if keySize != 2 || dataSize != 6 {
+		return nil, fmt.Errorf("%w: bad property context", errCorrupt)
+	}
+	p := props{}
+	for _, r := range records {
+		id := binary.LittleEndian.Uint16(r)
+		typ := binary.LittleEndian.Uint16(r[2:])
+		v := r[4:8]
+		if size := fixedSize(typ); size == 0 || size > 4 {
+			v, err = h.hnidData(binary.LittleEndian.Uint32(v))
+			if err != nil {
+				return nil, fmt.Errorf("reading property %#x: %w", id, err)
+			}
+		} else {
+			v = v[:size]
+		}
+		p[id] = prop{typ, v}
+	}
+	return p, nil
+}
+
+// table is a table context, with rows of properties.
+type table struct {
+	h         *heap
+	cols      []column
+	rows      [][]byte
+	cebOffset int // Offset of cell existence bitmap in rows.
+}
+
+type column struct {
+	id  uint16
+	typ uint16
+	ib  int // Offset in row.
+	cb  int // Size in row.
+	bit int // In cell existence bitmap.
+}
+
+// tableContext reads the table context of node n.
+func (n *node) tableContext() (*table, error) {
+	h, err := n.heap()
+	if err != nil {
+		return nil, err
+	}
+	if h.clientSig != 0x7C {
+		return nil, fmt.Errorf("%w: not a table context", errCorrupt)
+	}
+	info, err := h.get(h.userRoot)
+	if err != nil {
+		return nil, err
+	}
+	if len(info) < 22 || info[0] != 0x7C {
+		return nil, fmt.Errorf("%w: bad table context", errCorrupt)
+	}
+	ncols := int(info[1])
+	rowSize := int(binary.LittleEndian.Uint16(info[8:]))
+	cebOffset := int(binary.LittleEndian.Uint16(info[6:]))
+	hidRowIndex := binary.LittleEndian.Uint32(info[10:])
+	hnidRows := binary.LittleEndian.Uint32(info[14:])
+	if len(info) < 22+8*ncols || rowSize == 0 {
+		return nil, fmt.Errorf("%w: bad table context", errCorrupt)
+	}
+	t := &table{h: h, cebOffset: cebOffset}
+	for i := range ncols {
+		c := info[22+8*i:]
+		col := column{
+			typ: binary.LittleEndian.Uint16(c),
+			id:  binary.LittleEndian.Uint16(c[2:]),
+			ib:  int(binary.LittleEndian.Uint16(c[4:])),
+			cb:  int(c[6]),
+			bit: int(c[7]),
+		}
+		if col.ib+col.cb > cebOffset || cebOffset+col.bit/8 >= rowSize {
+			return nil, fmt.Errorf("%w: bad table column", errCorrupt)
+		}
+		t.cols = append(t.cols, col)
+	}
+
+	// Number of rows is determined by the row index.
+	_, _, records, err := h.bthRecords(hidRowIndex)
+	if err != nil {
+		return nil, fmt.Errorf("reading row index: %w", err)
+	}
+	if len(records) == 0 {
+		return t, nil
+	}
+
+	// Rows are not split over blocks, with padding at the end of each block.
+	var blocks [][]byte
+	if hnidRows&0x1f == 0 {
+		b, err := h.get(hnidRows)
+		if err != nil {
+			return nil, fmt.Errorf("reading rows: %w", err)
+		}
+		blocks = [][]byte{b}
+	} else {
+		sn, err := n.subnode(hnidRows)
+		if err != nil {
+			return nil, fmt.Errorf("reading rows: %w", err)
+		}
+		blocks, err = n.f.dataBlocks(sn.bidData)
+		if err != nil {
+			return nil, fmt.Errorf("reading rows: %w", err)
+		}
+	}
+	for _, b := range blocks {
+		for ; len(b) >= rowSize; b = b[rowSize:] {
+			t.rows = append(t.rows, b[:rowSize])
+		}
+	}
+	if len(t.rows) > len(records) {
+		t.rows = t.rows[:len(records)]
+	}
+	return t, nil
+}
+
+// row returns the properties of row i.
+func (t *table) row(i int) (props, error) {
+	row := t.rows[i]
+	ceb := row[t.cebOffset:]
+	p := props{}
+	for _, c := range t.cols {
+		if ceb[c.bit/8]&(1<<(7-c.bit%8)) == 0 {
+			continue
+		}
+		v := row[c.ib : c.ib+c.cb]
+		if size := fixedSize(c.typ); size == 0 || size > 8 {
+			if len(v) != 4 {
+				return nil, fmt.Errorf("%w: bad table cell", errCorrupt)
+			}
+			var err error
+			v, err = t.h.hnidData(binary.LittleEndian.Uint32(v))
+			if err != nil {
+				return nil, fmt.Errorf("reading cell for property %#x: %w", c.id, err)
+			}
+		} else if len(v) > size {
+			v = v[:size]
+		}
+		p[c.id] = prop{c.typ, v}
+	}
+	return p, nil
+}
+
+// str returns a string property, or the empty string.
+func (p props) str(id uint16) string {
+	v, ok := p[id]
+	if !ok {
+		return ""
+	}
+	switch v.typ {
+	case ptypString:
+		return decodeUTF16(v.value)
+	case ptypString8:
+		return decodeString8(v.value)
+	}
+	return ""
+}
+
+func decodeUTF16(buf []byte) string {
+	u := make([]uint16, len(buf)/2)
+	for i := range u {
+		u[i] = binary.LittleEndian.Uint16(buf[2*i:])
+	}
+	return strings.TrimRight(string(utf16.Decode(u)), "\x00")
+}
+
+// decodeString8 returns an 8-bit string, which is in the codepage of the system
+// that wrote it. We don't know that codepage, but if it isn't valid utf-8, we
+// assume windows-1252.
+func decodeString8(buf []byte) string {
+	s := strings.TrimRight(string(buf), "\x00")
+	if utf8.ValidString(s) {
+		return s
+	}
+	if r, err := charmap.Windows1252.NewDecoder().String(s); err == nil {
+		return r
+	}
+	return s
+}
+
+// int returns an integer property and whether it was present.
+func (p props) int(id uint16) (int64, bool) {
+	v, ok := p[id]
+	if !ok {
+		return 0, false
+	}
+	switch {
+	case v.typ == ptypInt16 && len(v.value) == 2:
+		return int64(int16(binary.LittleEndian.Uint16(v.value))), true
+	case v.typ == ptypInt32 && len(v.value) == 4:
+		return int64(int32(binary.LittleEndian.Uint32(v.value))), true
+	case v.typ == ptypInt64 && len(v.value) == 8:
+		return int64(binary.LittleEndian.Uint64(v.value)), true
+	}
+	return 0, false
+}
+
+func (p props) bool(id uint16) bool {
+	v, ok := p[id]
+	return ok && v.typ == ptypBoolean && len(v.value) > 0 && v.value[0] != 0
+}
+
+// binary returns the bytes of a binary property. String properties are returned
+// as raw bytes, without decoding.
+func (p props) binary(id uint16) []byte {
+	v, ok := p[id]
+	if !ok || (v.typ != ptypBinary && v.typ != ptypString8) {
+		return nil
+	}
+	return v.value
+}
+
+// time returns a time property, or the zero time.
+func (p props) time(id uint16) time.Time {
+	v, ok := p[id]
+	if !ok || v.typ != ptypTime || len(v.value) != 8 {
+		return time.Time{}
+	}
+	// FILETIME, number of 100ns intervals since January 1, 1601 UTC.
+	ft := int64(binary.LittleEndian.Uint64(v.value))
+	if ft <= 0 {
+		return time.Time{}
+	}
+	const epochDiff = 11644473600 // Seconds between 1601 and 1970.
+	return time.Unix(ft/1e7-epochDiff, (ft%1e7)*100)
+}
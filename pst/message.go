@@ -0,0 +1,515 @@
+package pst
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/textproto"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/mjl-/mox/message"
+	"github.com/mjl-/mox/moxio"
+	"github.com/mjl-/mox/smtp"
+	"github.com/mjl-/mox/store"
+)
+
+// Subnodes of a message node.
+const (
+	nidAttachmentTable = 0x671
+	nidRecipientTable  = 0x692
+)
+
+// Message properties.
+const (
+	propSubject               = 0x0037
+	propClientSubmitTime      = 0x0039
+	propSentRepresentingName  = 0x0042
+	propSentRepresentingEmail = 0x0065
+	propTransportHeaders      = 0x007D
+	propRecipientType         = 0x0C15
+	propSenderName            = 0x0C1A
+	propSenderEmail           = 0x0C1F
+	propMessageDeliveryTime   = 0x0E06
+	propMessageFlags          = 0x0E07
+	propBody                  = 0x1000
+	propHTML                  = 0x1013
+	propInternetMessageID     = 0x1035
+	propInternetReferences    = 0x1039
+	propInReplyToID           = 0x1042
+	propLastVerbExecuted      = 0x1081
+	propFlagStatus            = 0x1090
+	propCreationTime          = 0x3007
+	propEmailAddress          = 0x3003
+	propInternetCodepage      = 0x3FDE
+	propSMTPAddress           = 0x39FE
+	propSenderSMTPAddress     = 0x5D01
+	propSentRepresentingSMTP  = 0x5D02
+
+	propAttachDataBinary   = 0x3701
+	propAttachFilename     = 0x3704
+	propAttachMethod       = 0x3705
+	propAttachLongFilename = 0x3707
+	propAttachMimeTag      = 0x370E
+	propAttachContentID    = 0x3712
+	propAttachmentHidden   = 0x7FFE
+)
+
+// Attach methods.
+const (
+	attachByValue     = 1
+	attachEmbeddedMsg = 5
+)
+
+// Maximum depth of messages embedded in messages.
+const maxEmbedDepth = 8
+
+type pstMessage struct {
+	props       props
+	recipients  []props
+	attachments []attachment
+}
+
+type attachment struct {
+	props    props
+	embedded *pstMessage // For attached messages.
+}
+
+// readMessage reads a message with its recipients and attachments from n.
+func readMessage(n *node, depth int) (*pstMessage, error) {
+	p, err := n.propContext()
+	if err != nil {
+		return nil, fmt.Errorf("reading message properties: %w", err)
+	}
+	m := &pstMessage{props: p}
+
+	if sn, err := n.subnode(nidRecipientTable); err != nil && !errors.Is(err, errNoSubnode) {
+		return nil, fmt.Errorf("reading recipients: %w", err)
+	} else if err == nil {
+		t, err := sn.tableContext()
+		if err != nil {
+			return nil, fmt.Errorf("reading recipients: %w", err)
+		}
+		for i := range t.rows {
+			row, err := t.row(i)
+			if err != nil {
+				return nil, fmt.Errorf("reading recipient: %w", err)
+			}
+			m.recipients = append(m.recipients, row)
+		}
+	}
+
+	sn, err := n.subnode(nidAttachmentTable)
+	if errors.Is(err, errNoSubnode) {
+		return m, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("reading attachments: %w", err)
+	}
+	t, err := sn.tableContext()
+	if err != nil {
+		return nil, fmt.Errorf("reading attachments: %w", err)
+	}
+	for i := range t.rows {
+		row, err := t.row(i)
+		if err != nil {
+			return nil, fmt.Errorf("reading attachment: %w", err)
+		}
+		nid, ok := row.int(propLtpRowID)
+		if !ok {
+			continue
+		}
+		an, err := n.subnode(uint32(nid))
+		if err != nil {
+			return nil, fmt.Errorf("reading attachment: %w", err)
+		}
+		ap, err := an.propContext()
+		if err != nil {
+			return nil, fmt.Errorf("reading attachment properties: %w", err)
+		}
+		a := attachment{props: ap}
+		method, _ := ap.int(propAttachMethod)
+		switch method {
+		case attachByValue:
+		case attachEmbeddedMsg:
+			// Object value: node id of subnode with the message, and its size.
+			v, ok := ap[propAttachDataBinary]
+			if !ok || v.typ != ptypObject || len(v.value) != 8 || depth >= maxEmbedDepth {
+				continue
+			}
+			en, err := an.subnode(binary.LittleEndian.Uint32(v.value))
+			if err != nil {
+				return nil, fmt.Errorf("reading attached message: %w", err)
+			}
+			a.embedded, err = readMessage(en, depth+1)
+			if err != nil {
+				return nil, fmt.Errorf("reading attached message: %w", err)
+			}
+		default:
+			// Attachments by reference and OLE objects are skipped.
+			continue
+		}
+		m.attachments = append(m.attachments, a)
+	}
+	return m, nil
+}
+
+// flags returns the IMAP flags for the message.
+func (m *pstMessage) flags() store.Flags {
+	var flags store.Flags
+	mf, _ := m.props.int(propMessageFlags)
+	flags.Seen = mf&0x01 != 0  // mfRead
+	flags.Draft = mf&0x08 != 0 // mfUnsent
+	if status, _ := m.props.int(propFlagStatus); status == 2 {
+		flags.Flagged = true
+	}
+	switch verb, _ := m.props.int(propLastVerbExecuted); verb {
+	case 102, 103: // Reply to sender, reply to all.
+		flags.Answered = true
+	case 104: // Forward.
+		flags.Forwarded = true
+	}
+	return flags
+}
+
+// received returns the time the message was received, falling back to the time it
+// was sent or created. The zero time is returned if none are known.
+func (m *pstMessage) received() time.Time {
+	for _, id := range []uint16{propMessageDeliveryTime, propClientSubmitTime, propCreationTime} {
+		if t := m.props.time(id); !t.IsZero() {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// writeTo writes the message in internet message format.
+func (m *pstMessage) writeTo(w io.Writer) (size int64, rerr error) {
+	xc := message.NewComposer(w, 0, false)
+	defer func() {
+		x := recover()
+		if x == nil {
+			return
+		}
+		if err, ok := x.(error); ok && errors.Is(err, message.ErrCompose) {
+			rerr = err
+			return
+		}
+		panic(x)
+	}()
+	m.compose(xc)
+	xc.Flush()
+	return xc.Size, nil
+}
+
+func (m *pstMessage) compose(xc *message.Composer) {
+	// Messages received over the internet have their original headers. We use those,
+	// except for the MIME headers, since we construct a new MIME structure.
+	if hdrs := m.props.str(propTransportHeaders); strings.TrimSpace(hdrs) != "" {
+		writeTransportHeaders(xc, hdrs)
+	} else {
+		m.composeHeaders(xc)
+	}
+	xc.Header("MIME-Version", "1.0")
+
+	e := m.body(xc)
+	for _, k := range []string{"Content-Type", "Content-Transfer-Encoding"} {
+		if v := e.header.Get(k); v != "" {
+			xc.Header(k, v)
+		}
+	}
+	xc.Line()
+	_, err := xc.Write(e.body)
+	xc.Checkf(err, "writing body")
+}
+
+// writeTransportHeaders writes header fields from hdrs, except fields about the
+// MIME structure.
+func writeTransportHeaders(xc *message.Composer, hdrs string) {
+	hdrs = strings.ReplaceAll(hdrs, "\r\n", "\n")
+	var field []string
+	flush := func() {
+		if len(field) == 0 {
+			return
+		}
+		k := strings.ToLower(strings.TrimSpace(strings.SplitN(field[0], ":", 2)[0]))
+		if !strings.HasPrefix(k, "content-") && k != "mime-version" && strings.Contains(field[0], ":") {
+			_, err := xc.Write([]byte(strings.Join(field, "\r\n") + "\r\n"))
+			xc.Checkf(err, "writing header")
+		}
+		field = nil
+	}
+	for _, line := range strings.Split(hdrs, "\n") {
+		if line == "" {
+			break
+		}
+		if line[0] != ' ' && line[0] != '\t' {
+			flush()
+		}
+		field = append(field, line)
+	}
+	flush()
+}
+
+// composeHeaders writes header fields based on message properties, for messages
+// without transport headers, e.g. drafts and sent messages.
+func (m *pstMessage) composeHeaders(xc *message.Composer) {
+	p := m.props
+	from := nameAddress(p.str(propSentRepresentingName), p.str(propSentRepresentingSMTP), p.str(propSentRepresentingEmail))
+	if from == nil {
+		from = nameAddress(p.str(propSenderName), p.str(propSenderSMTPAddress), p.str(propSenderEmail))
+	}
+	if from != nil {
+		xc.HeaderAddrs("From", []message.NameAddress{*from})
+	}
+
+	var to, cc, bcc []message.NameAddress
+	for _, r := range m.recipients {
+		a := nameAddress(r.str(propDisplayName), r.str(propSMTPAddress), r.str(propEmailAddress))
+		if a == nil {
+			continue
+		}
+		switch typ, _ := r.int(propRecipientType); typ {
+		case 1:
+			to = append(to, *a)
+		case 2:
+			cc = append(cc, *a)
+		case 3:
+			bcc = append(bcc, *a)
+		}
+	}
+	xc.HeaderAddrs("To", to)
+	xc.HeaderAddrs("Cc", cc)
+	xc.HeaderAddrs("Bcc", bcc)
+
+	if s := subject(p.str(propSubject)); s != "" {
+		xc.Subject(s)
+	}
+	if t := p.time(propClientSubmitTime); !t.IsZero() {
+		xc.Header("Date", t.Format(message.RFC5322Z))
+	} else if t := m.received(); !t.IsZero() {
+		xc.Header("Date", t.Format(message.RFC5322Z))
+	}
+	for _, h := range []struct {
+		k  string
+		id uint16
+	}{
+		{"Message-Id", propInternetMessageID},
+		{"In-Reply-To", propInReplyToID},
+		{"References", propInternetReferences},
+	} {
+		if v := strings.TrimSpace(p.str(h.id)); v != "" && isASCII(v) {
+			xc.Header(h.k, v)
+		}
+	}
+}
+
+// nameAddress returns an address for use in a message header, or nil if there is
+// no usable email address. Addresses for Exchange (X500) recipients are only
+// usable if the SMTP address is also present.
+func nameAddress(name, smtpAddr, emailAddr string) *message.NameAddress {
+	s := smtpAddr
+	if s == "" && strings.Contains(emailAddr, "@") {
+		s = emailAddr
+	}
+	addr, err := smtp.ParseAddress(s)
+	if err != nil {
+		return nil
+	}
+	if strings.EqualFold(name, s) {
+		name = ""
+	}
+	return &message.NameAddress{DisplayName: name, Address: addr}
+}
+
+// subject returns a subject without the normalized subject prefix marker.
+func subject(s string) string {
+	if len(s) >= 2 && s[0] == 0x01 {
+		s = s[2:]
+	}
+	return s
+}
+
+// entity is a MIME part with its header and encoded body.
+type entity struct {
+	header textproto.MIMEHeader
+	body   []byte
+}
+
+// body returns the body of the message, with text and/or html and attachments.
+func (m *pstMessage) body(xc *message.Composer) entity {
+	var alternatives []entity
+
+	if text := m.props.str(propBody); text != "" {
+		text = strings.ReplaceAll(text, "\r\n", "\n")
+		body, ct, cte := xc.TextPart("plain", text)
+		alternatives = append(alternatives, entity{mimeHeader("Content-Type", ct, "Content-Transfer-Encoding", cte), body})
+	}
+	if html := m.props.binary(propHTML); len(bytes.TrimSpace(html)) > 0 {
+		charset := "utf-8"
+		if !utf8.Valid(html) {
+			cp, _ := m.props.int(propInternetCodepage)
+			charset = codepageCharset(cp)
+		}
+		var buf bytes.Buffer
+		qpw := quotedprintable.NewWriter(&buf)
+		_, err := qpw.Write(html)
+		xc.Checkf(err, "encoding html")
+		err = qpw.Close()
+		xc.Checkf(err, "encoding html")
+		ct := mime.FormatMediaType("text/html", map[string]string{"charset": charset})
+		alternatives = append(alternatives, entity{mimeHeader("Content-Type", ct, "Content-Transfer-Encoding", "quoted-printable"), buf.Bytes()})
+	}
+
+	var e entity
+	switch len(alternatives) {
+	case 0:
+		body, ct, cte := xc.TextPart("plain", "")
+		e = entity{mimeHeader("Content-Type", ct, "Content-Transfer-Encoding", cte), body}
+	case 1:
+		e = alternatives[0]
+	default:
+		e = multipartEntity(xc, "alternative", alternatives)
+	}
+
+	var attachments []entity
+	for _, a := range m.attachments {
+		attachments = append(attachments, a.entity(xc))
+	}
+	if len(attachments) == 0 {
+		return e
+	}
+	return multipartEntity(xc, "mixed", append([]entity{e}, attachments...))
+}
+
+// entity returns the MIME part for an attachment.
+func (a attachment) entity(xc *message.Composer) entity {
+	p := a.props
+	name := p.str(propAttachLongFilename)
+	if name == "" {
+		name = p.str(propAttachFilename)
+	}
+	if name == "" {
+		name = p.str(propDisplayName)
+	}
+
+	h := textproto.MIMEHeader{}
+	if a.embedded != nil {
+		var buf bytes.Buffer
+		exc := message.NewComposer(&buf, 0, false)
+		a.embedded.compose(exc)
+		exc.Flush()
+		h.Set("Content-Type", "message/rfc822")
+		if !isASCII(buf.String()) {
+			h.Set("Content-Transfer-Encoding", "8bit")
+		}
+		if name != "" {
+			h.Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name}))
+		}
+		return entity{h, buf.Bytes()}
+	}
+
+	ct := strings.ToLower(strings.TrimSpace(p.str(propAttachMimeTag)))
+	if _, _, err := mime.ParseMediaType(ct); ct == "" || err != nil {
+		ct = mime.TypeByExtension(filepath.Ext(name))
+		if ct == "" {
+			ct = "application/octet-stream"
+		}
+	}
+	h.Set("Content-Type", ct)
+	h.Set("Content-Transfer-Encoding", "base64")
+	disp := "attachment"
+	cid := strings.Trim(strings.TrimSpace(p.str(propAttachContentID)), "<>")
+	if cid != "" && isASCII(cid) {
+		h.Set("Content-Id", "<"+cid+">")
+		if p.bool(propAttachmentHidden) {
+			disp = "inline"
+		}
+	}
+	params := map[string]string{}
+	if name != "" {
+		params["filename"] = name
+	}
+	h.Set("Content-Disposition", mime.FormatMediaType(disp, params))
+
+	var buf bytes.Buffer
+	wc := moxio.Base64Writer(&buf)
+	_, err := wc.Write(p.binary(propAttachDataBinary))
+	xc.Checkf(err, "encoding attachment")
+	err = wc.Close()
+	xc.Checkf(err, "encoding attachment")
+	return entity{h, buf.Bytes()}
+}
+
+// multipartEntity returns a multipart entity with parts.
+func multipartEntity(xc *message.Composer, subtype string, parts []entity) entity {
+	var buf bytes.Buffer
+	mp := multipart.NewWriter(&buf)
+	for _, e := range parts {
+		pw, err := mp.CreatePart(e.header)
+		xc.Checkf(err, "adding part")
+		_, err = pw.Write(e.body)
+		xc.Checkf(err, "writing part")
+	}
+	err := mp.Close()
+	xc.Checkf(err, "closing multipart")
+	ct := fmt.Sprintf(`multipart/%s; boundary="%s"`, subtype, mp.Boundary())
+	return entity{mimeHeader("Content-Type", ct), buf.Bytes()}
+}
+
+func mimeHeader(kv ...string) textproto.MIMEHeader {
+	h := textproto.MIMEHeader{}
+	for i := 0; i+1 < len(kv); i += 2 {
+		h.Set(kv[i], kv[i+1])
+	}
+	return h
+}
+
+// codepageCharset returns the MIME charset name for a Windows codepage, for html
+// bodies that are not utf-8.
+func codepageCharset(cp int64) string {
+	switch {
+	case cp >= 1250 && cp <= 1258:
+		return fmt.Sprintf("windows-%d", cp)
+	case cp >= 28591 && cp <= 28605:
+		return fmt.Sprintf("iso-8859-%d", cp-28590)
+	}
+	switch cp {
+	case 20127:
+		return "us-ascii"
+	case 20866:
+		return "koi8-r"
+	case 21866:
+		return "koi8-u"
+	case 932:
+		return "shift_jis"
+	case 936:
+		return "gb2312"
+	case 949:
+		return "ks_c_5601-1987"
+	case 950:
+		return "big5"
+	case 50220:
+		return "iso-2022-jp"
+	case 51932:
+		return "euc-jp"
+	case 54936:
+		return "gb18030"
+	}
+	return "windows-1252"
+}
+
+func isASCII(s string) bool {
+	for _, c := range s {
+		if c >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
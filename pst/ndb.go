@@ -0,0 +1,319 @@
+package pst
+
+// The node database (NDB) layer: header, node and block b-trees, data blocks and
+// subnodes. See [MS-PST] section 2.2.
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+var (
+	ErrFormat      = errors.New("not a pst/ost file")
+	ErrUnsupported = errors.New("unsupported pst/ost file")
+	errCorrupt     = errors.New("corrupt pst/ost file")
+	errNoSubnode   = fmt.Errorf("%w: subnode not found", errCorrupt)
+)
+
+const pageSize = 512
+
+// File is an opened PST or OST file, in either the ANSI or Unicode format.
+type File struct {
+	r       io.ReaderAt
+	unicode bool
+	crypt   byte // 0 for none, 1 for "permute".
+	nbt     bref // Root of node b-tree.
+	bbt     bref // Root of block b-tree.
+}
+
+// Block reference, a block id and an offset in the file.
+type bref struct {
+	bid uint64
+	ib  uint64
+}
+
+// Open parses the header of a PST/OST file.
+func Open(r io.ReaderAt) (*File, error) {
+	buf := make([]byte, 564)
+	if _, err := r.ReadAt(buf, 0); err != nil {
+		return nil, fmt.Errorf("%w: reading header: %v", ErrFormat, err)
+	}
+	if string(buf[:4]) != "!BDN" {
+		return nil, fmt.Errorf("%w: bad magic", ErrFormat)
+	}
+	f := &File{r: r}
+	switch ver := binary.LittleEndian.Uint16(buf[10:]); ver {
+	case 14, 15:
+		f.nbt = bref{uint64(binary.LittleEndian.Uint32(buf[184:])), uint64(binary.LittleEndian.Uint32(buf[188:]))}
+		f.bbt = bref{uint64(binary.LittleEndian.Uint32(buf[192:])), uint64(binary.LittleEndian.Uint32(buf[196:]))}
+		f.crypt = buf[461]
+	case 23:
+		f.unicode = true
+		f.nbt = bref{binary.LittleEndian.Uint64(buf[216:]), binary.LittleEndian.Uint64(buf[224:])}
+		f.bbt = bref{binary.LittleEndian.Uint64(buf[232:]), binary.LittleEndian.Uint64(buf[240:])}
+		f.crypt = buf[513]
+	case 36:
+		return nil, fmt.Errorf("%w: unicode format with 4k pages", ErrUnsupported)
+	default:
+		return nil, fmt.Errorf("%w: unknown version %d", ErrUnsupported, ver)
+	}
+	switch f.crypt {
+	case 0, 1:
+	case 2:
+		return nil, fmt.Errorf("%w: cyclic encryption", ErrUnsupported)
+	default:
+		return nil, fmt.Errorf("%w: unknown encryption %d", ErrUnsupported, f.crypt)
+	}
+	return f, nil
+}
+
+// uint returns the little-endian integer of 8 bytes for unicode files, or 4
+// bytes for ansi files, and the remaining buffer.
+func (f *File) uint(buf []byte) (uint64, []byte) {
+	if f.unicode {
+		return binary.LittleEndian.Uint64(buf), buf[8:]
+	}
+	return uint64(binary.LittleEndian.Uint32(buf)), buf[4:]
+}
+
+func (f *File) uintSize() int {
+	if f.unicode {
+		return 8
+	}
+	return 4
+}
+
+// btLookup finds key in the b-tree (node or block) starting at root, returning
+// the leaf entry. Block ids are compared without their lowest bit, which is
+// reserved.
+func (f *File) btLookup(root bref, key uint64, ptype byte) ([]byte, error) {
+	page := make([]byte, pageSize)
+	ref := root
+	for depth := 0; ; depth++ {
+		if depth > 16 {
+			return nil, fmt.Errorf("%w: b-tree too deep", errCorrupt)
+		}
+		if _, err := f.r.ReadAt(page, int64(ref.ib)); err != nil {
+			return nil, fmt.Errorf("reading b-tree page: %v", err)
+		}
+		// Entries are followed by their counts, sizes and the page trailer.
+		o := 496
+		if f.unicode {
+			o = 488
+		}
+		cEnt, cbEnt, cLevel := int(page[o]), int(page[o+2]), int(page[o+3])
+		pt := page[o+4]
+		if f.unicode {
+			pt = page[o+8]
+		}
+		if pt != ptype || cbEnt == 0 || cEnt*cbEnt > o {
+			return nil, fmt.Errorf("%w: bad b-tree page", errCorrupt)
+		}
+		var next *bref
+		for i := range cEnt {
+			e := page[i*cbEnt : (i+1)*cbEnt]
+			k, rest := f.uint(e)
+			if cLevel == 0 {
+				if k&^1 == key&^1 {
+					return e, nil
+				}
+				continue
+			}
+			if k&^1 > key&^1 {
+				break
+			}
+			bid, rest := f.uint(rest)
+			ib, _ := f.uint(rest)
+			next = &bref{bid, ib}
+		}
+		if cLevel == 0 || next == nil {
+			return nil, fmt.Errorf("%w: key %#x not found in b-tree", errCorrupt, key)
+		}
+		ref = *next
+	}
+}
+
+// block reads the block with id bid, decrypting it if needed.
+func (f *File) block(bid uint64) ([]byte, error) {
+	e, err := f.btLookup(f.bbt, bid, 0x80)
+	if err != nil {
+		return nil, fmt.Errorf("looking up block: %w", err)
+	}
+	_, rest := f.uint(e)
+	ib, rest := f.uint(rest)
+	cb := binary.LittleEndian.Uint16(rest)
+	buf := make([]byte, cb)
+	if _, err := f.r.ReadAt(buf, int64(ib)); err != nil {
+		return nil, fmt.Errorf("reading block: %v", err)
+	}
+	// Internal blocks (bit 1 set) are never encrypted.
+	if bid&2 == 0 && f.crypt == 1 {
+		for i, c := range buf {
+			buf[i] = permuteDecrypt[c]
+		}
+	}
+	return buf, nil
+}
+
+// dataBlocks returns the data blocks of a node with data block id bid. For
+// large nodes, the data is spread over multiple blocks, referenced from an
+// XBLOCK or XXBLOCK.
+func (f *File) dataBlocks(bid uint64) ([][]byte, error) {
+	if bid == 0 {
+		return nil, nil
+	}
+	buf, err := f.block(bid)
+	if err != nil {
+		return nil, err
+	}
+	if bid&2 == 0 {
+		return [][]byte{buf}, nil
+	}
+	// XBLOCK (level 1) or XXBLOCK (level 2).
+	if len(buf) < 8 || buf[0] != 1 || buf[1] < 1 || buf[1] > 2 {
+		return nil, fmt.Errorf("%w: bad data tree block", errCorrupt)
+	}
+	level := buf[1]
+	n := int(binary.LittleEndian.Uint16(buf[2:]))
+	bids := buf[8:]
+	if n*f.uintSize() > len(bids) {
+		return nil, fmt.Errorf("%w: bad data tree block", errCorrupt)
+	}
+	var l [][]byte
+	for range n {
+		var xbid uint64
+		xbid, bids = f.uint(bids)
+		if level == 2 && xbid&2 == 0 {
+			return nil, fmt.Errorf("%w: bad data tree block", errCorrupt)
+		}
+		xl, err := f.dataBlocks(xbid)
+		if err != nil {
+			return nil, err
+		}
+		l = append(l, xl...)
+	}
+	return l, nil
+}
+
+// data returns the concatenated data blocks of a node.
+func (f *File) data(bid uint64) ([]byte, error) {
+	l, err := f.dataBlocks(bid)
+	if err != nil {
+		return nil, err
+	}
+	var buf []byte
+	for _, b := range l {
+		buf = append(buf, b...)
+	}
+	return buf, nil
+}
+
+// node is a top-level node from the node b-tree, or a subnode of another node.
+type node struct {
+	f       *File
+	nid     uint32
+	bidData uint64
+	bidSub  uint64
+	subs    map[uint32]node // Lazily initialized.
+}
+
+// node looks up a top-level node in the node b-tree.
+func (f *File) node(nid uint32) (*node, error) {
+	e, err := f.btLookup(f.nbt, uint64(nid), 0x81)
+	if err != nil {
+		return nil, fmt.Errorf("looking up node %#x: %w", nid, err)
+	}
+	_, rest := f.uint(e)
+	bidData, rest := f.uint(rest)
+	bidSub, _ := f.uint(rest)
+	return &node{f: f, nid: nid, bidData: bidData, bidSub: bidSub}, nil
+}
+
+// subnode returns subnode nid of n.
+func (n *node) subnode(nid uint32) (*node, error) {
+	if n.subs == nil {
+		n.subs = map[uint32]node{}
+		if err := n.f.readSubnodes(n.bidSub, n.subs); err != nil {
+			return nil, fmt.Errorf("reading subnodes: %w", err)
+		}
+	}
+	sn, ok := n.subs[nid]
+	if !ok {
+		return nil, fmt.Errorf("%w: %#x", errNoSubnode, nid)
+	}
+	return &sn, nil
+}
+
+// readSubnodes reads the subnode tree starting at SLBLOCK or SIBLOCK bid into
+// subs.
+func (f *File) readSubnodes(bid uint64, subs map[uint32]node) error {
+	if bid == 0 {
+		return nil
+	}
+	buf, err := f.block(bid)
+	if err != nil {
+		return err
+	}
+	if len(buf) < 8 || buf[0] != 2 || buf[1] > 1 {
+		return fmt.Errorf("%w: bad subnode block", errCorrupt)
+	}
+	level := buf[1]
+	n := int(binary.LittleEndian.Uint16(buf[2:]))
+	entries := buf[4:]
+	if f.unicode {
+		entries = buf[8:]
+	}
+	esize := 3 * f.uintSize()
+	if level == 1 {
+		esize = 2 * f.uintSize()
+	}
+	if n*esize > len(entries) {
+		return fmt.Errorf("%w: bad subnode block", errCorrupt)
+	}
+	for i := range n {
+		e := entries[i*esize:]
+		nid, e := f.uint(e)
+		if level == 1 {
+			sibid, _ := f.uint(e)
+			if err := f.readSubnodes(sibid, subs); err != nil {
+				return err
+			}
+			continue
+		}
+		bidData, e := f.uint(e)
+		bidSub, _ := f.uint(e)
+		subs[uint32(nid)] = node{f: f, nid: uint32(nid), bidData: bidData, bidSub: bidSub}
+	}
+	return nil
+}
+
+// permuteEncrypt is the table for "permute" encryption, mpbbR in [MS-PST]
+// 5.1. Decryption uses its inverse.
+var permuteEncrypt = [256]byte{
+	65, 54, 19, 98, 168, 33, 110, 187, 244, 22, 204, 4, 127, 100, 232, 93,
+	30, 242, 203, 42, 116, 197, 94, 53, 210, 149, 71, 158, 150, 45, 154, 136,
+	76, 125, 132, 63, 219, 172, 49, 182, 72, 95, 246, 196, 216, 57, 139, 231,
+	35, 59, 56, 142, 200, 193, 223, 37, 177, 32, 165, 70, 96, 78, 156, 251,
+	170, 211, 86, 81, 69, 124, 85, 0, 7, 201, 43, 157, 133, 155, 9, 160,
+	143, 173, 179, 15, 99, 171, 137, 75, 215, 167, 21, 90, 113, 102, 66, 191,
+	38, 74, 107, 152, 250, 234, 119, 83, 178, 112, 5, 44, 253, 89, 58, 134,
+	126, 206, 6, 235, 130, 120, 87, 199, 141, 67, 175, 180, 28, 212, 91, 205,
+	226, 233, 39, 79, 195, 8, 114, 128, 207, 176, 239, 245, 40, 109, 190, 48,
+	77, 52, 146, 213, 14, 60, 34, 50, 229, 228, 249, 159, 194, 209, 10, 129,
+	18, 225, 238, 145, 131, 118, 227, 151, 230, 97, 138, 23, 121, 164, 183, 220,
+	144, 122, 92, 140, 2, 166, 202, 105, 222, 80, 26, 17, 147, 185, 82, 135,
+	88, 252, 237, 29, 55, 73, 27, 106, 224, 41, 51, 153, 189, 108, 217, 148,
+	243, 64, 84, 111, 240, 198, 115, 184, 214, 62, 101, 24, 68, 31, 221, 103,
+	16, 241, 12, 25, 236, 174, 3, 161, 20, 123, 169, 11, 255, 248, 163, 192,
+	162, 1, 247, 46, 188, 36, 104, 117, 13, 254, 186, 47, 181, 208, 218, 61,
+}
+
+var permuteDecrypt [256]byte
+
+func init() {
+	for i, c := range permuteEncrypt {
+		permuteDecrypt[c] = byte(i)
+	}
+}
@@ -0,0 +1,543 @@
+package pst
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf16"
+
+	"github.com/mjl-/mox/message"
+	"github.com/mjl-/mox/mlog"
+	"github.com/mjl-/mox/store"
+)
+
+var pkglog = mlog.New("pst", nil)
+
+func tcheck(t *testing.T, err error, msg string) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("%s: %s", msg, err)
+	}
+}
+
+// pstWriter writes a minimal unicode PST file with "permute" encryption, for
+// testing. The file testdata/importtest.pst was written by TestReader with
+// makeTestPST, with environment variable MOX_WRITE_TESTPST set.
+type pstWriter struct {
+	buf     []byte
+	nbt     []nbtEntry
+	bbt     []bbtEntry
+	nextBid uint64
+}
+
+type nbtEntry struct {
+	nid             uint32
+	bidData, bidSub uint64
+}
+
+type bbtEntry struct {
+	bid, ib uint64
+	cb      int
+}
+
+type subEntry struct {
+	nid             uint32
+	bidData, bidSub uint64
+}
+
+type tprop struct {
+	id, typ uint16
+	value   []byte
+}
+
+func (w *pstWriter) block(data []byte, internal bool) uint64 {
+	w.nextBid += 4
+	bid := w.nextBid
+	if internal {
+		bid |= 2
+	} else {
+		data = slices.Clone(data)
+		for i, c := range data {
+			data[i] = permuteEncrypt[c]
+		}
+	}
+	ib := uint64(len(w.buf))
+	w.buf = append(w.buf, data...)
+	for len(w.buf)%64 != 0 {
+		w.buf = append(w.buf, 0)
+	}
+	w.bbt = append(w.bbt, bbtEntry{bid, ib, len(data)})
+	return bid
+}
+
+func (w *pstWriter) node(nid uint32, data []byte, bidSub uint64) {
+	w.nbt = append(w.nbt, nbtEntry{nid, w.block(data, false), bidSub})
+}
+
+// subnodes writes an SLBLOCK.
+func (w *pstWriter) subnodes(l []subEntry) uint64 {
+	slices.SortFunc(l, func(a, b subEntry) int { return int(a.nid) - int(b.nid) })
+	b := []byte{2, 0, byte(len(l)), byte(len(l) >> 8), 0, 0, 0, 0}
+	for _, e := range l {
+		b = binary.LittleEndian.AppendUint64(b, uint64(e.nid))
+		b = binary.LittleEndian.AppendUint64(b, e.bidData)
+		b = binary.LittleEndian.AppendUint64(b, e.bidSub)
+	}
+	return w.block(b, true)
+}
+
+// btree writes leaf pages with entries, and an intermediate page if needed,
+// returning the root.
+func (w *pstWriter) btree(ptype byte, keys []uint64, entries [][]byte) bref {
+	page := func(level int, keys []uint64, entries [][]byte) (uint64, bref) {
+		p := make([]byte, pageSize)
+		for i, e := range entries {
+			copy(p[i*len(e):], e)
+		}
+		p[488] = byte(len(entries))
+		p[489] = byte(488 / len(entries[0]))
+		p[490] = byte(len(entries[0]))
+		p[491] = byte(level)
+		p[496] = ptype
+		p[497] = ptype
+		w.nextBid += 4
+		ib := uint64(len(w.buf))
+		w.buf = append(w.buf, p...)
+		return keys[0], bref{w.nextBid, ib}
+	}
+	max := 488 / len(entries[0])
+	var keys1 []uint64
+	var entries1 [][]byte
+	var ref bref
+	for i := 0; i < len(entries); i += max {
+		e := min(i+max, len(entries))
+		var k uint64
+		k, ref = page(0, keys[i:e], entries[i:e])
+		keys1 = append(keys1, k)
+		entries1 = append(entries1, binary.LittleEndian.AppendUint64(binary.LittleEndian.AppendUint64(binary.LittleEndian.AppendUint64(nil, k), ref.bid), ref.ib))
+	}
+	if len(entries1) > 1 {
+		_, ref = page(1, keys1, entries1)
+	}
+	return ref
+}
+
+// finish writes the b-trees and the header.
+func (w *pstWriter) finish() []byte {
+	slices.SortFunc(w.nbt, func(a, b nbtEntry) int { return int(a.nid) - int(b.nid) })
+	var keys []uint64
+	var entries [][]byte
+	for _, e := range w.nbt {
+		b := binary.LittleEndian.AppendUint64(nil, uint64(e.nid))
+		b = binary.LittleEndian.AppendUint64(b, e.bidData)
+		b = binary.LittleEndian.AppendUint64(b, e.bidSub)
+		b = append(b, make([]byte, 8)...)
+		keys = append(keys, uint64(e.nid))
+		entries = append(entries, b)
+	}
+	nbt := w.btree(0x81, keys, entries)
+
+	// Block ids increase, the b-tree pages don't have to be in the block b-tree.
+	keys, entries = nil, nil
+	for _, e := range w.bbt {
+		b := binary.LittleEndian.AppendUint64(nil, e.bid)
+		b = binary.LittleEndian.AppendUint64(b, e.ib)
+		b = binary.LittleEndian.AppendUint16(b, uint16(e.cb))
+		b = append(b, 1, 0, 0, 0, 0, 0)
+		keys = append(keys, e.bid)
+		entries = append(entries, b)
+	}
+	bbt := w.btree(0x80, keys, entries)
+
+	h := w.buf[:564]
+	copy(h, "!BDN")
+	copy(h[8:], "SM")
+	binary.LittleEndian.PutUint16(h[10:], 23)
+	binary.LittleEndian.PutUint64(h[216:], nbt.bid)
+	binary.LittleEndian.PutUint64(h[224:], nbt.ib)
+	binary.LittleEndian.PutUint64(h[232:], bbt.bid)
+	binary.LittleEndian.PutUint64(h[240:], bbt.ib)
+	h[513] = 1
+	return w.buf
+}
+
+// heapBlock returns a heap-on-node with items, the user root being item root
+// (1-based).
+func heapBlock(clientSig byte, items [][]byte, root int) []byte {
+	b := make([]byte, 12)
+	offsets := []uint16{12}
+	for _, item := range items {
+		b = append(b, item...)
+		offsets = append(offsets, uint16(len(b)))
+	}
+	if len(b)%2 != 0 {
+		b = append(b, 0)
+	}
+	binary.LittleEndian.PutUint16(b, uint16(len(b)))
+	b[2] = 0xEC
+	b[3] = clientSig
+	binary.LittleEndian.PutUint32(b[4:], hid(root))
+	b = binary.LittleEndian.AppendUint16(b, uint16(len(items)))
+	b = binary.LittleEndian.AppendUint16(b, 0)
+	for _, o := range offsets {
+		b = binary.LittleEndian.AppendUint16(b, o)
+	}
+	return b
+}
+
+func hid(index int) uint32 {
+	return uint32(index) << 5
+}
+
+// pcBlock returns a property context.
+func pcBlock(props []tprop) []byte {
+	slices.SortFunc(props, func(a, b tprop) int { return int(a.id) - int(b.id) })
+	items := [][]byte{{0xB5, 2, 6, 0, 0, 0, 0, 0}, nil}
+	binary.LittleEndian.PutUint32(items[0][4:], hid(2))
+	for _, p := range props {
+		rec := binary.LittleEndian.AppendUint16(nil, p.id)
+		rec = binary.LittleEndian.AppendUint16(rec, p.typ)
+		if size := fixedSize(p.typ); size > 0 && size <= 4 {
+			rec = append(rec, append(slices.Clone(p.value), make([]byte, 4-size)...)...)
+		} else {
+			items = append(items, p.value)
+			rec = binary.LittleEndian.AppendUint32(rec, hid(len(items)))
+		}
+		items[1] = append(items[1], rec...)
+	}
+	return heapBlock(0xBC, items, 1)
+}
+
+// tcBlock returns a table context, with only 4- and 8-byte columns.
+func tcBlock(cols []tprop, rows [][]tprop) []byte {
+	// Column values: 8-byte fixed values first, then 4-byte values, including
+	// references to heap items.
+	slices.SortStableFunc(cols, func(a, b tprop) int { return tcellSize(b.typ) - tcellSize(a.typ) })
+	var offsets []int
+	o := 0
+	for _, c := range cols {
+		offsets = append(offsets, o)
+		o += tcellSize(c.typ)
+	}
+	ceb := o
+	rowSize := ceb + (len(cols)+7)/8
+
+	items := [][]byte{nil, {0xB5, 4, 4, 0, 0, 0, 0, 0}, nil, nil}
+	if len(rows) > 0 {
+		binary.LittleEndian.PutUint32(items[1][4:], hid(3))
+	}
+	for i, r := range rows {
+		items[2] = binary.LittleEndian.AppendUint32(items[2], uint32(i+1))
+		items[2] = binary.LittleEndian.AppendUint32(items[2], uint32(i))
+		row := make([]byte, rowSize)
+		for _, p := range r {
+			ci := slices.IndexFunc(cols, func(c tprop) bool { return c.id == p.id })
+			if fixedSize(p.typ) > 0 {
+				copy(row[offsets[ci]:], p.value)
+			} else {
+				items = append(items, p.value)
+				binary.LittleEndian.PutUint32(row[offsets[ci]:], hid(len(items)))
+			}
+			row[ceb+ci/8] |= 1 << (7 - ci%8)
+		}
+		items[3] = append(items[3], row...)
+	}
+
+	info := []byte{0x7C, byte(len(cols))}
+	for range 3 {
+		info = binary.LittleEndian.AppendUint16(info, uint16(ceb))
+	}
+	info = binary.LittleEndian.AppendUint16(info, uint16(rowSize))
+	info = binary.LittleEndian.AppendUint32(info, hid(2))
+	if len(rows) > 0 {
+		info = binary.LittleEndian.AppendUint32(info, hid(4))
+	} else {
+		info = binary.LittleEndian.AppendUint32(info, 0)
+	}
+	info = binary.LittleEndian.AppendUint32(info, 0)
+	for i, c := range cols {
+		info = binary.LittleEndian.AppendUint16(info, c.typ)
+		info = binary.LittleEndian.AppendUint16(info, c.id)
+		info = binary.LittleEndian.AppendUint16(info, uint16(offsets[i]))
+		info = append(info, byte(tcellSize(c.typ)), byte(i))
+	}
+	items[0] = info
+	if len(rows) == 0 {
+		items = items[:2]
+	}
+	return heapBlock(0x7C, items, 1)
+}
+
+func tcellSize(typ uint16) int {
+	if fixedSize(typ) == 8 {
+		return 8
+	}
+	return 4
+}
+
+func pstr(id uint16, s string) tprop {
+	var b []byte
+	for _, c := range utf16.Encode([]rune(s)) {
+		b = binary.LittleEndian.AppendUint16(b, c)
+	}
+	return tprop{id, ptypString, b}
+}
+
+func pint(id uint16, v int32) tprop {
+	return tprop{id, ptypInt32, binary.LittleEndian.AppendUint32(nil, uint32(v))}
+}
+
+func pbin(id uint16, b []byte) tprop {
+	return tprop{id, ptypBinary, b}
+}
+
+func ptime(id uint16, tm time.Time) tprop {
+	ft := (tm.Unix()+11644473600)*1e7 + int64(tm.Nanosecond()/100)
+	return tprop{id, ptypTime, binary.LittleEndian.AppendUint64(nil, uint64(ft))}
+}
+
+var testTime = time.Date(2024, 3, 1, 12, 30, 0, 0, time.UTC)
+
+// makeTestPST returns a pst file with mail folders Inbox and "Archive/2020" with
+// subfolder "Old", and a contacts folder. Inbox has two messages, Old has one
+// with an attached message.
+func makeTestPST() []byte {
+	w := &pstWriter{buf: make([]byte, 1024)}
+
+	folder := func(nid uint32, name, class string, subfolders []uint32, messages []uint32) {
+		props := []tprop{pstr(propDisplayName, name)}
+		if class != "" {
+			props = append(props, pstr(propContainerClass, class))
+		}
+		w.node(nid, pcBlock(props), 0)
+		cols := []tprop{{id: propLtpRowID, typ: ptypInt32}}
+		var rows [][]tprop
+		for _, n := range subfolders {
+			rows = append(rows, []tprop{pint(propLtpRowID, int32(n))})
+		}
+		w.node(nid&^0x1f|nidTypeHierarchyTable, tcBlock(cols, rows), 0)
+		rows = nil
+		for _, n := range messages {
+			rows = append(rows, []tprop{pint(propLtpRowID, int32(n))})
+		}
+		w.node(nid&^0x1f|nidTypeContentsTable, tcBlock(cols, rows), 0)
+	}
+
+	eid := make([]byte, 24)
+	binary.LittleEndian.PutUint32(eid[20:], 0x8022)
+	w.node(nidMessageStore, pcBlock([]tprop{pbin(propIPMSubtreeEntryID, eid), pstr(propDisplayName, "Personal Folders")}), 0)
+	folder(0x8022, "Top of Personal Folders", "", []uint32{0x8042, 0x8062, 0x8082}, nil)
+	folder(0x8042, "Inbox", "IPF.Note", nil, []uint32{0x200024, 0x200044})
+	folder(0x8062, "Contacts", "IPF.Contact", nil, []uint32{0x200084})
+	folder(0x8082, "Archive/2020", "IPF.Note", []uint32{0x80A2}, nil)
+	folder(0x80A2, "Old", "", nil, []uint32{0x200064})
+
+	attachTable := func(nids ...uint32) []byte {
+		var rows [][]tprop
+		for _, nid := range nids {
+			rows = append(rows, []tprop{pint(propLtpRowID, int32(nid))})
+		}
+		return tcBlock([]tprop{{id: propLtpRowID, typ: ptypInt32}}, rows)
+	}
+
+	// Received message with transport headers, text and html body, and an attachment.
+	attach := pcBlock([]tprop{
+		pint(propAttachMethod, attachByValue),
+		pstr(propAttachLongFilename, "test.txt"),
+		pstr(propAttachMimeTag, "text/plain"),
+		pbin(propAttachDataBinary, []byte("attachment data")),
+	})
+	subs := w.subnodes([]subEntry{
+		{nidAttachmentTable, w.block(attachTable(0x25), false), 0},
+		{0x25, w.block(attach, false), 0},
+	})
+	w.node(0x200024, pcBlock([]tprop{
+		pstr(propTransportHeaders, "From: <remote@example.org>\r\nTo: <mjl@mox.example>\r\nSubject: test\r\nMessage-Id: <test@example.org>\r\nContent-Type: text/plain\r\nMIME-Version: 1.0\r\n\r\n"),
+		pstr(propSubject, "test"),
+		pstr(propBody, "hello\r\nworld\r\n"),
+		pbin(propHTML, []byte("<p>hello world</p>")),
+		pint(propMessageFlags, 0x01),
+		pint(propFlagStatus, 2),
+		ptime(propMessageDeliveryTime, testTime),
+	}), subs)
+
+	// Draft without transport headers, with recipients.
+	recipients := tcBlock(
+		[]tprop{{id: propRecipientType, typ: ptypInt32}, {id: propDisplayName, typ: ptypString}, {id: propSMTPAddress, typ: ptypString}, {id: propEmailAddress, typ: ptypString}},
+		[][]tprop{
+			{pint(propRecipientType, 1), pstr(propDisplayName, "Remote"), pstr(propSMTPAddress, "remote@example.org")},
+			{pint(propRecipientType, 2), pstr(propDisplayName, "Exchange user"), pstr(propEmailAddress, "/O=EXAMPLE/OU=EXCHANGE/CN=RECIPIENTS/CN=USER")},
+			{pint(propRecipientType, 2), pstr(propDisplayName, "other@example.org"), pstr(propEmailAddress, "other@example.org")},
+		},
+	)
+	subs = w.subnodes([]subEntry{{nidRecipientTable, w.block(recipients, false), 0}})
+	w.node(0x200044, pcBlock([]tprop{
+		{propSubject, ptypString8, []byte("\x01\x04Re: caf\xe9")},
+		pstr(propSenderName, "Mjl"),
+		pstr(propSenderSMTPAddress, "mjl@mox.example"),
+		{propBody, ptypString8, []byte("draft text")},
+		pint(propMessageFlags, 0x08),
+		pint(propLastVerbExecuted, 102),
+		ptime(propClientSubmitTime, testTime),
+		pstr(propInternetMessageID, "<draft@mox.example>"),
+	}), subs)
+
+	// Message with an attached message, stored in a subnode of the attachment.
+	embedded := pcBlock([]tprop{
+		pstr(propSubject, "embedded"),
+		pstr(propSenderName, "Other"),
+		pstr(propSenderSMTPAddress, "other@example.org"),
+		pstr(propBody, "embedded text"),
+	})
+	embedSubs := w.subnodes([]subEntry{{0x2A1, w.block(embedded, false), 0}})
+	attach = pcBlock([]tprop{
+		pint(propAttachMethod, attachEmbeddedMsg),
+		{propAttachDataBinary, ptypObject, binary.LittleEndian.AppendUint32(binary.LittleEndian.AppendUint32(nil, 0x2A1), uint32(len(embedded)))},
+	})
+	subs = w.subnodes([]subEntry{
+		{nidAttachmentTable, w.block(attachTable(0x45), false), 0},
+		{0x45, w.block(attach, false), embedSubs},
+	})
+	w.node(0x200064, pcBlock([]tprop{
+		pstr(propSubject, "forward"),
+		pstr(propSenderName, "Mjl"),
+		pstr(propSenderSMTPAddress, "mjl@mox.example"),
+		pstr(propBody, "see attached"),
+		pint(propMessageFlags, 0x01),
+		pint(propLastVerbExecuted, 104),
+	}), subs)
+
+	// Contact, in folder that is skipped.
+	w.node(0x200084, pcBlock([]tprop{pstr(propDisplayName, "contact")}), 0)
+
+	// Enough nodes to get a two-level block b-tree.
+	for i := range 20 {
+		w.node(0x300004+uint32(i)<<5, pcBlock(nil), 0)
+	}
+
+	return w.finish()
+}
+
+func TestReader(t *testing.T) {
+	for i, c := range permuteEncrypt {
+		if permuteDecrypt[c] != byte(i) {
+			t.Fatalf("permute tables not inverse at %d", i)
+		}
+	}
+
+	buf := makeTestPST()
+
+	if os.Getenv("MOX_WRITE_TESTPST") != "" {
+		err := os.WriteFile(filepath.FromSlash("../testdata/importtest.pst"), buf, 0660)
+		tcheck(t, err, "writing test pst")
+	}
+
+	dir := t.TempDir()
+	createTemp := func(log mlog.Log, pattern string) (*os.File, error) {
+		return os.CreateTemp(dir, pattern)
+	}
+	r, err := NewReader(pkglog, createTemp, bytes.NewReader(buf))
+	tcheck(t, err, "new reader")
+
+	type result struct {
+		mailbox string
+		m       *store.Message
+		part    message.Part
+		data    string
+	}
+	var results []result
+	for {
+		m, f, _, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		tcheck(t, err, "next")
+		data, err := os.ReadFile(f.Name())
+		tcheck(t, err, "read message")
+		store.CloseRemoveTempFile(pkglog, f, "test message")
+		if int64(len(data)) != m.Size {
+			t.Fatalf("size %d, file has %d bytes", m.Size, len(data))
+		}
+		p, err := message.Parse(pkglog.Logger, true, bytes.NewReader(data))
+		tcheck(t, err, "parse message")
+		err = p.Walk(pkglog.Logger, nil)
+		tcheck(t, err, "walk message")
+		results = append(results, result{r.Mailbox(), m, p, string(data)})
+	}
+
+	var mailboxes []string
+	for _, r := range results {
+		mailboxes = append(mailboxes, r.mailbox)
+	}
+	if !slices.Equal(mailboxes, []string{"Inbox", "Inbox", "Archive-2020/Old"}) {
+		t.Fatalf("got mailboxes %v", mailboxes)
+	}
+
+	// Received message.
+	res := results[0]
+	if !res.m.Received.Equal(testTime) || res.m.Flags != (store.Flags{Seen: true, Flagged: true}) {
+		t.Fatalf("first message, received %v, flags %v", res.m.Received, res.m.Flags)
+	}
+	if res.part.Envelope.Subject != "test" || res.part.Envelope.MessageID != "<test@example.org>" || res.part.MediaType != "MULTIPART" || res.part.MediaSubType != "MIXED" || len(res.part.Parts) != 2 {
+		t.Fatalf("first message, unexpected structure: %#v", res.part)
+	}
+	if strings.Contains(res.data, "text/plain\r\nMIME-Version") || strings.Count(res.data, "MIME-Version") != 1 {
+		t.Fatalf("first message, original mime headers not removed:\n%s", res.data)
+	}
+	alt := res.part.Parts[0]
+	if alt.MediaSubType != "ALTERNATIVE" || len(alt.Parts) != 2 || alt.Parts[0].MediaSubType != "PLAIN" || alt.Parts[1].MediaSubType != "HTML" {
+		t.Fatalf("first message, unexpected body: %#v", alt)
+	}
+	text, err := io.ReadAll(alt.Parts[0].ReaderUTF8OrBinary())
+	tcheck(t, err, "read text")
+	if string(text) != "hello\r\nworld\r\n" {
+		t.Fatalf("first message, text %q", text)
+	}
+	att := res.part.Parts[1]
+	data, err := io.ReadAll(att.Reader())
+	tcheck(t, err, "read attachment")
+	if att.ContentTypeParams["name"] != "" || att.MediaType != "TEXT" || string(data) != "attachment data" || !strings.Contains(res.data, `attachment; filename=test.txt`) {
+		t.Fatalf("first message, attachment %#v, data %q", att, data)
+	}
+
+	// Draft composed from properties.
+	res = results[1]
+	if res.m.Flags != (store.Flags{Draft: true, Answered: true}) {
+		t.Fatalf("second message, flags %v", res.m.Flags)
+	}
+	env := res.part.Envelope
+	if env.Subject != "Re: café" || len(env.From) != 1 || env.From[0].User != "mjl" || env.From[0].Name != "Mjl" || len(env.To) != 1 || env.To[0].Host != "example.org" || len(env.CC) != 1 || env.CC[0].User != "other" || env.CC[0].Name != "" || env.MessageID != "<draft@mox.example>" || !env.Date.Equal(testTime) {
+		t.Fatalf("second message, envelope %#v", env)
+	}
+	if !res.m.Received.Equal(testTime) {
+		t.Fatalf("second message, received %v", res.m.Received)
+	}
+
+	// Attached message.
+	res = results[2]
+	if res.m.Flags != (store.Flags{Seen: true, Forwarded: true}) || !res.m.Received.IsZero() {
+		t.Fatalf("third message, flags %v, received %v", res.m.Flags, res.m.Received)
+	}
+	if len(res.part.Parts) != 2 || res.part.Parts[1].MediaType != "MESSAGE" || res.part.Parts[1].Message == nil || res.part.Parts[1].Message.Envelope.Subject != "embedded" {
+		t.Fatalf("third message, unexpected structure %#v", res.part)
+	}
+
+	// Not a pst file.
+	_, err = NewReader(pkglog, createTemp, bytes.NewReader(make([]byte, 1024)))
+	if !errors.Is(err, ErrFormat) {
+		t.Fatalf("got err %v, expected ErrFormat", err)
+	}
+
+	// Truncated file, without the b-trees.
+	_, err = NewReader(pkglog, createTemp, bytes.NewReader(buf[:2048]))
+	if err == nil {
+		t.Fatalf("no error for truncated file")
+	}
+}
@@ -0,0 +1,246 @@
+// Package pst reads messages from Microsoft Outlook PST and OST files, for
+// importing them into an account.
+//
+// Both the ANSI (Outlook 97-2002) and Unicode (Outlook 2003 and later) formats
+// are supported, unencrypted or with "permute" encryption (the default
+// "compressible" encryption). Messages are reconstructed as MIME messages from
+// their stored properties, using the original internet headers when present.
+package pst
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+
+	"github.com/mjl-/mox/mlog"
+	"github.com/mjl-/mox/store"
+)
+
+// Node ids and properties used for the folder hierarchy.
+const (
+	nidMessageStore = 0x21
+
+	nidTypeHierarchyTable = 0x0D
+	nidTypeContentsTable  = 0x0E
+
+	propIPMSubtreeEntryID = 0x35E0
+	propDisplayName       = 0x3001
+	propContainerClass    = 0x3613
+	propLtpRowID          = 0x67F2
+)
+
+// Reader reads messages from a PST/OST file, implementing store.MsgSource.
+// Folders are walked depth-first, starting at the top of the personal folders.
+type Reader struct {
+	log        mlog.Log
+	createTemp func(log mlog.Log, pattern string) (*os.File, error)
+	f          *File
+
+	folders []folder // Folders still to read.
+	cur     *folder  // Folder currently being read, its messages in msgs.
+	msgs    []uint32
+	mailbox string // Mailbox of message last returned by Next.
+}
+
+type folder struct {
+	nid  uint32
+	name string // Mailbox name, with "/" as hierarchy separator.
+}
+
+// NewReader returns a reader for the PST/OST file in r.
+func NewReader(log mlog.Log, createTemp func(log mlog.Log, pattern string) (*os.File, error), r io.ReaderAt) (*Reader, error) {
+	f, err := Open(r)
+	if err != nil {
+		return nil, err
+	}
+	n, err := f.node(nidMessageStore)
+	if err != nil {
+		return nil, fmt.Errorf("reading message store: %w", err)
+	}
+	p, err := n.propContext()
+	if err != nil {
+		return nil, fmt.Errorf("reading message store: %w", err)
+	}
+	// Entry id: 4 bytes flags, 16 bytes provider uid, 4 bytes node id.
+	eid := p.binary(propIPMSubtreeEntryID)
+	if len(eid) != 24 {
+		return nil, fmt.Errorf("%w: missing top of personal folders", errCorrupt)
+	}
+	top := binary.LittleEndian.Uint32(eid[20:])
+
+	mr := &Reader{log: log, createTemp: createTemp, f: f}
+	children, err := mr.subfolders(folder{top, ""})
+	if err != nil {
+		return nil, fmt.Errorf("reading top of personal folders: %w", err)
+	}
+	mr.folders = children
+	return mr, nil
+}
+
+// Mailbox returns the mailbox name for the message last returned by Next,
+// derived from the folder path in the PST file.
+func (mr *Reader) Mailbox() string {
+	return mr.mailbox
+}
+
+// subfolders returns the mail folders below f.
+func (mr *Reader) subfolders(f folder) ([]folder, error) {
+	n, err := mr.f.node(f.nid&^0x1f | nidTypeHierarchyTable)
+	if err != nil {
+		return nil, err
+	}
+	t, err := n.tableContext()
+	if err != nil {
+		return nil, err
+	}
+	var l []folder
+	for i := range t.rows {
+		row, err := t.row(i)
+		if err != nil {
+			return nil, err
+		}
+		nid, ok := row.int(propLtpRowID)
+		if !ok {
+			return nil, fmt.Errorf("%w: folder without node id", errCorrupt)
+		}
+		fn, err := mr.f.node(uint32(nid))
+		if err != nil {
+			return nil, err
+		}
+		p, err := fn.propContext()
+		if err != nil {
+			return nil, err
+		}
+		// Skip folders with contacts, calendar items, etc.
+		if class := p.str(propContainerClass); class != "" && !strings.HasPrefix(class, "IPF.Note") && !strings.HasPrefix(class, "IPF.Imap") {
+			mr.log.Debug("skipping non-mail folder", slog.String("folder", p.str(propDisplayName)), slog.String("class", class))
+			continue
+		}
+		name := mailboxName(p.str(propDisplayName))
+		if f.name != "" {
+			name = f.name + "/" + name
+		}
+		l = append(l, folder{uint32(nid), name})
+	}
+	return l, nil
+}
+
+// mailboxName returns a name usable as mailbox name for a folder display name.
+// Slashes would create hierarchy, so they are replaced.
+func mailboxName(s string) string {
+	s = strings.Map(func(r rune) rune {
+		if r == '/' {
+			return '-'
+		} else if unicode.IsControl(r) || r == 0x2028 || r == 0x2029 {
+			return -1
+		}
+		return r
+	}, norm.NFC.String(s))
+	s = strings.TrimSpace(strings.TrimLeft(s, "#"))
+	if s == "" {
+		s = "Unnamed"
+	}
+	return s
+}
+
+// messages returns the node ids of the messages in a folder.
+func (mr *Reader) messages(f folder) ([]uint32, error) {
+	n, err := mr.f.node(f.nid&^0x1f | nidTypeContentsTable)
+	if err != nil {
+		return nil, err
+	}
+	t, err := n.tableContext()
+	if err != nil {
+		return nil, err
+	}
+	var l []uint32
+	for i := range t.rows {
+		row, err := t.row(i)
+		if err != nil {
+			return nil, err
+		}
+		if nid, ok := row.int(propLtpRowID); ok {
+			l = append(l, uint32(nid))
+		}
+	}
+	return l, nil
+}
+
+// Next returns the next message. The file is a temporary file and must be
+// removed/consumed. The third return value is the position in the PST file, the
+// folder and node id of the message. Messages that cannot be read are logged
+// and skipped.
+func (mr *Reader) Next() (*store.Message, *os.File, string, error) {
+	for {
+		for mr.cur == nil || len(mr.msgs) == 0 {
+			if len(mr.folders) == 0 {
+				return nil, nil, "", io.EOF
+			}
+			f := mr.folders[0]
+			children, err := mr.subfolders(f)
+			if err != nil {
+				return nil, nil, f.name, fmt.Errorf("reading subfolders: %w", err)
+			}
+			mr.folders = append(children, mr.folders[1:]...)
+			mr.msgs, err = mr.messages(f)
+			if err != nil {
+				return nil, nil, f.name, fmt.Errorf("reading folder contents: %w", err)
+			}
+			mr.cur = &f
+		}
+
+		nid := mr.msgs[0]
+		mr.msgs = mr.msgs[1:]
+		pos := fmt.Sprintf("%s, message node %#x", mr.cur.name, nid)
+		m, mf, err := mr.message(nid)
+		if err != nil {
+			if errors.Is(err, errCorrupt) {
+				mr.log.Errorx("reading message from pst file, skipping", err, slog.String("position", pos))
+				continue
+			}
+			return nil, nil, pos, err
+		}
+		mr.mailbox = mr.cur.name
+		return m, mf, pos, nil
+	}
+}
+
+// message reads a message and writes it to a temporary file.
+func (mr *Reader) message(nid uint32) (*store.Message, *os.File, error) {
+	n, err := mr.f.node(nid)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	f, err := mr.createTemp(mr.log, "pstreader")
+	if err != nil {
+		return nil, nil, err
+	}
+	defer func() {
+		if f != nil {
+			store.CloseRemoveTempFile(mr.log, f, "message file after error")
+		}
+	}()
+
+	msg, err := readMessage(n, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	size, err := msg.writeTo(f)
+	if err != nil {
+		return nil, nil, fmt.Errorf("writing message: %v", err)
+	}
+
+	m := &store.Message{Received: msg.received(), Flags: msg.flags(), Size: size}
+
+	mf := f
+	f = nil
+	return m, mf, nil
+}
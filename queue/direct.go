@@ -195,6 +195,7 @@ func deliverDirect(qlog mlog.Log, resolver dns.Resolver, dialer smtpclient.Diale
 	var remoteMTA dsn.NameIP
 	var lastErr = errors.New("no error") // Can be smtpclient.Error.
 	nmissingRequireTLS := 0
+	nmissingSMTPUTF8 := 0
 	// todo: should make distinction between host permanently not accepting the message, and the message not being deliverable permanently. e.g. a mx host may have a size limit, or not accept 8bitmime, while another host in the list does accept the message. same for smtputf8, ../rfc/6531:555
 	for _, h := range hosts {
 		// ../rfc/8461:913
@@ -287,6 +288,9 @@ func deliverDirect(qlog mlog.Log, resolver dns.Resolver, dialer smtpclient.Diale
 		remoteMTA = dsn.NameIP{Name: h.XString(false), IP: remoteIP}
 		if result.err != nil {
 			lastErr = result.err
+			if errors.Is(result.err, smtpclient.ErrSMTPUTF8Unsupported) {
+				nmissingSMTPUTF8++
+			}
 			var cerr smtpclient.Error
 			if errors.As(result.err, &cerr) {
 				if cerr.Secode == smtp.SePol7MissingReqTLS30 {
@@ -305,6 +309,11 @@ func deliverDirect(qlog mlog.Log, resolver dns.Resolver, dialer smtpclient.Diale
 			mqlog.Info("delivered from queue")
 			mr.msg.markResult(mr.resp.Code, mr.resp.Secode, "", true)
 			delMsgs[i] = *mr.msg
+			// If the remote supports DSNs, it got the DSN parameters and will send any
+			// requested DSN.
+			if !result.remoteDSN && mr.msg.dsnNotify("SUCCESS") {
+				deliverDSNRelayed(mqlog, nil, *mr.msg, remoteMTA)
+			}
 		}
 		if len(delMsgs) > 0 {
 			err := DB.Write(context.Background(), func(tx *bstore.Tx) error {
@@ -360,6 +369,21 @@ func deliverDirect(qlog mlog.Log, resolver dns.Resolver, dialer smtpclient.Diale
 		return
 	}
 
+	// Likewise for messages that need smtputf8, e.g. for internationalized email
+	// addresses. We don't downgrade messages, addresses with non-ascii localparts
+	// cannot be represented without smtputf8. ../rfc/6531:555
+	if len(hosts) > 0 && nmissingSMTPUTF8 == len(hosts) {
+		qlog.Info("marking delivery as permanently failed because recipient domain does not implement smtputf8")
+		err := smtpclient.Error{
+			Permanent: true,
+			Code:      smtp.C553BadMailbox,
+			Secode:    smtp.SeMsg6NonASCIIAddrNotPermitted7,
+			Err:       fmt.Errorf("destination servers do not support smtputf8, required by message"),
+		}
+		failMsgsDB(qlog, msgs, m0.DialedIPs, backoff, remoteMTA, err)
+		return
+	}
+
 	failMsgsDB(qlog, msgs, m0.DialedIPs, backoff, remoteMTA, lastErr)
 	return
 }
@@ -368,6 +392,7 @@ type deliverResult struct {
 	tlsDANE    bool
 	remoteIP   net.IP
 	hostResult tlsrpt.Result
+	remoteDSN  bool // Whether remote supports the DSN extension.
 
 	// If err is set, no messages were delivered but delivered and failed are still
 	// nil. If err is not set, delivered and always add up to all msgs requested to be
@@ -724,8 +749,10 @@ func deliverHost(log mlog.Log, resolver dns.Resolver, dialer smtpclient.Dialer,
 		}
 
 		rcpts := make([]string, n)
+		rcptMsgs := make([]*Msg, n)
 		for i, mr := range todo[:n] {
 			rcpts[i] = mr.msg.Recipient().XString(m0.SMTPUTF8)
+			rcptMsgs[i] = mr.msg
 		}
 
 		// Only require that remote announces 8bitmime extension when in pedantic mode. All
@@ -734,7 +761,7 @@ func deliverHost(log mlog.Log, resolver dns.Resolver, dialer smtpclient.Dialer,
 		// 7-bit-only, but the trouble likely isn't worth it.
 		req8bit := has8bit && mox.Pedantic
 
-		resps, err := sc.DeliverMultiple(ctx, mailFrom, rcpts, size, msg, req8bit, smtputf8, m0.RequireTLS != nil && *m0.RequireTLS)
+		resps, err := sc.DeliverMultipleDSN(ctx, mailFrom, rcpts, size, msg, req8bit, smtputf8, m0.RequireTLS != nil && *m0.RequireTLS, dsnParams(rcptMsgs))
 		if err != nil && (len(resps) == 0 && n == len(msgResps) || len(resps) == len(msgResps)) {
 			// If error and it applies to all recipients, return a single error.
 			return deliverResult{err: inspectError(err)}
@@ -766,7 +793,7 @@ func deliverHost(log mlog.Log, resolver dns.Resolver, dialer smtpclient.Dialer,
 		// implement such a limit when we see it in practice.
 	}
 
-	return deliverResult{delivered: delivered, failed: failed}
+	return deliverResult{delivered: delivered, failed: failed, remoteDSN: sc.SupportsDSN()}
 }
 
 // Update (overwite) last known starttls/requiretls support for recipient domain.
@@ -0,0 +1,132 @@
+package queue
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/mjl-/bstore"
+
+	"github.com/mjl-/mox/dkim"
+	"github.com/mjl-/mox/mlog"
+	"github.com/mjl-/mox/mox-"
+	"github.com/mjl-/mox/smtp"
+	"github.com/mjl-/mox/store"
+)
+
+// dkimResign replaces DKIM-Signature header fields in the MsgPrefix of m0 that
+// were made with a selector that is retiring or no longer configured, with new
+// signatures by the current signing selectors of the signing domain. Without this,
+// messages that stay in the queue for a while, e.g. due to temporary delivery
+// failures, would fail DKIM verification once the DNS record of the old selector
+// is removed during key rotation.
+//
+// The messages in msgs are for the same message as m0 (same BaseID), and are
+// updated too. Messages are updated in the database with tx.
+func dkimResign(ctx context.Context, log mlog.Log, tx *bstore.Tx, msgs []*Msg) error {
+	m0 := msgs[0]
+	if len(m0.MsgPrefix) == 0 || !bytes.Contains(bytes.ToLower(m0.MsgPrefix), []byte("dkim-signature:")) {
+		return nil
+	}
+
+	// Gather header fields of the prefix, keeping the ones we don't replace.
+	var keep [][]byte
+	var sigs []*dkim.Sig
+	for _, h := range prefixHeaderFields(m0.MsgPrefix) {
+		k, _, _ := bytes.Cut(h, []byte(":"))
+		if !strings.EqualFold(strings.TrimRight(string(k), " \t"), "DKIM-Signature") {
+			keep = append(keep, h)
+			continue
+		}
+		sig, err := dkim.ParseSignature(h, m0.SMTPUTF8)
+		if err != nil {
+			log.Debugx("parsing dkim-signature in queued message prefix, keeping", err)
+			keep = append(keep, h)
+			continue
+		}
+		confDom, ok := mox.Conf.Domain(sig.Domain)
+		if !ok {
+			keep = append(keep, h)
+			continue
+		}
+		sel, ok := confDom.DKIM.Selectors[sig.Selector.Name()]
+		if ok && !sel.Retiring {
+			keep = append(keep, h)
+			continue
+		}
+		sigs = append(sigs, sig)
+	}
+	if len(sigs) == 0 {
+		return nil
+	}
+
+	// All signatures are for the same domain, with the same identity.
+	sig := sigs[0]
+	confDom, _ := mox.Conf.Domain(sig.Domain)
+	selectors := mox.DKIMSelectors(confDom.DKIM)
+	if len(selectors) == 0 {
+		// Better to keep the old signature, it may still be valid.
+		log.Info("no current dkim selectors to sign queued message with, keeping signature by retiring selector", slog.Any("domain", sig.Domain), slog.Any("selector", sig.Selector))
+		return nil
+	}
+	var localpart smtp.Localpart
+	if sig.Identity != nil && sig.Identity.Localpart != nil {
+		localpart = *sig.Identity.Localpart
+	}
+
+	prefix := bytes.Join(keep, nil)
+	f, err := os.Open(m0.MessagePath())
+	if err != nil {
+		return fmt.Errorf("open message file: %v", err)
+	}
+	defer func() {
+		err := f.Close()
+		log.Check(err, "closing message file after dkim signing")
+	}()
+	dkimHeaders, err := dkim.Sign(ctx, log.Logger, localpart, sig.Domain, selectors, m0.SMTPUTF8, store.FileMsgReader(prefix, f))
+	if err != nil {
+		return fmt.Errorf("dkim sign: %v", err)
+	}
+	nprefix := append([]byte(dkimHeaders), prefix...)
+
+	oprefix := m0.MsgPrefix
+	for _, m := range msgs {
+		if !bytes.Equal(m.MsgPrefix, oprefix) {
+			continue
+		}
+		m.Size += int64(len(nprefix) - len(oprefix))
+		m.MsgPrefix = nprefix
+		if err := tx.Update(m); err != nil {
+			return fmt.Errorf("updating message with new dkim signatures: %v", err)
+		}
+	}
+	log.Info("signed queued message again with current dkim selectors", slog.Any("domain", sig.Domain), slog.Any("oldselector", sig.Selector))
+	return nil
+}
+
+// prefixHeaderFields returns the header fields in prefix, each including its
+// continuation lines and ending crlf.
+func prefixHeaderFields(prefix []byte) [][]byte {
+	var l [][]byte
+	for len(prefix) > 0 {
+		n := len(prefix)
+		for i := bytes.Index(prefix, []byte("\r\n")); i >= 0; {
+			o := i + 2
+			if o >= len(prefix) || prefix[o] != ' ' && prefix[o] != '\t' {
+				n = o
+				break
+			}
+			j := bytes.Index(prefix[o:], []byte("\r\n"))
+			if j < 0 {
+				break
+			}
+			i = o + j
+		}
+		l = append(l, prefix[:n])
+		prefix = prefix[n:]
+	}
+	return l
+}
@@ -0,0 +1,129 @@
+package queue
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mjl-/bstore"
+
+	"github.com/mjl-/mox/config"
+	"github.com/mjl-/mox/dkim"
+	"github.com/mjl-/mox/dns"
+	"github.com/mjl-/mox/mox-"
+	"github.com/mjl-/mox/smtp"
+)
+
+func TestDKIMResign(t *testing.T) {
+	_, cleanup := setup(t)
+	defer cleanup()
+
+	domain := dns.Domain{ASCII: "mox.example"}
+	selector := func(name string, seed byte) config.Selector {
+		return config.Selector{
+			HashEffective:    "sha256",
+			HeadersEffective: []string{"From", "To", "Subject"},
+			Key:              ed25519.NewKeyFromSeed(bytes.Repeat([]byte{seed}, ed25519.SeedSize)),
+			Domain:           dns.Domain{ASCII: name},
+		}
+	}
+	setDKIM := func(dkimConf config.DKIM) {
+		dc := mox.Conf.Dynamic.Domains["mox.example"]
+		dc.DKIM = dkimConf
+		mox.Conf.Dynamic.Domains["mox.example"] = dc
+	}
+	defer setDKIM(config.DKIM{})
+
+	oldSel := selector("old", 1)
+	newSel := selector("new", 2)
+	setDKIM(config.DKIM{Selectors: map[string]config.Selector{"old": oldSel}, Sign: []string{"old"}})
+
+	// Sign and queue message, like a submission.
+	received := "Received: from localhost\r\n"
+	dkimHeaders, err := dkim.Sign(ctxbg, pkglog.Logger, "mjl", domain, mox.DKIMSelectors(mox.Conf.Dynamic.Domains["mox.example"].DKIM), false, strings.NewReader(received+testmsg))
+	tcheck(t, err, "dkim sign")
+	authResults := "Authentication-Results: localhost; auth=pass\r\n"
+	prefix := []byte(received + dkimHeaders + authResults)
+
+	path := smtp.Path{Localpart: "mjl", IPDomain: dns.IPDomain{Domain: domain}}
+	mf := prepareFile(t)
+	defer os.Remove(mf.Name())
+	defer mf.Close()
+	qm := MakeMsg(path, path, false, false, int64(len(prefix)+len(testmsg)), "<test@localhost>", prefix, nil, time.Now(), "test")
+	err = Add(ctxbg, pkglog, "mjl", mf, qm)
+	tcheck(t, err, "add message to queue")
+	msgs, err := List(ctxbg, Filter{}, Sort{})
+	tcheck(t, err, "list queue")
+	tcompare(t, len(msgs), 1)
+	id := msgs[0].ID
+
+	resign := func() Msg {
+		t.Helper()
+		err := DB.Write(ctxbg, func(tx *bstore.Tx) error {
+			m := Msg{ID: id}
+			if err := tx.Get(&m); err != nil {
+				return err
+			}
+			return dkimResign(ctxbg, pkglog, tx, []*Msg{&m})
+		})
+		tcheck(t, err, "dkim resign")
+		m := Msg{ID: id}
+		err = DB.Get(ctxbg, &m)
+		tcheck(t, err, "get message")
+		return m
+	}
+
+	// Selector not retiring, nothing changes.
+	m := resign()
+	tcompare(t, m.MsgPrefix, prefix)
+
+	// Retiring selector, but no other selector to sign with: keep old signature.
+	oldSel.Retiring = true
+	setDKIM(config.DKIM{Selectors: map[string]config.Selector{"old": oldSel}, Sign: []string{"old"}})
+	m = resign()
+	tcompare(t, m.MsgPrefix, prefix)
+
+	// With a new selector, the message gets a new signature, and the old is removed.
+	setDKIM(config.DKIM{Selectors: map[string]config.Selector{"old": oldSel, "new": newSel}, Sign: []string{"old", "new"}})
+	m = resign()
+	nprefix := string(m.MsgPrefix)
+	if !strings.HasPrefix(nprefix, "DKIM-Signature: ") || !strings.Contains(nprefix, "s=new;") || strings.Contains(nprefix, "s=old;") {
+		t.Fatalf("unexpected new message prefix %q", nprefix)
+	}
+	if !strings.HasSuffix(nprefix, received+authResults) {
+		t.Fatalf("other header fields not kept in new message prefix %q", nprefix)
+	}
+	tcompare(t, m.Size, int64(len(m.MsgPrefix)+len(testmsg)))
+
+	// New signature verifies.
+	resolver := dns.MockResolver{
+		TXT: map[string][]string{
+			"new._domainkey.mox.example.": {"v=DKIM1;k=ed25519;p=" + dkimPublicKey(t, newSel)},
+		},
+	}
+	results, err := dkim.Verify(ctxbg, pkglog.Logger, resolver, false, dkim.DefaultPolicy, strings.NewReader(nprefix+testmsg), false)
+	tcheck(t, err, "dkim verify")
+	if len(results) != 1 || results[0].Status != dkim.StatusPass {
+		t.Fatalf("unexpected dkim verify results %#v", results)
+	}
+
+	// Signing again does not change anything.
+	m2 := resign()
+	tcompare(t, m2.MsgPrefix, m.MsgPrefix)
+}
+
+func dkimPublicKey(t *testing.T, sel config.Selector) string {
+	t.Helper()
+	record := dkim.Record{
+		Version:   "DKIM1",
+		Key:       "ed25519",
+		PublicKey: sel.Key.Public(),
+	}
+	txt, err := record.Record()
+	tcheck(t, err, "dkim record")
+	_, p, _ := strings.Cut(txt, "p=")
+	return p
+}
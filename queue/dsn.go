@@ -5,6 +5,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"log/slog"
 	"net"
 	"os"
@@ -19,11 +20,13 @@ import (
 
 	"github.com/mjl-/mox/dns"
 	"github.com/mjl-/mox/dsn"
+	"github.com/mjl-/mox/eventdb"
 	"github.com/mjl-/mox/message"
 	"github.com/mjl-/mox/mlog"
 	"github.com/mjl-/mox/mox-"
 	"github.com/mjl-/mox/smtp"
 	"github.com/mjl-/mox/smtpclient"
+	"github.com/mjl-/mox/srs"
 	"github.com/mjl-/mox/store"
 	"github.com/mjl-/mox/webhook"
 )
@@ -56,17 +59,51 @@ func failMsgsDB(qlog mlog.Log, msgs []*Msg, dialedIPs map[string][]net.IP, backo
 	kick()
 }
 
+// failoverMsgsTx processes a failure to deliver msgs for which the route has a
+// next transport to fail over to. The messages are scheduled for immediate
+// delivery with the next transport.
+func failoverMsgsTx(qlog mlog.Log, tx *bstore.Tx, msgs []*Msg, ids []int64, dialedIPs map[string][]net.IP, failoverIndex int, code int, secode string, err error) {
+	errmsg := err.Error()
+	events := make([]eventdb.Event, len(msgs))
+	for i, m := range msgs {
+		qlog.Errorx("failure delivering from queue, failing over to next transport of route", err,
+			slog.Int64("msgid", m.ID),
+			slog.Any("recipient", m.Recipient()),
+			slog.Int("failoverindex", failoverIndex))
+		events[i] = m.event(eventdb.KindAttempt)
+		events[i].Code = code
+		events[i].Secode = secode
+		events[i].Detail = errmsg
+	}
+	eventdb.Add(context.Background(), qlog, events...)
+
+	qup := bstore.QueryTx[Msg](tx)
+	qup.FilterIDs(ids)
+	umsgs, xerr := qup.List()
+	if xerr != nil {
+		qlog.Errorx("retrieving messages for failing over to next transport", xerr)
+		return
+	}
+	now := time.Now()
+	for _, um := range umsgs {
+		um.DialedIPs = dialedIPs
+		um.markResult(code, secode, errmsg, false)
+		um.FailoverIndex = failoverIndex
+		um.NextAttempt = now
+		if err := tx.Update(&um); err != nil {
+			qlog.Errorx("updating message for failing over to next transport", err, slog.Int64("msgid", um.ID))
+		}
+	}
+}
+
 // todo: perhaps put some of the params in a delivery struct so we don't pass all the params all the time?
 
 // failMsgsTx processes a failure to deliver msgs. If the error is permanent, a DSN
-// is delivered to the sender account.
+// is delivered to the sender account, or queued for the sender of a relayed
+// message.
 // Caller must call kick() after commiting the transaction for any (re)scheduling
 // of messages and webhooks.
 func failMsgsTx(qlog mlog.Log, tx *bstore.Tx, msgs []*Msg, dialedIPs map[string][]net.IP, backoff time.Duration, remoteMTA dsn.NameIP, err error) {
-	// todo future: when we implement relaying, we should be able to send DSNs to non-local users. and possibly specify a null mailfrom. ../rfc/5321:1503
-	// todo future: when we implement relaying, and a dsn cannot be delivered, and requiretls was active, we cannot drop the message. instead deliver to local postmaster? though ../rfc/8689:383 may intend to say the dsn should be delivered without requiretls?
-	// todo future: when we implement smtp dsn extension, parameter RET=FULL must be disregarded for messages with REQUIRETLS. ../rfc/8689:379
-
 	m0 := msgs[0]
 
 	var smtpLines []string
@@ -95,7 +132,16 @@ func failMsgsTx(qlog mlog.Log, tx *bstore.Tx, msgs []*Msg, dialedIPs map[string]
 		ids[i] = m.ID
 	}
 
-	if permanent || m0.MaxAttempts == 0 && m0.Attempts >= 8 || m0.MaxAttempts > 0 && m0.Attempts >= m0.MaxAttempts {
+	attemptsDone := m0.MaxAttempts == 0 && m0.Attempts >= 8 || m0.MaxAttempts > 0 && m0.Attempts >= m0.MaxAttempts
+
+	// If the route has a next transport to fail over to for this error, we attempt
+	// delivery with that transport immediately, also for permanent errors.
+	if failoverIndex := routeFailover(*m0, err); failoverIndex > 0 && !attemptsDone {
+		failoverMsgsTx(qlog, tx, msgs, ids, dialedIPs, failoverIndex, code, secodeOpt, err)
+		return
+	}
+
+	if permanent || attemptsDone {
 		event = webhook.EventFailed
 		if errors.Is(err, errSuppressed) {
 			event = webhook.EventSuppressed
@@ -110,7 +156,9 @@ func failMsgsTx(qlog mlog.Log, tx *bstore.Tx, msgs []*Msg, dialedIPs map[string]
 
 			qmlog := qlog.With(slog.Int64("msgid", rm.ID), slog.Any("recipient", m.Recipient()))
 			qmlog.Errorx("permanent failure delivering from queue", err)
-			deliverDSNFailure(qmlog, rm, remoteMTA, secodeOpt, errmsg, smtpLines)
+			if rm.dsnNotify("FAILURE") {
+				deliverDSNFailure(qmlog, tx, rm, remoteMTA, secodeOpt, errmsg, smtpLines)
+			}
 
 			rmsgs[i] = rm
 
@@ -155,8 +203,12 @@ func failMsgsTx(qlog mlog.Log, tx *bstore.Tx, msgs []*Msg, dialedIPs map[string]
 		retryUntil := m0.LastAttempt.Add((4 + 8 + 16) * time.Hour)
 		for _, m := range msgs {
 			qmlog := qlog.With(slog.Int64("msgid", m.ID), slog.Any("recipient", m.Recipient()))
+			if !m.dsnNotify("DELAY") {
+				qmlog.Errorx("temporary failure delivering from queue, delayed dsn not requested", err, slog.Duration("backoff", backoff))
+				continue
+			}
 			qmlog.Errorx("temporary failure delivering from queue, sending delayed dsn", err, slog.Duration("backoff", backoff))
-			deliverDSNDelay(qmlog, *m, remoteMTA, secodeOpt, errmsg, smtpLines, retryUntil)
+			deliverDSNDelay(qmlog, tx, *m, remoteMTA, secodeOpt, errmsg, smtpLines, retryUntil)
 		}
 	} else {
 		for _, m := range msgs {
@@ -168,6 +220,15 @@ func failMsgsTx(qlog mlog.Log, tx *bstore.Tx, msgs []*Msg, dialedIPs map[string]
 		}
 	}
 
+	events := make([]eventdb.Event, len(msgs))
+	for i, m := range msgs {
+		events[i] = m.event(eventdb.KindAttempt)
+		events[i].Code = code
+		events[i].Secode = secodeOpt
+		events[i].Detail = errmsg
+	}
+	eventdb.Add(context.Background(), qlog, events...)
+
 	process := func() error {
 		// Update DialedIPs in message, and record the result.
 		qup := bstore.QueryTx[Msg](tx)
@@ -180,6 +241,8 @@ func failMsgsTx(qlog mlog.Log, tx *bstore.Tx, msgs []*Msg, dialedIPs map[string]
 			// All messages should have the same DialedIPs.
 			um.DialedIPs = dialedIPs
 			um.markResult(code, secodeOpt, errmsg, false)
+			// Next attempt starts at the beginning of a failover chain again.
+			um.FailoverIndex = 0
 			if err := tx.Update(&um); err != nil {
 				return fmt.Errorf("updating message after temporary failure to deliver: %v", err)
 			}
@@ -213,7 +276,7 @@ func failMsgsTx(qlog mlog.Log, tx *bstore.Tx, msgs []*Msg, dialedIPs map[string]
 	}
 }
 
-func deliverDSNFailure(log mlog.Log, m Msg, remoteMTA dsn.NameIP, secodeOpt, errmsg string, smtpLines []string) {
+func deliverDSNFailure(log mlog.Log, tx *bstore.Tx, m Msg, remoteMTA dsn.NameIP, secodeOpt, errmsg string, smtpLines []string) {
 	const subject = "mail delivery failed"
 	message := fmt.Sprintf(`
 Delivery has failed permanently for your email to:
@@ -230,10 +293,10 @@ Error during the last delivery attempt:
 		message += "\nFull SMTP response:\n\n\t" + strings.Join(smtpLines, "\n\t") + "\n"
 	}
 
-	deliverDSN(log, m, remoteMTA, secodeOpt, errmsg, smtpLines, true, nil, subject, message)
+	deliverDSN(log, tx, m, remoteMTA, secodeOpt, errmsg, smtpLines, dsn.Failed, nil, subject, message)
 }
 
-func deliverDSNDelay(log mlog.Log, m Msg, remoteMTA dsn.NameIP, secodeOpt, errmsg string, smtpLines []string, retryUntil time.Time) {
+func deliverDSNDelay(log mlog.Log, tx *bstore.Tx, m Msg, remoteMTA dsn.NameIP, secodeOpt, errmsg string, smtpLines []string, retryUntil time.Time) {
 	// Should not happen, but doesn't hurt to prevent sending delayed delivery
 	// notifications for DMARC reports. We don't want to waste postmaster attention.
 	if m.IsDMARCReport {
@@ -257,17 +320,40 @@ Error during the last delivery attempt:
 		message += "\nFull SMTP response:\n\n\t" + strings.Join(smtpLines, "\n\t") + "\n"
 	}
 
-	deliverDSN(log, m, remoteMTA, secodeOpt, errmsg, smtpLines, false, &retryUntil, subject, message)
+	deliverDSN(log, tx, m, remoteMTA, secodeOpt, errmsg, smtpLines, dsn.Delayed, &retryUntil, subject, message)
+}
+
+// deliverDSNRelayed delivers a DSN for a message that was delivered to a remote
+// server that does not support the DSN extension, and for which the sender
+// requested notification of success. ../rfc/3461
+func deliverDSNRelayed(log mlog.Log, tx *bstore.Tx, m Msg, remoteMTA dsn.NameIP) {
+	const subject = "mail delivery relayed"
+	message := fmt.Sprintf(`
+Your email has been delivered to the mail server for:
+
+	%s
+
+The mail server does not send notifications about final delivery. You will not
+receive any further notifications about this message.
+`, m.Recipient().XString(m.SMTPUTF8))
+
+	deliverDSN(log, tx, m, remoteMTA, "", "", nil, dsn.Relayed, nil, subject, message)
 }
 
-// We only queue DSNs for delivery failures for emails submitted by authenticated
-// users. So we are delivering to local users. ../rfc/5321:1466
+// DSNs for emails submitted by authenticated users are delivered to the local
+// sender account. ../rfc/5321:1466
+// DSNs for relayed emails are queued for delivery to the sender with a null
+// reverse path. No DSN is sent for an email with a null reverse path.
 // ../rfc/5321:1494
 // ../rfc/7208:490
-func deliverDSN(log mlog.Log, m Msg, remoteMTA dsn.NameIP, secodeOpt, errmsg string, smtpLines []string, permanent bool, retryUntil *time.Time, subject, textBody string) {
-	kind := "delayed delivery"
-	if permanent {
-		kind = "failure"
+//
+// If tx is not nil, a DSN for a relayed email is queued in tx.
+func deliverDSN(log mlog.Log, tx *bstore.Tx, m Msg, remoteMTA dsn.NameIP, secodeOpt, errmsg string, smtpLines []string, action dsn.Action, retryUntil *time.Time, subject, textBody string) {
+	kind := string(action)
+
+	if m.Sender().IsZero() {
+		log.Debug("queue dsn: not sending dsn for message with null reverse path", slog.String("kind", kind))
+		return
 	}
 
 	qlog := func(text string, err error) {
@@ -284,20 +370,33 @@ func deliverDSN(log mlog.Log, m Msg, remoteMTA dsn.NameIP, secodeOpt, errmsg str
 		err := msgr.Close()
 		log.Check(err, "closing message reader after queuing dsn")
 	}()
-	headers, err := message.ReadHeaders(bufio.NewReader(msgr))
-	if err != nil {
-		qlog("reading headers of queued message", err)
-		return
+
+	// With RET=FULL, we return the whole message, except for messages with REQUIRETLS.
+	// ../rfc/3461 ../rfc/8689:379
+	var original []byte
+	full := m.DSNRet == "FULL" && (m.RequireTLS == nil || !*m.RequireTLS)
+	if full {
+		original, err = io.ReadAll(msgr)
+		if err != nil {
+			qlog("reading queued message", err)
+			return
+		}
+	} else {
+		original, err = message.ReadHeaders(bufio.NewReader(msgr))
+		if err != nil {
+			qlog("reading headers of queued message", err)
+			return
+		}
 	}
 
-	var action dsn.Action
 	var status string
-	if permanent {
+	switch action {
+	case dsn.Failed:
 		status = "5."
-		action = dsn.Failed
-	} else {
-		action = dsn.Delayed
+	case dsn.Delayed:
 		status = "4."
+	default:
+		status = "2."
 	}
 	if secodeOpt != "" {
 		status += secodeOpt
@@ -305,6 +404,14 @@ func deliverDSN(log mlog.Log, m Msg, remoteMTA dsn.NameIP, secodeOpt, errmsg str
 		status += "0.0"
 	}
 
+	var origRcpt smtp.Path
+	if m.DSNORCPT != "" {
+		origRcpt, err = dsn.ParseOriginalRecipient(m.DSNORCPT)
+		if err != nil {
+			log.Debugx("parsing original recipient for dsn, not including it", err, slog.String("orcpt", m.DSNORCPT))
+		}
+	}
+
 	// ../rfc/3461:1329
 	var smtpDiag string
 	if len(smtpLines) > 0 {
@@ -320,6 +427,7 @@ func deliverDSN(log mlog.Log, m Msg, remoteMTA dsn.NameIP, secodeOpt, errmsg str
 		References: m.MessageID,
 		TextBody:   textBody,
 
+		OriginalEnvelopeID:   m.DSNEnvID,
 		ReportingMTA:         mox.Conf.Static.HostnameDomain.ASCII,
 		ArrivalDate:          m.Queued,
 		FutureReleaseRequest: m.FutureReleaseRequest,
@@ -327,6 +435,7 @@ func deliverDSN(log mlog.Log, m Msg, remoteMTA dsn.NameIP, secodeOpt, errmsg str
 		Recipients: []dsn.Recipient{
 			{
 				FinalRecipient:     m.Recipient(),
+				OriginalRecipient:  origRcpt,
 				Action:             action,
 				Status:             status,
 				StatusComment:      errmsg,
@@ -337,8 +446,18 @@ func deliverDSN(log mlog.Log, m Msg, remoteMTA dsn.NameIP, secodeOpt, errmsg str
 			},
 		},
 
-		Original: headers,
+		Original:     original,
+		OriginalFull: full,
+	}
+
+	if m.Relayed {
+		dsnMsg.To = dsnRecipient(log, m)
+		if err := queueDSN(log, tx, m, dsnMsg); err != nil {
+			qlog("queueing dsn", err)
+		}
+		return
 	}
+
 	msgData, err := dsnMsg.Compose(log, m.SMTPUTF8)
 	if err != nil {
 		qlog("composing dsn", err)
@@ -405,3 +524,86 @@ func deliverDSN(log mlog.Log, m Msg, remoteMTA dsn.NameIP, secodeOpt, errmsg str
 		}
 	})
 }
+
+// dsnRecipient returns the address to send a DSN for a relayed message to: the
+// sender, or the original sender if the message was forwarded with an
+// SRS-rewritten address at one of our domains.
+func dsnRecipient(log mlog.Log, m Msg) smtp.Path {
+	sender := m.Sender()
+	if _, ok := mox.Conf.Domain(sender.IPDomain.Domain); !ok || !srs.IsSRS(sender.Localpart) {
+		return sender
+	}
+	orig, err := mox.SRSReverse(sender.Localpart)
+	if err != nil {
+		log.Debugx("reversing srs address for dsn, sending to srs address", err, slog.Any("sender", sender))
+		return sender
+	}
+	return orig
+}
+
+// queueDSN adds a DSN for a relayed message to the queue, with a null reverse path
+// so a failure to deliver the DSN will not result in another DSN. If tx is not
+// nil, the DSN is queued in tx, and its message file is left behind if tx is not
+// committed.
+func queueDSN(log mlog.Log, tx *bstore.Tx, m Msg, dsnMsg *dsn.Message) error {
+	ctx := context.Background()
+
+	buf, err := dsnMsg.Compose(log, false)
+	if err != nil {
+		return fmt.Errorf("composing dsn: %v", err)
+	}
+	bufDKIM, err := mox.DKIMSign(ctx, log, dsnMsg.From, false, buf)
+	log.Check(err, "dkim signing dsn")
+	buf = append([]byte(bufDKIM), buf...)
+
+	var bufUTF8 []byte
+	if m.SMTPUTF8 {
+		bufUTF8, err = dsnMsg.Compose(log, true)
+		if err != nil {
+			log.Errorx("composing dsn with utf-8, continuing with ascii-only dsn", err)
+			bufUTF8 = nil
+		} else {
+			bufUTF8DKIM, err := mox.DKIMSign(ctx, log, dsnMsg.From, true, bufUTF8)
+			log.Check(err, "dkim signing dsn with utf8")
+			bufUTF8 = append([]byte(bufUTF8DKIM), bufUTF8...)
+		}
+	}
+
+	msgFile, err := store.CreateMessageTemp(log, "queue-dsn")
+	if err != nil {
+		return fmt.Errorf("creating temporary message file: %v", err)
+	}
+	defer store.CloseRemoveTempFile(log, msgFile, "dsn message")
+	if _, err := msgFile.Write(buf); err != nil {
+		return fmt.Errorf("writing dsn message: %v", err)
+	}
+
+	// If the original message required TLS, so does the DSN. ../rfc/8689:383
+	var requireTLS *bool
+	if m.RequireTLS != nil && *m.RequireTLS {
+		requireTLS = m.RequireTLS
+	}
+	qm := MakeMsg(smtp.Path{}, dsnMsg.To, false, false, int64(len(buf)), dsnMsg.MessageID, nil, requireTLS, time.Now(), dsnMsg.Subject)
+	qm.DSNUTF8 = bufUTF8
+	qm.Relayed = true
+
+	postmaster := mox.Conf.Static.Postmaster.Account
+	if tx == nil {
+		if err := Add(ctx, log, postmaster, msgFile, qm); err != nil {
+			return err
+		}
+	} else {
+		qml := []Msg{qm}
+		paths, err := addTx(log, tx, postmaster, msgFile, qml)
+		if err != nil {
+			for _, p := range paths {
+				err := os.Remove(p)
+				log.Check(err, "removing dsn message file for queue", slog.String("path", p))
+			}
+			return err
+		}
+		eventdb.Add(ctx, log, qml[0].event(eventdb.KindQueued))
+	}
+	log.Info("dsn for relayed message queued", slog.Any("recipient", dsnMsg.To))
+	return nil
+}
@@ -2,6 +2,9 @@ package queue
 
 import (
 	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -20,6 +23,7 @@ import (
 
 	"github.com/mjl-/bstore"
 
+	"github.com/mjl-/mox/config"
 	"github.com/mjl-/mox/dns"
 	"github.com/mjl-/mox/dsn"
 	"github.com/mjl-/mox/message"
@@ -59,11 +63,13 @@ type Hook struct {
 	Subject    string            // Subject of original outgoing message, or of incoming message.
 	Extra      map[string]string // From submitted message.
 
-	Account       string `bstore:"nonzero"`
+	Account       string // Empty for admin events.
 	URL           string `bstore:"nonzero"` // Taken from config when webhook is scheduled.
 	Authorization string // Optional value for authorization header to include in HTTP request.
+	Signature     string // Optional value for X-Mox-Webhook-Signature header, an HMAC of the payload.
 	IsIncoming    bool
 	OutgoingEvent string // Empty string if not outgoing.
+	AdminEvent    string // Empty string if not an admin event.
 	Payload       string // JSON data to be submitted.
 
 	Submitted   time.Time `bstore:"default now,index"`
@@ -88,6 +94,8 @@ func (h Hook) attrs() []slog.Attr {
 	event := string(h.OutgoingEvent)
 	if h.IsIncoming {
 		event = "incoming"
+	} else if h.AdminEvent != "" {
+		event = h.AdminEvent
 	}
 	return []slog.Attr{
 		slog.Int64("webhookid", h.ID),
@@ -124,6 +132,7 @@ func (h Hook) Retired(success bool, lastActivity, keepUntil time.Time) HookRetir
 		Authorization: h.Authorization != "",
 		IsIncoming:    h.IsIncoming,
 		OutgoingEvent: h.OutgoingEvent,
+		AdminEvent:    h.AdminEvent,
 		Payload:       h.Payload,
 		Submitted:     h.Submitted,
 		Attempts:      h.Attempts,
@@ -144,11 +153,12 @@ type HookRetired struct {
 	Subject    string            // Subject of original outgoing message, or of incoming message.
 	Extra      map[string]string // From submitted message.
 
-	Account       string `bstore:"nonzero,index Account+LastActivity"`
-	URL           string `bstore:"nonzero"` // Taken from config at start of each attempt.
+	Account       string `bstore:"index Account+LastActivity"` // Empty for admin events.
+	URL           string `bstore:"nonzero"`                    // Taken from config at start of each attempt.
 	Authorization bool   // Whether request had authorization without keeping it around.
 	IsIncoming    bool
 	OutgoingEvent string
+	AdminEvent    string
 	Payload       string // JSON data submitted.
 
 	Submitted      time.Time
@@ -223,7 +233,7 @@ type HookFilter struct {
 	Account     string
 	Submitted   string // Whether submitted before/after a time relative to now. ">$duration" or "<$duration", also with "now" for duration.
 	NextAttempt string // ">$duration" or "<$duration", also with "now" for duration.
-	Event       string // Including "incoming".
+	Event       string // Including "incoming" and admin events.
 }
 
 func (f HookFilter) apply(q *bstore.Query[Hook]) error {
@@ -271,7 +281,9 @@ func (f HookFilter) apply(q *bstore.Query[Hook]) error {
 		if f.Event == "incoming" {
 			q.FilterNonzero(Hook{IsIncoming: true})
 		} else {
-			q.FilterNonzero(Hook{OutgoingEvent: f.Event})
+			q.FilterFn(func(h Hook) bool {
+				return h.OutgoingEvent == f.Event || h.AdminEvent == f.Event
+			})
 		}
 	}
 	if f.Max != 0 {
@@ -364,7 +376,7 @@ type HookRetiredFilter struct {
 	Account      string
 	Submitted    string // Whether submitted before/after a time relative to now. ">$duration" or "<$duration", also with "now" for duration.
 	LastActivity string // ">$duration" or "<$duration", also with "now" for duration.
-	Event        string // Including "incoming".
+	Event        string // Including "incoming" and admin events.
 }
 
 func (f HookRetiredFilter) apply(q *bstore.Query[HookRetired]) error {
@@ -412,7 +424,9 @@ func (f HookRetiredFilter) apply(q *bstore.Query[HookRetired]) error {
 		if f.Event == "incoming" {
 			q.FilterNonzero(HookRetired{IsIncoming: true})
 		} else {
-			q.FilterNonzero(HookRetired{OutgoingEvent: f.Event})
+			q.FilterFn(func(h HookRetired) bool {
+				return h.OutgoingEvent == f.Event || h.AdminEvent == f.Event
+			})
 		}
 	}
 	if f.Max != 0 {
@@ -626,6 +640,45 @@ func hookCompose(m Msg, url, authz string, event webhook.OutgoingEvent, suppress
 	return h, nil
 }
 
+// HookAdmin schedules a webhook for an admin event, if configured through wh and
+// the event is enabled for the webhook.
+func HookAdmin(ctx context.Context, log mlog.Log, wh config.AdminWebhook, data webhook.Admin) error {
+	if len(wh.Events) > 0 && !slices.Contains(wh.Events, string(data.Event)) {
+		return nil
+	}
+
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("marshal webhook payload: %v", err)
+	}
+	var signature string
+	if wh.Secret != "" {
+		mac := hmac.New(sha256.New, []byte(wh.Secret))
+		mac.Write(payload)
+		signature = "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	}
+
+	now := time.Now()
+	h := Hook{
+		URL:           wh.URL,
+		Authorization: wh.Authorization,
+		Signature:     signature,
+		AdminEvent:    string(data.Event),
+		Payload:       string(payload),
+		Submitted:     now,
+		NextAttempt:   now,
+	}
+	err = DB.Write(ctx, func(tx *bstore.Tx) error {
+		return hookInsert(tx, &h, now, 0)
+	})
+	if err != nil {
+		return fmt.Errorf("inserting webhook in database: %v", err)
+	}
+	log.Debug("queued webhook for admin event", h.attrs()...)
+	hookqueueKick()
+	return nil
+}
+
 // Incoming processes a message delivered over SMTP for webhooks. If the message is
 // a DSN, a webhook for outgoing deliveries may be scheduled (if configured).
 // Otherwise, a webhook for incoming deliveries may be scheduled.
@@ -1171,7 +1224,7 @@ func hookDeliver(log mlog.Log, h Hook) {
 	hctx, cancel := context.WithTimeout(ctx, 60*time.Second)
 	defer cancel()
 	t0 := time.Now()
-	code, response, err := HookPost(hctx, qlog, h.ID, h.Attempts, h.URL, h.Authorization, h.Payload)
+	code, response, err := hookPost(hctx, qlog, h.ID, h.Attempts, h.URL, h.Authorization, h.Signature, h.Payload)
 	result.Duration = time.Since(t0)
 	result.Success = err == nil
 	result.Code = code
@@ -1242,7 +1295,12 @@ func hookTransport() *http.Transport {
 	return t
 }
 
+// HookPost makes an HTTP POST request with payload to a webhook URL.
 func HookPost(ctx context.Context, log mlog.Log, hookID int64, attempt int, url, authz string, payload string) (code int, response string, err error) {
+	return hookPost(ctx, log, hookID, attempt, url, authz, "", payload)
+}
+
+func hookPost(ctx context.Context, log mlog.Log, hookID int64, attempt int, url, authz, signature string, payload string) (code int, response string, err error) {
 	req, err := http.NewRequestWithContext(ctx, "POST", url, strings.NewReader(payload))
 	if err != nil {
 		return 0, "", fmt.Errorf("new request: %v", err)
@@ -1254,6 +1312,9 @@ func HookPost(ctx context.Context, log mlog.Log, hookID int64, attempt int, url,
 	if authz != "" {
 		req.Header.Set("Authorization", authz)
 	}
+	if signature != "" {
+		req.Header.Set("X-Mox-Webhook-Signature", signature)
+	}
 	t0 := time.Now()
 	resp, err := hookClient.Do(req)
 	metricHookRequest.Observe(float64(time.Since(t0)) / float64(time.Second))
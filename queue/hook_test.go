@@ -2,6 +2,9 @@ package queue
 
 import (
 	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -13,6 +16,7 @@ import (
 
 	"github.com/mjl-/bstore"
 
+	"github.com/mjl-/mox/config"
 	"github.com/mjl-/mox/dsn"
 	"github.com/mjl-/mox/message"
 	"github.com/mjl-/mox/smtp"
@@ -521,12 +525,77 @@ func TestFromIDIncomingDelivery(t *testing.T) {
 	tcompare(t, h2.ID > h.ID, true)
 }
 
+// Test webhooks for admin events, with event filtering and signatures.
+func TestHookAdmin(t *testing.T) {
+	_, cleanup := setup(t)
+	defer cleanup()
+
+	var gotSignature string
+	var gotPayload webhook.Admin
+	hs := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotSignature = r.Header.Get("X-Mox-Webhook-Signature")
+		err := json.NewDecoder(r.Body).Decode(&gotPayload)
+		if err != nil {
+			http.Error(w, "bad payload", http.StatusBadRequest)
+			return
+		}
+		fmt.Fprintln(w, "ok")
+	}))
+	defer hs.Close()
+
+	wh := config.AdminWebhook{
+		URL:    hs.URL,
+		Secret: "secret",
+		Events: []string{string(webhook.EventAccountAdded)},
+	}
+
+	// Event not enabled, no webhook.
+	err := HookAdmin(ctxbg, pkglog, wh, webhook.Admin{Event: webhook.EventDomainAdded, Domain: "mox.example"})
+	tcheck(t, err, "admin hook")
+	n, err := HookQueueSize(ctxbg)
+	tcheck(t, err, "hook queue size")
+	tcompare(t, n, 0)
+
+	now := time.Now().Round(0)
+	data := webhook.Admin{Event: webhook.EventAccountAdded, Time: now, Account: "other", Address: "other@mox.example"}
+	err = HookAdmin(ctxbg, pkglog, wh, data)
+	tcheck(t, err, "admin hook")
+	h, err := bstore.QueryDB[Hook](ctxbg, DB).Get()
+	tcheck(t, err, "get hook")
+	tcompare(t, h.AdminEvent, string(webhook.EventAccountAdded))
+	tcompare(t, h.Account, "")
+
+	mac := hmac.New(sha256.New, []byte(wh.Secret))
+	mac.Write([]byte(h.Payload))
+	expSignature := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	tcompare(t, h.Signature, expSignature)
+
+	hookDeliver(pkglog, h)
+	<-hookDeliveryResults
+	err = DB.Get(ctxbg, &h)
+	tcompare(t, err, bstore.ErrAbsent)
+	hr := HookRetired{ID: h.ID}
+	err = DB.Get(ctxbg, &hr)
+	tcheck(t, err, "get retired hook after delivery")
+	tcompare(t, hr.Success, true)
+	tcompare(t, hr.AdminEvent, string(webhook.EventAccountAdded))
+	tcompare(t, gotSignature, expSignature)
+	gotPayload.Time = gotPayload.Time.Local() // For TZ UTC.
+	data.Version = 0
+	tcompare(t, gotPayload, data)
+
+	// Filtering on admin event.
+	l, err := HookRetiredList(ctxbg, HookRetiredFilter{Event: string(webhook.EventAccountAdded)}, HookRetiredSort{})
+	tcheck(t, err, "list retired hooks")
+	tcompare(t, len(l), 1)
+}
+
 func TestHookListFilterSort(t *testing.T) {
 	_, cleanup := setup(t)
 	defer cleanup()
 
 	now := time.Now().Round(0)
-	h := Hook{0, 0, "fromid", "messageid", "subj", nil, "mjl", "http://localhost", "", false, "delivered", "", now, 0, now, []HookResult{}}
+	h := Hook{0, 0, "fromid", "messageid", "subj", nil, "mjl", "http://localhost", "", "", false, "delivered", "", "", now, 0, now, []HookResult{}}
 	h1 := h
 	h1.Submitted = now.Add(-time.Second)
 	h1.NextAttempt = now.Add(time.Minute)
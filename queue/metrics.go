@@ -0,0 +1,84 @@
+package queue
+
+import (
+	"context"
+	"path/filepath"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/mjl-/bstore"
+
+	"github.com/mjl-/mox/metrics"
+	"github.com/mjl-/mox/mlog"
+	"github.com/mjl-/mox/mox-"
+)
+
+var metricQueueMessagesDesc = prometheus.NewDesc(
+	"mox_queue_messages",
+	"Messages in queue, by recipient domain and maximum age since queueing (1h, 6h, 24h, 72h, 168h or inf).",
+	[]string{
+		"domain",
+		"age",
+	},
+	nil,
+)
+
+// Upper limits for the age label of mox_queue_messages.
+var queueAgeBuckets = []struct {
+	limit time.Duration
+	label string
+}{
+	{time.Hour, "1h"},
+	{6 * time.Hour, "6h"},
+	{24 * time.Hour, "24h"},
+	{72 * time.Hour, "72h"},
+	{168 * time.Hour, "168h"},
+}
+
+// queueCollector gathers queue depth on each scrape, by reading all messages from
+// the queue database.
+type queueCollector struct{}
+
+func init() {
+	prometheus.MustRegister(queueCollector{})
+	metrics.DatabaseSize("queue", func() string { return mox.DataDirPath(filepath.FromSlash("queue/index.db")) })
+}
+
+func (queueCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- metricQueueMessagesDesc
+}
+
+func (queueCollector) Collect(ch chan<- prometheus.Metric) {
+	if DB == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	type key struct {
+		domain string
+		age    string
+	}
+	counts := map[key]int{}
+	now := time.Now()
+	err := bstore.QueryDB[Msg](ctx, DB).ForEach(func(m Msg) error {
+		age := "inf"
+		for _, b := range queueAgeBuckets {
+			if now.Sub(m.Queued) <= b.limit {
+				age = b.label
+				break
+			}
+		}
+		counts[key{m.RecipientDomainStr, age}]++
+		return nil
+	})
+	if err != nil {
+		mlog.New("queue", nil).Errorx("gathering queue metrics", err)
+		return
+	}
+	for k, n := range counts {
+		ch <- prometheus.MustNewConstMetric(metricQueueMessagesDesc, prometheus.GaugeValue, float64(n), k.domain, k.age)
+	}
+}
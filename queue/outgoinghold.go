@@ -0,0 +1,205 @@
+package queue
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/mjl-/bstore"
+
+	"github.com/mjl-/mox/message"
+	"github.com/mjl-/mox/mlog"
+	"github.com/mjl-/mox/mox-"
+	"github.com/mjl-/mox/moxvar"
+	"github.com/mjl-/mox/smtp"
+	"github.com/mjl-/mox/store"
+)
+
+var metricHoldAccount = promauto.NewCounter(
+	prometheus.CounterOpts{
+		Name: "mox_queue_hold_account_total",
+		Help: "Accounts of which outgoing messages were put on hold automatically because they appear to be compromised.",
+	},
+)
+
+// HoldAccount adds a hold rule for an account that appears to be compromised,
+// with the reason, see the OutgoingHold configuration. The messages of the account
+// in the queue, and messages it submits later, are held until released by the
+// admin. A notification is delivered to the postmaster mailbox. If a hold rule for
+// the account already exists, nothing is done.
+func HoldAccount(ctx context.Context, log mlog.Log, account, reason string) error {
+	exists, err := bstore.QueryDB[HoldRule](ctx, DB).FilterNonzero(HoldRule{Account: account}).Exists()
+	if err != nil {
+		return fmt.Errorf("looking up hold rule for account: %v", err)
+	} else if exists {
+		return nil
+	}
+	hr, err := HoldRuleAdd(ctx, log, HoldRule{Account: account, Reason: reason})
+	if err != nil {
+		return err
+	}
+	metricHoldAccount.Inc()
+	log.Info("holding outgoing messages of possibly compromised account", slog.String("account", account), slog.String("reason", reason))
+	holdNotify(ctx, log, hr)
+	return nil
+}
+
+// holdRuleMessages returns the IDs of messages in the queue that are on hold and
+// match the hold rule.
+func holdRuleMessages(tx *bstore.Tx, hr HoldRule) ([]int64, error) {
+	var ids []int64
+	err := bstore.QueryTx[Msg](tx).FilterEqual("Hold", true).ForEach(func(m Msg) error {
+		if hr.matches(m) {
+			ids = append(ids, m.ID)
+		}
+		return nil
+	})
+	return ids, err
+}
+
+// HoldRuleRelease removes a hold rule and takes the messages in the queue that
+// match it off hold, e.g. after reviewing the messages of an account held with
+// HoldAccount.
+func HoldRuleRelease(ctx context.Context, log mlog.Log, holdRuleID int64) (affected int, rerr error) {
+	var ids []int64
+	err := DB.Write(ctx, func(tx *bstore.Tx) error {
+		hr := HoldRule{ID: holdRuleID}
+		if err := tx.Get(&hr); err != nil {
+			return err
+		}
+		var err error
+		ids, err = holdRuleMessages(tx, hr)
+		if err != nil {
+			return fmt.Errorf("listing held messages: %v", err)
+		}
+		log.Info("releasing hold rule", slog.Any("holdrule", hr), slog.Int("messages", len(ids)))
+		return tx.Delete(hr)
+	})
+	if err != nil || len(ids) == 0 {
+		return 0, err
+	}
+	return HoldSet(ctx, Filter{IDs: ids}, false)
+}
+
+// HoldRuleDeny drops the messages on hold in the queue that match a hold rule,
+// e.g. after reviewing the messages of an account held with HoldAccount. The hold
+// rule is kept, so new messages are held too.
+func HoldRuleDeny(ctx context.Context, log mlog.Log, holdRuleID int64) (affected int, rerr error) {
+	var ids []int64
+	err := DB.Read(ctx, func(tx *bstore.Tx) error {
+		hr := HoldRule{ID: holdRuleID}
+		if err := tx.Get(&hr); err != nil {
+			return err
+		}
+		var err error
+		ids, err = holdRuleMessages(tx, hr)
+		if err != nil {
+			return fmt.Errorf("listing held messages: %v", err)
+		}
+		log.Info("denying held messages for hold rule", slog.Any("holdrule", hr), slog.Int("messages", len(ids)))
+		return nil
+	})
+	if err != nil || len(ids) == 0 {
+		return 0, err
+	}
+	hold := true
+	return Drop(ctx, log, Filter{IDs: ids, Hold: &hold})
+}
+
+// holdNotify delivers a message about the account held with hr to the postmaster
+// mailbox. Errors are logged.
+func holdNotify(ctx context.Context, log mlog.Log, hr HoldRule) {
+	var held int
+	err := DB.Read(ctx, func(tx *bstore.Tx) error {
+		ids, err := holdRuleMessages(tx, hr)
+		held = len(ids)
+		return err
+	})
+	log.Check(err, "counting held messages for notification")
+
+	postmaster := smtp.Address{Localpart: "postmaster", Domain: mox.Conf.Static.HostnameDomain}
+	text := fmt.Sprintf(`Outgoing messages of account %q are held for review, because it may be compromised:
+
+	%s
+
+Messages in the queue for the account are on hold, %d at the time of writing,
+and messages submitted later are held too. Review the messages on the queue
+page of the admin web interface, and release or drop them. Releasing removes
+the hold rule.
+
+If the account is compromised, consider suspending it and changing its
+password.
+`, hr.Account, hr.Reason, held)
+
+	var msgBuf bytes.Buffer
+	err = func() (rerr error) {
+		xc := message.NewComposer(&msgBuf, 1024*1024, false)
+		defer func() {
+			x := recover()
+			if x == nil {
+				return
+			}
+			if err, ok := x.(error); ok && errors.Is(err, message.ErrCompose) {
+				rerr = err
+				return
+			}
+			panic(x)
+		}()
+		xc.HeaderAddrs("From", []message.NameAddress{{DisplayName: "mox", Address: postmaster}})
+		xc.HeaderAddrs("To", []message.NameAddress{{Address: postmaster}})
+		xc.Subject(fmt.Sprintf("Outgoing messages of account %s held", hr.Account))
+		xc.Header("Message-Id", fmt.Sprintf("<%s>", mox.MessageIDGen(false)))
+		xc.Header("Date", time.Now().Format(message.RFC5322Z))
+		xc.Header("Auto-Submitted", "auto-generated")
+		xc.Header("User-Agent", "mox/"+moxvar.Version)
+		xc.Header("MIME-Version", "1.0")
+		body, ct, cte := xc.TextPart("plain", text)
+		xc.Header("Content-Type", ct)
+		xc.Header("Content-Transfer-Encoding", cte)
+		xc.Line()
+		xc.Write(body)
+		xc.Flush()
+		return nil
+	}()
+	if err != nil {
+		log.Errorx("composing hold notification", err)
+		return
+	}
+
+	acc, err := store.OpenAccount(log, mox.Conf.Static.Postmaster.Account, false)
+	if err != nil {
+		log.Errorx("open postmaster account for hold notification", err)
+		return
+	}
+	defer func() {
+		err := acc.Close()
+		log.Check(err, "closing postmaster account")
+	}()
+
+	msgFile, err := store.CreateMessageTemp(log, "queue-holdnotify")
+	if err != nil {
+		log.Errorx("creating temporary message file for hold notification", err)
+		return
+	}
+	defer store.CloseRemoveTempFile(log, msgFile, "hold notification")
+	if _, err := msgFile.Write(msgBuf.Bytes()); err != nil {
+		log.Errorx("writing hold notification", err)
+		return
+	}
+
+	m := store.Message{
+		Received:  time.Now(),
+		Size:      int64(msgBuf.Len()),
+		MsgPrefix: []byte{},
+	}
+	acc.WithWLock(func() {
+		err := acc.DeliverMailbox(log, mox.Conf.Static.Postmaster.Mailbox, &m, msgFile)
+		log.Check(err, "delivering hold notification to postmaster mailbox")
+	})
+}
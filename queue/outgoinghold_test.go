@@ -0,0 +1,89 @@
+package queue
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/mjl-/bstore"
+
+	"github.com/mjl-/mox/dns"
+	"github.com/mjl-/mox/smtp"
+	"github.com/mjl-/mox/store"
+)
+
+func TestHoldAccount(t *testing.T) {
+	acc, cleanup := setup(t)
+	defer cleanup()
+
+	add := func() {
+		t.Helper()
+		path := smtp.Path{Localpart: "mjl", IPDomain: dns.IPDomain{Domain: dns.Domain{ASCII: "mox.example"}}}
+		mf := prepareFile(t)
+		defer os.Remove(mf.Name())
+		defer mf.Close()
+		qm := MakeMsg(path, path, false, false, int64(len(testmsg)), "<test@localhost>", nil, nil, time.Now(), "test")
+		err := Add(ctxbg, pkglog, "mjl", mf, qm)
+		tcheck(t, err, "add message to queue")
+	}
+
+	held := func(exp int) {
+		t.Helper()
+		n, err := bstore.QueryDB[Msg](ctxbg, DB).FilterEqual("Hold", true).Count()
+		tcheck(t, err, "count held messages")
+		tcompare(t, n, exp)
+	}
+
+	add()
+	held(0)
+
+	err := HoldAccount(ctxbg, pkglog, "mjl", "test reason")
+	tcheck(t, err, "hold account")
+	held(1)
+
+	// A second hold for the account does nothing.
+	err = HoldAccount(ctxbg, pkglog, "mjl", "other reason")
+	tcheck(t, err, "hold account again")
+	hrl, err := HoldRuleList(ctxbg)
+	tcheck(t, err, "list hold rules")
+	tcompare(t, len(hrl), 1)
+	tcompare(t, hrl[0].Reason, "test reason")
+
+	// Postmaster was notified.
+	err = acc.DB.Read(ctxbg, func(tx *bstore.Tx) error {
+		mb, err := acc.MailboxFind(tx, "postmaster")
+		tcheck(t, err, "find postmaster mailbox")
+		if mb == nil {
+			t.Fatalf("no postmaster mailbox")
+		}
+		n, err := bstore.QueryTx[store.Message](tx).FilterNonzero(store.Message{MailboxID: mb.ID}).Count()
+		tcheck(t, err, "count messages")
+		tcompare(t, n, 1)
+		return nil
+	})
+	tcheck(t, err, "read postmaster mailbox")
+
+	// New messages are held too.
+	add()
+	held(2)
+
+	// Deny drops the held messages, the rule stays.
+	n, err := HoldRuleDeny(ctxbg, pkglog, hrl[0].ID)
+	tcheck(t, err, "deny")
+	tcompare(t, n, 2)
+	held(0)
+	hrl, err = HoldRuleList(ctxbg)
+	tcheck(t, err, "list hold rules")
+	tcompare(t, len(hrl), 1)
+
+	// Release removes the rule and takes messages off hold.
+	add()
+	held(1)
+	n, err = HoldRuleRelease(ctxbg, pkglog, hrl[0].ID)
+	tcheck(t, err, "release")
+	tcompare(t, n, 1)
+	held(0)
+	hrl, err = HoldRuleList(ctxbg)
+	tcheck(t, err, "list hold rules")
+	tcompare(t, len(hrl), 0)
+}
@@ -28,6 +28,7 @@ import (
 	"github.com/mjl-/mox/config"
 	"github.com/mjl-/mox/dns"
 	"github.com/mjl-/mox/dsn"
+	"github.com/mjl-/mox/eventdb"
 	"github.com/mjl-/mox/metrics"
 	"github.com/mjl-/mox/mlog"
 	"github.com/mjl-/mox/mox-"
@@ -98,10 +99,15 @@ type HoldRule struct {
 	RecipientDomain    dns.Domain
 	SenderDomainStr    string // Unicode.
 	RecipientDomainStr string // Unicode.
+
+	// For hold rules added automatically for an account that appears to be
+	// compromised, the heuristic that was tripped. See HoldAccount.
+	Reason string
 }
 
 func (pr HoldRule) All() bool {
 	pr.ID = 0
+	pr.Reason = ""
 	return pr == HoldRule{}
 }
 
@@ -125,7 +131,7 @@ type Msg struct {
 
 	Queued             time.Time      `bstore:"default now"`
 	Hold               bool           // If set, delivery won't be attempted.
-	SenderAccount      string         // Failures are delivered back to this local account. Also used for routing.
+	SenderAccount      string         // Failures are delivered back to this local account, unless Relayed. Also used for routing.
 	SenderLocalpart    smtp.Localpart // Should be a local user and domain.
 	SenderDomain       dns.IPDomain
 	SenderDomainStr    string         // For filtering, unicode.
@@ -159,6 +165,11 @@ type Msg struct {
 	// rules apply.
 	Transport string
 
+	// Position in the failover chain of the matching route for the next delivery
+	// attempt: Zero for the Transport of the route, 1 for the first of its Failover
+	// transports, etc. Only used if Transport is empty.
+	FailoverIndex int
+
 	// RequireTLS influences TLS verification during delivery.
 	//
 	// If nil, the recipient domain policy is followed (MTA-STS and/or DANE), falling
@@ -180,9 +191,51 @@ type Msg struct {
 	FutureReleaseRequest string
 	// ../rfc/4865:305
 
+	// Parameters of the SMTP DSN extension, as given during submission. They
+	// determine for which events DSNs are sent and what they contain, and are passed
+	// on to the next hop if it supports the DSN extension. ../rfc/3461
+	DSNNotify []string // Empty for the default of failures and delays, otherwise "NEVER", or any of "SUCCESS", "FAILURE" and "DELAY".
+	DSNORCPT  string   // Original recipient, with address type, e.g. "rfc822;user@example.org".
+	DSNRet    string   // "FULL" or "HDRS", or empty for the default of only headers.
+	DSNEnvID  string   // Envelope identifier.
+
+	// If set, the message was not submitted by a local user, but is relayed for a
+	// remote sender, e.g. a forwarded message. DSNs are not delivered to the
+	// SenderAccount, but queued for delivery to the sender address (or the original
+	// sender of an SRS-rewritten address), with a null reverse path.
+	Relayed bool
+
 	Extra map[string]string // Extra information, for transactional email.
 }
 
+// dsnNotify returns whether a DSN is requested for kind, one of "SUCCESS",
+// "FAILURE" and "DELAY". Without NOTIFY parameter, DSNs are sent for failures and
+// delays. ../rfc/3461
+func (m Msg) dsnNotify(kind string) bool {
+	if len(m.DSNNotify) == 0 {
+		return kind != "SUCCESS"
+	}
+	return slices.Contains(m.DSNNotify, kind)
+}
+
+// dsnParams returns the DSN parameters to pass on to the next hop for a
+// transaction with msgs, or nil if none were set during submission.
+func dsnParams(msgs []*Msg) *smtpclient.DSN {
+	d := &smtpclient.DSN{Ret: msgs[0].DSNRet, EnvID: msgs[0].DSNEnvID}
+	var haveRcpt bool
+	rcpts := make([]smtpclient.DSNRecipient, len(msgs))
+	for i, m := range msgs {
+		rcpts[i] = smtpclient.DSNRecipient{Notify: m.DSNNotify, ORCPT: m.DSNORCPT}
+		haveRcpt = haveRcpt || len(m.DSNNotify) > 0 || m.DSNORCPT != ""
+	}
+	if haveRcpt {
+		d.Recipients = rcpts
+	} else if d.Ret == "" && d.EnvID == "" {
+		return nil
+	}
+	return d
+}
+
 // MsgResult is the result (or work in progress) of a delivery attempt.
 type MsgResult struct {
 	Start    time.Time
@@ -235,6 +288,18 @@ func (m Msg) MessagePath() string {
 
 // todo: store which transport (if any) was actually used in MsgResult, based on routes.
 
+// event returns an event for the message, for the event database.
+func (m Msg) event(kind eventdb.Kind) eventdb.Event {
+	return eventdb.Event{
+		Kind:       kind,
+		MessageID:  m.MessageID,
+		QueueMsgID: m.ID,
+		Account:    m.SenderAccount,
+		Sender:     m.Sender().XString(true),
+		Recipient:  m.Recipient().XString(true),
+	}
+}
+
 // Retired returns a MsgRetired for the message, for history of deliveries.
 func (m Msg) Retired(success bool, t, keepUntil time.Time) MsgRetired {
 	return MsgRetired{
@@ -632,11 +697,56 @@ func Add(ctx context.Context, log mlog.Log, senderAccount string, msgFile *os.Fi
 		return fmt.Errorf("must queue at least one message")
 	}
 
+	tx, err := DB.Begin(ctx, true)
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer func() {
+		if tx != nil {
+			if err := tx.Rollback(); err != nil {
+				log.Errorx("rollback for queue", err)
+			}
+		}
+	}()
+
+	paths, err := addTx(log, tx, senderAccount, msgFile, qml)
+	defer func() {
+		for _, p := range paths {
+			err := os.Remove(p)
+			log.Check(err, "removing destination message file for queue", slog.String("path", p))
+		}
+	}()
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit transaction: %s", err)
+	}
+	tx = nil
+	paths = nil
+
+	events := make([]eventdb.Event, len(qml))
+	for i, qm := range qml {
+		events[i] = qm.event(eventdb.KindQueued)
+	}
+	eventdb.Add(ctx, log, events...)
+
+	msgqueueKick()
+
+	return nil
+}
+
+// addTx inserts messages into the queue in an existing transaction, and links
+// msgFile into the queue directory for each. The paths of the message files are
+// returned, also in case of an error, so the caller can remove them if the
+// transaction is not committed.
+func addTx(log mlog.Log, tx *bstore.Tx, senderAccount string, msgFile *os.File, qml []Msg) ([]string, error) {
 	base := true
 
 	for i, qm := range qml {
 		if qm.ID != 0 {
-			return fmt.Errorf("id of queued messages must be 0")
+			return nil, fmt.Errorf("id of queued messages must be 0")
 		}
 		// Sanity check, internal consistency.
 		qml[i].SenderDomainStr = formatIPDomain(qm.SenderDomain)
@@ -646,22 +756,10 @@ func Add(ctx context.Context, log mlog.Log, senderAccount string, msgFile *os.Fi
 		}
 	}
 
-	tx, err := DB.Begin(ctx, true)
-	if err != nil {
-		return fmt.Errorf("begin transaction: %w", err)
-	}
-	defer func() {
-		if tx != nil {
-			if err := tx.Rollback(); err != nil {
-				log.Errorx("rollback for queue", err)
-			}
-		}
-	}()
-
 	// Mark messages Hold if they match a hold rule.
 	holdRules, err := bstore.QueryTx[HoldRule](tx).List()
 	if err != nil {
-		return fmt.Errorf("getting queue hold rules")
+		return nil, fmt.Errorf("getting queue hold rules")
 	}
 
 	// Insert messages into queue. If multiple messages are to be delivered in a single
@@ -674,14 +772,14 @@ func Add(ctx context.Context, log mlog.Log, senderAccount string, msgFile *os.Fi
 		// for uniquely identifying a message sent in the past.
 		if fromID := qml[i].FromID; fromID != "" {
 			if exists, err := bstore.QueryTx[Msg](tx).FilterNonzero(Msg{FromID: fromID}).Exists(); err != nil {
-				return fmt.Errorf("looking up fromid: %v", err)
+				return nil, fmt.Errorf("looking up fromid: %v", err)
 			} else if exists {
-				return fmt.Errorf("%w: fromid %q already present in message queue", ErrFromID, fromID)
+				return nil, fmt.Errorf("%w: fromid %q already present in message queue", ErrFromID, fromID)
 			}
 			if exists, err := bstore.QueryTx[MsgRetired](tx).FilterNonzero(MsgRetired{FromID: fromID}).Exists(); err != nil {
-				return fmt.Errorf("looking up fromid: %v", err)
+				return nil, fmt.Errorf("looking up fromid: %v", err)
 			} else if exists {
-				return fmt.Errorf("%w: fromid %q already present in retired message queue", ErrFromID, fromID)
+				return nil, fmt.Errorf("%w: fromid %q already present in retired message queue", ErrFromID, fromID)
 			}
 		}
 
@@ -694,55 +792,40 @@ func Add(ctx context.Context, log mlog.Log, senderAccount string, msgFile *os.Fi
 			}
 		}
 		if err := tx.Insert(&qml[i]); err != nil {
-			return err
+			return nil, err
 		}
 		if base && i == 0 && len(qml) > 1 {
 			baseID = qml[i].ID
 			qml[i].BaseID = baseID
 			if err := tx.Update(&qml[i]); err != nil {
-				return err
+				return nil, err
 			}
 		}
 	}
 
 	var paths []string
-	defer func() {
-		for _, p := range paths {
-			err := os.Remove(p)
-			log.Check(err, "removing destination message file for queue", slog.String("path", p))
-		}
-	}()
-
 	for _, qm := range qml {
 		dst := qm.MessagePath()
 		paths = append(paths, dst)
 		dstDir := filepath.Dir(dst)
 		os.MkdirAll(dstDir, 0770)
 		if err := moxio.LinkOrCopy(log, dst, msgFile.Name(), nil, true); err != nil {
-			return fmt.Errorf("linking/copying message to new file: %s", err)
+			return paths, fmt.Errorf("linking/copying message to new file: %s", err)
 		} else if err := moxio.SyncDir(log, dstDir); err != nil {
-			return fmt.Errorf("sync directory: %v", err)
+			return paths, fmt.Errorf("sync directory: %v", err)
 		}
 	}
 
 	for _, m := range qml {
 		if m.Hold {
 			if err := metricHoldUpdate(tx); err != nil {
-				return err
+				return paths, err
 			}
 			break
 		}
 	}
 
-	if err := tx.Commit(); err != nil {
-		return fmt.Errorf("commit transaction: %s", err)
-	}
-	tx = nil
-	paths = nil
-
-	msgqueueKick()
-
-	return nil
+	return paths, nil
 }
 
 func formatIPDomain(d dns.IPDomain) string {
@@ -894,7 +977,7 @@ func failDrop(ctx context.Context, log mlog.Log, filter Filter, fail bool) (affe
 				if msgs[i].LastAttempt == nil {
 					msgs[i].LastAttempt = &now
 				}
-				deliverDSNFailure(log, msgs[i], remoteMTA, "", result.Error, nil)
+				deliverDSNFailure(log, tx, msgs[i], remoteMTA, "", result.Error, nil)
 			}
 		}
 		event := webhook.EventCanceled
@@ -1294,6 +1377,25 @@ func retireMsgs(log mlog.Log, tx *bstore.Tx, event webhook.OutgoingEvent, code i
 			return err
 		}
 	}
+	var events []eventdb.Event
+	for _, m := range msgs {
+		var e eventdb.Event
+		switch event {
+		case webhook.EventDelivered:
+			e = m.event(eventdb.KindSent)
+		case webhook.EventFailed, webhook.EventSuppressed:
+			e = m.event(eventdb.KindBounced)
+		default:
+			continue
+		}
+		lr := m.LastResult()
+		e.Code = lr.Code
+		e.Secode = lr.Secode
+		e.Detail = lr.Error
+		events = append(events, e)
+	}
+	eventdb.Add(context.Background(), log, events...)
+
 	if msgKeep > 0 {
 		for _, m := range msgs {
 			rm := m.Retired(event == webhook.EventDelivered, now, now.Add(msgKeep))
@@ -1432,6 +1534,10 @@ func deliver(log mlog.Log, resolver dns.Resolver, m0 Msg) {
 			return mm.Transport, transport, ok
 		}
 		route := findRoute(mm.Attempts, mm)
+		if mm.FailoverIndex > 0 && mm.FailoverIndex <= len(route.Failover) {
+			i := mm.FailoverIndex - 1
+			return route.Failover[i], route.ResolvedFailover[i], true
+		}
 		return route.Transport, route.ResolvedTransport, true
 	}
 
@@ -1498,6 +1604,12 @@ func deliver(log mlog.Log, resolver dns.Resolver, m0 Msg) {
 		}
 	}
 
+	// If the message was signed with a DKIM key that is being retired, sign it again
+	// with the current keys, so it still verifies after the old key is removed.
+	if err := dkimResign(ctx, qlog, xtx, msgs); err != nil {
+		qlog.Errorx("signing message again with current dkim selectors, delivering with original signatures", err, slog.Int64("msgid", m0.ID))
+	}
+
 	if err := xtx.Commit(); err != nil {
 		qlog.Errorx("commit of preparation to deliver", err, slog.Any("msgid", m0.ID))
 		return
@@ -1645,6 +1757,50 @@ func findRoute(attempt int, m Msg) config.Route {
 	return config.Route{}
 }
 
+// routeFailover returns the position in the failover chain of the route for the
+// next delivery attempt of m, after the attempt that was just made failed with
+// err. Zero is returned if the delivery should not fail over to a next transport.
+func routeFailover(m Msg, err error) int {
+	if m.Transport != "" || errors.Is(err, errSuppressed) {
+		return 0
+	}
+	// Attempts has already been incremented for the failed attempt.
+	route := findRoute(m.Attempts-1, m)
+	if m.FailoverIndex >= len(route.Failover) {
+		return 0
+	}
+	classes := route.FailoverErrors
+	if len(classes) == 0 {
+		classes = []string{"connection", "tls", "policy"}
+	}
+	var code int
+	var secode string
+	var cerr smtpclient.Error
+	if errors.As(err, &cerr) {
+		code = cerr.Code
+		secode = cerr.Secode
+	}
+	for _, class := range classes {
+		var match bool
+		switch class {
+		case "connection":
+			match = code == 0 && !errors.Is(err, smtpclient.ErrTLS)
+		case "tls":
+			match = errors.Is(err, smtpclient.ErrTLS)
+		case "temporary":
+			match = code/100 == 4
+		case "policy":
+			match = (code/100 == 4 || code/100 == 5) && strings.HasPrefix(secode, "7.")
+		case "permanent":
+			match = code/100 == 5
+		}
+		if match {
+			return m.FailoverIndex + 1
+		}
+	}
+	return 0
+}
+
 func findRouteInList(attempt int, m Msg, routes []config.Route) (config.Route, bool) {
 	for _, r := range routes {
 		if routeMatch(attempt, m, r) {
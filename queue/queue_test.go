@@ -9,6 +9,7 @@ import (
 	"crypto/tls"
 	"crypto/x509"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"math/big"
@@ -22,10 +23,14 @@ import (
 	"testing"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+
 	"github.com/mjl-/adns"
 	"github.com/mjl-/bstore"
 
 	"github.com/mjl-/mox/dns"
+	"github.com/mjl-/mox/eventdb"
 	"github.com/mjl-/mox/mlog"
 	"github.com/mjl-/mox/mox-"
 	"github.com/mjl-/mox/mtastsdb"
@@ -67,6 +72,8 @@ func setup(t *testing.T) (*store.Account, func()) {
 	tcheck(t, err, "mtastsdb init")
 	err = tlsrptdb.Init()
 	tcheck(t, err, "tlsrptdb init")
+	err = eventdb.Init()
+	tcheck(t, err, "eventdb init")
 	acc, err := store.OpenAccount(log, "mjl", false)
 	tcheck(t, err, "open account")
 	err = acc.SetPassword(log, "testtest")
@@ -83,6 +90,8 @@ func setup(t *testing.T) (*store.Account, func()) {
 		tcheck(t, err, "mtastsdb close")
 		err = tlsrptdb.Close()
 		tcheck(t, err, "tlsrptdb close")
+		err = eventdb.Close()
+		tcheck(t, err, "eventdb close")
 		switchStop()
 	}
 }
@@ -800,6 +809,22 @@ func TestQueue(t *testing.T) {
 	resolver.AllAuthentic = false
 	resolver.TLSA = nil
 
+	// Add message that needs smtputf8, failing immediately because no server supports it.
+	utf8addr, _ := smtp.ParseAddress("møx@mox.example")
+	qml = []Msg{MakeMsg(path, utf8addr.Path(), true, true, int64(len(testmsg)), "<smtputf8unsupported@localhost>", nil, nil, time.Now(), "test")}
+	err = Add(ctxbg, pkglog, "mjl", mf, qml...)
+	tcheck(t, err, "add message to queue for delivery")
+	kick(1, qml[0].ID)
+	testDSN(func(server net.Conn) {
+		fmt.Fprintf(server, "220 mail.mox.example\r\n")
+		br := bufio.NewReader(server)
+		br.ReadString('\n') // Should be EHLO.
+		fmt.Fprintf(server, "250-mail.mox.example\r\n")
+		fmt.Fprintf(server, "250 8BITMIME\r\n")
+		br.ReadString('\n') // Should be QUIT.
+		fmt.Fprintf(server, "221 ok\r\n")
+	})
+
 	// Add message with requiretls that fails immediately due to no verification policy for recipient domain.
 	qml = []Msg{MakeMsg(path, path, false, false, int64(len(testmsg)), "<tlsrequirednopolicy@localhost>", nil, &yes, time.Now(), "test")}
 	err = Add(ctxbg, pkglog, "mjl", mf, qml...)
@@ -917,12 +942,107 @@ func TestQueue(t *testing.T) {
 		t.Fatalf("no dsn in 1s")
 	}
 
+	// Lifecycle of the message is in the event database.
+	events, err := eventdb.DeliveryStatus(ctxbg, "", msg.ID)
+	tcheck(t, err, "delivery status")
+	if len(events) < 3 || events[0].Kind != eventdb.KindQueued || events[1].Kind != eventdb.KindAttempt || events[len(events)-1].Kind != eventdb.KindBounced {
+		t.Fatalf("unexpected delivery events %#v", events)
+	}
+
 	// We shouldn't have any more work to do.
 	msgs, err = List(ctxbg, Filter{}, Sort{})
 	tcheck(t, err, "list messages at end of test")
 	tcompare(t, len(msgs), 0)
 }
 
+// Test DSNs for relayed messages are queued for the (original) sender, and that
+// no DSNs are generated for messages with a null reverse path.
+func TestDSNRelayed(t *testing.T) {
+	acc, cleanup := setup(t)
+	defer cleanup()
+
+	mf := prepareFile(t)
+	defer os.Remove(mf.Name())
+	defer mf.Close()
+
+	localDomain := dns.IPDomain{Domain: dns.Domain{ASCII: "mox.example"}}
+	remote := smtp.Path{Localpart: "remote", IPDomain: dns.IPDomain{Domain: dns.Domain{ASCII: "remote.example"}}}
+	other := smtp.Path{Localpart: "other", IPDomain: dns.IPDomain{Domain: dns.Domain{ASCII: "other.example"}}}
+
+	// fail adds a message to the queue, fails it, and returns the DSN queued as a
+	// result, if any, and its contents.
+	fail := func(sender smtp.Path, relayed bool) (*Msg, string) {
+		t.Helper()
+		qm := MakeMsg(sender, other, false, false, int64(len(testmsg)), "<test@localhost>", nil, nil, time.Now(), "test")
+		qm.Relayed = relayed
+		qm.DSNEnvID = "envid123"
+		qm.DSNORCPT = "rfc822;orig@mox.example"
+		err := Add(ctxbg, pkglog, "mjl", mf, qm)
+		tcheck(t, err, "add message to queue")
+		n, err := Fail(ctxbg, pkglog, Filter{})
+		tcheck(t, err, "fail message")
+		tcompare(t, n, 1)
+
+		l, err := List(ctxbg, Filter{}, Sort{})
+		tcheck(t, err, "list queue")
+		if len(l) == 0 {
+			return nil, ""
+		}
+		tcompare(t, len(l), 1)
+		buf, err := os.ReadFile(l[0].MessagePath())
+		tcheck(t, err, "read dsn message")
+		_, err = Drop(ctxbg, pkglog, Filter{})
+		tcheck(t, err, "drop dsn")
+		return &l[0], string(buf)
+	}
+
+	inboxCount := func() int {
+		t.Helper()
+		n, err := bstore.QueryDB[store.Message](ctxbg, acc.DB).Count()
+		tcheck(t, err, "count messages in account")
+		return n
+	}
+
+	// DSN for relayed message is queued for the sender, not delivered locally.
+	dm, dsnMsg := fail(remote, true)
+	if dm == nil {
+		t.Fatalf("no dsn queued")
+	}
+	tcompare(t, dm.Sender().IsZero(), true)
+	tcompare(t, dm.Recipient().String(), remote.String())
+	tcompare(t, dm.Relayed, true)
+	tcompare(t, dm.SenderAccount, "mjl")
+	tcompare(t, inboxCount(), 0)
+
+	// The DSN contains the envelope id and original recipient.
+	if !strings.Contains(dsnMsg, "Original-Envelope-ID: envid123") || !strings.Contains(dsnMsg, "Original-Recipient: rfc822;orig@mox.example") {
+		t.Fatalf("dsn does not contain envelope id and original recipient:\n%s", dsnMsg)
+	}
+
+	// DSN for a forwarded message with SRS address goes to the original sender.
+	srsFrom := mox.SRSForward(remote, localDomain.Domain)
+	if srsFrom.Localpart == remote.Localpart {
+		t.Fatalf("sender not rewritten with srs")
+	}
+	dm, _ = fail(srsFrom, true)
+	if dm == nil {
+		t.Fatalf("no dsn queued")
+	}
+	tcompare(t, dm.Recipient().String(), remote.String())
+
+	// No DSN for a message with null reverse path, relayed or not.
+	dm, _ = fail(smtp.Path{}, true)
+	tcompare(t, dm, (*Msg)(nil))
+	dm, _ = fail(smtp.Path{}, false)
+	tcompare(t, dm, (*Msg)(nil))
+	tcompare(t, inboxCount(), 0)
+
+	// DSN for a non-relayed message is still delivered to the account.
+	dm, _ = fail(smtp.Path{Localpart: "mjl", IPDomain: localDomain}, false)
+	tcompare(t, dm, (*Msg)(nil))
+	tcompare(t, inboxCount(), 1)
+}
+
 func addCounts(success, failure int64, result tlsrpt.Result) tlsrpt.Result {
 	result.Summary.TotalSuccessfulSessionCount += success
 	result.Summary.TotalFailureSessionCount += failure
@@ -1047,7 +1167,7 @@ func TestRetiredHooks(t *testing.T) {
 			h.Payload = ""
 			h.Submitted = time.Time{}
 			h.NextAttempt = time.Time{}
-			exph := Hook{0, mr.ID, "", mr.MessageID, mr.Subject, mr.Extra, mr.SenderAccount, "http://localhost:1234/outgoing", "Basic dXNlcm5hbWU6cGFzc3dvcmQ=", false, expEvent, "", time.Time{}, 0, time.Time{}, nil}
+			exph := Hook{0, mr.ID, "", mr.MessageID, mr.Subject, mr.Extra, mr.SenderAccount, "http://localhost:1234/outgoing", "Basic dXNlcm5hbWU6cGFzc3dvcmQ=", "", false, expEvent, "", "", time.Time{}, 0, time.Time{}, nil}
 			tcompare(t, h, exph)
 		}
 	}
@@ -1494,3 +1614,88 @@ func fakeCert(t *testing.T, name string, expired bool) tls.Certificate {
 	}
 	return c
 }
+
+func TestMetrics(t *testing.T) {
+	_, cleanup := setup(t)
+	defer cleanup()
+
+	path := smtp.Path{Localpart: "mjl", IPDomain: dns.IPDomain{Domain: dns.Domain{ASCII: "mox.example"}}}
+	mf := prepareFile(t)
+	defer os.Remove(mf.Name())
+	defer mf.Close()
+
+	now := time.Now()
+	qm := MakeMsg(path, path, false, false, int64(len(testmsg)), "<test@localhost>", nil, nil, now, "test")
+	qm1 := qm
+	qm1.Queued = now.Add(-2 * time.Hour)
+	qm2 := qm
+	qm2.Queued = now.Add(-30 * 24 * time.Hour)
+	err := Add(ctxbg, pkglog, "mjl", mf, qm, qm, qm1, qm2)
+	tcheck(t, err, "add messages to queue")
+
+	ch := make(chan prometheus.Metric, 10)
+	queueCollector{}.Collect(ch)
+	close(ch)
+	counts := map[string]float64{}
+	for m := range ch {
+		var dm dto.Metric
+		err := m.Write(&dm)
+		tcheck(t, err, "write metric")
+		labels := map[string]string{}
+		for _, lp := range dm.Label {
+			labels[lp.GetName()] = lp.GetValue()
+		}
+		tcompare(t, labels["domain"], "mox.example")
+		counts[labels["age"]] = dm.Gauge.GetValue()
+	}
+	tcompare(t, counts, map[string]float64{"1h": 2, "6h": 1, "inf": 1})
+}
+
+func TestRouteFailover(t *testing.T) {
+	_, cleanup := setup(t)
+	defer cleanup()
+
+	m := Msg{
+		RecipientLocalpart: "mjl",
+		RecipientDomain:    dns.IPDomain{Domain: dns.Domain{ASCII: "failover.example"}},
+		Attempts:           1,
+	}
+	errDial := errors.New("dial failed")
+	errPerm := smtpclient.Error{Permanent: true, Code: smtp.C550MailboxUnavail, Secode: smtp.SeAddr1UnknownDestMailbox1}
+	errTemp := smtpclient.Error{Code: smtp.C451LocalErr, Secode: smtp.SeSys3Other0}
+
+	check := func(m Msg, err error, exp int) {
+		t.Helper()
+		if idx := routeFailover(m, err); idx != exp {
+			t.Fatalf("failover index for %v: got %d, expected %d", err, idx, exp)
+		}
+	}
+	check(m, errDial, 1)
+	check(m, errPerm, 1)
+	check(m, errTemp, 0)
+	check(m, fmt.Errorf("%w: handshake", smtpclient.ErrTLS), 0)
+	check(m, errSuppressed, 0)
+
+	m.FailoverIndex = 1
+	check(m, errDial, 2)
+	m.FailoverIndex = 2
+	check(m, errDial, 0) // End of chain.
+
+	// Explicitly set transport does not fail over.
+	m.FailoverIndex = 0
+	m.Transport = "submit"
+	check(m, errDial, 0)
+
+	// Routes without failover.
+	m.Transport = ""
+	m.RecipientDomain = dns.IPDomain{Domain: dns.Domain{ASCII: "submit.example"}}
+	check(m, errDial, 0)
+
+	// Transport from failover chain is used for delivery.
+	m.RecipientDomain = dns.IPDomain{Domain: dns.Domain{ASCII: "failover.example"}}
+	route := findRoute(m.Attempts, m)
+	tcompare(t, route.Failover, []string{"submittls", "socks"})
+	if route.ResolvedFailover[0].Submissions == nil || route.ResolvedFailover[1].Socks == nil {
+		t.Fatalf("failover transports not resolved")
+	}
+}
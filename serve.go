@@ -1,62 +1,28 @@
 package main
 
 import (
-	"fmt"
+	"context"
 	"os"
 	"time"
 
-	"github.com/mjl-/mox/dmarcdb"
-	"github.com/mjl-/mox/dns"
-	"github.com/mjl-/mox/http"
-	"github.com/mjl-/mox/imapserver"
 	"github.com/mjl-/mox/mlog"
 	"github.com/mjl-/mox/mox-"
-	"github.com/mjl-/mox/mtastsdb"
-	"github.com/mjl-/mox/queue"
-	"github.com/mjl-/mox/smtpserver"
-	"github.com/mjl-/mox/store"
-	"github.com/mjl-/mox/tlsrptdb"
-	"github.com/mjl-/mox/tlsrptsend"
+	"github.com/mjl-/mox/moxserver"
 )
 
 func shutdown(log mlog.Log) {
-	// We indicate we are shutting down. Causes new connections and new SMTP commands
-	// to be rejected. Should stop active connections pretty quickly.
-	mox.ShutdownCancel()
-
-	// Now we are going to wait for all connections to be gone, up to a timeout.
-	done := mox.Connections.Done()
-	second := time.Tick(time.Second)
-	select {
-	case <-done:
-		log.Print("connections shutdown, waiting until 1 second passed")
-		<-second
-
-	case <-time.Tick(3 * time.Second):
-		// We now cancel all pending operations, and set an immediate deadline on sockets.
-		// Should get us a clean shutdown relatively quickly.
-		mox.ContextCancel()
-		mox.Connections.Shutdown()
-
-		second := time.Tick(time.Second)
-		select {
-		case <-done:
-			log.Print("no more connections, shutdown is clean, waiting until 1 second passed")
-			<-second // Still wait for second, giving processes like imports a chance to clean up.
-		case <-second:
-			log.Print("shutting down with pending sockets")
-		}
-	}
-	err := os.Remove(mox.DataDirPath("ctl"))
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := moxserver.Shutdown(ctx, log)
+	log.Check(err, "shutdown")
+	err = os.Remove(mox.DataDirPath("ctl"))
 	log.Check(err, "removing ctl unix domain socket during shutdown")
 }
 
 // start initializes all packages, starts all listeners and the switchboard
 // goroutine, then returns.
 func start(mtastsdbRefresher, sendDMARCReports, sendTLSReports, skipForkExec bool) error {
-	smtpserver.Listen()
-	imapserver.Listen()
-	http.Listen()
+	moxserver.Listen()
 
 	if !skipForkExec {
 		// If we were just launched as root, fork and exec as unprivileged user, handing
@@ -70,43 +36,5 @@ func start(mtastsdbRefresher, sendDMARCReports, sendTLSReports, skipForkExec boo
 		}
 	}
 
-	if err := mtastsdb.Init(mtastsdbRefresher); err != nil {
-		return fmt.Errorf("mtastsdb init: %s", err)
-	}
-
-	if err := tlsrptdb.Init(); err != nil {
-		return fmt.Errorf("tlsrptdb init: %s", err)
-	}
-
-	if err := dmarcdb.Init(); err != nil {
-		return fmt.Errorf("dmarcdb init: %s", err)
-	}
-
-	if err := store.Init(mox.Context); err != nil {
-		return fmt.Errorf("store init: %s", err)
-	}
-
-	done := make(chan struct{}) // Goroutines for messages and webhooks, and cleaners.
-	if err := queue.Start(dns.StrictResolver{Pkg: "queue"}, done); err != nil {
-		return fmt.Errorf("queue start: %s", err)
-	}
-
-	if sendDMARCReports {
-		dmarcdb.Start(dns.StrictResolver{Pkg: "dmarcdb"})
-	}
-
-	if sendTLSReports {
-		tlsrptsend.Start(dns.StrictResolver{Pkg: "tlsrptsend"})
-	}
-
-	store.StartAuthCache()
-	smtpserver.Serve()
-	imapserver.Serve()
-	http.Serve()
-
-	go func() {
-		store.Switchboard()
-		<-make(chan struct{})
-	}()
-	return nil
+	return moxserver.Serve(mtastsdbRefresher, sendDMARCReports, sendTLSReports)
 }
@@ -0,0 +1,474 @@
+package sieve
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/textproto"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding/ianaindex"
+
+	"github.com/mjl-/mox/message"
+)
+
+// Maximum number of redirect actions, to limit the damage of a misconfigured or
+// abused script.
+const maxRedirects = 5
+
+// Maximum number of bytes of the message body, or of each part, that a body test
+// matches against.
+const maxBodySize = 1024 * 1024
+
+var errTooManyRedirects = errors.New("too many redirects")
+
+// Message is the input for evaluating a script.
+type Message struct {
+	EnvelopeFrom string               // SMTP MAIL FROM address, empty for the null reverse path.
+	EnvelopeTo   string               // SMTP RCPT TO address the message is delivered to.
+	Header       textproto.MIMEHeader // Message header, values as in the message, not yet decoded.
+	Size         int64
+	Part         *message.Part // Parsed message with reader, for the "body" test. If nil, body tests don't match.
+}
+
+// Result holds the actions from evaluating a script, to be executed by the
+// caller.
+type Result struct {
+	Keep     bool      // Deliver to the default mailbox, through explicit or implicit keep.
+	FileInto []string  // Additional mailboxes to deliver to.
+	Redirect []string  // Addresses to redirect the message to.
+	Vacation *Vacation // If set, a vacation response must be sent, unless recently sent.
+	Notify   []Notify  // Notifications to send.
+
+	// If set, through "reject" or "ereject", the message must not be delivered but
+	// refused, with RejectReason as explanation for the sender.
+	Reject       bool
+	RejectReason string
+}
+
+// Vacation is the vacation action, for sending an automatic response.
+type Vacation struct {
+	Days      int      // Number of days during which no new response is sent to the same sender.
+	Subject   string   // Subject for the response, "Auto: " followed by original subject if empty.
+	From      string   // Optional address to use as From.
+	Addresses []string // Additional addresses of the recipient. The recipient must be in To/Cc for a response to be sent.
+	MIME      bool     // If set, Reason is a MIME entity with headers.
+	Handle    string   // Identifies this vacation action for tracking sent responses. Empty means the other parameters form the handle.
+	Reason    string
+}
+
+// Notify is the notify action, for sending a notification.
+type Notify struct {
+	Method     string   // URI, e.g. "mailto:user@example.org" or "ntfy://ntfy.sh/topic".
+	From       string   // Optional. Used as From for the mailto method.
+	Importance int      // 1 is high, 2 normal, 3 low.
+	Options    []string // Method-specific options, typically "name=value".
+	Message    string   // Optional, a default message is generated if empty.
+}
+
+// Eval evaluates the script for a message. On error, the returned result has
+// only Keep set, i.e. the message must be delivered to the default mailbox.
+func (s *Script) Eval(m Message) (Result, error) {
+	e := evaluator{m: m}
+	_, err := e.commands(s.commands)
+	if err != nil {
+		return Result{Keep: true}, err
+	}
+	r := e.r
+	// ../rfc/5429
+	if r.Reject && (e.keep || len(r.FileInto) > 0 || len(r.Redirect) > 0 || r.Vacation != nil) {
+		return Result{Keep: true}, fmt.Errorf("reject cannot be combined with keep, fileinto, redirect or vacation")
+	}
+	// Without explicit keep, discard/fileinto/redirect/reject cancel the implicit keep.
+	r.Keep = e.keep || !e.cancelKeep
+	return r, nil
+}
+
+type evaluator struct {
+	m          Message
+	r          Result
+	keep       bool // Explicit keep.
+	cancelKeep bool
+}
+
+// commands executes commands, returning true if evaluation must stop.
+func (e *evaluator) commands(l []command) (bool, error) {
+	for _, c := range l {
+		switch c := c.(type) {
+		case *cmdIf:
+			block := c.elseBlock
+			for i, t := range c.tests {
+				if e.test(t) {
+					block = c.blocks[i]
+					break
+				}
+			}
+			if stop, err := e.commands(block); stop || err != nil {
+				return stop, err
+			}
+		case cmdStop:
+			return true, nil
+		case cmdKeep:
+			e.keep = true
+		case cmdDiscard:
+			e.cancelKeep = true
+		case cmdFileInto:
+			e.cancelKeep = true
+			if !slices.Contains(e.r.FileInto, c.mailbox) {
+				e.r.FileInto = append(e.r.FileInto, c.mailbox)
+			}
+		case cmdRedirect:
+			e.cancelKeep = true
+			if slices.ContainsFunc(e.r.Redirect, func(s string) bool { return strings.EqualFold(s, c.address) }) {
+				continue
+			}
+			if len(e.r.Redirect) >= maxRedirects {
+				return true, errTooManyRedirects
+			}
+			e.r.Redirect = append(e.r.Redirect, c.address)
+		case cmdReject:
+			if e.r.Reject {
+				return true, fmt.Errorf("multiple reject actions")
+			}
+			e.cancelKeep = true
+			e.r.Reject = true
+			e.r.RejectReason = c.reason
+		case cmdVacation:
+			if e.r.Vacation != nil {
+				return true, fmt.Errorf("multiple vacation actions")
+			}
+			v := c.Vacation
+			e.r.Vacation = &v
+		case cmdNotify:
+			// Identical notifications are sent only once.
+			if !slices.ContainsFunc(e.r.Notify, func(n Notify) bool {
+				return n.Method == c.Method && n.Message == c.Message && slices.Equal(n.Options, c.Options)
+			}) {
+				e.r.Notify = append(e.r.Notify, c.Notify)
+			}
+		default:
+			panic(fmt.Sprintf("unknown command %T", c))
+		}
+	}
+	return false, nil
+}
+
+func (e *evaluator) test(t test) bool {
+	switch t := t.(type) {
+	case testTrue:
+		return true
+	case testFalse:
+		return false
+	case testNot:
+		return !e.test(t.test)
+	case testAllOf:
+		for _, tt := range t.tests {
+			if !e.test(tt) {
+				return false
+			}
+		}
+		return true
+	case testAnyOf:
+		for _, tt := range t.tests {
+			if e.test(tt) {
+				return true
+			}
+		}
+		return false
+	case testAddress:
+		var values []string
+		for _, h := range t.headers {
+			if t.envelope {
+				if h == "from" {
+					values = append(values, addrPart(e.m.EnvelopeFrom, t.part))
+				} else {
+					values = append(values, addrPart(e.m.EnvelopeTo, t.part))
+				}
+				continue
+			}
+			for _, v := range e.m.Header.Values(h) {
+				addrs, err := message.ParseAddressList(v)
+				if err != nil {
+					// Not a valid address list, compare the whole value with :all.
+					if t.part == partAll {
+						values = append(values, strings.TrimSpace(decodeHeader(v)))
+					}
+					continue
+				}
+				for _, a := range addrs {
+					values = append(values, addrPart(a.User+"@"+a.Host, t.part))
+				}
+			}
+		}
+		return t.match.any(values, t.keys)
+	case testHeader:
+		var values []string
+		for _, h := range t.headers {
+			for _, v := range e.m.Header.Values(h) {
+				values = append(values, strings.TrimSpace(decodeHeader(v)))
+			}
+		}
+		return t.match.any(values, t.keys)
+	case testExists:
+		for _, h := range t.headers {
+			if len(e.m.Header.Values(h)) == 0 {
+				return false
+			}
+		}
+		return true
+	case testBody:
+		return t.match.any(e.bodyValues(t), t.keys)
+	case testSize:
+		if t.over {
+			return e.m.Size > t.limit
+		}
+		return e.m.Size < t.limit
+	case testValidNotifyMethod:
+		for _, uri := range t.uris {
+			if CheckMethod(uri) != nil {
+				return false
+			}
+		}
+		return true
+	case testNotifyMethodCapability:
+		// We only know the "online" capability, and can't tell if a recipient is
+		// online.
+		if t.capability != "online" || CheckMethod(t.uri) != nil {
+			return false
+		}
+		return t.match.any([]string{"maybe"}, t.keys)
+	}
+	panic(fmt.Sprintf("unknown test %T", t))
+}
+
+// bodyValues returns the texts to match for a body test: The undecoded body of
+// the message for transform "raw", the decoded text parts for "text", and the
+// decoded parts with one of the content types for "content".
+func (e *evaluator) bodyValues(t testBody) []string {
+	if e.m.Part == nil {
+		return nil
+	}
+	read := func(r io.Reader) string {
+		// We use what we could read, also on errors.
+		buf, _ := io.ReadAll(io.LimitReader(r, maxBodySize))
+		return string(buf)
+	}
+	if t.transform == "raw" {
+		return []string{read(e.m.Part.RawReader())}
+	}
+
+	var values []string
+	var walk func(p *message.Part)
+	walk = func(p *message.Part) {
+		if len(p.Parts) > 0 {
+			for i := range p.Parts {
+				walk(&p.Parts[i])
+			}
+			return
+		}
+		mt, st := strings.ToLower(p.MediaType), strings.ToLower(p.MediaSubType)
+		if mt == "" {
+			mt, st = "text", "plain"
+		}
+		if t.transform == "text" && mt != "text" || t.transform == "content" && !slices.ContainsFunc(t.contentTypes, func(ct string) bool {
+			ct = strings.ToLower(ct)
+			return ct == "" || ct == mt || ct == mt+"/"+st
+		}) {
+			return
+		}
+		if mt == "text" {
+			values = append(values, read(p.ReaderUTF8OrBinary()))
+		} else {
+			values = append(values, read(p.Reader()))
+		}
+	}
+	walk(e.m.Part)
+	return values
+}
+
+func addrPart(addr string, part addressPart) string {
+	if part == partAll {
+		return addr
+	}
+	i := strings.LastIndexByte(addr, '@')
+	if i < 0 {
+		if part == partLocalpart {
+			return addr
+		}
+		return ""
+	}
+	if part == partLocalpart {
+		return addr[:i]
+	}
+	return addr[i+1:]
+}
+
+// any returns whether any of the values matches any of the keys. For match type
+// "count", the number of values is compared with the keys.
+func (m match) any(values, keys []string) bool {
+	if m.typ == "count" {
+		n := fmt.Sprintf("%d", len(values))
+		return slices.ContainsFunc(keys, func(k string) bool {
+			return m.relate(m.compare(n, k))
+		})
+	}
+	for _, v := range values {
+		for _, k := range keys {
+			if m.matches(v, k) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (m match) matches(value, key string) bool {
+	switch m.typ {
+	case "is":
+		return m.compare(value, key) == 0
+	case "value":
+		return m.relate(m.compare(value, key))
+	}
+	if !m.octet {
+		value = asciiLower(value)
+		key = asciiLower(key)
+	}
+	switch m.typ {
+	case "contains":
+		return strings.Contains(value, key)
+	case "matches":
+		return globMatch(value, key)
+	}
+	panic("unknown match type " + m.typ)
+}
+
+// compare returns -1, 0 or 1 if value is less than, equal to or greater than key
+// according to the comparator.
+func (m match) compare(value, key string) int {
+	if m.numeric {
+		return compareNumeric(value, key)
+	} else if !m.octet {
+		value = asciiLower(value)
+		key = asciiLower(key)
+	}
+	return strings.Compare(value, key)
+}
+
+// relate returns whether comparison result cmp satisfies the relation.
+func (m match) relate(cmp int) bool {
+	switch m.relation {
+	case "gt":
+		return cmp > 0
+	case "ge":
+		return cmp >= 0
+	case "lt":
+		return cmp < 0
+	case "le":
+		return cmp <= 0
+	case "eq":
+		return cmp == 0
+	case "ne":
+		return cmp != 0
+	}
+	panic("unknown relation " + m.relation)
+}
+
+// compareNumeric compares the numbers at the start of a and b, for comparator
+// "i;ascii-numeric". Strings not starting with a digit are equal to each other,
+// and greater than any number. ../rfc/4790
+func compareNumeric(a, b string) int {
+	number := func(s string) (string, bool) {
+		n := 0
+		for n < len(s) && s[n] >= '0' && s[n] <= '9' {
+			n++
+		}
+		return strings.TrimLeft(s[:n], "0"), n > 0
+	}
+	an, aok := number(a)
+	bn, bok := number(b)
+	switch {
+	case !aok && !bok:
+		return 0
+	case !aok:
+		return 1
+	case !bok:
+		return -1
+	case len(an) != len(bn):
+		if len(an) < len(bn) {
+			return -1
+		}
+		return 1
+	}
+	return strings.Compare(an, bn)
+}
+
+// The "i;ascii-casemap" comparator only folds ASCII letters.
+func asciiLower(s string) string {
+	b := []byte(s)
+	for i, c := range b {
+		if c >= 'A' && c <= 'Z' {
+			b[i] = c + ('a' - 'A')
+		}
+	}
+	return string(b)
+}
+
+// globMatch matches s against pattern, with "*" matching zero or more
+// characters, "?" a single character and backslash escaping the next character.
+func globMatch(s, pattern string) bool {
+	if pattern == "" {
+		return s == ""
+	}
+	switch c := pattern[0]; c {
+	case '*':
+		for i := 0; i <= len(s); i++ {
+			if globMatch(s[i:], pattern[1:]) {
+				return true
+			}
+		}
+		return false
+	case '?':
+		if s == "" {
+			return false
+		}
+		// Single character, not byte.
+		_, size := utf8.DecodeRuneInString(s)
+		return globMatch(s[size:], pattern[1:])
+	case '\\':
+		if len(pattern) > 1 {
+			pattern = pattern[1:]
+		}
+		fallthrough
+	default:
+		return s != "" && s[0] == pattern[0] && globMatch(s[1:], pattern[1:])
+	}
+}
+
+var wordDecoder = mime.WordDecoder{
+	CharsetReader: func(charset string, r io.Reader) (io.Reader, error) {
+		switch strings.ToLower(charset) {
+		case "", "us-ascii", "utf-8":
+			return r, nil
+		}
+		enc, _ := ianaindex.MIME.Encoding(charset)
+		if enc == nil {
+			enc, _ = ianaindex.IANA.Encoding(charset)
+		}
+		if enc == nil {
+			return r, fmt.Errorf("unknown charset %q", charset)
+		}
+		return enc.NewDecoder().Reader(r), nil
+	},
+}
+
+// decodeHeader decodes RFC 2047 encoded-words, returning the original value on
+// errors.
+func decodeHeader(s string) string {
+	if r, err := wordDecoder.DecodeHeader(s); err == nil {
+		return r
+	}
+	return s
+}
@@ -0,0 +1,337 @@
+package sieve
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/mjl-/mox/mlog"
+	"github.com/mjl-/mox/moxvar"
+)
+
+// Notification is a notify action for a delivered message, to be sent by a
+// Notifier.
+type Notification struct {
+	Notify
+	Account   string // Account the message was delivered to.
+	Recipient string // Address the message was delivered to.
+	MsgFrom   string // Address from message From header, can be empty.
+	Subject   string // Decoded subject of the message.
+}
+
+// Text returns the message of the notification, either specified in the
+// script, or a short summary of the message.
+func (n Notification) Text() string {
+	if n.Message != "" {
+		return n.Message
+	}
+	from := n.MsgFrom
+	if from == "" {
+		from = "(unknown sender)"
+	}
+	return fmt.Sprintf("%s: %s", from, n.Subject)
+}
+
+// Notifier sends notifications for a notification method, identified by the
+// scheme of the method URI.
+type Notifier interface {
+	// Check returns an error if the method URI is not valid for this notifier.
+	Check(uri *url.URL) error
+
+	// Send sends the notification. Called outside of the SMTP transaction, may
+	// take a while.
+	Send(ctx context.Context, log mlog.Log, uri *url.URL, n Notification) error
+}
+
+// Notifiers by lower-case URI scheme. The "mailto" notifier is registered by
+// the smtpserver package, which can queue messages.
+var notifiers = map[string]Notifier{
+	"http":   webhookNotifier{},
+	"https":  webhookNotifier{},
+	"ntfy":   ntfyNotifier{},
+	"gotify": gotifyNotifier{},
+}
+
+// Register registers a notifier for a URI scheme, replacing any existing
+// notifier. Must be called during initialization, before scripts are parsed.
+func Register(scheme string, n Notifier) {
+	notifiers[strings.ToLower(scheme)] = n
+}
+
+// Methods returns the URI schemes of the registered notifiers, sorted. Methods
+// over HTTP are only included if enabled with HTTPNotifyPolicy.
+func Methods() []string {
+	httpEnabled := len(httpPolicy().Hosts) > 0
+	l := make([]string, 0, len(notifiers))
+	for scheme, n := range notifiers {
+		switch n.(type) {
+		case webhookNotifier, ntfyNotifier, gotifyNotifier:
+			if !httpEnabled {
+				continue
+			}
+		}
+		l = append(l, scheme)
+	}
+	slices.Sort(l)
+	return l
+}
+
+// Send sends notification n through the notifier for its method.
+func Send(ctx context.Context, log mlog.Log, n Notification) error {
+	u, err := url.Parse(n.Method)
+	if err != nil {
+		return fmt.Errorf("parsing notify method: %v", err)
+	}
+	notifier, ok := notifiers[strings.ToLower(u.Scheme)]
+	if !ok {
+		return fmt.Errorf("unsupported notify method %q", u.Scheme)
+	}
+	return notifier.Send(ctx, log, u, n)
+}
+
+// HTTPPolicy restricts notifications with the http, https, ntfy and gotify
+// methods. Sieve scripts are managed by account users, who should not be able to
+// make the server send requests to arbitrary (internal) hosts.
+type HTTPPolicy struct {
+	// Hosts notifications can be sent to. A leading "*." matches subdomains, a single
+	// "*" matches all hosts. If empty, no notifications over HTTP are sent.
+	Hosts []string
+
+	// If set, connections to loopback, private, link-local and unspecified IPs are
+	// allowed. Otherwise they are refused when dialing, so a host name resolving to
+	// such an IP, e.g. through DNS rebinding, doesn't help.
+	AllowPrivateIPs bool
+}
+
+// HTTPNotifyPolicy returns the current policy for notifications over HTTP. Set
+// during initialization, typically based on the configuration. If nil, no
+// notifications over HTTP are sent.
+var HTTPNotifyPolicy func() HTTPPolicy
+
+func httpPolicy() HTTPPolicy {
+	if HTTPNotifyPolicy == nil {
+		return HTTPPolicy{}
+	}
+	return HTTPNotifyPolicy()
+}
+
+// hostAllowed returns whether host matches one of the hosts of the policy.
+func (p HTTPPolicy) hostAllowed(host string) bool {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	for _, h := range p.Hosts {
+		if h == "*" || h == host || strings.HasPrefix(h, "*.") && strings.HasSuffix(host, h[1:]) {
+			return true
+		}
+	}
+	return false
+}
+
+// TLS config for HTTP notifications. Tests can replace it.
+var httpTLSConfig *tls.Config
+
+// httpClient returns a client for notifications. Unless allowPrivateIPs is set,
+// connections to non-public IPs are refused.
+func httpClient(allowPrivateIPs bool) *http.Client {
+	dialer := &net.Dialer{Timeout: 30 * time.Second}
+	if !allowPrivateIPs {
+		dialer.Control = dialControlPublic
+	}
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	// With a proxy, we would only check the IP of the proxy.
+	t.Proxy = nil
+	t.DialContext = dialer.DialContext
+	t.TLSClientConfig = httpTLSConfig
+	t.DisableKeepAlives = true
+	return &http.Client{
+		Transport: t,
+		Timeout:   30 * time.Second,
+		// A redirect could send us to a host that isn't allowed.
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// dialControlPublic is called for each connection attempt, with the resolved IP in
+// address, and refuses connections to non-public IPs.
+func dialControlPublic(network, address string, c syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return fmt.Errorf("parsing dial address: %v", err)
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return fmt.Errorf("dial address %q is not an ip", host)
+	}
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified() {
+		return fmt.Errorf("connection to non-public ip %s refused", ip)
+	}
+	return nil
+}
+
+func httpPost(ctx context.Context, u *url.URL, hdrs http.Header, body []byte) error {
+	policy := httpPolicy()
+	if !policy.hostAllowed(u.Hostname()) {
+		return fmt.Errorf("notifications to host %q not allowed by configuration", u.Hostname())
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", u.String(), bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("new request: %v", err)
+	}
+	req.Header = hdrs
+	req.Header.Set("User-Agent", "mox/"+moxvar.Version)
+	resp, err := httpClient(policy.AllowPrivateIPs).Do(req)
+	if err != nil {
+		return fmt.Errorf("http post: %v", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 1024))
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("http post: got status %q, expected 2xx", resp.Status)
+	}
+	return nil
+}
+
+func checkHTTPURL(u *url.URL) error {
+	if u.Host == "" {
+		return fmt.Errorf("missing host")
+	}
+	if u.Fragment != "" {
+		return fmt.Errorf("fragment not allowed")
+	}
+	return nil
+}
+
+// WebhookNotification is the JSON body of notifications sent to http and https
+// methods.
+type WebhookNotification struct {
+	Version    int      // Always 0 for now.
+	Account    string   // Account the message was delivered to.
+	Recipient  string   // Address the message was delivered to.
+	From       string   // Address in message From header.
+	Subject    string   // Decoded subject.
+	Importance int      // 1 is high, 2 normal, 3 low.
+	Options    []string // From the notify action.
+	Message    string   // Message specified in the notify action, or summary of message.
+}
+
+// webhookNotifier does an HTTP POST with a JSON WebhookNotification to the URI.
+type webhookNotifier struct{}
+
+func (webhookNotifier) Check(u *url.URL) error {
+	return checkHTTPURL(u)
+}
+
+func (webhookNotifier) Send(ctx context.Context, log mlog.Log, u *url.URL, n Notification) error {
+	wn := WebhookNotification{0, n.Account, n.Recipient, n.MsgFrom, n.Subject, n.Importance, n.Options, n.Text()}
+	buf, err := json.Marshal(wn)
+	if err != nil {
+		return fmt.Errorf("marshal webhook notification: %v", err)
+	}
+	hdrs := http.Header{}
+	hdrs.Set("Content-Type", "application/json; charset=utf-8")
+	uc := *u
+	if uc.User != nil {
+		// Credentials in the URI are sent as basic authentication.
+		pw, _ := uc.User.Password()
+		hdrs.Set("Authorization", "Basic "+basicAuth(uc.User.Username(), pw))
+		uc.User = nil
+	}
+	return httpPost(ctx, &uc, hdrs, buf)
+}
+
+func basicAuth(username, password string) string {
+	return base64.StdEncoding.EncodeToString([]byte(username + ":" + password))
+}
+
+// ntfyNotifier publishes to an ntfy topic, with URIs of the form
+// "ntfy://host[:port]/topic", published to over HTTPS. A username with password
+// in the URI is used for basic authentication, a username without password as
+// access token.
+type ntfyNotifier struct{}
+
+func (ntfyNotifier) Check(u *url.URL) error {
+	if err := checkHTTPURL(u); err != nil {
+		return err
+	}
+	if strings.Trim(u.Path, "/") == "" {
+		return fmt.Errorf("missing topic in path")
+	}
+	return nil
+}
+
+func (ntfyNotifier) Send(ctx context.Context, log mlog.Log, u *url.URL, n Notification) error {
+	hdrs := http.Header{}
+	if n.Subject != "" {
+		hdrs.Set("Title", mime.QEncoding.Encode("utf-8", n.Subject))
+	}
+	// ntfy priorities are 1 (min) to 5 (max), with 3 as default.
+	hdrs.Set("Priority", strconv.Itoa(5-n.Importance))
+	hdrs.Set("Tags", "email")
+	uc := *u
+	uc.Scheme = "https"
+	if uc.User != nil {
+		if pw, ok := uc.User.Password(); ok {
+			hdrs.Set("Authorization", "Basic "+basicAuth(uc.User.Username(), pw))
+		} else {
+			hdrs.Set("Authorization", "Bearer "+uc.User.Username())
+		}
+		uc.User = nil
+	}
+	return httpPost(ctx, &uc, hdrs, []byte(n.Text()))
+}
+
+// gotifyNotifier sends messages to a gotify server, with URIs of the form
+// "gotify://host[:port][/path]?token=apptoken", sent over HTTPS.
+type gotifyNotifier struct{}
+
+func (gotifyNotifier) Check(u *url.URL) error {
+	if err := checkHTTPURL(u); err != nil {
+		return err
+	}
+	if u.Query().Get("token") == "" {
+		return fmt.Errorf("missing token parameter")
+	}
+	return nil
+}
+
+func (gotifyNotifier) Send(ctx context.Context, log mlog.Log, u *url.URL, n Notification) error {
+	// Gotify priorities are 0 to 10, with high priority starting at 8.
+	var priority int
+	switch n.Importance {
+	case 1:
+		priority = 8
+	case 2:
+		priority = 5
+	default:
+		priority = 2
+	}
+	msg := struct {
+		Title    string `json:"title"`
+		Message  string `json:"message"`
+		Priority int    `json:"priority"`
+	}{n.Subject, n.Text(), priority}
+	buf, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("marshal gotify message: %v", err)
+	}
+	hdrs := http.Header{}
+	hdrs.Set("Content-Type", "application/json; charset=utf-8")
+	hdrs.Set("X-Gotify-Key", u.Query().Get("token"))
+	uc := url.URL{Scheme: "https", Host: u.Host, Path: strings.TrimSuffix(u.Path, "/") + "/message"}
+	return httpPost(ctx, &uc, hdrs, buf)
+}
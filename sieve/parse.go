@@ -0,0 +1,409 @@
+package sieve
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ParseError is returned for syntax and semantic errors in a script.
+type ParseError struct {
+	Line int
+	Msg  string
+}
+
+func (e ParseError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Msg)
+}
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokTag
+	tokNumber
+	tokString
+	tokLBracket
+	tokRBracket
+	tokLParen
+	tokRParen
+	tokLBrace
+	tokRBrace
+	tokComma
+	tokSemicolon
+)
+
+type token struct {
+	kind tokenKind
+	line int
+	s    string // Lower-cased identifier or tag (without colon), or string value.
+	num  int64
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case tokEOF:
+		return "end of script"
+	case tokIdent:
+		return fmt.Sprintf("identifier %q", t.s)
+	case tokTag:
+		return fmt.Sprintf("tag :%s", t.s)
+	case tokNumber:
+		return fmt.Sprintf("number %d", t.num)
+	case tokString:
+		return fmt.Sprintf("string %q", t.s)
+	}
+	return fmt.Sprintf("%q", "[](){},;"[t.kind-tokLBracket])
+}
+
+type lexer struct {
+	s    string
+	o    int
+	line int
+}
+
+func (l *lexer) xerrorf(format string, args ...any) {
+	panic(ParseError{l.line, fmt.Sprintf(format, args...)})
+}
+
+// skip whitespace and comments.
+func (l *lexer) skip() {
+	for l.o < len(l.s) {
+		switch c := l.s[l.o]; {
+		case c == '\n':
+			l.line++
+			l.o++
+		case c == ' ' || c == '\t' || c == '\r':
+			l.o++
+		case c == '#':
+			for l.o < len(l.s) && l.s[l.o] != '\n' {
+				l.o++
+			}
+		case strings.HasPrefix(l.s[l.o:], "/*"):
+			end := strings.Index(l.s[l.o+2:], "*/")
+			if end < 0 {
+				l.xerrorf("unterminated comment")
+			}
+			l.line += strings.Count(l.s[l.o:l.o+2+end], "\n")
+			l.o += 2 + end + 2
+		default:
+			return
+		}
+	}
+}
+
+func isIdentChar(c byte, first bool) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_' || !first && c >= '0' && c <= '9'
+}
+
+func (l *lexer) next() token {
+	l.skip()
+	if l.o >= len(l.s) {
+		return token{kind: tokEOF, line: l.line}
+	}
+	line := l.line
+	c := l.s[l.o]
+	if i := strings.IndexByte("[](){},;", c); i >= 0 {
+		l.o++
+		return token{kind: tokLBracket + tokenKind(i), line: line}
+	}
+	switch {
+	case c == '"':
+		return token{kind: tokString, line: line, s: l.quoted()}
+	case c >= '0' && c <= '9':
+		o := l.o
+		for l.o < len(l.s) && l.s[l.o] >= '0' && l.s[l.o] <= '9' {
+			l.o++
+		}
+		v, err := strconv.ParseInt(l.s[o:l.o], 10, 64)
+		if err != nil {
+			l.xerrorf("parsing number: %v", err)
+		}
+		if l.o < len(l.s) {
+			var shift int
+			switch l.s[l.o] {
+			case 'k', 'K':
+				shift = 10
+			case 'm', 'M':
+				shift = 20
+			case 'g', 'G':
+				shift = 30
+			}
+			if shift > 0 {
+				l.o++
+				if v > 1<<(62-shift) {
+					l.xerrorf("number too large")
+				}
+				v <<= shift
+			}
+		}
+		return token{kind: tokNumber, line: line, num: v}
+	case c == ':':
+		l.o++
+		if l.o >= len(l.s) || !isIdentChar(l.s[l.o], true) {
+			l.xerrorf("missing identifier after colon")
+		}
+		return token{kind: tokTag, line: line, s: l.ident()}
+	case isIdentChar(c, true):
+		s := l.ident()
+		if s == "text" && l.o < len(l.s) && l.s[l.o] == ':' {
+			l.o++
+			return token{kind: tokString, line: line, s: l.multiline()}
+		}
+		return token{kind: tokIdent, line: line, s: s}
+	}
+	l.xerrorf("unexpected character %q", c)
+	panic("not reached")
+}
+
+func (l *lexer) ident() string {
+	o := l.o
+	for l.o < len(l.s) && isIdentChar(l.s[l.o], l.o == o) {
+		l.o++
+	}
+	return strings.ToLower(l.s[o:l.o])
+}
+
+// quoted-string, with backslash escapes. Escapes other than \" and \\ are
+// undefined, we use the escaped character.
+func (l *lexer) quoted() string {
+	l.o++
+	var b strings.Builder
+	for {
+		if l.o >= len(l.s) {
+			l.xerrorf("unterminated string")
+		}
+		c := l.s[l.o]
+		l.o++
+		switch c {
+		case '"':
+			return b.String()
+		case '\\':
+			if l.o >= len(l.s) {
+				l.xerrorf("unterminated string")
+			}
+			c = l.s[l.o]
+			l.o++
+		case '\n':
+			l.line++
+		}
+		b.WriteByte(c)
+	}
+}
+
+// multi-line string after "text:", ending with a line with a single dot. Lines
+// starting with a dot have the dot removed.
+func (l *lexer) multiline() string {
+	// Only whitespace and a hash comment are allowed on the rest of the line.
+	for l.o < len(l.s) && (l.s[l.o] == ' ' || l.s[l.o] == '\t') {
+		l.o++
+	}
+	if l.o < len(l.s) && l.s[l.o] == '#' {
+		for l.o < len(l.s) && l.s[l.o] != '\n' {
+			l.o++
+		}
+	}
+	if l.o < len(l.s) && l.s[l.o] == '\r' {
+		l.o++
+	}
+	if l.o >= len(l.s) || l.s[l.o] != '\n' {
+		l.xerrorf("expected newline after text:")
+	}
+	l.o++
+	l.line++
+
+	var b strings.Builder
+	for {
+		if l.o >= len(l.s) {
+			l.xerrorf("unterminated multi-line string")
+		}
+		line, _, found := strings.Cut(l.s[l.o:], "\n")
+		if !found {
+			l.xerrorf("unterminated multi-line string")
+		}
+		l.o += len(line) + 1
+		l.line++
+		line = strings.TrimSuffix(line, "\r")
+		if line == "." {
+			return b.String()
+		}
+		line = strings.TrimPrefix(line, ".")
+		b.WriteString(line)
+		b.WriteString("\r\n")
+	}
+}
+
+// Generic syntax tree, before checking commands and their arguments.
+
+type rawArg struct {
+	tag  string // Tagged argument, without colon, lower case.
+	num  *int64
+	strs []string // Single string or string list.
+	list bool     // Whether strs is a string list.
+	line int
+}
+
+type rawTest struct {
+	name  string
+	args  []rawArg
+	tests []rawTest
+	line  int
+}
+
+type rawCommand struct {
+	name     string
+	args     []rawArg
+	tests    []rawTest
+	block    []rawCommand
+	hasBlock bool
+	line     int
+}
+
+type parser struct {
+	l    *lexer
+	peek *token
+}
+
+func (p *parser) next() token {
+	if p.peek != nil {
+		t := *p.peek
+		p.peek = nil
+		return t
+	}
+	return p.l.next()
+}
+
+func (p *parser) look() token {
+	if p.peek == nil {
+		t := p.l.next()
+		p.peek = &t
+	}
+	return *p.peek
+}
+
+func (p *parser) xerrorf(t token, format string, args ...any) {
+	panic(ParseError{t.line, fmt.Sprintf(format, args...)})
+}
+
+func (p *parser) xexpect(kind tokenKind, what string) token {
+	t := p.next()
+	if t.kind != kind {
+		p.xerrorf(t, "expected %s, got %s", what, t)
+	}
+	return t
+}
+
+// commands parses commands until end of script or closing brace.
+func (p *parser) commands(nested bool) []rawCommand {
+	var l []rawCommand
+	for {
+		t := p.look()
+		if t.kind == tokEOF {
+			if nested {
+				p.xerrorf(t, "missing closing brace")
+			}
+			return l
+		}
+		if t.kind == tokRBrace {
+			if !nested {
+				p.xerrorf(t, "unexpected closing brace")
+			}
+			p.next()
+			return l
+		}
+		l = append(l, p.command())
+	}
+}
+
+func (p *parser) command() rawCommand {
+	t := p.xexpect(tokIdent, "command")
+	c := rawCommand{name: t.s, line: t.line}
+	c.args, c.tests = p.arguments()
+	t = p.next()
+	switch t.kind {
+	case tokSemicolon:
+	case tokLBrace:
+		c.hasBlock = true
+		c.block = p.commands(true)
+	default:
+		p.xerrorf(t, "expected semicolon or block, got %s", t)
+	}
+	return c
+}
+
+// arguments parses arguments, followed by an optional test or test list.
+func (p *parser) arguments() ([]rawArg, []rawTest) {
+	var args []rawArg
+	for {
+		t := p.look()
+		switch t.kind {
+		case tokTag:
+			p.next()
+			args = append(args, rawArg{tag: t.s, line: t.line})
+		case tokNumber:
+			p.next()
+			num := t.num
+			args = append(args, rawArg{num: &num, line: t.line})
+		case tokString:
+			p.next()
+			args = append(args, rawArg{strs: []string{t.s}, line: t.line})
+		case tokLBracket:
+			p.next()
+			a := rawArg{list: true, line: t.line}
+			for {
+				a.strs = append(a.strs, p.xexpect(tokString, "string in string list").s)
+				t := p.next()
+				if t.kind == tokRBracket {
+					break
+				} else if t.kind != tokComma {
+					p.xerrorf(t, "expected comma or closing bracket in string list, got %s", t)
+				}
+			}
+			args = append(args, a)
+		case tokIdent:
+			return args, []rawTest{p.test()}
+		case tokLParen:
+			return args, p.testList()
+		default:
+			return args, nil
+		}
+	}
+}
+
+func (p *parser) test() rawTest {
+	t := p.xexpect(tokIdent, "test")
+	rt := rawTest{name: t.s, line: t.line}
+	rt.args, rt.tests = p.arguments()
+	return rt
+}
+
+func (p *parser) testList() []rawTest {
+	p.xexpect(tokLParen, "opening parenthesis")
+	var l []rawTest
+	for {
+		l = append(l, p.test())
+		t := p.next()
+		if t.kind == tokRParen {
+			return l
+		} else if t.kind != tokComma {
+			p.xerrorf(t, "expected comma or closing parenthesis in test list, got %s", t)
+		}
+	}
+}
+
+func parseRaw(script string) (cmds []rawCommand, rerr error) {
+	defer func() {
+		x := recover()
+		if x == nil {
+			return
+		}
+		if err, ok := x.(ParseError); ok {
+			rerr = err
+			return
+		}
+		panic(x)
+	}()
+	p := &parser{l: &lexer{s: script, line: 1}}
+	return p.commands(false), nil
+}
@@ -0,0 +1,644 @@
+// Package sieve implements the Sieve email filtering language, RFC 5228, with
+// the "fileinto", "envelope", "vacation" (RFC 5230), "enotify" (RFC 5435),
+// "reject" and "ereject" (RFC 5429), "relational" (RFC 5231) and "body" (RFC
+// 5173) extensions, and comparator "i;ascii-numeric".
+//
+// A script is parsed and checked with Parse, and evaluated for an incoming
+// message with Script.Eval. Evaluation only determines the actions to take, the
+// caller executes them: delivering to mailboxes, redirecting, sending vacation
+// responses and notifications (see Send).
+package sieve
+
+import (
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/mjl-/mox/smtp"
+)
+
+// Extensions are the extensions that can be specified in a "require" command.
+var Extensions = []string{
+	"body",
+	"comparator-i;ascii-casemap",
+	"comparator-i;ascii-numeric",
+	"comparator-i;octet",
+	"enotify",
+	"envelope",
+	"ereject",
+	"fileinto",
+	"reject",
+	"relational",
+	"vacation",
+}
+
+// Script is a parsed and checked sieve script.
+type Script struct {
+	commands []command
+	required map[string]bool
+}
+
+type command interface{}
+
+type cmdIf struct {
+	tests     []test // For "if" and each "elsif".
+	blocks    [][]command
+	elseBlock []command // Can be nil.
+}
+
+type cmdStop struct{}
+type cmdKeep struct{}
+type cmdDiscard struct{}
+
+type cmdFileInto struct {
+	mailbox string
+}
+
+type cmdRedirect struct {
+	address string
+}
+
+// For both "reject" and "ereject".
+type cmdReject struct {
+	reason string
+}
+
+type cmdVacation struct {
+	Vacation
+}
+
+type cmdNotify struct {
+	Notify
+}
+
+type test interface{}
+
+type testTrue struct{}
+type testFalse struct{}
+
+type testNot struct {
+	test test
+}
+
+type testAllOf struct {
+	tests []test
+}
+
+type testAnyOf struct {
+	tests []test
+}
+
+type addressPart string
+
+const (
+	partAll       addressPart = "all"
+	partLocalpart addressPart = "localpart"
+	partDomain    addressPart = "domain"
+)
+
+// Comparator and match type for tests that compare strings.
+type match struct {
+	octet    bool   // Comparator "i;octet" instead of "i;ascii-casemap".
+	numeric  bool   // Comparator "i;ascii-numeric".
+	typ      string // "is", "contains", "matches", or "value" or "count" from the relational extension.
+	relation string // For "value" and "count": "gt", "ge", "lt", "le", "eq" or "ne".
+}
+
+type testAddress struct {
+	envelope bool // For "envelope" test, with parts "from" and "to".
+	match    match
+	part     addressPart
+	headers  []string
+	keys     []string
+}
+
+type testHeader struct {
+	match   match
+	headers []string
+	keys    []string
+}
+
+type testExists struct {
+	headers []string
+}
+
+type testBody struct {
+	match        match
+	transform    string   // "raw", "content" or "text".
+	contentTypes []string // For transform "content".
+	keys         []string
+}
+
+type testSize struct {
+	over  bool
+	limit int64
+}
+
+type testValidNotifyMethod struct {
+	uris []string
+}
+
+type testNotifyMethodCapability struct {
+	match      match
+	uri        string
+	capability string
+	keys       []string
+}
+
+// Parse parses and checks a script. An error of type ParseError is returned for
+// invalid scripts.
+func Parse(script string) (*Script, error) {
+	raw, err := parseRaw(script)
+	if err != nil {
+		return nil, err
+	}
+	c := checker{required: map[string]bool{}}
+	var cmds []command
+	err = func() (rerr error) {
+		defer func() {
+			x := recover()
+			if x == nil {
+				return
+			}
+			if err, ok := x.(ParseError); ok {
+				rerr = err
+				return
+			}
+			panic(x)
+		}()
+		cmds = c.commands(raw, true)
+		return nil
+	}()
+	if err != nil {
+		return nil, err
+	}
+	return &Script{cmds, c.required}, nil
+}
+
+// Requires returns whether the script requires extension ext, e.g. "body" for
+// scripts that need the parsed message.
+func (s *Script) Requires(ext string) bool {
+	return s.required[ext]
+}
+
+type checker struct {
+	required map[string]bool
+}
+
+func xerrorf(line int, format string, args ...any) {
+	panic(ParseError{line, fmt.Sprintf(format, args...)})
+}
+
+func (c *checker) xrequire(line int, ext, name string) {
+	if !c.required[ext] {
+		xerrorf(line, "%s requires extension %q", name, ext)
+	}
+}
+
+func (c *checker) commands(raw []rawCommand, toplevel bool) []command {
+	var l []command
+	requireAllowed := toplevel
+	for i := 0; i < len(raw); i++ {
+		rc := raw[i]
+		if rc.name != "require" {
+			requireAllowed = false
+		}
+		if rc.name != "if" && rc.name != "elsif" && rc.name != "else" && rc.hasBlock {
+			xerrorf(rc.line, "command %q does not take a block", rc.name)
+		}
+		if rc.name != "if" && rc.name != "elsif" && len(rc.tests) > 0 {
+			xerrorf(rc.line, "command %q does not take a test", rc.name)
+		}
+
+		switch rc.name {
+		case "require":
+			if !requireAllowed {
+				xerrorf(rc.line, "require must come before other commands")
+			}
+			a := args{rc.line, rc.name, rc.args}
+			exts := a.xstrings()
+			a.xend()
+			for _, ext := range exts {
+				ext = strings.ToLower(ext)
+				if !slices.Contains(Extensions, ext) {
+					xerrorf(rc.line, "unsupported extension %q", ext)
+				}
+				c.required[ext] = true
+			}
+
+		case "if":
+			ci := &cmdIf{}
+			ci.tests = append(ci.tests, c.xconditional(rc))
+			ci.blocks = append(ci.blocks, c.commands(rc.block, false))
+			for i+1 < len(raw) && (raw[i+1].name == "elsif" || raw[i+1].name == "else") {
+				i++
+				rc := raw[i]
+				if rc.name == "else" {
+					if len(rc.args) > 0 || len(rc.tests) > 0 || !rc.hasBlock {
+						xerrorf(rc.line, "else takes only a block")
+					}
+					ci.elseBlock = c.commands(rc.block, false)
+					if ci.elseBlock == nil {
+						ci.elseBlock = []command{}
+					}
+					break
+				}
+				ci.tests = append(ci.tests, c.xconditional(rc))
+				ci.blocks = append(ci.blocks, c.commands(rc.block, false))
+			}
+			l = append(l, ci)
+
+		case "elsif", "else":
+			xerrorf(rc.line, "%s without if", rc.name)
+
+		case "stop", "keep", "discard":
+			a := args{rc.line, rc.name, rc.args}
+			a.xend()
+			switch rc.name {
+			case "stop":
+				l = append(l, cmdStop{})
+			case "keep":
+				l = append(l, cmdKeep{})
+			case "discard":
+				l = append(l, cmdDiscard{})
+			}
+
+		case "fileinto":
+			c.xrequire(rc.line, "fileinto", rc.name)
+			a := args{rc.line, rc.name, rc.args}
+			mailbox := a.xstring()
+			a.xend()
+			if mailbox == "" {
+				xerrorf(rc.line, "empty mailbox name")
+			}
+			l = append(l, cmdFileInto{mailbox})
+
+		case "redirect":
+			a := args{rc.line, rc.name, rc.args}
+			addr := a.xstring()
+			a.xend()
+			if _, err := smtp.ParseAddress(addr); err != nil {
+				xerrorf(rc.line, "invalid redirect address %q: %v", addr, err)
+			}
+			l = append(l, cmdRedirect{addr})
+
+		case "reject", "ereject":
+			c.xrequire(rc.line, rc.name, rc.name)
+			a := args{rc.line, rc.name, rc.args}
+			reason := a.xstring()
+			a.xend()
+			l = append(l, cmdReject{reason})
+
+		case "vacation":
+			c.xrequire(rc.line, "vacation", rc.name)
+			l = append(l, c.vacation(rc))
+
+		case "notify":
+			c.xrequire(rc.line, "enotify", rc.name)
+			l = append(l, c.notify(rc))
+
+		default:
+			xerrorf(rc.line, "unknown command %q", rc.name)
+		}
+	}
+	return l
+}
+
+func (c *checker) xconditional(rc rawCommand) test {
+	if len(rc.args) > 0 || len(rc.tests) != 1 || !rc.hasBlock {
+		xerrorf(rc.line, "%s requires a single test and a block", rc.name)
+	}
+	return c.test(rc.tests[0])
+}
+
+func (c *checker) vacation(rc rawCommand) cmdVacation {
+	v := Vacation{Days: 7}
+	a := args{rc.line, rc.name, rc.args}
+	for {
+		tag, ok := a.tag()
+		if !ok {
+			break
+		}
+		switch tag {
+		case "days":
+			v.Days = int(max(1, min(a.xnumber(), 365)))
+		case "subject":
+			v.Subject = a.xstring()
+		case "from":
+			v.From = a.xstring()
+			if _, err := smtp.ParseAddress(v.From); err != nil {
+				// We only accept a plain address, not a display name.
+				xerrorf(rc.line, "invalid vacation from address %q: %v", v.From, err)
+			}
+		case "addresses":
+			v.Addresses = a.xstrings()
+		case "mime":
+			v.MIME = true
+		case "handle":
+			v.Handle = a.xstring()
+		default:
+			xerrorf(rc.line, "unknown tag :%s for vacation", tag)
+		}
+	}
+	v.Reason = a.xstring()
+	a.xend()
+	return cmdVacation{v}
+}
+
+func (c *checker) notify(rc rawCommand) cmdNotify {
+	n := Notify{Importance: 2}
+	a := args{rc.line, rc.name, rc.args}
+	for {
+		tag, ok := a.tag()
+		if !ok {
+			break
+		}
+		switch tag {
+		case "from":
+			n.From = a.xstring()
+		case "importance":
+			switch s := a.xstring(); s {
+			case "1", "2", "3":
+				n.Importance = int(s[0] - '0')
+			default:
+				xerrorf(rc.line, "invalid importance %q, must be 1, 2 or 3", s)
+			}
+		case "options":
+			n.Options = a.xstrings()
+		case "message":
+			n.Message = a.xstring()
+		default:
+			xerrorf(rc.line, "unknown tag :%s for notify", tag)
+		}
+	}
+	n.Method = a.xstring()
+	a.xend()
+	if err := CheckMethod(n.Method); err != nil {
+		xerrorf(rc.line, "%v", err)
+	}
+	return cmdNotify{n}
+}
+
+func (c *checker) tests(l []rawTest) []test {
+	var r []test
+	for _, rt := range l {
+		r = append(r, c.test(rt))
+	}
+	return r
+}
+
+func (c *checker) test(rt rawTest) test {
+	if len(rt.tests) > 0 && rt.name != "allof" && rt.name != "anyof" && rt.name != "not" {
+		xerrorf(rt.line, "test %q does not take tests", rt.name)
+	}
+	a := args{rt.line, rt.name, rt.args}
+	switch rt.name {
+	case "true", "false":
+		a.xend()
+		if rt.name == "true" {
+			return testTrue{}
+		}
+		return testFalse{}
+
+	case "not":
+		a.xend()
+		if len(rt.tests) != 1 {
+			xerrorf(rt.line, "not requires a single test")
+		}
+		return testNot{c.test(rt.tests[0])}
+
+	case "allof", "anyof":
+		a.xend()
+		if len(rt.tests) == 0 {
+			xerrorf(rt.line, "%s requires a test list", rt.name)
+		}
+		if rt.name == "allof" {
+			return testAllOf{c.tests(rt.tests)}
+		}
+		return testAnyOf{c.tests(rt.tests)}
+
+	case "address", "envelope":
+		if rt.name == "envelope" {
+			c.xrequire(rt.line, "envelope", rt.name)
+		}
+		t := testAddress{envelope: rt.name == "envelope", part: partAll}
+		var havePart bool
+		t.match = c.xmatch(&a, func(tag string) bool {
+			switch tag {
+			case "all", "localpart", "domain":
+				if havePart {
+					xerrorf(rt.line, "duplicate address part")
+				}
+				havePart = true
+				t.part = addressPart(tag)
+				return true
+			}
+			return false
+		})
+		t.headers = a.xstrings()
+		t.keys = a.xstrings()
+		a.xend()
+		for i, h := range t.headers {
+			t.headers[i] = strings.ToLower(h)
+			if t.envelope && t.headers[i] != "from" && t.headers[i] != "to" {
+				xerrorf(rt.line, "unknown envelope part %q", h)
+			}
+		}
+		return t
+
+	case "header":
+		t := testHeader{match: c.xmatch(&a, nil)}
+		t.headers = a.xstrings()
+		t.keys = a.xstrings()
+		a.xend()
+		return t
+
+	case "exists":
+		t := testExists{a.xstrings()}
+		a.xend()
+		return t
+
+	case "body":
+		c.xrequire(rt.line, "body", rt.name)
+		t := testBody{transform: "text"}
+		var haveTransform bool
+		t.match = c.xmatch(&a, func(tag string) bool {
+			switch tag {
+			case "raw", "content", "text":
+				if haveTransform {
+					xerrorf(rt.line, "duplicate body transform")
+				}
+				haveTransform = true
+				t.transform = tag
+				if tag == "content" {
+					t.contentTypes = a.xstrings()
+				}
+				return true
+			}
+			return false
+		})
+		if t.match.typ == "count" {
+			xerrorf(rt.line, "match type :count not allowed for body")
+		}
+		t.keys = a.xstrings()
+		a.xend()
+		return t
+
+	case "size":
+		tag, ok := a.tag()
+		if !ok || tag != "over" && tag != "under" {
+			xerrorf(rt.line, "size requires :over or :under")
+		}
+		t := testSize{tag == "over", a.xnumber()}
+		a.xend()
+		return t
+
+	case "valid_notify_method":
+		c.xrequire(rt.line, "enotify", rt.name)
+		t := testValidNotifyMethod{a.xstrings()}
+		a.xend()
+		return t
+
+	case "notify_method_capability":
+		c.xrequire(rt.line, "enotify", rt.name)
+		t := testNotifyMethodCapability{match: c.xmatch(&a, nil)}
+		t.uri = a.xstring()
+		t.capability = strings.ToLower(a.xstring())
+		t.keys = a.xstrings()
+		a.xend()
+		return t
+	}
+	xerrorf(rt.line, "unknown test %q", rt.name)
+	panic("not reached")
+}
+
+// xmatch parses the optional comparator and match type tags, and other tags
+// through fn.
+func (c *checker) xmatch(a *args, fn func(tag string) bool) match {
+	m := match{typ: "is"}
+	var haveComparator, haveType bool
+	for {
+		tag, ok := a.tag()
+		if !ok {
+			break
+		}
+		switch tag {
+		case "comparator":
+			if haveComparator {
+				xerrorf(a.line, "duplicate comparator")
+			}
+			haveComparator = true
+			switch s := strings.ToLower(a.xstring()); s {
+			case "i;octet":
+				m.octet = true
+			case "i;ascii-casemap":
+			case "i;ascii-numeric":
+				c.xrequire(a.line, "comparator-i;ascii-numeric", "comparator "+s)
+				m.numeric = true
+			default:
+				xerrorf(a.line, "unsupported comparator %q", s)
+			}
+		case "is", "contains", "matches", "value", "count":
+			if haveType {
+				xerrorf(a.line, "duplicate match type")
+			}
+			haveType = true
+			m.typ = tag
+			if tag == "value" || tag == "count" {
+				c.xrequire(a.line, "relational", ":"+tag)
+				m.relation = strings.ToLower(a.xstring())
+				switch m.relation {
+				case "gt", "ge", "lt", "le", "eq", "ne":
+				default:
+					xerrorf(a.line, "unknown relation %q", m.relation)
+				}
+			}
+		default:
+			if fn == nil || !fn(tag) {
+				xerrorf(a.line, "unknown tag :%s for %s", tag, a.name)
+			}
+		}
+	}
+	// Numbers cannot be matched on substrings. ../rfc/4790
+	if m.numeric && (m.typ == "contains" || m.typ == "matches") {
+		xerrorf(a.line, "comparator i;ascii-numeric does not support match type :%s", m.typ)
+	}
+	return m
+}
+
+// args helps with parsing arguments of commands and tests.
+type args struct {
+	line int
+	name string
+	l    []rawArg
+}
+
+// tag returns the next tag, if the next argument is a tag.
+func (a *args) tag() (string, bool) {
+	if len(a.l) == 0 || a.l[0].tag == "" {
+		return "", false
+	}
+	tag := a.l[0].tag
+	a.l = a.l[1:]
+	return tag, true
+}
+
+func (a *args) xnext(what string) rawArg {
+	if len(a.l) == 0 {
+		xerrorf(a.line, "missing %s for %s", what, a.name)
+	}
+	arg := a.l[0]
+	a.l = a.l[1:]
+	if arg.tag != "" {
+		xerrorf(arg.line, "unexpected tag :%s for %s, expected %s", arg.tag, a.name, what)
+	}
+	return arg
+}
+
+func (a *args) xstring() string {
+	arg := a.xnext("string")
+	if arg.num != nil || arg.list {
+		xerrorf(arg.line, "expected string for %s", a.name)
+	}
+	return arg.strs[0]
+}
+
+func (a *args) xstrings() []string {
+	arg := a.xnext("string list")
+	if arg.num != nil {
+		xerrorf(arg.line, "expected string or string list for %s", a.name)
+	}
+	return arg.strs
+}
+
+func (a *args) xnumber() int64 {
+	arg := a.xnext("number")
+	if arg.num == nil {
+		xerrorf(arg.line, "expected number for %s", a.name)
+	}
+	return *arg.num
+}
+
+func (a *args) xend() {
+	if len(a.l) > 0 {
+		xerrorf(a.l[0].line, "too many arguments for %s", a.name)
+	}
+}
+
+// CheckMethod returns an error if the notification method URI is invalid or its
+// scheme has no registered Notifier.
+func CheckMethod(method string) error {
+	u, err := url.Parse(method)
+	if err != nil {
+		return fmt.Errorf("parsing notify method: %v", err)
+	}
+	n, ok := notifiers[strings.ToLower(u.Scheme)]
+	if !ok {
+		return fmt.Errorf("unsupported notify method %q", u.Scheme)
+	}
+	if err := n.Check(u); err != nil {
+		return fmt.Errorf("invalid notify method %q: %v", method, err)
+	}
+	return nil
+}
@@ -0,0 +1,386 @@
+package sieve
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/mjl-/mox/message"
+	"github.com/mjl-/mox/mlog"
+)
+
+var pkglog = mlog.New("sieve", nil)
+
+func TestParse(t *testing.T) {
+	bad := func(script string) {
+		t.Helper()
+		_, err := Parse(script)
+		var perr ParseError
+		if err == nil || !errors.As(err, &perr) {
+			t.Fatalf("parse %q: got err %v, expected parse error", script, err)
+		}
+	}
+	good := func(script string) {
+		t.Helper()
+		_, err := Parse(script)
+		if err != nil {
+			t.Fatalf("parse %q: %v", script, err)
+		}
+	}
+
+	good("")
+	good("# comment\r\n/* multi\r\nline */ keep;")
+	good(`require ["fileinto", "envelope"]; if envelope :domain :is "from" "example.org" { fileinto "Lists"; } elsif true { stop; } else { discard; }`)
+	good(`if size :over 100K { discard; }`)
+	good(`if allof (exists "list-id", not header :contains "subject" ["a", "b"]) { keep; }`)
+	good(`if address :comparator "i;octet" :matches :localpart ["from", "to"] "*mjl?" { keep; }`)
+	good(`require "vacation"; vacation :days 3 :subject "away" :from "mjl@mox.example" :addresses ["other@mox.example"] :handle "h" text:
+I'm away.
+..
+.
+;`)
+	good(`require "enotify"; if valid_notify_method "ntfy://ntfy.sh/topic" { notify :importance "1" :message "hi" "ntfy://ntfy.sh/topic"; }`)
+	good(`require "enotify"; if notify_method_capability "https://example.org/hook" "online" ["yes", "maybe"] { keep; }`)
+	good(`require "reject"; if size :over 10M { reject "too large"; }`)
+	good(`require "ereject"; ereject "no";`)
+	good(`require ["relational", "comparator-i;ascii-numeric"]; if header :value "ge" :comparator "i;ascii-numeric" "x-spam-score" "5" { discard; }`)
+	good(`require "relational"; if address :count "gt" ["to", "cc"] "5" { discard; }`)
+	good(`require "body"; if body :content ["text", "application/pdf"] :contains "invoice" { keep; }`)
+	good(`require "body"; if body :raw :matches "*x*" { keep; }`)
+
+	bad("keep")
+	bad("keep; }")
+	bad(`fileinto "Lists";`) // Missing require.
+	bad(`keep; require "fileinto";`)
+	bad(`require "unknown";`)
+	bad(`unknown;`)
+	bad(`if true keep;`)
+	bad(`else { keep; }`)
+	bad(`if unknown { keep; }`)
+	bad(`if size 100 { keep; }`)
+	bad(`if header :comparator "i;unknown" "a" "b" { keep; }`)
+	bad(`if header :is :contains "a" "b" { keep; }`)
+	bad(`redirect "not an address";`)
+	bad(`require "envelope"; if envelope "cc" "a" { keep; }`)
+	bad(`require "enotify"; notify "unknown:x";`)
+	bad(`require "enotify"; notify :importance "4" "https://example.org";`)
+	bad(`require "enotify"; notify "gotify://example.org/";`) // Missing token.
+	bad(`require "vacation"; vacation;`)
+	bad(`reject "no";`) // Missing require.
+	bad(`require "reject"; ereject "no";`)
+	bad(`require "reject"; reject;`)
+	bad(`if header :value "ge" "a" "b" { keep; }`) // Missing require.
+	bad(`require "relational"; if header :value "unknown" "a" "b" { keep; }`)
+	bad(`require "relational"; if header :count "a" "b" { keep; }`)  // Missing relation.
+	bad(`if header :comparator "i;ascii-numeric" "a" "1" { keep; }`) // Missing require.
+	bad(`require "comparator-i;ascii-numeric"; if header :comparator "i;ascii-numeric" :contains "a" "1" { keep; }`)
+	bad(`if body "a" { keep; }`) // Missing require.
+	bad(`require "body"; if body :raw :text "a" { keep; }`)
+	bad(`require ["body", "relational"]; if body :count "eq" "1" { keep; }`)
+	bad(`"unterminated`)
+	bad(`/* unterminated`)
+}
+
+func TestEval(t *testing.T) {
+	header := textproto.MIMEHeader{
+		"From":         {`"Boss" <Boss@Example.org>`},
+		"To":           {"mjl@mox.example, other@mox.example"},
+		"Subject":      {"=?utf-8?q?caf=C3=A9?= meeting"},
+		"List-Id":      {"<list.example.org>"},
+		"X-Spam-Score": {"12.5"},
+	}
+	msg := Message{EnvelopeFrom: "bounces@example.org", EnvelopeTo: "mjl@mox.example", Header: header, Size: 2000}
+
+	check := func(script string, exp Result) {
+		t.Helper()
+		s, err := Parse(script)
+		if err != nil {
+			t.Fatalf("parse %q: %v", script, err)
+		}
+		r, err := s.Eval(msg)
+		if err != nil {
+			t.Fatalf("eval %q: %v", script, err)
+		}
+		if !reflect.DeepEqual(r, exp) {
+			t.Fatalf("eval %q: got %#v, expected %#v", script, r, exp)
+		}
+	}
+
+	check(``, Result{Keep: true})
+	check(`discard;`, Result{})
+	check(`discard; keep;`, Result{Keep: true})
+	check(`stop; discard;`, Result{Keep: true})
+	check(`require "fileinto"; fileinto "A"; fileinto "B"; fileinto "A";`, Result{FileInto: []string{"A", "B"}})
+	check(`require "fileinto"; fileinto "A"; keep;`, Result{Keep: true, FileInto: []string{"A"}})
+	check(`redirect "other@example.org";`, Result{Redirect: []string{"other@example.org"}})
+
+	check(`if address :is "from" "boss@example.org" { discard; }`, Result{})
+	check(`if address :comparator "i;octet" :is "from" "boss@example.org" { discard; }`, Result{Keep: true})
+	check(`if address :domain "to" "MOX.example" { discard; }`, Result{})
+	check(`if address :localpart "to" "other" { discard; }`, Result{})
+	check(`if address :all :matches "from" "b*@*.org" { discard; }`, Result{})
+	check(`if address :matches "from" "b?ss@*" { discard; }`, Result{})
+	check(`if address :matches "from" "b?s@*" { discard; }`, Result{Keep: true})
+	check(`if header :is "subject" "café meeting" { discard; }`, Result{})
+	check(`if header :matches "subject" "caf? *" { discard; }`, Result{})
+	check(`if header :contains ["x-missing", "list-id"] "list.example" { discard; }`, Result{})
+	check(`if header :contains "subject" "other" { discard; }`, Result{Keep: true})
+	check(`if exists ["list-id", "subject"] { discard; }`, Result{})
+	check(`if exists ["list-id", "x-missing"] { discard; }`, Result{Keep: true})
+	check(`if size :over 1K { discard; }`, Result{})
+	check(`if size :under 1K { discard; }`, Result{Keep: true})
+	check(`require "envelope"; if envelope :is "from" "bounces@example.org" { discard; }`, Result{})
+	check(`require "envelope"; if envelope :localpart :is "to" "mjl" { discard; }`, Result{})
+	check(`if anyof (false, true) { discard; }`, Result{})
+	check(`if allof (true, false) { discard; }`, Result{Keep: true})
+	check(`if not false { discard; }`, Result{})
+	check(`if false { discard; } elsif true { redirect "a@example.org"; } else { stop; }`, Result{Redirect: []string{"a@example.org"}})
+	check(`if false { discard; } elsif false { redirect "a@example.org"; } else { stop; } discard;`, Result{Keep: true})
+
+	check(`require "vacation"; vacation "away";`, Result{Keep: true, Vacation: &Vacation{Days: 7, Reason: "away"}})
+	check(`require "vacation"; vacation :days 0 :mime "away";`, Result{Keep: true, Vacation: &Vacation{Days: 1, MIME: true, Reason: "away"}})
+
+	check(`require "enotify"; if address "from" "boss@example.org" { notify :message "boss" "ntfy://ntfy.sh/t"; notify :message "boss" "ntfy://ntfy.sh/t"; }`, Result{Keep: true, Notify: []Notify{{Method: "ntfy://ntfy.sh/t", Importance: 2, Message: "boss"}}})
+	check(`require "enotify"; if valid_notify_method ["https://example.org", "unknown:x"] { discard; }`, Result{Keep: true})
+	check(`require "enotify"; if notify_method_capability "https://example.org" "online" "maybe" { discard; }`, Result{})
+
+	check(`require "reject"; if address :domain "from" "example.org" { reject "go away"; }`, Result{Reject: true, RejectReason: "go away"})
+	check(`require "ereject"; ereject "go away"; discard;`, Result{Reject: true, RejectReason: "go away"})
+
+	check(`require "relational"; if address :count "eq" "to" "2" { discard; }`, Result{})
+	check(`require "relational"; if header :count "gt" "to" "1" { discard; }`, Result{Keep: true}) // Single header.
+	check(`require "relational"; if header :value "gt" "subject" "b" { discard; }`, Result{})
+	check(`require "relational"; if header :value "lt" "subject" "b" { discard; }`, Result{Keep: true})
+	check(`require ["relational", "comparator-i;ascii-numeric"]; if header :value "ge" :comparator "i;ascii-numeric" "x-spam-score" "5" { discard; }`, Result{})
+	check(`require ["relational", "comparator-i;ascii-numeric"]; if header :value "ge" :comparator "i;ascii-numeric" "x-spam-score" "13" { discard; }`, Result{Keep: true})
+	check(`require ["relational", "comparator-i;ascii-numeric"]; if header :value "eq" :comparator "i;ascii-numeric" "subject" "x" { discard; }`, Result{}) // Both non-numbers.
+	check(`require "comparator-i;ascii-numeric"; if header :is :comparator "i;ascii-numeric" "x-spam-score" "012" { discard; }`, Result{})
+
+	// Without message body.
+	check(`require "body"; if body :contains "" { discard; }`, Result{Keep: true})
+
+	// Runtime errors result in implicit keep.
+	s, err := Parse(`require "vacation"; vacation "a"; vacation "b"; discard;`)
+	tcheck(t, err, "parse")
+	r, err := s.Eval(msg)
+	if err == nil || !reflect.DeepEqual(r, Result{Keep: true}) {
+		t.Fatalf("got %v, %v, expected error and keep", r, err)
+	}
+	s, err = Parse(`require ["reject", "fileinto"]; reject "no"; fileinto "Lists";`)
+	tcheck(t, err, "parse")
+	r, err = s.Eval(msg)
+	if err == nil || !reflect.DeepEqual(r, Result{Keep: true}) {
+		t.Fatalf("got %v, %v, expected error and keep", r, err)
+	}
+	s, err = Parse(`redirect "a1@example.org"; redirect "a2@example.org"; redirect "a3@example.org"; redirect "a4@example.org"; redirect "a5@example.org"; redirect "a6@example.org";`)
+	tcheck(t, err, "parse")
+	_, err = s.Eval(msg)
+	if !errors.Is(err, errTooManyRedirects) {
+		t.Fatalf("got err %v, expected errTooManyRedirects", err)
+	}
+}
+
+func TestBody(t *testing.T) {
+	const msg = "From: <boss@example.org>\r\n" +
+		"Content-Type: multipart/mixed; boundary=x\r\n" +
+		"\r\n" +
+		"--x\r\n" +
+		"Content-Type: text/plain; charset=iso-8859-1\r\n" +
+		"Content-Transfer-Encoding: quoted-printable\r\n" +
+		"\r\n" +
+		"Caf=E9 meeting at noon.\r\n" +
+		"--x\r\n" +
+		"Content-Type: application/octet-stream\r\n" +
+		"Content-Transfer-Encoding: base64\r\n" +
+		"\r\n" +
+		"aW52b2ljZQ==\r\n" +
+		"--x--\r\n"
+	part, err := message.Parse(pkglog.Logger, false, strings.NewReader(msg))
+	tcheck(t, err, "parse message")
+	err = part.Walk(pkglog.Logger, nil)
+	tcheck(t, err, "walk message")
+	m := Message{Header: textproto.MIMEHeader{}, Size: int64(len(msg)), Part: &part}
+
+	check := func(script string, exp bool) {
+		t.Helper()
+		s, err := Parse(`require "body"; if ` + script + ` { discard; }`)
+		tcheck(t, err, "parse")
+		r, err := s.Eval(m)
+		tcheck(t, err, "eval")
+		if !r.Keep != exp {
+			t.Fatalf("body test %q: got %v, expected %v", script, !r.Keep, exp)
+		}
+	}
+
+	check(`body :contains "café meeting"`, true)
+	check(`body :text :contains "invoice"`, false)
+	check(`body :content "application" :contains "invoice"`, true)
+	check(`body :content "application/pdf" :contains "invoice"`, false)
+	check(`body :content "" :contains "invoice"`, true)
+	check(`body :content "text/plain" :matches "caf? *"`, true)
+	check(`body :raw :contains "Caf=E9"`, true)
+	check(`body :raw :contains "aW52b2ljZQ=="`, true)
+	check(`body :contains "Caf=E9"`, false)
+}
+
+func tcheck(t *testing.T, err error, msg string) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("%s: %s", msg, err)
+	}
+}
+
+func TestGlobMatch(t *testing.T) {
+	check := func(s, pattern string, exp bool) {
+		t.Helper()
+		if globMatch(s, pattern) != exp {
+			t.Fatalf("globMatch(%q, %q), expected %v", s, pattern, exp)
+		}
+	}
+	check("", "", true)
+	check("", "*", true)
+	check("abc", "a*", true)
+	check("abc", "*c", true)
+	check("abc", "a?c", true)
+	check("aéc", "a?c", true)
+	check("abc", "a?", false)
+	check("a*c", `a\*c`, true)
+	check("abc", `a\*c`, false)
+	check("a?", `a\?`, true)
+}
+
+func TestNotify(t *testing.T) {
+	var req *http.Request
+	var body []byte
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req = r
+		body, _ = io.ReadAll(r.Body)
+	}))
+	defer srv.Close()
+	defer func(c *tls.Config) {
+		httpTLSConfig = c
+	}(httpTLSConfig)
+	httpTLSConfig = srv.Client().Transport.(*http.Transport).TLSClientConfig
+	defer func(f func() HTTPPolicy) {
+		HTTPNotifyPolicy = f
+	}(HTTPNotifyPolicy)
+	policy := HTTPPolicy{Hosts: []string{"127.0.0.1"}, AllowPrivateIPs: true}
+	HTTPNotifyPolicy = func() HTTPPolicy { return policy }
+	host := strings.TrimPrefix(srv.URL, "https://")
+
+	n := Notification{
+		Notify:    Notify{Importance: 1},
+		Account:   "mjl",
+		Recipient: "mjl@mox.example",
+		MsgFrom:   "boss@example.org",
+		Subject:   "café",
+	}
+
+	n.Method = srv.URL + "/hook"
+	err := Send(context.Background(), pkglog, n)
+	tcheck(t, err, "webhook")
+	var wn WebhookNotification
+	err = json.Unmarshal(body, &wn)
+	tcheck(t, err, "parse webhook notification")
+	if req.URL.Path != "/hook" || wn.Recipient != "mjl@mox.example" || wn.Message != "boss@example.org: café" || wn.Importance != 1 {
+		t.Fatalf("unexpected webhook request, path %q, notification %#v", req.URL.Path, wn)
+	}
+
+	n.Method = "ntfy://token@" + host + "/topic"
+	err = Send(context.Background(), pkglog, n)
+	tcheck(t, err, "ntfy")
+	if req.URL.Path != "/topic" || req.Header.Get("Priority") != "4" || req.Header.Get("Authorization") != "Bearer token" || string(body) != "boss@example.org: café" {
+		t.Fatalf("unexpected ntfy request, path %q, headers %v, body %q", req.URL.Path, req.Header, body)
+	}
+
+	n.Method = "gotify://" + host + "/gotify?token=apptoken"
+	n.Message = "custom"
+	err = Send(context.Background(), pkglog, n)
+	tcheck(t, err, "gotify")
+	var gm struct {
+		Title    string `json:"title"`
+		Message  string `json:"message"`
+		Priority int    `json:"priority"`
+	}
+	err = json.Unmarshal(body, &gm)
+	tcheck(t, err, "parse gotify message")
+	if req.URL.Path != "/gotify/message" || req.Header.Get("X-Gotify-Key") != "apptoken" || gm.Title != "café" || gm.Message != "custom" || gm.Priority != 8 {
+		t.Fatalf("unexpected gotify request, path %q, headers %v, message %#v", req.URL.Path, req.Header, gm)
+	}
+
+	n.Method = "unknown:x"
+	err = Send(context.Background(), pkglog, n)
+	if err == nil {
+		t.Fatalf("no error for unknown method")
+	}
+
+	// Notifications over HTTP must be enabled, and only go to the configured hosts,
+	// and by default not to loopback, private, link-local or unspecified IPs, also
+	// not through a name resolving to them.
+	refused := func(method, expErr string) {
+		t.Helper()
+		req = nil
+		n.Method = method
+		err := Send(context.Background(), pkglog, n)
+		if err == nil || !strings.Contains(err.Error(), expErr) {
+			t.Fatalf("send to %s: got err %v, expected error with %q", method, err, expErr)
+		}
+		if req != nil {
+			t.Fatalf("send to %s: request was made", method)
+		}
+	}
+	policy = HTTPPolicy{}
+	refused(srv.URL+"/hook", "not allowed by configuration")
+	if slices.Contains(Methods(), "https") {
+		t.Fatalf("https method advertised while disabled")
+	}
+	policy = HTTPPolicy{Hosts: []string{"*.example.org"}, AllowPrivateIPs: true}
+	refused(srv.URL+"/hook", "not allowed by configuration")
+	refused("https://example.org/hook", "not allowed by configuration")
+	policy = HTTPPolicy{Hosts: []string{"*"}}
+	if !slices.Contains(Methods(), "https") {
+		t.Fatalf("https method not advertised while enabled")
+	}
+	refused(srv.URL+"/hook", "non-public ip 127.0.0.1")
+	refused("ntfy://token@"+host+"/topic", "non-public ip 127.0.0.1")
+	refused("gotify://"+host+"/gotify?token=apptoken", "non-public ip 127.0.0.1")
+	refused(fmt.Sprintf("https://localhost:%d/hook", srv.Listener.Addr().(*net.TCPAddr).Port), "non-public ip")
+	refused("http://10.1.2.3/hook", "non-public ip 10.1.2.3")
+	refused("http://169.254.169.254/latest/meta-data", "non-public ip 169.254.169.254")
+	refused("http://[::1]/hook", "non-public ip ::1")
+	refused("http://0.0.0.0/hook", "non-public ip 0.0.0.0")
+}
+
+func TestDialControlPublic(t *testing.T) {
+	check := func(addr string, expOK bool) {
+		t.Helper()
+		err := dialControlPublic("tcp", addr, nil)
+		if (err == nil) != expOK {
+			t.Fatalf("dial control for %s: got err %v, expected ok %v", addr, err, expOK)
+		}
+	}
+	check("127.0.0.1:80", false)
+	check("10.0.0.1:443", false)
+	check("172.16.1.1:443", false)
+	check("192.168.1.1:443", false)
+	check("169.254.169.254:80", false)
+	check("[::1]:80", false)
+	check("[fe80::1]:80", false)
+	check("[fd00::1]:80", false)
+	check("[::ffff:127.0.0.1]:80", false)
+	check("0.0.0.0:80", false)
+	check("[::]:80", false)
+	check("198.51.100.1:443", true)
+	check("[2001:db8::1]:443", true)
+}
@@ -144,6 +144,8 @@ type Client struct {
 	extSMTPUTF8           bool              // Remote server supports SMTPUTF8 extension.
 	extAuthMechanisms     []string          // Supported authentication mechanisms.
 	extRequireTLS         bool              // Remote supports REQUIRETLS extension.
+	extDSN                bool              // Remote supports DSN extension.
+	extensions            []string          // Extension lines from last EHLO response, as sent by remote.
 	ExtLimits             map[string]string // For LIMITS extension, only if present and valid, with uppercase keys.
 	ExtLimitMailMax       int               // Max "MAIL" commands in a connection, if > 0.
 	ExtLimitRcptMax       int               // Max "RCPT" commands in a transaction, if > 0.
@@ -736,6 +738,7 @@ func (c *Client) hello(ctx context.Context, tlsMode TLSMode, ehloHostname dns.Do
 		default:
 			c.xerrorf(code/100 == 5, code, "", firstLine, moreLines, "%w: expected 250, got %d", ErrStatus, code)
 		}
+		c.extensions = moreTexts
 		for _, s := range moreTexts {
 			// ../rfc/5321:1869
 			s = strings.ToUpper(strings.TrimSpace(s))
@@ -750,6 +753,8 @@ func (c *Client) hello(ctx context.Context, tlsMode TLSMode, ehloHostname dns.Do
 				c.extPipelining = true
 			case "REQUIRETLS":
 				c.extRequireTLS = true
+			case "DSN":
+				c.extDSN = true
 			default:
 				// For SMTPUTF8 we must ignore any parameter. ../rfc/6531:207
 				if s == "SMTPUTF8" || strings.HasPrefix(s, "SMTPUTF8 ") {
@@ -1081,6 +1086,20 @@ func (c *Client) SupportsRequireTLS() bool {
 	return c.extRequireTLS
 }
 
+// SupportsDSN returns whether the SMTP server supports the DSN extension. If so,
+// DSN parameters are passed on by DeliverMultipleDSN, and the remote server is
+// responsible for sending requested delivery status notifications.
+func (c *Client) SupportsDSN() bool {
+	return c.extDSN
+}
+
+// Extensions returns the extensions announced by the SMTP server in its last
+// EHLO response, one per line, with parameters, as sent by the server. Nil if the
+// server only supports HELO.
+func (c *Client) Extensions() []string {
+	return c.extensions
+}
+
 // TLSConnectionState returns TLS details if TLS is enabled, and nil otherwise.
 func (c *Client) TLSConnectionState() *tls.ConnectionState {
 	if tlsConn, ok := c.conn.(*tls.Conn); ok {
@@ -1119,6 +1138,45 @@ func (c *Client) Deliver(ctx context.Context, mailFrom string, rcptTo string, ms
 var errNoRecipientsPipelined = errors.New("no recipients accepted in pipelined transaction")
 var errNoRecipients = errors.New("no recipients accepted in transaction")
 
+// DSN holds the parameters of the DSN extension for a transaction. They are only
+// sent if the remote server supports the DSN extension. ../rfc/3461
+type DSN struct {
+	Ret   string // "FULL" or "HDRS", or empty.
+	EnvID string // Envelope identifier, sent as xtext. Empty if not set.
+
+	// Per recipient, in the same order as the recipients in the transaction. Can be
+	// nil.
+	Recipients []DSNRecipient
+}
+
+// DSNRecipient holds the DSN parameters for a single recipient.
+type DSNRecipient struct {
+	Notify []string // Empty for default, otherwise "NEVER", or any of "SUCCESS", "FAILURE" and "DELAY".
+	ORCPT  string   // Original recipient, with address type, e.g. "rfc822;user@example.org". Sent as xtext, only if ASCII.
+}
+
+// xtext encodes s as xtext, for use in DSN parameters. ../rfc/3461
+func xtext(s string) string {
+	var r strings.Builder
+	for _, b := range []byte(s) {
+		if b >= 0x21 && b <= 0x7e && b != '+' && b != '=' {
+			r.WriteByte(b)
+		} else {
+			fmt.Fprintf(&r, "+%02X", b)
+		}
+	}
+	return r.String()
+}
+
+func isASCII(s string) bool {
+	for _, c := range s {
+		if c >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
+
 // DeliverMultiple is like Deliver, but attempts to deliver a message to multiple
 // recipients.  Errors about the entire transaction, such as i/o errors or error
 // responses to the MAIL FROM or DATA commands, are returned by a non-nil rerr. If
@@ -1132,11 +1190,20 @@ var errNoRecipients = errors.New("no recipients accepted in transaction")
 // delivery attempt as failed. Also code "552" must be treated like temporary error
 // code "452" for historic reasons.
 func (c *Client) DeliverMultiple(ctx context.Context, mailFrom string, rcptTo []string, msgSize int64, msg io.Reader, req8bitmime, reqSMTPUTF8, requireTLS bool) (rcptResps []Response, rerr error) {
+	return c.DeliverMultipleDSN(ctx, mailFrom, rcptTo, msgSize, msg, req8bitmime, reqSMTPUTF8, requireTLS, nil)
+}
+
+// DeliverMultipleDSN is like DeliverMultiple, but also passes DSN parameters if
+// dsn is not nil and the remote server supports the DSN extension.
+func (c *Client) DeliverMultipleDSN(ctx context.Context, mailFrom string, rcptTo []string, msgSize int64, msg io.Reader, req8bitmime, reqSMTPUTF8, requireTLS bool, dsn *DSN) (rcptResps []Response, rerr error) {
 	defer c.recover(&rerr)
 
 	if len(rcptTo) == 0 {
 		return nil, fmt.Errorf("need at least one recipient")
 	}
+	if dsn != nil && dsn.Recipients != nil && len(dsn.Recipients) != len(rcptTo) {
+		return nil, fmt.Errorf("dsn parameters for %d recipients, expected %d", len(dsn.Recipients), len(rcptTo))
+	}
 
 	if c.origConn == nil {
 		return nil, ErrClosed
@@ -1185,12 +1252,37 @@ func (c *Client) DeliverMultiple(ctx context.Context, mailFrom string, rcptTo []
 		// ../rfc/8689:155
 		requiretlsArg = " REQUIRETLS"
 	}
+	var dsnArgs string
+	if c.extDSN && dsn != nil {
+		// ../rfc/3461
+		if dsn.Ret != "" {
+			dsnArgs += " RET=" + dsn.Ret
+		}
+		if dsn.EnvID != "" {
+			dsnArgs += " ENVID=" + xtext(dsn.EnvID)
+		}
+	}
+	lineRcptTo := func(i int) string {
+		line := "RCPT TO:<" + rcptTo[i] + ">"
+		if !c.extDSN || dsn == nil || dsn.Recipients == nil {
+			return line
+		}
+		r := dsn.Recipients[i]
+		// ../rfc/3461
+		if len(r.Notify) > 0 {
+			line += " NOTIFY=" + strings.Join(r.Notify, ",")
+		}
+		if r.ORCPT != "" && isASCII(r.ORCPT) {
+			line += " ORCPT=" + xtext(r.ORCPT)
+		}
+		return line
+	}
 
 	// Transaction overview: ../rfc/5321:1015
 	// MAIL FROM: ../rfc/5321:1879
 	// RCPT TO: ../rfc/5321:1916
 	// DATA: ../rfc/5321:1992
-	lineMailFrom := fmt.Sprintf("MAIL FROM:<%s>%s%s%s%s", mailFrom, mailSize, bodyType, smtputf8Arg, requiretlsArg)
+	lineMailFrom := fmt.Sprintf("MAIL FROM:<%s>%s%s%s%s%s", mailFrom, mailSize, bodyType, smtputf8Arg, requiretlsArg, dsnArgs)
 
 	// We are going into a transaction. We'll clear this when done.
 	c.needRset = true
@@ -1218,10 +1310,9 @@ func (c *Client) DeliverMultiple(ctx context.Context, mailFrom string, rcptTo []
 			var b bytes.Buffer
 			b.WriteString(lineMailFrom)
 			b.WriteString("\r\n")
-			for _, rcpt := range rcptTo {
-				b.WriteString("RCPT TO:<")
-				b.WriteString(rcpt)
-				b.WriteString(">\r\n")
+			for i := range rcptTo {
+				b.WriteString(lineRcptTo(i))
+				b.WriteString("\r\n")
 			}
 			b.WriteString("DATA\r\n")
 			_, err := c.w.Write(b.Bytes())
@@ -1327,10 +1418,10 @@ func (c *Client) DeliverMultiple(ctx context.Context, mailFrom string, rcptTo []
 
 		rcptResps = make([]Response, len(rcptTo))
 		nok := 0
-		for i, rcpt := range rcptTo {
+		for i := range rcptTo {
 			c.cmds[0] = "rcptto"
 			c.cmdStart = time.Now()
-			c.xwriteline(fmt.Sprintf("RCPT TO:<%s>", rcpt))
+			c.xwriteline(lineRcptTo(i))
 			code, secode, firstLine, moreLines = c.xread()
 			if i > 0 && (code == smtp.C452StorageFull || code == smtp.C552MailboxFull) {
 				// Remote doesn't accept more recipients for this transaction. Don't send more, give
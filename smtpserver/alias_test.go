@@ -1,14 +1,21 @@
 package smtpserver
 
 import (
+	cryptorand "crypto/rand"
+	"crypto/rsa"
 	"errors"
+	"os"
 	"path/filepath"
 	"strings"
 	"testing"
 
 	"github.com/mjl-/bstore"
 
+	"github.com/mjl-/mox/config"
+	"github.com/mjl-/mox/dkim"
 	"github.com/mjl-/mox/dns"
+	"github.com/mjl-/mox/mox-"
+	"github.com/mjl-/mox/queue"
 	"github.com/mjl-/mox/smtp"
 	"github.com/mjl-/mox/smtpclient"
 	"github.com/mjl-/mox/store"
@@ -291,3 +298,136 @@ test email
 		ts.smtpErr(err, &smtpclient.Error{Code: smtp.C451LocalErr, Secode: smtp.SeSys3Other0})
 	})
 }
+
+// Messages to an alias with remote members are queued for the remote members, and
+// rejected when looping back.
+func TestAliasDeliverRemote(t *testing.T) {
+	resolver := dns.MockResolver{
+		A: map[string][]string{
+			"example.org.": {"127.0.0.10"}, // For mx check.
+		},
+		PTR: map[string][]string{
+			"127.0.0.10": {"example.org."},
+		},
+	}
+	ts := newTestServer(t, filepath.FromSlash("../testdata/smtp/mox.conf"), resolver)
+	defer ts.close()
+
+	var msg = strings.ReplaceAll(`From: <other@example.org>
+To: <forward@mox.example>
+Subject: test
+
+test email
+`, "\n", "\r\n")
+
+	ts.run(func(client *smtpclient.Client) {
+		mailFrom := "other@example.org"
+		rcptTo := "forward@mox.example"
+		err := client.Deliver(ctxbg, mailFrom, rcptTo, int64(len(msg)), strings.NewReader(msg), false, false, false)
+		ts.smtpErr(err, nil)
+
+		ts.checkCount("Inbox", 1) // Local member mjl@.
+	})
+
+	msgs, err := queue.List(ctxbg, queue.Filter{}, queue.Sort{})
+	tcheck(t, err, "list queue")
+	tcompare(t, len(msgs), 1)
+	tcompare(t, msgs[0].Recipient().String(), "remote@remote.example")
+	tcompare(t, msgs[0].Sender().String(), "postmaster@mox.example")
+	tcompare(t, strings.HasPrefix(string(msgs[0].MsgPrefix), "Delivered-To: forward@mox.example\r\n"), true)
+
+	// Message coming back from the remote member is a loop.
+	msg = "Delivered-To: forward@mox.example\r\n" + msg
+	ts.run(func(client *smtpclient.Client) {
+		mailFrom := "other@example.org"
+		rcptTo := "forward@mox.example"
+		err := client.Deliver(ctxbg, mailFrom, rcptTo, int64(len(msg)), strings.NewReader(msg), false, false, false)
+		ts.smtpErr(err, &smtpclient.Error{Permanent: true, Code: smtp.C550MailboxUnavail, Secode: smtp.SeNet4Loop6})
+
+		ts.checkCount("Inbox", 1)
+	})
+
+	// With ListUnsubscribe, remote members get a one-click unsubscribe link.
+	l := mox.Conf.Static.Listeners["local"]
+	l.UnsubscribeHTTPS.Enabled = true
+	mox.Conf.Static.Listeners["local"] = l
+	defer func() {
+		l.UnsubscribeHTTPS.Enabled = false
+		mox.Conf.Static.Listeners["local"] = l
+	}()
+	msg = strings.TrimPrefix(msg, "Delivered-To: forward@mox.example\r\n")
+	msg = strings.ReplaceAll(msg, "forward@", "forwardunsub@")
+	ts.run(func(client *smtpclient.Client) {
+		mailFrom := "other@example.org"
+		rcptTo := "forwardunsub@mox.example"
+		err := client.Deliver(ctxbg, mailFrom, rcptTo, int64(len(msg)), strings.NewReader(msg), false, false, false)
+		ts.smtpErr(err, nil)
+	})
+	msgs, err = queue.List(ctxbg, queue.Filter{To: "remote@remote.example"}, queue.Sort{Field: "Queued", Asc: true})
+	tcheck(t, err, "list queue")
+	tcompare(t, len(msgs), 2)
+	token := mox.UnsubscribeToken(mox.Unsubscribe{Alias: "forwardunsub@mox.example", Address: "remote@remote.example"})
+	expPrefix := "List-Unsubscribe: <https://mox.example/unsubscribe/" + token + ">\r\nList-Unsubscribe-Post: List-Unsubscribe=One-Click\r\nDelivered-To: forwardunsub@mox.example\r\n"
+	tcompare(t, strings.HasPrefix(string(msgs[1].MsgPrefix), expPrefix), true)
+}
+
+// Messages forwarded to remote alias members are ARC-sealed, and the ARC result
+// of incoming messages is added to the Authentication-Results header.
+func TestAliasARCSeal(t *testing.T) {
+	resolver := dns.MockResolver{
+		A: map[string][]string{
+			"example.org.": {"127.0.0.10"}, // For mx check.
+		},
+		PTR: map[string][]string{
+			"127.0.0.10": {"example.org."},
+		},
+	}
+	ts := newTestServer(t, filepath.FromSlash("../testdata/smtp/mox.conf"), resolver)
+	defer ts.close()
+
+	// ARC only uses RSA keys.
+	key, err := rsa.GenerateKey(cryptorand.Reader, 1024)
+	tcheck(t, err, "generate rsa key")
+	dom, _ := mox.Conf.Domain(dns.Domain{ASCII: "mox.example"})
+	sel := config.Selector{
+		HashEffective:    "sha256",
+		HeadersEffective: []string{"From", "To", "Subject"},
+		Key:              key,
+		Domain:           dns.Domain{ASCII: "arcsel"},
+	}
+	dom.DKIM = config.DKIM{
+		Selectors: map[string]config.Selector{"arcsel": sel},
+		Sign:      []string{"arcsel"},
+	}
+	mox.Conf.Dynamic.Domains["mox.example"] = dom
+	record := dkim.Record{Version: "DKIM1", Key: "rsa", PublicKey: key.Public()}
+	txt, err := record.Record()
+	tcheck(t, err, "dkim record")
+	resolver.TXT = map[string][]string{"arcsel._domainkey.mox.example.": {txt}}
+
+	var msg = strings.ReplaceAll(`From: <other@example.org>
+To: <forward@mox.example>
+Subject: test
+
+test email
+`, "\n", "\r\n")
+
+	ts.run(func(client *smtpclient.Client) {
+		err := client.Deliver(ctxbg, "other@example.org", "forward@mox.example", int64(len(msg)), strings.NewReader(msg), false, false, false)
+		ts.smtpErr(err, nil)
+	})
+
+	msgs, err := queue.List(ctxbg, queue.Filter{}, queue.Sort{})
+	tcheck(t, err, "list queue")
+	tcompare(t, len(msgs), 1)
+	prefix := string(msgs[0].MsgPrefix)
+	tcompare(t, strings.HasPrefix(prefix, "ARC-Seal: i=1;"), true)
+	tcompare(t, strings.Contains(prefix, "\r\n\tarc=none smtp.remote-ip=127.0.0.10;"), true)
+
+	data, err := os.ReadFile(msgs[0].MessagePath())
+	tcheck(t, err, "read queued message")
+	result, err := dkim.ARCVerify(ctxbg, pkglog.Logger, resolver, false, strings.NewReader(prefix+string(data)))
+	tcheck(t, err, "arc verify")
+	tcompare(t, result.Status, dkim.ARCPass)
+	tcompare(t, result.Instance, 1)
+}
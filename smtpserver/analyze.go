@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"log/slog"
 	"net"
+	"net/textproto"
 	"os"
 	"strings"
 	"time"
@@ -18,10 +19,12 @@ import (
 	"github.com/mjl-/mox/dns"
 	"github.com/mjl-/mox/dnsbl"
 	"github.com/mjl-/mox/iprev"
+	"github.com/mjl-/mox/lookalike"
 	"github.com/mjl-/mox/message"
 	"github.com/mjl-/mox/mlog"
 	"github.com/mjl-/mox/mox-"
 	"github.com/mjl-/mox/publicsuffix"
+	"github.com/mjl-/mox/sieve"
 	"github.com/mjl-/mox/smtp"
 	"github.com/mjl-/mox/store"
 	"github.com/mjl-/mox/subjectpass"
@@ -46,6 +49,9 @@ type delivery struct {
 	dkimResults      []dkim.Result
 	iprevStatus      iprev.Status
 	smtputf8         bool
+	msgHeader        textproto.MIMEHeader // Header of the incoming message, for sieve.
+	sieveResult      *sieve.Result        // Set if the account has an active sieve script that was evaluated, or if a matching ruleset forwards or discards the message.
+	spoofProtect     bool                 // Message From domain is hosted here, fails DMARC and has an active spoofing incident.
 }
 
 type analysis struct {
@@ -65,6 +71,8 @@ type analysis struct {
 	// Additional headers to add during delivery. Used for reasons a message to a
 	// dmarc/tls reporting address isn't processed.
 	headers string
+	// Inputs to the decision, stored with the outcome for the account.
+	decision store.JunkDecision
 }
 
 const (
@@ -85,6 +93,8 @@ const (
 	reasonIPrev             = "iprev"     // No or mild junk reputation signals, and bad iprev.
 	reasonHighRate          = "high-rate" // Too many messages, not added to rejects.
 	reasonMsgAuthRequired   = "msg-auth-required"
+	reasonLookalikeDomain   = "lookalike-domain"
+	reasonContentFilter     = "content-filter" // Quarantined by content filter.
 )
 
 func isListDomain(d delivery, ld dns.Domain) bool {
@@ -99,6 +109,42 @@ func isListDomain(d delivery, ld dns.Domain) bool {
 	return false
 }
 
+// lookalikeSender returns a hosted domain with LookalikeSenders configured that
+// the message From or SMTP MAIL FROM domain is a lookalike of, with the kind of
+// lookalike and the configured action. Sender domains with an organizational
+// domain that is hosted here are never considered lookalikes.
+func lookalikeSender(ctx context.Context, log mlog.Log, d delivery) (own dns.Domain, kind, action string) {
+	domains := mox.Conf.DomainConfigs()
+	hostedOrgs := map[string]bool{}
+	for _, dc := range domains {
+		hostedOrgs[publicsuffix.Lookup(ctx, log.Logger, dc.Domain).ASCII] = true
+	}
+
+	var senders []dns.Domain
+	if !d.msgFrom.IsZero() {
+		senders = append(senders, d.msgFrom.Domain)
+	}
+	if d.m.MailFromDomain != "" {
+		if md, err := dns.ParseDomain(d.m.MailFromDomain); err == nil && md.ASCII != d.msgFrom.Domain.ASCII {
+			senders = append(senders, md)
+		}
+	}
+	for _, sd := range senders {
+		if hostedOrgs[publicsuffix.Lookup(ctx, log.Logger, sd).ASCII] {
+			continue
+		}
+		for _, dc := range domains {
+			if dc.LookalikeSenders == "" || dc.ReportsOnly {
+				continue
+			}
+			if kind, ok := lookalike.Match(ctx, log.Logger, sd, dc.Domain); ok {
+				return dc.Domain, kind, dc.LookalikeSenders
+			}
+		}
+	}
+	return dns.Domain{}, "", ""
+}
+
 func analyze(ctx context.Context, log mlog.Log, resolver dns.Resolver, d delivery) analysis {
 	var headers string
 
@@ -108,6 +154,8 @@ func analyze(ctx context.Context, log mlog.Log, resolver dns.Resolver, d deliver
 		reasonText = append(reasonText, s)
 	}
 
+	var decision store.JunkDecision
+
 	// We don't want to let a single IP or network deliver too many messages to an
 	// account. They may fill up the mailbox, either with messages that have to be
 	// purged, or by filling the disk. We check both cases for IP's and networks.
@@ -185,12 +233,12 @@ func analyze(ctx context.Context, log mlog.Log, resolver dns.Resolver, d deliver
 		log.Errorx("checking delivery rates", err)
 		metricDelivery.WithLabelValues("checkrates", "").Inc()
 		addReasonText("checking delivery rates: %v", err)
-		return analysis{d, false, "", smtp.C451LocalErr, smtp.SeSys3Other0, false, "error processing", err, nil, nil, reasonReputationError, reasonText, "", headers}
+		return analysis{d, false, "", smtp.C451LocalErr, smtp.SeSys3Other0, false, "error processing", err, nil, nil, reasonReputationError, reasonText, "", headers, decision}
 	} else if err != nil {
 		log.Debugx("refusing due to high delivery rate", err)
 		metricDelivery.WithLabelValues("highrate", "").Inc()
 		addReasonText("high delivery rate")
-		return analysis{d, false, "", smtp.C452StorageFull, smtp.SeMailbox2Full2, true, err.Error(), err, nil, nil, reasonHighRate, reasonText, "", headers}
+		return analysis{d, false, "", smtp.C452StorageFull, smtp.SeMailbox2Full2, true, err.Error(), err, nil, nil, reasonHighRate, reasonText, "", headers, decision}
 	}
 
 	mailbox := d.destination.Mailbox
@@ -202,7 +250,30 @@ func analyze(ctx context.Context, log mlog.Log, resolver dns.Resolver, d deliver
 	// check it for a pass.
 	rs := store.MessageRuleset(log, d.destination, d.m, d.m.MsgPrefix, d.dataFile)
 	if rs != nil {
-		mailbox = rs.Mailbox
+		if rs.Mailbox != "" {
+			mailbox = rs.Mailbox
+		}
+		store.RulesetFlags(rs, d.m)
+		// Forwarding and discarding are executed like the actions of a sieve script.
+		if rs.Discard || len(rs.ForwardTo) > 0 {
+			d.sieveResult = &sieve.Result{Keep: !rs.Discard, Redirect: rs.ForwardTo}
+		}
+	} else {
+		// Sieve scripts are only evaluated when no ruleset matched.
+		d.sieveResult = sieveEval(ctx, log, d)
+	}
+	// An active out-of-office auto-responder for the address sends its response
+	// through the sieve vacation action, unless a sieve script already responds.
+	if d.sieveResult == nil || d.sieveResult.Vacation == nil {
+		if v, err := d.acc.VacationGet(ctx, d.canonicalAddress); err != nil {
+			log.Errorx("looking up vacation, continuing without", err)
+		} else if v != nil && v.Active(time.Now()) {
+			if d.sieveResult == nil {
+				d.sieveResult = &sieve.Result{Keep: true}
+			}
+			sv := v.SieveVacation()
+			d.sieveResult.Vacation = &sv
+		}
 	}
 	if rs != nil && !rs.ListAllowDNSDomain.IsZero() {
 		// todo: on temporary failures, reject temporarily?
@@ -217,6 +288,7 @@ func analyze(ctx context.Context, log mlog.Log, resolver dns.Resolver, d deliver
 				reasonText:          reasonText,
 				dmarcOverrideReason: string(dmarcrpt.PolicyOverrideMailingList),
 				headers:             headers,
+				decision:            decision,
 			}
 		}
 	}
@@ -288,7 +360,7 @@ func analyze(ctx context.Context, log mlog.Log, resolver dns.Resolver, d deliver
 			})
 			if mberr != nil {
 				addReasonText("error setting original destination mailbox for rejected message: %v", mberr)
-				return analysis{d, false, mailbox, smtp.C451LocalErr, smtp.SeSys3Other0, false, "error processing", err, nil, nil, reasonReputationError, reasonText, dmarcOverrideReason, headers}
+				return analysis{d, false, mailbox, smtp.C451LocalErr, smtp.SeSys3Other0, false, "error processing", err, nil, nil, reasonReputationError, reasonText, dmarcOverrideReason, headers, decision}
 			}
 			d.m.MailboxID = 0 // We plan to reject, no need to set intended MailboxID.
 		}
@@ -303,7 +375,7 @@ func analyze(ctx context.Context, log mlog.Log, resolver dns.Resolver, d deliver
 			log.Info("accepting reject to configured mailbox due to ruleset")
 			addReasonText("accepting reject to mailbox due to ruleset")
 		}
-		return analysis{d, accept, mailbox, code, secode, err == nil, errmsg, err, nil, nil, reason, reasonText, dmarcOverrideReason, headers}
+		return analysis{d, accept, mailbox, code, secode, err == nil, errmsg, err, nil, nil, reason, reasonText, dmarcOverrideReason, headers, decision}
 	}
 
 	if d.dmarcUse && d.dmarcResult.Reject {
@@ -316,6 +388,21 @@ func analyze(ctx context.Context, log mlog.Log, resolver dns.Resolver, d deliver
 	}
 	// todo: should we also reject messages that have a dmarc pass but an spf record "v=spf1 -all"? suggested by m3aawg best practices.
 
+	// Senders impersonating one of our domains with a lookalike domain are likely
+	// phishing. Depending on the domain config, reject, or be stricter about junk.
+	var lookalikeJunk bool
+	if own, kind, action := lookalikeSender(ctx, log, d); action != "" {
+		addReasonText("sender domain is a lookalike (%s) of hosted domain %s", kind, own)
+		if action == "reject" {
+			return reject(smtp.C550MailboxUnavail, smtp.SePol7Other0, "rejecting lookalike of local domain", nil, reasonLookalikeDomain)
+		}
+		lookalikeJunk = true
+	}
+
+	if d.spoofProtect {
+		addReasonText("message from hosted domain %s fails dmarc during spoofing incident", d.msgFrom.Domain)
+	}
+
 	// If destination is the DMARC reporting mailbox, do additional checks and keep
 	// track of the report. We'll check reputation, defaulting to accept.
 	var dmarcReport *dmarcrpt.Feedback
@@ -446,6 +533,9 @@ func analyze(ctx context.Context, log mlog.Log, resolver dns.Resolver, d deliver
 		addReasonText("determining reputation: %v", err)
 		return reject(smtp.C451LocalErr, smtp.SeSys3Other0, "error processing", err, reasonReputationError)
 	}
+	decision.ReputationMethod = string(method)
+	decision.ReputationJunk = isjunk
+	decision.ReputationConclusive = conclusive
 	log.Info("reputation analyzed",
 		slog.Bool("conclusive", conclusive),
 		slog.Any("isjunk", isjunk),
@@ -462,6 +552,7 @@ func analyze(ctx context.Context, log mlog.Log, resolver dns.Resolver, d deliver
 				reasonText:          reasonText,
 				dmarcOverrideReason: dmarcOverrideReason,
 				headers:             headers,
+				decision:            decision,
 			}
 		}
 		return reject(smtp.C451LocalErr, smtp.SeSys3Other0, "error processing", err, string(method))
@@ -478,6 +569,7 @@ func analyze(ctx context.Context, log mlog.Log, resolver dns.Resolver, d deliver
 			reasonText:          reasonText,
 			dmarcOverrideReason: dmarcOverrideReason,
 			headers:             headers,
+			decision:            decision,
 		}
 	}
 	// If there was no previous message from sender or its domain, and we have an SPF
@@ -507,6 +599,12 @@ func analyze(ctx context.Context, log mlog.Log, resolver dns.Resolver, d deliver
 		return reject(smtp.C451LocalErr, smtp.SeSys3Other0, "error processing", nil, reasonIPrev)
 	}
 
+	// Likewise for a lookalike sender domain.
+	if lookalikeJunk && isjunk != nil && *isjunk {
+		addReasonText("message has a mild junk signal and lookalike sender domain")
+		return reject(smtp.C451LocalErr, smtp.SeSys3Other0, "error processing", nil, reasonLookalikeDomain)
+	}
+
 	var subjectpassKey string
 	conf, _ := d.acc.Conf()
 	if conf.SubjectPass.Period > 0 {
@@ -529,6 +627,7 @@ func analyze(ctx context.Context, log mlog.Log, resolver dns.Resolver, d deliver
 				reasonText:          reasonText,
 				dmarcOverrideReason: dmarcOverrideReason,
 				headers:             headers,
+				decision:            decision,
 			}
 		}
 	}
@@ -581,7 +680,17 @@ func analyze(ctx context.Context, log mlog.Log, resolver dns.Resolver, d deliver
 		// With an iprev fail, non-TLS connection or our address not in To/Cc header, we set a higher bar for content.
 		reason = reasonJunkContent
 		var thresholdRemark string
-		if suspiciousIPrevFail && threshold > 0.25 {
+		if lookalikeJunk && threshold > 0.25 {
+			threshold = 0.25
+			log.Info("setting junk threshold due to lookalike sender domain", slog.Float64("threshold", threshold))
+			reason = reasonJunkContentStrict
+			thresholdRemark = " (stricter due to lookalike sender domain)"
+		} else if d.spoofProtect && threshold > 0.25 {
+			threshold = 0.25
+			log.Info("setting junk threshold due to spoofing incident for sender domain", slog.Float64("threshold", threshold))
+			reason = reasonJunkContentStrict
+			thresholdRemark = " (stricter due to spoofing incident for sender domain)"
+		} else if suspiciousIPrevFail && threshold > 0.25 {
 			threshold = 0.25
 			log.Info("setting junk threshold due to iprev fail", slog.Float64("threshold", threshold))
 			reason = reasonJunkContentStrict
@@ -601,8 +710,14 @@ func analyze(ctx context.Context, log mlog.Log, resolver dns.Resolver, d deliver
 			reason = reasonJunkContentStrict
 			thresholdRemark = " (stricter due to recipient address not in to/cc header)"
 		}
-		accept = result.Probability <= threshold || (!result.Significant && !suspiciousIPrevFail)
+		accept = result.Probability <= threshold || (!result.Significant && !suspiciousIPrevFail && !lookalikeJunk && !d.spoofProtect)
 		junkSubjectpass = result.Probability < threshold-0.2
+		decision.ContentAnalyzed = true
+		decision.Probability = result.Probability
+		decision.Significant = result.Significant
+		decision.Threshold = threshold
+		decision.HamWords = result.Hams
+		decision.SpamWords = result.Spams
 		log.Info("content analyzed",
 			slog.Bool("accept", accept),
 			slog.Float64("contentprob", result.Probability),
@@ -680,6 +795,7 @@ func analyze(ctx context.Context, log mlog.Log, resolver dns.Resolver, d deliver
 			if blocked(zone) {
 				accept = false
 				dnsblocklisted = true
+				decision.DNSBLZone = zone.Name()
 				reason = reasonDNSBlocklisted
 				addReasonText("dnsbl: ip %s listed in dnsbl %s", d.m.RemoteIP, zone.XName(d.smtputf8))
 				break
@@ -700,6 +816,7 @@ func analyze(ctx context.Context, log mlog.Log, resolver dns.Resolver, d deliver
 			reasonText:          reasonText,
 			dmarcOverrideReason: dmarcOverrideReason,
 			headers:             headers,
+			decision:            decision,
 		}
 	}
 
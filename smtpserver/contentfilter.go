@@ -0,0 +1,287 @@
+package smtpserver
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/mjl-/mox/config"
+	"github.com/mjl-/mox/message"
+	"github.com/mjl-/mox/mlog"
+	"github.com/mjl-/mox/moxio"
+	"github.com/mjl-/mox/moxvar"
+	"github.com/mjl-/mox/smtp"
+	"github.com/mjl-/mox/store"
+)
+
+// contentFilterResult is the verdict of a content filter, as JSON written to stdout
+// by a command or returned in the body of an HTTP response.
+type contentFilterResult struct {
+	// One of accept (default if empty), reject, tempfail or quarantine.
+	Action string
+
+	// For reject and tempfail, the SMTP code, enhanced status code (e.g. "7.1") and
+	// text for the response. Defaults are used when absent or invalid.
+	Code   int
+	Secode string
+	Text   string
+
+	// Header fields to add at the top of the message. For all actions that deliver
+	// the message.
+	Headers []contentFilterHeader
+
+	// If set, replaces the message. Base64-encoded in JSON. Header fields in
+	// Headers are added to the rewritten message.
+	Rewrite []byte
+}
+
+type contentFilterHeader struct {
+	Name  string
+	Value string
+}
+
+// contentFilterTransaction holds details of the SMTP transaction passed to filters.
+type contentFilterTransaction struct {
+	RemoteIP string
+	EHLO     string
+	MailFrom string
+	RcptTo   []string
+	TLS      bool
+}
+
+var contentFilterClient = &http.Client{}
+
+// contentFilterVerdict passes the message to the filter and returns its verdict.
+func contentFilterVerdict(ctx context.Context, f config.ContentFilter, tx contentFilterTransaction, msgFile *os.File, size int64) (contentFilterResult, error) {
+	timeout := f.Timeout
+	if timeout == 0 {
+		timeout = 30 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	tlsStr := "no"
+	if tx.TLS {
+		tlsStr = "yes"
+	}
+
+	// The verdict can hold a rewritten message, base64-encoded. Anything much larger
+	// is not a valid verdict, we don't want to read unbounded output into memory.
+	maxOutput := 2*size + 64*1024
+
+	var output []byte
+	if len(f.Command) > 0 {
+		cmd := exec.CommandContext(ctx, f.Command[0], f.Command[1:]...)
+		cmd.Stdin = io.NewSectionReader(msgFile, 0, size)
+		cmd.Env = append(os.Environ(),
+			"MOX_REMOTE_IP="+tx.RemoteIP,
+			"MOX_EHLO="+tx.EHLO,
+			"MOX_MAIL_FROM="+tx.MailFrom,
+			"MOX_RCPT_TO="+strings.Join(tx.RcptTo, " "),
+			"MOX_TLS="+tlsStr,
+		)
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+		stdout, err := cmd.StdoutPipe()
+		if err != nil {
+			return contentFilterResult{}, fmt.Errorf("stdout pipe for command: %v", err)
+		}
+		if err := cmd.Start(); err != nil {
+			return contentFilterResult{}, fmt.Errorf("starting command: %v", err)
+		}
+		buf, err := io.ReadAll(&moxio.LimitReader{R: stdout, Limit: maxOutput})
+		if err != nil {
+			// Kill the command, it may still be writing.
+			cancel()
+			cmd.Wait()
+			return contentFilterResult{}, fmt.Errorf("reading command output: %v", err)
+		}
+		if err := cmd.Wait(); err != nil {
+			return contentFilterResult{}, fmt.Errorf("running command: %v (stderr %q)", err, strings.TrimSpace(stderr.String()))
+		}
+		output = buf
+	} else {
+		req, err := http.NewRequestWithContext(ctx, "POST", f.URL, io.NewSectionReader(msgFile, 0, size))
+		if err != nil {
+			return contentFilterResult{}, fmt.Errorf("new request: %v", err)
+		}
+		req.ContentLength = size
+		req.Header.Set("User-Agent", fmt.Sprintf("mox/%s (contentfilter)", moxvar.Version))
+		req.Header.Set("Content-Type", "message/rfc822")
+		req.Header.Set("X-Mox-Remote-IP", tx.RemoteIP)
+		req.Header.Set("X-Mox-EHLO", tx.EHLO)
+		req.Header.Set("X-Mox-Mail-From", tx.MailFrom)
+		for _, s := range tx.RcptTo {
+			req.Header.Add("X-Mox-Rcpt-To", s)
+		}
+		req.Header.Set("X-Mox-TLS", tlsStr)
+		resp, err := contentFilterClient.Do(req)
+		if err != nil {
+			return contentFilterResult{}, fmt.Errorf("http transaction: %v", err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return contentFilterResult{}, fmt.Errorf("http status %q, expected 200 ok", resp.Status)
+		}
+		output, err = io.ReadAll(&moxio.LimitReader{R: resp.Body, Limit: maxOutput})
+		if err != nil {
+			return contentFilterResult{}, fmt.Errorf("reading response: %v", err)
+		}
+	}
+
+	var r contentFilterResult
+	if err := json.Unmarshal(output, &r); err != nil {
+		return contentFilterResult{}, fmt.Errorf("parsing verdict: %v", err)
+	}
+	switch r.Action {
+	case "":
+		r.Action = "accept"
+	case "accept", "reject", "tempfail", "quarantine":
+	default:
+		return contentFilterResult{}, fmt.Errorf("unknown action %q in verdict", r.Action)
+	}
+	for _, h := range r.Headers {
+		if h.Name == "" || strings.ContainsAny(h.Name, ": \t\r\n") || strings.ContainsAny(h.Value, "\r\n") {
+			return contentFilterResult{}, fmt.Errorf("invalid header %q in verdict", h.Name)
+		}
+	}
+	return r, nil
+}
+
+// contentFilterResponse returns the SMTP code, enhanced status code and text for a
+// reject or tempfail verdict, with defaults for missing or invalid values.
+func contentFilterResponse(r contentFilterResult) (code int, secode, text string) {
+	code, secode, text = r.Code, r.Secode, r.Text
+	if r.Action == "reject" && (code < 500 || code > 599) {
+		code = smtp.C550MailboxUnavail
+	} else if r.Action == "tempfail" && (code < 400 || code > 499) {
+		code = smtp.C451LocalErr
+	}
+	if t := strings.Split(secode, "."); len(t) != 2 || t[0] == "" || t[1] == "" || strings.Trim(secode, "0123456789.") != "" {
+		secode = smtp.SePol7Other0
+	}
+	if text == "" || strings.ContainsAny(text, "\r\n") {
+		text = "message refused by content filter"
+	}
+	return
+}
+
+// contentFilterRewrite writes a new version of the message to a temporary file,
+// with headers added at the top, followed by rewrite if not nil, or by the
+// message in msgFile otherwise. Bare newlines are replaced with CRLF. The caller
+// must close and remove the returned file.
+func contentFilterRewrite(log mlog.Log, msgFile *os.File, size int64, headers []contentFilterHeader, rewrite []byte) (rf *os.File, rw *message.Writer, rerr error) {
+	f, err := store.CreateMessageTemp(log, "smtp-contentfilter")
+	if err != nil {
+		return nil, nil, fmt.Errorf("creating temporary file: %v", err)
+	}
+	defer func() {
+		if rerr != nil {
+			store.CloseRemoveTempFile(log, f, "message from content filter")
+		}
+	}()
+
+	bw := bufio.NewWriter(f)
+	mw := message.NewWriter(bw)
+	for _, h := range headers {
+		if _, err := fmt.Fprintf(mw, "%s: %s\r\n", h.Name, h.Value); err != nil {
+			return nil, nil, fmt.Errorf("writing header: %v", err)
+		}
+	}
+	var r io.Reader = io.NewSectionReader(msgFile, 0, size)
+	if rewrite != nil {
+		r = bytes.NewReader(rewrite)
+	}
+	if _, err := io.Copy(mw, r); err != nil {
+		return nil, nil, fmt.Errorf("writing message: %v", err)
+	}
+	if err := bw.Flush(); err != nil {
+		return nil, nil, fmt.Errorf("writing message: %v", err)
+	}
+	return f, mw, nil
+}
+
+// contentFilters passes the message through the configured filters, in order. The
+// first filter that does not accept the message determines the outcome. Reject and
+// tempfail verdicts abort the SMTP transaction with an error. For a quarantine
+// verdict, the mailbox to deliver to is returned. If a filter adds headers or
+// rewrites the message, a new message file and writer are returned, the caller
+// must close and remove the file.
+func contentFilters(ctx context.Context, log mlog.Log, filters []config.ContentFilter, tx contentFilterTransaction, msgFile *os.File, msgWriter *message.Writer) (quarantineMailbox string, rf *os.File, rw *message.Writer) {
+	defer func() {
+		x := recover()
+		if x == nil {
+			return
+		}
+		// Don't leave a temporary file behind when aborting with an smtp error.
+		if rf != nil {
+			store.CloseRemoveTempFile(log, rf, "message from content filter")
+		}
+		panic(x)
+	}()
+
+	for _, f := range filters {
+		flog := log.With(slog.String("contentfilter", f.Name))
+
+		if f.MaxSize > 0 && msgWriter.Size > f.MaxSize {
+			flog.Debug("message too large for content filter, skipping", slog.Int64("size", msgWriter.Size))
+			metricContentFilter.WithLabelValues(f.Name, "skipped").Inc()
+			continue
+		}
+
+		t0 := time.Now()
+		r, err := contentFilterVerdict(ctx, f, tx, msgFile, msgWriter.Size)
+		if err != nil {
+			metricContentFilter.WithLabelValues(f.Name, "error").Inc()
+			if f.OnError == "accept" {
+				flog.Errorx("content filter failed, continuing without verdict", err)
+				continue
+			}
+			flog.Errorx("content filter failed", err)
+			xsmtpServerErrorf(codes{smtp.C451LocalErr, smtp.SeSys3Other0}, "error processing")
+		}
+		metricContentFilter.WithLabelValues(f.Name, r.Action).Inc()
+		flog.Info("content filter verdict",
+			slog.String("action", r.Action),
+			slog.Int("headers", len(r.Headers)),
+			slog.Bool("rewrite", r.Rewrite != nil),
+			slog.Duration("duration", time.Since(t0)))
+
+		switch r.Action {
+		case "reject", "tempfail":
+			code, secode, text := contentFilterResponse(r)
+			xsmtpUserErrorf(code, secode, "%s", text)
+		}
+
+		if len(r.Headers) > 0 || r.Rewrite != nil {
+			nf, nw, err := contentFilterRewrite(flog, msgFile, msgWriter.Size, r.Headers, r.Rewrite)
+			if err != nil {
+				flog.Errorx("writing message from content filter", err)
+				xsmtpServerErrorf(codes{smtp.C451LocalErr, smtp.SeSys3Other0}, "error processing")
+			}
+			if rf != nil {
+				store.CloseRemoveTempFile(log, rf, "message from content filter")
+			}
+			rf, rw = nf, nw
+			msgFile, msgWriter = nf, nw
+		}
+
+		if r.Action == "quarantine" {
+			quarantineMailbox = f.QuarantineMailbox
+			if quarantineMailbox == "" {
+				quarantineMailbox = "Junk"
+			}
+			return
+		}
+	}
+	return
+}
@@ -0,0 +1,172 @@
+package smtpserver
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/mjl-/bstore"
+
+	"github.com/mjl-/mox/config"
+	"github.com/mjl-/mox/dns"
+	"github.com/mjl-/mox/mox-"
+	"github.com/mjl-/mox/smtp"
+	"github.com/mjl-/mox/smtpclient"
+	"github.com/mjl-/mox/store"
+)
+
+// Content filters can accept (adding headers or rewriting), reject, tempfail or
+// quarantine incoming messages.
+func TestContentFilter(t *testing.T) {
+	resolver := dns.MockResolver{
+		A: map[string][]string{
+			"example.org.": {"127.0.0.10"}, // For mx check.
+		},
+		PTR: map[string][]string{
+			"127.0.0.10": {"example.org."}, // For iprev check.
+		},
+	}
+	ts := newTestServer(t, filepath.FromSlash("../testdata/smtp/mox.conf"), resolver)
+	defer ts.close()
+
+	// Verdict returned by the http filter, and request headers it saw.
+	var verdict string
+	var reqHeader http.Header
+	var reqBody string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reqHeader = r.Header
+		buf, _ := io.ReadAll(r.Body)
+		reqBody = string(buf)
+		if verdict == "" {
+			http.Error(w, "broken", http.StatusInternalServerError)
+			return
+		}
+		fmt.Fprint(w, verdict)
+	}))
+	defer srv.Close()
+
+	orig := mox.Conf.Static.Listeners["test"]
+	defer func() {
+		mox.Conf.Static.Listeners["test"] = orig
+	}()
+	setFilters := func(filters ...config.ContentFilter) {
+		l := orig
+		l.SMTP.ContentFilters = filters
+		mox.Conf.Static.Listeners["test"] = l
+	}
+	httpFilter := config.ContentFilter{Name: "http", URL: srv.URL}
+	setFilters(httpFilter)
+
+	msg := strings.ReplaceAll(`From: <remote@example.org>
+To: <mjl@mox.example>
+Subject: test
+
+test email
+`, "\n", "\r\n")
+
+	deliver := func(expErr *smtpclient.Error) {
+		t.Helper()
+		ts.run(func(client *smtpclient.Client) {
+			err := client.Deliver(ctxbg, "remote@example.org", "mjl@mox.example", int64(len(msg)), strings.NewReader(msg), false, false, false)
+			ts.smtpErr(err, expErr)
+		})
+	}
+	lastMessage := func() (store.Message, string) {
+		t.Helper()
+		m, err := bstore.QueryDB[store.Message](ctxbg, ts.acc.DB).SortDesc("ID").Limit(1).Get()
+		tcheck(t, err, "get delivered message")
+		buf, err := io.ReadAll(ts.acc.MessageReader(m))
+		tcheck(t, err, "read message")
+		tcompare(t, int64(len(buf)), m.Size)
+		return m, string(buf)
+	}
+
+	// Accept with headers.
+	verdict = `{"Action": "accept", "Headers": [{"Name": "X-Virus-Scanned", "Value": "clean"}]}`
+	deliver(nil)
+	ts.checkCount("Inbox", 1)
+	tcompare(t, reqBody, msg)
+	tcompare(t, reqHeader.Get("X-Mox-Mail-From"), "remote@example.org")
+	tcompare(t, reqHeader.Values("X-Mox-Rcpt-To"), []string{"mjl@mox.example"})
+	_, data := lastMessage()
+	tcompare(t, strings.Contains(data, "\r\nX-Virus-Scanned: clean\r\nFrom: <remote@example.org>\r\n"), true)
+
+	// Rewritten message.
+	verdict = `{"Rewrite": "` + base64.StdEncoding.EncodeToString([]byte("From: <remote@example.org>\r\nTo: <mjl@mox.example>\r\nSubject: [SPAM] test\r\n\r\ntest email\r\n")) + `"}`
+	deliver(nil)
+	ts.checkCount("Inbox", 2)
+	_, data = lastMessage()
+	tcompare(t, strings.Contains(data, "\r\nSubject: [SPAM] test\r\n"), true)
+
+	// Reject, with code from filter, and defaults.
+	verdict = `{"Action": "reject", "Code": 554, "Secode": "7.1", "Text": "virus found"}`
+	deliver(&smtpclient.Error{Permanent: true, Code: smtp.C554TransactionFailed, Secode: smtp.SePol7DeliveryUnauth1})
+	verdict = `{"Action": "reject", "Code": 451}`
+	deliver(&smtpclient.Error{Permanent: true, Code: smtp.C550MailboxUnavail, Secode: smtp.SePol7Other0})
+	verdict = `{"Action": "tempfail"}`
+	deliver(&smtpclient.Error{Code: smtp.C451LocalErr, Secode: smtp.SePol7Other0})
+	ts.checkCount("Inbox", 2)
+
+	// Quarantine.
+	verdict = `{"Action": "quarantine", "Headers": [{"Name": "X-Spam", "Value": "yes"}]}`
+	deliver(nil)
+	ts.checkCount("Inbox", 2)
+	ts.checkCount("Junk", 1)
+	m, data := lastMessage()
+	tcompare(t, m.Seen, true)
+	tcompare(t, strings.Contains(data, "X-Mox-Reason: content-filter"), true)
+	tcompare(t, strings.Contains(data, "\r\nX-Spam: yes\r\n"), true)
+
+	// Failing filter causes temporary error, unless configured to continue.
+	verdict = ""
+	deliver(&smtpclient.Error{Code: smtp.C451LocalErr, Secode: smtp.SeSys3Other0})
+	verdict = `{"Action": "bogus"}`
+	deliver(&smtpclient.Error{Code: smtp.C451LocalErr, Secode: smtp.SeSys3Other0})
+	// Verdict larger than twice the message size plus 64KB.
+	verdict = `{"Text": "` + strings.Repeat("x", 2*len(msg)+64*1024) + `"}`
+	deliver(&smtpclient.Error{Code: smtp.C451LocalErr, Secode: smtp.SeSys3Other0})
+	httpFilter.OnError = "accept"
+	setFilters(httpFilter)
+	deliver(nil)
+	ts.checkCount("Inbox", 3)
+
+	// Messages larger than max size are not filtered.
+	verdict = `{"Action": "reject"}`
+	setFilters(config.ContentFilter{Name: "http", URL: srv.URL, MaxSize: 10})
+	deliver(nil)
+	ts.checkCount("Inbox", 4)
+
+	if runtime.GOOS == "windows" {
+		return
+	}
+
+	// Command, chained after the http filter, sees the headers added by the first
+	// filter.
+	script := filepath.Join(t.TempDir(), "filter.sh")
+	err := os.WriteFile(script, []byte(`#!/bin/sh
+if grep -q '^X-Virus-Scanned: clean' && test "$MOX_RCPT_TO" = "mjl@mox.example"; then
+	echo '{"Action": "reject", "Text": "from command"}'
+else
+	echo '{}'
+fi
+`), 0700)
+	tcheck(t, err, "write filter script")
+	verdict = `{"Headers": [{"Name": "X-Virus-Scanned", "Value": "clean"}]}`
+	setFilters(httpFilter, config.ContentFilter{Name: "command", Command: []string{script}})
+	deliver(&smtpclient.Error{Permanent: true, Code: smtp.C550MailboxUnavail, Secode: smtp.SePol7Other0})
+	verdict = `{}`
+	deliver(nil)
+	ts.checkCount("Inbox", 5)
+
+	// Command with unbounded output is stopped and fails.
+	setFilters(config.ContentFilter{Name: "command", Command: []string{"yes"}})
+	deliver(&smtpclient.Error{Code: smtp.C451LocalErr, Secode: smtp.SeSys3Other0})
+	ts.checkCount("Inbox", 5)
+}
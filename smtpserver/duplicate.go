@@ -0,0 +1,38 @@
+package smtpserver
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/mjl-/mox/config"
+	"github.com/mjl-/mox/message"
+	"github.com/mjl-/mox/mlog"
+	"github.com/mjl-/mox/store"
+)
+
+// duplicateWindow returns the duplicate detection settings for the delivery, from
+// the destination or otherwise the account. Returns nil if duplicate detection is
+// disabled.
+func duplicateWindow(d delivery) *config.DuplicateWindow {
+	dw := d.destination.DuplicateWindow
+	if dw == nil {
+		conf, _ := d.acc.Conf()
+		dw = conf.DuplicateWindow
+	}
+	if dw == nil || dw.Period <= 0 {
+		return nil
+	}
+	return dw
+}
+
+// isDuplicate returns whether a message with the same Message-ID header was
+// delivered to the account during the past period.
+func isDuplicate(ctx context.Context, log mlog.Log, acc *store.Account, messageIDHeader string, period time.Duration) (bool, error) {
+	msgID, _, err := message.MessageIDCanonical(messageIDHeader)
+	if err != nil || msgID == "" {
+		log.Debugx("no usable message-id for duplicate check", err, slog.String("messageid", messageIDHeader))
+		return false, nil
+	}
+	return acc.DuplicatePresent(ctx, msgID, time.Now().Add(-period))
+}
@@ -0,0 +1,119 @@
+package smtpserver
+
+import (
+	"crypto/md5"
+	"crypto/tls"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/mjl-/mox/mox-"
+	"github.com/mjl-/mox/smtp"
+)
+
+var (
+	metricFingerprintRule = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "mox_smtpserver_fingerprint_rule_total",
+			Help: "Incoming delivery connections matching a fingerprint rule, by action.",
+		},
+		[]string{
+			"action", // reject, slow
+		},
+	)
+)
+
+// Maximum number of commands included in the SMTP fingerprint.
+const smtpFingerprintMax = 10
+
+// tlsFingerprint returns a fingerprint for the client hello, similar to JA3: A
+// hexadecimal MD5 hash over the supported TLS versions, cipher suites, curves,
+// point formats, signature schemes and application protocols, in the order sent
+// by the client. GREASE values are skipped. Unlike JA3, the extensions are not
+// included, they are not exposed by crypto/tls.
+func tlsFingerprint(hello *tls.ClientHelloInfo) string {
+	// Reserved values for "generate random extensions and sustain extensibility",
+	// sent by clients to keep servers from ossifying. ../rfc/8701:215
+	isGREASE := func(v uint16) bool {
+		return v&0x0f0f == 0x0a0a && v>>8 == v&0xff
+	}
+	join := func(n int, get func(int) uint16) string {
+		var l []string
+		for i := 0; i < n; i++ {
+			if v := get(i); !isGREASE(v) {
+				l = append(l, strconv.Itoa(int(v)))
+			}
+		}
+		return strings.Join(l, "-")
+	}
+	fields := []string{
+		join(len(hello.SupportedVersions), func(i int) uint16 { return hello.SupportedVersions[i] }),
+		join(len(hello.CipherSuites), func(i int) uint16 { return hello.CipherSuites[i] }),
+		join(len(hello.SupportedCurves), func(i int) uint16 { return uint16(hello.SupportedCurves[i]) }),
+		join(len(hello.SupportedPoints), func(i int) uint16 { return uint16(hello.SupportedPoints[i]) }),
+		join(len(hello.SignatureSchemes), func(i int) uint16 { return uint16(hello.SignatureSchemes[i]) }),
+		strings.Join(hello.SupportedProtos, "-"),
+	}
+	h := md5.Sum([]byte(strings.Join(fields, ",")))
+	return hex.EncodeToString(h[:])
+}
+
+// commandShape returns the form of a command for the SMTP fingerprint: the
+// command as sent, and for MAIL and RCPT the parameter up to and including the
+// "<" of the address. HELO/EHLO with an address literal get " [" appended. A "+"
+// is appended if the remote sent more data without waiting for our response.
+func commandShape(cmd, cmdl, args string, pipelined bool) string {
+	s := cmd
+	switch cmdl {
+	case "mail", "rcpt":
+		if i := strings.IndexByte(args, '<'); i >= 0 && i < 16 {
+			s += args[:i+1]
+		}
+	case "helo", "ehlo":
+		if strings.HasPrefix(args, " [") {
+			s += " ["
+		}
+	}
+	if pipelined {
+		s += "+"
+	}
+	return s
+}
+
+// xfingerprintCheck logs the fingerprints of the connection, and applies the
+// first matching fingerprint rule of the listener. Called at the first MAIL FROM
+// of an incoming delivery connection.
+func (c *conn) xfingerprintCheck() {
+	if c.fingerprinted {
+		return
+	}
+	c.fingerprinted = true
+
+	smtpFP := strings.Join(c.smtpFingerprint, ",")
+	c.log.Info("fingerprints", slog.String("tls", c.tlsFingerprint), slog.String("smtp", smtpFP))
+
+	for _, r := range c.fingerprintRules {
+		if r.TLS != "" && r.TLS != c.tlsFingerprint || r.SMTP != "" && r.SMTP != smtpFP {
+			continue
+		}
+		metricFingerprintRule.WithLabelValues(r.Action).Inc()
+		c.log.Info("connection matches fingerprint rule", slog.String("action", r.Action), slog.String("tls", r.TLS), slog.String("smtp", r.SMTP))
+		switch r.Action {
+		case "reject":
+			// No need to tell the remote why. We delay like for other bad behaviour.
+			if badClientDelay > 0 {
+				mox.Sleep(mox.Context, badClientDelay)
+			}
+			c.writecodeline(smtp.C554TransactionFailed, smtp.SePol7Other0, fmt.Sprintf("not accepting messages from this connection (%s)", mox.ReceivedID(c.cid)), nil)
+			panic(errIO)
+		case "slow":
+			c.setSlow(true)
+		}
+		return
+	}
+}
@@ -0,0 +1,84 @@
+package smtpserver
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/mjl-/mox/dkim"
+	"github.com/mjl-/mox/dns"
+	"github.com/mjl-/mox/mlog"
+	"github.com/mjl-/mox/mox-"
+	"github.com/mjl-/mox/queue"
+	"github.com/mjl-/mox/smtp"
+	"github.com/mjl-/mox/store"
+)
+
+// forward queues a copy of the message for addresses in "to", for forwarding
+// configured for the destination, and for redirects by sieve scripts and
+// rulesets. The SMTP MAIL FROM address is rewritten with SRS to an address at the
+// domain of the recipient, so SPF verification at the next hop passes and bounces
+// can be sent back to the original sender. A Delivered-To header is added, and the
+// copy is ARC-sealed and DKIM-signed by the domain of the recipient. The DSN
+// parameters of the incoming message are passed on, and DSNs about the forwarded
+// copy are sent to the original sender, not to the account of the recipient.
+//
+// The number of queued messages is returned, zero if the message was already
+// delivered to the recipient before, i.e. is looping.
+func forward(ctx context.Context, log mlog.Log, d delivery, mailFrom smtp.Path, to []string, dataFile *os.File, size int64, has8bit, smtputf8 bool, requireTLS *bool, dsnp dsnParams, messageID, subject, recvHdr string, arcSeal func(domain dns.Domain, prefix []byte) []byte) (int, error) {
+	// Messages that already passed through the recipient address are not forwarded
+	// again, preventing loops.
+	for _, v := range d.msgHeader.Values("Delivered-To") {
+		if strings.EqualFold(strings.TrimSpace(v), d.deliverTo.XString(true)) {
+			log.Info("not forwarding message that was already delivered to recipient, possible loop")
+			return 0, nil
+		}
+	}
+
+	domain := d.deliverTo.IPDomain.Domain
+	fwFrom := mox.SRSForward(mailFrom, domain)
+
+	prefix := []byte("Delivered-To: " + d.deliverTo.XString(smtputf8) + "\r\n" + recvHdr)
+	prefix = arcSeal(domain, prefix)
+
+	// The original DKIM signatures may still verify, but our signature aligns with the
+	// rewritten MAIL FROM, helping with reputation at the next hop.
+	if confDom, ok := mox.Conf.Domain(domain); ok {
+		if selectors := mox.DKIMSelectors(confDom.DKIM); len(selectors) > 0 {
+			dkimHeaders, err := dkim.Sign(ctx, log.Logger, fwFrom.Localpart, domain, selectors, smtputf8, store.FileMsgReader(prefix, dataFile))
+			if err != nil {
+				log.Errorx("dkim signing forwarded message, continuing without", err)
+			} else {
+				prefix = append([]byte(dkimHeaders), prefix...)
+			}
+		}
+	}
+
+	var qml []queue.Msg
+	for _, s := range to {
+		addr, err := smtp.ParseAddress(s)
+		if err != nil {
+			log.Infox("parsing forward address, skipping", err, slog.String("address", s))
+			continue
+		}
+		if addr.Path().Equal(d.deliverTo) || addr == d.msgFrom {
+			log.Info("not forwarding to recipient or sender", slog.Any("address", addr))
+			continue
+		}
+		qm := queue.MakeMsg(fwFrom, addr.Path(), has8bit, smtputf8, int64(len(prefix))+size, messageID, prefix, requireTLS, time.Now(), subject)
+		dsnp.set(&qm)
+		// Failures go to the original sender, not to the account of the recipient.
+		qm.Relayed = true
+		qml = append(qml, qm)
+	}
+	if len(qml) == 0 {
+		return 0, nil
+	}
+	if err := queue.Add(ctx, log, d.acc.Name, dataFile, qml...); err != nil {
+		return 0, err
+	}
+	log.Info("message queued for forwarding", slog.Int("count", len(qml)), slog.Any("mailfrom", fwFrom))
+	return len(qml), nil
+}
@@ -0,0 +1,158 @@
+package smtpserver
+
+import (
+	cryptorand "crypto/rand"
+	"crypto/rsa"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mjl-/mox/config"
+	"github.com/mjl-/mox/dkim"
+	"github.com/mjl-/mox/dns"
+	"github.com/mjl-/mox/mox-"
+	"github.com/mjl-/mox/queue"
+	"github.com/mjl-/mox/smtp"
+	"github.com/mjl-/mox/smtpclient"
+	"github.com/mjl-/mox/srs"
+)
+
+// Messages for a destination with forwarding are queued with an SRS address as
+// MAIL FROM, and bounces to that address are sent back to the original sender.
+func TestDestinationForward(t *testing.T) {
+	resolver := dns.MockResolver{
+		A: map[string][]string{
+			"example.org.": {"127.0.0.10"}, // For mx check.
+		},
+		PTR: map[string][]string{
+			"127.0.0.10": {"example.org."},
+		},
+	}
+	ts := newTestServer(t, filepath.FromSlash("../testdata/smtp/mox.conf"), resolver)
+	defer ts.close()
+
+	key, err := rsa.GenerateKey(cryptorand.Reader, 1024)
+	tcheck(t, err, "generate rsa key")
+	dom, _ := mox.Conf.Domain(dns.Domain{ASCII: "mox.example"})
+	dom.DKIM = config.DKIM{
+		Selectors: map[string]config.Selector{
+			"sel": {
+				HashEffective:    "sha256",
+				HeadersEffective: []string{"From", "To", "Subject"},
+				Key:              key,
+				Domain:           dns.Domain{ASCII: "sel"},
+			},
+		},
+		Sign: []string{"sel"},
+	}
+	mox.Conf.Dynamic.Domains["mox.example"] = dom
+	record := dkim.Record{Version: "DKIM1", Key: "rsa", PublicKey: key.Public()}
+	txt, err := record.Record()
+	tcheck(t, err, "dkim record")
+	resolver.TXT = map[string][]string{"sel._domainkey.mox.example.": {txt}}
+
+	var msg = strings.ReplaceAll(`From: <other@example.org>
+To: <fwd@mox.example>
+Subject: test
+
+test email
+`, "\n", "\r\n")
+
+	ts.run(func(client *smtpclient.Client) {
+		err := client.Deliver(ctxbg, "other@example.org", "fwd@mox.example", int64(len(msg)), strings.NewReader(msg), false, false, false)
+		ts.smtpErr(err, nil)
+	})
+
+	// Message is only forwarded, not stored.
+	ts.checkCount("Inbox", 0)
+	msgs, err := queue.List(ctxbg, queue.Filter{}, queue.Sort{})
+	tcheck(t, err, "list queue")
+	tcompare(t, len(msgs), 1)
+	qm := msgs[0]
+	tcompare(t, qm.Recipient().XString(true), "remote@remote.example")
+	tcompare(t, srs.IsSRS(qm.SenderLocalpart), true)
+	tcompare(t, qm.SenderDomain.Domain.ASCII, "mox.example")
+	prefix := string(qm.MsgPrefix)
+	tcompare(t, strings.HasPrefix(prefix, "DKIM-Signature: "), true)
+	tcompare(t, strings.Contains(prefix, "\r\nARC-Seal: i=1;"), true)
+	tcompare(t, strings.Contains(prefix, "\r\nDelivered-To: fwd@mox.example\r\n"), true)
+
+	data, err := os.ReadFile(qm.MessagePath())
+	tcheck(t, err, "read queued message")
+	results, err := dkim.Verify(ctxbg, pkglog.Logger, resolver, false, dkim.DefaultPolicy, strings.NewReader(prefix+string(data)), false)
+	tcheck(t, err, "dkim verify")
+	tcompare(t, len(results), 1)
+	tcompare(t, results[0].Status, dkim.StatusPass)
+
+	srsAddr := qm.Sender().XString(true)
+
+	// A failure to deliver the forwarded message results in a DSN for the original
+	// sender, not a message in the account of the forwarding address.
+	tcompare(t, qm.Relayed, true)
+	_, err = queue.Fail(ctxbg, pkglog, queue.Filter{})
+	tcheck(t, err, "fail queued message")
+	ts.checkCount("Inbox", 0)
+	msgs, err = queue.List(ctxbg, queue.Filter{}, queue.Sort{})
+	tcheck(t, err, "list queue")
+	tcompare(t, len(msgs), 1)
+	tcompare(t, msgs[0].Recipient().XString(true), "other@example.org")
+	tcompare(t, msgs[0].Sender().IsZero(), true)
+	_, err = queue.Drop(ctxbg, pkglog, queue.Filter{})
+	tcheck(t, err, "drop queue")
+
+	// Bounce to the SRS address is queued for the original sender.
+	dsnMsg := strings.ReplaceAll(`From: <postmaster@remote.example>
+To: <`+srsAddr+`>
+Subject: delivery failure
+
+no such user
+`, "\n", "\r\n")
+	ts.run(func(client *smtpclient.Client) {
+		err := client.Deliver(ctxbg, "", srsAddr, int64(len(dsnMsg)), strings.NewReader(dsnMsg), false, false, false)
+		ts.smtpErr(err, nil)
+	})
+	msgs, err = queue.List(ctxbg, queue.Filter{}, queue.Sort{})
+	tcheck(t, err, "list queue")
+	tcompare(t, len(msgs), 1)
+	tcompare(t, msgs[0].Recipient().XString(true), "other@example.org")
+	tcompare(t, msgs[0].Sender().IsZero(), true)
+	_, err = queue.Drop(ctxbg, pkglog, queue.Filter{})
+	tcheck(t, err, "drop queue")
+
+	// Forged SRS address is refused.
+	forged := strings.Replace(srsAddr, "=other@", "=forged@", 1)
+	ts.run(func(client *smtpclient.Client) {
+		err := client.Deliver(ctxbg, "", forged, int64(len(dsnMsg)), strings.NewReader(dsnMsg), false, false, false)
+		ts.smtpErr(err, &smtpclient.Error{Permanent: true, Code: smtp.C550MailboxUnavail, Secode: smtp.SeAddr1UnknownDestMailbox1})
+	})
+
+	// A message that was already delivered to the destination is looping, it is
+	// stored instead of forwarded again.
+	ts.run(func(client *smtpclient.Client) {
+		lmsg := "Delivered-To: fwd@mox.example\r\n" + msg
+		err := client.Deliver(ctxbg, "other@example.org", "fwd@mox.example", int64(len(lmsg)), strings.NewReader(lmsg), false, false, false)
+		ts.smtpErr(err, nil)
+	})
+	ts.checkCount("Inbox", 1)
+	msgs, err = queue.List(ctxbg, queue.Filter{}, queue.Sort{})
+	tcheck(t, err, "list queue")
+	tcompare(t, len(msgs), 0)
+
+	// Failure to deliver a forwarded message with null reverse path is dropped
+	// without DSN.
+	ts.run(func(client *smtpclient.Client) {
+		err := client.Deliver(ctxbg, "", "fwd@mox.example", int64(len(msg)), strings.NewReader(msg), false, false, false)
+		ts.smtpErr(err, nil)
+	})
+	msgs, err = queue.List(ctxbg, queue.Filter{}, queue.Sort{})
+	tcheck(t, err, "list queue")
+	tcompare(t, len(msgs), 1)
+	tcompare(t, msgs[0].Sender().IsZero(), true)
+	_, err = queue.Fail(ctxbg, pkglog, queue.Filter{})
+	tcheck(t, err, "fail queued message")
+	msgs, err = queue.List(ctxbg, queue.Filter{}, queue.Sort{})
+	tcheck(t, err, "list queue")
+	tcompare(t, len(msgs), 0)
+	ts.checkCount("Inbox", 1)
+}
@@ -0,0 +1,126 @@
+package smtpserver
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"mime"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/mjl-/mox/config"
+	"github.com/mjl-/mox/mlog"
+	"github.com/mjl-/mox/mox-"
+	"github.com/mjl-/mox/store"
+)
+
+// inboundHeaders returns the header changes configured for the domain of the
+// delivery, or nil if there are none or if the message is exempt because it has a
+// verified message From address in a domain of the organization.
+func inboundHeaders(d delivery) *config.InboundHeaders {
+	dom, ok := mox.Conf.Domain(d.deliverTo.IPDomain.Domain)
+	if !ok || dom.InboundHeaders == nil {
+		return nil
+	}
+	ih := dom.InboundHeaders
+	if d.m.MsgFromValidated {
+		if _, ok := mox.Conf.Domain(d.msgFrom.Domain); ok || slices.Contains(ih.ParsedInternalDomains, d.msgFrom.Domain) {
+			return nil
+		}
+	}
+	return ih
+}
+
+// inboundHeaderEncode returns s as MIME encoded-word if it has non-ASCII text.
+func inboundHeaderEncode(s string) string {
+	for _, c := range s {
+		if c >= 0x80 {
+			t := strings.TrimRight(s, " \t")
+			return mime.QEncoding.Encode("utf-8", t) + s[len(t):]
+		}
+	}
+	return s
+}
+
+// inboundHeadersAdd returns the header fields to add to the message, in sorted
+// order.
+func inboundHeadersAdd(ih *config.InboundHeaders) string {
+	var sb strings.Builder
+	keys := make([]string, 0, len(ih.Headers))
+	for k := range ih.Headers {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	for _, k := range keys {
+		fmt.Fprintf(&sb, "%s: %s\r\n", k, inboundHeaderEncode(ih.Headers[k]))
+	}
+	return sb.String()
+}
+
+// inboundSubjectRewrite writes a copy of the message in dataFile to a new temporary
+// file, with prefix prepended to the value of the Subject header, or with a
+// Subject header added if the message has none. The body of the message is copied
+// unchanged, so the MIME structure is preserved. The caller must close and remove
+// the returned file.
+func inboundSubjectRewrite(log mlog.Log, dataFile *os.File, size int64, prefix string) (rf *os.File, rsize int64, rerr error) {
+	f, err := store.CreateMessageTemp(log, "smtp-inboundheaders")
+	if err != nil {
+		return nil, 0, fmt.Errorf("creating temporary file: %v", err)
+	}
+	defer func() {
+		if rerr != nil {
+			store.CloseRemoveTempFile(log, f, "message with rewritten subject")
+		}
+	}()
+
+	prefix = inboundHeaderEncode(prefix)
+	br := bufio.NewReader(io.NewSectionReader(dataFile, 0, size))
+	bw := bufio.NewWriter(f)
+	var haveSubject bool
+	for {
+		line, err := br.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return nil, 0, fmt.Errorf("reading message header: %v", err)
+		}
+		if line == "\r\n" || line == "\n" || err == io.EOF {
+			// End of header. Add a Subject if we haven't seen one.
+			if !haveSubject {
+				if _, err := fmt.Fprintf(bw, "Subject: %s\r\n", strings.TrimRight(prefix, " \t")); err != nil {
+					return nil, 0, fmt.Errorf("writing subject header: %v", err)
+				}
+			}
+			if _, err := bw.WriteString(line); err != nil {
+				return nil, 0, fmt.Errorf("writing message: %v", err)
+			}
+			break
+		}
+		if !haveSubject && len(line) >= len("subject:") && strings.EqualFold(line[:len("subject:")], "subject:") {
+			haveSubject = true
+			// Insert the prefix after the colon and any whitespace.
+			n := len("subject:")
+			for n < len(line) && (line[n] == ' ' || line[n] == '\t') {
+				n++
+			}
+			sep := line[len("subject:"):n]
+			if sep == "" {
+				sep = " "
+			}
+			line = line[:len("subject:")] + sep + prefix + line[n:]
+		}
+		if _, err := bw.WriteString(line); err != nil {
+			return nil, 0, fmt.Errorf("writing message header: %v", err)
+		}
+	}
+	if _, err := io.Copy(bw, br); err != nil {
+		return nil, 0, fmt.Errorf("copying message body: %v", err)
+	}
+	if err := bw.Flush(); err != nil {
+		return nil, 0, fmt.Errorf("writing message: %v", err)
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, 0, fmt.Errorf("stat message: %v", err)
+	}
+	return f, fi.Size(), nil
+}
@@ -431,6 +431,22 @@ func (p *parser) xstring() string {
 	return p.xatom(false)
 }
 
+// xvrfyString parses the parameter of VRFY and EXPN. The RFC only allows a
+// string, but clients typically send an address, with or without angle brackets.
+// If the parameter is an address, it is returned and isAddr is true.
+func (p *parser) xvrfyString() (addr smtp.Path, isAddr bool) {
+	if p.hasPrefix("<") {
+		return p.xpath(), true
+	}
+	o := p.o
+	p.xstring()
+	if !p.hasPrefix("@") {
+		return smtp.Path{}, false
+	}
+	p.o = o
+	return p.xmailbox(), true
+}
+
 // ../rfc/5321:2279
 func (p *parser) xparamKeyword() string {
 	return p.xtakefn1("parameter keyword", func(c rune, i int) bool {
@@ -195,13 +195,16 @@ func reputation(tx *bstore.Tx, log mlog.Log, m *store.Message, smtputf8 bool) (r
 			}
 		}
 
-		// Look if we ever sent to this address. If so, we accept,
-		qr := bstore.QueryTx[store.Recipient](tx)
-		qr.FilterEqual("Localpart", m.MsgFromLocalpart)
-		qr.FilterEqual("Domain", m.MsgFromDomain)
-		qr.FilterGreaterEqual("Sent", now.Add(-3*year))
-		if xrecipientExists(qr) {
-			return xfalse, true, methodMsgtoFull, "exact message-from address was earlier message recipient", nil
+		// Look if we ever sent to this address, i.e. if it is a trusted sender. If so, we
+		// accept.
+		qt := bstore.QueryTx[store.TrustedSender](tx)
+		qt.FilterEqual("Localpart", m.MsgFromLocalpart.String())
+		qt.FilterEqual("Domain", m.MsgFromDomain)
+		qt.FilterGreaterEqual("LastSent", now.Add(-3*year))
+		if exists, err := qt.Exists(); err != nil {
+			panic(queryError(fmt.Sprintf("checking for trusted sender: %v", err)))
+		} else if exists {
+			return xfalse, true, methodMsgtoFull, "exact message-from address is trusted sender, was earlier message recipient", nil
 		}
 
 		// Look for domain match, then for organizational domain match.
@@ -135,6 +135,16 @@ func TestReputation(t *testing.T) {
 				}
 				err = tx.Insert(&r)
 				tcheck(t, err, "insert recipient")
+				qt := bstore.QueryTx[store.TrustedSender](tx)
+				qt.FilterEqual("Localpart", r.Localpart)
+				qt.FilterEqual("Domain", r.Domain)
+				exists, err := qt.Exists()
+				tcheck(t, err, "checking trusted sender")
+				if !exists {
+					ts := store.TrustedSender{Localpart: r.Localpart, Domain: r.Domain, LastSent: r.Sent, Count: 1}
+					err = tx.Insert(&ts)
+					tcheck(t, err, "insert trusted sender")
+				}
 			}
 			err = tx.Update(&inbox)
 			tcheck(t, err, "update mailbox counts")
@@ -46,6 +46,8 @@ import (
 	"github.com/mjl-/mox/dmarcrpt"
 	"github.com/mjl-/mox/dns"
 	"github.com/mjl-/mox/dsn"
+	"github.com/mjl-/mox/eventdb"
+	"github.com/mjl-/mox/greylist"
 	"github.com/mjl-/mox/iprev"
 	"github.com/mjl-/mox/message"
 	"github.com/mjl-/mox/metrics"
@@ -53,12 +55,15 @@ import (
 	"github.com/mjl-/mox/mox-"
 	"github.com/mjl-/mox/moxio"
 	"github.com/mjl-/mox/moxvar"
+	"github.com/mjl-/mox/oauthbearer"
+	"github.com/mjl-/mox/proxyproto"
 	"github.com/mjl-/mox/publicsuffix"
 	"github.com/mjl-/mox/queue"
 	"github.com/mjl-/mox/ratelimit"
 	"github.com/mjl-/mox/scram"
 	"github.com/mjl-/mox/smtp"
 	"github.com/mjl-/mox/spf"
+	"github.com/mjl-/mox/srs"
 	"github.com/mjl-/mox/store"
 	"github.com/mjl-/mox/tlsrpt"
 	"github.com/mjl-/mox/tlsrptdb"
@@ -78,6 +83,17 @@ var limiterConnectionRate, limiterConnections *ratelimit.Limiter
 var limitIPMasked1MessagesPerMinute int = 500
 var limitIPMasked1SizePerMinute int64 = 1000 * 1024 * 1024
 
+// Default limit per hour for probes with null reverse path, per IP. Variable
+// because changed during tests.
+var nullSenderProbesPerHourDefault = 60
+
+// Limiters for probes with null reverse path, per listener name, created on first
+// use. Nil value if disabled for listener.
+var nullSenderLimiters = struct {
+	sync.Mutex
+	m map[string]*ratelimit.Limiter
+}{}
+
 // Maximum number of RCPT TO commands (i.e. recipients) for a single message
 // delivery. Must be at least 100. Announced in LIMIT extension.
 const rcptToLimit = 1000
@@ -106,6 +122,38 @@ func limitersInit() {
 			},
 		},
 	}
+
+	nullSenderLimiters.Lock()
+	nullSenderLimiters.m = map[string]*ratelimit.Limiter{}
+	nullSenderLimiters.Unlock()
+}
+
+// nullSenderLimiter returns the limiter for probes with null reverse path for the
+// listener, or nil if disabled.
+func nullSenderLimiter(listenerName string) *ratelimit.Limiter {
+	nullSenderLimiters.Lock()
+	defer nullSenderLimiters.Unlock()
+
+	if l, ok := nullSenderLimiters.m[listenerName]; ok {
+		return l
+	}
+	n := nullSenderProbesPerHourDefault
+	if listener, ok := mox.Conf.Static.Listeners[listenerName]; ok && listener.SMTP.NullSenderProbesPerHour != 0 {
+		n = listener.SMTP.NullSenderProbesPerHour
+	}
+	var l *ratelimit.Limiter
+	if n > 0 {
+		l = &ratelimit.Limiter{
+			WindowLimits: []ratelimit.WindowLimit{
+				{
+					Window: time.Hour,
+					Limits: [...]int64{int64(n), 3 * int64(n), 9 * int64(n)},
+				},
+			},
+		}
+	}
+	nullSenderLimiters.m[listenerName] = l
+	return l
 }
 
 var (
@@ -147,7 +195,7 @@ var (
 	metricDelivery = promauto.NewCounterVec(
 		prometheus.CounterOpts{
 			Name: "mox_smtpserver_delivery_total",
-			Help: "SMTP incoming message delivery from external source, not submission. Result values: delivered, reject, unknownuser, accounterror, delivererror. Reason indicates why a message was rejected/accepted.",
+			Help: "SMTP incoming message delivery from external source, not submission. Result values: delivered, forwarded, srsbounce, reject, unknownuser, accounterror, delivererror. Reason indicates why a message was rejected/accepted.",
 		},
 		[]string{
 			"result",
@@ -158,7 +206,7 @@ var (
 	metricSubmission = promauto.NewCounterVec(
 		prometheus.CounterOpts{
 			Name: "mox_smtpserver_submission_total",
-			Help: "SMTP server incoming submission results, known values (those ending with error are server errors): ok, badmessage, badfrom, badheader, messagelimiterror, recipientlimiterror, localserveerror, queueerror.",
+			Help: "SMTP server incoming submission results, known values (those ending with error are server errors): ok, badmessage, badfrom, badheader, submissioncheck, messagelimiterror, recipientlimiterror, localserveerror, queueerror.",
 		},
 		[]string{
 			"result",
@@ -173,6 +221,40 @@ var (
 			"error",
 		},
 	)
+	metricNullSender = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "mox_smtpserver_nullsender_total",
+			Help: "SMTP incoming transactions with null reverse path, known values: dsn (message transferred), probe (no message transferred), throttled (recipient rejected due to too many probes).",
+		},
+		[]string{
+			"result",
+		},
+	)
+	metricGreylist = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "mox_smtpserver_greylist_total",
+			Help: "Greylisting checks for recipients of incoming deliveries, known values: whitelisted, retried, greylisted, error.",
+		},
+		[]string{
+			"result",
+		},
+	)
+	metricContentFilter = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "mox_smtpserver_contentfilter_total",
+			Help: "Verdicts of content filters for incoming deliveries, known values: accept, reject, tempfail, quarantine, skipped, error.",
+		},
+		[]string{
+			"name",
+			"result",
+		},
+	)
+	metricSubmissionAccessRefused = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "mox_smtpserver_submission_access_refused_total",
+			Help: "Total number of submission connections refused because the remote IP is not in the networks allowed for the listener.",
+		},
+	)
 	metricDeliveryStarttls = promauto.NewCounter(
 		prometheus.CounterOpts{
 			Name: "mox_smtpserver_delivery_starttls_total",
@@ -279,6 +361,9 @@ func listen1(protocol, name, ip string, port int, hostname dns.Domain, tlsConfig
 	if err != nil {
 		log.Fatalx("smtp: listen for smtp", err, slog.String("protocol", protocol), slog.String("listener", name))
 	}
+	if pp := mox.Conf.Static.Listeners[name].ProxyProtocol; pp != nil {
+		ln = &proxyproto.Listener{Listener: ln, Networks: pp.ParsedNetworks, Timeout: 30 * time.Second}
+	}
 
 	// Each listener gets its own copy of the config, so session keys between different
 	// ports on same listener aren't shared. We rotate session keys explicitly in this
@@ -292,7 +377,9 @@ func listen1(protocol, name, ip string, port int, hostname dns.Domain, tlsConfig
 	serve := func() {
 		for {
 			conn, err := ln.Accept()
-			if err != nil {
+			if err != nil && errors.Is(err, net.ErrClosed) {
+				return
+			} else if err != nil {
 				log.Infox("smtp: accept", err, slog.String("protocol", protocol), slog.String("listener", name))
 				continue
 			}
@@ -335,6 +422,7 @@ type conn struct {
 	lastlog               time.Time // Used for printing the delta time since the previous logging for this connection.
 	submission            bool      // ../rfc/6409:19 applies
 	baseTLSConfig         *tls.Config
+	clientAuthCAs         *x509.CertPool // For verifying client certificates matched by subject. Nil if none.
 	localIP               net.IP
 	remoteIP              net.IP
 	hostname              dns.Domain
@@ -347,6 +435,19 @@ type conn struct {
 	ncmds                 int       // Number of commands processed. Used to abort connection when first incoming command is unknown/invalid.
 	dnsBLs                []dns.Domain
 	firstTimeSenderDelay  time.Duration
+	nullSenderLimiter     *ratelimit.Limiter  // For probes with null reverse path. Nil if disabled.
+	greylisting           *config.Greylisting // For incoming deliveries, if enabled for listener.
+	contentFilters        []config.ContentFilter
+
+	// Fingerprints for incoming deliveries, logged and checked against the rules of
+	// the listener at the first MAIL FROM.
+	fingerprintRules []config.FingerprintRule
+	tlsFingerprint   string   // Of the TLS client hello, empty without TLS.
+	smtpFingerprint  []string // Shapes of the commands until the first MAIL FROM.
+	fingerprinted    bool     // Whether fingerprints have been logged and checked.
+
+	submissionAccess *config.SubmissionAccess // Restrictions of the listener for submission, or nil.
+	vrfyExpn         *config.VRFYEXPN         // Behaviour for VRFY and EXPN, nil for the default of responding with 252.
 
 	// If non-zero, taken into account during Read and Write. Set while processing DATA
 	// command, we don't want the entire delivery to take too long.
@@ -370,10 +471,16 @@ type conn struct {
 	requireTLS           *bool     // MAIL FROM with REQUIRETLS set.
 	futureRelease        time.Time // MAIL FROM with HOLDFOR or HOLDUNTIL.
 	futureReleaseRequest string    // For use in DSNs, either "for;" or "until;" plus original value. ../rfc/4865:305
+	dsnRet               string    // MAIL FROM with RET, either "FULL" or "HDRS". ../rfc/3461
+	dsnEnvID             string    // MAIL FROM with ENVID, decoded.
 	has8bitmime          bool      // If MAIL FROM parameter BODY=8BITMIME was sent. Required for SMTPUTF8.
 	smtputf8             bool      // todo future: we should keep track of this per recipient. perhaps only a specific recipient requires smtputf8, e.g. due to a utf8 localpart.
 	msgsmtputf8          bool      // Is SMTPUTF8 required for the received message. Default to the same value as `smtputf8`, but is re-evaluated after the whole message (envelope and data) is received.
 	recipients           []recipient
+	nullSenderProbe      bool            // Null reverse path with recipient, no DATA yet.
+	bdatFile             *os.File        // Temporary file with the chunks received with BDAT so far, nil if no BDAT yet.
+	bdatWriter           *message.Writer // For writing to bdatFile.
+	bdatSize             int64           // Octets received in BDAT chunks so far.
 }
 
 type rcptAccount struct {
@@ -395,6 +502,42 @@ type recipient struct {
 	// deliveries, this will result in an error.
 	Account *rcptAccount // If set, recipient address is for this local account.
 	Alias   *rcptAlias   // If set, for a local alias.
+	SRS     *smtp.Path   // If set, a bounce for a forwarded message, to be sent to this original sender.
+
+	// DSN parameters from RCPT TO. ../rfc/3461
+	Notify []string // Uppercase, NOTIFY parameter, either "NEVER" or any of "SUCCESS", "FAILURE", "DELAY".
+	ORCPT  string   // ORCPT parameter, decoded, with address type, e.g. "rfc822;user@example.org".
+}
+
+// dsnNotify returns whether the sender requested a DSN of kind ("SUCCESS",
+// "FAILURE" or "DELAY") for this recipient. Without explicit NOTIFY parameter,
+// only failures are reported. ../rfc/3461
+func (r recipient) dsnNotify(kind string) bool {
+	if len(r.Notify) == 0 {
+		return kind == "FAILURE"
+	}
+	return slices.Contains(r.Notify, kind)
+}
+
+// dsnParams are the DSN parameters of a transaction and recipient, to be passed
+// on with messages we queue for the recipient. ../rfc/3461
+type dsnParams struct {
+	Notify []string
+	ORCPT  string
+	Ret    string
+	EnvID  string
+}
+
+func (c *conn) dsnParams(rcpt recipient) dsnParams {
+	return dsnParams{rcpt.Notify, rcpt.ORCPT, c.dsnRet, c.dsnEnvID}
+}
+
+// set sets the DSN parameters on a message to be queued.
+func (p dsnParams) set(qm *queue.Msg) {
+	qm.DSNNotify = p.Notify
+	qm.DSNORCPT = p.ORCPT
+	qm.DSNRet = p.Ret
+	qm.DSNEnvID = p.EnvID
 }
 
 func isClosed(err error) bool {
@@ -424,7 +567,17 @@ func (c *conn) loginAttempt(useTLS bool, authMech string) store.LoginAttempt {
 // possible client certificate authentication in case of submission.
 func (c *conn) makeTLSConfig() *tls.Config {
 	if !c.submission {
-		return c.baseTLSConfig
+		// We clone the config to calculate the fingerprint of the client hello.
+		tlsConf := c.baseTLSConfig.Clone()
+		getConfigForClient := tlsConf.GetConfigForClient
+		tlsConf.GetConfigForClient = func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+			c.tlsFingerprint = tlsFingerprint(hello)
+			if getConfigForClient != nil {
+				return getConfigForClient(hello)
+			}
+			return nil, nil
+		}
+		return tlsConf
 	}
 
 	// We clone the config so we can set VerifyPeerCertificate below to a method bound
@@ -459,21 +612,25 @@ func (c *conn) tlsClientAuthVerifyPeerCert(rawCerts [][]byte, verifiedChains [][
 		return nil
 	}
 
-	cert, err := x509.ParseCertificate(rawCerts[0])
-	if err != nil {
-		c.log.Debugx("parsing tls client certificate", err)
-		return err
+	certs := make([]*x509.Certificate, len(rawCerts))
+	for i, raw := range rawCerts {
+		cert, err := x509.ParseCertificate(raw)
+		if err != nil {
+			c.log.Debugx("parsing tls client certificate", err)
+			return err
+		}
+		certs[i] = cert
 	}
-	if err := c.tlsClientAuthVerifyPeerCertParsed(cert); err != nil {
+	if err := c.tlsClientAuthVerifyPeerCertParsed(certs); err != nil {
 		c.log.Debugx("verifying tls client certificate", err)
 		return fmt.Errorf("verifying client certificate: %w", err)
 	}
 	return nil
 }
 
-// tlsClientAuthVerifyPeerCertParsed verifies a client certificate. Called both for
-// fresh and resumed TLS connections.
-func (c *conn) tlsClientAuthVerifyPeerCertParsed(cert *x509.Certificate) error {
+// tlsClientAuthVerifyPeerCertParsed verifies a client certificate chain, with the
+// leaf certificate first. Called both for fresh and resumed TLS connections.
+func (c *conn) tlsClientAuthVerifyPeerCertParsed(certs []*x509.Certificate) error {
 	if c.account != nil {
 		return fmt.Errorf("cannot authenticate with tls client certificate after previous authentication")
 	}
@@ -519,10 +676,10 @@ func (c *conn) tlsClientAuthVerifyPeerCertParsed(cert *x509.Certificate) error {
 		}
 	}()
 
-	shabuf := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	shabuf := sha256.Sum256(certs[0].RawSubjectPublicKeyInfo)
 	fp := base64.RawURLEncoding.EncodeToString(shabuf[:])
 	la.TLSPubKeyFingerprint = fp
-	pubKey, err := store.TLSPublicKeyGet(context.TODO(), fp)
+	pubKey, err := store.TLSPublicKeyFind(context.TODO(), certs, c.clientAuthCAs)
 	if err != nil {
 		if err == bstore.ErrAbsent {
 			la.Result = store.AuthBadCredentials
@@ -554,6 +711,10 @@ func (c *conn) tlsClientAuthVerifyPeerCertParsed(cert *x509.Certificate) error {
 	if acc.Name != pubKey.Account {
 		return fmt.Errorf("tls client public key %s is for account %s, but email address %s is for account %s", fp, pubKey.Account, pubKey.LoginAddress, acc.Name)
 	}
+	if accConf, ok := acc.Conf(); ok && checkLoginDisabled && !accConf.LoginNetworkAllowed(c.remoteIP) {
+		la.Result = store.AuthNetworkDenied
+		return fmt.Errorf("tls client public key %s for account %s: %w", fp, acc.Name, store.ErrLoginNetwork)
+	}
 
 	c.authFailed = 0
 	c.account = acc
@@ -609,7 +770,7 @@ func (c *conn) xtlsHandshakeAndAuthenticate(conn net.Conn) {
 	cs := tlsConn.ConnectionState()
 	if cs.DidResume && len(cs.PeerCertificates) > 0 {
 		// Verify client after session resumption.
-		err := c.tlsClientAuthVerifyPeerCertParsed(cs.PeerCertificates[0])
+		err := c.tlsClientAuthVerifyPeerCertParsed(cs.PeerCertificates)
 		if err != nil {
 			panic(fmt.Errorf("tls verify client certificate after resumption: %s (%w)", err, errIO))
 		}
@@ -657,14 +818,43 @@ func (c *conn) reset() {
 // for rset command, and a few more cases that reset the mail transaction state.
 // ../rfc/5321:2502
 func (c *conn) rset() {
+	c.nullSenderProbeDone()
 	c.mailFrom = nil
 	c.requireTLS = nil
 	c.futureRelease = time.Time{}
 	c.futureReleaseRequest = ""
+	c.dsnRet = ""
+	c.dsnEnvID = ""
 	c.has8bitmime = false
 	c.smtputf8 = false
 	c.msgsmtputf8 = false
 	c.recipients = nil
+	c.bdatDiscard()
+}
+
+// bdatDiscard removes the temporary file with chunks of a BDAT transaction, if
+// any.
+func (c *conn) bdatDiscard() {
+	if c.bdatFile == nil {
+		return
+	}
+	store.CloseRemoveTempFile(c.log, c.bdatFile, "smtpserver bdat chunks")
+	c.bdatFile = nil
+	c.bdatWriter = nil
+	c.bdatSize = 0
+}
+
+// nullSenderProbeDone accounts for a transaction with a null reverse path that
+// ended without transferring a message, if any.
+func (c *conn) nullSenderProbeDone() {
+	if !c.nullSenderProbe {
+		return
+	}
+	c.nullSenderProbe = false
+	metricNullSender.WithLabelValues("probe").Inc()
+	if c.nullSenderLimiter != nil {
+		c.nullSenderLimiter.Add(c.remoteIP, time.Now(), 1)
+	}
 }
 
 func (c *conn) earliestDeadline(d time.Duration) time.Time {
@@ -680,6 +870,9 @@ func (c *conn) xcheckAuth() {
 		// ../rfc/4954:623
 		xsmtpUserErrorf(smtp.C530SecurityRequired, smtp.SePol7Other0, "authentication required")
 	}
+	if c.submission && c.submissionAccess != nil && c.submissionAccess.RequireClientCertAndPassword && (!c.authTLS || !c.authSASL) {
+		xsmtpUserErrorf(smtp.C530SecurityRequired, smtp.SePol7Other0, "authentication with both tls client certificate and password required")
+	}
 }
 
 func (c *conn) xtrace(level slog.Level) func() {
@@ -811,7 +1004,7 @@ func (c *conn) bwritecodeline(code int, secode string, msg string, err error) {
 			e := 510 - prelen
 			for ; e > 400 && line[e] != ' '; e-- {
 			}
-			// todo future: understand if ecode should be on each line. won't hurt. at least as long as we don't do expn or vrfy.
+			// todo future: understand if ecode should be on each line. won't hurt, also for expn.
 			c.bwritelinef("%d-%s%s%s", code, ecode, sep, line[:e])
 			line = line[e:]
 		}
@@ -855,6 +1048,23 @@ func ServeTLSConn(listenerName string, hostname dns.Domain, conn *tls.Conn, tlsC
 	serve(listenerName, mox.Cid(), hostname, tlsConfig, conn, resolver, submission, true, viaHTTPS, maxMsgSize, true, true, requireTLS, nil, 0)
 }
 
+// ServeConn serves SMTP on a plain connection for a listener, for delivery or
+// for submission, with the DNS lookups done through resolver. TLS is not offered
+// or required, authentication is allowed without TLS. Used by package moxtest.
+func ServeConn(listenerName string, conn net.Conn, resolver dns.Resolver, submission bool) {
+	hostname := mox.Conf.Static.HostnameDomain
+	var maxMsgSize int64 = config.DefaultMaxMsgSize
+	if listener, ok := mox.Conf.Static.Listeners[listenerName]; ok {
+		if listener.Hostname != "" {
+			hostname = listener.HostnameDomain
+		}
+		if listener.SMTPMaxMessageSize != 0 {
+			maxMsgSize = listener.SMTPMaxMessageSize
+		}
+	}
+	serve(listenerName, mox.Cid(), hostname, nil, conn, resolver, submission, false, false, maxMsgSize, false, false, false, nil, 0)
+}
+
 func serve(listenerName string, cid int64, hostname dns.Domain, tlsConfig *tls.Config, nc net.Conn, resolver dns.Resolver, submission, xtls, viaHTTPS bool, maxMessageSize int64, requireTLSForAuth, requireTLSForDelivery, requireTLS bool, dnsBLs []dns.Domain, firstTimeSenderDelay time.Duration) {
 	var localIP, remoteIP net.IP
 	if a, ok := nc.LocalAddr().(*net.TCPAddr); ok {
@@ -894,6 +1104,20 @@ func serve(listenerName string, cid int64, hostname dns.Domain, tlsConfig *tls.C
 		requireTLSForDelivery: requireTLSForDelivery,
 		dnsBLs:                dnsBLs,
 		firstTimeSenderDelay:  firstTimeSenderDelay,
+		nullSenderLimiter:     nullSenderLimiter(listenerName),
+	}
+	if listener, ok := mox.Conf.Static.Listeners[listenerName]; ok {
+		c.vrfyExpn = listener.VRFYEXPN
+		if listener.TLS != nil {
+			c.clientAuthCAs = listener.TLS.ClientAuthCAs
+		}
+		if !submission {
+			c.fingerprintRules = listener.SMTP.FingerprintRules
+			c.greylisting = listener.SMTP.Greylisting
+			c.contentFilters = listener.SMTP.ContentFilters
+		} else {
+			c.submissionAccess = listener.SubmissionAccess
+		}
 	}
 	var logmutex sync.Mutex
 	c.log = mlog.New("smtpserver", nil).WithFunc(func() []slog.Attr {
@@ -934,6 +1158,9 @@ func serve(listenerName string, cid int64, hostname dns.Domain, tlsConfig *tls.C
 			c.account = nil
 		}
 
+		c.nullSenderProbeDone()
+		c.bdatDiscard()
+
 		x := recover()
 		if x == nil || x == cleanClose {
 			c.log.Info("connection closed")
@@ -946,6 +1173,17 @@ func serve(listenerName string, cid int64, hostname dns.Domain, tlsConfig *tls.C
 		}
 	}()
 
+	// Submission can be limited to networks, e.g. a VPN. We don't start TLS for
+	// connections from other networks.
+	if sa := c.submissionAccess; sa != nil && len(sa.ParsedNetworks) > 0 && !slices.ContainsFunc(sa.ParsedNetworks, func(n net.IPNet) bool { return n.Contains(c.remoteIP) }) {
+		metricSubmissionAccessRefused.Inc()
+		c.log.Info("refusing submission connection from ip outside allowed networks", slog.Any("remoteip", c.remoteIP))
+		if !xtls {
+			c.writecodeline(smtp.C421ServiceUnavail, smtp.SePol7Other0, "submission not allowed from your network", nil)
+		}
+		return
+	}
+
 	if xtls && !viaHTTPS {
 		// Start TLS on connection. We perform the handshake explicitly, so we can set a
 		// timeout, do client certificate authentication, log TLS details afterwards.
@@ -1016,6 +1254,7 @@ var commands = map[string]func(c *conn, p *parser){
 	"mail":     (*conn).cmdMail,
 	"rcpt":     (*conn).cmdRcpt,
 	"data":     (*conn).cmdData,
+	"bdat":     (*conn).cmdBdat,
 	"rset":     (*conn).cmdRset,
 	"vrfy":     (*conn).cmdVrfy,
 	"expn":     (*conn).cmdExpn,
@@ -1074,6 +1313,16 @@ func command(c *conn) {
 	default:
 	}
 
+	// Submission sessions authenticated before the account was suspended end at their
+	// next command.
+	if c.account != nil {
+		if accConf, ok := c.account.Conf(); ok && accConf.Suspended != "" {
+			c.log.Info("account suspended, closing connection", slog.String("account", c.account.Name))
+			c.writecodeline(smtp.C421ServiceUnavail, smtp.SePol7AccountDisabled13, "account suspended: "+accConf.Suspended, nil)
+			panic(errIO)
+		}
+	}
+
 	c.cmd = cmdl
 	c.cmdStart = time.Now()
 
@@ -1092,6 +1341,9 @@ func command(c *conn) {
 		xsmtpUserErrorf(smtp.C500BadSyntax, smtp.SeProto5BadCmdOrSeq1, "unknown command")
 	}
 	c.ncmds++
+	if !c.submission && !c.fingerprinted && len(c.smtpFingerprint) < smtpFingerprintMax {
+		c.smtpFingerprint = append(c.smtpFingerprint, commandShape(cmd, cmdl, args, c.r.Buffered() > 0))
+	}
 	fn(c, p)
 }
 
@@ -1198,6 +1450,10 @@ func (c *conn) cmdHello(p *parser, ehlo bool) {
 			// present, and also not indicate the server supports the PLUS variant in that
 			// case, or it would trigger the mechanism downgrade detection.
 			mechs = "SCRAM-SHA-256-PLUS SCRAM-SHA-256 SCRAM-SHA-1-PLUS SCRAM-SHA-1 CRAM-MD5 PLAIN LOGIN"
+			if mox.Conf.Static.OAuth != nil {
+				// ../rfc/7628
+				mechs += " OAUTHBEARER XOAUTH2"
+			}
 		}
 		if c.tls && len(c.conn.(*tls.Conn).ConnectionState().PeerCertificates) > 0 && !c.viaHTTPS {
 			mechs = "EXTERNAL " + mechs
@@ -1207,9 +1463,10 @@ func (c *conn) cmdHello(p *parser, ehlo bool) {
 		t := time.Now().Add(queue.FutureReleaseIntervalMax).UTC() // ../rfc/4865:98
 		c.bwritelinef("250-FUTURERELEASE %d %s", queue.FutureReleaseIntervalMax/time.Second, t.Format(time.RFC3339))
 	}
-	c.bwritelinef("250-ENHANCEDSTATUSCODES") // ../rfc/2034:71
-	// todo future? c.writelinef("250-DSN")
+	c.bwritelinef("250-ENHANCEDSTATUSCODES")            // ../rfc/2034:71
+	c.bwritelinef("250-DSN")                            // ../rfc/3461
 	c.bwritelinef("250-8BITMIME")                       // ../rfc/6152:86
+	c.bwritelinef("250-CHUNKING")                       // ../rfc/3030
 	c.bwritelinef("250-LIMITS RCPTMAX=%d", rcptToLimit) // ../rfc/9422:301
 	c.bwritecodeline(250, "", "SMTPUTF8", nil)          // ../rfc/6531:201
 	c.xflush()
@@ -1252,6 +1509,25 @@ func (c *conn) cmdStarttls(p *parser) {
 	c.tls = true
 }
 
+// xcheckAuthLockout fails authentication if there were too many failed attempts
+// from the remote IP, or for the account if accountName is non-empty.
+func (c *conn) xcheckAuthLockout(la *store.LoginAttempt, accountName string) {
+	err := store.AuthLockoutCheck(context.TODO(), c.remoteIP, accountName)
+	if errors.Is(err, store.ErrAuthLockedOut) {
+		c.xauthLockedOut(la, err)
+	}
+	xcheckf(err, "checking authentication lockout")
+}
+
+// xauthLockedOut fails an authentication attempt refused due to a lockout, with a
+// temporary error so clients don't prompt for a different password.
+func (c *conn) xauthLockedOut(la *store.LoginAttempt, err error) {
+	la.Result = store.AuthLockedOut
+	c.log.Info("authentication refused due to lockout", slog.String("account", la.AccountName), slog.Any("remote", c.remoteIP))
+	// ../rfc/4954:586
+	xsmtpUserErrorf(smtp.C454TempAuthFail, smtp.SePol7Other0, "%s", err)
+}
+
 // ../rfc/4954:139
 func (c *conn) cmdAuth(p *parser) {
 	c.xneedHello()
@@ -1302,10 +1578,20 @@ func (c *conn) cmdAuth(p *parser) {
 		}
 	}()
 
+	c.xcheckAuthLockout(&la, "")
+
 	// ../rfc/4954:699
 	p.xspace()
 	mech := p.xsaslMech()
 
+	if c.submissionAccess != nil && c.submissionAccess.RequireClientCertAndPassword {
+		if !c.authTLS {
+			xsmtpUserErrorf(smtp.C530SecurityRequired, smtp.SePol7Other0, "tls client certificate required before authentication")
+		} else if mech == "EXTERNAL" {
+			xsmtpUserErrorf(smtp.C504ParamNotImpl, smtp.SeProto5BadParams4, "mechanism EXTERNAL not allowed, password-based authentication required in addition to tls client certificate")
+		}
+	}
+
 	// Read the first parameter, either as initial parameter or by sending a
 	// continuation with the optional encChal (must already be base64-encoded).
 	xreadInitial := func(encChal string) []byte {
@@ -1405,6 +1691,8 @@ func (c *conn) cmdAuth(p *parser) {
 			la.Result = store.AuthBadCredentials
 			c.log.Info("failed authentication attempt", slog.String("username", username), slog.Any("remote", c.remoteIP))
 			xsmtpUserErrorf(smtp.C535AuthBadCreds, smtp.SePol7AuthBadCreds8, "bad user/pass")
+		} else if err != nil && errors.Is(err, store.ErrAuthLockedOut) {
+			c.xauthLockedOut(&la, err)
 		}
 		xcheckf(err, "verifying credentials")
 
@@ -1448,6 +1736,8 @@ func (c *conn) cmdAuth(p *parser) {
 			la.Result = store.AuthBadCredentials
 			c.log.Info("failed authentication attempt", slog.String("username", username), slog.Any("remote", c.remoteIP))
 			xsmtpUserErrorf(smtp.C535AuthBadCreds, smtp.SePol7AuthBadCreds8, "bad user/pass")
+		} else if err != nil && errors.Is(err, store.ErrAuthLockedOut) {
+			c.xauthLockedOut(&la, err)
 		}
 		xcheckf(err, "verifying credentials")
 
@@ -1477,6 +1767,7 @@ func (c *conn) cmdAuth(p *parser) {
 		}
 		xcheckf(err, "looking up address")
 		la.AccountName = account.Name
+		c.xcheckAuthLockout(&la, account.Name)
 		var ipadhash, opadhash hash.Hash
 		account.WithRLock(func() {
 			err := account.DB.Read(context.TODO(), func(tx *bstore.Tx) error {
@@ -1555,6 +1846,7 @@ func (c *conn) cmdAuth(p *parser) {
 			c.log.Info("failed authentication attempt", slog.String("username", username), slog.Any("remote", c.remoteIP))
 			xsmtpUserErrorf(smtp.C454TempAuthFail, smtp.SeSys3Other0, "scram not possible")
 		}
+		c.xcheckAuthLockout(&la, account.Name)
 		if ss.Authorization != "" && ss.Authorization != username {
 			xsmtpUserErrorf(smtp.C535AuthBadCreds, smtp.SePol7AuthBadCreds8, "authentication with authorization for different user not supported")
 		}
@@ -1615,6 +1907,55 @@ func (c *conn) cmdAuth(p *parser) {
 		// The message should be empty. todo: should we require it is empty?
 		xreadContinuation()
 
+	case "OAUTHBEARER", "XOAUTH2":
+		la.AuthMech = strings.ToLower(mech)
+		xoauth2 := mech == "XOAUTH2"
+
+		oc := mox.Conf.Static.OAuth
+		if oc == nil {
+			// ../rfc/4954:176
+			xsmtpUserErrorf(smtp.C504ParamNotImpl, smtp.SeProto5BadParams4, "mechanism %s not supported", mech)
+		}
+		// ../rfc/7628
+		if !c.tls && c.requireTLSForAuth {
+			xsmtpUserErrorf(smtp.C538EncReqForAuth, smtp.SePol7EncReqForAuth11, "authentication requires tls")
+		}
+
+		// Bearer token is a credential, so hide it.
+		defer c.xtrace(mlog.LevelTraceauth)()
+		buf := xreadInitial("")
+		c.xtrace(mlog.LevelTrace) // Restore.
+		var token string
+		var err error
+		if xoauth2 {
+			username, token, err = oauthbearer.ParseXOAuth2(buf)
+		} else {
+			username, token, err = oauthbearer.ParseOAuthBearer(buf)
+		}
+		if err != nil {
+			la.Result = store.AuthBadProtocol
+			xsmtpUserErrorf(smtp.C501BadParamSyntax, smtp.SeProto5BadParams4, "%s", err)
+		}
+		username = norm.NFC.String(username)
+		la.LoginAddress = username
+
+		var address string
+		account, la.AccountName, address, err = store.OpenEmailOAuth(context.TODO(), c.log, username, token)
+		if err != nil && errors.Is(err, store.ErrUnknownCredentials) {
+			la.Result = store.AuthBadCredentials
+			c.log.Infox("failed authentication attempt", err, slog.String("username", username), slog.Any("remote", c.remoteIP))
+			// Client must respond to the error challenge, after which we fail the
+			// authentication. ../rfc/7628
+			c.writelinef("%d %s", smtp.C334ContinueAuth, base64.StdEncoding.EncodeToString(oc.Verifier.ErrorChallenge(xoauth2, err)))
+			xreadContinuation()
+			xsmtpUserErrorf(smtp.C535AuthBadCreds, smtp.SePol7AuthBadCreds8, "bad credentials")
+		} else if err != nil && errors.Is(err, store.ErrAuthLockedOut) {
+			c.xauthLockedOut(&la, err)
+		}
+		xcheckf(err, "verifying token")
+		username = address
+		la.LoginAddress = username
+
 	case "EXTERNAL":
 		la.AuthMech = "external"
 
@@ -1647,10 +1988,14 @@ func (c *conn) cmdAuth(p *parser) {
 
 	if accConf, ok := account.Conf(); !ok {
 		xcheckf(errors.New("cannot find account"), "get account config")
-	} else if accConf.LoginDisabled != "" {
+	} else if msg := accConf.LoginDisabledMessage(); msg != "" {
 		la.Result = store.AuthLoginDisabled
 		c.log.Info("account login disabled", slog.String("username", username))
-		xsmtpUserErrorf(smtp.C525AccountDisabled, smtp.SePol7AccountDisabled13, "%w: %s", store.ErrLoginDisabled, accConf.LoginDisabled)
+		xsmtpUserErrorf(smtp.C525AccountDisabled, smtp.SePol7AccountDisabled13, "%w: %s", store.ErrLoginDisabled, msg)
+	} else if !accConf.LoginNetworkAllowed(c.remoteIP) {
+		la.Result = store.AuthNetworkDenied
+		c.log.Info("account login from network not allowed", slog.String("account", account.Name), slog.Any("remote", c.remoteIP))
+		xsmtpUserErrorf(smtp.C525AccountDisabled, smtp.SePol7AccountDisabled13, "%s", store.ErrLoginNetwork)
 	}
 
 	// We may already have TLS credentials. We allow an additional SASL authentication,
@@ -1705,6 +2050,9 @@ func (c *conn) cmdMail(p *parser) {
 
 	c.xneedHello()
 	c.xcheckAuth()
+	if !c.submission {
+		c.xfingerprintCheck()
+	}
 	if c.mailFrom != nil {
 		// ../rfc/5321:2507, though ../rfc/5321:1029 contradicts, implying a MAIL would also reset, but ../rfc/5321:1160 decides.
 		xsmtpUserErrorf(smtp.C503BadCmdSeq, smtp.SeProto5BadCmdOrSeq1, "already have MAIL")
@@ -1761,6 +2109,10 @@ func (c *conn) cmdMail(p *parser) {
 				c.has8bitmime = false
 			case "8BITMIME":
 				c.has8bitmime = true
+			case "BINARYMIME":
+				// We don't announce BINARYMIME. We would have to convert binary messages
+				// to 7bit/8bit for delivery to servers without BINARYMIME. ../rfc/3030
+				xsmtpUserErrorf(smtp.C555UnrecognizedAddrParams, smtp.SeSys3NotSupported3, "BINARYMIME not supported")
 			default:
 				xsmtpUserErrorf(smtp.C555UnrecognizedAddrParams, smtp.SeProto5BadParams4, "unrecognized parameter %q", key)
 			}
@@ -1777,6 +2129,27 @@ func (c *conn) cmdMail(p *parser) {
 			p.xtake("<")
 			p.xtext()
 			p.xtake(">")
+		case "RET":
+			// ../rfc/3461
+			p.xtake("=")
+			v := strings.ToUpper(p.xparamValue())
+			if v != "FULL" && v != "HDRS" {
+				xsmtpUserErrorf(smtp.C501BadParamSyntax, smtp.SeProto5BadParams4, "RET must be FULL or HDRS")
+			}
+			c.dsnRet = v
+		case "ENVID":
+			// ../rfc/3461
+			p.xtake("=")
+			v := p.xtext()
+			if v == "" || len(v) > 100 {
+				xsmtpUserErrorf(smtp.C501BadParamSyntax, smtp.SeProto5BadParams4, "ENVID must be 1 to 100 characters")
+			}
+			for _, ch := range v {
+				if ch < 0x20 || ch >= 0x7f {
+					xsmtpUserErrorf(smtp.C501BadParamSyntax, smtp.SeProto5BadParams4, "ENVID must be printable ascii")
+				}
+			}
+			c.dsnEnvID = v
 		case "SMTPUTF8":
 			// ../rfc/6531:213
 			c.smtputf8 = true
@@ -1902,6 +2275,10 @@ func (c *conn) cmdRcpt(p *parser) {
 		// ../rfc/5321:1088
 		xsmtpUserErrorf(smtp.C503BadCmdSeq, smtp.SeProto5BadCmdOrSeq1, "missing MAIL FROM")
 	}
+	if c.bdatFile != nil {
+		// ../rfc/3030
+		xsmtpUserErrorf(smtp.C503BadCmdSeq, smtp.SeProto5BadCmdOrSeq1, "no RCPT TO after BDAT")
+	}
 
 	// ../rfc/5321:1985
 	p.xtake(" TO:")
@@ -1917,13 +2294,48 @@ func (c *conn) cmdRcpt(p *parser) {
 	} else {
 		fpath = p.xforwardPath()
 	}
+	var notify []string
+	var orcpt string
+	paramSeen := map[string]bool{}
 	for p.space() {
 		// ../rfc/5321:2275
 		key := p.xparamKeyword()
-		// K := strings.ToUpper(key)
-		// todo future: DSN, ../rfc/3461, with "NOTIFY"
-		// ../rfc/5321:2230
-		xsmtpUserErrorf(smtp.C555UnrecognizedAddrParams, smtp.SeSys3NotSupported3, "unrecognized parameter %q", key)
+		K := strings.ToUpper(key)
+		if paramSeen[K] {
+			xsmtpUserErrorf(smtp.C501BadParamSyntax, smtp.SeProto5BadParams4, "duplicate param %q", key)
+		}
+		paramSeen[K] = true
+		switch K {
+		case "NOTIFY":
+			// ../rfc/3461
+			p.xtake("=")
+			for _, v := range strings.Split(strings.ToUpper(p.xparamValue()), ",") {
+				switch v {
+				case "SUCCESS", "FAILURE", "DELAY", "NEVER":
+				default:
+					xsmtpUserErrorf(smtp.C501BadParamSyntax, smtp.SeProto5BadParams4, "unknown NOTIFY value %q", v)
+				}
+				if slices.Contains(notify, v) {
+					xsmtpUserErrorf(smtp.C501BadParamSyntax, smtp.SeProto5BadParams4, "duplicate NOTIFY value %q", v)
+				}
+				notify = append(notify, v)
+			}
+			if slices.Contains(notify, "NEVER") && len(notify) > 1 {
+				xsmtpUserErrorf(smtp.C501BadParamSyntax, smtp.SeProto5BadParams4, "NOTIFY NEVER cannot be combined with other values")
+			}
+		case "ORCPT":
+			// ../rfc/3461
+			p.xtake("=")
+			v := p.xtext()
+			t, addr, ok := strings.Cut(v, ";")
+			if !ok || t == "" || addr == "" || len(v) > 500 {
+				xsmtpUserErrorf(smtp.C501BadParamSyntax, smtp.SeProto5BadParams4, "ORCPT must be of the form addr-type;address")
+			}
+			orcpt = v
+		default:
+			// ../rfc/5321:2230
+			xsmtpUserErrorf(smtp.C555UnrecognizedAddrParams, smtp.SeSys3NotSupported3, "unrecognized parameter %q", key)
+		}
 	}
 	p.xend()
 
@@ -1947,6 +2359,19 @@ func (c *conn) cmdRcpt(p *parser) {
 		xsmtpUserErrorf(smtp.C452StorageFull, smtp.SeProto5TooManyRcpts3, "only one recipient allowed with null reverse address")
 	}
 
+	// Transactions with null reverse path that don't transfer a message are likely
+	// probes, e.g. callout verification or spammers checking addresses. We limit how
+	// many we accept per IP/network. Legitimate DSNs are counted as probes only if the
+	// transaction does not get to DATA.
+	if !c.submission && c.mailFrom.IsZero() {
+		if c.nullSenderLimiter != nil && !c.nullSenderLimiter.CanAdd(c.remoteIP, time.Now(), 1) {
+			metricNullSender.WithLabelValues("throttled").Inc()
+			c.log.Debug("refusing recipient due to many probes with null reverse path", slog.Any("remoteip", c.remoteIP))
+			xsmtpUserErrorf(smtp.C451LocalErr, smtp.SePol7Other0, "too many transactions with null reverse path without message from your ip or network, slow down please")
+		}
+		c.nullSenderProbe = true
+	}
+
 	// Do not accept multiple recipients if remote does not pass SPF. Because we don't
 	// want to generate DSNs to unverified domains. This is the moment we
 	// can refuse individual recipients, DATA will be too late. Because mail
@@ -1993,15 +2418,31 @@ func (c *conn) cmdRcpt(p *parser) {
 		if !c.submission {
 			xsmtpUserErrorf(smtp.C550MailboxUnavail, smtp.SeAddr1UnknownDestMailbox1, "not accepting email for ip")
 		}
-		c.recipients = append(c.recipients, recipient{fpath, nil, nil})
+		c.recipients = append(c.recipients, recipient{fpath, nil, nil, nil, notify, orcpt})
+	} else if _, ok := mox.Conf.Domain(fpath.IPDomain.Domain); ok && !c.submission && c.mailFrom.IsZero() && srs.IsSRS(fpath.Localpart) {
+		// Bounce for a message we forwarded with a rewritten MAIL FROM, to be sent back to
+		// the original sender.
+		origFrom, err := mox.SRSReverse(fpath.Localpart)
+		if err != nil {
+			c.log.Infox("invalid srs address for bounce", err, slog.Any("rcptto", fpath))
+			xsmtpUserErrorf(smtp.C550MailboxUnavail, smtp.SeAddr1UnknownDestMailbox1, "invalid or expired srs address")
+		}
+		c.recipients = append(c.recipients, recipient{fpath, nil, nil, &origFrom, notify, orcpt})
 	} else if accountName, alias, canonical, dest, err := mox.LookupAddress(fpath.Localpart, fpath.IPDomain.Domain, true, true, true); err == nil {
 		// note: a bare postmaster, without domain, is handled by LookupAddress. ../rfc/5321:735
 		if alias != nil {
-			c.recipients = append(c.recipients, recipient{fpath, nil, &rcptAlias{*alias, canonical}})
+			c.recipients = append(c.recipients, recipient{fpath, nil, &rcptAlias{*alias, canonical}, nil, notify, orcpt})
 		} else if dest.SMTPError != "" {
 			xsmtpServerErrorf(codes{dest.SMTPErrorCode, dest.SMTPErrorSecode}, "%s", dest.SMTPErrorMsg)
+		} else if accConf, ok := mox.Conf.Account(accountName); ok && accConf.Suspended != "" {
+			// We don't reveal the suspension message, it is meant for the account user.
+			c.log.Info("smtp recipient for suspended account", slog.String("account", accountName))
+			if accConf.SuspendedReject {
+				xsmtpUserErrorf(smtp.C550MailboxUnavail, smtp.SeMailbox2Disabled1, "recipient mailbox disabled")
+			}
+			xsmtpUserErrorf(smtp.C450MailboxUnavail, smtp.SeMailbox2Disabled1, "recipient mailbox temporarily disabled")
 		} else {
-			c.recipients = append(c.recipients, recipient{fpath, &rcptAccount{accountName, dest, canonical}, nil})
+			c.recipients = append(c.recipients, recipient{fpath, &rcptAccount{accountName, dest, canonical}, nil, nil, notify, orcpt})
 		}
 
 	} else if Localserve {
@@ -2011,7 +2452,7 @@ func (c *conn) cmdRcpt(p *parser) {
 		// which is typically the mox user.
 		acc, _ := mox.Conf.Account("mox")
 		dest := acc.Destinations["mox@localhost"]
-		c.recipients = append(c.recipients, recipient{fpath, &rcptAccount{"mox", dest, "mox@localhost"}, nil})
+		c.recipients = append(c.recipients, recipient{fpath, &rcptAccount{"mox", dest, "mox@localhost"}, nil, nil, notify, orcpt})
 	} else if errors.Is(err, mox.ErrDomainDisabled) {
 		c.log.Info("smtp recipient for temporarily disabled domain", slog.Any("domain", fpath.IPDomain.Domain))
 		xsmtpUserErrorf(smtp.C450MailboxUnavail, smtp.SeMailbox2Disabled1, "recipient domain temporarily disabled")
@@ -2020,7 +2461,7 @@ func (c *conn) cmdRcpt(p *parser) {
 			xsmtpUserErrorf(smtp.C550MailboxUnavail, smtp.SeAddr1UnknownDestMailbox1, "not accepting email for domain")
 		}
 		// We'll be delivering this email.
-		c.recipients = append(c.recipients, recipient{fpath, nil, nil})
+		c.recipients = append(c.recipients, recipient{fpath, nil, nil, nil, notify, orcpt})
 	} else if errors.Is(err, mox.ErrAddressNotFound) {
 		if c.submission {
 			// For submission, we're transparent about which user exists. Should be fine for the typical small-scale deploy.
@@ -2030,14 +2471,43 @@ func (c *conn) cmdRcpt(p *parser) {
 		// We pretend to accept. We don't want to let remote know the user does not exist
 		// until after DATA. Because then remote has committed to sending a message.
 		// note: not local for !c.submission is the signal this address is in error.
-		c.recipients = append(c.recipients, recipient{fpath, nil, nil})
+		c.recipients = append(c.recipients, recipient{fpath, nil, nil, nil, notify, orcpt})
 	} else {
 		c.log.Errorx("looking up account for delivery", err, slog.Any("rcptto", fpath))
 		xsmtpServerErrorf(codes{smtp.C451LocalErr, smtp.SeSys3Other0}, "error processing")
 	}
+	// Unknown addresses are greylisted too, not revealing which addresses exist.
+	if !c.submission && c.greylisting != nil && !Localserve {
+		c.xgreylist()
+	}
 	c.bwritecodeline(smtp.C250Completed, smtp.SeAddr1Other0, "now on the list", nil)
 }
 
+// xgreylist checks the last recipient against the greylist, removing it and
+// responding with a temporary error if the remote network isn't whitelisted and
+// this isn't a proper retry. If checking fails, the recipient is accepted.
+func (c *conn) xgreylist() {
+	rcpt := c.recipients[len(c.recipients)-1]
+	var mailFrom string
+	if !c.mailFrom.IsZero() {
+		mailFrom = c.mailFrom.XString(true)
+	}
+	ctx, cancel := context.WithTimeout(mox.Context, 5*time.Second)
+	defer cancel()
+	result, err := greylist.Check(ctx, c.log, *c.greylisting, c.remoteIP, mailFrom, rcpt.Addr.XString(true), time.Now())
+	if err != nil {
+		metricGreylist.WithLabelValues("error").Inc()
+		c.log.Errorx("greylist check, accepting recipient", err, slog.Any("rcptto", rcpt.Addr))
+		return
+	}
+	metricGreylist.WithLabelValues(string(result)).Inc()
+	if result == greylist.Greylisted {
+		c.recipients = c.recipients[:len(c.recipients)-1]
+		c.log.Info("recipient greylisted", slog.Any("rcptto", rcpt.Addr), slog.Any("remoteip", c.remoteIP))
+		xsmtpUserErrorf(smtp.C451LocalErr, smtp.SePol7DeliveryUnauth1, "greylisted, try again later")
+	}
+}
+
 func hasNonASCII(s string) bool {
 	for _, c := range []byte(s) {
 		if c > unicode.MaxASCII {
@@ -2078,21 +2548,23 @@ func (c *conn) cmdData(p *parser) {
 		// ../rfc/5321:1130
 		xsmtpUserErrorf(smtp.C503BadCmdSeq, smtp.SeProto5BadCmdOrSeq1, "missing RCPT TO")
 	}
+	if c.bdatFile != nil {
+		// ../rfc/3030
+		xsmtpUserErrorf(smtp.C503BadCmdSeq, smtp.SeProto5BadCmdOrSeq1, "cannot mix DATA with BDAT")
+	}
 
 	// ../rfc/5321:2066
 	p.xend()
 
+	if c.nullSenderProbe {
+		c.nullSenderProbe = false
+		metricNullSender.WithLabelValues("dsn").Inc()
+	}
+
 	// todo future: we could start a reader for a single line. we would then create a context that would be canceled on i/o errors.
 
-	// Entire delivery should be done within 30 minutes, or we abort.
-	cidctx := context.WithValue(mox.Context, mlog.CidKey, c.cid)
-	cmdctx, cmdcancel := context.WithTimeout(cidctx, 30*time.Minute)
+	cmdctx, cmdcancel := c.messageContext()
 	defer cmdcancel()
-	// Deadline is taken into account by Read and Write.
-	c.deadline, _ = cmdctx.Deadline()
-	defer func() {
-		c.deadline = time.Time{}
-	}()
 
 	// ../rfc/5321:1994
 	c.writelinef("354 see you at the bare dot")
@@ -2137,6 +2609,127 @@ func (c *conn) cmdData(p *parser) {
 		return
 	}
 
+	c.processMessage(cmdctx, msgWriter, dataFile)
+}
+
+// messageContext returns a context for processing a message after DATA or the
+// last BDAT chunk. Entire delivery should be done within 30 minutes, or we abort.
+// The deadline is also set on the connection, and cleared by calling the returned
+// cancel function.
+func (c *conn) messageContext() (context.Context, context.CancelFunc) {
+	cidctx := context.WithValue(mox.Context, mlog.CidKey, c.cid)
+	cmdctx, cmdcancel := context.WithTimeout(cidctx, 30*time.Minute)
+	// Deadline is taken into account by Read and Write.
+	c.deadline, _ = cmdctx.Deadline()
+	return cmdctx, func() {
+		cmdcancel()
+		c.deadline = time.Time{}
+	}
+}
+
+// ../rfc/3030
+func (c *conn) cmdBdat(p *parser) {
+	// The chunk follows the command line, also when we are going to return an error.
+	// If we can't parse its size, we can't find the next command, so we stop.
+	var size int64
+	var last bool
+	func() {
+		defer func() {
+			x := recover()
+			if x == nil {
+				return
+			}
+			if serr, ok := x.(smtpError); ok {
+				c.writecodeline(serr.code, serr.secode, fmt.Sprintf("%s, closing connection (%s)", serr.errmsg, mox.ReceivedID(c.cid)), serr.err)
+				panic(fmt.Errorf("bad bdat command: %w", errIO))
+			}
+			panic(x)
+		}()
+		p.xspace()
+		size = p.xnumber(20, true)
+		last = p.space() && p.take("LAST")
+		p.xend()
+	}()
+
+	if c.bdatSize+size > c.maxMessageSize {
+		// ../rfc/1870:136 and ../rfc/3463:382
+		ecode := smtp.SeSys3MsgLimitExceeded4
+		if c.bdatSize+size < config.DefaultMaxMsgSize {
+			ecode = smtp.SeMailbox2MsgLimitExceeded3
+		}
+		c.writecodeline(smtp.C552MailboxFull, ecode, fmt.Sprintf("message too large (%s)", mox.ReceivedID(c.cid)), nil)
+		panic(fmt.Errorf("remote sent too much BDAT: %w", errIO))
+	}
+
+	// Read the chunk into the temporary file, discarding the chunk and aborting the
+	// transaction on errors. ../rfc/3030
+	func() {
+		chunk := io.LimitReader(c.r, size)
+		defer func() {
+			x := recover()
+			if x == nil {
+				return
+			}
+			if err, ok := x.(error); ok && !isClosed(err) {
+				io.Copy(io.Discard, chunk)
+				c.rset()
+			}
+			panic(x)
+		}()
+
+		c.xneedHello()
+		c.xcheckAuth()
+		if c.mailFrom == nil {
+			xsmtpUserErrorf(smtp.C503BadCmdSeq, smtp.SeProto5BadCmdOrSeq1, "missing MAIL FROM")
+		}
+		if len(c.recipients) == 0 {
+			xsmtpUserErrorf(smtp.C503BadCmdSeq, smtp.SeProto5BadCmdOrSeq1, "missing RCPT TO")
+		}
+
+		if c.bdatFile == nil {
+			f, err := store.CreateMessageTemp(c.log, "smtp-deliver")
+			if err != nil {
+				xsmtpServerErrorf(errCodes(smtp.C451LocalErr, smtp.SeSys3Other0, err), "creating temporary file for message: %s", err)
+			}
+			c.bdatFile = f
+			c.bdatWriter = message.NewWriter(f)
+		}
+
+		// Mark as tracedata.
+		defer c.xtrace(mlog.LevelTracedata)()
+		n, err := io.Copy(c.bdatWriter, chunk)
+		c.bdatSize += n
+		if err != nil {
+			xsmtpServerErrorf(codes{smtp.C451LocalErr, smtp.SeSys3Other0}, "error copying chunk to file: %s", err)
+		}
+	}()
+
+	if !last {
+		c.writecodeline(smtp.C250Completed, smtp.SeOther00, fmt.Sprintf("%d octets received", size), nil)
+		return
+	}
+
+	if c.nullSenderProbe {
+		c.nullSenderProbe = false
+		metricNullSender.WithLabelValues("dsn").Inc()
+	}
+
+	cmdctx, cmdcancel := c.messageContext()
+	defer cmdcancel()
+
+	// The transaction state is reset after processing, but the message file is ours.
+	msgWriter, dataFile := c.bdatWriter, c.bdatFile
+	c.bdatFile = nil
+	c.bdatWriter = nil
+	c.bdatSize = 0
+	defer store.CloseRemoveTempFile(c.log, dataFile, "smtpserver delivered message")
+
+	c.processMessage(cmdctx, msgWriter, dataFile)
+}
+
+// processMessage checks and processes a message received with DATA or BDAT, for
+// submission or delivery.
+func (c *conn) processMessage(cmdctx context.Context, msgWriter *message.Writer, dataFile *os.File) {
 	// Basic sanity checks on messages before we send them out to the world. Just
 	// trying to be strict in what we do to others and liberal in what we accept.
 	if c.submission {
@@ -2211,6 +2804,7 @@ func (c *conn) cmdData(p *parser) {
 		iprevctx, iprevcancel := context.WithTimeout(cmdctx, time.Minute)
 		var revName string
 		var revNames []string
+		var err error
 		iprevStatus, revName, revNames, iprevAuthentic, err = iprev.Lookup(iprevctx, c.resolver, c.remoteIP)
 		iprevcancel()
 		if err != nil {
@@ -2365,7 +2959,18 @@ func (c *conn) submit(ctx context.Context, recvHdrFor func(string) string, msgWr
 		msgPrefix = append(msgPrefix, "Date: "+time.Now().Format(message.RFC5322Z)+"\r\n"...)
 	}
 
-	// Check outgoing message rate limit.
+	accConf, _ := c.account.Conf()
+
+	// Sanity checks configured for the account.
+	hasTo := header.Get("To") != "" || header.Get("Cc") != ""
+	if err := mox.SubmissionCheck(accConf.SubmissionChecks, hasTo, header.Get("Subject"), len(c.recipients)); err != nil {
+		metricSubmission.WithLabelValues("submissioncheck").Inc()
+		c.log.Infox("submission check", err, slog.String("user", c.username))
+		xsmtpUserErrorf(smtp.C554TransactionFailed, smtp.SePol7Other0, "%s", err)
+	}
+
+	// Check outgoing message rate limit, and whether the account appears compromised.
+	var holdReason string
 	err = c.account.DB.Read(ctx, func(tx *bstore.Tx) error {
 		rcpts := make([]smtp.Path, len(c.recipients))
 		for i, r := range c.recipients {
@@ -2380,9 +2985,16 @@ func (c *conn) submit(ctx context.Context, recvHdrFor func(string) string, msgWr
 			metricSubmission.WithLabelValues("recipientlimiterror").Inc()
 			xsmtpUserErrorf(smtp.C451LocalErr, smtp.SePol7DeliveryUnauth1, "max number of new/first-time recipients (%d) over past 24h reached, try increasing per-account setting MaxFirstTimeRecipientsPerDay", rcptlimit)
 		}
+		holdReason, err = c.account.OutgoingHoldCheck(ctx, tx, rcpts, c.remoteIP)
+		xcheckf(err, "checking outgoing hold heuristics")
 		return nil
 	})
 	xcheckf(err, "read-only transaction")
+	if holdReason != "" {
+		// The hold rule applies to this message too when it is queued.
+		err := queue.HoldAccount(ctx, c.log, c.account.Name, holdReason)
+		xcheckf(err, "holding outgoing messages of account")
+	}
 
 	// We gather any X-Mox-Extra-* headers into the "extra" data during queueing, which
 	// will make it into any webhook we deliver.
@@ -2447,7 +3059,6 @@ func (c *conn) submit(ctx context.Context, recvHdrFor func(string) string, msgWr
 	// measures. Accounts on a single mox instance should be allowed to block each
 	// other.
 
-	accConf, _ := c.account.Conf()
 	loginAddr, err := smtp.ParseAddress(c.username)
 	xcheckf(err, "parsing login address")
 	useFromID := slices.Contains(accConf.ParsedFromIDLoginAddresses, loginAddr)
@@ -2504,6 +3115,7 @@ func (c *conn) submit(ctx context.Context, recvHdrFor func(string) string, msgWr
 			qm.NextAttempt = c.futureRelease
 			qm.FutureReleaseRequest = c.futureReleaseRequest
 		}
+		c.dsnParams(rcpt).set(&qm)
 		qm.FromID = fromID
 		qm.Extra = extra
 		qml[i] = qm
@@ -2589,11 +3201,49 @@ func (c *conn) xlocalserveError(lp smtp.Localpart) {
 	}
 }
 
+// event returns an event for the event database for an incoming message.
+func (c *conn) event(kind eventdb.Kind, messageID string, a analysis) eventdb.Event {
+	var sender string
+	if c.mailFrom != nil {
+		sender = c.mailFrom.XString(true)
+	}
+	return eventdb.Event{
+		Kind:      kind,
+		MessageID: messageID,
+		Account:   a.d.acc.Name,
+		Sender:    sender,
+		Recipient: a.d.deliverTo.XString(true),
+		RemoteIP:  c.remoteIP.String(),
+	}
+}
+
 // deliver is called for incoming messages from external, typically untrusted
 // sources. i.e. not submitted by authenticated users.
 func (c *conn) deliver(ctx context.Context, recvHdrFor func(string) string, msgWriter *message.Writer, iprevStatus iprev.Status, iprevAuthentic bool, dataFile *os.File) {
 	// todo: in decision making process, if we run into (some) temporary errors, attempt to continue. if we decide to accept, all good. if we decide to reject, we'll make it a temporary reject.
 
+	// External content filters can refuse the message, or change it before we analyze
+	// and deliver it.
+	var quarantineMailbox string
+	if len(c.contentFilters) > 0 {
+		tx := contentFilterTransaction{
+			RemoteIP: c.remoteIP.String(),
+			EHLO:     c.hello.String(),
+			MailFrom: c.mailFrom.String(),
+			TLS:      c.tls,
+		}
+		for _, rcpt := range c.recipients {
+			tx.RcptTo = append(tx.RcptTo, rcpt.Addr.String())
+		}
+		var f *os.File
+		var w *message.Writer
+		quarantineMailbox, f, w = contentFilters(ctx, c.log, c.contentFilters, tx, dataFile, msgWriter)
+		if f != nil {
+			defer store.CloseRemoveTempFile(c.log, f, "message from content filter")
+			dataFile, msgWriter = f, w
+		}
+	}
+
 	var msgFrom smtp.Address
 	var envelope *message.Envelope
 	var headers textproto.MIMEHeader
@@ -2614,8 +3264,8 @@ func (c *conn) deliver(ctx context.Context, recvHdrFor func(string) string, msgW
 	}
 
 	// TLS-Required: No header makes us not enforce recipient domain's TLS policy.
-	// Since we only deliver locally at the moment, this won't influence our behaviour.
-	// Once we forward, it would our delivery attempts.
+	// Local deliveries are not affected, but messages queued for remote members of
+	// aliases, and DSNs, are delivered with this policy.
 	// ../rfc/8689:206
 	// Only when requiretls smtp extension wasn't used. ../rfc/8689:246
 	if c.requireTLS == nil && hasTLSRequiredNo(headers) {
@@ -2654,6 +3304,8 @@ func (c *conn) deliver(ctx context.Context, recvHdrFor func(string) string, msgW
 	wg.Add(1)
 	var dkimResults []dkim.Result
 	var dkimErr error
+	var arcResult dkim.ARCResult
+	var arcErr error
 	go func() {
 		defer func() {
 			x := recover() // Should not happen, but don't take program down if it does.
@@ -2699,6 +3351,9 @@ func (c *conn) deliver(ctx context.Context, recvHdrFor func(string) string, msgW
 			}
 		}
 		dkimResults, dkimErr = dkim.Verify(dkimctx, c.log.Logger, resolver, c.msgsmtputf8, dkim.DefaultPolicy, dataFile, ignoreTestMode)
+		// The ARC chain is recorded in the Authentication-Results, and when forwarding
+		// the message, we add our ARC set to the chain.
+		arcResult, arcErr = dkim.ARCVerify(dkimctx, c.log.Logger, resolver, c.msgsmtputf8, dataFile)
 		dkimcancel()
 	}()
 
@@ -2753,7 +3408,7 @@ func (c *conn) deliver(ctx context.Context, recvHdrFor func(string) string, msgW
 	// Give immediate response if all recipients are unknown.
 	nunknown := 0
 	for _, r := range c.recipients {
-		if r.Account == nil && r.Alias == nil {
+		if r.Account == nil && r.Alias == nil && r.SRS == nil {
 			nunknown++
 		}
 	}
@@ -2835,6 +3490,33 @@ func (c *conn) deliver(ctx context.Context, recvHdrFor func(string) string, msgW
 			slog.Any("identity", identity))
 	}
 
+	// Add ARC result to Authentication-Results header. ../rfc/8617
+	if arcErr != nil {
+		c.log.Errorx("arc verify", arcErr)
+		arcResult = dkim.ARCResult{Status: dkim.ARCFail, Err: arcErr}
+	}
+	arcMethod := message.AuthMethod{
+		Method: "arc",
+		Result: string(arcResult.Status),
+		Props: []message.AuthProp{
+			message.MakeAuthProp("smtp", "remote-ip", c.remoteIP.String(), false, ""),
+		},
+	}
+	if arcResult.Status == dkim.ARCPass {
+		var sealers []string
+		for _, d := range arcResult.Sealers {
+			sealers = append(sealers, d.XName(c.msgsmtputf8))
+		}
+		arcMethod.Comment = fmt.Sprintf("i=%d sealed by %s", arcResult.Instance, strings.Join(sealers, ","))
+	} else if arcResult.Err != nil {
+		arcMethod.Reason = arcResult.Err.Error()
+	}
+	authResults.Methods = append(authResults.Methods, arcMethod)
+	c.log.Debugx("arc verification result", arcResult.Err,
+		slog.Any("mailfrom", c.mailFrom),
+		slog.Any("status", arcResult.Status),
+		slog.Int("instance", arcResult.Instance))
+
 	// Add SPF results to Authentication-Results header. ../rfc/7208:2141
 	var spfIdentity *dns.Domain
 	var mailFromValidation = store.ValidationUnknown
@@ -2952,6 +3634,15 @@ func (c *conn) deliver(ctx context.Context, recvHdrFor func(string) string, msgW
 	}
 	c.log.Debug("dmarc verification", slog.Any("result", dmarcResult.Status), slog.Any("domain", msgFrom.Domain))
 
+	// A surge of messages failing DMARC for one of our domains is likely a spoofing
+	// campaign, which is detected and can make the junk filter stricter.
+	var spoofProtect bool
+	if dmarcResult.Status == dmarc.StatusFail {
+		if _, ok := mox.Conf.Domain(msgFrom.Domain); ok {
+			spoofProtect = dmarcdb.SpoofAdd(ctx, c.log, msgFrom.Domain, c.remoteIP.String())
+		}
+	}
+
 	// Prepare for analyzing content, calculating reputation.
 	ipmasked1, ipmasked2, ipmasked3 := ipmasked(c.remoteIP)
 	var verifiedDKIMDomains []string
@@ -2980,7 +3671,7 @@ func (c *conn) deliver(ctx context.Context, recvHdrFor func(string) string, msgW
 	// deliver to a single recipient, e.g. for junk mail).
 	// ../rfc/3464:436
 	type deliverError struct {
-		rcptTo    smtp.Path
+		rcpt      recipient
 		code      int
 		secode    string
 		userError bool
@@ -2988,9 +3679,9 @@ func (c *conn) deliver(ctx context.Context, recvHdrFor func(string) string, msgW
 	}
 	var deliverErrors []deliverError
 	addError := func(rcpt recipient, code int, secode string, userError bool, errmsg string) {
-		e := deliverError{rcpt.Addr, code, secode, userError, errmsg}
+		e := deliverError{rcpt, code, secode, userError, errmsg}
 		c.log.Info("deliver error",
-			slog.Any("rcptto", e.rcptTo),
+			slog.Any("rcptto", e.rcpt.Addr),
 			slog.Int("code", code),
 			slog.String("secode", "secode"),
 			slog.Bool("usererror", userError),
@@ -3085,7 +3776,7 @@ func (c *conn) deliver(ctx context.Context, recvHdrFor func(string) string, msgW
 			msgTo = envelope.To
 			msgCc = envelope.CC
 		}
-		d := delivery{c.tls, &m, dataFile, smtpRcptTo, deliverTo, destination, canonicalAddr, acc, msgTo, msgCc, msgFrom, c.dnsBLs, dmarcUse, dmarcResult, dkimResults, iprevStatus, c.smtputf8}
+		d := delivery{c.tls, &m, dataFile, smtpRcptTo, deliverTo, destination, canonicalAddr, acc, msgTo, msgCc, msgFrom, c.dnsBLs, dmarcUse, dmarcResult, dkimResults, iprevStatus, c.smtputf8, headers, nil, spoofProtect}
 
 		r := analyze(ctx, log, c.resolver, d)
 		return &r, nil
@@ -3106,6 +3797,25 @@ func (c *conn) deliver(ctx context.Context, recvHdrFor func(string) string, msgW
 		// deliveries, and return an error at the end? Though the failure conditions will
 		// probably prevent any other successful deliveries too...
 		// We'll continue delivering to other recipients. ../rfc/5321:3275
+		if rcpt.SRS != nil {
+			// Bounce for a message we forwarded. We send it on to the original sender, with
+			// the null reverse path of the bounce. The address was verified during RCPT TO.
+			var subject string
+			if envelope != nil {
+				subject = envelope.Subject
+			}
+			prefix := []byte(recvHdrFor(rcpt.Addr.String()))
+			qm := queue.MakeMsg(smtp.Path{}, *rcpt.SRS, msgWriter.Has8bit, c.msgsmtputf8, int64(len(prefix))+msgWriter.Size, headers.Get("Message-Id"), prefix, c.requireTLS, time.Now(), subject)
+			if err := queue.Add(ctx, log, mox.Conf.Static.Postmaster.Account, dataFile, qm); err != nil {
+				log.Errorx("queueing bounce for forwarded message", err)
+				metricDelivery.WithLabelValues("delivererror", "").Inc()
+				addError(rcpt, smtp.C451LocalErr, smtp.SeSys3Other0, false, "error processing")
+				return
+			}
+			metricDelivery.WithLabelValues("srsbounce", "").Inc()
+			log.Info("bounce for forwarded message queued for original sender", slog.Any("origfrom", *rcpt.SRS))
+			return
+		}
 		if rcpt.Account == nil && rcpt.Alias == nil {
 			metricDelivery.WithLabelValues("unknownuser", "").Inc()
 			addError(rcpt, smtp.C550MailboxUnavail, smtp.SeAddr1UnknownDestMailbox1, true, "no such user")
@@ -3135,8 +3845,26 @@ func (c *conn) deliver(ctx context.Context, recvHdrFor func(string) string, msgW
 				return
 			}
 
+			// We add a Delivered-To header with the alias address when forwarding to remote
+			// members. If we see it again, the message is looping. ../rfc/9228:274
+			for _, v := range headers.Values("Delivered-To") {
+				if strings.EqualFold(strings.TrimSpace(v), rcpt.Alias.CanonicalAddress) {
+					log.Info("alias delivery loop detected", slog.String("alias", rcpt.Alias.CanonicalAddress))
+					addError(rcpt, smtp.C550MailboxUnavail, smtp.SeNet4Loop6, true, "loop detected for alias")
+					return
+				}
+			}
+
 			la = make([]analysis, 0, len(rcpt.Alias.Alias.ParsedAddresses))
 			for _, aa := range rcpt.Alias.Alias.ParsedAddresses {
+				if accConf, ok := mox.Conf.Account(aa.AccountName); ok && accConf.Suspended != "" {
+					log.Info("not delivering to suspended account for alias member", slog.String("account", aa.AccountName), slog.Any("address", aa.Address))
+					continue
+				}
+				if aa.Destination.Disabled {
+					log.Info("not delivering to disabled alias member", slog.String("account", aa.AccountName), slog.Any("address", aa.Address))
+					continue
+				}
 				a, err := messageAnalyze(log, rcpt.Addr, aa.Address.Path(), aa.AccountName, aa.Destination, rcpt.Alias.CanonicalAddress)
 				if err != nil {
 					addError(rcpt, smtp.C451LocalErr, smtp.SeSys3Other0, false, "error processing")
@@ -3148,6 +3876,10 @@ func (c *conn) deliver(ctx context.Context, recvHdrFor func(string) string, msgW
 					a0 = &la[len(la)-1]
 				}
 			}
+			if len(la) == 0 {
+				addError(rcpt, smtp.C450MailboxUnavail, smtp.SeMailbox2Disabled1, true, "recipient mailboxes temporarily disabled")
+				return
+			}
 			if a0 == nil {
 				// First address, for rejecting.
 				a0 = &la[0]
@@ -3170,6 +3902,20 @@ func (c *conn) deliver(ctx context.Context, recvHdrFor func(string) string, msgW
 			return
 		}
 
+		// A message quarantined by a content filter is delivered to the quarantine mailbox
+		// like a reject accepted to a mailbox by a ruleset, so it isn't processed by sieve
+		// scripts or forwarded.
+		if quarantineMailbox != "" && a0.accept {
+			for i := range la {
+				la[i].mailbox = quarantineMailbox
+				la[i].d.m.IsReject = true
+				la[i].d.m.Seen = true
+			}
+			a0.reason = reasonContentFilter
+			a0.reasonText = append(a0.reasonText, "quarantined by content filter")
+			log.Info("incoming message quarantined by content filter", slog.String("mailbox", quarantineMailbox), slog.Any("msgfrom", msgFrom))
+		}
+
 		// Any DMARC result override is stored in the evaluation for outgoing DMARC
 		// aggregate reports, and added to the Authentication-Results message header.
 		// We want to tell the sender that we have an override, e.g. for mailing lists, so
@@ -3197,6 +3943,19 @@ func (c *conn) deliver(ctx context.Context, recvHdrFor func(string) string, msgW
 		rcptAuthResults.Methods = append([]message.AuthMethod{}, authResults.Methods...)
 		rcptAuthResults.Methods = append(rcptAuthResults.Methods, rcptDMARCMethod)
 
+		// arcSeal returns prefix with the headers of a new ARC set prepended, sealed by
+		// domain, for a copy of the message we forward, so the next hop can use our
+		// authentication results. If the message cannot be sealed, e.g. because its ARC
+		// chain failed, prefix is returned unchanged.
+		arcSeal := func(domain dns.Domain, prefix []byte) []byte {
+			arcHeaders, err := mox.ARCSeal(ctx, log, domain, arcResult, rcptAuthResults, c.msgsmtputf8, store.FileMsgReader(prefix, dataFile))
+			if err != nil {
+				log.Errorx("arc sealing forwarded message, continuing without", err)
+				return prefix
+			}
+			return append([]byte(arcHeaders), prefix...)
+		}
+
 		// Prepend reason as message header, for easy viewing in mail clients.
 		var xmox string
 		if a0.reason != "" {
@@ -3220,10 +3979,17 @@ func (c *conn) deliver(ctx context.Context, recvHdrFor func(string) string, msgW
 		xmox += a0.headers
 
 		for i := range la {
+			// Header fields configured for the domain, e.g. to mark external messages.
+			var inboundAdd string
+			if ih := inboundHeaders(la[i].d); ih != nil {
+				inboundAdd = inboundHeadersAdd(ih)
+			}
+
 			// ../rfc/5321:3204
 			// Received-SPF header goes before Received. ../rfc/7208:2038
 			la[i].d.m.MsgPrefix = []byte(
 				xmox +
+					inboundAdd +
 					"Delivered-To: " + la[i].d.deliverTo.XString(c.msgsmtputf8) + "\r\n" + // ../rfc/9228:274
 					"Return-Path: <" + c.mailFrom.String() + ">\r\n" + // ../rfc/5321:3300
 					rcptAuthResults.Header() +
@@ -3366,6 +4132,54 @@ func (c *conn) deliver(ctx context.Context, recvHdrFor func(string) string, msgW
 			log.Check(err, "adding dmarc evaluation to database for aggregate report")
 		}
 
+		// Gather the message-id before we deliver and the file may be consumed. Also used
+		// for the event database.
+		if !parsedMessageID {
+			if p, err := message.Parse(c.log.Logger, false, store.FileMsgReader(a0.d.m.MsgPrefix, dataFile)); err != nil {
+				log.Infox("parsing message for message-id", err)
+			} else if header, err := p.Header(); err != nil {
+				log.Infox("parsing message header for message-id", err)
+			} else {
+				messageID = header.Get("Message-Id")
+			}
+			parsedMessageID = true
+		}
+
+		events := make([]eventdb.Event, 0, 2*len(la))
+		for _, a := range la {
+			events = append(events, c.event(eventdb.KindReceived, messageID, a))
+			e := c.event(eventdb.KindJunkVerdict, messageID, a)
+			e.Success = a.accept
+			e.Detail = a.reason
+			events = append(events, e)
+		}
+		eventdb.Add(ctx, log, events...)
+
+		// Keep the junk decision per account, for analysis by users and admins.
+		for _, a := range la {
+			jd := a.decision
+			if c.mailFrom != nil {
+				jd.MailFrom = c.mailFrom.XString(true)
+			}
+			if !msgFrom.IsZero() {
+				jd.MsgFrom = msgFrom.Pack(true)
+			}
+			if envelope != nil {
+				jd.Subject = envelope.Subject
+			}
+			jd.MessageID = messageID
+			jd.Recipient = a.d.deliverTo.XString(true)
+			jd.RemoteIP = c.remoteIP.String()
+			jd.Accept = a.accept
+			if a.accept {
+				jd.Mailbox = a.mailbox
+			}
+			jd.Reason = a.reason
+			jd.ReasonText = a.reasonText
+			err := a.d.acc.JunkDecisionAdd(ctx, jd)
+			log.Check(err, "storing junk decision")
+		}
+
 		if !a0.accept {
 			for _, a := range la {
 				// Don't add message if address was also explicitly present in a RCPT TO command.
@@ -3440,6 +4254,13 @@ func (c *conn) deliver(ctx context.Context, recvHdrFor func(string) string, msgW
 			}
 		}
 
+		// Whitelist the remote network for greylisting if the message has a good
+		// reputation and passes SPF or DKIM verification.
+		if c.greylisting != nil && a0.decision.ReputationJunk != nil && !*a0.decision.ReputationJunk && (a0.d.m.MailFromValidated || len(a0.d.m.DKIMDomains) > 0) {
+			err := greylist.Whitelist(ctx, log, *c.greylisting, c.remoteIP, "reputation", time.Now())
+			log.Check(err, "whitelisting remote network for greylisting")
+		}
+
 		// If this is a first-time sender and not a forwarded/mailing list message, wait
 		// before actually delivering. If this turns out to be a spammer, we've kept one of
 		// their connections busy.
@@ -3463,16 +4284,46 @@ func (c *conn) deliver(ctx context.Context, recvHdrFor func(string) string, msgW
 			}
 		}
 
-		// Gather the message-id before we deliver and the file may be consumed.
-		if !parsedMessageID {
-			if p, err := message.Parse(c.log.Logger, false, store.FileMsgReader(a0.d.m.MsgPrefix, dataFile)); err != nil {
-				log.Infox("parsing message for message-id", err)
-			} else if header, err := p.Header(); err != nil {
-				log.Infox("parsing message header for message-id", err)
-			} else {
-				messageID = header.Get("Message-Id")
+		// Add a copy of the message to the queue for each remote alias member. This is
+		// done before delivering to local accounts, which may consume the data file. If
+		// queueing fails, we return a temporary error before any local delivery, so a
+		// retry by the remote won't cause duplicates.
+		if rcpt.Alias != nil && len(rcpt.Alias.Alias.RemoteAddresses) > 0 && quarantineMailbox == "" {
+			// Bounces go to the postmaster of the alias domain.
+			fp := smtp.Path{Localpart: "postmaster", IPDomain: dns.IPDomain{Domain: rcpt.Alias.Alias.Domain}}
+			prefix := []byte("Delivered-To: " + rcpt.Alias.CanonicalAddress + "\r\n" + recvHdrFor(rcpt.Addr.String()))
+			var subject string
+			if envelope != nil {
+				subject = envelope.Subject
+			}
+			if !rcpt.Alias.Alias.ListUnsubscribe {
+				prefix = arcSeal(rcpt.Alias.Alias.Domain, prefix)
+			}
+			var qml []queue.Msg
+			for _, ra := range rcpt.Alias.Alias.RemoteAddresses {
+				if regularRecipient(ra.Path()) || ra == msgFrom {
+					continue
+				}
+				// With one-click unsubscribe, each member gets its own link, and its own ARC
+				// seal because the headers differ.
+				raPrefix := prefix
+				if rcpt.Alias.Alias.ListUnsubscribe {
+					u := mox.Unsubscribe{Alias: rcpt.Alias.CanonicalAddress, Address: ra.String()}
+					raPrefix = arcSeal(rcpt.Alias.Alias.Domain, append([]byte(mox.UnsubscribeHeaders(u)), prefix...))
+				}
+				qm := queue.MakeMsg(fp, ra.Path(), msgWriter.Has8bit, c.msgsmtputf8, int64(len(raPrefix))+msgWriter.Size, messageID, raPrefix, c.requireTLS, time.Now(), subject)
+				c.dsnParams(rcpt).set(&qm)
+				qml = append(qml, qm)
+			}
+			if len(qml) > 0 {
+				if err := queue.Add(ctx, log, mox.Conf.Static.Postmaster.Account, dataFile, qml...); err != nil {
+					log.Errorx("queueing message for remote alias members", err)
+					metricDelivery.WithLabelValues("delivererror", a0.reason).Inc()
+					addError(rcpt, smtp.C451LocalErr, smtp.SeSys3Other0, false, "error processing")
+					return
+				}
+				log.Info("message queued for remote alias members", slog.Int("count", len(qml)), slog.String("alias", rcpt.Alias.CanonicalAddress))
 			}
-			parsedMessageID = true
 		}
 
 		// Finally deliver the message to the account(s).
@@ -3486,19 +4337,137 @@ func (c *conn) deliver(ctx context.Context, recvHdrFor func(string) string, msgW
 				continue
 			}
 
-			var delivered bool
-			a.d.acc.WithWLock(func() {
-				if err := a.d.acc.DeliverMailbox(log, a.mailbox, a.d.m, dataFile); err != nil {
-					log.Errorx("delivering", err)
-					metricDelivery.WithLabelValues("delivererror", a0.reason).Inc()
-					if errors.Is(err, store.ErrOverQuota) {
-						nfull++
+			// A copy of a message that was recently delivered, e.g. through both a mailing
+			// list and directly, can be marked as duplicate or not stored at all.
+			if dw := duplicateWindow(a.d); dw != nil && !a.d.m.IsReject {
+				if dup, err := isDuplicate(ctx, log, a.d.acc, messageID, dw.Period); err != nil {
+					log.Errorx("checking for duplicate message, continuing", err)
+				} else if dup && dw.Suppress {
+					ndelivered++
+					metricDelivery.WithLabelValues("duplicate", a0.reason).Inc()
+					log.Info("not storing duplicate message", slog.String("messageid", messageID))
+					continue
+				} else if dup {
+					log.Debug("marking duplicate message", slog.String("messageid", messageID))
+					a.d.m.Keywords, _ = store.MergeKeywords(a.d.m.Keywords, []string{"$duplicate"})
+				}
+			}
+
+			// With a sieve script, the message can be delivered to multiple mailboxes,
+			// redirected, discarded or rejected.
+			mailboxes := []string{a.mailbox}
+			sr := a.d.sieveResult
+			if sr != nil && !a.d.m.IsReject {
+				if sr.Reject {
+					// For a single recipient, the remote gets the refusal in the SMTP
+					// transaction, otherwise through a DSN. A member of an alias cannot reject
+					// for other members, the message is just not stored for the member.
+					// ../rfc/5429
+					metricDelivery.WithLabelValues("sievereject", a0.reason).Inc()
+					if rcpt.Alias == nil {
+						log.Info("incoming message rejected due to sieve script", slog.Any("msgfrom", msgFrom))
+						addError(rcpt, smtp.C550MailboxUnavail, smtp.SePol7DeliveryUnauth1, true, sieveRejectMessage(sr.RejectReason))
 					} else {
+						ndelivered++
+						log.Info("incoming message for alias member not stored due to sieve reject", slog.Any("msgfrom", msgFrom))
+					}
+					continue
+				}
+				if len(sr.Redirect) > 0 {
+					var subject string
+					if envelope != nil {
+						subject = envelope.Subject
+					}
+					// Redirects are forwarded like messages for destinations with forwarding,
+					// with an SRS-rewritten MAIL FROM.
+					if _, err := forward(ctx, log, a.d, *c.mailFrom, sr.Redirect, dataFile, msgWriter.Size, msgWriter.Has8bit, c.msgsmtputf8, c.requireTLS, c.dsnParams(rcpt), messageID, subject, recvHdrFor(a.d.deliverTo.String()), arcSeal); err != nil {
+						log.Errorx("queueing message for sieve redirect", err)
+						metricDelivery.WithLabelValues("delivererror", a0.reason).Inc()
 						addError(rcpt, smtp.C451LocalErr, smtp.SeSys3Other0, false, "error processing")
 						nerr++
+						break
 					}
+				}
+				mailboxes = sieveMailboxes(sr, a.mailbox)
+			} else {
+				sr = nil
+			}
+
+			// Messages for a destination with forwarding enabled are queued for the forwarding
+			// addresses. They are only stored locally if a copy should be kept, or if nothing
+			// was forwarded, e.g. due to a loop.
+			if fw := a.d.destination.Forward; fw != nil && !fw.Disabled && !a.d.m.IsReject && !a.d.m.Junk {
+				var subject string
+				if envelope != nil {
+					subject = envelope.Subject
+				}
+				n, err := forward(ctx, log, a.d, *c.mailFrom, fw.To, dataFile, msgWriter.Size, msgWriter.Has8bit, c.msgsmtputf8, c.requireTLS, c.dsnParams(rcpt), messageID, subject, recvHdrFor(a.d.deliverTo.String()), arcSeal)
+				if err != nil {
+					log.Errorx("queueing message for forwarding", err)
+					metricDelivery.WithLabelValues("delivererror", a0.reason).Inc()
+					addError(rcpt, smtp.C451LocalErr, smtp.SeSys3Other0, false, "error processing")
+					nerr++
+					break
+				}
+				if n > 0 && !fw.KeepCopy {
+					ndelivered++
+					metricDelivery.WithLabelValues("forwarded", a0.reason).Inc()
+					log.Info("incoming message forwarded, not stored", slog.Any("msgfrom", msgFrom))
+					continue
+				}
+			}
+
+			// The domain can have a prefix added to the Subject of incoming messages. We
+			// deliver a rewritten copy of the message.
+			msgFile := dataFile
+			if ih := inboundHeaders(a.d); ih != nil && ih.SubjectPrefix != "" && !a.d.m.IsReject && (envelope == nil || !strings.HasPrefix(envelope.Subject, strings.TrimSpace(ih.SubjectPrefix))) {
+				if f, size, err := inboundSubjectRewrite(log, dataFile, msgWriter.Size, ih.SubjectPrefix); err != nil {
+					log.Errorx("adding subject prefix to incoming message, delivering unchanged", err)
+				} else {
+					defer store.CloseRemoveTempFile(log, f, "message with subject prefix")
+					msgFile = f
+					a.d.m.Size = int64(len(a.d.m.MsgPrefix)) + size
+				}
+			}
+
+			var delivered, discarded bool
+			var mailbox string
+			a.d.acc.WithWLock(func() {
+				if len(mailboxes) == 0 {
+					discarded = true
+					ndelivered++
+					metricDelivery.WithLabelValues("discarded", a0.reason).Inc()
+					log.Info("incoming message not stored due to sieve script or ruleset", slog.Any("msgfrom", msgFrom))
 					return
 				}
+
+				orig := *a.d.m
+				for i, mb := range mailboxes {
+					m := a.d.m
+					if i > 0 {
+						// Additional mailboxes from sieve fileinto get their own copy.
+						mc := orig
+						m = &mc
+					}
+					if err := a.d.acc.DeliverMailbox(log, mb, m, msgFile); err != nil {
+						if i > 0 {
+							log.Errorx("delivering to additional mailbox for sieve script", err, slog.String("mailbox", mb))
+							continue
+						}
+						log.Errorx("delivering", err)
+						metricDelivery.WithLabelValues("delivererror", a0.reason).Inc()
+						if errors.Is(err, store.ErrOverQuota) {
+							nfull++
+						} else {
+							addError(rcpt, smtp.C451LocalErr, smtp.SeSys3Other0, false, "error processing")
+							nerr++
+						}
+						return
+					}
+					if i == 0 {
+						mailbox = mb
+					}
+				}
 				delivered = true
 				ndelivered++
 				metricDelivery.WithLabelValues("delivered", a0.reason).Inc()
@@ -3512,14 +4481,26 @@ func (c *conn) deliver(ctx context.Context, recvHdrFor func(string) string, msgW
 				}
 			})
 
+			if sr != nil && (delivered || discarded) {
+				var subject string
+				if envelope != nil {
+					subject = envelope.Subject
+				}
+				sieveActions(log, a.d, sr, msgFrom, subject)
+			}
+
 			// Pass delivered messages to queue for DSN processing and/or hooks.
 			if delivered {
-				mr := store.FileMsgReader(a.d.m.MsgPrefix, dataFile)
+				e := c.event(eventdb.KindDelivered, messageID, a)
+				e.Mailbox = mailbox
+				eventdb.Add(ctx, log, e)
+
+				mr := store.FileMsgReader(a.d.m.MsgPrefix, msgFile)
 				part, err := a.d.m.LoadPart(mr)
 				if err != nil {
 					log.Errorx("loading parsed part for evaluating webhook", err)
 				} else {
-					err = queue.Incoming(context.Background(), log, a.d.acc, messageID, *a.d.m, part, a.mailbox)
+					err = queue.Incoming(context.Background(), log, a.d.acc, messageID, *a.d.m, part, mailbox)
 					log.Check(err, "queueing webhook for incoming delivery")
 				}
 			} else if nerr > 0 && ndelivered == 0 {
@@ -3537,9 +4518,15 @@ func (c *conn) deliver(ctx context.Context, recvHdrFor func(string) string, msgW
 		}
 	}
 
-	// For each recipient, do final spam analysis and delivery.
+	// For each recipient, do final spam analysis and delivery. We keep track of
+	// recipients that requested a DSN on successful delivery.
+	var dsnSuccess []recipient
 	for _, rcpt := range c.recipients {
+		nerr := len(deliverErrors)
 		processRecipient(rcpt)
+		if len(deliverErrors) == nerr && rcpt.dsnNotify("SUCCESS") {
+			dsnSuccess = append(dsnSuccess, rcpt)
+		}
 	}
 
 	// If all recipients failed to deliver, return an error.
@@ -3577,51 +4564,110 @@ func (c *conn) deliver(ctx context.Context, recvHdrFor func(string) string, msgW
 		lines = append(lines, "multiple errors")
 		xsmtpErrorf(code, secode, !serverError, "%s", strings.Join(lines, "\n"))
 	}
-	// Generate one DSN for all failed recipients.
-	if len(deliverErrors) > 0 {
+	// Generate one DSN for all failed recipients that didn't opt out of failure
+	// notifications, and recipients that requested notification of success. Never
+	// for a null reverse path. ../rfc/3461 ../rfc/3464:436
+	var dsnErrors []deliverError
+	for _, e := range deliverErrors {
+		if e.rcpt.dsnNotify("FAILURE") {
+			dsnErrors = append(dsnErrors, e)
+		}
+	}
+	if !c.mailFrom.IsZero() && (len(dsnErrors) > 0 || len(dsnSuccess) > 0) {
+		var fromDom dns.IPDomain
+		subject := "mail delivered"
+		if len(dsnErrors) > 0 {
+			fromDom = dsnErrors[0].rcpt.Addr.IPDomain
+			subject = "mail delivery failure"
+		} else {
+			fromDom = dsnSuccess[0].Addr.IPDomain
+		}
+
 		now := time.Now()
 		dsnMsg := dsn.Message{
 			SMTPUTF8:   c.msgsmtputf8,
-			From:       smtp.Path{Localpart: "postmaster", IPDomain: deliverErrors[0].rcptTo.IPDomain},
+			From:       smtp.Path{Localpart: "postmaster", IPDomain: fromDom},
 			To:         *c.mailFrom,
-			Subject:    "mail delivery failure",
+			Subject:    subject,
 			MessageID:  mox.MessageIDGen(false),
 			References: messageID,
 
 			// Per-message details.
-			ReportingMTA:    mox.Conf.Static.HostnameDomain.ASCII,
-			ReceivedFromMTA: smtp.Ehlo{Name: c.hello, ConnIP: c.remoteIP},
-			ArrivalDate:     now,
+			OriginalEnvelopeID: c.dsnEnvID,
+			ReportingMTA:       mox.Conf.Static.HostnameDomain.ASCII,
+			ReceivedFromMTA:    smtp.Ehlo{Name: c.hello, ConnIP: c.remoteIP},
+			ArrivalDate:        now,
 		}
 
-		if len(deliverErrors) > 1 {
+		if len(dsnErrors) > 1 {
 			dsnMsg.TextBody = "Multiple delivery failures occurred.\n\n"
 		}
 
-		for _, e := range deliverErrors {
+		// Parse ORCPT for inclusion in DSN, ignoring parameters we can't parse.
+		originalRecipient := func(rcpt recipient) smtp.Path {
+			if rcpt.ORCPT == "" {
+				return smtp.Path{}
+			}
+			p, err := dsn.ParseOriginalRecipient(rcpt.ORCPT)
+			if err != nil {
+				c.log.Debugx("parsing orcpt for dsn, ignoring", err, slog.String("orcpt", rcpt.ORCPT))
+			}
+			return p
+		}
+
+		for _, e := range dsnErrors {
 			kind := "Permanent"
 			if e.code/100 == 4 {
 				kind = "Transient"
 			}
-			dsnMsg.TextBody += fmt.Sprintf("%s delivery failure to:\n\n\t%s\n\nError:\n\n\t%s\n\n", kind, e.errmsg, e.rcptTo.XString(false))
+			dsnMsg.TextBody += fmt.Sprintf("%s delivery failure to:\n\n\t%s\n\nError:\n\n\t%s\n\n", kind, e.rcpt.Addr.XString(false), e.errmsg)
+			rcpt := dsn.Recipient{
+				FinalRecipient:    e.rcpt.Addr,
+				OriginalRecipient: originalRecipient(e.rcpt),
+				Action:            dsn.Failed,
+				Status:            fmt.Sprintf("%d.%s", e.code/100, e.secode),
+				LastAttemptDate:   now,
+			}
+			dsnMsg.Recipients = append(dsnMsg.Recipients, rcpt)
+		}
+		for _, r := range dsnSuccess {
+			// Delivery to an alias is reported as expanded. ../rfc/3461
+			action := dsn.Delivered
+			if r.Alias != nil {
+				action = dsn.Expanded
+			}
+			dsnMsg.TextBody += fmt.Sprintf("Delivered to:\n\n\t%s\n\n", r.Addr.XString(false))
 			rcpt := dsn.Recipient{
-				FinalRecipient:  e.rcptTo,
-				Action:          dsn.Failed,
-				Status:          fmt.Sprintf("%d.%s", e.code/100, e.secode),
-				LastAttemptDate: now,
+				FinalRecipient:    r.Addr,
+				OriginalRecipient: originalRecipient(r),
+				Action:            action,
+				Status:            "2.0.0",
+				LastAttemptDate:   now,
 			}
 			dsnMsg.Recipients = append(dsnMsg.Recipients, rcpt)
 		}
 
-		header, err := message.ReadHeaders(bufio.NewReader(&moxio.AtReader{R: dataFile}))
-		if err != nil {
-			c.log.Errorx("reading headers of incoming message for dsn, continuing dsn without headers", err)
+		// Only include the full message if requested, and not with REQUIRETLS, the DSN
+		// may be delivered over less protected channels. ../rfc/3461 ../rfc/8689
+		requireTLS := c.requireTLS != nil && *c.requireTLS
+		if c.dsnRet == "FULL" && !requireTLS {
+			buf, err := io.ReadAll(&moxio.AtReader{R: dataFile})
+			if err != nil {
+				c.log.Errorx("reading incoming message for dsn, continuing dsn without message", err)
+			}
+			dsnMsg.Original = buf
+			dsnMsg.OriginalFull = true
+		} else {
+			header, err := message.ReadHeaders(bufio.NewReader(&moxio.AtReader{R: dataFile}))
+			if err != nil {
+				c.log.Errorx("reading headers of incoming message for dsn, continuing dsn without headers", err)
+			}
+			dsnMsg.Original = header
 		}
-		dsnMsg.Original = header
 
 		if Localserve {
 			c.log.Error("not queueing dsn for incoming delivery due to localserve")
-		} else if err := queueDSN(context.TODO(), c.log, c, *c.mailFrom, dsnMsg, c.requireTLS != nil && *c.requireTLS); err != nil {
+		} else if err := queueDSN(context.TODO(), c.log, c, *c.mailFrom, dsnMsg, requireTLS); err != nil {
 			metricServerErrors.WithLabelValues("queuedsn").Inc()
 			c.log.Errorx("queuing DSN for incoming delivery, no DSN sent", err)
 		}
@@ -3640,6 +4686,9 @@ func aliasAllowedMsgFrom(alias config.Alias, msgFrom smtp.Address) bool {
 			return true
 		}
 	}
+	if slices.Contains(alias.RemoteAddresses, msgFrom) {
+		return true
+	}
 	lp, err := smtp.ParseLocalpart(alias.LocalpartStr)
 	xcheckf(err, "parsing alias localpart")
 	if msgFrom == smtp.NewAddress(lp, alias.Domain) {
@@ -3686,16 +4735,19 @@ func (c *conn) cmdVrfy(p *parser) {
 
 	// ../rfc/5321:2119 ../rfc/6531:641
 	p.xspace()
-	p.xstring()
+	addr, isAddr := p.xvrfyString()
 	if p.space() {
 		p.xtake("SMTPUTF8")
 	}
 	p.xend()
 
-	// todo future: we could support vrfy and expn for submission? though would need to see if its rfc defines it.
+	if !c.xvrfyAccurate(isAddr) {
+		// ../rfc/5321:4239
+		xsmtpUserErrorf(smtp.C252WithoutVrfy, smtp.SePol7Other0, "no verify but will try delivery")
+	}
 
-	// ../rfc/5321:4239
-	xsmtpUserErrorf(smtp.C252WithoutVrfy, smtp.SePol7Other0, "no verify but will try delivery")
+	c.xvrfyLookup(addr, false)
+	c.bwritecodeline(smtp.C250Completed, smtp.SeAddr1DestValid5, "<"+addr.String()+">", nil)
 }
 
 // ../rfc/5321:2135 ../rfc/5321:1272
@@ -3705,16 +4757,87 @@ func (c *conn) cmdExpn(p *parser) {
 
 	// ../rfc/5321:2149 ../rfc/6531:645
 	p.xspace()
-	p.xstring()
+	addr, isAddr := p.xvrfyString()
 	if p.space() {
 		p.xtake("SMTPUTF8")
 	}
 	p.xend()
 
-	// todo: we could implement expn for local aliases for authenticated users, when members have permission to list. would anyone use it?
+	if !c.xvrfyAccurate(isAddr) {
+		// ../rfc/5321:4239
+		xsmtpUserErrorf(smtp.C252WithoutVrfy, smtp.SePol7Other0, "no expand but will try delivery")
+	}
 
-	// ../rfc/5321:4239
-	xsmtpUserErrorf(smtp.C252WithoutVrfy, smtp.SePol7Other0, "no expand but will try delivery")
+	alias := c.xvrfyLookup(addr, true)
+	if alias == nil {
+		xsmtpUserErrorf(smtp.C550MailboxUnavail, smtp.SeAddr1Other0, "not a mailing list")
+	}
+	// Authenticated users can only see members of lists that allow it. Clients from
+	// internal networks, e.g. tooling, can see all members.
+	if !alias.ListMembers && !c.vrfyInternal() {
+		xsmtpUserErrorf(smtp.C252WithoutVrfy, smtp.SePol7Other0, "no expand but will try delivery")
+	}
+	members := make([]string, len(alias.Addresses))
+	for i, a := range alias.Addresses {
+		members[i] = "<" + a + ">"
+	}
+	c.bwritecodeline(smtp.C250Completed, smtp.SeAddr1DestValid5, strings.Join(members, "\n"), nil)
+}
+
+// xvrfyAccurate returns whether VRFY/EXPN should be answered accurately, for
+// clients that have authenticated or connect from an internal network, and
+// addresses (not names). Responds with an error if the commands are disabled.
+func (c *conn) xvrfyAccurate(isAddr bool) bool {
+	ve := c.vrfyExpn
+	if ve == nil || ve.Mode == "252" || ve.Mode == "" {
+		return false
+	} else if ve.Mode == "disabled" {
+		xsmtpUserErrorf(smtp.C502CmdNotImpl, smtp.SeProto5BadCmdOrSeq1, "command disabled")
+	}
+	return isAddr && (c.account != nil || c.vrfyInternal())
+}
+
+// vrfyInternal returns whether the connection is from a network configured for
+// accurate VRFY/EXPN responses.
+func (c *conn) vrfyInternal() bool {
+	return c.vrfyExpn != nil && slices.ContainsFunc(c.vrfyExpn.ParsedNetworks, func(n net.IPNet) bool { return n.Contains(c.remoteIP) })
+}
+
+// xvrfyLookup looks up a local address for VRFY/EXPN, responding with an error if
+// it does not exist or cannot receive messages. For addresses in domains that are
+// not local, a 252 is returned for submission, where we will try delivery, and a
+// 551 otherwise. An alias is returned for aliases. If expn is set, addresses of
+// accounts are not checked further, they are not mailing lists.
+func (c *conn) xvrfyLookup(addr smtp.Path, expn bool) *config.Alias {
+	if len(addr.IPDomain.IP) > 0 {
+		xsmtpUserErrorf(smtp.C252WithoutVrfy, smtp.SePol7Other0, "not verifying ip addresses")
+	}
+	accountName, alias, _, dest, err := mox.LookupAddress(addr.Localpart, addr.IPDomain.Domain, true, true, true)
+	if err == nil {
+		if alias != nil || expn {
+			return alias
+		} else if dest.SMTPError != "" {
+			xsmtpServerErrorf(codes{dest.SMTPErrorCode, dest.SMTPErrorSecode}, "%s", dest.SMTPErrorMsg)
+		} else if accConf, ok := mox.Conf.Account(accountName); ok && accConf.Suspended != "" {
+			if accConf.SuspendedReject {
+				xsmtpUserErrorf(smtp.C550MailboxUnavail, smtp.SeMailbox2Disabled1, "recipient mailbox disabled")
+			}
+			xsmtpUserErrorf(smtp.C450MailboxUnavail, smtp.SeMailbox2Disabled1, "recipient mailbox temporarily disabled")
+		}
+		return nil
+	} else if errors.Is(err, mox.ErrDomainDisabled) {
+		xsmtpUserErrorf(smtp.C450MailboxUnavail, smtp.SeMailbox2Disabled1, "recipient domain temporarily disabled")
+	} else if errors.Is(err, mox.ErrDomainNotFound) {
+		if c.submission {
+			xsmtpUserErrorf(smtp.C252WithoutVrfy, smtp.SePol7Other0, "not a local address but will try delivery")
+		}
+		xsmtpUserErrorf(smtp.C551UserNotLocal, smtp.SeAddr1UnknownDestMailbox1, "not a local address")
+	} else if errors.Is(err, mox.ErrAddressNotFound) {
+		xsmtpUserErrorf(smtp.C550MailboxUnavail, smtp.SeAddr1UnknownDestMailbox1, "no such user")
+	}
+	c.log.Errorx("looking up address for vrfy/expn", err, slog.Any("address", addr))
+	xsmtpServerErrorf(codes{smtp.C451LocalErr, smtp.SeSys3Other0}, "error processing")
+	return nil
 }
 
 // ../rfc/5321:2151
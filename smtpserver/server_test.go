@@ -4,6 +4,7 @@ package smtpserver
 // todo: test delivering a message to multiple recipients, and with some of them failing.
 
 import (
+	"bufio"
 	"bytes"
 	"context"
 	"crypto/ed25519"
@@ -13,12 +14,17 @@ import (
 	"encoding/base64"
 	"errors"
 	"fmt"
+	"io"
 	"log/slog"
 	"math/big"
 	"mime/quotedprintable"
 	"net"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"regexp"
+	"slices"
 	"sort"
 	"strings"
 	"testing"
@@ -30,12 +36,15 @@ import (
 	"github.com/mjl-/mox/dkim"
 	"github.com/mjl-/mox/dmarcdb"
 	"github.com/mjl-/mox/dns"
+	"github.com/mjl-/mox/greylist"
 	"github.com/mjl-/mox/mlog"
 	"github.com/mjl-/mox/mox-"
+	"github.com/mjl-/mox/oauthbearer"
 	"github.com/mjl-/mox/queue"
 	"github.com/mjl-/mox/sasl"
 	"github.com/mjl-/mox/smtp"
 	"github.com/mjl-/mox/smtpclient"
+	"github.com/mjl-/mox/srs"
 	"github.com/mjl-/mox/store"
 	"github.com/mjl-/mox/subjectpass"
 	"github.com/mjl-/mox/tlsrptdb"
@@ -483,6 +492,92 @@ func TestSubmission(t *testing.T) {
 	}
 }
 
+// oauthClient is a SASL client for OAUTHBEARER and XOAUTH2. If fail is set, it
+// expects an error challenge from the server after the initial response.
+type oauthClient struct {
+	mech, msg string
+	fail      bool
+	step      int
+}
+
+func (a *oauthClient) Info() (name string, hasCleartextCredentials bool) {
+	return a.mech, true
+}
+
+func (a *oauthClient) Next(fromServer []byte) (toServer []byte, last bool, rerr error) {
+	defer func() { a.step++ }()
+	switch a.step {
+	case 0:
+		return []byte(a.msg), !a.fail, nil
+	case 1:
+		if a.mech == "XOAUTH2" {
+			return []byte{}, true, nil
+		}
+		return []byte{1}, true, nil
+	default:
+		return nil, false, fmt.Errorf("invalid step %d", a.step)
+	}
+}
+
+// Test submission with OAuth bearer tokens.
+func TestSubmissionOAuth(t *testing.T) {
+	ts := newTestServer(t, filepath.FromSlash("../testdata/smtp/mox.conf"), dns.MockResolver{})
+	defer ts.close()
+
+	key := ed25519.NewKeyFromSeed(make([]byte, ed25519.SeedSize))
+	jwks := fmt.Sprintf(`{"keys": [{"kty": "OKP", "crv": "Ed25519", "x": "%s"}]}`, base64.RawURLEncoding.EncodeToString(key.Public().(ed25519.PublicKey)))
+	hts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, jwks)
+	}))
+	defer hts.Close()
+
+	const issuer = "https://sso.mox.example"
+	mox.Conf.Static.OAuth = &config.OAuth{
+		Verifier: &oauthbearer.Verifier{Issuer: issuer, JWKSURL: hts.URL, Audience: "mox"},
+	}
+	defer func() {
+		mox.Conf.Static.OAuth = nil
+	}()
+
+	token := func(email string, exp time.Time) string {
+		header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg": "EdDSA"}`))
+		claims := fmt.Sprintf(`{"iss": "%s", "aud": "mox", "exp": %d, "email": "%s"}`, issuer, exp.Unix(), email)
+		data := header + "." + base64.RawURLEncoding.EncodeToString([]byte(claims))
+		return data + "." + base64.RawURLEncoding.EncodeToString(ed25519.Sign(key, []byte(data)))
+	}
+
+	testAuth := func(mech, msg string, expErr *smtpclient.Error) {
+		t.Helper()
+		ts.auth = func(mechanisms []string, cs *tls.ConnectionState) (sasl.Client, error) {
+			if !slices.Contains(mechanisms, mech) {
+				return nil, fmt.Errorf("mechanism %s not announced", mech)
+			}
+			// Bad credentials get an error challenge.
+			fail := expErr != nil && expErr.Code == smtp.C535AuthBadCreds
+			return &oauthClient{mech, msg, fail, 0}, nil
+		}
+		ts.runx(func(err error, client *smtpclient.Client) {
+			if err == nil {
+				err = client.Deliver(ctxbg, "mjl@mox.example", "remote@example.org", int64(len(submitMessage)), strings.NewReader(submitMessage), false, false, false)
+			}
+			var cerr smtpclient.Error
+			if expErr == nil && err != nil || expErr != nil && (err == nil || !errors.As(err, &cerr) || cerr.Code != expErr.Code || cerr.Secode != expErr.Secode) {
+				t.Fatalf("got err:\n%#v (%q)\nexpected:\n%#v", err, err, expErr)
+			}
+		})
+	}
+
+	ts.submission = true
+	exp := time.Now().Add(time.Hour)
+	badCreds := &smtpclient.Error{Code: smtp.C535AuthBadCreds, Secode: smtp.SePol7AuthBadCreds8}
+	testAuth("OAUTHBEARER", "n,,\x01auth=Bearer "+token("mjl@mox.example", exp)+"\x01\x01", nil)
+	testAuth("OAUTHBEARER", "n,a=móx@mox.example,\x01auth=Bearer "+token("mjl@mox.example", exp)+"\x01\x01", nil)
+	testAuth("XOAUTH2", "user=mjl@mox.example\x01auth=Bearer "+token("mjl@mox.example", exp)+"\x01\x01", nil)
+	testAuth("OAUTHBEARER", "n,,\x01auth=Bearer "+token("mjl@mox.example", time.Now().Add(-time.Hour))+"\x01\x01", badCreds)
+	testAuth("XOAUTH2", "user=other@mox.example\x01auth=Bearer "+token("mjl@mox.example", exp)+"\x01\x01", badCreds)
+	testAuth("OAUTHBEARER", "n,,\x01auth=Bearer "+token("disabled@mox.example", exp)+"\x01\x01", &smtpclient.Error{Code: smtp.C525AccountDisabled, Secode: smtp.SePol7AccountDisabled13})
+}
+
 func TestDomainDisabled(t *testing.T) {
 	ts := newTestServer(t, filepath.FromSlash("../testdata/smtp/mox.conf"), dns.MockResolver{})
 	defer ts.close()
@@ -517,6 +612,91 @@ test email
 	})
 }
 
+// Test that incoming deliveries and logins for a suspended account fail.
+func TestAccountSuspended(t *testing.T) {
+	resolver := dns.MockResolver{
+		A: map[string][]string{
+			"example.org.": {"127.0.0.10"}, // For mx check.
+		},
+	}
+	ts := newTestServer(t, filepath.FromSlash("../testdata/smtp/mox.conf"), resolver)
+	defer ts.close()
+
+	acc := mox.Conf.Dynamic.Accounts["mjl"]
+	acc.Suspended = "account suspended"
+	mox.Conf.Dynamic.Accounts["mjl"] = acc
+
+	ts.run(func(client *smtpclient.Client) {
+		mailFrom := "remote@example.org"
+		rcptTo := "mjl@mox.example"
+		err := client.Deliver(ctxbg, mailFrom, rcptTo, int64(len(deliverMessage)), strings.NewReader(deliverMessage), false, false, false)
+		ts.smtpErr(err, &smtpclient.Error{Permanent: false, Code: smtp.C450MailboxUnavail, Secode: smtp.SeMailbox2Disabled1})
+	})
+
+	acc.SuspendedReject = true
+	mox.Conf.Dynamic.Accounts["mjl"] = acc
+
+	ts.run(func(client *smtpclient.Client) {
+		mailFrom := "remote@example.org"
+		rcptTo := "mjl@mox.example"
+		err := client.Deliver(ctxbg, mailFrom, rcptTo, int64(len(deliverMessage)), strings.NewReader(deliverMessage), false, false, false)
+		ts.smtpErr(err, &smtpclient.Error{Permanent: true, Code: smtp.C550MailboxUnavail, Secode: smtp.SeMailbox2Disabled1})
+	})
+
+	// Login for submission must fail.
+	ts.submission = true
+	ts.auth = func(mechanisms []string, cs *tls.ConnectionState) (sasl.Client, error) {
+		return sasl.NewClientPlain("mjl@mox.example", password0), nil
+	}
+	ts.runx(func(err error, client *smtpclient.Client) {
+		var cerr smtpclient.Error
+		if err == nil || !errors.As(err, &cerr) || cerr.Code != smtp.C525AccountDisabled || cerr.Secode != smtp.SePol7AccountDisabled13 {
+			t.Fatalf("got err %v, expected account disabled", err)
+		}
+	})
+
+	// Session that authenticated before suspension is closed at its next command.
+	acc.Suspended = ""
+	acc.SuspendedReject = false
+	mox.Conf.Dynamic.Accounts["mjl"] = acc
+	ts.run(func(client *smtpclient.Client) {
+		acc.Suspended = "account suspended"
+		mox.Conf.Dynamic.Accounts["mjl"] = acc
+
+		mailFrom := "mjl@mox.example"
+		rcptTo := "remote@example.org"
+		err := client.Deliver(ctxbg, mailFrom, rcptTo, int64(len(submitMessage)), strings.NewReader(submitMessage), false, false, false)
+		ts.smtpErr(err, &smtpclient.Error{Permanent: false, Code: smtp.C421ServiceUnavail, Secode: smtp.SePol7AccountDisabled13})
+	})
+}
+
+// Test submission login is rejected when not connecting from account
+// LoginNetworks.
+func TestLoginNetworks(t *testing.T) {
+	ts := newTestServer(t, filepath.FromSlash("../testdata/smtp/mox.conf"), dns.MockResolver{})
+	defer ts.close()
+
+	acc := mox.Conf.Dynamic.Accounts["mjl"]
+	acc.ParsedLoginNetworks = []net.IPNet{{IP: net.ParseIP("192.0.2.0").To4(), Mask: net.CIDRMask(24, 32)}}
+	mox.Conf.Dynamic.Accounts["mjl"] = acc
+
+	ts.submission = true
+	ts.auth = func(mechanisms []string, cs *tls.ConnectionState) (sasl.Client, error) {
+		return sasl.NewClientPlain("mjl@mox.example", password0), nil
+	}
+	ts.runx(func(err error, client *smtpclient.Client) {
+		var cerr smtpclient.Error
+		if err == nil || !errors.As(err, &cerr) || cerr.Code != smtp.C525AccountDisabled || cerr.Secode != smtp.SePol7AccountDisabled13 {
+			t.Fatalf("got err %v, expected login from network not allowed", err)
+		}
+	})
+
+	// Connections in tests are from 127.0.0.10.
+	acc.ParsedLoginNetworks = append(acc.ParsedLoginNetworks, net.IPNet{IP: net.ParseIP("127.0.0.0").To4(), Mask: net.CIDRMask(8, 32)})
+	mox.Conf.Dynamic.Accounts["mjl"] = acc
+	ts.run(func(client *smtpclient.Client) {})
+}
+
 // Test delivery from external MTA.
 func TestDelivery(t *testing.T) {
 	resolver := dns.MockResolver{
@@ -768,6 +948,20 @@ func TestSpam(t *testing.T) {
 		ts.smtpErr(err, &smtpclient.Error{Permanent: false, Code: smtp.C451LocalErr, Secode: smtp.SeSys3Other0})
 		checkEvaluationCount(t, 1) // No new evaluation, this isn't a DMARC reject.
 	})
+
+	// Decisions are kept for analysis, most recent first.
+	l, err := ts.acc.JunkDecisions(ctxbg, time.Time{}, time.Time{}, 0)
+	tcheck(t, err, "list junk decisions")
+	if len(l) < 3 {
+		t.Fatalf("got %d junk decisions, expected at least 3", len(l))
+	}
+	jd := l[0]
+	if jd.Accept || jd.Reason != jd.ReputationMethod || jd.ReputationJunk == nil || !*jd.ReputationJunk || !jd.ReputationConclusive || jd.Recipient != "mjl@mox.example" || jd.MailFrom != "remote@example.org" || jd.Subject != "test" {
+		t.Fatalf("unexpected junk decision for reject by reputation: %#v", jd)
+	}
+	if jd := l[1]; !jd.Accept || jd.Mailbox != "Inbox" || jd.ReputationJunk == nil || *jd.ReputationJunk || !jd.ReputationConclusive {
+		t.Fatalf("unexpected junk decision for accept by reputation: %#v", jd)
+	}
 }
 
 // Test accept/reject with forwarded messages, DMARC ignored, no IP/EHLO/MAIL
@@ -1337,6 +1531,93 @@ func TestRatelimitDelivery(t *testing.T) {
 	})
 }
 
+// Test that transactions with null reverse path without message are limited, but
+// regular DSNs are not.
+func TestNullSenderProbes(t *testing.T) {
+	resolver := dns.MockResolver{
+		A: map[string][]string{
+			"example.org.": {"127.0.0.10"}, // For mx check.
+		},
+		PTR: map[string][]string{
+			"127.0.0.10": {"example.org."}, // For iprev check.
+		},
+	}
+	ts := newTestServer(t, filepath.FromSlash("../testdata/smtp/mox.conf"), resolver)
+	ts.tlsmode = smtpclient.TLSSkip
+	defer ts.close()
+
+	orig := nullSenderProbesPerHourDefault
+	nullSenderProbesPerHourDefault = 2
+	limitersInit()
+	defer func() {
+		nullSenderProbesPerHourDefault = orig
+		limitersInit()
+	}()
+
+	ts.runRaw(func(conn net.Conn) {
+		ourHostname := mox.Conf.Static.HostnameDomain
+		remoteHostname := dns.Domain{ASCII: "mox.example"}
+		opts := smtpclient.Opts{
+			RootCAs: mox.Conf.Static.TLS.CertPool,
+		}
+		log := pkglog.WithCid(ts.cid - 1)
+		_, err := smtpclient.New(ctxbg, log.Logger, conn, ts.tlsmode, ts.tlspkix, ourHostname, remoteHostname, opts)
+		tcheck(t, err, "smtpclient")
+		defer conn.Close()
+
+		write := func(s string) {
+			_, err := conn.Write([]byte(s))
+			tcheck(t, err, "write")
+		}
+
+		readPrefixLine := func(prefix string) string {
+			t.Helper()
+			buf := make([]byte, 512)
+			n, err := conn.Read(buf)
+			tcheck(t, err, "read")
+			s := strings.TrimRight(string(buf[:n]), "\r\n")
+			if !strings.HasPrefix(s, prefix) {
+				t.Fatalf("got smtp response %q, expected line with prefix %q", s, prefix)
+			}
+			return s
+		}
+
+		// DSNs, with message, are not counted as probes.
+		for i := 0; i < 3; i++ {
+			write("MAIL FROM:<>\r\n")
+			readPrefixLine("2")
+			write("RCPT TO:<mjl@mox.example>\r\n")
+			readPrefixLine("2")
+			write("DATA\r\n")
+			readPrefixLine("3")
+			write("\r\ntest\r\n.\r\n")
+			readPrefixLine("2")
+		}
+
+		// Probes without message are counted, until the limit is reached.
+		for i := 0; i < 2; i++ {
+			write("MAIL FROM:<>\r\n")
+			readPrefixLine("2")
+			write("RCPT TO:<mjl@mox.example>\r\n")
+			readPrefixLine("2")
+			write("RSET\r\n")
+			readPrefixLine("2")
+		}
+		write("MAIL FROM:<>\r\n")
+		readPrefixLine("2")
+		write("RCPT TO:<mjl@mox.example>\r\n")
+		readPrefixLine("451 4.7.0 ")
+
+		// Regular senders are not affected.
+		write("RSET\r\n")
+		readPrefixLine("2")
+		write("MAIL FROM:<remote@example.org>\r\n")
+		readPrefixLine("2")
+		write("RCPT TO:<mjl@mox.example>\r\n")
+		readPrefixLine("2")
+	})
+}
+
 func TestNonSMTP(t *testing.T) {
 	ts := newTestServer(t, filepath.FromSlash("../testdata/smtp/mox.conf"), dns.MockResolver{})
 	defer ts.close()
@@ -1781,6 +2062,99 @@ func TestSmuggle(t *testing.T) {
 	test("\n.\r\n")
 }
 
+// Test delivery with BDAT chunks, and errors that leave the connection usable.
+func TestBdat(t *testing.T) {
+	resolver := dns.MockResolver{
+		A: map[string][]string{
+			"example.org.": {"127.0.0.10"}, // For mx check.
+		},
+		PTR: map[string][]string{
+			"127.0.0.10": {"example.org."}, // For iprev check.
+		},
+	}
+	ts := newTestServer(t, filepath.FromSlash("../testdata/smtp/mox.conf"), resolver)
+	ts.tlsmode = smtpclient.TLSSkip
+	defer ts.close()
+
+	ts.runRaw(func(conn net.Conn) {
+		ourHostname := mox.Conf.Static.HostnameDomain
+		remoteHostname := dns.Domain{ASCII: "mox.example"}
+		opts := smtpclient.Opts{
+			RootCAs: mox.Conf.Static.TLS.CertPool,
+		}
+		log := pkglog.WithCid(ts.cid - 1)
+		_, err := smtpclient.New(ctxbg, log.Logger, conn, ts.tlsmode, ts.tlspkix, ourHostname, remoteHostname, opts)
+		tcheck(t, err, "smtpclient")
+		defer conn.Close()
+
+		br := bufio.NewReader(conn)
+		write := func(s string) {
+			t.Helper()
+			_, err := conn.Write([]byte(s))
+			tcheck(t, err, "write")
+		}
+		// Read a response, possibly multiline, and return the last line.
+		readPrefixLine := func(prefix string) string {
+			t.Helper()
+			for {
+				line, err := br.ReadString('\n')
+				tcheck(t, err, "read")
+				line = strings.TrimRight(line, "\r\n")
+				if len(line) > 3 && line[3] == '-' {
+					continue
+				}
+				if !strings.HasPrefix(line, prefix) {
+					t.Fatalf("got smtp response %q, expected line with prefix %q", line, prefix)
+				}
+				return line
+			}
+		}
+		transact := func(cmd, prefix string) {
+			t.Helper()
+			write(cmd)
+			readPrefixLine(prefix)
+		}
+
+		// Chunk without transaction is consumed, connection stays usable.
+		transact("BDAT 4\r\ntest", "503 ")
+		transact("NOOP\r\n", "250 ")
+
+		// Binary MIME is not supported.
+		transact("MAIL FROM:<remote@example.org> BODY=BINARYMIME\r\n", "555 ")
+
+		transact("MAIL FROM:<remote@example.org>\r\n", "250 ")
+		transact("RCPT TO:<mjl@mox.example>\r\n", "250 ")
+		n := len(deliverMessage) / 2
+		transact(fmt.Sprintf("BDAT %d\r\n%s", n, deliverMessage[:n]), "250 ")
+		transact("DATA\r\n", "503 ")
+		transact("RCPT TO:<mjl@mox.example>\r\n", "503 ")
+		transact(fmt.Sprintf("BDAT %d LAST\r\n%s", len(deliverMessage)-n, deliverMessage[n:]), "250 ")
+		ts.checkCount("Inbox", 1)
+
+		// Empty last chunk.
+		transact("MAIL FROM:<remote@example.org>\r\n", "250 ")
+		transact("RCPT TO:<mjl@mox.example>\r\n", "250 ")
+		transact(fmt.Sprintf("BDAT %d\r\n%s", len(deliverMessage2), deliverMessage2), "250 ")
+		transact("BDAT 0 LAST\r\n", "250 ")
+		ts.checkCount("Inbox", 2)
+
+		// Chunks are discarded on RSET.
+		transact("MAIL FROM:<remote@example.org>\r\n", "250 ")
+		transact("RCPT TO:<mjl@mox.example>\r\n", "250 ")
+		transact("BDAT 4\r\ntest", "250 ")
+		transact("RSET\r\n", "250 ")
+		transact("BDAT 0 LAST\r\n", "503 ")
+		ts.checkCount("Inbox", 2)
+
+		// Unparsable size closes the connection.
+		transact("BDAT x\r\n", "501 ")
+		_, err = br.ReadString('\n')
+		if err == nil {
+			t.Fatalf("connection still open after bad bdat command")
+		}
+	})
+}
+
 func TestFutureRelease(t *testing.T) {
 	ts := newTestServer(t, filepath.FromSlash("../testdata/smtp/mox.conf"), dns.MockResolver{})
 	ts.tlsmode = smtpclient.TLSSkip
@@ -1952,6 +2326,120 @@ test email
 	// note: these headers currently stay in the message.
 }
 
+// TestDSNParams checks that DSN parameters from MAIL FROM and RCPT TO are stored
+// in the queue for submissions, and that a DSN is queued for incoming deliveries
+// with NOTIFY=SUCCESS.
+func TestDSNParams(t *testing.T) {
+	resolver := dns.MockResolver{
+		A: map[string][]string{
+			"example.org.": {"127.0.0.10"}, // For mx check.
+		},
+		PTR: map[string][]string{
+			"127.0.0.10": {"example.org."}, // For iprev check.
+		},
+	}
+	ts := newTestServer(t, filepath.FromSlash("../testdata/smtp/mox.conf"), resolver)
+	ts.tlsmode = smtpclient.TLSSkip
+	defer ts.close()
+
+	dsnParams := &smtpclient.DSN{
+		Ret:   "FULL",
+		EnvID: "env+id",
+		Recipients: []smtpclient.DSNRecipient{
+			{Notify: []string{"SUCCESS", "FAILURE"}, ORCPT: "rfc822;orig@example.org"},
+		},
+	}
+
+	ts.user = "mjl@mox.example"
+	ts.pass = password0
+	ts.submission = true
+	ts.run(func(client *smtpclient.Client) {
+		if !client.SupportsDSN() {
+			t.Fatalf("server does not announce dsn")
+		}
+		_, err := client.DeliverMultipleDSN(ctxbg, "mjl@mox.example", []string{"remote@example.org"}, int64(len(submitMessage)), strings.NewReader(submitMessage), false, false, false, dsnParams)
+		tcheck(t, err, "deliver")
+	})
+	msgs, err := queue.List(ctxbg, queue.Filter{}, queue.Sort{})
+	tcheck(t, err, "queue list")
+	tcompare(t, len(msgs), 1)
+	tcompare(t, msgs[0].DSNNotify, []string{"SUCCESS", "FAILURE"})
+	tcompare(t, msgs[0].DSNORCPT, "rfc822;orig@example.org")
+	tcompare(t, msgs[0].DSNRet, "FULL")
+	tcompare(t, msgs[0].DSNEnvID, "env+id")
+	_, err = queue.Drop(ctxbg, pkglog, queue.Filter{})
+	tcheck(t, err, "drop queue")
+
+	// Incoming delivery with NOTIFY=SUCCESS results in a DSN to the sender.
+	ts.user = ""
+	ts.pass = ""
+	ts.submission = false
+	ts.run(func(client *smtpclient.Client) {
+		_, err := client.DeliverMultipleDSN(ctxbg, "remote@example.org", []string{"mjl@mox.example"}, int64(len(deliverMessage)), strings.NewReader(deliverMessage), false, false, false, dsnParams)
+		tcheck(t, err, "deliver")
+	})
+	ts.checkCount("Inbox", 1)
+	msgs, err = queue.List(ctxbg, queue.Filter{}, queue.Sort{})
+	tcheck(t, err, "queue list")
+	tcompare(t, len(msgs), 1)
+	tcompare(t, msgs[0].Recipient().XString(false), "remote@example.org")
+	tcompare(t, msgs[0].SenderLocalpart, smtp.Localpart(""))
+	_, err = queue.Drop(ctxbg, pkglog, queue.Filter{})
+	tcheck(t, err, "drop queue")
+
+	// Parameters are passed on for messages relayed to forwarding addresses and remote
+	// alias members.
+	for _, rcpt := range []string{"fwd@mox.example", "forward@mox.example"} {
+		ts.run(func(client *smtpclient.Client) {
+			_, err := client.DeliverMultipleDSN(ctxbg, "remote@example.org", []string{rcpt}, int64(len(deliverMessage)), strings.NewReader(deliverMessage), false, false, false, dsnParams)
+			tcheck(t, err, "deliver")
+		})
+		msgs, err = queue.List(ctxbg, queue.Filter{To: "remote@remote.example"}, queue.Sort{})
+		tcheck(t, err, "queue list")
+		tcompare(t, len(msgs), 1)
+		tcompare(t, msgs[0].DSNNotify, []string{"SUCCESS", "FAILURE"})
+		tcompare(t, msgs[0].DSNORCPT, "rfc822;orig@example.org")
+		tcompare(t, msgs[0].DSNRet, "FULL")
+		tcompare(t, msgs[0].DSNEnvID, "env+id")
+		_, err = queue.Drop(ctxbg, pkglog, queue.Filter{})
+		tcheck(t, err, "drop queue")
+	}
+
+	// Invalid parameters are rejected.
+	ts.runRaw(func(conn net.Conn) {
+		ourHostname := mox.Conf.Static.HostnameDomain
+		remoteHostname := dns.Domain{ASCII: "mox.example"}
+		opts := smtpclient.Opts{
+			RootCAs: mox.Conf.Static.TLS.CertPool,
+		}
+		log := pkglog.WithCid(ts.cid - 1)
+		_, err := smtpclient.New(ctxbg, log.Logger, conn, ts.tlsmode, ts.tlspkix, ourHostname, remoteHostname, opts)
+		tcheck(t, err, "smtpclient")
+		defer conn.Close()
+
+		br := bufio.NewReader(conn)
+		transact := func(cmd, prefix string) {
+			t.Helper()
+			_, err := conn.Write([]byte(cmd))
+			tcheck(t, err, "write")
+			line, err := br.ReadString('\n')
+			tcheck(t, err, "read")
+			if !strings.HasPrefix(line, prefix) {
+				t.Fatalf("got smtp response %q, expected line with prefix %q", line, prefix)
+			}
+		}
+
+		transact("MAIL FROM:<remote@example.org> RET=BOGUS\r\n", "501 ")
+		transact("MAIL FROM:<remote@example.org> ENVID=\r\n", "501 ")
+		transact("MAIL FROM:<remote@example.org> RET=HDRS ENVID=x\r\n", "250 ")
+		transact("RCPT TO:<mjl@mox.example> NOTIFY=NEVER,SUCCESS\r\n", "501 ")
+		transact("RCPT TO:<mjl@mox.example> NOTIFY=BOGUS\r\n", "501 ")
+		transact("RCPT TO:<mjl@mox.example> ORCPT=bogus\r\n", "501 ")
+		transact("RCPT TO:<mjl@mox.example> NOTIFY=NEVER NOTIFY=NEVER\r\n", "501 ")
+		transact("RCPT TO:<mjl@mox.example> NOTIFY=NEVER ORCPT=rfc822;mjl+40mox.example\r\n", "250 ")
+	})
+}
+
 // TestExtraDup checks for an error for duplicate x-mox-extra-* keys.
 func TestExtraDup(t *testing.T) {
 	ts := newTestServer(t, filepath.FromSlash("../testdata/smtp/mox.conf"), dns.MockResolver{})
@@ -2020,6 +2508,35 @@ test email
 	})
 }
 
+// Test the per-account submission checks.
+func TestSubmissionChecks(t *testing.T) {
+	ts := newTestServer(t, filepath.FromSlash("../testdata/smtp/mox.conf"), dns.MockResolver{})
+	defer ts.close()
+
+	ts.submission = true
+	ts.auth = func(mechanisms []string, cs *tls.ConnectionState) (sasl.Client, error) {
+		return sasl.NewClientPlain("mjl@mox.example", password0), nil
+	}
+
+	acc := mox.Conf.Dynamic.Accounts["mjl"]
+	acc.SubmissionChecks = &config.SubmissionChecks{RequireTo: true, RequireSubject: true, MaxRecipients: 1}
+	mox.Conf.Dynamic.Accounts["mjl"] = acc
+
+	submit := func(msg string, rcptTo []string, expErr *smtpclient.Error) {
+		t.Helper()
+		ts.run(func(client *smtpclient.Client) {
+			_, err := client.DeliverMultiple(ctxbg, "mjl@mox.example", rcptTo, int64(len(msg)), strings.NewReader(msg), false, false, false)
+			ts.smtpErr(err, expErr)
+		})
+	}
+
+	checkErr := &smtpclient.Error{Permanent: true, Code: smtp.C554TransactionFailed, Secode: smtp.SePol7Other0}
+	submit(submitMessage, []string{"remote@example.org"}, nil)
+	submit(strings.Replace(submitMessage, "To: <remote@example.org>\r\n", "", 1), []string{"remote@example.org"}, checkErr)
+	submit(strings.Replace(submitMessage, "Subject: test\r\n", "", 1), []string{"remote@example.org"}, checkErr)
+	submit(submitMessage, []string{"remote@example.org", "other@example.org"}, checkErr)
+}
+
 // TestDestinationSMTPError checks delivery to a destination with an SMTPError is rejected as configured.
 func TestDestinationSMTPError(t *testing.T) {
 	resolver := dns.MockResolver{
@@ -2071,3 +2588,683 @@ func TestDestinationMessageAuthRequiredSMTPError(t *testing.T) {
 		ts.smtpErr(err, nil)
 	})
 }
+
+// Test fingerprint rules for incoming connections.
+func TestFingerprintRules(t *testing.T) {
+	resolver := dns.MockResolver{
+		A: map[string][]string{
+			"example.org.": {"127.0.0.10"}, // For mx check.
+		},
+		PTR: map[string][]string{
+			"127.0.0.10": {"example.org."}, // For iprev check.
+		},
+	}
+	ts := newTestServer(t, filepath.FromSlash("../testdata/smtp/mox.conf"), resolver)
+	ts.tlsmode = smtpclient.TLSSkip
+	defer ts.close()
+
+	orig := mox.Conf.Static.Listeners["test"]
+	defer func() {
+		mox.Conf.Static.Listeners["test"] = orig
+	}()
+	setRules := func(rules ...config.FingerprintRule) {
+		l := orig
+		l.SMTP.FingerprintRules = rules
+		mox.Conf.Static.Listeners["test"] = l
+	}
+
+	deliver := func(expErr *smtpclient.Error) {
+		t.Helper()
+		ts.run(func(client *smtpclient.Client) {
+			mailFrom := "remote@example.org"
+			rcptTo := "mjl@mox.example"
+			err := client.Deliver(ctxbg, mailFrom, rcptTo, int64(len(deliverMessage)), strings.NewReader(deliverMessage), false, false, false)
+			ts.smtpErr(err, expErr)
+		})
+	}
+
+	// Our smtpclient pipelines MAIL FROM with RCPT TO and DATA.
+	setRules(config.FingerprintRule{SMTP: "EHLO,MAIL FROM:<+", Action: "reject"})
+	deliver(&smtpclient.Error{Permanent: true, Code: smtp.C554TransactionFailed, Secode: smtp.SePol7Other0})
+
+	// Non-matching rule doesn't affect delivery.
+	setRules(config.FingerprintRule{SMTP: "HELO,MAIL FROM:<", Action: "reject"})
+	deliver(nil)
+
+	// GREASE values are ignored for TLS fingerprints.
+	fp := tlsFingerprint(&tls.ClientHelloInfo{CipherSuites: []uint16{tls.TLS_AES_128_GCM_SHA256}, SupportedVersions: []uint16{tls.VersionTLS13}})
+	fpg := tlsFingerprint(&tls.ClientHelloInfo{CipherSuites: []uint16{0x1a1a, tls.TLS_AES_128_GCM_SHA256}, SupportedVersions: []uint16{0x2a2a, tls.VersionTLS13}})
+	if fp != fpg {
+		t.Fatalf("got tls fingerprint %q with grease, expected %q", fpg, fp)
+	}
+}
+
+// Test greylisting of incoming deliveries.
+func TestGreylisting(t *testing.T) {
+	resolver := dns.MockResolver{
+		A: map[string][]string{
+			"example.org.": {"127.0.0.10"}, // For mx check.
+		},
+		PTR: map[string][]string{
+			"127.0.0.10": {"example.org."}, // For iprev check.
+		},
+	}
+	ts := newTestServer(t, filepath.FromSlash("../testdata/smtp/mox.conf"), resolver)
+	ts.tlsmode = smtpclient.TLSSkip
+	defer ts.close()
+
+	err := greylist.Init()
+	tcheck(t, err, "greylist init")
+	defer greylist.Close()
+
+	orig := mox.Conf.Static.Listeners["test"]
+	defer func() {
+		mox.Conf.Static.Listeners["test"] = orig
+	}()
+	l := orig
+	l.SMTP.Greylisting = &config.Greylisting{}
+	mox.Conf.Static.Listeners["test"] = l
+
+	deliver := func(mailFrom, rcptTo string, expErr *smtpclient.Error) {
+		t.Helper()
+		ts.run(func(client *smtpclient.Client) {
+			err := client.Deliver(ctxbg, mailFrom, rcptTo, int64(len(deliverMessage)), strings.NewReader(deliverMessage), false, false, false)
+			ts.smtpErr(err, expErr)
+		})
+	}
+	greylisted := &smtpclient.Error{Code: smtp.C451LocalErr, Secode: smtp.SePol7DeliveryUnauth1}
+
+	// First contact and early retry are greylisted.
+	deliver("remote@example.org", "mjl@mox.example", greylisted)
+	deliver("remote@example.org", "mjl@mox.example", greylisted)
+	ts.checkCount("Inbox", 0)
+
+	// Unknown addresses are greylisted too.
+	deliver("remote@example.org", "unknown@mox.example", greylisted)
+
+	// Retry after the delay is accepted.
+	_, err = bstore.QueryDB[greylist.Tuple](ctxbg, greylist.DB).FilterNonzero(greylist.Tuple{RcptTo: "mjl@mox.example"}).UpdateField("First", time.Now().Add(-10*time.Minute))
+	tcheck(t, err, "update tuple")
+	deliver("remote@example.org", "mjl@mox.example", nil)
+	ts.checkCount("Inbox", 1)
+
+	// Network is now whitelisted, also for other addresses.
+	deliver("other@example.org", "mjl@mox.example", nil)
+	ts.checkCount("Inbox", 2)
+
+	// Submissions are not greylisted.
+	_, err = bstore.QueryDB[greylist.Host](ctxbg, greylist.DB).Delete()
+	tcheck(t, err, "remove whitelisted networks")
+	ts.user = "mjl@mox.example"
+	ts.pass = password0
+	ts.submission = true
+	ts.run(func(client *smtpclient.Client) {
+		err := client.Deliver(ctxbg, "mjl@mox.example", "remote@example.org", int64(len(submitMessage)), strings.NewReader(submitMessage), false, false, false)
+		tcheck(t, err, "submit")
+	})
+}
+
+// Test submission access restrictions of a listener.
+func TestSubmissionAccess(t *testing.T) {
+	ts := newTestServer(t, filepath.FromSlash("../testdata/smtp/mox.conf"), dns.MockResolver{})
+	defer ts.close()
+	ts.submission = true
+
+	orig := mox.Conf.Static.Listeners["test"]
+	defer func() {
+		mox.Conf.Static.Listeners["test"] = orig
+	}()
+	setAccess := func(sa *config.SubmissionAccess) {
+		l := orig
+		l.SubmissionAccess = sa
+		mox.Conf.Static.Listeners["test"] = l
+	}
+
+	testAuth := func(authfn func(user, pass string, cs *tls.ConnectionState) sasl.Client, user, pass string, expErr *smtpclient.Error) {
+		t.Helper()
+		if authfn != nil {
+			ts.auth = func(mechanisms []string, cs *tls.ConnectionState) (sasl.Client, error) {
+				return authfn(user, pass, cs), nil
+			}
+		} else {
+			ts.auth = nil
+		}
+		ts.runx(func(err error, client *smtpclient.Client) {
+			mailFrom := "mjl@mox.example"
+			rcptTo := "remote@example.org"
+			if err == nil {
+				err = client.Deliver(ctxbg, mailFrom, rcptTo, int64(len(submitMessage)), strings.NewReader(submitMessage), false, false, false)
+			}
+			var cerr smtpclient.Error
+			if expErr == nil && err != nil || expErr != nil && (err == nil || !errors.As(err, &cerr) || cerr.Code != expErr.Code || cerr.Secode != expErr.Secode) {
+				t.Fatalf("got err:\n%#v (%q)\nexpected:\n%#v", err, err, expErr)
+			}
+		})
+	}
+	plain := func(user, pass string, cs *tls.ConnectionState) sasl.Client { return sasl.NewClientPlain(user, pass) }
+
+	// Connections from outside the allowed networks are refused. Test connections
+	// come from 127.0.0.10.
+	_, ipnet, err := net.ParseCIDR("10.0.0.0/8")
+	tcheck(t, err, "parse cidr")
+	setAccess(&config.SubmissionAccess{ParsedNetworks: []net.IPNet{*ipnet}})
+	testAuth(plain, "mjl@mox.example", password0, &smtpclient.Error{Code: smtp.C421ServiceUnavail})
+
+	_, ipnet, err = net.ParseCIDR("127.0.0.0/8")
+	tcheck(t, err, "parse cidr")
+	setAccess(&config.SubmissionAccess{ParsedNetworks: []net.IPNet{*ipnet}})
+	testAuth(plain, "mjl@mox.example", password0, nil)
+
+	// Require both client certificate and password.
+	setAccess(&config.SubmissionAccess{RequireClientCertAndPassword: true})
+	testAuth(plain, "mjl@mox.example", password0, &smtpclient.Error{Permanent: true, Code: smtp.C530SecurityRequired, Secode: smtp.SePol7Other0})
+
+	clientCert0 := fakeCert(ts.t, true)
+	tlspubkey, err := store.ParseTLSPublicKeyCert(clientCert0.Certificate[0])
+	tcheck(t, err, "parse certificate")
+	tlspubkey.Account = "mjl"
+	tlspubkey.LoginAddress = "mjl@mox.example"
+	err = store.TLSPublicKeyAdd(ctxbg, &tlspubkey)
+	tcheck(t, err, "add tls public key to account")
+	ts.immediateTLS = true
+	ts.clientConfig = &tls.Config{
+		InsecureSkipVerify: true,
+		Certificates: []tls.Certificate{
+			clientCert0,
+		},
+	}
+
+	// Certificate alone is not enough.
+	testAuth(func(user, pass string, cs *tls.ConnectionState) sasl.Client {
+		return sasl.NewClientExternal(user)
+	}, "", "", &smtpclient.Error{Permanent: true, Code: smtp.C504ParamNotImpl, Secode: smtp.SeProto5BadParams4})
+
+	// Certificate and password.
+	testAuth(func(user, pass string, cs *tls.ConnectionState) sasl.Client {
+		return sasl.NewClientSCRAMSHA256PLUS(user, pass, *cs)
+	}, "mjl@mox.example", password0, nil)
+	testAuth(func(user, pass string, cs *tls.ConnectionState) sasl.Client {
+		return sasl.NewClientSCRAMSHA256PLUS(user, pass, *cs)
+	}, "mjl@mox.example", password0+"bad", &smtpclient.Error{Code: smtp.C535AuthBadCreds, Secode: smtp.SePol7AuthBadCreds8})
+}
+
+// Test configurable behaviour of VRFY and EXPN.
+func TestVRFYEXPN(t *testing.T) {
+	ts := newTestServer(t, filepath.FromSlash("../testdata/smtp/mox.conf"), dns.MockResolver{})
+	defer ts.close()
+	ts.tlsmode = smtpclient.TLSSkip
+
+	orig := mox.Conf.Static.Listeners["test"]
+	defer func() {
+		mox.Conf.Static.Listeners["test"] = orig
+	}()
+	setVRFYEXPN := func(ve *config.VRFYEXPN) {
+		l := orig
+		l.VRFYEXPN = ve
+		mox.Conf.Static.Listeners["test"] = l
+	}
+
+	// Run commands, checking the response lines.
+	test := func(cmds ...string) {
+		t.Helper()
+		ts.run(func(client *smtpclient.Client) {
+			t.Helper()
+			conn, err := client.Conn()
+			tcheck(t, err, "get conn")
+			br := bufio.NewReader(conn)
+			for i := 0; i < len(cmds); i += 2 {
+				_, err := fmt.Fprintf(conn, "%s\r\n", cmds[i])
+				tcheck(t, err, "write command")
+				var lines []string
+				for {
+					line, err := br.ReadString('\n')
+					tcheck(t, err, "read response")
+					line = strings.TrimRight(line, "\r\n")
+					lines = append(lines, line)
+					if len(line) < 4 || line[3] != '-' {
+						break
+					}
+				}
+				if got := strings.Join(lines, "\n"); !strings.HasPrefix(got, cmds[i+1]) {
+					t.Fatalf("command %q: got response %q, expected prefix %q", cmds[i], got, cmds[i+1])
+				}
+			}
+		})
+	}
+
+	// Default, no verification.
+	test("VRFY mjl@mox.example", "252 2.7.0 no verify but will try delivery",
+		"EXPN public@mox.example", "252 2.7.0 no expand but will try delivery")
+
+	setVRFYEXPN(&config.VRFYEXPN{Mode: "252"})
+	test("VRFY <mjl@mox.example>", "252 2.7.0 no verify but will try delivery")
+
+	setVRFYEXPN(&config.VRFYEXPN{Mode: "disabled"})
+	test("VRFY mjl@mox.example", "502 5.5.1 command disabled",
+		"EXPN public@mox.example", "502 5.5.1 command disabled")
+
+	// Accurate, but not for unauthenticated clients outside the internal networks.
+	setVRFYEXPN(&config.VRFYEXPN{Mode: "accurate"})
+	test("VRFY mjl@mox.example", "252 2.7.0 no verify but will try delivery")
+
+	// Test connections come from 127.0.0.10.
+	_, ipnet, err := net.ParseCIDR("127.0.0.0/8")
+	tcheck(t, err, "parse cidr")
+	setVRFYEXPN(&config.VRFYEXPN{Mode: "accurate", ParsedNetworks: []net.IPNet{*ipnet}})
+	test("VRFY mjl@mox.example", "250 2.1.5 <mjl@mox.example>",
+		"VRFY <mjl@mox.example>", "250 2.1.5 <mjl@mox.example>",
+		"VRFY mjl", "252 2.7.0 no verify but will try delivery",
+		"VRFY bogus@mox.example", "550 5.1.1 no such user",
+		"VRFY blocked@mox.example", "550 5.1.1 no more messages",
+		"VRFY mjl@disabled.example", "450 4.2.1 recipient domain temporarily disabled",
+		"VRFY remote@example.org", "551 5.1.1 not a local address",
+		"VRFY public@mox.example", "250 2.1.5 <public@mox.example>",
+		"EXPN mjl@mox.example", "550 5.1.0 not a mailing list",
+		"EXPN private@mox.example", "250-2.1.5 <mjl@mox.example>\n250 2.1.5 <móx@mox.example>",
+	)
+
+	// Authenticated clients can only expand aliases with ListMembers.
+	ts.submission = true
+	ts.user = "mjl@mox.example"
+	ts.pass = password0
+	setVRFYEXPN(&config.VRFYEXPN{Mode: "accurate"})
+	test("VRFY mjl@mox.example", "250 2.1.5 <mjl@mox.example>",
+		"VRFY remote@example.org", "252 2.7.0 not a local address but will try delivery",
+		"EXPN private@mox.example", "252 2.7.0 no expand but will try delivery",
+	)
+}
+
+// Test delivery to wildcard addresses for subdomains.
+func TestDeliveryWildcard(t *testing.T) {
+	resolver := dns.MockResolver{
+		A: map[string][]string{
+			"example.org.": {"127.0.0.10"}, // For mx check.
+		},
+		PTR: map[string][]string{
+			"127.0.0.10": {"example.org."}, // For iprev check.
+		},
+	}
+	ts := newTestServer(t, filepath.FromSlash("../testdata/smtp/mox.conf"), resolver)
+	defer ts.close()
+
+	deliver := func(rcptTo string, expErr *smtpclient.Error) {
+		t.Helper()
+		ts.run(func(client *smtpclient.Client) {
+			mailFrom := "remote@example.org"
+			msg := strings.ReplaceAll(deliverMessage, "mjl@mox.example", rcptTo)
+			err := client.Deliver(ctxbg, mailFrom, rcptTo, int64(len(msg)), strings.NewReader(msg), false, true, false)
+			ts.smtpErr(err, expErr)
+		})
+	}
+
+	// Localpart wildcard, for any subdomain depth.
+	deliver("mjl@tag.mox2.example", nil)
+	deliver("MJL@a.b.mox2.example", nil)
+	ts.checkCount("Inbox", 2)
+
+	// Other localparts go to the catchall wildcard of another account.
+	deliver("other@tag.mox2.example", nil)
+	ts.checkCount("Inbox", 2)
+
+	// No wildcard for the parent domain itself, or for subdomains of other domains.
+	deliver("other@mox2.example", &smtpclient.Error{Permanent: true, Code: smtp.C550MailboxUnavail, Secode: smtp.SeAddr1UnknownDestMailbox1})
+	deliver("mjl@tag.mox.example", &smtpclient.Error{Permanent: true, Code: smtp.C550MailboxUnavail, Secode: smtp.SeAddr1UnknownDestMailbox1})
+
+	accountName, _, canonical, _, err := mox.LookupAddress("other", dns.Domain{ASCII: "tag.mox2.example"}, false, false, false)
+	tcheck(t, err, "lookup address")
+	tcompare(t, accountName, "☺")
+	tcompare(t, canonical, "@*.mox2.example")
+}
+
+// Test sieve script evaluation during delivery.
+func TestSieve(t *testing.T) {
+	resolver := dns.MockResolver{
+		A: map[string][]string{
+			"example.org.": {"127.0.0.10"}, // For mx check.
+		},
+		PTR: map[string][]string{
+			"127.0.0.10": {"example.org."}, // For iprev check.
+		},
+	}
+	ts := newTestServer(t, filepath.FromSlash("../testdata/smtp/mox.conf"), resolver)
+	defer ts.close()
+
+	deliver := func(msg string) {
+		t.Helper()
+		ts.run(func(client *smtpclient.Client) {
+			mailFrom := "remote@example.org"
+			rcptTo := "mjl@mox.example"
+			err := client.Deliver(ctxbg, mailFrom, rcptTo, int64(len(msg)), strings.NewReader(msg), false, true, false)
+			ts.smtpErr(err, nil)
+		})
+	}
+	queued := func(exp int) []queue.Msg {
+		t.Helper()
+		msgs, err := queue.List(ctxbg, queue.Filter{}, queue.Sort{})
+		tcheck(t, err, "listing queue")
+		tcompare(t, len(msgs), exp)
+		return msgs
+	}
+
+	err := ts.acc.SieveScriptSave(ctxbg, "test", "unknown;", true)
+	if !errors.Is(err, store.ErrSieveScript) {
+		t.Fatalf("saving invalid script, got err %v, expected ErrSieveScript", err)
+	}
+
+	// Fileinto with keep, and a vacation response, sent once.
+	err = ts.acc.SieveScriptSave(ctxbg, "test", `require ["fileinto", "vacation"]; if header :is "subject" "test" { fileinto "Lists"; keep; } vacation :subject "away" "Back next week.";`, true)
+	tcheck(t, err, "save sieve script")
+	deliver(deliverMessage)
+	ts.checkCount("Inbox", 1)
+	ts.checkCount("Lists", 1)
+	msgs := queued(1)
+	tcompare(t, msgs[0].Sender().IsZero(), true)
+	tcompare(t, msgs[0].Recipient().String(), "remote@example.org")
+	tcompare(t, msgs[0].Subject, "away")
+	deliver(deliverMessage2)
+	ts.checkCount("Inbox", 2)
+	queued(1)
+
+	// Discard and redirect, with an SRS address at the recipient domain as sender of
+	// the redirected message.
+	err = ts.acc.SieveScriptSave(ctxbg, "other", `redirect "other@example.org";`, true)
+	tcheck(t, err, "save sieve script")
+	deliver(deliverMessage)
+	ts.checkCount("Inbox", 2)
+	msgs = queued(2) // Most recent first.
+	tcompare(t, srs.IsSRS(msgs[0].SenderLocalpart), true)
+	tcompare(t, msgs[0].SenderDomain.Domain.ASCII, "mox.example")
+	tcompare(t, msgs[0].Recipient().String(), "other@example.org")
+
+	// Reject based on the message body, refused in the SMTP transaction.
+	err = ts.acc.SieveScriptSave(ctxbg, "other", `require ["reject", "body"]; if body :contains "unique" { reject "Not interested."; }`, true)
+	tcheck(t, err, "save sieve script")
+	deliver(deliverMessage)
+	ts.checkCount("Inbox", 3)
+	ts.run(func(client *smtpclient.Client) {
+		msg := deliverMessage2
+		err := client.Deliver(ctxbg, "remote@example.org", "mjl@mox.example", int64(len(msg)), strings.NewReader(msg), false, true, false)
+		ts.smtpErr(err, &smtpclient.Error{Permanent: true, Code: smtp.C550MailboxUnavail, Secode: smtp.SePol7DeliveryUnauth1})
+	})
+	ts.checkCount("Inbox", 3)
+}
+
+// Test out-of-office responses of a vacation during delivery.
+func TestVacation(t *testing.T) {
+	resolver := dns.MockResolver{
+		A: map[string][]string{
+			"example.org.": {"127.0.0.10"}, // For mx check.
+		},
+		PTR: map[string][]string{
+			"127.0.0.10": {"example.org."}, // For iprev check.
+		},
+	}
+	ts := newTestServer(t, filepath.FromSlash("../testdata/smtp/mox.conf"), resolver)
+	defer ts.close()
+
+	deliver := func(msg string) {
+		t.Helper()
+		ts.run(func(client *smtpclient.Client) {
+			mailFrom := "remote@example.org"
+			rcptTo := "mjl@mox.example"
+			err := client.Deliver(ctxbg, mailFrom, rcptTo, int64(len(msg)), strings.NewReader(msg), false, true, false)
+			ts.smtpErr(err, nil)
+		})
+	}
+	queued := func(exp int) []queue.Msg {
+		t.Helper()
+		msgs, err := queue.List(ctxbg, queue.Filter{}, queue.Sort{})
+		tcheck(t, err, "listing queue")
+		tcompare(t, len(msgs), exp)
+		return msgs
+	}
+
+	v := store.Vacation{Address: "mjl@mox.example", Enabled: true, Subject: "out of office", Body: "Back next week."}
+	err := ts.acc.VacationSave(ctxbg, v)
+	tcheck(t, err, "save vacation")
+
+	// No response for bulk messages.
+	deliver("Precedence: bulk\r\n" + deliverMessage)
+	ts.checkCount("Inbox", 1)
+	queued(0)
+
+	// Response is sent once per correspondent.
+	deliver(deliverMessage2)
+	ts.checkCount("Inbox", 2)
+	msgs := queued(1)
+	tcompare(t, msgs[0].Sender().IsZero(), true)
+	tcompare(t, msgs[0].Recipient().String(), "remote@example.org")
+	tcompare(t, msgs[0].Subject, "out of office")
+	deliver(deliverMessage)
+	queued(1)
+
+	// Not active after the end time.
+	end := time.Now().Add(-time.Minute)
+	v.End = &end
+	err = ts.acc.VacationSave(ctxbg, v)
+	tcheck(t, err, "save vacation")
+	deliver(deliverMessage)
+	ts.checkCount("Inbox", 4)
+	queued(1)
+}
+
+// Test messages with a Message-ID that was recently delivered are marked as
+// duplicate, or not stored.
+func TestDuplicateWindow(t *testing.T) {
+	resolver := dns.MockResolver{
+		A: map[string][]string{
+			"example.org.": {"127.0.0.10"}, // For mx check.
+		},
+		PTR: map[string][]string{
+			"127.0.0.10": {"example.org."}, // For iprev check.
+		},
+	}
+	ts := newTestServer(t, filepath.FromSlash("../testdata/smtp/mox.conf"), resolver)
+	defer ts.close()
+
+	deliver := func(msg string) {
+		t.Helper()
+		ts.run(func(client *smtpclient.Client) {
+			mailFrom := "remote@example.org"
+			rcptTo := "mjl@mox.example"
+			err := client.Deliver(ctxbg, mailFrom, rcptTo, int64(len(msg)), strings.NewReader(msg), false, true, false)
+			ts.smtpErr(err, nil)
+		})
+	}
+	duplicates := func(exp int) {
+		t.Helper()
+		q := bstore.QueryDB[store.Message](ctxbg, ts.acc.DB)
+		q.FilterIn("Keywords", "$duplicate")
+		n, err := q.Count()
+		tcheck(t, err, "count duplicates")
+		tcompare(t, n, exp)
+	}
+
+	// Without configuration, no duplicate detection.
+	deliver(deliverMessage)
+	deliver(deliverMessage)
+	ts.checkCount("Inbox", 2)
+	duplicates(0)
+
+	acc := mox.Conf.Dynamic.Accounts["mjl"]
+	acc.DuplicateWindow = &config.DuplicateWindow{Period: time.Hour}
+	mox.Conf.Dynamic.Accounts["mjl"] = acc
+
+	deliver(deliverMessage)
+	ts.checkCount("Inbox", 3)
+	duplicates(1)
+	deliver(deliverMessage2) // Different Message-ID.
+	ts.checkCount("Inbox", 4)
+	duplicates(1)
+
+	// Destination overrides account, with suppressing duplicates.
+	ad := mox.Conf.AccountDestinationsLocked["mjl@mox.example"]
+	ad.Destination.DuplicateWindow = &config.DuplicateWindow{Period: time.Hour, Suppress: true}
+	mox.Conf.AccountDestinationsLocked["mjl@mox.example"] = ad
+	deliver(deliverMessage2)
+	ts.checkCount("Inbox", 4)
+}
+
+// Test actions of a matching ruleset: marking as read, adding keywords,
+// forwarding and discarding.
+func TestRulesetActions(t *testing.T) {
+	resolver := dns.MockResolver{
+		A: map[string][]string{
+			"example.org.": {"127.0.0.10"}, // For mx check.
+		},
+		PTR: map[string][]string{
+			"127.0.0.10": {"example.org."}, // For iprev check.
+		},
+	}
+	ts := newTestServer(t, filepath.FromSlash("../testdata/smtp/mox.conf"), resolver)
+	defer ts.close()
+
+	deliver := func(msg string) {
+		t.Helper()
+		ts.run(func(client *smtpclient.Client) {
+			err := client.Deliver(ctxbg, "remote@example.org", "mjl@mox.example", int64(len(msg)), strings.NewReader(msg), false, true, false)
+			ts.smtpErr(err, nil)
+		})
+	}
+	setRuleset := func(rs config.Ruleset) {
+		rs.MsgToRegexpCompiled = regexp.MustCompile(`^mjl@mox\.example$`)
+		ad := mox.Conf.AccountDestinationsLocked["mjl@mox.example"]
+		ad.Destination.Rulesets = []config.Ruleset{rs}
+		mox.Conf.AccountDestinationsLocked["mjl@mox.example"] = ad
+	}
+
+	setRuleset(config.Ruleset{Mailbox: "Lists", Seen: true, Keywords: []string{"newsletter"}})
+	deliver(deliverMessage)
+	ts.checkCount("Lists", 1)
+	m, err := bstore.QueryDB[store.Message](ctxbg, ts.acc.DB).SortDesc("ID").Limit(1).Get()
+	tcheck(t, err, "get delivered message")
+	tcompare(t, m.Seen, true)
+	tcompare(t, m.Keywords, []string{"newsletter"})
+
+	// Forward and discard, with an SRS address at the recipient domain as sender of
+	// the forwarded message.
+	setRuleset(config.Ruleset{ForwardTo: []string{"other@example.org"}, Discard: true})
+	deliver(deliverMessage2)
+	ts.checkCount("Lists", 1)
+	ts.checkCount("Inbox", 0)
+	msgs, err := queue.List(ctxbg, queue.Filter{}, queue.Sort{})
+	tcheck(t, err, "listing queue")
+	tcompare(t, len(msgs), 1)
+	tcompare(t, srs.IsSRS(msgs[0].SenderLocalpart), true)
+	tcompare(t, msgs[0].SenderDomain.Domain.ASCII, "mox.example")
+	tcompare(t, msgs[0].Recipient().String(), "other@example.org")
+}
+
+// Test header fields and subject prefix configured for a domain, and exemption
+// for internal senders.
+func TestInboundHeaders(t *testing.T) {
+	resolver := dns.MockResolver{
+		A: map[string][]string{
+			"example.org.": {"127.0.0.10"}, // For mx check.
+		},
+		PTR: map[string][]string{
+			"127.0.0.10": {"example.org."}, // For iprev check.
+		},
+		TXT: map[string][]string{
+			"example.org.":        {"v=spf1 ip4:127.0.0.10 -all"},
+			"_dmarc.example.org.": {"v=DMARC1;p=reject"},
+		},
+	}
+	ts := newTestServer(t, filepath.FromSlash("../testdata/smtp/mox.conf"), resolver)
+	defer ts.close()
+
+	deliver := func(msg string) string {
+		t.Helper()
+		ts.run(func(client *smtpclient.Client) {
+			err := client.Deliver(ctxbg, "remote@example.org", "mjl@mox.example", int64(len(msg)), strings.NewReader(msg), false, true, false)
+			ts.smtpErr(err, nil)
+		})
+		m, err := bstore.QueryDB[store.Message](ctxbg, ts.acc.DB).SortDesc("ID").Limit(1).Get()
+		tcheck(t, err, "get delivered message")
+		buf, err := io.ReadAll(ts.acc.MessageReader(m))
+		tcheck(t, err, "read message")
+		tcompare(t, int64(len(buf)), m.Size)
+		return string(buf)
+	}
+	check := func(data, s string, expect bool) {
+		t.Helper()
+		if strings.Contains(data, s) != expect {
+			t.Fatalf("message contains %q: %v, expected %v:\n%s", s, !expect, expect, data)
+		}
+	}
+
+	dom := mox.Conf.Dynamic.Domains["mox.example"]
+	dom.InboundHeaders = &config.InboundHeaders{
+		SubjectPrefix: "[EXTERNAL] ",
+		Headers:       map[string]string{"X-External": "Message from outside the organization."},
+	}
+	mox.Conf.Dynamic.Domains["mox.example"] = dom
+
+	data := deliver(deliverMessage)
+	check(data, "\r\nSubject: [EXTERNAL] test\r\n", true)
+	check(data, "X-External: Message from outside the organization.\r\n", true)
+	check(data, "\r\n\r\ntest email\r\n", true)
+
+	// Prefix is not added again.
+	data = deliver(strings.Replace(deliverMessage2, "Subject: test", "Subject: [EXTERNAL] test", 1))
+	check(data, "Subject: [EXTERNAL] [EXTERNAL]", false)
+	check(data, "\r\nSubject: [EXTERNAL] test\r\n", true)
+
+	// Message without subject gets one, non-ASCII prefix is encoded.
+	dom.InboundHeaders.SubjectPrefix = "[EXTÉRN] "
+	data = deliver(strings.Replace(deliverMessage, "Subject: test\r\n", "", 1))
+	check(data, "\r\nSubject: =?utf-8?q?[EXT=C3=89RN]?=\r\n", true)
+
+	// Internal sender with verified From address is exempt.
+	dom.InboundHeaders.InternalDomains = []string{"example.org"}
+	dom.InboundHeaders.ParsedInternalDomains = []dns.Domain{{ASCII: "example.org"}}
+	data = deliver(deliverMessage)
+	check(data, "[EXT", false)
+	check(data, "X-External", false)
+}
+
+// Test messages from a lookalike of a hosted domain are rejected or treated
+// strictly as junk, depending on domain config.
+func TestLookalikeSenders(t *testing.T) {
+	resolver := dns.MockResolver{
+		A: map[string][]string{
+			"rnox.example.": {"127.0.0.10"}, // For mx check.
+			"example.org.":  {"127.0.0.10"},
+		},
+		PTR: map[string][]string{
+			"127.0.0.10": {"rnox.example."}, // For iprev check.
+		},
+	}
+	ts := newTestServer(t, filepath.FromSlash("../testdata/smtp/mox.conf"), resolver)
+	defer ts.close()
+
+	msg := strings.ReplaceAll(deliverMessage, "remote@example.org", "remote@rnox.example")
+	deliver := func(mailFrom, msg string, expErr *smtpclient.Error) {
+		t.Helper()
+		ts.run(func(client *smtpclient.Client) {
+			err := client.Deliver(ctxbg, mailFrom, "mjl@mox.example", int64(len(msg)), strings.NewReader(msg), false, true, false)
+			ts.smtpErr(err, expErr)
+		})
+	}
+
+	// Without configuration, lookalikes are delivered.
+	deliver("remote@rnox.example", msg, nil)
+	ts.checkCount("Inbox", 1)
+
+	dom := mox.Conf.Dynamic.Domains["mox.example"]
+	dom.LookalikeSenders = "reject"
+	mox.Conf.Dynamic.Domains["mox.example"] = dom
+
+	deliver("remote@rnox.example", msg, &smtpclient.Error{Permanent: true, Code: smtp.C550MailboxUnavail, Secode: smtp.SePol7Other0})
+	// Lookalike in SMTP MAIL FROM only.
+	deliver("remote@rnox.example", deliverMessage, &smtpclient.Error{Permanent: true, Code: smtp.C550MailboxUnavail, Secode: smtp.SePol7Other0})
+	// Other domains are not affected.
+	deliver("remote@example.org", deliverMessage, nil)
+	ts.checkCount("Inbox", 2)
+
+	// With "junk", the junk filter without significant signal no longer accepts the message.
+	dom.LookalikeSenders = "junk"
+	mox.Conf.Dynamic.Domains["mox.example"] = dom
+	deliver("remote@rnox.example", msg, &smtpclient.Error{Code: smtp.C451LocalErr, Secode: smtp.SeSys3Other0})
+	ts.checkCount("Inbox", 2)
+}
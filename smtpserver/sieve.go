@@ -0,0 +1,417 @@
+package smtpserver
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/mjl-/mox/message"
+	"github.com/mjl-/mox/metrics"
+	"github.com/mjl-/mox/mlog"
+	"github.com/mjl-/mox/mox-"
+	"github.com/mjl-/mox/moxvar"
+	"github.com/mjl-/mox/queue"
+	"github.com/mjl-/mox/sieve"
+	"github.com/mjl-/mox/smtp"
+	"github.com/mjl-/mox/store"
+)
+
+func init() {
+	sieve.Register("mailto", mailtoNotifier{})
+	sieve.HTTPNotifyPolicy = func() sieve.HTTPPolicy {
+		sn := mox.Conf.Static.SieveNotifyHTTP
+		if sn == nil {
+			return sieve.HTTPPolicy{}
+		}
+		return sieve.HTTPPolicy{Hosts: sn.Hosts, AllowPrivateIPs: sn.AllowPrivateIPs}
+	}
+}
+
+// sieveEval evaluates the active sieve script of the account for the delivery.
+// Returns nil if the account has no active script. On errors, the result
+// delivers to the default mailbox.
+func sieveEval(ctx context.Context, log mlog.Log, d delivery) *sieve.Result {
+	ss, err := d.acc.SieveScriptActive(ctx)
+	if err != nil {
+		log.Errorx("looking up active sieve script, continuing without", err)
+		return nil
+	} else if ss == nil {
+		return nil
+	}
+	script, err := sieve.Parse(ss.Script)
+	if err != nil {
+		log.Errorx("parsing sieve script, continuing without", err, slog.String("script", ss.Name))
+		return nil
+	}
+	sm := sieve.Message{
+		EnvelopeFrom: d.m.MailFrom,
+		EnvelopeTo:   d.deliverTo.String(),
+		Header:       d.msgHeader,
+		Size:         d.m.Size,
+	}
+	if script.Requires("body") {
+		p, err := message.Parse(log.Logger, false, d.dataFile)
+		if err == nil {
+			err = p.Walk(log.Logger, nil)
+		}
+		if err != nil {
+			log.Debugx("parsing message for sieve body tests, continuing without body", err)
+		} else {
+			sm.Part = &p
+		}
+	}
+	r, err := script.Eval(sm)
+	if err != nil {
+		log.Infox("evaluating sieve script, delivering to default mailbox", err, slog.String("script", ss.Name))
+	}
+	log.Debug("sieve script evaluated",
+		slog.Bool("keep", r.Keep),
+		slog.Any("fileinto", r.FileInto),
+		slog.Any("redirect", r.Redirect),
+		slog.Bool("vacation", r.Vacation != nil),
+		slog.Int("notify", len(r.Notify)),
+		slog.Bool("reject", r.Reject))
+	return &r
+}
+
+// sieveRejectMessage returns the reason of a sieve reject action, for use in an
+// SMTP response or DSN: A single line of limited length.
+func sieveRejectMessage(reason string) string {
+	reason = strings.Join(strings.Fields(reason), " ")
+	if reason == "" {
+		return "message rejected by recipient"
+	}
+	if len(reason) > 200 {
+		reason = reason[:200] + "..."
+	}
+	return "message rejected by recipient: " + reason
+}
+
+// sieveMailboxes returns the mailboxes to deliver to according to the sieve
+// result. Can be empty, e.g. for discard or redirect.
+func sieveMailboxes(r *sieve.Result, defaultMailbox string) []string {
+	var l []string
+	if r.Keep {
+		l = append(l, defaultMailbox)
+	}
+	for _, mb := range r.FileInto {
+		if strings.EqualFold(mb, "inbox") {
+			mb = "Inbox"
+		}
+		if mb != defaultMailbox {
+			l = append(l, mb)
+		}
+	}
+	return l
+}
+
+// isAutomatic returns whether a message with headers should not get an
+// automatic response, because it is an automatic message itself or comes from a
+// mailing list.
+func isAutomatic(d delivery) bool {
+	h := d.msgHeader
+	if v := strings.TrimSpace(h.Get("Auto-Submitted")); v != "" && !strings.EqualFold(v, "no") {
+		return true
+	}
+	switch strings.ToLower(strings.TrimSpace(h.Get("Precedence"))) {
+	case "bulk", "list", "junk":
+		return true
+	}
+	for _, k := range []string{"List-Id", "List-Unsubscribe", "List-Post", "X-Auto-Response-Suppress"} {
+		if h.Get(k) != "" {
+			return true
+		}
+	}
+	return d.m.IsMailingList || d.m.DSN
+}
+
+// sieveActions sends the vacation response and notifications of the sieve
+// result for a delivered message. Vacation responses are queued immediately,
+// notifications are sent in the background.
+func sieveActions(log mlog.Log, d delivery, r *sieve.Result, msgFrom smtp.Address, subject string) {
+	if r.Vacation == nil && len(r.Notify) == 0 || d.m.Junk {
+		return
+	}
+
+	automatic := isAutomatic(d)
+
+	if v := r.Vacation; v != nil {
+		references := strings.Fields(d.msgHeader.Get("References"))
+		msgID := strings.TrimSpace(d.msgHeader.Get("Message-Id"))
+		if msgID != "" {
+			references = append(references, msgID)
+		}
+		var toAddrs []string
+		for _, a := range append(append([]message.Address{}, d.msgTo...), d.msgCc...) {
+			toAddrs = append(toAddrs, strings.ToLower(a.User+"@"+a.Host))
+		}
+		ctx, cancel := context.WithTimeout(mox.Shutdown, time.Minute)
+		defer cancel()
+		err := sieveVacation(ctx, log, d.acc, *v, d.deliverTo, d.m.MailFrom, toAddrs, automatic, subject, msgID, references)
+		log.Check(err, "sending sieve vacation response")
+	}
+
+	if len(r.Notify) == 0 {
+		return
+	}
+	var from string
+	if !msgFrom.IsZero() {
+		from = msgFrom.String()
+	}
+	accName := d.acc.Name
+	rcpt := d.deliverTo.String()
+	go func() {
+		defer func() {
+			x := recover()
+			if x != nil {
+				log.Error("unhandled panic in sieve notify", slog.Any("err", x))
+				debug.PrintStack()
+				metrics.PanicInc(metrics.Smtpserver)
+			}
+		}()
+
+		ctx, cancel := context.WithTimeout(mox.Shutdown, time.Minute)
+		defer cancel()
+
+		for _, n := range r.Notify {
+			// Don't send notifications about notifications through email.
+			if strings.HasPrefix(strings.ToLower(n.Method), "mailto:") && automatic {
+				log.Debug("not sending mailto notification for automatic message")
+				continue
+			}
+			nn := sieve.Notification{
+				Notify:    n,
+				Account:   accName,
+				Recipient: rcpt,
+				MsgFrom:   from,
+				Subject:   subject,
+			}
+			err := sieve.Send(ctx, log, nn)
+			log.Check(err, "sending sieve notification", slog.String("method", n.Method))
+		}
+	}()
+}
+
+// sieveVacation sends a vacation response, if allowed and not sent recently.
+func sieveVacation(ctx context.Context, log mlog.Log, acc *store.Account, v sieve.Vacation, rcpt smtp.Path, mailFrom string, toAddrs []string, automatic bool, subject, inReplyTo string, references []string) error {
+	// Responses go to the SMTP MAIL FROM, not to the message From header.
+	if mailFrom == "" || automatic {
+		log.Debug("not sending vacation response to null sender or for automatic message")
+		return nil
+	}
+	sender, err := smtp.ParseAddress(mailFrom)
+	if err != nil {
+		return fmt.Errorf("parsing mail from address: %v", err)
+	}
+	lp := strings.ToLower(sender.Localpart.String())
+	if lp == "mailer-daemon" || lp == "listserv" || lp == "majordomo" || strings.HasPrefix(lp, "owner-") || strings.HasSuffix(lp, "-request") {
+		log.Debug("not sending vacation response to automated sender")
+		return nil
+	}
+
+	// Only respond if the message was sent to us, not through a list or bcc.
+	own := append([]string{strings.ToLower(rcpt.String())}, v.Addresses...)
+	var addressed bool
+	for _, a := range own {
+		a = strings.ToLower(a)
+		if a == strings.ToLower(mailFrom) {
+			log.Debug("not sending vacation response to own address")
+			return nil
+		}
+		for _, t := range toAddrs {
+			addressed = addressed || t == a
+		}
+	}
+	if !addressed {
+		log.Debug("not sending vacation response, recipient address not in to/cc")
+		return nil
+	}
+
+	handle := v.Handle
+	if handle == "" {
+		h := sha256.Sum256([]byte(fmt.Sprintf("%s\n%s\n%v\n%s", v.Subject, v.From, v.MIME, v.Reason)))
+		handle = base64.RawURLEncoding.EncodeToString(h[:12])
+	}
+	if send, err := acc.VacationResponseNeeded(ctx, handle, mailFrom, v.Days); err != nil {
+		return fmt.Errorf("checking previous vacation responses: %v", err)
+	} else if !send {
+		log.Debug("vacation response recently sent, not sending again")
+		return nil
+	}
+
+	from := smtp.NewAddress(rcpt.Localpart, rcpt.IPDomain.Domain)
+	if v.From != "" {
+		from, err = smtp.ParseAddress(v.From)
+		if err != nil {
+			return fmt.Errorf("parsing vacation from address: %v", err)
+		}
+	}
+	respSubject := v.Subject
+	if respSubject == "" {
+		respSubject = "Auto: " + subject
+	}
+	err = sieveQueueMessage(ctx, log, acc.Name, from, []smtp.Address{sender}, respSubject, v.Reason, v.MIME, inReplyTo, references, "auto-replied")
+	if err == nil {
+		log.Info("sieve vacation response queued", slog.Any("to", sender))
+	}
+	return err
+}
+
+// mailtoNotifier sends notifications as email message, for "mailto:" methods.
+type mailtoNotifier struct{}
+
+// mailtoAddresses returns the addresses in a mailto URI, and the optional subject
+// and body.
+func mailtoAddresses(u *url.URL) (addrs []smtp.Address, subject, body string, rerr error) {
+	s, err := url.PathUnescape(u.Opaque)
+	if err != nil {
+		return nil, "", "", fmt.Errorf("unescape addresses: %v", err)
+	}
+	for _, t := range strings.Split(s, ",") {
+		if t == "" {
+			continue
+		}
+		addr, err := smtp.ParseAddress(t)
+		if err != nil {
+			return nil, "", "", fmt.Errorf("parsing address %q: %v", t, err)
+		}
+		addrs = append(addrs, addr)
+	}
+	q := u.Query()
+	for _, t := range q["to"] {
+		addr, err := smtp.ParseAddress(t)
+		if err != nil {
+			return nil, "", "", fmt.Errorf("parsing address %q: %v", t, err)
+		}
+		addrs = append(addrs, addr)
+	}
+	if len(addrs) == 0 {
+		return nil, "", "", errors.New("missing address")
+	}
+	return addrs, q.Get("subject"), q.Get("body"), nil
+}
+
+func (mailtoNotifier) Check(u *url.URL) error {
+	_, _, _, err := mailtoAddresses(u)
+	return err
+}
+
+func (mailtoNotifier) Send(ctx context.Context, log mlog.Log, u *url.URL, n sieve.Notification) error {
+	addrs, subject, body, err := mailtoAddresses(u)
+	if err != nil {
+		return err
+	}
+	var from smtp.Address
+	if n.From != "" {
+		from, err = smtp.ParseAddress(n.From)
+	} else {
+		from, err = smtp.ParseAddress(n.Recipient)
+	}
+	if err != nil {
+		return fmt.Errorf("parsing from address for notification: %v", err)
+	}
+	text := n.Text()
+	if subject == "" {
+		subject = text
+	}
+	if body == "" {
+		body = text
+	}
+	return sieveQueueMessage(ctx, log, n.Account, from, addrs, subject, body, false, "", nil, "auto-notified")
+}
+
+// sieveQueueMessage composes a vacation response or notification message and
+// queues it for delivery with a null reverse path, so failures don't cause
+// responses.
+func sieveQueueMessage(ctx context.Context, log mlog.Log, account string, from smtp.Address, to []smtp.Address, subject, text string, mimeEntity bool, inReplyTo string, references []string, autoSubmitted string) (rerr error) {
+	smtputf8 := from.Localpart.IsInternational()
+	for _, a := range to {
+		smtputf8 = smtputf8 || a.Localpart.IsInternational()
+	}
+
+	var msgBuf bytes.Buffer
+	xc := message.NewComposer(&msgBuf, 1024*1024, smtputf8)
+	defer func() {
+		x := recover()
+		if x == nil {
+			return
+		}
+		if err, ok := x.(error); ok && errors.Is(err, message.ErrCompose) {
+			rerr = err
+			return
+		}
+		panic(x)
+	}()
+
+	xc.HeaderAddrs("From", []message.NameAddress{{Address: from}})
+	var tol []message.NameAddress
+	for _, a := range to {
+		tol = append(tol, message.NameAddress{Address: a})
+	}
+	xc.HeaderAddrs("To", tol)
+	xc.Subject(subject)
+	messageID := fmt.Sprintf("<%s>", mox.MessageIDGen(smtputf8))
+	xc.Header("Message-Id", messageID)
+	if inReplyTo != "" {
+		xc.Header("In-Reply-To", inReplyTo)
+	}
+	if len(references) > 0 {
+		xc.Header("References", strings.Join(references, "\r\n\t"))
+	}
+	xc.Header("Date", time.Now().Format(message.RFC5322Z))
+	xc.Header("Auto-Submitted", autoSubmitted)
+	xc.Header("User-Agent", "mox/"+moxvar.Version)
+	xc.Header("MIME-Version", "1.0")
+	has8bit := smtputf8
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	if mimeEntity {
+		// Text is a MIME entity, starting with its headers.
+		if !strings.HasSuffix(text, "\n") {
+			text += "\n"
+		}
+		for _, c := range text {
+			has8bit = has8bit || c >= 0x80
+		}
+		xc.Write([]byte(strings.ReplaceAll(text, "\n", "\r\n")))
+	} else {
+		body, ct, cte := xc.TextPart("plain", text)
+		xc.Header("Content-Type", ct)
+		xc.Header("Content-Transfer-Encoding", cte)
+		xc.Line()
+		xc.Write(body)
+		has8bit = has8bit || cte == "8bit"
+	}
+	xc.Flush()
+
+	msgPrefix, err := mox.DKIMSign(ctx, log, from.Path(), smtputf8, msgBuf.Bytes())
+	if err != nil {
+		log.Errorx("dkim signing sieve message, continuing without signature", err)
+	}
+
+	msgFile, err := store.CreateMessageTemp(log, "sieve-out")
+	if err != nil {
+		return fmt.Errorf("creating temp file: %v", err)
+	}
+	defer store.CloseRemoveTempFile(log, msgFile, "sieve message")
+	if _, err := msgFile.Write(msgBuf.Bytes()); err != nil {
+		return fmt.Errorf("writing message: %v", err)
+	}
+
+	var qml []queue.Msg
+	for _, a := range to {
+		qm := queue.MakeMsg(smtp.Path{}, a.Path(), has8bit, smtputf8, int64(len(msgPrefix)+msgBuf.Len()), messageID, []byte(msgPrefix), nil, time.Now(), subject)
+		qml = append(qml, qm)
+	}
+	if err := queue.Add(ctx, log, account, msgFile, qml...); err != nil {
+		return fmt.Errorf("queueing message: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,165 @@
+// Package srs implements the Sender Rewriting Scheme, for forwarding messages.
+//
+// When forwarding a message, the SMTP MAIL FROM address of the original sender
+// cannot be kept: SPF verification at the next hop would fail because the
+// forwarding server isn't allowed to send for the original domain. The address is
+// rewritten to an address at the domain of the forwarder. The new localpart holds
+// the original address, a timestamp and a hash (an HMAC with a secret key), so
+// bounces sent to the rewritten address can be sent back to the original sender,
+// without turning the forwarder into an open relay.
+//
+// Addresses have the form "SRS0=HHHHHH=TT=domain=localpart@forwarder". When
+// forwarding a message with an SRS0 address from another forwarder, the form
+// "SRS1=HHHHHH=firstforwarder==HHHHHH=TT=domain=localpart@forwarder" is used, so
+// bounces go back through the first forwarder, skipping intermediate forwarders.
+//
+// Rewritten localparts can be longer than the 64 octets allowed by the SMTP
+// specification. Most mail servers accept them.
+package srs
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base32"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/mjl-/mox/dns"
+	"github.com/mjl-/mox/smtp"
+)
+
+var (
+	ErrSyntax  = errors.New("srs: malformed srs address")
+	ErrHash    = errors.New("srs: hash mismatch")
+	ErrExpired = errors.New("srs: address expired")
+)
+
+// MaxAge is how long a rewritten address remains valid for bounces.
+const MaxAge = 21 * 24 * time.Hour
+
+const (
+	hashLength = 6
+	// Timestamps are days since the epoch, modulo 1024, encoded in two base32
+	// characters.
+	timestampBase = 1024
+	day           = 24 * time.Hour
+)
+
+var base32Alphabet = "ABCDEFGHIJKLMNOPQRSTUVWXYZ234567"
+
+// IsSRS returns whether localpart looks like an SRS address.
+func IsSRS(localpart smtp.Localpart) bool {
+	s := strings.ToUpper(string(localpart))
+	return strings.HasPrefix(s, "SRS0=") || strings.HasPrefix(s, "SRS1=")
+}
+
+func hash(key []byte, parts ...string) string {
+	mac := hmac.New(sha256.New, key)
+	for _, p := range parts {
+		mac.Write([]byte(strings.ToLower(p)))
+		mac.Write([]byte{0})
+	}
+	return base32.StdEncoding.EncodeToString(mac.Sum(nil))[:hashLength]
+}
+
+func timestamp(now time.Time) string {
+	t := (now.Unix() / int64(day/time.Second)) % timestampBase
+	return string([]byte{base32Alphabet[t>>5], base32Alphabet[t&31]})
+}
+
+// checkTimestamp checks the encoded timestamp is not older than MaxAge.
+func checkTimestamp(s string, now time.Time) error {
+	if len(s) != 2 {
+		return ErrSyntax
+	}
+	s = strings.ToUpper(s)
+	hi := strings.IndexByte(base32Alphabet, s[0])
+	lo := strings.IndexByte(base32Alphabet, s[1])
+	if hi < 0 || lo < 0 {
+		return ErrSyntax
+	}
+	today := (now.Unix() / int64(day/time.Second)) % timestampBase
+	age := (today - int64(hi<<5|lo) + timestampBase) % timestampBase
+	if time.Duration(age)*day > MaxAge {
+		return ErrExpired
+	}
+	return nil
+}
+
+// Forward returns the address to use as SMTP MAIL FROM when forwarding a message
+// from "from" through a forwarder at domain.
+//
+// The null reverse path, addresses with an IP address instead of a domain, and
+// addresses at domain itself are returned unchanged.
+func Forward(key []byte, from smtp.Path, domain dns.Domain, now time.Time) smtp.Path {
+	if from.IsZero() || len(from.IPDomain.IP) > 0 || from.IPDomain.Domain == domain {
+		return from
+	}
+
+	lp := string(from.Localpart)
+	var nlp string
+	switch strings.ToUpper(lp[:min(len(lp), 5)]) {
+	case "SRS0=":
+		// Another forwarder rewrote the address, we don't need its timestamp, bounces go
+		// back through that forwarder.
+		orighost := from.IPDomain.Domain.ASCII
+		rest := lp[4:]
+		nlp = "SRS1=" + hash(key, orighost, rest) + "=" + orighost + "=" + rest
+	case "SRS1=":
+		// Already forwarded twice or more, keep pointing to the first forwarder.
+		t := strings.SplitN(lp[5:], "=", 3)
+		if len(t) == 3 && t[1] != "" {
+			nlp = "SRS1=" + hash(key, t[1], t[2]) + "=" + t[1] + "=" + t[2]
+		}
+	}
+	if nlp == "" {
+		ts := timestamp(now)
+		d := from.IPDomain.Domain.ASCII
+		nlp = "SRS0=" + hash(key, ts, d, lp) + "=" + ts + "=" + d + "=" + lp
+	}
+	return smtp.Path{Localpart: smtp.Localpart(nlp), IPDomain: dns.IPDomain{Domain: domain}}
+}
+
+// Reverse returns the address a bounce for an SRS localpart, as generated by
+// Forward, should be sent to. For an SRS0 address, this is the original sender.
+// For an SRS1 address, this is the SRS0 address at the first forwarder.
+func Reverse(key []byte, localpart smtp.Localpart, now time.Time) (smtp.Path, error) {
+	lp := string(localpart)
+	if !IsSRS(localpart) {
+		return smtp.Path{}, ErrSyntax
+	}
+
+	switch strings.ToUpper(lp[:5]) {
+	case "SRS0=":
+		t := strings.SplitN(lp[5:], "=", 4)
+		if len(t) != 4 || t[2] == "" || t[3] == "" {
+			return smtp.Path{}, ErrSyntax
+		}
+		if !hmac.Equal([]byte(strings.ToUpper(t[0])), []byte(hash(key, t[1], t[2], t[3]))) {
+			return smtp.Path{}, ErrHash
+		}
+		if err := checkTimestamp(t[1], now); err != nil {
+			return smtp.Path{}, err
+		}
+		d, err := dns.ParseDomain(t[2])
+		if err != nil {
+			return smtp.Path{}, ErrSyntax
+		}
+		return smtp.Path{Localpart: smtp.Localpart(t[3]), IPDomain: dns.IPDomain{Domain: d}}, nil
+
+	default:
+		t := strings.SplitN(lp[5:], "=", 3)
+		if len(t) != 3 || t[1] == "" || !strings.HasPrefix(t[2], "=") {
+			return smtp.Path{}, ErrSyntax
+		}
+		if !hmac.Equal([]byte(strings.ToUpper(t[0])), []byte(hash(key, t[1], t[2]))) {
+			return smtp.Path{}, ErrHash
+		}
+		d, err := dns.ParseDomain(t[1])
+		if err != nil {
+			return smtp.Path{}, ErrSyntax
+		}
+		return smtp.Path{Localpart: smtp.Localpart("SRS0" + t[2]), IPDomain: dns.IPDomain{Domain: d}}, nil
+	}
+}
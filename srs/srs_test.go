@@ -0,0 +1,79 @@
+package srs
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mjl-/mox/dns"
+	"github.com/mjl-/mox/smtp"
+)
+
+func TestSRS(t *testing.T) {
+	key := []byte("test key")
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	fwd := dns.Domain{ASCII: "forward.example"}
+	fwd2 := dns.Domain{ASCII: "forward2.example"}
+
+	parse := func(s string) smtp.Path {
+		t.Helper()
+		a, err := smtp.ParseAddress(s)
+		if err != nil {
+			t.Fatalf("parse address %q: %v", s, err)
+		}
+		return a.Path()
+	}
+
+	reverse := func(p smtp.Path, now time.Time, exp string, expErr error) {
+		t.Helper()
+		r, err := Reverse(key, p.Localpart, now)
+		if (err == nil) != (expErr == nil) || expErr != nil && !errors.Is(err, expErr) {
+			t.Fatalf("reverse %s: got err %v, expected %v", p.XString(true), err, expErr)
+		}
+		if expErr == nil && r.XString(true) != exp {
+			t.Fatalf("reverse %s: got %s, expected %s", p.XString(true), r.XString(true), exp)
+		}
+	}
+
+	orig := parse("Remote@Remote.example")
+	p := Forward(key, orig, fwd, now)
+	if !strings.HasPrefix(string(p.Localpart), "SRS0=") || !strings.HasSuffix(string(p.Localpart), "=remote.example=Remote") || p.IPDomain.Domain != fwd {
+		t.Fatalf("unexpected srs address %s", p.XString(true))
+	}
+	if !IsSRS(p.Localpart) || IsSRS(orig.Localpart) {
+		t.Fatalf("bad IsSRS")
+	}
+	reverse(p, now, "Remote@remote.example", nil)
+	reverse(p, now.Add(MaxAge), "Remote@remote.example", nil)
+	reverse(p, now.Add(MaxAge+day), "", ErrExpired)
+
+	// Case changes by intermediate systems don't matter.
+	reverse(smtp.Path{Localpart: smtp.Localpart(strings.ToLower(string(p.Localpart)))}, now, "remote@remote.example", nil)
+
+	// Forged addresses are refused.
+	reverse(smtp.Path{Localpart: smtp.Localpart(strings.Replace(string(p.Localpart), "=Remote", "=other", 1))}, now, "", ErrHash)
+	reverse(smtp.Path{Localpart: smtp.Localpart(strings.Replace(string(p.Localpart), "=remote.example=", "=other.example=", 1))}, now, "", ErrHash)
+	reverse(smtp.Path{Localpart: "SRS0=AAAAAA=AA=remote.example"}, now, "", ErrSyntax)
+	reverse(smtp.Path{Localpart: "remote"}, now, "", ErrSyntax)
+
+	// Second forwarder makes an SRS1 address, bounces go to the first forwarder.
+	p2 := Forward(key, p, fwd2, now)
+	if !strings.HasPrefix(string(p2.Localpart), "SRS1=") || !strings.Contains(string(p2.Localpart), "=forward.example==") {
+		t.Fatalf("unexpected srs1 address %s", p2.XString(true))
+	}
+	reverse(p2, now, p.XString(true), nil)
+
+	// Third forwarder still points to the first forwarder.
+	p3 := Forward(key, p2, dns.Domain{ASCII: "forward3.example"}, now)
+	reverse(p3, now, p.XString(true), nil)
+
+	// Null reverse path and addresses at the forwarding domain are not rewritten.
+	if np := Forward(key, smtp.Path{}, fwd, now); !np.IsZero() {
+		t.Fatalf("null reverse path rewritten to %s", np.XString(true))
+	}
+	local := parse("mjl@forward.example")
+	if lp := Forward(key, local, fwd, now); !lp.Equal(local) {
+		t.Fatalf("local address rewritten to %s", lp.XString(true))
+	}
+}
@@ -23,6 +23,7 @@ package store
 
 import (
 	"context"
+	"crypto/ecdh"
 	"crypto/md5"
 	cryptorand "crypto/rand"
 	"crypto/sha1"
@@ -58,6 +59,7 @@ import (
 	"github.com/mjl-/mox/mox-"
 	"github.com/mjl-/mox/moxio"
 	"github.com/mjl-/mox/moxvar"
+	"github.com/mjl-/mox/oauthbearer"
 	"github.com/mjl-/mox/publicsuffix"
 	"github.com/mjl-/mox/scram"
 	"github.com/mjl-/mox/smtp"
@@ -75,6 +77,8 @@ var (
 	ErrAccountUnknown     = errors.New("no such account")
 	ErrOverQuota          = errors.New("account over quota")
 	ErrLoginDisabled      = errors.New("login disabled for account")
+	ErrLoginNetwork       = errors.New("login not allowed from this network for account")
+	ErrMailboxReadOnly    = errors.New("mailbox is read-only")
 )
 
 var DefaultInitialMailboxes = config.InitialMailboxes{
@@ -151,7 +155,12 @@ func (c *CRAMMD5) UnmarshalBinary(buf []byte) error {
 
 // Password holds credentials in various forms, for logging in with SMTP/IMAP.
 type Password struct {
-	Hash        string  // bcrypt hash for IMAP LOGIN, SASL PLAIN and HTTP basic authentication.
+	// bcrypt hash for IMAP LOGIN, SASL PLAIN and HTTP basic authentication. Or a
+	// password hash imported from another system, prefixed with its scheme, e.g.
+	// "{SHA512-CRYPT}$6$...", see ParsePasswordHash. For an imported hash, the other
+	// fields are empty. At the first successful login with the plain text password,
+	// the password is set again with a bcrypt hash and the derived secrets.
+	Hash        string
 	CRAMMD5     CRAMMD5 // For SASL CRAM-MD5.
 	SCRAMSHA1   SCRAM   // For SASL SCRAM-SHA-1.
 	SCRAMSHA256 SCRAM   // For SASL SCRAM-SHA-256.
@@ -212,20 +221,26 @@ type Mailbox struct {
 	// lower case (for JMAP), sorted.
 	Keywords []string
 
+	// If set, users can only read from the mailbox, see CheckWritable. IMAP SELECT
+	// opens it like EXAMINE. For mailboxes shared with other users, or archives that
+	// should not change. Incoming deliveries, e.g. through rulesets, are not affected.
+	ReadOnly bool
+
 	HaveCounts    bool // Whether MailboxCounts have been initialized.
 	MailboxCounts      // Statistics about messages, kept up to date whenever a change happens.
 }
 
 // Annotation is a per-mailbox or global (per-account) annotation for the IMAP
-// metadata extension, currently always a private annotation.
+// metadata extension. Mailbox annotations can be private or shared, global
+// annotations are always private.
 type Annotation struct {
 	ID int64
 
 	// Can be zero, indicates global (per-account) annotation.
 	MailboxID int64 `bstore:"ref Mailbox,unique MailboxID+Key"`
 
-	// "Entry name", always starts with "/private/". Stored lower-case, comparisons
-	// must be done case-insensitively.
+	// "Entry name", starts with "/private/" or "/shared/". Stored lower-case,
+	// comparisons must be done case-insensitively.
 	Key string `bstore:"nonzero"`
 
 	IsString bool // If true, the value is a string instead of bytes.
@@ -244,10 +259,12 @@ type MailboxCounts struct {
 	Unread  int64 // Messages without \Seen, excluding those with \Deleted, for JMAP.
 	Unseen  int64 // Messages without \Seen, including those with \Deleted, for IMAP.
 	Size    int64 // Number of bytes for all messages.
+
+	DeletedSize int64 // Number of bytes for messages with \Deleted flag, for IMAP STATUS DELETED-STORAGE.
 }
 
 func (mc MailboxCounts) String() string {
-	return fmt.Sprintf("%d total, %d deleted, %d unread, %d unseen, size %d bytes", mc.Total, mc.Deleted, mc.Unread, mc.Unseen, mc.Size)
+	return fmt.Sprintf("%d total, %d deleted, %d unread, %d unseen, size %d bytes, deleted size %d bytes", mc.Total, mc.Deleted, mc.Unread, mc.Unseen, mc.Size, mc.DeletedSize)
 }
 
 // Add increases mailbox counts mc with those of delta.
@@ -257,6 +274,7 @@ func (mc *MailboxCounts) Add(delta MailboxCounts) {
 	mc.Unread += delta.Unread
 	mc.Unseen += delta.Unseen
 	mc.Size += delta.Size
+	mc.DeletedSize += delta.DeletedSize
 }
 
 // Add decreases mailbox counts mc with those of delta.
@@ -266,6 +284,7 @@ func (mc *MailboxCounts) Sub(delta MailboxCounts) {
 	mc.Unread -= delta.Unread
 	mc.Unseen -= delta.Unseen
 	mc.Size -= delta.Size
+	mc.DeletedSize -= delta.DeletedSize
 }
 
 // SpecialUse identifies a specific role for a mailbox, used by clients to
@@ -278,6 +297,17 @@ type SpecialUse struct {
 	Trash   bool
 }
 
+// CheckWritable returns ErrMailboxReadOnly if the mailbox is marked read-only.
+// Such a mailbox cannot be deleted or renamed, and its messages cannot be removed,
+// moved or have their flags changed, and no messages can be added, except by
+// incoming deliveries.
+func (mb Mailbox) CheckWritable() error {
+	if mb.ReadOnly {
+		return ErrMailboxReadOnly
+	}
+	return nil
+}
+
 // CalculateCounts calculates the full current counts for messages in the mailbox.
 func (mb *Mailbox) CalculateCounts(tx *bstore.Tx) (mc MailboxCounts, err error) {
 	q := bstore.QueryTx[Message](tx)
@@ -426,6 +456,11 @@ type Message struct {
 
 	Received time.Time `bstore:"default now,index"`
 
+	// When the message was saved in its current mailbox, for IMAP SAVEDATE. Set
+	// during delivery, copy and move. Nil for messages saved before SaveDate was
+	// added, in which case Received is used for searches.
+	SaveDate *time.Time
+
 	// Full IP address of remote SMTP server. Empty if not delivered over SMTP. The
 	// masked IPs are used to classify incoming messages. They are left empty for
 	// messages matching a ruleset for forwarded messages.
@@ -525,6 +560,25 @@ type Message struct {
 	TrainedJunk *bool  // If nil, no training done yet. Otherwise, true is trained as junk, false trained as nonjunk.
 	MsgPrefix   []byte // Typically holds received headers and/or header separator.
 
+	// If non-zero, the message data following MsgPrefix is not in an on-disk file of
+	// its own, but stored compressed in a pack file, see Account.ArchivePack.
+	// PackOffset and PackSize are the position and size of the compressed data in the
+	// pack file. Copies of a message share the compressed data.
+	PackID     int64
+	PackOffset int64
+	PackSize   int64
+
+	// If > 0, the on-disk message file is gzip-compressed and has this size, see
+	// MessageCompression in the configuration. Size remains the size of the
+	// uncompressed message, as reported to IMAP clients. Copies of a message share
+	// the compressed file.
+	CompressedSize int64
+
+	// Whether the on-disk message file is encrypted with the message key of the
+	// account, see MessageEncryption in the configuration. Encrypted message files are
+	// not compressed. Size remains the size of the unencrypted message.
+	Encrypted bool
+
 	// ParsedBuf message structure. Currently saved as JSON of message.Part because bstore
 	// cannot yet store recursive types. Created when first needed, and saved in the
 	// database.
@@ -540,6 +594,7 @@ func (m Message) MailboxCounts() (mc MailboxCounts) {
 	}
 	if m.Deleted {
 		mc.Deleted++
+		mc.DeletedSize += m.Size
 	} else {
 		mc.Total++
 	}
@@ -682,6 +737,28 @@ func (m *Message) JunkFlagsForMailbox(mb Mailbox, conf config.Account) {
 	}
 }
 
+// JunkFlagsForImport sets the Junk or Notjunk flag on an imported message that has
+// neither, for training the junk filter with the mailboxes of a migrated account.
+// Messages in the Junk mailbox, or in mailboxes with a name starting with "junk"
+// or "spam", are junk. Messages in the Trash and Draft mailboxes, or in mailboxes
+// starting with "trash", "deleted" or "draft", are left alone. Other messages are
+// not junk.
+func (m *Message) JunkFlagsForImport(mb Mailbox) {
+	if m.Junk || m.Notjunk {
+		return
+	}
+
+	lmailbox := strings.ToLower(mb.Name)
+	hasPrefix := func(prefixes ...string) bool {
+		return slices.ContainsFunc(prefixes, func(p string) bool { return strings.HasPrefix(lmailbox, p) })
+	}
+	if mb.Junk || hasPrefix("junk", "spam") {
+		m.Junk = true
+	} else if !mb.Trash && !mb.Draft && !hasPrefix("trash", "deleted", "draft") {
+		m.Notjunk = true
+	}
+}
+
 // Recipient represents the recipient of a message. It is tracked to allow
 // first-time incoming replies from users this account has sent messages to. When a
 // mailbox is added to the Sent mailbox the message is parsed and recipients are
@@ -698,6 +775,21 @@ type Recipient struct {
 	Sent      time.Time `bstore:"nonzero"`
 }
 
+// TrustedSender is an address this account has sent messages to. Like an address
+// book, incoming messages with the message From address of a trusted sender are
+// accepted without junk filtering and without a subjectpass challenge. Trusted
+// senders are added along with Recipient, but unlike Recipient, they are kept
+// when the sent messages are removed, and they can be reviewed and removed by the
+// user.
+type TrustedSender struct {
+	ID        int64
+	Localpart string    `bstore:"nonzero"`                         // Encoded localpart.
+	Domain    string    `bstore:"nonzero,unique Domain+Localpart"` // Unicode string.
+	Created   time.Time `bstore:"nonzero,default now"`
+	LastSent  time.Time `bstore:"nonzero"`
+	Count     int       // Number of sent messages with this address as recipient.
+}
+
 // Outgoing is a message submitted for delivery from the queue. Used to enforce
 // maximum outgoing messages.
 type Outgoing struct {
@@ -732,8 +824,8 @@ type LoginSession struct {
 	ID                 int64
 	Created            time.Time `bstore:"nonzero,default now"` // Of original login.
 	Expires            time.Time `bstore:"nonzero"`             // Extended each time it is used.
-	SessionTokenBinary [16]byte  `bstore:"nonzero"`             // Stored in cookie, like "webmailsession" or "webaccountsession".
-	CSRFTokenBinary    [16]byte  // For API requests, in "x-mox-csrf" header.
+	SessionTokenBinary [16]byte  `bstore:"nonzero" json:"-"`    // Stored in cookie, like "webmailsession" or "webaccountsession".
+	CSRFTokenBinary    [16]byte  `json:"-"`                     // For API requests, in "x-mox-csrf" header.
 	AccountName        string    `bstore:"nonzero"`
 	LoginAddress       string    `bstore:"nonzero"`
 
@@ -742,6 +834,99 @@ type LoginSession struct {
 	csrfToken    CSRFToken
 }
 
+// LoginToken is a short-lived password for an account, minted by the admin for
+// external applications such as webmail software (e.g. Roundcube) that
+// authenticate users over IMAP and SMTP without storing their passwords. Tokens
+// are accepted by the PLAIN and LOGIN authentication mechanisms, not by
+// CRAM-MD5/SCRAM, which require the password.
+type LoginToken struct {
+	ID          int64
+	TokenHash   string    `bstore:"nonzero,unique" json:"-"` // Hex-encoded SHA-256 of the token.
+	Created     time.Time `bstore:"nonzero,default now"`
+	Expires     time.Time `bstore:"nonzero"`
+	Description string    // E.g. the application the token was minted for.
+	LastUsed    time.Time // Updated with a delay, zero if never used.
+}
+
+// IMAPImport holds the state of importing a mailbox from a remote IMAP server, for
+// continuing an interrupted import.
+type IMAPImport struct {
+	ID          int64
+	Address     string    `bstore:"nonzero,unique Address+Username+Mailbox"` // Of remote server, host and port.
+	Username    string    `bstore:"nonzero"`
+	Mailbox     string    `bstore:"nonzero"` // Remote mailbox name as used in IMAP commands.
+	UIDValidity uint32    // Of remote mailbox. If changed, the mailbox is imported again.
+	LastUID     uint32    // Highest UID imported from the remote mailbox.
+	Imported    int       // Number of messages imported.
+	Updated     time.Time `bstore:"nonzero"`
+}
+
+// ImportJob holds the progress of importing messages from an mbox, maildir or
+// other file-based source into an account, for reporting and for continuing an
+// interrupted import. An import commits its messages in batches. When an import
+// of the same source into the same mailbox is started while a job is unfinished,
+// the messages already done are skipped.
+type ImportJob struct {
+	ID       int64
+	Kind     string    `bstore:"nonzero"` // "mbox", "maildir", "pst", "dbox", "mh" or "babyl", or an mbox dialect like "mboxrd".
+	Source   string    `bstore:"nonzero"` // Path of file or directory, as given to the import command.
+	Mailbox  string    // Destination mailbox, or prefix for sources with multiple mailboxes.
+	Total    int       // Number of messages in the source, counted before importing.
+	Done     int       // Number of messages read from the source and committed, imported or skipped.
+	Imported int       // Number of messages delivered.
+	Skipped  int       // Number of duplicate messages skipped.
+	Position string    // Of the last committed message in the source, e.g. "<file>:<line>" for mbox.
+	Started  time.Time `bstore:"nonzero,default now"`
+	Updated  time.Time `bstore:"nonzero"`
+	Finished time.Time // Zero while the import is running or interrupted.
+}
+
+// ImportSource records where an imported message came from, for imports with the
+// option to keep sources. Used for cross-referencing messages with the source,
+// e.g. to verify a migration. Records follow a message when it is moved, but not
+// when it is copied, and they are not removed with the message.
+type ImportSource struct {
+	ID        int64
+	MessageID int64     `bstore:"nonzero,index"` // Of imported Message.
+	Kind      string    `bstore:"nonzero"`       // As in ImportJob, or "imap".
+	Source    string    `bstore:"nonzero"`       // Path of file or directory as given to the import command, or IMAP URL of the remote mailbox, with UIDVALIDITY.
+	Position  string    `bstore:"nonzero"`       // Of message in the source, e.g. "<file>:<line>" for mbox, file path for maildir, UID for IMAP.
+	Imported  time.Time `bstore:"nonzero,default now"`
+}
+
+// SieveScript is a sieve script for filtering incoming messages, see package
+// sieve. At most one script is active.
+type SieveScript struct {
+	ID      int64
+	Name    string `bstore:"nonzero,unique"`
+	Script  string
+	Active  bool
+	Updated time.Time `bstore:"nonzero"`
+}
+
+// VacationResponse records when a sieve vacation response was last sent to an
+// address, to prevent sending responses too often.
+type VacationResponse struct {
+	ID      int64
+	Handle  string    `bstore:"nonzero,unique Handle+Address"` // Of the vacation action.
+	Address string    `bstore:"nonzero"`                       // Lower-case address the response was sent to.
+	Sent    time.Time `bstore:"nonzero,default now"`
+}
+
+// Vacation is an out-of-office auto-responder for an address of the account. An
+// active vacation sends responses like the sieve vacation action.
+type Vacation struct {
+	ID      int64
+	Address string     `bstore:"nonzero,unique"` // Canonical address of a destination, as in the account configuration.
+	Enabled bool       // Whether responses are sent. Also see Start and End.
+	Start   *time.Time // If set, no responses are sent before this time.
+	End     *time.Time // If set, no responses are sent after this time.
+	Subject string     // Subject for responses, "Auto: " followed by original subject if empty.
+	Body    string     // Plain text.
+	Days    int        // Number of days during which no new response is sent to the same correspondent. Default 7.
+	Updated time.Time  `bstore:"nonzero,default now"`
+}
+
 // Quoting is a setting for how to quote in replies/forwards.
 type Quoting string
 
@@ -788,6 +973,29 @@ type FromAddressSettings struct {
 	ViewMode    ViewMode
 }
 
+// Identity holds settings for composing messages with an address of the account
+// as "From" address. Identities are stored in the account so they are the same
+// for all devices the user works from.
+type Identity struct {
+	Address string // Unicode, without display name.
+
+	// Display name for the From header. If empty, the full name from the account
+	// configuration is used.
+	Name string
+
+	// Signature to add to new messages and replies. If empty, the signature from the
+	// account Settings is used.
+	Signature string
+
+	// Addresses added as Cc or Bcc when composing a message. Either a plain email
+	// address, or of the form "name <localpart@domain>".
+	Cc  []string
+	Bcc []string
+
+	// Address set as Reply-To when composing a message, can be empty.
+	ReplyTo string
+}
+
 // RulesetNoListID records a user "no" response to the question of
 // creating/removing a ruleset after moving a message with list-id header from/to
 // the inbox.
@@ -824,6 +1032,8 @@ var DBTypes = []any{
 	NextUIDValidity{},
 	Message{},
 	Recipient{},
+	TextIndex{},
+	TrustedSender{},
 	Mailbox{},
 	Subscription{},
 	Outgoing{},
@@ -834,12 +1044,23 @@ var DBTypes = []any{
 	RecipientDomainTLS{},
 	DiskUsage{},
 	LoginSession{},
+	LoginToken{},
+	IMAPImport{},
+	ImportJob{},
+	ImportSource{},
+	SieveScript{},
+	VacationResponse{},
+	Vacation{},
 	Settings{},
 	FromAddressSettings{},
+	Identity{},
 	RulesetNoListID{},
 	RulesetNoMsgFrom{},
 	RulesetNoMailbox{},
 	Annotation{},
+	Pack{},
+	MessageKey{},
+	JunkDecision{},
 }
 
 // Account holds the information about a user, includings mailboxes, messages, imap subscriptions.
@@ -863,11 +1084,15 @@ type Account struct {
 	sync.RWMutex
 
 	nused int // Reference count, while >0, this account is alive and shared.
+
+	packMutex sync.Mutex // Serializes ArchivePack.
 }
 
 type Upgrade struct {
-	ID      byte
-	Threads byte // 0: None, 1: Adding MessageID's completed, 2: Adding ThreadID's completed.
+	ID             byte
+	Threads        byte // 0: None, 1: Adding MessageID's completed, 2: Adding ThreadID's completed.
+	TrustedSenders bool // Whether trusted senders have been added for existing recipients.
+	DeletedSize    bool // Whether MailboxCounts.DeletedSize has been set for existing messages.
 }
 
 // InitialUIDValidity returns a UIDValidity used for initializing an account.
@@ -910,8 +1135,8 @@ func OpenAccount(log mlog.Log, name string, checkLoginDisabled bool) (*Account,
 
 	if a, ok := mox.Conf.Account(name); !ok {
 		return nil, ErrAccountUnknown
-	} else if checkLoginDisabled && a.LoginDisabled != "" {
-		return nil, fmt.Errorf("%w: %s", ErrLoginDisabled, a.LoginDisabled)
+	} else if msg := a.LoginDisabledMessage(); checkLoginDisabled && msg != "" {
+		return nil, fmt.Errorf("%w: %s", ErrLoginDisabled, msg)
 	}
 
 	acc, err := openAccount(log, name)
@@ -966,7 +1191,7 @@ func OpenAccountDB(log mlog.Log, accountDir, accountName string) (a *Account, re
 	}
 
 	if isNew {
-		if err := initAccount(db); err != nil {
+		if err := initAccount(db, accountName); err != nil {
 			return nil, fmt.Errorf("initializing account: %v", err)
 		}
 		close(acc.threadsCompleted)
@@ -1018,6 +1243,9 @@ func OpenAccountDB(log mlog.Log, accountDir, accountName string) (a *Account, re
 		return nil, fmt.Errorf("calculating counts for mailbox or inserting settings: %v", err)
 	}
 
+	// Make encrypted messages readable, if the message key is protected by the master key.
+	acc.loadMessageKey(log)
+
 	// Start adding threading if needed.
 	up := Upgrade{ID: 1}
 	err = db.Write(context.TODO(), func(tx *bstore.Tx) error {
@@ -1028,10 +1256,52 @@ func OpenAccountDB(log mlog.Log, accountDir, accountName string) (a *Account, re
 			}
 			err = nil
 		}
-		return err
+		if err != nil || up.TrustedSenders && up.DeletedSize {
+			return err
+		}
+
+		if !up.TrustedSenders {
+			// Add trusted senders for recipients of messages sent before trusted senders
+			// were tracked.
+			err = bstore.QueryTx[Recipient](tx).ForEach(func(r Recipient) error {
+				return trustedSenderAdd(tx, r.Localpart, r.Domain, r.Sent)
+			})
+			if err != nil {
+				return fmt.Errorf("adding trusted senders for recipients: %v", err)
+			}
+			up.TrustedSenders = true
+		}
+
+		if !up.DeletedSize {
+			// Add sizes of messages with \Deleted flag to mailbox counts, they weren't
+			// tracked before.
+			sizes := map[int64]int64{}
+			q := bstore.QueryTx[Message](tx)
+			q.FilterEqual("Expunged", false)
+			q.FilterEqual("Deleted", true)
+			err = q.ForEach(func(m Message) error {
+				sizes[m.MailboxID] += m.Size
+				return nil
+			})
+			if err != nil {
+				return fmt.Errorf("calculating size of deleted messages: %v", err)
+			}
+			for mbID, size := range sizes {
+				mb := Mailbox{ID: mbID}
+				if err := tx.Get(&mb); err != nil {
+					return fmt.Errorf("get mailbox for updating deleted size: %v", err)
+				}
+				mb.DeletedSize = size
+				if err := tx.Update(&mb); err != nil {
+					return fmt.Errorf("update deleted size for mailbox: %v", err)
+				}
+			}
+			up.DeletedSize = true
+		}
+		return tx.Update(&up)
 	})
 	if err != nil {
-		return nil, fmt.Errorf("checking message threading: %v", err)
+		return nil, fmt.Errorf("checking account upgrades: %v", err)
 	}
 	if up.Threads == 2 {
 		close(acc.threadsCompleted)
@@ -1093,11 +1363,11 @@ func (a *Account) ThreadingWait(log mlog.Log) error {
 	return a.threadsErr
 }
 
-func initAccount(db *bstore.DB) error {
+func initAccount(db *bstore.DB, accountName string) error {
 	return db.Write(context.TODO(), func(tx *bstore.Tx) error {
 		uidvalidity := InitialUIDValidity()
 
-		if err := tx.Insert(&Upgrade{ID: 1, Threads: 2}); err != nil {
+		if err := tx.Insert(&Upgrade{ID: 1, Threads: 2, TrustedSenders: true, DeletedSize: true}); err != nil {
 			return err
 		}
 		if err := tx.Insert(&DiskUsage{ID: 1}); err != nil {
@@ -1107,7 +1377,15 @@ func initAccount(db *bstore.DB) error {
 			return err
 		}
 
-		if len(mox.Conf.Static.DefaultMailboxes) > 0 {
+		// Mailboxes of the account template take precedence.
+		var zerouse config.SpecialUseMailboxes
+		var templateMailboxes config.InitialMailboxes
+		if accConf, ok := mox.Conf.Account(accountName); ok && accConf.Template != "" {
+			templateMailboxes = mox.Conf.Static.AccountTemplates[accConf.Template].InitialMailboxes
+		}
+		haveTemplateMailboxes := templateMailboxes.SpecialUse != zerouse || len(templateMailboxes.Regular) > 0
+
+		if len(mox.Conf.Static.DefaultMailboxes) > 0 && !haveTemplateMailboxes {
 			// Deprecated in favor of InitialMailboxes.
 			defaultMailboxes := mox.Conf.Static.DefaultMailboxes
 			mailboxes := []string{"Inbox"}
@@ -1139,8 +1417,9 @@ func initAccount(db *bstore.DB) error {
 			}
 		} else {
 			mailboxes := mox.Conf.Static.InitialMailboxes
-			var zerouse config.SpecialUseMailboxes
-			if mailboxes.SpecialUse == zerouse && len(mailboxes.Regular) == 0 {
+			if haveTemplateMailboxes {
+				mailboxes = templateMailboxes
+			} else if mailboxes.SpecialUse == zerouse && len(mailboxes.Regular) == 0 {
 				mailboxes = DefaultInitialMailboxes
 			}
 
@@ -1217,7 +1496,7 @@ func (a *Account) Close() error {
 // CheckConsistency checks the consistency of the database and returns a non-nil
 // error for these cases:
 //
-// - Missing on-disk file for message.
+// - Missing on-disk file or pack file for message.
 // - Mismatch between message size and length of MsgPrefix and on-disk file.
 // - Missing HaveCounts.
 // - Incorrect mailbox counts.
@@ -1275,14 +1554,31 @@ func (a *Account) CheckConsistency() error {
 			if m.Expunged {
 				return nil
 			}
-			p := a.MessagePath(m.ID)
-			st, err := os.Stat(p)
-			if err != nil {
-				existserr := fmt.Sprintf("message %d in mailbox %q (id %d) on-disk file %s: %v", m.ID, mb.Name, mb.ID, p, err)
-				fileErrors = append(fileErrors, existserr)
-			} else if len(fileErrors) < 20 && m.Size != int64(len(m.MsgPrefix))+st.Size() {
-				sizeerr := fmt.Sprintf("message %d in mailbox %q (id %d) has size %d != len msgprefix %d + on-disk file size %d = %d", m.ID, mb.Name, mb.ID, m.Size, len(m.MsgPrefix), st.Size(), int64(len(m.MsgPrefix))+st.Size())
-				fileErrors = append(fileErrors, sizeerr)
+			if m.PackID != 0 {
+				p := packPath(a.Dir, m.PackID)
+				if st, err := os.Stat(p); err != nil {
+					existserr := fmt.Sprintf("message %d in mailbox %q (id %d) pack file %s: %v", m.ID, mb.Name, mb.ID, p, err)
+					fileErrors = append(fileErrors, existserr)
+				} else if len(fileErrors) < 20 && m.PackOffset+m.PackSize > st.Size() {
+					packerr := fmt.Sprintf("message %d in mailbox %q (id %d) has data at offset %d and size %d beyond pack file %s size %d", m.ID, mb.Name, mb.ID, m.PackOffset, m.PackSize, p, st.Size())
+					fileErrors = append(fileErrors, packerr)
+				}
+			} else {
+				p := a.MessagePath(m.ID)
+				st, err := os.Stat(p)
+				if err != nil {
+					existserr := fmt.Sprintf("message %d in mailbox %q (id %d) on-disk file %s: %v", m.ID, mb.Name, mb.ID, p, err)
+					fileErrors = append(fileErrors, existserr)
+				} else if len(fileErrors) < 20 && m.CompressedSize > 0 && m.CompressedSize != st.Size() {
+					sizeerr := fmt.Sprintf("message %d in mailbox %q (id %d) has compressed size %d != on-disk file size %d", m.ID, mb.Name, mb.ID, m.CompressedSize, st.Size())
+					fileErrors = append(fileErrors, sizeerr)
+				} else if len(fileErrors) < 20 && m.Encrypted && EncryptedFileSize(m.Size-int64(len(m.MsgPrefix))) != st.Size() {
+					sizeerr := fmt.Sprintf("message %d in mailbox %q (id %d) has encrypted file size %d, expected %d", m.ID, mb.Name, mb.ID, st.Size(), EncryptedFileSize(m.Size-int64(len(m.MsgPrefix))))
+					fileErrors = append(fileErrors, sizeerr)
+				} else if len(fileErrors) < 20 && m.CompressedSize == 0 && !m.Encrypted && m.Size != int64(len(m.MsgPrefix))+st.Size() {
+					sizeerr := fmt.Sprintf("message %d in mailbox %q (id %d) has size %d != len msgprefix %d + on-disk file size %d = %d", m.ID, mb.Name, mb.ID, m.Size, len(m.MsgPrefix), st.Size(), int64(len(m.MsgPrefix))+st.Size())
+					fileErrors = append(fileErrors, sizeerr)
+				}
 			}
 
 			if m.ThreadID <= 0 && len(threadidErrors) < 20 {
@@ -1388,6 +1684,17 @@ func (a *Account) NextModSeq(tx *bstore.Tx) (ModSeq, error) {
 	return v.LastModSeq, tx.Update(&v)
 }
 
+// LastModSeq returns the last assigned modification sequence. It changes with any
+// change to messages in the account.
+func (a *Account) LastModSeq(tx *bstore.Tx) (ModSeq, error) {
+	v := SyncState{ID: 1}
+	err := tx.Get(&v)
+	if err == bstore.ErrAbsent {
+		return 0, nil
+	}
+	return v.LastModSeq, err
+}
+
 func (a *Account) HighestDeletedModSeq(tx *bstore.Tx) (ModSeq, error) {
 	v := SyncState{ID: 1}
 	err := tx.Get(&v)
@@ -1450,6 +1757,10 @@ func (a *Account) DeliverMessage(log mlog.Log, tx *bstore.Tx, m *Message, msgFil
 	if err := tx.Update(&mb); err != nil {
 		return fmt.Errorf("updating mailbox nextuid: %w", err)
 	}
+	if m.SaveDate == nil {
+		now := time.Now()
+		m.SaveDate = &now
+	}
 
 	if updateDiskUsage {
 		du := DiskUsage{ID: 1}
@@ -1484,6 +1795,7 @@ func (a *Account) DeliverMessage(log mlog.Log, tx *bstore.Tx, m *Message, msgFil
 		if err := json.Unmarshal(m.ParsedBuf, &p); err != nil {
 			log.Errorx("unmarshal parsed message, continuing", err, slog.String("parse", ""))
 		} else {
+			p.SetReaderAt(mr)
 			part = &p
 		}
 	}
@@ -1537,6 +1849,12 @@ func (a *Account) DeliverMessage(log mlog.Log, tx *bstore.Tx, m *Message, msgFil
 		}
 	}
 
+	if part != nil {
+		if err := textIndexAdd(log, tx, m, part); err != nil {
+			return err
+		}
+	}
+
 	// todo: perhaps we should match the recipients based on smtp submission and a matching message-id? we now miss the addresses in bcc's if the mail client doesn't save a message that includes the bcc header in the sent mailbox.
 	if mb.Sent && part != nil && part.Envelope != nil {
 		e := part.Envelope
@@ -1574,6 +1892,9 @@ func (a *Account) DeliverMessage(log mlog.Log, tx *bstore.Tx, m *Message, msgFil
 			if err := tx.Insert(&mr); err != nil {
 				return fmt.Errorf("inserting sent message recipients: %w", err)
 			}
+			if err := trustedSenderAdd(tx, mr.Localpart, mr.Domain, sent); err != nil {
+				return fmt.Errorf("adding trusted sender: %w", err)
+			}
 		}
 	}
 
@@ -1581,15 +1902,61 @@ func (a *Account) DeliverMessage(log mlog.Log, tx *bstore.Tx, m *Message, msgFil
 	msgDir := filepath.Dir(msgPath)
 	os.MkdirAll(msgDir, 0770)
 
-	// Sync file data to disk.
-	if sync {
-		if err := msgFile.Sync(); err != nil {
-			return fmt.Errorf("fsync message file: %w", err)
+	// Store encrypted if configured, otherwise compressed if configured and it saves
+	// space.
+	pub, err := a.messagePublicKey(log, tx)
+	if err != nil {
+		return fmt.Errorf("get message encryption key: %w", err)
+	}
+	if pub != nil {
+		st, err := msgFile.Stat()
+		if err != nil {
+			return fmt.Errorf("stat message file: %w", err)
+		}
+		if err := writeEncrypted(log, msgPath, &moxio.AtReader{R: msgFile}, st.Size(), pub, sync); err != nil {
+			return fmt.Errorf("writing encrypted message file: %w", err)
+		}
+		m.Encrypted = true
+		if err := tx.Update(m); err != nil {
+			return fmt.Errorf("updating message for encryption: %w", err)
+		}
+	} else if minSize, maxSize, ok := a.messageCompression(); ok {
+		st, err := msgFile.Stat()
+		if err != nil {
+			return fmt.Errorf("stat message file: %w", err)
+		}
+		if st.Size() >= minSize && st.Size() <= maxSize {
+			m.CompressedSize, err = writeCompressed(log, msgPath, &moxio.AtReader{R: msgFile}, st.Size(), sync)
+			if err != nil {
+				return fmt.Errorf("writing compressed message file: %w", err)
+			}
+			if m.CompressedSize > 0 {
+				if err := tx.Update(m); err != nil {
+					return fmt.Errorf("updating message for compressed size: %w", err)
+				}
+			}
 		}
 	}
 
-	if err := moxio.LinkOrCopy(log, msgPath, msgFile.Name(), &moxio.AtReader{R: msgFile}, true); err != nil {
-		return fmt.Errorf("linking/copying message to new file: %w", err)
+	if m.CompressedSize == 0 && !m.Encrypted {
+		// Sync file data to disk.
+		if sync {
+			if err := msgFile.Sync(); err != nil {
+				return fmt.Errorf("fsync message file: %w", err)
+			}
+		}
+
+		// Share the file with messages with the same data if configured, otherwise store
+		// our own file.
+		linked, err := dedupLink(log, msgPath, msgFile, sync)
+		if err != nil {
+			log.Errorx("linking message file from msgstore, storing separately", err)
+		}
+		if !linked {
+			if err := moxio.LinkOrCopy(log, msgPath, msgFile.Name(), &moxio.AtReader{R: msgFile}, true); err != nil {
+				return fmt.Errorf("linking/copying message to new file: %w", err)
+			}
+		}
 	}
 
 	if sync {
@@ -1677,6 +2044,10 @@ func (a *Account) SetPassword(log mlog.Log, password string) error {
 			return fmt.Errorf("inserting new password: %v", err)
 		}
 
+		if err := a.setPasswordMessageKey(log, tx, password); err != nil {
+			return err
+		}
+
 		return sessionRemoveAll(context.TODO(), log, tx, a.Name)
 	})
 	if err == nil {
@@ -1685,6 +2056,41 @@ func (a *Account) SetPassword(log mlog.Log, password string) error {
 	return err
 }
 
+// SetPasswordHash sets the password of the account to a password hash imported
+// from another system, see ParsePasswordHash. Only authentication with a plain
+// text password is possible until the first successful login, at which point the
+// password is upgraded to the native hashes and secrets for all authentication
+// mechanisms.
+func (a *Account) SetPasswordHash(log mlog.Log, passwordHash string) error {
+	scheme, taggedHash, err := ParsePasswordHash(passwordHash)
+	if err != nil {
+		return fmt.Errorf("parsing password hash: %w", err)
+	}
+
+	err = a.DB.Write(context.TODO(), func(tx *bstore.Tx) error {
+		// The message key cannot be wrapped with a password we don't know.
+		mk := MessageKey{ID: 1}
+		if err := tx.Get(&mk); err == nil && mk.KeyWrap == "password" {
+			return fmt.Errorf("cannot set password hash for account with message key protected by password")
+		} else if err != nil && err != bstore.ErrAbsent {
+			return fmt.Errorf("get message key: %v", err)
+		}
+
+		if _, err := bstore.QueryTx[Password](tx).Delete(); err != nil {
+			return fmt.Errorf("deleting existing password: %v", err)
+		}
+		pw := Password{Hash: taggedHash}
+		if err := tx.Insert(&pw); err != nil {
+			return fmt.Errorf("inserting new password: %v", err)
+		}
+		return sessionRemoveAll(context.TODO(), log, tx, a.Name)
+	})
+	if err == nil {
+		log.Info("imported password hash set for account", slog.String("account", a.Name), slog.String("scheme", scheme))
+	}
+	return err
+}
+
 // SessionsClear invalidates all (web) login sessions for the account.
 func (a *Account) SessionsClear(ctx context.Context, log mlog.Log) error {
 	return a.DB.Write(ctx, func(tx *bstore.Tx) error {
@@ -1869,6 +2275,13 @@ ruleset:
 				continue ruleset
 			}
 		}
+		if rs.MsgToRegexpCompiled != nil {
+			if p.Envelope == nil || !slices.ContainsFunc(append(slices.Clone(p.Envelope.To), p.Envelope.CC...), func(a message.Address) bool {
+				return rs.MsgToRegexpCompiled.MatchString(a.User + "@" + a.Host)
+			}) {
+				continue ruleset
+			}
+		}
 
 		if !rs.VerifiedDNSDomain.IsZero() {
 			d := rs.VerifiedDNSDomain.Name()
@@ -1915,18 +2328,43 @@ ruleset:
 	return nil
 }
 
+// RulesetFlags marks m as read and adds keywords, as configured in the matching
+// ruleset rs.
+func RulesetFlags(rs *config.Ruleset, m *Message) {
+	if rs.Seen {
+		m.Seen = true
+	}
+	m.Keywords, _ = MergeKeywords(m.Keywords, rs.Keywords)
+}
+
 // MessagePath returns the file system path of a message.
 func (a *Account) MessagePath(messageID int64) string {
 	return strings.Join(append([]string{a.Dir, "msg"}, messagePathElems(messageID)...), string(filepath.Separator))
 }
 
 // MessageReader opens a message for reading, transparently combining the
-// message prefix with the original incoming message.
+// message prefix with the original incoming message. Reads of encrypted messages
+// return ErrMessageKeyLocked if the message key of the account isn't unlocked.
 func (a *Account) MessageReader(m Message) *MsgReader {
-	return &MsgReader{prefix: m.MsgPrefix, path: a.MessagePath(m.ID), size: m.Size}
+	return messageReader(a.Dir, messageKeyGet(a.Name), m)
+}
+
+func messageReader(accountDir string, messageKey *ecdh.PrivateKey, m Message) *MsgReader {
+	if m.PackID != 0 {
+		return &MsgReader{prefix: m.MsgPrefix, path: packPath(accountDir, m.PackID), size: m.Size, packOffset: m.PackOffset, packSize: m.PackSize}
+	}
+	mr := &MsgReader{prefix: m.MsgPrefix, path: filepath.Join(accountDir, "msg", MessagePath(m.ID)), size: m.Size, compressedSize: m.CompressedSize}
+	if m.Encrypted {
+		mr.messageKey = messageKey
+		if messageKey == nil {
+			mr.err = ErrMessageKeyLocked
+		}
+	}
+	return mr
 }
 
 // DeliverDestination delivers an email to dest, based on the configured rulesets.
+// Messages matching a ruleset with Discard are not stored, m.ID remains zero.
 //
 // Returns ErrOverQuota when account would be over quota after adding message.
 //
@@ -1936,8 +2374,12 @@ func (a *Account) MessageReader(m Message) *MsgReader {
 func (a *Account) DeliverDestination(log mlog.Log, dest config.Destination, m *Message, msgFile *os.File) error {
 	var mailbox string
 	rs := MessageRuleset(log, dest, m, m.MsgPrefix, msgFile)
-	if rs != nil {
+	if rs != nil && rs.Discard {
+		log.Info("not storing message due to ruleset")
+		return nil
+	} else if rs != nil {
 		mailbox = rs.Mailbox
+		RulesetFlags(rs, m)
 	} else if dest.Mailbox == "" {
 		mailbox = "Inbox"
 	} else {
@@ -1972,6 +2414,8 @@ func (a *Account) DeliverMailbox(log mlog.Log, mailbox string, m *Message, msgFi
 		// Update count early, DeliverMessage will update mb too and we don't want to fetch
 		// it again before updating.
 		mb.MailboxCounts.Add(m.MailboxCounts())
+		var mbKwChanged bool
+		mb.Keywords, mbKwChanged = MergeKeywords(mb.Keywords, m.Keywords)
 		if err := tx.Update(&mb); err != nil {
 			return fmt.Errorf("updating mailbox for delivery: %w", err)
 		}
@@ -1982,6 +2426,9 @@ func (a *Account) DeliverMailbox(log mlog.Log, mailbox string, m *Message, msgFi
 
 		changes = append(changes, chl...)
 		changes = append(changes, m.ChangeAddUID(), mb.ChangeCounts())
+		if mbKwChanged {
+			changes = append(changes, mb.ChangeKeywords())
+		}
 		return nil
 	})
 	// todo: if rename succeeded but transaction failed, we should remove the file.
@@ -2003,6 +2450,9 @@ func (a *Account) TidyRejectsMailbox(log mlog.Log, rejectsMailbox string) (hasSp
 	var remove []Message
 	defer func() {
 		for _, m := range remove {
+			if m.PackID != 0 {
+				continue
+			}
 			p := a.MessagePath(m.ID)
 			err := os.Remove(p)
 			log.Check(err, "removing rejects message file", slog.String("path", p))
@@ -2077,6 +2527,9 @@ func (a *Account) rejectsRemoveMessages(ctx context.Context, log mlog.Log, tx *b
 	if _, err := qdmr.Delete(); err != nil {
 		return nil, fmt.Errorf("deleting from message recipient: %w", err)
 	}
+	if _, err := bstore.QueryTx[TextIndex](tx).FilterIDs(ids).Delete(); err != nil {
+		return nil, fmt.Errorf("deleting from text index: %w", err)
+	}
 
 	// Assign new modseq.
 	modseq, err := a.NextModSeq(tx)
@@ -2123,6 +2576,19 @@ func (a *Account) rejectsRemoveMessages(ctx context.Context, log mlog.Log, tx *b
 	return changes, nil
 }
 
+// DuplicatePresent returns whether a message with the canonical messageID was
+// delivered to the account over SMTP at or after "since", and is not expunged.
+// Messages that were imported, appended or are rejects don't count.
+func (a *Account) DuplicatePresent(ctx context.Context, messageID string, since time.Time) (bool, error) {
+	q := bstore.QueryDB[Message](ctx, a.DB)
+	q.FilterNonzero(Message{MessageID: messageID})
+	q.FilterGreaterEqual("Received", since)
+	q.FilterNotEqual("RemoteIP", "")
+	q.FilterEqual("Expunged", false)
+	q.FilterEqual("IsReject", false)
+	return q.Exists()
+}
+
 // RejectsRemove removes a message from the rejects mailbox if present.
 // Caller most hold account wlock.
 // Changes are broadcasted.
@@ -2132,6 +2598,9 @@ func (a *Account) RejectsRemove(log mlog.Log, rejectsMailbox, messageID string)
 	var remove []Message
 	defer func() {
 		for _, m := range remove {
+			if m.PackID != 0 {
+				continue
+			}
 			p := a.MessagePath(m.ID)
 			err := os.Remove(p)
 			log.Check(err, "removing rejects message file", slog.String("path", p))
@@ -2264,11 +2733,40 @@ func OpenEmailAuth(log mlog.Log, email string, password string, checkLoginDisabl
 		}
 	}()
 
+	// Checked before verifying the password, so an attacker cannot learn whether a
+	// password is correct while the account is locked out.
+	if err := AuthLockoutCheck(context.TODO(), nil, accName); err != nil {
+		return acc, accName, err
+	}
+
 	password, err := precis.OpaqueString.String(password)
 	if err != nil {
 		return nil, accName, ErrUnknownCredentials
 	}
 
+	checkDisabled := func() error {
+		if !checkLoginDisabled {
+			return nil
+		}
+		conf, aok := acc.Conf()
+		if !aok {
+			return fmt.Errorf("cannot find config for account")
+		} else if msg := conf.LoginDisabledMessage(); msg != "" {
+			return fmt.Errorf("%w: %s", ErrLoginDisabled, msg)
+		}
+		return nil
+	}
+
+	// Login tokens, e.g. for external webmail software, are accepted instead of the
+	// password. If not a valid token, it may still be the password.
+	if strings.HasPrefix(password, LoginTokenPrefix) {
+		if err := acc.loginTokenVerify(context.TODO(), password); err == nil {
+			return acc, accName, checkDisabled()
+		} else if !errors.Is(err, ErrUnknownCredentials) {
+			return acc, accName, err
+		}
+	}
+
 	pw, err := bstore.QueryDB[Password](context.TODO(), acc.DB).Get()
 	if err != nil {
 		if err == bstore.ErrAbsent {
@@ -2276,28 +2774,97 @@ func OpenEmailAuth(log mlog.Log, email string, password string, checkLoginDisabl
 		}
 		return acc, accName, fmt.Errorf("looking up password: %v", err)
 	}
-	authCache.Lock()
-	ok := len(password) >= 8 && authCache.success[authKey{email, pw.Hash}] == password
-	authCache.Unlock()
-	if !ok {
-		if err := bcrypt.CompareHashAndPassword([]byte(pw.Hash), []byte(password)); err != nil {
+	imported := strings.HasPrefix(pw.Hash, "{")
+	if imported {
+		if !verifyPasswordHash(pw.Hash, password) {
 			return acc, accName, ErrUnknownCredentials
 		}
+	} else {
+		authCache.Lock()
+		ok := len(password) >= 8 && authCache.success[authKey{email, pw.Hash}] == password
+		authCache.Unlock()
+		if !ok {
+			if err := bcrypt.CompareHashAndPassword([]byte(pw.Hash), []byte(password)); err != nil {
+				return acc, accName, ErrUnknownCredentials
+			}
+		}
 	}
-	if checkLoginDisabled {
-		conf, aok := acc.Conf()
-		if !aok {
-			return acc, accName, fmt.Errorf("cannot find config for account")
-		} else if conf.LoginDisabled != "" {
-			return acc, accName, fmt.Errorf("%w: %s", ErrLoginDisabled, conf.LoginDisabled)
+	if err := checkDisabled(); err != nil {
+		return acc, accName, err
+	}
+	if imported {
+		// Upgrade to our own hashes. With a password that we would not allow to be set,
+		// we keep the imported hash.
+		if err := acc.SetPassword(log, password); err != nil {
+			log.Errorx("upgrading imported password hash", err, slog.String("account", acc.Name))
+		} else if npw, err := bstore.QueryDB[Password](context.TODO(), acc.DB).Get(); err != nil {
+			return acc, accName, fmt.Errorf("looking up password after upgrade: %v", err)
+		} else {
+			pw = npw
 		}
 	}
 	authCache.Lock()
 	authCache.success[authKey{email, pw.Hash}] = password
 	authCache.Unlock()
+
+	if err := acc.unlockMessageKey(log, password); err != nil {
+		log.Errorx("unlocking message key with password, encrypted messages cannot be read", err, slog.String("account", acc.Name))
+	}
 	return
 }
 
+// OpenEmailOAuth verifies an OAuth 2.0 bearer token with the configured issuer,
+// and opens the account of the email address in the token. If username is not
+// empty, e.g. the authorization identity from the SASL exchange, it must be an
+// address of the same account. The returned loginAddress is username if set,
+// and the address from the token otherwise.
+//
+// Tokens that are not valid result in an error wrapping ErrUnknownCredentials,
+// and also oauthbearer.ErrInsufficientScope if the scopes are missing.
+func OpenEmailOAuth(ctx context.Context, log mlog.Log, username, token string) (acc *Account, accName, loginAddress string, rerr error) {
+	oc := mox.Conf.Static.OAuth
+	if oc == nil {
+		return nil, "", "", fmt.Errorf("oauth not configured")
+	}
+	address, err := oc.Verifier.Verify(ctx, log, token)
+	if err != nil {
+		if errors.Is(err, oauthbearer.ErrInvalidToken) || errors.Is(err, oauthbearer.ErrInsufficientScope) {
+			return nil, "", "", fmt.Errorf("%w: %w", ErrUnknownCredentials, err)
+		}
+		return nil, "", "", fmt.Errorf("verifying token: %w", err)
+	}
+
+	acc, accName, _, rerr = OpenEmail(log, address, false)
+	if rerr != nil {
+		return nil, accName, address, rerr
+	}
+	defer func() {
+		if rerr != nil {
+			err := acc.Close()
+			log.Check(err, "closing account after open oauth failure")
+			acc = nil
+		}
+	}()
+
+	loginAddress = address
+	if username != "" && !strings.EqualFold(username, address) {
+		addr, err := smtp.ParseAddress(username)
+		if err != nil {
+			return acc, accName, username, fmt.Errorf("%w: %v", ErrUnknownCredentials, err)
+		}
+		name, _, _, _, err := mox.LookupAddress(addr.Localpart, addr.Domain, false, false, false)
+		if err != nil || name != accName {
+			return acc, accName, username, fmt.Errorf("%w: username %q not an address of account of token", ErrUnknownCredentials, username)
+		}
+		loginAddress = username
+	}
+
+	if err := AuthLockoutCheck(ctx, nil, accName); err != nil {
+		return acc, accName, loginAddress, err
+	}
+	return acc, accName, loginAddress, nil
+}
+
 // OpenEmail opens an account given an email address.
 //
 // The email address may contain a catchall separator.
@@ -2627,7 +3194,8 @@ func (a *Account) MailboxCreate(tx *bstore.Tx, name string) (changes []Change, c
 // MailboxRename renames mailbox mbsrc to dst, and any missing parents for the
 // destination, and any children of mbsrc and the destination.
 //
-// Names must be normalized and cannot be Inbox.
+// Names must be normalized and cannot be Inbox. Read-only mailboxes, including
+// children, cannot be renamed, ErrMailboxReadOnly is returned.
 func (a *Account) MailboxRename(tx *bstore.Tx, mbsrc Mailbox, dst string) (changes []Change, isInbox, notExists, alreadyExists bool, rerr error) {
 	if mbsrc.Name == "Inbox" || dst == "Inbox" {
 		return nil, true, false, false, fmt.Errorf("inbox cannot be renamed")
@@ -2698,6 +3266,9 @@ func (a *Account) MailboxRename(tx *bstore.Tx, mbsrc Mailbox, dst string) (chang
 		if srcmb.Name != mbsrc.Name && !strings.HasPrefix(srcmb.Name, srcPrefix) {
 			continue
 		}
+		if err := srcmb.CheckWritable(); err != nil {
+			return nil, false, false, false, fmt.Errorf("mailbox %q: %w", srcmb.Name, err)
+		}
 		srcName := srcmb.Name
 		dstName := dst + srcmb.Name[len(mbsrc.Name):]
 		if _, ok := mailboxes[dstName]; ok {
@@ -2736,10 +3307,16 @@ func (a *Account) MailboxRename(tx *bstore.Tx, mbsrc Mailbox, dst string) (chang
 }
 
 // MailboxDelete deletes a mailbox by ID, including its annotations. If it has
-// children, the return value indicates that and an error is returned.
+// children, the return value indicates that and an error is returned. A read-only
+// mailbox cannot be deleted, ErrMailboxReadOnly is returned.
 //
-// Caller should broadcast the changes and remove files for the removed message IDs.
-func (a *Account) MailboxDelete(ctx context.Context, log mlog.Log, tx *bstore.Tx, mailbox Mailbox) (changes []Change, removeMessageIDs []int64, hasChildren bool, rerr error) {
+// Caller should broadcast the changes and remove files for the removed messages,
+// except for messages stored in a pack file.
+func (a *Account) MailboxDelete(ctx context.Context, log mlog.Log, tx *bstore.Tx, mailbox Mailbox) (changes []Change, removeMessages []Message, hasChildren bool, rerr error) {
+	if err := mailbox.CheckWritable(); err != nil {
+		return nil, nil, false, err
+	}
+
 	// Look for existence of child mailboxes. There is a lot of text in the IMAP RFCs about
 	// NoInferior and NoSelect. We just require only leaf mailboxes are deleted.
 	qmb := bstore.QueryTx[Mailbox](tx)
@@ -2753,7 +3330,7 @@ func (a *Account) MailboxDelete(ctx context.Context, log mlog.Log, tx *bstore.Tx
 		return nil, nil, true, fmt.Errorf("mailbox has a child, only leaf mailboxes can be deleted")
 	}
 
-	// todo jmap: instead of completely deleting a mailbox and its messages, we need to mark them all as expunged.
+	// todo: instead of completely deleting a mailbox and its messages, we could mark them all as expunged.
 
 	qm := bstore.QueryTx[Message](tx)
 	qm.FilterNonzero(Message{MailboxID: mailbox.ID})
@@ -2772,6 +3349,11 @@ func (a *Account) MailboxDelete(ctx context.Context, log mlog.Log, tx *bstore.Tx
 		if _, err = qmr.Delete(); err != nil {
 			return nil, nil, false, fmt.Errorf("removing message recipients for messages: %v", err)
 		}
+		qti := bstore.QueryTx[TextIndex](tx)
+		qti.FilterEqual("ID", removeIDs...)
+		if _, err = qti.Delete(); err != nil {
+			return nil, nil, false, fmt.Errorf("removing text index for messages: %v", err)
+		}
 
 		qm = bstore.QueryTx[Message](tx)
 		qm.FilterNonzero(Message{MailboxID: mailbox.ID})
@@ -2779,10 +3361,25 @@ func (a *Account) MailboxDelete(ctx context.Context, log mlog.Log, tx *bstore.Tx
 			return nil, nil, false, fmt.Errorf("removing messages: %v", err)
 		}
 
+		// Clients synchronizing from an earlier modseq (IMAP QRESYNC, JMAP) can no longer
+		// learn about these removed messages.
+		modseq, err := a.NextModSeq(tx)
+		if err != nil {
+			return nil, nil, false, fmt.Errorf("assigning next modseq: %v", err)
+		}
+		ss := SyncState{ID: 1}
+		if err := tx.Get(&ss); err != nil {
+			return nil, nil, false, fmt.Errorf("get sync state: %v", err)
+		}
+		ss.HighestDeletedModSeq = modseq
+		if err := tx.Update(&ss); err != nil {
+			return nil, nil, false, fmt.Errorf("updating highest deleted modseq: %v", err)
+		}
+
 		var totalSize int64
 		for _, m := range remove {
 			if !m.Expunged {
-				removeMessageIDs = append(removeMessageIDs, m.ID)
+				removeMessages = append(removeMessages, m)
 				totalSize += m.Size
 			}
 		}
@@ -2817,7 +3414,7 @@ func (a *Account) MailboxDelete(ctx context.Context, log mlog.Log, tx *bstore.Tx
 	if err := tx.Delete(&Mailbox{ID: mailbox.ID}); err != nil {
 		return nil, nil, false, fmt.Errorf("removing mailbox: %v", err)
 	}
-	return []Change{ChangeRemoveMailbox{MailboxID: mailbox.ID, Name: mailbox.Name}}, removeMessageIDs, false, nil
+	return []Change{ChangeRemoveMailbox{MailboxID: mailbox.ID, Name: mailbox.Name}}, removeMessages, false, nil
 }
 
 // CheckMailboxName checks if name is valid, returning an INBOX-normalized name.
@@ -41,6 +41,13 @@ func TestMailbox(t *testing.T) {
 	os.RemoveAll("../testdata/store/data")
 	mox.ConfigStaticPath = filepath.FromSlash("../testdata/store/mox.conf")
 	mox.MustLoadConfig(true, false)
+	// For authentication lockouts.
+	err := Init(ctxbg)
+	tcheck(t, err, "store init")
+	defer func() {
+		err := Close()
+		tcheck(t, err, "store close")
+	}()
 	acc, err := OpenAccount(log, "mjl", false)
 	tcheck(t, err, "open account")
 	defer func() {
@@ -119,6 +126,18 @@ func TestMailbox(t *testing.T) {
 		})
 		tcheck(t, err, "deliver as sent and rejects")
 
+		// Recipients of the message in Sent are trusted senders.
+		tsl, err := acc.TrustedSenderList(ctxbg)
+		tcheck(t, err, "list trusted senders")
+		if len(tsl) != 1 || tsl[0].Localpart != "mjl" || tsl[0].Domain != "mox.example" || tsl[0].Count != 1 {
+			t.Fatalf("got trusted senders %v, expected mjl@mox.example", tsl)
+		}
+		err = acc.TrustedSenderRemove(ctxbg, tsl[0].ID)
+		tcheck(t, err, "remove trusted sender")
+		tsl, err = acc.TrustedSenderList(ctxbg)
+		tcheck(t, err, "list trusted senders")
+		tcompare(t, len(tsl), 0)
+
 		err = acc.DeliverDestination(pkglog, conf.Destinations["mjl"], &mconsumed, msgFile)
 		tcheck(t, err, "deliver with consume")
 
@@ -259,6 +278,33 @@ func TestMailbox(t *testing.T) {
 	if err != ErrUnknownCredentials {
 		t.Fatalf("got %v, expected ErrUnknownCredentials", err)
 	}
+
+	// Login tokens are accepted instead of the password, until they expire or are removed.
+	_, err = acc.LoginTokenAdd(ctxbg, "test", time.Now().Add(LoginTokenMaxLifetime+time.Minute))
+	if err == nil {
+		t.Fatalf("login token with too long lifetime accepted")
+	}
+	token, err := acc.LoginTokenAdd(ctxbg, "test", time.Now().Add(time.Hour))
+	tcheck(t, err, "add login token")
+	acc2, _, err = OpenEmailAuth(log, "mjl@mox.example", token, false)
+	tcheck(t, err, "open for email with login token")
+	err = acc2.Close()
+	tcheck(t, err, "close account")
+	_, _, err = OpenEmailAuth(log, "mjl@mox.example", token+"x", false)
+	if err != ErrUnknownCredentials {
+		t.Fatalf("got %v, expected ErrUnknownCredentials", err)
+	}
+	tokens, err := acc.LoginTokenList(ctxbg)
+	tcheck(t, err, "list login tokens")
+	if len(tokens) != 1 || tokens[0].LastUsed.IsZero() {
+		t.Fatalf("got tokens %v, expected 1 used token", tokens)
+	}
+	err = acc.LoginTokenRemove(ctxbg, tokens[0].ID)
+	tcheck(t, err, "remove login token")
+	_, _, err = OpenEmailAuth(log, "mjl@mox.example", token, false)
+	if err != ErrUnknownCredentials {
+		t.Fatalf("got %v, expected ErrUnknownCredentials", err)
+	}
 }
 
 func TestMessageRuleset(t *testing.T) {
@@ -309,3 +355,24 @@ test
 
 	// todo: test the SMTPMailFrom and VerifiedDomains rule.
 }
+
+func TestJunkFlagsForImport(t *testing.T) {
+	test := func(m Message, mb Mailbox, expJunk, expNotjunk bool) {
+		t.Helper()
+		m.JunkFlagsForImport(mb)
+		if m.Junk != expJunk || m.Notjunk != expNotjunk {
+			t.Fatalf("mailbox %q: got junk %v, notjunk %v, expected %v, %v", mb.Name, m.Junk, m.Notjunk, expJunk, expNotjunk)
+		}
+	}
+	test(Message{}, Mailbox{Name: "Spam"}, true, false)
+	test(Message{}, Mailbox{Name: "Junk E-mail"}, true, false)
+	test(Message{}, Mailbox{Name: "Bulk", SpecialUse: SpecialUse{Junk: true}}, true, false)
+	test(Message{}, Mailbox{Name: "Inbox"}, false, true)
+	test(Message{}, Mailbox{Name: "Archive/2024"}, false, true)
+	test(Message{}, Mailbox{Name: "Deleted Items"}, false, false)
+	test(Message{}, Mailbox{Name: "Bin", SpecialUse: SpecialUse{Trash: true}}, false, false)
+	test(Message{}, Mailbox{Name: "Drafts"}, false, false)
+	// Existing flags are kept.
+	test(Message{Flags: Flags{Notjunk: true}}, Mailbox{Name: "Spam"}, false, true)
+	test(Message{Flags: Flags{Junk: true}}, Mailbox{Name: "Inbox"}, true, false)
+}
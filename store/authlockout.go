@@ -0,0 +1,229 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/mjl-/bstore"
+
+	"github.com/mjl-/mox/metrics"
+	"github.com/mjl-/mox/mlog"
+)
+
+// Thresholds and durations for lockouts. Variables so tests can change them.
+var (
+	authLockoutIPFailures      = 20             // Consecutive failures from an IP before it is locked out.
+	authLockoutAccountFailures = 10             // Consecutive failures for an account before it is locked out.
+	authLockoutDuration        = time.Minute    // For the first failure at the threshold, doubled for each next failure.
+	authLockoutIPMax           = 24 * time.Hour // Maximum lockout for an IP.
+	authLockoutAccountMax      = time.Hour      // Maximum lockout for an account. Lower, third parties can trigger it.
+	authLockoutExpire          = 24 * time.Hour // Failure counters are reset after this period without failures.
+	authLockoutNow             = time.Now       // For tests.
+	authLockoutResults         = []AuthResult{AuthBadUser, AuthBadPassword, AuthBadCredentials, AuthBadChannelBinding}
+)
+
+// ErrAuthLockedOut is returned when authentication is refused due to too many
+// failed attempts from the remote IP or for the account.
+var ErrAuthLockedOut = errors.New("too many failed authentication attempts, try again later")
+
+// AuthLockout tracks consecutive failed authentication attempts from a remote IP
+// (for IPv6, its /64 network) or for an account, across all protocols. Once the
+// number of failures reaches a threshold, authentication is refused until a
+// lockout period has passed. Each further failure doubles the period, up to a
+// maximum. A successful authentication removes the records for the IP and
+// account. Attempts refused due to a lockout are not counted as failures, so a
+// lockout does not keep extending while clients keep retrying.
+//
+// Stored in the auth database, so lockouts survive restarts.
+type AuthLockout struct {
+	// "ip <ip>", "ip <ip>/64" or "account <name>".
+	Key string
+
+	First    time.Time `bstore:"nonzero,default now"`
+	Last     time.Time `bstore:"nonzero,default now,index"` // Of last failure.
+	Failures int       // Consecutive failures.
+	Until    time.Time // If in the future, authentication is refused. Zero if below threshold.
+}
+
+// authLockoutIPKey returns the key for a remote IP, with the /64 network for IPv6
+// addresses, since a single user typically has all addresses in a /64.
+func authLockoutIPKey(ip net.IP) string {
+	if ip4 := ip.To4(); ip4 != nil {
+		return "ip " + ip4.String()
+	}
+	return "ip " + ip.Mask(net.CIDRMask(64, 128)).String() + "/64"
+}
+
+func authLockoutAccountKey(accountName string) string {
+	return "account " + accountName
+}
+
+// AuthLockoutCheck returns ErrAuthLockedOut if authentication from remoteIP or for
+// accountName is currently refused due to too many failures. Either remoteIP or
+// accountName can be nil/empty to skip that check.
+func AuthLockoutCheck(ctx context.Context, remoteIP net.IP, accountName string) error {
+	var keys []string
+	if remoteIP != nil {
+		keys = append(keys, authLockoutIPKey(remoteIP))
+	}
+	if accountName != "" && accountName != "-" {
+		keys = append(keys, authLockoutAccountKey(accountName))
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+	now := authLockoutNow()
+	return AuthDB.Read(ctx, func(tx *bstore.Tx) error {
+		for _, k := range keys {
+			al := AuthLockout{Key: k}
+			if err := tx.Get(&al); err == bstore.ErrAbsent {
+				continue
+			} else if err != nil {
+				return fmt.Errorf("get auth lockout: %v", err)
+			}
+			if al.Until.After(now) {
+				return fmt.Errorf("%w (until %s)", ErrAuthLockedOut, al.Until.UTC().Format(time.RFC3339))
+			}
+		}
+		return nil
+	})
+}
+
+// authLockoutRecord updates the failure counters for the remote IP and account of
+// a login attempt, called for each login attempt. Admin logins only count for the
+// IP, so third parties cannot lock out the admin.
+func authLockoutRecord(ctx context.Context, log mlog.Log, a LoginAttempt) {
+	// Using an existing web session is not a login. Checking for counters to reset
+	// on each HTTP request would be too expensive, and expired sessions should not
+	// lock out an IP.
+	if a.AuthMech == "websession" {
+		return
+	}
+	success := a.Result == AuthSuccess
+	if !success && !slices.Contains(authLockoutResults, a.Result) {
+		return
+	}
+
+	var keys []string
+	if ip := net.ParseIP(a.RemoteIP); ip != nil {
+		keys = append(keys, authLockoutIPKey(ip))
+	}
+	if a.AccountName != "" && a.AccountName != "-" && a.AccountName != "(admin)" {
+		keys = append(keys, authLockoutAccountKey(a.AccountName))
+	}
+	if len(keys) == 0 {
+		return
+	}
+
+	if success {
+		// Most successful logins have nothing to reset, don't start a write transaction.
+		var present bool
+		err := AuthDB.Read(ctx, func(tx *bstore.Tx) error {
+			var err error
+			present, err = bstore.QueryTx[AuthLockout](tx).FilterIDs(keys).Exists()
+			return err
+		})
+		if err != nil {
+			log.Errorx("checking auth lockouts", err)
+			return
+		} else if !present {
+			return
+		}
+	}
+
+	now := authLockoutNow()
+	err := AuthDB.Write(ctx, func(tx *bstore.Tx) error {
+		for _, k := range keys {
+			al := AuthLockout{Key: k}
+			err := tx.Get(&al)
+			if err != nil && err != bstore.ErrAbsent {
+				return fmt.Errorf("get auth lockout: %v", err)
+			}
+			exists := err == nil
+
+			if success {
+				if exists {
+					if err := tx.Delete(&al); err != nil {
+						return fmt.Errorf("removing auth lockout: %v", err)
+					}
+				}
+				continue
+			}
+
+			if !exists || now.Sub(al.Last) > authLockoutExpire {
+				al = AuthLockout{Key: k, First: now}
+			}
+			al.Last = now
+			al.Failures++
+
+			threshold, maxDuration := authLockoutIPFailures, authLockoutIPMax
+			if strings.HasPrefix(k, "account ") {
+				threshold, maxDuration = authLockoutAccountFailures, authLockoutAccountMax
+			}
+			if al.Failures >= threshold {
+				d := authLockoutDuration
+				for i := threshold; i < al.Failures && d < maxDuration; i++ {
+					d *= 2
+				}
+				d = min(d, maxDuration)
+				al.Until = now.Add(d)
+				kind, _, _ := strings.Cut(k, " ")
+				metrics.AuthenticationLockoutInc(kind)
+				log.Info("authentication locked out due to many failures",
+					slog.String("key", k),
+					slog.Int("failures", al.Failures),
+					slog.Duration("duration", d),
+					slog.String("protocol", a.Protocol))
+			}
+
+			if exists {
+				err = tx.Update(&al)
+			} else {
+				err = tx.Insert(&al)
+			}
+			if err != nil {
+				return fmt.Errorf("storing auth lockout: %v", err)
+			}
+		}
+		return nil
+	})
+	log.Check(err, "updating auth lockouts")
+}
+
+// AuthLockoutList returns all failure counters, including those below the
+// threshold and expired lockouts, most recent failure first.
+func AuthLockoutList(ctx context.Context) ([]AuthLockout, error) {
+	return bstore.QueryDB[AuthLockout](ctx, AuthDB).SortDesc("Last").List()
+}
+
+// AuthLockoutRemove removes the failure counter with key, lifting any lockout.
+// Returns an error wrapping bstore.ErrAbsent if there is no such counter.
+func AuthLockoutRemove(ctx context.Context, log mlog.Log, key string) error {
+	if err := AuthDB.Delete(ctx, &AuthLockout{Key: key}); err != nil {
+		return fmt.Errorf("removing auth lockout: %w", err)
+	}
+	log.Info("auth lockout removed", slog.String("key", key))
+	return nil
+}
+
+// AuthLockoutCleanup removes failure counters that have expired and are not
+// locked out.
+func AuthLockoutCleanup(ctx context.Context) error {
+	now := authLockoutNow()
+	return AuthDB.Write(ctx, func(tx *bstore.Tx) error {
+		q := bstore.QueryTx[AuthLockout](tx)
+		q.FilterLess("Last", now.Add(-authLockoutExpire))
+		q.FilterFn(func(al AuthLockout) bool { return !al.Until.After(now) })
+		_, err := q.Delete()
+		if err != nil {
+			return fmt.Errorf("deleting expired auth lockouts: %v", err)
+		}
+		return nil
+	})
+}
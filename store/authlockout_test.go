@@ -0,0 +1,117 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mjl-/bstore"
+
+	"github.com/mjl-/mox/mox-"
+)
+
+func TestAuthLockout(t *testing.T) {
+	os.RemoveAll("../testdata/store/data")
+	mox.ConfigStaticPath = filepath.FromSlash("../testdata/store/mox.conf")
+	mox.MustLoadConfig(true, false)
+
+	xctx, xcancel := context.WithCancel(ctxbg)
+	err := Init(xctx)
+	tcheck(t, err, "store init")
+	xcancel()
+	<-writeLoginAttemptStopped
+	defer func() {
+		err := Close()
+		tcheck(t, err, "store close")
+	}()
+
+	now := time.Now()
+	authLockoutNow = func() time.Time { return now }
+	defer func() {
+		authLockoutNow = time.Now
+	}()
+
+	ip := net.ParseIP("192.0.2.1")
+	fail := func(accountName string) {
+		LoginAttemptAdd(ctxbg, pkglog, LoginAttempt{AccountName: accountName, RemoteIP: ip.String(), Protocol: "imap", AuthMech: "plain", Result: AuthBadCredentials})
+	}
+	xcheck := func(ip net.IP, accountName string, expLocked bool) {
+		t.Helper()
+		err := AuthLockoutCheck(ctxbg, ip, accountName)
+		if expLocked && !errors.Is(err, ErrAuthLockedOut) {
+			t.Fatalf("got err %v, expected lockout", err)
+		} else if !expLocked {
+			tcheck(t, err, "check lockout")
+		}
+	}
+
+	// Account is locked out after its threshold, IP not yet.
+	for range authLockoutAccountFailures {
+		xcheck(ip, "mjl", false)
+		fail("mjl")
+	}
+	xcheck(nil, "mjl", true)
+	xcheck(ip, "", false)
+	xcheck(ip, "other", false)
+
+	// Lockout ends after the lockout duration.
+	now = now.Add(authLockoutDuration + time.Second)
+	xcheck(ip, "mjl", false)
+
+	// Next failure doubles the duration.
+	fail("mjl")
+	al := AuthLockout{Key: "account mjl"}
+	err = AuthDB.Get(ctxbg, &al)
+	tcheck(t, err, "get lockout")
+	tcompare(t, al.Failures, authLockoutAccountFailures+1)
+	tcompare(t, al.Until.Equal(now.Add(2*authLockoutDuration)), true)
+
+	// Failures for unknown accounts only count for the IP. Attempts that are refused
+	// due to lockouts are not counted.
+	for range authLockoutIPFailures - authLockoutAccountFailures - 2 {
+		fail("-")
+	}
+	LoginAttemptAdd(ctxbg, pkglog, LoginAttempt{AccountName: "-", RemoteIP: ip.String(), Result: AuthLockedOut})
+	xcheck(ip, "", false)
+	fail("-")
+	xcheck(ip, "", true)
+	xcheck(net.ParseIP("192.0.2.2"), "", false)
+
+	// IPv6 addresses are locked out per /64.
+	ip6 := net.ParseIP("2001:db8::1")
+	for range authLockoutIPFailures {
+		LoginAttemptAdd(ctxbg, pkglog, LoginAttempt{RemoteIP: ip6.String(), Result: AuthBadPassword})
+	}
+	xcheck(net.ParseIP("2001:db8::2"), "", true)
+	xcheck(net.ParseIP("2001:db8:1::1"), "", false)
+
+	l, err := AuthLockoutList(ctxbg)
+	tcheck(t, err, "list lockouts")
+	tcompare(t, len(l), 3)
+
+	// Successful login resets counters for the IP and account.
+	LoginAttemptAdd(ctxbg, pkglog, LoginAttempt{AccountName: "mjl", RemoteIP: ip.String(), Result: AuthSuccess})
+	xcheck(ip, "mjl", false)
+
+	// Admin can remove lockouts.
+	err = AuthLockoutRemove(ctxbg, pkglog, "ip 2001:db8::/64")
+	tcheck(t, err, "remove lockout")
+	xcheck(ip6, "", false)
+	err = AuthLockoutRemove(ctxbg, pkglog, "ip 2001:db8::/64")
+	if !errors.Is(err, bstore.ErrAbsent) {
+		t.Fatalf("got err %v, expected ErrAbsent", err)
+	}
+
+	// Counters expire.
+	fail("mjl")
+	now = now.Add(authLockoutExpire + time.Second)
+	err = AuthLockoutCleanup(ctxbg)
+	tcheck(t, err, "cleanup")
+	l, err = AuthLockoutList(ctxbg)
+	tcheck(t, err, "list lockouts")
+	tcompare(t, len(l), 0)
+}
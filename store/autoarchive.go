@@ -0,0 +1,287 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"runtime/debug"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mjl-/bstore"
+
+	"github.com/mjl-/mox/metrics"
+	"github.com/mjl-/mox/mlog"
+	"github.com/mjl-/mox/mox-"
+)
+
+// Number of messages to move in a single transaction. Keeps the account
+// available for other operations while archiving many messages.
+const autoArchiveBatchSize = 1000
+
+// ErrAutoArchiveDisabled is returned by AutoArchive for accounts without
+// AutoArchive configured.
+var ErrAutoArchiveDisabled = errors.New("automatic archiving not enabled for account")
+
+// AutoArchiveStats is the result of Account.AutoArchive.
+type AutoArchiveStats struct {
+	Archived int // Messages moved to yearly archive mailboxes.
+}
+
+// AutoArchive moves messages received longer ago than the age configured in the
+// AutoArchive of the account from the configured mailboxes into yearly mailboxes
+// under the archive mailbox, e.g. "Archive/2023", creating them as needed. The
+// year is that of the received time of the message. Like moves by IMAP clients,
+// moved messages get a new UID in their new mailbox, and keep their flags,
+// keywords and thread.
+//
+// Must be called without holding the account lock.
+func (a *Account) AutoArchive(ctx context.Context, log mlog.Log) (stats AutoArchiveStats, err error) {
+	conf, _ := a.Conf()
+	aa := conf.AutoArchive
+	if aa == nil {
+		return stats, ErrAutoArchiveDisabled
+	}
+	sources := aa.Mailboxes
+	if len(sources) == 0 {
+		sources = []string{"Inbox"}
+	}
+	cutoff := time.Now().Add(-aa.Age)
+
+	for {
+		var changes []Change
+		var n int
+		a.WithWLock(func() {
+			err = a.DB.Write(ctx, func(tx *bstore.Tx) error {
+				var xchanges []Change
+				n, xchanges, err = a.autoArchiveBatch(ctx, log, tx, aa.Mailbox, sources, cutoff, aa.SkipUnread, aa.SkipFlagged)
+				changes = append(changes, xchanges...)
+				return err
+			})
+			if err == nil {
+				BroadcastChanges(a, changes)
+			}
+		})
+		if err != nil {
+			return stats, err
+		}
+		stats.Archived += n
+		if n < autoArchiveBatchSize {
+			break
+		}
+	}
+	return stats, nil
+}
+
+// autoArchiveBatch moves at most autoArchiveBatchSize messages to archive
+// mailboxes, returning the number of moved messages.
+func (a *Account) autoArchiveBatch(ctx context.Context, log mlog.Log, tx *bstore.Tx, archiveName string, sources []string, cutoff time.Time, skipUnread, skipFlagged bool) (int, []Change, error) {
+	if archiveName == "" {
+		mb, err := bstore.QueryTx[Mailbox](tx).FilterEqual("Archive", true).SortAsc("ID").Limit(1).Get()
+		if err == bstore.ErrAbsent {
+			archiveName = "Archive"
+		} else if err != nil {
+			return 0, nil, fmt.Errorf("looking up archive mailbox: %v", err)
+		} else {
+			archiveName = mb.Name
+		}
+	}
+
+	mailboxes := map[int64]*Mailbox{}
+	var sourceIDs []any
+	for _, name := range sources {
+		mb, err := a.MailboxFind(tx, name)
+		if err != nil {
+			return 0, nil, fmt.Errorf("looking up mailbox %q: %v", name, err)
+		}
+		// Messages are not moved out of read-only mailboxes.
+		if mb == nil || mb.Name == archiveName || strings.HasPrefix(mb.Name, archiveName+"/") || mb.CheckWritable() != nil {
+			continue
+		}
+		mailboxes[mb.ID] = mb
+		sourceIDs = append(sourceIDs, mb.ID)
+	}
+	if len(sourceIDs) == 0 {
+		return 0, nil, nil
+	}
+
+	// Nor into read-only yearly archive mailboxes.
+	readOnlyYears := map[int]bool{}
+	err := bstore.QueryTx[Mailbox](tx).FilterEqual("ReadOnly", true).ForEach(func(mb Mailbox) error {
+		if s, ok := strings.CutPrefix(mb.Name, archiveName+"/"); ok {
+			if year, err := strconv.Atoi(s); err == nil {
+				readOnlyYears[year] = true
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, nil, fmt.Errorf("listing read-only mailboxes: %v", err)
+	}
+
+	q := bstore.QueryTx[Message](tx)
+	q.FilterEqual("MailboxID", sourceIDs...)
+	q.FilterEqual("Expunged", false)
+	q.FilterLess("Received", cutoff)
+	q.FilterFn(func(m Message) bool {
+		return !(skipUnread && !m.Seen || skipFlagged && m.Flagged || readOnlyYears[m.Received.Year()])
+	})
+	q.SortAsc("Received")
+	q.Limit(autoArchiveBatchSize)
+	msgs, err := q.List()
+	if err != nil {
+		return 0, nil, fmt.Errorf("listing messages to archive: %v", err)
+	}
+	if len(msgs) == 0 {
+		return 0, nil, nil
+	}
+
+	modseq, err := a.NextModSeq(tx)
+	if err != nil {
+		return 0, nil, fmt.Errorf("assigning next modseq: %v", err)
+	}
+	conf, _ := a.Conf()
+	now := time.Now()
+
+	var changes []Change
+	removeChanges := map[int64]ChangeRemoveUIDs{}
+	destinations := map[int]*Mailbox{}
+	changed := map[int64]*Mailbox{} // Source and destination mailboxes with changed counts.
+	keywords := map[int64][]string{}
+	var retrain []Message
+	for _, m := range msgs {
+		year := m.Received.Year()
+		mbDst := destinations[year]
+		if mbDst == nil {
+			mb, xchanges, err := a.MailboxEnsure(tx, archiveName+"/"+strconv.Itoa(year), true)
+			if err != nil {
+				return 0, nil, fmt.Errorf("ensuring archive mailbox: %v", err)
+			}
+			changes = append(changes, xchanges...)
+			mbDst = &mb
+			destinations[year] = mbDst
+			mailboxes[mbDst.ID] = mbDst
+		}
+		mbSrc := mailboxes[m.MailboxID]
+		changed[mbSrc.ID] = mbSrc
+		changed[mbDst.ID] = mbDst
+
+		ch := removeChanges[m.MailboxID]
+		ch.MailboxID = m.MailboxID
+		ch.UIDs = append(ch.UIDs, m.UID)
+		ch.ModSeq = modseq
+		removeChanges[m.MailboxID] = ch
+
+		// Copy of message record that we'll insert when UID is freed up.
+		om := m
+		om.PrepareExpunge()
+		om.ID = 0 // Assign new ID.
+		om.ModSeq = modseq
+
+		mbSrc.Sub(m.MailboxCounts())
+		m.MailboxID = mbDst.ID
+		m.UID = mbDst.UIDNext
+		m.SaveDate = &now
+		m.ModSeq = modseq
+		mbDst.UIDNext++
+		m.JunkFlagsForMailbox(*mbDst, conf)
+		if err := tx.Update(&m); err != nil {
+			return 0, nil, fmt.Errorf("updating moved message: %v", err)
+		}
+		if err := tx.Insert(&om); err != nil {
+			return 0, nil, fmt.Errorf("inserting record for expunge after moving message: %v", err)
+		}
+		mbDst.Add(m.MailboxCounts())
+		keywords[mbDst.ID] = append(keywords[mbDst.ID], m.Keywords...)
+
+		changes = append(changes, m.ChangeAddUID())
+		if m.NeedsTraining() {
+			retrain = append(retrain, m)
+		}
+	}
+
+	for _, mb := range changed {
+		if kw, ok := keywords[mb.ID]; ok {
+			var kwChanged bool
+			mb.Keywords, kwChanged = MergeKeywords(mb.Keywords, kw)
+			if kwChanged {
+				changes = append(changes, mb.ChangeKeywords())
+			}
+		}
+		if err := tx.Update(mb); err != nil {
+			return 0, nil, fmt.Errorf("updating mailbox %q: %v", mb.Name, err)
+		}
+		changes = append(changes, mb.ChangeCounts())
+	}
+
+	if err := a.RetrainMessages(ctx, log, tx, retrain, false); err != nil {
+		return 0, nil, fmt.Errorf("retraining messages after archiving: %v", err)
+	}
+
+	for _, ch := range removeChanges {
+		slices.Sort(ch.UIDs)
+		changes = append(changes, ch)
+	}
+	return len(msgs), changes, nil
+}
+
+// StartAutoArchiver starts a goroutine that runs AutoArchive once a day for
+// accounts with AutoArchive configured.
+func StartAutoArchiver(ctx context.Context) {
+	log := mlog.New("store", nil)
+
+	go func() {
+		defer func() {
+			x := recover()
+			if x == nil {
+				return
+			}
+
+			log.Error("unhandled panic in auto archiver", slog.Any("err", x))
+			debug.PrintStack()
+			metrics.PanicInc(metrics.Store)
+		}()
+
+		// Wait a bit after startup, we don't want to slow it down.
+		t := time.NewTimer(time.Hour)
+		defer t.Stop()
+		for {
+			select {
+			case <-t.C:
+			case <-ctx.Done():
+				return
+			}
+
+			for _, accName := range mox.Conf.Accounts() {
+				if conf, ok := mox.Conf.Account(accName); !ok || conf.AutoArchive == nil {
+					continue
+				}
+				autoArchiveAccount(ctx, log, accName)
+			}
+			t.Reset(24 * time.Hour)
+		}
+	}()
+}
+
+func autoArchiveAccount(ctx context.Context, log mlog.Log, accName string) {
+	log = log.With(slog.String("account", accName))
+	acc, err := OpenAccount(log, accName, false)
+	if err != nil {
+		log.Errorx("open account for auto archiving", err)
+		return
+	}
+	defer func() {
+		err := acc.Close()
+		log.Check(err, "closing account after auto archiving")
+	}()
+	stats, err := acc.AutoArchive(ctx, log)
+	if err != nil {
+		log.Errorx("auto archiving", err)
+	}
+	if stats.Archived > 0 {
+		log.Info("auto archiving done", slog.Int("archived", stats.Archived))
+	}
+}
@@ -0,0 +1,146 @@
+package store
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mjl-/bstore"
+
+	"github.com/mjl-/mox/config"
+	"github.com/mjl-/mox/mox-"
+)
+
+func TestAutoArchive(t *testing.T) {
+	log := pkglog
+	os.RemoveAll("../testdata/store/data")
+	mox.ConfigStaticPath = filepath.FromSlash("../testdata/store/mox.conf")
+	mox.MustLoadConfig(true, false)
+	acc, err := OpenAccount(log, "mjl", false)
+	tcheck(t, err, "open account")
+	defer func() {
+		err = acc.Close()
+		tcheck(t, err, "closing account")
+		acc.CheckClosed()
+	}()
+	defer Switchboard()()
+
+	deliver := func(mailbox string, received time.Time, flags Flags, keywords []string) Message {
+		t.Helper()
+		msgFile, err := CreateMessageTemp(log, "autoarchive-test")
+		tcheck(t, err, "temp message file")
+		defer CloseRemoveTempFile(log, msgFile, "test message")
+		msg := "From: <mjl@mox.example>\r\nSubject: test\r\n\r\ntest\r\n"
+		_, err = msgFile.Write([]byte(msg))
+		tcheck(t, err, "write message")
+		m := Message{Received: received, Size: int64(len(msg)), Flags: flags, Keywords: keywords}
+		acc.WithWLock(func() {
+			err := acc.DeliverMailbox(log, mailbox, &m, msgFile)
+			tcheck(t, err, "deliver")
+		})
+		return m
+	}
+	getMsg := func(id int64) Message {
+		t.Helper()
+		m := Message{ID: id}
+		err := acc.DB.Get(ctxbg, &m)
+		tcheck(t, err, "get message")
+		return m
+	}
+	mailboxName := func(id int64) string {
+		t.Helper()
+		mb := Mailbox{ID: id}
+		err := acc.DB.Get(ctxbg, &mb)
+		tcheck(t, err, "get mailbox")
+		return mb.Name
+	}
+
+	_, err = acc.AutoArchive(ctxbg, log)
+	tcompare(t, err, ErrAutoArchiveDisabled)
+
+	old2021 := time.Date(2021, 6, 1, 12, 0, 0, 0, time.Local)
+	old2022 := time.Date(2022, 6, 1, 12, 0, 0, 0, time.Local)
+	m0 := deliver("Inbox", old2021, Flags{Seen: true, Answered: true}, []string{"custom"})
+	m1 := deliver("Inbox", old2022, Flags{Seen: true}, nil)
+	m2 := deliver("Inbox", old2022, Flags{}, nil) // Unread, skipped.
+	m3 := deliver("Inbox", time.Now(), Flags{Seen: true}, nil)
+	m4 := deliver("Other", old2021, Flags{Seen: true}, nil) // Not configured.
+
+	accConf, _ := acc.Conf()
+	accConf.AutoArchive = &config.AutoArchive{Age: 30 * 24 * time.Hour, SkipUnread: true}
+	mox.Conf.Dynamic.Accounts["mjl"] = accConf
+	defer func() {
+		accConf.AutoArchive = nil
+		mox.Conf.Dynamic.Accounts["mjl"] = accConf
+	}()
+
+	stats, err := acc.AutoArchive(ctxbg, log)
+	tcheck(t, err, "auto archive")
+	tcompare(t, stats, AutoArchiveStats{Archived: 2})
+
+	xm0 := getMsg(m0.ID)
+	tcompare(t, mailboxName(xm0.MailboxID), "Archive/2021")
+	tcompare(t, xm0.Flags, m0.Flags)
+	tcompare(t, xm0.Keywords, []string{"custom"})
+	tcompare(t, xm0.ThreadID, m0.ThreadID)
+	tcompare(t, mailboxName(getMsg(m1.ID).MailboxID), "Archive/2022")
+	tcompare(t, mailboxName(getMsg(m2.ID).MailboxID), "Inbox")
+	tcompare(t, mailboxName(getMsg(m3.ID).MailboxID), "Inbox")
+	tcompare(t, mailboxName(getMsg(m4.ID).MailboxID), "Other")
+
+	// Archive mailbox got the keyword, and new mailboxes are subscribed.
+	mb, err := bstore.QueryDB[Mailbox](ctxbg, acc.DB).FilterNonzero(Mailbox{Name: "Archive/2021"}).Get()
+	tcheck(t, err, "get archive mailbox")
+	tcompare(t, mb.Keywords, []string{"custom"})
+	tcompare(t, mb.MailboxCounts, MailboxCounts{Total: 1, Size: m0.Size})
+	err = acc.DB.Get(ctxbg, &Subscription{"Archive/2021"})
+	tcheck(t, err, "get subscription")
+
+	// Nothing more to do.
+	stats, err = acc.AutoArchive(ctxbg, log)
+	tcheck(t, err, "auto archive")
+	tcompare(t, stats, AutoArchiveStats{})
+
+	// Configured archive mailbox, and more source mailboxes.
+	accConf.AutoArchive = &config.AutoArchive{Age: 30 * 24 * time.Hour, Mailboxes: []string{"Inbox", "Other"}, Mailbox: "Old"}
+	mox.Conf.Dynamic.Accounts["mjl"] = accConf
+	stats, err = acc.AutoArchive(ctxbg, log)
+	tcheck(t, err, "auto archive")
+	tcompare(t, stats, AutoArchiveStats{Archived: 2})
+	tcompare(t, mailboxName(getMsg(m2.ID).MailboxID), "Old/2022")
+	tcompare(t, mailboxName(getMsg(m4.ID).MailboxID), "Old/2021")
+
+	// Messages are not moved out of read-only mailboxes, nor into read-only archive
+	// mailboxes.
+	setReadOnly := func(name string, readOnly bool) {
+		t.Helper()
+		err := acc.DB.Write(ctxbg, func(tx *bstore.Tx) error {
+			mb, err := acc.MailboxFind(tx, name)
+			if err != nil {
+				return err
+			}
+			mb.ReadOnly = readOnly
+			return tx.Update(mb)
+		})
+		tcheck(t, err, "setting mailbox read-only")
+	}
+	m5 := deliver("Inbox", old2021, Flags{Seen: true}, nil)
+	m6 := deliver("Other", old2022, Flags{Seen: true}, nil)
+	setReadOnly("Old/2021", true)
+	setReadOnly("Other", true)
+	stats, err = acc.AutoArchive(ctxbg, log)
+	tcheck(t, err, "auto archive")
+	tcompare(t, stats, AutoArchiveStats{})
+	tcompare(t, mailboxName(getMsg(m5.ID).MailboxID), "Inbox")
+	tcompare(t, mailboxName(getMsg(m6.ID).MailboxID), "Other")
+	setReadOnly("Other", false)
+	stats, err = acc.AutoArchive(ctxbg, log)
+	tcheck(t, err, "auto archive")
+	tcompare(t, stats, AutoArchiveStats{Archived: 1})
+	tcompare(t, mailboxName(getMsg(m5.ID).MailboxID), "Inbox")
+	tcompare(t, mailboxName(getMsg(m6.ID).MailboxID), "Old/2022")
+
+	err = acc.CheckConsistency()
+	tcheck(t, err, "check consistency")
+}
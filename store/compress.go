@@ -0,0 +1,277 @@
+package store
+
+// Message files can be stored gzip-compressed, for accounts with
+// MessageCompression configured (possibly through the global configuration). New
+// messages are compressed at delivery, existing messages with
+// Account.CompressMessages. The size of the compressed file is stored in
+// Message.CompressedSize, Message.Size remains the size of the uncompressed
+// message. Compressed messages are decompressed into memory when read.
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+
+	"github.com/mjl-/bstore"
+
+	"github.com/mjl-/mox/mlog"
+	"github.com/mjl-/mox/mox-"
+)
+
+const (
+	// Defaults for MessageCompression.MinMessageSize and MaxMessageSize.
+	compressMinMessageSizeDefault = 4096
+	compressMaxMessageSizeDefault = 1024 * 1024
+
+	// Number of candidate messages to fetch from the database at a time.
+	compressBatchSize = 1000
+)
+
+// messageCompression returns the range of sizes of message files that are
+// stored compressed. The MessageCompression of the account takes precedence over
+// the global configuration. If compression is not enabled, ok is false.
+func (a *Account) messageCompression() (minSize, maxSize int64, ok bool) {
+	conf, _ := a.Conf()
+	mc := conf.MessageCompression
+	if mc == nil {
+		mc = mox.Conf.Static.MessageCompression
+	}
+	if mc == nil || mc.Disabled {
+		return 0, 0, false
+	}
+	minSize, maxSize = mc.MinMessageSize, mc.MaxMessageSize
+	if minSize == 0 {
+		minSize = compressMinMessageSizeDefault
+	}
+	if maxSize == 0 {
+		maxSize = compressMaxMessageSizeDefault
+	}
+	return minSize, maxSize, true
+}
+
+// writeCompressed writes the gzip-compressed data of r, which must be size
+// bytes, to a new file at path p, and returns the size of the compressed file.
+// If compression doesn't make the file smaller, no file is written and 0 is
+// returned.
+func writeCompressed(log mlog.Log, p string, r io.Reader, size int64, sync bool) (compressedSize int64, rerr error) {
+	f, err := os.OpenFile(p, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0660)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if f != nil {
+			err := f.Close()
+			log.Check(err, "closing compressed message file")
+		}
+		if rerr != nil || compressedSize == 0 {
+			err := os.Remove(p)
+			log.Check(err, "removing compressed message file", slog.String("path", p))
+		}
+	}()
+
+	compressedSize, err = compressTo(f, r, size)
+	if err != nil || compressedSize == 0 {
+		return 0, err
+	}
+	if sync {
+		if err := f.Sync(); err != nil {
+			return 0, fmt.Errorf("sync compressed message file: %v", err)
+		}
+	}
+	err = f.Close()
+	f = nil
+	if err != nil {
+		return 0, fmt.Errorf("closing compressed message file: %v", err)
+	}
+	return compressedSize, nil
+}
+
+// compressTo writes the gzip-compressed data of r, which must be size bytes, to
+// w. If the compressed data is not smaller than the original, 0 is returned and
+// the data written to w should not be used.
+func compressTo(w io.Writer, r io.Reader, size int64) (int64, error) {
+	bw := bufio.NewWriter(w)
+	cw := &countWriter{w: bw}
+	gzw := gzip.NewWriter(cw)
+	if n, err := io.Copy(gzw, r); err != nil {
+		return 0, fmt.Errorf("compressing message: %v", err)
+	} else if n != size {
+		return 0, fmt.Errorf("compressed %d bytes, expected message size %d", n, size)
+	}
+	if err := gzw.Close(); err != nil {
+		return 0, fmt.Errorf("compressing message: %v", err)
+	}
+	if cw.n >= size {
+		return 0, nil
+	}
+	if err := bw.Flush(); err != nil {
+		return 0, fmt.Errorf("writing compressed message: %v", err)
+	}
+	return cw.n, nil
+}
+
+// readCompressed reads the gzip-compressed message file f of size bytes, and
+// returns the decompressed data, which must be dataSize bytes.
+func readCompressed(f io.ReaderAt, size, dataSize int64) ([]byte, error) {
+	gzr, err := gzip.NewReader(io.NewSectionReader(f, 0, size))
+	if err != nil {
+		return nil, fmt.Errorf("gzip reader: %w", err)
+	}
+	defer gzr.Close()
+	buf := make([]byte, dataSize)
+	if _, err := io.ReadFull(gzr, buf); err != nil {
+		return nil, fmt.Errorf("decompressing message data: %w", err)
+	}
+	if n, err := gzr.Read(make([]byte, 1)); n > 0 || err != io.EOF {
+		return nil, fmt.Errorf("decompressed message data larger than expected size %d", dataSize)
+	}
+	return buf, nil
+}
+
+// ErrCompressionDisabled is returned by CompressMessages for accounts without
+// message compression.
+var ErrCompressionDisabled = errors.New("message compression not enabled for account")
+
+// CompressMessagesStats is the result of Account.CompressMessages.
+type CompressMessagesStats struct {
+	Compressed     int   // Messages whose file was replaced with a compressed file.
+	Size           int64 // Total size of the files before compression.
+	CompressedSize int64 // Total size of the compressed files.
+	Skipped        int   // Messages not compressed because compression didn't save space.
+}
+
+// CompressMessages compresses the files of existing messages, for accounts with
+// message compression enabled. Messages that are already compressed, are stored
+// in a pack file, are encrypted, or have a size outside the configured range are
+// skipped. Copies
+// of a message that share a file each get their own compressed file.
+//
+// Must be called without holding the account lock.
+func (a *Account) CompressMessages(ctx context.Context, log mlog.Log) (stats CompressMessagesStats, rerr error) {
+	a.packMutex.Lock()
+	defer a.packMutex.Unlock()
+
+	minSize, maxSize, ok := a.messageCompression()
+	if !ok {
+		return stats, ErrCompressionDisabled
+	}
+
+	var lastID int64
+	for {
+		var msgs []Message
+		err := a.DB.Read(ctx, func(tx *bstore.Tx) error {
+			q := bstore.QueryTx[Message](tx)
+			q.FilterEqual("Expunged", false)
+			q.FilterEqual("PackID", int64(0))
+			q.FilterEqual("CompressedSize", int64(0))
+			q.FilterEqual("Encrypted", false)
+			q.FilterGreater("ID", lastID)
+			q.FilterFn(func(m Message) bool {
+				size := m.Size - int64(len(m.MsgPrefix))
+				return size >= minSize && size <= maxSize
+			})
+			q.SortAsc("ID")
+			q.Limit(compressBatchSize)
+			var err error
+			msgs, err = q.List()
+			return err
+		})
+		if err != nil {
+			return stats, fmt.Errorf("listing messages to compress: %v", err)
+		}
+		if len(msgs) == 0 {
+			break
+		}
+		for _, m := range msgs {
+			if err := a.compressMessage(ctx, log, m, &stats); err != nil {
+				return stats, fmt.Errorf("compressing message %d: %v", m.ID, err)
+			}
+		}
+		lastID = msgs[len(msgs)-1].ID
+	}
+	return stats, nil
+}
+
+// compressMessage writes a compressed copy of the file for m to a temporary
+// file, and replaces the message file with it if the message hasn't changed in
+// the mean time.
+func (a *Account) compressMessage(ctx context.Context, log mlog.Log, m Message, stats *CompressMessagesStats) error {
+	p := a.MessagePath(m.ID)
+	mf, err := os.Open(p)
+	if err != nil {
+		// Message may have been removed in the mean time.
+		log.Debugx("opening message file for compressing, skipping", err, slog.Int64("msgid", m.ID))
+		return nil
+	}
+	defer func() {
+		err := mf.Close()
+		log.Check(err, "closing message file after compressing")
+	}()
+	st, err := mf.Stat()
+	if err != nil {
+		return fmt.Errorf("stat message file: %v", err)
+	}
+	if int64(len(m.MsgPrefix))+st.Size() != m.Size {
+		log.Error("message size does not match message file, not compressing, see mox fixmsgsize", slog.Int64("msgid", m.ID), slog.Int64("size", m.Size), slog.Int("prefixsize", len(m.MsgPrefix)), slog.Int64("filesize", st.Size()))
+		return nil
+	}
+
+	f, err := CreateMessageTemp(log, "compress")
+	if err != nil {
+		return fmt.Errorf("creating temporary file: %v", err)
+	}
+	defer func() {
+		if f != nil {
+			CloseRemoveTempFile(log, f, "compressed message")
+		}
+	}()
+
+	size, err := compressTo(f, mf, st.Size())
+	if err != nil {
+		return err
+	}
+	if size == 0 {
+		stats.Skipped++
+		return nil
+	}
+	if err := f.Sync(); err != nil {
+		return fmt.Errorf("sync compressed file: %v", err)
+	}
+
+	var rerr error
+	a.WithWLock(func() {
+		rerr = a.DB.Write(ctx, func(tx *bstore.Tx) error {
+			xm := Message{ID: m.ID}
+			if err := tx.Get(&xm); err == bstore.ErrAbsent {
+				return nil
+			} else if err != nil {
+				return fmt.Errorf("get message: %v", err)
+			}
+			if xm.Expunged || xm.PackID != 0 || xm.CompressedSize != 0 || xm.Encrypted {
+				return nil
+			}
+			xm.CompressedSize = size
+			if err := tx.Update(&xm); err != nil {
+				return fmt.Errorf("updating message: %v", err)
+			}
+			// The message file may be shared with copies of the message, so we replace it
+			// instead of writing to it.
+			if err := os.Rename(f.Name(), p); err != nil {
+				return fmt.Errorf("replacing message file: %v", err)
+			}
+			err := f.Close()
+			log.Check(err, "closing compressed message file")
+			f = nil
+			stats.Compressed++
+			stats.Size += st.Size()
+			stats.CompressedSize += size
+			return nil
+		})
+	})
+	return rerr
+}
@@ -0,0 +1,147 @@
+package store
+
+import (
+	cryptorand "crypto/rand"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mjl-/mox/config"
+	"github.com/mjl-/mox/mox-"
+)
+
+func TestCompressMessages(t *testing.T) {
+	log := pkglog
+	os.RemoveAll("../testdata/store/data")
+	mox.ConfigStaticPath = filepath.FromSlash("../testdata/store/mox.conf")
+	mox.MustLoadConfig(true, false)
+	acc, err := OpenAccount(log, "mjl", false)
+	tcheck(t, err, "open account")
+	defer func() {
+		err = acc.Close()
+		tcheck(t, err, "closing account")
+		acc.CheckClosed()
+	}()
+	defer Switchboard()()
+
+	prefix := []byte("Received: from localhost\r\n")
+	deliver := func(body string) Message {
+		t.Helper()
+		msgFile, err := CreateMessageTemp(log, "compress-test")
+		tcheck(t, err, "temp message file")
+		defer CloseRemoveTempFile(log, msgFile, "test message")
+		_, err = msgFile.Write([]byte(body))
+		tcheck(t, err, "write message")
+		m := Message{
+			Received:  time.Now(),
+			Size:      int64(len(prefix)) + int64(len(body)),
+			MsgPrefix: prefix,
+		}
+		acc.WithWLock(func() {
+			err := acc.DeliverMailbox(log, "Inbox", &m, msgFile)
+			tcheck(t, err, "deliver")
+		})
+		return m
+	}
+	msg := func(subject string, size int) string {
+		s := fmt.Sprintf("Subject: %s\r\n\r\n", subject)
+		return s + strings.Repeat("hello world\r\n", size/13)
+	}
+	getMsg := func(id int64) Message {
+		t.Helper()
+		m := Message{ID: id}
+		err := acc.DB.Get(ctxbg, &m)
+		tcheck(t, err, "get message")
+		return m
+	}
+	checkData := func(m Message, body string) {
+		t.Helper()
+		mr := acc.MessageReader(m)
+		defer mr.Close()
+		tcompare(t, mr.Size(), m.Size)
+		buf, err := io.ReadAll(mr)
+		tcheck(t, err, "read message")
+		tcompare(t, string(buf), string(prefix)+body)
+
+		buf = make([]byte, 5)
+		_, err = mr.ReadAt(buf, int64(len(prefix))+9)
+		tcheck(t, err, "readat message")
+		tcompare(t, string(buf), body[9:14])
+	}
+	fileSize := func(m Message) int64 {
+		t.Helper()
+		st, err := os.Stat(acc.MessagePath(m.ID))
+		tcheck(t, err, "stat message file")
+		return st.Size()
+	}
+
+	// Without compression configured, messages are stored as is.
+	m1 := deliver(msg("first", 1000))
+	tcompare(t, getMsg(m1.ID).CompressedSize, int64(0))
+	_, err = acc.CompressMessages(ctxbg, log)
+	tcompare(t, err, ErrCompressionDisabled)
+
+	accConf, _ := acc.Conf()
+	accConf.MessageCompression = &config.MessageCompression{MinMessageSize: 100, MaxMessageSize: 1500}
+	mox.Conf.Dynamic.Accounts["mjl"] = accConf
+	defer func() {
+		accConf.MessageCompression = nil
+		mox.Conf.Dynamic.Accounts["mjl"] = accConf
+	}()
+
+	// New messages within the size range are compressed at delivery.
+	m2 := deliver(msg("second", 1000))
+	msmall := deliver(msg("small", 50))
+	mlarge := deliver(msg("large", 2000))
+	xm2 := getMsg(m2.ID)
+	if xm2.CompressedSize == 0 || xm2.CompressedSize != fileSize(xm2) {
+		t.Fatalf("new message not compressed, compressed size %d, file size %d", xm2.CompressedSize, fileSize(xm2))
+	}
+	tcompare(t, xm2.Size, m2.Size)
+	checkData(xm2, msg("second", 1000))
+	tcompare(t, getMsg(msmall.ID).CompressedSize, int64(0))
+	tcompare(t, getMsg(mlarge.ID).CompressedSize, int64(0))
+
+	// Existing message is compressed, others are left alone.
+	stats, err := acc.CompressMessages(ctxbg, log)
+	tcheck(t, err, "compress messages")
+	xm1 := getMsg(m1.ID)
+	tcompare(t, stats, CompressMessagesStats{Compressed: 1, Size: m1.Size - int64(len(prefix)), CompressedSize: xm1.CompressedSize})
+	tcompare(t, fileSize(xm1), xm1.CompressedSize)
+	checkData(xm1, msg("first", 1000))
+	checkData(getMsg(mlarge.ID), msg("large", 2000))
+
+	// Nothing more to do.
+	stats, err = acc.CompressMessages(ctxbg, log)
+	tcheck(t, err, "compress messages")
+	tcompare(t, stats, CompressMessagesStats{})
+
+	// Messages with data that doesn't compress are stored as is.
+	random := make([]byte, 200)
+	cryptorand.Read(random)
+	mrandom := deliver("Subject: random\r\n\r\n" + string(random))
+	tcompare(t, getMsg(mrandom.ID).CompressedSize, int64(0))
+
+	// Packing a compressed message stores its uncompressed data.
+	accConf.ArchiveTier = &config.ArchiveTier{Age: time.Nanosecond}
+	mox.Conf.Dynamic.Accounts["mjl"] = accConf
+	_, err = acc.ArchivePack(ctxbg, log)
+	tcheck(t, err, "archive pack")
+	accConf.ArchiveTier = nil
+	mox.Conf.Dynamic.Accounts["mjl"] = accConf
+	xm1 = getMsg(m1.ID)
+	if xm1.PackID == 0 || xm1.CompressedSize != 0 {
+		t.Fatalf("compressed message not packed, pack id %d, compressed size %d", xm1.PackID, xm1.CompressedSize)
+	}
+	checkData(xm1, msg("first", 1000))
+
+	// Corrupt data is detected.
+	_, err = readCompressed(strings.NewReader("not gzip"), 8, 100)
+	if err == nil {
+		t.Fatalf("reading invalid compressed data succeeded")
+	}
+}
@@ -0,0 +1,139 @@
+package store
+
+// Message files with identical data can be stored once, shared between messages
+// in mailboxes of one or more accounts, with DeduplicateMessages configured. The
+// "msgstore" directory in the data directory holds a file for each distinct
+// message data, named after its SHA-256 hash. Message files of accounts are
+// hardlinks to those files. The number of links to a file is its reference count:
+// One for the name in msgstore, and one for each message file. Message files are
+// never modified, only replaced or removed, so sharing them is safe. Files in
+// msgstore that are no longer referenced by message files are removed by
+// MessageStoreCleanup.
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/mjl-/mox/mlog"
+	"github.com/mjl-/mox/mox-"
+	"github.com/mjl-/mox/moxio"
+)
+
+// Serializes adding links to files in msgstore with removing unreferenced files.
+var msgstoreMutex sync.Mutex
+
+// messageStorePath returns the path in the msgstore directory for message data
+// with the hex-encoded hash.
+func messageStorePath(hash string) string {
+	return mox.DataDirPath(filepath.Join("msgstore", hash[:2], hash))
+}
+
+// dedupLink makes a hardlink at dst to the file in msgstore with the same data as
+// f, adding the data of f to msgstore if not yet present. If deduplication is not
+// enabled, or the file system does not support hardlinks, false is returned and
+// the caller should store the message file itself.
+func dedupLink(log mlog.Log, dst string, f *os.File, sync bool) (bool, error) {
+	if !mox.Conf.Static.DeduplicateMessages {
+		return false, nil
+	}
+
+	st, err := f.Stat()
+	if err != nil {
+		return false, fmt.Errorf("stat message file: %v", err)
+	}
+	h := sha256.New()
+	if _, err := io.Copy(h, &moxio.AtReader{R: f}); err != nil {
+		return false, fmt.Errorf("hashing message file: %v", err)
+	}
+	hash := hex.EncodeToString(h.Sum(nil))
+	p := messageStorePath(hash)
+
+	msgstoreMutex.Lock()
+	defer msgstoreMutex.Unlock()
+
+	if xst, err := os.Stat(p); err == nil {
+		if xst.Size() != st.Size() {
+			return false, fmt.Errorf("file in msgstore with same hash has different size %d, expected %d", xst.Size(), st.Size())
+		}
+		if err := os.Link(p, dst); err != nil {
+			return false, fmt.Errorf("linking message file from msgstore: %v", err)
+		}
+		log.Debug("message data already present in msgstore", slog.String("hash", hash))
+		return true, nil
+	} else if !os.IsNotExist(err) {
+		return false, fmt.Errorf("stat file in msgstore: %v", err)
+	}
+
+	dir := filepath.Dir(p)
+	os.MkdirAll(dir, 0770)
+	if err := os.Link(f.Name(), p); err != nil {
+		// Likely no hardlink support, or the temporary file is on another file system.
+		log.Debugx("adding message file to msgstore, storing separately", err)
+		return false, nil
+	}
+	if sync {
+		if err := moxio.SyncDir(log, dir); err != nil {
+			xerr := os.Remove(p)
+			log.Check(xerr, "removing file from msgstore after syncdir error", slog.String("path", p))
+			return false, fmt.Errorf("sync msgstore directory: %v", err)
+		}
+	}
+	if err := os.Link(p, dst); err != nil {
+		xerr := os.Remove(p)
+		log.Check(xerr, "removing file from msgstore after error", slog.String("path", p))
+		return false, fmt.Errorf("linking message file from msgstore: %v", err)
+	}
+	return true, nil
+}
+
+// MessageStoreCleanup removes files from the msgstore directory that are no
+// longer referenced by any message file, i.e. that have no other hardlinks.
+// Unreferenced files remain if the number of links of a file cannot be determined,
+// e.g. on Windows.
+func MessageStoreCleanup(ctx context.Context, log mlog.Log) (removed int, rerr error) {
+	dir := mox.DataDirPath("msgstore")
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if p == dir && os.IsNotExist(err) {
+				return fs.SkipDir
+			}
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		msgstoreMutex.Lock()
+		defer msgstoreMutex.Unlock()
+
+		fi, err := os.Stat(p)
+		if err != nil {
+			return fmt.Errorf("stat: %v", err)
+		}
+		if n, ok := moxio.LinkCount(fi); !ok {
+			return fs.SkipAll
+		} else if n > 1 {
+			return nil
+		}
+		if err := os.Remove(p); err != nil {
+			return fmt.Errorf("removing unreferenced file: %v", err)
+		}
+		removed++
+		return nil
+	})
+	if err != nil {
+		return removed, fmt.Errorf("cleaning up msgstore: %v", err)
+	}
+	return removed, nil
+}
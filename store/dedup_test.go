@@ -0,0 +1,97 @@
+package store
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/mjl-/mox/mox-"
+)
+
+func TestDedup(t *testing.T) {
+	log := pkglog
+	os.RemoveAll("../testdata/store/data")
+	mox.ConfigStaticPath = filepath.FromSlash("../testdata/store/mox.conf")
+	mox.MustLoadConfig(true, false)
+	acc, err := OpenAccount(log, "mjl", false)
+	tcheck(t, err, "open account")
+	defer func() {
+		err = acc.Close()
+		tcheck(t, err, "closing account")
+		acc.CheckClosed()
+	}()
+	defer Switchboard()()
+
+	mox.Conf.Static.DeduplicateMessages = true
+	defer func() {
+		mox.Conf.Static.DeduplicateMessages = false
+	}()
+
+	deliver := func(mailbox, body string) Message {
+		t.Helper()
+		msgFile, err := CreateMessageTemp(log, "dedup-test")
+		tcheck(t, err, "temp message file")
+		defer CloseRemoveTempFile(log, msgFile, "test message")
+		_, err = msgFile.Write([]byte(body))
+		tcheck(t, err, "write message")
+		m := Message{
+			Received: time.Now(),
+			Size:     int64(len(body)),
+		}
+		acc.WithWLock(func() {
+			err := acc.DeliverMailbox(log, mailbox, &m, msgFile)
+			tcheck(t, err, "deliver")
+		})
+		return m
+	}
+	stat := func(m Message) os.FileInfo {
+		t.Helper()
+		fi, err := os.Stat(acc.MessagePath(m.ID))
+		tcheck(t, err, "stat message file")
+		return fi
+	}
+
+	// Messages with identical data share a file, others don't.
+	const body = "Subject: test\r\n\r\nhello\r\n"
+	m1 := deliver("Inbox", body)
+	m2 := deliver("Archive", body)
+	m3 := deliver("Inbox", "Subject: other\r\n\r\nhello\r\n")
+	if !os.SameFile(stat(m1), stat(m2)) {
+		t.Fatalf("messages with identical data do not share file")
+	}
+	if os.SameFile(stat(m1), stat(m3)) {
+		t.Fatalf("messages with different data share file")
+	}
+	mr := acc.MessageReader(m2)
+	buf := make([]byte, len(body))
+	_, err = mr.ReadAt(buf, 0)
+	tcheck(t, err, "read message")
+	mr.Close()
+	tcompare(t, string(buf), body)
+
+	if runtime.GOOS == "windows" {
+		return
+	}
+
+	// Files still in use are kept.
+	n, err := MessageStoreCleanup(ctxbg, log)
+	tcheck(t, err, "cleanup msgstore")
+	tcompare(t, n, 0)
+
+	// Files without references, e.g. after removing messages, are removed.
+	p := messageStorePath("00112233445566778899aabbccddeeff00112233445566778899aabbccddeeff")
+	err = os.MkdirAll(filepath.Dir(p), 0770)
+	tcheck(t, err, "mkdir")
+	err = os.WriteFile(p, []byte(body), 0660)
+	tcheck(t, err, "write file")
+	n, err = MessageStoreCleanup(ctxbg, log)
+	tcheck(t, err, "cleanup msgstore")
+	tcompare(t, n, 1)
+	_, err = os.Stat(p)
+	if !os.IsNotExist(err) {
+		t.Fatalf("unreferenced file still present, stat err %v", err)
+	}
+	tcompare(t, stat(m1).Size(), int64(len(body)))
+}
@@ -0,0 +1,698 @@
+package store
+
+// Message files can be stored encrypted, for accounts with MessageEncryption
+// configured, so a copy of the disk does not directly expose message contents.
+//
+// Each account has an X25519 key pair, stored in the account database as
+// MessageKey. The private key is stored encrypted ("wrapped") with either the
+// server master key (KeyWrap "masterkey"), or with a key derived from the account
+// password (KeyWrap "password"). New messages are encrypted at delivery with the
+// public key, so delivery doesn't need the private key. Reading messages requires
+// the private key. With "masterkey", it is unwrapped when the account is opened.
+// With "password", it is unwrapped when the account logs in with its password,
+// and kept in memory until mox stops.
+//
+// An encrypted message file starts with a magic string and an ephemeral X25519
+// public key. The file key is the SHA-256 hash of the X25519 shared secret with
+// the account public key and both public keys. The message data follows in chunks
+// of 64KB, each sealed with AES-256-GCM, with the chunk number in the nonce and a
+// flag for the final chunk, so chunks cannot be reordered and truncation is
+// detected. Chunks are decrypted while reading, messages are not read into memory
+// completely. Copies of a message share the encrypted file.
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	cryptorand "crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/argon2"
+
+	"github.com/mjl-/bstore"
+
+	"github.com/mjl-/mox/mlog"
+	"github.com/mjl-/mox/mox-"
+)
+
+// MessageKey is the key pair for encrypting message files of an account. There is
+// at most one, with ID 1.
+type MessageKey struct {
+	ID        int64
+	Created   time.Time `bstore:"default now"`
+	KeyWrap   string    // "masterkey" or "password", the key the private key is encrypted with.
+	PublicKey []byte    // X25519.
+
+	// For KeyWrap "password", salt for deriving the wrapping key from the password.
+	Salt []byte
+
+	// Nonce followed by the AES-256-GCM sealed private key.
+	WrappedPrivateKey []byte
+}
+
+const (
+	encMagic     = "moxenc1\n"
+	encChunkSize = 64 * 1024
+	encHeaderLen = len(encMagic) + 32
+
+	// Number of candidate messages to fetch from the database at a time.
+	encryptBatchSize = 1000
+)
+
+var (
+	// ErrMessageKeyLocked is returned when reading an encrypted message of an account
+	// whose message key is protected by its password, and the account has not logged
+	// in with its password since mox started.
+	ErrMessageKeyLocked = errors.New("message key of account is locked, log in with password to unlock")
+
+	// ErrMessageEncryptionDisabled is returned by EncryptMessages for accounts without
+	// message encryption.
+	ErrMessageEncryptionDisabled = errors.New("message encryption not enabled for account")
+)
+
+// Unwrapped private message keys, by account name. Kept after closing an account,
+// keys unlocked with a password cannot be unwrapped again without the password.
+var messageKeys = struct {
+	sync.Mutex
+	keys map[string]*ecdh.PrivateKey
+}{keys: map[string]*ecdh.PrivateKey{}}
+
+func messageKeyGet(accountName string) *ecdh.PrivateKey {
+	messageKeys.Lock()
+	defer messageKeys.Unlock()
+	return messageKeys.keys[accountName]
+}
+
+func messageKeySet(accountName string, key *ecdh.PrivateKey) {
+	messageKeys.Lock()
+	defer messageKeys.Unlock()
+	if key == nil {
+		delete(messageKeys.keys, accountName)
+	} else {
+		messageKeys.keys[accountName] = key
+	}
+}
+
+// messageEncryption returns how the message key of the account is wrapped, if
+// message encryption is enabled.
+func (a *Account) messageEncryption() (keyWrap string, ok bool) {
+	conf, _ := a.Conf()
+	if conf.MessageEncryption == nil {
+		return "", false
+	}
+	keyWrap = conf.MessageEncryption.KeyWrap
+	if keyWrap == "" {
+		keyWrap = "masterkey"
+	}
+	return keyWrap, true
+}
+
+// wrapKey returns the key for wrapping the private key, for the master key or
+// the password.
+func wrapKey(keyWrap, password string, salt []byte) ([]byte, error) {
+	switch keyWrap {
+	case "masterkey":
+		if len(mox.Conf.Static.MessageEncryptionKey) == 0 {
+			return nil, fmt.Errorf("no message encryption master key configured")
+		}
+		return mox.Conf.Static.MessageEncryptionKey, nil
+	case "password":
+		return argon2.IDKey([]byte(password), salt, 1, 64*1024, 4, 32), nil
+	}
+	return nil, fmt.Errorf("unknown key wrap %q", keyWrap)
+}
+
+// wrap sets the private key in mk, encrypted according to keyWrap.
+func (mk *MessageKey) wrap(key *ecdh.PrivateKey, keyWrap, password string) error {
+	mk.KeyWrap = keyWrap
+	mk.PublicKey = key.PublicKey().Bytes()
+	mk.Salt = nil
+	if keyWrap == "password" {
+		mk.Salt = make([]byte, 16)
+		cryptorand.Read(mk.Salt)
+	}
+	wk, err := wrapKey(keyWrap, password, mk.Salt)
+	if err != nil {
+		return err
+	}
+	aead, err := newGCM(wk)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	cryptorand.Read(nonce)
+	mk.WrappedPrivateKey = aead.Seal(nonce, nonce, key.Bytes(), nil)
+	return nil
+}
+
+// unwrap returns the private key, decrypting it with the master key or password.
+func (mk MessageKey) unwrap(password string) (*ecdh.PrivateKey, error) {
+	wk, err := wrapKey(mk.KeyWrap, password, mk.Salt)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newGCM(wk)
+	if err != nil {
+		return nil, err
+	}
+	if len(mk.WrappedPrivateKey) < aead.NonceSize() {
+		return nil, fmt.Errorf("wrapped private key too short")
+	}
+	nonce, sealed := mk.WrappedPrivateKey[:aead.NonceSize()], mk.WrappedPrivateKey[aead.NonceSize():]
+	buf, err := aead.Open(nil, nonce, sealed, nil)
+	if err != nil {
+		return nil, fmt.Errorf("decrypting private key: %w", err)
+	}
+	return ecdh.X25519().NewPrivateKey(buf)
+}
+
+// unlocked returns the unwrapped private key in memory for mk, if any.
+func (mk MessageKey) unlocked(accountName string) *ecdh.PrivateKey {
+	key := messageKeyGet(accountName)
+	if key != nil && bytes.Equal(key.PublicKey().Bytes(), mk.PublicKey) {
+		return key
+	}
+	return nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// messageKeyTx returns the private message key of the account, unwrapping it with
+// the master key if needed. If the account has no message key, nil is returned.
+// An unwrapped key in memory that doesn't match the database, e.g. after restoring
+// an account, is dropped.
+func messageKeyTx(tx *bstore.Tx, accountName string) (*ecdh.PrivateKey, error) {
+	mk := MessageKey{ID: 1}
+	if err := tx.Get(&mk); err == bstore.ErrAbsent {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("get message key: %v", err)
+	}
+	if key := mk.unlocked(accountName); key != nil {
+		return key, nil
+	}
+	messageKeySet(accountName, nil)
+	if mk.KeyWrap != "masterkey" {
+		return nil, ErrMessageKeyLocked
+	}
+	key, err := mk.unwrap("")
+	if err != nil {
+		return nil, fmt.Errorf("unwrapping message key with master key: %w", err)
+	}
+	messageKeySet(accountName, key)
+	return key, nil
+}
+
+// loadMessageKey unwraps a message key protected by the master key, making
+// encrypted messages readable.
+func (a *Account) loadMessageKey(log mlog.Log) {
+	err := a.DB.Read(context.TODO(), func(tx *bstore.Tx) error {
+		_, err := messageKeyTx(tx, a.Name)
+		return err
+	})
+	if err != nil && !errors.Is(err, ErrMessageKeyLocked) {
+		log.Errorx("loading message key for account, encrypted messages cannot be read", err, slog.String("account", a.Name))
+	}
+}
+
+// messagePublicKey returns the public key to encrypt new message files with, or
+// nil if messages are not to be encrypted. A key pair is created for accounts with
+// a master key wrap. For password wrap, the key pair is created when the password
+// is set or at the next login with password. Until then, messages are stored
+// unencrypted.
+func (a *Account) messagePublicKey(log mlog.Log, tx *bstore.Tx) (*ecdh.PublicKey, error) {
+	keyWrap, ok := a.messageEncryption()
+	if !ok {
+		return nil, nil
+	}
+	mk := MessageKey{ID: 1}
+	if err := tx.Get(&mk); err == bstore.ErrAbsent {
+		if keyWrap != "masterkey" {
+			log.Debug("no message key yet, not encrypting message until login with password", slog.String("account", a.Name))
+			return nil, nil
+		}
+		key, err := ecdh.X25519().GenerateKey(cryptorand.Reader)
+		if err != nil {
+			return nil, fmt.Errorf("generating message key: %v", err)
+		}
+		if err := mk.wrap(key, keyWrap, ""); err != nil {
+			return nil, fmt.Errorf("wrapping message key: %w", err)
+		}
+		if err := tx.Insert(&mk); err != nil {
+			return nil, fmt.Errorf("inserting message key: %v", err)
+		}
+		messageKeySet(a.Name, key)
+		log.Info("created message key for account", slog.String("account", a.Name))
+		return key.PublicKey(), nil
+	} else if err != nil {
+		return nil, fmt.Errorf("get message key: %v", err)
+	}
+	return ecdh.X25519().NewPublicKey(mk.PublicKey)
+}
+
+// unlockMessageKey unwraps a message key protected by the password of the
+// account, called after a successful login with password. For accounts with
+// password key wrap without message key, a key pair is created. If the message
+// key is wrapped differently than configured, it is wrapped again according to
+// the configuration.
+func (a *Account) unlockMessageKey(log mlog.Log, password string) error {
+	keyWrap, enabled := a.messageEncryption()
+	if messageKeyGet(a.Name) != nil && !enabled {
+		return nil
+	}
+
+	// Most logins don't need changes, check with a read-only transaction first.
+	mk := MessageKey{ID: 1}
+	err := a.DB.Get(context.TODO(), &mk)
+	if err == bstore.ErrAbsent && (!enabled || keyWrap != "password") {
+		return nil
+	} else if err == nil && mk.unlocked(a.Name) != nil && (!enabled || mk.KeyWrap == keyWrap) {
+		return nil
+	} else if err != nil && err != bstore.ErrAbsent {
+		return fmt.Errorf("get message key: %v", err)
+	}
+
+	return a.DB.Write(context.TODO(), func(tx *bstore.Tx) error {
+		mk := MessageKey{ID: 1}
+		err := tx.Get(&mk)
+		if err == bstore.ErrAbsent {
+			return a.setPasswordMessageKey(log, tx, password)
+		} else if err != nil {
+			return fmt.Errorf("get message key: %v", err)
+		}
+
+		key := mk.unlocked(a.Name)
+		if key == nil {
+			key, err = mk.unwrap(password)
+			if err != nil {
+				return fmt.Errorf("unwrapping message key: %w", err)
+			}
+			messageKeySet(a.Name, key)
+		}
+		if enabled && mk.KeyWrap != keyWrap {
+			if err := mk.wrap(key, keyWrap, password); err != nil {
+				return fmt.Errorf("wrapping message key: %w", err)
+			}
+			if err := tx.Update(&mk); err != nil {
+				return fmt.Errorf("updating message key: %v", err)
+			}
+			log.Info("message key wrapped with new key wrap", slog.String("account", a.Name), slog.String("keywrap", keyWrap))
+		}
+		return nil
+	})
+}
+
+// setPasswordMessageKey wraps the message key of the account with the new
+// password, if it is protected by the password, or creates a message key if
+// configured with password key wrap. The message key must have been unlocked.
+func (a *Account) setPasswordMessageKey(log mlog.Log, tx *bstore.Tx, password string) error {
+	mk := MessageKey{ID: 1}
+	if err := tx.Get(&mk); err == bstore.ErrAbsent {
+		if keyWrap, ok := a.messageEncryption(); !ok || keyWrap != "password" {
+			return nil
+		}
+		key, err := ecdh.X25519().GenerateKey(cryptorand.Reader)
+		if err != nil {
+			return fmt.Errorf("generating message key: %v", err)
+		}
+		if err := mk.wrap(key, "password", password); err != nil {
+			return fmt.Errorf("wrapping message key: %w", err)
+		}
+		if err := tx.Insert(&mk); err != nil {
+			return fmt.Errorf("inserting message key: %v", err)
+		}
+		messageKeySet(a.Name, key)
+		log.Info("created message key for account", slog.String("account", a.Name))
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("get message key: %v", err)
+	} else if mk.KeyWrap != "password" {
+		return nil
+	}
+
+	key := mk.unlocked(a.Name)
+	if key == nil {
+		return fmt.Errorf("cannot set new password: %w", ErrMessageKeyLocked)
+	}
+	if err := mk.wrap(key, "password", password); err != nil {
+		return fmt.Errorf("wrapping message key: %w", err)
+	}
+	if err := tx.Update(&mk); err != nil {
+		return fmt.Errorf("updating message key: %v", err)
+	}
+	return nil
+}
+
+// EncryptedFileSize returns the size of an encrypted message file for message
+// data of size bytes.
+func EncryptedFileSize(size int64) int64 {
+	chunks := max(1, (size+encChunkSize-1)/encChunkSize)
+	return int64(encHeaderLen) + size + chunks*16
+}
+
+// encryptFileKey returns the AES-GCM for a message file, from the shared secret
+// and public keys.
+func encryptFileKey(shared, ephemeralPub, accountPub []byte) (cipher.AEAD, error) {
+	h := sha256.New()
+	h.Write(shared)
+	h.Write(ephemeralPub)
+	h.Write(accountPub)
+	return newGCM(h.Sum(nil))
+}
+
+func encryptNonce(nonce []byte, chunk int64, final bool) {
+	clear(nonce)
+	if final {
+		nonce[0] = 1
+	}
+	binary.BigEndian.PutUint64(nonce[len(nonce)-8:], uint64(chunk))
+}
+
+// encryptTo writes the encrypted data of r, which must be size bytes, to w.
+func encryptTo(w io.Writer, r io.Reader, size int64, pub *ecdh.PublicKey) error {
+	eph, err := ecdh.X25519().GenerateKey(cryptorand.Reader)
+	if err != nil {
+		return fmt.Errorf("generating ephemeral key: %v", err)
+	}
+	shared, err := eph.ECDH(pub)
+	if err != nil {
+		return fmt.Errorf("key agreement: %v", err)
+	}
+	aead, err := encryptFileKey(shared, eph.PublicKey().Bytes(), pub.Bytes())
+	if err != nil {
+		return err
+	}
+
+	if _, err := w.Write(append([]byte(encMagic), eph.PublicKey().Bytes()...)); err != nil {
+		return fmt.Errorf("writing encrypted message header: %v", err)
+	}
+	nonce := make([]byte, aead.NonceSize())
+	buf := make([]byte, encChunkSize, encChunkSize+aead.Overhead())
+	var o int64
+	for chunk := int64(0); ; chunk++ {
+		n := min(size-o, encChunkSize)
+		if _, err := io.ReadFull(r, buf[:n]); err != nil {
+			return fmt.Errorf("reading message data: %v", err)
+		}
+		o += n
+		final := o == size
+		encryptNonce(nonce, chunk, final)
+		if _, err := w.Write(aead.Seal(buf[:0], nonce, buf[:n], nil)); err != nil {
+			return fmt.Errorf("writing encrypted message data: %v", err)
+		}
+		if final {
+			break
+		}
+	}
+	if n, err := r.Read(make([]byte, 1)); n > 0 || err != io.EOF {
+		return fmt.Errorf("message data larger than expected size %d", size)
+	}
+	return nil
+}
+
+// writeEncrypted writes the encrypted data of r, which must be size bytes, to a
+// new file at path p.
+func writeEncrypted(log mlog.Log, p string, r io.Reader, size int64, pub *ecdh.PublicKey, sync bool) (rerr error) {
+	f, err := os.OpenFile(p, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0660)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if f != nil {
+			err := f.Close()
+			log.Check(err, "closing encrypted message file")
+		}
+		if rerr != nil {
+			err := os.Remove(p)
+			log.Check(err, "removing encrypted message file", slog.String("path", p))
+		}
+	}()
+
+	if err := encryptTo(f, r, size, pub); err != nil {
+		return err
+	}
+	if sync {
+		if err := f.Sync(); err != nil {
+			return fmt.Errorf("sync encrypted message file: %v", err)
+		}
+	}
+	err = f.Close()
+	f = nil
+	if err != nil {
+		return fmt.Errorf("closing encrypted message file: %v", err)
+	}
+	return nil
+}
+
+// encryptedReader decrypts an encrypted message file per chunk.
+type encryptedReader struct {
+	f        *os.File
+	aead     cipher.AEAD
+	dataSize int64
+	nonce    []byte
+	chunk    int64 // Chunk in buf, -1 if none.
+	buf      []byte
+}
+
+// openEncrypted opens the encrypted message file at p, with message data of
+// dataSize bytes.
+func openEncrypted(p string, key *ecdh.PrivateKey, dataSize int64) (readerAtCloser, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	er, err := newEncryptedReader(f, key, dataSize)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("reading encrypted message file %s: %w", p, err)
+	}
+	return er, nil
+}
+
+func newEncryptedReader(f *os.File, key *ecdh.PrivateKey, dataSize int64) (*encryptedReader, error) {
+	if st, err := f.Stat(); err != nil {
+		return nil, err
+	} else if st.Size() != EncryptedFileSize(dataSize) {
+		return nil, fmt.Errorf("encrypted file has size %d, expected %d for message data of size %d", st.Size(), EncryptedFileSize(dataSize), dataSize)
+	}
+	hdr := make([]byte, encHeaderLen)
+	if _, err := f.ReadAt(hdr, 0); err != nil {
+		return nil, fmt.Errorf("reading header: %v", err)
+	}
+	if string(hdr[:len(encMagic)]) != encMagic {
+		return nil, fmt.Errorf("not an encrypted message file")
+	}
+	ephPub, err := ecdh.X25519().NewPublicKey(hdr[len(encMagic):])
+	if err != nil {
+		return nil, fmt.Errorf("parsing ephemeral public key: %v", err)
+	}
+	shared, err := key.ECDH(ephPub)
+	if err != nil {
+		return nil, fmt.Errorf("key agreement: %v", err)
+	}
+	aead, err := encryptFileKey(shared, ephPub.Bytes(), key.PublicKey().Bytes())
+	if err != nil {
+		return nil, err
+	}
+	er := &encryptedReader{
+		f:        f,
+		aead:     aead,
+		dataSize: dataSize,
+		nonce:    make([]byte, aead.NonceSize()),
+		chunk:    -1,
+		buf:      make([]byte, 0, encChunkSize+aead.Overhead()),
+	}
+	return er, nil
+}
+
+// readChunk reads and decrypts chunk into er.buf.
+func (er *encryptedReader) readChunk(chunk int64) error {
+	overhead := int64(er.aead.Overhead())
+	off := chunk * encChunkSize
+	n := min(er.dataSize-off, encChunkSize)
+	final := off+n == er.dataSize
+	buf := er.buf[:n+overhead]
+	if _, err := er.f.ReadAt(buf, int64(encHeaderLen)+chunk*(encChunkSize+overhead)); err != nil {
+		return fmt.Errorf("reading encrypted chunk: %v", err)
+	}
+	encryptNonce(er.nonce, chunk, final)
+	buf, err := er.aead.Open(buf[:0], er.nonce, buf, nil)
+	if err != nil {
+		er.chunk = -1
+		return fmt.Errorf("decrypting message data: %v", err)
+	}
+	er.buf = buf
+	er.chunk = chunk
+	return nil
+}
+
+// ReadAt reads decrypted message data.
+func (er *encryptedReader) ReadAt(buf []byte, off int64) (int, error) {
+	var o int
+	for o < len(buf) {
+		if off >= er.dataSize {
+			return o, io.EOF
+		}
+		chunk := off / encChunkSize
+		if chunk != er.chunk {
+			if err := er.readChunk(chunk); err != nil {
+				return o, err
+			}
+		}
+		n := copy(buf[o:], er.buf[off-chunk*encChunkSize:])
+		o += n
+		off += int64(n)
+	}
+	return o, nil
+}
+
+// Close closes the underlying file.
+func (er *encryptedReader) Close() error {
+	return er.f.Close()
+}
+
+// EncryptMessagesStats is the result of Account.EncryptMessages.
+type EncryptMessagesStats struct {
+	Encrypted int   // Messages whose file was replaced with an encrypted file.
+	Size      int64 // Total size of the message data of the encrypted messages.
+}
+
+// EncryptMessages encrypts the files of existing messages, for accounts with
+// message encryption enabled. Compressed messages are stored encrypted
+// uncompressed. Messages in pack files are skipped. Copies of a message that share
+// a file each get their own encrypted file.
+//
+// Must be called without holding the account lock.
+func (a *Account) EncryptMessages(ctx context.Context, log mlog.Log) (stats EncryptMessagesStats, rerr error) {
+	a.packMutex.Lock()
+	defer a.packMutex.Unlock()
+
+	if _, ok := a.messageEncryption(); !ok {
+		return stats, ErrMessageEncryptionDisabled
+	}
+	var pub *ecdh.PublicKey
+	err := a.DB.Write(ctx, func(tx *bstore.Tx) error {
+		var err error
+		pub, err = a.messagePublicKey(log, tx)
+		return err
+	})
+	if err != nil {
+		return stats, fmt.Errorf("get message public key: %v", err)
+	} else if pub == nil {
+		return stats, fmt.Errorf("no message key yet, account must log in with password first")
+	}
+
+	var lastID int64
+	for {
+		var msgs []Message
+		err := a.DB.Read(ctx, func(tx *bstore.Tx) error {
+			q := bstore.QueryTx[Message](tx)
+			q.FilterEqual("Expunged", false)
+			q.FilterEqual("PackID", int64(0))
+			q.FilterEqual("Encrypted", false)
+			q.FilterGreater("ID", lastID)
+			q.SortAsc("ID")
+			q.Limit(encryptBatchSize)
+			var err error
+			msgs, err = q.List()
+			return err
+		})
+		if err != nil {
+			return stats, fmt.Errorf("listing messages to encrypt: %v", err)
+		}
+		if len(msgs) == 0 {
+			break
+		}
+		for _, m := range msgs {
+			if err := a.encryptMessage(ctx, log, m, pub, &stats); err != nil {
+				return stats, fmt.Errorf("encrypting message %d: %v", m.ID, err)
+			}
+		}
+		lastID = msgs[len(msgs)-1].ID
+	}
+	return stats, nil
+}
+
+// encryptMessage writes an encrypted copy of the file for m to a temporary file,
+// and replaces the message file with it if the message hasn't changed in the mean
+// time.
+func (a *Account) encryptMessage(ctx context.Context, log mlog.Log, m Message, pub *ecdh.PublicKey, stats *EncryptMessagesStats) error {
+	p := a.MessagePath(m.ID)
+	if _, err := os.Stat(p); err != nil {
+		// Message may have been removed in the mean time.
+		log.Debugx("stat message file for encrypting, skipping", err, slog.Int64("msgid", m.ID))
+		return nil
+	}
+
+	mr := a.MessageReader(m)
+	defer func() {
+		err := mr.Close()
+		log.Check(err, "closing message reader after encrypting")
+	}()
+	size := m.Size - int64(len(m.MsgPrefix))
+
+	f, err := CreateMessageTemp(log, "encrypt")
+	if err != nil {
+		return fmt.Errorf("creating temporary file: %v", err)
+	}
+	defer func() {
+		if f != nil {
+			CloseRemoveTempFile(log, f, "encrypted message")
+		}
+	}()
+
+	if err := encryptTo(f, io.NewSectionReader(mr, int64(len(m.MsgPrefix)), size), size, pub); err != nil {
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		return fmt.Errorf("sync encrypted file: %v", err)
+	}
+
+	var rerr error
+	a.WithWLock(func() {
+		rerr = a.DB.Write(ctx, func(tx *bstore.Tx) error {
+			xm := Message{ID: m.ID}
+			if err := tx.Get(&xm); err == bstore.ErrAbsent {
+				return nil
+			} else if err != nil {
+				return fmt.Errorf("get message: %v", err)
+			}
+			if xm.Expunged || xm.PackID != 0 || xm.Encrypted || xm.CompressedSize != m.CompressedSize {
+				return nil
+			}
+			xm.Encrypted = true
+			xm.CompressedSize = 0
+			if err := tx.Update(&xm); err != nil {
+				return fmt.Errorf("updating message: %v", err)
+			}
+			// The message file may be shared with copies of the message, so we replace it
+			// instead of writing to it.
+			if err := os.Rename(f.Name(), p); err != nil {
+				return fmt.Errorf("replacing message file: %v", err)
+			}
+			err := f.Close()
+			log.Check(err, "closing encrypted message file")
+			f = nil
+			stats.Encrypted++
+			stats.Size += size
+			return nil
+		})
+	})
+	return rerr
+}
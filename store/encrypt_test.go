@@ -0,0 +1,226 @@
+package store
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mjl-/mox/config"
+	"github.com/mjl-/mox/mox-"
+)
+
+func TestEncryptMessages(t *testing.T) {
+	log := pkglog
+	os.RemoveAll("../testdata/store/data")
+	mox.ConfigStaticPath = filepath.FromSlash("../testdata/store/mox.conf")
+	mox.MustLoadConfig(true, false)
+	// For authentication lockouts.
+	err := Init(ctxbg)
+	tcheck(t, err, "store init")
+	defer func() {
+		err := Close()
+		tcheck(t, err, "store close")
+	}()
+	acc, err := OpenAccount(log, "mjl", false)
+	tcheck(t, err, "open account")
+	defer func() {
+		err = acc.Close()
+		tcheck(t, err, "closing account")
+		acc.CheckClosed()
+	}()
+	defer Switchboard()()
+	defer messageKeySet("mjl", nil)
+
+	mox.Conf.Static.MessageEncryptionKey = bytes.Repeat([]byte{1}, 32)
+	defer func() {
+		mox.Conf.Static.MessageEncryptionKey = nil
+	}()
+
+	prefix := []byte("Received: from localhost\r\n")
+	deliver := func(body string) Message {
+		t.Helper()
+		msgFile, err := CreateMessageTemp(log, "encrypt-test")
+		tcheck(t, err, "temp message file")
+		defer CloseRemoveTempFile(log, msgFile, "test message")
+		_, err = msgFile.Write([]byte(body))
+		tcheck(t, err, "write message")
+		m := Message{
+			Received:  time.Now(),
+			Size:      int64(len(prefix)) + int64(len(body)),
+			MsgPrefix: prefix,
+		}
+		acc.WithWLock(func() {
+			err := acc.DeliverMailbox(log, "Inbox", &m, msgFile)
+			tcheck(t, err, "deliver")
+		})
+		return m
+	}
+	msg := func(subject string, size int) string {
+		s := fmt.Sprintf("Subject: %s\r\n\r\n", subject)
+		return s + strings.Repeat("hello world\r\n", size/13)
+	}
+	getMsg := func(id int64) Message {
+		t.Helper()
+		m := Message{ID: id}
+		err := acc.DB.Get(ctxbg, &m)
+		tcheck(t, err, "get message")
+		return m
+	}
+	checkData := func(m Message, body string) {
+		t.Helper()
+		mr := acc.MessageReader(m)
+		defer mr.Close()
+		buf, err := io.ReadAll(mr)
+		tcheck(t, err, "read message")
+		tcompare(t, string(buf), string(prefix)+body)
+
+		// Read across a chunk boundary.
+		if len(body) > encChunkSize+10 {
+			buf = make([]byte, 20)
+			off := int64(len(prefix)) + encChunkSize - 10
+			_, err = mr.ReadAt(buf, off)
+			tcheck(t, err, "readat message")
+			tcompare(t, string(buf), body[encChunkSize-10:encChunkSize+10])
+		}
+	}
+	checkEncrypted := func(m Message, body string) {
+		t.Helper()
+		tcompare(t, m.Encrypted, true)
+		buf, err := os.ReadFile(acc.MessagePath(m.ID))
+		tcheck(t, err, "read message file")
+		tcompare(t, int64(len(buf)), EncryptedFileSize(int64(len(body))))
+		if len(body) > 0 && bytes.Contains(buf, []byte(body[:10])) {
+			t.Fatalf("message file contains plain text")
+		}
+	}
+
+	// Without encryption configured, messages are stored as is.
+	m1 := deliver(msg("first", 1000))
+	tcompare(t, getMsg(m1.ID).Encrypted, false)
+	_, err = acc.EncryptMessages(ctxbg, log)
+	tcompare(t, err, ErrMessageEncryptionDisabled)
+
+	accConf, _ := acc.Conf()
+	accConf.MessageCompression = &config.MessageCompression{MinMessageSize: 100, MaxMessageSize: 1500}
+	mox.Conf.Dynamic.Accounts["mjl"] = accConf
+	mcompressed := deliver(msg("compressed", 1000))
+	accConf.MessageCompression = nil
+	accConf.MessageEncryption = &config.MessageEncryption{}
+	mox.Conf.Dynamic.Accounts["mjl"] = accConf
+	defer func() {
+		accConf.MessageEncryption = nil
+		mox.Conf.Dynamic.Accounts["mjl"] = accConf
+	}()
+
+	// New messages are encrypted at delivery, with a key pair created on first use.
+	large := msg("large", 3*encChunkSize)
+	mlarge := deliver(large)
+	checkEncrypted(getMsg(mlarge.ID), large)
+	checkData(getMsg(mlarge.ID), large)
+	mempty := deliver("")
+	checkEncrypted(getMsg(mempty.ID), "")
+	checkData(getMsg(mempty.ID), "")
+	// Message size exactly at chunk size.
+	exact := strings.Repeat("a", encChunkSize)
+	mexact := deliver(exact)
+	checkData(getMsg(mexact.ID), exact)
+
+	// Existing messages are encrypted, including compressed messages.
+	stats, err := acc.EncryptMessages(ctxbg, log)
+	tcheck(t, err, "encrypt messages")
+	tcompare(t, stats, EncryptMessagesStats{Encrypted: 2, Size: m1.Size + mcompressed.Size - 2*int64(len(prefix))})
+	checkEncrypted(getMsg(m1.ID), msg("first", 1000))
+	checkData(getMsg(m1.ID), msg("first", 1000))
+	xmcompressed := getMsg(mcompressed.ID)
+	tcompare(t, xmcompressed.CompressedSize, int64(0))
+	checkEncrypted(xmcompressed, msg("compressed", 1000))
+	checkData(xmcompressed, msg("compressed", 1000))
+
+	// Nothing more to do.
+	stats, err = acc.EncryptMessages(ctxbg, log)
+	tcheck(t, err, "encrypt messages")
+	tcompare(t, stats, EncryptMessagesStats{})
+
+	err = acc.CheckConsistency()
+	tcheck(t, err, "check consistency")
+
+	// Key is unwrapped with the master key when the account is opened again.
+	messageKeySet("mjl", nil)
+	acc.loadMessageKey(log)
+	checkData(getMsg(m1.ID), msg("first", 1000))
+
+	// Tampered data is detected.
+	p := acc.MessagePath(m1.ID)
+	buf, err := os.ReadFile(p)
+	tcheck(t, err, "read message file")
+	buf[len(buf)-1] ^= 1
+	err = os.WriteFile(p, buf, 0660)
+	tcheck(t, err, "write message file")
+	mr := acc.MessageReader(getMsg(m1.ID))
+	_, err = io.ReadAll(mr)
+	if err == nil {
+		t.Fatalf("reading tampered message succeeded")
+	}
+	mr.Close()
+
+	// With password key wrap, the key is wrapped again with the password at login.
+	accConf.MessageEncryption = &config.MessageEncryption{KeyWrap: "password"}
+	mox.Conf.Dynamic.Accounts["mjl"] = accConf
+	err = acc.SetPassword(log, "test1234")
+	tcheck(t, err, "set password")
+	xacc, _, err := OpenEmailAuth(log, "mjl@mox.example", "test1234", false)
+	tcheck(t, err, "open with password")
+	err = xacc.Close()
+	tcheck(t, err, "close account")
+	mk := MessageKey{ID: 1}
+	err = acc.DB.Get(ctxbg, &mk)
+	tcheck(t, err, "get message key")
+	tcompare(t, mk.KeyWrap, "password")
+
+	// After a restart, messages cannot be read until login with password.
+	messageKeySet("mjl", nil)
+	acc.loadMessageKey(log)
+	mr = acc.MessageReader(getMsg(mlarge.ID))
+	_, err = io.ReadAll(mr)
+	if !errors.Is(err, ErrMessageKeyLocked) {
+		t.Fatalf("reading message with locked key, got err %v, expected ErrMessageKeyLocked", err)
+	}
+	mr.Close()
+	// New messages are still encrypted.
+	mlocked := deliver(msg("locked", 100))
+	checkEncrypted(getMsg(mlocked.ID), msg("locked", 100))
+	// Password cannot be changed, it would make messages unreadable.
+	err = acc.SetPassword(log, "test12345")
+	if !errors.Is(err, ErrMessageKeyLocked) {
+		t.Fatalf("set password with locked key, got err %v, expected ErrMessageKeyLocked", err)
+	}
+
+	// Wrong password doesn't unlock.
+	_, _, err = OpenEmailAuth(log, "mjl@mox.example", "bogus123", false)
+	tcompare(t, err, ErrUnknownCredentials)
+	tcompare(t, messageKeyGet("mjl") == nil, true)
+
+	xacc, _, err = OpenEmailAuth(log, "mjl@mox.example", "test1234", false)
+	tcheck(t, err, "open with password")
+	err = xacc.Close()
+	tcheck(t, err, "close account")
+	checkData(getMsg(mlarge.ID), large)
+	checkData(getMsg(mlocked.ID), msg("locked", 100))
+
+	// With unlocked key, the password can be changed, the key is wrapped with the new
+	// password.
+	err = acc.SetPassword(log, "test12345")
+	tcheck(t, err, "set password")
+	messageKeySet("mjl", nil)
+	xacc, _, err = OpenEmailAuth(log, "mjl@mox.example", "test12345", false)
+	tcheck(t, err, "open with new password")
+	err = xacc.Close()
+	tcheck(t, err, "close account")
+	checkData(getMsg(mlarge.ID), large)
+}
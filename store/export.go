@@ -6,12 +6,14 @@ import (
 	"bufio"
 	"bytes"
 	"context"
+	"crypto/ecdh"
 	"fmt"
 	"io"
 	"log/slog"
 	"os"
 	"path"
 	"path/filepath"
+	"slices"
 	"strings"
 	"time"
 
@@ -122,16 +124,66 @@ func (a *MboxArchiver) Close() error {
 	return nil
 }
 
-// ExportMessages writes messages to archiver. Either in maildir format, or otherwise in
-// mbox. If mailboxOpt is empty, all mailboxes are exported, otherwise only the
-// named mailbox.
+// ExportFormat is the format in which messages are exported.
+type ExportFormat string
+
+const (
+	ExportMaildir ExportFormat = "maildir" // Maildir per mailbox, with flags in file names.
+	ExportMbox    ExportFormat = "mbox"    // Single "mboxrd" file per mailbox, with flags in headers.
+	ExportEML     ExportFormat = "eml"     // Directory per mailbox, with a .eml file per message as stored.
+)
+
+// ExportFilter selects messages to export. The zero value selects all messages.
+type ExportFilter struct {
+	Since  time.Time // If not zero, only messages received at or after this time.
+	Before time.Time // If not zero, only messages received before this time.
+
+	// Flags and keywords a message must all have.
+	Flags    Flags
+	Keywords []string
+
+	// Flags and keywords a message must not have, e.g. \Deleted.
+	NotFlags    Flags
+	NotKeywords []string
+}
+
+func (f ExportFilter) match(m Message) bool {
+	if !f.Since.IsZero() && m.Received.Before(f.Since) || !f.Before.IsZero() && !m.Received.Before(f.Before) {
+		return false
+	}
+	if m.Flags.Set(f.Flags, f.Flags) != m.Flags || m.Flags.Set(f.NotFlags, Flags{}) != m.Flags {
+		return false
+	}
+	for _, k := range f.Keywords {
+		if !slices.Contains(m.Keywords, k) {
+			return false
+		}
+	}
+	for _, k := range f.NotKeywords {
+		if slices.Contains(m.Keywords, k) {
+			return false
+		}
+	}
+	return true
+}
+
+// ExportMessages writes messages to archiver, in the requested format. If
+// mailboxes is empty, all mailboxes are exported, otherwise only the named
+// mailboxes, and with recursive also their children. Only messages matching
+// filter are exported.
 //
 // Some errors are not fatal and result in skipped messages. In that happens, a
 // file "errors.txt" is added to the archive describing the errors. The goal is to
 // let users export (hopefully) most messages even in the face of errors.
-func ExportMessages(ctx context.Context, log mlog.Log, db *bstore.DB, accountDir string, archiver Archiver, maildir bool, mailboxOpt string, recursive bool) error {
+func ExportMessages(ctx context.Context, log mlog.Log, db *bstore.DB, accountDir string, archiver Archiver, format ExportFormat, mailboxes []string, recursive bool, filter ExportFilter) error {
 	// todo optimize: should prepare next file to add to archive (can be an mbox with many messages) while writing a file to the archive (which typically compresses, which takes time).
 
+	switch format {
+	case ExportMaildir, ExportMbox, ExportEML:
+	default:
+		return fmt.Errorf("unknown export format %q", format)
+	}
+
 	// Start transaction without closure, we are going to close it early, but don't
 	// want to deal with declaring many variables now to be able to assign them in a
 	// closure and use them afterwards.
@@ -146,6 +198,13 @@ func ExportMessages(ctx context.Context, log mlog.Log, db *bstore.DB, accountDir
 
 	start := time.Now()
 
+	// Encrypted messages can only be exported if the message key can be unwrapped
+	// with the master key, or was unlocked by a login with password.
+	messageKey, err := messageKeyTx(tx, filepath.Base(accountDir))
+	if err != nil {
+		log.Infox("message key not available for export, encrypted messages cannot be read", err)
+	}
+
 	// We keep track of errors reading message files. We continue exporting and add an
 	// errors.txt file to the archive. In case of errors, the user can get (hopefully)
 	// most of their emails, and see something went wrong. For other errors, like
@@ -154,15 +213,22 @@ func ExportMessages(ctx context.Context, log mlog.Log, db *bstore.DB, accountDir
 	var errors string
 
 	// Process mailboxes sorted by name, so submaildirs come after their parent.
-	prefix := mailboxOpt + "/"
 	var trimPrefix string
-	if mailboxOpt != "" {
+	if len(mailboxes) == 1 {
 		// If exporting a specific mailbox, trim its parent path from stored file names.
-		trimPrefix = path.Dir(mailboxOpt) + "/"
+		trimPrefix = path.Dir(mailboxes[0]) + "/"
 	}
 	q := bstore.QueryTx[Mailbox](tx)
 	q.FilterFn(func(mb Mailbox) bool {
-		return mailboxOpt == "" || mb.Name == mailboxOpt || recursive && strings.HasPrefix(mb.Name, prefix)
+		if len(mailboxes) == 0 {
+			return true
+		}
+		for _, name := range mailboxes {
+			if mb.Name == name || recursive && strings.HasPrefix(mb.Name, name+"/") {
+				return true
+			}
+		}
+		return false
 	})
 	q.SortAsc("Name")
 	err = q.ForEach(func(mb Mailbox) error {
@@ -170,7 +236,7 @@ func ExportMessages(ctx context.Context, log mlog.Log, db *bstore.DB, accountDir
 		if trimPrefix != "" {
 			mailboxName = strings.TrimPrefix(mailboxName, trimPrefix)
 		}
-		errmsgs, err := exportMailbox(log, tx, accountDir, mb.ID, mailboxName, archiver, maildir, start)
+		errmsgs, err := exportMailbox(log, tx, accountDir, messageKey, mb.ID, mailboxName, archiver, format, filter, start)
 		if err != nil {
 			return err
 		}
@@ -200,9 +266,11 @@ func ExportMessages(ctx context.Context, log mlog.Log, db *bstore.DB, accountDir
 	return nil
 }
 
-func exportMailbox(log mlog.Log, tx *bstore.Tx, accountDir string, mailboxID int64, mailboxName string, archiver Archiver, maildir bool, start time.Time) (string, error) {
+func exportMailbox(log mlog.Log, tx *bstore.Tx, accountDir string, messageKey *ecdh.PrivateKey, mailboxID int64, mailboxName string, archiver Archiver, format ExportFormat, filter ExportFilter, start time.Time) (string, error) {
 	var errors string
 
+	maildir := format == ExportMaildir
+
 	var mboxtmp *os.File
 	var mboxwriter *bufio.Writer
 	defer func() {
@@ -229,6 +297,9 @@ func exportMailbox(log mlog.Log, tx *bstore.Tx, accountDir string, mailboxID int
 	}
 
 	finishMailbox := func() error {
+		if format == ExportEML {
+			return nil
+		}
 		if maildir {
 			if len(maildirFlags) == 0 {
 				return nil
@@ -289,8 +360,11 @@ func exportMailbox(log mlog.Log, tx *bstore.Tx, accountDir string, mailboxID int
 	exportMessage := func(m Message) error {
 		mp := filepath.Join(accountDir, "msg", MessagePath(m.ID))
 		var mr io.ReadCloser
+		size := m.Size
 		if m.Size == int64(len(m.MsgPrefix)) {
 			mr = io.NopCloser(bytes.NewReader(m.MsgPrefix))
+		} else if m.PackID != 0 || m.CompressedSize > 0 || m.Encrypted {
+			mr = messageReader(accountDir, messageKey, m)
 		} else {
 			mf, err := os.Open(mp)
 			if err != nil {
@@ -306,13 +380,28 @@ func exportMailbox(log mlog.Log, tx *bstore.Tx, accountDir string, mailboxID int
 				errors += fmt.Sprintf("stat message file for id %d, path %s: %v (message skipped)\n", m.ID, mp, err)
 				return nil
 			}
-			size := st.Size() + int64(len(m.MsgPrefix))
+			size = st.Size() + int64(len(m.MsgPrefix))
 			if size != m.Size {
 				errors += fmt.Sprintf("message size mismatch for message id %d, database has %d, size is %d+%d=%d, using calculated size\n", m.ID, m.Size, len(m.MsgPrefix), st.Size(), size)
 			}
 			mr = FileMsgReader(m.MsgPrefix, mf)
 		}
 
+		if format == ExportEML {
+			// Messages are stored with \r\n line endings, as is common for .eml files.
+			name := fmt.Sprintf("%s/%s-%d.eml", mailboxName, m.Received.Format("20060102-150405"), m.ID)
+			w, err := archiver.Create(name, size, m.Received)
+			if err != nil {
+				return fmt.Errorf("adding message to archive: %v", err)
+			}
+			if _, err := io.Copy(w, mr); err != nil {
+				xerr := w.Close()
+				log.Check(xerr, "closing message")
+				return fmt.Errorf("copying message to archive: %v", err)
+			}
+			return w.Close()
+		}
+
 		if maildir {
 			p := mailboxName
 			if m.Flags.Seen {
@@ -502,7 +591,7 @@ func exportMailbox(log mlog.Log, tx *bstore.Tx, accountDir string, mailboxID int
 		if _, err := archiver.Create(mailboxName+"/tmp/", 0, start); err != nil {
 			return errors, fmt.Errorf("adding maildir tmp directory: %v", err)
 		}
-	} else {
+	} else if format == ExportMbox {
 		var err error
 		mboxtmp, err = os.CreateTemp("", "mox-mail-export-mbox")
 		if err != nil {
@@ -517,6 +606,9 @@ func exportMailbox(log mlog.Log, tx *bstore.Tx, accountDir string, mailboxID int
 	q.FilterEqual("Expunged", false)
 	q.SortAsc("Received", "ID")
 	err := q.ForEach(func(m Message) error {
+		if !filter.match(m) {
+			return nil
+		}
 		return exportMessage(m)
 	})
 	if err != nil {
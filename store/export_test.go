@@ -7,6 +7,7 @@ import (
 	"io"
 	"io/fs"
 	"os"
+	"path"
 	"path/filepath"
 	"testing"
 	"time"
@@ -53,7 +54,11 @@ func TestExport(t *testing.T) {
 
 	archive := func(archiver Archiver, maildir bool) {
 		t.Helper()
-		err = ExportMessages(ctxbg, log, acc.DB, acc.Dir, archiver, maildir, "", true)
+		format := ExportMbox
+		if maildir {
+			format = ExportMaildir
+		}
+		err = ExportMessages(ctxbg, log, acc.DB, acc.Dir, archiver, format, nil, true, ExportFilter{})
 		tcheck(t, err, "export messages")
 		err = archiver.Close()
 		tcheck(t, err, "archiver close")
@@ -123,4 +128,36 @@ func TestExport(t *testing.T) {
 
 	checkDirFiles(filepath.FromSlash("../testdata/exportmaildir"), 2)
 	checkDirFiles(filepath.FromSlash("../testdata/exportmbox"), defaultMailboxes)
+
+	// Export as .eml files, with filters. With an additional message that is marked
+	// as read.
+	m = Message{Received: time.Now(), Size: int64(len(msg)), Flags: Flags{Seen: true}}
+	err = acc.DeliverMailbox(pkglog, "Sent", &m, msgFile)
+	tcheck(t, err, "deliver")
+
+	exportEML := func(mailboxes []string, filter ExportFilter, expNames ...string) {
+		t.Helper()
+		var buf bytes.Buffer
+		archiver := ZipArchiver{zip.NewWriter(&buf)}
+		err := ExportMessages(ctxbg, log, acc.DB, acc.Dir, archiver, ExportEML, mailboxes, true, filter)
+		tcheck(t, err, "export messages")
+		err = archiver.Close()
+		tcheck(t, err, "archiver close")
+		r, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+		tcheck(t, err, "reading eml zip")
+		if len(r.File) != len(expNames) {
+			t.Fatalf("eml zip, got %d files, expected %d", len(r.File), len(expNames))
+		}
+		for i, f := range r.File {
+			if path.Dir(f.Name) != expNames[i] || path.Ext(f.Name) != ".eml" || f.UncompressedSize64 != uint64(len(msg)) {
+				t.Fatalf("eml zip, got file %q of size %d, expected in %q", f.Name, f.UncompressedSize64, expNames[i])
+			}
+		}
+	}
+	exportEML(nil, ExportFilter{}, "Inbox", "Sent", "Trash")
+	exportEML([]string{"Trash"}, ExportFilter{}, "Trash")
+	exportEML(nil, ExportFilter{Flags: Flags{Seen: true}}, "Sent")
+	exportEML(nil, ExportFilter{NotFlags: Flags{Seen: true}}, "Inbox", "Trash")
+	exportEML(nil, ExportFilter{Since: time.Now().Add(time.Hour)})
+	exportEML(nil, ExportFilter{Before: time.Now().Add(time.Hour)}, "Inbox", "Sent", "Trash")
 }
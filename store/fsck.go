@@ -0,0 +1,213 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+
+	"github.com/mjl-/bstore"
+
+	"github.com/mjl-/mox/mlog"
+)
+
+// FsckProblem is an inconsistency found by Fsck.
+type FsckProblem struct {
+	Kind     string // "missingfile", "orphanfile", "counts", "messagesize", "uidnext", "uidvalidity".
+	Text     string
+	Repaired bool
+}
+
+// Fsck checks the consistency between the messages in the database, the message
+// files on disk, the mailbox counts and disk usage, and mailbox UIDs. If repair is
+// set, problems are fixed:
+//
+// - Messages without on-disk file are marked expunged. The message data is gone,
+// and the messages would cause errors when accessed. Trained messages are not
+// untrained in the junk filter.
+// - Files in the message directory that do not belong to a message are removed.
+// - Incorrect mailbox counts and total message size are set to the correct values.
+// - Mailbox UIDNext is raised above the highest UID in the mailbox.
+// - The account next UIDValidity is raised above the highest of its mailboxes.
+//
+// The account is write-locked during the check.
+func (a *Account) Fsck(ctx context.Context, log mlog.Log, repair bool) (problems []FsckProblem, rerr error) {
+	var changes []Change
+	var removeFiles []string
+
+	add := func(kind, format string, args ...any) {
+		problems = append(problems, FsckProblem{kind, fmt.Sprintf(format, args...), repair})
+	}
+
+	a.WithWLock(func() {
+		fsck := func(tx *bstore.Tx) error {
+			nuv := NextUIDValidity{ID: 1}
+			if err := tx.Get(&nuv); err != nil {
+				return fmt.Errorf("get next uidvalidity: %v", err)
+			}
+
+			mailboxes, err := bstore.QueryTx[Mailbox](tx).SortAsc("ID").List()
+			if err != nil {
+				return fmt.Errorf("listing mailboxes: %v", err)
+			}
+			mailboxNames := map[int64]string{}
+			for _, mb := range mailboxes {
+				mailboxNames[mb.ID] = mb.Name
+			}
+
+			// Gather highest UIDs (also of expunged messages, their UIDs cannot be reused),
+			// message IDs that should have a file, and messages whose file is missing.
+			maxUIDs := map[int64]UID{}
+			files := map[int64]struct{}{}
+			var missing []Message
+			err = bstore.QueryTx[Message](tx).ForEach(func(m Message) error {
+				maxUIDs[m.MailboxID] = max(maxUIDs[m.MailboxID], m.UID)
+				if m.Expunged || m.PackID != 0 {
+					return nil
+				}
+				files[m.ID] = struct{}{}
+				if _, err := os.Stat(a.MessagePath(m.ID)); err != nil && os.IsNotExist(err) {
+					add("missingfile", "message %d with uid %d in mailbox %q has no file %s", m.ID, m.UID, mailboxNames[m.MailboxID], a.MessagePath(m.ID))
+					missing = append(missing, m)
+				} else if err != nil {
+					return fmt.Errorf("stat message file: %v", err)
+				}
+				return nil
+			})
+			if err != nil {
+				return fmt.Errorf("reading messages: %v", err)
+			}
+
+			if repair && len(missing) > 0 {
+				modseq, err := a.NextModSeq(tx)
+				if err != nil {
+					return fmt.Errorf("assigning next modseq: %v", err)
+				}
+				removeChanges := map[int64]ChangeRemoveUIDs{}
+				for _, m := range missing {
+					if _, err := bstore.QueryTx[Recipient](tx).FilterNonzero(Recipient{MessageID: m.ID}).Delete(); err != nil {
+						return fmt.Errorf("removing message recipients: %v", err)
+					}
+					if err := tx.Delete(&TextIndex{ID: m.ID}); err != nil && err != bstore.ErrAbsent {
+						return fmt.Errorf("removing text index: %v", err)
+					}
+					m.Expunged = true
+					m.ModSeq = modseq
+					if err := tx.Update(&m); err != nil {
+						return fmt.Errorf("marking message as expunged: %v", err)
+					}
+					ch := removeChanges[m.MailboxID]
+					ch.MailboxID = m.MailboxID
+					ch.UIDs = append(ch.UIDs, m.UID)
+					ch.ModSeq = modseq
+					removeChanges[m.MailboxID] = ch
+				}
+				for _, ch := range removeChanges {
+					slices.Sort(ch.UIDs)
+					changes = append(changes, ch)
+				}
+			}
+
+			var maxUIDValidity uint32
+			var totalSize int64
+			for _, mb := range mailboxes {
+				maxUIDValidity = max(maxUIDValidity, mb.UIDValidity)
+
+				var changed bool
+				mc, err := mb.CalculateCounts(tx)
+				if err != nil {
+					return fmt.Errorf("calculating counts for mailbox %q: %v", mb.Name, err)
+				}
+				totalSize += mc.Size
+				if !mb.HaveCounts || mb.MailboxCounts != mc {
+					add("counts", "mailbox %q has counts %s, should be %s", mb.Name, mb.MailboxCounts, mc)
+					mb.HaveCounts = true
+					mb.MailboxCounts = mc
+					changes = append(changes, mb.ChangeCounts())
+					changed = true
+				}
+				if uid, ok := maxUIDs[mb.ID]; ok && uid >= mb.UIDNext {
+					add("uidnext", "mailbox %q has uidnext %d, but has message with uid %d", mb.Name, mb.UIDNext, uid)
+					mb.UIDNext = uid + 1
+					changed = true
+				}
+				if repair && changed {
+					if err := tx.Update(&mb); err != nil {
+						return fmt.Errorf("updating mailbox %q: %v", mb.Name, err)
+					}
+				}
+			}
+
+			if maxUIDValidity >= nuv.Next {
+				add("uidvalidity", "account next uidvalidity %d is not above highest mailbox uidvalidity %d", nuv.Next, maxUIDValidity)
+				if repair {
+					nuv.Next = maxUIDValidity + 1
+					if err := tx.Update(&nuv); err != nil {
+						return fmt.Errorf("updating next uidvalidity: %v", err)
+					}
+				}
+			}
+
+			du := DiskUsage{ID: 1}
+			if err := tx.Get(&du); err != nil {
+				return fmt.Errorf("get disk usage: %v", err)
+			}
+			if du.MessageSize != totalSize {
+				add("messagesize", "total message size is %d, should be %d", du.MessageSize, totalSize)
+				if repair {
+					du.MessageSize = totalSize
+					if err := tx.Update(&du); err != nil {
+						return fmt.Errorf("updating disk usage: %v", err)
+					}
+				}
+			}
+
+			// Look for files that don't belong to a (non-expunged) message.
+			msgDir := filepath.Join(a.Dir, "msg")
+			err = filepath.WalkDir(msgDir, func(p string, d fs.DirEntry, err error) error {
+				if err != nil {
+					if p == msgDir && os.IsNotExist(err) {
+						return nil
+					}
+					return err
+				}
+				if d.IsDir() {
+					return nil
+				}
+				id, err := strconv.ParseInt(d.Name(), 10, 64)
+				_, ok := files[id]
+				if err == nil && ok && p == a.MessagePath(id) {
+					return nil
+				}
+				add("orphanfile", "file %s does not belong to a message", p)
+				removeFiles = append(removeFiles, p)
+				return nil
+			})
+			if err != nil {
+				return fmt.Errorf("walking message directory: %v", err)
+			}
+			return nil
+		}
+
+		if repair {
+			rerr = a.DB.Write(ctx, fsck)
+		} else {
+			rerr = a.DB.Read(ctx, fsck)
+		}
+		if rerr != nil || !repair {
+			return
+		}
+
+		BroadcastChanges(a, changes)
+
+		for _, p := range removeFiles {
+			err := os.Remove(p)
+			log.Check(err, "removing orphaned message file", slog.String("path", p))
+		}
+	})
+	return problems, rerr
+}
@@ -0,0 +1,94 @@
+package store
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/mjl-/bstore"
+
+	"github.com/mjl-/mox/mox-"
+)
+
+func TestFsck(t *testing.T) {
+	log := pkglog
+	os.RemoveAll("../testdata/store/data")
+	mox.ConfigStaticPath = filepath.FromSlash("../testdata/store/mox.conf")
+	mox.MustLoadConfig(true, false)
+	acc, err := OpenAccount(log, "mjl", false)
+	tcheck(t, err, "open account")
+	defer func() {
+		err = acc.Close()
+		tcheck(t, err, "closing account")
+		acc.CheckClosed()
+	}()
+	defer Switchboard()()
+
+	deliver := func() Message {
+		t.Helper()
+		msgFile, err := CreateMessageTemp(log, "fsck-test")
+		tcheck(t, err, "temp message file")
+		defer CloseRemoveTempFile(log, msgFile, "test message")
+		_, err = msgFile.Write([]byte("From: <mjl@mox.example>\r\nSubject: test\r\n\r\ntest\r\n"))
+		tcheck(t, err, "write message")
+		st, err := msgFile.Stat()
+		tcheck(t, err, "stat message file")
+		m := Message{Received: time.Now(), Size: st.Size()}
+		acc.WithWLock(func() {
+			err := acc.DeliverMailbox(log, "Inbox", &m, msgFile)
+			tcheck(t, err, "deliver")
+		})
+		return m
+	}
+
+	fsck := func(repair bool, expKinds ...string) {
+		t.Helper()
+		problems, err := acc.Fsck(ctxbg, log, repair)
+		tcheck(t, err, "fsck")
+		var kinds []string
+		for _, p := range problems {
+			kinds = append(kinds, p.Kind)
+			if p.Repaired != repair {
+				t.Fatalf("problem %v, expected repaired %v", p, repair)
+			}
+		}
+		slices.Sort(kinds)
+		slices.Sort(expKinds)
+		tcompare(t, kinds, expKinds)
+	}
+
+	m0 := deliver()
+	deliver()
+	fsck(false)
+
+	// Missing message file, orphaned file, and bad uidnext.
+	err = os.Remove(acc.MessagePath(m0.ID))
+	tcheck(t, err, "remove message file")
+	orphan := acc.MessagePath(m0.ID + 100)
+	err = os.WriteFile(orphan, []byte("orphan"), 0660)
+	tcheck(t, err, "write orphan file")
+	mb, err := bstore.QueryDB[Mailbox](ctxbg, acc.DB).FilterNonzero(Mailbox{Name: "Inbox"}).Get()
+	tcheck(t, err, "get inbox")
+	mb.UIDNext = 1
+	err = acc.DB.Update(ctxbg, &mb)
+	tcheck(t, err, "update mailbox")
+
+	fsck(false, "missingfile", "orphanfile", "uidnext")
+	// Nothing repaired.
+	fsck(false, "missingfile", "orphanfile", "uidnext")
+
+	// Repairing expunges the message without file, which changes mailbox counts and
+	// total message size.
+	fsck(true, "missingfile", "orphanfile", "uidnext", "counts", "messagesize")
+	fsck(false)
+	if _, err := os.Stat(orphan); !os.IsNotExist(err) {
+		t.Fatalf("orphan file still present, stat: %v", err)
+	}
+	err = acc.DB.Get(ctxbg, &m0)
+	tcheck(t, err, "get message")
+	tcompare(t, m0.Expunged, true)
+	err = acc.CheckConsistency()
+	tcheck(t, err, "check consistency")
+}
@@ -0,0 +1,159 @@
+package store
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/mjl-/bstore"
+)
+
+// FuzzySearch holds the words of a search string for approximate matching, as
+// used for IMAP SEARCH=FUZZY. Each word of the search string is compared against
+// the words of a message, lower-cased, with a relevancy score of 100 for an exact
+// match, 90 for a word containing the search word (as with regular search), and
+// lower scores for words within a small edit distance, e.g. with a typo. A message
+// matches if each search word matches some word in the message. Its relevancy is
+// the average of the scores of the search words.
+type FuzzySearch struct {
+	words [][]rune
+}
+
+// PrepareFuzzySearch returns a fuzzy search for the words in s.
+func PrepareFuzzySearch(s string) FuzzySearch {
+	var fs FuzzySearch
+	for _, w := range textWords(s) {
+		fs.words = append(fs.words, []rune(w))
+	}
+	return fs
+}
+
+// textWords returns the lower-cased words, sequences of letters and digits, in
+// s, like words in the TextIndex.
+func textWords(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(c rune) bool {
+		return !unicode.IsLetter(c) && !unicode.IsDigit(c)
+	})
+}
+
+// MatchIndex returns the relevancy score of the message with msgID, between 0
+// (no match) and 100, according to its TextIndex. If the message has no
+// TextIndex, indexed is false and the caller must fall back to a regular search.
+// The TextIndex does not distinguish between words in headers and bodies.
+func (fs FuzzySearch) MatchIndex(tx *bstore.Tx, msgID int64) (score int, indexed bool, rerr error) {
+	ti := TextIndex{ID: msgID}
+	if err := tx.Get(&ti); err == bstore.ErrAbsent {
+		return 0, false, nil
+	} else if err != nil {
+		return 0, false, fmt.Errorf("get text index: %w", err)
+	}
+	return fs.score(func(fn func(w string)) {
+		s := ti.Words
+		for s != "" {
+			var w string
+			w, s, _ = strings.Cut(s, "\n")
+			fn(w)
+		}
+	}), true, nil
+}
+
+// MatchText returns the relevancy score for text, e.g. a header value, between 0
+// (no match) and 100.
+func (fs FuzzySearch) MatchText(text string) int {
+	words := textWords(text)
+	return fs.score(func(fn func(w string)) {
+		for _, w := range words {
+			fn(w)
+		}
+	})
+}
+
+// score returns the relevancy for the words from the iterator.
+func (fs FuzzySearch) score(forEach func(fn func(w string))) int {
+	if len(fs.words) == 0 {
+		return 100
+	}
+	best := make([]int, len(fs.words))
+	forEach(func(w string) {
+		var wr []rune
+		for i, q := range fs.words {
+			if best[i] == 100 {
+				continue
+			}
+			if wr == nil {
+				wr = []rune(w)
+			}
+			if s := fuzzyWordScore(q, wr); s > best[i] {
+				best[i] = s
+			}
+		}
+	})
+	var total int
+	for _, s := range best {
+		if s == 0 {
+			return 0
+		}
+		total += s
+	}
+	return total / len(best)
+}
+
+// fuzzyWordScore returns the score for search word q against word w.
+func fuzzyWordScore(q, w []rune) int {
+	if len(q) == len(w) && string(q) == string(w) {
+		return 100
+	}
+	if len(w) > len(q) && strings.Contains(string(w), string(q)) {
+		return 90
+	}
+
+	// Short words would match too many other words with a typo.
+	maxDist := 2
+	if len(q) < 4 {
+		return 0
+	} else if len(q) < 8 {
+		maxDist = 1
+	}
+	if len(w) < len(q)-maxDist || len(w) > len(q)+maxDist {
+		return 0
+	}
+	d := editDistance(q, w, maxDist)
+	if d > maxDist {
+		return 0
+	}
+	return 80 - 20*(d-1)
+}
+
+// editDistance returns the number of single character insertions, deletions,
+// substitutions and transpositions of adjacent characters to get from a to b
+// (optimal string alignment distance). Once the distance exceeds limit, limit+1 is
+// returned.
+func editDistance(a, b []rune, limit int) int {
+	// Three rows of the matrix, for the transposition.
+	prev2 := make([]int, len(b)+1)
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		rowMin := cur[0]
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] {
+				cur[j] = min(cur[j], prev2[j-2]+1)
+			}
+			rowMin = min(rowMin, cur[j])
+		}
+		if rowMin > limit {
+			return limit + 1
+		}
+		prev2, prev, cur = prev, cur, prev2
+	}
+	return prev[len(b)]
+}
@@ -0,0 +1,33 @@
+package store
+
+import (
+	"testing"
+)
+
+func TestFuzzySearch(t *testing.T) {
+	test := func(search, text string, expScore int) {
+		t.Helper()
+		score := PrepareFuzzySearch(search).MatchText(text)
+		tcompare(t, score, expScore)
+	}
+
+	test("meeting", "Afternoon meeting", 100)
+	test("Meeting", "afternoon MEETING", 100)
+	test("meet", "afternoon meeting", 90)     // Substring.
+	test("meting", "afternoon meeting", 80)   // Insertion.
+	test("meetnig", "afternoon meeting", 80)  // Transposition.
+	test("meetinx", "afternoon meeting", 80)  // Substitution.
+	test("mweetinx", "afternoon meeting", 60) // Two edits for longer words.
+	test("meetinxx", "afternoon meeting", 60)
+	test("mxxting", "afternoon meeting", 0) // Too many edits for length.
+	test("jeo", "hello joe", 0)             // Short words must match exactly.
+	test("afternon meeting", "afternoon meeting", 90)
+	test("afternon bogus", "afternoon meeting", 0) // All words must match.
+	test("", "afternoon meeting", 100)
+	test("meeting", "", 0)
+
+	tcompare(t, editDistance([]rune("kitten"), []rune("sitting"), 5), 3)
+	tcompare(t, editDistance([]rune("kitten"), []rune("sitting"), 1), 2)
+	tcompare(t, editDistance([]rune("ab"), []rune("ba"), 2), 1)
+	tcompare(t, editDistance([]rune("é"), []rune("e"), 2), 1)
+}
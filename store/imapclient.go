@@ -0,0 +1,132 @@
+package store
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mjl-/bstore"
+)
+
+// IMAPClient is an entry in the inventory of IMAP client software in use by an
+// account, as identified by the client with the IMAP ID command. Useful for
+// finding which clients would be affected by changes, like disabling legacy
+// authentication mechanisms.
+//
+// Entries are removed after not having been used for 90 days.
+type IMAPClient struct {
+	// Hash of AccountName and the fields Name through OSVersion. We store a single
+	// entry per key, updating its Last and Count fields.
+	Key []byte
+
+	AccountName string `bstore:"nonzero,index AccountName+Last"`
+
+	// From the ID parameters "name", "version", "vendor", "os" and "os-version".
+	Name      string
+	Version   string
+	Vendor    string
+	OS        string
+	OSVersion string
+
+	// All ID parameters of the most recent login, with lower-case keys.
+	Params map[string]string
+
+	First  time.Time `bstore:"nonzero,default now"`
+	Last   time.Time `bstore:"nonzero,default now,index"`
+	Count  int64     // Number of logins.
+	Denied int64     // Number of logins denied by IMAP client rules.
+}
+
+// IMAPClientAdd records a login by an IMAP client with ID parameters for an
+// account in the inventory, as denied if the login was refused by an IMAP client
+// rule.
+func IMAPClientAdd(ctx context.Context, accountName string, params map[string]string, denied bool) error {
+	lparams := map[string]string{}
+	for k, v := range params {
+		lparams[strings.ToLower(k)] = v
+	}
+	c := IMAPClient{
+		AccountName: accountName,
+		Name:        lparams["name"],
+		Version:     lparams["version"],
+		Vendor:      lparams["vendor"],
+		OS:          lparams["os"],
+		OSVersion:   lparams["os-version"],
+		Params:      lparams,
+	}
+	h := sha256.New()
+	for _, s := range []string{c.AccountName, c.Name, c.Version, c.Vendor, c.OS, c.OSVersion} {
+		// Length-prefixed, so fields cannot run into each other.
+		fmt.Fprintf(h, "%d:%s", len(s), s)
+	}
+	c.Key = h.Sum(nil)
+
+	return AuthDB.Write(ctx, func(tx *bstore.Tx) error {
+		xc := IMAPClient{Key: c.Key}
+		err := tx.Get(&xc)
+		if err == bstore.ErrAbsent {
+			c.Count = 1
+			if denied {
+				c.Denied = 1
+			}
+			if err := tx.Insert(&c); err != nil {
+				return fmt.Errorf("inserting imap client: %v", err)
+			}
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("get imap client: %v", err)
+		}
+		xc.Params = c.Params
+		xc.Last = time.Now()
+		xc.Count++
+		if denied {
+			xc.Denied++
+		}
+		if err := tx.Update(&xc); err != nil {
+			return fmt.Errorf("updating imap client: %v", err)
+		}
+		return nil
+	})
+}
+
+// IMAPClientList returns the IMAP clients for accountName, or for all accounts
+// if accountName is empty, most recently used first.
+func IMAPClientList(ctx context.Context, accountName string) ([]IMAPClient, error) {
+	var l []IMAPClient
+	err := AuthDB.Read(ctx, func(tx *bstore.Tx) error {
+		q := bstore.QueryTx[IMAPClient](tx)
+		if accountName != "" {
+			q.FilterNonzero(IMAPClient{AccountName: accountName})
+		}
+		q.SortDesc("Last")
+		var err error
+		l, err = q.List()
+		return err
+	})
+	return l, err
+}
+
+// IMAPClientCleanup removes IMAPClient entries not used in the last 90 days.
+func IMAPClientCleanup(ctx context.Context) error {
+	return AuthDB.Write(ctx, func(tx *bstore.Tx) error {
+		q := bstore.QueryTx[IMAPClient](tx)
+		q.FilterLess("Last", time.Now().Add(-90*24*time.Hour))
+		if _, err := q.Delete(); err != nil {
+			return fmt.Errorf("deleting old imap clients: %v", err)
+		}
+		return nil
+	})
+}
+
+// IMAPClientRemoveAccount removes all IMAPClient entries for an account (value
+// must be non-empty).
+func IMAPClientRemoveAccount(ctx context.Context, accountName string) error {
+	return AuthDB.Write(ctx, func(tx *bstore.Tx) error {
+		q := bstore.QueryTx[IMAPClient](tx)
+		q.FilterNonzero(IMAPClient{AccountName: accountName})
+		_, err := q.Delete()
+		return err
+	})
+}
@@ -6,9 +6,11 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"log/slog"
 	"os"
 	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
@@ -24,11 +26,56 @@ type MsgSource interface {
 	Next() (*Message, *os.File, string, error)
 }
 
+// MsgSourceDeferred is implemented by a MsgSource of which messages can be read
+// independently of each other, e.g. files of a maildir, so they can be read and
+// converted in parallel.
+type MsgSourceDeferred interface {
+	MsgSource
+
+	// NextDeferred returns the position of the next message, and a function to read
+	// and convert it. The read functions can be called concurrently and in any order.
+	// Returns io.EOF when there are no more messages.
+	NextDeferred() (origPath string, read func() (*Message, *os.File, error), err error)
+}
+
+// MboxDialect is a variant of the mbox format. Variants differ in how messages
+// are separated and how lines starting with "From " in messages are quoted. See
+// https://doc.dovecot.org/admin_manual/mailbox_formats/mbox/ and
+// https://www.loc.gov/preservation/digital/formats/fdd/fdd000383.shtml.
+type MboxDialect string
+
+const (
+	// Messages start at a "From " line after an empty line, or at the end of the body
+	// as indicated by a Content-Length header, if that is followed by the end of the
+	// file or a "From " line. Quoted lines of the form ">From ", with one or more
+	// ">", have one ">" removed.
+	MboxAuto MboxDialect = ""
+
+	// Messages start at a "From " line after an empty line. Lines ">From " are
+	// unquoted to "From ".
+	MboxO MboxDialect = "mboxo"
+
+	// Like mboxo, but lines with one or more ">" followed by "From " have one ">"
+	// removed.
+	MboxRD MboxDialect = "mboxrd"
+
+	// Like mboxo, but the body of a message with a Content-Length header ends after
+	// that many bytes, optionally followed by an empty line.
+	MboxCL MboxDialect = "mboxcl"
+
+	// Like mboxcl, but lines starting with "From " are not quoted.
+	MboxCL2 MboxDialect = "mboxcl2"
+)
+
+// MboxDialects are the dialects that can be selected explicitly.
+var MboxDialects = []MboxDialect{MboxO, MboxRD, MboxCL, MboxCL2}
+
 // MboxReader reads messages from an mbox file, implementing MsgSource.
 type MboxReader struct {
 	log        mlog.Log
 	createTemp func(log mlog.Log, pattern string) (*os.File, error)
 	path       string
+	dialect    MboxDialect
 	line       int
 	r          *bufio.Reader
 	prevempty  bool
@@ -38,11 +85,14 @@ type MboxReader struct {
 	header     bool   // Now in header section.
 }
 
-func NewMboxReader(log mlog.Log, createTemp func(log mlog.Log, pattern string) (*os.File, error), filename string, r io.Reader) *MboxReader {
+// NewMboxReader returns a reader for messages in an mbox file of the dialect,
+// typically MboxAuto.
+func NewMboxReader(log mlog.Log, createTemp func(log mlog.Log, pattern string) (*os.File, error), filename string, r io.Reader, dialect MboxDialect) *MboxReader {
 	return &MboxReader{
 		log:        log,
 		createTemp: createTemp,
 		path:       filename,
+		dialect:    dialect,
 		line:       1,
 		r:          bufio.NewReader(r),
 	}
@@ -94,6 +144,7 @@ func (mr *MboxReader) Next() (*Message, *os.File, string, error) {
 	var flags Flags
 	keywords := map[string]bool{}
 	var size int64
+	contentLength := int64(-1)
 	for {
 		line, err := mr.r.ReadBytes('\n')
 		if err != nil && err != io.EOF {
@@ -151,10 +202,33 @@ func (mr *MboxReader) Next() (*Message, *os.File, string, error) {
 							}
 						}
 					}
+				} else if mr.dialect != MboxO && mr.dialect != MboxRD && len(line) > len("content-length:") && strings.EqualFold(string(line[:len("content-length:")]), "content-length:") {
+					n, err := strconv.ParseInt(strings.TrimSpace(string(line[len("content-length:"):])), 10, 64)
+					if err == nil && n >= 0 {
+						contentLength = n
+					}
 				}
 			}
-			if bytes.Equal(line, []byte("\r\n")) {
+			if mr.header && bytes.Equal(line, []byte("\r\n")) {
 				mr.header = false
+				if contentLength >= 0 {
+					n, err := bf.Write(line)
+					if err != nil {
+						return nil, nil, mr.Position(), fmt.Errorf("writing message to file: %v", err)
+					}
+					size += int64(n)
+					mr.prevempty = true
+
+					var ok bool
+					size, ok, err = mr.readBody(f, bf, size, contentLength)
+					if err != nil {
+						return nil, nil, mr.Position(), err
+					} else if ok {
+						break
+					}
+					// Content-Length was wrong, continue with "From " lines as separator.
+					continue
+				}
 			}
 
 			// Next mail message starts at bare From word.
@@ -163,9 +237,7 @@ func (mr *MboxReader) Next() (*Message, *os.File, string, error) {
 				mr.header = true
 				break
 			}
-			if bytes.HasPrefix(line, []byte(">")) && bytes.HasPrefix(bytes.TrimLeft(line, ">"), []byte("From ")) {
-				line = line[1:]
-			}
+			line = mr.unquote(line)
 			n, err := bf.Write(line)
 			if err != nil {
 				return nil, nil, mr.Position(), fmt.Errorf("writing message to file: %v", err)
@@ -202,6 +274,136 @@ func (mr *MboxReader) Next() (*Message, *os.File, string, error) {
 	return m, mf, mr.Position(), nil
 }
 
+// unquote returns line with quoting of a "From " line removed, according to the
+// dialect.
+func (mr *MboxReader) unquote(line []byte) []byte {
+	switch mr.dialect {
+	case MboxO, MboxCL:
+		if bytes.HasPrefix(line, []byte(">From ")) {
+			return line[1:]
+		}
+	case MboxCL2:
+	default:
+		if bytes.HasPrefix(line, []byte(">")) && bytes.HasPrefix(bytes.TrimLeft(line, ">"), []byte("From ")) {
+			return line[1:]
+		}
+	}
+	return line
+}
+
+// readBody reads a message body of n bytes, as indicated by a Content-Length
+// header, and writes it to bf, which writes to f, which currently holds size
+// bytes. The body must be followed by the end of the file, or a "From " line,
+// optionally preceded by an empty line. If not, the Content-Length is wrong. For
+// MboxAuto, the reader is then rewound to the first line in the body that could
+// start a new message, f is truncated accordingly and false is returned, so the
+// caller can continue with "From " lines as separator. For other dialects, an
+// error is returned.
+func (mr *MboxReader) readBody(f *os.File, bf *bufio.Writer, size, n int64) (nsize int64, ok bool, rerr error) {
+	from := []byte("From ")
+	empty := func(line []byte) bool {
+		return bytes.Equal(line, []byte("\n")) || bytes.Equal(line, []byte("\r\n"))
+	}
+
+	// Lines read from the first line that could start a new message, for rewinding.
+	var raw bytes.Buffer
+	rawSize := int64(-1) // Size of message at start of raw.
+	var rawLine int
+	var rawPrevempty bool
+	record := func(line []byte) {
+		if rawSize < 0 {
+			rawSize = size
+			rawLine = mr.line
+			rawPrevempty = mr.prevempty
+		}
+		raw.Write(line)
+	}
+
+	var nread int64
+	for nread < n {
+		line, err := mr.r.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return size, false, fmt.Errorf("reading from mbox: %v", err)
+		}
+		if len(line) == 0 {
+			break
+		}
+		if mr.dialect == MboxAuto && (rawSize >= 0 || mr.prevempty && bytes.HasPrefix(line, from)) {
+			record(line)
+		}
+		mr.line++
+		nread += int64(len(line))
+		mr.prevempty = empty(line)
+		// We store data with crlf, adjust any imported messages with bare newlines.
+		if !bytes.HasSuffix(line, []byte("\r\n")) {
+			line = append(line[:len(line)-1], "\r\n"...)
+		}
+		line = mr.unquote(line)
+		xn, err := bf.Write(line)
+		if err != nil {
+			return size, false, fmt.Errorf("writing message to file: %v", err)
+		}
+		size += int64(xn)
+	}
+
+	// Check that the next message starts at the end of the body.
+	if nread == n {
+		line, err := mr.r.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return size, false, fmt.Errorf("reading from mbox: %v", err)
+		}
+		if len(line) == 0 {
+			mr.eof = true
+			return size, true, nil
+		}
+		if empty(line) {
+			if buf, err := mr.r.Peek(len(from)); len(buf) == 0 && err == io.EOF {
+				mr.line++
+				mr.eof = true
+				return size, true, nil
+			} else if bytes.Equal(buf, from) {
+				mr.line++
+				line, err = mr.r.ReadBytes('\n')
+				if err != nil && err != io.EOF {
+					return size, false, fmt.Errorf("reading from mbox: %v", err)
+				}
+			} else if mr.dialect == MboxAuto {
+				record(line)
+			}
+		}
+		if bytes.HasPrefix(line, from) {
+			mr.line++
+			mr.fromLine = strings.TrimSpace(string(line))
+			mr.header = true
+			return size, true, nil
+		} else if mr.dialect == MboxAuto && !empty(line) {
+			record(line)
+		}
+	}
+
+	if mr.dialect != MboxAuto {
+		return size, false, fmt.Errorf("message body does not end at content-length %d", n)
+	}
+	if rawSize < 0 {
+		return size, false, nil
+	}
+
+	// Rewind.
+	if err := bf.Flush(); err != nil {
+		return size, false, fmt.Errorf("flush: %v", err)
+	}
+	if err := f.Truncate(rawSize); err != nil {
+		return size, false, fmt.Errorf("truncating message file: %v", err)
+	}
+	if _, err := f.Seek(rawSize, 0); err != nil {
+		return size, false, fmt.Errorf("seek in message file: %v", err)
+	}
+	mr.r = bufio.NewReader(io.MultiReader(&raw, mr.r))
+	mr.line = rawLine
+	mr.prevempty = rawPrevempty
+	return rawSize, false, nil
+}
+
 type MaildirReader struct {
 	log          mlog.Log
 	createTemp   func(log mlog.Log, pattern string) (*os.File, error)
@@ -234,6 +436,17 @@ func NewMaildirReader(log mlog.Log, createTemp func(log mlog.Log, pattern string
 }
 
 func (mr *MaildirReader) Next() (*Message, *os.File, string, error) {
+	p, read, err := mr.NextDeferred()
+	if err != nil {
+		return nil, nil, p, err
+	}
+	m, f, err := read()
+	return m, f, p, err
+}
+
+// NextDeferred returns the path of the next message file, and a function to read
+// it.
+func (mr *MaildirReader) NextDeferred() (string, func() (*Message, *os.File, error), error) {
 	if mr.dir == "" {
 		mr.dir = mr.f.Name()
 	}
@@ -242,23 +455,31 @@ func (mr *MaildirReader) Next() (*Message, *os.File, string, error) {
 		var err error
 		mr.entries, err = mr.f.ReadDir(100)
 		if err != nil && err != io.EOF {
-			return nil, nil, "", err
+			return "", nil, err
 		}
 		if len(mr.entries) == 0 {
 			if mr.f == mr.curf {
-				return nil, nil, "", io.EOF
+				return "", nil, io.EOF
 			}
 			mr.f = mr.curf
 			mr.dir = ""
-			return mr.Next()
+			return mr.NextDeferred()
 		}
 	}
 
 	p := filepath.Join(mr.dir, mr.entries[0].Name())
 	mr.entries = mr.entries[1:]
+	return p, func() (*Message, *os.File, error) {
+		return mr.read(p)
+	}, nil
+}
+
+// read reads the message file at p, converting bare newlines to crlf, and parses
+// flags from the file name. Safe for concurrent use.
+func (mr *MaildirReader) read(p string) (*Message, *os.File, error) {
 	sf, err := os.Open(p)
 	if err != nil {
-		return nil, nil, p, fmt.Errorf("open message in maildir: %s", err)
+		return nil, nil, fmt.Errorf("open message in maildir: %s", err)
 	}
 	defer func() {
 		err := sf.Close()
@@ -266,7 +487,7 @@ func (mr *MaildirReader) Next() (*Message, *os.File, string, error) {
 	}()
 	f, err := mr.createTemp(mr.log, "maildirreader")
 	if err != nil {
-		return nil, nil, p, err
+		return nil, nil, err
 	}
 	defer func() {
 		if f != nil {
@@ -285,7 +506,7 @@ func (mr *MaildirReader) Next() (*Message, *os.File, string, error) {
 	for {
 		line, err := r.ReadBytes('\n')
 		if err != nil && err != io.EOF {
-			return nil, nil, p, fmt.Errorf("reading message: %v", err)
+			return nil, nil, fmt.Errorf("reading message: %v", err)
 		}
 		if len(line) > 0 {
 			if !bytes.HasSuffix(line, []byte("\r\n")) {
@@ -293,7 +514,7 @@ func (mr *MaildirReader) Next() (*Message, *os.File, string, error) {
 			}
 
 			if n, err := w.Write(line); err != nil {
-				return nil, nil, p, fmt.Errorf("writing message: %v", err)
+				return nil, nil, fmt.Errorf("writing message: %v", err)
 			} else {
 				size += int64(n)
 			}
@@ -303,7 +524,7 @@ func (mr *MaildirReader) Next() (*Message, *os.File, string, error) {
 		}
 	}
 	if err := w.Flush(); err != nil {
-		return nil, nil, p, fmt.Errorf("writing message: %v", err)
+		return nil, nil, fmt.Errorf("writing message: %v", err)
 	}
 
 	// Take received time from filename, falling back to mtime for maildirs
@@ -367,9 +588,476 @@ func (mr *MaildirReader) Next() (*Message, *os.File, string, error) {
 	mf := f
 	f = nil
 
+	return m, mf, nil
+}
+
+// importKeyword sets the flag for a well-known keyword, or adds word as keyword
+// if it is valid. Used for keywords, labels and sequences of imported messages.
+func importKeyword(flags *Flags, keywords map[string]bool, word string) {
+	switch word = strings.ToLower(word); word {
+	case "forwarded", "$forwarded":
+		flags.Forwarded = true
+	case "junk", "$junk":
+		flags.Junk = true
+	case "notjunk", "$notjunk", "nonjunk", "$nonjunk":
+		flags.Notjunk = true
+	case "phishing", "$phishing":
+		flags.Phishing = true
+	case "mdnsent", "$mdnsent":
+		flags.MDNSent = true
+	default:
+		if err := CheckKeyword(word); err == nil {
+			keywords[word] = true
+		}
+	}
+}
+
+// mhRange is a range of message numbers in an MH sequence, inclusive.
+type mhRange struct {
+	first, last int64
+}
+
+// MHReader reads messages from an MH folder, as used by nmh, mh-e and Claws Mail,
+// implementing MsgSource. Messages are the files with a numeric name, read in
+// order. Flags and keywords are read from the sequences in the .mh_sequences file.
+// Subfolders are not read.
+type MHReader struct {
+	log        mlog.Log
+	createTemp func(log mlog.Log, pattern string) (*os.File, error)
+	dir        string
+	msgs       []int64              // Remaining message numbers.
+	sequences  map[string][]mhRange // Lower-case sequence name to message ranges.
+}
+
+// NewMHReader returns a reader for the MH folder at dir.
+func NewMHReader(log mlog.Log, createTemp func(log mlog.Log, pattern string) (*os.File, error), dir string) (*MHReader, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("reading mh folder: %v", err)
+	}
+	mr := &MHReader{
+		log:        log,
+		createTemp: createTemp,
+		dir:        dir,
+		sequences:  map[string][]mhRange{},
+	}
+	for _, e := range entries {
+		// Other files, like .mh_sequences and removed messages named ",<num>", and
+		// subfolders are skipped.
+		if v, err := strconv.ParseInt(e.Name(), 10, 64); err == nil && v > 0 && e.Type().IsRegular() {
+			mr.msgs = append(mr.msgs, v)
+		}
+	}
+	slices.Sort(mr.msgs)
+
+	sf, err := os.Open(filepath.Join(dir, ".mh_sequences"))
+	if err == nil {
+		defer func() {
+			err := sf.Close()
+			log.Check(err, "closing mh sequences file")
+		}()
+		err = mr.parseSequences(sf)
+		log.Check(err, "parsing mh sequences file", slog.String("dir", dir))
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("open mh sequences file: %v", err)
+	}
+	return mr, nil
+}
+
+// parseSequences parses lines of the form "name: 1-3 5 8", with continuation
+// lines starting with white space. Invalid lines and ranges are skipped, with
+// an error returned at the end.
+func (mr *MHReader) parseSequences(r io.Reader) error {
+	var lines []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		s := scanner.Text()
+		if len(lines) > 0 && s != "" && (s[0] == ' ' || s[0] == '\t') {
+			lines[len(lines)-1] += s
+		} else if strings.TrimSpace(s) != "" {
+			lines = append(lines, s)
+		}
+	}
+	var errs []string
+	if err := scanner.Err(); err != nil {
+		errs = append(errs, err.Error())
+	}
+	for _, s := range lines {
+		name, nums, ok := strings.Cut(s, ":")
+		if !ok {
+			errs = append(errs, fmt.Sprintf("unexpected sequence line: %q", s))
+			continue
+		}
+		name = strings.ToLower(strings.TrimSpace(name))
+		for _, t := range strings.Fields(nums) {
+			first, last, isRange := strings.Cut(t, "-")
+			a, err0 := strconv.ParseInt(first, 10, 64)
+			b := a
+			var err1 error
+			if isRange {
+				b, err1 = strconv.ParseInt(last, 10, 64)
+			}
+			if err0 != nil || err1 != nil || b < a {
+				errs = append(errs, fmt.Sprintf("invalid message range %q in sequence %q", t, name))
+				continue
+			}
+			mr.sequences[name] = append(mr.sequences[name], mhRange{a, b})
+		}
+	}
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// Next returns the next message from the MH folder. The file is a temporary file
+// and must be removed/consumed. The third return value is the path of the
+// message file.
+func (mr *MHReader) Next() (*Message, *os.File, string, error) {
+	if len(mr.msgs) == 0 {
+		return nil, nil, "", io.EOF
+	}
+	num := mr.msgs[0]
+	mr.msgs = mr.msgs[1:]
+
+	p := filepath.Join(mr.dir, strconv.FormatInt(num, 10))
+	sf, err := os.Open(p)
+	if err != nil {
+		return nil, nil, p, fmt.Errorf("open message in mh folder: %v", err)
+	}
+	defer func() {
+		err := sf.Close()
+		mr.log.Check(err, "closing message file")
+	}()
+	f, err := mr.createTemp(mr.log, "mhreader")
+	if err != nil {
+		return nil, nil, p, err
+	}
+	defer func() {
+		if f != nil {
+			CloseRemoveTempFile(mr.log, f, "message after mh read error")
+		}
+	}()
+
+	// Copy data, changing bare \n into \r\n.
+	r := bufio.NewReader(sf)
+	w := bufio.NewWriter(f)
+	var size int64
+	for {
+		line, err := r.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return nil, nil, p, fmt.Errorf("reading message: %v", err)
+		}
+		if len(line) > 0 {
+			if !bytes.HasSuffix(line, []byte("\r\n")) {
+				line = append(bytes.TrimSuffix(line, []byte("\n")), "\r\n"...)
+			}
+			if n, err := w.Write(line); err != nil {
+				return nil, nil, p, fmt.Errorf("writing message: %v", err)
+			} else {
+				size += int64(n)
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return nil, nil, p, fmt.Errorf("writing message: %v", err)
+	}
+
+	// MH doesn't store a received time. The modification time is typically the time
+	// the message was incorporated into the folder.
+	var received time.Time
+	if fi, err := sf.Stat(); err == nil {
+		received = fi.ModTime()
+	}
+
+	// Messages are seen unless in the "unseen" sequence.
+	flags := Flags{Seen: true}
+	keywords := map[string]bool{}
+	for name, ranges := range mr.sequences {
+		if !slices.ContainsFunc(ranges, func(r mhRange) bool { return num >= r.first && num <= r.last }) {
+			continue
+		}
+		switch name {
+		case "cur":
+			// Current message, not a flag.
+		case "unseen":
+			flags.Seen = false
+		case "flagged":
+			flags.Flagged = true
+		case "replied":
+			flags.Answered = true
+		default:
+			importKeyword(&flags, keywords, name)
+		}
+	}
+
+	m := &Message{Received: received, Flags: flags, Keywords: maps.Keys(keywords), Size: size}
+
+	// Prevent cleanup by defer.
+	mf := f
+	f = nil
+
 	return m, mf, p, nil
 }
 
+// BabylReader reads messages from an Emacs Rmail Babyl file, implementing
+// MsgSource.
+//
+// A Babyl file starts with an options section. Each message starts with a line
+// with a form feed, followed by a line with attributes and labels, the header,
+// and a line "*** EOOH ***" (end of original header). If the message was
+// reformatted for display by Rmail, the original header is before the EOOH line
+// and the reformatted header is after it. Messages end with a line starting with
+// 0x1f.
+type BabylReader struct {
+	log        mlog.Log
+	createTemp func(log mlog.Log, pattern string) (*os.File, error)
+	path       string
+	line       int
+	r          *bufio.Reader
+	nonfirst   bool // Whether options section has been read.
+	atMessage  bool // Whether the form feed of the next message has been read.
+	eof        bool
+}
+
+func NewBabylReader(log mlog.Log, createTemp func(log mlog.Log, pattern string) (*os.File, error), filename string, r io.Reader) *BabylReader {
+	return &BabylReader{
+		log:        log,
+		createTemp: createTemp,
+		path:       filename,
+		line:       1,
+		r:          bufio.NewReader(r),
+	}
+}
+
+// Position returns "<filename>:<lineno>" for the current position.
+func (br *BabylReader) Position() string {
+	return fmt.Sprintf("%s:%d", br.path, br.line)
+}
+
+// readLine returns the next line without line ending. At the end of the file, the
+// line is returned without error, and io.EOF after that.
+func (br *BabylReader) readLine() (string, error) {
+	line, err := br.r.ReadString('\n')
+	if err == io.EOF && line == "" {
+		return "", io.EOF
+	} else if err != nil && err != io.EOF {
+		return "", fmt.Errorf("reading from babyl file: %v", err)
+	}
+	br.line++
+	return strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r"), nil
+}
+
+// endMessage handles the remainder of a line that started with 0x1f, ending a
+// section.
+func (br *BabylReader) endMessage(rest string) {
+	br.atMessage = rest == "\f"
+}
+
+// Next returns the next message read from the Babyl file. The file is a temporary
+// file and must be removed/consumed. The third return value is the position in the
+// file.
+func (br *BabylReader) Next() (*Message, *os.File, string, error) {
+	if br.eof {
+		return nil, nil, "", io.EOF
+	}
+
+	if !br.nonfirst {
+		line, err := br.readLine()
+		if err == io.EOF {
+			br.eof = true
+			return nil, nil, "", io.EOF
+		} else if err != nil {
+			return nil, nil, br.Position(), err
+		}
+		if !strings.HasPrefix(line, "BABYL OPTIONS:") {
+			return nil, nil, br.Position(), fmt.Errorf(`first line does not start with "BABYL OPTIONS:"`)
+		}
+		for !strings.HasPrefix(line, "\x1f") {
+			line, err = br.readLine()
+			if err == io.EOF {
+				br.eof = true
+				return nil, nil, "", io.EOF
+			} else if err != nil {
+				return nil, nil, br.Position(), err
+			}
+		}
+		br.nonfirst = true
+		br.endMessage(line[1:])
+	}
+
+	// Find start of next message.
+	for !br.atMessage {
+		line, err := br.readLine()
+		if err == io.EOF {
+			br.eof = true
+			return nil, nil, "", io.EOF
+		} else if err != nil {
+			return nil, nil, br.Position(), err
+		}
+		if line == "\f" {
+			br.atMessage = true
+		} else if line != "" {
+			return nil, nil, br.Position(), fmt.Errorf("expected form feed at start of message, got %q", line)
+		}
+	}
+	br.atMessage = false
+
+	// Status line, e.g. "1, answered, unseen,, label1,". The first field indicates
+	// whether the header was reformatted.
+	status, err := br.readLine()
+	if err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, nil, br.Position(), err
+	}
+	if !strings.HasPrefix(status, "0,") && !strings.HasPrefix(status, "1,") {
+		return nil, nil, br.Position(), fmt.Errorf("unexpected message status line %q", status)
+	}
+	reformatted := status[0] == '1'
+	attrs, labels, _ := strings.Cut(status[2:], ",,")
+	flags := Flags{Seen: true}
+	keywords := map[string]bool{}
+	for _, s := range strings.Split(attrs, ",") {
+		switch strings.TrimSpace(s) {
+		case "unseen":
+			flags.Seen = false
+		case "deleted":
+			flags.Deleted = true
+		case "answered":
+			flags.Answered = true
+		case "forwarded":
+			flags.Forwarded = true
+		}
+		// Ignored: filed, edited, resent, retried.
+	}
+	for _, s := range strings.Split(labels, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			importKeyword(&flags, keywords, s)
+		}
+	}
+
+	f, err := br.createTemp(br.log, "babylreader")
+	if err != nil {
+		return nil, nil, br.Position(), err
+	}
+	defer func() {
+		if f != nil {
+			CloseRemoveTempFile(br.log, f, "message after babyl read error")
+		}
+	}()
+
+	bf := bufio.NewWriter(f)
+	var size int64
+	var received time.Time
+	write := func(line string) error {
+		n, err := bf.WriteString(line + "\r\n")
+		size += int64(n)
+		if err != nil {
+			return fmt.Errorf("writing message to file: %v", err)
+		}
+		return nil
+	}
+	// Rmail stores the mbox "From " line as "Mail-from:" header. We use it for the
+	// received time and don't store it.
+	isHeader := func(line string) bool {
+		if strings.HasPrefix(line, "Summary-line:") {
+			return false
+		} else if s, ok := strings.CutPrefix(line, "Mail-from:"); ok {
+			if t := strings.SplitN(strings.TrimSpace(s), " ", 3); len(t) == 3 {
+				for _, l := range []string{time.ANSIC, time.UnixDate, time.RubyDate} {
+					if tm, err := time.Parse(l, t[2]); err == nil {
+						received = tm
+						break
+					}
+				}
+			}
+			return false
+		}
+		return true
+	}
+
+	// Read until the EOOH line. For reformatted messages, this is the original header.
+	var header []string
+	for {
+		line, err := br.readLine()
+		if err == io.EOF {
+			return nil, nil, br.Position(), fmt.Errorf("missing end of original header line")
+		} else if err != nil {
+			return nil, nil, br.Position(), err
+		}
+		if line == "*** EOOH ***" {
+			break
+		} else if strings.HasPrefix(line, "\x1f") {
+			return nil, nil, br.Position(), fmt.Errorf("message without end of original header line")
+		}
+		if isHeader(line) {
+			header = append(header, line)
+		}
+	}
+	for len(header) > 0 && header[len(header)-1] == "" {
+		header = header[:len(header)-1]
+	}
+
+	// For reformatted messages, we write the original header and skip the reformatted
+	// header. Otherwise, the header follows the EOOH line.
+	inHeader := !reformatted
+	if reformatted {
+		for _, line := range header {
+			if err := write(line); err != nil {
+				return nil, nil, br.Position(), err
+			}
+		}
+		if err := write(""); err != nil {
+			return nil, nil, br.Position(), err
+		}
+	}
+	skip := reformatted
+	for {
+		line, err := br.readLine()
+		if err == io.EOF {
+			// Lenient about missing 0x1f at end of file.
+			br.eof = true
+			break
+		} else if err != nil {
+			return nil, nil, br.Position(), err
+		}
+		if strings.HasPrefix(line, "\x1f") {
+			br.endMessage(line[1:])
+			break
+		}
+		if skip {
+			skip = line != ""
+			continue
+		}
+		if inHeader {
+			if line == "" {
+				inHeader = false
+			} else if !isHeader(line) {
+				continue
+			}
+		}
+		if err := write(line); err != nil {
+			return nil, nil, br.Position(), err
+		}
+	}
+	if err := bf.Flush(); err != nil {
+		return nil, nil, br.Position(), fmt.Errorf("flush: %v", err)
+	}
+
+	m := &Message{Received: received, Flags: flags, Keywords: maps.Keys(keywords), Size: size}
+
+	// Prevent cleanup by defer.
+	mf := f
+	f = nil
+
+	return m, mf, br.Position(), nil
+}
+
 // ParseDovecotKeywordsFlags attempts to parse a dovecot-keywords file. It only
 // returns valid flags/keywords, as lower-case. If an error is encountered and
 // returned, any keywords that were found are still returned. The returned list has
@@ -1,10 +1,12 @@
 package store
 
 import (
+	"fmt"
 	"io"
 	"os"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/mjl-/mox/mlog"
 )
@@ -20,7 +22,7 @@ func TestMboxReader(t *testing.T) {
 	defer mboxf.Close()
 
 	log := mlog.New("mboxreader", nil)
-	mr := NewMboxReader(log, createTemp, mboxf.Name(), mboxf)
+	mr := NewMboxReader(log, createTemp, mboxf.Name(), mboxf, MboxAuto)
 	_, mf0, _, err := mr.Next()
 	if err != nil {
 		t.Fatalf("next mbox message: %v", err)
@@ -41,6 +43,77 @@ func TestMboxReader(t *testing.T) {
 	}
 }
 
+func TestMboxReaderDialects(t *testing.T) {
+	createTemp := func(log mlog.Log, pattern string) (*os.File, error) {
+		return os.CreateTemp("", pattern)
+	}
+	log := mlog.New("mboxreader", nil)
+
+	read := func(dialect MboxDialect, data string) ([]string, error) {
+		mr := NewMboxReader(log, createTemp, "test.mbox", strings.NewReader(data), dialect)
+		var l []string
+		for {
+			m, mf, _, err := mr.Next()
+			if err == io.EOF {
+				return l, nil
+			} else if err != nil {
+				return l, err
+			}
+			buf, err := os.ReadFile(mf.Name())
+			CloseRemoveTempFile(log, mf, "test message")
+			if err != nil {
+				t.Fatalf("read message: %v", err)
+			}
+			if int64(len(buf)) != m.Size {
+				t.Fatalf("message size %d, expected %d", m.Size, len(buf))
+			}
+			l = append(l, string(buf))
+		}
+	}
+
+	test := func(dialect MboxDialect, data string, expErr bool, exp ...string) {
+		t.Helper()
+		l, err := read(dialect, data)
+		if (err != nil) != expErr {
+			t.Fatalf("dialect %q: got err %v, expected error %v", dialect, err, expErr)
+		}
+		if !expErr && strings.Join(l, "\n---\n") != strings.Join(exp, "\n---\n") {
+			t.Fatalf("dialect %q: got messages %q, expected %q", dialect, l, exp)
+		}
+	}
+
+	body := "line\n\nFrom the start\n>From x\n>>From y\n"
+	mbox := func(contentLength int) string {
+		return fmt.Sprintf("From a Sun Jan 23 20:41:55 2022\nSubject: one\nContent-Length: %d\n\n%s\nFrom b Sun Jan 23 20:41:55 2022\nSubject: two\n\nhi\n", contentLength, body)
+	}
+	one := func(n int, body string) string {
+		return fmt.Sprintf("Subject: one\r\nContent-Length: %d\r\n\r\n", n) + body
+	}
+	two := "Subject: two\r\n\r\nhi\r\n"
+
+	// Content-Length splits messages, quoting depends on dialect.
+	n := len(body)
+	test(MboxAuto, mbox(n), false, one(n, "line\r\n\r\nFrom the start\r\nFrom x\r\n>From y\r\n"), two)
+	test(MboxCL, mbox(n), false, one(n, "line\r\n\r\nFrom the start\r\nFrom x\r\n>>From y\r\n"), two)
+	test(MboxCL2, mbox(n), false, one(n, "line\r\n\r\nFrom the start\r\n>From x\r\n>>From y\r\n"), two)
+
+	// Content-Length is ignored by dialects without it, "From " lines separate messages.
+	test(MboxRD, mbox(n), false, one(n, "line\r\n\r\n"), "From x\r\n>From y\r\n\r\n", two)
+	test(MboxO, mbox(n), false, one(n, "line\r\n\r\n"), "From x\r\n>>From y\r\n\r\n", two)
+
+	// Wrong Content-Length. Auto falls back to "From " lines, others fail.
+	for _, n := range []int{3, len(body) - 1, len(body) + 2, len(body) + 100} {
+		test(MboxAuto, mbox(n), false, one(n, "line\r\n\r\n"), "From x\r\n>From y\r\n\r\n", two)
+		test(MboxCL, mbox(n), true)
+		test(MboxCL2, mbox(n), true)
+	}
+
+	// Content-Length of last message, with and without trailing empty line.
+	data := "From a Sun Jan 23 20:41:55 2022\nContent-Length: 3\n\nhi\n"
+	test(MboxCL2, data, false, "Content-Length: 3\r\n\r\nhi\r\n")
+	test(MboxCL2, data+"\n", false, "Content-Length: 3\r\n\r\nhi\r\n")
+}
+
 func TestMaildirReader(t *testing.T) {
 	createTemp := func(log mlog.Log, pattern string) (*os.File, error) {
 		return os.CreateTemp("", pattern)
@@ -98,3 +171,110 @@ func TestParseDovecotKeywords(t *testing.T) {
 
 	}
 }
+
+func TestMHReader(t *testing.T) {
+	createTemp := func(log mlog.Log, pattern string) (*os.File, error) {
+		return os.CreateTemp("", pattern)
+	}
+	log := mlog.New("mhreader", nil)
+	mr, err := NewMHReader(log, createTemp, "../testdata/importtest.mh")
+	if err != nil {
+		t.Fatalf("new mh reader: %v", err)
+	}
+
+	expect := []struct {
+		subject  string
+		flags    Flags
+		keywords []string
+	}{
+		{"first", Flags{Seen: true, Flagged: true, Answered: true}, []string{"label1"}},
+		{"second", Flags{Flagged: true}, nil},
+		{"third", Flags{}, []string{"label1"}},
+	}
+	for _, exp := range expect {
+		m, mf, _, err := mr.Next()
+		if err != nil {
+			t.Fatalf("next mh message: %v", err)
+		}
+		defer os.Remove(mf.Name())
+		defer mf.Close()
+		buf, err := os.ReadFile(mf.Name())
+		if err != nil {
+			t.Fatalf("read message: %v", err)
+		}
+		if int64(len(buf)) != m.Size || !strings.Contains(string(buf), "Subject: "+exp.subject+"\r\n") {
+			t.Fatalf("got message %q with size %d, expected subject %q", buf, m.Size, exp.subject)
+		}
+		if m.Flags != exp.flags || strings.Join(m.Keywords, ",") != strings.Join(exp.keywords, ",") {
+			t.Fatalf("message %q: got flags %v, keywords %v, expected %v, %v", exp.subject, m.Flags, m.Keywords, exp.flags, exp.keywords)
+		}
+	}
+
+	_, _, _, err = mr.Next()
+	if err != io.EOF {
+		t.Fatalf("got err %v, expected eof for next mh message", err)
+	}
+}
+
+func TestBabylReader(t *testing.T) {
+	createTemp := func(log mlog.Log, pattern string) (*os.File, error) {
+		return os.CreateTemp("", pattern)
+	}
+	babylf, err := os.Open("../testdata/importtest.babyl")
+	if err != nil {
+		t.Fatalf("open babyl: %v", err)
+	}
+	defer babylf.Close()
+
+	log := mlog.New("babylreader", nil)
+	br := NewBabylReader(log, createTemp, babylf.Name(), babylf)
+
+	expect := []struct {
+		data     string
+		flags    Flags
+		keywords []string
+		received time.Time
+	}{
+		{
+			"Return-Path: <mjl@mox.test>\r\nFrom: mjl@mox.test\r\nTo: mjl@mox.test\r\nSubject: first\r\nDate: Wed, 10 Nov 2021 23:47:13 +0100\r\nMessage-ID: <first-babyl@mox.test>\r\n\r\nhello\r\n",
+			Flags{Seen: true, Answered: true},
+			[]string{"label1"},
+			time.Date(2021, 11, 10, 23, 47, 13, 0, time.UTC),
+		},
+		{
+			"From: mjl@mox.test\r\nTo: mjl@mox.test\r\nSubject: second\r\nDate: Wed, 10 Nov 2021 23:48:13 +0100\r\nMessage-ID: <second-babyl@mox.test>\r\n\r\nhello\r\n\r\nbye\r\n",
+			Flags{Deleted: true},
+			nil,
+			time.Time{},
+		},
+	}
+	for _, exp := range expect {
+		m, mf, _, err := br.Next()
+		if err != nil {
+			t.Fatalf("next babyl message: %v", err)
+		}
+		defer os.Remove(mf.Name())
+		defer mf.Close()
+		buf, err := os.ReadFile(mf.Name())
+		if err != nil {
+			t.Fatalf("read message: %v", err)
+		}
+		if string(buf) != exp.data || int64(len(buf)) != m.Size {
+			t.Fatalf("got message %q with size %d, expected %q", buf, m.Size, exp.data)
+		}
+		if m.Flags != exp.flags || strings.Join(m.Keywords, ",") != strings.Join(exp.keywords, ",") || !m.Received.Equal(exp.received) {
+			t.Fatalf("got flags %v, keywords %v, received %v, expected %v, %v, %v", m.Flags, m.Keywords, m.Received, exp.flags, exp.keywords, exp.received)
+		}
+	}
+
+	_, _, _, err = br.Next()
+	if err != io.EOF {
+		t.Fatalf("got err %v, expected eof for next babyl message", err)
+	}
+
+	// Not a babyl file.
+	br = NewBabylReader(log, createTemp, "test", strings.NewReader("From mox Sun Jan 23 20:41:55 2022\n"))
+	if _, _, _, err := br.Next(); err == nil || err == io.EOF {
+		t.Fatalf("got err %v, expected error for non-babyl file", err)
+	}
+}
@@ -0,0 +1,137 @@
+package store
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/mjl-/bstore"
+)
+
+// Scopes for ImportDedup.
+const (
+	ImportDedupMailbox = "mailbox" // Skip messages already present in the target mailbox.
+	ImportDedupAccount = "account" // Skip messages already present in any mailbox of the account.
+)
+
+// ImportDedup is used during an import to skip messages that are already present,
+// e.g. when running an import again. Messages are compared by Message-ID, or for
+// messages without Message-ID, by a hash of the full message. Messages delivered
+// during the import are included, so duplicates within the imported data are
+// skipped too.
+type ImportDedup struct {
+	acc   *Account
+	scope string
+
+	// Keys are a mailbox ID, 0 for scope account. Sets are loaded on first use.
+	messageIDs map[int64]map[string]struct{}
+	hashes     map[int64]map[[sha256.Size]byte]struct{}
+
+	Skipped int // Number of messages for which Duplicate returned true.
+}
+
+// NewImportDedup returns an ImportDedup for scope ImportDedupMailbox or
+// ImportDedupAccount, or nil for an empty scope.
+func NewImportDedup(acc *Account, scope string) (*ImportDedup, error) {
+	switch scope {
+	case "":
+		return nil, nil
+	case ImportDedupMailbox, ImportDedupAccount:
+	default:
+		return nil, fmt.Errorf("unknown deduplication scope %q, must be %q or %q", scope, ImportDedupMailbox, ImportDedupAccount)
+	}
+	d := &ImportDedup{
+		acc:        acc,
+		scope:      scope,
+		messageIDs: map[int64]map[string]struct{}{},
+		hashes:     map[int64]map[[sha256.Size]byte]struct{}{},
+	}
+	return d, nil
+}
+
+// Duplicate returns whether m, about to be delivered to m.MailboxID with its data
+// in f, is already present. Fields MailboxID, MsgPrefix and MessageID (see
+// PrepareThreading) of m must be set. If not a duplicate, m is registered as
+// present.
+func (d *ImportDedup) Duplicate(tx *bstore.Tx, m *Message, f *os.File) (bool, error) {
+	var key int64
+	if d.scope == ImportDedupMailbox {
+		key = m.MailboxID
+	}
+
+	// Existing messages in the scope, with or without Message-ID.
+	existing := func(withMessageID bool, fn func(m Message) error) error {
+		q := bstore.QueryTx[Message](tx)
+		if key != 0 {
+			q.FilterNonzero(Message{MailboxID: key})
+		}
+		q.FilterEqual("Expunged", false)
+		if withMessageID {
+			q.FilterNotEqual("MessageID", "")
+		} else {
+			q.FilterEqual("MessageID", "")
+		}
+		return q.ForEach(fn)
+	}
+
+	if m.MessageID != "" {
+		ids, ok := d.messageIDs[key]
+		if !ok {
+			ids = map[string]struct{}{}
+			err := existing(true, func(xm Message) error {
+				ids[xm.MessageID] = struct{}{}
+				return nil
+			})
+			if err != nil {
+				return false, fmt.Errorf("listing message-ids of existing messages: %v", err)
+			}
+			d.messageIDs[key] = ids
+		}
+		if _, ok := ids[m.MessageID]; ok {
+			d.Skipped++
+			return true, nil
+		}
+		ids[m.MessageID] = struct{}{}
+		return false, nil
+	}
+
+	hash := func(r io.Reader) ([sha256.Size]byte, error) {
+		var sum [sha256.Size]byte
+		h := sha256.New()
+		if _, err := io.Copy(h, r); err != nil {
+			return sum, err
+		}
+		copy(sum[:], h.Sum(nil))
+		return sum, nil
+	}
+
+	hashes, ok := d.hashes[key]
+	if !ok {
+		hashes = map[[sha256.Size]byte]struct{}{}
+		err := existing(false, func(xm Message) error {
+			mr := d.acc.MessageReader(xm)
+			defer mr.Close()
+			sum, err := hash(mr)
+			if err != nil {
+				return fmt.Errorf("reading message %d: %v", xm.ID, err)
+			}
+			hashes[sum] = struct{}{}
+			return nil
+		})
+		if err != nil {
+			return false, fmt.Errorf("hashing existing messages: %v", err)
+		}
+		d.hashes[key] = hashes
+	}
+	sum, err := hash(io.NewSectionReader(FileMsgReader(m.MsgPrefix, f), 0, m.Size))
+	if err != nil {
+		return false, fmt.Errorf("hashing message: %v", err)
+	}
+	if _, ok := hashes[sum]; ok {
+		d.Skipped++
+		return true, nil
+	}
+	hashes[sum] = struct{}{}
+	return false, nil
+}
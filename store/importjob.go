@@ -0,0 +1,90 @@
+package store
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/mjl-/bstore"
+)
+
+// ImportJobList returns the import jobs of the account, most recent first.
+func (a *Account) ImportJobList(ctx context.Context) ([]ImportJob, error) {
+	q := bstore.QueryDB[ImportJob](ctx, a.DB)
+	q.SortDesc("Started")
+	return q.List()
+}
+
+// ImportJobRemove removes an import job by ID. Messages already imported are
+// not removed. Without the job, an interrupted import cannot be continued, and a
+// new import of the same source starts at the first message.
+func (a *Account) ImportJobRemove(ctx context.Context, id int64) error {
+	return a.DB.Write(ctx, func(tx *bstore.Tx) error {
+		return tx.Delete(&ImportJob{ID: id})
+	})
+}
+
+// ImportSourceMessage is an ImportSource with the current mailbox and UID of its
+// message.
+type ImportSourceMessage struct {
+	ImportSource
+	Mailbox string
+	UID     UID
+}
+
+// ImportSourceList returns the recorded sources of imported messages that are
+// still present in the account, optionally only for messages in mailbox, ordered
+// by mailbox and UID.
+func (a *Account) ImportSourceList(ctx context.Context, mailbox string) ([]ImportSourceMessage, error) {
+	var l []ImportSourceMessage
+	err := a.DB.Read(ctx, func(tx *bstore.Tx) error {
+		var mailboxID int64
+		if mailbox != "" {
+			name, _, err := CheckMailboxName(mailbox, true)
+			if err != nil {
+				return fmt.Errorf("checking mailbox name: %v", err)
+			}
+			mb, err := a.MailboxFind(tx, name)
+			if err != nil {
+				return fmt.Errorf("looking up mailbox: %v", err)
+			} else if mb == nil {
+				return fmt.Errorf("mailbox %q not found", mailbox)
+			}
+			mailboxID = mb.ID
+		}
+
+		mailboxNames := map[int64]string{}
+		err := bstore.QueryTx[ImportSource](tx).ForEach(func(src ImportSource) error {
+			m := Message{ID: src.MessageID}
+			if err := tx.Get(&m); err == bstore.ErrAbsent || err == nil && (m.Expunged || mailboxID != 0 && m.MailboxID != mailboxID) {
+				return nil
+			} else if err != nil {
+				return fmt.Errorf("get message: %v", err)
+			}
+			name, ok := mailboxNames[m.MailboxID]
+			if !ok {
+				mb := Mailbox{ID: m.MailboxID}
+				if err := tx.Get(&mb); err != nil {
+					return fmt.Errorf("get mailbox: %v", err)
+				}
+				name = mb.Name
+				mailboxNames[mb.ID] = name
+			}
+			l = append(l, ImportSourceMessage{src, name, m.UID})
+			return nil
+		})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	slices.SortFunc(l, func(a, b ImportSourceMessage) int {
+		if a.Mailbox != b.Mailbox {
+			return strings.Compare(a.Mailbox, b.Mailbox)
+		}
+		return cmp.Compare(a.UID, b.UID)
+	})
+	return l, nil
+}
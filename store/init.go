@@ -19,7 +19,11 @@ import (
 
 // AuthDB and AuthDBTypes are exported for ../backup.go.
 var AuthDB *bstore.DB
-var AuthDBTypes = []any{TLSPublicKey{}, LoginAttempt{}, LoginAttemptState{}}
+var AuthDBTypes = []any{TLSPublicKey{}, LoginAttempt{}, LoginAttemptState{}, IMAPClient{}, OpenPGPKey{}, AuthLockout{}}
+
+func init() {
+	metrics.DatabaseSize("auth", func() string { return mox.DataDirPath("auth.db") })
+}
 
 // Init opens auth.db.
 func Init(ctx context.Context) error {
@@ -45,7 +49,7 @@ func Init(ctx context.Context) error {
 				return
 			}
 
-			mlog.New("store", nil).Error("unhandled panic in LoginAttemptCleanup", slog.Any("err", x))
+			mlog.New("store", nil).Error("unhandled panic in periodic cleanup", slog.Any("err", x))
 			debug.PrintStack()
 			metrics.PanicInc(metrics.Store)
 
@@ -55,6 +59,15 @@ func Init(ctx context.Context) error {
 		for {
 			err := LoginAttemptCleanup(ctx)
 			pkglog.Check(err, "cleaning up old historic login attempts")
+			err = AuthLockoutCleanup(ctx)
+			pkglog.Check(err, "cleaning up expired auth lockouts")
+			err = IMAPClientCleanup(ctx)
+			pkglog.Check(err, "cleaning up old imap clients")
+			n, err := MessageStoreCleanup(ctx, pkglog)
+			pkglog.Check(err, "cleaning up unreferenced message files in msgstore")
+			if n > 0 {
+				pkglog.Info("removed unreferenced message files from msgstore", slog.Int("count", n))
+			}
 
 			select {
 			case <-t.C:
@@ -0,0 +1,88 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/mjl-/bstore"
+
+	"github.com/mjl-/mox/junk"
+)
+
+// Junk decisions are kept for 30 days, for analyzing false positives and
+// negatives of recent incoming messages.
+const junkDecisionRetention = 30 * 24 * time.Hour
+
+// JunkDecision records the inputs and outcome of the analysis of an incoming
+// message for an account, i.e. whether it was accepted or rejected as junk. For
+// analyzing and tuning the junk filter and reputation settings.
+//
+// Address/DKIM/SPF/IP-based reputation is evaluated first. The content-based
+// junk filter is only evaluated when reputation was inconclusive and the account
+// has a junk filter. DNS block lists are only checked when the content looks
+// good.
+type JunkDecision struct {
+	ID   int64
+	Time time.Time `bstore:"nonzero,default now,index"`
+
+	MessageID string // Message-ID header, with <>.
+	MailFrom  string // SMTP MAIL FROM address.
+	MsgFrom   string // Message From header address.
+	Recipient string // SMTP RCPT TO address.
+	RemoteIP  string
+	Subject   string
+
+	Accept     bool     // Whether the message was accepted.
+	Mailbox    string   // Destination mailbox for accepted messages.
+	Reason     string   // As in the X-Mox-Reason header, e.g. "junk-content", "dns-blocklisted", "no-bad-signals", or a reputation method like "msgfromfull".
+	ReasonText []string // Human-readable details.
+
+	ReputationMethod     string // E.g. "msgfromfull", "dkimspf", "ip1", "none".
+	ReputationJunk       *bool  // Nil if no reputation could be determined.
+	ReputationConclusive bool
+
+	ContentAnalyzed bool             // Whether the junk filter was evaluated.
+	Probability     float64          // Between 0 (ham) and 1 (spam).
+	Significant     bool             // Whether enough known words were found to base a decision on.
+	Threshold       float64          // Threshold used, can be stricter than configured.
+	HamWords        []junk.WordScore // Words contributing most to ham.
+	SpamWords       []junk.WordScore // Words contributing most to spam.
+
+	DNSBLZone string // DNS block list zone the remote IP was listed in, if any.
+}
+
+// JunkDecisionAdd stores a junk decision for the account, and removes decisions
+// past their retention period.
+func (a *Account) JunkDecisionAdd(ctx context.Context, jd JunkDecision) error {
+	return a.DB.Write(ctx, func(tx *bstore.Tx) error {
+		jd.ID = 0
+		if err := tx.Insert(&jd); err != nil {
+			return fmt.Errorf("inserting junk decision: %v", err)
+		}
+		q := bstore.QueryTx[JunkDecision](tx)
+		q.FilterLess("Time", time.Now().Add(-junkDecisionRetention))
+		if _, err := q.Delete(); err != nil {
+			return fmt.Errorf("removing old junk decisions: %v", err)
+		}
+		return nil
+	})
+}
+
+// JunkDecisions returns the junk decisions in the period, most recent first.
+// Zero start or end times are ignored. If limit is greater than 0, at most limit
+// decisions are returned.
+func (a *Account) JunkDecisions(ctx context.Context, start, end time.Time, limit int) ([]JunkDecision, error) {
+	q := bstore.QueryDB[JunkDecision](ctx, a.DB)
+	if !start.IsZero() {
+		q.FilterGreaterEqual("Time", start)
+	}
+	if !end.IsZero() {
+		q.FilterLess("Time", end)
+	}
+	q.SortDesc("Time")
+	if limit > 0 {
+		q.Limit(limit)
+	}
+	return q.List()
+}
@@ -0,0 +1,49 @@
+package store
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mjl-/mox/mox-"
+)
+
+func TestJunkDecisions(t *testing.T) {
+	log := pkglog
+	os.RemoveAll("../testdata/store/data")
+	mox.ConfigStaticPath = filepath.FromSlash("../testdata/store/mox.conf")
+	mox.MustLoadConfig(true, false)
+	acc, err := OpenAccount(log, "mjl", false)
+	tcheck(t, err, "open account")
+	defer func() {
+		err = acc.Close()
+		tcheck(t, err, "closing account")
+		acc.CheckClosed()
+	}()
+	defer Switchboard()()
+
+	now := time.Now()
+	err = acc.JunkDecisionAdd(ctxbg, JunkDecision{Time: now.Add(-40 * 24 * time.Hour), Reason: "old"})
+	tcheck(t, err, "add junk decision")
+	err = acc.JunkDecisionAdd(ctxbg, JunkDecision{Time: now.Add(-time.Hour), Reason: "junk-content"})
+	tcheck(t, err, "add junk decision")
+	err = acc.JunkDecisionAdd(ctxbg, JunkDecision{Time: now, Accept: true, Mailbox: "Inbox", Reason: "no-bad-signals"})
+	tcheck(t, err, "add junk decision")
+
+	// Old decision was removed, most recent first.
+	l, err := acc.JunkDecisions(ctxbg, time.Time{}, time.Time{}, 0)
+	tcheck(t, err, "list junk decisions")
+	tcompare(t, len(l), 2)
+	tcompare(t, l[0].Reason, "no-bad-signals")
+	tcompare(t, l[1].Reason, "junk-content")
+
+	l, err = acc.JunkDecisions(ctxbg, time.Time{}, time.Time{}, 1)
+	tcheck(t, err, "list junk decisions")
+	tcompare(t, len(l), 1)
+
+	l, err = acc.JunkDecisions(ctxbg, now.Add(-2*time.Hour), now.Add(-time.Minute), 0)
+	tcheck(t, err, "list junk decisions")
+	tcompare(t, len(l), 1)
+	tcompare(t, l[0].Reason, "junk-content")
+}
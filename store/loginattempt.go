@@ -96,8 +96,12 @@ const (
 	AuthBadChannelBinding AuthResult = "badchanbind"
 	AuthBadProtocol       AuthResult = "badprotocol"
 	AuthLoginDisabled     AuthResult = "logindisabled"
+	AuthNetworkDenied     AuthResult = "networkdenied"
+	AuthClientDenied      AuthResult = "clientdenied"
 	AuthError             AuthResult = "error"
 	AuthAborted           AuthResult = "aborted"
+	AuthLockedOut         AuthResult = "lockedout"
+	AuthTooManyConns      AuthResult = "toomanyconns"
 )
 
 var writeLoginAttempt chan LoginAttempt
@@ -156,6 +160,9 @@ func startLoginAttemptWriter(ctx context.Context) {
 func LoginAttemptAdd(ctx context.Context, log mlog.Log, a LoginAttempt) {
 	metrics.AuthenticationInc(a.Protocol, a.AuthMech, string(a.Result))
 
+	// Updated synchronously, so a next attempt sees the new failure count.
+	authLockoutRecord(ctx, log, a)
+
 	a.log = log
 	select {
 	case <-mox.Context.Done():
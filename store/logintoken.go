@@ -0,0 +1,104 @@
+package store
+
+import (
+	"context"
+	cryptorand "crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mjl-/bstore"
+)
+
+// LoginTokenPrefix is the prefix of login tokens, distinguishing them from
+// passwords during authentication.
+const LoginTokenPrefix = "moxtoken-"
+
+// LoginTokenMaxLifetime is the maximum lifetime of a login token.
+const LoginTokenMaxLifetime = 7 * 24 * time.Hour
+
+// Delay between updates of LastUsed of a login token, to prevent a database write
+// for each login, which webmail software may do for each request.
+const loginTokenUsedDelay = 5 * time.Minute
+
+func loginTokenHash(token string) string {
+	h := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(h[:])
+}
+
+// LoginTokenAdd adds a new login token that expires at the given time, and returns
+// the token. Only a hash of the token is stored, so it cannot be retrieved later.
+// Expired tokens are removed.
+func (a *Account) LoginTokenAdd(ctx context.Context, description string, expires time.Time) (token string, rerr error) {
+	now := time.Now()
+	if !expires.After(now) {
+		return "", fmt.Errorf("expiration time must be in the future")
+	} else if expires.Sub(now) > LoginTokenMaxLifetime {
+		return "", fmt.Errorf("expiration time must be at most %s in the future", LoginTokenMaxLifetime)
+	}
+
+	buf := make([]byte, 24)
+	cryptorand.Read(buf)
+	token = LoginTokenPrefix + base64.RawURLEncoding.EncodeToString(buf)
+
+	err := a.DB.Write(ctx, func(tx *bstore.Tx) error {
+		q := bstore.QueryTx[LoginToken](tx)
+		q.FilterLess("Expires", now)
+		if _, err := q.Delete(); err != nil {
+			return fmt.Errorf("removing expired login tokens: %v", err)
+		}
+
+		lt := LoginToken{TokenHash: loginTokenHash(token), Expires: expires, Description: description}
+		return tx.Insert(&lt)
+	})
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// LoginTokenList returns the login tokens of the account, including expired tokens
+// that haven't been removed yet.
+func (a *Account) LoginTokenList(ctx context.Context) ([]LoginToken, error) {
+	q := bstore.QueryDB[LoginToken](ctx, a.DB)
+	q.SortDesc("Created")
+	return q.List()
+}
+
+// LoginTokenRemove removes a login token by ID. Existing connections
+// authenticated with the token are not closed.
+func (a *Account) LoginTokenRemove(ctx context.Context, id int64) error {
+	return a.DB.Write(ctx, func(tx *bstore.Tx) error {
+		return tx.Delete(&LoginToken{ID: id})
+	})
+}
+
+// loginTokenVerify checks if token is a valid, non-expired login token for the
+// account, returning ErrUnknownCredentials if not.
+func (a *Account) loginTokenVerify(ctx context.Context, token string) error {
+	if !strings.HasPrefix(token, LoginTokenPrefix) {
+		return ErrUnknownCredentials
+	}
+	q := bstore.QueryDB[LoginToken](ctx, a.DB)
+	q.FilterNonzero(LoginToken{TokenHash: loginTokenHash(token)})
+	lt, err := q.Get()
+	if err == bstore.ErrAbsent {
+		return ErrUnknownCredentials
+	} else if err != nil {
+		return fmt.Errorf("looking up login token: %v", err)
+	}
+	now := time.Now()
+	if !now.Before(lt.Expires) {
+		return ErrUnknownCredentials
+	}
+	if now.Sub(lt.LastUsed) >= loginTokenUsedDelay {
+		lt.LastUsed = now
+		if err := a.DB.Update(ctx, &lt); err != nil && err != bstore.ErrAbsent {
+			return fmt.Errorf("updating login token: %v", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package store
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/mjl-/bstore"
+
+	"github.com/mjl-/mox/mlog"
+	"github.com/mjl-/mox/mox-"
+)
+
+var (
+	metricAccountMessageSizeDesc = prometheus.NewDesc(
+		"mox_account_message_size_bytes",
+		"Sum of sizes of all messages in account, as used for quota accounting.",
+		[]string{"account"},
+		nil,
+	)
+	metricAccountDatabaseSizeDesc = prometheus.NewDesc(
+		"mox_account_database_size_bytes",
+		"Size of account database file on disk.",
+		[]string{"account"},
+		nil,
+	)
+	metricAccountJunkFilterSizeDesc = prometheus.NewDesc(
+		"mox_account_junkfilter_size_bytes",
+		"Size of junk filter corpus files on disk, by file (db or bloom).",
+		[]string{"account", "file"},
+		nil,
+	)
+)
+
+// accountCollector gathers per-account storage sizes on each scrape.
+type accountCollector struct{}
+
+func init() {
+	prometheus.MustRegister(accountCollector{})
+}
+
+func (accountCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- metricAccountMessageSizeDesc
+	ch <- metricAccountDatabaseSizeDesc
+	ch <- metricAccountJunkFilterSizeDesc
+}
+
+func (accountCollector) Collect(ch chan<- prometheus.Metric) {
+	log := mlog.New("store", nil)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	fileSize := func(p string) (float64, bool) {
+		fi, err := os.Stat(p)
+		if err != nil {
+			return 0, false
+		}
+		return float64(fi.Size()), true
+	}
+
+	for _, name := range mox.Conf.Accounts() {
+		dir := filepath.Join(mox.DataDirPath("accounts"), name)
+		size, ok := fileSize(filepath.Join(dir, "index.db"))
+		if !ok {
+			// Account has not been opened yet, we don't want to create it.
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(metricAccountDatabaseSizeDesc, prometheus.GaugeValue, size, name)
+		for _, file := range []string{"db", "bloom"} {
+			if size, ok := fileSize(filepath.Join(dir, "junkfilter."+file)); ok {
+				ch <- prometheus.MustNewConstMetric(metricAccountJunkFilterSizeDesc, prometheus.GaugeValue, size, name, file)
+			}
+		}
+
+		acc, err := OpenAccount(log, name, false)
+		if err != nil {
+			log.Errorx("open account for metrics", err, slog.String("account", name))
+			continue
+		}
+		du := DiskUsage{ID: 1}
+		err = acc.DB.Read(ctx, func(tx *bstore.Tx) error {
+			return tx.Get(&du)
+		})
+		if err != nil {
+			log.Errorx("reading disk usage for metrics", err, slog.String("account", name))
+		} else {
+			ch <- prometheus.MustNewConstMetric(metricAccountMessageSizeDesc, prometheus.GaugeValue, float64(du.MessageSize), name)
+		}
+		err = acc.Close()
+		log.Check(err, "closing account after gathering metrics")
+	}
+}
@@ -1,6 +1,8 @@
 package store
 
 import (
+	"bytes"
+	"crypto/ecdh"
 	"errors"
 	"fmt"
 	"io"
@@ -10,13 +12,26 @@ import (
 // MsgReader provides access to a message. Reads return the "msg_prefix" in the
 // database (typically received headers), followed by the on-disk msg file
 // contents. MsgReader is an io.Reader, io.ReaderAt and io.Closer.
+//
+// For messages stored in a pack file or in a compressed message file, the
+// compressed message data is read and decompressed into memory on first use.
+// Encrypted message files are decrypted while reading.
 type MsgReader struct {
-	prefix []byte   // First part of the message. Typically contains received headers.
-	path   string   // To on-disk message file.
-	size   int64    // Total size of message, including prefix and contents from path.
-	offset int64    // Current reading offset.
-	f      *os.File // Opened path, automatically opened after prefix has been read.
-	err    error    // If set, error to return for reads. Sets io.EOF for readers, but ReadAt ignores them.
+	prefix         []byte           // First part of the message. Typically contains received headers.
+	path           string           // To on-disk message file, or pack file.
+	size           int64            // Total size of message, including prefix and contents from path.
+	packOffset     int64            // If packSize > 0, offset of compressed data in pack file at path.
+	packSize       int64            // If > 0, size of compressed data in pack file.
+	compressedSize int64            // If > 0, file at path is gzip-compressed and has this size.
+	messageKey     *ecdh.PrivateKey // If set, file at path is encrypted, and decrypted with this key.
+	offset         int64            // Current reading offset.
+	f              readerAtCloser   // Opened path, automatically opened after prefix has been read.
+	err            error            // If set, error to return for reads. Sets io.EOF for readers, but ReadAt ignores them.
+}
+
+type readerAtCloser interface {
+	io.ReaderAt
+	io.Closer
 }
 
 var errMsgClosed = errors.New("msg is closed")
@@ -73,7 +88,17 @@ func (m *MsgReader) read(buf []byte, off int64, pread bool) (int, error) {
 
 		// Now we need to read from file. Ensure it is open.
 		if m.f == nil {
-			f, err := os.Open(m.path)
+			var f readerAtCloser
+			var err error
+			if m.packSize > 0 {
+				f, err = m.openPacked()
+			} else if m.compressedSize > 0 {
+				f, err = m.openCompressed()
+			} else if m.messageKey != nil {
+				f, err = openEncrypted(m.path, m.messageKey, m.size-int64(len(m.prefix)))
+			} else {
+				f, err = os.Open(m.path)
+			}
 			if err != nil {
 				m.err = err
 				break
@@ -108,6 +133,43 @@ func (m *MsgReader) read(buf []byte, off int64, pread bool) (int, error) {
 	return o, m.err
 }
 
+// openPacked reads and decompresses the message data from the pack file.
+func (m *MsgReader) openPacked() (readerAtCloser, error) {
+	f, err := os.Open(m.path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	buf, err := packReadEntry(f, m.packOffset, m.packSize, m.size-int64(len(m.prefix)))
+	if err != nil {
+		return nil, fmt.Errorf("reading message from pack file %s: %w", m.path, err)
+	}
+	return bytesReaderCloser{bytes.NewReader(buf)}, nil
+}
+
+// openCompressed reads and decompresses the gzip-compressed message file.
+func (m *MsgReader) openCompressed() (readerAtCloser, error) {
+	f, err := os.Open(m.path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	buf, err := readCompressed(f, m.compressedSize, m.size-int64(len(m.prefix)))
+	if err != nil {
+		return nil, fmt.Errorf("reading compressed message file %s: %w", m.path, err)
+	}
+	return bytesReaderCloser{bytes.NewReader(buf)}, nil
+}
+
+type bytesReaderCloser struct {
+	*bytes.Reader
+}
+
+// Close does nothing.
+func (bytesReaderCloser) Close() error {
+	return nil
+}
+
 // Close ensures the msg file is closed. Further reads will fail.
 func (m *MsgReader) Close() error {
 	if m.f != nil {
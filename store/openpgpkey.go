@@ -0,0 +1,135 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/mjl-/bstore"
+
+	"github.com/mjl-/mox/mox-"
+	"github.com/mjl-/mox/smtp"
+	"github.com/mjl-/mox/wkd"
+)
+
+// OpenPGPKey is an OpenPGP public key published by an account for one of its
+// addresses, served through the Web Key Directory (WKD).
+type OpenPGPKey struct {
+	Address     string    // Canonical email address, the key has a user ID with this address.
+	Domain      string    `bstore:"nonzero,index Domain+WKDHash"` // ASCII domain of Address.
+	WKDHash     string    `bstore:"nonzero"`                      // Of localpart of Address, see wkd.Hash.
+	Account     string    `bstore:"nonzero"`
+	Fingerprint string    `bstore:"nonzero"` // Upper-case hex.
+	Created     time.Time `bstore:"nonzero,default now"`
+	Updated     time.Time `bstore:"nonzero,default now"`
+	KeyData     []byte    `bstore:"nonzero"` // Binary OpenPGP transferable public key.
+}
+
+// ParseOpenPGPKey parses an OpenPGP public key, binary or ASCII-armored, for
+// publishing for address. The key must have a user ID with the address. Caller
+// must set Account.
+func ParseOpenPGPKey(address string, key []byte) (OpenPGPKey, error) {
+	a, err := smtp.ParseAddress(address)
+	if err != nil {
+		return OpenPGPKey{}, fmt.Errorf("parsing address %q: %v", address, err)
+	}
+	if a.String() != address {
+		return OpenPGPKey{}, fmt.Errorf("address %q must be specified in canonical form %q", address, a.String())
+	}
+	k, err := wkd.ParseKey(key)
+	if err != nil {
+		return OpenPGPKey{}, fmt.Errorf("parsing openpgp key: %w", err)
+	}
+	if !k.HasAddress(address) {
+		return OpenPGPKey{}, fmt.Errorf("openpgp key does not have a user id with address %q", address)
+	}
+	return OpenPGPKey{
+		Address:     address,
+		Domain:      a.Domain.ASCII,
+		WKDHash:     wkd.Hash(string(a.Localpart)),
+		Fingerprint: k.Fingerprint,
+		KeyData:     k.Data,
+	}, nil
+}
+
+// OpenPGPKeyAllowed returns an error if account may not publish an openpgp key
+// for address: The domain of the address must have WKD configured, with the
+// account allowed to publish keys, and the address must be a (non-catchall)
+// destination of the account. Checked when saving a key, and when serving it.
+func OpenPGPKeyAllowed(account string, address smtp.Address) error {
+	dc, ok := mox.Conf.Domain(address.Domain)
+	if !ok {
+		return fmt.Errorf("unknown domain")
+	} else if dc.WKD == nil {
+		return fmt.Errorf("publishing openpgp keys not enabled for domain")
+	} else if len(dc.WKD.Accounts) > 0 && !slices.Contains(dc.WKD.Accounts, account) {
+		return fmt.Errorf("account not allowed to publish openpgp keys for domain")
+	}
+	accDest, _, ok := mox.Conf.AccountDestination(address.String())
+	if !ok || accDest.Account != account || accDest.Catchall {
+		return fmt.Errorf("address is not an address of account")
+	}
+	return nil
+}
+
+// OpenPGPKeyList returns openpgp keys. If accountOpt is empty, keys for all
+// accounts are returned.
+func OpenPGPKeyList(ctx context.Context, accountOpt string) ([]OpenPGPKey, error) {
+	q := bstore.QueryDB[OpenPGPKey](ctx, AuthDB)
+	if accountOpt != "" {
+		q.FilterNonzero(OpenPGPKey{Account: accountOpt})
+	}
+	q.SortAsc("Address")
+	return q.List()
+}
+
+// OpenPGPKeyLookup returns the openpgp keys for the WKD hash of a localpart in an
+// ASCII domain. Multiple localparts can have the same hash, e.g. when localparts
+// are case-sensitive.
+func OpenPGPKeyLookup(ctx context.Context, domain, hash string) ([]OpenPGPKey, error) {
+	q := bstore.QueryDB[OpenPGPKey](ctx, AuthDB)
+	q.FilterNonzero(OpenPGPKey{Domain: domain, WKDHash: hash})
+	return q.List()
+}
+
+// OpenPGPKeySave adds or replaces the openpgp key for the address of key. A key
+// for the address published by another account, that had the address before, is
+// replaced too.
+//
+// Caller is responsible for checking the address belongs to the account, and the
+// account may publish keys.
+func OpenPGPKeySave(ctx context.Context, key *OpenPGPKey) error {
+	return AuthDB.Write(ctx, func(tx *bstore.Tx) error {
+		ok := OpenPGPKey{Address: key.Address}
+		if err := tx.Get(&ok); err == bstore.ErrAbsent {
+			return tx.Insert(key)
+		} else if err != nil {
+			return err
+		}
+		key.Created = ok.Created
+		key.Updated = time.Now()
+		return tx.Update(key)
+	})
+}
+
+// OpenPGPKeyRemove removes the openpgp key for an address of account. If absent,
+// bstore.ErrAbsent is returned.
+func OpenPGPKeyRemove(ctx context.Context, account, address string) error {
+	q := bstore.QueryDB[OpenPGPKey](ctx, AuthDB)
+	q.FilterID(address)
+	q.FilterNonzero(OpenPGPKey{Account: account})
+	n, err := q.Delete()
+	if err == nil && n == 0 {
+		err = bstore.ErrAbsent
+	}
+	return err
+}
+
+// OpenPGPKeyRemoveForAccount removes all openpgp keys for an account.
+func OpenPGPKeyRemoveForAccount(ctx context.Context, account string) error {
+	q := bstore.QueryDB[OpenPGPKey](ctx, AuthDB)
+	q.FilterNonzero(OpenPGPKey{Account: account})
+	_, err := q.Delete()
+	return err
+}
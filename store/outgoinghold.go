@@ -0,0 +1,104 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/mjl-/bstore"
+
+	"github.com/mjl-/mox/mox-"
+	"github.com/mjl-/mox/smtp"
+)
+
+// OutgoingHoldCheck evaluates the heuristics from the OutgoingHold configuration
+// for a message about to be submitted to recipients by a connection from remoteIP
+// (nil if not known). If the account appears to be compromised, a non-empty
+// reason is returned, and the outgoing messages of the account should be held for
+// review by the admin.
+func (a *Account) OutgoingHoldCheck(ctx context.Context, tx *bstore.Tx, recipients []smtp.Path, remoteIP net.IP) (reason string, rerr error) {
+	oh := mox.Conf.Static.OutgoingHold
+	if oh == nil {
+		return "", nil
+	}
+
+	now := time.Now()
+	if oh.MessagesPerHour > 0 || oh.FirstTimeRecipientsPerHour > 0 {
+		rcpts := map[string]time.Time{}
+		n := 0
+		err := bstore.QueryTx[Outgoing](tx).FilterGreater("Submitted", now.Add(-time.Hour)).ForEach(func(o Outgoing) error {
+			n++
+			if rcpts[o.Recipient].IsZero() || o.Submitted.Before(rcpts[o.Recipient]) {
+				rcpts[o.Recipient] = o.Submitted
+			}
+			return nil
+		})
+		if err != nil {
+			return "", fmt.Errorf("querying message recipients in past hour: %w", err)
+		}
+		if oh.MessagesPerHour > 0 && n+len(recipients) > oh.MessagesPerHour {
+			return fmt.Sprintf("%d messages submitted in past hour, more than %d", n+len(recipients), oh.MessagesPerHour), nil
+		}
+
+		if oh.FirstTimeRecipientsPerHour > 0 && n+len(recipients) > oh.FirstTimeRecipientsPerHour {
+			for _, r := range recipients {
+				if _, ok := rcpts[r.XString(true)]; !ok {
+					rcpts[r.XString(true)] = now
+				}
+			}
+			firsttime := 0
+			for r, t := range rcpts {
+				exists, err := bstore.QueryTx[Outgoing](tx).FilterNonzero(Outgoing{Recipient: r}).FilterLess("Submitted", t).Exists()
+				if err != nil {
+					return "", fmt.Errorf("checking whether recipient is first-time: %v", err)
+				} else if !exists {
+					firsttime++
+				}
+			}
+			if firsttime > oh.FirstTimeRecipientsPerHour {
+				return fmt.Sprintf("%d first-time recipients in past hour, more than %d", firsttime, oh.FirstTimeRecipientsPerHour), nil
+			}
+		}
+	}
+
+	if oh.NewNetworkLogin && remoteIP != nil && !remoteIP.IsLoopback() {
+		network := loginNetwork(remoteIP)
+		var known, other bool
+		q := bstore.QueryDB[LoginAttempt](ctx, AuthDB)
+		q.FilterNonzero(LoginAttempt{AccountName: a.Name, Result: AuthSuccess})
+		q.FilterGreater("Last", now.Add(-30*24*time.Hour))
+		err := q.ForEach(func(la LoginAttempt) error {
+			ip := net.ParseIP(la.RemoteIP)
+			if ip == nil || ip.IsLoopback() {
+				return nil
+			}
+			// Logins from a network that started only recently don't make it known, they may
+			// be from the attacker.
+			if network.Contains(ip) && la.First.Before(now.Add(-24*time.Hour)) {
+				known = true
+			} else if !network.Contains(ip) {
+				other = true
+			}
+			return nil
+		})
+		if err != nil {
+			return "", fmt.Errorf("listing login attempts: %v", err)
+		}
+		if other && !known {
+			return fmt.Sprintf("login from new network %s", network), nil
+		}
+	}
+	return "", nil
+}
+
+// loginNetwork returns the network of ip for comparing logins: /16 for IPv4, /48
+// for IPv6.
+func loginNetwork(ip net.IP) *net.IPNet {
+	if ip4 := ip.To4(); ip4 != nil {
+		mask := net.CIDRMask(16, 32)
+		return &net.IPNet{IP: ip4.Mask(mask), Mask: mask}
+	}
+	mask := net.CIDRMask(48, 128)
+	return &net.IPNet{IP: ip.Mask(mask), Mask: mask}
+}
@@ -0,0 +1,524 @@
+package store
+
+// Pack files hold the compressed data of old messages, for accounts with an
+// ArchiveTier configured. Storing many messages in a single file saves inodes,
+// and compression saves disk space. A pack file starts with a magic line,
+// followed by a DEFLATE stream for each message. The position and size of a
+// message in a pack file are stored in its Message. Pack files are never modified
+// after they are written. Data of removed messages stays in a pack file until the
+// pack file is rewritten by a repack.
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/mjl-/bstore"
+
+	"github.com/mjl-/mox/metrics"
+	"github.com/mjl-/mox/mlog"
+	"github.com/mjl-/mox/mox-"
+	"github.com/mjl-/mox/moxio"
+)
+
+const packMagic = "moxpack1\n"
+
+const (
+	// Default for ArchiveTier.MaxMessageSize.
+	packMaxMessageSizeDefault = 1024 * 1024
+
+	// We stop adding messages to a pack file once it reaches this size.
+	packMaxFileSize = 64 * 1024 * 1024
+
+	// Number of candidate messages to fetch from the database at a time.
+	packBatchSize = 1000
+)
+
+// Pack is a file with compressed message data, see Message.PackID.
+type Pack struct {
+	ID       int64
+	Created  time.Time `bstore:"default now"`
+	Size     int64     // Of pack file.
+	Messages int       // Number of messages at the time the pack file was written.
+}
+
+// packPath returns the path to a pack file.
+func packPath(accountDir string, packID int64) string {
+	return filepath.Join(accountDir, "pack", strconv.FormatInt(packID, 10))
+}
+
+// packReadEntry reads the compressed message data at offset with size from pack
+// file f, and returns the decompressed data, which must be dataSize bytes.
+func packReadEntry(f io.ReaderAt, offset, size, dataSize int64) ([]byte, error) {
+	fr := flate.NewReader(io.NewSectionReader(f, offset, size))
+	defer fr.Close()
+	buf := make([]byte, dataSize)
+	if _, err := io.ReadFull(fr, buf); err != nil {
+		return nil, fmt.Errorf("decompressing message data: %w", err)
+	}
+	if n, err := fr.Read(make([]byte, 1)); n > 0 || err != io.EOF {
+		return nil, fmt.Errorf("decompressed message data larger than expected size %d", dataSize)
+	}
+	return buf, nil
+}
+
+// countWriter counts the bytes written, for the offsets of messages in a pack
+// file.
+type countWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (w *countWriter) Write(buf []byte) (int, error) {
+	n, err := w.w.Write(buf)
+	w.n += int64(n)
+	return n, err
+}
+
+// ArchivePackStats is the result of Account.ArchivePack.
+type ArchivePackStats struct {
+	Packed       int   // Messages moved from their own file into a pack file.
+	PackedSize   int64 // Total size of the files of the packed messages.
+	PackFiles    int   // Pack files written, including those written for a repack.
+	Repacked     int   // Pack files rewritten because most of their data was for removed messages.
+	PacksRemoved int   // Pack files removed, after a repack or because no messages reference them anymore.
+}
+
+// ArchivePack moves the data of messages received longer ago than the age
+// configured in the ArchiveTier of the account from their own on-disk files into
+// compressed pack files. Pack files with more than half of their data belonging to
+// removed messages are rewritten, or removed if no messages reference them
+// anymore. Pack files are repacked even if the account does not have an
+// ArchiveTier configured (anymore). Messages of accounts with message encryption
+// are not packed.
+//
+// Must be called without holding the account lock.
+func (a *Account) ArchivePack(ctx context.Context, log mlog.Log) (stats ArchivePackStats, rerr error) {
+	a.packMutex.Lock()
+	defer a.packMutex.Unlock()
+
+	conf, _ := a.Conf()
+	// Packing would store messages of accounts with message encryption unencrypted.
+	if tier := conf.ArchiveTier; tier != nil && conf.MessageEncryption == nil {
+		maxSize := tier.MaxMessageSize
+		if maxSize == 0 {
+			maxSize = packMaxMessageSizeDefault
+		}
+		cutoff := time.Now().Add(-tier.Age)
+
+		var lastID int64
+		for {
+			var msgs []Message
+			err := a.DB.Read(ctx, func(tx *bstore.Tx) error {
+				q := bstore.QueryTx[Message](tx)
+				q.FilterEqual("Expunged", false)
+				q.FilterEqual("PackID", int64(0))
+				q.FilterEqual("Encrypted", false)
+				q.FilterGreater("ID", lastID)
+				q.FilterLess("Received", cutoff)
+				q.FilterFn(func(m Message) bool {
+					return m.Size-int64(len(m.MsgPrefix)) <= maxSize
+				})
+				q.SortAsc("ID")
+				q.Limit(packBatchSize)
+				var err error
+				msgs, err = q.List()
+				return err
+			})
+			if err != nil {
+				return stats, fmt.Errorf("listing messages to pack: %v", err)
+			}
+			if len(msgs) == 0 {
+				break
+			}
+			for len(msgs) > 0 {
+				n, err := a.packMessages(ctx, log, msgs, &stats)
+				if err != nil {
+					return stats, err
+				}
+				lastID = msgs[n-1].ID
+				msgs = msgs[n:]
+			}
+		}
+	}
+
+	if err := a.repack(ctx, log, &stats); err != nil {
+		return stats, err
+	}
+	return stats, nil
+}
+
+// packMessages writes a new pack file with the data of msgs, stopping when the
+// pack file reaches its maximum size. The number of messages processed from msgs
+// is returned.
+func (a *Account) packMessages(ctx context.Context, log mlog.Log, msgs []Message, stats *ArchivePackStats) (processed int, rerr error) {
+	f, err := CreateMessageTemp(log, "archivepack")
+	if err != nil {
+		return 0, fmt.Errorf("creating temporary pack file: %v", err)
+	}
+	defer CloseRemoveTempFile(log, f, "archive pack")
+
+	bw := bufio.NewWriter(f)
+	cw := &countWriter{w: bw}
+	if _, err := cw.Write([]byte(packMagic)); err != nil {
+		return 0, fmt.Errorf("writing pack file: %v", err)
+	}
+	fw, err := flate.NewWriter(cw, flate.DefaultCompression)
+	if err != nil {
+		return 0, fmt.Errorf("compressor: %v", err)
+	}
+
+	type entry struct {
+		msgID        int64
+		offset, size int64
+		fileSize     int64
+	}
+	var entries []entry
+
+	packMessage := func(m Message) error {
+		p := a.MessagePath(m.ID)
+		mf, err := os.Open(p)
+		if err != nil {
+			// Message may have been removed in the mean time.
+			log.Debugx("opening message file for packing, skipping", err, slog.Int64("msgid", m.ID))
+			return nil
+		}
+		defer func() {
+			err := mf.Close()
+			log.Check(err, "closing message file after packing")
+		}()
+		st, err := mf.Stat()
+		if err != nil {
+			return fmt.Errorf("stat message file: %v", err)
+		}
+		var src io.Reader = mf
+		dataSize := st.Size()
+		if m.CompressedSize > 0 {
+			if st.Size() != m.CompressedSize {
+				log.Error("compressed message size does not match message file, not packing", slog.Int64("msgid", m.ID), slog.Int64("compressedsize", m.CompressedSize), slog.Int64("filesize", st.Size()))
+				return nil
+			}
+			gzr, err := gzip.NewReader(mf)
+			if err != nil {
+				return fmt.Errorf("gzip reader for compressed message: %v", err)
+			}
+			src = gzr
+			dataSize = m.Size - int64(len(m.MsgPrefix))
+		} else if int64(len(m.MsgPrefix))+st.Size() != m.Size {
+			log.Error("message size does not match message file, not packing, see mox fixmsgsize", slog.Int64("msgid", m.ID), slog.Int64("size", m.Size), slog.Int("prefixsize", len(m.MsgPrefix)), slog.Int64("filesize", st.Size()))
+			return nil
+		}
+
+		offset := cw.n
+		fw.Reset(cw)
+		if n, err := io.Copy(fw, src); err != nil {
+			return fmt.Errorf("compressing message: %v", err)
+		} else if n != dataSize {
+			return fmt.Errorf("compressed %d bytes, expected message size %d", n, dataSize)
+		}
+		if err := fw.Close(); err != nil {
+			return fmt.Errorf("compressing message: %v", err)
+		}
+		entries = append(entries, entry{m.ID, offset, cw.n - offset, st.Size()})
+		return nil
+	}
+
+	for _, m := range msgs {
+		if cw.n >= packMaxFileSize {
+			break
+		}
+		processed++
+		if err := packMessage(m); err != nil {
+			return 0, fmt.Errorf("packing message %d: %v", m.ID, err)
+		}
+	}
+	if len(entries) == 0 {
+		return processed, nil
+	}
+	if err := bw.Flush(); err != nil {
+		return 0, fmt.Errorf("writing pack file: %v", err)
+	}
+	if err := f.Sync(); err != nil {
+		return 0, fmt.Errorf("sync pack file: %v", err)
+	}
+
+	var removeIDs []int64
+	a.WithWLock(func() {
+		rerr = a.DB.Write(ctx, func(tx *bstore.Tx) error {
+			pack := Pack{Size: cw.n, Messages: len(entries)}
+			if err := tx.Insert(&pack); err != nil {
+				return fmt.Errorf("inserting pack: %v", err)
+			}
+			for _, e := range entries {
+				m := Message{ID: e.msgID}
+				if err := tx.Get(&m); err == bstore.ErrAbsent {
+					continue
+				} else if err != nil {
+					return fmt.Errorf("get message: %v", err)
+				}
+				if m.Expunged || m.PackID != 0 {
+					continue
+				}
+				m.PackID = pack.ID
+				m.PackOffset = e.offset
+				m.PackSize = e.size
+				m.CompressedSize = 0
+				if err := tx.Update(&m); err != nil {
+					return fmt.Errorf("updating message: %v", err)
+				}
+				removeIDs = append(removeIDs, m.ID)
+				stats.Packed++
+				stats.PackedSize += e.fileSize
+			}
+			return a.packLink(log, f.Name(), pack.ID)
+		})
+	})
+	if rerr != nil {
+		return 0, rerr
+	}
+	stats.PackFiles++
+
+	for _, id := range removeIDs {
+		p := a.MessagePath(id)
+		err := os.Remove(p)
+		log.Check(err, "removing message file after packing", slog.String("path", p))
+	}
+
+	return processed, nil
+}
+
+// packLink links or copies the temporary file to the path for the pack file.
+func (a *Account) packLink(log mlog.Log, tmpPath string, packID int64) error {
+	p := packPath(a.Dir, packID)
+	dir := filepath.Dir(p)
+	os.MkdirAll(dir, 0770)
+	if err := moxio.LinkOrCopy(log, p, tmpPath, nil, true); err != nil {
+		return fmt.Errorf("linking/copying pack file: %v", err)
+	}
+	if err := moxio.SyncDir(log, dir); err != nil {
+		xerr := os.Remove(p)
+		log.Check(xerr, "removing pack file after syncdir error", slog.String("path", p))
+		return fmt.Errorf("sync directory: %v", err)
+	}
+	return nil
+}
+
+// repack rewrites pack files that have more than half of their data for removed
+// messages, and removes pack files without messages.
+func (a *Account) repack(ctx context.Context, log mlog.Log, stats *ArchivePackStats) error {
+	var packs []Pack
+	// Per pack, offset and size of message data still referenced by messages.
+	live := map[int64]map[int64]int64{}
+	err := a.DB.Read(ctx, func(tx *bstore.Tx) error {
+		var err error
+		packs, err = bstore.QueryTx[Pack](tx).List()
+		if err != nil || len(packs) == 0 {
+			return err
+		}
+		q := bstore.QueryTx[Message](tx)
+		q.FilterEqual("Expunged", false)
+		q.FilterNotEqual("PackID", int64(0))
+		return q.ForEach(func(m Message) error {
+			if live[m.PackID] == nil {
+				live[m.PackID] = map[int64]int64{}
+			}
+			live[m.PackID][m.PackOffset] = m.PackSize
+			return nil
+		})
+	})
+	if err != nil {
+		return fmt.Errorf("listing packed messages: %v", err)
+	}
+
+	for _, pack := range packs {
+		var liveSize int64
+		for _, size := range live[pack.ID] {
+			liveSize += size
+		}
+		if liveSize*2 >= pack.Size-int64(len(packMagic)) {
+			continue
+		}
+		if err := a.repackFile(ctx, log, pack, live[pack.ID], stats); err != nil {
+			return fmt.Errorf("repacking pack file %d: %v", pack.ID, err)
+		}
+	}
+	return nil
+}
+
+// repackFile writes a new pack file with the live message data from pack, and
+// removes the old pack file.
+func (a *Account) repackFile(ctx context.Context, log mlog.Log, pack Pack, live map[int64]int64, stats *ArchivePackStats) (rerr error) {
+	// Old offset to new offset.
+	offsets := map[int64]int64{}
+	var npack Pack
+
+	if len(live) > 0 {
+		srcf, err := os.Open(packPath(a.Dir, pack.ID))
+		if err != nil {
+			return fmt.Errorf("open pack file: %v", err)
+		}
+		defer func() {
+			err := srcf.Close()
+			log.Check(err, "closing pack file after repack")
+		}()
+
+		f, err := CreateMessageTemp(log, "archivepack")
+		if err != nil {
+			return fmt.Errorf("creating temporary pack file: %v", err)
+		}
+		defer CloseRemoveTempFile(log, f, "archive pack")
+
+		bw := bufio.NewWriter(f)
+		cw := &countWriter{w: bw}
+		if _, err := cw.Write([]byte(packMagic)); err != nil {
+			return fmt.Errorf("writing pack file: %v", err)
+		}
+		l := make([]int64, 0, len(live))
+		for offset := range live {
+			l = append(l, offset)
+		}
+		slices.Sort(l)
+		for _, offset := range l {
+			offsets[offset] = cw.n
+			if _, err := io.Copy(cw, io.NewSectionReader(srcf, offset, live[offset])); err != nil {
+				return fmt.Errorf("copying message data: %v", err)
+			}
+		}
+		if err := bw.Flush(); err != nil {
+			return fmt.Errorf("writing pack file: %v", err)
+		}
+		if err := f.Sync(); err != nil {
+			return fmt.Errorf("sync pack file: %v", err)
+		}
+
+		a.WithWLock(func() {
+			rerr = a.DB.Write(ctx, func(tx *bstore.Tx) error {
+				npack = Pack{Size: cw.n, Messages: len(live)}
+				if err := tx.Insert(&npack); err != nil {
+					return fmt.Errorf("inserting pack: %v", err)
+				}
+				q := bstore.QueryTx[Message](tx)
+				q.FilterEqual("Expunged", false)
+				q.FilterNonzero(Message{PackID: pack.ID})
+				err := q.ForEach(func(m Message) error {
+					offset, ok := offsets[m.PackOffset]
+					if !ok {
+						return fmt.Errorf("message %d references data at offset %d not in new pack file", m.ID, m.PackOffset)
+					}
+					m.PackID = npack.ID
+					m.PackOffset = offset
+					return tx.Update(&m)
+				})
+				if err != nil {
+					return fmt.Errorf("updating messages: %v", err)
+				}
+				if err := tx.Delete(&pack); err != nil {
+					return fmt.Errorf("removing pack: %v", err)
+				}
+				return a.packLink(log, f.Name(), npack.ID)
+			})
+		})
+		if rerr != nil {
+			return rerr
+		}
+		stats.PackFiles++
+		stats.Repacked++
+	} else {
+		a.WithWLock(func() {
+			rerr = a.DB.Write(ctx, func(tx *bstore.Tx) error {
+				// Messages may have been copied since we looked.
+				q := bstore.QueryTx[Message](tx)
+				q.FilterEqual("Expunged", false)
+				q.FilterNonzero(Message{PackID: pack.ID})
+				if exists, err := q.Exists(); err != nil {
+					return fmt.Errorf("checking for messages in pack: %v", err)
+				} else if exists {
+					return fmt.Errorf("pack file has new messages")
+				}
+				return tx.Delete(&pack)
+			})
+		})
+		if rerr != nil {
+			return rerr
+		}
+	}
+
+	p := packPath(a.Dir, pack.ID)
+	err := os.Remove(p)
+	log.Check(err, "removing old pack file", slog.String("path", p))
+	stats.PacksRemoved++
+	return nil
+}
+
+// StartArchivePacker starts a goroutine that runs ArchivePack once a day for
+// accounts with an ArchiveTier configured.
+func StartArchivePacker(ctx context.Context) {
+	log := mlog.New("store", nil)
+
+	go func() {
+		defer func() {
+			x := recover()
+			if x == nil {
+				return
+			}
+
+			log.Error("unhandled panic in archive packer", slog.Any("err", x))
+			debug.PrintStack()
+			metrics.PanicInc(metrics.Store)
+		}()
+
+		// Wait a bit after startup, we don't want to slow it down.
+		t := time.NewTimer(time.Hour)
+		defer t.Stop()
+		for {
+			select {
+			case <-t.C:
+			case <-ctx.Done():
+				return
+			}
+
+			for _, accName := range mox.Conf.Accounts() {
+				if conf, ok := mox.Conf.Account(accName); !ok || conf.ArchiveTier == nil {
+					continue
+				}
+				archivePackAccount(ctx, log, accName)
+			}
+			t.Reset(24 * time.Hour)
+		}
+	}()
+}
+
+func archivePackAccount(ctx context.Context, log mlog.Log, accName string) {
+	log = log.With(slog.String("account", accName))
+	acc, err := OpenAccount(log, accName, false)
+	if err != nil {
+		log.Errorx("open account for archive packing", err)
+		return
+	}
+	defer func() {
+		err := acc.Close()
+		log.Check(err, "closing account after archive packing")
+	}()
+	stats, err := acc.ArchivePack(ctx, log)
+	if err != nil {
+		log.Errorx("archive packing", err)
+	}
+	if stats != (ArchivePackStats{}) {
+		log.Info("archive packing done",
+			slog.Int("packed", stats.Packed),
+			slog.Int64("packedsize", stats.PackedSize),
+			slog.Int("packfiles", stats.PackFiles),
+			slog.Int("repacked", stats.Repacked),
+			slog.Int("packsremoved", stats.PacksRemoved))
+	}
+}
@@ -0,0 +1,167 @@
+package store
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mjl-/bstore"
+
+	"github.com/mjl-/mox/config"
+	"github.com/mjl-/mox/mox-"
+)
+
+func TestArchivePack(t *testing.T) {
+	log := pkglog
+	os.RemoveAll("../testdata/store/data")
+	mox.ConfigStaticPath = filepath.FromSlash("../testdata/store/mox.conf")
+	mox.MustLoadConfig(true, false)
+	acc, err := OpenAccount(log, "mjl", false)
+	tcheck(t, err, "open account")
+	defer func() {
+		err = acc.Close()
+		tcheck(t, err, "closing account")
+		acc.CheckClosed()
+	}()
+	defer Switchboard()()
+
+	old := time.Now().Add(-100 * 24 * time.Hour)
+	prefix := []byte("Received: from localhost\r\n")
+	deliver := func(mailbox string, received time.Time, body string) Message {
+		t.Helper()
+		msgFile, err := CreateMessageTemp(log, "pack-test")
+		tcheck(t, err, "temp message file")
+		defer CloseRemoveTempFile(log, msgFile, "test message")
+		_, err = msgFile.Write([]byte(body))
+		tcheck(t, err, "write message")
+		m := Message{
+			Received:  received,
+			Size:      int64(len(prefix)) + int64(len(body)),
+			MsgPrefix: prefix,
+		}
+		acc.WithWLock(func() {
+			err := acc.DeliverMailbox(log, mailbox, &m, msgFile)
+			tcheck(t, err, "deliver")
+		})
+		return m
+	}
+	msg := func(subject string, size int) string {
+		s := fmt.Sprintf("Subject: %s\r\n\r\n", subject)
+		return s + strings.Repeat("hello world\r\n", size/13)
+	}
+
+	m1 := deliver("Archive", old, msg("first", 500))
+	m2 := deliver("Archive", old, msg("second", 500))
+	m3 := deliver("Inbox", old, msg("third", 500))
+	mlarge := deliver("Inbox", old, msg("large", 2000))
+	mnew := deliver("Inbox", time.Now(), msg("new", 500))
+
+	getMsg := func(id int64) Message {
+		t.Helper()
+		m := Message{ID: id}
+		err := acc.DB.Get(ctxbg, &m)
+		tcheck(t, err, "get message")
+		return m
+	}
+	checkData := func(m Message, body string) {
+		t.Helper()
+		mr := acc.MessageReader(m)
+		defer mr.Close()
+		buf, err := io.ReadAll(mr)
+		tcheck(t, err, "read message")
+		tcompare(t, string(buf), string(prefix)+body)
+
+		// ReadAt in the message data.
+		buf = make([]byte, 5)
+		_, err = mr.ReadAt(buf, int64(len(prefix))+9)
+		tcheck(t, err, "readat message")
+		tcompare(t, string(buf), body[9:14])
+	}
+	fileExists := func(p string) bool {
+		_, err := os.Stat(p)
+		return err == nil
+	}
+
+	// Without archive tier, nothing happens.
+	stats, err := acc.ArchivePack(ctxbg, log)
+	tcheck(t, err, "archive pack")
+	tcompare(t, stats, ArchivePackStats{})
+
+	accConf, _ := acc.Conf()
+	accConf.ArchiveTier = &config.ArchiveTier{Age: 30 * 24 * time.Hour, MaxMessageSize: 1024}
+	mox.Conf.Dynamic.Accounts["mjl"] = accConf
+
+	stats, err = acc.ArchivePack(ctxbg, log)
+	tcheck(t, err, "archive pack")
+	tcompare(t, stats, ArchivePackStats{Packed: 3, PackedSize: m1.Size + m2.Size + m3.Size - 3*int64(len(prefix)), PackFiles: 1})
+
+	for _, m := range []Message{m1, m2, m3} {
+		xm := getMsg(m.ID)
+		if xm.PackID == 0 {
+			t.Fatalf("message %d not packed", m.ID)
+		}
+		if fileExists(acc.MessagePath(m.ID)) {
+			t.Fatalf("message file for packed message %d still exists", m.ID)
+		}
+	}
+	for _, m := range []Message{mlarge, mnew} {
+		if xm := getMsg(m.ID); xm.PackID != 0 || !fileExists(acc.MessagePath(m.ID)) {
+			t.Fatalf("message %d packed, expected own file", m.ID)
+		}
+	}
+	checkData(getMsg(m1.ID), msg("first", 500))
+	checkData(getMsg(m3.ID), msg("third", 500))
+	checkData(getMsg(mlarge.ID), msg("large", 2000))
+
+	// Nothing more to do.
+	stats, err = acc.ArchivePack(ctxbg, log)
+	tcheck(t, err, "archive pack")
+	tcompare(t, stats, ArchivePackStats{})
+
+	// Remove mailbox with 2 of 3 packed messages. The packed messages have no files to
+	// remove, callers skip them. The pack file is rewritten with only the remaining
+	// message.
+	xm3 := getMsg(m3.ID)
+	oldPackPath := packPath(acc.Dir, xm3.PackID)
+	acc.WithWLock(func() {
+		err := acc.DB.Write(ctxbg, func(tx *bstore.Tx) error {
+			mb, err := acc.MailboxFind(tx, "Archive")
+			tcheck(t, err, "find mailbox")
+			_, removeMessages, _, err := acc.MailboxDelete(ctxbg, log, tx, *mb)
+			tcheck(t, err, "delete mailbox")
+			tcompare(t, len(removeMessages), 2)
+			for _, m := range removeMessages {
+				if m.PackID == 0 {
+					t.Fatalf("removed message %d has no pack id", m.ID)
+				}
+			}
+			return nil
+		})
+		tcheck(t, err, "delete mailbox")
+	})
+
+	stats, err = acc.ArchivePack(ctxbg, log)
+	tcheck(t, err, "archive pack")
+	tcompare(t, stats, ArchivePackStats{PackFiles: 1, Repacked: 1, PacksRemoved: 1})
+	if fileExists(oldPackPath) {
+		t.Fatalf("old pack file still exists after repack")
+	}
+	nm3 := getMsg(m3.ID)
+	if nm3.PackID == xm3.PackID || nm3.PackOffset != int64(len(packMagic)) {
+		t.Fatalf("message not repacked, pack id %d, offset %d", nm3.PackID, nm3.PackOffset)
+	}
+	checkData(nm3, msg("third", 500))
+
+	// Corrupt data is detected.
+	f, err := os.Open(packPath(acc.Dir, nm3.PackID))
+	tcheck(t, err, "open pack file")
+	defer f.Close()
+	_, err = packReadEntry(f, nm3.PackOffset, nm3.PackSize, nm3.Size-int64(len(prefix))-1)
+	if err == nil {
+		t.Fatalf("reading pack entry with wrong size succeeded")
+	}
+}
@@ -0,0 +1,318 @@
+package store
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"hash"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Password hash schemes that can be imported, with their names as used by
+// Dovecot.
+const (
+	PasswordSchemeBcrypt      = "BLF-CRYPT"
+	PasswordSchemeArgon2i     = "ARGON2I"
+	PasswordSchemeArgon2id    = "ARGON2ID"
+	PasswordSchemeSHA256Crypt = "SHA256-CRYPT"
+	PasswordSchemeSHA512Crypt = "SHA512-CRYPT"
+)
+
+// Maximum cost parameters for imported password hashes. Hashes are verified for
+// each login attempt, also by unauthenticated clients, so their cost must be
+// bounded.
+const (
+	maxArgon2Memory   = 1 << 20 // In KiB, so 1 GiB.
+	maxArgon2Time     = 10
+	maxArgon2Threads  = 16
+	maxSHACryptRounds = 1000000
+)
+
+// ParsePasswordHash parses a password hash from another system in crypt format,
+// e.g. "$2y$...", "$argon2id$...", "$6$...", optionally prefixed with a scheme
+// in Dovecot syntax, e.g. "{SHA512-CRYPT}". The hash is returned prefixed with
+// its scheme, as stored in Password.Hash.
+func ParsePasswordHash(s string) (scheme, taggedHash string, rerr error) {
+	var prefix string
+	if strings.HasPrefix(s, "{") {
+		t := strings.SplitN(s[1:], "}", 2)
+		if len(t) != 2 {
+			return "", "", fmt.Errorf("missing closing brace for scheme")
+		}
+		prefix = strings.ToUpper(t[0])
+		s = t[1]
+	}
+
+	switch {
+	case strings.HasPrefix(s, "$2a$") || strings.HasPrefix(s, "$2b$") || strings.HasPrefix(s, "$2y$"):
+		scheme = PasswordSchemeBcrypt
+		if _, err := bcrypt.Cost([]byte(s)); err != nil {
+			return "", "", fmt.Errorf("parsing bcrypt hash: %v", err)
+		}
+	case strings.HasPrefix(s, "$argon2i$") || strings.HasPrefix(s, "$argon2id$"):
+		scheme = PasswordSchemeArgon2i
+		if strings.HasPrefix(s, "$argon2id$") {
+			scheme = PasswordSchemeArgon2id
+		}
+		if _, err := parseArgon2(s); err != nil {
+			return "", "", err
+		}
+	case strings.HasPrefix(s, "$5$") || strings.HasPrefix(s, "$6$"):
+		scheme = PasswordSchemeSHA256Crypt
+		if strings.HasPrefix(s, "$6$") {
+			scheme = PasswordSchemeSHA512Crypt
+		}
+		if _, err := parseSHACrypt(s); err != nil {
+			return "", "", err
+		}
+	default:
+		return "", "", fmt.Errorf("unrecognized password hash, must be bcrypt, argon2 or sha-crypt in crypt format")
+	}
+
+	// Dovecot uses "CRYPT" for bcrypt and the other crypt formats.
+	if prefix != "" && prefix != scheme && prefix != "CRYPT" && !(scheme == PasswordSchemeBcrypt && prefix == "BCRYPT") {
+		return "", "", fmt.Errorf("scheme %q does not match hash with scheme %q", prefix, scheme)
+	}
+	return scheme, "{" + scheme + "}" + s, nil
+}
+
+// verifyPasswordHash checks password against a hash as returned by
+// ParsePasswordHash.
+func verifyPasswordHash(taggedHash, password string) bool {
+	t := strings.SplitN(strings.TrimPrefix(taggedHash, "{"), "}", 2)
+	if len(t) != 2 {
+		return false
+	}
+	scheme, s := t[0], t[1]
+	switch scheme {
+	case PasswordSchemeBcrypt:
+		return bcrypt.CompareHashAndPassword([]byte(s), []byte(password)) == nil
+	case PasswordSchemeArgon2i, PasswordSchemeArgon2id:
+		p, err := parseArgon2(s)
+		if err != nil {
+			return false
+		}
+		var key []byte
+		if p.variant == "argon2id" {
+			key = argon2.IDKey([]byte(password), p.salt, p.time, p.memory, p.threads, uint32(len(p.key)))
+		} else {
+			key = argon2.Key([]byte(password), p.salt, p.time, p.memory, p.threads, uint32(len(p.key)))
+		}
+		return subtle.ConstantTimeCompare(key, p.key) == 1
+	case PasswordSchemeSHA256Crypt, PasswordSchemeSHA512Crypt:
+		p, err := parseSHACrypt(s)
+		if err != nil {
+			return false
+		}
+		return subtle.ConstantTimeCompare([]byte(p.crypt(password)), []byte(p.encoded)) == 1
+	}
+	return false
+}
+
+type argon2Params struct {
+	variant string // "argon2i" or "argon2id".
+	memory  uint32 // In KiB.
+	time    uint32
+	threads uint8
+	salt    []byte
+	key     []byte
+}
+
+// parseArgon2 parses an argon2 hash in the PHC string format, e.g.
+// "$argon2id$v=19$m=65536,t=3,p=1$<salt>$<key>".
+func parseArgon2(s string) (p argon2Params, rerr error) {
+	t := strings.Split(s, "$")
+	if len(t) != 6 || t[0] != "" {
+		return p, fmt.Errorf("malformed argon2 hash")
+	}
+	p.variant = t[1]
+	if t[2] != "v=19" {
+		return p, fmt.Errorf("unsupported argon2 version %q", t[2])
+	}
+	for _, kv := range strings.Split(t[3], ",") {
+		k, v, _ := strings.Cut(kv, "=")
+		n, err := strconv.ParseUint(v, 10, 32)
+		if err != nil {
+			return p, fmt.Errorf("parsing argon2 parameter %q: %v", kv, err)
+		}
+		switch k {
+		case "m":
+			p.memory = uint32(n)
+		case "t":
+			p.time = uint32(n)
+		case "p":
+			if n > maxArgon2Threads {
+				return p, fmt.Errorf("argon2 parallelism %d too high, maximum is %d", n, maxArgon2Threads)
+			}
+			p.threads = uint8(n)
+		default:
+			return p, fmt.Errorf("unknown argon2 parameter %q", k)
+		}
+	}
+	if p.memory == 0 || p.time == 0 || p.threads == 0 {
+		return p, fmt.Errorf("missing argon2 parameters")
+	} else if p.memory > maxArgon2Memory {
+		return p, fmt.Errorf("argon2 memory %d KiB too high, maximum is %d KiB", p.memory, maxArgon2Memory)
+	} else if p.time > maxArgon2Time {
+		return p, fmt.Errorf("argon2 time %d too high, maximum is %d", p.time, maxArgon2Time)
+	}
+	var err error
+	if p.salt, err = base64.RawStdEncoding.DecodeString(t[4]); err != nil {
+		return p, fmt.Errorf("parsing argon2 salt: %v", err)
+	}
+	if p.key, err = base64.RawStdEncoding.DecodeString(t[5]); err != nil {
+		return p, fmt.Errorf("parsing argon2 key: %v", err)
+	} else if len(p.key) < 16 {
+		return p, fmt.Errorf("argon2 key too short")
+	}
+	return p, nil
+}
+
+type shaCryptParams struct {
+	id      string // "5" for SHA-256, "6" for SHA-512.
+	rounds  int    // Zero if not explicitly specified.
+	salt    string
+	encoded string // Full hash, as parsed.
+}
+
+// parseSHACrypt parses a SHA-256 or SHA-512 crypt hash, e.g.
+// "$6$rounds=5000$<salt>$<hash>".
+func parseSHACrypt(s string) (p shaCryptParams, rerr error) {
+	t := strings.Split(s, "$")
+	if len(t) == 5 && strings.HasPrefix(t[2], "rounds=") {
+		v, err := strconv.Atoi(strings.TrimPrefix(t[2], "rounds="))
+		if err != nil {
+			return p, fmt.Errorf("parsing rounds: %v", err)
+		} else if v > maxSHACryptRounds {
+			return p, fmt.Errorf("sha-crypt rounds %d too high, maximum is %d", v, maxSHACryptRounds)
+		}
+		p.rounds = v
+		t = append(t[:2], t[3:]...)
+	}
+	if len(t) != 4 || t[0] != "" || t[3] == "" {
+		return p, fmt.Errorf("malformed sha-crypt hash")
+	}
+	p.id = t[1]
+	p.salt = t[2]
+	p.encoded = s
+	return p, nil
+}
+
+// crypt returns the hash for password with the parameters, in the same format as
+// it was parsed. Based on "Unix crypt using SHA-256 and SHA-512" by Ulrich
+// Drepper.
+func (p shaCryptParams) crypt(password string) string {
+	rounds := 5000
+	if p.rounds != 0 {
+		rounds = min(max(p.rounds, 1000), maxSHACryptRounds)
+	}
+	salt := p.salt
+	if len(salt) > 16 {
+		salt = salt[:16]
+	}
+
+	var newHash func() hash.Hash
+	var order [][3]int
+	if p.id == "5" {
+		newHash = sha256.New
+		order = [][3]int{{0, 10, 20}, {21, 1, 11}, {12, 22, 2}, {3, 13, 23}, {24, 4, 14}, {15, 25, 5}, {6, 16, 26}, {27, 7, 17}, {18, 28, 8}, {9, 19, 29}}
+	} else {
+		newHash = sha512.New
+		order = [][3]int{{0, 21, 42}, {22, 43, 1}, {44, 2, 23}, {3, 24, 45}, {25, 46, 4}, {47, 5, 26}, {6, 27, 48}, {28, 49, 7}, {50, 8, 29}, {9, 30, 51}, {31, 52, 10}, {53, 11, 32}, {12, 33, 54}, {34, 55, 13}, {56, 14, 35}, {15, 36, 57}, {37, 58, 16}, {59, 17, 38}, {18, 39, 60}, {40, 61, 19}, {62, 20, 41}}
+	}
+
+	pw := []byte(password)
+	sb := []byte(salt)
+
+	// Repeat buf to make n bytes.
+	repeat := func(buf []byte, n int) []byte {
+		r := make([]byte, 0, n)
+		for len(r) < n {
+			r = append(r, buf[:min(len(buf), n-len(r))]...)
+		}
+		return r
+	}
+
+	h := newHash()
+	h.Write(pw)
+	h.Write(sb)
+	h.Write(pw)
+	b := h.Sum(nil)
+
+	h = newHash()
+	h.Write(pw)
+	h.Write(sb)
+	h.Write(repeat(b, len(pw)))
+	for n := len(pw); n > 0; n >>= 1 {
+		if n&1 != 0 {
+			h.Write(b)
+		} else {
+			h.Write(pw)
+		}
+	}
+	a := h.Sum(nil)
+
+	h = newHash()
+	for range pw {
+		h.Write(pw)
+	}
+	pbytes := repeat(h.Sum(nil), len(pw))
+
+	h = newHash()
+	for i := 0; i < 16+int(a[0]); i++ {
+		h.Write(sb)
+	}
+	sbytes := repeat(h.Sum(nil), len(sb))
+
+	c := a
+	for i := 0; i < rounds; i++ {
+		h = newHash()
+		if i%2 != 0 {
+			h.Write(pbytes)
+		} else {
+			h.Write(c)
+		}
+		if i%3 != 0 {
+			h.Write(sbytes)
+		}
+		if i%7 != 0 {
+			h.Write(pbytes)
+		}
+		if i%2 != 0 {
+			h.Write(c)
+		} else {
+			h.Write(pbytes)
+		}
+		c = h.Sum(nil)
+	}
+
+	const alphabet = "./0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+	var enc strings.Builder
+	b64 := func(b2, b1, b0 byte, n int) {
+		w := uint(b2)<<16 | uint(b1)<<8 | uint(b0)
+		for ; n > 0; n-- {
+			enc.WriteByte(alphabet[w&0x3f])
+			w >>= 6
+		}
+	}
+	for _, o := range order {
+		b64(c[o[0]], c[o[1]], c[o[2]], 4)
+	}
+	if p.id == "5" {
+		b64(0, c[31], c[30], 3)
+	} else {
+		b64(0, 0, c[63], 2)
+	}
+
+	r := "$" + p.id + "$"
+	if p.rounds != 0 {
+		r += fmt.Sprintf("rounds=%d$", p.rounds)
+	}
+	return r + salt + "$" + enc.String()
+}
@@ -0,0 +1,120 @@
+package store
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/mjl-/bstore"
+
+	"github.com/mjl-/mox/mlog"
+	"github.com/mjl-/mox/mox-"
+)
+
+func TestPasswordHash(t *testing.T) {
+	bcryptHash, err := bcrypt.GenerateFromPassword([]byte("Hello world!"), bcrypt.MinCost)
+	tcheck(t, err, "bcrypt hash")
+
+	test := func(hash, password, expScheme string, expOK bool) {
+		t.Helper()
+		scheme, taggedHash, err := ParsePasswordHash(hash)
+		if expScheme == "" {
+			if err == nil {
+				t.Fatalf("parsing password hash %q: got nil error, expected error", hash)
+			}
+			return
+		}
+		tcheck(t, err, "parse password hash")
+		tcompare(t, scheme, expScheme)
+		tcompare(t, verifyPasswordHash(taggedHash, password), expOK)
+	}
+
+	// Vectors from "Unix crypt using SHA-256 and SHA-512", and openssl passwd.
+	test("$5$saltstring$5B8vYYiY.CVt1RlTTf8KbXBH3hsxY/GNooZaBBGWEc5", "Hello world!", PasswordSchemeSHA256Crypt, true)
+	test("$5$rounds=10000$saltstringsaltst$3xv.VbSHBb41AL9AvLeujZkZRBAwqFMz2.opqey6IcA", "Hello world!", PasswordSchemeSHA256Crypt, true)
+	test("{SHA512-CRYPT}$6$saltstring$svn8UoSVapNtMuq1ukKS4tPQd8iKwSMHWjl/O817G3uBnIFNjnQJuesI68u4OTLiBFdcbYEdFCoEOfaS35inz1", "Hello world!", PasswordSchemeSHA512Crypt, true)
+	test("$6$saltstring$svn8UoSVapNtMuq1ukKS4tPQd8iKwSMHWjl/O817G3uBnIFNjnQJuesI68u4OTLiBFdcbYEdFCoEOfaS35inz1", "Hello world", PasswordSchemeSHA512Crypt, false)
+	test("$6$rounds=5000$toolongsaltstrin$lQ8jolhgVRVhY4b5pZKaysCLi0QBxGoNeKQzQ3glMhwllF7oGDZxUhx1yxdYcz/e1JSbq3y6JMxxl8audkUEm0", "This is just a test", PasswordSchemeSHA512Crypt, true)
+	test("$6$toolongsaltstrin$qyFKOImKJ/9ow78ZyWHhqDtAhziHRo1f4nH4UVCPQ4mFgblG/GJpVEmGNvg826snosrCyJM90PuGfz8zVcbet/", "test1234", PasswordSchemeSHA512Crypt, true)
+
+	// Vector from the argon2 reference implementation.
+	test("$argon2i$v=19$m=65536,t=2,p=4$c29tZXNhbHQ$RdescudvJCsgt3ub+b+dWRWJTmaaJObG", "password", PasswordSchemeArgon2i, true)
+	test("{ARGON2I}$argon2i$v=19$m=65536,t=2,p=4$c29tZXNhbHQ$RdescudvJCsgt3ub+b+dWRWJTmaaJObG", "bogus", PasswordSchemeArgon2i, false)
+
+	test(string(bcryptHash), "Hello world!", PasswordSchemeBcrypt, true)
+	test("{BLF-CRYPT}"+string(bcryptHash), "Hello world", PasswordSchemeBcrypt, false)
+
+	test("{SHA512-CRYPT}"+string(bcryptHash), "", "", false) // Mismatching scheme.
+	test("{PLAIN}test1234", "", "", false)
+	test("$1$saltstring$hash", "", "", false)
+	test("$argon2id$v=16$m=65536,t=2,p=4$c29tZXNhbHQ$RdescudvJCsgt3ub+b+dWRWJTmaaJObG", "", "", false)
+
+	// Parameters making verification too expensive are refused.
+	test("$argon2i$v=19$m=4194304,t=2,p=4$c29tZXNhbHQ$RdescudvJCsgt3ub+b+dWRWJTmaaJObG", "", "", false)
+	test("$argon2i$v=19$m=65536,t=11,p=4$c29tZXNhbHQ$RdescudvJCsgt3ub+b+dWRWJTmaaJObG", "", "", false)
+	test("$argon2i$v=19$m=65536,t=2,p=17$c29tZXNhbHQ$RdescudvJCsgt3ub+b+dWRWJTmaaJObG", "", "", false)
+	test("$5$rounds=999999999$saltstringsaltst$3xv.VbSHBb41AL9AvLeujZkZRBAwqFMz2.opqey6IcA", "", "", false)
+
+	// Account with imported hash, upgraded at first login.
+	log := mlog.New("store", nil)
+	os.RemoveAll("../testdata/store/data")
+	mox.ConfigStaticPath = filepath.FromSlash("../testdata/store/mox.conf")
+	mox.MustLoadConfig(true, false)
+	// For authentication lockouts.
+	err = Init(ctxbg)
+	tcheck(t, err, "store init")
+	defer func() {
+		err := Close()
+		tcheck(t, err, "store close")
+	}()
+	acc, err := OpenAccount(log, "mjl", false)
+	tcheck(t, err, "open account")
+	defer func() {
+		err = acc.Close()
+		tcheck(t, err, "closing account")
+		acc.CheckClosed()
+	}()
+
+	err = acc.SetPasswordHash(log, "$6$toolongsaltstrin$qyFKOImKJ/9ow78ZyWHhqDtAhziHRo1f4nH4UVCPQ4mFgblG/GJpVEmGNvg826snosrCyJM90PuGfz8zVcbet/")
+	tcheck(t, err, "set password hash")
+	err = acc.SetPasswordHash(log, "bogus")
+	if err == nil {
+		t.Fatalf("set bad password hash: got nil error, expected error")
+	}
+
+	_, _, err = OpenEmailAuth(log, "mjl@mox.example", "bogus", false)
+	tcompare(t, err, ErrUnknownCredentials)
+
+	// Imported hash is not upgraded for an account with logins disabled.
+	accConf, _ := mox.Conf.Account("mjl")
+	nconf := accConf
+	nconf.LoginDisabled = "disabled for test"
+	mox.Conf.Dynamic.Accounts["mjl"] = nconf
+	_, _, err = OpenEmailAuth(log, "mjl@mox.example", "test1234", true)
+	if !errors.Is(err, ErrLoginDisabled) {
+		t.Fatalf("got err %v, expected ErrLoginDisabled", err)
+	}
+	mox.Conf.Dynamic.Accounts["mjl"] = accConf
+	pw, err := bstore.QueryDB[Password](ctxbg, acc.DB).Get()
+	tcheck(t, err, "get password")
+	tcompare(t, strings.HasPrefix(pw.Hash, "{SHA512-CRYPT}"), true)
+
+	acc2, _, err := OpenEmailAuth(log, "mjl@mox.example", "test1234", false)
+	tcheck(t, err, "open with imported password hash")
+	err = acc2.Close()
+	tcheck(t, err, "close account")
+
+	pw, err = bstore.QueryDB[Password](ctxbg, acc.DB).Get()
+	tcheck(t, err, "get password")
+	tcompare(t, strings.HasPrefix(pw.Hash, "$2a$"), true)
+	tcompare(t, len(pw.SCRAMSHA256.SaltedPassword) > 0, true)
+
+	acc2, _, err = OpenEmailAuth(log, "mjl@mox.example", "test1234", false)
+	tcheck(t, err, "open with upgraded password")
+	err = acc2.Close()
+	tcheck(t, err, "close account")
+}
@@ -2,11 +2,14 @@ package store
 
 import (
 	"bytes"
+	"fmt"
 	"io"
 	"strings"
 	"unicode"
 	"unicode/utf8"
 
+	"github.com/mjl-/bstore"
+
 	"github.com/mjl-/mox/message"
 	"github.com/mjl-/mox/mlog"
 )
@@ -16,14 +19,18 @@ import (
 type WordSearch struct {
 	words, notWords    [][]byte
 	searchBuf, keepBuf []byte
+	indexWords         [][]string // For each word, its parts for matching against TextIndex.
 }
 
 // PrepareWordSearch returns a search context that can be used to match multiple
 // messages (after each other, not concurrently).
 func PrepareWordSearch(words, notWords []string) WordSearch {
 	var wl, nwl [][]byte
+	var iwl [][]string
 	for _, w := range words {
-		wl = append(wl, []byte(strings.ToLower(w)))
+		lw := strings.ToLower(w)
+		wl = append(wl, []byte(lw))
+		iwl = append(iwl, textWords(lw))
 	}
 	for _, w := range notWords {
 		nwl = append(nwl, []byte(strings.ToLower(w)))
@@ -50,7 +57,28 @@ func PrepareWordSearch(words, notWords []string) WordSearch {
 	keepBuf := make([]byte, keep)
 	searchBuf := make([]byte, bufSize)
 
-	return WordSearch{wl, nwl, searchBuf, keepBuf}
+	return WordSearch{wl, nwl, searchBuf, keepBuf, iwl}
+}
+
+// MatchIndex returns whether the message with msgID may match the search,
+// according to its TextIndex. If false, the message does not match. If true,
+// MatchPart must be used to determine whether the message matches. Messages
+// without TextIndex may always match.
+func (ws WordSearch) MatchIndex(tx *bstore.Tx, msgID int64) (bool, error) {
+	ti := TextIndex{ID: msgID}
+	if err := tx.Get(&ti); err == bstore.ErrAbsent {
+		return true, nil
+	} else if err != nil {
+		return false, fmt.Errorf("get text index: %w", err)
+	}
+	for _, l := range ws.indexWords {
+		for _, w := range l {
+			if !strings.Contains(ti.Words, w) {
+				return false, nil
+			}
+		}
+	}
+	return true, nil
 }
 
 // MatchPart returns whether the part/mail message p matches the search.
@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"log/slog"
 	"runtime/debug"
+	"sort"
 	"sync"
 	"time"
 
@@ -18,10 +19,34 @@ import (
 	"github.com/mjl-/mox/mox-"
 )
 
-const sessionsPerAccount = 100            // We remove the oldest when 100th is added.
-const sessionLifetime = 24 * time.Hour    // Extended automatically by use.
 const sessionWriteDelay = 5 * time.Minute // Per account, for coalescing writes.
 
+// sessionLimits returns the limits for sessions from the WebSessions config, with
+// defaults applied. The lifetime of a session is extended by use up to
+// maxLifetime after login, zero meaning no maximum. When a new session exceeds
+// perAccount, the least recently used session is removed.
+func sessionLimits() (idleTimeout, maxLifetime time.Duration, perAccount int) {
+	ws := mox.Conf.Static.WebSessions
+	idleTimeout, maxLifetime, perAccount = 24*time.Hour, ws.MaxLifetime, 100
+	if ws.IdleTimeout > 0 {
+		idleTimeout = ws.IdleTimeout
+	}
+	if ws.MaxPerAccount > 0 {
+		perAccount = ws.MaxPerAccount
+	}
+	return
+}
+
+// sessionExpires returns the expiration time of a session used at time t.
+func sessionExpires(created, t time.Time) time.Time {
+	idleTimeout, maxLifetime, _ := sessionLimits()
+	expires := t.Add(idleTimeout)
+	if maxLifetime > 0 && created.Add(maxLifetime).Before(expires) {
+		expires = created.Add(maxLifetime)
+	}
+	return expires
+}
+
 var sessions = struct {
 	sync.Mutex
 
@@ -102,14 +127,18 @@ func sessionUse(ctx context.Context, log mlog.Log, accountName string, sessionTo
 	ls, ok := sessions.accounts[accountName][sessionToken]
 	if !ok {
 		return LoginSession{}, fmt.Errorf("unknown session token")
+	}
+	idleTimeout, maxLifetime, _ := sessionLimits()
+	if maxLifetime > 0 && time.Since(ls.Created) >= maxLifetime {
+		return LoginSession{}, fmt.Errorf("session expired (maximum lifetime of %s reached)", maxLifetime)
 	} else if time.Until(ls.Expires) < 0 {
-		return LoginSession{}, fmt.Errorf("session expired (after 24 hours inactivity)")
+		return LoginSession{}, fmt.Errorf("session expired (after %s inactivity)", idleTimeout)
 	} else if csrfToken != "" && csrfToken != ls.csrfToken {
 		return LoginSession{}, fmt.Errorf("mismatch between csrf and session tokens")
 	}
 
 	// Extend lifetime.
-	ls.Expires = time.Now().Add(sessionLifetime)
+	ls.Expires = sessionExpires(ls.Created, time.Now())
 	sessions.accounts[accountName][sessionToken] = ls
 
 	// If we haven't scheduled a flush to database yet, schedule one now.
@@ -204,26 +233,30 @@ func sessionAddToken(ctx context.Context, log mlog.Log, acc *Account, ls *LoginS
 
 	err := acc.DB.Write(ctx, func(tx *bstore.Tx) error {
 		// Remove sessions if we have too many, starting with expired sessions, and
-		// removing the oldest if needed.
-		if len(sessions.accounts[ls.AccountName]) >= sessionsPerAccount {
-			var oldest LoginSession
+		// removing the least recently used if needed. Sessions are extended by use, so the
+		// least recently used session expires first.
+		_, _, perAccount := sessionLimits()
+		if len(sessions.accounts[ls.AccountName]) >= perAccount {
 			for _, ols := range sessions.accounts[ls.AccountName] {
 				if time.Until(ols.Expires) < 0 {
 					if err := tx.Delete(&ols); err != nil {
 						return err
 					}
-					delete(sessions.accounts[ls.AccountName], ols.sessionToken)
-					continue
-				}
-				if oldest.ID == 0 || ols.Expires.Before(oldest.Expires) {
-					oldest = ols
+					sessionForget(ls.AccountName, ols.sessionToken)
 				}
 			}
-			if len(sessions.accounts[ls.AccountName]) >= sessionsPerAccount {
+			// With a lowered limit, we may have to remove more than one session.
+			for len(sessions.accounts[ls.AccountName]) >= perAccount {
+				var oldest LoginSession
+				for _, ols := range sessions.accounts[ls.AccountName] {
+					if oldest.ID == 0 || ols.Expires.Before(oldest.Expires) {
+						oldest = ols
+					}
+				}
 				if err := tx.Delete(&oldest); err != nil {
 					return err
 				}
-				delete(sessions.accounts[ls.AccountName], oldest.sessionToken)
+				sessionForget(ls.AccountName, oldest.sessionToken)
 			}
 		}
 
@@ -244,7 +277,8 @@ func sessionAddToken(ctx context.Context, log mlog.Log, acc *Account, ls *LoginS
 // is removed.
 func SessionAdd(ctx context.Context, log mlog.Log, accountName, loginAddress string) (session SessionToken, csrf CSRFToken, rerr error) {
 	// Prepare new LoginSession.
-	ls := LoginSession{0, time.Time{}, time.Now().Add(sessionLifetime), [16]byte{}, [16]byte{}, accountName, loginAddress, "", ""}
+	now := time.Now()
+	ls := LoginSession{0, now, sessionExpires(now, now), [16]byte{}, [16]byte{}, accountName, loginAddress, "", ""}
 	if _, err := cryptorand.Read(ls.SessionTokenBinary[:]); err != nil {
 		return "", "", err
 	}
@@ -296,14 +330,75 @@ func SessionRemove(ctx context.Context, log mlog.Log, accountName string, sessio
 	if err := acc.DB.Delete(ctx, &ls); err != nil {
 		return err
 	}
+	sessionForget(accountName, sessionToken)
+	return nil
+}
 
+// sessionForget removes a session from the in-memory cache, and from pending
+// flushes.
+//
+// caller must hold sessions lock.
+func sessionForget(accountName string, sessionToken SessionToken) {
 	delete(sessions.accounts[accountName], sessionToken)
-	pf := sessions.pendingFlushes[accountName]
-	if pf != nil {
+	if pf := sessions.pendingFlushes[accountName]; pf != nil {
 		delete(pf, sessionToken)
 	}
+}
 
-	return nil
+// SessionList returns the sessions of an account that have not expired, most
+// recently used first. Secret tokens are not included in JSON.
+func SessionList(ctx context.Context, log mlog.Log, accountName string) ([]LoginSession, error) {
+	sessions.Lock()
+	defer sessions.Unlock()
+
+	if _, err := ensureAccountSessions(ctx, log, accountName, false); err != nil {
+		return nil, err
+	}
+
+	_, maxLifetime, _ := sessionLimits()
+	l := []LoginSession{}
+	for _, ls := range sessions.accounts[accountName] {
+		if time.Until(ls.Expires) < 0 || maxLifetime > 0 && time.Since(ls.Created) >= maxLifetime {
+			continue
+		}
+		l = append(l, ls)
+	}
+	sort.Slice(l, func(i, j int) bool {
+		return l[i].Expires.After(l[j].Expires)
+	})
+	return l, nil
+}
+
+// ErrSessionUnknown is returned by SessionRemoveID for a session that doesn't
+// exist.
+var ErrSessionUnknown = errors.New("unknown session")
+
+// SessionRemoveID removes a session by its ID, e.g. by an admin. Future
+// operations using the session token will fail.
+func SessionRemoveID(ctx context.Context, log mlog.Log, accountName string, id int64) error {
+	sessions.Lock()
+	defer sessions.Unlock()
+
+	acc, err := ensureAccountSessions(ctx, log, accountName, true)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err := acc.Close()
+		log.Check(err, "closing account")
+	}()
+
+	for _, ls := range sessions.accounts[accountName] {
+		if ls.ID != id {
+			continue
+		}
+		if err := acc.DB.Delete(ctx, &ls); err != nil {
+			return err
+		}
+		sessionForget(accountName, ls.sessionToken)
+		return nil
+	}
+	return ErrSessionUnknown
 }
 
 // sessionRemoveAll removes all session tokens for an account. Useful after a password reset.
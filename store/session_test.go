@@ -0,0 +1,86 @@
+package store
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mjl-/mox/config"
+	"github.com/mjl-/mox/mox-"
+)
+
+func TestSessions(t *testing.T) {
+	log := pkglog
+	os.RemoveAll("../testdata/store/data")
+	mox.ConfigStaticPath = filepath.FromSlash("../testdata/store/mox.conf")
+	mox.MustLoadConfig(true, false)
+	defer func() {
+		mox.Conf.Static.WebSessions = config.WebSessions{}
+	}()
+
+	// Cache may be populated from earlier tests with removed data.
+	sessions.Lock()
+	delete(sessions.accounts, "mjl")
+	sessions.Unlock()
+
+	mox.Conf.Static.WebSessions = config.WebSessions{MaxPerAccount: 2}
+
+	s1, csrf1, err := SessionAdd(ctxbg, log, "mjl", "mjl@mox.example")
+	tcheck(t, err, "add session")
+	s2, _, err := SessionAdd(ctxbg, log, "mjl", "mjl@mox.example")
+	tcheck(t, err, "add session")
+
+	// Using the first session makes the second the least recently used.
+	time.Sleep(time.Millisecond)
+	_, err = SessionUse(ctxbg, log, "mjl", s1, csrf1)
+	tcheck(t, err, "use session")
+	_, err = SessionUse(ctxbg, log, "mjl", s1, "bogus")
+	if err == nil {
+		t.Fatalf("session used with bad csrf token")
+	}
+
+	s3, _, err := SessionAdd(ctxbg, log, "mjl", "mjl@mox.example")
+	tcheck(t, err, "add session")
+	_, err = SessionUse(ctxbg, log, "mjl", s2, "")
+	if err == nil {
+		t.Fatalf("least recently used session not removed")
+	}
+
+	l, err := SessionList(ctxbg, log, "mjl")
+	tcheck(t, err, "list sessions")
+	if len(l) != 2 || l[0].sessionToken != s3 || l[1].sessionToken != s1 {
+		t.Fatalf("unexpected sessions %v", l)
+	}
+
+	// Remove by ID, as done by admin.
+	err = SessionRemoveID(ctxbg, log, "mjl", l[0].ID)
+	tcheck(t, err, "remove session")
+	_, err = SessionUse(ctxbg, log, "mjl", s3, "")
+	if err == nil {
+		t.Fatalf("removed session still valid")
+	}
+	err = SessionRemoveID(ctxbg, log, "mjl", l[0].ID)
+	if !errors.Is(err, ErrSessionUnknown) {
+		t.Fatalf("removing unknown session, got %v, expected ErrSessionUnknown", err)
+	}
+
+	// Sessions expire after their maximum lifetime, even when used.
+	mox.Conf.Static.WebSessions = config.WebSessions{MaxLifetime: 50 * time.Millisecond}
+	s4, _, err := SessionAdd(ctxbg, log, "mjl", "mjl@mox.example")
+	tcheck(t, err, "add session")
+	ls, err := SessionUse(ctxbg, log, "mjl", s4, "")
+	tcheck(t, err, "use session")
+	if ls.Expires.After(ls.Created.Add(50 * time.Millisecond)) {
+		t.Fatalf("session expires %v, after maximum lifetime from created %v", ls.Expires, ls.Created)
+	}
+	time.Sleep(60 * time.Millisecond)
+	_, err = SessionUse(ctxbg, log, "mjl", s4, "")
+	if err == nil {
+		t.Fatalf("session valid after maximum lifetime")
+	}
+	l, err = SessionList(ctxbg, log, "mjl")
+	tcheck(t, err, "list sessions")
+	tcompare(t, len(l), 0)
+}
@@ -0,0 +1,208 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mjl-/bstore"
+
+	"github.com/mjl-/mox/sieve"
+)
+
+// Errors returned by the sieve script functions.
+var (
+	ErrSieveScript         = errors.New("invalid sieve script")
+	ErrSieveScriptNotFound = errors.New("sieve script not found")
+	ErrSieveScriptExists   = errors.New("sieve script already exists")
+	ErrSieveScriptActive   = errors.New("sieve script is active")
+)
+
+// SieveScripts returns all sieve scripts of the account, sorted by name.
+func (a *Account) SieveScripts(ctx context.Context) ([]SieveScript, error) {
+	q := bstore.QueryDB[SieveScript](ctx, a.DB)
+	q.SortAsc("Name")
+	return q.List()
+}
+
+// SieveScriptGet returns the sieve script with name, or ErrSieveScriptNotFound.
+func (a *Account) SieveScriptGet(ctx context.Context, name string) (SieveScript, error) {
+	q := bstore.QueryDB[SieveScript](ctx, a.DB)
+	q.FilterNonzero(SieveScript{Name: name})
+	ss, err := q.Get()
+	if err == bstore.ErrAbsent {
+		return SieveScript{}, ErrSieveScriptNotFound
+	}
+	return ss, err
+}
+
+// SieveScriptActive returns the active sieve script, or nil if there is none.
+func (a *Account) SieveScriptActive(ctx context.Context) (*SieveScript, error) {
+	q := bstore.QueryDB[SieveScript](ctx, a.DB)
+	q.FilterEqual("Active", true)
+	ss, err := q.Get()
+	if err == bstore.ErrAbsent {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return &ss, nil
+}
+
+// SieveScriptSave checks and saves a sieve script under name, replacing an
+// existing script with the same name. If active is set, the script becomes the
+// active script, and any other script is deactivated.
+func (a *Account) SieveScriptSave(ctx context.Context, name, script string, active bool) error {
+	if _, err := sieve.Parse(script); err != nil {
+		return fmt.Errorf("%w: %v", ErrSieveScript, err)
+	}
+	return a.DB.Write(ctx, func(tx *bstore.Tx) error {
+		if active {
+			q := bstore.QueryTx[SieveScript](tx)
+			q.FilterEqual("Active", true)
+			q.FilterNotEqual("Name", name)
+			if _, err := q.UpdateFields(map[string]any{"Active": false, "Updated": time.Now()}); err != nil {
+				return fmt.Errorf("deactivating scripts: %v", err)
+			}
+		}
+
+		q := bstore.QueryTx[SieveScript](tx)
+		q.FilterNonzero(SieveScript{Name: name})
+		ss, err := q.Get()
+		if err == bstore.ErrAbsent {
+			ss = SieveScript{Name: name, Script: script, Active: active, Updated: time.Now()}
+			return tx.Insert(&ss)
+		} else if err != nil {
+			return fmt.Errorf("looking up script: %v", err)
+		}
+		ss.Script = script
+		ss.Active = active
+		ss.Updated = time.Now()
+		return tx.Update(&ss)
+	})
+}
+
+// SieveScriptPut checks and saves a sieve script under name, replacing an existing
+// script with the same name but keeping its active status.
+func (a *Account) SieveScriptPut(ctx context.Context, name, script string) error {
+	if _, err := sieve.Parse(script); err != nil {
+		return fmt.Errorf("%w: %v", ErrSieveScript, err)
+	}
+	return a.DB.Write(ctx, func(tx *bstore.Tx) error {
+		q := bstore.QueryTx[SieveScript](tx)
+		q.FilterNonzero(SieveScript{Name: name})
+		ss, err := q.Get()
+		if err == bstore.ErrAbsent {
+			ss = SieveScript{Name: name, Script: script, Updated: time.Now()}
+			return tx.Insert(&ss)
+		} else if err != nil {
+			return fmt.Errorf("looking up script: %v", err)
+		}
+		ss.Script = script
+		ss.Updated = time.Now()
+		return tx.Update(&ss)
+	})
+}
+
+// SieveScriptSetActive makes the script with name the active script, deactivating
+// any other script. If name is empty, all scripts are deactivated.
+func (a *Account) SieveScriptSetActive(ctx context.Context, name string) error {
+	return a.DB.Write(ctx, func(tx *bstore.Tx) error {
+		if name != "" {
+			q := bstore.QueryTx[SieveScript](tx)
+			q.FilterNonzero(SieveScript{Name: name})
+			if exists, err := q.Exists(); err != nil {
+				return fmt.Errorf("looking up script: %v", err)
+			} else if !exists {
+				return ErrSieveScriptNotFound
+			}
+		}
+
+		q := bstore.QueryTx[SieveScript](tx)
+		q.FilterEqual("Active", true)
+		q.FilterNotEqual("Name", name)
+		if _, err := q.UpdateFields(map[string]any{"Active": false, "Updated": time.Now()}); err != nil {
+			return fmt.Errorf("deactivating scripts: %v", err)
+		}
+		if name == "" {
+			return nil
+		}
+		q = bstore.QueryTx[SieveScript](tx)
+		q.FilterNonzero(SieveScript{Name: name})
+		q.FilterEqual("Active", false)
+		_, err := q.UpdateFields(map[string]any{"Active": true, "Updated": time.Now()})
+		return err
+	})
+}
+
+// SieveScriptDelete removes the script with name. The active script cannot be
+// removed, ErrSieveScriptActive is returned.
+func (a *Account) SieveScriptDelete(ctx context.Context, name string) error {
+	return a.DB.Write(ctx, func(tx *bstore.Tx) error {
+		q := bstore.QueryTx[SieveScript](tx)
+		q.FilterNonzero(SieveScript{Name: name})
+		ss, err := q.Get()
+		if err == bstore.ErrAbsent {
+			return ErrSieveScriptNotFound
+		} else if err != nil {
+			return fmt.Errorf("looking up script: %v", err)
+		} else if ss.Active {
+			return ErrSieveScriptActive
+		}
+		return tx.Delete(&ss)
+	})
+}
+
+// SieveScriptRename changes the name of a script, keeping its active status.
+func (a *Account) SieveScriptRename(ctx context.Context, name, newName string) error {
+	return a.DB.Write(ctx, func(tx *bstore.Tx) error {
+		q := bstore.QueryTx[SieveScript](tx)
+		q.FilterNonzero(SieveScript{Name: name})
+		ss, err := q.Get()
+		if err == bstore.ErrAbsent {
+			return ErrSieveScriptNotFound
+		} else if err != nil {
+			return fmt.Errorf("looking up script: %v", err)
+		}
+
+		q = bstore.QueryTx[SieveScript](tx)
+		q.FilterNonzero(SieveScript{Name: newName})
+		if exists, err := q.Exists(); err != nil {
+			return fmt.Errorf("looking up script: %v", err)
+		} else if exists {
+			return ErrSieveScriptExists
+		}
+
+		ss.Name = newName
+		ss.Updated = time.Now()
+		return tx.Update(&ss)
+	})
+}
+
+// VacationResponseNeeded returns whether a vacation response for handle should be
+// sent to address, i.e. if no response was sent during the past days. If so, the
+// response is recorded as sent.
+func (a *Account) VacationResponseNeeded(ctx context.Context, handle, address string, days int) (bool, error) {
+	address = strings.ToLower(address)
+	var send bool
+	err := a.DB.Write(ctx, func(tx *bstore.Tx) error {
+		q := bstore.QueryTx[VacationResponse](tx)
+		q.FilterNonzero(VacationResponse{Handle: handle, Address: address})
+		vr, err := q.Get()
+		if err == bstore.ErrAbsent {
+			send = true
+			return tx.Insert(&VacationResponse{Handle: handle, Address: address, Sent: time.Now()})
+		} else if err != nil {
+			return err
+		}
+		if time.Since(vr.Sent) < time.Duration(days)*24*time.Hour {
+			return nil
+		}
+		send = true
+		vr.Sent = time.Now()
+		return tx.Update(&vr)
+	})
+	return send, err
+}
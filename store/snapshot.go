@@ -0,0 +1,195 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/mjl-/bstore"
+
+	"github.com/mjl-/mox/mlog"
+	"github.com/mjl-/mox/mox-"
+)
+
+// Snapshot adds the account database, junk filter files if a junk filter is
+// configured, and the message and pack files referenced by the database to
+// archiver, with paths relative to the account directory. The account read lock
+// is held while writing the snapshot, so messages referenced by the snapshot of
+// the database cannot be removed while they are being added. Deliveries can
+// continue, they are not part of the snapshot.
+func (a *Account) Snapshot(ctx context.Context, log mlog.Log, archiver Archiver) error {
+	a.RLock()
+	defer a.RUnlock()
+
+	start := time.Now()
+
+	// Write database to a temporary file first, we need to know the size for the
+	// archiver.
+	addDB := func(db *bstore.DB, name string) error {
+		f, err := CreateMessageTemp(log, "account-snapshot-db")
+		if err != nil {
+			return fmt.Errorf("creating temporary file: %v", err)
+		}
+		defer CloseRemoveTempFile(log, f, "database snapshot")
+		err = db.Read(ctx, func(tx *bstore.Tx) error {
+			_, err := tx.WriteTo(f)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("writing database %s: %v", name, err)
+		}
+		if _, err := f.Seek(0, 0); err != nil {
+			return fmt.Errorf("seek in temporary file: %v", err)
+		}
+		return addFile(archiver, f, name, start)
+	}
+	addPath := func(p, name string) error {
+		f, err := os.Open(p)
+		if err != nil {
+			return fmt.Errorf("open %s: %v", name, err)
+		}
+		defer func() {
+			err := f.Close()
+			log.Check(err, "closing file after snapshot", slog.String("path", p))
+		}()
+		return addFile(archiver, f, name, start)
+	}
+
+	// Database snapshot and its messages. Message files are added from the same
+	// transaction, so they match the database.
+	dbf, err := CreateMessageTemp(log, "account-snapshot-db")
+	if err != nil {
+		return fmt.Errorf("creating temporary file: %v", err)
+	}
+	defer CloseRemoveTempFile(log, dbf, "database snapshot")
+	var msgIDs, packIDs []int64
+	err = a.DB.Read(ctx, func(tx *bstore.Tx) error {
+		err := bstore.QueryTx[Message](tx).FilterEqual("Expunged", false).ForEach(func(m Message) error {
+			// Packed messages are added with their pack file.
+			if m.PackID == 0 {
+				msgIDs = append(msgIDs, m.ID)
+			}
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("listing messages: %v", err)
+		}
+		err = bstore.QueryTx[Pack](tx).ForEach(func(p Pack) error {
+			packIDs = append(packIDs, p.ID)
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("listing packs: %v", err)
+		}
+		if _, err := tx.WriteTo(dbf); err != nil {
+			return fmt.Errorf("writing database: %v", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if _, err := dbf.Seek(0, 0); err != nil {
+		return fmt.Errorf("seek in temporary file: %v", err)
+	}
+	if err := addFile(archiver, dbf, "index.db", start); err != nil {
+		return err
+	}
+
+	if jf, _, err := a.OpenJunkFilter(ctx, log); err != nil {
+		if !errors.Is(err, ErrNoJunkFilter) {
+			return fmt.Errorf("open junk filter: %v", err)
+		}
+	} else {
+		err := addDB(jf.DB(), "junkfilter.db")
+		if err == nil {
+			err = addPath(filepath.Join(a.Dir, "junkfilter.bloom"), "junkfilter.bloom")
+		}
+		xerr := jf.CloseDiscard()
+		log.Check(xerr, "closing junk filter after snapshot")
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, id := range msgIDs {
+		mp := MessagePath(id)
+		if err := addPath(filepath.Join(a.Dir, "msg", mp), path.Join("msg", filepath.ToSlash(mp))); err != nil {
+			return err
+		}
+	}
+	for _, id := range packIDs {
+		name := path.Join("pack", strconv.FormatInt(id, 10))
+		if err := addPath(packPath(a.Dir, id), name); err != nil {
+			return err
+		}
+	}
+	log.Debug("account snapshot written",
+		slog.String("account", a.Name),
+		slog.Int("messages", len(msgIDs)),
+		slog.Int("packs", len(packIDs)),
+		slog.Duration("duration", time.Since(start)))
+	return nil
+}
+
+func addFile(archiver Archiver, f *os.File, name string, mtime time.Time) error {
+	fi, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("stat %s: %v", name, err)
+	}
+	w, err := archiver.Create(name, fi.Size(), mtime)
+	if err != nil {
+		return fmt.Errorf("adding %s to archive: %v", name, err)
+	}
+	if _, err := io.Copy(w, f); err != nil {
+		w.Close()
+		return fmt.Errorf("writing %s to archive: %v", name, err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("closing %s in archive: %v", name, err)
+	}
+	return nil
+}
+
+// ErrAccountOpen is returned by ReplaceAccountDir for accounts that are in use.
+var ErrAccountOpen = errors.New("account is in use")
+
+// ReplaceAccountDir makes dir the data directory of the account, e.g. when
+// restoring an account from a snapshot. Dir must be on the same file system as
+// the data directory. The account must not be open, ErrAccountOpen is returned
+// otherwise. An existing account data directory is moved to the tmp directory,
+// and its new path returned.
+func ReplaceAccountDir(log mlog.Log, name, dir string) (oldDir string, rerr error) {
+	openAccounts.Lock()
+	defer openAccounts.Unlock()
+	if _, ok := openAccounts.names[name]; ok {
+		return "", ErrAccountOpen
+	}
+
+	accDir := filepath.Join(mox.DataDirPath("accounts"), name)
+	if _, err := os.Stat(accDir); err == nil {
+		os.MkdirAll(mox.DataDirPath("tmp"), 0770)
+		oldDir = filepath.Join(mox.DataDirPath("tmp"), fmt.Sprintf("replacedaccount-%s-%s", name, time.Now().Format("20060102-150405")))
+		if err := os.Rename(accDir, oldDir); err != nil {
+			return "", fmt.Errorf("moving existing account data directory out of the way: %v", err)
+		}
+	} else if !os.IsNotExist(err) {
+		return "", fmt.Errorf("stat existing account data directory: %v", err)
+	}
+	os.MkdirAll(filepath.Dir(accDir), 0770)
+	if err := os.Rename(dir, accDir); err != nil {
+		if oldDir != "" {
+			xerr := os.Rename(oldDir, accDir)
+			log.Check(xerr, "moving existing account data directory back")
+		}
+		return "", fmt.Errorf("moving new account data directory into place: %v", err)
+	}
+	return oldDir, nil
+}
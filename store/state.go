@@ -6,9 +6,11 @@ import (
 )
 
 var (
-	register   = make(chan *Comm)
-	unregister = make(chan *Comm)
-	broadcast  = make(chan changeReq)
+	register         = make(chan *Comm)
+	unregister       = make(chan *Comm)
+	registerServer   = make(chan *ServerComm)
+	unregisterServer = make(chan *ServerComm)
+	broadcast        = make(chan changeReq)
 )
 
 type changeReq struct {
@@ -118,6 +120,7 @@ var switchboardBusy atomic.Bool
 // Switchboard distributes changes to accounts to interested listeners. See Comm and Change.
 func Switchboard() (stop func()) {
 	regs := map[*Account]map[*Comm]struct{}{}
+	serverRegs := map[*ServerComm]struct{}{}
 	done := make(chan struct{})
 
 	if !switchboardBusy.CompareAndSwap(false, true) {
@@ -139,6 +142,12 @@ func Switchboard() (stop func()) {
 					delete(regs, c.acc)
 				}
 
+			case c := <-registerServer:
+				serverRegs[c] = struct{}{}
+
+			case c := <-unregisterServer:
+				delete(serverRegs, c)
+
 			case chReq := <-broadcast:
 				acc := chReq.acc
 				for c := range regs[acc] {
@@ -157,6 +166,18 @@ func Switchboard() (stop func()) {
 					default:
 					}
 				}
+				// Server-wide listeners get all changes, including those from the broadcasting
+				// comm.
+				for c := range serverRegs {
+					c.Lock()
+					c.changes = append(c.changes, AccountChanges{acc.Name, chReq.changes})
+					c.Unlock()
+
+					select {
+					case c.Pending <- struct{}{}:
+					default:
+					}
+				}
 				chReq.done <- struct{}{}
 
 			case <-done:
@@ -229,3 +250,42 @@ func BroadcastChanges(acc *Account, ch []Change) {
 	broadcast <- changeReq{acc, nil, ch, done}
 	<-done
 }
+
+// AccountChanges holds changes for an account, as received by a ServerComm.
+type AccountChanges struct {
+	AccountName string
+	Changes     []Change
+}
+
+// ServerComm receives changes for all accounts, e.g. for streaming changes to
+// external consumers.
+type ServerComm struct {
+	Pending chan struct{} // Receives block until changes come in.
+
+	sync.Mutex
+	changes []AccountChanges
+}
+
+// RegisterServerComm starts a ServerComm. Unregister must be called.
+func RegisterServerComm() *ServerComm {
+	c := &ServerComm{
+		Pending: make(chan struct{}, 1), // Buffered so Switchboard can just do a non-blocking send.
+	}
+	registerServer <- c
+	return c
+}
+
+// Unregister stops this ServerComm.
+func (c *ServerComm) Unregister() {
+	unregisterServer <- c
+}
+
+// Get retrieves all pending changes. If no changes are pending a nil or empty list
+// is returned.
+func (c *ServerComm) Get() []AccountChanges {
+	c.Lock()
+	defer c.Unlock()
+	l := c.changes
+	c.changes = nil
+	return l
+}
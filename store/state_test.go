@@ -0,0 +1,44 @@
+package store
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mjl-/mox/mlog"
+	"github.com/mjl-/mox/mox-"
+)
+
+func TestServerComm(t *testing.T) {
+	log := mlog.New("store", nil)
+	os.RemoveAll("../testdata/store/data")
+	mox.ConfigStaticPath = filepath.FromSlash("../testdata/store/mox.conf")
+	mox.MustLoadConfig(true, false)
+	acc, err := OpenAccount(log, "mjl", false)
+	tcheck(t, err, "open account")
+	defer func() {
+		err = acc.Close()
+		tcheck(t, err, "closing account")
+		acc.CheckClosed()
+	}()
+	defer Switchboard()()
+
+	sc := RegisterServerComm()
+	defer sc.Unregister()
+	comm := RegisterComm(acc)
+	defer comm.Unregister()
+
+	// Changes broadcast by a comm are not sent back to that comm, but are sent to
+	// server-wide listeners.
+	ch := ChangeAddSubscription{Name: "Inbox"}
+	comm.Broadcast([]Change{ch})
+	<-sc.Pending
+	tcompare(t, sc.Get(), []AccountChanges{{"mjl", []Change{ch}}})
+	tcompare(t, len(comm.Get()), 0)
+
+	BroadcastChanges(acc, []Change{ch})
+	<-comm.Pending
+	tcompare(t, comm.Get(), []Change{ch})
+	<-sc.Pending
+	tcompare(t, sc.Get(), []AccountChanges{{"mjl", []Change{ch}}})
+}
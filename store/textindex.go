@@ -0,0 +1,247 @@
+package store
+
+// Messages can have a TextIndex record with the distinct words in the message,
+// used to quickly rule out messages when searching for text (IMAP SEARCH
+// TEXT/BODY, webmail search) without reading and parsing the message file. Words
+// are gathered from the same data that is searched: the headers of the message
+// and its (sub)parts, and the decoded text parts. Names of attachments are
+// included too. A word is a sequence of letters and digits, lower-cased. A search
+// string can only be present in a message if each of its words is a substring of
+// a word in the message. Messages without TextIndex record, e.g. delivered before
+// the index existed, or with too many words, are always searched by reading the
+// message. Records are added at delivery, removed at expunge, and can be rebuilt
+// with Account.TextIndexRebuild.
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/mjl-/bstore"
+
+	"github.com/mjl-/mox/message"
+	"github.com/mjl-/mox/mlog"
+)
+
+const (
+	// Maximum size of all words for a message. Messages with more are not indexed.
+	textIndexMaxSize = 256 * 1024
+
+	// Number of messages to index per database transaction during rebuild.
+	textIndexBatchSize = 100
+)
+
+var errTextIndexTooLarge = errors.New("too many words for text index")
+
+// TextIndex holds the distinct words of a message, for full-text search.
+type TextIndex struct {
+	ID    int64  // Same as Message.ID.
+	Words string // Lower-case words, newline-separated.
+}
+
+// textIndexWords returns the distinct words in the headers and text parts of p,
+// recursively, and in the names of attachments.
+func textIndexWords(p *message.Part) (string, error) {
+	words := map[string]struct{}{}
+	var size int
+
+	add := func(w string) error {
+		if _, ok := words[w]; ok {
+			return nil
+		}
+		size += len(w) + 1
+		if size > textIndexMaxSize {
+			return errTextIndexTooLarge
+		}
+		words[w] = struct{}{}
+		return nil
+	}
+
+	addReader := func(r io.Reader) error {
+		br := bufio.NewReader(r)
+		var b strings.Builder
+		for {
+			c, _, err := br.ReadRune()
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				return err
+			}
+			c = unicode.ToLower(c)
+			if unicode.IsLetter(c) || unicode.IsDigit(c) {
+				b.WriteRune(c)
+				continue
+			}
+			if b.Len() > 0 {
+				if err := add(b.String()); err != nil {
+					return err
+				}
+				b.Reset()
+			}
+		}
+		if b.Len() > 0 {
+			return add(b.String())
+		}
+		return nil
+	}
+
+	// Walk the parts like WordSearch.matchPart.
+	var walk func(p *message.Part) error
+	walk = func(p *message.Part) error {
+		if err := addReader(p.HeaderReader()); err != nil {
+			return err
+		}
+		if len(p.Parts) == 0 {
+			_, name, _ := p.DispositionFilename()
+			if err := addReader(strings.NewReader(name)); err != nil {
+				return err
+			}
+			if p.MediaType != "TEXT" {
+				return nil
+			}
+			return addReader(p.ReaderUTF8OrBinary())
+		}
+		for _, pp := range p.Parts {
+			if pp.Message != nil {
+				if err := pp.SetMessageReaderAt(); err != nil {
+					return err
+				}
+				pp = *pp.Message
+			}
+			if err := walk(&pp); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := walk(p); err != nil {
+		return "", err
+	}
+
+	l := make([]string, 0, len(words))
+	for w := range words {
+		l = append(l, w)
+	}
+	sort.Strings(l)
+	return strings.Join(l, "\n"), nil
+}
+
+// textIndexAdd adds a TextIndex record for message m with parsed part p, which
+// must have a reader. Messages that cannot be indexed, e.g. due to too many
+// words, don't get a record and are always searched fully. Only database errors
+// are returned.
+func textIndexAdd(log mlog.Log, tx *bstore.Tx, m *Message, p *message.Part) error {
+	words, err := textIndexWords(p)
+	if err != nil {
+		log.Debugx("gathering words for text index, not indexing message", err, slog.Int64("msgid", m.ID))
+		return nil
+	}
+	ti := TextIndex{ID: m.ID, Words: words}
+	if err := tx.Insert(&ti); err != nil {
+		return fmt.Errorf("inserting text index: %w", err)
+	}
+	return nil
+}
+
+// TextIndexRebuildStats is the result of Account.TextIndexRebuild.
+type TextIndexRebuildStats struct {
+	Indexed int // Messages with text index record.
+	Skipped int // Messages that could not be indexed and are searched fully.
+}
+
+// TextIndexRebuild removes all text index records and adds new records for all
+// messages. During the rebuild, messages without record are searched by reading
+// the message files.
+//
+// Must be called without holding the account lock.
+func (a *Account) TextIndexRebuild(ctx context.Context, log mlog.Log) (stats TextIndexRebuildStats, rerr error) {
+	var err error
+	a.WithWLock(func() {
+		err = a.DB.Write(ctx, func(tx *bstore.Tx) error {
+			_, err := bstore.QueryTx[TextIndex](tx).Delete()
+			return err
+		})
+	})
+	if err != nil {
+		return stats, fmt.Errorf("removing text index records: %v", err)
+	}
+
+	var lastID int64
+	for {
+		var msgs []Message
+		err := a.DB.Read(ctx, func(tx *bstore.Tx) error {
+			q := bstore.QueryTx[Message](tx)
+			q.FilterEqual("Expunged", false)
+			q.FilterGreater("ID", lastID)
+			q.SortAsc("ID")
+			q.Limit(textIndexBatchSize)
+			var err error
+			msgs, err = q.List()
+			return err
+		})
+		if err != nil {
+			return stats, fmt.Errorf("listing messages to index: %v", err)
+		}
+		if len(msgs) == 0 {
+			break
+		}
+		lastID = msgs[len(msgs)-1].ID
+
+		// Gather words without holding the account lock, then store the records.
+		records := make([]TextIndex, 0, len(msgs))
+		for _, m := range msgs {
+			if err := ctx.Err(); err != nil {
+				return stats, err
+			}
+			mr := a.MessageReader(m)
+			p, err := m.LoadPart(mr)
+			var words string
+			if err == nil {
+				words, err = textIndexWords(&p)
+			}
+			mr.Close()
+			if err != nil {
+				log.Debugx("gathering words for text index, not indexing message", err, slog.Int64("msgid", m.ID))
+				stats.Skipped++
+				continue
+			}
+			records = append(records, TextIndex{m.ID, words})
+		}
+
+		a.WithWLock(func() {
+			err = a.DB.Write(ctx, func(tx *bstore.Tx) error {
+				for _, ti := range records {
+					// Message may have been expunged in the mean time. If it was delivered in the mean
+					// time, it already has a record.
+					m := Message{ID: ti.ID}
+					if err := tx.Get(&m); err == bstore.ErrAbsent || err == nil && m.Expunged {
+						continue
+					} else if err != nil {
+						return fmt.Errorf("get message: %v", err)
+					}
+					if err := tx.Get(&TextIndex{ID: ti.ID}); err == nil {
+						stats.Indexed++
+						continue
+					} else if err != bstore.ErrAbsent {
+						return fmt.Errorf("get text index: %v", err)
+					}
+					if err := tx.Insert(&ti); err != nil {
+						return fmt.Errorf("inserting text index: %v", err)
+					}
+					stats.Indexed++
+				}
+				return nil
+			})
+		})
+		if err != nil {
+			return stats, err
+		}
+	}
+	return stats, nil
+}
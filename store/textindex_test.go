@@ -0,0 +1,109 @@
+package store
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mjl-/bstore"
+
+	"github.com/mjl-/mox/mox-"
+)
+
+func TestTextIndex(t *testing.T) {
+	log := pkglog
+	os.RemoveAll("../testdata/store/data")
+	mox.ConfigStaticPath = filepath.FromSlash("../testdata/store/mox.conf")
+	mox.MustLoadConfig(true, false)
+	acc, err := OpenAccount(log, "mjl", false)
+	tcheck(t, err, "open account")
+	defer func() {
+		err = acc.Close()
+		tcheck(t, err, "closing account")
+		acc.CheckClosed()
+	}()
+	defer Switchboard()()
+
+	const body = `From: <mjl@mox.example>
+Subject: Meeting notes
+MIME-Version: 1.0
+Content-Type: multipart/mixed; boundary=x
+
+--x
+Content-Type: text/plain; charset=utf-8
+Content-Transfer-Encoding: quoted-printable
+
+Caf=C3=A9 tomorrow at 10:30?
+--x
+Content-Type: application/pdf
+Content-Disposition: attachment; filename="Agenda.pdf"
+Content-Transfer-Encoding: base64
+
+aGlkZGVu
+--x--
+`
+	msgFile, err := CreateMessageTemp(log, "textindex-test")
+	tcheck(t, err, "temp message file")
+	defer CloseRemoveTempFile(log, msgFile, "test message")
+	_, err = msgFile.Write([]byte(strings.ReplaceAll(body, "\n", "\r\n")))
+	tcheck(t, err, "write message")
+	st, err := msgFile.Stat()
+	tcheck(t, err, "stat message file")
+	m := Message{Received: time.Now(), Size: st.Size()}
+	acc.WithWLock(func() {
+		err := acc.DeliverMailbox(log, "Inbox", &m, msgFile)
+		tcheck(t, err, "deliver")
+	})
+
+	ti := TextIndex{ID: m.ID}
+	err = acc.DB.Get(ctxbg, &ti)
+	tcheck(t, err, "get text index")
+	words := strings.Split(ti.Words, "\n")
+	for _, w := range []string{"meeting", "notes", "café", "10", "30", "agenda", "pdf", "mox"} {
+		if !slices.Contains(words, w) {
+			t.Fatalf("word %q not in text index %q", w, words)
+		}
+	}
+	// Data of attachments is not searched, so not indexed.
+	if slices.Contains(words, "hidden") {
+		t.Fatalf("attachment data in text index")
+	}
+
+	matchIndex := func(expect bool, words, notWords []string) {
+		t.Helper()
+		ws := PrepareWordSearch(words, notWords)
+		err := acc.DB.Read(ctxbg, func(tx *bstore.Tx) error {
+			match, err := ws.MatchIndex(tx, m.ID)
+			tcheck(t, err, "match index")
+			if match != expect {
+				t.Fatalf("match index for %q, not %q: got %v, expected %v", words, notWords, match, expect)
+			}
+			return nil
+		})
+		tcheck(t, err, "read")
+	}
+	matchIndex(true, []string{"MEET"}, nil)
+	matchIndex(true, []string{"ng not"}, nil)
+	matchIndex(true, []string{"at 10:30"}, nil)
+	matchIndex(true, []string{"meeting"}, []string{"bogus"})
+	matchIndex(false, []string{"bogus"}, nil)
+	matchIndex(false, []string{"meeting bogus"}, nil)
+	matchIndex(false, []string{"meeting", "bogus"}, nil)
+
+	// Rebuild results in the same record.
+	stats, err := acc.TextIndexRebuild(ctxbg, log)
+	tcheck(t, err, "rebuild text index")
+	tcompare(t, stats, TextIndexRebuildStats{Indexed: 1})
+	xti := TextIndex{ID: m.ID}
+	err = acc.DB.Get(ctxbg, &xti)
+	tcheck(t, err, "get text index")
+	tcompare(t, xti, ti)
+
+	// Messages without record may always match.
+	err = acc.DB.Delete(ctxbg, &ti)
+	tcheck(t, err, "remove text index")
+	matchIndex(true, []string{"bogus"}, nil)
+}
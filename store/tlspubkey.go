@@ -14,6 +14,7 @@ import (
 
 	"github.com/mjl-/bstore"
 
+	"github.com/mjl-/mox/mox-"
 	"github.com/mjl-/mox/smtp"
 )
 
@@ -90,6 +91,55 @@ func TLSPublicKeyGet(ctx context.Context, fingerprint string) (TLSPublicKey, err
 	return pubKey, err
 }
 
+// TLSPublicKeyFind looks up the tls public key for a client certificate chain,
+// with the leaf certificate first. Keys in the database are tried first, then
+// fingerprints in the TLSClientAuth account configurations. If clientCAs is not
+// nil and the chain verifies against it for client authentication, the
+// certificate subject is matched against TLSClientAuth subjects. Keys from the
+// configuration are returned with Name "config". If no key matches,
+// bstore.ErrAbsent is returned.
+func TLSPublicKeyFind(ctx context.Context, certs []*x509.Certificate, clientCAs *x509.CertPool) (TLSPublicKey, error) {
+	if len(certs) == 0 {
+		return TLSPublicKey{}, bstore.ErrAbsent
+	}
+	cert := certs[0]
+	buf := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	fp := base64.RawURLEncoding.EncodeToString(buf[:])
+	pubKey, err := TLSPublicKeyGet(ctx, fp)
+	if err != bstore.ErrAbsent {
+		return pubKey, err
+	}
+
+	var subject string
+	if clientCAs != nil {
+		intermediates := x509.NewCertPool()
+		for _, c := range certs[1:] {
+			intermediates.AddCert(c)
+		}
+		opts := x509.VerifyOptions{
+			Roots:         clientCAs,
+			Intermediates: intermediates,
+			KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		}
+		if _, err := cert.Verify(opts); err == nil {
+			subject = cert.Subject.String()
+		}
+	}
+	accName, ta, ok := mox.Conf.TLSClientAuth(fp, subject)
+	if !ok {
+		return TLSPublicKey{}, bstore.ErrAbsent
+	}
+	pubKey, err = ParseTLSPublicKeyCert(cert.Raw)
+	if err != nil {
+		return TLSPublicKey{}, err
+	}
+	pubKey.Name = "config"
+	pubKey.NoIMAPPreauth = ta.NoIMAPPreauth
+	pubKey.Account = accName
+	pubKey.LoginAddress = ta.LoginAddress
+	return pubKey, nil
+}
+
 // TLSPublicKeyAdd adds a new tls public key.
 //
 // Caller is responsible for checking the account and email address are valid.
@@ -0,0 +1,123 @@
+package store
+
+import (
+	"context"
+	"crypto/ed25519"
+	cryptorand "crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mjl-/bstore"
+
+	"github.com/mjl-/mox/config"
+	"github.com/mjl-/mox/mox-"
+)
+
+func TestTLSPublicKeyFind(t *testing.T) {
+	os.RemoveAll("../testdata/store/data")
+	mox.ConfigStaticPath = filepath.FromSlash("../testdata/store/mox.conf")
+	mox.MustLoadConfig(true, false)
+
+	xctx, xcancel := context.WithCancel(ctxbg)
+	err := Init(xctx)
+	tcheck(t, err, "store init")
+	xcancel()
+	<-writeLoginAttemptStopped
+	defer func() {
+		err := Close()
+		tcheck(t, err, "store close")
+	}()
+
+	makeCert := func(subject string, client bool, parent *x509.Certificate, parentKey ed25519.PrivateKey) (*x509.Certificate, ed25519.PrivateKey) {
+		t.Helper()
+		_, key, err := ed25519.GenerateKey(cryptorand.Reader)
+		tcheck(t, err, "generate key")
+		template := &x509.Certificate{
+			SerialNumber: big.NewInt(1),
+			Subject:      pkix.Name{CommonName: subject, Organization: []string{"Mox"}},
+			NotBefore:    time.Now().Add(-time.Minute),
+			NotAfter:     time.Now().Add(time.Hour),
+		}
+		if client {
+			template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
+		} else {
+			template.IsCA = true
+			template.BasicConstraintsValid = true
+			template.KeyUsage = x509.KeyUsageCertSign
+		}
+		if parent == nil {
+			parent, parentKey = template, key
+		}
+		buf, err := x509.CreateCertificate(cryptorand.Reader, template, parent, key.Public(), parentKey)
+		tcheck(t, err, "create certificate")
+		cert, err := x509.ParseCertificate(buf)
+		tcheck(t, err, "parse certificate")
+		return cert, key
+	}
+	fingerprint := func(cert *x509.Certificate) string {
+		buf := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+		return base64.RawURLEncoding.EncodeToString(buf[:])
+	}
+
+	caCert, caKey := makeCert("ca", false, nil, nil)
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(caCert)
+	signedCert, _ := makeCert("backup", true, caCert, caKey)
+	selfCert, _ := makeCert("backup", true, nil, nil)
+	dbCert, _ := makeCert("device", true, nil, nil)
+
+	accConf := mox.Conf.Dynamic.Accounts["mjl"]
+	accConf.TLSClientAuth = []config.TLSClientAuth{
+		{Fingerprint: fingerprint(selfCert), LoginAddress: "other@mox.example", NoIMAPPreauth: true},
+		{Subject: "CN=backup,O=Mox", LoginAddress: "mjl@mox.example"},
+	}
+	mox.Conf.Dynamic.Accounts["mjl"] = accConf
+
+	dbKey, err := ParseTLSPublicKeyCert(dbCert.Raw)
+	tcheck(t, err, "parse certificate")
+	dbKey.Account = "mjl"
+	dbKey.LoginAddress = "mjl@mox.example"
+	err = TLSPublicKeyAdd(ctxbg, &dbKey)
+	tcheck(t, err, "add tls public key")
+
+	test := func(certs []*x509.Certificate, clientCAs *x509.CertPool, expName, expAddress string, expNoPreauth bool) {
+		t.Helper()
+		pubKey, err := TLSPublicKeyFind(ctxbg, certs, clientCAs)
+		if expName == "" {
+			if err != bstore.ErrAbsent {
+				t.Fatalf("got err %v, expected ErrAbsent", err)
+			}
+			return
+		}
+		tcheck(t, err, "find tls public key")
+		tcompare(t, pubKey.Name, expName)
+		tcompare(t, pubKey.Account, "mjl")
+		tcompare(t, pubKey.LoginAddress, expAddress)
+		tcompare(t, pubKey.NoIMAPPreauth, expNoPreauth)
+		tcompare(t, pubKey.Fingerprint, fingerprint(certs[0]))
+	}
+
+	// Key from database.
+	test([]*x509.Certificate{dbCert}, clientCAs, "device", "mjl@mox.example", false)
+
+	// Fingerprint from config, also without CAs, and not verified against CAs.
+	test([]*x509.Certificate{selfCert}, nil, "config", "other@mox.example", true)
+	test([]*x509.Certificate{selfCert}, clientCAs, "config", "other@mox.example", true)
+
+	// Subject only matches for certificates signed by CA.
+	test([]*x509.Certificate{signedCert}, clientCAs, "config", "mjl@mox.example", false)
+	test([]*x509.Certificate{signedCert}, nil, "", "", false)
+	otherCert, _ := makeCert("backup", true, nil, nil)
+	test([]*x509.Certificate{otherCert}, clientCAs, "", "", false)
+
+	// Other subject does not match, and no certificate.
+	test([]*x509.Certificate{caCert}, clientCAs, "", "", false)
+	test(nil, clientCAs, "", "", false)
+}
@@ -0,0 +1,45 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/mjl-/bstore"
+)
+
+// trustedSenderAdd adds localpart and domain as trusted sender, or updates the
+// existing trusted sender for a message sent at time sent.
+func trustedSenderAdd(tx *bstore.Tx, localpart, domain string, sent time.Time) error {
+	q := bstore.QueryTx[TrustedSender](tx)
+	q.FilterEqual("Localpart", localpart)
+	q.FilterEqual("Domain", domain)
+	ts, err := q.Get()
+	if err == bstore.ErrAbsent {
+		ts = TrustedSender{Localpart: localpart, Domain: domain, LastSent: sent, Count: 1}
+		return tx.Insert(&ts)
+	} else if err != nil {
+		return fmt.Errorf("looking up trusted sender: %v", err)
+	}
+	if sent.After(ts.LastSent) {
+		ts.LastSent = sent
+	}
+	ts.Count++
+	return tx.Update(&ts)
+}
+
+// TrustedSenderList returns the trusted senders for account, most recently sent
+// to first.
+func (a *Account) TrustedSenderList(ctx context.Context) ([]TrustedSender, error) {
+	q := bstore.QueryDB[TrustedSender](ctx, a.DB)
+	q.SortDesc("LastSent")
+	return q.List()
+}
+
+// TrustedSenderRemove removes a trusted sender by ID. Messages from the domain of
+// the address may still be accepted based on reputation of the domain.
+func (a *Account) TrustedSenderRemove(ctx context.Context, id int64) error {
+	return a.DB.Write(ctx, func(tx *bstore.Tx) error {
+		return tx.Delete(&TrustedSender{ID: id})
+	})
+}
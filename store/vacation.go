@@ -0,0 +1,82 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/mjl-/bstore"
+
+	"github.com/mjl-/mox/sieve"
+)
+
+// ErrVacation is returned by VacationSave for invalid vacation settings.
+var ErrVacation = errors.New("invalid vacation")
+
+// Active returns whether responses are sent at time now.
+func (v Vacation) Active(now time.Time) bool {
+	return v.Enabled && (v.Start == nil || !now.Before(*v.Start)) && (v.End == nil || now.Before(*v.End))
+}
+
+// SieveVacation returns the vacation as sieve vacation action, for sending
+// responses, and tracking them per correspondent.
+func (v Vacation) SieveVacation() sieve.Vacation {
+	days := v.Days
+	if days <= 0 {
+		days = 7
+	}
+	// The handle changes when the vacation is modified, so correspondents get the
+	// updated response.
+	handle := fmt.Sprintf("vacation-%d-%d", v.ID, v.Updated.Unix())
+	return sieve.Vacation{Days: days, Subject: v.Subject, Handle: handle, Reason: v.Body}
+}
+
+// Vacations returns the vacations of the account, sorted by address.
+func (a *Account) Vacations(ctx context.Context) ([]Vacation, error) {
+	q := bstore.QueryDB[Vacation](ctx, a.DB)
+	q.SortAsc("Address")
+	return q.List()
+}
+
+// VacationGet returns the vacation for address, or nil if there is none.
+func (a *Account) VacationGet(ctx context.Context, address string) (*Vacation, error) {
+	q := bstore.QueryDB[Vacation](ctx, a.DB)
+	q.FilterNonzero(Vacation{Address: address})
+	v, err := q.Get()
+	if err == bstore.ErrAbsent {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+// VacationSave checks and saves the vacation, replacing an existing vacation for
+// the same address.
+func (a *Account) VacationSave(ctx context.Context, v Vacation) error {
+	if v.Address == "" {
+		return fmt.Errorf("%w: missing address", ErrVacation)
+	} else if v.Enabled && v.Body == "" {
+		return fmt.Errorf("%w: body required", ErrVacation)
+	} else if v.Start != nil && v.End != nil && !v.End.After(*v.Start) {
+		return fmt.Errorf("%w: end must be after start", ErrVacation)
+	} else if v.Days < 0 {
+		return fmt.Errorf("%w: days must be >= 0", ErrVacation)
+	}
+
+	return a.DB.Write(ctx, func(tx *bstore.Tx) error {
+		q := bstore.QueryTx[Vacation](tx)
+		q.FilterNonzero(Vacation{Address: v.Address})
+		ov, err := q.Get()
+		v.Updated = time.Now()
+		if err == bstore.ErrAbsent {
+			v.ID = 0
+			return tx.Insert(&v)
+		} else if err != nil {
+			return err
+		}
+		v.ID = ov.ID
+		return tx.Update(&v)
+	})
+}
@@ -9,6 +9,7 @@ import (
 
 	"github.com/mjl-/bstore"
 
+	"github.com/mjl-/mox/metrics"
 	"github.com/mjl-/mox/mlog"
 	"github.com/mjl-/mox/mox-"
 	"github.com/mjl-/mox/moxvar"
@@ -43,6 +44,11 @@ func Init() error {
 	return nil
 }
 
+func init() {
+	metrics.DatabaseSize("tlsrpt", func() string { return mox.DataDirPath("tlsrpt.db") })
+	metrics.DatabaseSize("tlsrptresult", func() string { return mox.DataDirPath("tlsrptresult.db") })
+}
+
 func openReportDB(ctx context.Context, log mlog.Log) (*bstore.DB, error) {
 	p := mox.DataDirPath("tlsrpt.db")
 	os.MkdirAll(filepath.Dir(p), 0770)
@@ -17,6 +17,8 @@ import (
 	"github.com/mjl-/bstore"
 
 	"github.com/mjl-/mox/dmarcdb"
+	"github.com/mjl-/mox/eventdb"
+	"github.com/mjl-/mox/greylist"
 	"github.com/mjl-/mox/junk"
 	"github.com/mjl-/mox/moxvar"
 	"github.com/mjl-/mox/mtastsdb"
@@ -228,6 +230,25 @@ possibly making them potentially no longer readable by the previous version.
 		accdir := filepath.Join(dataDir, "accounts", name)
 		checkDB(true, filepath.Join(accdir, "index.db"), store.DBTypes)
 
+		// Pack files are checked once, each message must fit in the pack file.
+		packSizes := map[string]int64{}
+		checkPackFile := func(dbpath, path string, end int64) {
+			size, ok := packSizes[path]
+			if !ok {
+				st, err := os.Stat(path)
+				checkf(err, path, "checking if pack file exists")
+				if err == nil {
+					size = st.Size()
+				} else {
+					size = -1
+				}
+				packSizes[path] = size
+			}
+			if size >= 0 && end > size {
+				checkf(fmt.Errorf("%s: message data ends at offset %d beyond pack file size %d", path, end, size), dbpath, "checking packed message")
+			}
+		}
+
 		jfdbpath := filepath.Join(accdir, "junkfilter.db")
 		jfbloompath := filepath.Join(accdir, "junkfilter.bloom")
 		if exists(jfdbpath) || exists(jfbloompath) {
@@ -287,10 +308,21 @@ possibly making them potentially no longer readable by the previous version.
 				}
 				totalSize += m.Size
 
-				mp := store.MessagePath(m.ID)
-				seen[mp] = struct{}{}
-				p := filepath.Join(accdir, "msg", mp)
-				checkFile(dbpath, p, len(m.MsgPrefix), m.Size)
+				if m.PackID != 0 {
+					checkPackFile(dbpath, filepath.Join(accdir, "pack", strconv.FormatInt(m.PackID, 10)), m.PackOffset+m.PackSize)
+				} else {
+					mp := store.MessagePath(m.ID)
+					seen[mp] = struct{}{}
+					p := filepath.Join(accdir, "msg", mp)
+					if m.CompressedSize > 0 {
+						// Compressed file has no prefix, its size is the compressed size.
+						checkFile(dbpath, p, 0, m.CompressedSize)
+					} else if m.Encrypted {
+						checkFile(dbpath, p, 0, store.EncryptedFileSize(m.Size-int64(len(m.MsgPrefix))))
+					} else {
+						checkFile(dbpath, p, len(m.MsgPrefix), m.Size)
+					}
+				}
 
 				if up.Threads != 2 {
 					return nil
@@ -422,9 +454,9 @@ possibly making them potentially no longer readable by the previous version.
 				p = p[len(dataDir)+1:]
 			}
 			switch p {
-			case "auth.db", "dmarcrpt.db", "dmarceval.db", "mtasts.db", "tlsrpt.db", "tlsrptresult.db", "receivedid.key", "lastknownversion":
+			case "auth.db", "dmarcrpt.db", "dmarceval.db", "mtasts.db", "tlsrpt.db", "tlsrptresult.db", "events.db", "greylist.db", "receivedid.key", "lastknownversion":
 				return nil
-			case "acme", "queue", "accounts", "tmp", "moved":
+			case "acme", "queue", "accounts", "tmp", "moved", "msgstore":
 				return fs.SkipDir
 			case "moxversion":
 				buf, err := os.ReadFile(dpath)
@@ -446,6 +478,8 @@ possibly making them potentially no longer readable by the previous version.
 	checkDB(true, filepath.Join(dataDir, "mtasts.db"), mtastsdb.DBTypes)
 	checkDB(true, filepath.Join(dataDir, "tlsrpt.db"), tlsrptdb.ReportDBTypes)
 	checkDB(false, filepath.Join(dataDir, "tlsrptresult.db"), tlsrptdb.ResultDBTypes) // After v0.0.7.
+	checkDB(false, filepath.Join(dataDir, "events.db"), eventdb.DBTypes)
+	checkDB(false, filepath.Join(dataDir, "greylist.db"), greylist.DBTypes)
 	checkQueue()
 	checkAccounts()
 	checkOther()
@@ -17,6 +17,7 @@ import (
 	"net/url"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"time"
 
@@ -236,7 +237,7 @@ func handle(apiHandler http.Handler, isForwarded bool, w http.ResponseWriter, r
 	// All other URLs, except the login endpoint require some authentication.
 	if r.URL.Path != "/api/LoginPrep" && r.URL.Path != "/api/Login" {
 		var ok bool
-		isExport := r.URL.Path == "/export"
+		isExport := r.URL.Path == "/export" || r.URL.Path == "/junkdecisions"
 		requireCSRF := isAPI || r.URL.Path == "/import" || isExport
 		accName, sessionToken, loginAddress, ok = webauth.Check(ctx, log, webauth.Accounts, "webaccount", isForwarded, w, r, isAPI, requireCSRF, isExport)
 		if !ok {
@@ -256,6 +257,9 @@ func handle(apiHandler http.Handler, isForwarded bool, w http.ResponseWriter, r
 	case "/export":
 		webops.Export(log, accName, w, r)
 
+	case "/junkdecisions":
+		webops.JunkDecisionsExport(log, accName, w, r)
+
 	case "/import":
 		if r.Method != "POST" {
 			http.Error(w, "405 - method not allowed - post required", http.StatusMethodNotAllowed)
@@ -276,6 +280,7 @@ func handle(apiHandler http.Handler, isForwarded bool, w http.ResponseWriter, r
 			log.Check(err, "closing form file")
 		}()
 		skipMailboxPrefix := r.FormValue("skipMailboxPrefix")
+		dedup := r.FormValue("dedup")
 		tmpf, err := os.CreateTemp("", "mox-import")
 		if err != nil {
 			http.Error(w, "500 - internal server error - "+err.Error(), http.StatusInternalServerError)
@@ -291,7 +296,7 @@ func handle(apiHandler http.Handler, isForwarded bool, w http.ResponseWriter, r
 			http.Error(w, "500 - internal server error - "+err.Error(), http.StatusInternalServerError)
 			return
 		}
-		token, isUserError, err := importStart(log, accName, tmpf, skipMailboxPrefix)
+		token, isUserError, err := importStart(log, accName, tmpf, skipMailboxPrefix, dedup)
 		if err != nil {
 			log.Errorx("starting import", err, slog.Bool("usererror", isUserError))
 			if isUserError {
@@ -374,7 +379,8 @@ func (w Account) Logout(ctx context.Context) {
 // Sessions are not interrupted, and will keep working. New login attempts must use
 // the new password.
 //
-// Password must be at least 8 characters.
+// Password must be at least 8 characters, and meet the password policy from the
+// configuration.
 //
 // Setting a user-supplied password is not allowed if NoCustomPassword is set
 // for the account.
@@ -383,6 +389,9 @@ func (Account) SetPassword(ctx context.Context, password string) {
 	if len(password) < 8 {
 		panic(&sherpa.Error{Code: "user:error", Message: "password must be at least 8 characters"})
 	}
+	if err := mox.CheckPassword(password); err != nil {
+		panic(&sherpa.Error{Code: "user:error", Message: err.Error()})
+	}
 
 	reqInfo := ctx.Value(requestInfoCtxKey).(requestInfo)
 	acc, err := store.OpenAccount(log, reqInfo.AccountName, false)
@@ -501,6 +510,8 @@ func (Account) DestinationSave(ctx context.Context, destName string, oldDest, ne
 		newDest.DMARCReports = curDest.DMARCReports
 		newDest.HostTLSReports = curDest.HostTLSReports
 		newDest.DomainTLSReports = curDest.DomainTLSReports
+		// Only admins can enable/disable addresses.
+		newDest.Disabled = curDest.Disabled
 
 		// Make copy of reference values.
 		nd := map[string]config.Destination{}
@@ -564,6 +575,168 @@ func (Account) SuppressionRemove(ctx context.Context, address string) {
 	xcheckf(ctx, err, "remove suppression")
 }
 
+// TrustedSenders returns the addresses this account has sent messages to, whose
+// messages are accepted without junk filtering.
+func (Account) TrustedSenders(ctx context.Context) (trustedSenders []store.TrustedSender) {
+	log := pkglog.WithContext(ctx)
+	reqInfo := ctx.Value(requestInfoCtxKey).(requestInfo)
+
+	acc, err := store.OpenAccount(log, reqInfo.AccountName, false)
+	xcheckf(ctx, err, "open account")
+	defer func() {
+		err := acc.Close()
+		log.Check(err, "closing account")
+	}()
+
+	l, err := acc.TrustedSenderList(ctx)
+	xcheckf(ctx, err, "list trusted senders")
+	return l
+}
+
+// TrustedSenderRemove removes a trusted sender by id. Future messages from the
+// address are subject to junk filtering again, unless it is added again by
+// sending a message to it.
+func (Account) TrustedSenderRemove(ctx context.Context, id int64) {
+	log := pkglog.WithContext(ctx)
+	reqInfo := ctx.Value(requestInfoCtxKey).(requestInfo)
+
+	acc, err := store.OpenAccount(log, reqInfo.AccountName, false)
+	xcheckf(ctx, err, "open account")
+	defer func() {
+		err := acc.Close()
+		log.Check(err, "closing account")
+	}()
+
+	err = acc.TrustedSenderRemove(ctx, id)
+	if err == bstore.ErrAbsent {
+		xcheckuserf(ctx, err, "remove trusted sender")
+	}
+	xcheckf(ctx, err, "remove trusted sender")
+}
+
+// JunkDecisions returns the most recent decisions about incoming messages, i.e.
+// whether they were accepted or rejected as junk, with the reputation, junk
+// filter and DNS block list inputs. For analyzing false positives/negatives. At
+// most limit decisions are returned, if greater than 0.
+func (Account) JunkDecisions(ctx context.Context, limit int) []store.JunkDecision {
+	log := pkglog.WithContext(ctx)
+	reqInfo := ctx.Value(requestInfoCtxKey).(requestInfo)
+
+	acc, err := store.OpenAccount(log, reqInfo.AccountName, false)
+	xcheckf(ctx, err, "open account")
+	defer func() {
+		err := acc.Close()
+		log.Check(err, "closing account")
+	}()
+
+	l, err := acc.JunkDecisions(ctx, time.Time{}, time.Time{}, limit)
+	xcheckf(ctx, err, "list junk decisions")
+	return l
+}
+
+// SieveScriptGet returns the active sieve script, evaluated for incoming
+// messages that don't match a ruleset. Empty if there is no active script.
+func (Account) SieveScriptGet(ctx context.Context) (script string) {
+	log := pkglog.WithContext(ctx)
+	reqInfo := ctx.Value(requestInfoCtxKey).(requestInfo)
+
+	acc, err := store.OpenAccount(log, reqInfo.AccountName, false)
+	xcheckf(ctx, err, "open account")
+	defer func() {
+		err := acc.Close()
+		log.Check(err, "closing account")
+	}()
+
+	ss, err := acc.SieveScriptActive(ctx)
+	xcheckf(ctx, err, "get active sieve script")
+	if ss == nil {
+		return ""
+	}
+	return ss.Script
+}
+
+// SieveScriptSave checks and saves the sieve script as the active script,
+// replacing the current active script, or creating a script named "default".
+func (Account) SieveScriptSave(ctx context.Context, script string) {
+	log := pkglog.WithContext(ctx)
+	reqInfo := ctx.Value(requestInfoCtxKey).(requestInfo)
+
+	acc, err := store.OpenAccount(log, reqInfo.AccountName, false)
+	xcheckf(ctx, err, "open account")
+	defer func() {
+		err := acc.Close()
+		log.Check(err, "closing account")
+	}()
+
+	name := "default"
+	ss, err := acc.SieveScriptActive(ctx)
+	xcheckf(ctx, err, "get active sieve script")
+	if ss != nil {
+		name = ss.Name
+	}
+	err = acc.SieveScriptSave(ctx, name, script, true)
+	if errors.Is(err, store.ErrSieveScript) {
+		xcheckuserf(ctx, err, "saving sieve script")
+	}
+	xcheckf(ctx, err, "saving sieve script")
+}
+
+// VacationGet returns the out-of-office auto-responder for the address of a
+// destination. If none was configured yet, a disabled vacation is returned.
+func (Account) VacationGet(ctx context.Context, address string) store.Vacation {
+	log := pkglog.WithContext(ctx)
+	reqInfo := ctx.Value(requestInfoCtxKey).(requestInfo)
+
+	acc, err := store.OpenAccount(log, reqInfo.AccountName, false)
+	xcheckf(ctx, err, "open account")
+	defer func() {
+		err := acc.Close()
+		log.Check(err, "closing account")
+	}()
+
+	xcheckDestination(ctx, acc, address)
+
+	v, err := acc.VacationGet(ctx, address)
+	xcheckf(ctx, err, "get vacation")
+	if v == nil {
+		return store.Vacation{Address: address, Days: 7}
+	}
+	return *v
+}
+
+// VacationSave saves the out-of-office auto-responder for the address of a
+// destination. While enabled, and between the optional start and end time,
+// incoming messages addressed to the destination get an automatic response, at
+// most once per number of days per correspondent. Messages from mailing lists and
+// automated messages don't get a response.
+func (Account) VacationSave(ctx context.Context, vacation store.Vacation) {
+	log := pkglog.WithContext(ctx)
+	reqInfo := ctx.Value(requestInfoCtxKey).(requestInfo)
+
+	acc, err := store.OpenAccount(log, reqInfo.AccountName, false)
+	xcheckf(ctx, err, "open account")
+	defer func() {
+		err := acc.Close()
+		log.Check(err, "closing account")
+	}()
+
+	xcheckDestination(ctx, acc, vacation.Address)
+
+	err = acc.VacationSave(ctx, vacation)
+	if errors.Is(err, store.ErrVacation) {
+		xcheckuserf(ctx, err, "saving vacation")
+	}
+	xcheckf(ctx, err, "saving vacation")
+}
+
+// xcheckDestination checks address is a destination of the account.
+func xcheckDestination(ctx context.Context, acc *store.Account, address string) {
+	conf, _ := acc.Conf()
+	if _, ok := conf.Destinations[address]; !ok {
+		xcheckuserf(ctx, errors.New("not found"), "looking up destination")
+	}
+}
+
 // OutgoingWebhookSave saves a new webhook url for outgoing deliveries. If url
 // is empty, the webhook is disabled. If authorization is non-empty it is used for
 // the Authorization header in HTTP requests. Events specifies the outgoing events
@@ -791,6 +964,54 @@ func (Account) TLSPublicKeyUpdate(ctx context.Context, pubKey store.TLSPublicKey
 	return nil
 }
 
+// OpenPGPKeys returns the OpenPGP keys the account publishes through the Web Key
+// Directory (WKD), and the addresses of the account for which keys can be
+// published.
+func (Account) OpenPGPKeys(ctx context.Context) (keys []store.OpenPGPKey, addresses []string) {
+	reqInfo := ctx.Value(requestInfoCtxKey).(requestInfo)
+	keys, err := store.OpenPGPKeyList(ctx, reqInfo.AccountName)
+	xcheckf(ctx, err, "listing openpgp keys")
+
+	accConf, _ := mox.Conf.Account(reqInfo.AccountName)
+	for name := range accConf.Destinations {
+		addr, err := smtp.ParseAddress(name)
+		if err == nil && store.OpenPGPKeyAllowed(reqInfo.AccountName, addr) == nil {
+			addresses = append(addresses, addr.String())
+		}
+	}
+	sort.Strings(addresses)
+	return keys, addresses
+}
+
+// OpenPGPKeySave publishes an OpenPGP public key, typically ASCII-armored, for an
+// address of the account, replacing a previously published key for the address.
+func (Account) OpenPGPKeySave(ctx context.Context, address, key string) store.OpenPGPKey {
+	reqInfo := ctx.Value(requestInfoCtxKey).(requestInfo)
+
+	k, err := store.ParseOpenPGPKey(address, []byte(key))
+	xcheckuserf(ctx, err, "parsing key")
+	addr, err := smtp.ParseAddress(address)
+	xcheckf(ctx, err, "parsing address")
+	err = store.OpenPGPKeyAllowed(reqInfo.AccountName, addr)
+	xcheckuserf(ctx, err, "checking if key can be published")
+
+	k.Account = reqInfo.AccountName
+	err = store.OpenPGPKeySave(ctx, &k)
+	xcheckf(ctx, err, "saving openpgp key")
+	return k
+}
+
+// OpenPGPKeyRemove stops publishing the OpenPGP key for an address of the
+// account.
+func (Account) OpenPGPKeyRemove(ctx context.Context, address string) {
+	reqInfo := ctx.Value(requestInfoCtxKey).(requestInfo)
+	err := store.OpenPGPKeyRemove(ctx, reqInfo.AccountName, address)
+	if err == bstore.ErrAbsent {
+		xcheckuserf(ctx, err, "removing openpgp key")
+	}
+	xcheckf(ctx, err, "removing openpgp key")
+}
+
 func (Account) LoginAttempts(ctx context.Context, limit int) []store.LoginAttempt {
 	reqInfo := ctx.Value(requestInfoCtxKey).(requestInfo)
 	l, err := store.LoginAttemptList(ctx, reqInfo.AccountName, limit)
@@ -265,40 +265,54 @@ var api;
 		AuthResult["AuthBadChannelBinding"] = "badchanbind";
 		AuthResult["AuthBadProtocol"] = "badprotocol";
 		AuthResult["AuthLoginDisabled"] = "logindisabled";
+		AuthResult["AuthClientDenied"] = "clientdenied";
 		AuthResult["AuthError"] = "error";
 		AuthResult["AuthAborted"] = "aborted";
 	})(AuthResult = api.AuthResult || (api.AuthResult = {}));
-	api.structTypes = { "Account": true, "Address": true, "AddressAlias": true, "Alias": true, "AliasAddress": true, "AutomaticJunkFlags": true, "Destination": true, "Domain": true, "ImportProgress": true, "Incoming": true, "IncomingMeta": true, "IncomingWebhook": true, "JunkFilter": true, "LoginAttempt": true, "NameAddress": true, "Outgoing": true, "OutgoingWebhook": true, "Route": true, "Ruleset": true, "Structure": true, "SubjectPass": true, "Suppression": true, "TLSPublicKey": true };
+	api.structTypes = { "Account": true, "Address": true, "AddressAlias": true, "Alias": true, "AliasAddress": true, "ArchiveTier": true, "AutoArchive": true, "AutomaticJunkFlags": true, "Destination": true, "Domain": true, "DuplicateWindow": true, "Forward": true, "ImportProgress": true, "Incoming": true, "IncomingMeta": true, "IncomingWebhook": true, "JunkDecision": true, "JunkFilter": true, "LoginAttempt": true, "MessageCompression": true, "MessageEncryption": true, "NameAddress": true, "OpenPGPKey": true, "Outgoing": true, "OutgoingWebhook": true, "Route": true, "Ruleset": true, "Structure": true, "SubjectPass": true, "SubmissionChecks": true, "Suppression": true, "TLSClientAuth": true, "TLSPublicKey": true, "TrustedSender": true, "Vacation": true, "WordScore": true };
 	api.stringsTypes = { "AuthResult": true, "CSRFToken": true, "Localpart": true, "OutgoingEvent": true };
 	api.intsTypes = {};
 	api.types = {
-		"Account": { "Name": "Account", "Docs": "", "Fields": [{ "Name": "OutgoingWebhook", "Docs": "", "Typewords": ["nullable", "OutgoingWebhook"] }, { "Name": "IncomingWebhook", "Docs": "", "Typewords": ["nullable", "IncomingWebhook"] }, { "Name": "FromIDLoginAddresses", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "KeepRetiredMessagePeriod", "Docs": "", "Typewords": ["int64"] }, { "Name": "KeepRetiredWebhookPeriod", "Docs": "", "Typewords": ["int64"] }, { "Name": "LoginDisabled", "Docs": "", "Typewords": ["string"] }, { "Name": "Domain", "Docs": "", "Typewords": ["string"] }, { "Name": "Description", "Docs": "", "Typewords": ["string"] }, { "Name": "FullName", "Docs": "", "Typewords": ["string"] }, { "Name": "Destinations", "Docs": "", "Typewords": ["{}", "Destination"] }, { "Name": "SubjectPass", "Docs": "", "Typewords": ["SubjectPass"] }, { "Name": "QuotaMessageSize", "Docs": "", "Typewords": ["int64"] }, { "Name": "RejectsMailbox", "Docs": "", "Typewords": ["string"] }, { "Name": "KeepRejects", "Docs": "", "Typewords": ["bool"] }, { "Name": "AutomaticJunkFlags", "Docs": "", "Typewords": ["AutomaticJunkFlags"] }, { "Name": "JunkFilter", "Docs": "", "Typewords": ["nullable", "JunkFilter"] }, { "Name": "MaxOutgoingMessagesPerDay", "Docs": "", "Typewords": ["int32"] }, { "Name": "MaxFirstTimeRecipientsPerDay", "Docs": "", "Typewords": ["int32"] }, { "Name": "NoFirstTimeSenderDelay", "Docs": "", "Typewords": ["bool"] }, { "Name": "NoCustomPassword", "Docs": "", "Typewords": ["bool"] }, { "Name": "Routes", "Docs": "", "Typewords": ["[]", "Route"] }, { "Name": "DNSDomain", "Docs": "", "Typewords": ["Domain"] }, { "Name": "Aliases", "Docs": "", "Typewords": ["[]", "AddressAlias"] }] },
+		"Account": { "Name": "Account", "Docs": "", "Fields": [{ "Name": "OutgoingWebhook", "Docs": "", "Typewords": ["nullable", "OutgoingWebhook"] }, { "Name": "IncomingWebhook", "Docs": "", "Typewords": ["nullable", "IncomingWebhook"] }, { "Name": "FromIDLoginAddresses", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "KeepRetiredMessagePeriod", "Docs": "", "Typewords": ["int64"] }, { "Name": "KeepRetiredWebhookPeriod", "Docs": "", "Typewords": ["int64"] }, { "Name": "LoginDisabled", "Docs": "", "Typewords": ["string"] }, { "Name": "Suspended", "Docs": "", "Typewords": ["string"] }, { "Name": "SuspendedReject", "Docs": "", "Typewords": ["bool"] }, { "Name": "LoginNetworks", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "Domain", "Docs": "", "Typewords": ["string"] }, { "Name": "Description", "Docs": "", "Typewords": ["string"] }, { "Name": "FullName", "Docs": "", "Typewords": ["string"] }, { "Name": "Template", "Docs": "", "Typewords": ["string"] }, { "Name": "Destinations", "Docs": "", "Typewords": ["{}", "Destination"] }, { "Name": "SubjectPass", "Docs": "", "Typewords": ["SubjectPass"] }, { "Name": "QuotaMessageSize", "Docs": "", "Typewords": ["int64"] }, { "Name": "MaxAppendSize", "Docs": "", "Typewords": ["int64"] }, { "Name": "MaxIMAPConnections", "Docs": "", "Typewords": ["int32"] }, { "Name": "RejectsMailbox", "Docs": "", "Typewords": ["string"] }, { "Name": "KeepRejects", "Docs": "", "Typewords": ["bool"] }, { "Name": "AutomaticJunkFlags", "Docs": "", "Typewords": ["AutomaticJunkFlags"] }, { "Name": "JunkFilter", "Docs": "", "Typewords": ["nullable", "JunkFilter"] }, { "Name": "MaxOutgoingMessagesPerDay", "Docs": "", "Typewords": ["int32"] }, { "Name": "MaxFirstTimeRecipientsPerDay", "Docs": "", "Typewords": ["int32"] }, { "Name": "NoFirstTimeSenderDelay", "Docs": "", "Typewords": ["bool"] }, { "Name": "DuplicateWindow", "Docs": "", "Typewords": ["nullable", "DuplicateWindow"] }, { "Name": "AutoArchive", "Docs": "", "Typewords": ["nullable", "AutoArchive"] }, { "Name": "ArchiveTier", "Docs": "", "Typewords": ["nullable", "ArchiveTier"] }, { "Name": "MessageCompression", "Docs": "", "Typewords": ["nullable", "MessageCompression"] }, { "Name": "MessageEncryption", "Docs": "", "Typewords": ["nullable", "MessageEncryption"] }, { "Name": "SubmissionChecks", "Docs": "", "Typewords": ["nullable", "SubmissionChecks"] }, { "Name": "TLSClientAuth", "Docs": "", "Typewords": ["[]", "TLSClientAuth"] }, { "Name": "NoCustomPassword", "Docs": "", "Typewords": ["bool"] }, { "Name": "Routes", "Docs": "", "Typewords": ["[]", "Route"] }, { "Name": "DNSDomain", "Docs": "", "Typewords": ["Domain"] }, { "Name": "Aliases", "Docs": "", "Typewords": ["[]", "AddressAlias"] }] },
 		"OutgoingWebhook": { "Name": "OutgoingWebhook", "Docs": "", "Fields": [{ "Name": "URL", "Docs": "", "Typewords": ["string"] }, { "Name": "Authorization", "Docs": "", "Typewords": ["string"] }, { "Name": "Events", "Docs": "", "Typewords": ["[]", "string"] }] },
 		"IncomingWebhook": { "Name": "IncomingWebhook", "Docs": "", "Fields": [{ "Name": "URL", "Docs": "", "Typewords": ["string"] }, { "Name": "Authorization", "Docs": "", "Typewords": ["string"] }] },
-		"Destination": { "Name": "Destination", "Docs": "", "Fields": [{ "Name": "Mailbox", "Docs": "", "Typewords": ["string"] }, { "Name": "Rulesets", "Docs": "", "Typewords": ["[]", "Ruleset"] }, { "Name": "SMTPError", "Docs": "", "Typewords": ["string"] }, { "Name": "MessageAuthRequiredSMTPError", "Docs": "", "Typewords": ["string"] }, { "Name": "FullName", "Docs": "", "Typewords": ["string"] }] },
-		"Ruleset": { "Name": "Ruleset", "Docs": "", "Fields": [{ "Name": "SMTPMailFromRegexp", "Docs": "", "Typewords": ["string"] }, { "Name": "MsgFromRegexp", "Docs": "", "Typewords": ["string"] }, { "Name": "VerifiedDomain", "Docs": "", "Typewords": ["string"] }, { "Name": "HeadersRegexp", "Docs": "", "Typewords": ["{}", "string"] }, { "Name": "IsForward", "Docs": "", "Typewords": ["bool"] }, { "Name": "ListAllowDomain", "Docs": "", "Typewords": ["string"] }, { "Name": "AcceptRejectsToMailbox", "Docs": "", "Typewords": ["string"] }, { "Name": "Mailbox", "Docs": "", "Typewords": ["string"] }, { "Name": "Comment", "Docs": "", "Typewords": ["string"] }, { "Name": "VerifiedDNSDomain", "Docs": "", "Typewords": ["Domain"] }, { "Name": "ListAllowDNSDomain", "Docs": "", "Typewords": ["Domain"] }] },
+		"Destination": { "Name": "Destination", "Docs": "", "Fields": [{ "Name": "Mailbox", "Docs": "", "Typewords": ["string"] }, { "Name": "Rulesets", "Docs": "", "Typewords": ["[]", "Ruleset"] }, { "Name": "SMTPError", "Docs": "", "Typewords": ["string"] }, { "Name": "MessageAuthRequiredSMTPError", "Docs": "", "Typewords": ["string"] }, { "Name": "FullName", "Docs": "", "Typewords": ["string"] }, { "Name": "Disabled", "Docs": "", "Typewords": ["bool"] }, { "Name": "DuplicateWindow", "Docs": "", "Typewords": ["nullable", "DuplicateWindow"] }, { "Name": "Forward", "Docs": "", "Typewords": ["nullable", "Forward"] }] },
+		"Ruleset": { "Name": "Ruleset", "Docs": "", "Fields": [{ "Name": "SMTPMailFromRegexp", "Docs": "", "Typewords": ["string"] }, { "Name": "MsgFromRegexp", "Docs": "", "Typewords": ["string"] }, { "Name": "MsgToRegexp", "Docs": "", "Typewords": ["string"] }, { "Name": "VerifiedDomain", "Docs": "", "Typewords": ["string"] }, { "Name": "HeadersRegexp", "Docs": "", "Typewords": ["{}", "string"] }, { "Name": "IsForward", "Docs": "", "Typewords": ["bool"] }, { "Name": "ListAllowDomain", "Docs": "", "Typewords": ["string"] }, { "Name": "AcceptRejectsToMailbox", "Docs": "", "Typewords": ["string"] }, { "Name": "Mailbox", "Docs": "", "Typewords": ["string"] }, { "Name": "Seen", "Docs": "", "Typewords": ["bool"] }, { "Name": "Keywords", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "ForwardTo", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "Discard", "Docs": "", "Typewords": ["bool"] }, { "Name": "Comment", "Docs": "", "Typewords": ["string"] }, { "Name": "VerifiedDNSDomain", "Docs": "", "Typewords": ["Domain"] }, { "Name": "ListAllowDNSDomain", "Docs": "", "Typewords": ["Domain"] }] },
 		"Domain": { "Name": "Domain", "Docs": "", "Fields": [{ "Name": "ASCII", "Docs": "", "Typewords": ["string"] }, { "Name": "Unicode", "Docs": "", "Typewords": ["string"] }] },
+		"DuplicateWindow": { "Name": "DuplicateWindow", "Docs": "", "Fields": [{ "Name": "Period", "Docs": "", "Typewords": ["int64"] }, { "Name": "Suppress", "Docs": "", "Typewords": ["bool"] }] },
+		"Forward": { "Name": "Forward", "Docs": "", "Fields": [{ "Name": "To", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "KeepCopy", "Docs": "", "Typewords": ["bool"] }, { "Name": "Disabled", "Docs": "", "Typewords": ["bool"] }] },
 		"SubjectPass": { "Name": "SubjectPass", "Docs": "", "Fields": [{ "Name": "Period", "Docs": "", "Typewords": ["int64"] }] },
 		"AutomaticJunkFlags": { "Name": "AutomaticJunkFlags", "Docs": "", "Fields": [{ "Name": "Enabled", "Docs": "", "Typewords": ["bool"] }, { "Name": "JunkMailboxRegexp", "Docs": "", "Typewords": ["string"] }, { "Name": "NeutralMailboxRegexp", "Docs": "", "Typewords": ["string"] }, { "Name": "NotJunkMailboxRegexp", "Docs": "", "Typewords": ["string"] }] },
 		"JunkFilter": { "Name": "JunkFilter", "Docs": "", "Fields": [{ "Name": "Threshold", "Docs": "", "Typewords": ["float64"] }, { "Name": "Onegrams", "Docs": "", "Typewords": ["bool"] }, { "Name": "Twograms", "Docs": "", "Typewords": ["bool"] }, { "Name": "Threegrams", "Docs": "", "Typewords": ["bool"] }, { "Name": "MaxPower", "Docs": "", "Typewords": ["float64"] }, { "Name": "TopWords", "Docs": "", "Typewords": ["int32"] }, { "Name": "IgnoreWords", "Docs": "", "Typewords": ["float64"] }, { "Name": "RareWords", "Docs": "", "Typewords": ["int32"] }] },
-		"Route": { "Name": "Route", "Docs": "", "Fields": [{ "Name": "FromDomain", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "ToDomain", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "MinimumAttempts", "Docs": "", "Typewords": ["int32"] }, { "Name": "Transport", "Docs": "", "Typewords": ["string"] }, { "Name": "FromDomainASCII", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "ToDomainASCII", "Docs": "", "Typewords": ["[]", "string"] }] },
+		"AutoArchive": { "Name": "AutoArchive", "Docs": "", "Fields": [{ "Name": "Age", "Docs": "", "Typewords": ["int64"] }, { "Name": "Mailboxes", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "Mailbox", "Docs": "", "Typewords": ["string"] }, { "Name": "SkipUnread", "Docs": "", "Typewords": ["bool"] }, { "Name": "SkipFlagged", "Docs": "", "Typewords": ["bool"] }] },
+		"ArchiveTier": { "Name": "ArchiveTier", "Docs": "", "Fields": [{ "Name": "Age", "Docs": "", "Typewords": ["int64"] }, { "Name": "MaxMessageSize", "Docs": "", "Typewords": ["int64"] }] },
+		"MessageCompression": { "Name": "MessageCompression", "Docs": "", "Fields": [{ "Name": "Disabled", "Docs": "", "Typewords": ["bool"] }, { "Name": "MinMessageSize", "Docs": "", "Typewords": ["int64"] }, { "Name": "MaxMessageSize", "Docs": "", "Typewords": ["int64"] }] },
+		"MessageEncryption": { "Name": "MessageEncryption", "Docs": "", "Fields": [{ "Name": "KeyWrap", "Docs": "", "Typewords": ["string"] }] },
+		"SubmissionChecks": { "Name": "SubmissionChecks", "Docs": "", "Fields": [{ "Name": "RequireTo", "Docs": "", "Typewords": ["bool"] }, { "Name": "RequireSubject", "Docs": "", "Typewords": ["bool"] }, { "Name": "MaxRecipients", "Docs": "", "Typewords": ["int32"] }, { "Name": "ConfirmRecipients", "Docs": "", "Typewords": ["int32"] }] },
+		"TLSClientAuth": { "Name": "TLSClientAuth", "Docs": "", "Fields": [{ "Name": "Fingerprint", "Docs": "", "Typewords": ["string"] }, { "Name": "Subject", "Docs": "", "Typewords": ["string"] }, { "Name": "LoginAddress", "Docs": "", "Typewords": ["string"] }, { "Name": "NoIMAPPreauth", "Docs": "", "Typewords": ["bool"] }] },
+		"Route": { "Name": "Route", "Docs": "", "Fields": [{ "Name": "FromDomain", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "ToDomain", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "MinimumAttempts", "Docs": "", "Typewords": ["int32"] }, { "Name": "Transport", "Docs": "", "Typewords": ["string"] }, { "Name": "Failover", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "FailoverErrors", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "FromDomainASCII", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "ToDomainASCII", "Docs": "", "Typewords": ["[]", "string"] }] },
 		"AddressAlias": { "Name": "AddressAlias", "Docs": "", "Fields": [{ "Name": "SubscriptionAddress", "Docs": "", "Typewords": ["string"] }, { "Name": "Alias", "Docs": "", "Typewords": ["Alias"] }, { "Name": "MemberAddresses", "Docs": "", "Typewords": ["[]", "string"] }] },
-		"Alias": { "Name": "Alias", "Docs": "", "Fields": [{ "Name": "Addresses", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "PostPublic", "Docs": "", "Typewords": ["bool"] }, { "Name": "ListMembers", "Docs": "", "Typewords": ["bool"] }, { "Name": "AllowMsgFrom", "Docs": "", "Typewords": ["bool"] }, { "Name": "LocalpartStr", "Docs": "", "Typewords": ["string"] }, { "Name": "Domain", "Docs": "", "Typewords": ["Domain"] }, { "Name": "ParsedAddresses", "Docs": "", "Typewords": ["[]", "AliasAddress"] }] },
+		"Alias": { "Name": "Alias", "Docs": "", "Fields": [{ "Name": "Addresses", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "PostPublic", "Docs": "", "Typewords": ["bool"] }, { "Name": "ListMembers", "Docs": "", "Typewords": ["bool"] }, { "Name": "AllowMsgFrom", "Docs": "", "Typewords": ["bool"] }, { "Name": "ListUnsubscribe", "Docs": "", "Typewords": ["bool"] }, { "Name": "LocalpartStr", "Docs": "", "Typewords": ["string"] }, { "Name": "Domain", "Docs": "", "Typewords": ["Domain"] }, { "Name": "ParsedAddresses", "Docs": "", "Typewords": ["[]", "AliasAddress"] }, { "Name": "RemoteAddresses", "Docs": "", "Typewords": ["[]", "Address"] }] },
 		"AliasAddress": { "Name": "AliasAddress", "Docs": "", "Fields": [{ "Name": "Address", "Docs": "", "Typewords": ["Address"] }, { "Name": "AccountName", "Docs": "", "Typewords": ["string"] }, { "Name": "Destination", "Docs": "", "Typewords": ["Destination"] }] },
 		"Address": { "Name": "Address", "Docs": "", "Fields": [{ "Name": "Localpart", "Docs": "", "Typewords": ["Localpart"] }, { "Name": "Domain", "Docs": "", "Typewords": ["Domain"] }] },
 		"Suppression": { "Name": "Suppression", "Docs": "", "Fields": [{ "Name": "ID", "Docs": "", "Typewords": ["int64"] }, { "Name": "Created", "Docs": "", "Typewords": ["timestamp"] }, { "Name": "Account", "Docs": "", "Typewords": ["string"] }, { "Name": "BaseAddress", "Docs": "", "Typewords": ["string"] }, { "Name": "OriginalAddress", "Docs": "", "Typewords": ["string"] }, { "Name": "Manual", "Docs": "", "Typewords": ["bool"] }, { "Name": "Reason", "Docs": "", "Typewords": ["string"] }] },
 		"ImportProgress": { "Name": "ImportProgress", "Docs": "", "Fields": [{ "Name": "Token", "Docs": "", "Typewords": ["string"] }] },
+		"TrustedSender": { "Name": "TrustedSender", "Docs": "", "Fields": [{ "Name": "ID", "Docs": "", "Typewords": ["int64"] }, { "Name": "Localpart", "Docs": "", "Typewords": ["string"] }, { "Name": "Domain", "Docs": "", "Typewords": ["string"] }, { "Name": "Created", "Docs": "", "Typewords": ["timestamp"] }, { "Name": "LastSent", "Docs": "", "Typewords": ["timestamp"] }, { "Name": "Count", "Docs": "", "Typewords": ["int32"] }] },
+		"JunkDecision": { "Name": "JunkDecision", "Docs": "", "Fields": [{ "Name": "ID", "Docs": "", "Typewords": ["int64"] }, { "Name": "Time", "Docs": "", "Typewords": ["timestamp"] }, { "Name": "MessageID", "Docs": "", "Typewords": ["string"] }, { "Name": "MailFrom", "Docs": "", "Typewords": ["string"] }, { "Name": "MsgFrom", "Docs": "", "Typewords": ["string"] }, { "Name": "Recipient", "Docs": "", "Typewords": ["string"] }, { "Name": "RemoteIP", "Docs": "", "Typewords": ["string"] }, { "Name": "Subject", "Docs": "", "Typewords": ["string"] }, { "Name": "Accept", "Docs": "", "Typewords": ["bool"] }, { "Name": "Mailbox", "Docs": "", "Typewords": ["string"] }, { "Name": "Reason", "Docs": "", "Typewords": ["string"] }, { "Name": "ReasonText", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "ReputationMethod", "Docs": "", "Typewords": ["string"] }, { "Name": "ReputationJunk", "Docs": "", "Typewords": ["nullable", "bool"] }, { "Name": "ReputationConclusive", "Docs": "", "Typewords": ["bool"] }, { "Name": "ContentAnalyzed", "Docs": "", "Typewords": ["bool"] }, { "Name": "Probability", "Docs": "", "Typewords": ["float64"] }, { "Name": "Significant", "Docs": "", "Typewords": ["bool"] }, { "Name": "Threshold", "Docs": "", "Typewords": ["float64"] }, { "Name": "HamWords", "Docs": "", "Typewords": ["[]", "WordScore"] }, { "Name": "SpamWords", "Docs": "", "Typewords": ["[]", "WordScore"] }, { "Name": "DNSBLZone", "Docs": "", "Typewords": ["string"] }] },
+		"WordScore": { "Name": "WordScore", "Docs": "", "Fields": [{ "Name": "Word", "Docs": "", "Typewords": ["string"] }, { "Name": "Score", "Docs": "", "Typewords": ["float64"] }] },
+		"Vacation": { "Name": "Vacation", "Docs": "", "Fields": [{ "Name": "ID", "Docs": "", "Typewords": ["int64"] }, { "Name": "Address", "Docs": "", "Typewords": ["string"] }, { "Name": "Enabled", "Docs": "", "Typewords": ["bool"] }, { "Name": "Start", "Docs": "", "Typewords": ["nullable", "timestamp"] }, { "Name": "End", "Docs": "", "Typewords": ["nullable", "timestamp"] }, { "Name": "Subject", "Docs": "", "Typewords": ["string"] }, { "Name": "Body", "Docs": "", "Typewords": ["string"] }, { "Name": "Days", "Docs": "", "Typewords": ["int32"] }, { "Name": "Updated", "Docs": "", "Typewords": ["timestamp"] }] },
 		"Outgoing": { "Name": "Outgoing", "Docs": "", "Fields": [{ "Name": "Version", "Docs": "", "Typewords": ["int32"] }, { "Name": "Event", "Docs": "", "Typewords": ["OutgoingEvent"] }, { "Name": "DSN", "Docs": "", "Typewords": ["bool"] }, { "Name": "Suppressing", "Docs": "", "Typewords": ["bool"] }, { "Name": "QueueMsgID", "Docs": "", "Typewords": ["int64"] }, { "Name": "FromID", "Docs": "", "Typewords": ["string"] }, { "Name": "MessageID", "Docs": "", "Typewords": ["string"] }, { "Name": "Subject", "Docs": "", "Typewords": ["string"] }, { "Name": "WebhookQueued", "Docs": "", "Typewords": ["timestamp"] }, { "Name": "SMTPCode", "Docs": "", "Typewords": ["int32"] }, { "Name": "SMTPEnhancedCode", "Docs": "", "Typewords": ["string"] }, { "Name": "Error", "Docs": "", "Typewords": ["string"] }, { "Name": "Extra", "Docs": "", "Typewords": ["{}", "string"] }] },
 		"Incoming": { "Name": "Incoming", "Docs": "", "Fields": [{ "Name": "Version", "Docs": "", "Typewords": ["int32"] }, { "Name": "From", "Docs": "", "Typewords": ["[]", "NameAddress"] }, { "Name": "To", "Docs": "", "Typewords": ["[]", "NameAddress"] }, { "Name": "CC", "Docs": "", "Typewords": ["[]", "NameAddress"] }, { "Name": "BCC", "Docs": "", "Typewords": ["[]", "NameAddress"] }, { "Name": "ReplyTo", "Docs": "", "Typewords": ["[]", "NameAddress"] }, { "Name": "Subject", "Docs": "", "Typewords": ["string"] }, { "Name": "MessageID", "Docs": "", "Typewords": ["string"] }, { "Name": "InReplyTo", "Docs": "", "Typewords": ["string"] }, { "Name": "References", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "Date", "Docs": "", "Typewords": ["nullable", "timestamp"] }, { "Name": "Text", "Docs": "", "Typewords": ["string"] }, { "Name": "HTML", "Docs": "", "Typewords": ["string"] }, { "Name": "Structure", "Docs": "", "Typewords": ["Structure"] }, { "Name": "Meta", "Docs": "", "Typewords": ["IncomingMeta"] }] },
 		"NameAddress": { "Name": "NameAddress", "Docs": "", "Fields": [{ "Name": "Name", "Docs": "", "Typewords": ["string"] }, { "Name": "Address", "Docs": "", "Typewords": ["string"] }] },
 		"Structure": { "Name": "Structure", "Docs": "", "Fields": [{ "Name": "ContentType", "Docs": "", "Typewords": ["string"] }, { "Name": "ContentTypeParams", "Docs": "", "Typewords": ["{}", "string"] }, { "Name": "ContentID", "Docs": "", "Typewords": ["string"] }, { "Name": "ContentDisposition", "Docs": "", "Typewords": ["string"] }, { "Name": "Filename", "Docs": "", "Typewords": ["string"] }, { "Name": "DecodedSize", "Docs": "", "Typewords": ["int64"] }, { "Name": "Parts", "Docs": "", "Typewords": ["[]", "Structure"] }] },
 		"IncomingMeta": { "Name": "IncomingMeta", "Docs": "", "Fields": [{ "Name": "MsgID", "Docs": "", "Typewords": ["int64"] }, { "Name": "MailFrom", "Docs": "", "Typewords": ["string"] }, { "Name": "MailFromValidated", "Docs": "", "Typewords": ["bool"] }, { "Name": "MsgFromValidated", "Docs": "", "Typewords": ["bool"] }, { "Name": "RcptTo", "Docs": "", "Typewords": ["string"] }, { "Name": "DKIMVerifiedDomains", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "RemoteIP", "Docs": "", "Typewords": ["string"] }, { "Name": "Received", "Docs": "", "Typewords": ["timestamp"] }, { "Name": "MailboxName", "Docs": "", "Typewords": ["string"] }, { "Name": "Automated", "Docs": "", "Typewords": ["bool"] }] },
 		"TLSPublicKey": { "Name": "TLSPublicKey", "Docs": "", "Fields": [{ "Name": "Fingerprint", "Docs": "", "Typewords": ["string"] }, { "Name": "Created", "Docs": "", "Typewords": ["timestamp"] }, { "Name": "Type", "Docs": "", "Typewords": ["string"] }, { "Name": "Name", "Docs": "", "Typewords": ["string"] }, { "Name": "NoIMAPPreauth", "Docs": "", "Typewords": ["bool"] }, { "Name": "CertDER", "Docs": "", "Typewords": ["nullable", "string"] }, { "Name": "Account", "Docs": "", "Typewords": ["string"] }, { "Name": "LoginAddress", "Docs": "", "Typewords": ["string"] }] },
+		"OpenPGPKey": { "Name": "OpenPGPKey", "Docs": "", "Fields": [{ "Name": "Address", "Docs": "", "Typewords": ["string"] }, { "Name": "Domain", "Docs": "", "Typewords": ["string"] }, { "Name": "WKDHash", "Docs": "", "Typewords": ["string"] }, { "Name": "Account", "Docs": "", "Typewords": ["string"] }, { "Name": "Fingerprint", "Docs": "", "Typewords": ["string"] }, { "Name": "Created", "Docs": "", "Typewords": ["timestamp"] }, { "Name": "Updated", "Docs": "", "Typewords": ["timestamp"] }, { "Name": "KeyData", "Docs": "", "Typewords": ["nullable", "string"] }] },
 		"LoginAttempt": { "Name": "LoginAttempt", "Docs": "", "Fields": [{ "Name": "Key", "Docs": "", "Typewords": ["nullable", "string"] }, { "Name": "Last", "Docs": "", "Typewords": ["timestamp"] }, { "Name": "First", "Docs": "", "Typewords": ["timestamp"] }, { "Name": "Count", "Docs": "", "Typewords": ["int64"] }, { "Name": "AccountName", "Docs": "", "Typewords": ["string"] }, { "Name": "LoginAddress", "Docs": "", "Typewords": ["string"] }, { "Name": "RemoteIP", "Docs": "", "Typewords": ["string"] }, { "Name": "LocalIP", "Docs": "", "Typewords": ["string"] }, { "Name": "TLS", "Docs": "", "Typewords": ["string"] }, { "Name": "TLSPubKeyFingerprint", "Docs": "", "Typewords": ["string"] }, { "Name": "Protocol", "Docs": "", "Typewords": ["string"] }, { "Name": "UserAgent", "Docs": "", "Typewords": ["string"] }, { "Name": "AuthMech", "Docs": "", "Typewords": ["string"] }, { "Name": "Result", "Docs": "", "Typewords": ["AuthResult"] }] },
 		"CSRFToken": { "Name": "CSRFToken", "Docs": "", "Values": null },
 		"Localpart": { "Name": "Localpart", "Docs": "", "Values": null },
 		"OutgoingEvent": { "Name": "OutgoingEvent", "Docs": "", "Values": [{ "Name": "EventDelivered", "Value": "delivered", "Docs": "" }, { "Name": "EventSuppressed", "Value": "suppressed", "Docs": "" }, { "Name": "EventDelayed", "Value": "delayed", "Docs": "" }, { "Name": "EventFailed", "Value": "failed", "Docs": "" }, { "Name": "EventRelayed", "Value": "relayed", "Docs": "" }, { "Name": "EventExpanded", "Value": "expanded", "Docs": "" }, { "Name": "EventCanceled", "Value": "canceled", "Docs": "" }, { "Name": "EventUnrecognized", "Value": "unrecognized", "Docs": "" }] },
-		"AuthResult": { "Name": "AuthResult", "Docs": "", "Values": [{ "Name": "AuthSuccess", "Value": "ok", "Docs": "" }, { "Name": "AuthBadUser", "Value": "baduser", "Docs": "" }, { "Name": "AuthBadPassword", "Value": "badpassword", "Docs": "" }, { "Name": "AuthBadCredentials", "Value": "badcreds", "Docs": "" }, { "Name": "AuthBadChannelBinding", "Value": "badchanbind", "Docs": "" }, { "Name": "AuthBadProtocol", "Value": "badprotocol", "Docs": "" }, { "Name": "AuthLoginDisabled", "Value": "logindisabled", "Docs": "" }, { "Name": "AuthError", "Value": "error", "Docs": "" }, { "Name": "AuthAborted", "Value": "aborted", "Docs": "" }] },
+		"AuthResult": { "Name": "AuthResult", "Docs": "", "Values": [{ "Name": "AuthSuccess", "Value": "ok", "Docs": "" }, { "Name": "AuthBadUser", "Value": "baduser", "Docs": "" }, { "Name": "AuthBadPassword", "Value": "badpassword", "Docs": "" }, { "Name": "AuthBadCredentials", "Value": "badcreds", "Docs": "" }, { "Name": "AuthBadChannelBinding", "Value": "badchanbind", "Docs": "" }, { "Name": "AuthBadProtocol", "Value": "badprotocol", "Docs": "" }, { "Name": "AuthLoginDisabled", "Value": "logindisabled", "Docs": "" }, { "Name": "AuthNetworkDenied", "Value": "networkdenied", "Docs": "" }, { "Name": "AuthClientDenied", "Value": "clientdenied", "Docs": "" }, { "Name": "AuthError", "Value": "error", "Docs": "" }, { "Name": "AuthAborted", "Value": "aborted", "Docs": "" }, { "Name": "AuthLockedOut", "Value": "lockedout", "Docs": "" }, { "Name": "AuthTooManyConns", "Value": "toomanyconns", "Docs": "" }] },
 	};
 	api.parser = {
 		Account: (v) => api.parse("Account", v),
@@ -307,9 +321,17 @@ var api;
 		Destination: (v) => api.parse("Destination", v),
 		Ruleset: (v) => api.parse("Ruleset", v),
 		Domain: (v) => api.parse("Domain", v),
+		DuplicateWindow: (v) => api.parse("DuplicateWindow", v),
+		Forward: (v) => api.parse("Forward", v),
 		SubjectPass: (v) => api.parse("SubjectPass", v),
 		AutomaticJunkFlags: (v) => api.parse("AutomaticJunkFlags", v),
 		JunkFilter: (v) => api.parse("JunkFilter", v),
+		AutoArchive: (v) => api.parse("AutoArchive", v),
+		ArchiveTier: (v) => api.parse("ArchiveTier", v),
+		MessageCompression: (v) => api.parse("MessageCompression", v),
+		MessageEncryption: (v) => api.parse("MessageEncryption", v),
+		SubmissionChecks: (v) => api.parse("SubmissionChecks", v),
+		TLSClientAuth: (v) => api.parse("TLSClientAuth", v),
 		Route: (v) => api.parse("Route", v),
 		AddressAlias: (v) => api.parse("AddressAlias", v),
 		Alias: (v) => api.parse("Alias", v),
@@ -317,12 +339,17 @@ var api;
 		Address: (v) => api.parse("Address", v),
 		Suppression: (v) => api.parse("Suppression", v),
 		ImportProgress: (v) => api.parse("ImportProgress", v),
+		TrustedSender: (v) => api.parse("TrustedSender", v),
+		JunkDecision: (v) => api.parse("JunkDecision", v),
+		WordScore: (v) => api.parse("WordScore", v),
+		Vacation: (v) => api.parse("Vacation", v),
 		Outgoing: (v) => api.parse("Outgoing", v),
 		Incoming: (v) => api.parse("Incoming", v),
 		NameAddress: (v) => api.parse("NameAddress", v),
 		Structure: (v) => api.parse("Structure", v),
 		IncomingMeta: (v) => api.parse("IncomingMeta", v),
 		TLSPublicKey: (v) => api.parse("TLSPublicKey", v),
+		OpenPGPKey: (v) => api.parse("OpenPGPKey", v),
 		LoginAttempt: (v) => api.parse("LoginAttempt", v),
 		CSRFToken: (v) => api.parse("CSRFToken", v),
 		Localpart: (v) => api.parse("Localpart", v),
@@ -386,7 +413,8 @@ var api;
 		// Sessions are not interrupted, and will keep working. New login attempts must use
 		// the new password.
 		// 
-		// Password must be at least 8 characters.
+		// Password must be at least 8 characters, and meet the password policy from the
+		// configuration.
 		// 
 		// Setting a user-supplied password is not allowed if NoCustomPassword is set
 		// for the account.
@@ -476,6 +504,54 @@ var api;
 			const params = [address];
 			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
 		}
+		// TrustedSenders returns the addresses this account has sent messages to, whose
+		// messages are accepted without junk filtering.
+		async TrustedSenders() {
+			const fn = "TrustedSenders";
+			const paramTypes = [];
+			const returnTypes = [["[]", "TrustedSender"]];
+			const params = [];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
+		// TrustedSenderRemove removes a trusted sender by id. Future messages from the
+		// address are subject to junk filtering again, unless it is added again by
+		// sending a message to it.
+		async TrustedSenderRemove(id) {
+			const fn = "TrustedSenderRemove";
+			const paramTypes = [["int64"]];
+			const returnTypes = [];
+			const params = [id];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
+		// JunkDecisions returns the most recent decisions about incoming messages, i.e.
+		// whether they were accepted or rejected as junk, with the reputation, junk
+		// filter and DNS block list inputs. For analyzing false positives/negatives. At
+		// most limit decisions are returned, if greater than 0.
+		async JunkDecisions(limit) {
+			const fn = "JunkDecisions";
+			const paramTypes = [["int32"]];
+			const returnTypes = [["[]", "JunkDecision"]];
+			const params = [limit];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
+		// SieveScriptGet returns the active sieve script, evaluated for incoming
+		// messages that don't match a ruleset. Empty if there is no active script.
+		async SieveScriptGet() {
+			const fn = "SieveScriptGet";
+			const paramTypes = [];
+			const returnTypes = [["string"]];
+			const params = [];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
+		// SieveScriptSave checks and saves the sieve script as the active script,
+		// replacing the current active script, or creating a script named "default".
+		async SieveScriptSave(script) {
+			const fn = "SieveScriptSave";
+			const paramTypes = [["string"]];
+			const returnTypes = [];
+			const params = [script];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
 		// OutgoingWebhookSave saves a new webhook url for outgoing deliveries. If url
 		// is empty, the webhook is disabled. If authorization is non-empty it is used for
 		// the Authorization header in HTTP requests. Events specifies the outgoing events
@@ -588,6 +664,34 @@ var api;
 			const params = [pubKey];
 			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
 		}
+		// OpenPGPKeys returns the OpenPGP keys the account publishes through the Web Key
+		// Directory (WKD), and the addresses of the account for which keys can be
+		// published.
+		async OpenPGPKeys() {
+			const fn = "OpenPGPKeys";
+			const paramTypes = [];
+			const returnTypes = [["[]", "OpenPGPKey"], ["[]", "string"]];
+			const params = [];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
+		// OpenPGPKeySave publishes an OpenPGP public key, typically ASCII-armored, for an
+		// address of the account, replacing a previously published key for the address.
+		async OpenPGPKeySave(address, key) {
+			const fn = "OpenPGPKeySave";
+			const paramTypes = [["string"], ["string"]];
+			const returnTypes = [["OpenPGPKey"]];
+			const params = [address, key];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
+		// OpenPGPKeyRemove stops publishing the OpenPGP key for an address of the
+		// account.
+		async OpenPGPKeyRemove(address) {
+			const fn = "OpenPGPKeyRemove";
+			const paramTypes = [["string"]];
+			const returnTypes = [];
+			const params = [address];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
 		async LoginAttempts(limit) {
 			const fn = "LoginAttempts";
 			const paramTypes = [["int32"]];
@@ -1162,12 +1266,18 @@ const formatQuotaSize = (v) => {
 	return '' + v;
 };
 const index = async () => {
-	const [[acc, storageUsed, storageLimit, suppressions], tlspubkeys0, recentLoginAttempts] = await Promise.all([
+	const [[acc, storageUsed, storageLimit, suppressions], tlspubkeys0, recentLoginAttempts, trustedSenders0, sieveScript0, [openpgpKeys0, openpgpAddresses0]] = await Promise.all([
 		client.Account(),
 		client.TLSPublicKeys(),
 		client.LoginAttempts(10),
+		client.TrustedSenders(),
+		client.SieveScriptGet(),
+		client.OpenPGPKeys(),
 	]);
 	const tlspubkeys = tlspubkeys0 || [];
+	const trustedSenders = trustedSenders0 || [];
+	const openpgpKeys = openpgpKeys0 || [];
+	const openpgpAddresses = openpgpAddresses0 || [];
 	let fullNameForm;
 	let fullNameFieldset;
 	let fullName;
@@ -1176,6 +1286,9 @@ const index = async () => {
 	let password1;
 	let password2;
 	let passwordHint;
+	let openpgpKeyFieldset;
+	let openpgpAddress;
+	let openpgpKey;
 	let autoJunkFlagsFieldset;
 	let autoJunkFlagsEnabled;
 	let junkMailboxRegexp;
@@ -1193,6 +1306,8 @@ const index = async () => {
 	let rejectsFieldset;
 	let rejectsMailbox;
 	let keepRejects;
+	let sieveFieldset;
+	let sieveScript;
 	let outgoingWebhookFieldset;
 	let outgoingWebhookURL;
 	let outgoingWebhookAuthorization;
@@ -1261,6 +1376,7 @@ const index = async () => {
 	let importFieldset;
 	let mailboxFileHint;
 	let mailboxPrefixHint;
+	let dedupHint;
 	let importProgress;
 	let importAbortBox;
 	let suppressionAddress;
@@ -1319,8 +1435,9 @@ const index = async () => {
 				importProgress.appendChild(dom.div(dom.br(), box(blue, 'Step: ' + data.Title)));
 			});
 			eventSource.addEventListener('done', (e) => {
-				console.log('import done event', { e });
-				importProgress.appendChild(dom.div(dom.br(), box(blue, 'Import finished')));
+				const data = JSON.parse(e.data); // {Skipped: ...}
+				console.log('import done event', { e, data });
+				importProgress.appendChild(dom.div(dom.br(), box(blue, 'Import finished' + (data.Skipped ? ', ' + data.Skipped + ' duplicate message' + (data.Skipped === 1 ? '' : 's') + ' skipped' : ''))));
 				eventSource.close();
 				dom._kids(importConnection);
 				dom._kids(importAbortBox);
@@ -1643,7 +1760,11 @@ openssl pkcs12 \\
 		e.preventDefault();
 		e.stopPropagation();
 		await check(rejectsFieldset, client.RejectsSave(rejectsMailbox.value, keepRejects.checked));
-	}, rejectsFieldset = dom.fieldset(dom.div(style({ display: 'flex', gap: '1em' }), dom.label('Mailbox', attr.title("Mail that looks like spam will be rejected, but a copy can be stored temporarily in a mailbox, e.g. Rejects. If mail isn't coming in when you expect, you can look there. The mail still isn't accepted, so the remote mail server may retry (hopefully, if legitimate), or give up (hopefully, if indeed a spammer). Messages are automatically removed from this mailbox, so do not set it to a mailbox that has messages you want to keep."), dom.div(rejectsMailbox = dom.input(attr.value(acc.RejectsMailbox)))), dom.label("No cleanup", attr.title("Don't automatically delete mail in the RejectsMailbox listed above. This can be useful, e.g. for future spam training. It can also cause storage to fill up."), dom.div(keepRejects = dom.input(attr.type('checkbox'), acc.KeepRejects ? attr.checked('') : []))), dom.div(dom.span('\u00a0'), dom.div(dom.submitbutton('Save')))))), dom.br(), dom.h2('Webhooks'), dom.h3('Outgoing', attr.title('Webhooks for outgoing messages are called for each attempt to deliver a message in the outgoing queue, e.g. when the queue has delivered a message to the next hop, when a single attempt failed with a temporary error, when delivery permanently failed, or when DSN (delivery status notification) messages were received about a previously sent message.')), dom.form(async function submit(e) {
+	}, rejectsFieldset = dom.fieldset(dom.div(style({ display: 'flex', gap: '1em' }), dom.label('Mailbox', attr.title("Mail that looks like spam will be rejected, but a copy can be stored temporarily in a mailbox, e.g. Rejects. If mail isn't coming in when you expect, you can look there. The mail still isn't accepted, so the remote mail server may retry (hopefully, if legitimate), or give up (hopefully, if indeed a spammer). Messages are automatically removed from this mailbox, so do not set it to a mailbox that has messages you want to keep."), dom.div(rejectsMailbox = dom.input(attr.value(acc.RejectsMailbox)))), dom.label("No cleanup", attr.title("Don't automatically delete mail in the RejectsMailbox listed above. This can be useful, e.g. for future spam training. It can also cause storage to fill up."), dom.div(keepRejects = dom.input(attr.type('checkbox'), acc.KeepRejects ? attr.checked('') : []))), dom.div(dom.span('\u00a0'), dom.div(dom.submitbutton('Save')))))), dom.br(), dom.h2('Sieve script'), dom.p('A sieve script is evaluated for incoming messages that do not match a ruleset of the destination address. It can file messages into mailboxes, redirect or discard them, send vacation responses, and send notifications with the "enotify" extension, through mailto: URIs, and, if enabled by the admin, http(s):// webhooks, ntfy:// or gotify:// URIs. Clear the script to disable it.'), dom.form(async function submit(e) {
+		e.preventDefault();
+		e.stopPropagation();
+		await check(sieveFieldset, client.SieveScriptSave(sieveScript.value));
+	}, sieveFieldset = dom.fieldset(dom.div(sieveScript = dom.textarea(sieveScript0, attr.rows('10'), style({ width: '100%', fontFamily: 'monospace' }), attr.placeholder('require ["fileinto", "vacation"];\nif header :contains "list-id" "example.org" { fileinto "Lists"; }\nvacation :days 7 "I am away until next week.";'))), dom.br(), dom.div(dom.submitbutton('Save')))), dom.br(), dom.h2('Webhooks'), dom.h3('Outgoing', attr.title('Webhooks for outgoing messages are called for each attempt to deliver a message in the outgoing queue, e.g. when the queue has delivered a message to the next hop, when a single attempt failed with a temporary error, when delivery permanently failed, or when DSN (delivery status notification) messages were received about a previously sent message.')), dom.form(async function submit(e) {
 		e.preventDefault();
 		e.stopPropagation();
 		await check(outgoingWebhookFieldset, client.OutgoingWebhookSave(outgoingWebhookURL.value, outgoingWebhookAuthorization.value, [...outgoingWebhookEvents.selectedOptions].map(o => o.value)));
@@ -1703,7 +1824,18 @@ openssl pkcs12 \\
 	}), dom.table(dom.thead(dom.tr(dom.th('Address', attr.title('Address that caused this entry to be added to the list. The title (shown on hover) displays an address with a fictional simplified localpart, with lower-cased, dots removed, only first part before "+" or "-" (typicaly catchall separators). When checking if an address is on the suppression list, it is checked against this address.')), dom.th('Manual', attr.title('Whether suppression was added manually, instead of automatically based on bounces.')), dom.th('Reason'), dom.th('Since'), dom.th('Action'))), dom.tbody((suppressions || []).length === 0 ? dom.tr(dom.td(attr.colspan('5'), '(None)')) : [], (suppressions || []).map(s => dom.tr(dom.td(prewrap(s.OriginalAddress), attr.title(s.BaseAddress)), dom.td(s.Manual ? '✓' : ''), dom.td(s.Reason), dom.td(age(s.Created)), dom.td(dom.clickbutton('Remove', async function click(e) {
 		await check(e.target, client.SuppressionRemove(s.OriginalAddress));
 		window.location.reload(); // todo: reload less
-	}))))), dom.tfoot(dom.tr(dom.td(suppressionAddress = dom.input(attr.type('required'), attr.form('suppressionAdd'))), dom.td(), dom.td(suppressionReason = dom.input(style({ width: '100%' }), attr.form('suppressionAdd'))), dom.td(), dom.td(dom.submitbutton('Add suppression', attr.form('suppressionAdd')))))), dom.br(), dom.h2('Export'), dom.p('Export all messages in all mailboxes.'), dom.form(attr.target('_blank'), attr.method('POST'), attr.action('export'), dom.input(attr.type('hidden'), attr.name('csrf'), attr.value(localStorageGet('webaccountcsrftoken') || '')), dom.input(attr.type('hidden'), attr.name('mailbox'), attr.value('')), dom.input(attr.type('hidden'), attr.name('recursive'), attr.value('on')), dom.div(style({ display: 'flex', flexDirection: 'column', gap: '.5ex' }), dom.div(dom.label(dom.input(attr.type('radio'), attr.name('format'), attr.value('maildir'), attr.checked('')), ' Maildir'), ' ', dom.label(dom.input(attr.type('radio'), attr.name('format'), attr.value('mbox')), ' Mbox')), dom.div(dom.label(dom.input(attr.type('radio'), attr.name('archive'), attr.value('tar')), ' Tar'), ' ', dom.label(dom.input(attr.type('radio'), attr.name('archive'), attr.value('tgz'), attr.checked('')), ' Tgz'), ' ', dom.label(dom.input(attr.type('radio'), attr.name('archive'), attr.value('zip')), ' Zip'), ' '), dom.div(style({ marginTop: '1ex' }), dom.submitbutton('Export')))), dom.br(), dom.h2('Import'), dom.p('Import messages from a .zip or .tgz file with maildirs and/or mbox files.'), importForm = dom.form(async function submit(e) {
+	}))))), dom.tfoot(dom.tr(dom.td(suppressionAddress = dom.input(attr.type('required'), attr.form('suppressionAdd'))), dom.td(), dom.td(suppressionReason = dom.input(style({ width: '100%' }), attr.form('suppressionAdd'))), dom.td(), dom.td(dom.submitbutton('Add suppression', attr.form('suppressionAdd')))))), dom.br(), dom.h2('Trusted senders'), dom.p('Addresses you have sent messages to are trusted senders. Incoming messages from trusted senders are accepted without junk filtering and without a subjectpass challenge. Remove an address to make its messages subject to junk filtering again.'), dom.table(dom.thead(dom.tr(dom.th('Address'), dom.th('Messages', attr.title('Number of sent messages with this address as recipient.')), dom.th('Last sent'), dom.th('Since'), dom.th('Action'))), dom.tbody(trustedSenders.length === 0 ? dom.tr(dom.td(attr.colspan('5'), '(None)')) : [], trustedSenders.map(ts => dom.tr(dom.td(prewrap(ts.Localpart + '@' + ts.Domain)), dom.td('' + ts.Count), dom.td(age(ts.LastSent)), dom.td(age(ts.Created)), dom.td(dom.clickbutton('Remove', async function click(e) {
+		await check(e.target, client.TrustedSenderRemove(ts.ID));
+		window.location.reload(); // todo: reload less
+	})))))), dom.br(), dom.h2('OpenPGP keys'), dom.p('Publish your OpenPGP public keys through the Web Key Directory (WKD), so mail clients of the people you correspond with can find them automatically, for encrypting messages they send to you. Keys can only be published for addresses in domains for which WKD is enabled by the administrator.'), dom.table(dom.thead(dom.tr(dom.th('Address'), dom.th('Fingerprint'), dom.th('Updated'), dom.th('Action'))), dom.tbody(openpgpKeys.length === 0 ? dom.tr(dom.td(attr.colspan('4'), '(None)')) : [], openpgpKeys.map(k => dom.tr(dom.td(k.Address), dom.td(style({ fontFamily: 'monospace' }), k.Fingerprint), dom.td(age(k.Updated)), dom.td(dom.clickbutton('Remove', async function click(e) {
+		await check(e.target, client.OpenPGPKeyRemove(k.Address));
+		window.location.reload(); // todo: reload less
+	})))))), openpgpAddresses.length === 0 ? [] : dom.form(async function submit(e) {
+		e.preventDefault();
+		e.stopPropagation();
+		await check(openpgpKeyFieldset, client.OpenPGPKeySave(openpgpAddress.value, openpgpKey.value));
+		window.location.reload(); // todo: reload less
+	}, openpgpKeyFieldset = dom.fieldset(dom.div(style({ display: 'flex', flexDirection: 'column', gap: '.5ex' }), dom.label(dom.div('Address'), openpgpAddress = dom.select(openpgpAddresses.map(a => dom.option(a)))), dom.label(dom.div('Public key', attr.title('ASCII-armored, e.g. from "gpg --export --armor <address>". The key must have a user ID with the address. A key published earlier for the address is replaced.')), openpgpKey = dom.textarea(attr.required(''), attr.rows('8'), style({ width: '100%', fontFamily: 'monospace' }))), dom.div(dom.submitbutton('Publish key'))))), dom.br(), dom.h2('Export'), dom.p('Export messages in all mailboxes, or only in selected mailboxes (including their children). Messages can be filtered by the date they were received, and by flags/keywords they must or must not have.'), dom.form(attr.target('_blank'), attr.method('POST'), attr.action('export'), dom.input(attr.type('hidden'), attr.name('csrf'), attr.value(localStorageGet('webaccountcsrftoken') || '')), dom.input(attr.type('hidden'), attr.name('recursive'), attr.value('on')), dom.div(style({ display: 'flex', flexDirection: 'column', gap: '.5ex' }), dom.label(dom.div('Mailboxes', attr.title('One mailbox per line. Leave empty to export all mailboxes.')), dom.textarea(attr.name('mailbox'), attr.rows('3'), attr.placeholder('All mailboxes'))), dom.div(dom.label('Received since ', dom.input(attr.type('date'), attr.name('since'))), ' ', dom.label('Received before ', dom.input(attr.type('date'), attr.name('before')))), dom.div(dom.label('With flags ', dom.input(attr.name('flags'), attr.placeholder('e.g. \\Seen $Junk'), attr.title('Space-separated flags and keywords that messages must all have.'))), ' ', dom.label('Without flags ', dom.input(attr.name('notflags'), attr.placeholder('e.g. \\Deleted'), attr.title('Space-separated flags and keywords that messages must not have.')))), dom.div(dom.label(dom.input(attr.type('radio'), attr.name('format'), attr.value('maildir'), attr.checked('')), ' Maildir'), ' ', dom.label(dom.input(attr.type('radio'), attr.name('format'), attr.value('mbox')), ' Mbox'), ' ', dom.label(dom.input(attr.type('radio'), attr.name('format'), attr.value('eml')), ' EML files', attr.title('A .eml file per message, in a directory per mailbox.'))), dom.div(dom.label(dom.input(attr.type('radio'), attr.name('archive'), attr.value('tar')), ' Tar'), ' ', dom.label(dom.input(attr.type('radio'), attr.name('archive'), attr.value('tgz'), attr.checked('')), ' Tgz'), ' ', dom.label(dom.input(attr.type('radio'), attr.name('archive'), attr.value('zip')), ' Zip'), ' '), dom.div(style({ marginTop: '1ex' }), dom.submitbutton('Export')))), dom.br(), dom.h2('Import'), dom.p('Import messages from a .zip or .tgz file with maildirs and/or mbox files, or from a Microsoft Outlook .pst file.'), importForm = dom.form(async function submit(e) {
 		e.preventDefault();
 		e.stopPropagation();
 		const request = async () => {
@@ -1765,9 +1897,11 @@ openssl pkcs12 \\
 		}
 	}, importFieldset = dom.fieldset(dom.div(style({ marginBottom: '1ex' }), dom.label(dom.div(style({ marginBottom: '.5ex' }), 'File'), dom.input(attr.type('file'), attr.required(''), attr.name('file'), function focus() {
 		mailboxFileHint.style.display = '';
-	})), mailboxFileHint = dom.p(style({ display: 'none', fontStyle: 'italic', marginTop: '.5ex' }), 'This file must either be a zip file or a gzipped tar file with mbox and/or maildir mailboxes. For maildirs, an optional file "dovecot-keywords" is read additional keywords, like Forwarded/Junk/NotJunk. If an imported mailbox already exists by name, messages are added to the existing mailbox. If a mailbox does not yet exist it will be created. Messages are not deduplicated, importing them twice will result in duplicates.')), dom.div(style({ marginBottom: '1ex' }), dom.label(dom.div(style({ marginBottom: '.5ex' }), 'Skip mailbox prefix (optional)'), dom.input(attr.name('skipMailboxPrefix'), function focus() {
+	})), mailboxFileHint = dom.p(style({ display: 'none', fontStyle: 'italic', marginTop: '.5ex' }), 'This file must either be a zip file or a gzipped tar file with mbox and/or maildir mailboxes, or a pst/ost file. Zip and tar files can also contain pst/ost files. Mail folders in pst files are imported as mailboxes with the same name. For maildirs, an optional file "dovecot-keywords" is read additional keywords, like Forwarded/Junk/NotJunk. If an imported mailbox already exists by name, messages are added to the existing mailbox. If a mailbox does not yet exist it will be created. Unless deduplication is enabled below, importing messages twice will result in duplicates.')), dom.div(style({ marginBottom: '1ex' }), dom.label(dom.div(style({ marginBottom: '.5ex' }), 'Skip mailbox prefix (optional)'), dom.input(attr.name('skipMailboxPrefix'), function focus() {
 		mailboxPrefixHint.style.display = '';
-	})), mailboxPrefixHint = dom.p(style({ display: 'none', fontStyle: 'italic', marginTop: '.5ex' }), 'If set, any mbox/maildir path with this prefix will have it stripped before importing. For example, if all mailboxes are in a directory "Takeout", specify that path in the field above so mailboxes like "Takeout/Inbox.mbox" are imported into a mailbox called "Inbox" instead of "Takeout/Inbox".')), dom.div(dom.submitbutton('Upload and import'), dom.p(style({ fontStyle: 'italic', marginTop: '.5ex' }), 'The file is uploaded first, then its messages are imported, finally messages are matched for threading. Importing is done in a transaction, you can abort the entire import before it is finished.')))), importAbortBox = dom.div(), // Outside fieldset because it gets disabled, above progress because may be scrolling it down quickly with problems.
+	})), mailboxPrefixHint = dom.p(style({ display: 'none', fontStyle: 'italic', marginTop: '.5ex' }), 'If set, any mbox/maildir path with this prefix will have it stripped before importing. For example, if all mailboxes are in a directory "Takeout", specify that path in the field above so mailboxes like "Takeout/Inbox.mbox" are imported into a mailbox called "Inbox" instead of "Takeout/Inbox".')), dom.div(style({ marginBottom: '1ex' }), dom.label(dom.div(style({ marginBottom: '.5ex' }), 'Skip duplicate messages'), dom.select(attr.name('dedup'), function focus() {
+		dedupHint.style.display = '';
+	}, dom.option('No', attr.value('')), dom.option('Already in the destination mailbox', attr.value('mailbox')), dom.option('Already in any mailbox', attr.value('account')))), dedupHint = dom.p(style({ display: 'none', fontStyle: 'italic', marginTop: '.5ex' }), 'Messages are compared by their Message-ID header, or for messages without Message-ID by their full contents. Duplicates within the imported file are skipped too.')), dom.div(dom.submitbutton('Upload and import'), dom.p(style({ fontStyle: 'italic', marginTop: '.5ex' }), 'The file is uploaded first, then its messages are imported, finally messages are matched for threading. Importing is done in a transaction, you can abort the entire import before it is finished.')))), importAbortBox = dom.div(), // Outside fieldset because it gets disabled, above progress because may be scrolling it down quickly with problems.
 	importProgress = dom.div(style({ display: 'none' })), dom.br(), footer);
 	(async () => {
 		// Try to show the progress of an earlier import session. The user may have just
@@ -1809,7 +1943,10 @@ const loginattempts = async () => {
 	return dom.div(crumbs(crumblink('Mox Account', '#'), 'Login attempts'), dom.h2('Login attempts'), dom.p('Login attempts are stored for 30 days. At most 10000 failed login attempts are stored to prevent unlimited growth of the database.'), renderLoginAttempts(loginAttempts || []));
 };
 const destination = async (name) => {
-	const [acc] = await client.Account();
+	const [[acc], vacation] = await Promise.all([
+		client.Account(),
+		client.VacationGet(name),
+	]);
 	let dest = (acc.Destinations || {})[name];
 	if (!dest) {
 		throw new Error('destination not found');
@@ -1842,13 +1979,18 @@ const destination = async (name) => {
 		};
 		let smtpMailFromRegexp;
 		let msgFromRegexp;
+		let msgToRegexp;
 		let verifiedDomain;
 		let isForward; // Checkbox
 		let listAllowDomain;
 		let acceptRejectsToMailbox;
 		let mailbox;
+		let seen; // Checkbox
+		let keywords;
+		let forwardTo;
+		let discard; // Checkbox
 		let comment;
-		const root = dom.tr(dom.td(smtpMailFromRegexp = dom.input(attr.value(rs.SMTPMailFromRegexp || ''))), dom.td(msgFromRegexp = dom.input(attr.value(rs.MsgFromRegexp || ''))), dom.td(verifiedDomain = dom.input(attr.value(rs.VerifiedDomain || ''))), headersCell, dom.td(dom.label(isForward = dom.input(attr.type('checkbox'), rs.IsForward ? attr.checked('') : []))), dom.td(listAllowDomain = dom.input(attr.value(rs.ListAllowDomain || ''))), dom.td(acceptRejectsToMailbox = dom.input(attr.value(rs.AcceptRejectsToMailbox || ''))), dom.td(mailbox = dom.input(attr.value(rs.Mailbox || ''))), dom.td(comment = dom.input(attr.value(rs.Comment || ''))), dom.td(dom.clickbutton('Remove ruleset', function click() {
+		const root = dom.tr(dom.td(smtpMailFromRegexp = dom.input(attr.value(rs.SMTPMailFromRegexp || ''))), dom.td(msgFromRegexp = dom.input(attr.value(rs.MsgFromRegexp || ''))), dom.td(msgToRegexp = dom.input(attr.value(rs.MsgToRegexp || ''))), dom.td(verifiedDomain = dom.input(attr.value(rs.VerifiedDomain || ''))), headersCell, dom.td(dom.label(isForward = dom.input(attr.type('checkbox'), rs.IsForward ? attr.checked('') : []))), dom.td(listAllowDomain = dom.input(attr.value(rs.ListAllowDomain || ''))), dom.td(acceptRejectsToMailbox = dom.input(attr.value(rs.AcceptRejectsToMailbox || ''))), dom.td(mailbox = dom.input(attr.value(rs.Mailbox || ''))), dom.td(dom.label(seen = dom.input(attr.type('checkbox'), rs.Seen ? attr.checked('') : []))), dom.td(keywords = dom.input(attr.value((rs.Keywords || []).join(' ')))), dom.td(forwardTo = dom.input(attr.value((rs.ForwardTo || []).join(', ')))), dom.td(dom.label(discard = dom.input(attr.type('checkbox'), rs.Discard ? attr.checked('') : []))), dom.td(comment = dom.input(attr.value(rs.Comment || ''))), dom.td(dom.clickbutton('Remove ruleset', function click() {
 			row.root.remove();
 			rulesetsRows = rulesetsRows.filter(e => e !== row);
 		})));
@@ -1856,12 +1998,17 @@ const destination = async (name) => {
 			root: root,
 			smtpMailFromRegexp: smtpMailFromRegexp,
 			msgFromRegexp: msgFromRegexp,
+			msgToRegexp: msgToRegexp,
 			verifiedDomain: verifiedDomain,
 			headers: [],
 			isForward: isForward,
 			listAllowDomain: listAllowDomain,
 			acceptRejectsToMailbox: acceptRejectsToMailbox,
 			mailbox: mailbox,
+			seen: seen,
+			keywords: keywords,
+			forwardTo: forwardTo,
+			discard: discard,
 			comment: comment,
 		};
 		rulesetsRows.push(row);
@@ -1882,18 +2029,54 @@ const destination = async (name) => {
 	let fullName;
 	let smtpError;
 	let msgAuthRequiredSMTPError;
+	let forwardEnabled;
+	let forwardTo;
+	let forwardKeepCopy;
 	let saveButton;
+	let vacationFieldset;
+	let vacationEnabled;
+	let vacationStart;
+	let vacationEnd;
+	let vacationDays;
+	let vacationSubject;
+	let vacationBody;
+	// Value for a datetime-local input, in local time.
+	const localDateTime = (d) => {
+		if (!d) {
+			return '';
+		}
+		const pad = (v) => (v < 10 ? '0' : '') + v;
+		return d.getFullYear() + '-' + pad(d.getMonth() + 1) + '-' + pad(d.getDate()) + 'T' + pad(d.getHours()) + ':' + pad(d.getMinutes());
+	};
 	const addresses = [name, ...Object.keys(acc.Destinations || {}).filter(a => !a.startsWith('@') && a !== name)];
-	return dom.div(crumbs(crumblink('Mox Account', '#'), 'Destination ' + name), dom.div(dom.span('Default mailbox', attr.title('Default mailbox where email for this recipient is delivered to if it does not match any ruleset. Default is Inbox.')), dom.br(), defaultMailbox = dom.input(attr.value(dest.Mailbox), attr.placeholder('Inbox'))), dom.br(), dom.div(dom.span('Full name', attr.title('Name to use in From header when composing messages. If not set, the account default full name is used.')), dom.br(), fullName = dom.input(attr.value(dest.FullName))), dom.br(), dom.div(dom.span('Reject deliveries with SMTP Error', attr.title('If non-empty, incoming delivery attempts to this destination will be rejected during SMTP RCPT TO with this error response line. The response line must start with an error code. Currently the following error resonse codes are allowed: 421 (temporary local error), 550 (mailbox not found). If the line consists of only an error code, an appropriate error message is added. Rejecting messages with a 4xx code invites later retries by the remote, while 5xx codes should prevent further delivery attempts.')), dom.br(), smtpError = dom.input(attr.value(dest.SMTPError), attr.placeholder('421 or 550...'))), dom.br(), dom.div(dom.span('Reject messages without authenticated domain (aligned SPF/DKIM)', attr.title("If non-empty, an additional DMARC-like message authentication check is done for incoming messages, validating the domain in the From-header of the message. Messages without either an aligned SPF or aligned DKIM pass are rejected during the SMTP DATA command with a permanent error code followed by the message in this field. The domain in the message 'From' header is matched in relaxed or strict mode according to the domain's DMARC policy if present, or relaxed mode (organizational instead of exact domain match) otherwise. Useful for autoresponders that don't want to accept messages they don't want to send an automated reply to.")), dom.br(), msgAuthRequiredSMTPError = dom.input(attr.value(dest.MessageAuthRequiredSMTPError), attr.placeholder('messages must have aligned spf/dkim for domain authentication...'))), dom.br(), dom.h2('Rulesets'), dom.p('Incoming messages are checked against the rulesets. If a ruleset matches, the message is delivered to the mailbox configured for the ruleset instead of to the default mailbox.'), dom.p('"Is Forward" does not affect matching, but changes prevents the sending mail server from being included in future junk classifications by clearing fields related to the forwarding email server (IP address, EHLO domain, MAIL FROM domain and a matching DKIM domain), and prevents DMARC rejects for forwarded messages.'), dom.p('"List allow domain" does not affect matching, but skips the regular spam checks if one of the verified domains is a (sub)domain of the domain mentioned here.'), dom.p('"Accept rejects to mailbox" does not affect matching, but causes messages classified as junk to be accepted and delivered to this mailbox, instead of being rejected during the SMTP transaction. Useful for incoming forwarded messages where rejecting incoming messages may cause the forwarding server to stop forwarding.'), dom.table(dom.thead(dom.tr(dom.th('SMTP "MAIL FROM" regexp', attr.title('Matches if this regular expression matches (a substring of) the SMTP MAIL FROM address (not the message From-header). E.g. user@example.org.')), dom.th('Message "From" address regexp', attr.title('Matches if this regular expression matches (a substring of) the single address in the message From header.')), dom.th('Verified domain', attr.title('Matches if this domain matches an SPF- and/or DKIM-verified (sub)domain.')), dom.th('Headers regexp', attr.title('Matches if these header field/value regular expressions all match (substrings of) the message headers. Header fields and valuees are converted to lower case before matching. Whitespace is trimmed from the value before matching. A header field can occur multiple times in a message, only one instance has to match. For mailing lists, you could match on ^list-id$ with the value typically the mailing list address in angled brackets with @ replaced with a dot, e.g. <name\\.lists\\.example\\.org>.')), dom.th('Is Forward', attr.title("Influences spam filtering only, this option does not change whether a message matches this ruleset. Can only be used together with SMTPMailFromRegexp and VerifiedDomain. SMTPMailFromRegexp must be set to the address used to deliver the forwarded message, e.g. '^user(|\\+.*)@forward\\.example$'. Changes to junk analysis: 1. Messages are not rejected for failing a DMARC policy, because a legitimate forwarded message without valid/intact/aligned DKIM signature would be rejected because any verified SPF domain will be 'unaligned', of the forwarding mail server. 2. The sending mail server IP address, and sending EHLO and MAIL FROM domains and matching DKIM domain aren't used in future reputation-based spam classifications (but other verified DKIM domains are) because the forwarding server is not a useful spam signal for future messages.")), dom.th('List allow domain', attr.title("Influences spam filtering only, this option does not change whether a message matches this ruleset. If this domain matches an SPF- and/or DKIM-verified (sub)domain, the message is accepted without further spam checks, such as a junk filter or DMARC reject evaluation. DMARC rejects should not apply for mailing lists that are not configured to rewrite the From-header of messages that don't have a passing DKIM signature of the From-domain. Otherwise, by rejecting messages, you may be automatically unsubscribed from the mailing list. The assumption is that mailing lists do their own spam filtering/moderation.")), dom.th('Allow rejects to mailbox', attr.title("Influences spam filtering only, this option does not change whether a message matches this ruleset. If a message is classified as spam, it isn't rejected during the SMTP transaction (the normal behaviour), but accepted during the SMTP transaction and delivered to the specified mailbox. The specified mailbox is not automatically cleaned up like the account global Rejects mailbox, unless set to that Rejects mailbox.")), dom.th('Mailbox', attr.title('Mailbox to deliver to if this ruleset matches.')), dom.th('Comment', attr.title('Free-form comments.')), dom.th('Action'))), rulesetsTbody, dom.tfoot(dom.tr(dom.td(attr.colspan('9')), dom.td(dom.clickbutton('Add ruleset', function click() {
+	return dom.div(crumbs(crumblink('Mox Account', '#'), 'Destination ' + name), dom.div(dom.span('Default mailbox', attr.title('Default mailbox where email for this recipient is delivered to if it does not match any ruleset. Default is Inbox.')), dom.br(), defaultMailbox = dom.input(attr.value(dest.Mailbox), attr.placeholder('Inbox'))), dom.br(), dom.div(dom.span('Full name', attr.title('Name to use in From header when composing messages. If not set, the account default full name is used.')), dom.br(), fullName = dom.input(attr.value(dest.FullName))), dom.br(), dom.div(dom.span('Reject deliveries with SMTP Error', attr.title('If non-empty, incoming delivery attempts to this destination will be rejected during SMTP RCPT TO with this error response line. The response line must start with an error code. Currently the following error resonse codes are allowed: 421 (temporary local error), 550 (mailbox not found). If the line consists of only an error code, an appropriate error message is added. Rejecting messages with a 4xx code invites later retries by the remote, while 5xx codes should prevent further delivery attempts.')), dom.br(), smtpError = dom.input(attr.value(dest.SMTPError), attr.placeholder('421 or 550...'))), dom.br(), dom.div(dom.span('Reject messages without authenticated domain (aligned SPF/DKIM)', attr.title("If non-empty, an additional DMARC-like message authentication check is done for incoming messages, validating the domain in the From-header of the message. Messages without either an aligned SPF or aligned DKIM pass are rejected during the SMTP DATA command with a permanent error code followed by the message in this field. The domain in the message 'From' header is matched in relaxed or strict mode according to the domain's DMARC policy if present, or relaxed mode (organizational instead of exact domain match) otherwise. Useful for autoresponders that don't want to accept messages they don't want to send an automated reply to.")), dom.br(), msgAuthRequiredSMTPError = dom.input(attr.value(dest.MessageAuthRequiredSMTPError), attr.placeholder('messages must have aligned spf/dkim for domain authentication...'))), dom.br(), dom.h2('Forwarding'), dom.p('Incoming messages can be forwarded to external addresses. The SMTP MAIL FROM address of forwarded messages is rewritten to an address at this domain (sender rewriting scheme, SRS), so the messages pass SPF checks at the next hop, and delivery failures are sent back to the original sender. Messages classified as junk are not forwarded.'), dom.div(dom.label(forwardEnabled = dom.input(attr.type('checkbox'), dest.Forward && !dest.Forward.Disabled ? attr.checked('') : []), ' Forward incoming messages', attr.title('If not checked, the forwarding addresses are kept, but messages are delivered to the mailbox instead.'))), dom.div(dom.span('Forward to', attr.title('Addresses to forward messages to, separated by commas.')), dom.br(), forwardTo = dom.input(attr.value((dest.Forward?.To || []).join(', ')), attr.placeholder('user@example.org, ...'))), dom.div(dom.label(forwardKeepCopy = dom.input(attr.type('checkbox'), dest.Forward?.KeepCopy ? attr.checked('') : []), ' Keep a copy', attr.title('Also deliver forwarded messages to the mailbox.'))), dom.br(), dom.h2('Out of office'), dom.p("Send an automatic response to incoming messages addressed to this address, e.g. while on vacation. Each correspondent gets at most one response per number of days. Messages from mailing lists, automated messages and messages classified as junk don't get a response. A vacation response of an active sieve script takes precedence."), dom.form(async function submit(e) {
+		e.preventDefault();
+		e.stopPropagation();
+		const v = {
+			...vacation,
+			Enabled: vacationEnabled.checked,
+			Start: vacationStart.value ? new Date(vacationStart.value) : null,
+			End: vacationEnd.value ? new Date(vacationEnd.value) : null,
+			Days: parseInt(vacationDays.value),
+			Subject: vacationSubject.value,
+			Body: vacationBody.value,
+		};
+		await check(vacationFieldset, client.VacationSave(v));
+	}, vacationFieldset = dom.fieldset(dom.div(dom.label(vacationEnabled = dom.input(attr.type('checkbox'), vacation.Enabled ? attr.checked('') : []), ' Enabled')), dom.div(style({ display: 'flex', gap: '1em', marginTop: '.5ex' }), dom.label(dom.div('Start', attr.title('Optional, no responses are sent before this time.')), vacationStart = dom.input(attr.type('datetime-local'), attr.value(localDateTime(vacation.Start)))), dom.label(dom.div('End', attr.title('Optional, no responses are sent after this time.')), vacationEnd = dom.input(attr.type('datetime-local'), attr.value(localDateTime(vacation.End)))), dom.label(dom.div('Days', attr.title('Number of days during which no new response is sent to the same correspondent.')), vacationDays = dom.input(attr.type('number'), attr.min('1'), attr.required(''), attr.value('' + (vacation.Days || 7))))), dom.div(style({ marginTop: '.5ex' }), dom.label(dom.div('Subject'), vacationSubject = dom.input(attr.value(vacation.Subject), attr.placeholder('Auto: <original subject>'), style({ width: '30em' })))), dom.div(style({ marginTop: '.5ex' }), dom.label(dom.div('Message'), vacationBody = dom.textarea(vacation.Body, attr.rows('5'), style({ width: '30em' }), attr.placeholder('I am away until next week.')))), dom.div(style({ marginTop: '.5ex' }), dom.submitbutton('Save')))), dom.br(), dom.h2('Rulesets'), dom.p('Incoming messages are checked against the rulesets. If a ruleset matches, the message is delivered to the mailbox configured for the ruleset instead of to the default mailbox.'), dom.p('A matching ruleset can also mark the message as read, add keywords, forward the message to other addresses, and discard the message instead of storing it, e.g. after forwarding.'), dom.p('"Is Forward" does not affect matching, but changes prevents the sending mail server from being included in future junk classifications by clearing fields related to the forwarding email server (IP address, EHLO domain, MAIL FROM domain and a matching DKIM domain), and prevents DMARC rejects for forwarded messages.'), dom.p('"List allow domain" does not affect matching, but skips the regular spam checks if one of the verified domains is a (sub)domain of the domain mentioned here.'), dom.p('"Accept rejects to mailbox" does not affect matching, but causes messages classified as junk to be accepted and delivered to this mailbox, instead of being rejected during the SMTP transaction. Useful for incoming forwarded messages where rejecting incoming messages may cause the forwarding server to stop forwarding.'), dom.table(dom.thead(dom.tr(dom.th('SMTP "MAIL FROM" regexp', attr.title('Matches if this regular expression matches (a substring of) the SMTP MAIL FROM address (not the message From-header). E.g. user@example.org.')), dom.th('Message "From" address regexp', attr.title('Matches if this regular expression matches (a substring of) the single address in the message From header.')), dom.th('Message "To" address regexp', attr.title('Matches if this regular expression matches (a substring of) one of the addresses in the message To and Cc headers.')), dom.th('Verified domain', attr.title('Matches if this domain matches an SPF- and/or DKIM-verified (sub)domain.')), dom.th('Headers regexp', attr.title('Matches if these header field/value regular expressions all match (substrings of) the message headers. Header fields and valuees are converted to lower case before matching. Whitespace is trimmed from the value before matching. A header field can occur multiple times in a message, only one instance has to match. For mailing lists, you could match on ^list-id$ with the value typically the mailing list address in angled brackets with @ replaced with a dot, e.g. <name\\.lists\\.example\\.org>.')), dom.th('Is Forward', attr.title("Influences spam filtering only, this option does not change whether a message matches this ruleset. Can only be used together with SMTPMailFromRegexp and VerifiedDomain. SMTPMailFromRegexp must be set to the address used to deliver the forwarded message, e.g. '^user(|\\+.*)@forward\\.example$'. Changes to junk analysis: 1. Messages are not rejected for failing a DMARC policy, because a legitimate forwarded message without valid/intact/aligned DKIM signature would be rejected because any verified SPF domain will be 'unaligned', of the forwarding mail server. 2. The sending mail server IP address, and sending EHLO and MAIL FROM domains and matching DKIM domain aren't used in future reputation-based spam classifications (but other verified DKIM domains are) because the forwarding server is not a useful spam signal for future messages.")), dom.th('List allow domain', attr.title("Influences spam filtering only, this option does not change whether a message matches this ruleset. If this domain matches an SPF- and/or DKIM-verified (sub)domain, the message is accepted without further spam checks, such as a junk filter or DMARC reject evaluation. DMARC rejects should not apply for mailing lists that are not configured to rewrite the From-header of messages that don't have a passing DKIM signature of the From-domain. Otherwise, by rejecting messages, you may be automatically unsubscribed from the mailing list. The assumption is that mailing lists do their own spam filtering/moderation.")), dom.th('Allow rejects to mailbox', attr.title("Influences spam filtering only, this option does not change whether a message matches this ruleset. If a message is classified as spam, it isn't rejected during the SMTP transaction (the normal behaviour), but accepted during the SMTP transaction and delivered to the specified mailbox. The specified mailbox is not automatically cleaned up like the account global Rejects mailbox, unless set to that Rejects mailbox.")), dom.th('Mailbox', attr.title('Mailbox to deliver to if this ruleset matches. Required unless Discard is set.')), dom.th('Mark read', attr.title('Mark the delivered message as read.')), dom.th('Keywords', attr.title('Keywords to add to the delivered message, separated by spaces, e.g. to label newsletters. Must be lower case.')), dom.th('Forward to', attr.title('Addresses to forward the message to, separated by commas, in addition to delivering it to the mailbox, unless Discard is set. Delivery failures are reported to this address. Messages classified as junk are not forwarded.')), dom.th('Discard', attr.title('Accept the message, but do not store it, e.g. for messages that are only forwarded. Mailbox must be empty.')), dom.th('Comment', attr.title('Free-form comments.')), dom.th('Action'))), rulesetsTbody, dom.tfoot(dom.tr(dom.td(attr.colspan('14')), dom.td(dom.clickbutton('Add ruleset', function click() {
 		addRulesetsRow({
 			SMTPMailFromRegexp: '',
 			MsgFromRegexp: '',
+			MsgToRegexp: '',
 			VerifiedDomain: '',
 			HeadersRegexp: {},
 			IsForward: false,
 			ListAllowDomain: '',
 			AcceptRejectsToMailbox: '',
 			Mailbox: '',
+			Seen: false,
+			Keywords: [],
+			ForwardTo: [],
+			Discard: false,
 			Comment: '',
 			VerifiedDNSDomain: { ASCII: '', Unicode: '' },
 			ListAllowDNSDomain: { ASCII: '', Unicode: '' },
@@ -1906,12 +2089,17 @@ const destination = async (name) => {
 				return {
 					SMTPMailFromRegexp: row.smtpMailFromRegexp.value,
 					MsgFromRegexp: row.msgFromRegexp.value,
+					MsgToRegexp: row.msgToRegexp.value,
 					VerifiedDomain: row.verifiedDomain.value,
 					HeadersRegexp: Object.fromEntries(row.headers.map(h => [h.key.value, h.value.value])),
 					IsForward: row.isForward.checked,
 					ListAllowDomain: row.listAllowDomain.value,
 					AcceptRejectsToMailbox: row.acceptRejectsToMailbox.value,
 					Mailbox: row.mailbox.value,
+					Seen: row.seen.checked,
+					Keywords: row.keywords.value.split(' ').map(s => s.trim().toLowerCase()).filter(s => s),
+					ForwardTo: row.forwardTo.value.split(',').map(s => s.trim()).filter(s => s),
+					Discard: row.discard.checked,
 					Comment: row.comment.value,
 					VerifiedDNSDomain: { ASCII: '', Unicode: '' },
 					ListAllowDNSDomain: { ASCII: '', Unicode: '' },
@@ -1919,6 +2107,13 @@ const destination = async (name) => {
 			}),
 			SMTPError: smtpError.value,
 			MessageAuthRequiredSMTPError: msgAuthRequiredSMTPError.value,
+			Disabled: dest.Disabled,
+			DuplicateWindow: dest.DuplicateWindow,
+			Forward: forwardTo.value.trim() ? {
+				To: forwardTo.value.split(',').map(s => s.trim()).filter(s => s),
+				KeepCopy: forwardKeepCopy.checked,
+				Disabled: !forwardEnabled.checked,
+			} : null,
 		};
 		await check(saveButton, client.DestinationSave(name, dest, newDest));
 		window.location.reload(); // todo: only refresh part of ui
@@ -298,12 +298,18 @@ const formatQuotaSize = (v: number) => {
 }
 
 const index = async () => {
-	const [[acc, storageUsed, storageLimit, suppressions], tlspubkeys0, recentLoginAttempts] = await Promise.all([
+	const [[acc, storageUsed, storageLimit, suppressions], tlspubkeys0, recentLoginAttempts, trustedSenders0, sieveScript0, [openpgpKeys0, openpgpAddresses0]] = await Promise.all([
 		client.Account(),
 		client.TLSPublicKeys(),
 		client.LoginAttempts(10),
+		client.TrustedSenders(),
+		client.SieveScriptGet(),
+		client.OpenPGPKeys(),
 	])
 	const tlspubkeys = tlspubkeys0 || []
+	const trustedSenders = trustedSenders0 || []
+	const openpgpKeys = openpgpKeys0 || []
+	const openpgpAddresses = openpgpAddresses0 || []
 
 	let fullNameForm: HTMLFormElement
 	let fullNameFieldset: HTMLFieldSetElement
@@ -314,6 +320,10 @@ const index = async () => {
 	let password2: HTMLInputElement
 	let passwordHint: HTMLElement
 
+	let openpgpKeyFieldset: HTMLFieldSetElement
+	let openpgpAddress: HTMLSelectElement
+	let openpgpKey: HTMLTextAreaElement
+
 	let autoJunkFlagsFieldset: HTMLFieldSetElement
 	let autoJunkFlagsEnabled: HTMLInputElement
 	let junkMailboxRegexp: HTMLInputElement
@@ -334,6 +344,9 @@ const index = async () => {
 	let rejectsMailbox: HTMLInputElement
 	let keepRejects: HTMLInputElement
 
+	let sieveFieldset: HTMLFieldSetElement
+	let sieveScript: HTMLTextAreaElement
+
 	let outgoingWebhookFieldset: HTMLFieldSetElement
 	let outgoingWebhookURL: HTMLInputElement
 	let outgoingWebhookAuthorization: HTMLInputElement
@@ -387,6 +400,7 @@ const index = async () => {
 	let importFieldset: HTMLFieldSetElement
 	let mailboxFileHint: HTMLElement
 	let mailboxPrefixHint: HTMLElement
+	let dedupHint: HTMLElement
 	let importProgress: HTMLElement
 	let importAbortBox: HTMLElement
 
@@ -474,8 +488,9 @@ const index = async () => {
 				importProgress.appendChild(dom.div(dom.br(), box(blue, 'Step: '+data.Title)))
 			})
 			eventSource.addEventListener('done', (e) => {
-				console.log('import done event', {e})
-				importProgress.appendChild(dom.div(dom.br(), box(blue, 'Import finished')))
+				const data = JSON.parse(e.data) // {Skipped: ...}
+				console.log('import done event', {e, data})
+				importProgress.appendChild(dom.div(dom.br(), box(blue, 'Import finished' + (data.Skipped ? ', '+data.Skipped+' duplicate message'+(data.Skipped === 1 ? '' : 's')+' skipped' : ''))))
 
 				eventSource.close()
 				dom._kids(importConnection)
@@ -1229,6 +1244,25 @@ openssl pkcs12 \\
 		),
 		dom.br(),
 
+		dom.h2('Sieve script'),
+		dom.p('A sieve script is evaluated for incoming messages that do not match a ruleset of the destination address. It can file messages into mailboxes, redirect or discard them, send vacation responses, and send notifications with the "enotify" extension, through mailto: URIs, and, if enabled by the admin, http(s):// webhooks, ntfy:// or gotify:// URIs. Clear the script to disable it.'),
+		dom.form(
+			async function submit(e: SubmitEvent) {
+				e.preventDefault()
+				e.stopPropagation()
+
+				await check(sieveFieldset, client.SieveScriptSave(sieveScript.value))
+			},
+			sieveFieldset=dom.fieldset(
+				dom.div(
+					sieveScript=dom.textarea(sieveScript0, attr.rows('10'), style({width: '100%', fontFamily: 'monospace'}), attr.placeholder('require ["fileinto", "vacation"];\nif header :contains "list-id" "example.org" { fileinto "Lists"; }\nvacation :days 7 "I am away until next week.";')),
+				),
+				dom.br(),
+				dom.div(dom.submitbutton('Save')),
+			),
+		),
+		dom.br(),
+
 		dom.h2('Webhooks'),
 		dom.h3('Outgoing', attr.title('Webhooks for outgoing messages are called for each attempt to deliver a message in the outgoing queue, e.g. when the queue has delivered a message to the next hop, when a single attempt failed with a temporary error, when delivery permanently failed, or when DSN (delivery status notification) messages were received about a previously sent message.')),
 		dom.form(
@@ -1478,18 +1512,113 @@ openssl pkcs12 \\
 		),
 		dom.br(),
 
+		dom.h2('Trusted senders'),
+		dom.p('Addresses you have sent messages to are trusted senders. Incoming messages from trusted senders are accepted without junk filtering and without a subjectpass challenge. Remove an address to make its messages subject to junk filtering again.'),
+		dom.table(
+			dom.thead(
+				dom.tr(
+					dom.th('Address'),
+					dom.th('Messages', attr.title('Number of sent messages with this address as recipient.')),
+					dom.th('Last sent'),
+					dom.th('Since'),
+					dom.th('Action'),
+				),
+			),
+			dom.tbody(
+				trustedSenders.length === 0 ? dom.tr(dom.td(attr.colspan('5'), '(None)')) : [],
+				trustedSenders.map(ts =>
+					dom.tr(
+						dom.td(prewrap(ts.Localpart+'@'+ts.Domain)),
+						dom.td(''+ts.Count),
+						dom.td(age(ts.LastSent)),
+						dom.td(age(ts.Created)),
+						dom.td(
+							dom.clickbutton('Remove', async function click(e: MouseEvent) {
+								await check(e.target! as HTMLButtonElement, client.TrustedSenderRemove(ts.ID))
+								window.location.reload() // todo: reload less
+							})
+						),
+					),
+				),
+			),
+		),
+		dom.br(),
+
+		dom.h2('OpenPGP keys'),
+		dom.p('Publish your OpenPGP public keys through the Web Key Directory (WKD), so mail clients of the people you correspond with can find them automatically, for encrypting messages they send to you. Keys can only be published for addresses in domains for which WKD is enabled by the administrator.'),
+		dom.table(
+			dom.thead(
+				dom.tr(
+					dom.th('Address'),
+					dom.th('Fingerprint'),
+					dom.th('Updated'),
+					dom.th('Action'),
+				),
+			),
+			dom.tbody(
+				openpgpKeys.length === 0 ? dom.tr(dom.td(attr.colspan('4'), '(None)')) : [],
+				openpgpKeys.map(k =>
+					dom.tr(
+						dom.td(k.Address),
+						dom.td(style({fontFamily: 'monospace'}), k.Fingerprint),
+						dom.td(age(k.Updated)),
+						dom.td(
+							dom.clickbutton('Remove', async function click(e: MouseEvent) {
+								await check(e.target! as HTMLButtonElement, client.OpenPGPKeyRemove(k.Address))
+								window.location.reload() // todo: reload less
+							})
+						),
+					),
+				),
+			),
+		),
+		openpgpAddresses.length === 0 ? [] : dom.form(
+			async function submit(e: SubmitEvent) {
+				e.preventDefault()
+				e.stopPropagation()
+				await check(openpgpKeyFieldset, client.OpenPGPKeySave(openpgpAddress.value, openpgpKey.value))
+				window.location.reload() // todo: reload less
+			},
+			openpgpKeyFieldset=dom.fieldset(
+				dom.div(style({display: 'flex', flexDirection: 'column', gap: '.5ex'}),
+					dom.label(
+						dom.div('Address'),
+						openpgpAddress=dom.select(openpgpAddresses.map(a => dom.option(a))),
+					),
+					dom.label(
+						dom.div('Public key', attr.title('ASCII-armored, e.g. from "gpg --export --armor <address>". The key must have a user ID with the address. A key published earlier for the address is replaced.')),
+						openpgpKey=dom.textarea(attr.required(''), attr.rows('8'), style({width: '100%', fontFamily: 'monospace'})),
+					),
+					dom.div(dom.submitbutton('Publish key')),
+				),
+			),
+		),
+		dom.br(),
+
 		dom.h2('Export'),
-		dom.p('Export all messages in all mailboxes.'),
+		dom.p('Export messages in all mailboxes, or only in selected mailboxes (including their children). Messages can be filtered by the date they were received, and by flags/keywords they must or must not have.'),
 		dom.form(
 			attr.target('_blank'), attr.method('POST'), attr.action('export'),
 			dom.input(attr.type('hidden'), attr.name('csrf'), attr.value(localStorageGet('webaccountcsrftoken') || '')),
-			dom.input(attr.type('hidden'), attr.name('mailbox'), attr.value('')),
 			dom.input(attr.type('hidden'), attr.name('recursive'), attr.value('on')),
 
 			dom.div(style({display: 'flex', flexDirection: 'column', gap: '.5ex'}),
+				dom.label(
+					dom.div('Mailboxes', attr.title('One mailbox per line. Leave empty to export all mailboxes.')),
+					dom.textarea(attr.name('mailbox'), attr.rows('3'), attr.placeholder('All mailboxes')),
+				),
+				dom.div(
+					dom.label('Received since ', dom.input(attr.type('date'), attr.name('since'))), ' ',
+					dom.label('Received before ', dom.input(attr.type('date'), attr.name('before'))),
+				),
+				dom.div(
+					dom.label('With flags ', dom.input(attr.name('flags'), attr.placeholder('e.g. \\Seen $Junk'), attr.title('Space-separated flags and keywords that messages must all have.'))), ' ',
+					dom.label('Without flags ', dom.input(attr.name('notflags'), attr.placeholder('e.g. \\Deleted'), attr.title('Space-separated flags and keywords that messages must not have.'))),
+				),
 				dom.div(
 					dom.label(dom.input(attr.type('radio'), attr.name('format'), attr.value('maildir'), attr.checked('')), ' Maildir'), ' ',
-					dom.label(dom.input(attr.type('radio'), attr.name('format'), attr.value('mbox')), ' Mbox'),
+					dom.label(dom.input(attr.type('radio'), attr.name('format'), attr.value('mbox')), ' Mbox'), ' ',
+					dom.label(dom.input(attr.type('radio'), attr.name('format'), attr.value('eml')), ' EML files', attr.title('A .eml file per message, in a directory per mailbox.')),
 				),
 				dom.div(
 					dom.label(dom.input(attr.type('radio'), attr.name('archive'), attr.value('tar')), ' Tar'), ' ',
@@ -1502,7 +1631,7 @@ openssl pkcs12 \\
 		dom.br(),
 
 		dom.h2('Import'),
-		dom.p('Import messages from a .zip or .tgz file with maildirs and/or mbox files.'),
+		dom.p('Import messages from a .zip or .tgz file with maildirs and/or mbox files, or from a Microsoft Outlook .pst file.'),
 		importForm=dom.form(
 			async function submit(e: SubmitEvent) {
 				e.preventDefault()
@@ -1578,7 +1707,7 @@ openssl pkcs12 \\
 							mailboxFileHint.style.display = ''
 						}),
 					),
-					mailboxFileHint=dom.p(style({display: 'none', fontStyle: 'italic', marginTop: '.5ex'}), 'This file must either be a zip file or a gzipped tar file with mbox and/or maildir mailboxes. For maildirs, an optional file "dovecot-keywords" is read additional keywords, like Forwarded/Junk/NotJunk. If an imported mailbox already exists by name, messages are added to the existing mailbox. If a mailbox does not yet exist it will be created. Messages are not deduplicated, importing them twice will result in duplicates.'),
+					mailboxFileHint=dom.p(style({display: 'none', fontStyle: 'italic', marginTop: '.5ex'}), 'This file must either be a zip file or a gzipped tar file with mbox and/or maildir mailboxes, or a pst/ost file. Zip and tar files can also contain pst/ost files. Mail folders in pst files are imported as mailboxes with the same name. For maildirs, an optional file "dovecot-keywords" is read additional keywords, like Forwarded/Junk/NotJunk. If an imported mailbox already exists by name, messages are added to the existing mailbox. If a mailbox does not yet exist it will be created. Unless deduplication is enabled below, importing messages twice will result in duplicates.'),
 				),
 				dom.div(
 					style({marginBottom: '1ex'}),
@@ -1590,6 +1719,20 @@ openssl pkcs12 \\
 					),
 					mailboxPrefixHint=dom.p(style({display: 'none', fontStyle: 'italic', marginTop: '.5ex'}), 'If set, any mbox/maildir path with this prefix will have it stripped before importing. For example, if all mailboxes are in a directory "Takeout", specify that path in the field above so mailboxes like "Takeout/Inbox.mbox" are imported into a mailbox called "Inbox" instead of "Takeout/Inbox".'),
 				),
+				dom.div(
+					style({marginBottom: '1ex'}),
+					dom.label(
+						dom.div(style({marginBottom: '.5ex'}), 'Skip duplicate messages'),
+						dom.select(attr.name('dedup'), function focus() {
+							dedupHint.style.display = ''
+						},
+							dom.option('No', attr.value('')),
+							dom.option('Already in the destination mailbox', attr.value('mailbox')),
+							dom.option('Already in any mailbox', attr.value('account')),
+						),
+					),
+					dedupHint=dom.p(style({display: 'none', fontStyle: 'italic', marginTop: '.5ex'}), 'Messages are compared by their Message-ID header, or for messages without Message-ID by their full contents. Duplicates within the imported file are skipped too.'),
+				),
 				dom.div(
 					dom.submitbutton('Upload and import'),
 					dom.p(style({fontStyle: 'italic', marginTop: '.5ex'}), 'The file is uploaded first, then its messages are imported, finally messages are matched for threading. Importing is done in a transaction, you can abort the entire import before it is finished.'),
@@ -1698,7 +1841,10 @@ const loginattempts = async () => {
 }
 
 const destination = async (name: string) => {
-	const [acc] = await client.Account()
+	const [[acc], vacation] = await Promise.all([
+		client.Account(),
+		client.VacationGet(name),
+	])
 	let dest = (acc.Destinations || {})[name]
 	if (!dest) {
 		throw new Error('destination not found')
@@ -1716,12 +1862,17 @@ const destination = async (name: string) => {
 
 		smtpMailFromRegexp: HTMLInputElement
 		msgFromRegexp: HTMLInputElement
+		msgToRegexp: HTMLInputElement
 		verifiedDomain: HTMLInputElement
 		headers: Header[]
 		isForward: HTMLInputElement // Checkbox
 		listAllowDomain: HTMLInputElement
 		acceptRejectsToMailbox: HTMLInputElement
 		mailbox: HTMLInputElement
+		seen: HTMLInputElement // Checkbox
+		keywords: HTMLInputElement
+		forwardTo: HTMLInputElement
+		discard: HTMLInputElement // Checkbox
 		comment: HTMLInputElement
 	}
 
@@ -1765,22 +1916,32 @@ const destination = async (name: string) => {
 
 		let smtpMailFromRegexp: HTMLInputElement
 		let msgFromRegexp: HTMLInputElement
+		let msgToRegexp: HTMLInputElement
 		let verifiedDomain: HTMLInputElement
 		let isForward: HTMLInputElement // Checkbox
 		let listAllowDomain: HTMLInputElement
 		let acceptRejectsToMailbox: HTMLInputElement
 		let mailbox: HTMLInputElement
+		let seen: HTMLInputElement // Checkbox
+		let keywords: HTMLInputElement
+		let forwardTo: HTMLInputElement
+		let discard: HTMLInputElement // Checkbox
 		let comment: HTMLInputElement
 
 		const root = dom.tr(
 			dom.td(smtpMailFromRegexp=dom.input(attr.value(rs.SMTPMailFromRegexp || ''))),
 			dom.td(msgFromRegexp=dom.input(attr.value(rs.MsgFromRegexp || ''))),
+			dom.td(msgToRegexp=dom.input(attr.value(rs.MsgToRegexp || ''))),
 			dom.td(verifiedDomain=dom.input(attr.value(rs.VerifiedDomain || ''))),
 			headersCell,
 			dom.td(dom.label(isForward=dom.input(attr.type('checkbox'), rs.IsForward ? attr.checked('') : [] ))),
 			dom.td(listAllowDomain=dom.input(attr.value(rs.ListAllowDomain || ''))),
 			dom.td(acceptRejectsToMailbox=dom.input(attr.value(rs.AcceptRejectsToMailbox || ''))),
 			dom.td(mailbox=dom.input(attr.value(rs.Mailbox || ''))),
+			dom.td(dom.label(seen=dom.input(attr.type('checkbox'), rs.Seen ? attr.checked('') : [] ))),
+			dom.td(keywords=dom.input(attr.value((rs.Keywords || []).join(' ')))),
+			dom.td(forwardTo=dom.input(attr.value((rs.ForwardTo || []).join(', ')))),
+			dom.td(dom.label(discard=dom.input(attr.type('checkbox'), rs.Discard ? attr.checked('') : [] ))),
 			dom.td(comment=dom.input(attr.value(rs.Comment || ''))),
 			dom.td(
 				dom.clickbutton('Remove ruleset', function click() {
@@ -1793,12 +1954,17 @@ const destination = async (name: string) => {
 			root: root,
 			smtpMailFromRegexp: smtpMailFromRegexp,
 			msgFromRegexp: msgFromRegexp,
+			msgToRegexp: msgToRegexp,
 			verifiedDomain: verifiedDomain,
 			headers: [],
 			isForward: isForward,
 			listAllowDomain: listAllowDomain,
 			acceptRejectsToMailbox: acceptRejectsToMailbox,
 			mailbox: mailbox,
+			seen: seen,
+			keywords: keywords,
+			forwardTo: forwardTo,
+			discard: discard,
 			comment: comment,
 		}
 		rulesetsRows.push(row)
@@ -1825,8 +1991,28 @@ const destination = async (name: string) => {
 	let fullName: HTMLInputElement
 	let smtpError: HTMLInputElement
 	let msgAuthRequiredSMTPError: HTMLInputElement
+	let forwardEnabled: HTMLInputElement
+	let forwardTo: HTMLInputElement
+	let forwardKeepCopy: HTMLInputElement
 	let saveButton: HTMLButtonElement
 
+	let vacationFieldset: HTMLFieldSetElement
+	let vacationEnabled: HTMLInputElement
+	let vacationStart: HTMLInputElement
+	let vacationEnd: HTMLInputElement
+	let vacationDays: HTMLInputElement
+	let vacationSubject: HTMLInputElement
+	let vacationBody: HTMLTextAreaElement
+
+	// Value for a datetime-local input, in local time.
+	const localDateTime = (d: Date | null | undefined) => {
+		if (!d) {
+			return ''
+		}
+		const pad = (v: number) => (v < 10 ? '0' : '') + v
+		return d.getFullYear()+'-'+pad(d.getMonth()+1)+'-'+pad(d.getDate())+'T'+pad(d.getHours())+':'+pad(d.getMinutes())
+	}
+
 	const addresses = [name, ...Object.keys(acc.Destinations || {}).filter(a => !a.startsWith('@') && a !== name)]
 
 	return dom.div(
@@ -1859,8 +2045,62 @@ const destination = async (name: string) => {
 		),
 		dom.br(),
 
+		dom.h2('Forwarding'),
+		dom.p('Incoming messages can be forwarded to external addresses. The SMTP MAIL FROM address of forwarded messages is rewritten to an address at this domain (sender rewriting scheme, SRS), so the messages pass SPF checks at the next hop, and delivery failures are sent back to the original sender. Messages classified as junk are not forwarded.'),
+		dom.div(
+			dom.label(forwardEnabled=dom.input(attr.type('checkbox'), dest.Forward && !dest.Forward.Disabled ? attr.checked('') : []), ' Forward incoming messages', attr.title('If not checked, the forwarding addresses are kept, but messages are delivered to the mailbox instead.')),
+		),
+		dom.div(
+			dom.span('Forward to', attr.title('Addresses to forward messages to, separated by commas.')),
+			dom.br(),
+			forwardTo=dom.input(attr.value((dest.Forward?.To || []).join(', ')), attr.placeholder('user@example.org, ...')),
+		),
+		dom.div(
+			dom.label(forwardKeepCopy=dom.input(attr.type('checkbox'), dest.Forward?.KeepCopy ? attr.checked('') : []), ' Keep a copy', attr.title('Also deliver forwarded messages to the mailbox.')),
+		),
+		dom.br(),
+
+		dom.h2('Out of office'),
+		dom.p("Send an automatic response to incoming messages addressed to this address, e.g. while on vacation. Each correspondent gets at most one response per number of days. Messages from mailing lists, automated messages and messages classified as junk don't get a response. A vacation response of an active sieve script takes precedence."),
+		dom.form(
+			async function submit(e: SubmitEvent) {
+				e.preventDefault()
+				e.stopPropagation()
+
+				const v: api.Vacation = {
+					...vacation,
+					Enabled: vacationEnabled.checked,
+					Start: vacationStart.value ? new Date(vacationStart.value) : null,
+					End: vacationEnd.value ? new Date(vacationEnd.value) : null,
+					Days: parseInt(vacationDays.value),
+					Subject: vacationSubject.value,
+					Body: vacationBody.value,
+				}
+				await check(vacationFieldset, client.VacationSave(v))
+			},
+			vacationFieldset=dom.fieldset(
+				dom.div(
+					dom.label(vacationEnabled=dom.input(attr.type('checkbox'), vacation.Enabled ? attr.checked('') : []), ' Enabled'),
+				),
+				dom.div(style({display: 'flex', gap: '1em', marginTop: '.5ex'}),
+					dom.label(dom.div('Start', attr.title('Optional, no responses are sent before this time.')), vacationStart=dom.input(attr.type('datetime-local'), attr.value(localDateTime(vacation.Start)))),
+					dom.label(dom.div('End', attr.title('Optional, no responses are sent after this time.')), vacationEnd=dom.input(attr.type('datetime-local'), attr.value(localDateTime(vacation.End)))),
+					dom.label(dom.div('Days', attr.title('Number of days during which no new response is sent to the same correspondent.')), vacationDays=dom.input(attr.type('number'), attr.min('1'), attr.required(''), attr.value(''+(vacation.Days || 7)))),
+				),
+				dom.div(style({marginTop: '.5ex'}),
+					dom.label(dom.div('Subject'), vacationSubject=dom.input(attr.value(vacation.Subject), attr.placeholder('Auto: <original subject>'), style({width: '30em'}))),
+				),
+				dom.div(style({marginTop: '.5ex'}),
+					dom.label(dom.div('Message'), vacationBody=dom.textarea(vacation.Body, attr.rows('5'), style({width: '30em'}), attr.placeholder('I am away until next week.'))),
+				),
+				dom.div(style({marginTop: '.5ex'}), dom.submitbutton('Save')),
+			),
+		),
+		dom.br(),
+
 		dom.h2('Rulesets'),
 		dom.p('Incoming messages are checked against the rulesets. If a ruleset matches, the message is delivered to the mailbox configured for the ruleset instead of to the default mailbox.'),
+		dom.p('A matching ruleset can also mark the message as read, add keywords, forward the message to other addresses, and discard the message instead of storing it, e.g. after forwarding.'),
 		dom.p('"Is Forward" does not affect matching, but changes prevents the sending mail server from being included in future junk classifications by clearing fields related to the forwarding email server (IP address, EHLO domain, MAIL FROM domain and a matching DKIM domain), and prevents DMARC rejects for forwarded messages.'),
 		dom.p('"List allow domain" does not affect matching, but skips the regular spam checks if one of the verified domains is a (sub)domain of the domain mentioned here.'),
 		dom.p('"Accept rejects to mailbox" does not affect matching, but causes messages classified as junk to be accepted and delivered to this mailbox, instead of being rejected during the SMTP transaction. Useful for incoming forwarded messages where rejecting incoming messages may cause the forwarding server to stop forwarding.'),
@@ -1869,12 +2109,17 @@ const destination = async (name: string) => {
 				dom.tr(
 					dom.th('SMTP "MAIL FROM" regexp', attr.title('Matches if this regular expression matches (a substring of) the SMTP MAIL FROM address (not the message From-header). E.g. user@example.org.')),
 					dom.th('Message "From" address regexp', attr.title('Matches if this regular expression matches (a substring of) the single address in the message From header.')),
+					dom.th('Message "To" address regexp', attr.title('Matches if this regular expression matches (a substring of) one of the addresses in the message To and Cc headers.')),
 					dom.th('Verified domain', attr.title('Matches if this domain matches an SPF- and/or DKIM-verified (sub)domain.')),
 					dom.th('Headers regexp', attr.title('Matches if these header field/value regular expressions all match (substrings of) the message headers. Header fields and valuees are converted to lower case before matching. Whitespace is trimmed from the value before matching. A header field can occur multiple times in a message, only one instance has to match. For mailing lists, you could match on ^list-id$ with the value typically the mailing list address in angled brackets with @ replaced with a dot, e.g. <name\\.lists\\.example\\.org>.')),
 					dom.th('Is Forward', attr.title("Influences spam filtering only, this option does not change whether a message matches this ruleset. Can only be used together with SMTPMailFromRegexp and VerifiedDomain. SMTPMailFromRegexp must be set to the address used to deliver the forwarded message, e.g. '^user(|\\+.*)@forward\\.example$'. Changes to junk analysis: 1. Messages are not rejected for failing a DMARC policy, because a legitimate forwarded message without valid/intact/aligned DKIM signature would be rejected because any verified SPF domain will be 'unaligned', of the forwarding mail server. 2. The sending mail server IP address, and sending EHLO and MAIL FROM domains and matching DKIM domain aren't used in future reputation-based spam classifications (but other verified DKIM domains are) because the forwarding server is not a useful spam signal for future messages.")),
 					dom.th('List allow domain', attr.title("Influences spam filtering only, this option does not change whether a message matches this ruleset. If this domain matches an SPF- and/or DKIM-verified (sub)domain, the message is accepted without further spam checks, such as a junk filter or DMARC reject evaluation. DMARC rejects should not apply for mailing lists that are not configured to rewrite the From-header of messages that don't have a passing DKIM signature of the From-domain. Otherwise, by rejecting messages, you may be automatically unsubscribed from the mailing list. The assumption is that mailing lists do their own spam filtering/moderation.")),
 					dom.th('Allow rejects to mailbox', attr.title("Influences spam filtering only, this option does not change whether a message matches this ruleset. If a message is classified as spam, it isn't rejected during the SMTP transaction (the normal behaviour), but accepted during the SMTP transaction and delivered to the specified mailbox. The specified mailbox is not automatically cleaned up like the account global Rejects mailbox, unless set to that Rejects mailbox.")),
-					dom.th('Mailbox', attr.title('Mailbox to deliver to if this ruleset matches.')),
+					dom.th('Mailbox', attr.title('Mailbox to deliver to if this ruleset matches. Required unless Discard is set.')),
+					dom.th('Mark read', attr.title('Mark the delivered message as read.')),
+					dom.th('Keywords', attr.title('Keywords to add to the delivered message, separated by spaces, e.g. to label newsletters. Must be lower case.')),
+					dom.th('Forward to', attr.title('Addresses to forward the message to, separated by commas, in addition to delivering it to the mailbox, unless Discard is set. Delivery failures are reported to this address. Messages classified as junk are not forwarded.')),
+					dom.th('Discard', attr.title('Accept the message, but do not store it, e.g. for messages that are only forwarded. Mailbox must be empty.')),
 					dom.th('Comment', attr.title('Free-form comments.')),
 					dom.th('Action'),
 				)
@@ -1882,18 +2127,23 @@ const destination = async (name: string) => {
 			rulesetsTbody,
 			dom.tfoot(
 				dom.tr(
-					dom.td(attr.colspan('9')),
+					dom.td(attr.colspan('14')),
 					dom.td(
 						dom.clickbutton('Add ruleset', function click() {
 							addRulesetsRow({
 								SMTPMailFromRegexp: '',
 								MsgFromRegexp: '',
+								MsgToRegexp: '',
 								VerifiedDomain: '',
 								HeadersRegexp: {},
 								IsForward: false,
 								ListAllowDomain: '',
 								AcceptRejectsToMailbox: '',
 								Mailbox: '',
+								Seen: false,
+								Keywords: [],
+								ForwardTo: [],
+								Discard: false,
 								Comment: '',
 								VerifiedDNSDomain: {ASCII: '', Unicode: ''},
 								ListAllowDNSDomain: {ASCII: '', Unicode: ''},
@@ -1912,12 +2162,17 @@ const destination = async (name: string) => {
 					return {
 						SMTPMailFromRegexp: row.smtpMailFromRegexp.value,
 						MsgFromRegexp: row.msgFromRegexp.value,
+						MsgToRegexp: row.msgToRegexp.value,
 						VerifiedDomain: row.verifiedDomain.value,
 						HeadersRegexp: Object.fromEntries(row.headers.map(h => [h.key.value, h.value.value])),
 						IsForward: row.isForward.checked,
 						ListAllowDomain: row.listAllowDomain.value,
 						AcceptRejectsToMailbox: row.acceptRejectsToMailbox.value,
 						Mailbox: row.mailbox.value,
+						Seen: row.seen.checked,
+						Keywords: row.keywords.value.split(' ').map(s => s.trim().toLowerCase()).filter(s => s),
+						ForwardTo: row.forwardTo.value.split(',').map(s => s.trim()).filter(s => s),
+						Discard: row.discard.checked,
 						Comment: row.comment.value,
 						VerifiedDNSDomain: {ASCII: '', Unicode: ''},
 						ListAllowDNSDomain: {ASCII: '', Unicode: ''},
@@ -1925,6 +2180,13 @@ const destination = async (name: string) => {
 				}),
 				SMTPError: smtpError.value,
 				MessageAuthRequiredSMTPError: msgAuthRequiredSMTPError.value,
+				Disabled: dest.Disabled,
+				DuplicateWindow: dest.DuplicateWindow,
+				Forward: forwardTo.value.trim() ? {
+					To: forwardTo.value.split(',').map(s => s.trim()).filter(s => s),
+					KeepCopy: forwardKeepCopy.checked,
+					Disabled: !forwardEnabled.checked,
+				} : null,
 			}
 			await check(saveButton, client.DestinationSave(name, dest, newDest))
 			window.location.reload() // todo: only refresh part of ui
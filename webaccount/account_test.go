@@ -282,7 +282,7 @@ func TestAccount(t *testing.T) {
 	}()
 
 	// Import mbox/maildir tgz/zip.
-	testImport := func(filename string, expect int) {
+	testImport := func(filename, dedup string, expect, expectSkipped int) {
 		t.Helper()
 
 		var reqBody bytes.Buffer
@@ -293,6 +293,10 @@ func TestAccount(t *testing.T) {
 		tcheck(t, err, "reading file")
 		_, err = part.Write(buf)
 		tcheck(t, err, "write part")
+		if dedup != "" {
+			err = mpw.WriteField("dedup", dedup)
+			tcheck(t, err, "write dedup field")
+		}
 		err = mpw.Close()
 		tcheck(t, err, "close multipart writer")
 
@@ -319,6 +323,7 @@ func TestAccount(t *testing.T) {
 			importers.Unregister <- &l
 		}()
 		count := 0
+		skipped := 0
 	loop:
 		for {
 			e := <-l.Events
@@ -332,6 +337,7 @@ func TestAccount(t *testing.T) {
 				t.Fatalf("unexpected problem: %q", x.Message)
 			case importStep:
 			case importDone:
+				skipped = x.Skipped
 				break loop
 			case importAborted:
 				t.Fatalf("unexpected aborted import")
@@ -342,9 +348,12 @@ func TestAccount(t *testing.T) {
 		if count != expect {
 			t.Fatalf("imported %d messages, expected %d", count, expect)
 		}
+		if skipped != expectSkipped {
+			t.Fatalf("skipped %d duplicate messages, expected %d", skipped, expectSkipped)
+		}
 	}
-	testImport(filepath.FromSlash("../testdata/importtest.mbox.zip"), 2)
-	testImport(filepath.FromSlash("../testdata/importtest.maildir.tgz"), 2)
+	testImport(filepath.FromSlash("../testdata/importtest.mbox.zip"), "", 2, 0)
+	testImport(filepath.FromSlash("../testdata/importtest.maildir.tgz"), "", 2, 0)
 
 	// Check there are messages, with the right flags.
 	acc.DB.Read(ctxbg, func(tx *bstore.Tx) error {
@@ -379,7 +388,7 @@ func TestAccount(t *testing.T) {
 		return nil
 	})
 
-	testExport := func(format, archive string, expectFiles int) {
+	testExport := func(format, archive string, expectFiles int, extra ...string) {
 		t.Helper()
 
 		fields := url.Values{
@@ -389,6 +398,9 @@ func TestAccount(t *testing.T) {
 			"mailbox":   []string{""},
 			"recursive": []string{"on"},
 		}
+		for i := 0; i+1 < len(extra); i += 2 {
+			fields.Set(extra[i], extra[i+1])
+		}
 		r := httptest.NewRequest("POST", "/export", strings.NewReader(fields.Encode()))
 		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 		r.Header.Add("Cookie", cookieOK.String())
@@ -437,6 +449,31 @@ func TestAccount(t *testing.T) {
 	testExport("maildir", "zip", 6)
 	testExport("mbox", "tar", 2+6) // 2 imported plus 6 default mailboxes (Inbox, Draft, etc)
 	testExport("mbox", "zip", 2+6)
+	testExport("eml", "zip", 4)
+	testExport("eml", "tgz", 2, "mailbox", "maildir")
+	testExport("eml", "zip", 4, "mailbox", "maildir\r\nimporttest\r\n")
+	testExport("eml", "zip", 0, "before", "2000-01-01")
+	testExport("eml", "zip", 2, "since", "2000-01-01", "notflags", `\Deleted`) // One message in each mailbox is marked deleted.
+	testExport("eml", "zip", 2, "flags", "custom")
+
+	// Importing again with deduplication skips all messages.
+	testImport(filepath.FromSlash("../testdata/importtest.mbox.zip"), "mailbox", 0, 2)
+
+	// Import pst, with messages in subfolders.
+	testImport(filepath.FromSlash("../testdata/importtest.pst"), "", 3, 0)
+	acc.DB.Read(ctxbg, func(tx *bstore.Tx) error {
+		mb, err := acc.MailboxFind(tx, "Archive-2020/Old")
+		tcheck(t, err, "looking up mailbox from pst")
+		if mb == nil {
+			t.Fatalf("missing mailbox Archive-2020/Old")
+		}
+		n, err := bstore.QueryTx[store.Message](tx).FilterNonzero(store.Message{MailboxID: mb.ID}).FilterEqual("Expunged", false).Count()
+		tcheck(t, err, "counting messages")
+		if n != 1 {
+			t.Fatalf("got %d messages in mailbox from pst, expected 1", n)
+		}
+		return nil
+	})
 
 	sl := api.SuppressionList(ctx)
 	tcompare(t, len(sl), 0)
@@ -452,6 +489,25 @@ func TestAccount(t *testing.T) {
 	tneedErrorCode(t, "user:error", func() { api.SuppressionRemove(ctx, "mjl@mox.example") }) // Absent.
 	tneedErrorCode(t, "user:error", func() { api.SuppressionRemove(ctx, "bogus") })           // Not an address.
 
+	tsl := api.TrustedSenders(ctx)
+	tcompare(t, len(tsl), 0)
+	tneedErrorCode(t, "user:error", func() { api.TrustedSenderRemove(ctx, 1) }) // Absent.
+
+	tcompare(t, api.SieveScriptGet(ctx), "")
+	api.SieveScriptSave(ctx, `require "fileinto"; fileinto "Lists";`)
+	tcompare(t, api.SieveScriptGet(ctx), `require "fileinto"; fileinto "Lists";`)
+	tneedErrorCode(t, "user:error", func() { api.SieveScriptSave(ctx, `fileinto "Lists";`) }) // Missing require.
+
+	vac := api.VacationGet(ctx, "mjl☺@mox.example")
+	tcompare(t, vac.Enabled, false)
+	vac.Enabled = true
+	vac.Body = "on vacation"
+	api.VacationSave(ctx, vac)
+	vac = api.VacationGet(ctx, "mjl☺@mox.example")
+	tcompare(t, vac.Enabled && vac.Body == "on vacation" && vac.ID != 0, true)
+	tneedErrorCode(t, "user:error", func() { api.VacationGet(ctx, "bogus@mox.example") })                                         // Not a destination.
+	tneedErrorCode(t, "user:error", func() { api.VacationSave(ctx, store.Vacation{Address: "mjl☺@mox.example", Enabled: true}) }) // Missing body.
+
 	var hooks int
 	hookServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		fmt.Fprintln(w, "ok")
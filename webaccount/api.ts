@@ -9,12 +9,18 @@ export interface Account {
 	KeepRetiredMessagePeriod: number
 	KeepRetiredWebhookPeriod: number
 	LoginDisabled: string
+	Suspended: string
+	SuspendedReject: boolean
+	LoginNetworks?: string[] | null
 	Domain: string
 	Description: string
 	FullName: string
+	Template: string
 	Destinations?: { [key: string]: Destination }
 	SubjectPass: SubjectPass
 	QuotaMessageSize: number
+	MaxAppendSize: number
+	MaxIMAPConnections: number
 	RejectsMailbox: string
 	KeepRejects: boolean
 	AutomaticJunkFlags: AutomaticJunkFlags
@@ -22,6 +28,13 @@ export interface Account {
 	MaxOutgoingMessagesPerDay: number
 	MaxFirstTimeRecipientsPerDay: number
 	NoFirstTimeSenderDelay: boolean
+	DuplicateWindow?: DuplicateWindow | null
+	AutoArchive?: AutoArchive | null
+	ArchiveTier?: ArchiveTier | null
+	MessageCompression?: MessageCompression | null
+	MessageEncryption?: MessageEncryption | null
+	SubmissionChecks?: SubmissionChecks | null
+	TLSClientAuth?: TLSClientAuth[] | null
 	NoCustomPassword: boolean
 	Routes?: Route[] | null
 	DNSDomain: Domain  // Parsed form of Domain.
@@ -45,17 +58,25 @@ export interface Destination {
 	SMTPError: string
 	MessageAuthRequiredSMTPError: string
 	FullName: string
+	Disabled: boolean
+	DuplicateWindow?: DuplicateWindow | null
+	Forward?: Forward | null
 }
 
 export interface Ruleset {
 	SMTPMailFromRegexp: string
 	MsgFromRegexp: string
+	MsgToRegexp: string
 	VerifiedDomain: string
 	HeadersRegexp?: { [key: string]: string }
 	IsForward: boolean  // todo: once we implement ARC, we can use dkim domains that we cannot verify but that the arc-verified forwarding mail server was able to verify.
 	ListAllowDomain: string
 	AcceptRejectsToMailbox: string
 	Mailbox: string
+	Seen: boolean
+	Keywords?: string[] | null
+	ForwardTo?: string[] | null
+	Discard: boolean
 	Comment: string
 	VerifiedDNSDomain: Domain
 	ListAllowDNSDomain: Domain
@@ -70,6 +91,17 @@ export interface Domain {
 	Unicode: string  // Name as U-labels, in Unicode NFC. Empty if this is an ASCII-only domain. No trailing dot.
 }
 
+export interface DuplicateWindow {
+	Period: number
+	Suppress: boolean
+}
+
+export interface Forward {
+	To?: string[] | null
+	KeepCopy: boolean
+	Disabled: boolean
+}
+
 export interface SubjectPass {
 	Period: number  // todo: have a reasonable default for this?
 }
@@ -92,11 +124,52 @@ export interface JunkFilter {
 	RareWords: number
 }
 
+export interface AutoArchive {
+	Age: number
+	Mailboxes?: string[] | null
+	Mailbox: string
+	SkipUnread: boolean
+	SkipFlagged: boolean
+}
+
+export interface ArchiveTier {
+	Age: number
+	MaxMessageSize: number
+}
+
+export interface MessageCompression {
+	Disabled: boolean
+	MinMessageSize: number
+	MaxMessageSize: number
+}
+
+export interface MessageEncryption {
+	KeyWrap: string
+}
+
+export interface SubmissionChecks {
+	RequireTo: boolean
+	RequireSubject: boolean
+	MaxRecipients: number
+	ConfirmRecipients: number
+}
+
+// TLSClientAuth maps a TLS client certificate to an account. Exactly one of
+// Fingerprint and Subject must be set.
+export interface TLSClientAuth {
+	Fingerprint: string
+	Subject: string
+	LoginAddress: string
+	NoIMAPPreauth: boolean
+}
+
 export interface Route {
 	FromDomain?: string[] | null
 	ToDomain?: string[] | null
 	MinimumAttempts: number
 	Transport: string
+	Failover?: string[] | null
+	FailoverErrors?: string[] | null
 	FromDomainASCII?: string[] | null
 	ToDomainASCII?: string[] | null
 }
@@ -112,9 +185,11 @@ export interface Alias {
 	PostPublic: boolean
 	ListMembers: boolean
 	AllowMsgFrom: boolean
+	ListUnsubscribe: boolean
 	LocalpartStr: string  // In encoded form.
 	Domain: Domain
-	ParsedAddresses?: AliasAddress[] | null  // Matches addresses.
+	ParsedAddresses?: AliasAddress[] | null  // Local addresses, matching accounts.
+	RemoteAddresses?: Address[] | null  // Addresses in domains not configured on this server.
 }
 
 export interface AliasAddress {
@@ -146,6 +221,75 @@ export interface ImportProgress {
 	Token: string  // For fetching progress, or cancelling an import.
 }
 
+// TrustedSender is an address this account has sent messages to. Like an address
+// book, incoming messages with the message From address of a trusted sender are
+// accepted without junk filtering and without a subjectpass challenge. Trusted
+// senders are added along with Recipient, but unlike Recipient, they are kept
+// when the sent messages are removed, and they can be reviewed and removed by the
+// user.
+export interface TrustedSender {
+	ID: number
+	Localpart: string  // Encoded localpart.
+	Domain: string  // Unicode string.
+	Created: Date
+	LastSent: Date
+	Count: number  // Number of sent messages with this address as recipient.
+}
+
+// JunkDecision records the inputs and outcome of the analysis of an incoming
+// message for an account, i.e. whether it was accepted or rejected as junk. For
+// analyzing and tuning the junk filter and reputation settings.
+// 
+// Address/DKIM/SPF/IP-based reputation is evaluated first. The content-based
+// junk filter is only evaluated when reputation was inconclusive and the account
+// has a junk filter. DNS block lists are only checked when the content looks
+// good.
+export interface JunkDecision {
+	ID: number
+	Time: Date
+	MessageID: string  // Message-ID header, with <>.
+	MailFrom: string  // SMTP MAIL FROM address.
+	MsgFrom: string  // Message From header address.
+	Recipient: string  // SMTP RCPT TO address.
+	RemoteIP: string
+	Subject: string
+	Accept: boolean  // Whether the message was accepted.
+	Mailbox: string  // Destination mailbox for accepted messages.
+	Reason: string  // As in the X-Mox-Reason header, e.g. "junk-content", "dns-blocklisted", "no-bad-signals", or a reputation method like "msgfromfull".
+	ReasonText?: string[] | null  // Human-readable details.
+	ReputationMethod: string  // E.g. "msgfromfull", "dkimspf", "ip1", "none".
+	ReputationJunk?: boolean | null  // Nil if no reputation could be determined.
+	ReputationConclusive: boolean
+	ContentAnalyzed: boolean  // Whether the junk filter was evaluated.
+	Probability: number  // Between 0 (ham) and 1 (spam).
+	Significant: boolean  // Whether enough known words were found to base a decision on.
+	Threshold: number  // Threshold used, can be stricter than configured.
+	HamWords?: WordScore[] | null  // Words contributing most to ham.
+	SpamWords?: WordScore[] | null  // Words contributing most to spam.
+	DNSBLZone: string  // DNS block list zone the remote IP was listed in, if any.
+}
+
+// WordScore is a word with its score as used in classifications, based on
+// (historic) training.
+export interface WordScore {
+	Word: string
+	Score: number  // 0 is ham, 1 is spam.
+}
+
+// Vacation is an out-of-office auto-responder for an address of the account. An
+// active vacation sends responses like the sieve vacation action.
+export interface Vacation {
+	ID: number
+	Address: string  // Canonical address of a destination, as in the account configuration.
+	Enabled: boolean  // Whether responses are sent. Also see Start and End.
+	Start?: Date | null  // If set, no responses are sent before this time.
+	End?: Date | null  // If set, no responses are sent after this time.
+	Subject: string  // Subject for responses, "Auto: " followed by original subject if empty.
+	Body: string  // Plain text.
+	Days: number  // Number of days during which no new response is sent to the same correspondent. Default 7.
+	Updated: Date
+}
+
 // Outgoing is the payload sent to webhook URLs for events about outgoing deliveries.
 export interface Outgoing {
 	Version: number  // Format of hook, currently 0.
@@ -223,6 +367,19 @@ export interface TLSPublicKey {
 	LoginAddress: string  // Must belong to account.
 }
 
+// OpenPGPKey is an OpenPGP public key published by an account for one of its
+// addresses, served through the Web Key Directory (WKD).
+export interface OpenPGPKey {
+	Address: string  // Canonical email address, the key has a user ID with this address.
+	Domain: string  // ASCII domain of Address.
+	WKDHash: string  // Of localpart of Address, see wkd.Hash.
+	Account: string
+	Fingerprint: string  // Upper-case hex.
+	Created: Date
+	Updated: Date
+	KeyData?: string | null  // Binary OpenPGP transferable public key.
+}
+
 // LoginAttempt is a successful or failed login attempt, stored for auditing
 // purposes.
 // 
@@ -288,41 +445,58 @@ export enum AuthResult {
 	AuthBadChannelBinding = "badchanbind",
 	AuthBadProtocol = "badprotocol",
 	AuthLoginDisabled = "logindisabled",
+	AuthNetworkDenied = "networkdenied",
+	AuthClientDenied = "clientdenied",
 	AuthError = "error",
 	AuthAborted = "aborted",
+	AuthLockedOut = "lockedout",
+	AuthTooManyConns = "toomanyconns",
 }
 
-export const structTypes: {[typename: string]: boolean} = {"Account":true,"Address":true,"AddressAlias":true,"Alias":true,"AliasAddress":true,"AutomaticJunkFlags":true,"Destination":true,"Domain":true,"ImportProgress":true,"Incoming":true,"IncomingMeta":true,"IncomingWebhook":true,"JunkFilter":true,"LoginAttempt":true,"NameAddress":true,"Outgoing":true,"OutgoingWebhook":true,"Route":true,"Ruleset":true,"Structure":true,"SubjectPass":true,"Suppression":true,"TLSPublicKey":true}
+export const structTypes: {[typename: string]: boolean} = {"Account":true,"Address":true,"AddressAlias":true,"Alias":true,"AliasAddress":true,"ArchiveTier":true,"AutoArchive":true,"AutomaticJunkFlags":true,"Destination":true,"Domain":true,"DuplicateWindow":true,"Forward":true,"ImportProgress":true,"Incoming":true,"IncomingMeta":true,"IncomingWebhook":true,"JunkDecision":true,"JunkFilter":true,"LoginAttempt":true,"MessageCompression":true,"MessageEncryption":true,"NameAddress":true,"OpenPGPKey":true,"Outgoing":true,"OutgoingWebhook":true,"Route":true,"Ruleset":true,"Structure":true,"SubjectPass":true,"SubmissionChecks":true,"Suppression":true,"TLSClientAuth":true,"TLSPublicKey":true,"TrustedSender":true,"Vacation":true,"WordScore":true}
 export const stringsTypes: {[typename: string]: boolean} = {"AuthResult":true,"CSRFToken":true,"Localpart":true,"OutgoingEvent":true}
 export const intsTypes: {[typename: string]: boolean} = {}
 export const types: TypenameMap = {
-	"Account": {"Name":"Account","Docs":"","Fields":[{"Name":"OutgoingWebhook","Docs":"","Typewords":["nullable","OutgoingWebhook"]},{"Name":"IncomingWebhook","Docs":"","Typewords":["nullable","IncomingWebhook"]},{"Name":"FromIDLoginAddresses","Docs":"","Typewords":["[]","string"]},{"Name":"KeepRetiredMessagePeriod","Docs":"","Typewords":["int64"]},{"Name":"KeepRetiredWebhookPeriod","Docs":"","Typewords":["int64"]},{"Name":"LoginDisabled","Docs":"","Typewords":["string"]},{"Name":"Domain","Docs":"","Typewords":["string"]},{"Name":"Description","Docs":"","Typewords":["string"]},{"Name":"FullName","Docs":"","Typewords":["string"]},{"Name":"Destinations","Docs":"","Typewords":["{}","Destination"]},{"Name":"SubjectPass","Docs":"","Typewords":["SubjectPass"]},{"Name":"QuotaMessageSize","Docs":"","Typewords":["int64"]},{"Name":"RejectsMailbox","Docs":"","Typewords":["string"]},{"Name":"KeepRejects","Docs":"","Typewords":["bool"]},{"Name":"AutomaticJunkFlags","Docs":"","Typewords":["AutomaticJunkFlags"]},{"Name":"JunkFilter","Docs":"","Typewords":["nullable","JunkFilter"]},{"Name":"MaxOutgoingMessagesPerDay","Docs":"","Typewords":["int32"]},{"Name":"MaxFirstTimeRecipientsPerDay","Docs":"","Typewords":["int32"]},{"Name":"NoFirstTimeSenderDelay","Docs":"","Typewords":["bool"]},{"Name":"NoCustomPassword","Docs":"","Typewords":["bool"]},{"Name":"Routes","Docs":"","Typewords":["[]","Route"]},{"Name":"DNSDomain","Docs":"","Typewords":["Domain"]},{"Name":"Aliases","Docs":"","Typewords":["[]","AddressAlias"]}]},
+	"Account": {"Name":"Account","Docs":"","Fields":[{"Name":"OutgoingWebhook","Docs":"","Typewords":["nullable","OutgoingWebhook"]},{"Name":"IncomingWebhook","Docs":"","Typewords":["nullable","IncomingWebhook"]},{"Name":"FromIDLoginAddresses","Docs":"","Typewords":["[]","string"]},{"Name":"KeepRetiredMessagePeriod","Docs":"","Typewords":["int64"]},{"Name":"KeepRetiredWebhookPeriod","Docs":"","Typewords":["int64"]},{"Name":"LoginDisabled","Docs":"","Typewords":["string"]},{"Name":"Suspended","Docs":"","Typewords":["string"]},{"Name":"SuspendedReject","Docs":"","Typewords":["bool"]},{"Name":"LoginNetworks","Docs":"","Typewords":["[]","string"]},{"Name":"Domain","Docs":"","Typewords":["string"]},{"Name":"Description","Docs":"","Typewords":["string"]},{"Name":"FullName","Docs":"","Typewords":["string"]},{"Name":"Template","Docs":"","Typewords":["string"]},{"Name":"Destinations","Docs":"","Typewords":["{}","Destination"]},{"Name":"SubjectPass","Docs":"","Typewords":["SubjectPass"]},{"Name":"QuotaMessageSize","Docs":"","Typewords":["int64"]},{"Name":"MaxAppendSize","Docs":"","Typewords":["int64"]},{"Name":"MaxIMAPConnections","Docs":"","Typewords":["int32"]},{"Name":"RejectsMailbox","Docs":"","Typewords":["string"]},{"Name":"KeepRejects","Docs":"","Typewords":["bool"]},{"Name":"AutomaticJunkFlags","Docs":"","Typewords":["AutomaticJunkFlags"]},{"Name":"JunkFilter","Docs":"","Typewords":["nullable","JunkFilter"]},{"Name":"MaxOutgoingMessagesPerDay","Docs":"","Typewords":["int32"]},{"Name":"MaxFirstTimeRecipientsPerDay","Docs":"","Typewords":["int32"]},{"Name":"NoFirstTimeSenderDelay","Docs":"","Typewords":["bool"]},{"Name":"DuplicateWindow","Docs":"","Typewords":["nullable","DuplicateWindow"]},{"Name":"AutoArchive","Docs":"","Typewords":["nullable","AutoArchive"]},{"Name":"ArchiveTier","Docs":"","Typewords":["nullable","ArchiveTier"]},{"Name":"MessageCompression","Docs":"","Typewords":["nullable","MessageCompression"]},{"Name":"MessageEncryption","Docs":"","Typewords":["nullable","MessageEncryption"]},{"Name":"SubmissionChecks","Docs":"","Typewords":["nullable","SubmissionChecks"]},{"Name":"TLSClientAuth","Docs":"","Typewords":["[]","TLSClientAuth"]},{"Name":"NoCustomPassword","Docs":"","Typewords":["bool"]},{"Name":"Routes","Docs":"","Typewords":["[]","Route"]},{"Name":"DNSDomain","Docs":"","Typewords":["Domain"]},{"Name":"Aliases","Docs":"","Typewords":["[]","AddressAlias"]}]},
 	"OutgoingWebhook": {"Name":"OutgoingWebhook","Docs":"","Fields":[{"Name":"URL","Docs":"","Typewords":["string"]},{"Name":"Authorization","Docs":"","Typewords":["string"]},{"Name":"Events","Docs":"","Typewords":["[]","string"]}]},
 	"IncomingWebhook": {"Name":"IncomingWebhook","Docs":"","Fields":[{"Name":"URL","Docs":"","Typewords":["string"]},{"Name":"Authorization","Docs":"","Typewords":["string"]}]},
-	"Destination": {"Name":"Destination","Docs":"","Fields":[{"Name":"Mailbox","Docs":"","Typewords":["string"]},{"Name":"Rulesets","Docs":"","Typewords":["[]","Ruleset"]},{"Name":"SMTPError","Docs":"","Typewords":["string"]},{"Name":"MessageAuthRequiredSMTPError","Docs":"","Typewords":["string"]},{"Name":"FullName","Docs":"","Typewords":["string"]}]},
-	"Ruleset": {"Name":"Ruleset","Docs":"","Fields":[{"Name":"SMTPMailFromRegexp","Docs":"","Typewords":["string"]},{"Name":"MsgFromRegexp","Docs":"","Typewords":["string"]},{"Name":"VerifiedDomain","Docs":"","Typewords":["string"]},{"Name":"HeadersRegexp","Docs":"","Typewords":["{}","string"]},{"Name":"IsForward","Docs":"","Typewords":["bool"]},{"Name":"ListAllowDomain","Docs":"","Typewords":["string"]},{"Name":"AcceptRejectsToMailbox","Docs":"","Typewords":["string"]},{"Name":"Mailbox","Docs":"","Typewords":["string"]},{"Name":"Comment","Docs":"","Typewords":["string"]},{"Name":"VerifiedDNSDomain","Docs":"","Typewords":["Domain"]},{"Name":"ListAllowDNSDomain","Docs":"","Typewords":["Domain"]}]},
+	"Destination": {"Name":"Destination","Docs":"","Fields":[{"Name":"Mailbox","Docs":"","Typewords":["string"]},{"Name":"Rulesets","Docs":"","Typewords":["[]","Ruleset"]},{"Name":"SMTPError","Docs":"","Typewords":["string"]},{"Name":"MessageAuthRequiredSMTPError","Docs":"","Typewords":["string"]},{"Name":"FullName","Docs":"","Typewords":["string"]},{"Name":"Disabled","Docs":"","Typewords":["bool"]},{"Name":"DuplicateWindow","Docs":"","Typewords":["nullable","DuplicateWindow"]},{"Name":"Forward","Docs":"","Typewords":["nullable","Forward"]}]},
+	"Ruleset": {"Name":"Ruleset","Docs":"","Fields":[{"Name":"SMTPMailFromRegexp","Docs":"","Typewords":["string"]},{"Name":"MsgFromRegexp","Docs":"","Typewords":["string"]},{"Name":"MsgToRegexp","Docs":"","Typewords":["string"]},{"Name":"VerifiedDomain","Docs":"","Typewords":["string"]},{"Name":"HeadersRegexp","Docs":"","Typewords":["{}","string"]},{"Name":"IsForward","Docs":"","Typewords":["bool"]},{"Name":"ListAllowDomain","Docs":"","Typewords":["string"]},{"Name":"AcceptRejectsToMailbox","Docs":"","Typewords":["string"]},{"Name":"Mailbox","Docs":"","Typewords":["string"]},{"Name":"Seen","Docs":"","Typewords":["bool"]},{"Name":"Keywords","Docs":"","Typewords":["[]","string"]},{"Name":"ForwardTo","Docs":"","Typewords":["[]","string"]},{"Name":"Discard","Docs":"","Typewords":["bool"]},{"Name":"Comment","Docs":"","Typewords":["string"]},{"Name":"VerifiedDNSDomain","Docs":"","Typewords":["Domain"]},{"Name":"ListAllowDNSDomain","Docs":"","Typewords":["Domain"]}]},
 	"Domain": {"Name":"Domain","Docs":"","Fields":[{"Name":"ASCII","Docs":"","Typewords":["string"]},{"Name":"Unicode","Docs":"","Typewords":["string"]}]},
+	"DuplicateWindow": {"Name":"DuplicateWindow","Docs":"","Fields":[{"Name":"Period","Docs":"","Typewords":["int64"]},{"Name":"Suppress","Docs":"","Typewords":["bool"]}]},
+	"Forward": {"Name":"Forward","Docs":"","Fields":[{"Name":"To","Docs":"","Typewords":["[]","string"]},{"Name":"KeepCopy","Docs":"","Typewords":["bool"]},{"Name":"Disabled","Docs":"","Typewords":["bool"]}]},
 	"SubjectPass": {"Name":"SubjectPass","Docs":"","Fields":[{"Name":"Period","Docs":"","Typewords":["int64"]}]},
 	"AutomaticJunkFlags": {"Name":"AutomaticJunkFlags","Docs":"","Fields":[{"Name":"Enabled","Docs":"","Typewords":["bool"]},{"Name":"JunkMailboxRegexp","Docs":"","Typewords":["string"]},{"Name":"NeutralMailboxRegexp","Docs":"","Typewords":["string"]},{"Name":"NotJunkMailboxRegexp","Docs":"","Typewords":["string"]}]},
 	"JunkFilter": {"Name":"JunkFilter","Docs":"","Fields":[{"Name":"Threshold","Docs":"","Typewords":["float64"]},{"Name":"Onegrams","Docs":"","Typewords":["bool"]},{"Name":"Twograms","Docs":"","Typewords":["bool"]},{"Name":"Threegrams","Docs":"","Typewords":["bool"]},{"Name":"MaxPower","Docs":"","Typewords":["float64"]},{"Name":"TopWords","Docs":"","Typewords":["int32"]},{"Name":"IgnoreWords","Docs":"","Typewords":["float64"]},{"Name":"RareWords","Docs":"","Typewords":["int32"]}]},
-	"Route": {"Name":"Route","Docs":"","Fields":[{"Name":"FromDomain","Docs":"","Typewords":["[]","string"]},{"Name":"ToDomain","Docs":"","Typewords":["[]","string"]},{"Name":"MinimumAttempts","Docs":"","Typewords":["int32"]},{"Name":"Transport","Docs":"","Typewords":["string"]},{"Name":"FromDomainASCII","Docs":"","Typewords":["[]","string"]},{"Name":"ToDomainASCII","Docs":"","Typewords":["[]","string"]}]},
+	"AutoArchive": {"Name":"AutoArchive","Docs":"","Fields":[{"Name":"Age","Docs":"","Typewords":["int64"]},{"Name":"Mailboxes","Docs":"","Typewords":["[]","string"]},{"Name":"Mailbox","Docs":"","Typewords":["string"]},{"Name":"SkipUnread","Docs":"","Typewords":["bool"]},{"Name":"SkipFlagged","Docs":"","Typewords":["bool"]}]},
+	"ArchiveTier": {"Name":"ArchiveTier","Docs":"","Fields":[{"Name":"Age","Docs":"","Typewords":["int64"]},{"Name":"MaxMessageSize","Docs":"","Typewords":["int64"]}]},
+	"MessageCompression": {"Name":"MessageCompression","Docs":"","Fields":[{"Name":"Disabled","Docs":"","Typewords":["bool"]},{"Name":"MinMessageSize","Docs":"","Typewords":["int64"]},{"Name":"MaxMessageSize","Docs":"","Typewords":["int64"]}]},
+	"MessageEncryption": {"Name":"MessageEncryption","Docs":"","Fields":[{"Name":"KeyWrap","Docs":"","Typewords":["string"]}]},
+	"SubmissionChecks": {"Name":"SubmissionChecks","Docs":"","Fields":[{"Name":"RequireTo","Docs":"","Typewords":["bool"]},{"Name":"RequireSubject","Docs":"","Typewords":["bool"]},{"Name":"MaxRecipients","Docs":"","Typewords":["int32"]},{"Name":"ConfirmRecipients","Docs":"","Typewords":["int32"]}]},
+	"TLSClientAuth": {"Name":"TLSClientAuth","Docs":"","Fields":[{"Name":"Fingerprint","Docs":"","Typewords":["string"]},{"Name":"Subject","Docs":"","Typewords":["string"]},{"Name":"LoginAddress","Docs":"","Typewords":["string"]},{"Name":"NoIMAPPreauth","Docs":"","Typewords":["bool"]}]},
+	"Route": {"Name":"Route","Docs":"","Fields":[{"Name":"FromDomain","Docs":"","Typewords":["[]","string"]},{"Name":"ToDomain","Docs":"","Typewords":["[]","string"]},{"Name":"MinimumAttempts","Docs":"","Typewords":["int32"]},{"Name":"Transport","Docs":"","Typewords":["string"]},{"Name":"Failover","Docs":"","Typewords":["[]","string"]},{"Name":"FailoverErrors","Docs":"","Typewords":["[]","string"]},{"Name":"FromDomainASCII","Docs":"","Typewords":["[]","string"]},{"Name":"ToDomainASCII","Docs":"","Typewords":["[]","string"]}]},
 	"AddressAlias": {"Name":"AddressAlias","Docs":"","Fields":[{"Name":"SubscriptionAddress","Docs":"","Typewords":["string"]},{"Name":"Alias","Docs":"","Typewords":["Alias"]},{"Name":"MemberAddresses","Docs":"","Typewords":["[]","string"]}]},
-	"Alias": {"Name":"Alias","Docs":"","Fields":[{"Name":"Addresses","Docs":"","Typewords":["[]","string"]},{"Name":"PostPublic","Docs":"","Typewords":["bool"]},{"Name":"ListMembers","Docs":"","Typewords":["bool"]},{"Name":"AllowMsgFrom","Docs":"","Typewords":["bool"]},{"Name":"LocalpartStr","Docs":"","Typewords":["string"]},{"Name":"Domain","Docs":"","Typewords":["Domain"]},{"Name":"ParsedAddresses","Docs":"","Typewords":["[]","AliasAddress"]}]},
+	"Alias": {"Name":"Alias","Docs":"","Fields":[{"Name":"Addresses","Docs":"","Typewords":["[]","string"]},{"Name":"PostPublic","Docs":"","Typewords":["bool"]},{"Name":"ListMembers","Docs":"","Typewords":["bool"]},{"Name":"AllowMsgFrom","Docs":"","Typewords":["bool"]},{"Name":"ListUnsubscribe","Docs":"","Typewords":["bool"]},{"Name":"LocalpartStr","Docs":"","Typewords":["string"]},{"Name":"Domain","Docs":"","Typewords":["Domain"]},{"Name":"ParsedAddresses","Docs":"","Typewords":["[]","AliasAddress"]},{"Name":"RemoteAddresses","Docs":"","Typewords":["[]","Address"]}]},
 	"AliasAddress": {"Name":"AliasAddress","Docs":"","Fields":[{"Name":"Address","Docs":"","Typewords":["Address"]},{"Name":"AccountName","Docs":"","Typewords":["string"]},{"Name":"Destination","Docs":"","Typewords":["Destination"]}]},
 	"Address": {"Name":"Address","Docs":"","Fields":[{"Name":"Localpart","Docs":"","Typewords":["Localpart"]},{"Name":"Domain","Docs":"","Typewords":["Domain"]}]},
 	"Suppression": {"Name":"Suppression","Docs":"","Fields":[{"Name":"ID","Docs":"","Typewords":["int64"]},{"Name":"Created","Docs":"","Typewords":["timestamp"]},{"Name":"Account","Docs":"","Typewords":["string"]},{"Name":"BaseAddress","Docs":"","Typewords":["string"]},{"Name":"OriginalAddress","Docs":"","Typewords":["string"]},{"Name":"Manual","Docs":"","Typewords":["bool"]},{"Name":"Reason","Docs":"","Typewords":["string"]}]},
 	"ImportProgress": {"Name":"ImportProgress","Docs":"","Fields":[{"Name":"Token","Docs":"","Typewords":["string"]}]},
+	"TrustedSender": {"Name":"TrustedSender","Docs":"","Fields":[{"Name":"ID","Docs":"","Typewords":["int64"]},{"Name":"Localpart","Docs":"","Typewords":["string"]},{"Name":"Domain","Docs":"","Typewords":["string"]},{"Name":"Created","Docs":"","Typewords":["timestamp"]},{"Name":"LastSent","Docs":"","Typewords":["timestamp"]},{"Name":"Count","Docs":"","Typewords":["int32"]}]},
+	"JunkDecision": {"Name":"JunkDecision","Docs":"","Fields":[{"Name":"ID","Docs":"","Typewords":["int64"]},{"Name":"Time","Docs":"","Typewords":["timestamp"]},{"Name":"MessageID","Docs":"","Typewords":["string"]},{"Name":"MailFrom","Docs":"","Typewords":["string"]},{"Name":"MsgFrom","Docs":"","Typewords":["string"]},{"Name":"Recipient","Docs":"","Typewords":["string"]},{"Name":"RemoteIP","Docs":"","Typewords":["string"]},{"Name":"Subject","Docs":"","Typewords":["string"]},{"Name":"Accept","Docs":"","Typewords":["bool"]},{"Name":"Mailbox","Docs":"","Typewords":["string"]},{"Name":"Reason","Docs":"","Typewords":["string"]},{"Name":"ReasonText","Docs":"","Typewords":["[]","string"]},{"Name":"ReputationMethod","Docs":"","Typewords":["string"]},{"Name":"ReputationJunk","Docs":"","Typewords":["nullable","bool"]},{"Name":"ReputationConclusive","Docs":"","Typewords":["bool"]},{"Name":"ContentAnalyzed","Docs":"","Typewords":["bool"]},{"Name":"Probability","Docs":"","Typewords":["float64"]},{"Name":"Significant","Docs":"","Typewords":["bool"]},{"Name":"Threshold","Docs":"","Typewords":["float64"]},{"Name":"HamWords","Docs":"","Typewords":["[]","WordScore"]},{"Name":"SpamWords","Docs":"","Typewords":["[]","WordScore"]},{"Name":"DNSBLZone","Docs":"","Typewords":["string"]}]},
+	"WordScore": {"Name":"WordScore","Docs":"","Fields":[{"Name":"Word","Docs":"","Typewords":["string"]},{"Name":"Score","Docs":"","Typewords":["float64"]}]},
+	"Vacation": {"Name":"Vacation","Docs":"","Fields":[{"Name":"ID","Docs":"","Typewords":["int64"]},{"Name":"Address","Docs":"","Typewords":["string"]},{"Name":"Enabled","Docs":"","Typewords":["bool"]},{"Name":"Start","Docs":"","Typewords":["nullable","timestamp"]},{"Name":"End","Docs":"","Typewords":["nullable","timestamp"]},{"Name":"Subject","Docs":"","Typewords":["string"]},{"Name":"Body","Docs":"","Typewords":["string"]},{"Name":"Days","Docs":"","Typewords":["int32"]},{"Name":"Updated","Docs":"","Typewords":["timestamp"]}]},
 	"Outgoing": {"Name":"Outgoing","Docs":"","Fields":[{"Name":"Version","Docs":"","Typewords":["int32"]},{"Name":"Event","Docs":"","Typewords":["OutgoingEvent"]},{"Name":"DSN","Docs":"","Typewords":["bool"]},{"Name":"Suppressing","Docs":"","Typewords":["bool"]},{"Name":"QueueMsgID","Docs":"","Typewords":["int64"]},{"Name":"FromID","Docs":"","Typewords":["string"]},{"Name":"MessageID","Docs":"","Typewords":["string"]},{"Name":"Subject","Docs":"","Typewords":["string"]},{"Name":"WebhookQueued","Docs":"","Typewords":["timestamp"]},{"Name":"SMTPCode","Docs":"","Typewords":["int32"]},{"Name":"SMTPEnhancedCode","Docs":"","Typewords":["string"]},{"Name":"Error","Docs":"","Typewords":["string"]},{"Name":"Extra","Docs":"","Typewords":["{}","string"]}]},
 	"Incoming": {"Name":"Incoming","Docs":"","Fields":[{"Name":"Version","Docs":"","Typewords":["int32"]},{"Name":"From","Docs":"","Typewords":["[]","NameAddress"]},{"Name":"To","Docs":"","Typewords":["[]","NameAddress"]},{"Name":"CC","Docs":"","Typewords":["[]","NameAddress"]},{"Name":"BCC","Docs":"","Typewords":["[]","NameAddress"]},{"Name":"ReplyTo","Docs":"","Typewords":["[]","NameAddress"]},{"Name":"Subject","Docs":"","Typewords":["string"]},{"Name":"MessageID","Docs":"","Typewords":["string"]},{"Name":"InReplyTo","Docs":"","Typewords":["string"]},{"Name":"References","Docs":"","Typewords":["[]","string"]},{"Name":"Date","Docs":"","Typewords":["nullable","timestamp"]},{"Name":"Text","Docs":"","Typewords":["string"]},{"Name":"HTML","Docs":"","Typewords":["string"]},{"Name":"Structure","Docs":"","Typewords":["Structure"]},{"Name":"Meta","Docs":"","Typewords":["IncomingMeta"]}]},
 	"NameAddress": {"Name":"NameAddress","Docs":"","Fields":[{"Name":"Name","Docs":"","Typewords":["string"]},{"Name":"Address","Docs":"","Typewords":["string"]}]},
 	"Structure": {"Name":"Structure","Docs":"","Fields":[{"Name":"ContentType","Docs":"","Typewords":["string"]},{"Name":"ContentTypeParams","Docs":"","Typewords":["{}","string"]},{"Name":"ContentID","Docs":"","Typewords":["string"]},{"Name":"ContentDisposition","Docs":"","Typewords":["string"]},{"Name":"Filename","Docs":"","Typewords":["string"]},{"Name":"DecodedSize","Docs":"","Typewords":["int64"]},{"Name":"Parts","Docs":"","Typewords":["[]","Structure"]}]},
 	"IncomingMeta": {"Name":"IncomingMeta","Docs":"","Fields":[{"Name":"MsgID","Docs":"","Typewords":["int64"]},{"Name":"MailFrom","Docs":"","Typewords":["string"]},{"Name":"MailFromValidated","Docs":"","Typewords":["bool"]},{"Name":"MsgFromValidated","Docs":"","Typewords":["bool"]},{"Name":"RcptTo","Docs":"","Typewords":["string"]},{"Name":"DKIMVerifiedDomains","Docs":"","Typewords":["[]","string"]},{"Name":"RemoteIP","Docs":"","Typewords":["string"]},{"Name":"Received","Docs":"","Typewords":["timestamp"]},{"Name":"MailboxName","Docs":"","Typewords":["string"]},{"Name":"Automated","Docs":"","Typewords":["bool"]}]},
 	"TLSPublicKey": {"Name":"TLSPublicKey","Docs":"","Fields":[{"Name":"Fingerprint","Docs":"","Typewords":["string"]},{"Name":"Created","Docs":"","Typewords":["timestamp"]},{"Name":"Type","Docs":"","Typewords":["string"]},{"Name":"Name","Docs":"","Typewords":["string"]},{"Name":"NoIMAPPreauth","Docs":"","Typewords":["bool"]},{"Name":"CertDER","Docs":"","Typewords":["nullable","string"]},{"Name":"Account","Docs":"","Typewords":["string"]},{"Name":"LoginAddress","Docs":"","Typewords":["string"]}]},
+	"OpenPGPKey": {"Name":"OpenPGPKey","Docs":"","Fields":[{"Name":"Address","Docs":"","Typewords":["string"]},{"Name":"Domain","Docs":"","Typewords":["string"]},{"Name":"WKDHash","Docs":"","Typewords":["string"]},{"Name":"Account","Docs":"","Typewords":["string"]},{"Name":"Fingerprint","Docs":"","Typewords":["string"]},{"Name":"Created","Docs":"","Typewords":["timestamp"]},{"Name":"Updated","Docs":"","Typewords":["timestamp"]},{"Name":"KeyData","Docs":"","Typewords":["nullable","string"]}]},
 	"LoginAttempt": {"Name":"LoginAttempt","Docs":"","Fields":[{"Name":"Key","Docs":"","Typewords":["nullable","string"]},{"Name":"Last","Docs":"","Typewords":["timestamp"]},{"Name":"First","Docs":"","Typewords":["timestamp"]},{"Name":"Count","Docs":"","Typewords":["int64"]},{"Name":"AccountName","Docs":"","Typewords":["string"]},{"Name":"LoginAddress","Docs":"","Typewords":["string"]},{"Name":"RemoteIP","Docs":"","Typewords":["string"]},{"Name":"LocalIP","Docs":"","Typewords":["string"]},{"Name":"TLS","Docs":"","Typewords":["string"]},{"Name":"TLSPubKeyFingerprint","Docs":"","Typewords":["string"]},{"Name":"Protocol","Docs":"","Typewords":["string"]},{"Name":"UserAgent","Docs":"","Typewords":["string"]},{"Name":"AuthMech","Docs":"","Typewords":["string"]},{"Name":"Result","Docs":"","Typewords":["AuthResult"]}]},
 	"CSRFToken": {"Name":"CSRFToken","Docs":"","Values":null},
 	"Localpart": {"Name":"Localpart","Docs":"","Values":null},
 	"OutgoingEvent": {"Name":"OutgoingEvent","Docs":"","Values":[{"Name":"EventDelivered","Value":"delivered","Docs":""},{"Name":"EventSuppressed","Value":"suppressed","Docs":""},{"Name":"EventDelayed","Value":"delayed","Docs":""},{"Name":"EventFailed","Value":"failed","Docs":""},{"Name":"EventRelayed","Value":"relayed","Docs":""},{"Name":"EventExpanded","Value":"expanded","Docs":""},{"Name":"EventCanceled","Value":"canceled","Docs":""},{"Name":"EventUnrecognized","Value":"unrecognized","Docs":""}]},
-	"AuthResult": {"Name":"AuthResult","Docs":"","Values":[{"Name":"AuthSuccess","Value":"ok","Docs":""},{"Name":"AuthBadUser","Value":"baduser","Docs":""},{"Name":"AuthBadPassword","Value":"badpassword","Docs":""},{"Name":"AuthBadCredentials","Value":"badcreds","Docs":""},{"Name":"AuthBadChannelBinding","Value":"badchanbind","Docs":""},{"Name":"AuthBadProtocol","Value":"badprotocol","Docs":""},{"Name":"AuthLoginDisabled","Value":"logindisabled","Docs":""},{"Name":"AuthError","Value":"error","Docs":""},{"Name":"AuthAborted","Value":"aborted","Docs":""}]},
+	"AuthResult": {"Name":"AuthResult","Docs":"","Values":[{"Name":"AuthSuccess","Value":"ok","Docs":""},{"Name":"AuthBadUser","Value":"baduser","Docs":""},{"Name":"AuthBadPassword","Value":"badpassword","Docs":""},{"Name":"AuthBadCredentials","Value":"badcreds","Docs":""},{"Name":"AuthBadChannelBinding","Value":"badchanbind","Docs":""},{"Name":"AuthBadProtocol","Value":"badprotocol","Docs":""},{"Name":"AuthLoginDisabled","Value":"logindisabled","Docs":""},{"Name":"AuthNetworkDenied","Value":"networkdenied","Docs":""},{"Name":"AuthClientDenied","Value":"clientdenied","Docs":""},{"Name":"AuthError","Value":"error","Docs":""},{"Name":"AuthAborted","Value":"aborted","Docs":""},{"Name":"AuthLockedOut","Value":"lockedout","Docs":""},{"Name":"AuthTooManyConns","Value":"toomanyconns","Docs":""}]},
 }
 
 export const parser = {
@@ -332,9 +506,17 @@ export const parser = {
 	Destination: (v: any) => parse("Destination", v) as Destination,
 	Ruleset: (v: any) => parse("Ruleset", v) as Ruleset,
 	Domain: (v: any) => parse("Domain", v) as Domain,
+	DuplicateWindow: (v: any) => parse("DuplicateWindow", v) as DuplicateWindow,
+	Forward: (v: any) => parse("Forward", v) as Forward,
 	SubjectPass: (v: any) => parse("SubjectPass", v) as SubjectPass,
 	AutomaticJunkFlags: (v: any) => parse("AutomaticJunkFlags", v) as AutomaticJunkFlags,
 	JunkFilter: (v: any) => parse("JunkFilter", v) as JunkFilter,
+	AutoArchive: (v: any) => parse("AutoArchive", v) as AutoArchive,
+	ArchiveTier: (v: any) => parse("ArchiveTier", v) as ArchiveTier,
+	MessageCompression: (v: any) => parse("MessageCompression", v) as MessageCompression,
+	MessageEncryption: (v: any) => parse("MessageEncryption", v) as MessageEncryption,
+	SubmissionChecks: (v: any) => parse("SubmissionChecks", v) as SubmissionChecks,
+	TLSClientAuth: (v: any) => parse("TLSClientAuth", v) as TLSClientAuth,
 	Route: (v: any) => parse("Route", v) as Route,
 	AddressAlias: (v: any) => parse("AddressAlias", v) as AddressAlias,
 	Alias: (v: any) => parse("Alias", v) as Alias,
@@ -342,12 +524,17 @@ export const parser = {
 	Address: (v: any) => parse("Address", v) as Address,
 	Suppression: (v: any) => parse("Suppression", v) as Suppression,
 	ImportProgress: (v: any) => parse("ImportProgress", v) as ImportProgress,
+	TrustedSender: (v: any) => parse("TrustedSender", v) as TrustedSender,
+	JunkDecision: (v: any) => parse("JunkDecision", v) as JunkDecision,
+	WordScore: (v: any) => parse("WordScore", v) as WordScore,
+	Vacation: (v: any) => parse("Vacation", v) as Vacation,
 	Outgoing: (v: any) => parse("Outgoing", v) as Outgoing,
 	Incoming: (v: any) => parse("Incoming", v) as Incoming,
 	NameAddress: (v: any) => parse("NameAddress", v) as NameAddress,
 	Structure: (v: any) => parse("Structure", v) as Structure,
 	IncomingMeta: (v: any) => parse("IncomingMeta", v) as IncomingMeta,
 	TLSPublicKey: (v: any) => parse("TLSPublicKey", v) as TLSPublicKey,
+	OpenPGPKey: (v: any) => parse("OpenPGPKey", v) as OpenPGPKey,
 	LoginAttempt: (v: any) => parse("LoginAttempt", v) as LoginAttempt,
 	CSRFToken: (v: any) => parse("CSRFToken", v) as CSRFToken,
 	Localpart: (v: any) => parse("Localpart", v) as Localpart,
@@ -420,7 +607,8 @@ export class Client {
 	// Sessions are not interrupted, and will keep working. New login attempts must use
 	// the new password.
 	// 
-	// Password must be at least 8 characters.
+	// Password must be at least 8 characters, and meet the password policy from the
+	// configuration.
 	// 
 	// Setting a user-supplied password is not allowed if NoCustomPassword is set
 	// for the account.
@@ -520,6 +708,82 @@ export class Client {
 		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as void
 	}
 
+	// TrustedSenders returns the addresses this account has sent messages to, whose
+	// messages are accepted without junk filtering.
+	async TrustedSenders(): Promise<TrustedSender[] | null> {
+		const fn: string = "TrustedSenders"
+		const paramTypes: string[][] = []
+		const returnTypes: string[][] = [["[]","TrustedSender"]]
+		const params: any[] = []
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as TrustedSender[] | null
+	}
+
+	// TrustedSenderRemove removes a trusted sender by id. Future messages from the
+	// address are subject to junk filtering again, unless it is added again by
+	// sending a message to it.
+	async TrustedSenderRemove(id: number): Promise<void> {
+		const fn: string = "TrustedSenderRemove"
+		const paramTypes: string[][] = [["int64"]]
+		const returnTypes: string[][] = []
+		const params: any[] = [id]
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as void
+	}
+
+	// JunkDecisions returns the most recent decisions about incoming messages, i.e.
+	// whether they were accepted or rejected as junk, with the reputation, junk
+	// filter and DNS block list inputs. For analyzing false positives/negatives. At
+	// most limit decisions are returned, if greater than 0.
+	async JunkDecisions(limit: number): Promise<JunkDecision[] | null> {
+		const fn: string = "JunkDecisions"
+		const paramTypes: string[][] = [["int32"]]
+		const returnTypes: string[][] = [["[]","JunkDecision"]]
+		const params: any[] = [limit]
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as JunkDecision[] | null
+	}
+
+	// SieveScriptGet returns the active sieve script, evaluated for incoming
+	// messages that don't match a ruleset. Empty if there is no active script.
+	async SieveScriptGet(): Promise<string> {
+		const fn: string = "SieveScriptGet"
+		const paramTypes: string[][] = []
+		const returnTypes: string[][] = [["string"]]
+		const params: any[] = []
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as string
+	}
+
+	// SieveScriptSave checks and saves the sieve script as the active script,
+	// replacing the current active script, or creating a script named "default".
+	async SieveScriptSave(script: string): Promise<void> {
+		const fn: string = "SieveScriptSave"
+		const paramTypes: string[][] = [["string"]]
+		const returnTypes: string[][] = []
+		const params: any[] = [script]
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as void
+	}
+
+	// VacationGet returns the out-of-office auto-responder for the address of a
+	// destination. If none was configured yet, a disabled vacation is returned.
+	async VacationGet(address: string): Promise<Vacation> {
+		const fn: string = "VacationGet"
+		const paramTypes: string[][] = [["string"]]
+		const returnTypes: string[][] = [["Vacation"]]
+		const params: any[] = [address]
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as Vacation
+	}
+
+	// VacationSave saves the out-of-office auto-responder for the address of a
+	// destination. While enabled, and between the optional start and end time,
+	// incoming messages addressed to the destination get an automatic response, at
+	// most once per number of days per correspondent. Messages from mailing lists and
+	// automated messages don't get a response.
+	async VacationSave(vacation: Vacation): Promise<void> {
+		const fn: string = "VacationSave"
+		const paramTypes: string[][] = [["Vacation"]]
+		const returnTypes: string[][] = []
+		const params: any[] = [vacation]
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as void
+	}
+
 	// OutgoingWebhookSave saves a new webhook url for outgoing deliveries. If url
 	// is empty, the webhook is disabled. If authorization is non-empty it is used for
 	// the Authorization header in HTTP requests. Events specifies the outgoing events
@@ -645,6 +909,37 @@ export class Client {
 		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as void
 	}
 
+	// OpenPGPKeys returns the OpenPGP keys the account publishes through the Web Key
+	// Directory (WKD), and the addresses of the account for which keys can be
+	// published.
+	async OpenPGPKeys(): Promise<[OpenPGPKey[] | null, string[] | null]> {
+		const fn: string = "OpenPGPKeys"
+		const paramTypes: string[][] = []
+		const returnTypes: string[][] = [["[]","OpenPGPKey"],["[]","string"]]
+		const params: any[] = []
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as [OpenPGPKey[] | null, string[] | null]
+	}
+
+	// OpenPGPKeySave publishes an OpenPGP public key, typically ASCII-armored, for an
+	// address of the account, replacing a previously published key for the address.
+	async OpenPGPKeySave(address: string, key: string): Promise<OpenPGPKey> {
+		const fn: string = "OpenPGPKeySave"
+		const paramTypes: string[][] = [["string"],["string"]]
+		const returnTypes: string[][] = [["OpenPGPKey"]]
+		const params: any[] = [address, key]
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as OpenPGPKey
+	}
+
+	// OpenPGPKeyRemove stops publishing the OpenPGP key for an address of the
+	// account.
+	async OpenPGPKeyRemove(address: string): Promise<void> {
+		const fn: string = "OpenPGPKeyRemove"
+		const paramTypes: string[][] = [["string"]]
+		const returnTypes: string[][] = []
+		const params: any[] = [address]
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as void
+	}
+
 	async LoginAttempts(limit: number): Promise<LoginAttempt[] | null> {
 		const fn: string = "LoginAttempts"
 		const paramTypes: string[][] = [["int32"]]
@@ -31,6 +31,7 @@ import (
 	"github.com/mjl-/mox/metrics"
 	"github.com/mjl-/mox/mlog"
 	"github.com/mjl-/mox/mox-"
+	"github.com/mjl-/mox/pst"
 	"github.com/mjl-/mox/store"
 )
 
@@ -81,6 +82,7 @@ func ImportManage() {
 		MailboxCounts map[string]int
 		Problems      []string
 		Done          *time.Time
+		Skipped       int
 		Aborted       *time.Time
 		Listeners     map[*importListener]struct{}
 		Cancel        func()
@@ -120,7 +122,7 @@ func ImportManage() {
 				sendEvent("problem", importProblem{p})
 			}
 			if s.Done != nil {
-				sendEvent("done", importDone{})
+				sendEvent("done", importDone{s.Skipped})
 			} else if s.Aborted != nil {
 				sendEvent("aborted", importAborted{})
 			}
@@ -155,6 +157,7 @@ func ImportManage() {
 				case importDone:
 					now := time.Now()
 					s.Done = &now
+					s.Skipped = x.Skipped
 				case importAborted:
 					now := time.Now()
 					s.Aborted = &now
@@ -198,7 +201,9 @@ type importCount struct {
 type importProblem struct {
 	Message string
 }
-type importDone struct{}
+type importDone struct {
+	Skipped int // Messages not imported because they were already present.
+}
 type importAborted struct{}
 type importStep struct {
 	Title string
@@ -206,7 +211,7 @@ type importStep struct {
 
 // importStart prepare the import and launches the goroutine to actually import.
 // importStart is responsible for closing f and removing f.
-func importStart(log mlog.Log, accName string, f *os.File, skipMailboxPrefix string) (string, bool, error) {
+func importStart(log mlog.Log, accName string, f *os.File, skipMailboxPrefix, dedupScope string) (string, bool, error) {
 	defer func() {
 		if f != nil {
 			store.CloseRemoveTempFile(log, f, "upload for import")
@@ -224,22 +229,30 @@ func importStart(log mlog.Log, accName string, f *os.File, skipMailboxPrefix str
 	}
 
 	// Recognize file format.
-	var iszip bool
+	var iszip, ispst bool
 	magicZip := []byte{0x50, 0x4b, 0x03, 0x04}
 	magicGzip := []byte{0x1f, 0x8b}
+	magicPST := []byte("!BDN")
 	magic := make([]byte, 4)
 	if _, err := f.ReadAt(magic, 0); err != nil {
 		return "", true, fmt.Errorf("detecting file format: %v", err)
 	}
 	if bytes.Equal(magic, magicZip) {
 		iszip = true
+	} else if bytes.Equal(magic, magicPST) {
+		ispst = true
 	} else if !bytes.Equal(magic[:2], magicGzip) {
-		return "", true, fmt.Errorf("file is not a zip or gzip file")
+		return "", true, fmt.Errorf("file is not a zip, gzip or pst file")
 	}
 
+	// For pst files, zr and tr remain nil.
 	var zr *zip.Reader
 	var tr *tar.Reader
-	if iszip {
+	if ispst {
+		if _, err := pst.Open(f); err != nil {
+			return "", true, fmt.Errorf("opening pst file: %v", err)
+		}
+	} else if iszip {
 		fi, err := f.Stat()
 		if err != nil {
 			return "", false, fmt.Errorf("stat temporary import zip file: %v", err)
@@ -260,6 +273,12 @@ func importStart(log mlog.Log, accName string, f *os.File, skipMailboxPrefix str
 	if err != nil {
 		return "", false, fmt.Errorf("open acount: %v", err)
 	}
+	dedup, err := store.NewImportDedup(acc, dedupScope)
+	if err != nil {
+		xerr := acc.Close()
+		log.Check(xerr, "closing account")
+		return "", true, err
+	}
 	acc.Lock() // Not using WithWLock because importMessage is responsible for unlocking.
 
 	tx, err := acc.DB.Begin(context.Background(), true)
@@ -275,15 +294,16 @@ func importStart(log mlog.Log, accName string, f *os.File, skipMailboxPrefix str
 	importers.Events <- importEvent{token, []byte(": keepalive\n\n"), nil, cancel}
 
 	log.Info("starting import")
-	go importMessages(ctx, log.WithCid(mox.Cid()), token, acc, tx, zr, tr, f, skipMailboxPrefix)
+	go importMessages(ctx, log.WithCid(mox.Cid()), token, acc, tx, zr, tr, f, skipMailboxPrefix, dedup)
 	f = nil // importMessages is now responsible for closing and removing.
 
 	return token, false, nil
 }
 
-// importMessages imports the messages from zip/tgz file f.
+// importMessages imports the messages from zip/tgz/pst file f.
 // importMessages is responsible for unlocking and closing acc, and closing tx and f.
-func importMessages(ctx context.Context, log mlog.Log, token string, acc *store.Account, tx *bstore.Tx, zr *zip.Reader, tr *tar.Reader, f *os.File, skipMailboxPrefix string) {
+// If dedup is not nil, messages already present are skipped.
+func importMessages(ctx context.Context, log mlog.Log, token string, acc *store.Account, tx *bstore.Tx, zr *zip.Reader, tr *tar.Reader, f *os.File, skipMailboxPrefix string, dedup *store.ImportDedup) {
 	// If a fatal processing error occurs, we panic with this type.
 	type importError struct{ Err error }
 
@@ -416,17 +436,12 @@ func importMessages(ctx context.Context, log mlog.Log, token string, acc *store.
 	}
 
 	openTrainMessage := func(m *store.Message) {
-		path := acc.MessagePath(m.ID)
-		f, err := os.Open(path)
-		if err != nil {
-			problemf("opening message again for training junk filter: %v (continuing)", err)
-			return
-		}
+		mr := acc.MessageReader(*m)
 		defer func() {
-			err := f.Close()
-			log.Check(err, "closing file after training junkfilter")
+			err := mr.Close()
+			log.Check(err, "closing message after training junkfilter")
 		}()
-		p, err := m.LoadPart(f)
+		p, err := m.LoadPart(mr)
 		if err != nil {
 			problemf("loading parsed message again for training junk filter: %v (continuing)", err)
 			return
@@ -502,6 +517,27 @@ func importMessages(ctx context.Context, log mlog.Log, token string, acc *store.
 		m.MailboxID = mb.ID
 		m.MailboxOrigID = mb.ID
 
+		// Parse message and store parsed information for later fast retrieval.
+		p, err := message.EnsurePart(log.Logger, false, f, m.Size)
+		if err != nil {
+			problemf("parsing message %s: %s (continuing)", pos, err)
+		}
+		m.ParsedBuf, err = json.Marshal(p)
+		ximportcheckf(err, "marshal parsed message structure")
+
+		// Set fields needed for future threading. By doing it now, DeliverMessage won't
+		// have to parse the Part again.
+		p.SetReaderAt(store.FileMsgReader(m.MsgPrefix, f))
+		m.PrepareThreading(log, &p)
+
+		if dedup != nil {
+			dup, err := dedup.Duplicate(tx, m, f)
+			ximportcheckf(err, "checking for duplicate message")
+			if dup {
+				return
+			}
+		}
+
 		addSize += m.Size
 		if maxSize > 0 && du.MessageSize+addSize > maxSize {
 			ximportcheckf(fmt.Errorf("account over maximum total size %d", maxSize), "checking quota")
@@ -528,19 +564,6 @@ func importMessages(ctx context.Context, log mlog.Log, token string, acc *store.
 			}
 		}
 
-		// Parse message and store parsed information for later fast retrieval.
-		p, err := message.EnsurePart(log.Logger, false, f, m.Size)
-		if err != nil {
-			problemf("parsing message %s: %s (continuing)", pos, err)
-		}
-		m.ParsedBuf, err = json.Marshal(p)
-		ximportcheckf(err, "marshal parsed message structure")
-
-		// Set fields needed for future threading. By doing it now, DeliverMessage won't
-		// have to parse the Part again.
-		p.SetReaderAt(store.FileMsgReader(m.MsgPrefix, f))
-		m.PrepareThreading(log, &p)
-
 		if m.Received.IsZero() {
 			if p.Envelope != nil && !p.Envelope.Date.IsZero() {
 				m.Received = p.Envelope.Date
@@ -581,7 +604,7 @@ func importMessages(ctx context.Context, log mlog.Log, token string, acc *store.
 		}
 		mb := xensureMailbox(mailbox)
 
-		mr := store.NewMboxReader(log, store.CreateMessageTemp, filename, r)
+		mr := store.NewMboxReader(log, store.CreateMessageTemp, filename, r, store.MboxAuto)
 		for {
 			m, mf, pos, err := mr.Next()
 			if err == io.EOF {
@@ -682,7 +705,7 @@ func importMessages(ctx context.Context, log mlog.Log, token string, acc *store.
 		}
 		xdeliver(mb, &m, f, filename)
 		f = nil
-		if keepFlags != "" {
+		if keepFlags != "" && m.ID != 0 {
 			if _, ok := mailboxMissingKeywordMessages[mailbox]; !ok {
 				mailboxMissingKeywordMessages[mailbox] = map[int64]string{}
 			}
@@ -690,6 +713,31 @@ func importMessages(ctx context.Context, log mlog.Log, token string, acc *store.
 		}
 	}
 
+	// Mail folders from pst files are imported into mailboxes with the same name, below
+	// prefix if not empty.
+	ximportPST := func(prefix, filename string, r io.ReaderAt) {
+		pr, err := pst.NewReader(log, store.CreateMessageTemp, r)
+		if err != nil {
+			problemf("reading pst file %s: %v (skipping)", filename, err)
+			return
+		}
+		for {
+			m, mf, pos, err := pr.Next()
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				ximportcheckf(err, "next message in pst file")
+			}
+
+			mailbox := pr.Mailbox()
+			if prefix != "" {
+				mailbox = prefix + "/" + mailbox
+			}
+			mb := xensureMailbox(mailbox)
+			xdeliver(mb, m, mf, pos)
+		}
+	}
+
 	importFile := func(name string, r io.Reader) {
 		origName := name
 
@@ -697,6 +745,21 @@ func importMessages(ctx context.Context, log mlog.Log, token string, acc *store.
 			name = strings.TrimPrefix(name[len(skipMailboxPrefix):], "/")
 		}
 
+		if ext := strings.ToLower(path.Ext(name)); ext == ".pst" || ext == ".ost" {
+			// The pst reader needs random access, so we store the file first.
+			pf, err := store.CreateMessageTemp(log, "import-pst")
+			ximportcheckf(err, "creating temp file for pst file")
+			defer store.CloseRemoveTempFile(log, pf, "pst file to import")
+			_, err = io.Copy(pf, r)
+			ximportcheckf(err, "storing pst file")
+			prefix := path.Dir(name)
+			if prefix == "." {
+				prefix = ""
+			}
+			ximportPST(prefix, origName, pf)
+			return
+		}
+
 		if strings.HasSuffix(name, "/") {
 			name = strings.TrimSuffix(name, "/")
 			dir := path.Dir(name)
@@ -786,7 +849,9 @@ func importMessages(ctx context.Context, log mlog.Log, token string, acc *store.
 		}
 	}
 
-	if zr != nil {
+	if zr == nil && tr == nil {
+		ximportPST("", "upload", f)
+	} else if zr != nil {
 		for _, f := range zr.File {
 			if canceled() {
 				return
@@ -878,7 +943,12 @@ func importMessages(ctx context.Context, log mlog.Log, token string, acc *store.
 	log.Check(err, "closing account after import")
 	acc = nil
 
-	sendEvent("done", importDone{})
+	var skipped int
+	if dedup != nil {
+		skipped = dedup.Skipped
+		log.Debug("duplicate messages skipped", slog.Int("skipped", skipped))
+	}
+	sendEvent("done", importDone{skipped})
 }
 
 func flagSet(flags *store.Flags, keywords map[string]bool, word string) {
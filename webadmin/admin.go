@@ -8,11 +8,9 @@ import (
 	"bufio"
 	"bytes"
 	"context"
-	"crypto"
 	"crypto/ed25519"
 	cryptorand "crypto/rand"
 	"crypto/rsa"
-	"crypto/sha256"
 	"crypto/tls"
 	"crypto/x509"
 	"encoding/base64"
@@ -38,8 +36,6 @@ import (
 	"golang.org/x/exp/maps"
 	"golang.org/x/text/unicode/norm"
 
-	"github.com/mjl-/adns"
-
 	"github.com/mjl-/bstore"
 	"github.com/mjl-/sherpa"
 	"github.com/mjl-/sherpadoc"
@@ -53,6 +49,8 @@ import (
 	"github.com/mjl-/mox/dmarcrpt"
 	"github.com/mjl-/mox/dns"
 	"github.com/mjl-/mox/dnsbl"
+	"github.com/mjl-/mox/eventdb"
+	"github.com/mjl-/mox/imapserver"
 	"github.com/mjl-/mox/metrics"
 	"github.com/mjl-/mox/mlog"
 	mox "github.com/mjl-/mox/mox-"
@@ -67,6 +65,7 @@ import (
 	"github.com/mjl-/mox/tlsrpt"
 	"github.com/mjl-/mox/tlsrptdb"
 	"github.com/mjl-/mox/webauth"
+	"github.com/mjl-/mox/webops"
 )
 
 var pkglog = mlog.New("webadmin", nil)
@@ -184,17 +183,44 @@ func handle(apiHandler http.Handler, isForwarded bool, w http.ResponseWriter, r
 		return
 	}
 
-	// All other URLs, except the login endpoint require some authentication.
+	fn, _ := strings.CutPrefix(r.URL.Path, "/api/")
+	isFunction := isAPI && fn != "" && !strings.HasPrefix(fn, "_")
+
+	// All other URLs, except the login endpoint require some authentication. API
+	// calls can be authenticated with an admin token instead of a session.
 	var sessionToken store.SessionToken
-	if r.URL.Path != "/api/LoginPrep" && r.URL.Path != "/api/Login" {
+	var domainAdmin string
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok && isAPI {
+		name, at, ok := webauth.CheckAdminToken(ctx, log, isForwarded, w, r, token)
+		if !ok {
+			// Response has been written already.
+			return
+		}
+		log = log.With(slog.String("admintoken", name))
+		if isFunction && (loginFunctions[fn] || len(at.Functions) > 0 && !slices.Contains(at.Functions, fn)) {
+			writeAPIError(w, "user:error", "function not available for admin token")
+			return
+		}
+		domainAdmin = at.DomainAdmin
+	} else if r.URL.Path != "/api/LoginPrep" && r.URL.Path != "/api/Login" {
 		var ok bool
-		_, sessionToken, _, ok = webauth.Check(ctx, log, webauth.Admin, "webadmin", isForwarded, w, r, isAPI, isAPI, false)
+		_, sessionToken, domainAdmin, ok = webauth.Check(ctx, log, webauth.Admin, "webadmin", isForwarded, w, r, isAPI, isAPI, false)
 		if !ok {
 			// Response has been written already.
 			return
 		}
 	}
 
+	// Domain admins can only call a subset of the API functions. Those functions
+	// verify the domains and accounts are managed by the domain admin.
+	if domainAdmin != "" {
+		ctx = admin.WithDomainAdmin(ctx, domainAdmin)
+		if isFunction && !domainAdminFunctions[fn] {
+			writeAPIError(w, "user:error", "function not available for domain admins")
+			return
+		}
+	}
+
 	if isAPI {
 		reqInfo := requestInfo{sessionToken, w, r}
 		ctx = context.WithValue(ctx, requestInfoCtxKey, reqInfo)
@@ -202,9 +228,137 @@ func handle(apiHandler http.Handler, isForwarded bool, w http.ResponseWriter, r
 		return
 	}
 
+	// Stream of changes to all accounts, or a single account with query string
+	// parameter "account", as server-sent events.
+	if r.URL.Path == "/changes" {
+		var acc *store.Account
+		name := r.URL.Query().Get("account")
+		if domainAdmin != "" && (name == "" || !admin.AccountAllowed(ctx, name)) {
+			http.Error(w, "403 - forbidden - domain admins must specify an account they manage", http.StatusForbidden)
+			return
+		}
+		if name != "" {
+			var err error
+			acc, err = store.OpenAccount(log, name, false)
+			if err != nil {
+				http.Error(w, "400 - bad request - opening account: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+			defer func() {
+				err := acc.Close()
+				log.Check(err, "closing account")
+			}()
+		}
+		webops.ChangesStream(log, acc, w, r)
+		return
+	}
+
 	http.NotFound(w, r)
 }
 
+// writeAPIError writes a sherpa error response for an API call.
+func writeAPIError(w http.ResponseWriter, code, message string) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	var result = struct {
+		Error sherpa.Error `json:"error"`
+	}{
+		sherpa.Error{Code: code, Message: message},
+	}
+	json.NewEncoder(w).Encode(result)
+}
+
+// API functions for login sessions, not available to admin tokens.
+var loginFunctions = map[string]bool{
+	"LoginPrep": true,
+	"Login":     true,
+	"Logout":    true,
+}
+
+// API functions domain admins can call. The preview functions are not included:
+// The context lines of their diffs can show configuration of other domains.
+var domainAdminFunctions = map[string]bool{
+	"LoginPrep":                      true,
+	"Login":                          true,
+	"Logout":                         true,
+	"DomainAdminScope":               true,
+	"CheckDomain":                    true,
+	"Domains":                        true,
+	"Domain":                         true,
+	"ParseDomain":                    true,
+	"DomainConfig":                   true,
+	"DomainLocalparts":               true,
+	"Accounts":                       true,
+	"Account":                        true,
+	"TLSRPTSummaries":                true,
+	"DMARCSummaries":                 true,
+	"DomainRecords":                  true,
+	"DomainRecordsExport":            true,
+	"DomainAdd":                      true,
+	"DomainRemove":                   true,
+	"AccountAdd":                     true,
+	"AccountRemove":                  true,
+	"AddressAdd":                     true,
+	"AddressRemove":                  true,
+	"AddressSearch":                  true,
+	"AddressesMove":                  true,
+	"AddressesDisabledSave":          true,
+	"SetPassword":                    true,
+	"LoginTokenAdd":                  true,
+	"LoginTokens":                    true,
+	"LoginTokenRemove":               true,
+	"ImportJobs":                     true,
+	"ImportJobRemove":                true,
+	"AccountSettingsSave":            true,
+	"DestinationRulesetsSave":        true,
+	"AccountLoginDisabledSave":       true,
+	"AccountSuspend":                 true,
+	"AccountResume":                  true,
+	"ClientConfigsDomain":            true,
+	"Transports":                     true,
+	"DomainDescriptionSave":          true,
+	"DomainClientSettingsDomainSave": true,
+	"DomainLocalpartConfigSave":      true,
+	"DomainDMARCAddressSave":         true,
+	"DomainDMARCPolicySave":          true,
+	"DMARCAdvice":                    true,
+	"DMARCSpoofIncidents":            true,
+	"DomainTLSRPTAddressSave":        true,
+	"DomainMTASTSSave":               true,
+	"DomainMTASTSRecordPending":      true,
+	"DomainWKDSave":                  true,
+	"DomainWellKnownSave":            true,
+	"DomainDKIMAdd":                  true,
+	"DomainDKIMRemove":               true,
+	"DomainDKIMSave":                 true,
+	"DomainDisabledSave":             true,
+	"AliasAdd":                       true,
+	"AliasUpdate":                    true,
+	"AliasRemove":                    true,
+	"AliasAddressesAdd":              true,
+	"AliasAddressesRemove":           true,
+	"TLSPublicKeys":                  true,
+	"LoginAttempts":                  true,
+	"IMAPClients":                    true,
+	"IMAPConnections":                true,
+	"IMAPConnectionClose":            true,
+	"WebSessions":                    true,
+	"WebSessionRemove":               true,
+}
+
+// xdomainAllowed prevents domain admins from accessing domains they don't manage.
+func xdomainAllowed(ctx context.Context, d dns.Domain) {
+	if !admin.DomainAllowed(ctx, d) {
+		xusererrorf(ctx, "domain %s not managed by domain admin", d)
+	}
+}
+
+// xaccountAllowed prevents domain admins from accessing accounts they don't manage.
+func xaccountAllowed(ctx context.Context, accountName string) {
+	if !admin.AccountAllowed(ctx, accountName) {
+		xusererrorf(ctx, "account %q not managed by domain admin", accountName)
+	}
+}
+
 func xcheckf(ctx context.Context, err error, format string, args ...any) {
 	if err == nil {
 		return
@@ -257,12 +411,13 @@ func (w Admin) LoginPrep(ctx context.Context) string {
 }
 
 // Login returns a session token for the credentials, or fails with error code
-// "user:badLogin". Call LoginPrep to get a loginToken.
-func (w Admin) Login(ctx context.Context, loginToken, password string) store.CSRFToken {
+// "user:badLogin". Call LoginPrep to get a loginToken. Username is empty for the
+// global admin, or the name of a domain admin.
+func (w Admin) Login(ctx context.Context, loginToken, username, password string) store.CSRFToken {
 	log := pkglog.WithContext(ctx)
 	reqInfo := ctx.Value(requestInfoCtxKey).(requestInfo)
 
-	csrfToken, err := webauth.Login(ctx, log, webauth.Admin, "webadmin", w.cookiePath, w.isForwarded, reqInfo.Response, reqInfo.Request, loginToken, "", password)
+	csrfToken, err := webauth.Login(ctx, log, webauth.Admin, "webadmin", w.cookiePath, w.isForwarded, reqInfo.Response, reqInfo.Request, loginToken, username, password)
 	if _, ok := err.(*sherpa.Error); ok {
 		panic(err)
 	}
@@ -441,6 +596,12 @@ func xsendingIPs(ctx context.Context) []net.IP {
 func (Admin) CheckDomain(ctx context.Context, domainName string) (r CheckResult) {
 	// todo future: should run these checks without a DNS cache so recent changes are picked up.
 
+	if d, err := dns.ParseDomain(domainName); err == nil {
+		xdomainAllowed(ctx, d)
+	} else if admin.DomainAdminName(ctx) != "" {
+		xcheckuserf(ctx, err, "parsing domain")
+	}
+
 	resolver := dns.StrictResolver{Pkg: "check", Log: pkglog.WithContext(ctx).Logger}
 	dialer := &net.Dialer{Timeout: 10 * time.Second}
 	nctx, cancel := context.WithTimeout(ctx, 30*time.Second)
@@ -837,32 +998,18 @@ EOF
 		defer logPanic(ctx)
 		defer wg.Done()
 
+		// Records for keys to roll over to must be published before they are used, so
+		// they are expected too.
 		daneRecords := func(l config.Listener) map[string]struct{} {
-			if l.TLS == nil {
+			current, next, err := admin.TLSARecords(l)
+			if err != nil {
+				addf(&r.DANE.Errors, "Making DANE records: %v", err)
 				return nil
 			}
 			records := map[string]struct{}{}
-			addRecord := func(privKey crypto.Signer) {
-				spkiBuf, err := x509.MarshalPKIXPublicKey(privKey.Public())
-				if err != nil {
-					addf(&r.DANE.Errors, "marshal SubjectPublicKeyInfo for DANE record: %v", err)
-					return
-				}
-				sum := sha256.Sum256(spkiBuf)
-				r := adns.TLSA{
-					Usage:     adns.TLSAUsageDANEEE,
-					Selector:  adns.TLSASelectorSPKI,
-					MatchType: adns.TLSAMatchTypeSHA256,
-					CertAssoc: sum[:],
-				}
+			for _, r := range append(current, next...) {
 				records[r.Record()] = struct{}{}
 			}
-			for _, privKey := range l.TLS.HostPrivateRSA2048Keys {
-				addRecord(privKey)
-			}
-			for _, privKey := range l.TLS.HostPrivateECDSAP256Keys {
-				addRecord(privKey)
-			}
 			return records
 		}
 
@@ -936,6 +1083,9 @@ EOF
 			for _, r := range records {
 				instr += fmt.Sprintf("\t_25._tcp.%s. TLSA %s\n", pubDom.ASCII, r)
 			}
+			if public.TLS != nil && len(public.TLS.HostPrivateKeysNext) > 0 {
+				instr += "\nThe records include the keys from HostPrivateKeyFilesNext, for key rollover. Once the records are published and the TTL of the previous records has expired, move those keys to the front of HostPrivateKeyFiles in mox.conf. Once all certificates have been renewed with the new keys, remove the old keys from HostPrivateKeyFiles and their TLSA records from DNS.\n"
+			}
 			addf(&r.DANE.Instructions, instr)
 		} else {
 			addf(&r.DANE.Warnings, "DANE not configured: no static TLS host keys.")
@@ -955,7 +1105,7 @@ EOF
 		ips := mox.DomainSPFIPs()
 
 		// Verify a domain with the configured IPs that do SMTP.
-		verifySPF := func(isHost bool, domain dns.Domain) (string, *SPFRecord, spf.Record) {
+		verifySPF := func(isHost bool, domain dns.Domain) (string, *SPFRecord) {
 			kind := "domain"
 			if isHost {
 				kind = "host"
@@ -970,17 +1120,7 @@ EOF
 				xrecord = &SPFRecord{*record}
 			}
 
-			spfr := spf.Record{
-				Version: "spf1",
-			}
-
 			checkSPFIP := func(ip net.IP) {
-				mechanism := "ip4"
-				if ip.To4() == nil {
-					mechanism = "ip6"
-				}
-				spfr.Directives = append(spfr.Directives, spf.Directive{Mechanism: mechanism, IP: ip})
-
 				if record == nil {
 					return
 				}
@@ -1004,37 +1144,36 @@ EOF
 			for _, ip := range ips {
 				checkSPFIP(ip)
 			}
-			if !isHost {
-				spfr.Directives = append(spfr.Directives, spf.Directive{Mechanism: "mx"})
-			}
-
-			qual := "~"
-			if isHost {
-				qual = "-"
-			}
-			spfr.Directives = append(spfr.Directives, spf.Directive{Qualifier: qual, Mechanism: "all"})
-			return txt, xrecord, spfr
+			return txt, xrecord
 		}
 
 		// Check SPF record for domain.
-		var dspfr spf.Record
-		r.SPF.DomainTXT, r.SPF.DomainRecord, dspfr = verifySPF(false, domain)
+		r.SPF.DomainTXT, r.SPF.DomainRecord = verifySPF(false, domain)
 		// todo: possibly check all hosts for MX records? assuming they are also sending mail servers.
-		r.SPF.HostTXT, r.SPF.HostRecord, _ = verifySPF(true, mox.Conf.Static.HostnameDomain)
+		r.SPF.HostTXT, r.SPF.HostRecord = verifySPF(true, mox.Conf.Static.HostnameDomain)
 
 		if len(ips) == 0 {
 			addf(&r.SPF.Warnings, `No explicitly configured IPs found to check SPF policy against. Consider configuring public IPs instead of unspecified addresses (0.0.0.0 and/or ::) in the "public" listener in mox.conf, or NATIPs in case of NAT.`)
 		}
 
-		dtxt, err := dspfr.Record()
+		// Check SPF record for sending host. ../rfc/7208:2263 ../rfc/7208:2287
+		hostspf := fmt.Sprintf(`%s TXT "v=spf1 a -all"`, mox.Conf.Static.HostnameDomain.ASCII+".")
+
+		// Suggested record includes the additional senders configured for the domain. If
+		// no valid record can be made, e.g. because it would need too many DNS lookups, we
+		// don't suggest a broken record.
+		dspfr, err := admin.DomainSPFRecord(domConf)
+		var dtxt string
+		if err == nil {
+			dtxt, err = dspfr.Record()
+		}
 		if err != nil {
 			addf(&r.SPF.Errors, "Making SPF record for instructions: %s", err)
+			addf(&r.SPF.Instructions, "Ensure a DNS TXT record like the following exists:\n\n\t%s\n\nNo SPF record for the domain can be suggested, fix the SPF configuration of the domain first, see the errors.", hostspf)
+			return
 		}
 		domainspf := fmt.Sprintf("%s TXT %s", domain.ASCII+".", mox.TXTStrings(dtxt))
 
-		// Check SPF record for sending host. ../rfc/7208:2263 ../rfc/7208:2287
-		hostspf := fmt.Sprintf(`%s TXT "v=spf1 a -all"`, mox.Conf.Static.HostnameDomain.ASCII+".")
-
 		addf(&r.SPF.Instructions, "Ensure DNS TXT records like the following exists:\n\n\t%s\n\t%s\n\nIf you have an existing mail setup, with other hosts also sending mail for you domain, you should add those IPs as well. You could replace \"-all\" with \"~all\" to treat mail sent from unlisted IPs as \"softfail\", or with \"?all\" for \"neutral\".", domainspf, hostspf)
 	}()
 
@@ -1550,15 +1689,34 @@ When enabling MTA-STS, or updating a policy, always update the policy first (thr
 	return
 }
 
+// DomainAdminScope returns the name and domains of the logged in domain admin. The
+// name is empty for the global admin, which can manage all domains.
+func (Admin) DomainAdminScope(ctx context.Context) (name string, domains []dns.Domain) {
+	name = admin.DomainAdminName(ctx)
+	if name == "" {
+		return "", nil
+	}
+	da, ok := mox.Conf.DomainAdmin(name)
+	if !ok {
+		xusererrorf(ctx, "unknown domain admin")
+	}
+	return name, da.DNSDomains
+}
+
 // Domains returns all configured domain names.
 func (Admin) Domains(ctx context.Context) []config.Domain {
-	return mox.Conf.DomainConfigs()
+	l := mox.Conf.DomainConfigs()
+	if admin.DomainAdminName(ctx) != "" {
+		l = slices.DeleteFunc(l, func(d config.Domain) bool { return !admin.DomainAllowed(ctx, d.Domain) })
+	}
+	return l
 }
 
 // Domain returns the dns domain for a (potentially unicode as IDNA) domain name.
 func (Admin) Domain(ctx context.Context, domain string) dns.Domain {
 	d, err := dns.ParseDomain(domain)
 	xcheckuserf(ctx, err, "parse domain")
+	xdomainAllowed(ctx, d)
 	_, ok := mox.Conf.Domain(d)
 	if !ok {
 		xcheckuserf(ctx, errors.New("no such domain"), "looking up domain")
@@ -1577,6 +1735,7 @@ func (Admin) ParseDomain(ctx context.Context, domain string) dns.Domain {
 func (Admin) DomainConfig(ctx context.Context, domain string) config.Domain {
 	d, err := dns.ParseDomain(domain)
 	xcheckuserf(ctx, err, "parse domain")
+	xdomainAllowed(ctx, d)
 	conf, ok := mox.Conf.Domain(d)
 	if !ok {
 		xcheckuserf(ctx, errors.New("no such domain"), "looking up domain")
@@ -1588,6 +1747,7 @@ func (Admin) DomainConfig(ctx context.Context, domain string) config.Domain {
 func (Admin) DomainLocalparts(ctx context.Context, domain string) (localpartAccounts map[string]string, localpartAliases map[string]config.Alias) {
 	d, err := dns.ParseDomain(domain)
 	xcheckuserf(ctx, err, "parsing domain")
+	xdomainAllowed(ctx, d)
 	_, ok := mox.Conf.Domain(d)
 	if !ok {
 		xcheckuserf(ctx, errors.New("no such domain"), "looking up domain")
@@ -1598,6 +1758,11 @@ func (Admin) DomainLocalparts(ctx context.Context, domain string) (localpartAcco
 // Accounts returns the names of all configured and all disabled accounts.
 func (Admin) Accounts(ctx context.Context) (all, disabled []string) {
 	all, disabled = mox.Conf.AccountsDisabled()
+	if admin.DomainAdminName(ctx) != "" {
+		notAllowed := func(name string) bool { return !admin.AccountAllowed(ctx, name) }
+		all = slices.DeleteFunc(all, notAllowed)
+		disabled = slices.DeleteFunc(disabled, notAllowed)
+	}
 	sort.Slice(all, func(i, j int) bool {
 		return all[i] < all[j]
 	})
@@ -1608,6 +1773,8 @@ func (Admin) Accounts(ctx context.Context) (all, disabled []string) {
 func (Admin) Account(ctx context.Context, account string) (accountConfig config.Account, diskUsage int64) {
 	log := pkglog.WithContext(ctx)
 
+	xaccountAllowed(ctx, account)
+
 	acc, err := store.OpenAccount(log, account, false)
 	if err != nil && errors.Is(err, store.ErrAccountUnknown) {
 		xcheckuserf(ctx, err, "looking up account")
@@ -1706,6 +1873,7 @@ func (Admin) TLSRPTSummaries(ctx context.Context, start, end time.Time, policyDo
 		polDom, err = dns.ParseDomain(policyDomain)
 		xcheckuserf(ctx, err, "parsing policy domain")
 	}
+	xdomainAllowed(ctx, polDom)
 	reports, err := tlsrptdb.RecordsPeriodDomain(ctx, start, end, polDom)
 	xcheckf(ctx, err, "fetching tlsrpt reports from database")
 
@@ -1785,6 +1953,11 @@ type DMARCSummary struct {
 // period start/end for one or all domains (when domain is empty).
 // The returned summaries are ordered by domain name.
 func (Admin) DMARCSummaries(ctx context.Context, start, end time.Time, domain string) (domainSummaries []DMARCSummary) {
+	if admin.DomainAdminName(ctx) != "" {
+		d, err := dns.ParseDomain(domain)
+		xcheckuserf(ctx, err, "parsing domain")
+		xdomainAllowed(ctx, d)
+	}
 	reports, err := dmarcdb.RecordsPeriodDomain(ctx, start, end, domain)
 	xcheckf(ctx, err, "fetching dmarc aggregate reports from database")
 	summaries := map[string]DMARCSummary{}
@@ -1831,6 +2004,31 @@ func (Admin) DMARCSummaries(ctx context.Context, start, end time.Time, domain st
 	return sums
 }
 
+// DMARCAdvice returns a recommendation for the DMARC policy of a domain, based on
+// received DMARC aggregate reports of the past 30 days.
+func (Admin) DMARCAdvice(ctx context.Context, domain string) (advice dmarcdb.Advice) {
+	d, err := dns.ParseDomain(domain)
+	xcheckuserf(ctx, err, "parsing domain")
+	xdomainAllowed(ctx, d)
+	advice, err = dmarcdb.DomainAdvice(ctx, d.Name(), time.Now())
+	xcheckf(ctx, err, "analyzing dmarc aggregate reports")
+	return advice
+}
+
+// DMARCSpoofIncidents returns incidents with a surge of incoming messages failing
+// DMARC for a domain (or all domains if empty), overlapping with period
+// start/end. The most recent incident is first.
+func (Admin) DMARCSpoofIncidents(ctx context.Context, start, end time.Time, domain string) []dmarcdb.SpoofIncident {
+	if admin.DomainAdminName(ctx) != "" {
+		d, err := dns.ParseDomain(domain)
+		xcheckuserf(ctx, err, "parsing domain")
+		xdomainAllowed(ctx, d)
+	}
+	l, err := dmarcdb.SpoofIncidents(ctx, start, end, domain)
+	xcheckf(ctx, err, "listing spoofing incidents")
+	return l
+}
+
 // Reverse is the result of a reverse lookup.
 type Reverse struct {
 	Hostnames []string
@@ -1934,6 +2132,7 @@ func (Admin) DomainRecords(ctx context.Context, domain string) []string {
 func DomainRecords(ctx context.Context, log mlog.Log, domain string) []string {
 	d, err := dns.ParseDomain(domain)
 	xcheckuserf(ctx, err, "parsing domain")
+	xdomainAllowed(ctx, d)
 	dc, ok := mox.Conf.Domain(d)
 	if !ok {
 		xcheckuserf(ctx, errors.New("unknown domain"), "lookup domain")
@@ -1963,6 +2162,17 @@ func DomainRecords(ctx context.Context, log mlog.Log, domain string) []string {
 	return records
 }
 
+// DomainRecordsExport returns the DNS records that should exist for the
+// configured domain in a format for a DNS provider: "zone", "cloudflare",
+// "route53" or "terraform".
+func (Admin) DomainRecordsExport(ctx context.Context, domain, format string) string {
+	log := pkglog.WithContext(ctx)
+	records := DomainRecords(ctx, log, domain)
+	s, err := admin.DomainRecordsExport(records, format)
+	xcheckf(ctx, err, "exporting dns records")
+	return s
+}
+
 // DomainAdd adds a new domain and reloads the configuration.
 func (Admin) DomainAdd(ctx context.Context, disabled bool, domain, accountName, localpart string) {
 	d, err := dns.ParseDomain(domain)
@@ -1982,12 +2192,19 @@ func (Admin) DomainRemove(ctx context.Context, domain string) {
 }
 
 // AccountAdd adds existing a new account, with an initial email address, and
-// reloads the configuration.
-func (Admin) AccountAdd(ctx context.Context, accountName, address string) {
-	err := admin.AccountAdd(ctx, accountName, address)
+// reloads the configuration. If template is not empty, the settings of the
+// account template are used for the new account.
+func (Admin) AccountAdd(ctx context.Context, accountName, address, template string) {
+	err := admin.AccountAdd(ctx, accountName, address, template)
 	xcheckf(ctx, err, "adding account")
 }
 
+// AccountTemplates returns the names of the account templates that can be used
+// when adding an account.
+func (Admin) AccountTemplates(ctx context.Context) []string {
+	return admin.AccountTemplates()
+}
+
 // AccountRemove removes an existing account and reloads the configuration.
 func (Admin) AccountRemove(ctx context.Context, accountName string) {
 	err := admin.AccountRemove(ctx, accountName)
@@ -2006,14 +2223,98 @@ func (Admin) AddressRemove(ctx context.Context, address string) {
 	xcheckf(ctx, err, "removing address")
 }
 
+// xpreview calls fn with a context for a dry run, returning the changes fn would
+// make to the configuration.
+func xpreview(ctx context.Context, fn func(ctx context.Context) error, errmsg string) mox.ConfigPreview {
+	var preview mox.ConfigPreview
+	err := fn(mox.WithDryRun(ctx, &preview))
+	if !errors.Is(err, mox.ErrDryRun) {
+		xcheckf(ctx, err, errmsg)
+	}
+	return preview
+}
+
+// DomainAddPreview validates adding a domain like DomainAdd, returning the
+// changes to the configuration without making them.
+func (Admin) DomainAddPreview(ctx context.Context, disabled bool, domain, accountName, localpart string) mox.ConfigPreview {
+	d, err := dns.ParseDomain(domain)
+	xcheckuserf(ctx, err, "parsing domain")
+
+	return xpreview(ctx, func(ctx context.Context) error {
+		return admin.DomainAdd(ctx, disabled, d, accountName, smtp.Localpart(norm.NFC.String(localpart)))
+	}, "adding domain")
+}
+
+// AddressRemovePreview validates removing an address like AddressRemove,
+// returning the changes to the configuration without making them.
+func (Admin) AddressRemovePreview(ctx context.Context, address string) mox.ConfigPreview {
+	return xpreview(ctx, func(ctx context.Context) error {
+		return admin.AddressRemove(ctx, address)
+	}, "removing address")
+}
+
+func destinationRulesetsSave(ctx context.Context, accountName, destName string, rulesets []config.Ruleset) error {
+	return admin.AccountSave(ctx, accountName, func(acc *config.Account) {
+		dest, ok := acc.Destinations[destName]
+		if !ok {
+			xcheckuserf(ctx, errors.New("not found"), "looking up destination")
+		}
+		dest.Rulesets = rulesets
+		nd := maps.Clone(acc.Destinations)
+		nd[destName] = dest
+		acc.Destinations = nd
+	})
+}
+
+// DestinationRulesetsSave replaces the rulesets of a destination (address) of an
+// account.
+func (Admin) DestinationRulesetsSave(ctx context.Context, accountName, destName string, rulesets []config.Ruleset) {
+	err := destinationRulesetsSave(ctx, accountName, destName, rulesets)
+	xcheckf(ctx, err, "saving rulesets")
+}
+
+// DestinationRulesetsSavePreview validates new rulesets for a destination like
+// DestinationRulesetsSave, returning the changes to the configuration without
+// making them.
+func (Admin) DestinationRulesetsSavePreview(ctx context.Context, accountName, destName string, rulesets []config.Ruleset) mox.ConfigPreview {
+	return xpreview(ctx, func(ctx context.Context) error {
+		return destinationRulesetsSave(ctx, accountName, destName, rulesets)
+	}, "saving rulesets")
+}
+
+// AddressSearch returns a page of configured addresses matching query, with the
+// total number of matches. See admin.AddressSearch.
+func (Admin) AddressSearch(ctx context.Context, query string, offset, limit int) (addresses []admin.AddressEntry, total int) {
+	addresses, total, err := admin.AddressSearch(ctx, query, offset, limit)
+	xcheckf(ctx, err, "searching addresses")
+	return addresses, total
+}
+
+// AddressesMove moves addresses to another account, keeping their destination
+// configuration. Messages are not moved.
+func (Admin) AddressesMove(ctx context.Context, addresses []string, accountName string) {
+	err := admin.AddressesMove(ctx, addresses, accountName)
+	xcheckf(ctx, err, "moving addresses")
+}
+
+// AddressesDisabledSave disables or enables addresses.
+func (Admin) AddressesDisabledSave(ctx context.Context, addresses []string, disabled bool) {
+	err := admin.AddressesDisable(ctx, addresses, disabled)
+	xcheckf(ctx, err, "saving disabled for addresses")
+}
+
 // SetPassword saves a new password for an account, invalidating the previous password.
 // Sessions are not interrupted, and will keep working. New login attempts must use the new password.
-// Password must be at least 8 characters.
+// Password must be at least 8 characters, and meet the password policy from the
+// configuration.
 func (Admin) SetPassword(ctx context.Context, accountName, password string) {
 	log := pkglog.WithContext(ctx)
 	if len(password) < 8 {
 		xusererrorf(ctx, "message must be at least 8 characters")
 	}
+	err := mox.CheckPassword(password)
+	xcheckuserf(ctx, err, "checking password")
+	xaccountAllowed(ctx, accountName)
 	acc, err := store.OpenAccount(log, accountName, false)
 	xcheckf(ctx, err, "open account")
 	defer func() {
@@ -2024,6 +2325,107 @@ func (Admin) SetPassword(ctx context.Context, accountName, password string) {
 	xcheckf(ctx, err, "setting password")
 }
 
+// SetPasswordHash sets the password of an account to a password hash imported from
+// another system, e.g. when migrating from another mail server. Supported are
+// bcrypt, argon2 and sha-crypt hashes in crypt format, optionally prefixed with a
+// scheme in Dovecot syntax, e.g. "{SHA512-CRYPT}". Until the first successful
+// login, only authentication with a plain text password is possible. At the first
+// login, the password is upgraded to the native hashes.
+func (Admin) SetPasswordHash(ctx context.Context, accountName, passwordHash string) {
+	log := pkglog.WithContext(ctx)
+	xaccountAllowed(ctx, accountName)
+	_, _, err := store.ParsePasswordHash(passwordHash)
+	xcheckuserf(ctx, err, "parsing password hash")
+	acc, err := store.OpenAccount(log, accountName, false)
+	xcheckf(ctx, err, "open account")
+	defer func() {
+		err := acc.Close()
+		log.WithContext(ctx).Check(err, "closing account")
+	}()
+	err = acc.SetPasswordHash(log, passwordHash)
+	xcheckf(ctx, err, "setting password hash")
+}
+
+// LoginTokenAdd adds a short-lived login token for an account, and returns the
+// token. The token can be used instead of the password with the PLAIN and LOGIN
+// authentication mechanisms, e.g. by external webmail software such as Roundcube
+// that authenticates users against mox without storing their passwords. The
+// token cannot be retrieved later. Expires can be at most 7 days in the future.
+// See ClientConfigsDomain for the IMAP and SMTP submission endpoints.
+func (Admin) LoginTokenAdd(ctx context.Context, accountName, description string, expires time.Time) (token string) {
+	log := pkglog.WithContext(ctx)
+	xaccountAllowed(ctx, accountName)
+	acc, err := store.OpenAccount(log, accountName, false)
+	xcheckf(ctx, err, "open account")
+	defer func() {
+		err := acc.Close()
+		log.WithContext(ctx).Check(err, "closing account")
+	}()
+	token, err = acc.LoginTokenAdd(ctx, description, expires)
+	xcheckuserf(ctx, err, "adding login token")
+	return token
+}
+
+// LoginTokens returns the login tokens for an account.
+func (Admin) LoginTokens(ctx context.Context, accountName string) []store.LoginToken {
+	log := pkglog.WithContext(ctx)
+	xaccountAllowed(ctx, accountName)
+	acc, err := store.OpenAccount(log, accountName, false)
+	xcheckf(ctx, err, "open account")
+	defer func() {
+		err := acc.Close()
+		log.WithContext(ctx).Check(err, "closing account")
+	}()
+	l, err := acc.LoginTokenList(ctx)
+	xcheckf(ctx, err, "listing login tokens")
+	return l
+}
+
+// LoginTokenRemove removes a login token of an account.
+func (Admin) LoginTokenRemove(ctx context.Context, accountName string, id int64) {
+	log := pkglog.WithContext(ctx)
+	xaccountAllowed(ctx, accountName)
+	acc, err := store.OpenAccount(log, accountName, false)
+	xcheckf(ctx, err, "open account")
+	defer func() {
+		err := acc.Close()
+		log.WithContext(ctx).Check(err, "closing account")
+	}()
+	err = acc.LoginTokenRemove(ctx, id)
+	xcheckf(ctx, err, "removing login token")
+}
+
+// ImportJobs returns the jobs for imports into an account from files or
+// directories, with their progress, most recent first.
+func (Admin) ImportJobs(ctx context.Context, accountName string) []store.ImportJob {
+	log := pkglog.WithContext(ctx)
+	xaccountAllowed(ctx, accountName)
+	acc, err := store.OpenAccount(log, accountName, false)
+	xcheckf(ctx, err, "open account")
+	defer func() {
+		err := acc.Close()
+		log.WithContext(ctx).Check(err, "closing account")
+	}()
+	l, err := acc.ImportJobList(ctx)
+	xcheckf(ctx, err, "listing import jobs")
+	return l
+}
+
+// ImportJobRemove removes an import job of an account. Imported messages are not
+// removed, but an interrupted import can no longer be continued.
+func (Admin) ImportJobRemove(ctx context.Context, accountName string, id int64) {
+	log := pkglog.WithContext(ctx)
+	xaccountAllowed(ctx, accountName)
+	acc, err := store.OpenAccount(log, accountName, false)
+	xcheckf(ctx, err, "open account")
+	defer func() {
+		err := acc.Close()
+		log.WithContext(ctx).Check(err, "closing account")
+	}()
+	err = acc.ImportJobRemove(ctx, id)
+	xcheckf(ctx, err, "removing import job")
+}
+
 // AccountSettingsSave set new settings for an account that only an admin can set.
 func (Admin) AccountSettingsSave(ctx context.Context, accountName string, maxOutgoingMessagesPerDay, maxFirstTimeRecipientsPerDay int, maxMsgSize int64, firstTimeSenderDelay, noCustomPassword bool) {
 	err := admin.AccountSave(ctx, accountName, func(acc *config.Account) {
@@ -2056,11 +2458,48 @@ func (Admin) AccountLoginDisabledSave(ctx context.Context, accountName string, l
 	xcheckf(ctx, err, "removing current sessions")
 }
 
+// AccountSuspend suspends an account: logins are rejected with message, and
+// incoming deliveries are rejected with a temporary error, or a permanent error
+// if reject is set.
+func (Admin) AccountSuspend(ctx context.Context, accountName string, message string, reject bool) {
+	log := pkglog.WithContext(ctx)
+
+	if message == "" {
+		xusererrorf(ctx, "message for suspended account must be non-empty")
+	}
+
+	acc, err := store.OpenAccount(log, accountName, false)
+	xcheckf(ctx, err, "open account")
+	defer func() {
+		err := acc.Close()
+		log.Check(err, "closing account")
+	}()
+
+	err = admin.AccountSave(ctx, accountName, func(acc *config.Account) {
+		acc.Suspended = message
+		acc.SuspendedReject = reject
+	})
+	xcheckf(ctx, err, "saving suspended account")
+
+	err = acc.SessionsClear(ctx, log)
+	xcheckf(ctx, err, "removing current sessions")
+}
+
+// AccountResume ends the suspension of an account.
+func (Admin) AccountResume(ctx context.Context, accountName string) {
+	err := admin.AccountSave(ctx, accountName, func(acc *config.Account) {
+		acc.Suspended = ""
+		acc.SuspendedReject = false
+	})
+	xcheckf(ctx, err, "resuming account")
+}
+
 // ClientConfigsDomain returns configurations for email clients, IMAP and
 // Submission (SMTP) for the domain.
 func (Admin) ClientConfigsDomain(ctx context.Context, domain string) admin.ClientConfigs {
 	d, err := dns.ParseDomain(domain)
 	xcheckuserf(ctx, err, "parsing domain")
+	xdomainAllowed(ctx, d)
 
 	cc, err := admin.ClientConfigsDomain(d)
 	xcheckf(ctx, err, "client config for domain")
@@ -2104,6 +2543,25 @@ func (Admin) QueueHoldRuleRemove(ctx context.Context, holdRuleID int64) {
 	xcheckf(ctx, err, "removing queue hold rule")
 }
 
+// QueueHoldRuleRelease removes a hold rule and takes the messages in the queue
+// matching it off hold, e.g. for an account held because it appeared
+// compromised. Returns number of messages released.
+func (Admin) QueueHoldRuleRelease(ctx context.Context, holdRuleID int64) (affected int) {
+	log := pkglog.WithContext(ctx)
+	n, err := queue.HoldRuleRelease(ctx, log, holdRuleID)
+	xcheckf(ctx, err, "releasing queue hold rule")
+	return n
+}
+
+// QueueHoldRuleDeny drops the messages on hold in the queue matching a hold rule.
+// The hold rule is kept. Returns number of messages dropped.
+func (Admin) QueueHoldRuleDeny(ctx context.Context, holdRuleID int64) (affected int) {
+	log := pkglog.WithContext(ctx)
+	n, err := queue.HoldRuleDeny(ctx, log, holdRuleID)
+	xcheckf(ctx, err, "dropping messages held by queue hold rule")
+	return n
+}
+
 // QueueList returns the messages currently in the outgoing queue.
 func (Admin) QueueList(ctx context.Context, filter queue.Filter, sort queue.Sort) []queue.Msg {
 	l, err := queue.List(ctx, filter, sort)
@@ -2174,6 +2632,48 @@ func (Admin) RetiredList(ctx context.Context, filter queue.RetiredFilter, sort q
 	return l
 }
 
+// Events returns events in the lifecycle of messages from the event database,
+// oldest first.
+func (Admin) Events(ctx context.Context, filter eventdb.EventFilter) []eventdb.Event {
+	l, err := eventdb.List(ctx, filter)
+	xcheckf(ctx, err, "listing events")
+	return l
+}
+
+// MessageTrace returns all events for a message with the given Message-ID,
+// across incoming and outgoing deliveries.
+func (Admin) MessageTrace(ctx context.Context, messageID string) []eventdb.Event {
+	if messageID == "" {
+		xcheckuserf(ctx, errors.New("missing message-id"), "tracing message")
+	}
+	l, err := eventdb.Trace(ctx, messageID)
+	xcheckf(ctx, err, "tracing message")
+	return l
+}
+
+// DeliveryStatus returns the events for an outgoing message, by its ID in the
+// queue, e.g. queueing, delivery attempts and the final result.
+func (Admin) DeliveryStatus(ctx context.Context, queueMsgID int64) []eventdb.Event {
+	if queueMsgID <= 0 {
+		xcheckuserf(ctx, errors.New("missing queue message id"), "getting delivery status")
+	}
+	l, err := eventdb.DeliveryStatus(ctx, "", queueMsgID)
+	xcheckf(ctx, err, "getting delivery status")
+	return l
+}
+
+// EventStats returns the number of events per kind (e.g. "received",
+// "delivered", "sent", "bounced") between start and end.
+func (Admin) EventStats(ctx context.Context, start, end time.Time) map[string]int {
+	counts, err := eventdb.Stats(ctx, start, end)
+	xcheckf(ctx, err, "gathering event statistics")
+	r := map[string]int{}
+	for k, n := range counts {
+		r[string(k)] = n
+	}
+	return r
+}
+
 // HookQueueSize returns the number of webhooks still to be delivered.
 func (Admin) HookQueueSize(ctx context.Context) int {
 	n, err := queue.HookQueueSize(ctx)
@@ -2329,6 +2829,11 @@ func (Admin) WebserverConfigSave(ctx context.Context, oldConf, newConf Webserver
 
 // Transports returns the configured transports, for sending email.
 func (Admin) Transports(ctx context.Context) map[string]config.Transport {
+	// Transports can contain credentials, and routes can only be changed by the global
+	// admin.
+	if admin.DomainAdminName(ctx) != "" {
+		return map[string]config.Transport{}
+	}
 	return mox.Conf.Static.Transports
 }
 
@@ -2549,15 +3054,23 @@ func (Admin) DomainLocalpartConfigSave(ctx context.Context, domainName, localpar
 // configuration for a domain. If localpart is empty, processing reports is
 // disabled.
 func (Admin) DomainDMARCAddressSave(ctx context.Context, domainName, localpart, domain, account, mailbox string) {
+	if localpart != "" {
+		xaccountAllowed(ctx, account)
+	}
 	err := admin.DomainSave(ctx, domainName, func(d *config.Domain) error {
 		if localpart == "" {
 			d.DMARC = nil
 		} else {
+			var policy string
+			if d.DMARC != nil {
+				policy = d.DMARC.Policy
+			}
 			d.DMARC = &config.DMARC{
 				Localpart: localpart,
 				Domain:    domain,
 				Account:   account,
 				Mailbox:   mailbox,
+				Policy:    policy,
 			}
 		}
 		return nil
@@ -2565,10 +3078,30 @@ func (Admin) DomainDMARCAddressSave(ctx context.Context, domainName, localpart,
 	xcheckf(ctx, err, "saving dmarc reporting address/settings for domain")
 }
 
+// DomainDMARCPolicySave saves the policy for the suggested DMARC DNS record of a
+// domain: "none", "quarantine", "reject" or empty for the default (reject), or
+// "auto" for the policy recommended based on DMARC aggregate reports. A DMARC
+// reporting address must be configured.
+func (Admin) DomainDMARCPolicySave(ctx context.Context, domainName, policy string) {
+	err := admin.DomainSave(ctx, domainName, func(d *config.Domain) error {
+		if d.DMARC == nil {
+			return fmt.Errorf("%w: no dmarc reporting address configured", admin.ErrRequest)
+		}
+		nd := *d.DMARC
+		nd.Policy = policy
+		d.DMARC = &nd
+		return nil
+	})
+	xcheckf(ctx, err, "saving dmarc policy for domain")
+}
+
 // DomainTLSRPTAddressSave saves the TLS reporting address/processing
 // configuration for a domain. If localpart is empty, processing reports is
 // disabled.
 func (Admin) DomainTLSRPTAddressSave(ctx context.Context, domainName, localpart, domain, account, mailbox string) {
+	if localpart != "" {
+		xaccountAllowed(ctx, account)
+	}
 	err := admin.DomainSave(ctx, domainName, func(d *config.Domain) error {
 		if localpart == "" {
 			d.TLSRPT = nil
@@ -2592,11 +3125,16 @@ func (Admin) DomainMTASTSSave(ctx context.Context, domainName, policyID string,
 		if policyID == "" {
 			d.MTASTS = nil
 		} else {
+			var rampDays int
+			if d.MTASTS != nil {
+				rampDays = d.MTASTS.MaxAgeRampDays
+			}
 			d.MTASTS = &config.MTASTS{
-				PolicyID: policyID,
-				Mode:     mode,
-				MaxAge:   maxAge,
-				MX:       mx,
+				PolicyID:       policyID,
+				Mode:           mode,
+				MaxAge:         maxAge,
+				MX:             mx,
+				MaxAgeRampDays: rampDays,
 			}
 		}
 		return nil
@@ -2604,6 +3142,58 @@ func (Admin) DomainMTASTSSave(ctx context.Context, domainName, policyID string,
 	xcheckf(ctx, err, "saving mtasts policy for domain")
 }
 
+// DomainMTASTSRecordPending returns the DNS TXT record for _mta-sts.<domain> to
+// publish if the record in DNS does not have the policy ID of the configured
+// MTA-STS policy, e.g. after the max age was increased automatically. Empty if the
+// DNS record is up to date or no policy is configured.
+func (Admin) DomainMTASTSRecordPending(ctx context.Context, domainName string) string {
+	d, err := dns.ParseDomain(domainName)
+	xcheckuserf(ctx, err, "parsing domain")
+	xdomainAllowed(ctx, d)
+	dc, ok := mox.Conf.Domain(d)
+	if !ok {
+		xcheckuserf(ctx, errors.New("unknown domain"), "lookup domain")
+	}
+	log := pkglog.WithContext(ctx)
+	resolver := dns.StrictResolver{Pkg: "webadmin", Log: log.Logger}
+	txt, err := admin.MTASTSRecordPending(ctx, log, resolver, dc)
+	xcheckf(ctx, err, "checking mta-sts dns record")
+	return txt
+}
+
+// DomainWKDSave enables or disables serving OpenPGP keys published by accounts
+// through the Web Key Directory for the domain. If accounts is non-empty, only
+// those accounts can publish keys.
+func (Admin) DomainWKDSave(ctx context.Context, domainName string, enabled bool, accounts []string) {
+	for _, acc := range accounts {
+		xaccountAllowed(ctx, acc)
+	}
+	err := admin.DomainSave(ctx, domainName, func(d *config.Domain) error {
+		if !enabled {
+			d.WKD = nil
+		} else {
+			d.WKD = &config.WKD{Accounts: accounts}
+		}
+		return nil
+	})
+	xcheckf(ctx, err, "saving wkd settings for domain")
+}
+
+// DomainWellKnownSave saves the files served under /.well-known/ for the domain,
+// e.g. security.txt. If neither a security.txt nor a change-password URL is set,
+// no well-known files are served.
+func (Admin) DomainWellKnownSave(ctx context.Context, domainName string, wellKnown config.WellKnown) {
+	err := admin.DomainSave(ctx, domainName, func(d *config.Domain) error {
+		if wellKnown.SecurityTXT == nil && wellKnown.ChangePasswordURL == "" {
+			d.WellKnown = nil
+		} else {
+			d.WellKnown = &wellKnown
+		}
+		return nil
+	})
+	xcheckf(ctx, err, "saving well-known files for domain")
+}
+
 // DomainDKIMAdd adds a DKIM selector for a domain, generating a new private
 // key. The selector is not enabled for signing.
 func (Admin) DomainDKIMAdd(ctx context.Context, domainName, selector, algorithm, hash string, headerRelaxed, bodyRelaxed, seal bool, headers []string, lifetime time.Duration) {
@@ -2655,6 +3245,7 @@ func (Admin) DomainDKIMSave(ctx context.Context, domainName string, selectors ma
 				Canonicalization: nsel.Canonicalization,
 				DontSealHeaders:  nsel.DontSealHeaders,
 				Expiration:       nsel.Expiration,
+				Retiring:         nsel.Retiring,
 
 				PrivateKeyFile: osel.PrivateKeyFile,
 			}
@@ -2729,11 +3320,145 @@ func (Admin) AliasAddressesRemove(ctx context.Context, aliaslp string, domainNam
 }
 
 func (Admin) TLSPublicKeys(ctx context.Context, accountOpt string) ([]store.TLSPublicKey, error) {
-	return store.TLSPublicKeyList(ctx, accountOpt)
+	if admin.DomainAdminName(ctx) == "" {
+		return store.TLSPublicKeyList(ctx, accountOpt)
+	}
+	if accountOpt != "" {
+		xaccountAllowed(ctx, accountOpt)
+	}
+	l, err := store.TLSPublicKeyList(ctx, accountOpt)
+	l = slices.DeleteFunc(l, func(k store.TLSPublicKey) bool { return !admin.AccountAllowed(ctx, k.Account) })
+	return l, err
 }
 
 func (Admin) LoginAttempts(ctx context.Context, accountName string, limit int) []store.LoginAttempt {
-	l, err := store.LoginAttemptList(ctx, accountName, limit)
+	if admin.DomainAdminName(ctx) == "" {
+		l, err := store.LoginAttemptList(ctx, accountName, limit)
+		xcheckf(ctx, err, "listing login attempts")
+		return l
+	}
+
+	// For domain admins, only return login attempts for managed accounts.
+	var l []store.LoginAttempt
+	var err error
+	if accountName != "" {
+		xaccountAllowed(ctx, accountName)
+		l, err = store.LoginAttemptList(ctx, accountName, limit)
+	} else {
+		l, err = store.LoginAttemptList(ctx, "", 0)
+		l = slices.DeleteFunc(l, func(la store.LoginAttempt) bool { return !admin.AccountAllowed(ctx, la.AccountName) })
+		if limit > 0 && len(l) > limit {
+			l = l[:limit]
+		}
+	}
 	xcheckf(ctx, err, "listing login attempts")
 	return l
 }
+
+// AuthLockouts returns the counters of consecutive failed authentication attempts
+// per remote IP and account, including active lockouts.
+func (Admin) AuthLockouts(ctx context.Context) []store.AuthLockout {
+	l, err := store.AuthLockoutList(ctx)
+	xcheckf(ctx, err, "listing authentication lockouts")
+	return l
+}
+
+// AuthLockoutRemove removes a failure counter by its key, lifting any lockout for
+// the remote IP or account.
+func (Admin) AuthLockoutRemove(ctx context.Context, key string) {
+	log := pkglog.WithContext(ctx)
+	err := store.AuthLockoutRemove(ctx, log, key)
+	if errors.Is(err, bstore.ErrAbsent) {
+		xcheckuserf(ctx, err, "removing authentication lockout")
+	}
+	xcheckf(ctx, err, "removing authentication lockout")
+}
+
+// JunkDecisions returns the most recent decisions about incoming messages for an
+// account, with the inputs to the decisions. At most limit decisions are
+// returned, if greater than 0.
+func (Admin) JunkDecisions(ctx context.Context, accountName string, limit int) []store.JunkDecision {
+	log := pkglog.WithContext(ctx)
+	xaccountAllowed(ctx, accountName)
+
+	acc, err := store.OpenAccount(log, accountName, false)
+	if err != nil && errors.Is(err, store.ErrAccountUnknown) {
+		xcheckuserf(ctx, err, "open account")
+	}
+	xcheckf(ctx, err, "open account")
+	defer func() {
+		err := acc.Close()
+		log.Check(err, "closing account")
+	}()
+
+	l, err := acc.JunkDecisions(ctx, time.Time{}, time.Time{}, limit)
+	xcheckf(ctx, err, "list junk decisions")
+	return l
+}
+
+// IMAPClients returns the inventory of IMAP client software, as identified with
+// the IMAP ID command at login, for accountName, or for all accounts if empty.
+// Most recently used first.
+func (Admin) IMAPClients(ctx context.Context, accountName string) []store.IMAPClient {
+	if accountName != "" {
+		xaccountAllowed(ctx, accountName)
+	}
+	l, err := store.IMAPClientList(ctx, accountName)
+	xcheckf(ctx, err, "listing imap clients")
+	if admin.DomainAdminName(ctx) != "" {
+		l = slices.DeleteFunc(l, func(c store.IMAPClient) bool { return !admin.AccountAllowed(ctx, c.AccountName) })
+	}
+	return l
+}
+
+// IMAPConnections returns the open IMAP connections, for all listeners. For
+// domain admins, only authenticated connections of managed accounts are returned.
+func (Admin) IMAPConnections(ctx context.Context) []imapserver.Connection {
+	l := imapserver.ConnectionList()
+	if admin.DomainAdminName(ctx) != "" {
+		l = slices.DeleteFunc(l, func(c imapserver.Connection) bool { return c.Account == "" || !admin.AccountAllowed(ctx, c.Account) })
+	}
+	return l
+}
+
+// IMAPConnectionClose closes an open IMAP connection by its connection ID, after
+// sending a BYE. A command in progress is aborted.
+func (Admin) IMAPConnectionClose(ctx context.Context, cid int64) {
+	if admin.DomainAdminName(ctx) != "" {
+		l := imapserver.ConnectionList()
+		i := slices.IndexFunc(l, func(c imapserver.Connection) bool { return c.CID == cid })
+		if i < 0 || l[i].Account == "" || !admin.AccountAllowed(ctx, l[i].Account) {
+			xusererrorf(ctx, "unknown connection")
+		}
+	}
+	err := imapserver.ConnectionClose(cid, "connection closed by administrator")
+	if errors.Is(err, imapserver.ErrConnectionUnknown) {
+		xusererrorf(ctx, "unknown connection")
+	}
+	xcheckf(ctx, err, "closing connection")
+}
+
+// WebSessions returns the login sessions for the webmail and account web
+// interfaces of an account that have not expired, most recently used first.
+func (Admin) WebSessions(ctx context.Context, accountName string) []store.LoginSession {
+	xaccountAllowed(ctx, accountName)
+	log := pkglog.WithContext(ctx)
+	l, err := store.SessionList(ctx, log, accountName)
+	if errors.Is(err, store.ErrAccountUnknown) {
+		xusererrorf(ctx, "unknown account")
+	}
+	xcheckf(ctx, err, "listing sessions")
+	return l
+}
+
+// WebSessionRemove removes a login session of an account, logging out the user
+// of that session.
+func (Admin) WebSessionRemove(ctx context.Context, accountName string, sessionID int64) {
+	xaccountAllowed(ctx, accountName)
+	log := pkglog.WithContext(ctx)
+	err := store.SessionRemoveID(ctx, log, accountName, sessionID)
+	if errors.Is(err, store.ErrAccountUnknown) || errors.Is(err, store.ErrSessionUnknown) {
+		xcheckuserf(ctx, err, "removing session")
+	}
+	xcheckf(ctx, err, "removing session")
+}
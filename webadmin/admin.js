@@ -250,6 +250,21 @@ var api;
 		Mode["ModeTesting"] = "testing";
 		Mode["ModeNone"] = "none";
 	})(Mode = api.Mode || (api.Mode = {}));
+	// Kind of event.
+	let Kind;
+	(function (Kind) {
+		Kind["KindReceived"] = "received";
+		// Junk verdict for an incoming message. Success indicates the message was
+		// accepted, Detail holds the reason for the verdict.
+		Kind["KindJunkVerdict"] = "junkverdict";
+		Kind["KindDelivered"] = "delivered";
+		Kind["KindQueued"] = "queued";
+		// Delivery attempt of an outgoing message from the queue that failed
+		// temporarily. Another attempt will be made later.
+		Kind["KindAttempt"] = "attempt";
+		Kind["KindSent"] = "sent";
+		Kind["KindBounced"] = "bounced";
+	})(Kind = api.Kind || (api.Kind = {}));
 	// AuthResult is the result of a login attempt.
 	let AuthResult;
 	(function (AuthResult) {
@@ -260,11 +275,12 @@ var api;
 		AuthResult["AuthBadChannelBinding"] = "badchanbind";
 		AuthResult["AuthBadProtocol"] = "badprotocol";
 		AuthResult["AuthLoginDisabled"] = "logindisabled";
+		AuthResult["AuthClientDenied"] = "clientdenied";
 		AuthResult["AuthError"] = "error";
 		AuthResult["AuthAborted"] = "aborted";
 	})(AuthResult = api.AuthResult || (api.AuthResult = {}));
-	api.structTypes = { "Account": true, "Address": true, "AddressAlias": true, "Alias": true, "AliasAddress": true, "AuthResults": true, "AutoconfCheckResult": true, "AutodiscoverCheckResult": true, "AutodiscoverSRV": true, "AutomaticJunkFlags": true, "Canonicalization": true, "CheckResult": true, "ClientConfigs": true, "ClientConfigsEntry": true, "ConfigDomain": true, "DANECheckResult": true, "DKIM": true, "DKIMAuthResult": true, "DKIMCheckResult": true, "DKIMRecord": true, "DMARC": true, "DMARCCheckResult": true, "DMARCRecord": true, "DMARCSummary": true, "DNSSECResult": true, "DateRange": true, "Destination": true, "Directive": true, "Domain": true, "DomainFeedback": true, "Dynamic": true, "Evaluation": true, "EvaluationStat": true, "Extension": true, "FailureDetails": true, "Filter": true, "HoldRule": true, "Hook": true, "HookFilter": true, "HookResult": true, "HookRetired": true, "HookRetiredFilter": true, "HookRetiredSort": true, "HookSort": true, "IPDomain": true, "IPRevCheckResult": true, "Identifiers": true, "IncomingWebhook": true, "JunkFilter": true, "LoginAttempt": true, "MTASTS": true, "MTASTSCheckResult": true, "MTASTSRecord": true, "MX": true, "MXCheckResult": true, "Modifier": true, "Msg": true, "MsgResult": true, "MsgRetired": true, "OutgoingWebhook": true, "Pair": true, "Policy": true, "PolicyEvaluated": true, "PolicyOverrideReason": true, "PolicyPublished": true, "PolicyRecord": true, "Record": true, "Report": true, "ReportMetadata": true, "ReportRecord": true, "Result": true, "ResultPolicy": true, "RetiredFilter": true, "RetiredSort": true, "Reverse": true, "Route": true, "Row": true, "Ruleset": true, "SMTPAuth": true, "SPFAuthResult": true, "SPFCheckResult": true, "SPFRecord": true, "SRV": true, "SRVConfCheckResult": true, "STSMX": true, "Selector": true, "Sort": true, "SubjectPass": true, "Summary": true, "SuppressAddress": true, "TLSCheckResult": true, "TLSPublicKey": true, "TLSRPT": true, "TLSRPTCheckResult": true, "TLSRPTDateRange": true, "TLSRPTRecord": true, "TLSRPTSummary": true, "TLSRPTSuppressAddress": true, "TLSReportRecord": true, "TLSResult": true, "Transport": true, "TransportDirect": true, "TransportSMTP": true, "TransportSocks": true, "URI": true, "WebForward": true, "WebHandler": true, "WebInternal": true, "WebRedirect": true, "WebStatic": true, "WebserverConfig": true };
-	api.stringsTypes = { "Align": true, "AuthResult": true, "CSRFToken": true, "DMARCPolicy": true, "IP": true, "Localpart": true, "Mode": true, "RUA": true };
+	api.structTypes = { "Account": true, "Address": true, "AddressAlias": true, "AddressEntry": true, "AdminToken": true, "AdminWebhook": true, "Advice": true, "AdviceSource": true, "Alias": true, "AliasAddress": true, "ArchiveTier": true, "AuthLockout": true, "AuthResults": true, "AutoArchive": true, "AutoconfCheckResult": true, "AutodiscoverCheckResult": true, "AutodiscoverSRV": true, "AutomaticJunkFlags": true, "Canonicalization": true, "CheckResult": true, "ClientConfigs": true, "ClientConfigsEntry": true, "ConfigDomain": true, "ConfigPreview": true, "Connection": true, "DANECheckResult": true, "DKIM": true, "DKIMAuthResult": true, "DKIMCheckResult": true, "DKIMRecord": true, "DMARC": true, "DMARCCheckResult": true, "DMARCRecord": true, "DMARCSummary": true, "DNSSECResult": true, "DateRange": true, "Destination": true, "Directive": true, "Domain": true, "DomainAdmin": true, "DomainFeedback": true, "DuplicateWindow": true, "Dynamic": true, "Evaluation": true, "EvaluationStat": true, "Event": true, "EventFilter": true, "Extension": true, "FailureDetails": true, "Filter": true, "Forward": true, "HoldRule": true, "Hook": true, "HookFilter": true, "HookResult": true, "HookRetired": true, "HookRetiredFilter": true, "HookRetiredSort": true, "HookSort": true, "IMAPClient": true, "IMAPClientRule": true, "IPDomain": true, "IPRevCheckResult": true, "Identifiers": true, "ImportJob": true, "InboundHeaders": true, "IncomingWebhook": true, "JunkDecision": true, "JunkFilter": true, "LoginAttempt": true, "LoginSession": true, "LoginToken": true, "MTASTS": true, "MTASTSCheckResult": true, "MTASTSRecord": true, "MX": true, "MXCheckResult": true, "MessageCompression": true, "MessageEncryption": true, "Modifier": true, "Msg": true, "MsgResult": true, "MsgRetired": true, "OutgoingWebhook": true, "Pair": true, "Policy": true, "PolicyEvaluated": true, "PolicyOverrideReason": true, "PolicyPublished": true, "PolicyRecord": true, "Record": true, "Report": true, "ReportMetadata": true, "ReportRecord": true, "Result": true, "ResultPolicy": true, "RetiredFilter": true, "RetiredSort": true, "Reverse": true, "Route": true, "Row": true, "Ruleset": true, "SMTPAuth": true, "SPF": true, "SPFAuthResult": true, "SPFCheckResult": true, "SPFRecord": true, "SRV": true, "SRVConfCheckResult": true, "STSMX": true, "SecurityTXT": true, "Selector": true, "Sort": true, "SpoofIncident": true, "SubjectPass": true, "SubmissionChecks": true, "Summary": true, "SuppressAddress": true, "TLSCheckResult": true, "TLSClientAuth": true, "TLSPublicKey": true, "TLSRPT": true, "TLSRPTCheckResult": true, "TLSRPTDateRange": true, "TLSRPTRecord": true, "TLSRPTSummary": true, "TLSRPTSuppressAddress": true, "TLSReportRecord": true, "TLSResult": true, "Transport": true, "TransportDirect": true, "TransportSMTP": true, "TransportSocks": true, "URI": true, "WKD": true, "WebForward": true, "WebHandler": true, "WebInternal": true, "WebRedirect": true, "WebStatic": true, "WebserverConfig": true, "WellKnown": true, "WordScore": true };
+	api.stringsTypes = { "Align": true, "AuthResult": true, "CSRFToken": true, "DMARCPolicy": true, "IP": true, "Kind": true, "Localpart": true, "Mode": true, "RUA": true };
 	api.intsTypes = {};
 	api.types = {
 		"CheckResult": { "Name": "CheckResult", "Docs": "", "Fields": [{ "Name": "Domain", "Docs": "", "Typewords": ["string"] }, { "Name": "DNSSEC", "Docs": "", "Typewords": ["DNSSECResult"] }, { "Name": "IPRev", "Docs": "", "Typewords": ["IPRevCheckResult"] }, { "Name": "MX", "Docs": "", "Typewords": ["MXCheckResult"] }, { "Name": "TLS", "Docs": "", "Typewords": ["TLSCheckResult"] }, { "Name": "DANE", "Docs": "", "Typewords": ["DANECheckResult"] }, { "Name": "SPF", "Docs": "", "Typewords": ["SPFCheckResult"] }, { "Name": "DKIM", "Docs": "", "Typewords": ["DKIMCheckResult"] }, { "Name": "DMARC", "Docs": "", "Typewords": ["DMARCCheckResult"] }, { "Name": "HostTLSRPT", "Docs": "", "Typewords": ["TLSRPTCheckResult"] }, { "Name": "DomainTLSRPT", "Docs": "", "Typewords": ["TLSRPTCheckResult"] }, { "Name": "MTASTS", "Docs": "", "Typewords": ["MTASTSCheckResult"] }, { "Name": "SRVConf", "Docs": "", "Typewords": ["SRVConfCheckResult"] }, { "Name": "Autoconf", "Docs": "", "Typewords": ["AutoconfCheckResult"] }, { "Name": "Autodiscover", "Docs": "", "Typewords": ["AutodiscoverCheckResult"] }] },
@@ -298,25 +314,38 @@ var api;
 		"AutoconfCheckResult": { "Name": "AutoconfCheckResult", "Docs": "", "Fields": [{ "Name": "ClientSettingsDomainIPs", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "IPs", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "Errors", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "Warnings", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "Instructions", "Docs": "", "Typewords": ["[]", "string"] }] },
 		"AutodiscoverCheckResult": { "Name": "AutodiscoverCheckResult", "Docs": "", "Fields": [{ "Name": "Records", "Docs": "", "Typewords": ["[]", "AutodiscoverSRV"] }, { "Name": "Errors", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "Warnings", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "Instructions", "Docs": "", "Typewords": ["[]", "string"] }] },
 		"AutodiscoverSRV": { "Name": "AutodiscoverSRV", "Docs": "", "Fields": [{ "Name": "Target", "Docs": "", "Typewords": ["string"] }, { "Name": "Port", "Docs": "", "Typewords": ["uint16"] }, { "Name": "Priority", "Docs": "", "Typewords": ["uint16"] }, { "Name": "Weight", "Docs": "", "Typewords": ["uint16"] }, { "Name": "IPs", "Docs": "", "Typewords": ["[]", "string"] }] },
-		"ConfigDomain": { "Name": "ConfigDomain", "Docs": "", "Fields": [{ "Name": "Disabled", "Docs": "", "Typewords": ["bool"] }, { "Name": "Description", "Docs": "", "Typewords": ["string"] }, { "Name": "ClientSettingsDomain", "Docs": "", "Typewords": ["string"] }, { "Name": "LocalpartCatchallSeparator", "Docs": "", "Typewords": ["string"] }, { "Name": "LocalpartCaseSensitive", "Docs": "", "Typewords": ["bool"] }, { "Name": "DKIM", "Docs": "", "Typewords": ["DKIM"] }, { "Name": "DMARC", "Docs": "", "Typewords": ["nullable", "DMARC"] }, { "Name": "MTASTS", "Docs": "", "Typewords": ["nullable", "MTASTS"] }, { "Name": "TLSRPT", "Docs": "", "Typewords": ["nullable", "TLSRPT"] }, { "Name": "Routes", "Docs": "", "Typewords": ["[]", "Route"] }, { "Name": "Aliases", "Docs": "", "Typewords": ["{}", "Alias"] }, { "Name": "Domain", "Docs": "", "Typewords": ["Domain"] }] },
+		"ConfigDomain": { "Name": "ConfigDomain", "Docs": "", "Fields": [{ "Name": "Disabled", "Docs": "", "Typewords": ["bool"] }, { "Name": "Description", "Docs": "", "Typewords": ["string"] }, { "Name": "ClientSettingsDomain", "Docs": "", "Typewords": ["string"] }, { "Name": "LocalpartCatchallSeparator", "Docs": "", "Typewords": ["string"] }, { "Name": "LocalpartCaseSensitive", "Docs": "", "Typewords": ["bool"] }, { "Name": "DKIM", "Docs": "", "Typewords": ["DKIM"] }, { "Name": "DMARC", "Docs": "", "Typewords": ["nullable", "DMARC"] }, { "Name": "MTASTS", "Docs": "", "Typewords": ["nullable", "MTASTS"] }, { "Name": "WKD", "Docs": "", "Typewords": ["nullable", "WKD"] }, { "Name": "WellKnown", "Docs": "", "Typewords": ["nullable", "WellKnown"] }, { "Name": "TLSRPT", "Docs": "", "Typewords": ["nullable", "TLSRPT"] }, { "Name": "SPF", "Docs": "", "Typewords": ["nullable", "SPF"] }, { "Name": "Routes", "Docs": "", "Typewords": ["[]", "Route"] }, { "Name": "Aliases", "Docs": "", "Typewords": ["{}", "Alias"] }, { "Name": "InboundHeaders", "Docs": "", "Typewords": ["nullable", "InboundHeaders"] }, { "Name": "LookalikeSenders", "Docs": "", "Typewords": ["string"] }, { "Name": "SpoofingSurges", "Docs": "", "Typewords": ["string"] }, { "Name": "Domain", "Docs": "", "Typewords": ["Domain"] }] },
 		"DKIM": { "Name": "DKIM", "Docs": "", "Fields": [{ "Name": "Selectors", "Docs": "", "Typewords": ["{}", "Selector"] }, { "Name": "Sign", "Docs": "", "Typewords": ["[]", "string"] }] },
-		"Selector": { "Name": "Selector", "Docs": "", "Fields": [{ "Name": "Hash", "Docs": "", "Typewords": ["string"] }, { "Name": "HashEffective", "Docs": "", "Typewords": ["string"] }, { "Name": "Canonicalization", "Docs": "", "Typewords": ["Canonicalization"] }, { "Name": "Headers", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "HeadersEffective", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "DontSealHeaders", "Docs": "", "Typewords": ["bool"] }, { "Name": "Expiration", "Docs": "", "Typewords": ["string"] }, { "Name": "PrivateKeyFile", "Docs": "", "Typewords": ["string"] }, { "Name": "Algorithm", "Docs": "", "Typewords": ["string"] }] },
+		"Selector": { "Name": "Selector", "Docs": "", "Fields": [{ "Name": "Hash", "Docs": "", "Typewords": ["string"] }, { "Name": "HashEffective", "Docs": "", "Typewords": ["string"] }, { "Name": "Canonicalization", "Docs": "", "Typewords": ["Canonicalization"] }, { "Name": "Headers", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "HeadersEffective", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "DontSealHeaders", "Docs": "", "Typewords": ["bool"] }, { "Name": "Expiration", "Docs": "", "Typewords": ["string"] }, { "Name": "PrivateKeyFile", "Docs": "", "Typewords": ["string"] }, { "Name": "Retiring", "Docs": "", "Typewords": ["bool"] }, { "Name": "Algorithm", "Docs": "", "Typewords": ["string"] }] },
 		"Canonicalization": { "Name": "Canonicalization", "Docs": "", "Fields": [{ "Name": "HeaderRelaxed", "Docs": "", "Typewords": ["bool"] }, { "Name": "BodyRelaxed", "Docs": "", "Typewords": ["bool"] }] },
-		"DMARC": { "Name": "DMARC", "Docs": "", "Fields": [{ "Name": "Localpart", "Docs": "", "Typewords": ["string"] }, { "Name": "Domain", "Docs": "", "Typewords": ["string"] }, { "Name": "Account", "Docs": "", "Typewords": ["string"] }, { "Name": "Mailbox", "Docs": "", "Typewords": ["string"] }, { "Name": "ParsedLocalpart", "Docs": "", "Typewords": ["Localpart"] }, { "Name": "DNSDomain", "Docs": "", "Typewords": ["Domain"] }] },
-		"MTASTS": { "Name": "MTASTS", "Docs": "", "Fields": [{ "Name": "PolicyID", "Docs": "", "Typewords": ["string"] }, { "Name": "Mode", "Docs": "", "Typewords": ["Mode"] }, { "Name": "MaxAge", "Docs": "", "Typewords": ["int64"] }, { "Name": "MX", "Docs": "", "Typewords": ["[]", "string"] }] },
+		"DMARC": { "Name": "DMARC", "Docs": "", "Fields": [{ "Name": "Localpart", "Docs": "", "Typewords": ["string"] }, { "Name": "Domain", "Docs": "", "Typewords": ["string"] }, { "Name": "Account", "Docs": "", "Typewords": ["string"] }, { "Name": "Mailbox", "Docs": "", "Typewords": ["string"] }, { "Name": "Policy", "Docs": "", "Typewords": ["string"] }, { "Name": "ParsedLocalpart", "Docs": "", "Typewords": ["Localpart"] }, { "Name": "DNSDomain", "Docs": "", "Typewords": ["Domain"] }] },
+		"MTASTS": { "Name": "MTASTS", "Docs": "", "Fields": [{ "Name": "PolicyID", "Docs": "", "Typewords": ["string"] }, { "Name": "Mode", "Docs": "", "Typewords": ["Mode"] }, { "Name": "MaxAge", "Docs": "", "Typewords": ["int64"] }, { "Name": "MX", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "MaxAgeRampDays", "Docs": "", "Typewords": ["int32"] }] },
+		"WKD": { "Name": "WKD", "Docs": "", "Fields": [{ "Name": "Accounts", "Docs": "", "Typewords": ["[]", "string"] }] },
+		"WellKnown": { "Name": "WellKnown", "Docs": "", "Fields": [{ "Name": "SecurityTXT", "Docs": "", "Typewords": ["nullable", "SecurityTXT"] }, { "Name": "ChangePasswordURL", "Docs": "", "Typewords": ["string"] }] },
+		"SecurityTXT": { "Name": "SecurityTXT", "Docs": "", "Fields": [{ "Name": "Contact", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "Expires", "Docs": "", "Typewords": ["string"] }, { "Name": "Encryption", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "Acknowledgments", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "PreferredLanguages", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "Canonical", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "Policy", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "Hiring", "Docs": "", "Typewords": ["[]", "string"] }] },
 		"TLSRPT": { "Name": "TLSRPT", "Docs": "", "Fields": [{ "Name": "Localpart", "Docs": "", "Typewords": ["string"] }, { "Name": "Domain", "Docs": "", "Typewords": ["string"] }, { "Name": "Account", "Docs": "", "Typewords": ["string"] }, { "Name": "Mailbox", "Docs": "", "Typewords": ["string"] }, { "Name": "ParsedLocalpart", "Docs": "", "Typewords": ["Localpart"] }, { "Name": "DNSDomain", "Docs": "", "Typewords": ["Domain"] }] },
-		"Route": { "Name": "Route", "Docs": "", "Fields": [{ "Name": "FromDomain", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "ToDomain", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "MinimumAttempts", "Docs": "", "Typewords": ["int32"] }, { "Name": "Transport", "Docs": "", "Typewords": ["string"] }, { "Name": "FromDomainASCII", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "ToDomainASCII", "Docs": "", "Typewords": ["[]", "string"] }] },
-		"Alias": { "Name": "Alias", "Docs": "", "Fields": [{ "Name": "Addresses", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "PostPublic", "Docs": "", "Typewords": ["bool"] }, { "Name": "ListMembers", "Docs": "", "Typewords": ["bool"] }, { "Name": "AllowMsgFrom", "Docs": "", "Typewords": ["bool"] }, { "Name": "LocalpartStr", "Docs": "", "Typewords": ["string"] }, { "Name": "Domain", "Docs": "", "Typewords": ["Domain"] }, { "Name": "ParsedAddresses", "Docs": "", "Typewords": ["[]", "AliasAddress"] }] },
+		"SPF": { "Name": "SPF", "Docs": "", "Fields": [{ "Name": "Includes", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "IPs", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "All", "Docs": "", "Typewords": ["string"] }] },
+		"Route": { "Name": "Route", "Docs": "", "Fields": [{ "Name": "FromDomain", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "ToDomain", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "MinimumAttempts", "Docs": "", "Typewords": ["int32"] }, { "Name": "Transport", "Docs": "", "Typewords": ["string"] }, { "Name": "Failover", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "FailoverErrors", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "FromDomainASCII", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "ToDomainASCII", "Docs": "", "Typewords": ["[]", "string"] }] },
+		"Alias": { "Name": "Alias", "Docs": "", "Fields": [{ "Name": "Addresses", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "PostPublic", "Docs": "", "Typewords": ["bool"] }, { "Name": "ListMembers", "Docs": "", "Typewords": ["bool"] }, { "Name": "AllowMsgFrom", "Docs": "", "Typewords": ["bool"] }, { "Name": "ListUnsubscribe", "Docs": "", "Typewords": ["bool"] }, { "Name": "LocalpartStr", "Docs": "", "Typewords": ["string"] }, { "Name": "Domain", "Docs": "", "Typewords": ["Domain"] }, { "Name": "ParsedAddresses", "Docs": "", "Typewords": ["[]", "AliasAddress"] }, { "Name": "RemoteAddresses", "Docs": "", "Typewords": ["[]", "Address"] }] },
 		"AliasAddress": { "Name": "AliasAddress", "Docs": "", "Fields": [{ "Name": "Address", "Docs": "", "Typewords": ["Address"] }, { "Name": "AccountName", "Docs": "", "Typewords": ["string"] }, { "Name": "Destination", "Docs": "", "Typewords": ["Destination"] }] },
 		"Address": { "Name": "Address", "Docs": "", "Fields": [{ "Name": "Localpart", "Docs": "", "Typewords": ["Localpart"] }, { "Name": "Domain", "Docs": "", "Typewords": ["Domain"] }] },
-		"Destination": { "Name": "Destination", "Docs": "", "Fields": [{ "Name": "Mailbox", "Docs": "", "Typewords": ["string"] }, { "Name": "Rulesets", "Docs": "", "Typewords": ["[]", "Ruleset"] }, { "Name": "SMTPError", "Docs": "", "Typewords": ["string"] }, { "Name": "MessageAuthRequiredSMTPError", "Docs": "", "Typewords": ["string"] }, { "Name": "FullName", "Docs": "", "Typewords": ["string"] }] },
-		"Ruleset": { "Name": "Ruleset", "Docs": "", "Fields": [{ "Name": "SMTPMailFromRegexp", "Docs": "", "Typewords": ["string"] }, { "Name": "MsgFromRegexp", "Docs": "", "Typewords": ["string"] }, { "Name": "VerifiedDomain", "Docs": "", "Typewords": ["string"] }, { "Name": "HeadersRegexp", "Docs": "", "Typewords": ["{}", "string"] }, { "Name": "IsForward", "Docs": "", "Typewords": ["bool"] }, { "Name": "ListAllowDomain", "Docs": "", "Typewords": ["string"] }, { "Name": "AcceptRejectsToMailbox", "Docs": "", "Typewords": ["string"] }, { "Name": "Mailbox", "Docs": "", "Typewords": ["string"] }, { "Name": "Comment", "Docs": "", "Typewords": ["string"] }, { "Name": "VerifiedDNSDomain", "Docs": "", "Typewords": ["Domain"] }, { "Name": "ListAllowDNSDomain", "Docs": "", "Typewords": ["Domain"] }] },
-		"Account": { "Name": "Account", "Docs": "", "Fields": [{ "Name": "OutgoingWebhook", "Docs": "", "Typewords": ["nullable", "OutgoingWebhook"] }, { "Name": "IncomingWebhook", "Docs": "", "Typewords": ["nullable", "IncomingWebhook"] }, { "Name": "FromIDLoginAddresses", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "KeepRetiredMessagePeriod", "Docs": "", "Typewords": ["int64"] }, { "Name": "KeepRetiredWebhookPeriod", "Docs": "", "Typewords": ["int64"] }, { "Name": "LoginDisabled", "Docs": "", "Typewords": ["string"] }, { "Name": "Domain", "Docs": "", "Typewords": ["string"] }, { "Name": "Description", "Docs": "", "Typewords": ["string"] }, { "Name": "FullName", "Docs": "", "Typewords": ["string"] }, { "Name": "Destinations", "Docs": "", "Typewords": ["{}", "Destination"] }, { "Name": "SubjectPass", "Docs": "", "Typewords": ["SubjectPass"] }, { "Name": "QuotaMessageSize", "Docs": "", "Typewords": ["int64"] }, { "Name": "RejectsMailbox", "Docs": "", "Typewords": ["string"] }, { "Name": "KeepRejects", "Docs": "", "Typewords": ["bool"] }, { "Name": "AutomaticJunkFlags", "Docs": "", "Typewords": ["AutomaticJunkFlags"] }, { "Name": "JunkFilter", "Docs": "", "Typewords": ["nullable", "JunkFilter"] }, { "Name": "MaxOutgoingMessagesPerDay", "Docs": "", "Typewords": ["int32"] }, { "Name": "MaxFirstTimeRecipientsPerDay", "Docs": "", "Typewords": ["int32"] }, { "Name": "NoFirstTimeSenderDelay", "Docs": "", "Typewords": ["bool"] }, { "Name": "NoCustomPassword", "Docs": "", "Typewords": ["bool"] }, { "Name": "Routes", "Docs": "", "Typewords": ["[]", "Route"] }, { "Name": "DNSDomain", "Docs": "", "Typewords": ["Domain"] }, { "Name": "Aliases", "Docs": "", "Typewords": ["[]", "AddressAlias"] }] },
+		"Destination": { "Name": "Destination", "Docs": "", "Fields": [{ "Name": "Mailbox", "Docs": "", "Typewords": ["string"] }, { "Name": "Rulesets", "Docs": "", "Typewords": ["[]", "Ruleset"] }, { "Name": "SMTPError", "Docs": "", "Typewords": ["string"] }, { "Name": "MessageAuthRequiredSMTPError", "Docs": "", "Typewords": ["string"] }, { "Name": "FullName", "Docs": "", "Typewords": ["string"] }, { "Name": "Disabled", "Docs": "", "Typewords": ["bool"] }, { "Name": "DuplicateWindow", "Docs": "", "Typewords": ["nullable", "DuplicateWindow"] }, { "Name": "Forward", "Docs": "", "Typewords": ["nullable", "Forward"] }] },
+		"Ruleset": { "Name": "Ruleset", "Docs": "", "Fields": [{ "Name": "SMTPMailFromRegexp", "Docs": "", "Typewords": ["string"] }, { "Name": "MsgFromRegexp", "Docs": "", "Typewords": ["string"] }, { "Name": "MsgToRegexp", "Docs": "", "Typewords": ["string"] }, { "Name": "VerifiedDomain", "Docs": "", "Typewords": ["string"] }, { "Name": "HeadersRegexp", "Docs": "", "Typewords": ["{}", "string"] }, { "Name": "IsForward", "Docs": "", "Typewords": ["bool"] }, { "Name": "ListAllowDomain", "Docs": "", "Typewords": ["string"] }, { "Name": "AcceptRejectsToMailbox", "Docs": "", "Typewords": ["string"] }, { "Name": "Mailbox", "Docs": "", "Typewords": ["string"] }, { "Name": "Seen", "Docs": "", "Typewords": ["bool"] }, { "Name": "Keywords", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "ForwardTo", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "Discard", "Docs": "", "Typewords": ["bool"] }, { "Name": "Comment", "Docs": "", "Typewords": ["string"] }, { "Name": "VerifiedDNSDomain", "Docs": "", "Typewords": ["Domain"] }, { "Name": "ListAllowDNSDomain", "Docs": "", "Typewords": ["Domain"] }] },
+		"DuplicateWindow": { "Name": "DuplicateWindow", "Docs": "", "Fields": [{ "Name": "Period", "Docs": "", "Typewords": ["int64"] }, { "Name": "Suppress", "Docs": "", "Typewords": ["bool"] }] },
+		"Forward": { "Name": "Forward", "Docs": "", "Fields": [{ "Name": "To", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "KeepCopy", "Docs": "", "Typewords": ["bool"] }, { "Name": "Disabled", "Docs": "", "Typewords": ["bool"] }] },
+		"InboundHeaders": { "Name": "InboundHeaders", "Docs": "", "Fields": [{ "Name": "SubjectPrefix", "Docs": "", "Typewords": ["string"] }, { "Name": "Headers", "Docs": "", "Typewords": ["{}", "string"] }, { "Name": "InternalDomains", "Docs": "", "Typewords": ["[]", "string"] }] },
+		"Account": { "Name": "Account", "Docs": "", "Fields": [{ "Name": "OutgoingWebhook", "Docs": "", "Typewords": ["nullable", "OutgoingWebhook"] }, { "Name": "IncomingWebhook", "Docs": "", "Typewords": ["nullable", "IncomingWebhook"] }, { "Name": "FromIDLoginAddresses", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "KeepRetiredMessagePeriod", "Docs": "", "Typewords": ["int64"] }, { "Name": "KeepRetiredWebhookPeriod", "Docs": "", "Typewords": ["int64"] }, { "Name": "LoginDisabled", "Docs": "", "Typewords": ["string"] }, { "Name": "Suspended", "Docs": "", "Typewords": ["string"] }, { "Name": "SuspendedReject", "Docs": "", "Typewords": ["bool"] }, { "Name": "LoginNetworks", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "Domain", "Docs": "", "Typewords": ["string"] }, { "Name": "Description", "Docs": "", "Typewords": ["string"] }, { "Name": "FullName", "Docs": "", "Typewords": ["string"] }, { "Name": "Template", "Docs": "", "Typewords": ["string"] }, { "Name": "Destinations", "Docs": "", "Typewords": ["{}", "Destination"] }, { "Name": "SubjectPass", "Docs": "", "Typewords": ["SubjectPass"] }, { "Name": "QuotaMessageSize", "Docs": "", "Typewords": ["int64"] }, { "Name": "MaxAppendSize", "Docs": "", "Typewords": ["int64"] }, { "Name": "MaxIMAPConnections", "Docs": "", "Typewords": ["int32"] }, { "Name": "RejectsMailbox", "Docs": "", "Typewords": ["string"] }, { "Name": "KeepRejects", "Docs": "", "Typewords": ["bool"] }, { "Name": "AutomaticJunkFlags", "Docs": "", "Typewords": ["AutomaticJunkFlags"] }, { "Name": "JunkFilter", "Docs": "", "Typewords": ["nullable", "JunkFilter"] }, { "Name": "MaxOutgoingMessagesPerDay", "Docs": "", "Typewords": ["int32"] }, { "Name": "MaxFirstTimeRecipientsPerDay", "Docs": "", "Typewords": ["int32"] }, { "Name": "NoFirstTimeSenderDelay", "Docs": "", "Typewords": ["bool"] }, { "Name": "DuplicateWindow", "Docs": "", "Typewords": ["nullable", "DuplicateWindow"] }, { "Name": "AutoArchive", "Docs": "", "Typewords": ["nullable", "AutoArchive"] }, { "Name": "ArchiveTier", "Docs": "", "Typewords": ["nullable", "ArchiveTier"] }, { "Name": "MessageCompression", "Docs": "", "Typewords": ["nullable", "MessageCompression"] }, { "Name": "MessageEncryption", "Docs": "", "Typewords": ["nullable", "MessageEncryption"] }, { "Name": "SubmissionChecks", "Docs": "", "Typewords": ["nullable", "SubmissionChecks"] }, { "Name": "TLSClientAuth", "Docs": "", "Typewords": ["[]", "TLSClientAuth"] }, { "Name": "NoCustomPassword", "Docs": "", "Typewords": ["bool"] }, { "Name": "Routes", "Docs": "", "Typewords": ["[]", "Route"] }, { "Name": "DNSDomain", "Docs": "", "Typewords": ["Domain"] }, { "Name": "Aliases", "Docs": "", "Typewords": ["[]", "AddressAlias"] }] },
 		"OutgoingWebhook": { "Name": "OutgoingWebhook", "Docs": "", "Fields": [{ "Name": "URL", "Docs": "", "Typewords": ["string"] }, { "Name": "Authorization", "Docs": "", "Typewords": ["string"] }, { "Name": "Events", "Docs": "", "Typewords": ["[]", "string"] }] },
 		"IncomingWebhook": { "Name": "IncomingWebhook", "Docs": "", "Fields": [{ "Name": "URL", "Docs": "", "Typewords": ["string"] }, { "Name": "Authorization", "Docs": "", "Typewords": ["string"] }] },
 		"SubjectPass": { "Name": "SubjectPass", "Docs": "", "Fields": [{ "Name": "Period", "Docs": "", "Typewords": ["int64"] }] },
 		"AutomaticJunkFlags": { "Name": "AutomaticJunkFlags", "Docs": "", "Fields": [{ "Name": "Enabled", "Docs": "", "Typewords": ["bool"] }, { "Name": "JunkMailboxRegexp", "Docs": "", "Typewords": ["string"] }, { "Name": "NeutralMailboxRegexp", "Docs": "", "Typewords": ["string"] }, { "Name": "NotJunkMailboxRegexp", "Docs": "", "Typewords": ["string"] }] },
 		"JunkFilter": { "Name": "JunkFilter", "Docs": "", "Fields": [{ "Name": "Threshold", "Docs": "", "Typewords": ["float64"] }, { "Name": "Onegrams", "Docs": "", "Typewords": ["bool"] }, { "Name": "Twograms", "Docs": "", "Typewords": ["bool"] }, { "Name": "Threegrams", "Docs": "", "Typewords": ["bool"] }, { "Name": "MaxPower", "Docs": "", "Typewords": ["float64"] }, { "Name": "TopWords", "Docs": "", "Typewords": ["int32"] }, { "Name": "IgnoreWords", "Docs": "", "Typewords": ["float64"] }, { "Name": "RareWords", "Docs": "", "Typewords": ["int32"] }] },
+		"AutoArchive": { "Name": "AutoArchive", "Docs": "", "Fields": [{ "Name": "Age", "Docs": "", "Typewords": ["int64"] }, { "Name": "Mailboxes", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "Mailbox", "Docs": "", "Typewords": ["string"] }, { "Name": "SkipUnread", "Docs": "", "Typewords": ["bool"] }, { "Name": "SkipFlagged", "Docs": "", "Typewords": ["bool"] }] },
+		"ArchiveTier": { "Name": "ArchiveTier", "Docs": "", "Fields": [{ "Name": "Age", "Docs": "", "Typewords": ["int64"] }, { "Name": "MaxMessageSize", "Docs": "", "Typewords": ["int64"] }] },
+		"MessageCompression": { "Name": "MessageCompression", "Docs": "", "Fields": [{ "Name": "Disabled", "Docs": "", "Typewords": ["bool"] }, { "Name": "MinMessageSize", "Docs": "", "Typewords": ["int64"] }, { "Name": "MaxMessageSize", "Docs": "", "Typewords": ["int64"] }] },
+		"MessageEncryption": { "Name": "MessageEncryption", "Docs": "", "Fields": [{ "Name": "KeyWrap", "Docs": "", "Typewords": ["string"] }] },
+		"SubmissionChecks": { "Name": "SubmissionChecks", "Docs": "", "Fields": [{ "Name": "RequireTo", "Docs": "", "Typewords": ["bool"] }, { "Name": "RequireSubject", "Docs": "", "Typewords": ["bool"] }, { "Name": "MaxRecipients", "Docs": "", "Typewords": ["int32"] }, { "Name": "ConfirmRecipients", "Docs": "", "Typewords": ["int32"] }] },
+		"TLSClientAuth": { "Name": "TLSClientAuth", "Docs": "", "Fields": [{ "Name": "Fingerprint", "Docs": "", "Typewords": ["string"] }, { "Name": "Subject", "Docs": "", "Typewords": ["string"] }, { "Name": "LoginAddress", "Docs": "", "Typewords": ["string"] }, { "Name": "NoIMAPPreauth", "Docs": "", "Typewords": ["bool"] }] },
 		"AddressAlias": { "Name": "AddressAlias", "Docs": "", "Fields": [{ "Name": "SubscriptionAddress", "Docs": "", "Typewords": ["string"] }, { "Name": "Alias", "Docs": "", "Typewords": ["Alias"] }, { "Name": "MemberAddresses", "Docs": "", "Typewords": ["[]", "string"] }] },
 		"PolicyRecord": { "Name": "PolicyRecord", "Docs": "", "Fields": [{ "Name": "Domain", "Docs": "", "Typewords": ["string"] }, { "Name": "Inserted", "Docs": "", "Typewords": ["timestamp"] }, { "Name": "ValidEnd", "Docs": "", "Typewords": ["timestamp"] }, { "Name": "LastUpdate", "Docs": "", "Typewords": ["timestamp"] }, { "Name": "LastUse", "Docs": "", "Typewords": ["timestamp"] }, { "Name": "Backoff", "Docs": "", "Typewords": ["bool"] }, { "Name": "RecordID", "Docs": "", "Typewords": ["string"] }, { "Name": "Version", "Docs": "", "Typewords": ["string"] }, { "Name": "Mode", "Docs": "", "Typewords": ["Mode"] }, { "Name": "MX", "Docs": "", "Typewords": ["[]", "STSMX"] }, { "Name": "MaxAgeSeconds", "Docs": "", "Typewords": ["int32"] }, { "Name": "Extensions", "Docs": "", "Typewords": ["[]", "Pair"] }, { "Name": "PolicyText", "Docs": "", "Typewords": ["string"] }] },
 		"TLSReportRecord": { "Name": "TLSReportRecord", "Docs": "", "Fields": [{ "Name": "ID", "Docs": "", "Typewords": ["int64"] }, { "Name": "Domain", "Docs": "", "Typewords": ["string"] }, { "Name": "FromDomain", "Docs": "", "Typewords": ["string"] }, { "Name": "MailFrom", "Docs": "", "Typewords": ["string"] }, { "Name": "HostReport", "Docs": "", "Typewords": ["bool"] }, { "Name": "Report", "Docs": "", "Typewords": ["Report"] }] },
@@ -340,25 +369,34 @@ var api;
 		"DKIMAuthResult": { "Name": "DKIMAuthResult", "Docs": "", "Fields": [{ "Name": "Domain", "Docs": "", "Typewords": ["string"] }, { "Name": "Selector", "Docs": "", "Typewords": ["string"] }, { "Name": "Result", "Docs": "", "Typewords": ["string"] }, { "Name": "HumanResult", "Docs": "", "Typewords": ["string"] }] },
 		"SPFAuthResult": { "Name": "SPFAuthResult", "Docs": "", "Fields": [{ "Name": "Domain", "Docs": "", "Typewords": ["string"] }, { "Name": "Scope", "Docs": "", "Typewords": ["string"] }, { "Name": "Result", "Docs": "", "Typewords": ["string"] }] },
 		"DMARCSummary": { "Name": "DMARCSummary", "Docs": "", "Fields": [{ "Name": "Domain", "Docs": "", "Typewords": ["string"] }, { "Name": "Total", "Docs": "", "Typewords": ["int32"] }, { "Name": "DispositionNone", "Docs": "", "Typewords": ["int32"] }, { "Name": "DispositionQuarantine", "Docs": "", "Typewords": ["int32"] }, { "Name": "DispositionReject", "Docs": "", "Typewords": ["int32"] }, { "Name": "DKIMFail", "Docs": "", "Typewords": ["int32"] }, { "Name": "SPFFail", "Docs": "", "Typewords": ["int32"] }, { "Name": "PolicyOverrides", "Docs": "", "Typewords": ["{}", "int32"] }] },
+		"Advice": { "Name": "Advice", "Docs": "", "Fields": [{ "Name": "Domain", "Docs": "", "Typewords": ["string"] }, { "Name": "Start", "Docs": "", "Typewords": ["timestamp"] }, { "Name": "End", "Docs": "", "Typewords": ["timestamp"] }, { "Name": "Reports", "Docs": "", "Typewords": ["int32"] }, { "Name": "Messages", "Docs": "", "Typewords": ["int32"] }, { "Name": "Unaligned", "Docs": "", "Typewords": ["int32"] }, { "Name": "UnalignedSources", "Docs": "", "Typewords": ["[]", "AdviceSource"] }, { "Name": "PublishedPolicy", "Docs": "", "Typewords": ["string"] }, { "Name": "PublishedPercentage", "Docs": "", "Typewords": ["int32"] }, { "Name": "RecommendedPolicy", "Docs": "", "Typewords": ["string"] }, { "Name": "Recommendation", "Docs": "", "Typewords": ["string"] }] },
+		"AdviceSource": { "Name": "AdviceSource", "Docs": "", "Fields": [{ "Name": "IP", "Docs": "", "Typewords": ["string"] }, { "Name": "Messages", "Docs": "", "Typewords": ["int32"] }] },
+		"SpoofIncident": { "Name": "SpoofIncident", "Docs": "", "Fields": [{ "Name": "ID", "Docs": "", "Typewords": ["int64"] }, { "Name": "Domain", "Docs": "", "Typewords": ["string"] }, { "Name": "Start", "Docs": "", "Typewords": ["timestamp"] }, { "Name": "End", "Docs": "", "Typewords": ["timestamp"] }, { "Name": "Messages", "Docs": "", "Typewords": ["int32"] }, { "Name": "Baseline", "Docs": "", "Typewords": ["float64"] }, { "Name": "Protected", "Docs": "", "Typewords": ["bool"] }, { "Name": "Sources", "Docs": "", "Typewords": ["[]", "AdviceSource"] }] },
 		"Reverse": { "Name": "Reverse", "Docs": "", "Fields": [{ "Name": "Hostnames", "Docs": "", "Typewords": ["[]", "string"] }] },
+		"ConfigPreview": { "Name": "ConfigPreview", "Docs": "", "Fields": [{ "Name": "Diff", "Docs": "", "Typewords": ["string"] }, { "Name": "Accounts", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "Addresses", "Docs": "", "Typewords": ["[]", "string"] }] },
+		"AddressEntry": { "Name": "AddressEntry", "Docs": "", "Fields": [{ "Name": "Address", "Docs": "", "Typewords": ["string"] }, { "Name": "Account", "Docs": "", "Typewords": ["string"] }, { "Name": "Disabled", "Docs": "", "Typewords": ["bool"] }] },
+		"LoginToken": { "Name": "LoginToken", "Docs": "", "Fields": [{ "Name": "ID", "Docs": "", "Typewords": ["int64"] }, { "Name": "Created", "Docs": "", "Typewords": ["timestamp"] }, { "Name": "Expires", "Docs": "", "Typewords": ["timestamp"] }, { "Name": "Description", "Docs": "", "Typewords": ["string"] }, { "Name": "LastUsed", "Docs": "", "Typewords": ["timestamp"] }] },
+		"ImportJob": { "Name": "ImportJob", "Docs": "", "Fields": [{ "Name": "ID", "Docs": "", "Typewords": ["int64"] }, { "Name": "Kind", "Docs": "", "Typewords": ["string"] }, { "Name": "Source", "Docs": "", "Typewords": ["string"] }, { "Name": "Mailbox", "Docs": "", "Typewords": ["string"] }, { "Name": "Total", "Docs": "", "Typewords": ["int32"] }, { "Name": "Done", "Docs": "", "Typewords": ["int32"] }, { "Name": "Imported", "Docs": "", "Typewords": ["int32"] }, { "Name": "Skipped", "Docs": "", "Typewords": ["int32"] }, { "Name": "Position", "Docs": "", "Typewords": ["string"] }, { "Name": "Started", "Docs": "", "Typewords": ["timestamp"] }, { "Name": "Updated", "Docs": "", "Typewords": ["timestamp"] }, { "Name": "Finished", "Docs": "", "Typewords": ["timestamp"] }] },
 		"ClientConfigs": { "Name": "ClientConfigs", "Docs": "", "Fields": [{ "Name": "Entries", "Docs": "", "Typewords": ["[]", "ClientConfigsEntry"] }] },
 		"ClientConfigsEntry": { "Name": "ClientConfigsEntry", "Docs": "", "Fields": [{ "Name": "Protocol", "Docs": "", "Typewords": ["string"] }, { "Name": "Host", "Docs": "", "Typewords": ["Domain"] }, { "Name": "Port", "Docs": "", "Typewords": ["int32"] }, { "Name": "Listener", "Docs": "", "Typewords": ["string"] }, { "Name": "Note", "Docs": "", "Typewords": ["string"] }] },
-		"HoldRule": { "Name": "HoldRule", "Docs": "", "Fields": [{ "Name": "ID", "Docs": "", "Typewords": ["int64"] }, { "Name": "Account", "Docs": "", "Typewords": ["string"] }, { "Name": "SenderDomain", "Docs": "", "Typewords": ["Domain"] }, { "Name": "RecipientDomain", "Docs": "", "Typewords": ["Domain"] }, { "Name": "SenderDomainStr", "Docs": "", "Typewords": ["string"] }, { "Name": "RecipientDomainStr", "Docs": "", "Typewords": ["string"] }] },
+		"HoldRule": { "Name": "HoldRule", "Docs": "", "Fields": [{ "Name": "ID", "Docs": "", "Typewords": ["int64"] }, { "Name": "Account", "Docs": "", "Typewords": ["string"] }, { "Name": "SenderDomain", "Docs": "", "Typewords": ["Domain"] }, { "Name": "RecipientDomain", "Docs": "", "Typewords": ["Domain"] }, { "Name": "SenderDomainStr", "Docs": "", "Typewords": ["string"] }, { "Name": "RecipientDomainStr", "Docs": "", "Typewords": ["string"] }, { "Name": "Reason", "Docs": "", "Typewords": ["string"] }] },
 		"Filter": { "Name": "Filter", "Docs": "", "Fields": [{ "Name": "Max", "Docs": "", "Typewords": ["int32"] }, { "Name": "IDs", "Docs": "", "Typewords": ["[]", "int64"] }, { "Name": "Account", "Docs": "", "Typewords": ["string"] }, { "Name": "From", "Docs": "", "Typewords": ["string"] }, { "Name": "To", "Docs": "", "Typewords": ["string"] }, { "Name": "Hold", "Docs": "", "Typewords": ["nullable", "bool"] }, { "Name": "Submitted", "Docs": "", "Typewords": ["string"] }, { "Name": "NextAttempt", "Docs": "", "Typewords": ["string"] }, { "Name": "Transport", "Docs": "", "Typewords": ["nullable", "string"] }] },
 		"Sort": { "Name": "Sort", "Docs": "", "Fields": [{ "Name": "Field", "Docs": "", "Typewords": ["string"] }, { "Name": "LastID", "Docs": "", "Typewords": ["int64"] }, { "Name": "Last", "Docs": "", "Typewords": ["any"] }, { "Name": "Asc", "Docs": "", "Typewords": ["bool"] }] },
-		"Msg": { "Name": "Msg", "Docs": "", "Fields": [{ "Name": "ID", "Docs": "", "Typewords": ["int64"] }, { "Name": "BaseID", "Docs": "", "Typewords": ["int64"] }, { "Name": "Queued", "Docs": "", "Typewords": ["timestamp"] }, { "Name": "Hold", "Docs": "", "Typewords": ["bool"] }, { "Name": "SenderAccount", "Docs": "", "Typewords": ["string"] }, { "Name": "SenderLocalpart", "Docs": "", "Typewords": ["Localpart"] }, { "Name": "SenderDomain", "Docs": "", "Typewords": ["IPDomain"] }, { "Name": "SenderDomainStr", "Docs": "", "Typewords": ["string"] }, { "Name": "FromID", "Docs": "", "Typewords": ["string"] }, { "Name": "RecipientLocalpart", "Docs": "", "Typewords": ["Localpart"] }, { "Name": "RecipientDomain", "Docs": "", "Typewords": ["IPDomain"] }, { "Name": "RecipientDomainStr", "Docs": "", "Typewords": ["string"] }, { "Name": "Attempts", "Docs": "", "Typewords": ["int32"] }, { "Name": "MaxAttempts", "Docs": "", "Typewords": ["int32"] }, { "Name": "DialedIPs", "Docs": "", "Typewords": ["{}", "[]", "IP"] }, { "Name": "NextAttempt", "Docs": "", "Typewords": ["timestamp"] }, { "Name": "LastAttempt", "Docs": "", "Typewords": ["nullable", "timestamp"] }, { "Name": "Results", "Docs": "", "Typewords": ["[]", "MsgResult"] }, { "Name": "Has8bit", "Docs": "", "Typewords": ["bool"] }, { "Name": "SMTPUTF8", "Docs": "", "Typewords": ["bool"] }, { "Name": "IsDMARCReport", "Docs": "", "Typewords": ["bool"] }, { "Name": "IsTLSReport", "Docs": "", "Typewords": ["bool"] }, { "Name": "Size", "Docs": "", "Typewords": ["int64"] }, { "Name": "MessageID", "Docs": "", "Typewords": ["string"] }, { "Name": "MsgPrefix", "Docs": "", "Typewords": ["nullable", "string"] }, { "Name": "Subject", "Docs": "", "Typewords": ["string"] }, { "Name": "DSNUTF8", "Docs": "", "Typewords": ["nullable", "string"] }, { "Name": "Transport", "Docs": "", "Typewords": ["string"] }, { "Name": "RequireTLS", "Docs": "", "Typewords": ["nullable", "bool"] }, { "Name": "FutureReleaseRequest", "Docs": "", "Typewords": ["string"] }, { "Name": "Extra", "Docs": "", "Typewords": ["{}", "string"] }] },
+		"Msg": { "Name": "Msg", "Docs": "", "Fields": [{ "Name": "ID", "Docs": "", "Typewords": ["int64"] }, { "Name": "BaseID", "Docs": "", "Typewords": ["int64"] }, { "Name": "Queued", "Docs": "", "Typewords": ["timestamp"] }, { "Name": "Hold", "Docs": "", "Typewords": ["bool"] }, { "Name": "SenderAccount", "Docs": "", "Typewords": ["string"] }, { "Name": "SenderLocalpart", "Docs": "", "Typewords": ["Localpart"] }, { "Name": "SenderDomain", "Docs": "", "Typewords": ["IPDomain"] }, { "Name": "SenderDomainStr", "Docs": "", "Typewords": ["string"] }, { "Name": "FromID", "Docs": "", "Typewords": ["string"] }, { "Name": "RecipientLocalpart", "Docs": "", "Typewords": ["Localpart"] }, { "Name": "RecipientDomain", "Docs": "", "Typewords": ["IPDomain"] }, { "Name": "RecipientDomainStr", "Docs": "", "Typewords": ["string"] }, { "Name": "Attempts", "Docs": "", "Typewords": ["int32"] }, { "Name": "MaxAttempts", "Docs": "", "Typewords": ["int32"] }, { "Name": "DialedIPs", "Docs": "", "Typewords": ["{}", "[]", "IP"] }, { "Name": "NextAttempt", "Docs": "", "Typewords": ["timestamp"] }, { "Name": "LastAttempt", "Docs": "", "Typewords": ["nullable", "timestamp"] }, { "Name": "Results", "Docs": "", "Typewords": ["[]", "MsgResult"] }, { "Name": "Has8bit", "Docs": "", "Typewords": ["bool"] }, { "Name": "SMTPUTF8", "Docs": "", "Typewords": ["bool"] }, { "Name": "IsDMARCReport", "Docs": "", "Typewords": ["bool"] }, { "Name": "IsTLSReport", "Docs": "", "Typewords": ["bool"] }, { "Name": "Size", "Docs": "", "Typewords": ["int64"] }, { "Name": "MessageID", "Docs": "", "Typewords": ["string"] }, { "Name": "MsgPrefix", "Docs": "", "Typewords": ["nullable", "string"] }, { "Name": "Subject", "Docs": "", "Typewords": ["string"] }, { "Name": "DSNUTF8", "Docs": "", "Typewords": ["nullable", "string"] }, { "Name": "Transport", "Docs": "", "Typewords": ["string"] }, { "Name": "FailoverIndex", "Docs": "", "Typewords": ["int32"] }, { "Name": "RequireTLS", "Docs": "", "Typewords": ["nullable", "bool"] }, { "Name": "FutureReleaseRequest", "Docs": "", "Typewords": ["string"] }, { "Name": "DSNNotify", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "DSNORCPT", "Docs": "", "Typewords": ["string"] }, { "Name": "DSNRet", "Docs": "", "Typewords": ["string"] }, { "Name": "DSNEnvID", "Docs": "", "Typewords": ["string"] }, { "Name": "Relayed", "Docs": "", "Typewords": ["bool"] }, { "Name": "Extra", "Docs": "", "Typewords": ["{}", "string"] }] },
 		"IPDomain": { "Name": "IPDomain", "Docs": "", "Fields": [{ "Name": "IP", "Docs": "", "Typewords": ["IP"] }, { "Name": "Domain", "Docs": "", "Typewords": ["Domain"] }] },
 		"MsgResult": { "Name": "MsgResult", "Docs": "", "Fields": [{ "Name": "Start", "Docs": "", "Typewords": ["timestamp"] }, { "Name": "Duration", "Docs": "", "Typewords": ["int64"] }, { "Name": "Success", "Docs": "", "Typewords": ["bool"] }, { "Name": "Code", "Docs": "", "Typewords": ["int32"] }, { "Name": "Secode", "Docs": "", "Typewords": ["string"] }, { "Name": "Error", "Docs": "", "Typewords": ["string"] }] },
 		"RetiredFilter": { "Name": "RetiredFilter", "Docs": "", "Fields": [{ "Name": "Max", "Docs": "", "Typewords": ["int32"] }, { "Name": "IDs", "Docs": "", "Typewords": ["[]", "int64"] }, { "Name": "Account", "Docs": "", "Typewords": ["string"] }, { "Name": "From", "Docs": "", "Typewords": ["string"] }, { "Name": "To", "Docs": "", "Typewords": ["string"] }, { "Name": "Submitted", "Docs": "", "Typewords": ["string"] }, { "Name": "LastActivity", "Docs": "", "Typewords": ["string"] }, { "Name": "Transport", "Docs": "", "Typewords": ["nullable", "string"] }, { "Name": "Success", "Docs": "", "Typewords": ["nullable", "bool"] }] },
 		"RetiredSort": { "Name": "RetiredSort", "Docs": "", "Fields": [{ "Name": "Field", "Docs": "", "Typewords": ["string"] }, { "Name": "LastID", "Docs": "", "Typewords": ["int64"] }, { "Name": "Last", "Docs": "", "Typewords": ["any"] }, { "Name": "Asc", "Docs": "", "Typewords": ["bool"] }] },
 		"MsgRetired": { "Name": "MsgRetired", "Docs": "", "Fields": [{ "Name": "ID", "Docs": "", "Typewords": ["int64"] }, { "Name": "BaseID", "Docs": "", "Typewords": ["int64"] }, { "Name": "Queued", "Docs": "", "Typewords": ["timestamp"] }, { "Name": "SenderAccount", "Docs": "", "Typewords": ["string"] }, { "Name": "SenderLocalpart", "Docs": "", "Typewords": ["Localpart"] }, { "Name": "SenderDomainStr", "Docs": "", "Typewords": ["string"] }, { "Name": "FromID", "Docs": "", "Typewords": ["string"] }, { "Name": "RecipientLocalpart", "Docs": "", "Typewords": ["Localpart"] }, { "Name": "RecipientDomain", "Docs": "", "Typewords": ["IPDomain"] }, { "Name": "RecipientDomainStr", "Docs": "", "Typewords": ["string"] }, { "Name": "Attempts", "Docs": "", "Typewords": ["int32"] }, { "Name": "MaxAttempts", "Docs": "", "Typewords": ["int32"] }, { "Name": "DialedIPs", "Docs": "", "Typewords": ["{}", "[]", "IP"] }, { "Name": "LastAttempt", "Docs": "", "Typewords": ["nullable", "timestamp"] }, { "Name": "Results", "Docs": "", "Typewords": ["[]", "MsgResult"] }, { "Name": "Has8bit", "Docs": "", "Typewords": ["bool"] }, { "Name": "SMTPUTF8", "Docs": "", "Typewords": ["bool"] }, { "Name": "IsDMARCReport", "Docs": "", "Typewords": ["bool"] }, { "Name": "IsTLSReport", "Docs": "", "Typewords": ["bool"] }, { "Name": "Size", "Docs": "", "Typewords": ["int64"] }, { "Name": "MessageID", "Docs": "", "Typewords": ["string"] }, { "Name": "Subject", "Docs": "", "Typewords": ["string"] }, { "Name": "Transport", "Docs": "", "Typewords": ["string"] }, { "Name": "RequireTLS", "Docs": "", "Typewords": ["nullable", "bool"] }, { "Name": "FutureReleaseRequest", "Docs": "", "Typewords": ["string"] }, { "Name": "Extra", "Docs": "", "Typewords": ["{}", "string"] }, { "Name": "LastActivity", "Docs": "", "Typewords": ["timestamp"] }, { "Name": "RecipientAddress", "Docs": "", "Typewords": ["string"] }, { "Name": "Success", "Docs": "", "Typewords": ["bool"] }, { "Name": "KeepUntil", "Docs": "", "Typewords": ["timestamp"] }] },
+		"EventFilter": { "Name": "EventFilter", "Docs": "", "Fields": [{ "Name": "Max", "Docs": "", "Typewords": ["int32"] }, { "Name": "Start", "Docs": "", "Typewords": ["timestamp"] }, { "Name": "End", "Docs": "", "Typewords": ["timestamp"] }, { "Name": "Kinds", "Docs": "", "Typewords": ["[]", "Kind"] }, { "Name": "MessageID", "Docs": "", "Typewords": ["string"] }, { "Name": "QueueMsgID", "Docs": "", "Typewords": ["int64"] }, { "Name": "Account", "Docs": "", "Typewords": ["string"] }, { "Name": "Address", "Docs": "", "Typewords": ["string"] }] },
+		"Event": { "Name": "Event", "Docs": "", "Fields": [{ "Name": "ID", "Docs": "", "Typewords": ["int64"] }, { "Name": "Time", "Docs": "", "Typewords": ["timestamp"] }, { "Name": "Kind", "Docs": "", "Typewords": ["Kind"] }, { "Name": "MessageID", "Docs": "", "Typewords": ["string"] }, { "Name": "QueueMsgID", "Docs": "", "Typewords": ["int64"] }, { "Name": "Account", "Docs": "", "Typewords": ["string"] }, { "Name": "Mailbox", "Docs": "", "Typewords": ["string"] }, { "Name": "Sender", "Docs": "", "Typewords": ["string"] }, { "Name": "Recipient", "Docs": "", "Typewords": ["string"] }, { "Name": "RemoteIP", "Docs": "", "Typewords": ["string"] }, { "Name": "Success", "Docs": "", "Typewords": ["bool"] }, { "Name": "Code", "Docs": "", "Typewords": ["int32"] }, { "Name": "Secode", "Docs": "", "Typewords": ["string"] }, { "Name": "Detail", "Docs": "", "Typewords": ["string"] }] },
 		"HookFilter": { "Name": "HookFilter", "Docs": "", "Fields": [{ "Name": "Max", "Docs": "", "Typewords": ["int32"] }, { "Name": "IDs", "Docs": "", "Typewords": ["[]", "int64"] }, { "Name": "Account", "Docs": "", "Typewords": ["string"] }, { "Name": "Submitted", "Docs": "", "Typewords": ["string"] }, { "Name": "NextAttempt", "Docs": "", "Typewords": ["string"] }, { "Name": "Event", "Docs": "", "Typewords": ["string"] }] },
 		"HookSort": { "Name": "HookSort", "Docs": "", "Fields": [{ "Name": "Field", "Docs": "", "Typewords": ["string"] }, { "Name": "LastID", "Docs": "", "Typewords": ["int64"] }, { "Name": "Last", "Docs": "", "Typewords": ["any"] }, { "Name": "Asc", "Docs": "", "Typewords": ["bool"] }] },
-		"Hook": { "Name": "Hook", "Docs": "", "Fields": [{ "Name": "ID", "Docs": "", "Typewords": ["int64"] }, { "Name": "QueueMsgID", "Docs": "", "Typewords": ["int64"] }, { "Name": "FromID", "Docs": "", "Typewords": ["string"] }, { "Name": "MessageID", "Docs": "", "Typewords": ["string"] }, { "Name": "Subject", "Docs": "", "Typewords": ["string"] }, { "Name": "Extra", "Docs": "", "Typewords": ["{}", "string"] }, { "Name": "Account", "Docs": "", "Typewords": ["string"] }, { "Name": "URL", "Docs": "", "Typewords": ["string"] }, { "Name": "Authorization", "Docs": "", "Typewords": ["string"] }, { "Name": "IsIncoming", "Docs": "", "Typewords": ["bool"] }, { "Name": "OutgoingEvent", "Docs": "", "Typewords": ["string"] }, { "Name": "Payload", "Docs": "", "Typewords": ["string"] }, { "Name": "Submitted", "Docs": "", "Typewords": ["timestamp"] }, { "Name": "Attempts", "Docs": "", "Typewords": ["int32"] }, { "Name": "NextAttempt", "Docs": "", "Typewords": ["timestamp"] }, { "Name": "Results", "Docs": "", "Typewords": ["[]", "HookResult"] }] },
+		"Hook": { "Name": "Hook", "Docs": "", "Fields": [{ "Name": "ID", "Docs": "", "Typewords": ["int64"] }, { "Name": "QueueMsgID", "Docs": "", "Typewords": ["int64"] }, { "Name": "FromID", "Docs": "", "Typewords": ["string"] }, { "Name": "MessageID", "Docs": "", "Typewords": ["string"] }, { "Name": "Subject", "Docs": "", "Typewords": ["string"] }, { "Name": "Extra", "Docs": "", "Typewords": ["{}", "string"] }, { "Name": "Account", "Docs": "", "Typewords": ["string"] }, { "Name": "URL", "Docs": "", "Typewords": ["string"] }, { "Name": "Authorization", "Docs": "", "Typewords": ["string"] }, { "Name": "Signature", "Docs": "", "Typewords": ["string"] }, { "Name": "IsIncoming", "Docs": "", "Typewords": ["bool"] }, { "Name": "OutgoingEvent", "Docs": "", "Typewords": ["string"] }, { "Name": "AdminEvent", "Docs": "", "Typewords": ["string"] }, { "Name": "Payload", "Docs": "", "Typewords": ["string"] }, { "Name": "Submitted", "Docs": "", "Typewords": ["timestamp"] }, { "Name": "Attempts", "Docs": "", "Typewords": ["int32"] }, { "Name": "NextAttempt", "Docs": "", "Typewords": ["timestamp"] }, { "Name": "Results", "Docs": "", "Typewords": ["[]", "HookResult"] }] },
 		"HookResult": { "Name": "HookResult", "Docs": "", "Fields": [{ "Name": "Start", "Docs": "", "Typewords": ["timestamp"] }, { "Name": "Duration", "Docs": "", "Typewords": ["int64"] }, { "Name": "URL", "Docs": "", "Typewords": ["string"] }, { "Name": "Success", "Docs": "", "Typewords": ["bool"] }, { "Name": "Code", "Docs": "", "Typewords": ["int32"] }, { "Name": "Error", "Docs": "", "Typewords": ["string"] }, { "Name": "Response", "Docs": "", "Typewords": ["string"] }] },
 		"HookRetiredFilter": { "Name": "HookRetiredFilter", "Docs": "", "Fields": [{ "Name": "Max", "Docs": "", "Typewords": ["int32"] }, { "Name": "IDs", "Docs": "", "Typewords": ["[]", "int64"] }, { "Name": "Account", "Docs": "", "Typewords": ["string"] }, { "Name": "Submitted", "Docs": "", "Typewords": ["string"] }, { "Name": "LastActivity", "Docs": "", "Typewords": ["string"] }, { "Name": "Event", "Docs": "", "Typewords": ["string"] }] },
 		"HookRetiredSort": { "Name": "HookRetiredSort", "Docs": "", "Fields": [{ "Name": "Field", "Docs": "", "Typewords": ["string"] }, { "Name": "LastID", "Docs": "", "Typewords": ["int64"] }, { "Name": "Last", "Docs": "", "Typewords": ["any"] }, { "Name": "Asc", "Docs": "", "Typewords": ["bool"] }] },
-		"HookRetired": { "Name": "HookRetired", "Docs": "", "Fields": [{ "Name": "ID", "Docs": "", "Typewords": ["int64"] }, { "Name": "QueueMsgID", "Docs": "", "Typewords": ["int64"] }, { "Name": "FromID", "Docs": "", "Typewords": ["string"] }, { "Name": "MessageID", "Docs": "", "Typewords": ["string"] }, { "Name": "Subject", "Docs": "", "Typewords": ["string"] }, { "Name": "Extra", "Docs": "", "Typewords": ["{}", "string"] }, { "Name": "Account", "Docs": "", "Typewords": ["string"] }, { "Name": "URL", "Docs": "", "Typewords": ["string"] }, { "Name": "Authorization", "Docs": "", "Typewords": ["bool"] }, { "Name": "IsIncoming", "Docs": "", "Typewords": ["bool"] }, { "Name": "OutgoingEvent", "Docs": "", "Typewords": ["string"] }, { "Name": "Payload", "Docs": "", "Typewords": ["string"] }, { "Name": "Submitted", "Docs": "", "Typewords": ["timestamp"] }, { "Name": "SupersededByID", "Docs": "", "Typewords": ["int64"] }, { "Name": "Attempts", "Docs": "", "Typewords": ["int32"] }, { "Name": "Results", "Docs": "", "Typewords": ["[]", "HookResult"] }, { "Name": "Success", "Docs": "", "Typewords": ["bool"] }, { "Name": "LastActivity", "Docs": "", "Typewords": ["timestamp"] }, { "Name": "KeepUntil", "Docs": "", "Typewords": ["timestamp"] }] },
+		"HookRetired": { "Name": "HookRetired", "Docs": "", "Fields": [{ "Name": "ID", "Docs": "", "Typewords": ["int64"] }, { "Name": "QueueMsgID", "Docs": "", "Typewords": ["int64"] }, { "Name": "FromID", "Docs": "", "Typewords": ["string"] }, { "Name": "MessageID", "Docs": "", "Typewords": ["string"] }, { "Name": "Subject", "Docs": "", "Typewords": ["string"] }, { "Name": "Extra", "Docs": "", "Typewords": ["{}", "string"] }, { "Name": "Account", "Docs": "", "Typewords": ["string"] }, { "Name": "URL", "Docs": "", "Typewords": ["string"] }, { "Name": "Authorization", "Docs": "", "Typewords": ["bool"] }, { "Name": "IsIncoming", "Docs": "", "Typewords": ["bool"] }, { "Name": "OutgoingEvent", "Docs": "", "Typewords": ["string"] }, { "Name": "AdminEvent", "Docs": "", "Typewords": ["string"] }, { "Name": "Payload", "Docs": "", "Typewords": ["string"] }, { "Name": "Submitted", "Docs": "", "Typewords": ["timestamp"] }, { "Name": "SupersededByID", "Docs": "", "Typewords": ["int64"] }, { "Name": "Attempts", "Docs": "", "Typewords": ["int32"] }, { "Name": "Results", "Docs": "", "Typewords": ["[]", "HookResult"] }, { "Name": "Success", "Docs": "", "Typewords": ["bool"] }, { "Name": "LastActivity", "Docs": "", "Typewords": ["timestamp"] }, { "Name": "KeepUntil", "Docs": "", "Typewords": ["timestamp"] }] },
 		"WebserverConfig": { "Name": "WebserverConfig", "Docs": "", "Fields": [{ "Name": "WebDNSDomainRedirects", "Docs": "", "Typewords": ["[]", "[]", "Domain"] }, { "Name": "WebDomainRedirects", "Docs": "", "Typewords": ["[]", "[]", "string"] }, { "Name": "WebHandlers", "Docs": "", "Typewords": ["[]", "WebHandler"] }] },
 		"WebHandler": { "Name": "WebHandler", "Docs": "", "Fields": [{ "Name": "LogName", "Docs": "", "Typewords": ["string"] }, { "Name": "Domain", "Docs": "", "Typewords": ["string"] }, { "Name": "PathRegexp", "Docs": "", "Typewords": ["string"] }, { "Name": "DontRedirectPlainHTTP", "Docs": "", "Typewords": ["bool"] }, { "Name": "Compress", "Docs": "", "Typewords": ["bool"] }, { "Name": "WebStatic", "Docs": "", "Typewords": ["nullable", "WebStatic"] }, { "Name": "WebRedirect", "Docs": "", "Typewords": ["nullable", "WebRedirect"] }, { "Name": "WebForward", "Docs": "", "Typewords": ["nullable", "WebForward"] }, { "Name": "WebInternal", "Docs": "", "Typewords": ["nullable", "WebInternal"] }, { "Name": "Name", "Docs": "", "Typewords": ["string"] }, { "Name": "DNSDomain", "Docs": "", "Typewords": ["Domain"] }] },
 		"WebStatic": { "Name": "WebStatic", "Docs": "", "Fields": [{ "Name": "StripPrefix", "Docs": "", "Typewords": ["string"] }, { "Name": "Root", "Docs": "", "Typewords": ["string"] }, { "Name": "ListFiles", "Docs": "", "Typewords": ["bool"] }, { "Name": "ContinueNotFound", "Docs": "", "Typewords": ["bool"] }, { "Name": "ResponseHeaders", "Docs": "", "Typewords": ["{}", "string"] }] },
@@ -375,9 +413,19 @@ var api;
 		"SuppressAddress": { "Name": "SuppressAddress", "Docs": "", "Fields": [{ "Name": "ID", "Docs": "", "Typewords": ["int64"] }, { "Name": "Inserted", "Docs": "", "Typewords": ["timestamp"] }, { "Name": "ReportingAddress", "Docs": "", "Typewords": ["string"] }, { "Name": "Until", "Docs": "", "Typewords": ["timestamp"] }, { "Name": "Comment", "Docs": "", "Typewords": ["string"] }] },
 		"TLSResult": { "Name": "TLSResult", "Docs": "", "Fields": [{ "Name": "ID", "Docs": "", "Typewords": ["int64"] }, { "Name": "PolicyDomain", "Docs": "", "Typewords": ["string"] }, { "Name": "DayUTC", "Docs": "", "Typewords": ["string"] }, { "Name": "RecipientDomain", "Docs": "", "Typewords": ["string"] }, { "Name": "Created", "Docs": "", "Typewords": ["timestamp"] }, { "Name": "Updated", "Docs": "", "Typewords": ["timestamp"] }, { "Name": "IsHost", "Docs": "", "Typewords": ["bool"] }, { "Name": "SendReport", "Docs": "", "Typewords": ["bool"] }, { "Name": "SentToRecipientDomain", "Docs": "", "Typewords": ["bool"] }, { "Name": "RecipientDomainReportingAddresses", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "SentToPolicyDomain", "Docs": "", "Typewords": ["bool"] }, { "Name": "Results", "Docs": "", "Typewords": ["[]", "Result"] }] },
 		"TLSRPTSuppressAddress": { "Name": "TLSRPTSuppressAddress", "Docs": "", "Fields": [{ "Name": "ID", "Docs": "", "Typewords": ["int64"] }, { "Name": "Inserted", "Docs": "", "Typewords": ["timestamp"] }, { "Name": "ReportingAddress", "Docs": "", "Typewords": ["string"] }, { "Name": "Until", "Docs": "", "Typewords": ["timestamp"] }, { "Name": "Comment", "Docs": "", "Typewords": ["string"] }] },
-		"Dynamic": { "Name": "Dynamic", "Docs": "", "Fields": [{ "Name": "Domains", "Docs": "", "Typewords": ["{}", "ConfigDomain"] }, { "Name": "Accounts", "Docs": "", "Typewords": ["{}", "Account"] }, { "Name": "WebDomainRedirects", "Docs": "", "Typewords": ["{}", "string"] }, { "Name": "WebHandlers", "Docs": "", "Typewords": ["[]", "WebHandler"] }, { "Name": "Routes", "Docs": "", "Typewords": ["[]", "Route"] }, { "Name": "MonitorDNSBLs", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "MonitorDNSBLZones", "Docs": "", "Typewords": ["[]", "Domain"] }] },
+		"Dynamic": { "Name": "Dynamic", "Docs": "", "Fields": [{ "Name": "Domains", "Docs": "", "Typewords": ["{}", "ConfigDomain"] }, { "Name": "Accounts", "Docs": "", "Typewords": ["{}", "Account"] }, { "Name": "WebDomainRedirects", "Docs": "", "Typewords": ["{}", "string"] }, { "Name": "WebHandlers", "Docs": "", "Typewords": ["[]", "WebHandler"] }, { "Name": "Routes", "Docs": "", "Typewords": ["[]", "Route"] }, { "Name": "MonitorDNSBLs", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "DomainAdmins", "Docs": "", "Typewords": ["{}", "DomainAdmin"] }, { "Name": "AdminTokens", "Docs": "", "Typewords": ["{}", "AdminToken"] }, { "Name": "AdminWebhook", "Docs": "", "Typewords": ["nullable", "AdminWebhook"] }, { "Name": "IMAPClientRules", "Docs": "", "Typewords": ["[]", "IMAPClientRule"] }, { "Name": "MonitorDNSBLZones", "Docs": "", "Typewords": ["[]", "Domain"] }] },
+		"DomainAdmin": { "Name": "DomainAdmin", "Docs": "", "Fields": [{ "Name": "Domains", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "PasswordHash", "Docs": "", "Typewords": ["string"] }] },
+		"AdminToken": { "Name": "AdminToken", "Docs": "", "Fields": [{ "Name": "TokenHash", "Docs": "", "Typewords": ["string"] }, { "Name": "Functions", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "DomainAdmin", "Docs": "", "Typewords": ["string"] }] },
+		"AdminWebhook": { "Name": "AdminWebhook", "Docs": "", "Fields": [{ "Name": "URL", "Docs": "", "Typewords": ["string"] }, { "Name": "Authorization", "Docs": "", "Typewords": ["string"] }, { "Name": "Secret", "Docs": "", "Typewords": ["string"] }, { "Name": "Events", "Docs": "", "Typewords": ["[]", "string"] }] },
+		"IMAPClientRule": { "Name": "IMAPClientRule", "Docs": "", "Fields": [{ "Name": "ParamsRegexp", "Docs": "", "Typewords": ["{}", "string"] }, { "Name": "Accounts", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "Action", "Docs": "", "Typewords": ["string"] }, { "Name": "Message", "Docs": "", "Typewords": ["string"] }] },
 		"TLSPublicKey": { "Name": "TLSPublicKey", "Docs": "", "Fields": [{ "Name": "Fingerprint", "Docs": "", "Typewords": ["string"] }, { "Name": "Created", "Docs": "", "Typewords": ["timestamp"] }, { "Name": "Type", "Docs": "", "Typewords": ["string"] }, { "Name": "Name", "Docs": "", "Typewords": ["string"] }, { "Name": "NoIMAPPreauth", "Docs": "", "Typewords": ["bool"] }, { "Name": "CertDER", "Docs": "", "Typewords": ["nullable", "string"] }, { "Name": "Account", "Docs": "", "Typewords": ["string"] }, { "Name": "LoginAddress", "Docs": "", "Typewords": ["string"] }] },
 		"LoginAttempt": { "Name": "LoginAttempt", "Docs": "", "Fields": [{ "Name": "Key", "Docs": "", "Typewords": ["nullable", "string"] }, { "Name": "Last", "Docs": "", "Typewords": ["timestamp"] }, { "Name": "First", "Docs": "", "Typewords": ["timestamp"] }, { "Name": "Count", "Docs": "", "Typewords": ["int64"] }, { "Name": "AccountName", "Docs": "", "Typewords": ["string"] }, { "Name": "LoginAddress", "Docs": "", "Typewords": ["string"] }, { "Name": "RemoteIP", "Docs": "", "Typewords": ["string"] }, { "Name": "LocalIP", "Docs": "", "Typewords": ["string"] }, { "Name": "TLS", "Docs": "", "Typewords": ["string"] }, { "Name": "TLSPubKeyFingerprint", "Docs": "", "Typewords": ["string"] }, { "Name": "Protocol", "Docs": "", "Typewords": ["string"] }, { "Name": "UserAgent", "Docs": "", "Typewords": ["string"] }, { "Name": "AuthMech", "Docs": "", "Typewords": ["string"] }, { "Name": "Result", "Docs": "", "Typewords": ["AuthResult"] }] },
+		"AuthLockout": { "Name": "AuthLockout", "Docs": "", "Fields": [{ "Name": "Key", "Docs": "", "Typewords": ["string"] }, { "Name": "First", "Docs": "", "Typewords": ["timestamp"] }, { "Name": "Last", "Docs": "", "Typewords": ["timestamp"] }, { "Name": "Failures", "Docs": "", "Typewords": ["int32"] }, { "Name": "Until", "Docs": "", "Typewords": ["timestamp"] }] },
+		"JunkDecision": { "Name": "JunkDecision", "Docs": "", "Fields": [{ "Name": "ID", "Docs": "", "Typewords": ["int64"] }, { "Name": "Time", "Docs": "", "Typewords": ["timestamp"] }, { "Name": "MessageID", "Docs": "", "Typewords": ["string"] }, { "Name": "MailFrom", "Docs": "", "Typewords": ["string"] }, { "Name": "MsgFrom", "Docs": "", "Typewords": ["string"] }, { "Name": "Recipient", "Docs": "", "Typewords": ["string"] }, { "Name": "RemoteIP", "Docs": "", "Typewords": ["string"] }, { "Name": "Subject", "Docs": "", "Typewords": ["string"] }, { "Name": "Accept", "Docs": "", "Typewords": ["bool"] }, { "Name": "Mailbox", "Docs": "", "Typewords": ["string"] }, { "Name": "Reason", "Docs": "", "Typewords": ["string"] }, { "Name": "ReasonText", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "ReputationMethod", "Docs": "", "Typewords": ["string"] }, { "Name": "ReputationJunk", "Docs": "", "Typewords": ["nullable", "bool"] }, { "Name": "ReputationConclusive", "Docs": "", "Typewords": ["bool"] }, { "Name": "ContentAnalyzed", "Docs": "", "Typewords": ["bool"] }, { "Name": "Probability", "Docs": "", "Typewords": ["float64"] }, { "Name": "Significant", "Docs": "", "Typewords": ["bool"] }, { "Name": "Threshold", "Docs": "", "Typewords": ["float64"] }, { "Name": "HamWords", "Docs": "", "Typewords": ["[]", "WordScore"] }, { "Name": "SpamWords", "Docs": "", "Typewords": ["[]", "WordScore"] }, { "Name": "DNSBLZone", "Docs": "", "Typewords": ["string"] }] },
+		"WordScore": { "Name": "WordScore", "Docs": "", "Fields": [{ "Name": "Word", "Docs": "", "Typewords": ["string"] }, { "Name": "Score", "Docs": "", "Typewords": ["float64"] }] },
+		"IMAPClient": { "Name": "IMAPClient", "Docs": "", "Fields": [{ "Name": "Key", "Docs": "", "Typewords": ["nullable", "string"] }, { "Name": "AccountName", "Docs": "", "Typewords": ["string"] }, { "Name": "Name", "Docs": "", "Typewords": ["string"] }, { "Name": "Version", "Docs": "", "Typewords": ["string"] }, { "Name": "Vendor", "Docs": "", "Typewords": ["string"] }, { "Name": "OS", "Docs": "", "Typewords": ["string"] }, { "Name": "OSVersion", "Docs": "", "Typewords": ["string"] }, { "Name": "Params", "Docs": "", "Typewords": ["{}", "string"] }, { "Name": "First", "Docs": "", "Typewords": ["timestamp"] }, { "Name": "Last", "Docs": "", "Typewords": ["timestamp"] }, { "Name": "Count", "Docs": "", "Typewords": ["int64"] }, { "Name": "Denied", "Docs": "", "Typewords": ["int64"] }] },
+		"Connection": { "Name": "Connection", "Docs": "", "Fields": [{ "Name": "CID", "Docs": "", "Typewords": ["int64"] }, { "Name": "Listener", "Docs": "", "Typewords": ["string"] }, { "Name": "RemoteIP", "Docs": "", "Typewords": ["string"] }, { "Name": "TLS", "Docs": "", "Typewords": ["bool"] }, { "Name": "Start", "Docs": "", "Typewords": ["timestamp"] }, { "Name": "LastActive", "Docs": "", "Typewords": ["timestamp"] }, { "Name": "State", "Docs": "", "Typewords": ["string"] }, { "Name": "Username", "Docs": "", "Typewords": ["string"] }, { "Name": "Account", "Docs": "", "Typewords": ["string"] }, { "Name": "Command", "Docs": "", "Typewords": ["string"] }] },
+		"LoginSession": { "Name": "LoginSession", "Docs": "", "Fields": [{ "Name": "ID", "Docs": "", "Typewords": ["int64"] }, { "Name": "Created", "Docs": "", "Typewords": ["timestamp"] }, { "Name": "Expires", "Docs": "", "Typewords": ["timestamp"] }, { "Name": "AccountName", "Docs": "", "Typewords": ["string"] }, { "Name": "LoginAddress", "Docs": "", "Typewords": ["string"] }] },
 		"CSRFToken": { "Name": "CSRFToken", "Docs": "", "Values": null },
 		"DMARCPolicy": { "Name": "DMARCPolicy", "Docs": "", "Values": [{ "Name": "PolicyEmpty", "Value": "", "Docs": "" }, { "Name": "PolicyNone", "Value": "none", "Docs": "" }, { "Name": "PolicyQuarantine", "Value": "quarantine", "Docs": "" }, { "Name": "PolicyReject", "Value": "reject", "Docs": "" }] },
 		"Align": { "Name": "Align", "Docs": "", "Values": [{ "Name": "AlignStrict", "Value": "s", "Docs": "" }, { "Name": "AlignRelaxed", "Value": "r", "Docs": "" }] },
@@ -385,7 +433,8 @@ var api;
 		"Mode": { "Name": "Mode", "Docs": "", "Values": [{ "Name": "ModeEnforce", "Value": "enforce", "Docs": "" }, { "Name": "ModeTesting", "Value": "testing", "Docs": "" }, { "Name": "ModeNone", "Value": "none", "Docs": "" }] },
 		"Localpart": { "Name": "Localpart", "Docs": "", "Values": null },
 		"IP": { "Name": "IP", "Docs": "", "Values": [] },
-		"AuthResult": { "Name": "AuthResult", "Docs": "", "Values": [{ "Name": "AuthSuccess", "Value": "ok", "Docs": "" }, { "Name": "AuthBadUser", "Value": "baduser", "Docs": "" }, { "Name": "AuthBadPassword", "Value": "badpassword", "Docs": "" }, { "Name": "AuthBadCredentials", "Value": "badcreds", "Docs": "" }, { "Name": "AuthBadChannelBinding", "Value": "badchanbind", "Docs": "" }, { "Name": "AuthBadProtocol", "Value": "badprotocol", "Docs": "" }, { "Name": "AuthLoginDisabled", "Value": "logindisabled", "Docs": "" }, { "Name": "AuthError", "Value": "error", "Docs": "" }, { "Name": "AuthAborted", "Value": "aborted", "Docs": "" }] },
+		"Kind": { "Name": "Kind", "Docs": "", "Values": [{ "Name": "KindReceived", "Value": "received", "Docs": "" }, { "Name": "KindJunkVerdict", "Value": "junkverdict", "Docs": "" }, { "Name": "KindDelivered", "Value": "delivered", "Docs": "" }, { "Name": "KindQueued", "Value": "queued", "Docs": "" }, { "Name": "KindAttempt", "Value": "attempt", "Docs": "" }, { "Name": "KindSent", "Value": "sent", "Docs": "" }, { "Name": "KindBounced", "Value": "bounced", "Docs": "" }] },
+		"AuthResult": { "Name": "AuthResult", "Docs": "", "Values": [{ "Name": "AuthSuccess", "Value": "ok", "Docs": "" }, { "Name": "AuthBadUser", "Value": "baduser", "Docs": "" }, { "Name": "AuthBadPassword", "Value": "badpassword", "Docs": "" }, { "Name": "AuthBadCredentials", "Value": "badcreds", "Docs": "" }, { "Name": "AuthBadChannelBinding", "Value": "badchanbind", "Docs": "" }, { "Name": "AuthBadProtocol", "Value": "badprotocol", "Docs": "" }, { "Name": "AuthLoginDisabled", "Value": "logindisabled", "Docs": "" }, { "Name": "AuthNetworkDenied", "Value": "networkdenied", "Docs": "" }, { "Name": "AuthClientDenied", "Value": "clientdenied", "Docs": "" }, { "Name": "AuthError", "Value": "error", "Docs": "" }, { "Name": "AuthAborted", "Value": "aborted", "Docs": "" }, { "Name": "AuthLockedOut", "Value": "lockedout", "Docs": "" }, { "Name": "AuthTooManyConns", "Value": "toomanyconns", "Docs": "" }] },
 	};
 	api.parser = {
 		CheckResult: (v) => api.parse("CheckResult", v),
@@ -425,19 +474,32 @@ var api;
 		Canonicalization: (v) => api.parse("Canonicalization", v),
 		DMARC: (v) => api.parse("DMARC", v),
 		MTASTS: (v) => api.parse("MTASTS", v),
+		WKD: (v) => api.parse("WKD", v),
+		WellKnown: (v) => api.parse("WellKnown", v),
+		SecurityTXT: (v) => api.parse("SecurityTXT", v),
 		TLSRPT: (v) => api.parse("TLSRPT", v),
+		SPF: (v) => api.parse("SPF", v),
 		Route: (v) => api.parse("Route", v),
 		Alias: (v) => api.parse("Alias", v),
 		AliasAddress: (v) => api.parse("AliasAddress", v),
 		Address: (v) => api.parse("Address", v),
 		Destination: (v) => api.parse("Destination", v),
 		Ruleset: (v) => api.parse("Ruleset", v),
+		DuplicateWindow: (v) => api.parse("DuplicateWindow", v),
+		Forward: (v) => api.parse("Forward", v),
+		InboundHeaders: (v) => api.parse("InboundHeaders", v),
 		Account: (v) => api.parse("Account", v),
 		OutgoingWebhook: (v) => api.parse("OutgoingWebhook", v),
 		IncomingWebhook: (v) => api.parse("IncomingWebhook", v),
 		SubjectPass: (v) => api.parse("SubjectPass", v),
 		AutomaticJunkFlags: (v) => api.parse("AutomaticJunkFlags", v),
 		JunkFilter: (v) => api.parse("JunkFilter", v),
+		AutoArchive: (v) => api.parse("AutoArchive", v),
+		ArchiveTier: (v) => api.parse("ArchiveTier", v),
+		MessageCompression: (v) => api.parse("MessageCompression", v),
+		MessageEncryption: (v) => api.parse("MessageEncryption", v),
+		SubmissionChecks: (v) => api.parse("SubmissionChecks", v),
+		TLSClientAuth: (v) => api.parse("TLSClientAuth", v),
 		AddressAlias: (v) => api.parse("AddressAlias", v),
 		PolicyRecord: (v) => api.parse("PolicyRecord", v),
 		TLSReportRecord: (v) => api.parse("TLSReportRecord", v),
@@ -461,7 +523,14 @@ var api;
 		DKIMAuthResult: (v) => api.parse("DKIMAuthResult", v),
 		SPFAuthResult: (v) => api.parse("SPFAuthResult", v),
 		DMARCSummary: (v) => api.parse("DMARCSummary", v),
+		Advice: (v) => api.parse("Advice", v),
+		AdviceSource: (v) => api.parse("AdviceSource", v),
+		SpoofIncident: (v) => api.parse("SpoofIncident", v),
 		Reverse: (v) => api.parse("Reverse", v),
+		ConfigPreview: (v) => api.parse("ConfigPreview", v),
+		AddressEntry: (v) => api.parse("AddressEntry", v),
+		LoginToken: (v) => api.parse("LoginToken", v),
+		ImportJob: (v) => api.parse("ImportJob", v),
 		ClientConfigs: (v) => api.parse("ClientConfigs", v),
 		ClientConfigsEntry: (v) => api.parse("ClientConfigsEntry", v),
 		HoldRule: (v) => api.parse("HoldRule", v),
@@ -473,6 +542,8 @@ var api;
 		RetiredFilter: (v) => api.parse("RetiredFilter", v),
 		RetiredSort: (v) => api.parse("RetiredSort", v),
 		MsgRetired: (v) => api.parse("MsgRetired", v),
+		EventFilter: (v) => api.parse("EventFilter", v),
+		Event: (v) => api.parse("Event", v),
 		HookFilter: (v) => api.parse("HookFilter", v),
 		HookSort: (v) => api.parse("HookSort", v),
 		Hook: (v) => api.parse("Hook", v),
@@ -497,8 +568,18 @@ var api;
 		TLSResult: (v) => api.parse("TLSResult", v),
 		TLSRPTSuppressAddress: (v) => api.parse("TLSRPTSuppressAddress", v),
 		Dynamic: (v) => api.parse("Dynamic", v),
+		DomainAdmin: (v) => api.parse("DomainAdmin", v),
+		AdminToken: (v) => api.parse("AdminToken", v),
+		AdminWebhook: (v) => api.parse("AdminWebhook", v),
+		IMAPClientRule: (v) => api.parse("IMAPClientRule", v),
 		TLSPublicKey: (v) => api.parse("TLSPublicKey", v),
 		LoginAttempt: (v) => api.parse("LoginAttempt", v),
+		AuthLockout: (v) => api.parse("AuthLockout", v),
+		JunkDecision: (v) => api.parse("JunkDecision", v),
+		WordScore: (v) => api.parse("WordScore", v),
+		IMAPClient: (v) => api.parse("IMAPClient", v),
+		Connection: (v) => api.parse("Connection", v),
+		LoginSession: (v) => api.parse("LoginSession", v),
 		CSRFToken: (v) => api.parse("CSRFToken", v),
 		DMARCPolicy: (v) => api.parse("DMARCPolicy", v),
 		Align: (v) => api.parse("Align", v),
@@ -506,6 +587,7 @@ var api;
 		Mode: (v) => api.parse("Mode", v),
 		Localpart: (v) => api.parse("Localpart", v),
 		IP: (v) => api.parse("IP", v),
+		Kind: (v) => api.parse("Kind", v),
 		AuthResult: (v) => api.parse("AuthResult", v),
 	};
 	// Admin exports web API functions for the admin web interface. All its methods are
@@ -543,12 +625,13 @@ var api;
 			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
 		}
 		// Login returns a session token for the credentials, or fails with error code
-		// "user:badLogin". Call LoginPrep to get a loginToken.
-		async Login(loginToken, password) {
+		// "user:badLogin". Call LoginPrep to get a loginToken. Username is empty for the
+		// global admin, or the name of a domain admin.
+		async Login(loginToken, username, password) {
 			const fn = "Login";
-			const paramTypes = [["string"], ["string"]];
+			const paramTypes = [["string"], ["string"], ["string"]];
 			const returnTypes = [["CSRFToken"]];
-			const params = [loginToken, password];
+			const params = [loginToken, username, password];
 			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
 		}
 		// Logout invalidates the session token.
@@ -568,6 +651,15 @@ var api;
 			const params = [domainName];
 			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
 		}
+		// DomainAdminScope returns the name and domains of the logged in domain admin. The
+		// name is empty for the global admin, which can manage all domains.
+		async DomainAdminScope() {
+			const fn = "DomainAdminScope";
+			const paramTypes = [];
+			const returnTypes = [["string"], ["[]", "Domain"]];
+			const params = [];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
 		// Domains returns all configured domain names.
 		async Domains() {
 			const fn = "Domains";
@@ -696,6 +788,25 @@ var api;
 			const params = [start, end, domain];
 			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
 		}
+		// DMARCAdvice returns a recommendation for the DMARC policy of a domain, based on
+		// received DMARC aggregate reports of the past 30 days.
+		async DMARCAdvice(domain) {
+			const fn = "DMARCAdvice";
+			const paramTypes = [["string"]];
+			const returnTypes = [["Advice"]];
+			const params = [domain];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
+		// DMARCSpoofIncidents returns incidents with a surge of incoming messages failing
+		// DMARC for a domain (or all domains if empty), overlapping with period
+		// start/end. The most recent incident is first.
+		async DMARCSpoofIncidents(start, end, domain) {
+			const fn = "DMARCSpoofIncidents";
+			const paramTypes = [["timestamp"], ["timestamp"], ["string"]];
+			const returnTypes = [["[]", "SpoofIncident"]];
+			const params = [start, end, domain];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
 		// LookupIP does a reverse lookup of ip.
 		async LookupIP(ip) {
 			const fn = "LookupIP";
@@ -734,6 +845,16 @@ var api;
 			const params = [domain];
 			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
 		}
+		// DomainRecordsExport returns the DNS records that should exist for the
+		// configured domain in a format for a DNS provider: "zone", "cloudflare",
+		// "route53" or "terraform".
+		async DomainRecordsExport(domain, format) {
+			const fn = "DomainRecordsExport";
+			const paramTypes = [["string"], ["string"]];
+			const returnTypes = [["string"]];
+			const params = [domain, format];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
 		// DomainAdd adds a new domain and reloads the configuration.
 		async DomainAdd(disabled, domain, accountName, localpart) {
 			const fn = "DomainAdd";
@@ -751,12 +872,22 @@ var api;
 			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
 		}
 		// AccountAdd adds existing a new account, with an initial email address, and
-		// reloads the configuration.
-		async AccountAdd(accountName, address) {
+		// reloads the configuration. If template is not empty, the settings of the
+		// account template are used for the new account.
+		async AccountAdd(accountName, address, template) {
 			const fn = "AccountAdd";
-			const paramTypes = [["string"], ["string"]];
+			const paramTypes = [["string"], ["string"], ["string"]];
 			const returnTypes = [];
-			const params = [accountName, address];
+			const params = [accountName, address, template];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
+		// AccountTemplates returns the names of the account templates that can be used
+		// when adding an account.
+		async AccountTemplates() {
+			const fn = "AccountTemplates";
+			const paramTypes = [];
+			const returnTypes = [["[]", "string"]];
+			const params = [];
 			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
 		}
 		// AccountRemove removes an existing account and reloads the configuration.
@@ -783,9 +914,73 @@ var api;
 			const params = [address];
 			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
 		}
+		// DomainAddPreview validates adding a domain like DomainAdd, returning the
+		// changes to the configuration without making them.
+		async DomainAddPreview(disabled, domain, accountName, localpart) {
+			const fn = "DomainAddPreview";
+			const paramTypes = [["bool"], ["string"], ["string"], ["string"]];
+			const returnTypes = [["ConfigPreview"]];
+			const params = [disabled, domain, accountName, localpart];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
+		// AddressRemovePreview validates removing an address like AddressRemove,
+		// returning the changes to the configuration without making them.
+		async AddressRemovePreview(address) {
+			const fn = "AddressRemovePreview";
+			const paramTypes = [["string"]];
+			const returnTypes = [["ConfigPreview"]];
+			const params = [address];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
+		// DestinationRulesetsSave replaces the rulesets of a destination (address) of an
+		// account.
+		async DestinationRulesetsSave(accountName, destName, rulesets) {
+			const fn = "DestinationRulesetsSave";
+			const paramTypes = [["string"], ["string"], ["[]", "Ruleset"]];
+			const returnTypes = [];
+			const params = [accountName, destName, rulesets];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
+		// DestinationRulesetsSavePreview validates new rulesets for a destination like
+		// DestinationRulesetsSave, returning the changes to the configuration without
+		// making them.
+		async DestinationRulesetsSavePreview(accountName, destName, rulesets) {
+			const fn = "DestinationRulesetsSavePreview";
+			const paramTypes = [["string"], ["string"], ["[]", "Ruleset"]];
+			const returnTypes = [["ConfigPreview"]];
+			const params = [accountName, destName, rulesets];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
+		// AddressSearch returns a page of configured addresses matching query, with the
+		// total number of matches. See admin.AddressSearch.
+		async AddressSearch(query, offset, limit) {
+			const fn = "AddressSearch";
+			const paramTypes = [["string"], ["int32"], ["int32"]];
+			const returnTypes = [["[]", "AddressEntry"], ["int32"]];
+			const params = [query, offset, limit];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
+		// AddressesMove moves addresses to another account, keeping their destination
+		// configuration. Messages are not moved.
+		async AddressesMove(addresses, accountName) {
+			const fn = "AddressesMove";
+			const paramTypes = [["[]", "string"], ["string"]];
+			const returnTypes = [];
+			const params = [addresses, accountName];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
+		// AddressesDisabledSave disables or enables addresses.
+		async AddressesDisabledSave(addresses, disabled) {
+			const fn = "AddressesDisabledSave";
+			const paramTypes = [["[]", "string"], ["bool"]];
+			const returnTypes = [];
+			const params = [addresses, disabled];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
 		// SetPassword saves a new password for an account, invalidating the previous password.
 		// Sessions are not interrupted, and will keep working. New login attempts must use the new password.
-		// Password must be at least 8 characters.
+		// Password must be at least 8 characters, and meet the password policy from the
+		// configuration.
 		async SetPassword(accountName, password) {
 			const fn = "SetPassword";
 			const paramTypes = [["string"], ["string"]];
@@ -793,6 +988,66 @@ var api;
 			const params = [accountName, password];
 			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
 		}
+		// SetPasswordHash sets the password of an account to a password hash imported from
+		// another system, e.g. when migrating from another mail server. Supported are
+		// bcrypt, argon2 and sha-crypt hashes in crypt format, optionally prefixed with a
+		// scheme in Dovecot syntax, e.g. "{SHA512-CRYPT}". Until the first successful
+		// login, only authentication with a plain text password is possible. At the first
+		// login, the password is upgraded to the native hashes.
+		async SetPasswordHash(accountName, passwordHash) {
+			const fn = "SetPasswordHash";
+			const paramTypes = [["string"], ["string"]];
+			const returnTypes = [];
+			const params = [accountName, passwordHash];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
+		// LoginTokenAdd adds a short-lived login token for an account, and returns the
+		// token. The token can be used instead of the password with the PLAIN and LOGIN
+		// authentication mechanisms, e.g. by external webmail software such as Roundcube
+		// that authenticates users against mox without storing their passwords. The
+		// token cannot be retrieved later. Expires can be at most 7 days in the future.
+		// See ClientConfigsDomain for the IMAP and SMTP submission endpoints.
+		async LoginTokenAdd(accountName, description, expires) {
+			const fn = "LoginTokenAdd";
+			const paramTypes = [["string"], ["string"], ["timestamp"]];
+			const returnTypes = [["string"]];
+			const params = [accountName, description, expires];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
+		// LoginTokens returns the login tokens for an account.
+		async LoginTokens(accountName) {
+			const fn = "LoginTokens";
+			const paramTypes = [["string"]];
+			const returnTypes = [["[]", "LoginToken"]];
+			const params = [accountName];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
+		// LoginTokenRemove removes a login token of an account.
+		async LoginTokenRemove(accountName, id) {
+			const fn = "LoginTokenRemove";
+			const paramTypes = [["string"], ["int64"]];
+			const returnTypes = [];
+			const params = [accountName, id];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
+		// ImportJobs returns the jobs for imports into an account from files or
+		// directories, with their progress, most recent first.
+		async ImportJobs(accountName) {
+			const fn = "ImportJobs";
+			const paramTypes = [["string"]];
+			const returnTypes = [["[]", "ImportJob"]];
+			const params = [accountName];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
+		// ImportJobRemove removes an import job of an account. Imported messages are not
+		// removed, but an interrupted import can no longer be continued.
+		async ImportJobRemove(accountName, id) {
+			const fn = "ImportJobRemove";
+			const paramTypes = [["string"], ["int64"]];
+			const returnTypes = [];
+			const params = [accountName, id];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
 		// AccountSettingsSave set new settings for an account that only an admin can set.
 		async AccountSettingsSave(accountName, maxOutgoingMessagesPerDay, maxFirstTimeRecipientsPerDay, maxMsgSize, firstTimeSenderDelay, noCustomPassword) {
 			const fn = "AccountSettingsSave";
@@ -809,6 +1064,24 @@ var api;
 			const params = [accountName, loginDisabled];
 			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
 		}
+		// AccountSuspend suspends an account: logins are rejected with message, and
+		// incoming deliveries are rejected with a temporary error, or a permanent error
+		// if reject is set.
+		async AccountSuspend(accountName, message, reject) {
+			const fn = "AccountSuspend";
+			const paramTypes = [["string"], ["string"], ["bool"]];
+			const returnTypes = [];
+			const params = [accountName, message, reject];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
+		// AccountResume ends the suspension of an account.
+		async AccountResume(accountName) {
+			const fn = "AccountResume";
+			const paramTypes = [["string"]];
+			const returnTypes = [];
+			const params = [accountName];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
 		// ClientConfigsDomain returns configurations for email clients, IMAP and
 		// Submission (SMTP) for the domain.
 		async ClientConfigsDomain(domain) {
@@ -852,6 +1125,25 @@ var api;
 			const params = [holdRuleID];
 			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
 		}
+		// QueueHoldRuleRelease removes a hold rule and takes the messages in the queue
+		// matching it off hold, e.g. for an account held because it appeared
+		// compromised. Returns number of messages released.
+		async QueueHoldRuleRelease(holdRuleID) {
+			const fn = "QueueHoldRuleRelease";
+			const paramTypes = [["int64"]];
+			const returnTypes = [["int32"]];
+			const params = [holdRuleID];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
+		// QueueHoldRuleDeny drops the messages on hold in the queue matching a hold rule.
+		// The hold rule is kept. Returns number of messages dropped.
+		async QueueHoldRuleDeny(holdRuleID) {
+			const fn = "QueueHoldRuleDeny";
+			const paramTypes = [["int64"]];
+			const returnTypes = [["int32"]];
+			const params = [holdRuleID];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
 		// QueueList returns the messages currently in the outgoing queue.
 		async QueueList(filter, sort) {
 			const fn = "QueueList";
@@ -929,6 +1221,42 @@ var api;
 			const params = [filter, sort];
 			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
 		}
+		// Events returns events in the lifecycle of messages from the event database,
+		// oldest first.
+		async Events(filter) {
+			const fn = "Events";
+			const paramTypes = [["EventFilter"]];
+			const returnTypes = [["[]", "Event"]];
+			const params = [filter];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
+		// MessageTrace returns all events for a message with the given Message-ID,
+		// across incoming and outgoing deliveries.
+		async MessageTrace(messageID) {
+			const fn = "MessageTrace";
+			const paramTypes = [["string"]];
+			const returnTypes = [["[]", "Event"]];
+			const params = [messageID];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
+		// DeliveryStatus returns the events for an outgoing message, by its ID in the
+		// queue, e.g. queueing, delivery attempts and the final result.
+		async DeliveryStatus(queueMsgID) {
+			const fn = "DeliveryStatus";
+			const paramTypes = [["int64"]];
+			const returnTypes = [["[]", "Event"]];
+			const params = [queueMsgID];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
+		// EventStats returns the number of events per kind (e.g. "received",
+		// "delivered", "sent", "bounced") between start and end.
+		async EventStats(start, end) {
+			const fn = "EventStats";
+			const paramTypes = [["timestamp"], ["timestamp"]];
+			const returnTypes = [["{}", "int32"]];
+			const params = [start, end];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
 		// HookQueueSize returns the number of webhooks still to be delivered.
 		async HookQueueSize() {
 			const fn = "HookQueueSize";
@@ -1237,6 +1565,17 @@ var api;
 			const params = [domainName, localpart, domain, account, mailbox];
 			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
 		}
+		// DomainDMARCPolicySave saves the policy for the suggested DMARC DNS record of a
+		// domain: "none", "quarantine", "reject" or empty for the default (reject), or
+		// "auto" for the policy recommended based on DMARC aggregate reports. A DMARC
+		// reporting address must be configured.
+		async DomainDMARCPolicySave(domainName, policy) {
+			const fn = "DomainDMARCPolicySave";
+			const paramTypes = [["string"], ["string"]];
+			const returnTypes = [];
+			const params = [domainName, policy];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
 		// DomainTLSRPTAddressSave saves the TLS reporting address/processing
 		// configuration for a domain. If localpart is empty, processing reports is
 		// disabled.
@@ -1256,6 +1595,37 @@ var api;
 			const params = [domainName, policyID, mode, maxAge, mx];
 			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
 		}
+		// DomainMTASTSRecordPending returns the DNS TXT record for _mta-sts.<domain> to
+		// publish if the record in DNS does not have the policy ID of the configured
+		// MTA-STS policy, e.g. after the max age was increased automatically. Empty if the
+		// DNS record is up to date or no policy is configured.
+		async DomainMTASTSRecordPending(domainName) {
+			const fn = "DomainMTASTSRecordPending";
+			const paramTypes = [["string"]];
+			const returnTypes = [["string"]];
+			const params = [domainName];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
+		// DomainWKDSave enables or disables serving OpenPGP keys published by accounts
+		// through the Web Key Directory for the domain. If accounts is non-empty, only
+		// those accounts can publish keys.
+		async DomainWKDSave(domainName, enabled, accounts) {
+			const fn = "DomainWKDSave";
+			const paramTypes = [["string"], ["bool"], ["[]", "string"]];
+			const returnTypes = [];
+			const params = [domainName, enabled, accounts];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
+		// DomainWellKnownSave saves the files served under /.well-known/ for the domain,
+		// e.g. security.txt. If neither a security.txt nor a change-password URL is set,
+		// no well-known files are served.
+		async DomainWellKnownSave(domainName, wellKnown) {
+			const fn = "DomainWellKnownSave";
+			const paramTypes = [["string"], ["WellKnown"]];
+			const returnTypes = [];
+			const params = [domainName, wellKnown];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
 		// DomainDKIMAdd adds a DKIM selector for a domain, generating a new private
 		// key. The selector is not enabled for signing.
 		async DomainDKIMAdd(domainName, selector, algorithm, hash, headerRelaxed, bodyRelaxed, seal, headers, lifetime) {
@@ -1342,6 +1712,77 @@ var api;
 			const params = [accountName, limit];
 			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
 		}
+		// AuthLockouts returns the counters of consecutive failed authentication attempts
+		// per remote IP and account, including active lockouts.
+		async AuthLockouts() {
+			const fn = "AuthLockouts";
+			const paramTypes = [];
+			const returnTypes = [["[]", "AuthLockout"]];
+			const params = [];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
+		// AuthLockoutRemove removes a failure counter by its key, lifting any lockout for
+		// the remote IP or account.
+		async AuthLockoutRemove(key) {
+			const fn = "AuthLockoutRemove";
+			const paramTypes = [["string"]];
+			const returnTypes = [];
+			const params = [key];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
+		// JunkDecisions returns the most recent decisions about incoming messages for an
+		// account, with the inputs to the decisions. At most limit decisions are
+		// returned, if greater than 0.
+		async JunkDecisions(accountName, limit) {
+			const fn = "JunkDecisions";
+			const paramTypes = [["string"], ["int32"]];
+			const returnTypes = [["[]", "JunkDecision"]];
+			const params = [accountName, limit];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
+		async IMAPClients(accountName) {
+			const fn = "IMAPClients";
+			const paramTypes = [["string"]];
+			const returnTypes = [["[]", "IMAPClient"]];
+			const params = [accountName];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
+		// IMAPConnections returns the open IMAP connections, for all listeners. For
+		// domain admins, only authenticated connections of managed accounts are returned.
+		async IMAPConnections() {
+			const fn = "IMAPConnections";
+			const paramTypes = [];
+			const returnTypes = [["[]", "Connection"]];
+			const params = [];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
+		// IMAPConnectionClose closes an open IMAP connection by its connection ID, after
+		// sending a BYE. A command in progress is aborted.
+		async IMAPConnectionClose(cid) {
+			const fn = "IMAPConnectionClose";
+			const paramTypes = [["int64"]];
+			const returnTypes = [];
+			const params = [cid];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
+		// WebSessions returns the login sessions for the webmail and account web
+		// interfaces of an account that have not expired, most recently used first.
+		async WebSessions(accountName) {
+			const fn = "WebSessions";
+			const paramTypes = [["string"]];
+			const returnTypes = [["[]", "LoginSession"]];
+			const params = [accountName];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
+		// WebSessionRemove removes a login session of an account, logging out the user
+		// of that session.
+		async WebSessionRemove(accountName, sessionID) {
+			const fn = "WebSessionRemove";
+			const paramTypes = [["string"], ["int64"]];
+			const returnTypes = [];
+			const params = [accountName, sessionID];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
 	}
 	api.Client = Client;
 	api.defaultBaseURL = (function () {
@@ -1699,6 +2140,7 @@ const login = async (reason) => {
 		const origFocus = document.activeElement;
 		let reasonElem;
 		let fieldset;
+		let username;
 		let password;
 		const root = dom.div(style({ position: 'absolute', top: 0, right: 0, bottom: 0, left: 0, backgroundColor: '#eee', display: 'flex', alignItems: 'center', justifyContent: 'center', zIndex: '1', animation: 'fadein .15s ease-in' }), dom.div(style({ display: 'flex', flexDirection: 'column', alignItems: 'center' }), reasonElem = reason ? dom.div(style({ marginBottom: '2ex', textAlign: 'center' }), reason) : dom.div(), dom.div(style({ backgroundColor: 'white', borderRadius: '.25em', padding: '1em', boxShadow: '0 0 20px rgba(0, 0, 0, 0.1)', border: '1px solid #ddd', maxWidth: '95vw', overflowX: 'auto', maxHeight: '95vh', overflowY: 'auto', marginBottom: '20vh' }), dom.form(async function submit(e) {
 			e.preventDefault();
@@ -1707,7 +2149,7 @@ const login = async (reason) => {
 			try {
 				fieldset.disabled = true;
 				const loginToken = await client.LoginPrep();
-				const token = await client.Login(loginToken, password.value);
+				const token = await client.Login(loginToken, username.value, password.value);
 				try {
 					window.localStorage.setItem('webadmincsrftoken', token);
 				}
@@ -1727,7 +2169,7 @@ const login = async (reason) => {
 			finally {
 				fieldset.disabled = false;
 			}
-		}, fieldset = dom.fieldset(dom.h1('Admin'), dom.label(style({ display: 'block', marginBottom: '2ex' }), dom.div('Password', style({ marginBottom: '.5ex' })), password = dom.input(attr.type('password'), attr.autocomplete('current-password'), attr.required(''))), dom.div(style({ textAlign: 'center' }), dom.submitbutton('Login')))))));
+		}, fieldset = dom.fieldset(dom.h1('Admin'), dom.label(style({ display: 'block', marginBottom: '2ex' }), dom.div('Domain admin name', style({ marginBottom: '.5ex' }), attr.title('Leave empty for the global admin.')), username = dom.input(attr.autocomplete('username'))), dom.label(style({ display: 'block', marginBottom: '2ex' }), dom.div('Password', style({ marginBottom: '.5ex' })), password = dom.input(attr.type('password'), attr.autocomplete('current-password'), attr.required(''))), dom.div(style({ textAlign: 'center' }), dom.submitbutton('Login')))))));
 		document.body.appendChild(root);
 		password.focus();
 	});
@@ -1958,11 +2400,13 @@ const formatSize = (n) => {
 	return n + ' bytes';
 };
 const index = async () => {
+	// Domain admins only manage their domains and accounts, global functionality is hidden.
+	const [domainAdmin] = await client.DomainAdminScope();
 	const [domains, queueSize, hooksQueueSize, checkUpdatesEnabled, [accounts, accountsDisabled]] = await Promise.all([
 		client.Domains(),
-		client.QueueSize(),
-		client.HookQueueSize(),
-		client.CheckUpdatesEnabled(),
+		domainAdmin ? 0 : client.QueueSize(),
+		domainAdmin ? 0 : client.HookQueueSize(),
+		domainAdmin ? true : client.CheckUpdatesEnabled(),
 		client.Accounts(),
 	]);
 	let fieldset;
@@ -1973,13 +2417,18 @@ const index = async () => {
 	let recvIDFieldset;
 	let recvID;
 	let cidElem;
-	return dom.div(crumbs('Mox Admin'), checkUpdatesEnabled ? [] : dom.p(box(yellow, 'Warning: Checking for updates has not been enabled in mox.conf (CheckUpdates: true).', dom.br(), 'Make sure you stay up to date through another mechanism!', dom.br(), 'You have a responsibility to keep the internet-connected software you run up to date and secure!', dom.br(), 'See ', link('https://updates.xmox.nl/changelog'))), dom.p(dom.a('Accounts', attr.href('#accounts')), dom.br(), dom.a('Queue', attr.href('#queue')), ' (' + queueSize + ')', dom.br(), dom.a('Webhook queue', attr.href('#webhookqueue')), ' (' + hooksQueueSize + ')', dom.br()), dom.h2('Domains'), (domains || []).length === 0 ? box(red, 'No domains') :
+	return dom.div(crumbs('Mox Admin'), checkUpdatesEnabled ? [] : dom.p(box(yellow, 'Warning: Checking for updates has not been enabled in mox.conf (CheckUpdates: true).', dom.br(), 'Make sure you stay up to date through another mechanism!', dom.br(), 'You have a responsibility to keep the internet-connected software you run up to date and secure!', dom.br(), 'See ', link('https://updates.xmox.nl/changelog'))), domainAdmin ? dom.p('Logged in as domain admin ', dom.b(domainAdmin), '.') : [], dom.p(dom.a('Accounts', attr.href('#accounts')), dom.br(), domainAdmin ? [] : [
+		dom.a('Queue', attr.href('#queue')), ' (' + queueSize + ')', dom.br(),
+		dom.a('Webhook queue', attr.href('#webhookqueue')), ' (' + hooksQueueSize + ')', dom.br(),
+	]), dom.h2('Domains'), (domains || []).length === 0 ? box(red, 'No domains') :
 		dom.ul((domains || []).map(d => dom.li(dom.a(attr.href('#domains/' + domainName(d.Domain)), domainString(d.Domain)), d.Disabled ? ' (disabled)' : []))), dom.br(), dom.h2('Add domain'), dom.form(async function submit(e) {
 		e.preventDefault();
 		e.stopPropagation();
 		await check(fieldset, client.DomainAdd(disabled.checked, domain.value, account.value, localpart.value));
 		window.location.hash = '#domains/' + domain.value;
-	}, fieldset = dom.fieldset(dom.label(style({ display: 'inline-block' }), dom.span('Domain', attr.title('Domain for incoming/outgoing email to add to mox. Can also be a subdomain of a domain already configured.')), dom.br(), domain = dom.input(attr.required(''))), ' ', dom.label(style({ display: 'inline-block' }), dom.span('Postmaster/reporting account', attr.title('Account that is considered the owner of this domain. If the account does not yet exist, it will be created and a a localpart is required for the initial email address.')), dom.br(), account = dom.input(attr.required(''), attr.list('accountList')), dom.datalist(attr.id('accountList'), (accounts || []).map(a => dom.option(attr.value(a), a + (accountsDisabled?.includes(a) ? ' (disabled)' : ''))))), ' ', dom.label(style({ display: 'inline-block' }), dom.span('Localpart (if new account)', attr.title('Must be set if and only if account does not yet exist. A localpart is the part before the "@"-sign of an email address. An account requires an email address, so creating a new account for a domain requires a localpart to form an initial email address.')), dom.br(), localpart = dom.input()), ' ', dom.label(disabled = dom.input(attr.type('checkbox')), ' Disabled', attr.title('Disabled domains do fetch new certificates with ACME and do not accept incoming or outgoing messages involving the domain. Accounts and addresses referencing a disabled domain can be created. USeful during/before migrations.')), ' ', dom.submitbutton('Add domain', attr.title('Domain will be added and the config reloaded. Add the required DNS records after adding the domain.')))), dom.br(), dom.h2('Reports'), dom.div(dom.a('DMARC', attr.href('#dmarc/reports'))), dom.div(dom.a('TLS', attr.href('#tlsrpt/reports'))), dom.br(), dom.h2('Operations'), dom.div(dom.a('MTA-STS policies', attr.href('#mtasts'))), dom.div(dom.a('DMARC evaluations', attr.href('#dmarc/evaluations'))), dom.div(dom.a('TLS connection results', attr.href('#tlsrpt/results'))), dom.div(dom.a('DNSBL', attr.href('#dnsbl'))), dom.div(style({ marginTop: '.5ex' }), dom.form(async function submit(e) {
+	}, fieldset = dom.fieldset(dom.label(style({ display: 'inline-block' }), dom.span('Domain', attr.title('Domain for incoming/outgoing email to add to mox. Can also be a subdomain of a domain already configured.')), dom.br(), domain = dom.input(attr.required(''))), ' ', dom.label(style({ display: 'inline-block' }), dom.span('Postmaster/reporting account', attr.title('Account that is considered the owner of this domain. If the account does not yet exist, it will be created and a a localpart is required for the initial email address.')), dom.br(), account = dom.input(attr.required(''), attr.list('accountList')), dom.datalist(attr.id('accountList'), (accounts || []).map(a => dom.option(attr.value(a), a + (accountsDisabled?.includes(a) ? ' (disabled)' : ''))))), ' ', dom.label(style({ display: 'inline-block' }), dom.span('Localpart (if new account)', attr.title('Must be set if and only if account does not yet exist. A localpart is the part before the "@"-sign of an email address. An account requires an email address, so creating a new account for a domain requires a localpart to form an initial email address.')), dom.br(), localpart = dom.input()), ' ', dom.label(disabled = dom.input(attr.type('checkbox')), ' Disabled', attr.title('Disabled domains do fetch new certificates with ACME and do not accept incoming or outgoing messages involving the domain. Accounts and addresses referencing a disabled domain can be created. USeful during/before migrations.')), ' ', dom.submitbutton('Add domain', attr.title('Domain will be added and the config reloaded. Add the required DNS records after adding the domain.')))), domainAdmin ? [] : [
+		dom.br(),
+		dom.h2('Reports'), dom.div(dom.a('DMARC', attr.href('#dmarc/reports'))), dom.div(dom.a('TLS', attr.href('#tlsrpt/reports'))), dom.br(), dom.h2('Operations'), dom.div(dom.a('MTA-STS policies', attr.href('#mtasts'))), dom.div(dom.a('DMARC evaluations', attr.href('#dmarc/evaluations'))), dom.div(dom.a('TLS connection results', attr.href('#tlsrpt/results'))), dom.div(dom.a('DNSBL', attr.href('#dnsbl'))), dom.div(style({ marginTop: '.5ex' }), dom.form(async function submit(e) {
 		e.preventDefault();
 		e.stopPropagation();
 		dom._kids(cidElem);
@@ -1987,7 +2436,8 @@ const index = async () => {
 		dom._kids(cidElem, cid);
 	}, recvIDFieldset = dom.fieldset(dom.label('Received ID', attr.title('The ID in the Received header that was added during incoming delivery.')), ' ', recvID = dom.input(attr.required('')), ' ', dom.submitbutton('Lookup cid', attr.title('Logging about an incoming message includes an attribute "cid", a counter identifying the transaction related to delivery of the message. The ID in the received header is an encrypted cid, which this form decrypts, after which you can look it up in the logging.')), ' ', cidElem = dom.span()))), 
 	// todo: routing, globally, per domain and per account
-	dom.br(), dom.h2('Configuration'), dom.div(dom.a('Routes', attr.href('#routes'))), dom.div(dom.a('Webserver', attr.href('#webserver'))), dom.div(dom.a('Files', attr.href('#config'))), dom.div(dom.a('Log levels', attr.href('#loglevels'))), footer);
+	dom.br(), dom.h2('Configuration'), dom.div(dom.a('Routes', attr.href('#routes'))), dom.div(dom.a('Webserver', attr.href('#webserver'))), dom.div(dom.a('Files', attr.href('#config'))), dom.div(dom.a('Log levels', attr.href('#loglevels'))),
+	], footer);
 };
 const globalRoutes = async () => {
 	const [transports, config] = await Promise.all([
@@ -2043,21 +2493,23 @@ const inlineBox = (color, ...l) => dom.span(style({
 	borderRadius: '3px',
 }), l);
 const accounts = async () => {
-	const [[accounts, accountsDisabled], domains, loginAttempts] = await Promise.all([
+	const [[accounts, accountsDisabled], domains, loginAttempts, templates] = await Promise.all([
 		client.Accounts(),
 		client.Domains(),
 		client.LoginAttempts("", 10),
+		client.AccountTemplates(),
 	]);
 	let fieldset;
 	let localpart;
 	let domain;
 	let account;
+	let template = null;
 	let accountModified = false;
 	return dom.div(crumbs(crumblink('Mox Admin', '#'), 'Accounts'), dom.h2('Accounts'), (accounts || []).length === 0 ? dom.p('No accounts') :
 		dom.ul((accounts || []).map(s => dom.li(dom.a(attr.href('#accounts/l/' + s), s), accountsDisabled?.includes(s) ? ' (disabled)' : ''))), dom.br(), dom.h2('Add account'), dom.form(async function submit(e) {
 		e.preventDefault();
 		e.stopPropagation();
-		await check(fieldset, client.AccountAdd(account.value, localpart.value + '@' + domain.value));
+		await check(fieldset, client.AccountAdd(account.value, localpart.value + '@' + domain.value, template ? template.value : ''));
 		window.location.hash = '#accounts/l/' + account.value;
 	}, fieldset = dom.fieldset(dom.p('Start with the initial email address for the account. The localpart is the account name too by default, but the account name can be changed.'), dom.label(style({ display: 'inline-block' }), dom.span('Localpart', attr.title('The part before the "@" of an email address. More addresses, also at different domains, can be added after the account has been created.')), dom.br(), localpart = dom.input(attr.required(''), function keyup() {
 		if (!accountModified) {
@@ -2065,11 +2517,26 @@ const accounts = async () => {
 		}
 	})), '@', dom.label(style({ display: 'inline-block' }), dom.span('Domain', attr.title('The domain of the email address, after the "@".')), dom.br(), domain = dom.select(attr.required(''), (domains || []).map(d => dom.option(domainName(d.Domain))))), ' ', dom.label(style({ display: 'inline-block' }), dom.span('Account name', attr.title('An account has a password, and email address(es) (possibly at different domains). Its messages and the message index database are are stored in the file system in a directory with the name of the account. An account name is not an email address. Use a name like a unix user name, or the localpart (the part before the "@") of the initial address.')), dom.br(), account = dom.input(attr.required(''), function change() {
 		accountModified = true;
-	})), ' ', dom.submitbutton('Add account', attr.title('The account will be added and the config reloaded.')))), dom.br(), dom.h2('Recent login attempts', attr.title('Login attempts are stored for 30 days. At most 10000 failed login attempts are stored per account to prevent unlimited growth of the database.')), renderLoginAttempts(true, loginAttempts || []), dom.br(), loginAttempts && loginAttempts.length >= 10 ? dom.p('See ', dom.a(attr.href('#accounts/loginattempts'), 'all login attempts'), '.') : []);
+	})), ' ', (templates || []).length === 0 ? [] : [
+		dom.label(style({ display: 'inline-block' }), dom.span('Template', attr.title('Account template from the mox.conf configuration file, with settings for the new account, e.g. initial mailboxes, junk filter settings and quota.')), dom.br(), template = dom.select(dom.option('(none)', attr.value('')), (templates || []).map(t => dom.option(t)))),
+		' ',
+	], dom.submitbutton('Add account', attr.title('The account will be added and the config reloaded.')))), dom.br(), dom.h2('Recent login attempts', attr.title('Login attempts are stored for 30 days. At most 10000 failed login attempts are stored per account to prevent unlimited growth of the database.')), renderLoginAttempts(true, loginAttempts || []), dom.br(), loginAttempts && loginAttempts.length >= 10 ? dom.p('See ', dom.a(attr.href('#accounts/loginattempts'), 'all login attempts'), '.') : []);
 };
 const loginattempts = async () => {
-	const loginAttempts = await client.LoginAttempts("", 0);
-	return dom.div(crumbs(crumblink('Mox Admin', '#'), crumblink('Accounts', '#accounts'), 'Login attempts'), dom.h2('Login attempts'), dom.p('Login attempts are stored for 30 days. At most 10000 failed login attempts are stored per account to prevent unlimited growth of the database.'), renderLoginAttempts(true, loginAttempts || []));
+	const [[domainAdmin], loginAttempts] = await Promise.all([
+		client.DomainAdminScope(),
+		client.LoginAttempts("", 0),
+	]);
+	const authLockouts = domainAdmin ? [] : await client.AuthLockouts();
+	const nowSecs = new Date().getTime() / 1000;
+	return dom.div(crumbs(crumblink('Mox Admin', '#'), crumblink('Accounts', '#accounts'), 'Login attempts'), domainAdmin ? [] : [
+		dom.h2('Authentication lockouts', attr.title('Consecutive failed authentication attempts are counted per remote IP (IPv6 per /64) and per account, for all protocols. After 20 failures from an IP, or 10 for an account, authentication is refused for a minute, doubling with each next failure. A successful login resets the counters. Counters are reset after 24 hours without failures.')),
+		dom.table(dom.thead(dom.tr(dom.th('Key'), dom.th('Failures'), dom.th('Locked until'), dom.th('Last failure'), dom.th('First failure'), dom.th('Action'))), dom.tbody((authLockouts || []).length ? [] : dom.tr(dom.td(attr.colspan('6'), 'None')), (authLockouts || []).map(al => dom.tr(dom.td(al.Key), dom.td('' + al.Failures), dom.td(al.Until.getTime() > nowSecs * 1000 ? box(red, age(al.Until, true, nowSecs)) : '-'), dom.td(age(al.Last, false, nowSecs)), dom.td(age(al.First, false, nowSecs)), dom.td(dom.clickbutton('Remove', attr.title('Remove the failure counter, lifting any lockout.'), async function click(e) {
+			await check(e.target, client.AuthLockoutRemove(al.Key));
+			window.location.reload(); // todo: update lockouts and rerender.
+		})))))),
+		dom.br(),
+	], dom.h2('Login attempts'), dom.p('Login attempts are stored for 30 days. At most 10000 failed login attempts are stored per account to prevent unlimited growth of the database.'), renderLoginAttempts(true, loginAttempts || []));
 };
 const accountloginattempts = async (accountName) => {
 	const loginAttempts = await client.LoginAttempts(accountName, 0);
@@ -2113,16 +2580,18 @@ const RoutesEditor = (kind, transports, routes, save) => {
 			e.stopPropagation();
 			e.preventDefault();
 			await check(routesFieldset, save(routeRows.map(rr => rr.gather())));
-		}, routesFieldset = dom.fieldset(dom.table(dom.thead(dom.tr(dom.th('From domain'), dom.th('To domain'), dom.th('Minimum attempts'), dom.th('Transport'), dom.th(dom.clickbutton('Add', function click() {
+		}, routesFieldset = dom.fieldset(dom.table(dom.thead(dom.tr(dom.th('From domain'), dom.th('To domain'), dom.th('Minimum attempts'), dom.th('Transport'), dom.th('Failover transports', attr.title('Comma-separated transports to fail over to, in order, immediately, when delivery fails with an error of one of the failover error classes.')), dom.th('Failover errors', attr.title('Comma-separated error classes to fail over for: connection, tls, temporary, policy, permanent. Default: connection, tls, policy.')), dom.th(dom.clickbutton('Add', function click() {
 			routes = routeRows.map(rr => rr.gather());
 			routes.push({ FromDomain: [], ToDomain: [], MinimumAttempts: 0, Transport: transportNames[0] });
 			render();
-		})))), dom.tbody((routes || []).length === 0 ? dom.tr(dom.td(attr.colspan('5'), 'No routes.')) : [], routeRows = (routes || []).map((r, index) => {
+		})))), dom.tbody((routes || []).length === 0 ? dom.tr(dom.td(attr.colspan('7'), 'No routes.')) : [], routeRows = (routes || []).map((r, index) => {
 			let fromDomain = dom.input(attr.value((r.FromDomain || []).join(',')));
 			let toDomain = dom.input(attr.value((r.ToDomain || []).join(',')));
 			let minimumAttempts = dom.input(attr.value('' + r.MinimumAttempts));
 			let transport = dom.select(attr.required(''), transportNames.map(s => dom.option(s, s === r.Transport ? attr.selected('') : [])));
-			const tr = dom.tr(dom.td(fromDomain), dom.td(toDomain), dom.td(minimumAttempts), dom.td(transport), dom.td(dom.clickbutton('Remove', function click() {
+			let failover = dom.input(attr.value((r.Failover || []).join(',')));
+			let failoverErrors = dom.input(attr.value((r.FailoverErrors || []).join(',')));
+			const tr = dom.tr(dom.td(fromDomain), dom.td(toDomain), dom.td(minimumAttempts), dom.td(transport), dom.td(failover), dom.td(failoverErrors), dom.td(dom.clickbutton('Remove', function click() {
 				routeRows.splice(index, 1);
 				routes = routeRows.map(rr => rr.gather());
 				render();
@@ -2135,6 +2604,8 @@ const RoutesEditor = (kind, transports, routes, save) => {
 						ToDomain: toDomain.value ? toDomain.value.split(',') : [],
 						MinimumAttempts: parseInt(minimumAttempts.value) || 0,
 						Transport: transport.value,
+						Failover: failover.value ? failover.value.split(',') : [],
+						FailoverErrors: failoverErrors.value ? failoverErrors.value.split(',') : [],
 					};
 				},
 			};
@@ -2157,14 +2628,16 @@ const RoutesEditor = (kind, transports, routes, save) => {
 	return render();
 };
 const account = async (name) => {
-	const [[config, diskUsage], domains, transports, tlspubkeys, loginAttempts] = await Promise.all([
+	const [[config, diskUsage], domains, transports, tlspubkeys, loginAttempts, logintokens] = await Promise.all([
 		client.Account(name),
 		client.Domains(),
 		client.Transports(),
 		client.TLSPublicKeys(name),
 		client.LoginAttempts(name, 10),
+		client.LoginTokens(name),
 	]);
 	// todo: show suppression list, and buttons to add/remove entries.
+	const nowSecs = new Date().getTime() / 1000;
 	let form;
 	let fieldset;
 	let localpart;
@@ -2177,6 +2650,9 @@ const account = async (name) => {
 	let noCustomPassword;
 	let formPassword;
 	let fieldsetPassword;
+	let fieldsetLoginToken;
+	let loginTokenDescription;
+	let loginTokenHours;
 	let password;
 	let passwordHint;
 	const xparseSize = (s) => {
@@ -2266,7 +2742,16 @@ const account = async (name) => {
 	}), dom.br(), dom.h2('TLS public keys', attr.title('For TLS client authentication with certificates, for IMAP and/or submission (SMTP). Only the public key of the certificate is used during TLS authentication, to identify this account. Names, expiration or constraints are not verified.')), dom.table(dom.thead(dom.tr(dom.th('Login address'), dom.th('Name'), dom.th('Type'), dom.th('No IMAP "preauth"', attr.title('New IMAP immediate TLS connections authenticated with a client certificate are automatically switched to "authenticated" state with an untagged IMAP "preauth" message by default. IMAP connections have a state machine specifying when commands are allowed. Authenticating is not allowed while in the "authenticated" state. Enable this option to work around clients that would try to authenticated anyway.')), dom.th('Fingerprint'))), dom.tbody(tlspubkeys?.length ? [] : dom.tr(dom.td(attr.colspan('5'), 'None')), (tlspubkeys || []).map(tpk => {
 		const row = dom.tr(dom.td(tpk.LoginAddress), dom.td(tpk.Name), dom.td(tpk.Type), dom.td(tpk.NoIMAPPreauth ? 'Enabled' : ''), dom.td(tpk.Fingerprint));
 		return row;
-	}))), dom.br(), RoutesEditor('account-specific', transports, config.Routes || [], async (routes) => await client.AccountRoutesSave(name, routes)), dom.br(), dom.h2('Danger'), dom.div(config.LoginDisabled ? [
+	}))), dom.br(), dom.h2('Login tokens', attr.title('Short-lived tokens that can be used instead of the password with the PLAIN and LOGIN authentication mechanisms, e.g. for IMAP and SMTP submission. Useful for external webmail software, like Roundcube, that authenticates users against mox without storing their passwords. See the client configuration of a domain for the IMAP and SMTP submission endpoints.')), dom.table(dom.thead(dom.tr(dom.th('Description'), dom.th('Created'), dom.th('Expires'), dom.th('Last used'), dom.th('Action'))), dom.tbody(logintokens?.length ? [] : dom.tr(dom.td(attr.colspan('5'), 'None')), (logintokens || []).map(lt => dom.tr(dom.td(lt.Description), dom.td(age(lt.Created, false, nowSecs)), dom.td(lt.Expires.getTime() <= nowSecs * 1000 ? 'Expired' : age(lt.Expires, true, nowSecs)), dom.td(lt.LastUsed.getTime() > 0 ? age(lt.LastUsed, false, nowSecs) : '-'), dom.td(dom.clickbutton('Remove', async function click(e) {
+		await check(e.target, client.LoginTokenRemove(name, lt.ID));
+		window.location.reload(); // todo: update login tokens and rerender.
+	})))))), dom.br(), dom.form(fieldsetLoginToken = dom.fieldset(dom.label(style({ display: 'inline-block' }), 'Description', dom.br(), loginTokenDescription = dom.input()), ' ', dom.label(style({ display: 'inline-block' }), 'Valid for (hours)', attr.title('At most 7 days.'), dom.br(), loginTokenHours = dom.input(attr.type('number'), attr.min('1'), attr.max('168'), attr.value('12'), attr.required(''))), ' ', dom.submitbutton('Add login token')), async function submit(e) {
+		e.stopPropagation();
+		e.preventDefault();
+		const expires = new Date(new Date().getTime() + parseInt(loginTokenHours.value) * 3600 * 1000);
+		const token = await check(fieldsetLoginToken, client.LoginTokenAdd(name, loginTokenDescription.value, expires));
+		popup(dom.h1('Login token'), dom.p('Use this token instead of the password. It cannot be retrieved later.'), dom.pre(dom._class('literal'), token), dom.div(dom.clickbutton('Close and reload', function click() { window.location.reload(); })));
+	}), dom.br(), RoutesEditor('account-specific', transports, config.Routes || [], async (routes) => await client.AccountRoutesSave(name, routes)), dom.br(), dom.h2('Danger'), dom.div(config.LoginDisabled ? [
 		box(yellow, 'Account login is currently disabled.'),
 		dom.clickbutton('Enable account login', async function click(e) {
 			if (window.confirm('Are you sure you want to enable login to this account?')) {
@@ -2389,6 +2874,16 @@ const domain = async (d) => {
 	let mtastsMode;
 	let mtastsMaxAge;
 	let mtastsMX;
+	let wkdFieldset;
+	let wkdEnabled;
+	let wkdAccounts;
+	let wellKnownFieldset;
+	let securityTXTContact;
+	let securityTXTExpires;
+	let securityTXTEncryption;
+	let securityTXTPolicy;
+	let securityTXTLanguages;
+	let changePasswordURL;
 	const popupDKIMHeaders = (sel, span) => {
 		const l = sel.HeadersEffective || [];
 		let headers;
@@ -2429,6 +2924,22 @@ const domain = async (d) => {
 			window.location.reload(); // todo: reload only dkim section
 		}, fieldset = dom.fieldset(dom.div(style({ display: 'flex', gap: '1em' }), dom.div(dom.label(style({ display: 'block', marginBottom: '1ex' }), 'Selector', attr.title('Used in the DKIM-Signature header, and used to form a DNS record under ._domainkey.<domain>.'), dom.div(selector = dom.input(attr.required(''), attr.value(defaultSelector())))), dom.label(style({ display: 'block', marginBottom: '1ex' }), 'Algorithm', attr.title('For signing messages. RSA is common at the time of writing, not all mail servers recognize ed25519 signature.'), dom.div(algorithm = dom.select(dom.option('rsa'), dom.option('ed25519')))), dom.label(style({ display: 'block', marginBottom: '1ex' }), 'Hash', attr.title("Used in signing messages. Don't use sha1 unless you understand the consequences."), dom.div(hash = dom.select(dom.option('sha256')))), dom.label(style({ display: 'block', marginBottom: '1ex' }), 'Canonicalization - header', attr.title('Canonicalization processes the message headers before signing. Relaxed allows more whitespace changes, making it more likely for DKIM signatures to validate after transit through servers that make whitespace modifications. Simple is more strict.'), dom.div(canonHeader = dom.select(dom.option('relaxed'), dom.option('simple')))), dom.label(style({ display: 'block', marginBottom: '1ex' }), 'Canonicalization - body', attr.title('Like canonicalization for headers, but for the bodies.'), dom.div(canonBody = dom.select(dom.option('relaxed'), dom.option('simple')))), dom.label(style({ display: 'block', marginBottom: '1ex' }), 'Signature lifetime', attr.title('How long a signature remains valid. Should be as long as a message may take to be delivered. The signature must be valid at the time a message is being delivered to the final destination.'), dom.div(lifetime = dom.input(attr.value('3d'), attr.required('')))), dom.label(style({ display: 'block', marginBottom: '1ex' }), 'Seal headers', attr.title("DKIM-signatures cover headers. If headers are not sealed, additional message headers can be added with the same key without invalidating the signature. This may confuse software about which headers are trustworthy. Sealing is the safer option."), dom.div(seal = dom.input(attr.type('checkbox'), attr.checked(''))))), dom.div(dom.label(style({ display: 'block', marginBottom: '1ex' }), 'Headers (optional)', attr.title('Headers to sign. If left empty, a set of standard headers are signed. The (standard set of) headers are most easily edited after creating the selector/key.'), dom.div(headers = dom.textarea(attr.rows('15')))))), dom.div(dom.submitbutton('Add')))));
 	};
+	// Checking for a pending change to the MTA-STS DNS record involves a DNS lookup,
+	// so it is done in the background.
+	const mtastsPending = dom.div();
+	if (domainConfig.MTASTS) {
+		(async () => {
+			try {
+				const txt = await client.DomainMTASTSRecordPending(d);
+				if (txt) {
+					dom._kids(mtastsPending, dom.p(box(yellow, 'The _mta-sts DNS TXT record does not have the policy ID of the configured policy, e.g. because the max age was increased automatically. Update the DNS record to: ', dom.span(dom._class('literal'), txt))));
+				}
+			}
+			catch (err) {
+				dom._kids(mtastsPending, dom.p(box(yellow, 'Error checking MTA-STS DNS record: ' + (err.message || '(no error message)'))));
+			}
+		})();
+	}
 	return dom.div(crumbs(crumblink('Mox Admin', '#'), 'Domain ' + domainString(dnsdomain)), domainConfig.Disabled ? dom.p(box(yellow, 'Warning: Domain is disabled. Incoming/outgoing messages involving this domain are rejected and ACME for new TLS certificates is disabled.')) : [], dom.ul(dom.li(dom.a('Required DNS records', attr.href('#domains/' + d + '/dnsrecords'))), dom.li(dom.a('Check current actual DNS records and domain configuration', attr.href('#domains/' + d + '/dnscheck')))), dom.br(), dom.h2('Client configuration'), dom.p('If autoconfig/autodiscover does not work with an email client, use the settings below for this domain. Authenticate with email address and password. ', dom.span('Explicitly configure', attr.title('To prevent authentication mechanism downgrade attempts that may result in clients sending plain text passwords to a MitM.')), ' the first supported authentication mechanism: SCRAM-SHA-256-PLUS, SCRAM-SHA-1-PLUS, SCRAM-SHA-256, SCRAM-SHA-1, CRAM-MD5.'), dom.table(dom.thead(dom.tr(dom.th('Protocol'), dom.th('Host'), dom.th('Port'), dom.th('Listener'), dom.th('Note'))), dom.tbody((clientConfigs.Entries || []).map(e => dom.tr(dom.td(e.Protocol), dom.td(domainString(e.Host)), dom.td('' + e.Port), dom.td('' + e.Listener), dom.td('' + e.Note))))), dom.br(), dom.h2('DMARC aggregate reports summary'), renderDMARCSummaries(dmarcSummaries || []), dom.br(), dom.h2('TLS reports summary'), renderTLSRPTSummaries(tlsrptSummaries || []), dom.br(), dom.h2('Addresses'), dom.table(dom.thead(dom.tr(dom.th('Address'), dom.th('Account'), dom.th('Action'))), dom.tbody(Object.entries(localpartAccounts).map(t => dom.tr(dom.td(prewrap(t[0]) || '(catchall)'), dom.td(dom.a(t[1], attr.href('#accounts/l/' + t[1]))), dom.td(dom.clickbutton('Remove', async function click(e) {
 		e.preventDefault();
 		if (!window.confirm('Are you sure you want to remove this address? If it is a member of an alias, it will be removed from the alias.')) {
@@ -2559,7 +3070,34 @@ const domain = async (d) => {
 		e.preventDefault();
 		// 20060102T150405
 		mtastsPolicyID.value = new Date().toISOString().replace(/-/g, '').replace(/:/g, '').split('.')[0];
-	})), mtastsPolicyID = dom.input(attr.value(domainConfig.MTASTS?.PolicyID || ''))), dom.label(attr.title("If set to \"enforce\", a remote SMTP server will not deliver email to us if it cannot make a WebPKI-verified SMTP STARTTLS connection. In mode \"testing\", deliveries can be done without verified TLS, but errors will be reported through TLS reporting. In mode \"none\", verified TLS is not required, used for phasing out an MTA-STS policy."), dom.div('Mode'), mtastsMode = dom.select(dom.option(''), Object.values(api.Mode).map(s => dom.option(s, domainConfig.MTASTS?.Mode === s ? attr.selected('') : [])))), dom.label(attr.title('How long a remote mail server is allowed to cache a policy. Typically 1 or several weeks. Units: s for seconds, m for minutes, h for hours, d for day, w for weeks.'), dom.div('Max age'), mtastsMaxAge = dom.input(attr.value(domainConfig.MTASTS?.MaxAge ? formatDuration(domainConfig.MTASTS?.MaxAge || 0) : ''))), dom.label(attr.title('List of server names allowed for SMTP. If empty, the configured hostname is set. Host names can contain a wildcard (*) as a leading label (matching a single label, e.g. *.example matches host.example, not sub.host.example).'), dom.div('MX hosts/patterns (optional)'), mtastsMX = dom.textarea(new String((domainConfig.MTASTS?.MX || []).join('\n')), attr.rows('' + Math.max(2, 1 + (domainConfig.MTASTS?.MX || []).length)))), dom.div(dom.span('\u00a0'), dom.div(dom.submitbutton('Save'))))), dom.br(), dom.h2('DKIM', attr.title('With DKIM signing, a domain is taking responsibility for (content of) emails it sends, letting receiving mail servers build up a (hopefully positive) reputation of the domain, which can help with mail delivery.')), (() => {
+	})), mtastsPolicyID = dom.input(attr.value(domainConfig.MTASTS?.PolicyID || ''))), dom.label(attr.title("If set to \"enforce\", a remote SMTP server will not deliver email to us if it cannot make a WebPKI-verified SMTP STARTTLS connection. In mode \"testing\", deliveries can be done without verified TLS, but errors will be reported through TLS reporting. In mode \"none\", verified TLS is not required, used for phasing out an MTA-STS policy."), dom.div('Mode'), mtastsMode = dom.select(dom.option(''), Object.values(api.Mode).map(s => dom.option(s, domainConfig.MTASTS?.Mode === s ? attr.selected('') : [])))), dom.label(attr.title('How long a remote mail server is allowed to cache a policy. Typically 1 or several weeks. Units: s for seconds, m for minutes, h for hours, d for day, w for weeks.'), dom.div('Max age'), mtastsMaxAge = dom.input(attr.value(domainConfig.MTASTS?.MaxAge ? formatDuration(domainConfig.MTASTS?.MaxAge || 0) : ''))), dom.label(attr.title('List of server names allowed for SMTP. If empty, the configured hostname is set. Host names can contain a wildcard (*) as a leading label (matching a single label, e.g. *.example matches host.example, not sub.host.example).'), dom.div('MX hosts/patterns (optional)'), mtastsMX = dom.textarea(new String((domainConfig.MTASTS?.MX || []).join('\n')), attr.rows('' + Math.max(2, 1 + (domainConfig.MTASTS?.MX || []).length)))), dom.div(dom.span('\u00a0'), dom.div(dom.submitbutton('Save'))))), mtastsPending, dom.br(), dom.h2('Web Key Directory (WKD)', attr.title('With WKD, accounts can publish OpenPGP public keys for their addresses in this domain, for lookup by mail clients, typically for encrypting messages. Keys are served over HTTPS at openpgpkey.<domain> (the "advanced method", requires a DNS record for the host) and the domain itself (the "direct method", requires the domain to point to this server). Accounts publish keys on their account page.')), dom.form(style({ marginTop: '1ex' }), async function submit(e) {
+		e.preventDefault();
+		e.stopPropagation();
+		const accounts = wkdAccounts.value.split('\n').map(s => s.trim()).filter(s => !!s);
+		await check(wkdFieldset, client.DomainWKDSave(d, wkdEnabled.checked, accounts));
+		domainConfig.WKD = wkdEnabled.checked ? { Accounts: accounts } : null;
+	}, wkdFieldset = dom.fieldset(style({ display: 'flex', gap: '1em' }), dom.label(dom.div('\u00a0'), wkdEnabled = dom.input(attr.type('checkbox'), domainConfig.WKD ? attr.checked('') : []), ' Enabled'), dom.label(attr.title('Accounts allowed to publish OpenPGP keys for their addresses in this domain. If empty, all accounts with addresses in this domain can publish keys.'), dom.div('Accounts (optional)'), wkdAccounts = dom.textarea(new String((domainConfig.WKD?.Accounts || []).join('\n')), attr.rows('' + Math.max(2, 1 + (domainConfig.WKD?.Accounts || []).length)))), dom.div(dom.span('\u00a0'), dom.div(dom.submitbutton('Save'))))), dom.br(), dom.h2('Well-known files', attr.title('Files served under /.well-known/ for requests to the domain itself and to the subdomains served by mox (mta-sts, autoconfig, openpgpkey), on listeners serving web content for the domain.')), dom.form(style({ marginTop: '1ex' }), async function submit(e) {
+		e.preventDefault();
+		e.stopPropagation();
+		const lines = (s) => s.split('\n').map(s => s.trim()).filter(s => !!s);
+		const st = domainConfig.WellKnown?.SecurityTXT;
+		const contact = lines(securityTXTContact.value);
+		const wk = {
+			SecurityTXT: contact.length === 0 && !securityTXTExpires.value ? null : {
+				Contact: contact,
+				Expires: securityTXTExpires.value,
+				Encryption: lines(securityTXTEncryption.value),
+				Acknowledgments: st?.Acknowledgments || [],
+				PreferredLanguages: securityTXTLanguages.value.split(',').map(s => s.trim()).filter(s => !!s),
+				Canonical: st?.Canonical || [],
+				Policy: lines(securityTXTPolicy.value),
+				Hiring: st?.Hiring || [],
+			},
+			ChangePasswordURL: changePasswordURL.value,
+		};
+		await check(wellKnownFieldset, client.DomainWellKnownSave(d, wk));
+		domainConfig.WellKnown = !wk.SecurityTXT && !wk.ChangePasswordURL ? null : wk;
+	}, wellKnownFieldset = dom.fieldset(style({ display: 'flex', gap: '1em' }), dom.label(attr.title('URIs for reporting security vulnerabilities in /.well-known/security.txt (RFC 9116), one per line, e.g. mailto:security@example.org, or an https URL. If empty, no security.txt is served.'), dom.div('security.txt contact'), securityTXTContact = dom.textarea(new String((domainConfig.WellKnown?.SecurityTXT?.Contact || []).join('\n')), attr.rows('' + Math.max(2, 1 + (domainConfig.WellKnown?.SecurityTXT?.Contact || []).length)))), dom.label(attr.title('Date and time after which the security.txt should be considered stale, in RFC 3339 format. Recommended to be less than a year in the future.'), dom.div('Expires'), securityTXTExpires = dom.input(attr.value(domainConfig.WellKnown?.SecurityTXT?.Expires || ''), attr.placeholder('2006-01-02T15:04:05Z'))), dom.label(attr.title('URIs of keys for encrypting reports, one per line, e.g. an https URL to an OpenPGP key.'), dom.div('Encryption (optional)'), securityTXTEncryption = dom.textarea(new String((domainConfig.WellKnown?.SecurityTXT?.Encryption || []).join('\n')), attr.rows('' + Math.max(2, 1 + (domainConfig.WellKnown?.SecurityTXT?.Encryption || []).length)))), dom.label(attr.title('URIs of the security policy for reporting vulnerabilities, one per line.'), dom.div('Policy (optional)'), securityTXTPolicy = dom.textarea(new String((domainConfig.WellKnown?.SecurityTXT?.Policy || []).join('\n')), attr.rows('' + Math.max(2, 1 + (domainConfig.WellKnown?.SecurityTXT?.Policy || []).length)))), dom.label(attr.title('Language tags for preferred languages for reports, comma-separated, e.g. "en, nl".'), dom.div('Preferred languages (optional)'), securityTXTLanguages = dom.input(attr.value((domainConfig.WellKnown?.SecurityTXT?.PreferredLanguages || []).join(', ')))), dom.label(attr.title('If set, /.well-known/change-password redirects to this URL, e.g. the account web interface, so password managers can send users to the page for changing their password.'), dom.div('Change password URL (optional)'), changePasswordURL = dom.input(attr.value(domainConfig.WellKnown?.ChangePasswordURL || ''))), dom.div(dom.span('\u00a0'), dom.div(dom.submitbutton('Save'))))), dom.br(), dom.h2('DKIM', attr.title('With DKIM signing, a domain is taking responsibility for (content of) emails it sends, letting receiving mail servers build up a (hopefully positive) reputation of the domain, which can help with mail delivery.')), (() => {
 		let fieldset;
 		let rows = [];
 		return dom.form(async function submit(e) {
@@ -2580,15 +3118,16 @@ const domain = async (d) => {
 			}
 			await check(fieldset, client.DomainDKIMSave(d, selectors, sign));
 			window.alert("Don't forget to update DNS records if needed. See suggested DNS records.");
-		}, fieldset = dom.fieldset(dom.table(dom.thead(dom.tr(dom.th('Selector', attr.title('Used in the DKIM-Signature header, and used to form a DNS record under ._domainkey.<domain>.')), dom.th('Enabled', attr.title('Whether a DKIM-Signature is added to messages for this message. Multiple selectors can be enabled. Having backup keys published in DNS can be useful for quickly rotating a key.')), dom.th('Algorithm', attr.title('For signing messages. RSA is common at the time of writing, not all mail servers recognize ed25519 signature.')), dom.th('Hash', attr.title("Used in signing messages. Don't use sha1 unless you understand the consequences.")), dom.th('Canonicalization header/body', attr.colspan('2'), attr.title('Canonicalization processes the message headers and bodies before signing. Relaxed allows more whitespace changes, making it more likely for DKIM signatures to validate after transit through servers that make whitespace modifications. Simple is more strict.')), dom.th('Seal headers', attr.title("DKIM-signatures cover headers. If headers are not sealed, additional message headers can be added with the same key without invalidating the signature. This may confuse software about which headers are trustworthy. Sealing is the safer option.")), dom.th('Headers', attr.title('Headers to sign.')), dom.th('Signature lifetime', attr.title('How long a signature remains valid. Should be as long as a message may take to be delivered. The signature must be valid at the time a message is being delivered to the final destination.')), dom.th('Action'))), dom.tbody(Object.keys(domainConfig.DKIM.Selectors || []).length === 0 ? dom.tr(dom.td(attr.colspan('9'), 'No DKIM keys/selectors.')) : [], rows = Object.entries(domainConfig.DKIM.Selectors || []).sort().map(([selName, sel]) => {
+		}, fieldset = dom.fieldset(dom.table(dom.thead(dom.tr(dom.th('Selector', attr.title('Used in the DKIM-Signature header, and used to form a DNS record under ._domainkey.<domain>.')), dom.th('Enabled', attr.title('Whether a DKIM-Signature is added to messages for this message. Multiple selectors can be enabled. Having backup keys published in DNS can be useful for quickly rotating a key.')), dom.th('Retiring', attr.title('Set when the key is scheduled for removal, e.g. during key rotation. A retiring selector is not used for signing new messages. Messages in the queue signed with a retiring selector are signed again with the enabled selectors before their next delivery attempt, so they remain valid after the DNS record of the retiring selector is removed.')), dom.th('Algorithm', attr.title('For signing messages. RSA is common at the time of writing, not all mail servers recognize ed25519 signature.')), dom.th('Hash', attr.title("Used in signing messages. Don't use sha1 unless you understand the consequences.")), dom.th('Canonicalization header/body', attr.colspan('2'), attr.title('Canonicalization processes the message headers and bodies before signing. Relaxed allows more whitespace changes, making it more likely for DKIM signatures to validate after transit through servers that make whitespace modifications. Simple is more strict.')), dom.th('Seal headers', attr.title("DKIM-signatures cover headers. If headers are not sealed, additional message headers can be added with the same key without invalidating the signature. This may confuse software about which headers are trustworthy. Sealing is the safer option.")), dom.th('Headers', attr.title('Headers to sign.')), dom.th('Signature lifetime', attr.title('How long a signature remains valid. Should be as long as a message may take to be delivered. The signature must be valid at the time a message is being delivered to the final destination.')), dom.th('Action'))), dom.tbody(Object.keys(domainConfig.DKIM.Selectors || []).length === 0 ? dom.tr(dom.td(attr.colspan('11'), 'No DKIM keys/selectors.')) : [], rows = Object.entries(domainConfig.DKIM.Selectors || []).sort().map(([selName, sel]) => {
 			let enabled;
+			let retiring;
 			let hash;
 			let canonHeader;
 			let canonBody;
 			let seal;
 			let headersElem;
 			let lifetime;
-			const tr = dom.tr(dom.td(selName), dom.td(enabled = dom.input(attr.type('checkbox'), (domainConfig.DKIM.Sign || []).includes(selName) ? attr.checked('') : [])), dom.td(sel.Algorithm), dom.td(hash = dom.select(dom.option('sha256', sel.HashEffective === 'sha256' ? attr.selected('') : []), dom.option('sha1', sel.HashEffective === 'sha1' ? attr.selected('') : []))), dom.td(canonHeader = dom.select(dom.option('relaxed'), dom.option('simple', sel.Canonicalization.HeaderRelaxed ? [] : attr.selected('')))), dom.td(canonBody = dom.select(dom.option('relaxed'), dom.option('simple', sel.Canonicalization.BodyRelaxed ? [] : attr.selected('')))), dom.td(seal = dom.input(attr.type('checkbox'), sel.DontSealHeaders ? [] : attr.checked(''))), dom.td(headersElem = dom.span((sel.HeadersEffective || []).join('; ')), ' ', dom.a(attr.href(''), 'Edit', function click(e) {
+			const tr = dom.tr(dom.td(selName), dom.td(enabled = dom.input(attr.type('checkbox'), (domainConfig.DKIM.Sign || []).includes(selName) ? attr.checked('') : [])), dom.td(retiring = dom.input(attr.type('checkbox'), sel.Retiring ? attr.checked('') : [])), dom.td(sel.Algorithm), dom.td(hash = dom.select(dom.option('sha256', sel.HashEffective === 'sha256' ? attr.selected('') : []), dom.option('sha1', sel.HashEffective === 'sha1' ? attr.selected('') : []))), dom.td(canonHeader = dom.select(dom.option('relaxed'), dom.option('simple', sel.Canonicalization.HeaderRelaxed ? [] : attr.selected('')))), dom.td(canonBody = dom.select(dom.option('relaxed'), dom.option('simple', sel.Canonicalization.BodyRelaxed ? [] : attr.selected('')))), dom.td(seal = dom.input(attr.type('checkbox'), sel.DontSealHeaders ? [] : attr.checked(''))), dom.td(headersElem = dom.span((sel.HeadersEffective || []).join('; ')), ' ', dom.a(attr.href(''), 'Edit', function click(e) {
 				e.preventDefault();
 				popupDKIMHeaders(sel, headersElem);
 			})), dom.td(lifetime = dom.input(attr.value(sel.Expiration))), dom.td(dom.clickbutton('Remove', async function click(e) {
@@ -2596,7 +3135,7 @@ const domain = async (d) => {
 					return;
 				}
 				await check(e.target, client.DomainDKIMRemove(d, selName));
-				window.alert("Don't forget to remove the corresponding DNS records (if it exists). If the DKIM key was active, it is best to wait for all messages in transit have been delivered (which can take days if messages are held up in remote queues), or those messages will not pass DKIM validiation.");
+				window.alert("Don't forget to remove the corresponding DNS records (if it exists). If the DKIM key was active, it is best to wait for all messages in transit have been delivered (which can take days if messages are held up in remote queues), or those messages will not pass DKIM validiation. Marking the selector as retiring first causes messages still in the queue to be signed again with the enabled selectors.");
 				window.location.reload(); // todo: reload less
 			})));
 			return {
@@ -2614,6 +3153,7 @@ const domain = async (d) => {
 						DontSealHeaders: !seal.checked,
 						Expiration: lifetime.value,
 						PrivateKeyFile: '',
+						Retiring: retiring.checked,
 						Algorithm: '',
 					};
 					return [selName, enabled.checked, nsel];
@@ -2685,7 +3225,12 @@ const domainDNSRecords = async (d) => {
 		client.DomainRecords(d),
 		client.ParseDomain(d),
 	]);
-	return dom.div(crumbs(crumblink('Mox Admin', '#'), crumblink('Domain ' + domainString(dnsdomain), '#domains/' + d), 'DNS Records'), dom.h1('Required DNS records'), dom.pre(dom._class('literal'), (records || []).join('\n')), dom.br());
+	let format;
+	let recordsPre;
+	return dom.div(crumbs(crumblink('Mox Admin', '#'), crumblink('Domain ' + domainString(dnsdomain), '#domains/' + d), 'DNS Records'), dom.h1('Required DNS records'), dom.div(style({ marginBottom: '1ex' }), dom.label('Format ', format = dom.select(attr.title('Format for the DNS records. Records commented out in the zone file are not included in the formats for DNS providers.'), async function change() {
+		const s = await check(format, client.DomainRecordsExport(d, format.value));
+		dom._kids(recordsPre, s);
+	}, dom.option('Zone file', attr.value('zone')), dom.option('Cloudflare API, JSON', attr.value('cloudflare')), dom.option('AWS Route53 change batch, JSON', attr.value('route53')), dom.option('Terraform for AWS Route53, HCL', attr.value('terraform'))))), recordsPre = dom.pre(dom._class('literal'), (records || []).join('\n')), dom.br());
 };
 const domainDNSCheck = async (d) => {
 	const [checks, dnsdomain] = await Promise.all([
@@ -2899,12 +3444,25 @@ const period = (start, end) => {
 const domainDMARC = async (d) => {
 	const end = new Date();
 	const start = new Date(new Date().getTime() - 30 * 24 * 3600 * 1000);
-	const [reports, dnsdomain] = await Promise.all([
+	const [reports, dnsdomain, advice, domainConfig, incidents] = await Promise.all([
 		client.DMARCReports(start, end, d),
 		client.Domain(d),
+		client.DMARCAdvice(d),
+		client.DomainConfig(d),
+		client.DMARCSpoofIncidents(start, end, d),
 	]);
+	// Reports about a period with a spoofing incident are marked.
+	const incidentOverlap = (begin, end) => (incidents || []).some(si => si.Start.getTime() <= end.getTime() && si.End.getTime() >= begin.getTime());
+	let policyFieldset;
+	let policy;
 	// todo future: table sorting? period selection (last day, 7 days, 1 month, 1 year, custom period)? collapse rows for a report? show totals per report? a simple bar graph to visualize messages and dmarc/dkim/spf fails? similar for TLSRPT.
-	return dom.div(crumbs(crumblink('Mox Admin', '#'), crumblink('Domain ' + domainString(dnsdomain), '#domains/' + d), 'DMARC aggregate reports'), dom.p('DMARC reports are periodically sent by other mail servers that received an email message with a "From" header with our domain. Domains can have a DMARC DNS record that asks other mail servers to send these aggregate reports for analysis.'), dom.p('Below the DMARC aggregate reports for the past 30 days.'), (reports || []).length === 0 ? dom.div('No DMARC reports for domain.') :
+	return dom.div(crumbs(crumblink('Mox Admin', '#'), crumblink('Domain ' + domainString(dnsdomain), '#domains/' + d), 'DMARC aggregate reports'), dom.p('DMARC reports are periodically sent by other mail servers that received an email message with a "From" header with our domain. Domains can have a DMARC DNS record that asks other mail servers to send these aggregate reports for analysis.'), dom.h2('Policy advice'), dom.p(advice.Recommendation), (advice.UnalignedSources || []).length === 0 ? [] : dom.p('Sources of unaligned messages: ' + (advice.UnalignedSources || []).map(s => s.IP + ' (' + s.Messages + ')').join(', ')), !domainConfig.DMARC ? [] : dom.form(async function submit(e) {
+		e.preventDefault();
+		e.stopPropagation();
+		await check(policyFieldset, client.DomainDMARCPolicySave(d, policy.value));
+		window.alert('Do not forget to update the DMARC DNS record, as shown in the DNS records for the domain.');
+	}, policyFieldset = dom.fieldset(dom.label(attr.title('With policy auto, the policy recommended above is used for the suggested DMARC DNS record, and changes as new reports come in. The DNS record itself must still be updated.'), 'Policy for suggested DNS record ', policy = dom.select(['', 'none', 'quarantine', 'reject', 'auto'].map(p => dom.option(attr.value(p), p || 'default (reject)', p === domainConfig.DMARC?.Policy ? attr.selected('') : [])))), ' ', dom.submitbutton('Save'))), dom.h2('Spoofing incidents'), dom.p('A spoofing incident is a surge of incoming messages with a From address in this domain that fail DMARC, as is common in spoofing campaigns. Reports below that cover the period of an incident are marked.' + (domainConfig.SpoofingSurges === 'ignore' ? ' Detection is disabled for this domain.' : '')), (incidents || []).length === 0 ? dom.p('No spoofing incidents in the past 30 days.') :
+		dom.table(dom.thead(dom.tr(dom.th('Period', attr.title('First and most recent detection of the surge.')), dom.th('Messages', attr.title('Incoming messages failing DMARC during the incident, including those in the hour before the start.')), dom.th('Baseline', attr.title('Average messages failing DMARC per hour in the day before the incident.')), dom.th('Protected', attr.title('Whether a stricter junk filter threshold was used for messages from this domain that fail DMARC, during the incident and for a day after.')), dom.th('Sources', attr.title('IPs that sent most messages failing DMARC during the incident.')))), dom.tbody((incidents || []).map(si => dom.tr(dom.td(period(si.Start, si.End)), dom.td(style({ textAlign: 'right' }), '' + si.Messages), dom.td(style({ textAlign: 'right' }), si.Baseline.toFixed(1)), dom.td(si.Protected ? 'yes' : 'no'), dom.td((si.Sources || []).map(src => src.IP + ' (' + src.Messages + ')').join(', ')))))), dom.br(), dom.p('Below the DMARC aggregate reports for the past 30 days.'), (reports || []).length === 0 ? dom.div('No DMARC reports for domain.') :
 		dom.table(dom._class('hover'), dom.thead(dom.tr(dom.th('ID'), dom.th('Organisation', attr.title('Organization that sent the DMARC report.')), dom.th('Period (UTC)', attr.title('Period this reporting period is about. Mail servers are recommended to stick to whole UTC days.')), dom.th('Policy', attr.title('The DMARC policy that the remote mail server had fetched and applied to the message. A policy that changed during the reporting period may result in unexpected policy evaluations.')), dom.th('Source IP', attr.title('Remote IP address of session at remote mail server.')), dom.th('Messages', attr.title('Total messages that the results apply to.')), dom.th('Result', attr.title('DMARC evaluation result.')), dom.th('ADKIM', attr.title('DKIM alignment. For a pass, one of the DKIM signatures that pass must be strict/relaxed-aligned with the domain, as specified by the policy.')), dom.th('ASPF', attr.title('SPF alignment. For a pass, the SPF policy must pass and be strict/relaxed-aligned with the domain, as specified by the policy.')), dom.th('SMTP to', attr.title('Domain of destination address, as specified during the SMTP session.')), dom.th('SMTP from', attr.title('Domain of originating address, as specified during the SMTP session.')), dom.th('Header from', attr.title('Domain of address in From-header of message.')), dom.th('Auth Results', attr.title('Details of DKIM and/or SPF authentication results. DMARC requires at least one aligned DKIM or SPF pass.')))), dom.tbody((reports || []).map(r => {
 			const m = r.ReportMetadata;
 			let policy = [];
@@ -2965,7 +3523,7 @@ const domainDMARC = async (d) => {
 					const tr = dom.tr(recordIndex > 0 || rows.length > 0 ? [] : [
 						dom.td(reportRowspan, valignTop, dom.a('' + r.ID, attr.href('#domains/' + d + '/dmarc/' + r.ID), attr.title('View raw report.'))),
 						dom.td(reportRowspan, valignTop, m.OrgName, attr.title('Email: ' + m.Email + ', ReportID: ' + m.ReportID)),
-						dom.td(reportRowspan, valignTop, period(new Date(m.DateRange.Begin * 1000), new Date(m.DateRange.End * 1000)), m.Errors && m.Errors.length ? dom.span('errors', attr.title(m.Errors.join('; '))) : []),
+						dom.td(reportRowspan, valignTop, period(new Date(m.DateRange.Begin * 1000), new Date(m.DateRange.End * 1000)), m.Errors && m.Errors.length ? dom.span('errors', attr.title(m.Errors.join('; '))) : [], incidentOverlap(new Date(m.DateRange.Begin * 1000), new Date(m.DateRange.End * 1000)) ? [dom.br(), box(yellow, dom.span('spoofing incident', attr.title('Period overlaps with a spoofing incident, see above.')))] : []),
 						dom.td(reportRowspan, valignTop, policy.join(', ')),
 					], rows.length > 0 ? [] : [
 						dom.td(recordRowspan, valignTop, sourceIP(row.SourceIP)),
@@ -3344,6 +3902,7 @@ const queueList = async () => {
 			Account: holdRuleAccount.value,
 			SenderDomainStr: holdRuleSenderDomain.value,
 			RecipientDomainStr: holdRuleRecipientDomain.value,
+			Reason: '',
 			// Filled in by backend, we provide dummy values.
 			SenderDomain: { ASCII: '', Unicode: '' },
 			RecipientDomain: { ASCII: '', Unicode: '' },
@@ -3361,15 +3920,31 @@ const queueList = async () => {
 					renderHoldRules();
 				})) : [
 				dom.p('Newly submitted messages matching a hold rule will be marked as "on hold" and not be delivered until further action by the admin. To create a rule matching all messages, leave all fields empty.'),
-				dom.table(dom.thead(dom.tr(dom.th('Account'), dom.th('Sender domain'), dom.th('Recipient domain'), dom.th('Action'))), dom.tbody((holdRules || []).length === 0 ? dom.tr(dom.td(attr.colspan('4'), 'No hold rules.')) : [], (holdRules || []).map(pr => dom.tr(!pr.Account && !pr.SenderDomainStr && !pr.RecipientDomainStr ?
+				dom.table(dom.thead(dom.tr(dom.th('Account'), dom.th('Sender domain'), dom.th('Recipient domain'), dom.th('Reason', attr.title('Set for hold rules added automatically for accounts that appear to be compromised.')), dom.th('Action'))), dom.tbody((holdRules || []).length === 0 ? dom.tr(dom.td(attr.colspan('5'), 'No hold rules.')) : [], (holdRules || []).map(pr => dom.tr(!pr.Account && !pr.SenderDomainStr && !pr.RecipientDomainStr ?
 					dom.td(attr.colspan('3'), '(Match all messages)') : [
 					dom.td(pr.Account),
 					dom.td(domainString(pr.SenderDomain)),
 					dom.td(domainString(pr.RecipientDomain)),
-				], dom.td(dom.clickbutton('Remove', attr.title('Removing a hold rule does not modify the "on hold" status of messages in the queue.'), async function click(e) {
+				], dom.td(pr.Reason), dom.td(dom.clickbutton('Remove', attr.title('Removing a hold rule does not modify the "on hold" status of messages in the queue.'), async function click(e) {
 					await check(e.target, client.QueueHoldRuleRemove(pr.ID));
 					window.location.reload(); // todo: reload less
-				})))), dom.tr(dom.td(holdRuleAccount = dom.input(attr.form('holdRuleForm'))), dom.td(holdRuleSenderDomain = dom.input(attr.form('holdRuleForm'))), dom.td(holdRuleRecipientDomain = dom.input(attr.form('holdRuleForm'))), dom.td(holdRuleSubmit = dom.submitbutton('Add hold rule', attr.form('holdRuleForm'), attr.title('When adding a new hold rule, existing messages in queue matching the new rule will be marked as on hold.'))))))
+				}), !pr.Reason ? [] : [
+					' ',
+					dom.clickbutton('Release', attr.title('Remove the hold rule and take the messages in the queue matching it off hold, delivering them.'), async function click(e) {
+						const n = await check(e.target, client.QueueHoldRuleRelease(pr.ID));
+						window.alert('' + n + ' message(s) released');
+						window.location.reload(); // todo: reload less
+					}),
+					' ',
+					dom.clickbutton('Drop held messages', attr.title('Drop the messages on hold in the queue matching the hold rule. The hold rule is kept.'), async function click(e) {
+						if (!window.confirm('Are you sure you want to drop the held messages?')) {
+							return;
+						}
+						const n = await check(e.target, client.QueueHoldRuleDeny(pr.ID));
+						window.alert('' + n + ' message(s) dropped');
+						window.location.reload(); // todo: reload less
+					}),
+				]))), dom.tr(dom.td(holdRuleAccount = dom.input(attr.form('holdRuleForm'))), dom.td(holdRuleSenderDomain = dom.input(attr.form('holdRuleForm'))), dom.td(holdRuleRecipientDomain = dom.input(attr.form('holdRuleForm'))), dom.td(), dom.td(holdRuleSubmit = dom.submitbutton('Add hold rule', attr.form('holdRuleForm'), attr.title('When adding a new hold rule, existing messages in queue matching the new rule will be marked as on hold.'))))))
 			]);
 		};
 		renderHoldRules();
@@ -3619,7 +4194,7 @@ const hooksList = async () => {
 			toggles.set(h.ID, dom.input(attr.type('checkbox'), (hooks || []).length === 1 ? attr.checked('') : []));
 		}
 		const ntbody = dom.tbody(dom._class('loadend'), hooks.length === 0 ? dom.tr(dom.td(attr.colspan('15'), 'No webhooks.')) : [], hooks.map(h => dom.tr(dom.td(toggles.get(h.ID)), dom.td('' + h.ID), dom.td(age(new Date(h.Submitted), false, nowSecs)), dom.td('' + (h.QueueMsgID || '')), // todo future: make it easy to open the corresponding (retired) message from queue (if still around).
-		dom.td('' + h.FromID), dom.td('' + h.MessageID), dom.td(h.Account || '-'), dom.td(h.IsIncoming ? "incoming" : h.OutgoingEvent), dom.td(formatExtra(h.Extra)), dom.td('' + h.Attempts), dom.td(age(h.NextAttempt, true, nowSecs)), dom.td(h.Results && h.Results.length > 0 ? age(h.Results[h.Results.length - 1].Start, false, nowSecs) : []), dom.td(h.Results && h.Results.length > 0 ? h.Results[h.Results.length - 1].Error : []), dom.td(h.URL), dom.td(dom.clickbutton('Details', function click() {
+		dom.td('' + h.FromID), dom.td('' + h.MessageID), dom.td(h.Account || '-'), dom.td(h.IsIncoming ? "incoming" : (h.AdminEvent || h.OutgoingEvent)), dom.td(formatExtra(h.Extra)), dom.td('' + h.Attempts), dom.td(age(h.NextAttempt, true, nowSecs)), dom.td(h.Results && h.Results.length > 0 ? age(h.Results[h.Results.length - 1].Start, false, nowSecs) : []), dom.td(h.Results && h.Results.length > 0 ? h.Results[h.Results.length - 1].Error : []), dom.td(h.URL), dom.td(dom.clickbutton('Details', function click() {
 			popupDetails(h);
 		})))));
 		tbody.replaceWith(ntbody);
@@ -3724,7 +4299,7 @@ const hooksRetiredList = async () => {
 	let tbody = dom.tbody();
 	// todo future: add selection + button to reschedule old retired webhooks.
 	const render = () => {
-		const ntbody = dom.tbody(dom._class('loadend'), hooks.length === 0 ? dom.tr(dom.td(attr.colspan('14'), 'No retired webhooks.')) : [], hooks.map(h => dom.tr(dom.td('' + h.ID), dom.td(h.Success ? '✓' : ''), dom.td(age(h.LastActivity, false, nowSecs)), dom.td(age(new Date(h.Submitted), false, nowSecs)), dom.td('' + (h.QueueMsgID || '')), dom.td('' + h.FromID), dom.td('' + h.MessageID), dom.td(h.Account || '-'), dom.td(h.IsIncoming ? "incoming" : h.OutgoingEvent), dom.td(formatExtra(h.Extra)), dom.td('' + h.Attempts), dom.td(h.Results && h.Results.length > 0 ? h.Results[h.Results.length - 1].Error : []), dom.td(h.URL), dom.td(dom.clickbutton('Details', function click() {
+		const ntbody = dom.tbody(dom._class('loadend'), hooks.length === 0 ? dom.tr(dom.td(attr.colspan('14'), 'No retired webhooks.')) : [], hooks.map(h => dom.tr(dom.td('' + h.ID), dom.td(h.Success ? '✓' : ''), dom.td(age(h.LastActivity, false, nowSecs)), dom.td(age(new Date(h.Submitted), false, nowSecs)), dom.td('' + (h.QueueMsgID || '')), dom.td('' + h.FromID), dom.td('' + h.MessageID), dom.td(h.Account || '-'), dom.td(h.IsIncoming ? "incoming" : (h.AdminEvent || h.OutgoingEvent)), dom.td(formatExtra(h.Extra)), dom.td('' + h.Attempts), dom.td(h.Results && h.Results.length > 0 ? h.Results[h.Results.length - 1].Error : []), dom.td(h.URL), dom.td(dom.clickbutton('Details', function click() {
 			popupDetails(h);
 		})))));
 		tbody.replaceWith(ntbody);
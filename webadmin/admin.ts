@@ -13,6 +13,7 @@ const login = async (reason: string) => {
 		const origFocus = document.activeElement
 		let reasonElem: HTMLElement
 		let fieldset: HTMLFieldSetElement
+		let username: HTMLInputElement
 		let password: HTMLInputElement
 		const root = dom.div(
 			style({position: 'absolute', top: 0, right: 0, bottom: 0, left: 0, backgroundColor: '#eee', display: 'flex', alignItems: 'center', justifyContent: 'center', zIndex: '1', animation: 'fadein .15s ease-in'}),
@@ -31,7 +32,7 @@ const login = async (reason: string) => {
 							try {
 								fieldset.disabled = true
 								const loginToken = await client.LoginPrep()
-								const token = await client.Login(loginToken, password.value)
+								const token = await client.Login(loginToken, username.value, password.value)
 								try {
 									window.localStorage.setItem('webadmincsrftoken', token)
 								} catch (err) {
@@ -51,6 +52,11 @@ const login = async (reason: string) => {
 						},
 						fieldset=dom.fieldset(
 							dom.h1('Admin'),
+							dom.label(
+								style({display: 'block', marginBottom: '2ex'}),
+								dom.div('Domain admin name', style({marginBottom: '.5ex'}), attr.title('Leave empty for the global admin.')),
+								username=dom.input(attr.autocomplete('username')),
+							),
 							dom.label(
 								style({display: 'block', marginBottom: '2ex'}),
 								dom.div('Password', style({marginBottom: '.5ex'})),
@@ -331,11 +337,13 @@ const formatSize = (n: number) => {
 }
 
 const index = async () => {
+	// Domain admins only manage their domains and accounts, global functionality is hidden.
+	const [domainAdmin] = await client.DomainAdminScope()
 	const [domains, queueSize, hooksQueueSize, checkUpdatesEnabled, [accounts, accountsDisabled]] = await Promise.all([
 		client.Domains(),
-		client.QueueSize(),
-		client.HookQueueSize(),
-		client.CheckUpdatesEnabled(),
+		domainAdmin ? 0 : client.QueueSize(),
+		domainAdmin ? 0 : client.HookQueueSize(),
+		domainAdmin ? true : client.CheckUpdatesEnabled(),
 		client.Accounts(),
 	])
 
@@ -352,10 +360,13 @@ const index = async () => {
 	return dom.div(
 		crumbs('Mox Admin'),
 		checkUpdatesEnabled ? [] : dom.p(box(yellow, 'Warning: Checking for updates has not been enabled in mox.conf (CheckUpdates: true).', dom.br(), 'Make sure you stay up to date through another mechanism!', dom.br(), 'You have a responsibility to keep the internet-connected software you run up to date and secure!', dom.br(), 'See ', link('https://updates.xmox.nl/changelog'))),
+		domainAdmin ? dom.p('Logged in as domain admin ', dom.b(domainAdmin), '.') : [],
 		dom.p(
 			dom.a('Accounts', attr.href('#accounts')), dom.br(),
-			dom.a('Queue', attr.href('#queue')), ' ('+queueSize+')', dom.br(),
-			dom.a('Webhook queue', attr.href('#webhookqueue')), ' ('+hooksQueueSize+')', dom.br(),
+			domainAdmin ? [] : [
+				dom.a('Queue', attr.href('#queue')), ' ('+queueSize+')', dom.br(),
+				dom.a('Webhook queue', attr.href('#webhookqueue')), ' ('+hooksQueueSize+')', dom.br(),
+			],
 		),
 		dom.h2('Domains'),
 		(domains || []).length === 0 ? box(red, 'No domains') :
@@ -403,6 +414,7 @@ const index = async () => {
 				dom.submitbutton('Add domain', attr.title('Domain will be added and the config reloaded. Add the required DNS records after adding the domain.')),
 			),
 		),
+		domainAdmin ? [] : [
 		dom.br(),
 		dom.h2('Reports'),
 		dom.div(dom.a('DMARC', attr.href('#dmarc/reports'))),
@@ -438,6 +450,7 @@ const index = async () => {
 		dom.div(dom.a('Webserver', attr.href('#webserver'))),
 		dom.div(dom.a('Files', attr.href('#config'))),
 		dom.div(dom.a('Log levels', attr.href('#loglevels'))),
+		],
 		footer,
 	)
 }
@@ -582,16 +595,18 @@ const inlineBox = (color: string, ...l: ElemArg[]) =>
 	)
 
 const accounts = async () => {
-	const [[accounts, accountsDisabled], domains, loginAttempts] = await Promise.all([
+	const [[accounts, accountsDisabled], domains, loginAttempts, templates] = await Promise.all([
 		client.Accounts(),
 		client.Domains(),
 		client.LoginAttempts("", 10),
+		client.AccountTemplates(),
 	])
 
 	let fieldset: HTMLFieldSetElement
 	let localpart: HTMLInputElement
 	let domain: HTMLSelectElement
 	let account: HTMLInputElement
+	let template: HTMLSelectElement | null = null
 	let accountModified = false
 
 	return dom.div(
@@ -610,7 +625,7 @@ const accounts = async () => {
 			async function submit(e: SubmitEvent) {
 				e.preventDefault()
 				e.stopPropagation()
-				await check(fieldset, client.AccountAdd(account.value, localpart.value+'@'+domain.value))
+				await check(fieldset, client.AccountAdd(account.value, localpart.value+'@'+domain.value, template ? template.value : ''))
 				window.location.hash = '#accounts/l/'+account.value
 			},
 			fieldset=dom.fieldset(
@@ -642,6 +657,15 @@ const accounts = async () => {
 					}),
 				),
 				' ',
+				(templates || []).length === 0 ? [] : [
+					dom.label(
+						style({display: 'inline-block'}),
+						dom.span('Template', attr.title('Account template from the mox.conf configuration file, with settings for the new account, e.g. initial mailboxes, junk filter settings and quota.')),
+						dom.br(),
+						template=dom.select(dom.option('(none)', attr.value('')), (templates || []).map(t => dom.option(t))),
+					),
+					' ',
+				],
 				dom.submitbutton('Add account', attr.title('The account will be added and the config reloaded.')),
 			)
 		),
@@ -654,14 +678,53 @@ const accounts = async () => {
 }
 
 const loginattempts = async () => {
-	const loginAttempts = await client.LoginAttempts("", 0)
+	const [[domainAdmin], loginAttempts] = await Promise.all([
+		client.DomainAdminScope(),
+		client.LoginAttempts("", 0),
+	])
+	const authLockouts = domainAdmin ? [] : await client.AuthLockouts()
 
+	const nowSecs = new Date().getTime()/1000
 	return dom.div(
 		crumbs(
 			crumblink('Mox Admin', '#'),
 			crumblink('Accounts', '#accounts'),
 			'Login attempts',
 		),
+		domainAdmin ? [] : [
+			dom.h2('Authentication lockouts', attr.title('Consecutive failed authentication attempts are counted per remote IP (IPv6 per /64) and per account, for all protocols. After 20 failures from an IP, or 10 for an account, authentication is refused for a minute, doubling with each next failure. A successful login resets the counters. Counters are reset after 24 hours without failures.')),
+			dom.table(
+				dom.thead(
+					dom.tr(
+						dom.th('Key'),
+						dom.th('Failures'),
+						dom.th('Locked until'),
+						dom.th('Last failure'),
+						dom.th('First failure'),
+						dom.th('Action'),
+					),
+				),
+				dom.tbody(
+					(authLockouts || []).length ? [] : dom.tr(dom.td(attr.colspan('6'), 'None')),
+					(authLockouts || []).map(al =>
+						dom.tr(
+							dom.td(al.Key),
+							dom.td(''+al.Failures),
+							dom.td(al.Until.getTime() > nowSecs*1000 ? box(red, age(al.Until, true, nowSecs)) : '-'),
+							dom.td(age(al.Last, false, nowSecs)),
+							dom.td(age(al.First, false, nowSecs)),
+							dom.td(
+								dom.clickbutton('Remove', attr.title('Remove the failure counter, lifting any lockout.'), async function click(e: {target: HTMLButtonElement}) {
+									await check(e.target, client.AuthLockoutRemove(al.Key))
+									window.location.reload() // todo: update lockouts and rerender.
+								}),
+							),
+						)
+					),
+				),
+			),
+			dom.br(),
+		],
 		dom.h2('Login attempts'),
 		dom.p('Login attempts are stored for 30 days. At most 10000 failed login attempts are stored per account to prevent unlimited growth of the database.'),
 		renderLoginAttempts(true, loginAttempts || [])
@@ -779,6 +842,8 @@ const RoutesEditor = (kind: string, transports: { [key: string]: api.Transport }
 							dom.th('To domain'),
 							dom.th('Minimum attempts'),
 							dom.th('Transport'),
+							dom.th('Failover transports', attr.title('Comma-separated transports to fail over to, in order, immediately, when delivery fails with an error of one of the failover error classes.')),
+							dom.th('Failover errors', attr.title('Comma-separated error classes to fail over for: connection, tls, temporary, policy, permanent. Default: connection, tls, policy.')),
 							dom.th(
 								dom.clickbutton('Add', function click() {
 									routes = routeRows.map(rr => rr.gather())
@@ -789,18 +854,22 @@ const RoutesEditor = (kind: string, transports: { [key: string]: api.Transport }
 						),
 					),
 					dom.tbody(
-						(routes || []).length === 0 ? dom.tr(dom.td(attr.colspan('5'), 'No routes.')) : [],
+						(routes || []).length === 0 ? dom.tr(dom.td(attr.colspan('7'), 'No routes.')) : [],
 						routeRows=(routes || []).map((r, index) => {
 							let fromDomain = dom.input(attr.value((r.FromDomain || []).join(',')))
 							let toDomain = dom.input(attr.value((r.ToDomain || []).join(',')))
 							let minimumAttempts = dom.input(attr.value(''+r.MinimumAttempts))
 							let transport = dom.select(attr.required(''), transportNames.map(s => dom.option(s, s === r.Transport ? attr.selected('') : [])))
+							let failover = dom.input(attr.value((r.Failover || []).join(',')))
+							let failoverErrors = dom.input(attr.value((r.FailoverErrors || []).join(',')))
 
 							const tr = dom.tr(
 								dom.td(fromDomain),
 								dom.td(toDomain),
 								dom.td(minimumAttempts),
 								dom.td(transport),
+								dom.td(failover),
+								dom.td(failoverErrors),
 								dom.td(
 									dom.clickbutton('Remove', function click() {
 										routeRows.splice(index, 1)
@@ -817,6 +886,8 @@ const RoutesEditor = (kind: string, transports: { [key: string]: api.Transport }
 										ToDomain: toDomain.value ? toDomain.value.split(',') : [],
 										MinimumAttempts: parseInt(minimumAttempts.value) || 0,
 										Transport: transport.value,
+										Failover: failover.value ? failover.value.split(',') : [],
+										FailoverErrors: failoverErrors.value ? failoverErrors.value.split(',') : [],
 									}
 								},
 							}
@@ -848,16 +919,19 @@ const RoutesEditor = (kind: string, transports: { [key: string]: api.Transport }
 }
 
 const account = async (name: string) => {
-	const [[config, diskUsage], domains, transports, tlspubkeys, loginAttempts] = await Promise.all([
+	const [[config, diskUsage], domains, transports, tlspubkeys, loginAttempts, logintokens] = await Promise.all([
 		client.Account(name),
 		client.Domains(),
 		client.Transports(),
 		client.TLSPublicKeys(name),
 		client.LoginAttempts(name, 10),
+		client.LoginTokens(name),
 	])
 
 	// todo: show suppression list, and buttons to add/remove entries.
 
+	const nowSecs = new Date().getTime()/1000
+
 	let form: HTMLFormElement
 	let fieldset: HTMLFieldSetElement
 	let localpart: HTMLInputElement
@@ -872,6 +946,10 @@ const account = async (name: string) => {
 
 	let formPassword: HTMLFormElement
 	let fieldsetPassword: HTMLFieldSetElement
+
+	let fieldsetLoginToken: HTMLFieldSetElement
+	let loginTokenDescription: HTMLInputElement
+	let loginTokenHours: HTMLInputElement
 	let password: HTMLInputElement
 	let passwordHint: HTMLElement
 
@@ -1120,6 +1198,69 @@ const account = async (name: string) => {
 				}),
 			),
 		),
+		dom.br(),
+		dom.h2('Login tokens', attr.title('Short-lived tokens that can be used instead of the password with the PLAIN and LOGIN authentication mechanisms, e.g. for IMAP and SMTP submission. Useful for external webmail software, like Roundcube, that authenticates users against mox without storing their passwords. See the client configuration of a domain for the IMAP and SMTP submission endpoints.')),
+		dom.table(
+			dom.thead(
+				dom.tr(
+					dom.th('Description'),
+					dom.th('Created'),
+					dom.th('Expires'),
+					dom.th('Last used'),
+					dom.th('Action'),
+				),
+			),
+			dom.tbody(
+				logintokens?.length ? [] : dom.tr(dom.td(attr.colspan('5'), 'None')),
+				(logintokens || []).map(lt =>
+					dom.tr(
+						dom.td(lt.Description),
+						dom.td(age(lt.Created, false, nowSecs)),
+						dom.td(lt.Expires.getTime() <= nowSecs*1000 ? 'Expired' : age(lt.Expires, true, nowSecs)),
+						dom.td(lt.LastUsed.getTime() > 0 ? age(lt.LastUsed, false, nowSecs) : '-'),
+						dom.td(
+							dom.clickbutton('Remove', async function click(e: {target: HTMLButtonElement}) {
+								await check(e.target, client.LoginTokenRemove(name, lt.ID))
+								window.location.reload() // todo: update login tokens and rerender.
+							}),
+						),
+					)
+				),
+			),
+		),
+		dom.br(),
+		dom.form(
+			fieldsetLoginToken=dom.fieldset(
+				dom.label(
+					style({display: 'inline-block'}),
+					'Description',
+					dom.br(),
+					loginTokenDescription=dom.input(),
+				),
+				' ',
+				dom.label(
+					style({display: 'inline-block'}),
+					'Valid for (hours)',
+					attr.title('At most 7 days.'),
+					dom.br(),
+					loginTokenHours=dom.input(attr.type('number'), attr.min('1'), attr.max('168'), attr.value('12'), attr.required('')),
+				),
+				' ',
+				dom.submitbutton('Add login token'),
+			),
+			async function submit(e: SubmitEvent) {
+				e.stopPropagation()
+				e.preventDefault()
+				const expires = new Date(new Date().getTime() + parseInt(loginTokenHours.value)*3600*1000)
+				const token = await check(fieldsetLoginToken, client.LoginTokenAdd(name, loginTokenDescription.value, expires))
+				popup(
+					dom.h1('Login token'),
+					dom.p('Use this token instead of the password. It cannot be retrieved later.'),
+					dom.pre(dom._class('literal'), token),
+					dom.div(dom.clickbutton('Close and reload', function click() { window.location.reload() })),
+				)
+			},
+		),
 
 		dom.br(),
 		RoutesEditor('account-specific', transports, config.Routes || [], async (routes: api.Route[]) => await client.AccountRoutesSave(name, routes)),
@@ -1264,6 +1405,18 @@ const domain = async (d: string) => {
 	let mtastsMaxAge: HTMLInputElement
 	let mtastsMX: HTMLTextAreaElement
 
+	let wkdFieldset: HTMLFieldSetElement
+	let wkdEnabled: HTMLInputElement
+	let wkdAccounts: HTMLTextAreaElement
+
+	let wellKnownFieldset: HTMLFieldSetElement
+	let securityTXTContact: HTMLTextAreaElement
+	let securityTXTExpires: HTMLInputElement
+	let securityTXTEncryption: HTMLTextAreaElement
+	let securityTXTPolicy: HTMLTextAreaElement
+	let securityTXTLanguages: HTMLInputElement
+	let changePasswordURL: HTMLInputElement
+
 	const popupDKIMHeaders = (sel: api.Selector, span: HTMLSpanElement) => {
 		const l = sel.HeadersEffective || []
 		let headers: HTMLTextAreaElement
@@ -1390,6 +1543,22 @@ const domain = async (d: string) => {
 		)
 	}
 
+	// Checking for a pending change to the MTA-STS DNS record involves a DNS lookup,
+	// so it is done in the background.
+	const mtastsPending = dom.div()
+	if (domainConfig.MTASTS) {
+		(async () => {
+			try {
+				const txt = await client.DomainMTASTSRecordPending(d)
+				if (txt) {
+					dom._kids(mtastsPending, dom.p(box(yellow, 'The _mta-sts DNS TXT record does not have the policy ID of the configured policy, e.g. because the max age was increased automatically. Update the DNS record to: ', dom.span(dom._class('literal'), txt))))
+				}
+			} catch (err) {
+				dom._kids(mtastsPending, dom.p(box(yellow, 'Error checking MTA-STS DNS record: ' + ((err as any).message || '(no error message)'))))
+			}
+		})()
+	}
+
 	return dom.div(
 		crumbs(
 			crumblink('Mox Admin', '#'),
@@ -1802,6 +1971,96 @@ const domain = async (d: string) => {
 				dom.div(dom.span('\u00a0'), dom.div(dom.submitbutton('Save'))),
 			),
 		),
+		mtastsPending,
+		dom.br(),
+
+		dom.h2('Web Key Directory (WKD) attr.title('With WKD, accounts can publish OpenPGP public keys for their addresses in this domain, for lookup by mail clients, typically for encrypting messages. Keys are served over HTTPS at openpgpkey.<domain> (the "advanced method", requires a DNS record for the host) and the domain itself (the "direct method", requires the domain to point to this server). Accounts publish keys on their account page.')),
+		dom.form(
+			style({marginTop: '1ex'}),
+			async function submit(e: SubmitEvent) {
+				e.preventDefault()
+				e.stopPropagation()
+				const accounts = wkdAccounts.value.split('\n').map(s => s.trim()).filter(s => !!s)
+				await check(wkdFieldset, client.DomainWKDSave(d, wkdEnabled.checked, accounts))
+				domainConfig.WKD = wkdEnabled.checked ? {Accounts: accounts} : null
+			},
+			wkdFieldset=dom.fieldset(
+				style({display: 'flex', gap: '1em'}),
+				dom.label(
+					dom.div('\u00a0'),
+					wkdEnabled=dom.input(attr.type('checkbox'), domainConfig.WKD ? attr.checked('') : []),
+					' Enabled',
+				),
+				dom.label(
+					attr.title('Accounts allowed to publish OpenPGP keys for their addresses in this domain. If empty, all accounts with addresses in this domain can publish keys.'),
+					dom.div('Accounts (optional)'),
+					wkdAccounts=dom.textarea(new String((domainConfig.WKD?.Accounts || []).join('\n')), attr.rows(''+Math.max(2, 1+(domainConfig.WKD?.Accounts || []).length))),
+				),
+				dom.div(dom.span('\u00a0'), dom.div(dom.submitbutton('Save'))),
+			),
+		),
+		dom.br(),
+
+		dom.h2('Well-known files', attr.title('Files served under /.well-known/ for requests to the domain itself and to the subdomains served by mox (mta-sts, autoconfig, openpgpkey), on listeners serving web content for the domain.')),
+		dom.form(
+			style({marginTop: '1ex'}),
+			async function submit(e: SubmitEvent) {
+				e.preventDefault()
+				e.stopPropagation()
+				const lines = (s: string) => s.split('\n').map(s => s.trim()).filter(s => !!s)
+				const st = domainConfig.WellKnown?.SecurityTXT
+				const contact = lines(securityTXTContact.value)
+				const wk: api.WellKnown = {
+					SecurityTXT: contact.length === 0 && !securityTXTExpires.value ? null : {
+						Contact: contact,
+						Expires: securityTXTExpires.value,
+						Encryption: lines(securityTXTEncryption.value),
+						Acknowledgments: st?.Acknowledgments || [],
+						PreferredLanguages: securityTXTLanguages.value.split(',').map(s => s.trim()).filter(s => !!s),
+						Canonical: st?.Canonical || [],
+						Policy: lines(securityTXTPolicy.value),
+						Hiring: st?.Hiring || [],
+					},
+					ChangePasswordURL: changePasswordURL.value,
+				}
+				await check(wellKnownFieldset, client.DomainWellKnownSave(d, wk))
+				domainConfig.WellKnown = !wk.SecurityTXT && !wk.ChangePasswordURL ? null : wk
+			},
+			wellKnownFieldset=dom.fieldset(
+				style({display: 'flex', gap: '1em'}),
+				dom.label(
+					attr.title('URIs for reporting security vulnerabilities in /.well-known/security.txt (RFC 9116), one per line, e.g. mailto:security@example.org, or an https URL. If empty, no security.txt is served.'),
+					dom.div('security.txt contact'),
+					securityTXTContact=dom.textarea(new String((domainConfig.WellKnown?.SecurityTXT?.Contact || []).join('\n')), attr.rows(''+Math.max(2, 1+(domainConfig.WellKnown?.SecurityTXT?.Contact || []).length))),
+				),
+				dom.label(
+					attr.title('Date and time after which the security.txt should be considered stale, in RFC 3339 format. Recommended to be less than a year in the future.'),
+					dom.div('Expires'),
+					securityTXTExpires=dom.input(attr.value(domainConfig.WellKnown?.SecurityTXT?.Expires || ''), attr.placeholder('2006-01-02T15:04:05Z')),
+				),
+				dom.label(
+					attr.title('URIs of keys for encrypting reports, one per line, e.g. an https URL to an OpenPGP key.'),
+					dom.div('Encryption (optional)'),
+					securityTXTEncryption=dom.textarea(new String((domainConfig.WellKnown?.SecurityTXT?.Encryption || []).join('\n')), attr.rows(''+Math.max(2, 1+(domainConfig.WellKnown?.SecurityTXT?.Encryption || []).length))),
+				),
+				dom.label(
+					attr.title('URIs of the security policy for reporting vulnerabilities, one per line.'),
+					dom.div('Policy (optional)'),
+					securityTXTPolicy=dom.textarea(new String((domainConfig.WellKnown?.SecurityTXT?.Policy || []).join('\n')), attr.rows(''+Math.max(2, 1+(domainConfig.WellKnown?.SecurityTXT?.Policy || []).length))),
+				),
+				dom.label(
+					attr.title('Language tags for preferred languages for reports, comma-separated, e.g. "en, nl".'),
+					dom.div('Preferred languages (optional)'),
+					securityTXTLanguages=dom.input(attr.value((domainConfig.WellKnown?.SecurityTXT?.PreferredLanguages || []).join(', '))),
+				),
+				dom.label(
+					attr.title('If set, /.well-known/change-password redirects to this URL, e.g. the account web interface, so password managers can send users to the page for changing their password.'),
+					dom.div('Change password URL (optional)'),
+					changePasswordURL=dom.input(attr.value(domainConfig.WellKnown?.ChangePasswordURL || '')),
+				),
+				dom.div(dom.span('\u00a0'), dom.div(dom.submitbutton('Save'))),
+			),
+		),
 		dom.br(),
 
 		dom.h2('DKIM', attr.title('With DKIM signing, a domain is taking responsibility for (content of) emails it sends, letting receiving mail servers build up a (hopefully positive) reputation of the domain, which can help with mail delivery.')),
@@ -1840,6 +2099,7 @@ const domain = async (d: string) => {
 							dom.tr(
 								dom.th('Selector', attr.title('Used in the DKIM-Signature header, and used to form a DNS record under ._domainkey.<domain>.')),
 								dom.th('Enabled', attr.title('Whether a DKIM-Signature is added to messages for this message. Multiple selectors can be enabled. Having backup keys published in DNS can be useful for quickly rotating a key.')),
+								dom.th('Retiring', attr.title('Set when the key is scheduled for removal, e.g. during key rotation. A retiring selector is not used for signing new messages. Messages in the queue signed with a retiring selector are signed again with the enabled selectors before their next delivery attempt, so they remain valid after the DNS record of the retiring selector is removed.')),
 								dom.th('Algorithm', attr.title('For signing messages. RSA is common at the time of writing, not all mail servers recognize ed25519 signature.')),
 								dom.th('Hash', attr.title("Used in signing messages. Don't use sha1 unless you understand the consequences."),),
 								dom.th('Canonicalization header/body', attr.colspan('2'), attr.title('Canonicalization processes the message headers and bodies before signing. Relaxed allows more whitespace changes, making it more likely for DKIM signatures to validate after transit through servers that make whitespace modifications. Simple is more strict.')),
@@ -1850,9 +2110,10 @@ const domain = async (d: string) => {
 							),
 						),
 						dom.tbody(
-							Object.keys(domainConfig.DKIM.Selectors || []).length === 0 ? dom.tr(dom.td(attr.colspan('9'), 'No DKIM keys/selectors.')) : [],
+							Object.keys(domainConfig.DKIM.Selectors || []).length === 0 ? dom.tr(dom.td(attr.colspan('11'), 'No DKIM keys/selectors.')) : [],
 							rows=Object.entries(domainConfig.DKIM.Selectors || []).sort().map(([selName, sel]) => {
 								let enabled: HTMLInputElement
+								let retiring: HTMLInputElement
 								let hash: HTMLSelectElement
 								let canonHeader: HTMLSelectElement
 								let canonBody: HTMLSelectElement
@@ -1863,6 +2124,7 @@ const domain = async (d: string) => {
 								const tr = dom.tr(
 									dom.td(selName),
 									dom.td(enabled=dom.input(attr.type('checkbox'), (domainConfig.DKIM.Sign || []).includes(selName) ? attr.checked('') : [])),
+									dom.td(retiring=dom.input(attr.type('checkbox'), sel.Retiring ? attr.checked('') : [])),
 									dom.td(sel.Algorithm),
 									dom.td(
 										hash=dom.select(
@@ -1890,7 +2152,7 @@ const domain = async (d: string) => {
 											return
 										}
 										await check(e.target! as HTMLButtonElement, client.DomainDKIMRemove(d, selName))
-										window.alert("Don't forget to remove the corresponding DNS records (if it exists). If the DKIM key was active, it is best to wait for all messages in transit have been delivered (which can take days if messages are held up in remote queues), or those messages will not pass DKIM validiation.")
+										window.alert("Don't forget to remove the corresponding DNS records (if it exists). If the DKIM key was active, it is best to wait for all messages in transit have been delivered (which can take days if messages are held up in remote queues), or those messages will not pass DKIM validiation. Marking the selector as retiring first causes messages still in the queue to be signed again with the enabled selectors.")
 										window.location.reload() // todo: reload less
 									})),
 								)
@@ -1910,6 +2172,7 @@ const domain = async (d: string) => {
 											DontSealHeaders: !seal.checked,
 											Expiration: lifetime.value,
 											PrivateKeyFile: '',
+											Retiring: retiring.checked,
 											Algorithm: '',
 										}
 										return [selName, enabled.checked, nsel]
@@ -2092,6 +2355,9 @@ const domainDNSRecords = async (d: string) => {
 		client.ParseDomain(d),
 	])
 
+	let format: HTMLSelectElement
+	let recordsPre: HTMLElement
+
 	return dom.div(
 		crumbs(
 			crumblink('Mox Admin', '#'),
@@ -2099,7 +2365,24 @@ const domainDNSRecords = async (d: string) => {
 			'DNS Records',
 		),
 		dom.h1('Required DNS records'),
-		dom.pre(dom._class('literal'), (records || []).join('\n')),
+		dom.div(
+			style({marginBottom: '1ex'}),
+			dom.label(
+				'Format ',
+				format=dom.select(
+					attr.title('Format for the DNS records. Records commented out in the zone file are not included in the formats for DNS providers.'),
+					async function change() {
+						const s = await check(format, client.DomainRecordsExport(d, format.value))
+						dom._kids(recordsPre, s)
+					},
+					dom.option('Zone file', attr.value('zone')),
+					dom.option('Cloudflare API, JSON', attr.value('cloudflare')),
+					dom.option('AWS Route53 change batch, JSON', attr.value('route53')),
+					dom.option('Terraform for AWS Route53, HCL', attr.value('terraform')),
+				),
+			),
+		),
+		recordsPre=dom.pre(dom._class('literal'), (records || []).join('\n')),
 		dom.br(),
 	)
 }
@@ -2595,11 +2878,20 @@ const period = (start: Date, end: Date) => {
 const domainDMARC = async (d: string) => {
 	const end = new Date()
 	const start = new Date(new Date().getTime() - 30*24*3600*1000)
-	const [reports, dnsdomain] = await Promise.all([
+	const [reports, dnsdomain, advice, domainConfig, incidents] = await Promise.all([
 		client.DMARCReports(start, end, d),
 		client.Domain(d),
+		client.DMARCAdvice(d),
+		client.DomainConfig(d),
+		client.DMARCSpoofIncidents(start, end, d),
 	])
 
+	// Reports about a period with a spoofing incident are marked.
+	const incidentOverlap = (begin: Date, end: Date) => (incidents || []).some(si => si.Start.getTime() <= end.getTime() && si.End.getTime() >= begin.getTime())
+
+	let policyFieldset: HTMLFieldSetElement
+	let policy: HTMLSelectElement
+
 	// todo future: table sorting? period selection (last day, 7 days, 1 month, 1 year, custom period)? collapse rows for a report? show totals per report? a simple bar graph to visualize messages and dmarc/dkim/spf fails? similar for TLSRPT.
 
 	return dom.div(
@@ -2609,6 +2901,54 @@ const domainDMARC = async (d: string) => {
 			'DMARC aggregate reports',
 		),
 		dom.p('DMARC reports are periodically sent by other mail servers that received an email message with a "From" header with our domain. Domains can have a DMARC DNS record that asks other mail servers to send these aggregate reports for analysis.'),
+		dom.h2('Policy advice'),
+		dom.p(advice.Recommendation),
+		(advice.UnalignedSources || []).length === 0 ? [] : dom.p('Sources of unaligned messages: ' + (advice.UnalignedSources || []).map(s => s.IP + ' (' + s.Messages + ')').join(', ')),
+		!domainConfig.DMARC ? [] : dom.form(
+			async function submit(e: SubmitEvent) {
+				e.preventDefault()
+				e.stopPropagation()
+				await check(policyFieldset, client.DomainDMARCPolicySave(d, policy.value))
+				window.alert('Do not forget to update the DMARC DNS record, as shown in the DNS records for the domain.')
+			},
+			policyFieldset=dom.fieldset(
+				dom.label(
+					attr.title('With policy auto, the policy recommended above is used for the suggested DMARC DNS record, and changes as new reports come in. The DNS record itself must still be updated.'),
+					'Policy for suggested DNS record ',
+					policy=dom.select(
+						['', 'none', 'quarantine', 'reject', 'auto'].map(p => dom.option(attr.value(p), p || 'default (reject)', p === domainConfig.DMARC?.Policy ? attr.selected('') : [])),
+					),
+				),
+				' ',
+				dom.submitbutton('Save'),
+			),
+		),
+		dom.h2('Spoofing incidents'),
+		dom.p('A spoofing incident is a surge of incoming messages with a From address in this domain that fail DMARC, as is common in spoofing campaigns. Reports below that cover the period of an incident are marked.' + (domainConfig.SpoofingSurges === 'ignore' ? ' Detection is disabled for this domain.' : '')),
+		(incidents || []).length === 0 ? dom.p('No spoofing incidents in the past 30 days.') :
+		dom.table(
+			dom.thead(
+				dom.tr(
+					dom.th('Period', attr.title('First and most recent detection of the surge.')),
+					dom.th('Messages', attr.title('Incoming messages failing DMARC during the incident, including those in the hour before the start.')),
+					dom.th('Baseline', attr.title('Average messages failing DMARC per hour in the day before the incident.')),
+					dom.th('Protected', attr.title('Whether a stricter junk filter threshold was used for messages from this domain that fail DMARC, during the incident and for a day after.')),
+					dom.th('Sources', attr.title('IPs that sent most messages failing DMARC during the incident.')),
+				),
+			),
+			dom.tbody(
+				(incidents || []).map(si =>
+					dom.tr(
+						dom.td(period(si.Start, si.End)),
+						dom.td(style({textAlign: 'right'}), '' + si.Messages),
+						dom.td(style({textAlign: 'right'}), si.Baseline.toFixed(1)),
+						dom.td(si.Protected ? 'yes' : 'no'),
+						dom.td((si.Sources || []).map(src => src.IP + ' (' + src.Messages + ')').join(', ')),
+					)
+				),
+			),
+		),
+		dom.br(),
 		dom.p('Below the DMARC aggregate reports for the past 30 days.'),
 		(reports || []).length === 0 ? dom.div('No DMARC reports for domain.') :
 		dom.table(dom._class('hover'),
@@ -2695,7 +3035,7 @@ const domainDMARC = async (d: string) => {
 								recordIndex > 0 || rows.length > 0 ? [] : [
 									dom.td(reportRowspan, valignTop, dom.a('' + r.ID, attr.href('#domains/' + d + '/dmarc/' + r.ID), attr.title('View raw report.'))),
 									dom.td(reportRowspan, valignTop, m.OrgName, attr.title('Email: ' + m.Email + ', ReportID: ' + m.ReportID)),
-									dom.td(reportRowspan, valignTop, period(new Date(m.DateRange.Begin*1000), new Date(m.DateRange.End*1000)), m.Errors && m.Errors.length ? dom.span('errors', attr.title(m.Errors.join('; '))) : []),
+									dom.td(reportRowspan, valignTop, period(new Date(m.DateRange.Begin*1000), new Date(m.DateRange.End*1000)), m.Errors && m.Errors.length ? dom.span('errors', attr.title(m.Errors.join('; '))) : [], incidentOverlap(new Date(m.DateRange.Begin*1000), new Date(m.DateRange.End*1000)) ? [dom.br(), box(yellow, dom.span('spoofing incident', attr.title('Period overlaps with a spoofing incident, see above.')))] : []),
 									dom.td(reportRowspan, valignTop, policy.join(', ')),
 								],
 								rows.length > 0 ? [] : [
@@ -3467,6 +3807,7 @@ const queueList = async () => {
 					Account: holdRuleAccount.value,
 					SenderDomainStr: holdRuleSenderDomain.value,
 					RecipientDomainStr: holdRuleRecipientDomain.value,
+					Reason: '',
 					// Filled in by backend, we provide dummy values.
 					SenderDomain: {ASCII: '', Unicode: ''},
 					RecipientDomain: {ASCII: '', Unicode: ''},
@@ -3494,11 +3835,12 @@ const queueList = async () => {
 									dom.th('Account'),
 									dom.th('Sender domain'),
 									dom.th('Recipient domain'),
+									dom.th('Reason', attr.title('Set for hold rules added automatically for accounts that appear to be compromised.')),
 									dom.th('Action'),
 								),
 							),
 							dom.tbody(
-								(holdRules || []).length === 0 ? dom.tr(dom.td(attr.colspan('4'), 'No hold rules.')) : [],
+								(holdRules || []).length === 0 ? dom.tr(dom.td(attr.colspan('5'), 'No hold rules.')) : [],
 								(holdRules || []).map(pr =>
 									dom.tr(
 										!pr.Account && !pr.SenderDomainStr && !pr.RecipientDomainStr ?
@@ -3507,11 +3849,29 @@ const queueList = async () => {
 												dom.td(domainString(pr.SenderDomain)),
 												dom.td(domainString(pr.RecipientDomain)),
 											],
+										dom.td(pr.Reason),
 										dom.td(
 											dom.clickbutton('Remove', attr.title('Removing a hold rule does not modify the "on hold" status of messages in the queue.'), async function click(e: MouseEvent) {
 												await check(e.target! as HTMLButtonElement, client.QueueHoldRuleRemove(pr.ID))
 												window.location.reload() // todo: reload less
-											})
+											}),
+											!pr.Reason ? [] : [
+												' ',
+												dom.clickbutton('Release', attr.title('Remove the hold rule and take the messages in the queue matching it off hold, delivering them.'), async function click(e: MouseEvent) {
+													const n = await check(e.target! as HTMLButtonElement, client.QueueHoldRuleRelease(pr.ID))
+													window.alert(''+n+' message(s) released')
+													window.location.reload() // todo: reload less
+												}),
+												' ',
+												dom.clickbutton('Drop held messages', attr.title('Drop the messages on hold in the queue matching the hold rule. The hold rule is kept.'), async function click(e: MouseEvent) {
+													if (!window.confirm('Are you sure you want to drop the held messages?')) {
+														return
+													}
+													const n = await check(e.target! as HTMLButtonElement, client.QueueHoldRuleDeny(pr.ID))
+													window.alert(''+n+' message(s) dropped')
+													window.location.reload() // todo: reload less
+												}),
+											],
 										),
 									)
 								),
@@ -3519,6 +3879,7 @@ const queueList = async () => {
 									dom.td(holdRuleAccount=dom.input(attr.form('holdRuleForm'))),
 									dom.td(holdRuleSenderDomain=dom.input(attr.form('holdRuleForm'))),
 									dom.td(holdRuleRecipientDomain=dom.input(attr.form('holdRuleForm'))),
+									dom.td(),
 									dom.td(holdRuleSubmit=dom.submitbutton('Add hold rule', attr.form('holdRuleForm'), attr.title('When adding a new hold rule, existing messages in queue matching the new rule will be marked as on hold.'))),
 								),
 							),
@@ -4139,7 +4500,7 @@ const hooksList = async () => {
 					dom.td(''+h.FromID),
 					dom.td(''+h.MessageID),
 					dom.td(h.Account || '-'),
-					dom.td(h.IsIncoming ? "incoming" : h.OutgoingEvent),
+					dom.td(h.IsIncoming ? "incoming" : (h.AdminEvent || h.OutgoingEvent)),
 					dom.td(formatExtra(h.Extra)),
 					dom.td(''+h.Attempts),
 					dom.td(age(h.NextAttempt, true, nowSecs)),
@@ -4441,7 +4802,7 @@ const hooksRetiredList = async () => {
 					dom.td(''+h.FromID),
 					dom.td(''+h.MessageID),
 					dom.td(h.Account || '-'),
-					dom.td(h.IsIncoming ? "incoming" : h.OutgoingEvent),
+					dom.td(h.IsIncoming ? "incoming" : (h.AdminEvent || h.OutgoingEvent)),
 					dom.td(formatExtra(h.Extra)),
 					dom.td(''+h.Attempts),
 					dom.td(h.Results && h.Results.length > 0 ? h.Results[h.Results.length-1].Error : []),
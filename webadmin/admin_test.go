@@ -1,10 +1,12 @@
 package webadmin
 
 import (
+	"bufio"
 	"bytes"
 	"context"
 	"crypto/ed25519"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net"
@@ -14,14 +16,17 @@ import (
 	"path/filepath"
 	"reflect"
 	"runtime/debug"
+	"slices"
 	"strings"
 	"testing"
 	"time"
 
 	"golang.org/x/crypto/bcrypt"
 
+	"github.com/mjl-/bstore"
 	"github.com/mjl-/sherpa"
 
+	"github.com/mjl-/mox/admin"
 	"github.com/mjl-/mox/config"
 	"github.com/mjl-/mox/dns"
 	"github.com/mjl-/mox/mlog"
@@ -30,6 +35,7 @@ import (
 	"github.com/mjl-/mox/queue"
 	"github.com/mjl-/mox/store"
 	"github.com/mjl-/mox/webauth"
+	"github.com/mjl-/mox/webops"
 )
 
 var ctxbg = context.Background()
@@ -111,14 +117,14 @@ func TestAdminAuth(t *testing.T) {
 	ctx := context.WithValue(ctxbg, requestInfoCtxKey, reqInfo)
 
 	// Missing login token.
-	tneedErrorCode(t, "user:error", func() { api.Login(ctx, "", "moxtest123") })
+	tneedErrorCode(t, "user:error", func() { api.Login(ctx, "", "", "moxtest123") })
 
 	// Login with loginToken.
 	loginCookie := &http.Cookie{Name: "webadminlogin"}
 	loginCookie.Value = api.LoginPrep(ctx)
 	reqInfo.Request.Header = http.Header{"Cookie": []string{loginCookie.String()}}
 
-	csrfToken := api.Login(ctx, loginCookie.Value, "moxtest123")
+	csrfToken := api.Login(ctx, loginCookie.Value, "", "moxtest123")
 	var sessionCookie *http.Cookie
 	for _, c := range respRec.Result().Cookies() {
 		if c.Name == "webadminsession" {
@@ -133,7 +139,7 @@ func TestAdminAuth(t *testing.T) {
 	// Valid loginToken, but bad credentials.
 	loginCookie.Value = api.LoginPrep(ctx)
 	reqInfo.Request.Header = http.Header{"Cookie": []string{loginCookie.String()}}
-	tneedErrorCode(t, "user:loginFailed", func() { api.Login(ctx, loginCookie.Value, "badauth") })
+	tneedErrorCode(t, "user:loginFailed", func() { api.Login(ctx, loginCookie.Value, "", "badauth") })
 
 	type httpHeaders [][2]string
 	ctJSON := [2]string{"Content-Type", "application/json; charset=utf-8"}
@@ -210,6 +216,75 @@ func TestAdminAuth(t *testing.T) {
 	testHTTPAuthAPI("GET", "/api/Transports", http.StatusMethodNotAllowed, nil, nil)
 	testHTTPAuthAPI("POST", "/api/Transports", http.StatusOK, httpHeaders{ctJSON}, nil)
 
+	// Stream of changes needs a session, no csrf token.
+	testHTTP("GET", "/changes", httpHeaders{}, http.StatusForbidden, nil, nil)
+	testHTTP("GET", "/changes", httpHeaders{hdrSessionBad}, http.StatusForbidden, nil, nil)
+	testHTTP("POST", "/changes", httpHeaders{hdrSessionOK}, http.StatusMethodNotAllowed, nil, nil)
+	testHTTP("GET", "/changes?account=bogus", httpHeaders{hdrSessionOK}, http.StatusBadRequest, nil, nil)
+
+	// Change to an account is sent as event on the stream of changes.
+	func() {
+		defer store.Switchboard()()
+
+		hs := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			handle(apiHandler, false, w, r)
+		}))
+		defer hs.Close()
+
+		ctx, cancel := context.WithTimeout(ctxbg, 10*time.Second)
+		defer cancel()
+		req, err := http.NewRequestWithContext(ctx, "GET", hs.URL+"/changes", nil)
+		tcheck(t, err, "new request for changes")
+		req.Header.Add(hdrSessionOK[0], hdrSessionOK[1])
+		resp, err := http.DefaultClient.Do(req)
+		tcheck(t, err, "request changes")
+		defer resp.Body.Close()
+		tcompare(t, resp.StatusCode, http.StatusOK)
+		tcompare(t, resp.Header.Get("Content-Type"), "text/event-stream")
+		br := bufio.NewReader(resp.Body)
+		// First line is sent after registering for changes.
+		line, err := br.ReadString('\n')
+		tcheck(t, err, "reading from changes stream")
+		tcompare(t, line, ": keepalive\n")
+
+		acc, err := store.OpenAccount(pkglog, "mjl", false)
+		tcheck(t, err, "open account")
+		defer func() {
+			err := acc.Close()
+			pkglog.Check(err, "closing account")
+		}()
+		acc.WithWLock(func() {
+			var changes []store.Change
+			err := acc.DB.Write(ctxbg, func(tx *bstore.Tx) error {
+				var err error
+				changes, _, _, err = acc.MailboxCreate(tx, "changestest")
+				return err
+			})
+			tcheck(t, err, "create mailbox")
+			store.BroadcastChanges(acc, changes)
+		})
+
+		var event string
+		for {
+			line, err := br.ReadString('\n')
+			tcheck(t, err, "reading from changes stream")
+			line = strings.TrimSuffix(line, "\n")
+			if strings.HasPrefix(line, "event: ") {
+				event = strings.TrimPrefix(line, "event: ")
+			} else if data, ok := strings.CutPrefix(line, "data: "); ok {
+				tcompare(t, event, "change")
+				var ev webops.ChangeEvent
+				ev.Change = &store.ChangeAddMailbox{}
+				err := json.Unmarshal([]byte(data), &ev)
+				tcheck(t, err, "parsing change event")
+				tcompare(t, ev.Account, "mjl")
+				tcompare(t, ev.Type, "ChangeAddMailbox")
+				tcompare(t, ev.Change.(*store.ChangeAddMailbox).Mailbox.Name, "changestest")
+				break
+			}
+		}
+	}()
+
 	// Logout needs session token.
 	reqInfo.SessionToken = store.SessionToken(strings.SplitN(sessionCookie.Value, " ", 2)[0])
 	ctx = context.WithValue(ctxbg, requestInfoCtxKey, reqInfo)
@@ -218,6 +293,345 @@ func TestAdminAuth(t *testing.T) {
 	tneedErrorCode(t, "server:error", func() { api.Logout(ctx) })
 }
 
+func TestDomainAdmin(t *testing.T) {
+	os.RemoveAll("../testdata/webadmin/data")
+	mox.ConfigStaticPath = filepath.FromSlash("../testdata/webadmin/mox.conf")
+	mox.ConfigDynamicPath = filepath.Join(filepath.Dir(mox.ConfigStaticPath), "domains.conf")
+	mox.MustLoadConfig(true, false)
+	err := store.Init(ctxbg)
+	tcheck(t, err, "store init")
+	defer func() {
+		err := store.Close()
+		tcheck(t, err, "store close")
+	}()
+
+	err = admin.DomainAdminAdd(ctxbg, "reseller", []string{"mox.example"})
+	tcheck(t, err, "add domain admin")
+	defer func() {
+		err := admin.DomainAdminRemove(ctxbg, "reseller")
+		tcheck(t, err, "remove domain admin")
+	}()
+	err = admin.DomainAdminAdd(ctxbg, "other", []string{"other.example"})
+	tcheck(t, err, "add domain admin")
+	defer func() {
+		err := admin.DomainAdminRemove(ctxbg, "other")
+		tcheck(t, err, "remove domain admin")
+	}()
+	err = admin.DomainAdminSetPassword(ctxbg, "reseller", "moxtest123")
+	tcheck(t, err, "set domain admin password")
+
+	api := Admin{cookiePath: "/admin/"}
+
+	ctx := admin.WithDomainAdmin(ctxbg, "reseller")
+	name, domains := api.DomainAdminScope(ctx)
+	tcompare(t, name, "reseller")
+	tcompare(t, domains, []dns.Domain{{ASCII: "mox.example"}})
+	tcompare(t, len(api.Domains(ctx)), 1)
+	all, _ := api.Accounts(ctx)
+	tcompare(t, all, []string{"mjl"})
+	api.DomainConfig(ctx, "mox.example")
+	api.Account(ctx, "mjl")
+	tcompare(t, len(api.Transports(ctx)), 0)
+
+	// Login tokens.
+	tneedErrorCode(t, "user:error", func() { api.LoginTokenAdd(ctx, "mjl", "test", time.Now().Add(30*24*time.Hour)) })
+	api.LoginTokenAdd(ctx, "mjl", "test", time.Now().Add(time.Hour))
+	tokens := api.LoginTokens(ctx, "mjl")
+	tcompare(t, len(tokens), 1)
+	api.LoginTokenRemove(ctx, "mjl", tokens[0].ID)
+	tcompare(t, len(api.LoginTokens(ctx, "mjl")), 0)
+
+	// Domain admin for other domain cannot see or change mox.example.
+	ctx = admin.WithDomainAdmin(ctxbg, "other")
+	tcompare(t, len(api.Domains(ctx)), 0)
+	all, _ = api.Accounts(ctx)
+	tcompare(t, len(all), 0)
+	tneedErrorCode(t, "user:error", func() { api.DomainConfig(ctx, "mox.example") })
+	tneedErrorCode(t, "user:error", func() { api.Account(ctx, "mjl") })
+	tneedErrorCode(t, "user:error", func() { api.SetPassword(ctx, "mjl", "test1234") })
+	tneedErrorCode(t, "user:error", func() { api.LoginTokenAdd(ctx, "mjl", "test", time.Now().Add(time.Hour)) })
+	tneedErrorCode(t, "user:error", func() { api.AccountAdd(ctx, "other", "other@mox.example", "") })
+	tneedErrorCode(t, "user:error", func() { api.AddressAdd(ctx, "other@mox.example", "mjl") })
+	tneedErrorCode(t, "user:error", func() { api.AddressRemove(ctx, "mjl2@mox.example") })
+	tneedErrorCode(t, "user:error", func() { api.DomainDescriptionSave(ctx, "mox.example", "test") })
+	tneedErrorCode(t, "user:error", func() { api.DMARCSummaries(ctx, time.Now().Add(-time.Hour), time.Now(), "") })
+	tneedErrorCode(t, "user:error", func() { api.DMARCSpoofIncidents(ctx, time.Now().Add(-time.Hour), time.Now(), "") })
+
+	// Domain admins cannot make global changes.
+	err = admin.DomainAdminAdd(ctx, "another", []string{"other.example"})
+	if err == nil || !errors.Is(err, admin.ErrRequest) {
+		t.Fatalf("got err %v, expected ErrRequest", err)
+	}
+	err = admin.ConfigSave(ctx, func(config *config.Dynamic) {})
+	if err == nil || !errors.Is(err, admin.ErrRequest) {
+		t.Fatalf("got err %v, expected ErrRequest", err)
+	}
+
+	// Login as domain admin, and check only the allowed API functions can be called.
+	apiHandler, err := makeSherpaHandler(api.cookiePath, false)
+	tcheck(t, err, "sherpa handler")
+
+	respRec := httptest.NewRecorder()
+	reqInfo := requestInfo{"", respRec, &http.Request{RemoteAddr: "127.0.0.1:1234"}}
+	ctx = context.WithValue(ctxbg, requestInfoCtxKey, reqInfo)
+
+	loginCookie := &http.Cookie{Name: "webadminlogin"}
+	loginCookie.Value = api.LoginPrep(ctx)
+	reqInfo.Request.Header = http.Header{"Cookie": []string{loginCookie.String()}}
+	tneedErrorCode(t, "user:loginFailed", func() { api.Login(ctx, loginCookie.Value, "other", "moxtest123") })
+	loginCookie.Value = api.LoginPrep(ctx)
+	reqInfo.Request.Header = http.Header{"Cookie": []string{loginCookie.String()}}
+	csrfToken := api.Login(ctx, loginCookie.Value, "reseller", "moxtest123")
+	var sessionCookie *http.Cookie
+	for _, c := range respRec.Result().Cookies() {
+		if c.Name == "webadminsession" {
+			sessionCookie = c
+		}
+	}
+	if sessionCookie == nil {
+		t.Fatalf("missing session cookie")
+	}
+
+	testAPI := func(fn string, expErrCode string) {
+		t.Helper()
+		req := httptest.NewRequest("POST", "/api/"+fn, strings.NewReader(`{"params": []}`))
+		req.Header.Add("Cookie", (&http.Cookie{Name: "webadminsession", Value: sessionCookie.Value}).String())
+		req.Header.Add("x-mox-csrf", string(csrfToken))
+		req.Header.Add("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+		handle(apiHandler, false, rr, req)
+		var response struct {
+			Error *sherpa.Error `json:"error"`
+		}
+		err := json.NewDecoder(rr.Body).Decode(&response)
+		tcheck(t, err, "parsing response as json")
+		var code string
+		if response.Error != nil {
+			code = response.Error.Code
+		}
+		tcompare(t, code, expErrCode)
+	}
+	testAPI("Domains", "")
+	testAPI("QueueSize", "user:error")
+	testAPI("LogLevels", "user:error")
+}
+
+func TestAddresses(t *testing.T) {
+	os.RemoveAll("../testdata/webadmin/data")
+	mox.ConfigStaticPath = filepath.FromSlash("../testdata/webadmin/mox.conf")
+	mox.ConfigDynamicPath = filepath.Join(filepath.Dir(mox.ConfigStaticPath), "domains.conf")
+	mox.MustLoadConfig(true, false)
+	err := store.Init(ctxbg)
+	tcheck(t, err, "store init")
+	defer func() {
+		err := store.Close()
+		tcheck(t, err, "store close")
+	}()
+
+	api := Admin{}
+
+	api.AccountAdd(ctxbg, "other", "other@mox.example", "")
+	acc, err := store.OpenAccount(pkglog, "other", false)
+	tcheck(t, err, "open account")
+	err = acc.Close()
+	tcheck(t, err, "close account")
+	err = os.MkdirAll(mox.DataDirPath("tmp"), 0770)
+	tcheck(t, err, "mkdir tmp")
+	defer api.AccountRemove(ctxbg, "other")
+
+	l, total := api.AddressSearch(ctxbg, "", 0, 0)
+	tcompare(t, total, 3)
+	tcompare(t, l, []admin.AddressEntry{{Address: "mjl2@mox.example", Account: "mjl", Disabled: false}, {Address: "mjl@mox.example", Account: "mjl", Disabled: false}, {Address: "other@mox.example", Account: "other", Disabled: false}})
+	l, total = api.AddressSearch(ctxbg, "MJL", 1, 1)
+	tcompare(t, total, 2)
+	tcompare(t, l, []admin.AddressEntry{{Address: "mjl@mox.example", Account: "mjl", Disabled: false}})
+	l, total = api.AddressSearch(ctxbg, "mjl", 5, 1)
+	tcompare(t, total, 2)
+	tcompare(t, len(l), 0)
+	tneedErrorCode(t, "user:error", func() { api.AddressSearch(ctxbg, "", -1, 0) })
+
+	// Move address, and back.
+	api.AddressesMove(ctxbg, []string{"mjl2@mox.example"}, "other")
+	l, _ = api.AddressSearch(ctxbg, "mjl2", 0, 0)
+	tcompare(t, l, []admin.AddressEntry{{Address: "mjl2@mox.example", Account: "other", Disabled: false}})
+	tneedErrorCode(t, "user:error", func() { api.AddressesMove(ctxbg, []string{"mjl2@mox.example"}, "other") })                // Already in account.
+	tneedErrorCode(t, "user:error", func() { api.AddressesMove(ctxbg, []string{"bogus@mox.example"}, "mjl") })                 // Unknown address.
+	tneedErrorCode(t, "user:error", func() { api.AddressesMove(ctxbg, []string{"mjl2@mox.example"}, "bogus") })                // Unknown account.
+	tneedErrorCode(t, "user:error", func() { api.AddressesMove(ctxbg, []string{"mjl2@mox.example", "x@mox.example"}, "mjl") }) // All or nothing.
+	l, _ = api.AddressSearch(ctxbg, "mjl2", 0, 0)
+	tcompare(t, l, []admin.AddressEntry{{Address: "mjl2@mox.example", Account: "other", Disabled: false}})
+	api.AddressesMove(ctxbg, []string{"mjl2@mox.example"}, "mjl")
+
+	// Disabled addresses cannot be looked up.
+	api.AddressesDisabledSave(ctxbg, []string{"mjl2@mox.example", "other@mox.example"}, true)
+	l, _ = api.AddressSearch(ctxbg, "mjl2", 0, 0)
+	tcompare(t, l, []admin.AddressEntry{{Address: "mjl2@mox.example", Account: "mjl", Disabled: true}})
+	_, _, _, _, err = mox.LookupAddress("mjl2", dns.Domain{ASCII: "mox.example"}, false, false, false)
+	tcompare(t, err, mox.ErrAddressNotFound)
+	api.AddressesDisabledSave(ctxbg, []string{"mjl2@mox.example", "other@mox.example"}, false)
+	_, _, _, _, err = mox.LookupAddress("mjl2", dns.Domain{ASCII: "mox.example"}, false, false, false)
+	tcheck(t, err, "lookup address")
+	tneedErrorCode(t, "user:error", func() { api.AddressesDisabledSave(ctxbg, []string{"bogus@mox.example"}, true) })
+
+	// Domain admins only see addresses in their domains.
+	err = admin.DomainAdminAdd(ctxbg, "other", []string{"other.example"})
+	tcheck(t, err, "add domain admin")
+	defer admin.DomainAdminRemove(ctxbg, "other")
+	ctx := admin.WithDomainAdmin(ctxbg, "other")
+	l, total = api.AddressSearch(ctx, "", 0, 0)
+	tcompare(t, total, 0)
+	tcompare(t, len(l), 0)
+	tneedErrorCode(t, "user:error", func() { api.AddressesMove(ctx, []string{"mjl2@mox.example"}, "other") })
+	tneedErrorCode(t, "user:error", func() { api.AddressesDisabledSave(ctx, []string{"mjl2@mox.example"}, true) })
+}
+
+func TestConfigPreview(t *testing.T) {
+	os.RemoveAll("../testdata/webadmin/data")
+	mox.ConfigStaticPath = filepath.FromSlash("../testdata/webadmin/mox.conf")
+	mox.ConfigDynamicPath = filepath.Join(filepath.Dir(mox.ConfigStaticPath), "domains.conf")
+	mox.MustLoadConfig(true, false)
+	err := store.Init(ctxbg)
+	tcheck(t, err, "store init")
+	defer func() {
+		err := store.Close()
+		tcheck(t, err, "store close")
+	}()
+
+	api := Admin{}
+
+	origConf, err := os.ReadFile(mox.ConfigDynamicPath)
+	tcheck(t, err, "read domains.conf")
+	checkUnchanged := func() {
+		t.Helper()
+		buf, err := os.ReadFile(mox.ConfigDynamicPath)
+		tcheck(t, err, "read domains.conf")
+		tcompare(t, string(buf), string(origConf))
+	}
+
+	p := api.DomainAddPreview(ctxbg, false, "new.example", "new", "user")
+	tcompare(t, p.Accounts, []string{"new"})
+	tcompare(t, p.Addresses, []string{"dmarc-reports@new.example", "tls-reports@new.example", "user@new.example"})
+	if !strings.Contains(p.Diff, "\n+\tnew.example:\n") || !strings.Contains(p.Diff, "\n+\tnew:\n") {
+		t.Fatalf("diff does not add domain and account:\n%s", p.Diff)
+	}
+	checkUnchanged()
+	if _, ok := mox.Conf.Dynamic.Domains["new.example"]; ok {
+		t.Fatalf("domain added by preview")
+	}
+	if _, ok := mox.Conf.Dynamic.Accounts["new"]; ok {
+		t.Fatalf("account added by preview")
+	}
+	tneedErrorCode(t, "user:error", func() { api.DomainAddPreview(ctxbg, false, "mox.example", "mjl", "") }) // Already present.
+
+	p = api.AddressRemovePreview(ctxbg, "mjl2@mox.example")
+	tcompare(t, p, mox.ConfigPreview{
+		Diff:      "--- domains.conf\n+++ domains.conf\n@@ -4,5 +4,4 @@\n \tmjl:\n \t\tDomain: mox.example\n \t\tDestinations:\n-\t\t\tmjl2@mox.example: nil\n \t\t\tmjl@mox.example: nil\n",
+		Accounts:  []string{"mjl"},
+		Addresses: []string{"mjl2@mox.example"},
+	})
+	checkUnchanged()
+	tneedErrorCode(t, "user:error", func() { api.AddressRemovePreview(ctxbg, "bogus@mox.example") })
+
+	rulesets := []config.Ruleset{{MsgFromRegexp: "^list@", Mailbox: "Lists"}}
+	p = api.DestinationRulesetsSavePreview(ctxbg, "mjl", "mjl2@mox.example", rulesets)
+	tcompare(t, p.Accounts, []string{"mjl"})
+	tcompare(t, p.Addresses, []string{"mjl2@mox.example"})
+	checkUnchanged()
+	tneedErrorCode(t, "user:error", func() {
+		api.DestinationRulesetsSavePreview(ctxbg, "mjl", "mjl2@mox.example", []config.Ruleset{{MsgFromRegexp: "(", Mailbox: "Lists"}})
+	})
+	tneedErrorCode(t, "user:error", func() { api.DestinationRulesetsSavePreview(ctxbg, "mjl", "bogus@mox.example", rulesets) })
+
+	api.DestinationRulesetsSave(ctxbg, "mjl", "mjl2@mox.example", rulesets)
+	tcompare(t, mox.Conf.Dynamic.Accounts["mjl"].Destinations["mjl2@mox.example"].Rulesets[0].Mailbox, "Lists")
+	api.DestinationRulesetsSave(ctxbg, "mjl", "mjl2@mox.example", nil)
+	checkUnchanged()
+}
+
+func TestAdminToken(t *testing.T) {
+	os.RemoveAll("../testdata/webadmin/data")
+	mox.ConfigStaticPath = filepath.FromSlash("../testdata/webadmin/mox.conf")
+	mox.ConfigDynamicPath = filepath.Join(filepath.Dir(mox.ConfigStaticPath), "domains.conf")
+	mox.MustLoadConfig(true, false)
+	err := store.Init(ctxbg)
+	tcheck(t, err, "store init")
+	defer func() {
+		err := store.Close()
+		tcheck(t, err, "store close")
+	}()
+
+	err = admin.DomainAdminAdd(ctxbg, "reseller", []string{"mox.example"})
+	tcheck(t, err, "add domain admin")
+	defer func() {
+		err := admin.DomainAdminRemove(ctxbg, "reseller")
+		tcheck(t, err, "remove domain admin")
+	}()
+
+	fullToken, err := admin.AdminTokenAdd(ctxbg, "full", nil, "")
+	tcheck(t, err, "add admin token")
+	defer func() {
+		err := admin.AdminTokenRemove(ctxbg, "full")
+		tcheck(t, err, "remove admin token")
+	}()
+	loglevelsToken, err := admin.AdminTokenAdd(ctxbg, "loglevels", []string{"LogLevels"}, "")
+	tcheck(t, err, "add admin token")
+	defer func() {
+		err := admin.AdminTokenRemove(ctxbg, "loglevels")
+		tcheck(t, err, "remove admin token")
+	}()
+	resellerToken, err := admin.AdminTokenAdd(ctxbg, "reseller", nil, "reseller")
+	tcheck(t, err, "add admin token")
+	defer func() {
+		err := admin.AdminTokenRemove(ctxbg, "reseller")
+		tcheck(t, err, "remove admin token")
+	}()
+
+	_, err = admin.AdminTokenAdd(ctxbg, "full", nil, "")
+	if err == nil || !errors.Is(err, admin.ErrRequest) {
+		t.Fatalf("got err %v, expected ErrRequest for duplicate token", err)
+	}
+	_, err = admin.AdminTokenAdd(ctxbg, "bogus", nil, "bogus")
+	if err == nil {
+		t.Fatalf("adding token for unknown domain admin succeeded")
+	}
+	_, err = admin.AdminTokenAdd(admin.WithDomainAdmin(ctxbg, "reseller"), "another", nil, "")
+	if err == nil || !errors.Is(err, admin.ErrRequest) {
+		t.Fatalf("got err %v, expected ErrRequest for domain admin", err)
+	}
+
+	api := Admin{cookiePath: "/admin/"}
+	apiHandler, err := makeSherpaHandler(api.cookiePath, false)
+	tcheck(t, err, "sherpa handler")
+
+	// No session or csrf token needed with a token.
+	testAPI := func(token, fn string, expErrCode string) {
+		t.Helper()
+		req := httptest.NewRequest("POST", "/api/"+fn, strings.NewReader(`{"params": []}`))
+		req.Header.Add("Authorization", "Bearer "+token)
+		req.Header.Add("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+		handle(apiHandler, false, rr, req)
+		var response struct {
+			Error *sherpa.Error `json:"error"`
+		}
+		err := json.NewDecoder(rr.Body).Decode(&response)
+		tcheck(t, err, "parsing response as json")
+		var code string
+		if response.Error != nil {
+			code = response.Error.Code
+		}
+		tcompare(t, code, expErrCode)
+	}
+	testAPI(fullToken, "Domains", "")
+	testAPI(fullToken, "LogLevels", "")
+	testAPI(fullToken, "Logout", "user:error")
+	testAPI(loglevelsToken, "LogLevels", "")
+	testAPI(loglevelsToken, "Domains", "user:error")
+	testAPI(resellerToken, "Domains", "")
+	testAPI(resellerToken, "LogLevels", "user:error")
+	testAPI("moxadmin-bogus", "Domains", "user:badAuth")
+}
+
 func TestAdmin(t *testing.T) {
 	os.RemoveAll("../testdata/webadmin/data")
 	defer os.RemoveAll("../testdata/webadmin/dkim")
@@ -307,6 +721,26 @@ func TestAdmin(t *testing.T) {
 	})
 	api.DomainMTASTSSave(ctxbg, "mox.example", "", mtasts.ModeNone, 0, nil) // Restore.
 
+	wk := config.WellKnown{
+		SecurityTXT: &config.SecurityTXT{
+			Contact: []string{"mailto:security@mox.example"},
+			Expires: "2030-01-01T00:00:00Z",
+		},
+		ChangePasswordURL: "https://mail.mox.example/",
+	}
+	api.DomainWellKnownSave(ctxbg, "mox.example", wk)
+	tneedErrorCode(t, "user:error", func() { api.DomainWellKnownSave(ctxbg, "bogus.example", wk) })
+	tneedErrorCode(t, "user:error", func() {
+		api.DomainWellKnownSave(ctxbg, "mox.example", config.WellKnown{SecurityTXT: &config.SecurityTXT{Contact: []string{"mailto:security@mox.example"}, Expires: "bogus"}})
+	})
+	tneedErrorCode(t, "user:error", func() {
+		api.DomainWellKnownSave(ctxbg, "mox.example", config.WellKnown{SecurityTXT: &config.SecurityTXT{Expires: "2030-01-01T00:00:00Z"}})
+	})
+	tneedErrorCode(t, "user:error", func() {
+		api.DomainWellKnownSave(ctxbg, "mox.example", config.WellKnown{ChangePasswordURL: "/relative"})
+	})
+	api.DomainWellKnownSave(ctxbg, "mox.example", config.WellKnown{}) // Restore.
+
 	api.DomainDKIMAdd(ctxbg, "mox.example", "testsel", "ed25519", "sha256", true, true, true, nil, 24*time.Hour)
 	tneedErrorCode(t, "user:error", func() {
 		api.DomainDKIMAdd(ctxbg, "mox.example", "testsel", "ed25519", "sha256", true, true, true, nil, 24*time.Hour)
@@ -347,11 +781,14 @@ func TestAdmin(t *testing.T) {
 	api.AliasAddressesAdd(ctxbg, "support", "mox.example", []string{"mjl2@mox.example"})
 	tneedErrorCode(t, "user:error", func() { api.AliasAddressesAdd(ctxbg, "support", "mox.example", []string{"mjl2@mox.example"}) })    // Already present.
 	tneedErrorCode(t, "user:error", func() { api.AliasAddressesAdd(ctxbg, "support", "mox.example", []string{"bogus@mox.example"}) })   // Unknown dest localpart.
-	tneedErrorCode(t, "user:error", func() { api.AliasAddressesAdd(ctxbg, "support", "mox.example", []string{"bogus@bogus.example"}) }) // Unknown dest domain.
 	tneedErrorCode(t, "user:error", func() { api.AliasAddressesAdd(ctxbg, "support2", "mox.example", []string{"mjl@mox.example"}) })    // Unknown alias localpart.
 	tneedErrorCode(t, "user:error", func() { api.AliasAddressesAdd(ctxbg, "support", "bogus.example", []string{"mjl@mox.example"}) })   // Unknown alias localpart.
 	tneedErrorCode(t, "user:error", func() { api.AliasAddressesAdd(ctxbg, "support", "mox.example", []string{"support@mox.example"}) }) // Alias cannot be destination.
 
+	// Addresses in domains not configured are remote members.
+	api.AliasAddressesAdd(ctxbg, "support", "mox.example", []string{"remote@remote.example"})
+	api.AliasAddressesRemove(ctxbg, "support", "mox.example", []string{"remote@remote.example"})
+
 	tneedErrorCode(t, "user:error", func() { api.AliasAddressesRemove(ctxbg, "support", "mox.example", []string{}) })                      // Need at least 1 address.
 	tneedErrorCode(t, "user:error", func() { api.AliasAddressesRemove(ctxbg, "support", "mox.example", []string{"bogus@mox.example"}) })   // Not a member.
 	tneedErrorCode(t, "user:error", func() { api.AliasAddressesRemove(ctxbg, "support", "mox.example", []string{"bogus@bogus.example"}) }) // Not member, unknown domain.
@@ -436,6 +873,22 @@ func TestCheckDomain(t *testing.T) {
 	checkDomain(ctxbg, resolver, dialer, "mox.example")
 	// todo: check returned data
 
+	// If the suggested SPF record would need too many DNS lookups, the error is shown
+	// instead of a suggested record.
+	var spfConf config.SPF
+	for i := range 10 {
+		spfConf.ParsedIncludes = append(spfConf.ParsedIncludes, dns.Domain{ASCII: fmt.Sprintf("spf%d.example", i)})
+	}
+	domain.SPF = &spfConf
+	mox.Conf.Dynamic.Domains["mox.example"] = domain
+	r := checkDomain(ctxbg, resolver, dialer, "mox.example")
+	if !slices.ContainsFunc(r.SPF.Errors, func(s string) bool { return strings.Contains(s, "more than maximum 10") }) {
+		t.Fatalf("missing error about spf lookup limit, got errors %v", r.SPF.Errors)
+	}
+	if len(r.SPF.Instructions) != 1 || !strings.Contains(r.SPF.Instructions[0], "No SPF record for the domain can be suggested") {
+		t.Fatalf("expected instructions without spf record for domain, got %v", r.SPF.Instructions)
+	}
+
 	Admin{}.Domains(ctxbg)             // todo: check results
 	dnsblsStatus(ctxbg, log, resolver) // todo: check results
 }
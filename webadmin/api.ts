@@ -274,9 +274,15 @@ export interface ConfigDomain {
 	DKIM: DKIM
 	DMARC?: DMARC | null
 	MTASTS?: MTASTS | null
+	WKD?: WKD | null
+	WellKnown?: WellKnown | null
 	TLSRPT?: TLSRPT | null
+	SPF?: SPF | null
 	Routes?: Route[] | null
 	Aliases?: { [key: string]: Alias }
+	InboundHeaders?: InboundHeaders | null
+	LookalikeSenders: string
+	SpoofingSurges: string
 	Domain: Domain
 }
 
@@ -294,6 +300,7 @@ export interface Selector {
 	DontSealHeaders: boolean
 	Expiration: string
 	PrivateKeyFile: string
+	Retiring: boolean
 	Algorithm: string  // "ed25519", "rsa-*", based on private key.
 }
 
@@ -307,6 +314,7 @@ export interface DMARC {
 	Domain: string
 	Account: string
 	Mailbox: string
+	Policy: string
 	ParsedLocalpart: Localpart
 	DNSDomain: Domain  // Effective domain, always set based on Domain field or Domain where this is configured.
 }
@@ -316,6 +324,29 @@ export interface MTASTS {
 	Mode: Mode
 	MaxAge: number
 	MX?: string[] | null
+	MaxAgeRampDays: number
+}
+
+export interface WKD {
+	Accounts?: string[] | null
+}
+
+export interface WellKnown {
+	SecurityTXT?: SecurityTXT | null
+	ChangePasswordURL: string
+}
+
+// SecurityTXT holds the fields of a security.txt file, RFC 9116. Fields are
+// written in the order below, each value on its own line.
+export interface SecurityTXT {
+	Contact?: string[] | null
+	Expires: string
+	Encryption?: string[] | null
+	Acknowledgments?: string[] | null
+	PreferredLanguages?: string[] | null
+	Canonical?: string[] | null
+	Policy?: string[] | null
+	Hiring?: string[] | null
 }
 
 export interface TLSRPT {
@@ -327,11 +358,19 @@ export interface TLSRPT {
 	DNSDomain: Domain  // Effective domain, always set based on Domain field or Domain where this is configured.
 }
 
+export interface SPF {
+	Includes?: string[] | null
+	IPs?: string[] | null
+	All: string
+}
+
 export interface Route {
 	FromDomain?: string[] | null
 	ToDomain?: string[] | null
 	MinimumAttempts: number
 	Transport: string
+	Failover?: string[] | null
+	FailoverErrors?: string[] | null
 	FromDomainASCII?: string[] | null
 	ToDomainASCII?: string[] | null
 }
@@ -341,9 +380,11 @@ export interface Alias {
 	PostPublic: boolean
 	ListMembers: boolean
 	AllowMsgFrom: boolean
+	ListUnsubscribe: boolean
 	LocalpartStr: string  // In encoded form.
 	Domain: Domain
-	ParsedAddresses?: AliasAddress[] | null  // Matches addresses.
+	ParsedAddresses?: AliasAddress[] | null  // Local addresses, matching accounts.
+	RemoteAddresses?: Address[] | null  // Addresses in domains not configured on this server.
 }
 
 export interface AliasAddress {
@@ -364,22 +405,47 @@ export interface Destination {
 	SMTPError: string
 	MessageAuthRequiredSMTPError: string
 	FullName: string
+	Disabled: boolean
+	DuplicateWindow?: DuplicateWindow | null
+	Forward?: Forward | null
 }
 
 export interface Ruleset {
 	SMTPMailFromRegexp: string
 	MsgFromRegexp: string
+	MsgToRegexp: string
 	VerifiedDomain: string
 	HeadersRegexp?: { [key: string]: string }
 	IsForward: boolean  // todo: once we implement ARC, we can use dkim domains that we cannot verify but that the arc-verified forwarding mail server was able to verify.
 	ListAllowDomain: string
 	AcceptRejectsToMailbox: string
 	Mailbox: string
+	Seen: boolean
+	Keywords?: string[] | null
+	ForwardTo?: string[] | null
+	Discard: boolean
 	Comment: string
 	VerifiedDNSDomain: Domain
 	ListAllowDNSDomain: Domain
 }
 
+export interface DuplicateWindow {
+	Period: number
+	Suppress: boolean
+}
+
+export interface Forward {
+	To?: string[] | null
+	KeepCopy: boolean
+	Disabled: boolean
+}
+
+export interface InboundHeaders {
+	SubjectPrefix: string
+	Headers?: { [key: string]: string }
+	InternalDomains?: string[] | null
+}
+
 export interface Account {
 	OutgoingWebhook?: OutgoingWebhook | null
 	IncomingWebhook?: IncomingWebhook | null
@@ -387,12 +453,18 @@ export interface Account {
 	KeepRetiredMessagePeriod: number
 	KeepRetiredWebhookPeriod: number
 	LoginDisabled: string
+	Suspended: string
+	SuspendedReject: boolean
+	LoginNetworks?: string[] | null
 	Domain: string
 	Description: string
 	FullName: string
+	Template: string
 	Destinations?: { [key: string]: Destination }
 	SubjectPass: SubjectPass
 	QuotaMessageSize: number
+	MaxAppendSize: number
+	MaxIMAPConnections: number
 	RejectsMailbox: string
 	KeepRejects: boolean
 	AutomaticJunkFlags: AutomaticJunkFlags
@@ -400,6 +472,13 @@ export interface Account {
 	MaxOutgoingMessagesPerDay: number
 	MaxFirstTimeRecipientsPerDay: number
 	NoFirstTimeSenderDelay: boolean
+	DuplicateWindow?: DuplicateWindow | null
+	AutoArchive?: AutoArchive | null
+	ArchiveTier?: ArchiveTier | null
+	MessageCompression?: MessageCompression | null
+	MessageEncryption?: MessageEncryption | null
+	SubmissionChecks?: SubmissionChecks | null
+	TLSClientAuth?: TLSClientAuth[] | null
 	NoCustomPassword: boolean
 	Routes?: Route[] | null
 	DNSDomain: Domain  // Parsed form of Domain.
@@ -439,6 +518,45 @@ export interface JunkFilter {
 	RareWords: number
 }
 
+export interface AutoArchive {
+	Age: number
+	Mailboxes?: string[] | null
+	Mailbox: string
+	SkipUnread: boolean
+	SkipFlagged: boolean
+}
+
+export interface ArchiveTier {
+	Age: number
+	MaxMessageSize: number
+}
+
+export interface MessageCompression {
+	Disabled: boolean
+	MinMessageSize: number
+	MaxMessageSize: number
+}
+
+export interface MessageEncryption {
+	KeyWrap: string
+}
+
+export interface SubmissionChecks {
+	RequireTo: boolean
+	RequireSubject: boolean
+	MaxRecipients: number
+	ConfirmRecipients: number
+}
+
+// TLSClientAuth maps a TLS client certificate to an account. Exactly one of
+// Fingerprint and Subject must be set.
+export interface TLSClientAuth {
+	Fingerprint: string
+	Subject: string
+	LoginAddress: string
+	NoIMAPPreauth: boolean
+}
+
 export interface AddressAlias {
 	SubscriptionAddress: string
 	Alias: Alias  // Without members.
@@ -623,11 +741,96 @@ export interface DMARCSummary {
 	PolicyOverrides?: { [key: string]: number }
 }
 
+// Advice is a recommendation for the DMARC policy of one of our domains, based on
+// incoming DMARC aggregate reports.
+export interface Advice {
+	Domain: string
+	Start: Date  // Period covered by the analyzed reports.
+	End: Date
+	Reports: number
+	Messages: number
+	Unaligned: number  // Messages without aligned DKIM pass and without aligned SPF pass.
+	UnalignedSources?: AdviceSource[] | null  // Sources of unaligned messages, most messages first.
+	PublishedPolicy: string  // Policy and percentage as published in the most recent report, and the recommended policy. The recommended policy is empty when there is not enough information for a recommendation.
+	PublishedPercentage: number
+	RecommendedPolicy: string
+	Recommendation: string  // Human-readable recommendation.
+}
+
+// AdviceSource is an IP that sent messages that were not aligned.
+export interface AdviceSource {
+	IP: string
+	Messages: number
+}
+
+// SpoofIncident is a period with a surge of incoming messages that claim to be
+// from one of our domains in the message From header, but fail DMARC. Typically a
+// spoofing campaign.
+export interface SpoofIncident {
+	ID: number
+	Domain: string  // Unicode.
+	Start: Date  // First and most recent detection of the surge. The incident ends a day after the most recent detection.
+	End: Date
+	Messages: number  // Messages failing DMARC during the incident, including those in the hour before the start.
+	Baseline: number  // Average failures per hour in the day before the incident.
+	Protected: boolean  // Whether a stricter junk filter threshold was used for failing messages during the incident.
+	Sources?: AdviceSource[] | null  // Sources of failing messages during the incident, most messages first.
+}
+
 // Reverse is the result of a reverse lookup.
 export interface Reverse {
 	Hostnames?: string[] | null
 }
 
+// ConfigPreview describes the changes a new dynamic config would make, as
+// determined by a dry run.
+export interface ConfigPreview {
+	Diff: string  // Unified diff of domains.conf, both old and new as written by mox.
+	Accounts?: string[] | null  // Accounts added, removed or with changed configuration.
+	Addresses?: string[] | null  // Addresses and aliases added, removed, or with changed destination or members.
+}
+
+// AddressEntry is an address configured for an account, as returned by
+// AddressSearch.
+export interface AddressEntry {
+	Address: string  // Email address, or catchall address of the form "@<domain>".
+	Account: string
+	Disabled: boolean
+}
+
+// LoginToken is a short-lived password for an account, minted by the admin for
+// external applications such as webmail software (e.g. Roundcube) that
+// authenticate users over IMAP and SMTP without storing their passwords. Tokens
+// are accepted by the PLAIN and LOGIN authentication mechanisms, not by
+// CRAM-MD5/SCRAM, which require the password.
+export interface LoginToken {
+	ID: number
+	Created: Date
+	Expires: Date
+	Description: string  // E.g. the application the token was minted for.
+	LastUsed: Date  // Updated with a delay, zero if never used.
+}
+
+// ImportJob holds the progress of importing messages from an mbox, maildir or
+// other file-based source into an account, for reporting and for continuing an
+// interrupted import. An import commits its messages in batches. When an import
+// of the same source into the same mailbox is started while a job is unfinished,
+// the messages already done are skipped.
+export interface ImportJob {
+	ID: number
+	Kind: string  // "mbox", "maildir", "pst", "dbox", "mh" or "babyl", or an mbox dialect like "mboxrd".
+	Source: string  // Path of file or directory, as given to the import command.
+	Mailbox: string  // Destination mailbox, or prefix for sources with multiple mailboxes.
+	Total: number  // Number of messages in the source, counted before importing.
+	Done: number  // Number of messages read from the source and committed, imported or skipped.
+	Imported: number  // Number of messages delivered.
+	Skipped: number  // Number of duplicate messages skipped.
+	Position: string  // Of the last committed message in the source, e.g. "<file>:<line>" for mbox.
+	Started: Date
+	Updated: Date
+	Finished: Date  // Zero while the import is running or interrupted.
+}
+
 // ClientConfigs holds the client configuration for IMAP/Submission for a
 // domain.
 export interface ClientConfigs {
@@ -652,6 +855,7 @@ export interface HoldRule {
 	RecipientDomain: Domain
 	SenderDomainStr: string  // Unicode.
 	RecipientDomainStr: string  // Unicode.
+	Reason: string  // For hold rules added automatically for an account that appears to be compromised, the heuristic that was tripped. See HoldAccount.
 }
 
 // Filter filters messages to list or operate on. Used by admin web interface
@@ -687,7 +891,7 @@ export interface Msg {
 	BaseID: number  // A message for multiple recipients will get a BaseID that is identical to the first Msg.ID queued. The message contents will be identical for each recipient, including MsgPrefix. If other properties are identical too, including recipient domain, multiple Msgs may be delivered in a single SMTP transaction. For messages with a single recipient, this field will be 0.
 	Queued: Date
 	Hold: boolean  // If set, delivery won't be attempted.
-	SenderAccount: string  // Failures are delivered back to this local account. Also used for routing.
+	SenderAccount: string  // Failures are delivered back to this local account, unless Relayed. Also used for routing.
 	SenderLocalpart: Localpart  // Should be a local user and domain.
 	SenderDomain: IPDomain
 	SenderDomainStr: string  // For filtering, unicode.
@@ -711,8 +915,14 @@ export interface Msg {
 	Subject: string  // For context about delivery.
 	DSNUTF8?: string | null  // If set, this message is a DSN and this is a version using utf-8, for the case the remote MTA supports smtputf8. In this case, Size and MsgPrefix are not relevant.
 	Transport: string  // If non-empty, the transport to use for this message. Can be set through cli or admin interface. If empty (the default for a submitted message), regular routing rules apply.
+	FailoverIndex: number  // Position in the failover chain of the matching route for the next delivery attempt: Zero for the Transport of the route, 1 for the first of its Failover transports, etc. Only used if Transport is empty.
 	RequireTLS?: boolean | null  // RequireTLS influences TLS verification during delivery.  If nil, the recipient domain policy is followed (MTA-STS and/or DANE), falling back to optional opportunistic non-verified STARTTLS.  If RequireTLS is true (through SMTP REQUIRETLS extension or webmail submit), MTA-STS or DANE is required, as well as REQUIRETLS support by the next hop server.  If RequireTLS is false (through messag header "TLS-Required: No"), the recipient domain's policy is ignored if it does not lead to a successful TLS connection, i.e. falling back to SMTP delivery with unverified STARTTLS or plain text.
 	FutureReleaseRequest: string  // For DSNs, where the original FUTURERELEASE value must be included as per-message field. This field should be of the form "for;" plus interval, or "until;" plus utc date-time.
+	DSNNotify?: string[] | null  // Parameters of the SMTP DSN extension, as given during submission. They determine for which events DSNs are sent and what they contain, and are passed on to the next hop if it supports the DSN extension. ../rfc/3461; Empty for the default of failures and delays, otherwise "NEVER", or any of "SUCCESS", "FAILURE" and "DELAY".
+	DSNORCPT: string  // Original recipient, with address type, e.g. "rfc822;user@example.org".
+	DSNRet: string  // "FULL" or "HDRS", or empty for the default of only headers.
+	DSNEnvID: string  // Envelope identifier.
+	Relayed: boolean  // If set, the message was not submitted by a local user, but is relayed for a remote sender, e.g. a forwarded message. DSNs are not delivered to the SenderAccount, but queued for delivery to the sender address (or the original sender of an SRS-rewritten address), with a null reverse path.
 	Extra?: { [key: string]: string }  // Extra information, for transactional email.
 }
 
@@ -792,6 +1002,36 @@ export interface MsgRetired {
 	KeepUntil: Date
 }
 
+// EventFilter selects events to list. Zero fields are ignored.
+export interface EventFilter {
+	Max: number  // Maximum number of events to return. Default 1000.
+	Start: Date
+	End: Date
+	Kinds?: Kind[] | null
+	MessageID: string  // Message-ID, with or without <>.
+	QueueMsgID: number
+	Account: string
+	Address: string  // Matches sender or recipient address.
+}
+
+// Event is a single event in the lifecycle of a message.
+export interface Event {
+	ID: number
+	Time: Date
+	Kind: Kind
+	MessageID: string  // Canonical Message-ID, lower-case, without <>. Can be empty. For tracing a message across incoming and outgoing deliveries.
+	QueueMsgID: number  // For outgoing messages, the ID of the message in the queue. Zero for incoming messages.
+	Account: string  // Account the message was delivered to (for incoming messages), or sent from (for outgoing messages).
+	Mailbox: string  // Mailbox for KindDelivered.
+	Sender: string  // SMTP MAIL FROM address.
+	Recipient: string  // SMTP RCPT TO address.
+	RemoteIP: string  // For incoming messages.
+	Success: boolean  // For KindJunkVerdict, whether the message was accepted.
+	Code: number  // SMTP response code, for outgoing messages.
+	Secode: string  // Enhanced status code, for outgoing messages.
+	Detail: string  // E.g. junk verdict reason, or error message.
+}
+
 // HookFilter filters messages to list or operate on. Used by admin web interface
 // and cli.
 // 
@@ -803,7 +1043,7 @@ export interface HookFilter {
 	Account: string
 	Submitted: string  // Whether submitted before/after a time relative to now. ">$duration" or "<$duration", also with "now" for duration.
 	NextAttempt: string  // ">$duration" or "<$duration", also with "now" for duration.
-	Event: string  // Including "incoming".
+	Event: string  // Including "incoming" and admin events.
 }
 
 export interface HookSort {
@@ -821,11 +1061,13 @@ export interface Hook {
 	MessageID: string  // Of outgoing or incoming messages. Includes <>.
 	Subject: string  // Subject of original outgoing message, or of incoming message.
 	Extra?: { [key: string]: string }  // From submitted message.
-	Account: string
+	Account: string  // Empty for admin events.
 	URL: string  // Taken from config when webhook is scheduled.
 	Authorization: string  // Optional value for authorization header to include in HTTP request.
+	Signature: string  // Optional value for X-Mox-Webhook-Signature header, an HMAC of the payload.
 	IsIncoming: boolean
 	OutgoingEvent: string  // Empty string if not outgoing.
+	AdminEvent: string  // Empty string if not an admin event.
 	Payload: string  // JSON data to be submitted.
 	Submitted: Date
 	Attempts: number
@@ -855,7 +1097,7 @@ export interface HookRetiredFilter {
 	Account: string
 	Submitted: string  // Whether submitted before/after a time relative to now. ">$duration" or "<$duration", also with "now" for duration.
 	LastActivity: string  // ">$duration" or "<$duration", also with "now" for duration.
-	Event: string  // Including "incoming".
+	Event: string  // Including "incoming" and admin events.
 }
 
 export interface HookRetiredSort {
@@ -874,11 +1116,12 @@ export interface HookRetired {
 	MessageID: string  // Of outgoing or incoming messages. Includes <>.
 	Subject: string  // Subject of original outgoing message, or of incoming message.
 	Extra?: { [key: string]: string }  // From submitted message.
-	Account: string
+	Account: string  // Empty for admin events.
 	URL: string  // Taken from config at start of each attempt.
 	Authorization: boolean  // Whether request had authorization without keeping it around.
 	IsIncoming: boolean
 	OutgoingEvent: string
+	AdminEvent: string
 	Payload: string  // JSON data submitted.
 	Submitted: Date
 	SupersededByID: number  // If not 0, a Hook.ID that superseded this one and Done will be true.
@@ -1054,9 +1297,43 @@ export interface Dynamic {
 	WebHandlers?: WebHandler[] | null
 	Routes?: Route[] | null
 	MonitorDNSBLs?: string[] | null
+	DomainAdmins?: { [key: string]: DomainAdmin }
+	AdminTokens?: { [key: string]: AdminToken }
+	AdminWebhook?: AdminWebhook | null
+	IMAPClientRules?: IMAPClientRule[] | null
 	MonitorDNSBLZones?: Domain[] | null
 }
 
+// DomainAdmin is an admin with access to only a subset of the domains.
+export interface DomainAdmin {
+	Domains?: string[] | null
+	PasswordHash: string
+}
+
+// AdminToken is an API token for the admin web API, with optional restrictions.
+export interface AdminToken {
+	TokenHash: string
+	Functions?: string[] | null
+	DomainAdmin: string
+}
+
+// AdminWebhook is a webhook for admin events.
+export interface AdminWebhook {
+	URL: string
+	Authorization: string
+	Secret: string
+	Events?: string[] | null
+}
+
+// IMAPClientRule allows or denies IMAP clients based on the parameters of their
+// IMAP ID command.
+export interface IMAPClientRule {
+	ParamsRegexp?: { [key: string]: string }
+	Accounts?: string[] | null
+	Action: string
+	Message: string
+}
+
 // TLSPublicKey is a public key for use with TLS client authentication based on the
 // public key of the certificate.
 export interface TLSPublicKey {
@@ -1092,6 +1369,108 @@ export interface LoginAttempt {
 	Result: AuthResult
 }
 
+// AuthLockout tracks consecutive failed authentication attempts from a remote IP
+// (for IPv6, its /64 network) or for an account, across all protocols. Once the
+// number of failures reaches a threshold, authentication is refused until a
+// lockout period has passed. Each further failure doubles the period, up to a
+// maximum. A successful authentication removes the records for the IP and
+// account. Attempts refused due to a lockout are not counted as failures, so a
+// lockout does not keep extending while clients keep retrying.
+// 
+// Stored in the auth database, so lockouts survive restarts.
+export interface AuthLockout {
+	Key: string  // "ip <ip>", "ip <ip>/64" or "account <name>".
+	First: Date
+	Last: Date  // Of last failure.
+	Failures: number  // Consecutive failures.
+	Until: Date  // If in the future, authentication is refused. Zero if below threshold.
+}
+
+// JunkDecision records the inputs and outcome of the analysis of an incoming
+// message for an account, i.e. whether it was accepted or rejected as junk. For
+// analyzing and tuning the junk filter and reputation settings.
+// 
+// Address/DKIM/SPF/IP-based reputation is evaluated first. The content-based
+// junk filter is only evaluated when reputation was inconclusive and the account
+// has a junk filter. DNS block lists are only checked when the content looks
+// good.
+export interface JunkDecision {
+	ID: number
+	Time: Date
+	MessageID: string  // Message-ID header, with <>.
+	MailFrom: string  // SMTP MAIL FROM address.
+	MsgFrom: string  // Message From header address.
+	Recipient: string  // SMTP RCPT TO address.
+	RemoteIP: string
+	Subject: string
+	Accept: boolean  // Whether the message was accepted.
+	Mailbox: string  // Destination mailbox for accepted messages.
+	Reason: string  // As in the X-Mox-Reason header, e.g. "junk-content", "dns-blocklisted", "no-bad-signals", or a reputation method like "msgfromfull".
+	ReasonText?: string[] | null  // Human-readable details.
+	ReputationMethod: string  // E.g. "msgfromfull", "dkimspf", "ip1", "none".
+	ReputationJunk?: boolean | null  // Nil if no reputation could be determined.
+	ReputationConclusive: boolean
+	ContentAnalyzed: boolean  // Whether the junk filter was evaluated.
+	Probability: number  // Between 0 (ham) and 1 (spam).
+	Significant: boolean  // Whether enough known words were found to base a decision on.
+	Threshold: number  // Threshold used, can be stricter than configured.
+	HamWords?: WordScore[] | null  // Words contributing most to ham.
+	SpamWords?: WordScore[] | null  // Words contributing most to spam.
+	DNSBLZone: string  // DNS block list zone the remote IP was listed in, if any.
+}
+
+// WordScore is a word with its score as used in classifications, based on
+// (historic) training.
+export interface WordScore {
+	Word: string
+	Score: number  // 0 is ham, 1 is spam.
+}
+
+// IMAPClient is an entry in the inventory of IMAP client software in use by an
+// account, as identified by the client with the IMAP ID command. Useful for
+// finding which clients would be affected by changes, like disabling legacy
+// authentication mechanisms.
+// 
+// Entries are removed after not having been used for 90 days.
+export interface IMAPClient {
+	Key?: string | null  // Hash of AccountName and the fields Name through OSVersion. We store a single entry per key, updating its Last and Count fields.
+	AccountName: string
+	Name: string  // From the ID parameters "name", "version", "vendor", "os" and "os-version".
+	Version: string
+	Vendor: string
+	OS: string
+	OSVersion: string
+	Params?: { [key: string]: string }  // All ID parameters of the most recent login, with lower-case keys.
+	First: Date
+	Last: Date
+	Count: number  // Number of logins.
+	Denied: number  // Number of logins denied by IMAP client rules.
+}
+
+// Connection is an open IMAP connection, as listed in the admin interface.
+export interface Connection {
+	CID: number
+	Listener: string
+	RemoteIP: string
+	TLS: boolean
+	Start: Date
+	LastActive: Date  // Start of most recent command, or of connection.
+	State: string  // "notauthenticated", "authenticated" or "selected".
+	Username: string  // As used for authentication, empty before.
+	Account: string  // Empty before authentication.
+	Command: string  // Currently executing, empty while waiting for a command. Lower case.
+}
+
+// LoginSession represents a login session. We keep a limited number of sessions
+// for a user, removing the oldest session when a new one is created.
+export interface LoginSession {
+	ID: number
+	Created: Date  // Of original login.
+	Expires: Date  // Extended each time it is used.
+	AccountName: string
+	LoginAddress: string
+}
+
 export type CSRFToken = string
 
 // Policy as used in DMARC DNS record for "p=" or "sp=".
@@ -1136,6 +1515,21 @@ export type Localpart = string
 // be an IPv4 address.
 export type IP = string
 
+// Kind of event.
+export enum Kind {
+	KindReceived = "received",  // Incoming message received over SMTP for a local recipient.
+	// Junk verdict for an incoming message. Success indicates the message was
+	// accepted, Detail holds the reason for the verdict.
+	KindJunkVerdict = "junkverdict",
+	KindDelivered = "delivered",  // Incoming message delivered to a mailbox of a local account.
+	KindQueued = "queued",  // Outgoing message added to the queue.
+	// Delivery attempt of an outgoing message from the queue that failed
+	// temporarily. Another attempt will be made later.
+	KindAttempt = "attempt",
+	KindSent = "sent",  // Outgoing message delivered to the next hop.
+	KindBounced = "bounced",  // Outgoing message failed permanently, a DSN is delivered to the sender.
+}
+
 // AuthResult is the result of a login attempt.
 export enum AuthResult {
 	AuthSuccess = "ok",
@@ -1145,12 +1539,16 @@ export enum AuthResult {
 	AuthBadChannelBinding = "badchanbind",
 	AuthBadProtocol = "badprotocol",
 	AuthLoginDisabled = "logindisabled",
+	AuthNetworkDenied = "networkdenied",
+	AuthClientDenied = "clientdenied",
 	AuthError = "error",
 	AuthAborted = "aborted",
+	AuthLockedOut = "lockedout",
+	AuthTooManyConns = "toomanyconns",
 }
 
-export const structTypes: {[typename: string]: boolean} = {"Account":true,"Address":true,"AddressAlias":true,"Alias":true,"AliasAddress":true,"AuthResults":true,"AutoconfCheckResult":true,"AutodiscoverCheckResult":true,"AutodiscoverSRV":true,"AutomaticJunkFlags":true,"Canonicalization":true,"CheckResult":true,"ClientConfigs":true,"ClientConfigsEntry":true,"ConfigDomain":true,"DANECheckResult":true,"DKIM":true,"DKIMAuthResult":true,"DKIMCheckResult":true,"DKIMRecord":true,"DMARC":true,"DMARCCheckResult":true,"DMARCRecord":true,"DMARCSummary":true,"DNSSECResult":true,"DateRange":true,"Destination":true,"Directive":true,"Domain":true,"DomainFeedback":true,"Dynamic":true,"Evaluation":true,"EvaluationStat":true,"Extension":true,"FailureDetails":true,"Filter":true,"HoldRule":true,"Hook":true,"HookFilter":true,"HookResult":true,"HookRetired":true,"HookRetiredFilter":true,"HookRetiredSort":true,"HookSort":true,"IPDomain":true,"IPRevCheckResult":true,"Identifiers":true,"IncomingWebhook":true,"JunkFilter":true,"LoginAttempt":true,"MTASTS":true,"MTASTSCheckResult":true,"MTASTSRecord":true,"MX":true,"MXCheckResult":true,"Modifier":true,"Msg":true,"MsgResult":true,"MsgRetired":true,"OutgoingWebhook":true,"Pair":true,"Policy":true,"PolicyEvaluated":true,"PolicyOverrideReason":true,"PolicyPublished":true,"PolicyRecord":true,"Record":true,"Report":true,"ReportMetadata":true,"ReportRecord":true,"Result":true,"ResultPolicy":true,"RetiredFilter":true,"RetiredSort":true,"Reverse":true,"Route":true,"Row":true,"Ruleset":true,"SMTPAuth":true,"SPFAuthResult":true,"SPFCheckResult":true,"SPFRecord":true,"SRV":true,"SRVConfCheckResult":true,"STSMX":true,"Selector":true,"Sort":true,"SubjectPass":true,"Summary":true,"SuppressAddress":true,"TLSCheckResult":true,"TLSPublicKey":true,"TLSRPT":true,"TLSRPTCheckResult":true,"TLSRPTDateRange":true,"TLSRPTRecord":true,"TLSRPTSummary":true,"TLSRPTSuppressAddress":true,"TLSReportRecord":true,"TLSResult":true,"Transport":true,"TransportDirect":true,"TransportSMTP":true,"TransportSocks":true,"URI":true,"WebForward":true,"WebHandler":true,"WebInternal":true,"WebRedirect":true,"WebStatic":true,"WebserverConfig":true}
-export const stringsTypes: {[typename: string]: boolean} = {"Align":true,"AuthResult":true,"CSRFToken":true,"DMARCPolicy":true,"IP":true,"Localpart":true,"Mode":true,"RUA":true}
+export const structTypes: {[typename: string]: boolean} = {"Account":true,"Address":true,"AddressAlias":true,"AddressEntry":true,"AdminToken":true,"AdminWebhook":true,"Advice":true,"AdviceSource":true,"Alias":true,"AliasAddress":true,"ArchiveTier":true,"AuthLockout":true,"AuthResults":true,"AutoArchive":true,"AutoconfCheckResult":true,"AutodiscoverCheckResult":true,"AutodiscoverSRV":true,"AutomaticJunkFlags":true,"Canonicalization":true,"CheckResult":true,"ClientConfigs":true,"ClientConfigsEntry":true,"ConfigDomain":true,"ConfigPreview":true,"Connection":true,"DANECheckResult":true,"DKIM":true,"DKIMAuthResult":true,"DKIMCheckResult":true,"DKIMRecord":true,"DMARC":true,"DMARCCheckResult":true,"DMARCRecord":true,"DMARCSummary":true,"DNSSECResult":true,"DateRange":true,"Destination":true,"Directive":true,"Domain":true,"DomainAdmin":true,"DomainFeedback":true,"DuplicateWindow":true,"Dynamic":true,"Evaluation":true,"EvaluationStat":true,"Event":true,"EventFilter":true,"Extension":true,"FailureDetails":true,"Filter":true,"Forward":true,"HoldRule":true,"Hook":true,"HookFilter":true,"HookResult":true,"HookRetired":true,"HookRetiredFilter":true,"HookRetiredSort":true,"HookSort":true,"IMAPClient":true,"IMAPClientRule":true,"IPDomain":true,"IPRevCheckResult":true,"Identifiers":true,"ImportJob":true,"InboundHeaders":true,"IncomingWebhook":true,"JunkDecision":true,"JunkFilter":true,"LoginAttempt":true,"LoginSession":true,"LoginToken":true,"MTASTS":true,"MTASTSCheckResult":true,"MTASTSRecord":true,"MX":true,"MXCheckResult":true,"MessageCompression":true,"MessageEncryption":true,"Modifier":true,"Msg":true,"MsgResult":true,"MsgRetired":true,"OutgoingWebhook":true,"Pair":true,"Policy":true,"PolicyEvaluated":true,"PolicyOverrideReason":true,"PolicyPublished":true,"PolicyRecord":true,"Record":true,"Report":true,"ReportMetadata":true,"ReportRecord":true,"Result":true,"ResultPolicy":true,"RetiredFilter":true,"RetiredSort":true,"Reverse":true,"Route":true,"Row":true,"Ruleset":true,"SMTPAuth":true,"SPF":true,"SPFAuthResult":true,"SPFCheckResult":true,"SPFRecord":true,"SRV":true,"SRVConfCheckResult":true,"STSMX":true,"SecurityTXT":true,"Selector":true,"Sort":true,"SpoofIncident":true,"SubjectPass":true,"SubmissionChecks":true,"Summary":true,"SuppressAddress":true,"TLSCheckResult":true,"TLSClientAuth":true,"TLSPublicKey":true,"TLSRPT":true,"TLSRPTCheckResult":true,"TLSRPTDateRange":true,"TLSRPTRecord":true,"TLSRPTSummary":true,"TLSRPTSuppressAddress":true,"TLSReportRecord":true,"TLSResult":true,"Transport":true,"TransportDirect":true,"TransportSMTP":true,"TransportSocks":true,"URI":true,"WKD":true,"WebForward":true,"WebHandler":true,"WebInternal":true,"WebRedirect":true,"WebStatic":true,"WebserverConfig":true,"WellKnown":true,"WordScore":true}
+export const stringsTypes: {[typename: string]: boolean} = {"Align":true,"AuthResult":true,"CSRFToken":true,"DMARCPolicy":true,"IP":true,"Kind":true,"Localpart":true,"Mode":true,"RUA":true}
 export const intsTypes: {[typename: string]: boolean} = {}
 export const types: TypenameMap = {
 	"CheckResult": {"Name":"CheckResult","Docs":"","Fields":[{"Name":"Domain","Docs":"","Typewords":["string"]},{"Name":"DNSSEC","Docs":"","Typewords":["DNSSECResult"]},{"Name":"IPRev","Docs":"","Typewords":["IPRevCheckResult"]},{"Name":"MX","Docs":"","Typewords":["MXCheckResult"]},{"Name":"TLS","Docs":"","Typewords":["TLSCheckResult"]},{"Name":"DANE","Docs":"","Typewords":["DANECheckResult"]},{"Name":"SPF","Docs":"","Typewords":["SPFCheckResult"]},{"Name":"DKIM","Docs":"","Typewords":["DKIMCheckResult"]},{"Name":"DMARC","Docs":"","Typewords":["DMARCCheckResult"]},{"Name":"HostTLSRPT","Docs":"","Typewords":["TLSRPTCheckResult"]},{"Name":"DomainTLSRPT","Docs":"","Typewords":["TLSRPTCheckResult"]},{"Name":"MTASTS","Docs":"","Typewords":["MTASTSCheckResult"]},{"Name":"SRVConf","Docs":"","Typewords":["SRVConfCheckResult"]},{"Name":"Autoconf","Docs":"","Typewords":["AutoconfCheckResult"]},{"Name":"Autodiscover","Docs":"","Typewords":["AutodiscoverCheckResult"]}]},
@@ -1184,25 +1582,38 @@ export const types: TypenameMap = {
 	"AutoconfCheckResult": {"Name":"AutoconfCheckResult","Docs":"","Fields":[{"Name":"ClientSettingsDomainIPs","Docs":"","Typewords":["[]","string"]},{"Name":"IPs","Docs":"","Typewords":["[]","string"]},{"Name":"Errors","Docs":"","Typewords":["[]","string"]},{"Name":"Warnings","Docs":"","Typewords":["[]","string"]},{"Name":"Instructions","Docs":"","Typewords":["[]","string"]}]},
 	"AutodiscoverCheckResult": {"Name":"AutodiscoverCheckResult","Docs":"","Fields":[{"Name":"Records","Docs":"","Typewords":["[]","AutodiscoverSRV"]},{"Name":"Errors","Docs":"","Typewords":["[]","string"]},{"Name":"Warnings","Docs":"","Typewords":["[]","string"]},{"Name":"Instructions","Docs":"","Typewords":["[]","string"]}]},
 	"AutodiscoverSRV": {"Name":"AutodiscoverSRV","Docs":"","Fields":[{"Name":"Target","Docs":"","Typewords":["string"]},{"Name":"Port","Docs":"","Typewords":["uint16"]},{"Name":"Priority","Docs":"","Typewords":["uint16"]},{"Name":"Weight","Docs":"","Typewords":["uint16"]},{"Name":"IPs","Docs":"","Typewords":["[]","string"]}]},
-	"ConfigDomain": {"Name":"ConfigDomain","Docs":"","Fields":[{"Name":"Disabled","Docs":"","Typewords":["bool"]},{"Name":"Description","Docs":"","Typewords":["string"]},{"Name":"ClientSettingsDomain","Docs":"","Typewords":["string"]},{"Name":"LocalpartCatchallSeparator","Docs":"","Typewords":["string"]},{"Name":"LocalpartCaseSensitive","Docs":"","Typewords":["bool"]},{"Name":"DKIM","Docs":"","Typewords":["DKIM"]},{"Name":"DMARC","Docs":"","Typewords":["nullable","DMARC"]},{"Name":"MTASTS","Docs":"","Typewords":["nullable","MTASTS"]},{"Name":"TLSRPT","Docs":"","Typewords":["nullable","TLSRPT"]},{"Name":"Routes","Docs":"","Typewords":["[]","Route"]},{"Name":"Aliases","Docs":"","Typewords":["{}","Alias"]},{"Name":"Domain","Docs":"","Typewords":["Domain"]}]},
+	"ConfigDomain": {"Name":"ConfigDomain","Docs":"","Fields":[{"Name":"Disabled","Docs":"","Typewords":["bool"]},{"Name":"Description","Docs":"","Typewords":["string"]},{"Name":"ClientSettingsDomain","Docs":"","Typewords":["string"]},{"Name":"LocalpartCatchallSeparator","Docs":"","Typewords":["string"]},{"Name":"LocalpartCaseSensitive","Docs":"","Typewords":["bool"]},{"Name":"DKIM","Docs":"","Typewords":["DKIM"]},{"Name":"DMARC","Docs":"","Typewords":["nullable","DMARC"]},{"Name":"MTASTS","Docs":"","Typewords":["nullable","MTASTS"]},{"Name":"WKD","Docs":"","Typewords":["nullable","WKD"]},{"Name":"WellKnown","Docs":"","Typewords":["nullable","WellKnown"]},{"Name":"TLSRPT","Docs":"","Typewords":["nullable","TLSRPT"]},{"Name":"SPF","Docs":"","Typewords":["nullable","SPF"]},{"Name":"Routes","Docs":"","Typewords":["[]","Route"]},{"Name":"Aliases","Docs":"","Typewords":["{}","Alias"]},{"Name":"InboundHeaders","Docs":"","Typewords":["nullable","InboundHeaders"]},{"Name":"LookalikeSenders","Docs":"","Typewords":["string"]},{"Name":"SpoofingSurges","Docs":"","Typewords":["string"]},{"Name":"Domain","Docs":"","Typewords":["Domain"]}]},
 	"DKIM": {"Name":"DKIM","Docs":"","Fields":[{"Name":"Selectors","Docs":"","Typewords":["{}","Selector"]},{"Name":"Sign","Docs":"","Typewords":["[]","string"]}]},
-	"Selector": {"Name":"Selector","Docs":"","Fields":[{"Name":"Hash","Docs":"","Typewords":["string"]},{"Name":"HashEffective","Docs":"","Typewords":["string"]},{"Name":"Canonicalization","Docs":"","Typewords":["Canonicalization"]},{"Name":"Headers","Docs":"","Typewords":["[]","string"]},{"Name":"HeadersEffective","Docs":"","Typewords":["[]","string"]},{"Name":"DontSealHeaders","Docs":"","Typewords":["bool"]},{"Name":"Expiration","Docs":"","Typewords":["string"]},{"Name":"PrivateKeyFile","Docs":"","Typewords":["string"]},{"Name":"Algorithm","Docs":"","Typewords":["string"]}]},
+	"Selector": {"Name":"Selector","Docs":"","Fields":[{"Name":"Hash","Docs":"","Typewords":["string"]},{"Name":"HashEffective","Docs":"","Typewords":["string"]},{"Name":"Canonicalization","Docs":"","Typewords":["Canonicalization"]},{"Name":"Headers","Docs":"","Typewords":["[]","string"]},{"Name":"HeadersEffective","Docs":"","Typewords":["[]","string"]},{"Name":"DontSealHeaders","Docs":"","Typewords":["bool"]},{"Name":"Expiration","Docs":"","Typewords":["string"]},{"Name":"PrivateKeyFile","Docs":"","Typewords":["string"]},{"Name":"Retiring","Docs":"","Typewords":["bool"]},{"Name":"Algorithm","Docs":"","Typewords":["string"]}]},
 	"Canonicalization": {"Name":"Canonicalization","Docs":"","Fields":[{"Name":"HeaderRelaxed","Docs":"","Typewords":["bool"]},{"Name":"BodyRelaxed","Docs":"","Typewords":["bool"]}]},
-	"DMARC": {"Name":"DMARC","Docs":"","Fields":[{"Name":"Localpart","Docs":"","Typewords":["string"]},{"Name":"Domain","Docs":"","Typewords":["string"]},{"Name":"Account","Docs":"","Typewords":["string"]},{"Name":"Mailbox","Docs":"","Typewords":["string"]},{"Name":"ParsedLocalpart","Docs":"","Typewords":["Localpart"]},{"Name":"DNSDomain","Docs":"","Typewords":["Domain"]}]},
-	"MTASTS": {"Name":"MTASTS","Docs":"","Fields":[{"Name":"PolicyID","Docs":"","Typewords":["string"]},{"Name":"Mode","Docs":"","Typewords":["Mode"]},{"Name":"MaxAge","Docs":"","Typewords":["int64"]},{"Name":"MX","Docs":"","Typewords":["[]","string"]}]},
+	"DMARC": {"Name":"DMARC","Docs":"","Fields":[{"Name":"Localpart","Docs":"","Typewords":["string"]},{"Name":"Domain","Docs":"","Typewords":["string"]},{"Name":"Account","Docs":"","Typewords":["string"]},{"Name":"Mailbox","Docs":"","Typewords":["string"]},{"Name":"Policy","Docs":"","Typewords":["string"]},{"Name":"ParsedLocalpart","Docs":"","Typewords":["Localpart"]},{"Name":"DNSDomain","Docs":"","Typewords":["Domain"]}]},
+	"MTASTS": {"Name":"MTASTS","Docs":"","Fields":[{"Name":"PolicyID","Docs":"","Typewords":["string"]},{"Name":"Mode","Docs":"","Typewords":["Mode"]},{"Name":"MaxAge","Docs":"","Typewords":["int64"]},{"Name":"MX","Docs":"","Typewords":["[]","string"]},{"Name":"MaxAgeRampDays","Docs":"","Typewords":["int32"]}]},
+	"WKD": {"Name":"WKD","Docs":"","Fields":[{"Name":"Accounts","Docs":"","Typewords":["[]","string"]}]},
+	"WellKnown": {"Name":"WellKnown","Docs":"","Fields":[{"Name":"SecurityTXT","Docs":"","Typewords":["nullable","SecurityTXT"]},{"Name":"ChangePasswordURL","Docs":"","Typewords":["string"]}]},
+	"SecurityTXT": {"Name":"SecurityTXT","Docs":"","Fields":[{"Name":"Contact","Docs":"","Typewords":["[]","string"]},{"Name":"Expires","Docs":"","Typewords":["string"]},{"Name":"Encryption","Docs":"","Typewords":["[]","string"]},{"Name":"Acknowledgments","Docs":"","Typewords":["[]","string"]},{"Name":"PreferredLanguages","Docs":"","Typewords":["[]","string"]},{"Name":"Canonical","Docs":"","Typewords":["[]","string"]},{"Name":"Policy","Docs":"","Typewords":["[]","string"]},{"Name":"Hiring","Docs":"","Typewords":["[]","string"]}]},
 	"TLSRPT": {"Name":"TLSRPT","Docs":"","Fields":[{"Name":"Localpart","Docs":"","Typewords":["string"]},{"Name":"Domain","Docs":"","Typewords":["string"]},{"Name":"Account","Docs":"","Typewords":["string"]},{"Name":"Mailbox","Docs":"","Typewords":["string"]},{"Name":"ParsedLocalpart","Docs":"","Typewords":["Localpart"]},{"Name":"DNSDomain","Docs":"","Typewords":["Domain"]}]},
-	"Route": {"Name":"Route","Docs":"","Fields":[{"Name":"FromDomain","Docs":"","Typewords":["[]","string"]},{"Name":"ToDomain","Docs":"","Typewords":["[]","string"]},{"Name":"MinimumAttempts","Docs":"","Typewords":["int32"]},{"Name":"Transport","Docs":"","Typewords":["string"]},{"Name":"FromDomainASCII","Docs":"","Typewords":["[]","string"]},{"Name":"ToDomainASCII","Docs":"","Typewords":["[]","string"]}]},
-	"Alias": {"Name":"Alias","Docs":"","Fields":[{"Name":"Addresses","Docs":"","Typewords":["[]","string"]},{"Name":"PostPublic","Docs":"","Typewords":["bool"]},{"Name":"ListMembers","Docs":"","Typewords":["bool"]},{"Name":"AllowMsgFrom","Docs":"","Typewords":["bool"]},{"Name":"LocalpartStr","Docs":"","Typewords":["string"]},{"Name":"Domain","Docs":"","Typewords":["Domain"]},{"Name":"ParsedAddresses","Docs":"","Typewords":["[]","AliasAddress"]}]},
+	"SPF": {"Name":"SPF","Docs":"","Fields":[{"Name":"Includes","Docs":"","Typewords":["[]","string"]},{"Name":"IPs","Docs":"","Typewords":["[]","string"]},{"Name":"All","Docs":"","Typewords":["string"]}]},
+	"Route": {"Name":"Route","Docs":"","Fields":[{"Name":"FromDomain","Docs":"","Typewords":["[]","string"]},{"Name":"ToDomain","Docs":"","Typewords":["[]","string"]},{"Name":"MinimumAttempts","Docs":"","Typewords":["int32"]},{"Name":"Transport","Docs":"","Typewords":["string"]},{"Name":"Failover","Docs":"","Typewords":["[]","string"]},{"Name":"FailoverErrors","Docs":"","Typewords":["[]","string"]},{"Name":"FromDomainASCII","Docs":"","Typewords":["[]","string"]},{"Name":"ToDomainASCII","Docs":"","Typewords":["[]","string"]}]},
+	"Alias": {"Name":"Alias","Docs":"","Fields":[{"Name":"Addresses","Docs":"","Typewords":["[]","string"]},{"Name":"PostPublic","Docs":"","Typewords":["bool"]},{"Name":"ListMembers","Docs":"","Typewords":["bool"]},{"Name":"AllowMsgFrom","Docs":"","Typewords":["bool"]},{"Name":"ListUnsubscribe","Docs":"","Typewords":["bool"]},{"Name":"LocalpartStr","Docs":"","Typewords":["string"]},{"Name":"Domain","Docs":"","Typewords":["Domain"]},{"Name":"ParsedAddresses","Docs":"","Typewords":["[]","AliasAddress"]},{"Name":"RemoteAddresses","Docs":"","Typewords":["[]","Address"]}]},
 	"AliasAddress": {"Name":"AliasAddress","Docs":"","Fields":[{"Name":"Address","Docs":"","Typewords":["Address"]},{"Name":"AccountName","Docs":"","Typewords":["string"]},{"Name":"Destination","Docs":"","Typewords":["Destination"]}]},
 	"Address": {"Name":"Address","Docs":"","Fields":[{"Name":"Localpart","Docs":"","Typewords":["Localpart"]},{"Name":"Domain","Docs":"","Typewords":["Domain"]}]},
-	"Destination": {"Name":"Destination","Docs":"","Fields":[{"Name":"Mailbox","Docs":"","Typewords":["string"]},{"Name":"Rulesets","Docs":"","Typewords":["[]","Ruleset"]},{"Name":"SMTPError","Docs":"","Typewords":["string"]},{"Name":"MessageAuthRequiredSMTPError","Docs":"","Typewords":["string"]},{"Name":"FullName","Docs":"","Typewords":["string"]}]},
-	"Ruleset": {"Name":"Ruleset","Docs":"","Fields":[{"Name":"SMTPMailFromRegexp","Docs":"","Typewords":["string"]},{"Name":"MsgFromRegexp","Docs":"","Typewords":["string"]},{"Name":"VerifiedDomain","Docs":"","Typewords":["string"]},{"Name":"HeadersRegexp","Docs":"","Typewords":["{}","string"]},{"Name":"IsForward","Docs":"","Typewords":["bool"]},{"Name":"ListAllowDomain","Docs":"","Typewords":["string"]},{"Name":"AcceptRejectsToMailbox","Docs":"","Typewords":["string"]},{"Name":"Mailbox","Docs":"","Typewords":["string"]},{"Name":"Comment","Docs":"","Typewords":["string"]},{"Name":"VerifiedDNSDomain","Docs":"","Typewords":["Domain"]},{"Name":"ListAllowDNSDomain","Docs":"","Typewords":["Domain"]}]},
-	"Account": {"Name":"Account","Docs":"","Fields":[{"Name":"OutgoingWebhook","Docs":"","Typewords":["nullable","OutgoingWebhook"]},{"Name":"IncomingWebhook","Docs":"","Typewords":["nullable","IncomingWebhook"]},{"Name":"FromIDLoginAddresses","Docs":"","Typewords":["[]","string"]},{"Name":"KeepRetiredMessagePeriod","Docs":"","Typewords":["int64"]},{"Name":"KeepRetiredWebhookPeriod","Docs":"","Typewords":["int64"]},{"Name":"LoginDisabled","Docs":"","Typewords":["string"]},{"Name":"Domain","Docs":"","Typewords":["string"]},{"Name":"Description","Docs":"","Typewords":["string"]},{"Name":"FullName","Docs":"","Typewords":["string"]},{"Name":"Destinations","Docs":"","Typewords":["{}","Destination"]},{"Name":"SubjectPass","Docs":"","Typewords":["SubjectPass"]},{"Name":"QuotaMessageSize","Docs":"","Typewords":["int64"]},{"Name":"RejectsMailbox","Docs":"","Typewords":["string"]},{"Name":"KeepRejects","Docs":"","Typewords":["bool"]},{"Name":"AutomaticJunkFlags","Docs":"","Typewords":["AutomaticJunkFlags"]},{"Name":"JunkFilter","Docs":"","Typewords":["nullable","JunkFilter"]},{"Name":"MaxOutgoingMessagesPerDay","Docs":"","Typewords":["int32"]},{"Name":"MaxFirstTimeRecipientsPerDay","Docs":"","Typewords":["int32"]},{"Name":"NoFirstTimeSenderDelay","Docs":"","Typewords":["bool"]},{"Name":"NoCustomPassword","Docs":"","Typewords":["bool"]},{"Name":"Routes","Docs":"","Typewords":["[]","Route"]},{"Name":"DNSDomain","Docs":"","Typewords":["Domain"]},{"Name":"Aliases","Docs":"","Typewords":["[]","AddressAlias"]}]},
+	"Destination": {"Name":"Destination","Docs":"","Fields":[{"Name":"Mailbox","Docs":"","Typewords":["string"]},{"Name":"Rulesets","Docs":"","Typewords":["[]","Ruleset"]},{"Name":"SMTPError","Docs":"","Typewords":["string"]},{"Name":"MessageAuthRequiredSMTPError","Docs":"","Typewords":["string"]},{"Name":"FullName","Docs":"","Typewords":["string"]},{"Name":"Disabled","Docs":"","Typewords":["bool"]},{"Name":"DuplicateWindow","Docs":"","Typewords":["nullable","DuplicateWindow"]},{"Name":"Forward","Docs":"","Typewords":["nullable","Forward"]}]},
+	"Ruleset": {"Name":"Ruleset","Docs":"","Fields":[{"Name":"SMTPMailFromRegexp","Docs":"","Typewords":["string"]},{"Name":"MsgFromRegexp","Docs":"","Typewords":["string"]},{"Name":"MsgToRegexp","Docs":"","Typewords":["string"]},{"Name":"VerifiedDomain","Docs":"","Typewords":["string"]},{"Name":"HeadersRegexp","Docs":"","Typewords":["{}","string"]},{"Name":"IsForward","Docs":"","Typewords":["bool"]},{"Name":"ListAllowDomain","Docs":"","Typewords":["string"]},{"Name":"AcceptRejectsToMailbox","Docs":"","Typewords":["string"]},{"Name":"Mailbox","Docs":"","Typewords":["string"]},{"Name":"Seen","Docs":"","Typewords":["bool"]},{"Name":"Keywords","Docs":"","Typewords":["[]","string"]},{"Name":"ForwardTo","Docs":"","Typewords":["[]","string"]},{"Name":"Discard","Docs":"","Typewords":["bool"]},{"Name":"Comment","Docs":"","Typewords":["string"]},{"Name":"VerifiedDNSDomain","Docs":"","Typewords":["Domain"]},{"Name":"ListAllowDNSDomain","Docs":"","Typewords":["Domain"]}]},
+	"DuplicateWindow": {"Name":"DuplicateWindow","Docs":"","Fields":[{"Name":"Period","Docs":"","Typewords":["int64"]},{"Name":"Suppress","Docs":"","Typewords":["bool"]}]},
+	"Forward": {"Name":"Forward","Docs":"","Fields":[{"Name":"To","Docs":"","Typewords":["[]","string"]},{"Name":"KeepCopy","Docs":"","Typewords":["bool"]},{"Name":"Disabled","Docs":"","Typewords":["bool"]}]},
+	"InboundHeaders": {"Name":"InboundHeaders","Docs":"","Fields":[{"Name":"SubjectPrefix","Docs":"","Typewords":["string"]},{"Name":"Headers","Docs":"","Typewords":["{}","string"]},{"Name":"InternalDomains","Docs":"","Typewords":["[]","string"]}]},
+	"Account": {"Name":"Account","Docs":"","Fields":[{"Name":"OutgoingWebhook","Docs":"","Typewords":["nullable","OutgoingWebhook"]},{"Name":"IncomingWebhook","Docs":"","Typewords":["nullable","IncomingWebhook"]},{"Name":"FromIDLoginAddresses","Docs":"","Typewords":["[]","string"]},{"Name":"KeepRetiredMessagePeriod","Docs":"","Typewords":["int64"]},{"Name":"KeepRetiredWebhookPeriod","Docs":"","Typewords":["int64"]},{"Name":"LoginDisabled","Docs":"","Typewords":["string"]},{"Name":"Suspended","Docs":"","Typewords":["string"]},{"Name":"SuspendedReject","Docs":"","Typewords":["bool"]},{"Name":"LoginNetworks","Docs":"","Typewords":["[]","string"]},{"Name":"Domain","Docs":"","Typewords":["string"]},{"Name":"Description","Docs":"","Typewords":["string"]},{"Name":"FullName","Docs":"","Typewords":["string"]},{"Name":"Template","Docs":"","Typewords":["string"]},{"Name":"Destinations","Docs":"","Typewords":["{}","Destination"]},{"Name":"SubjectPass","Docs":"","Typewords":["SubjectPass"]},{"Name":"QuotaMessageSize","Docs":"","Typewords":["int64"]},{"Name":"MaxAppendSize","Docs":"","Typewords":["int64"]},{"Name":"MaxIMAPConnections","Docs":"","Typewords":["int32"]},{"Name":"RejectsMailbox","Docs":"","Typewords":["string"]},{"Name":"KeepRejects","Docs":"","Typewords":["bool"]},{"Name":"AutomaticJunkFlags","Docs":"","Typewords":["AutomaticJunkFlags"]},{"Name":"JunkFilter","Docs":"","Typewords":["nullable","JunkFilter"]},{"Name":"MaxOutgoingMessagesPerDay","Docs":"","Typewords":["int32"]},{"Name":"MaxFirstTimeRecipientsPerDay","Docs":"","Typewords":["int32"]},{"Name":"NoFirstTimeSenderDelay","Docs":"","Typewords":["bool"]},{"Name":"DuplicateWindow","Docs":"","Typewords":["nullable","DuplicateWindow"]},{"Name":"AutoArchive","Docs":"","Typewords":["nullable","AutoArchive"]},{"Name":"ArchiveTier","Docs":"","Typewords":["nullable","ArchiveTier"]},{"Name":"MessageCompression","Docs":"","Typewords":["nullable","MessageCompression"]},{"Name":"MessageEncryption","Docs":"","Typewords":["nullable","MessageEncryption"]},{"Name":"SubmissionChecks","Docs":"","Typewords":["nullable","SubmissionChecks"]},{"Name":"TLSClientAuth","Docs":"","Typewords":["[]","TLSClientAuth"]},{"Name":"NoCustomPassword","Docs":"","Typewords":["bool"]},{"Name":"Routes","Docs":"","Typewords":["[]","Route"]},{"Name":"DNSDomain","Docs":"","Typewords":["Domain"]},{"Name":"Aliases","Docs":"","Typewords":["[]","AddressAlias"]}]},
 	"OutgoingWebhook": {"Name":"OutgoingWebhook","Docs":"","Fields":[{"Name":"URL","Docs":"","Typewords":["string"]},{"Name":"Authorization","Docs":"","Typewords":["string"]},{"Name":"Events","Docs":"","Typewords":["[]","string"]}]},
 	"IncomingWebhook": {"Name":"IncomingWebhook","Docs":"","Fields":[{"Name":"URL","Docs":"","Typewords":["string"]},{"Name":"Authorization","Docs":"","Typewords":["string"]}]},
 	"SubjectPass": {"Name":"SubjectPass","Docs":"","Fields":[{"Name":"Period","Docs":"","Typewords":["int64"]}]},
 	"AutomaticJunkFlags": {"Name":"AutomaticJunkFlags","Docs":"","Fields":[{"Name":"Enabled","Docs":"","Typewords":["bool"]},{"Name":"JunkMailboxRegexp","Docs":"","Typewords":["string"]},{"Name":"NeutralMailboxRegexp","Docs":"","Typewords":["string"]},{"Name":"NotJunkMailboxRegexp","Docs":"","Typewords":["string"]}]},
 	"JunkFilter": {"Name":"JunkFilter","Docs":"","Fields":[{"Name":"Threshold","Docs":"","Typewords":["float64"]},{"Name":"Onegrams","Docs":"","Typewords":["bool"]},{"Name":"Twograms","Docs":"","Typewords":["bool"]},{"Name":"Threegrams","Docs":"","Typewords":["bool"]},{"Name":"MaxPower","Docs":"","Typewords":["float64"]},{"Name":"TopWords","Docs":"","Typewords":["int32"]},{"Name":"IgnoreWords","Docs":"","Typewords":["float64"]},{"Name":"RareWords","Docs":"","Typewords":["int32"]}]},
+	"AutoArchive": {"Name":"AutoArchive","Docs":"","Fields":[{"Name":"Age","Docs":"","Typewords":["int64"]},{"Name":"Mailboxes","Docs":"","Typewords":["[]","string"]},{"Name":"Mailbox","Docs":"","Typewords":["string"]},{"Name":"SkipUnread","Docs":"","Typewords":["bool"]},{"Name":"SkipFlagged","Docs":"","Typewords":["bool"]}]},
+	"ArchiveTier": {"Name":"ArchiveTier","Docs":"","Fields":[{"Name":"Age","Docs":"","Typewords":["int64"]},{"Name":"MaxMessageSize","Docs":"","Typewords":["int64"]}]},
+	"MessageCompression": {"Name":"MessageCompression","Docs":"","Fields":[{"Name":"Disabled","Docs":"","Typewords":["bool"]},{"Name":"MinMessageSize","Docs":"","Typewords":["int64"]},{"Name":"MaxMessageSize","Docs":"","Typewords":["int64"]}]},
+	"MessageEncryption": {"Name":"MessageEncryption","Docs":"","Fields":[{"Name":"KeyWrap","Docs":"","Typewords":["string"]}]},
+	"SubmissionChecks": {"Name":"SubmissionChecks","Docs":"","Fields":[{"Name":"RequireTo","Docs":"","Typewords":["bool"]},{"Name":"RequireSubject","Docs":"","Typewords":["bool"]},{"Name":"MaxRecipients","Docs":"","Typewords":["int32"]},{"Name":"ConfirmRecipients","Docs":"","Typewords":["int32"]}]},
+	"TLSClientAuth": {"Name":"TLSClientAuth","Docs":"","Fields":[{"Name":"Fingerprint","Docs":"","Typewords":["string"]},{"Name":"Subject","Docs":"","Typewords":["string"]},{"Name":"LoginAddress","Docs":"","Typewords":["string"]},{"Name":"NoIMAPPreauth","Docs":"","Typewords":["bool"]}]},
 	"AddressAlias": {"Name":"AddressAlias","Docs":"","Fields":[{"Name":"SubscriptionAddress","Docs":"","Typewords":["string"]},{"Name":"Alias","Docs":"","Typewords":["Alias"]},{"Name":"MemberAddresses","Docs":"","Typewords":["[]","string"]}]},
 	"PolicyRecord": {"Name":"PolicyRecord","Docs":"","Fields":[{"Name":"Domain","Docs":"","Typewords":["string"]},{"Name":"Inserted","Docs":"","Typewords":["timestamp"]},{"Name":"ValidEnd","Docs":"","Typewords":["timestamp"]},{"Name":"LastUpdate","Docs":"","Typewords":["timestamp"]},{"Name":"LastUse","Docs":"","Typewords":["timestamp"]},{"Name":"Backoff","Docs":"","Typewords":["bool"]},{"Name":"RecordID","Docs":"","Typewords":["string"]},{"Name":"Version","Docs":"","Typewords":["string"]},{"Name":"Mode","Docs":"","Typewords":["Mode"]},{"Name":"MX","Docs":"","Typewords":["[]","STSMX"]},{"Name":"MaxAgeSeconds","Docs":"","Typewords":["int32"]},{"Name":"Extensions","Docs":"","Typewords":["[]","Pair"]},{"Name":"PolicyText","Docs":"","Typewords":["string"]}]},
 	"TLSReportRecord": {"Name":"TLSReportRecord","Docs":"","Fields":[{"Name":"ID","Docs":"","Typewords":["int64"]},{"Name":"Domain","Docs":"","Typewords":["string"]},{"Name":"FromDomain","Docs":"","Typewords":["string"]},{"Name":"MailFrom","Docs":"","Typewords":["string"]},{"Name":"HostReport","Docs":"","Typewords":["bool"]},{"Name":"Report","Docs":"","Typewords":["Report"]}]},
@@ -1226,25 +1637,34 @@ export const types: TypenameMap = {
 	"DKIMAuthResult": {"Name":"DKIMAuthResult","Docs":"","Fields":[{"Name":"Domain","Docs":"","Typewords":["string"]},{"Name":"Selector","Docs":"","Typewords":["string"]},{"Name":"Result","Docs":"","Typewords":["string"]},{"Name":"HumanResult","Docs":"","Typewords":["string"]}]},
 	"SPFAuthResult": {"Name":"SPFAuthResult","Docs":"","Fields":[{"Name":"Domain","Docs":"","Typewords":["string"]},{"Name":"Scope","Docs":"","Typewords":["string"]},{"Name":"Result","Docs":"","Typewords":["string"]}]},
 	"DMARCSummary": {"Name":"DMARCSummary","Docs":"","Fields":[{"Name":"Domain","Docs":"","Typewords":["string"]},{"Name":"Total","Docs":"","Typewords":["int32"]},{"Name":"DispositionNone","Docs":"","Typewords":["int32"]},{"Name":"DispositionQuarantine","Docs":"","Typewords":["int32"]},{"Name":"DispositionReject","Docs":"","Typewords":["int32"]},{"Name":"DKIMFail","Docs":"","Typewords":["int32"]},{"Name":"SPFFail","Docs":"","Typewords":["int32"]},{"Name":"PolicyOverrides","Docs":"","Typewords":["{}","int32"]}]},
+	"Advice": {"Name":"Advice","Docs":"","Fields":[{"Name":"Domain","Docs":"","Typewords":["string"]},{"Name":"Start","Docs":"","Typewords":["timestamp"]},{"Name":"End","Docs":"","Typewords":["timestamp"]},{"Name":"Reports","Docs":"","Typewords":["int32"]},{"Name":"Messages","Docs":"","Typewords":["int32"]},{"Name":"Unaligned","Docs":"","Typewords":["int32"]},{"Name":"UnalignedSources","Docs":"","Typewords":["[]","AdviceSource"]},{"Name":"PublishedPolicy","Docs":"","Typewords":["string"]},{"Name":"PublishedPercentage","Docs":"","Typewords":["int32"]},{"Name":"RecommendedPolicy","Docs":"","Typewords":["string"]},{"Name":"Recommendation","Docs":"","Typewords":["string"]}]},
+	"AdviceSource": {"Name":"AdviceSource","Docs":"","Fields":[{"Name":"IP","Docs":"","Typewords":["string"]},{"Name":"Messages","Docs":"","Typewords":["int32"]}]},
+	"SpoofIncident": {"Name":"SpoofIncident","Docs":"","Fields":[{"Name":"ID","Docs":"","Typewords":["int64"]},{"Name":"Domain","Docs":"","Typewords":["string"]},{"Name":"Start","Docs":"","Typewords":["timestamp"]},{"Name":"End","Docs":"","Typewords":["timestamp"]},{"Name":"Messages","Docs":"","Typewords":["int32"]},{"Name":"Baseline","Docs":"","Typewords":["float64"]},{"Name":"Protected","Docs":"","Typewords":["bool"]},{"Name":"Sources","Docs":"","Typewords":["[]","AdviceSource"]}]},
 	"Reverse": {"Name":"Reverse","Docs":"","Fields":[{"Name":"Hostnames","Docs":"","Typewords":["[]","string"]}]},
+	"ConfigPreview": {"Name":"ConfigPreview","Docs":"","Fields":[{"Name":"Diff","Docs":"","Typewords":["string"]},{"Name":"Accounts","Docs":"","Typewords":["[]","string"]},{"Name":"Addresses","Docs":"","Typewords":["[]","string"]}]},
+	"AddressEntry": {"Name":"AddressEntry","Docs":"","Fields":[{"Name":"Address","Docs":"","Typewords":["string"]},{"Name":"Account","Docs":"","Typewords":["string"]},{"Name":"Disabled","Docs":"","Typewords":["bool"]}]},
+	"LoginToken": {"Name":"LoginToken","Docs":"","Fields":[{"Name":"ID","Docs":"","Typewords":["int64"]},{"Name":"Created","Docs":"","Typewords":["timestamp"]},{"Name":"Expires","Docs":"","Typewords":["timestamp"]},{"Name":"Description","Docs":"","Typewords":["string"]},{"Name":"LastUsed","Docs":"","Typewords":["timestamp"]}]},
+	"ImportJob": {"Name":"ImportJob","Docs":"","Fields":[{"Name":"ID","Docs":"","Typewords":["int64"]},{"Name":"Kind","Docs":"","Typewords":["string"]},{"Name":"Source","Docs":"","Typewords":["string"]},{"Name":"Mailbox","Docs":"","Typewords":["string"]},{"Name":"Total","Docs":"","Typewords":["int32"]},{"Name":"Done","Docs":"","Typewords":["int32"]},{"Name":"Imported","Docs":"","Typewords":["int32"]},{"Name":"Skipped","Docs":"","Typewords":["int32"]},{"Name":"Position","Docs":"","Typewords":["string"]},{"Name":"Started","Docs":"","Typewords":["timestamp"]},{"Name":"Updated","Docs":"","Typewords":["timestamp"]},{"Name":"Finished","Docs":"","Typewords":["timestamp"]}]},
 	"ClientConfigs": {"Name":"ClientConfigs","Docs":"","Fields":[{"Name":"Entries","Docs":"","Typewords":["[]","ClientConfigsEntry"]}]},
 	"ClientConfigsEntry": {"Name":"ClientConfigsEntry","Docs":"","Fields":[{"Name":"Protocol","Docs":"","Typewords":["string"]},{"Name":"Host","Docs":"","Typewords":["Domain"]},{"Name":"Port","Docs":"","Typewords":["int32"]},{"Name":"Listener","Docs":"","Typewords":["string"]},{"Name":"Note","Docs":"","Typewords":["string"]}]},
-	"HoldRule": {"Name":"HoldRule","Docs":"","Fields":[{"Name":"ID","Docs":"","Typewords":["int64"]},{"Name":"Account","Docs":"","Typewords":["string"]},{"Name":"SenderDomain","Docs":"","Typewords":["Domain"]},{"Name":"RecipientDomain","Docs":"","Typewords":["Domain"]},{"Name":"SenderDomainStr","Docs":"","Typewords":["string"]},{"Name":"RecipientDomainStr","Docs":"","Typewords":["string"]}]},
+	"HoldRule": {"Name":"HoldRule","Docs":"","Fields":[{"Name":"ID","Docs":"","Typewords":["int64"]},{"Name":"Account","Docs":"","Typewords":["string"]},{"Name":"SenderDomain","Docs":"","Typewords":["Domain"]},{"Name":"RecipientDomain","Docs":"","Typewords":["Domain"]},{"Name":"SenderDomainStr","Docs":"","Typewords":["string"]},{"Name":"RecipientDomainStr","Docs":"","Typewords":["string"]},{"Name":"Reason","Docs":"","Typewords":["string"]}]},
 	"Filter": {"Name":"Filter","Docs":"","Fields":[{"Name":"Max","Docs":"","Typewords":["int32"]},{"Name":"IDs","Docs":"","Typewords":["[]","int64"]},{"Name":"Account","Docs":"","Typewords":["string"]},{"Name":"From","Docs":"","Typewords":["string"]},{"Name":"To","Docs":"","Typewords":["string"]},{"Name":"Hold","Docs":"","Typewords":["nullable","bool"]},{"Name":"Submitted","Docs":"","Typewords":["string"]},{"Name":"NextAttempt","Docs":"","Typewords":["string"]},{"Name":"Transport","Docs":"","Typewords":["nullable","string"]}]},
 	"Sort": {"Name":"Sort","Docs":"","Fields":[{"Name":"Field","Docs":"","Typewords":["string"]},{"Name":"LastID","Docs":"","Typewords":["int64"]},{"Name":"Last","Docs":"","Typewords":["any"]},{"Name":"Asc","Docs":"","Typewords":["bool"]}]},
-	"Msg": {"Name":"Msg","Docs":"","Fields":[{"Name":"ID","Docs":"","Typewords":["int64"]},{"Name":"BaseID","Docs":"","Typewords":["int64"]},{"Name":"Queued","Docs":"","Typewords":["timestamp"]},{"Name":"Hold","Docs":"","Typewords":["bool"]},{"Name":"SenderAccount","Docs":"","Typewords":["string"]},{"Name":"SenderLocalpart","Docs":"","Typewords":["Localpart"]},{"Name":"SenderDomain","Docs":"","Typewords":["IPDomain"]},{"Name":"SenderDomainStr","Docs":"","Typewords":["string"]},{"Name":"FromID","Docs":"","Typewords":["string"]},{"Name":"RecipientLocalpart","Docs":"","Typewords":["Localpart"]},{"Name":"RecipientDomain","Docs":"","Typewords":["IPDomain"]},{"Name":"RecipientDomainStr","Docs":"","Typewords":["string"]},{"Name":"Attempts","Docs":"","Typewords":["int32"]},{"Name":"MaxAttempts","Docs":"","Typewords":["int32"]},{"Name":"DialedIPs","Docs":"","Typewords":["{}","[]","IP"]},{"Name":"NextAttempt","Docs":"","Typewords":["timestamp"]},{"Name":"LastAttempt","Docs":"","Typewords":["nullable","timestamp"]},{"Name":"Results","Docs":"","Typewords":["[]","MsgResult"]},{"Name":"Has8bit","Docs":"","Typewords":["bool"]},{"Name":"SMTPUTF8","Docs":"","Typewords":["bool"]},{"Name":"IsDMARCReport","Docs":"","Typewords":["bool"]},{"Name":"IsTLSReport","Docs":"","Typewords":["bool"]},{"Name":"Size","Docs":"","Typewords":["int64"]},{"Name":"MessageID","Docs":"","Typewords":["string"]},{"Name":"MsgPrefix","Docs":"","Typewords":["nullable","string"]},{"Name":"Subject","Docs":"","Typewords":["string"]},{"Name":"DSNUTF8","Docs":"","Typewords":["nullable","string"]},{"Name":"Transport","Docs":"","Typewords":["string"]},{"Name":"RequireTLS","Docs":"","Typewords":["nullable","bool"]},{"Name":"FutureReleaseRequest","Docs":"","Typewords":["string"]},{"Name":"Extra","Docs":"","Typewords":["{}","string"]}]},
+	"Msg": {"Name":"Msg","Docs":"","Fields":[{"Name":"ID","Docs":"","Typewords":["int64"]},{"Name":"BaseID","Docs":"","Typewords":["int64"]},{"Name":"Queued","Docs":"","Typewords":["timestamp"]},{"Name":"Hold","Docs":"","Typewords":["bool"]},{"Name":"SenderAccount","Docs":"","Typewords":["string"]},{"Name":"SenderLocalpart","Docs":"","Typewords":["Localpart"]},{"Name":"SenderDomain","Docs":"","Typewords":["IPDomain"]},{"Name":"SenderDomainStr","Docs":"","Typewords":["string"]},{"Name":"FromID","Docs":"","Typewords":["string"]},{"Name":"RecipientLocalpart","Docs":"","Typewords":["Localpart"]},{"Name":"RecipientDomain","Docs":"","Typewords":["IPDomain"]},{"Name":"RecipientDomainStr","Docs":"","Typewords":["string"]},{"Name":"Attempts","Docs":"","Typewords":["int32"]},{"Name":"MaxAttempts","Docs":"","Typewords":["int32"]},{"Name":"DialedIPs","Docs":"","Typewords":["{}","[]","IP"]},{"Name":"NextAttempt","Docs":"","Typewords":["timestamp"]},{"Name":"LastAttempt","Docs":"","Typewords":["nullable","timestamp"]},{"Name":"Results","Docs":"","Typewords":["[]","MsgResult"]},{"Name":"Has8bit","Docs":"","Typewords":["bool"]},{"Name":"SMTPUTF8","Docs":"","Typewords":["bool"]},{"Name":"IsDMARCReport","Docs":"","Typewords":["bool"]},{"Name":"IsTLSReport","Docs":"","Typewords":["bool"]},{"Name":"Size","Docs":"","Typewords":["int64"]},{"Name":"MessageID","Docs":"","Typewords":["string"]},{"Name":"MsgPrefix","Docs":"","Typewords":["nullable","string"]},{"Name":"Subject","Docs":"","Typewords":["string"]},{"Name":"DSNUTF8","Docs":"","Typewords":["nullable","string"]},{"Name":"Transport","Docs":"","Typewords":["string"]},{"Name":"FailoverIndex","Docs":"","Typewords":["int32"]},{"Name":"RequireTLS","Docs":"","Typewords":["nullable","bool"]},{"Name":"FutureReleaseRequest","Docs":"","Typewords":["string"]},{"Name":"DSNNotify","Docs":"","Typewords":["[]","string"]},{"Name":"DSNORCPT","Docs":"","Typewords":["string"]},{"Name":"DSNRet","Docs":"","Typewords":["string"]},{"Name":"DSNEnvID","Docs":"","Typewords":["string"]},{"Name":"Relayed","Docs":"","Typewords":["bool"]},{"Name":"Extra","Docs":"","Typewords":["{}","string"]}]},
 	"IPDomain": {"Name":"IPDomain","Docs":"","Fields":[{"Name":"IP","Docs":"","Typewords":["IP"]},{"Name":"Domain","Docs":"","Typewords":["Domain"]}]},
 	"MsgResult": {"Name":"MsgResult","Docs":"","Fields":[{"Name":"Start","Docs":"","Typewords":["timestamp"]},{"Name":"Duration","Docs":"","Typewords":["int64"]},{"Name":"Success","Docs":"","Typewords":["bool"]},{"Name":"Code","Docs":"","Typewords":["int32"]},{"Name":"Secode","Docs":"","Typewords":["string"]},{"Name":"Error","Docs":"","Typewords":["string"]}]},
 	"RetiredFilter": {"Name":"RetiredFilter","Docs":"","Fields":[{"Name":"Max","Docs":"","Typewords":["int32"]},{"Name":"IDs","Docs":"","Typewords":["[]","int64"]},{"Name":"Account","Docs":"","Typewords":["string"]},{"Name":"From","Docs":"","Typewords":["string"]},{"Name":"To","Docs":"","Typewords":["string"]},{"Name":"Submitted","Docs":"","Typewords":["string"]},{"Name":"LastActivity","Docs":"","Typewords":["string"]},{"Name":"Transport","Docs":"","Typewords":["nullable","string"]},{"Name":"Success","Docs":"","Typewords":["nullable","bool"]}]},
 	"RetiredSort": {"Name":"RetiredSort","Docs":"","Fields":[{"Name":"Field","Docs":"","Typewords":["string"]},{"Name":"LastID","Docs":"","Typewords":["int64"]},{"Name":"Last","Docs":"","Typewords":["any"]},{"Name":"Asc","Docs":"","Typewords":["bool"]}]},
 	"MsgRetired": {"Name":"MsgRetired","Docs":"","Fields":[{"Name":"ID","Docs":"","Typewords":["int64"]},{"Name":"BaseID","Docs":"","Typewords":["int64"]},{"Name":"Queued","Docs":"","Typewords":["timestamp"]},{"Name":"SenderAccount","Docs":"","Typewords":["string"]},{"Name":"SenderLocalpart","Docs":"","Typewords":["Localpart"]},{"Name":"SenderDomainStr","Docs":"","Typewords":["string"]},{"Name":"FromID","Docs":"","Typewords":["string"]},{"Name":"RecipientLocalpart","Docs":"","Typewords":["Localpart"]},{"Name":"RecipientDomain","Docs":"","Typewords":["IPDomain"]},{"Name":"RecipientDomainStr","Docs":"","Typewords":["string"]},{"Name":"Attempts","Docs":"","Typewords":["int32"]},{"Name":"MaxAttempts","Docs":"","Typewords":["int32"]},{"Name":"DialedIPs","Docs":"","Typewords":["{}","[]","IP"]},{"Name":"LastAttempt","Docs":"","Typewords":["nullable","timestamp"]},{"Name":"Results","Docs":"","Typewords":["[]","MsgResult"]},{"Name":"Has8bit","Docs":"","Typewords":["bool"]},{"Name":"SMTPUTF8","Docs":"","Typewords":["bool"]},{"Name":"IsDMARCReport","Docs":"","Typewords":["bool"]},{"Name":"IsTLSReport","Docs":"","Typewords":["bool"]},{"Name":"Size","Docs":"","Typewords":["int64"]},{"Name":"MessageID","Docs":"","Typewords":["string"]},{"Name":"Subject","Docs":"","Typewords":["string"]},{"Name":"Transport","Docs":"","Typewords":["string"]},{"Name":"RequireTLS","Docs":"","Typewords":["nullable","bool"]},{"Name":"FutureReleaseRequest","Docs":"","Typewords":["string"]},{"Name":"Extra","Docs":"","Typewords":["{}","string"]},{"Name":"LastActivity","Docs":"","Typewords":["timestamp"]},{"Name":"RecipientAddress","Docs":"","Typewords":["string"]},{"Name":"Success","Docs":"","Typewords":["bool"]},{"Name":"KeepUntil","Docs":"","Typewords":["timestamp"]}]},
+	"EventFilter": {"Name":"EventFilter","Docs":"","Fields":[{"Name":"Max","Docs":"","Typewords":["int32"]},{"Name":"Start","Docs":"","Typewords":["timestamp"]},{"Name":"End","Docs":"","Typewords":["timestamp"]},{"Name":"Kinds","Docs":"","Typewords":["[]","Kind"]},{"Name":"MessageID","Docs":"","Typewords":["string"]},{"Name":"QueueMsgID","Docs":"","Typewords":["int64"]},{"Name":"Account","Docs":"","Typewords":["string"]},{"Name":"Address","Docs":"","Typewords":["string"]}]},
+	"Event": {"Name":"Event","Docs":"","Fields":[{"Name":"ID","Docs":"","Typewords":["int64"]},{"Name":"Time","Docs":"","Typewords":["timestamp"]},{"Name":"Kind","Docs":"","Typewords":["Kind"]},{"Name":"MessageID","Docs":"","Typewords":["string"]},{"Name":"QueueMsgID","Docs":"","Typewords":["int64"]},{"Name":"Account","Docs":"","Typewords":["string"]},{"Name":"Mailbox","Docs":"","Typewords":["string"]},{"Name":"Sender","Docs":"","Typewords":["string"]},{"Name":"Recipient","Docs":"","Typewords":["string"]},{"Name":"RemoteIP","Docs":"","Typewords":["string"]},{"Name":"Success","Docs":"","Typewords":["bool"]},{"Name":"Code","Docs":"","Typewords":["int32"]},{"Name":"Secode","Docs":"","Typewords":["string"]},{"Name":"Detail","Docs":"","Typewords":["string"]}]},
 	"HookFilter": {"Name":"HookFilter","Docs":"","Fields":[{"Name":"Max","Docs":"","Typewords":["int32"]},{"Name":"IDs","Docs":"","Typewords":["[]","int64"]},{"Name":"Account","Docs":"","Typewords":["string"]},{"Name":"Submitted","Docs":"","Typewords":["string"]},{"Name":"NextAttempt","Docs":"","Typewords":["string"]},{"Name":"Event","Docs":"","Typewords":["string"]}]},
 	"HookSort": {"Name":"HookSort","Docs":"","Fields":[{"Name":"Field","Docs":"","Typewords":["string"]},{"Name":"LastID","Docs":"","Typewords":["int64"]},{"Name":"Last","Docs":"","Typewords":["any"]},{"Name":"Asc","Docs":"","Typewords":["bool"]}]},
-	"Hook": {"Name":"Hook","Docs":"","Fields":[{"Name":"ID","Docs":"","Typewords":["int64"]},{"Name":"QueueMsgID","Docs":"","Typewords":["int64"]},{"Name":"FromID","Docs":"","Typewords":["string"]},{"Name":"MessageID","Docs":"","Typewords":["string"]},{"Name":"Subject","Docs":"","Typewords":["string"]},{"Name":"Extra","Docs":"","Typewords":["{}","string"]},{"Name":"Account","Docs":"","Typewords":["string"]},{"Name":"URL","Docs":"","Typewords":["string"]},{"Name":"Authorization","Docs":"","Typewords":["string"]},{"Name":"IsIncoming","Docs":"","Typewords":["bool"]},{"Name":"OutgoingEvent","Docs":"","Typewords":["string"]},{"Name":"Payload","Docs":"","Typewords":["string"]},{"Name":"Submitted","Docs":"","Typewords":["timestamp"]},{"Name":"Attempts","Docs":"","Typewords":["int32"]},{"Name":"NextAttempt","Docs":"","Typewords":["timestamp"]},{"Name":"Results","Docs":"","Typewords":["[]","HookResult"]}]},
+	"Hook": {"Name":"Hook","Docs":"","Fields":[{"Name":"ID","Docs":"","Typewords":["int64"]},{"Name":"QueueMsgID","Docs":"","Typewords":["int64"]},{"Name":"FromID","Docs":"","Typewords":["string"]},{"Name":"MessageID","Docs":"","Typewords":["string"]},{"Name":"Subject","Docs":"","Typewords":["string"]},{"Name":"Extra","Docs":"","Typewords":["{}","string"]},{"Name":"Account","Docs":"","Typewords":["string"]},{"Name":"URL","Docs":"","Typewords":["string"]},{"Name":"Authorization","Docs":"","Typewords":["string"]},{"Name":"Signature","Docs":"","Typewords":["string"]},{"Name":"IsIncoming","Docs":"","Typewords":["bool"]},{"Name":"OutgoingEvent","Docs":"","Typewords":["string"]},{"Name":"AdminEvent","Docs":"","Typewords":["string"]},{"Name":"Payload","Docs":"","Typewords":["string"]},{"Name":"Submitted","Docs":"","Typewords":["timestamp"]},{"Name":"Attempts","Docs":"","Typewords":["int32"]},{"Name":"NextAttempt","Docs":"","Typewords":["timestamp"]},{"Name":"Results","Docs":"","Typewords":["[]","HookResult"]}]},
 	"HookResult": {"Name":"HookResult","Docs":"","Fields":[{"Name":"Start","Docs":"","Typewords":["timestamp"]},{"Name":"Duration","Docs":"","Typewords":["int64"]},{"Name":"URL","Docs":"","Typewords":["string"]},{"Name":"Success","Docs":"","Typewords":["bool"]},{"Name":"Code","Docs":"","Typewords":["int32"]},{"Name":"Error","Docs":"","Typewords":["string"]},{"Name":"Response","Docs":"","Typewords":["string"]}]},
 	"HookRetiredFilter": {"Name":"HookRetiredFilter","Docs":"","Fields":[{"Name":"Max","Docs":"","Typewords":["int32"]},{"Name":"IDs","Docs":"","Typewords":["[]","int64"]},{"Name":"Account","Docs":"","Typewords":["string"]},{"Name":"Submitted","Docs":"","Typewords":["string"]},{"Name":"LastActivity","Docs":"","Typewords":["string"]},{"Name":"Event","Docs":"","Typewords":["string"]}]},
 	"HookRetiredSort": {"Name":"HookRetiredSort","Docs":"","Fields":[{"Name":"Field","Docs":"","Typewords":["string"]},{"Name":"LastID","Docs":"","Typewords":["int64"]},{"Name":"Last","Docs":"","Typewords":["any"]},{"Name":"Asc","Docs":"","Typewords":["bool"]}]},
-	"HookRetired": {"Name":"HookRetired","Docs":"","Fields":[{"Name":"ID","Docs":"","Typewords":["int64"]},{"Name":"QueueMsgID","Docs":"","Typewords":["int64"]},{"Name":"FromID","Docs":"","Typewords":["string"]},{"Name":"MessageID","Docs":"","Typewords":["string"]},{"Name":"Subject","Docs":"","Typewords":["string"]},{"Name":"Extra","Docs":"","Typewords":["{}","string"]},{"Name":"Account","Docs":"","Typewords":["string"]},{"Name":"URL","Docs":"","Typewords":["string"]},{"Name":"Authorization","Docs":"","Typewords":["bool"]},{"Name":"IsIncoming","Docs":"","Typewords":["bool"]},{"Name":"OutgoingEvent","Docs":"","Typewords":["string"]},{"Name":"Payload","Docs":"","Typewords":["string"]},{"Name":"Submitted","Docs":"","Typewords":["timestamp"]},{"Name":"SupersededByID","Docs":"","Typewords":["int64"]},{"Name":"Attempts","Docs":"","Typewords":["int32"]},{"Name":"Results","Docs":"","Typewords":["[]","HookResult"]},{"Name":"Success","Docs":"","Typewords":["bool"]},{"Name":"LastActivity","Docs":"","Typewords":["timestamp"]},{"Name":"KeepUntil","Docs":"","Typewords":["timestamp"]}]},
+	"HookRetired": {"Name":"HookRetired","Docs":"","Fields":[{"Name":"ID","Docs":"","Typewords":["int64"]},{"Name":"QueueMsgID","Docs":"","Typewords":["int64"]},{"Name":"FromID","Docs":"","Typewords":["string"]},{"Name":"MessageID","Docs":"","Typewords":["string"]},{"Name":"Subject","Docs":"","Typewords":["string"]},{"Name":"Extra","Docs":"","Typewords":["{}","string"]},{"Name":"Account","Docs":"","Typewords":["string"]},{"Name":"URL","Docs":"","Typewords":["string"]},{"Name":"Authorization","Docs":"","Typewords":["bool"]},{"Name":"IsIncoming","Docs":"","Typewords":["bool"]},{"Name":"OutgoingEvent","Docs":"","Typewords":["string"]},{"Name":"AdminEvent","Docs":"","Typewords":["string"]},{"Name":"Payload","Docs":"","Typewords":["string"]},{"Name":"Submitted","Docs":"","Typewords":["timestamp"]},{"Name":"SupersededByID","Docs":"","Typewords":["int64"]},{"Name":"Attempts","Docs":"","Typewords":["int32"]},{"Name":"Results","Docs":"","Typewords":["[]","HookResult"]},{"Name":"Success","Docs":"","Typewords":["bool"]},{"Name":"LastActivity","Docs":"","Typewords":["timestamp"]},{"Name":"KeepUntil","Docs":"","Typewords":["timestamp"]}]},
 	"WebserverConfig": {"Name":"WebserverConfig","Docs":"","Fields":[{"Name":"WebDNSDomainRedirects","Docs":"","Typewords":["[]","[]","Domain"]},{"Name":"WebDomainRedirects","Docs":"","Typewords":["[]","[]","string"]},{"Name":"WebHandlers","Docs":"","Typewords":["[]","WebHandler"]}]},
 	"WebHandler": {"Name":"WebHandler","Docs":"","Fields":[{"Name":"LogName","Docs":"","Typewords":["string"]},{"Name":"Domain","Docs":"","Typewords":["string"]},{"Name":"PathRegexp","Docs":"","Typewords":["string"]},{"Name":"DontRedirectPlainHTTP","Docs":"","Typewords":["bool"]},{"Name":"Compress","Docs":"","Typewords":["bool"]},{"Name":"WebStatic","Docs":"","Typewords":["nullable","WebStatic"]},{"Name":"WebRedirect","Docs":"","Typewords":["nullable","WebRedirect"]},{"Name":"WebForward","Docs":"","Typewords":["nullable","WebForward"]},{"Name":"WebInternal","Docs":"","Typewords":["nullable","WebInternal"]},{"Name":"Name","Docs":"","Typewords":["string"]},{"Name":"DNSDomain","Docs":"","Typewords":["Domain"]}]},
 	"WebStatic": {"Name":"WebStatic","Docs":"","Fields":[{"Name":"StripPrefix","Docs":"","Typewords":["string"]},{"Name":"Root","Docs":"","Typewords":["string"]},{"Name":"ListFiles","Docs":"","Typewords":["bool"]},{"Name":"ContinueNotFound","Docs":"","Typewords":["bool"]},{"Name":"ResponseHeaders","Docs":"","Typewords":["{}","string"]}]},
@@ -1261,9 +1681,19 @@ export const types: TypenameMap = {
 	"SuppressAddress": {"Name":"SuppressAddress","Docs":"","Fields":[{"Name":"ID","Docs":"","Typewords":["int64"]},{"Name":"Inserted","Docs":"","Typewords":["timestamp"]},{"Name":"ReportingAddress","Docs":"","Typewords":["string"]},{"Name":"Until","Docs":"","Typewords":["timestamp"]},{"Name":"Comment","Docs":"","Typewords":["string"]}]},
 	"TLSResult": {"Name":"TLSResult","Docs":"","Fields":[{"Name":"ID","Docs":"","Typewords":["int64"]},{"Name":"PolicyDomain","Docs":"","Typewords":["string"]},{"Name":"DayUTC","Docs":"","Typewords":["string"]},{"Name":"RecipientDomain","Docs":"","Typewords":["string"]},{"Name":"Created","Docs":"","Typewords":["timestamp"]},{"Name":"Updated","Docs":"","Typewords":["timestamp"]},{"Name":"IsHost","Docs":"","Typewords":["bool"]},{"Name":"SendReport","Docs":"","Typewords":["bool"]},{"Name":"SentToRecipientDomain","Docs":"","Typewords":["bool"]},{"Name":"RecipientDomainReportingAddresses","Docs":"","Typewords":["[]","string"]},{"Name":"SentToPolicyDomain","Docs":"","Typewords":["bool"]},{"Name":"Results","Docs":"","Typewords":["[]","Result"]}]},
 	"TLSRPTSuppressAddress": {"Name":"TLSRPTSuppressAddress","Docs":"","Fields":[{"Name":"ID","Docs":"","Typewords":["int64"]},{"Name":"Inserted","Docs":"","Typewords":["timestamp"]},{"Name":"ReportingAddress","Docs":"","Typewords":["string"]},{"Name":"Until","Docs":"","Typewords":["timestamp"]},{"Name":"Comment","Docs":"","Typewords":["string"]}]},
-	"Dynamic": {"Name":"Dynamic","Docs":"","Fields":[{"Name":"Domains","Docs":"","Typewords":["{}","ConfigDomain"]},{"Name":"Accounts","Docs":"","Typewords":["{}","Account"]},{"Name":"WebDomainRedirects","Docs":"","Typewords":["{}","string"]},{"Name":"WebHandlers","Docs":"","Typewords":["[]","WebHandler"]},{"Name":"Routes","Docs":"","Typewords":["[]","Route"]},{"Name":"MonitorDNSBLs","Docs":"","Typewords":["[]","string"]},{"Name":"MonitorDNSBLZones","Docs":"","Typewords":["[]","Domain"]}]},
+	"Dynamic": {"Name":"Dynamic","Docs":"","Fields":[{"Name":"Domains","Docs":"","Typewords":["{}","ConfigDomain"]},{"Name":"Accounts","Docs":"","Typewords":["{}","Account"]},{"Name":"WebDomainRedirects","Docs":"","Typewords":["{}","string"]},{"Name":"WebHandlers","Docs":"","Typewords":["[]","WebHandler"]},{"Name":"Routes","Docs":"","Typewords":["[]","Route"]},{"Name":"MonitorDNSBLs","Docs":"","Typewords":["[]","string"]},{"Name":"DomainAdmins","Docs":"","Typewords":["{}","DomainAdmin"]},{"Name":"AdminTokens","Docs":"","Typewords":["{}","AdminToken"]},{"Name":"AdminWebhook","Docs":"","Typewords":["nullable","AdminWebhook"]},{"Name":"IMAPClientRules","Docs":"","Typewords":["[]","IMAPClientRule"]},{"Name":"MonitorDNSBLZones","Docs":"","Typewords":["[]","Domain"]}]},
+	"DomainAdmin": {"Name":"DomainAdmin","Docs":"","Fields":[{"Name":"Domains","Docs":"","Typewords":["[]","string"]},{"Name":"PasswordHash","Docs":"","Typewords":["string"]}]},
+	"AdminToken": {"Name":"AdminToken","Docs":"","Fields":[{"Name":"TokenHash","Docs":"","Typewords":["string"]},{"Name":"Functions","Docs":"","Typewords":["[]","string"]},{"Name":"DomainAdmin","Docs":"","Typewords":["string"]}]},
+	"AdminWebhook": {"Name":"AdminWebhook","Docs":"","Fields":[{"Name":"URL","Docs":"","Typewords":["string"]},{"Name":"Authorization","Docs":"","Typewords":["string"]},{"Name":"Secret","Docs":"","Typewords":["string"]},{"Name":"Events","Docs":"","Typewords":["[]","string"]}]},
+	"IMAPClientRule": {"Name":"IMAPClientRule","Docs":"","Fields":[{"Name":"ParamsRegexp","Docs":"","Typewords":["{}","string"]},{"Name":"Accounts","Docs":"","Typewords":["[]","string"]},{"Name":"Action","Docs":"","Typewords":["string"]},{"Name":"Message","Docs":"","Typewords":["string"]}]},
 	"TLSPublicKey": {"Name":"TLSPublicKey","Docs":"","Fields":[{"Name":"Fingerprint","Docs":"","Typewords":["string"]},{"Name":"Created","Docs":"","Typewords":["timestamp"]},{"Name":"Type","Docs":"","Typewords":["string"]},{"Name":"Name","Docs":"","Typewords":["string"]},{"Name":"NoIMAPPreauth","Docs":"","Typewords":["bool"]},{"Name":"CertDER","Docs":"","Typewords":["nullable","string"]},{"Name":"Account","Docs":"","Typewords":["string"]},{"Name":"LoginAddress","Docs":"","Typewords":["string"]}]},
 	"LoginAttempt": {"Name":"LoginAttempt","Docs":"","Fields":[{"Name":"Key","Docs":"","Typewords":["nullable","string"]},{"Name":"Last","Docs":"","Typewords":["timestamp"]},{"Name":"First","Docs":"","Typewords":["timestamp"]},{"Name":"Count","Docs":"","Typewords":["int64"]},{"Name":"AccountName","Docs":"","Typewords":["string"]},{"Name":"LoginAddress","Docs":"","Typewords":["string"]},{"Name":"RemoteIP","Docs":"","Typewords":["string"]},{"Name":"LocalIP","Docs":"","Typewords":["string"]},{"Name":"TLS","Docs":"","Typewords":["string"]},{"Name":"TLSPubKeyFingerprint","Docs":"","Typewords":["string"]},{"Name":"Protocol","Docs":"","Typewords":["string"]},{"Name":"UserAgent","Docs":"","Typewords":["string"]},{"Name":"AuthMech","Docs":"","Typewords":["string"]},{"Name":"Result","Docs":"","Typewords":["AuthResult"]}]},
+	"AuthLockout": {"Name":"AuthLockout","Docs":"","Fields":[{"Name":"Key","Docs":"","Typewords":["string"]},{"Name":"First","Docs":"","Typewords":["timestamp"]},{"Name":"Last","Docs":"","Typewords":["timestamp"]},{"Name":"Failures","Docs":"","Typewords":["int32"]},{"Name":"Until","Docs":"","Typewords":["timestamp"]}]},
+	"JunkDecision": {"Name":"JunkDecision","Docs":"","Fields":[{"Name":"ID","Docs":"","Typewords":["int64"]},{"Name":"Time","Docs":"","Typewords":["timestamp"]},{"Name":"MessageID","Docs":"","Typewords":["string"]},{"Name":"MailFrom","Docs":"","Typewords":["string"]},{"Name":"MsgFrom","Docs":"","Typewords":["string"]},{"Name":"Recipient","Docs":"","Typewords":["string"]},{"Name":"RemoteIP","Docs":"","Typewords":["string"]},{"Name":"Subject","Docs":"","Typewords":["string"]},{"Name":"Accept","Docs":"","Typewords":["bool"]},{"Name":"Mailbox","Docs":"","Typewords":["string"]},{"Name":"Reason","Docs":"","Typewords":["string"]},{"Name":"ReasonText","Docs":"","Typewords":["[]","string"]},{"Name":"ReputationMethod","Docs":"","Typewords":["string"]},{"Name":"ReputationJunk","Docs":"","Typewords":["nullable","bool"]},{"Name":"ReputationConclusive","Docs":"","Typewords":["bool"]},{"Name":"ContentAnalyzed","Docs":"","Typewords":["bool"]},{"Name":"Probability","Docs":"","Typewords":["float64"]},{"Name":"Significant","Docs":"","Typewords":["bool"]},{"Name":"Threshold","Docs":"","Typewords":["float64"]},{"Name":"HamWords","Docs":"","Typewords":["[]","WordScore"]},{"Name":"SpamWords","Docs":"","Typewords":["[]","WordScore"]},{"Name":"DNSBLZone","Docs":"","Typewords":["string"]}]},
+	"WordScore": {"Name":"WordScore","Docs":"","Fields":[{"Name":"Word","Docs":"","Typewords":["string"]},{"Name":"Score","Docs":"","Typewords":["float64"]}]},
+	"IMAPClient": {"Name":"IMAPClient","Docs":"","Fields":[{"Name":"Key","Docs":"","Typewords":["nullable","string"]},{"Name":"AccountName","Docs":"","Typewords":["string"]},{"Name":"Name","Docs":"","Typewords":["string"]},{"Name":"Version","Docs":"","Typewords":["string"]},{"Name":"Vendor","Docs":"","Typewords":["string"]},{"Name":"OS","Docs":"","Typewords":["string"]},{"Name":"OSVersion","Docs":"","Typewords":["string"]},{"Name":"Params","Docs":"","Typewords":["{}","string"]},{"Name":"First","Docs":"","Typewords":["timestamp"]},{"Name":"Last","Docs":"","Typewords":["timestamp"]},{"Name":"Count","Docs":"","Typewords":["int64"]},{"Name":"Denied","Docs":"","Typewords":["int64"]}]},
+	"Connection": {"Name":"Connection","Docs":"","Fields":[{"Name":"CID","Docs":"","Typewords":["int64"]},{"Name":"Listener","Docs":"","Typewords":["string"]},{"Name":"RemoteIP","Docs":"","Typewords":["string"]},{"Name":"TLS","Docs":"","Typewords":["bool"]},{"Name":"Start","Docs":"","Typewords":["timestamp"]},{"Name":"LastActive","Docs":"","Typewords":["timestamp"]},{"Name":"State","Docs":"","Typewords":["string"]},{"Name":"Username","Docs":"","Typewords":["string"]},{"Name":"Account","Docs":"","Typewords":["string"]},{"Name":"Command","Docs":"","Typewords":["string"]}]},
+	"LoginSession": {"Name":"LoginSession","Docs":"","Fields":[{"Name":"ID","Docs":"","Typewords":["int64"]},{"Name":"Created","Docs":"","Typewords":["timestamp"]},{"Name":"Expires","Docs":"","Typewords":["timestamp"]},{"Name":"AccountName","Docs":"","Typewords":["string"]},{"Name":"LoginAddress","Docs":"","Typewords":["string"]}]},
 	"CSRFToken": {"Name":"CSRFToken","Docs":"","Values":null},
 	"DMARCPolicy": {"Name":"DMARCPolicy","Docs":"","Values":[{"Name":"PolicyEmpty","Value":"","Docs":""},{"Name":"PolicyNone","Value":"none","Docs":""},{"Name":"PolicyQuarantine","Value":"quarantine","Docs":""},{"Name":"PolicyReject","Value":"reject","Docs":""}]},
 	"Align": {"Name":"Align","Docs":"","Values":[{"Name":"AlignStrict","Value":"s","Docs":""},{"Name":"AlignRelaxed","Value":"r","Docs":""}]},
@@ -1271,7 +1701,8 @@ export const types: TypenameMap = {
 	"Mode": {"Name":"Mode","Docs":"","Values":[{"Name":"ModeEnforce","Value":"enforce","Docs":""},{"Name":"ModeTesting","Value":"testing","Docs":""},{"Name":"ModeNone","Value":"none","Docs":""}]},
 	"Localpart": {"Name":"Localpart","Docs":"","Values":null},
 	"IP": {"Name":"IP","Docs":"","Values":[]},
-	"AuthResult": {"Name":"AuthResult","Docs":"","Values":[{"Name":"AuthSuccess","Value":"ok","Docs":""},{"Name":"AuthBadUser","Value":"baduser","Docs":""},{"Name":"AuthBadPassword","Value":"badpassword","Docs":""},{"Name":"AuthBadCredentials","Value":"badcreds","Docs":""},{"Name":"AuthBadChannelBinding","Value":"badchanbind","Docs":""},{"Name":"AuthBadProtocol","Value":"badprotocol","Docs":""},{"Name":"AuthLoginDisabled","Value":"logindisabled","Docs":""},{"Name":"AuthError","Value":"error","Docs":""},{"Name":"AuthAborted","Value":"aborted","Docs":""}]},
+	"Kind": {"Name":"Kind","Docs":"","Values":[{"Name":"KindReceived","Value":"received","Docs":""},{"Name":"KindJunkVerdict","Value":"junkverdict","Docs":""},{"Name":"KindDelivered","Value":"delivered","Docs":""},{"Name":"KindQueued","Value":"queued","Docs":""},{"Name":"KindAttempt","Value":"attempt","Docs":""},{"Name":"KindSent","Value":"sent","Docs":""},{"Name":"KindBounced","Value":"bounced","Docs":""}]},
+	"AuthResult": {"Name":"AuthResult","Docs":"","Values":[{"Name":"AuthSuccess","Value":"ok","Docs":""},{"Name":"AuthBadUser","Value":"baduser","Docs":""},{"Name":"AuthBadPassword","Value":"badpassword","Docs":""},{"Name":"AuthBadCredentials","Value":"badcreds","Docs":""},{"Name":"AuthBadChannelBinding","Value":"badchanbind","Docs":""},{"Name":"AuthBadProtocol","Value":"badprotocol","Docs":""},{"Name":"AuthLoginDisabled","Value":"logindisabled","Docs":""},{"Name":"AuthNetworkDenied","Value":"networkdenied","Docs":""},{"Name":"AuthClientDenied","Value":"clientdenied","Docs":""},{"Name":"AuthError","Value":"error","Docs":""},{"Name":"AuthAborted","Value":"aborted","Docs":""},{"Name":"AuthLockedOut","Value":"lockedout","Docs":""},{"Name":"AuthTooManyConns","Value":"toomanyconns","Docs":""}]},
 }
 
 export const parser = {
@@ -1312,19 +1743,32 @@ export const parser = {
 	Canonicalization: (v: any) => parse("Canonicalization", v) as Canonicalization,
 	DMARC: (v: any) => parse("DMARC", v) as DMARC,
 	MTASTS: (v: any) => parse("MTASTS", v) as MTASTS,
+	WKD: (v: any) => parse("WKD", v) as WKD,
+	WellKnown: (v: any) => parse("WellKnown", v) as WellKnown,
+	SecurityTXT: (v: any) => parse("SecurityTXT", v) as SecurityTXT,
 	TLSRPT: (v: any) => parse("TLSRPT", v) as TLSRPT,
+	SPF: (v: any) => parse("SPF", v) as SPF,
 	Route: (v: any) => parse("Route", v) as Route,
 	Alias: (v: any) => parse("Alias", v) as Alias,
 	AliasAddress: (v: any) => parse("AliasAddress", v) as AliasAddress,
 	Address: (v: any) => parse("Address", v) as Address,
 	Destination: (v: any) => parse("Destination", v) as Destination,
 	Ruleset: (v: any) => parse("Ruleset", v) as Ruleset,
+	DuplicateWindow: (v: any) => parse("DuplicateWindow", v) as DuplicateWindow,
+	Forward: (v: any) => parse("Forward", v) as Forward,
+	InboundHeaders: (v: any) => parse("InboundHeaders", v) as InboundHeaders,
 	Account: (v: any) => parse("Account", v) as Account,
 	OutgoingWebhook: (v: any) => parse("OutgoingWebhook", v) as OutgoingWebhook,
 	IncomingWebhook: (v: any) => parse("IncomingWebhook", v) as IncomingWebhook,
 	SubjectPass: (v: any) => parse("SubjectPass", v) as SubjectPass,
 	AutomaticJunkFlags: (v: any) => parse("AutomaticJunkFlags", v) as AutomaticJunkFlags,
 	JunkFilter: (v: any) => parse("JunkFilter", v) as JunkFilter,
+	AutoArchive: (v: any) => parse("AutoArchive", v) as AutoArchive,
+	ArchiveTier: (v: any) => parse("ArchiveTier", v) as ArchiveTier,
+	MessageCompression: (v: any) => parse("MessageCompression", v) as MessageCompression,
+	MessageEncryption: (v: any) => parse("MessageEncryption", v) as MessageEncryption,
+	SubmissionChecks: (v: any) => parse("SubmissionChecks", v) as SubmissionChecks,
+	TLSClientAuth: (v: any) => parse("TLSClientAuth", v) as TLSClientAuth,
 	AddressAlias: (v: any) => parse("AddressAlias", v) as AddressAlias,
 	PolicyRecord: (v: any) => parse("PolicyRecord", v) as PolicyRecord,
 	TLSReportRecord: (v: any) => parse("TLSReportRecord", v) as TLSReportRecord,
@@ -1348,7 +1792,14 @@ export const parser = {
 	DKIMAuthResult: (v: any) => parse("DKIMAuthResult", v) as DKIMAuthResult,
 	SPFAuthResult: (v: any) => parse("SPFAuthResult", v) as SPFAuthResult,
 	DMARCSummary: (v: any) => parse("DMARCSummary", v) as DMARCSummary,
+	Advice: (v: any) => parse("Advice", v) as Advice,
+	AdviceSource: (v: any) => parse("AdviceSource", v) as AdviceSource,
+	SpoofIncident: (v: any) => parse("SpoofIncident", v) as SpoofIncident,
 	Reverse: (v: any) => parse("Reverse", v) as Reverse,
+	ConfigPreview: (v: any) => parse("ConfigPreview", v) as ConfigPreview,
+	AddressEntry: (v: any) => parse("AddressEntry", v) as AddressEntry,
+	LoginToken: (v: any) => parse("LoginToken", v) as LoginToken,
+	ImportJob: (v: any) => parse("ImportJob", v) as ImportJob,
 	ClientConfigs: (v: any) => parse("ClientConfigs", v) as ClientConfigs,
 	ClientConfigsEntry: (v: any) => parse("ClientConfigsEntry", v) as ClientConfigsEntry,
 	HoldRule: (v: any) => parse("HoldRule", v) as HoldRule,
@@ -1360,6 +1811,8 @@ export const parser = {
 	RetiredFilter: (v: any) => parse("RetiredFilter", v) as RetiredFilter,
 	RetiredSort: (v: any) => parse("RetiredSort", v) as RetiredSort,
 	MsgRetired: (v: any) => parse("MsgRetired", v) as MsgRetired,
+	EventFilter: (v: any) => parse("EventFilter", v) as EventFilter,
+	Event: (v: any) => parse("Event", v) as Event,
 	HookFilter: (v: any) => parse("HookFilter", v) as HookFilter,
 	HookSort: (v: any) => parse("HookSort", v) as HookSort,
 	Hook: (v: any) => parse("Hook", v) as Hook,
@@ -1384,8 +1837,18 @@ export const parser = {
 	TLSResult: (v: any) => parse("TLSResult", v) as TLSResult,
 	TLSRPTSuppressAddress: (v: any) => parse("TLSRPTSuppressAddress", v) as TLSRPTSuppressAddress,
 	Dynamic: (v: any) => parse("Dynamic", v) as Dynamic,
+	DomainAdmin: (v: any) => parse("DomainAdmin", v) as DomainAdmin,
+	AdminToken: (v: any) => parse("AdminToken", v) as AdminToken,
+	AdminWebhook: (v: any) => parse("AdminWebhook", v) as AdminWebhook,
+	IMAPClientRule: (v: any) => parse("IMAPClientRule", v) as IMAPClientRule,
 	TLSPublicKey: (v: any) => parse("TLSPublicKey", v) as TLSPublicKey,
 	LoginAttempt: (v: any) => parse("LoginAttempt", v) as LoginAttempt,
+	AuthLockout: (v: any) => parse("AuthLockout", v) as AuthLockout,
+	JunkDecision: (v: any) => parse("JunkDecision", v) as JunkDecision,
+	WordScore: (v: any) => parse("WordScore", v) as WordScore,
+	IMAPClient: (v: any) => parse("IMAPClient", v) as IMAPClient,
+	Connection: (v: any) => parse("Connection", v) as Connection,
+	LoginSession: (v: any) => parse("LoginSession", v) as LoginSession,
 	CSRFToken: (v: any) => parse("CSRFToken", v) as CSRFToken,
 	DMARCPolicy: (v: any) => parse("DMARCPolicy", v) as DMARCPolicy,
 	Align: (v: any) => parse("Align", v) as Align,
@@ -1393,6 +1856,7 @@ export const parser = {
 	Mode: (v: any) => parse("Mode", v) as Mode,
 	Localpart: (v: any) => parse("Localpart", v) as Localpart,
 	IP: (v: any) => parse("IP", v) as IP,
+	Kind: (v: any) => parse("Kind", v) as Kind,
 	AuthResult: (v: any) => parse("AuthResult", v) as AuthResult,
 }
 
@@ -1437,12 +1901,13 @@ export class Client {
 	}
 
 	// Login returns a session token for the credentials, or fails with error code
-	// "user:badLogin". Call LoginPrep to get a loginToken.
-	async Login(loginToken: string, password: string): Promise<CSRFToken> {
+	// "user:badLogin". Call LoginPrep to get a loginToken. Username is empty for the
+	// global admin, or the name of a domain admin.
+	async Login(loginToken: string, username: string, password: string): Promise<CSRFToken> {
 		const fn: string = "Login"
-		const paramTypes: string[][] = [["string"],["string"]]
+		const paramTypes: string[][] = [["string"],["string"],["string"]]
 		const returnTypes: string[][] = [["CSRFToken"]]
-		const params: any[] = [loginToken, password]
+		const params: any[] = [loginToken, username, password]
 		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as CSRFToken
 	}
 
@@ -1465,6 +1930,16 @@ export class Client {
 		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as CheckResult
 	}
 
+	// DomainAdminScope returns the name and domains of the logged in domain admin. The
+	// name is empty for the global admin, which can manage all domains.
+	async DomainAdminScope(): Promise<[string, Domain[] | null]> {
+		const fn: string = "DomainAdminScope"
+		const paramTypes: string[][] = []
+		const returnTypes: string[][] = [["string"],["[]","Domain"]]
+		const params: any[] = []
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as [string, Domain[] | null]
+	}
+
 	// Domains returns all configured domain names.
 	async Domains(): Promise<ConfigDomain[] | null> {
 		const fn: string = "Domains"
@@ -1608,6 +2083,27 @@ export class Client {
 		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as DMARCSummary[] | null
 	}
 
+	// DMARCAdvice returns a recommendation for the DMARC policy of a domain, based on
+	// received DMARC aggregate reports of the past 30 days.
+	async DMARCAdvice(domain: string): Promise<Advice> {
+		const fn: string = "DMARCAdvice"
+		const paramTypes: string[][] = [["string"]]
+		const returnTypes: string[][] = [["Advice"]]
+		const params: any[] = [domain]
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as Advice
+	}
+
+	// DMARCSpoofIncidents returns incidents with a surge of incoming messages failing
+	// DMARC for a domain (or all domains if empty), overlapping with period
+	// start/end. The most recent incident is first.
+	async DMARCSpoofIncidents(start: Date, end: Date, domain: string): Promise<SpoofIncident[] | null> {
+		const fn: string = "DMARCSpoofIncidents"
+		const paramTypes: string[][] = [["timestamp"],["timestamp"],["string"]]
+		const returnTypes: string[][] = [["[]","SpoofIncident"]]
+		const params: any[] = [start, end, domain]
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as SpoofIncident[] | null
+	}
+
 	// LookupIP does a reverse lookup of ip.
 	async LookupIP(ip: string): Promise<Reverse> {
 		const fn: string = "LookupIP"
@@ -1650,6 +2146,17 @@ export class Client {
 		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as string[] | null
 	}
 
+	// DomainRecordsExport returns the DNS records that should exist for the
+	// configured domain in a format for a DNS provider: "zone", "cloudflare",
+	// "route53" or "terraform".
+	async DomainRecordsExport(domain: string, format: string): Promise<string> {
+		const fn: string = "DomainRecordsExport"
+		const paramTypes: string[][] = [["string"],["string"]]
+		const returnTypes: string[][] = [["string"]]
+		const params: any[] = [domain, format]
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as string
+	}
+
 	// DomainAdd adds a new domain and reloads the configuration.
 	async DomainAdd(disabled: boolean, domain: string, accountName: string, localpart: string): Promise<void> {
 		const fn: string = "DomainAdd"
@@ -1669,15 +2176,26 @@ export class Client {
 	}
 
 	// AccountAdd adds existing a new account, with an initial email address, and
-	// reloads the configuration.
-	async AccountAdd(accountName: string, address: string): Promise<void> {
+	// reloads the configuration. If template is not empty, the settings of the
+	// account template are used for the new account.
+	async AccountAdd(accountName: string, address: string, template: string): Promise<void> {
 		const fn: string = "AccountAdd"
-		const paramTypes: string[][] = [["string"],["string"]]
+		const paramTypes: string[][] = [["string"],["string"],["string"]]
 		const returnTypes: string[][] = []
-		const params: any[] = [accountName, address]
+		const params: any[] = [accountName, address, template]
 		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as void
 	}
 
+	// AccountTemplates returns the names of the account templates that can be used
+	// when adding an account.
+	async AccountTemplates(): Promise<string[] | null> {
+		const fn: string = "AccountTemplates"
+		const paramTypes: string[][] = []
+		const returnTypes: string[][] = [["[]","string"]]
+		const params: any[] = []
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as string[] | null
+	}
+
 	// AccountRemove removes an existing account and reloads the configuration.
 	async AccountRemove(accountName: string): Promise<void> {
 		const fn: string = "AccountRemove"
@@ -1705,9 +2223,80 @@ export class Client {
 		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as void
 	}
 
+	// DomainAddPreview validates adding a domain like DomainAdd, returning the
+	// changes to the configuration without making them.
+	async DomainAddPreview(disabled: boolean, domain: string, accountName: string, localpart: string): Promise<ConfigPreview> {
+		const fn: string = "DomainAddPreview"
+		const paramTypes: string[][] = [["bool"],["string"],["string"],["string"]]
+		const returnTypes: string[][] = [["ConfigPreview"]]
+		const params: any[] = [disabled, domain, accountName, localpart]
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as ConfigPreview
+	}
+
+	// AddressRemovePreview validates removing an address like AddressRemove,
+	// returning the changes to the configuration without making them.
+	async AddressRemovePreview(address: string): Promise<ConfigPreview> {
+		const fn: string = "AddressRemovePreview"
+		const paramTypes: string[][] = [["string"]]
+		const returnTypes: string[][] = [["ConfigPreview"]]
+		const params: any[] = [address]
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as ConfigPreview
+	}
+
+	// DestinationRulesetsSave replaces the rulesets of a destination (address) of an
+	// account.
+	async DestinationRulesetsSave(accountName: string, destName: string, rulesets: Ruleset[] | null): Promise<void> {
+		const fn: string = "DestinationRulesetsSave"
+		const paramTypes: string[][] = [["string"],["string"],["[]","Ruleset"]]
+		const returnTypes: string[][] = []
+		const params: any[] = [accountName, destName, rulesets]
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as void
+	}
+
+	// DestinationRulesetsSavePreview validates new rulesets for a destination like
+	// DestinationRulesetsSave, returning the changes to the configuration without
+	// making them.
+	async DestinationRulesetsSavePreview(accountName: string, destName: string, rulesets: Ruleset[] | null): Promise<ConfigPreview> {
+		const fn: string = "DestinationRulesetsSavePreview"
+		const paramTypes: string[][] = [["string"],["string"],["[]","Ruleset"]]
+		const returnTypes: string[][] = [["ConfigPreview"]]
+		const params: any[] = [accountName, destName, rulesets]
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as ConfigPreview
+	}
+
+	// AddressSearch returns a page of configured addresses matching query, with the
+	// total number of matches. See admin.AddressSearch.
+	async AddressSearch(query: string, offset: number, limit: number): Promise<[AddressEntry[] | null, number]> {
+		const fn: string = "AddressSearch"
+		const paramTypes: string[][] = [["string"],["int32"],["int32"]]
+		const returnTypes: string[][] = [["[]","AddressEntry"],["int32"]]
+		const params: any[] = [query, offset, limit]
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as [AddressEntry[] | null, number]
+	}
+
+	// AddressesMove moves addresses to another account, keeping their destination
+	// configuration. Messages are not moved.
+	async AddressesMove(addresses: string[] | null, accountName: string): Promise<void> {
+		const fn: string = "AddressesMove"
+		const paramTypes: string[][] = [["[]","string"],["string"]]
+		const returnTypes: string[][] = []
+		const params: any[] = [addresses, accountName]
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as void
+	}
+
+	// AddressesDisabledSave disables or enables addresses.
+	async AddressesDisabledSave(addresses: string[] | null, disabled: boolean): Promise<void> {
+		const fn: string = "AddressesDisabledSave"
+		const paramTypes: string[][] = [["[]","string"],["bool"]]
+		const returnTypes: string[][] = []
+		const params: any[] = [addresses, disabled]
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as void
+	}
+
 	// SetPassword saves a new password for an account, invalidating the previous password.
 	// Sessions are not interrupted, and will keep working. New login attempts must use the new password.
-	// Password must be at least 8 characters.
+	// Password must be at least 8 characters, and meet the password policy from the
+	// configuration.
 	async SetPassword(accountName: string, password: string): Promise<void> {
 		const fn: string = "SetPassword"
 		const paramTypes: string[][] = [["string"],["string"]]
@@ -1716,6 +2305,72 @@ export class Client {
 		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as void
 	}
 
+	// SetPasswordHash sets the password of an account to a password hash imported from
+	// another system, e.g. when migrating from another mail server. Supported are
+	// bcrypt, argon2 and sha-crypt hashes in crypt format, optionally prefixed with a
+	// scheme in Dovecot syntax, e.g. "{SHA512-CRYPT}". Until the first successful
+	// login, only authentication with a plain text password is possible. At the first
+	// login, the password is upgraded to the native hashes.
+	async SetPasswordHash(accountName: string, passwordHash: string): Promise<void> {
+		const fn: string = "SetPasswordHash"
+		const paramTypes: string[][] = [["string"],["string"]]
+		const returnTypes: string[][] = []
+		const params: any[] = [accountName, passwordHash]
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as void
+	}
+
+	// LoginTokenAdd adds a short-lived login token for an account, and returns the
+	// token. The token can be used instead of the password with the PLAIN and LOGIN
+	// authentication mechanisms, e.g. by external webmail software such as Roundcube
+	// that authenticates users against mox without storing their passwords. The
+	// token cannot be retrieved later. Expires can be at most 7 days in the future.
+	// See ClientConfigsDomain for the IMAP and SMTP submission endpoints.
+	async LoginTokenAdd(accountName: string, description: string, expires: Date): Promise<string> {
+		const fn: string = "LoginTokenAdd"
+		const paramTypes: string[][] = [["string"],["string"],["timestamp"]]
+		const returnTypes: string[][] = [["string"]]
+		const params: any[] = [accountName, description, expires]
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as string
+	}
+
+	// LoginTokens returns the login tokens for an account.
+	async LoginTokens(accountName: string): Promise<LoginToken[] | null> {
+		const fn: string = "LoginTokens"
+		const paramTypes: string[][] = [["string"]]
+		const returnTypes: string[][] = [["[]","LoginToken"]]
+		const params: any[] = [accountName]
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as LoginToken[] | null
+	}
+
+	// LoginTokenRemove removes a login token of an account.
+	async LoginTokenRemove(accountName: string, id: number): Promise<void> {
+		const fn: string = "LoginTokenRemove"
+		const paramTypes: string[][] = [["string"],["int64"]]
+		const returnTypes: string[][] = []
+		const params: any[] = [accountName, id]
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as void
+	}
+
+	// ImportJobs returns the jobs for imports into an account from files or
+	// directories, with their progress, most recent first.
+	async ImportJobs(accountName: string): Promise<ImportJob[] | null> {
+		const fn: string = "ImportJobs"
+		const paramTypes: string[][] = [["string"]]
+		const returnTypes: string[][] = [["[]","ImportJob"]]
+		const params: any[] = [accountName]
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as ImportJob[] | null
+	}
+
+	// ImportJobRemove removes an import job of an account. Imported messages are not
+	// removed, but an interrupted import can no longer be continued.
+	async ImportJobRemove(accountName: string, id: number): Promise<void> {
+		const fn: string = "ImportJobRemove"
+		const paramTypes: string[][] = [["string"],["int64"]]
+		const returnTypes: string[][] = []
+		const params: any[] = [accountName, id]
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as void
+	}
+
 	// AccountSettingsSave set new settings for an account that only an admin can set.
 	async AccountSettingsSave(accountName: string, maxOutgoingMessagesPerDay: number, maxFirstTimeRecipientsPerDay: number, maxMsgSize: number, firstTimeSenderDelay: boolean, noCustomPassword: boolean): Promise<void> {
 		const fn: string = "AccountSettingsSave"
@@ -1734,6 +2389,26 @@ export class Client {
 		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as void
 	}
 
+	// AccountSuspend suspends an account: logins are rejected with message, and
+	// incoming deliveries are rejected with a temporary error, or a permanent error
+	// if reject is set.
+	async AccountSuspend(accountName: string, message: string, reject: boolean): Promise<void> {
+		const fn: string = "AccountSuspend"
+		const paramTypes: string[][] = [["string"],["string"],["bool"]]
+		const returnTypes: string[][] = []
+		const params: any[] = [accountName, message, reject]
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as void
+	}
+
+	// AccountResume ends the suspension of an account.
+	async AccountResume(accountName: string): Promise<void> {
+		const fn: string = "AccountResume"
+		const paramTypes: string[][] = [["string"]]
+		const returnTypes: string[][] = []
+		const params: any[] = [accountName]
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as void
+	}
+
 	// ClientConfigsDomain returns configurations for email clients, IMAP and
 	// Submission (SMTP) for the domain.
 	async ClientConfigsDomain(domain: string): Promise<ClientConfigs> {
@@ -1782,6 +2457,27 @@ export class Client {
 		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as void
 	}
 
+	// QueueHoldRuleRelease removes a hold rule and takes the messages in the queue
+	// matching it off hold, e.g. for an account held because it appeared
+	// compromised. Returns number of messages released.
+	async QueueHoldRuleRelease(holdRuleID: number): Promise<number> {
+		const fn: string = "QueueHoldRuleRelease"
+		const paramTypes: string[][] = [["int64"]]
+		const returnTypes: string[][] = [["int32"]]
+		const params: any[] = [holdRuleID]
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as number
+	}
+
+	// QueueHoldRuleDeny drops the messages on hold in the queue matching a hold rule.
+	// The hold rule is kept. Returns number of messages dropped.
+	async QueueHoldRuleDeny(holdRuleID: number): Promise<number> {
+		const fn: string = "QueueHoldRuleDeny"
+		const paramTypes: string[][] = [["int64"]]
+		const returnTypes: string[][] = [["int32"]]
+		const params: any[] = [holdRuleID]
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as number
+	}
+
 	// QueueList returns the messages currently in the outgoing queue.
 	async QueueList(filter: Filter, sort: Sort): Promise<Msg[] | null> {
 		const fn: string = "QueueList"
@@ -1868,6 +2564,46 @@ export class Client {
 		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as MsgRetired[] | null
 	}
 
+	// Events returns events in the lifecycle of messages from the event database,
+	// oldest first.
+	async Events(filter: EventFilter): Promise<Event[] | null> {
+		const fn: string = "Events"
+		const paramTypes: string[][] = [["EventFilter"]]
+		const returnTypes: string[][] = [["[]","Event"]]
+		const params: any[] = [filter]
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as Event[] | null
+	}
+
+	// MessageTrace returns all events for a message with the given Message-ID,
+	// across incoming and outgoing deliveries.
+	async MessageTrace(messageID: string): Promise<Event[] | null> {
+		const fn: string = "MessageTrace"
+		const paramTypes: string[][] = [["string"]]
+		const returnTypes: string[][] = [["[]","Event"]]
+		const params: any[] = [messageID]
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as Event[] | null
+	}
+
+	// DeliveryStatus returns the events for an outgoing message, by its ID in the
+	// queue, e.g. queueing, delivery attempts and the final result.
+	async DeliveryStatus(queueMsgID: number): Promise<Event[] | null> {
+		const fn: string = "DeliveryStatus"
+		const paramTypes: string[][] = [["int64"]]
+		const returnTypes: string[][] = [["[]","Event"]]
+		const params: any[] = [queueMsgID]
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as Event[] | null
+	}
+
+	// EventStats returns the number of events per kind (e.g. "received",
+	// "delivered", "sent", "bounced") between start and end.
+	async EventStats(start: Date, end: Date): Promise<{ [key: string]: number }> {
+		const fn: string = "EventStats"
+		const paramTypes: string[][] = [["timestamp"],["timestamp"]]
+		const returnTypes: string[][] = [["{}","int32"]]
+		const params: any[] = [start, end]
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as { [key: string]: number }
+	}
+
 	// HookQueueSize returns the number of webhooks still to be delivered.
 	async HookQueueSize(): Promise<number> {
 		const fn: string = "HookQueueSize"
@@ -2213,6 +2949,18 @@ export class Client {
 		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as void
 	}
 
+	// DomainDMARCPolicySave saves the policy for the suggested DMARC DNS record of a
+	// domain: "none", "quarantine", "reject" or empty for the default (reject), or
+	// "auto" for the policy recommended based on DMARC aggregate reports. A DMARC
+	// reporting address must be configured.
+	async DomainDMARCPolicySave(domainName: string, policy: string): Promise<void> {
+		const fn: string = "DomainDMARCPolicySave"
+		const paramTypes: string[][] = [["string"],["string"]]
+		const returnTypes: string[][] = []
+		const params: any[] = [domainName, policy]
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as void
+	}
+
 	// DomainTLSRPTAddressSave saves the TLS reporting address/processing
 	// configuration for a domain. If localpart is empty, processing reports is
 	// disabled.
@@ -2234,6 +2982,40 @@ export class Client {
 		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as void
 	}
 
+	// DomainMTASTSRecordPending returns the DNS TXT record for _mta-sts.<domain> to
+	// publish if the record in DNS does not have the policy ID of the configured
+	// MTA-STS policy, e.g. after the max age was increased automatically. Empty if the
+	// DNS record is up to date or no policy is configured.
+	async DomainMTASTSRecordPending(domainName: string): Promise<string> {
+		const fn: string = "DomainMTASTSRecordPending"
+		const paramTypes: string[][] = [["string"]]
+		const returnTypes: string[][] = [["string"]]
+		const params: any[] = [domainName]
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as string
+	}
+
+	// DomainWKDSave enables or disables serving OpenPGP keys published by accounts
+	// through the Web Key Directory for the domain. If accounts is non-empty, only
+	// those accounts can publish keys.
+	async DomainWKDSave(domainName: string, enabled: boolean, accounts: string[] | null): Promise<void> {
+		const fn: string = "DomainWKDSave"
+		const paramTypes: string[][] = [["string"],["bool"],["[]","string"]]
+		const returnTypes: string[][] = []
+		const params: any[] = [domainName, enabled, accounts]
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as void
+	}
+
+	// DomainWellKnownSave saves the files served under /.well-known/ for the domain,
+	// e.g. security.txt. If neither a security.txt nor a change-password URL is set,
+	// no well-known files are served.
+	async DomainWellKnownSave(domainName: string, wellKnown: WellKnown): Promise<void> {
+		const fn: string = "DomainWellKnownSave"
+		const paramTypes: string[][] = [["string"],["WellKnown"]]
+		const returnTypes: string[][] = []
+		const params: any[] = [domainName, wellKnown]
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as void
+	}
+
 	// DomainDKIMAdd adds a DKIM selector for a domain, generating a new private
 	// key. The selector is not enabled for signing.
 	async DomainDKIMAdd(domainName: string, selector: string, algorithm: string, hash: string, headerRelaxed: boolean, bodyRelaxed: boolean, seal: boolean, headers: string[] | null, lifetime: number): Promise<void> {
@@ -2330,6 +3112,88 @@ export class Client {
 		const params: any[] = [accountName, limit]
 		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as LoginAttempt[] | null
 	}
+
+	// AuthLockouts returns the counters of consecutive failed authentication attempts
+	// per remote IP and account, including active lockouts.
+	async AuthLockouts(): Promise<AuthLockout[] | null> {
+		const fn: string = "AuthLockouts"
+		const paramTypes: string[][] = []
+		const returnTypes: string[][] = [["[]","AuthLockout"]]
+		const params: any[] = []
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as AuthLockout[] | null
+	}
+
+	// AuthLockoutRemove removes a failure counter by its key, lifting any lockout for
+	// the remote IP or account.
+	async AuthLockoutRemove(key: string): Promise<void> {
+		const fn: string = "AuthLockoutRemove"
+		const paramTypes: string[][] = [["string"]]
+		const returnTypes: string[][] = []
+		const params: any[] = [key]
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as void
+	}
+
+	// JunkDecisions returns the most recent decisions about incoming messages for an
+	// account, with the inputs to the decisions. At most limit decisions are
+	// returned, if greater than 0.
+	async JunkDecisions(accountName: string, limit: number): Promise<JunkDecision[] | null> {
+		const fn: string = "JunkDecisions"
+		const paramTypes: string[][] = [["string"],["int32"]]
+		const returnTypes: string[][] = [["[]","JunkDecision"]]
+		const params: any[] = [accountName, limit]
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as JunkDecision[] | null
+	}
+
+	// IMAPClients returns the inventory of IMAP client software, as identified with
+	// the IMAP ID command at login, for accountName, or for all accounts if empty.
+	// Most recently used first.
+	async IMAPClients(accountName: string): Promise<IMAPClient[] | null> {
+		const fn: string = "IMAPClients"
+		const paramTypes: string[][] = [["string"]]
+		const returnTypes: string[][] = [["[]","IMAPClient"]]
+		const params: any[] = [accountName]
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as IMAPClient[] | null
+	}
+
+	// IMAPConnections returns the open IMAP connections, for all listeners. For
+	// domain admins, only authenticated connections of managed accounts are returned.
+	async IMAPConnections(): Promise<Connection[] | null> {
+		const fn: string = "IMAPConnections"
+		const paramTypes: string[][] = []
+		const returnTypes: string[][] = [["[]","Connection"]]
+		const params: any[] = []
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as Connection[] | null
+	}
+
+	// IMAPConnectionClose closes an open IMAP connection by its connection ID, after
+	// sending a BYE. A command in progress is aborted.
+	async IMAPConnectionClose(cid: number): Promise<void> {
+		const fn: string = "IMAPConnectionClose"
+		const paramTypes: string[][] = [["int64"]]
+		const returnTypes: string[][] = []
+		const params: any[] = [cid]
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as void
+	}
+
+	// WebSessions returns the login sessions for the webmail and account web
+	// interfaces of an account that have not expired, most recently used first.
+	async WebSessions(accountName: string): Promise<LoginSession[] | null> {
+		const fn: string = "WebSessions"
+		const paramTypes: string[][] = [["string"]]
+		const returnTypes: string[][] = [["[]","LoginSession"]]
+		const params: any[] = [accountName]
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as LoginSession[] | null
+	}
+
+	// WebSessionRemove removes a login session of an account, logging out the user
+	// of that session.
+	async WebSessionRemove(accountName: string, sessionID: number): Promise<void> {
+		const fn: string = "WebSessionRemove"
+		const paramTypes: string[][] = [["string"],["int64"]]
+		const returnTypes: string[][] = []
+		const params: any[] = [accountName, sessionID]
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as void
+	}
 }
 
 export const defaultBaseURL = (function() {
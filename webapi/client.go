@@ -134,6 +134,7 @@ func badResponse(hresp *http.Response) error {
 //   - multipleFrom, if multiple from addresses were specified.
 //   - badFrom, if a from address was specified that isn't configured for the account.
 //   - noRecipients, if no recipients were specified.
+//   - submissionCheck, if the message does not pass the submission checks configured for the account.
 //   - messageLimitReached, if the outgoing message rate limit was reached.
 //   - recipientLimitReached, if the outgoing new recipient rate limit was reached.
 //   - messageTooLarge, message larger than configured maximum size.
@@ -242,3 +243,13 @@ func (c Client) MessageFlagsRemove(ctx context.Context, req MessageFlagsRemoveRe
 func (c Client) MessageMove(ctx context.Context, req MessageMoveRequest) (resp MessageMoveResult, err error) {
 	return transact[MessageMoveResult](ctx, c, "MessageMove", req)
 }
+
+// DeliveryStatus returns the events in the delivery of an outgoing message, such
+// as being queued, failed delivery attempts, successful delivery to the next hop
+// or a bounce. Events are removed after a configurable period, 30 days by default.
+//
+// Error codes:
+//   - messageNotFound, if there are no events for the message.
+func (c Client) DeliveryStatus(ctx context.Context, req DeliveryStatusRequest) (resp DeliveryStatusResult, err error) {
+	return transact[DeliveryStatusResult](ctx, c, "DeliveryStatus", req)
+}
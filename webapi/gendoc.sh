@@ -89,6 +89,28 @@ and the contents of the first text and HTML parts. See [webhook.Incoming] for
 the fields in the JSON object. The full message and individual parts, including
 attachments, can be retrieved using the webapi.
 
+An admin webhook can be configured globally in domains.conf, for changes to the
+configuration such as domains, accounts and addresses being added or removed, and
+DKIM keys being added or removed. See [webhook.Admin] for the fields. If a
+secret is configured, the request has an "X-Mox-Webhook-Signature" header with
+value "sha256=" followed by the hex-encoded HMAC-SHA256 of the JSON body, keyed
+with the secret.
+
+# Changes
+
+An HTTP GET to /webapi/v0/changes, with HTTP basic authentication like the
+methods, starts a stream of server-sent events (content-type text/event-stream)
+for changes to the mailboxes and messages of the account, e.g. messages being
+added or removed, flags being changed, mailboxes being created or renamed. Each
+change is sent as an event of type "change" with a JSON object as data, with
+fields "Account", "Type" (e.g. "ChangeAddUID", "ChangeFlags",
+"ChangeRemoveUIDs", "ChangeAddMailbox") and "Change", with the details for the
+type of change. Useful for external indexing and automation without polling
+over IMAP. Unrecognized types should be ignored, new types may be added. Admins
+can get a similar stream with changes for all accounts at /admin/changes (or
+for a single account with query string parameter "account"), authenticated
+with a webadmin session.
+
 # Transactional email
 
 When sending transactional emails, potentially to many recipients, it is
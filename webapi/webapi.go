@@ -27,6 +27,7 @@ type Methods interface {
 	MessageFlagsAdd(ctx context.Context, request MessageFlagsAddRequest) (response MessageFlagsAddResult, err error)
 	MessageFlagsRemove(ctx context.Context, request MessageFlagsRemoveRequest) (response MessageFlagsRemoveResult, err error)
 	MessageMove(ctx context.Context, request MessageMoveRequest) (response MessageMoveResult, err error)
+	DeliveryStatus(ctx context.Context, request DeliveryStatusRequest) (response DeliveryStatusResult, err error)
 }
 
 // Error indicates an API-related error.
@@ -143,6 +144,14 @@ type SendRequest struct {
 
 	// Whether to store outgoing message in designated Sent mailbox (if configured).
 	SaveSent bool
+
+	// If set, List-Unsubscribe and List-Unsubscribe-Post headers are added to the
+	// message for each recipient, with a one-click unsubscribe link that adds the
+	// recipient to the suppression list of the account. The message is DKIM-signed
+	// for each recipient separately, with the headers included in the signature.
+	// Requires a listener with UnsubscribeHTTPS enabled, and cannot be combined
+	// with List-Unsubscribe headers in Headers. Optional.
+	ListUnsubscribe bool
 }
 
 type File struct {
@@ -265,3 +274,20 @@ type MessageMoveRequest struct {
 	DestMailboxName string // E.g. "Inbox", must already exist.
 }
 type MessageMoveResult struct{}
+
+type DeliveryStatusRequest struct {
+	QueueMsgID int64 // As returned in the Submissions of a SendResult.
+}
+type DeliveryStatusResult struct {
+	Events []DeliveryEvent // Oldest first.
+}
+
+// DeliveryEvent is an event in the delivery of an outgoing message.
+type DeliveryEvent struct {
+	Time      time.Time
+	Kind      string // "queued", "attempt" (failed temporarily, will be retried), "sent" or "bounced".
+	Recipient string
+	Code      int    // SMTP response code, for attempts, sent and bounced messages.
+	Secode    string // Enhanced status code, if any.
+	Error     string // Error message for failed attempts and bounces.
+}
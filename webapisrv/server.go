@@ -34,6 +34,7 @@ import (
 
 	"github.com/mjl-/mox/dkim"
 	"github.com/mjl-/mox/dns"
+	"github.com/mjl-/mox/eventdb"
 	"github.com/mjl-/mox/message"
 	"github.com/mjl-/mox/metrics"
 	"github.com/mjl-/mox/mlog"
@@ -55,7 +56,7 @@ var (
 	metricSubmission = promauto.NewCounterVec(
 		prometheus.CounterOpts{
 			Name: "mox_webapi_submission_total",
-			Help: "Webapi message submission results, known values (those ending with error are server errors): ok, badfrom, messagelimiterror, recipientlimiterror, queueerror, storesenterror, domaindisabled.",
+			Help: "Webapi message submission results, known values (those ending with error are server errors): ok, badfrom, submissioncheck, messagelimiterror, recipientlimiterror, queueerror, storesenterror, domaindisabled.",
 		},
 		[]string{
 			"result",
@@ -299,9 +300,14 @@ func (s server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 	fn := r.URL.Path[len("/v0/"):]
 	log = log.With(slog.String("method", fn))
+
+	// The "changes" endpoint is not a method, it streams changes to the account as
+	// server-sent events.
+	isChanges := fn == "changes"
+
 	rfn := reflect.ValueOf(s).MethodByName(fn)
 	var zero reflect.Value
-	if rfn == zero || rfn.Type().NumIn() != 2 || rfn.Type().NumOut() != 2 {
+	if !isChanges && (rfn == zero || rfn.Type().NumIn() != 2 || rfn.Type().NumOut() != 2) {
 		log.Debug("unknown webapi method")
 		http.NotFound(w, r)
 		return
@@ -310,7 +316,12 @@ func (s server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	// GET on method returns an example request JSON, a button to call the method,
 	// which either fills a textarea with the response (in case of JSON) or posts to
 	// the URL letting the browser handle the response (e.g. raw message or part).
-	if r.Method == "GET" {
+	if isChanges {
+		if r.Method != "GET" {
+			http.Error(w, "405 - method not allowed - use get", http.StatusMethodNotAllowed)
+			return
+		}
+	} else if r.Method == "GET" {
 		formatJSON := func(v any) (string, error) {
 			var b bytes.Buffer
 			enc := json.NewEncoder(&b)
@@ -427,14 +438,36 @@ func (s server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 	la := loginAttempt(r, "webapi", "httpbasic")
 	la.LoginAddress = email
+	var laAdded bool // Whether la was already added, for the long-running changes stream.
 	defer func() {
+		if laAdded {
+			return
+		}
 		store.LoginAttemptAdd(context.Background(), log, la)
 		metricDuration.WithLabelValues(fn).Observe(float64(time.Since(t0)) / float64(time.Second))
 	}()
 
-	var err error
+	authLockedOut := func(err error) {
+		la.Result = store.AuthLockedOut
+		log.Infox("authentication refused due to lockout", err, slog.String("account", la.AccountName), slog.Any("remoteip", remoteIP))
+		metricResults.WithLabelValues(fn, "badauth").Inc()
+		http.Error(w, "429 - too many requests - "+err.Error(), http.StatusTooManyRequests)
+	}
+
+	err := store.AuthLockoutCheck(r.Context(), remoteIP, "")
+	if errors.Is(err, store.ErrAuthLockedOut) {
+		authLockedOut(err)
+		return
+	} else if err != nil {
+		writeError(webapi.Error{Code: "server", Message: "error checking authentication lockout"})
+		return
+	}
+
 	acc, la.AccountName, err = store.OpenEmailAuth(log, email, password, true)
-	if err != nil {
+	if errors.Is(err, store.ErrAuthLockedOut) {
+		authLockedOut(err)
+		return
+	} else if err != nil {
 		mox.LimiterFailedAuth.Add(remoteIP, t0, 1)
 		if errors.Is(err, mox.ErrDomainNotFound) || errors.Is(err, mox.ErrAddressNotFound) || errors.Is(err, store.ErrUnknownCredentials) || errors.Is(err, store.ErrLoginDisabled) {
 			log.Debug("bad http basic authentication credentials")
@@ -453,9 +486,26 @@ func (s server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	la.AccountName = acc.Name
+	if accConf, ok := acc.Conf(); ok && !accConf.LoginNetworkAllowed(remoteIP) {
+		la.Result = store.AuthNetworkDenied
+		log.Info("account login from network not allowed", slog.String("account", acc.Name), slog.Any("remoteip", remoteIP))
+		metricResults.WithLabelValues(fn, "badauth").Inc()
+		http.Error(w, "403 - forbidden - "+store.ErrLoginNetwork.Error(), http.StatusForbidden)
+		return
+	}
 	la.Result = store.AuthSuccess
 	mox.LimiterFailedAuth.Reset(remoteIP, t0)
 
+	if isChanges {
+		store.LoginAttemptAdd(context.Background(), log, la)
+		laAdded = true
+
+		// The account stays open while streaming, changes are registered on it.
+		metricResults.WithLabelValues(fn, "ok").Inc()
+		webops.ChangesStream(log, acc, w, r)
+		return
+	}
+
 	ct := r.Header.Get("Content-Type")
 	ct, _, err = mime.ParseMediaType(ct)
 	if err != nil {
@@ -605,6 +655,23 @@ func xparseAddresses(l []webapi.NameAddress) ([]message.NameAddress, []smtp.Path
 	return r, paths
 }
 
+// unsubscribeSelectors returns copies of selectors that also sign the
+// List-Unsubscribe and List-Unsubscribe-Post headers, as required for one-click
+// unsubscribe.
+func unsubscribeSelectors(selectors []dkim.Selector) []dkim.Selector {
+	l := make([]dkim.Selector, len(selectors))
+	for i, sel := range selectors {
+		sel.Headers = slices.Clone(sel.Headers)
+		for _, h := range []string{"List-Unsubscribe", "List-Unsubscribe-Post"} {
+			if !slices.ContainsFunc(sel.Headers, func(s string) bool { return strings.EqualFold(s, h) }) {
+				sel.Headers = append(sel.Headers, h)
+			}
+		}
+		l[i] = sel
+	}
+	return l
+}
+
 func xrandomID(n int) string {
 	return base64.RawURLEncoding.EncodeToString(xrandom(n))
 }
@@ -662,7 +729,13 @@ func (s server) Send(ctx context.Context, req webapi.SendRequest) (resp webapi.S
 		return resp, webapi.Error{Code: "noRecipients", Message: "no recipients"}
 	}
 
-	// Check outgoing message rate limit.
+	if err := mox.SubmissionCheck(accConf.SubmissionChecks, len(to) > 0 || len(cc) > 0, m.Subject, len(recipients)); err != nil {
+		metricSubmission.WithLabelValues("submissioncheck").Inc()
+		return resp, webapi.Error{Code: "submissionCheck", Message: err.Error()}
+	}
+
+	// Check outgoing message rate limit, and whether the account appears compromised.
+	var holdReason string
 	xdbread(ctx, acc, func(tx *bstore.Tx) {
 		msglimit, rcptlimit, err := acc.SendLimitReached(tx, recipients)
 		if msglimit >= 0 {
@@ -673,7 +746,14 @@ func (s server) Send(ctx context.Context, req webapi.SendRequest) (resp webapi.S
 			panic(webapi.Error{Code: "recipientLimitReached", Message: "outgoing new recipient rate limit reached"})
 		}
 		xcheckf(err, "checking send limit")
+		holdReason, err = acc.OutgoingHoldCheck(ctx, tx, recipients, webauth.RemoteIP(log, s.isForwarded, reqInfo.Request))
+		xcheckf(err, "checking outgoing hold heuristics")
 	})
+	if holdReason != "" {
+		// The hold rule applies to this message too when it is queued.
+		err := queue.HoldAccount(ctx, log, acc.Name, holdReason)
+		xcheckf(err, "holding outgoing messages of account")
+	}
 
 	// If we have a non-ascii localpart, we will be sending with smtputf8. We'll go
 	// full utf-8 then.
@@ -778,6 +858,9 @@ func (s server) Send(ctx context.Context, req webapi.SendRequest) (resp webapi.S
 	for _, kv := range req.Headers {
 		xcheckcontrol(kv[0])
 		xcheckcontrol(kv[1])
+		if req.ListUnsubscribe && (strings.EqualFold(kv[0], "List-Unsubscribe") || strings.EqualFold(kv[0], "List-Unsubscribe-Post")) {
+			xcheckuserf(errors.New("cannot be combined with ListUnsubscribe"), "checking header %s", kv[0])
+		}
 		xc.Header(kv[0], kv[1])
 		if strings.EqualFold(kv[0], "User-Agent") || strings.EqualFold(kv[0], "X-Mailer") {
 			haveUserAgent = true
@@ -994,7 +1077,7 @@ func (s server) Send(ctx context.Context, req webapi.SendRequest) (resp webapi.S
 		xcheckuserf(mox.ErrDomainDisabled, "checking domain")
 	}
 	selectors := mox.DKIMSelectors(confDom.DKIM)
-	if len(selectors) > 0 {
+	if len(selectors) > 0 && !req.ListUnsubscribe {
 		dkimHeaders, err := dkim.Sign(ctx, log.Logger, from.Address.Localpart, fd, selectors, smtputf8, dataFile)
 		if err != nil {
 			metricServerErrors.WithLabelValues("dkimsign").Inc()
@@ -1031,6 +1114,22 @@ func (s server) Send(ctx context.Context, req webapi.SendRequest) (resp webapi.S
 			recvRcpt = rcpt.XString(smtputf8)
 		}
 		rcptMsgPrefix := recvHdrFor(recvRcpt) + msgPrefix
+		if req.ListUnsubscribe {
+			// Each recipient gets its own link, and its own DKIM signature covering it.
+			unsubHeaders := mox.UnsubscribeHeaders(mox.Unsubscribe{Account: acc.Name, Address: rcpt.XString(true)})
+			if unsubHeaders == "" {
+				xcheckuserf(errors.New("no listener with UnsubscribeHTTPS enabled"), "adding list-unsubscribe headers")
+			}
+			var dkimHeaders string
+			if len(selectors) > 0 {
+				dkimHeaders, err = dkim.Sign(ctx, log.Logger, from.Address.Localpart, fd, unsubscribeSelectors(selectors), smtputf8, store.FileMsgReader([]byte(unsubHeaders), dataFile))
+				if err != nil {
+					metricServerErrors.WithLabelValues("dkimsign").Inc()
+				}
+				xcheckf(err, "sign dkim")
+			}
+			rcptMsgPrefix = recvHdrFor(recvRcpt) + dkimHeaders + unsubHeaders
+		}
 		msgSize := int64(len(rcptMsgPrefix)) + xc.Size
 		qm := queue.MakeMsg(fp, rcpt, xc.Has8bit, xc.SMTPUTF8, msgSize, m.MessageID, []byte(rcptMsgPrefix), req.RequireTLS, now, m.Subject)
 		qm.FromID = fromIDs[i]
@@ -1388,3 +1487,27 @@ func (s server) MessageMove(ctx context.Context, req webapi.MessageMoveRequest)
 	xops.MessageMove(ctx, reqInfo.Log, reqInfo.Account, []int64{req.MsgID}, req.DestMailboxName, 0)
 	return
 }
+
+func (s server) DeliveryStatus(ctx context.Context, req webapi.DeliveryStatusRequest) (resp webapi.DeliveryStatusResult, err error) {
+	reqInfo := ctx.Value(requestInfoCtxKey).(requestInfo)
+	if req.QueueMsgID <= 0 {
+		xcheckuserf(errors.New("must be greater than zero"), "checking queue message id")
+	}
+	l, err := eventdb.DeliveryStatus(ctx, reqInfo.Account.Name, req.QueueMsgID)
+	xcheckf(err, "listing delivery events")
+	if len(l) == 0 {
+		panic(webapi.Error{Code: "messageNotFound", Message: "no delivery events for message"})
+	}
+	resp.Events = make([]webapi.DeliveryEvent, len(l))
+	for i, e := range l {
+		resp.Events[i] = webapi.DeliveryEvent{
+			Time:      e.Time,
+			Kind:      string(e.Kind),
+			Recipient: e.Recipient,
+			Code:      e.Code,
+			Secode:    e.Secode,
+			Error:     e.Detail,
+		}
+	}
+	return resp, nil
+}
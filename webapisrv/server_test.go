@@ -1,6 +1,7 @@
 package webapisrv
 
 import (
+	"bufio"
 	"bytes"
 	"context"
 	"encoding/base64"
@@ -19,6 +20,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/mjl-/mox/config"
 	"github.com/mjl-/mox/message"
 	"github.com/mjl-/mox/mlog"
 	"github.com/mjl-/mox/mox-"
@@ -146,6 +148,15 @@ func TestServer(t *testing.T) {
 		testHTTPHdrsBody(s, "POST", "/v0/Send", map[string]string{"Authorization": "Basic " + base64.StdEncoding.EncodeToString([]byte("mjl@mox.example:badpassword"))}, "", expCode, tooMany, "", "")
 	}
 	mox.LimitersInit()
+	// The account and IP are also locked out now.
+	lockouts, err := store.AuthLockoutList(ctxbg)
+	tcheckf(t, err, "list auth lockouts")
+	tcompare(t, len(lockouts), 2)
+	testHTTPHdrsBody(s, "POST", "/v0/Send", map[string]string{"Authorization": "Basic " + base64.StdEncoding.EncodeToString([]byte("mjl@mox.example:"+pw1))}, "", http.StatusTooManyRequests, false, "", "")
+	for _, al := range lockouts {
+		err := store.AuthLockoutRemove(ctxbg, log, al.Key)
+		tcheckf(t, err, "remove auth lockout")
+	}
 
 	// Cannot login to disabled account.
 	acc2, err := store.OpenAccount(log, "disabled", false)
@@ -295,6 +306,41 @@ func TestServer(t *testing.T) {
 	tcompare(t, len(sendRes.Submissions), 1)
 	tcompare(t, sendRes.Submissions[0].FromID != "", true)
 
+	// With one-click unsubscribe, each recipient gets its own link and DKIM signature.
+	unsubResp, err := client.Send(ctxbg, webapi.SendRequest{
+		Message: webapi.Message{
+			To:      []webapi.NameAddress{{Address: "mjl+unsub1@mox.example"}, {Address: "mjl+unsub2@mox.example"}},
+			Subject: "test",
+			Text:    "hi",
+		},
+		ListUnsubscribe: true,
+	})
+	tcheckf(t, err, "send with list-unsubscribe")
+	tcompare(t, len(unsubResp.Submissions), 2)
+	for i, sub := range unsubResp.Submissions {
+		qml, err := queue.List(ctxbg, queue.Filter{IDs: []int64{sub.QueueMsgID}}, queue.Sort{})
+		tcheckf(t, err, "get queue message")
+		tcompare(t, len(qml), 1)
+		prefix := string(qml[0].MsgPrefix)
+		token := mox.UnsubscribeToken(mox.Unsubscribe{Account: "mjl", Address: sub.Address})
+		if !strings.Contains(prefix, "List-Unsubscribe: <https://mox.example/unsubscribe/"+token+">\r\nList-Unsubscribe-Post: List-Unsubscribe=One-Click\r\n") {
+			t.Fatalf("message %d: missing list-unsubscribe headers in prefix %q", i, prefix)
+		}
+		if !strings.Contains(prefix, "List-Unsubscribe:List-Unsubscribe-Post") {
+			t.Fatalf("message %d: dkim signature does not cover list-unsubscribe headers: %q", i, prefix)
+		}
+	}
+	_, err = client.Send(ctxbg, webapi.SendRequest{
+		Message: webapi.Message{
+			To:      []webapi.NameAddress{{Address: "mjl@mox.example"}},
+			Subject: "test",
+			Text:    "hi",
+		},
+		Headers:         [][2]string{{"List-Unsubscribe", "<https://other.example/>"}},
+		ListUnsubscribe: true,
+	})
+	terrcode(t, err, "user")
+
 	// Trigger various error conditions.
 	_, err = client.Send(ctxbg, webapi.SendRequest{
 		Message: webapi.Message{
@@ -327,6 +373,14 @@ func TestServer(t *testing.T) {
 	_, err = client.Send(ctxbg, webapi.SendRequest{Message: webapi.Message{Subject: "test", Text: "hi"}})
 	terrcode(t, err, "noRecipients")
 
+	accConf := mox.Conf.Dynamic.Accounts["mjl"]
+	accConf.SubmissionChecks = &config.SubmissionChecks{RequireSubject: true}
+	mox.Conf.Dynamic.Accounts["mjl"] = accConf
+	_, err = client.Send(ctxbg, webapi.SendRequest{Message: webapi.Message{To: []webapi.NameAddress{{Address: "mjl@mox.example"}}, Text: "hi"}})
+	terrcode(t, err, "submissionCheck")
+	accConf.SubmissionChecks = nil
+	mox.Conf.Dynamic.Accounts["mjl"] = accConf
+
 	_, err = client.Send(ctxbg, webapi.SendRequest{
 		Message: webapi.Message{
 			MessageID: "missingltgt@localhost",
@@ -502,6 +556,50 @@ func TestServer(t *testing.T) {
 	_, err = client.MessageFlagsRemove(ctxbg, webapi.MessageFlagsRemoveRequest{MsgID: 1 + 999, Flags: []string{`\Answered`, "$forwarded", "custom"}})
 	terrcode(t, err, "messageNotFound")
 
+	// Changes are streamed as server-sent events, only after authentication.
+	testHTTP("GET", "/v0/changes", http.StatusUnauthorized, "")
+	testHTTPHdrsBody(s, "GET", "/v0/changes", map[string]string{"Authorization": "Basic " + base64.StdEncoding.EncodeToString([]byte("mjl@mox.example:badpassword"))}, "", http.StatusUnauthorized, false, "", "")
+	testHTTPHdrsBody(s, "POST", "/v0/changes", map[string]string{"Authorization": authz}, "", http.StatusMethodNotAllowed, false, "", "")
+
+	changesCtx, changesCancel := context.WithTimeout(ctxbg, 10*time.Second)
+	defer changesCancel()
+	changesReq, err := http.NewRequestWithContext(changesCtx, "GET", hs.URL+"/v0/changes", nil)
+	tcheckf(t, err, "new request for changes")
+	changesReq.SetBasicAuth("mjl@mox.example", pw0)
+	changesResp, err := http.DefaultClient.Do(changesReq)
+	tcheckf(t, err, "request changes")
+	defer changesResp.Body.Close()
+	tcompare(t, changesResp.StatusCode, http.StatusOK)
+	tcompare(t, changesResp.Header.Get("Content-Type"), "text/event-stream")
+	changes := bufio.NewReader(changesResp.Body)
+	// First line is sent after registering for changes.
+	line, err := changes.ReadString('\n')
+	tcheckf(t, err, "reading from changes stream")
+	tcompare(t, line, ": keepalive\n")
+	// nextChange returns the type of the next change event for the account.
+	nextChange := func() string {
+		t.Helper()
+		var event string
+		for {
+			line, err := changes.ReadString('\n')
+			tcheckf(t, err, "reading from changes stream")
+			line = strings.TrimSuffix(line, "\n")
+			if strings.HasPrefix(line, "event: ") {
+				event = strings.TrimPrefix(line, "event: ")
+			} else if data, ok := strings.CutPrefix(line, "data: "); ok {
+				tcompare(t, event, "change")
+				var ev struct {
+					Account string
+					Type    string
+				}
+				err := json.Unmarshal([]byte(data), &ev)
+				tcheckf(t, err, "parsing change event")
+				tcompare(t, ev.Account, "mjl")
+				return ev.Type
+			}
+		}
+	}
+
 	// MessageMove
 	tcompare(t, msgRes.Meta.MailboxName, "Sent")
 	_, err = client.MessageMove(ctxbg, webapi.MessageMoveRequest{MsgID: 1, DestMailboxName: "Inbox"})
@@ -509,6 +607,13 @@ func TestServer(t *testing.T) {
 	msgRes, err = client.MessageGet(ctxbg, webapi.MessageGetRequest{MsgID: 1})
 	tcheckf(t, err, "get message")
 	tcompare(t, msgRes.Meta.MailboxName, "Inbox")
+	// The move is sent on the changes stream, as removal from the source mailbox and
+	// addition to the destination mailbox.
+	var changeTypes []string
+	for !slices.Contains(changeTypes, "ChangeAddUID") || !slices.Contains(changeTypes, "ChangeRemoveUIDs") {
+		changeTypes = append(changeTypes, nextChange())
+	}
+	changesCancel()
 	_, err = client.MessageMove(ctxbg, webapi.MessageMoveRequest{MsgID: 1, DestMailboxName: "Bogus"})
 	terrcode(t, err, "user")
 	_, err = client.MessageMove(ctxbg, webapi.MessageMoveRequest{MsgID: 1 + 999, DestMailboxName: "Inbox"})
@@ -3,8 +3,12 @@ package webauth
 import (
 	"context"
 	cryptorand "crypto/rand"
+	"crypto/subtle"
 	"encoding/base64"
+	"encoding/json"
 	"fmt"
+	"log/slog"
+	"net/http"
 	"os"
 	"strings"
 	"sync"
@@ -13,6 +17,11 @@ import (
 	"golang.org/x/crypto/bcrypt"
 	"golang.org/x/text/secure/precis"
 
+	"github.com/mjl-/sherpa"
+
+	"github.com/mjl-/mox/admin"
+	"github.com/mjl-/mox/config"
+	"github.com/mjl-/mox/metrics"
 	"github.com/mjl-/mox/mlog"
 	"github.com/mjl-/mox/mox-"
 	"github.com/mjl-/mox/store"
@@ -21,6 +30,11 @@ import (
 // Admin is for admin logins, with authentication by password, and sessions only
 // stored in memory only, with lifetime 12 hour after last use, with a maximum of
 // 10 active sessions.
+//
+// Logins with an empty username are for the global admin, with the password from
+// the admin password file. Logins with a username are for domain admins from the
+// dynamic config. For sessions of domain admins, the login address returned by
+// Check is the name of the domain admin.
 var Admin SessionAuth = &adminSessionAuth{
 	sessions: map[store.SessionToken]adminSession{},
 }
@@ -32,6 +46,7 @@ type adminSession struct {
 	sessionToken store.SessionToken
 	csrfToken    store.CSRFToken
 	expires      time.Time
+	domainAdmin  string // Empty for global admin.
 }
 
 type adminSessionAuth struct {
@@ -43,12 +58,21 @@ func (a *adminSessionAuth) login(ctx context.Context, log mlog.Log, username, pa
 	a.Lock()
 	defer a.Unlock()
 
-	p := mox.ConfigDirPath(mox.Conf.Static.AdminPasswordFile)
-	buf, err := os.ReadFile(p)
-	if err != nil {
-		return false, false, "", fmt.Errorf("reading password file: %v", err)
+	var passwordhash string
+	if username != "" {
+		da, ok := mox.Conf.DomainAdmin(username)
+		if !ok || da.PasswordHash == "" {
+			return false, false, "", nil
+		}
+		passwordhash = da.PasswordHash
+	} else {
+		p := mox.ConfigDirPath(mox.Conf.Static.AdminPasswordFile)
+		buf, err := os.ReadFile(p)
+		if err != nil {
+			return false, false, "", fmt.Errorf("reading password file: %v", err)
+		}
+		passwordhash = strings.TrimSpace(string(buf))
 	}
-	passwordhash := strings.TrimSpace(string(buf))
 	// Transform with precis, if valid. ../rfc/8265:679
 	pw, err := precis.OpaqueString.String(password)
 	if err == nil {
@@ -58,6 +82,9 @@ func (a *adminSessionAuth) login(ctx context.Context, log mlog.Log, username, pa
 		return false, false, "", nil
 	}
 
+	if username != "" {
+		return true, false, username, nil
+	}
 	return true, false, "(admin)", nil
 }
 
@@ -95,7 +122,7 @@ func (a *adminSessionAuth) add(ctx context.Context, log mlog.Log, accountName st
 	csrfToken = store.CSRFToken(base64.RawURLEncoding.EncodeToString(csrfData[:]))
 
 	// Register session.
-	a.sessions[sessionToken] = adminSession{sessionToken, csrfToken, time.Now().Add(adminSessionLifetime)}
+	a.sessions[sessionToken] = adminSession{sessionToken, csrfToken, time.Now().Add(adminSessionLifetime), loginAddress}
 	return sessionToken, csrfToken, nil
 }
 
@@ -110,10 +137,15 @@ func (a *adminSessionAuth) use(ctx context.Context, log mlog.Log, accountName st
 		return "", fmt.Errorf("session expired (after 12 hours inactivity)")
 	} else if csrfToken != "" && csrfToken != s.csrfToken {
 		return "", fmt.Errorf("mismatch between csrf and session tokens")
+	} else if s.domainAdmin != "" {
+		if _, ok := mox.Conf.DomainAdmin(s.domainAdmin); !ok || accountName != s.domainAdmin {
+			delete(a.sessions, sessionToken)
+			return "", fmt.Errorf("unknown domain admin")
+		}
 	}
 	s.expires = time.Now().Add(adminSessionLifetime)
 	a.sessions[sessionToken] = s
-	return "", nil
+	return s.domainAdmin, nil
 }
 
 func (a *adminSessionAuth) remove(ctx context.Context, log mlog.Log, accountName string, sessionToken store.SessionToken) error {
@@ -126,3 +158,60 @@ func (a *adminSessionAuth) remove(ctx context.Context, log mlog.Log, accountName
 	delete(a.sessions, sessionToken)
 	return nil
 }
+
+// CheckAdminToken authenticates an admin API request with an "Authorization:
+// Bearer <token>" header, with the tokens from the dynamic config. Also performs
+// rate limiting, and records a login attempt.
+//
+// If the returned boolean is false, an error response has already been written,
+// like Check.
+func CheckAdminToken(ctx context.Context, log mlog.Log, isForwarded bool, w http.ResponseWriter, r *http.Request, token string) (name string, at config.AdminToken, ok bool) {
+	respondAuthError := func(code, msg string) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		var result = struct {
+			Error sherpa.Error `json:"error"`
+		}{
+			sherpa.Error{Code: code, Message: msg},
+		}
+		json.NewEncoder(w).Encode(result)
+	}
+
+	ip := RemoteIP(log, isForwarded, r)
+	if ip == nil {
+		respondAuthError("user:noAuth", "cannot find ip for rate limit check (missing x-forwarded-for header?)")
+		return "", config.AdminToken{}, false
+	}
+	start := time.Now()
+	if !mox.LimiterFailedAuth.Add(ip, start, 1) {
+		metrics.AuthenticationRatelimitedInc("webadmin")
+		http.Error(w, "429 - too many auth attempts", http.StatusTooManyRequests)
+		return "", config.AdminToken{}, false
+	}
+
+	la := loginAttempt(r, "webadmin", "bearer")
+	defer func() {
+		store.LoginAttemptAdd(context.Background(), log, la)
+	}()
+
+	hash := []byte(admin.AdminTokenHash(token))
+	for xname, xat := range mox.Conf.AdminTokens() {
+		if subtle.ConstantTimeCompare(hash, []byte(xat.TokenHash)) == 1 {
+			name, at, ok = xname, xat, true
+		}
+	}
+	if !ok {
+		la.Result = store.AuthBadCredentials
+		time.Sleep(BadAuthDelay)
+		respondAuthError("user:badAuth", "unknown admin token")
+		return "", config.AdminToken{}, false
+	}
+	la.LoginAddress = "token:" + name
+
+	mox.LimiterFailedAuth.Reset(ip, start)
+	la.Result = store.AuthSuccess
+
+	if lw, ok := w.(interface{ AddAttr(a slog.Attr) }); ok {
+		lw.AddAttr(slog.String("admintoken", name))
+	}
+	return name, at, true
+}
@@ -31,12 +31,17 @@ Sessions for the account and mail interfaces have a lifetime of 24 hours after
 last use, are kept in memory and stored in the database (do survive a server
 restart), and only 100 sessions can exist per account (the oldest session is
 dropped).
+
+The admin API can also be called with an admin token from the dynamic config, in
+an "Authorization: Bearer" header, without session or CSRF token. Browsers don't
+add such headers to requests by themselves.
 */
 package webauth
 
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net"
@@ -195,6 +200,13 @@ func Check(ctx context.Context, log mlog.Log, sessionAuth SessionAuth, kind stri
 	}
 	la.LoginAddress = loginAddress
 
+	// Sessions can only be used from the networks the account can login from.
+	if accConf, ok := mox.Conf.Account(accountName); ok && !accConf.LoginNetworkAllowed(ip) {
+		la.Result = store.AuthNetworkDenied
+		respondAuthError("user:badAuth", store.ErrLoginNetwork.Error())
+		return "", "", "", false
+	}
+
 	mox.LimiterFailedAuth.Reset(ip, start)
 	la.Result = store.AuthSuccess
 
@@ -269,16 +281,27 @@ func Login(ctx context.Context, log mlog.Log, sessionAuth SessionAuth, kind, coo
 	}
 
 	username = norm.NFC.String(username)
-	valid, disabled, accountName, err := sessionAuth.login(ctx, log, username, password)
 	la := loginAttempt(r, kind, "weblogin")
 	la.LoginAddress = username
-	la.AccountName = accountName
 	defer func() {
 		store.LoginAttemptAdd(context.Background(), log, la)
 	}()
+	if err := store.AuthLockoutCheck(ctx, ip, ""); errors.Is(err, store.ErrAuthLockedOut) {
+		la.Result = store.AuthLockedOut
+		return "", &sherpa.Error{Code: "user:loginFailed", Message: err.Error()}
+	} else if err != nil {
+		la.Result = store.AuthError
+		return "", fmt.Errorf("checking authentication lockout: %v", err)
+	}
+
+	valid, disabled, accountName, err := sessionAuth.login(ctx, log, username, password)
+	la.AccountName = accountName
 	if disabled {
 		la.Result = store.AuthLoginDisabled
 		return "", &sherpa.Error{Code: "user:loginFailed", Message: err.Error()}
+	} else if errors.Is(err, store.ErrAuthLockedOut) {
+		la.Result = store.AuthLockedOut
+		return "", &sherpa.Error{Code: "user:loginFailed", Message: err.Error()}
 	} else if err != nil {
 		la.Result = store.AuthError
 		return "", fmt.Errorf("evaluating login attempt: %v", err)
@@ -287,6 +310,11 @@ func Login(ctx context.Context, log mlog.Log, sessionAuth SessionAuth, kind, coo
 		la.Result = store.AuthBadCredentials
 		return "", &sherpa.Error{Code: "user:loginFailed", Message: "invalid credentials"}
 	}
+	if accConf, ok := mox.Conf.Account(accountName); ok && !accConf.LoginNetworkAllowed(ip) {
+		la.Result = store.AuthNetworkDenied
+		log.Info("account login from network not allowed", slog.String("account", accountName), slog.Any("remoteip", ip))
+		return "", &sherpa.Error{Code: "user:loginFailed", Message: store.ErrLoginNetwork.Error()}
+	}
 	la.Result = store.AuthSuccess
 	mox.LimiterFailedAuth.Reset(ip, start)
 
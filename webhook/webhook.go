@@ -1,8 +1,9 @@
-// Package webhook has data types used for webhooks about incoming and outgoing deliveries.
+// Package webhook has data types used for webhooks about incoming and outgoing
+// deliveries, and about admin changes to the configuration.
 //
 // See package webapi for details about the webapi and webhooks.
 //
-// Types [Incoming] and [Outgoing] represent the JSON bodies sent in the webhooks.
+// Types [Incoming], [Outgoing] and [Admin] represent the JSON bodies sent in the webhooks.
 // New fields may be added in the future, unrecognized fields should be ignored
 // when parsing for forward compatibility.
 package webhook
@@ -140,3 +141,41 @@ type Structure struct {
 	DecodedSize        int64             // Size of content after decoding content-transfer-encoding. For text and HTML parts, this can be larger than the data returned since this size includes \r\n line endings.
 	Parts              []Structure       // Subparts of a multipart message, possibly recursive.
 }
+
+// AdminEvent is the type of change for an admin webhook.
+type AdminEvent string
+
+// note: admin hook events are in ../mox-/config.go and ../config/config.go too. keep in sync.
+
+const (
+	EventDomainAdded    AdminEvent = "domainadded"
+	EventDomainRemoved  AdminEvent = "domainremoved"
+	EventAccountAdded   AdminEvent = "accountadded"
+	EventAccountRemoved AdminEvent = "accountremoved"
+	EventAddressAdded   AdminEvent = "addressadded"
+	EventAddressRemoved AdminEvent = "addressremoved"
+
+	// Address was moved to another account. Account is the new account.
+	EventAddressMoved AdminEvent = "addressmoved"
+
+	EventDKIMAdded   AdminEvent = "dkimadded"
+	EventDKIMRemoved AdminEvent = "dkimremoved"
+
+	// MaxAge of the MTA-STS policy of a domain was increased automatically, with a
+	// new policy ID. The DNS TXT record in DNSRecord must be published.
+	EventMTASTSRamp AdminEvent = "mtastsramp"
+)
+
+// Admin is the payload sent to webhook URLs for configuration changes made by
+// admins.
+type Admin struct {
+	Version     int        // Format of hook, currently 0.
+	Event       AdminEvent // Type of change.
+	Time        time.Time  // When the change was made.
+	DomainAdmin string     // Name of the domain admin that made the change, empty for the global admin.
+	Domain      string     // Domain of the change, in unicode. For all events except account events.
+	Account     string     // For account and address changes.
+	Address     string     // For address changes. Can be a catchall address of the form "@<domain>".
+	Selector    string     // DKIM selector, for events about DKIM keys.
+	DNSRecord   string     // For mtastsramp events, the _mta-sts DNS TXT record with the new policy ID.
+}
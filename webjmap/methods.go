@@ -0,0 +1,1034 @@
+package webjmap
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mjl-/bstore"
+
+	"github.com/mjl-/mox/message"
+	"github.com/mjl-/mox/store"
+	"github.com/mjl-/mox/webops"
+)
+
+// methods are the implemented JMAP methods, taking JSON arguments.
+var methods = map[string]func(c *call, args []byte) any{
+	"Core/echo":       coreEcho,
+	"Mailbox/get":     method(mailboxGet),
+	"Mailbox/changes": method(mailboxChanges),
+	"Email/get":       method(emailGet),
+	"Email/query":     method(emailQuery),
+	"Email/changes":   method(emailChanges),
+	"Email/set":       method(emailSet),
+	"Thread/get":      method(threadGet),
+	"Thread/changes":  method(threadChanges),
+}
+
+// method returns a function that parses the JSON arguments for fn, failing for
+// unknown arguments.
+func method[A any](fn func(c *call, a A) any) func(c *call, buf []byte) any {
+	return func(c *call, buf []byte) any {
+		var a A
+		dec := json.NewDecoder(bytes.NewReader(buf))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&a); err != nil {
+			xinvalidArgumentsf("parsing arguments: %v", err)
+		}
+		return fn(c, a)
+	}
+}
+
+var xops = webops.XOps{
+	DBWrite: xdbwrite,
+	Checkf: func(ctx context.Context, err error, format string, args ...any) {
+		xcheckf(err, format, args...)
+	},
+	Checkuserf: func(ctx context.Context, err error, format string, args ...any) {
+		if err != nil && errors.Is(err, webops.ErrMessageNotFound) {
+			panic(methodError{"notFound", fmt.Sprintf("%s: %s", fmt.Sprintf(format, args...), err)})
+		} else if err != nil && errors.Is(err, store.ErrMailboxReadOnly) {
+			panic(methodError{"forbidden", fmt.Sprintf("%s: %s", fmt.Sprintf(format, args...), err)})
+		} else if err != nil {
+			xinvalidArgumentsf("%s: %s", fmt.Sprintf(format, args...), err)
+		}
+	},
+}
+
+func xdbwrite(ctx context.Context, acc *store.Account, fn func(tx *bstore.Tx)) {
+	err := acc.DB.Write(ctx, func(tx *bstore.Tx) error {
+		fn(tx)
+		return nil
+	})
+	xcheckf(err, "transaction")
+}
+
+func (c *call) xdbread(fn func(tx *bstore.Tx)) {
+	err := c.acc.DB.Read(c.ctx, func(tx *bstore.Tx) error {
+		fn(tx)
+		return nil
+	})
+	xcheckf(err, "transaction")
+}
+
+// xaccount checks the accountId argument is for the authenticated account.
+func (c *call) xaccount(id string) {
+	if id != c.accountID {
+		panic(methodError{"accountNotFound", "unknown account id"})
+	}
+}
+
+// xstate returns the current state, used for all types.
+func xstate(acc *store.Account, tx *bstore.Tx) (store.ModSeq, string) {
+	modseq, err := acc.LastModSeq(tx)
+	xcheckf(err, "get last modseq")
+	return modseq, fmt.Sprintf("%d", modseq)
+}
+
+func xparseState(s string) store.ModSeq {
+	v, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || v < 0 {
+		panic(methodError{"cannotCalculateChanges", "unknown state"})
+	}
+	return store.ModSeq(v)
+}
+
+func mailboxID(id int64) string { return fmt.Sprintf("M%d", id) }
+func emailID(id int64) string   { return fmt.Sprintf("E%d", id) }
+func threadID(id int64) string  { return fmt.Sprintf("T%d", id) }
+func blobID(id int64) string    { return fmt.Sprintf("B%d", id) }
+
+// parseID parses an id with prefix, as generated by mailboxID and friends.
+func parseID(prefix, s string) (int64, bool) {
+	x, ok := strings.CutPrefix(s, prefix)
+	if !ok {
+		return 0, false
+	}
+	v, err := strconv.ParseInt(x, 10, 64)
+	if err != nil || v <= 0 || fmt.Sprintf("%d", v) != x {
+		return 0, false
+	}
+	return v, true
+}
+
+// xproperties returns the properties to include in objects. Properties is nil
+// for all properties.
+func xproperties(properties *[]string, all []string) map[string]bool {
+	props := map[string]bool{"id": true}
+	if properties == nil {
+		for _, p := range all {
+			props[p] = true
+		}
+		return props
+	}
+	for _, p := range *properties {
+		if !slices.Contains(all, p) {
+			xinvalidArgumentsf("unknown property %q", p)
+		}
+		props[p] = true
+	}
+	return props
+}
+
+// filterProperties removes properties from obj that were not requested.
+func filterProperties(obj map[string]any, props map[string]bool) map[string]any {
+	maps.DeleteFunc(obj, func(k string, v any) bool { return !props[k] })
+	return obj
+}
+
+func xcheckGetIDs(ids *[]string) {
+	if ids != nil && len(*ids) > maxObjectsInGet {
+		panic(methodError{"requestTooLarge", fmt.Sprintf("more than maximum of %d ids", maxObjectsInGet)})
+	}
+}
+
+func coreEcho(c *call, buf []byte) any {
+	var args any
+	dec := json.NewDecoder(bytes.NewReader(buf))
+	dec.UseNumber()
+	err := dec.Decode(&args)
+	xcheckf(err, "parsing arguments")
+	return args
+}
+
+type getArgs struct {
+	AccountID  string    `json:"accountId"`
+	IDs        *[]string `json:"ids"`
+	Properties *[]string `json:"properties"`
+}
+
+type getResult struct {
+	AccountID string           `json:"accountId"`
+	State     string           `json:"state"`
+	List      []map[string]any `json:"list"`
+	NotFound  []string         `json:"notFound"`
+}
+
+type changesArgs struct {
+	AccountID  string `json:"accountId"`
+	SinceState string `json:"sinceState"`
+	MaxChanges *int   `json:"maxChanges"`
+}
+
+type changesResult struct {
+	AccountID      string   `json:"accountId"`
+	OldState       string   `json:"oldState"`
+	NewState       string   `json:"newState"`
+	HasMoreChanges bool     `json:"hasMoreChanges"`
+	Created        []string `json:"created"`
+	Updated        []string `json:"updated"`
+	Destroyed      []string `json:"destroyed"`
+}
+
+func (c *call) newChangesResult(a changesArgs) changesResult {
+	c.xaccount(a.AccountID)
+	// A maxChanges of zero or less is invalid. ../rfc/8620
+	if a.MaxChanges != nil && *a.MaxChanges <= 0 {
+		xinvalidArgumentsf("maxChanges must be positive")
+	}
+	return changesResult{
+		AccountID: c.accountID,
+		OldState:  a.SinceState,
+		Created:   []string{},
+		Updated:   []string{},
+		Destroyed: []string{},
+	}
+}
+
+var mailboxProperties = []string{"name", "parentId", "role", "sortOrder", "totalEmails", "unreadEmails", "totalThreads", "unreadThreads", "myRights", "isSubscribed"}
+
+// mailboxObject returns the JMAP Mailbox for mb. ../rfc/8621
+func mailboxObject(mb store.Mailbox, byName map[string]store.Mailbox, subscribed map[string]bool) map[string]any {
+	name := mb.Name
+	var parentID any
+	if i := strings.LastIndex(mb.Name, "/"); i >= 0 {
+		name = mb.Name[i+1:]
+		if pmb, ok := byName[mb.Name[:i]]; ok {
+			parentID = mailboxID(pmb.ID)
+		}
+	}
+	var role any
+	switch {
+	case mb.Name == "Inbox":
+		role = "inbox"
+	case mb.Archive:
+		role = "archive"
+	case mb.Draft:
+		role = "drafts"
+	case mb.Junk:
+		role = "junk"
+	case mb.Sent:
+		role = "sent"
+	case mb.Trash:
+		role = "trash"
+	}
+	// Messages in read-only mailboxes can only be read.
+	writable := !mb.ReadOnly
+	// We don't keep thread counts per mailbox, message counts are the upper bound.
+	return map[string]any{
+		"id":            mailboxID(mb.ID),
+		"name":          name,
+		"parentId":      parentID,
+		"role":          role,
+		"sortOrder":     0,
+		"totalEmails":   mb.Total,
+		"unreadEmails":  mb.Unread,
+		"totalThreads":  mb.Total,
+		"unreadThreads": mb.Unread,
+		"myRights": map[string]bool{
+			"mayReadItems":   true,
+			"mayAddItems":    writable,
+			"mayRemoveItems": writable,
+			"maySetSeen":     writable,
+			"maySetKeywords": writable,
+			"mayCreateChild": false,
+			"mayRename":      false,
+			"mayDelete":      false,
+			"maySubmit":      false,
+		},
+		"isSubscribed": subscribed[mb.Name],
+	}
+}
+
+func mailboxGet(c *call, a getArgs) any {
+	c.xaccount(a.AccountID)
+	xcheckGetIDs(a.IDs)
+	props := xproperties(a.Properties, mailboxProperties)
+
+	r := getResult{AccountID: c.accountID, List: []map[string]any{}, NotFound: []string{}}
+	c.xdbread(func(tx *bstore.Tx) {
+		_, r.State = xstate(c.acc, tx)
+
+		mailboxes, err := bstore.QueryTx[store.Mailbox](tx).SortAsc("Name").List()
+		xcheckf(err, "listing mailboxes")
+		subs, err := bstore.QueryTx[store.Subscription](tx).List()
+		xcheckf(err, "listing subscriptions")
+		subscribed := map[string]bool{}
+		for _, sub := range subs {
+			subscribed[sub.Name] = true
+		}
+		byName := map[string]store.Mailbox{}
+		byID := map[string]store.Mailbox{}
+		for _, mb := range mailboxes {
+			byName[mb.Name] = mb
+			byID[mailboxID(mb.ID)] = mb
+		}
+
+		if a.IDs == nil {
+			for _, mb := range mailboxes {
+				r.List = append(r.List, filterProperties(mailboxObject(mb, byName, subscribed), props))
+			}
+			return
+		}
+		for _, id := range *a.IDs {
+			if mb, ok := byID[id]; ok {
+				r.List = append(r.List, filterProperties(mailboxObject(mb, byName, subscribed), props))
+			} else {
+				r.NotFound = append(r.NotFound, id)
+			}
+		}
+	})
+	return r
+}
+
+// mailboxChanges only returns changes if the state is current. Mailboxes don't
+// have a modseq, so we don't know which mailboxes changed. Clients fetch all
+// mailboxes again, typically not many.
+func mailboxChanges(c *call, a changesArgs) any {
+	r := c.newChangesResult(a)
+	since := xparseState(a.SinceState)
+	c.xdbread(func(tx *bstore.Tx) {
+		var modseq store.ModSeq
+		modseq, r.NewState = xstate(c.acc, tx)
+		if since != modseq {
+			panic(methodError{"cannotCalculateChanges", "changes for mailboxes are not tracked"})
+		}
+	})
+	return struct {
+		changesResult
+		UpdatedProperties *[]string `json:"updatedProperties"`
+	}{r, nil}
+}
+
+var emailProperties = []string{"blobId", "threadId", "mailboxIds", "keywords", "size", "receivedAt", "messageId", "inReplyTo", "sender", "from", "to", "cc", "bcc", "replyTo", "subject", "sentAt"}
+
+// Properties that require the parsed message.
+var emailEnvelopeProperties = []string{"messageId", "inReplyTo", "sender", "from", "to", "cc", "bcc", "replyTo", "subject", "sentAt"}
+
+// flagKeywords maps JMAP keywords to message flags.
+var flagKeywords = []struct {
+	keyword string
+	flag    func(f store.Flags) bool
+}{
+	{"$seen", func(f store.Flags) bool { return f.Seen }},
+	{"$answered", func(f store.Flags) bool { return f.Answered }},
+	{"$flagged", func(f store.Flags) bool { return f.Flagged }},
+	{"$draft", func(f store.Flags) bool { return f.Draft }},
+	{"$forwarded", func(f store.Flags) bool { return f.Forwarded }},
+	{"$junk", func(f store.Flags) bool { return f.Junk }},
+	{"$notjunk", func(f store.Flags) bool { return f.Notjunk }},
+	{"$phishing", func(f store.Flags) bool { return f.Phishing }},
+	{"$mdnsent", func(f store.Flags) bool { return f.MDNSent }},
+}
+
+// keywords returns the JMAP keywords for a message, combining flags and
+// keywords. The IMAP \Deleted flag has no JMAP keyword.
+func keywords(m store.Message) map[string]bool {
+	kw := map[string]bool{}
+	for _, fk := range flagKeywords {
+		if fk.flag(m.Flags) {
+			kw[fk.keyword] = true
+		}
+	}
+	for _, k := range m.Keywords {
+		kw[k] = true
+	}
+	return kw
+}
+
+// storeFlag returns the flag or keyword as used by the store for a JMAP keyword.
+func storeFlag(kw string) string {
+	switch kw {
+	case "$seen", "$answered", "$flagged", "$draft":
+		return `\` + kw[1:]
+	}
+	return kw
+}
+
+func addresses(l []message.Address) any {
+	if len(l) == 0 {
+		return nil
+	}
+	r := make([]map[string]any, len(l))
+	for i, a := range l {
+		var name any
+		if a.Name != "" {
+			name = a.Name
+		}
+		r[i] = map[string]any{"name": name, "email": a.User + "@" + a.Host}
+	}
+	return r
+}
+
+// messageIDs returns the message-ids without angle brackets from a header
+// value, or nil.
+func messageIDs(s string) any {
+	var l []string
+	for _, t := range strings.Fields(s) {
+		t = strings.TrimSuffix(strings.TrimPrefix(t, "<"), ">")
+		if t != "" {
+			l = append(l, t)
+		}
+	}
+	if l == nil {
+		return nil
+	}
+	return l
+}
+
+// emailObject returns the JMAP Email for m, with only the requested properties.
+func (c *call) emailObject(m store.Message, props map[string]bool) map[string]any {
+	obj := map[string]any{
+		"id":         emailID(m.ID),
+		"blobId":     blobID(m.ID),
+		"threadId":   threadID(m.ThreadID),
+		"mailboxIds": map[string]bool{mailboxID(m.MailboxID): true},
+		"keywords":   keywords(m),
+		"size":       m.Size,
+		"receivedAt": m.Received.UTC().Format("2006-01-02T15:04:05Z"),
+	}
+	if m.ThreadID == 0 {
+		obj["threadId"] = threadID(m.ID)
+	}
+	if slices.ContainsFunc(emailEnvelopeProperties, func(p string) bool { return props[p] }) {
+		// We only need the envelope, so we don't open the message file for a reader.
+		var env message.Envelope
+		var p message.Part
+		if err := json.Unmarshal(m.ParsedBuf, &p); err != nil {
+			c.log.Debugx("parsing message structure, continuing without envelope", err)
+		} else if p.Envelope != nil {
+			env = *p.Envelope
+		}
+		var sentAt, subject any
+		if !env.Date.IsZero() {
+			sentAt = env.Date.Format(time.RFC3339)
+		}
+		if env.Subject != "" {
+			subject = env.Subject
+		}
+		obj["messageId"] = messageIDs(env.MessageID)
+		obj["inReplyTo"] = messageIDs(env.InReplyTo)
+		obj["sender"] = addresses(env.Sender)
+		obj["from"] = addresses(env.From)
+		obj["to"] = addresses(env.To)
+		obj["cc"] = addresses(env.CC)
+		obj["bcc"] = addresses(env.BCC)
+		obj["replyTo"] = addresses(env.ReplyTo)
+		obj["subject"] = subject
+		obj["sentAt"] = sentAt
+	}
+	return filterProperties(obj, props)
+}
+
+type emailGetArgs struct {
+	getArgs
+
+	// We don't return body parts. These are accepted but ignored.
+	BodyProperties      []string `json:"bodyProperties"`
+	FetchTextBodyValues bool     `json:"fetchTextBodyValues"`
+	FetchHTMLBodyValues bool     `json:"fetchHTMLBodyValues"`
+	FetchAllBodyValues  bool     `json:"fetchAllBodyValues"`
+	MaxBodyValueBytes   int64    `json:"maxBodyValueBytes"`
+}
+
+func emailGet(c *call, a emailGetArgs) any {
+	c.xaccount(a.AccountID)
+	xcheckGetIDs(a.IDs)
+	props := xproperties(a.Properties, emailProperties)
+
+	r := getResult{AccountID: c.accountID, List: []map[string]any{}, NotFound: []string{}}
+	c.xdbread(func(tx *bstore.Tx) {
+		_, r.State = xstate(c.acc, tx)
+
+		if a.IDs == nil {
+			q := bstore.QueryTx[store.Message](tx)
+			q.FilterEqual("Expunged", false)
+			q.SortDesc("Received")
+			q.Limit(maxObjectsInGet + 1)
+			msgs, err := q.List()
+			xcheckf(err, "listing messages")
+			if len(msgs) > maxObjectsInGet {
+				panic(methodError{"requestTooLarge", fmt.Sprintf("more than maximum of %d messages, specify ids", maxObjectsInGet)})
+			}
+			for _, m := range msgs {
+				r.List = append(r.List, c.emailObject(m, props))
+			}
+			return
+		}
+		for _, id := range *a.IDs {
+			mid, ok := parseID("E", id)
+			if !ok {
+				r.NotFound = append(r.NotFound, id)
+				continue
+			}
+			m := store.Message{ID: mid}
+			err := tx.Get(&m)
+			if err == bstore.ErrAbsent || err == nil && m.Expunged {
+				r.NotFound = append(r.NotFound, id)
+				continue
+			}
+			xcheckf(err, "get message")
+			r.List = append(r.List, c.emailObject(m, props))
+		}
+	})
+	return r
+}
+
+type emailFilter struct {
+	InMailbox          string     `json:"inMailbox"`
+	InMailboxOtherThan []string   `json:"inMailboxOtherThan"`
+	Before             *time.Time `json:"before"`
+	After              *time.Time `json:"after"`
+	MinSize            int64      `json:"minSize"`
+	MaxSize            int64      `json:"maxSize"`
+	HasKeyword         string     `json:"hasKeyword"`
+	NotKeyword         string     `json:"notKeyword"`
+}
+
+type comparator struct {
+	Property    string `json:"property"`
+	IsAscending *bool  `json:"isAscending"`
+	Collation   string `json:"collation"`
+}
+
+type emailQueryArgs struct {
+	AccountID       string          `json:"accountId"`
+	Filter          json.RawMessage `json:"filter"`
+	Sort            []comparator    `json:"sort"`
+	Position        int64           `json:"position"`
+	Limit           *int64          `json:"limit"`
+	CalculateTotal  bool            `json:"calculateTotal"`
+	CollapseThreads bool            `json:"collapseThreads"`
+}
+
+type queryResult struct {
+	AccountID           string   `json:"accountId"`
+	QueryState          string   `json:"queryState"`
+	CanCalculateChanges bool     `json:"canCalculateChanges"`
+	Position            int64    `json:"position"`
+	IDs                 []string `json:"ids"`
+	Total               *int64   `json:"total,omitempty"`
+	Limit               *int64   `json:"limit,omitempty"`
+}
+
+// emailQuery lists messages. Only simple filter conditions are supported, no
+// text search or operators. Query changes are not supported, clients query
+// again.
+func emailQuery(c *call, a emailQueryArgs) any {
+	c.xaccount(a.AccountID)
+
+	var f emailFilter
+	if len(a.Filter) > 0 && string(a.Filter) != "null" {
+		dec := json.NewDecoder(bytes.NewReader(a.Filter))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&f); err != nil {
+			panic(methodError{"unsupportedFilter", fmt.Sprintf("parsing filter: %v", err)})
+		}
+	}
+	xmailboxIDs := func(l ...string) []int64 {
+		var ids []int64
+		for _, s := range l {
+			id, ok := parseID("M", s)
+			if !ok {
+				xinvalidArgumentsf("bad mailbox id %q", s)
+			}
+			ids = append(ids, id)
+		}
+		return ids
+	}
+	var inMailboxID int64
+	if f.InMailbox != "" {
+		inMailboxID = xmailboxIDs(f.InMailbox)[0]
+	}
+	otherThan := xmailboxIDs(f.InMailboxOtherThan...)
+
+	// Sort by received time, newest first, by default.
+	sortField, asc := "Received", false
+	if len(a.Sort) > 1 {
+		panic(methodError{"unsupportedSort", "only a single sort property is supported"})
+	} else if len(a.Sort) == 1 {
+		switch a.Sort[0].Property {
+		case "receivedAt":
+			sortField = "Received"
+		case "size":
+			sortField = "Size"
+		default:
+			panic(methodError{"unsupportedSort", fmt.Sprintf("cannot sort by %q", a.Sort[0].Property)})
+		}
+		asc = a.Sort[0].IsAscending == nil || *a.Sort[0].IsAscending
+	}
+
+	limit := int64(maxObjectsInGet)
+	r := queryResult{AccountID: c.accountID, IDs: []string{}}
+	if a.Limit != nil && *a.Limit < 0 {
+		xinvalidArgumentsf("limit must not be negative")
+	} else if a.Limit != nil && *a.Limit <= limit {
+		limit = *a.Limit
+	} else {
+		r.Limit = &limit
+	}
+
+	var ids []int64
+	c.xdbread(func(tx *bstore.Tx) {
+		_, r.QueryState = xstate(c.acc, tx)
+
+		q := bstore.QueryTx[store.Message](tx)
+		q.FilterEqual("Expunged", false)
+		if inMailboxID != 0 {
+			q.FilterNonzero(store.Message{MailboxID: inMailboxID})
+		}
+		q.FilterFn(func(m store.Message) bool {
+			if slices.Contains(otherThan, m.MailboxID) ||
+				f.Before != nil && !m.Received.Before(*f.Before) ||
+				f.After != nil && m.Received.Before(*f.After) ||
+				f.MinSize > 0 && m.Size < f.MinSize ||
+				f.MaxSize > 0 && m.Size >= f.MaxSize {
+				return false
+			}
+			if f.HasKeyword != "" || f.NotKeyword != "" {
+				kw := keywords(m)
+				if f.HasKeyword != "" && !kw[strings.ToLower(f.HasKeyword)] || f.NotKeyword != "" && kw[strings.ToLower(f.NotKeyword)] {
+					return false
+				}
+			}
+			return true
+		})
+		if asc {
+			q.SortAsc(sortField, "ID")
+		} else {
+			q.SortDesc(sortField, "ID")
+		}
+		threads := map[int64]bool{}
+		err := q.ForEach(func(m store.Message) error {
+			if a.CollapseThreads {
+				tid := m.ThreadID
+				if tid == 0 {
+					tid = m.ID
+				}
+				if threads[tid] {
+					return nil
+				}
+				threads[tid] = true
+			}
+			ids = append(ids, m.ID)
+			return nil
+		})
+		xcheckf(err, "listing messages")
+	})
+
+	total := int64(len(ids))
+	if a.CalculateTotal {
+		r.Total = &total
+	}
+	r.Position = a.Position
+	if r.Position < 0 {
+		r.Position = max(0, total+r.Position)
+	}
+	for i := r.Position; i < total && i < r.Position+limit; i++ {
+		r.IDs = append(r.IDs, emailID(ids[i]))
+	}
+	return r
+}
+
+// emailChanges returns the changed messages, based on their modseq. Expunged
+// messages are kept in the database, so we can report them as destroyed. Moving
+// a message keeps its ID, but leaves an expunged copy with a new ID behind for
+// IMAP, which is also reported as destroyed. Clients ignore unknown ids.
+func emailChanges(c *call, a changesArgs) any {
+	r := c.newChangesResult(a)
+	since := xparseState(a.SinceState)
+
+	c.xdbread(func(tx *bstore.Tx) {
+		var modseq store.ModSeq
+		modseq, r.NewState = xstate(c.acc, tx)
+		delModSeq, err := c.acc.HighestDeletedModSeq(tx)
+		xcheckf(err, "get highest deleted modseq")
+		if since < delModSeq || since > modseq {
+			panic(methodError{"cannotCalculateChanges", "changes since state no longer available"})
+		}
+
+		var n int
+		var last store.ModSeq
+		var tooMany bool
+		q := bstore.QueryTx[store.Message](tx)
+		q.FilterGreater("ModSeq", since)
+		q.SortAsc("ModSeq")
+		err = q.ForEach(func(m store.Message) error {
+			// We can only stop between modseqs, the new state is a modseq.
+			if a.MaxChanges != nil && n >= *a.MaxChanges {
+				if m.ModSeq == last {
+					tooMany = true
+				} else {
+					r.HasMoreChanges = true
+					r.NewState = fmt.Sprintf("%d", last)
+				}
+				return bstore.StopForEach
+			}
+			last = m.ModSeq
+			if m.Expunged {
+				// Messages created and expunged since the state are not reported.
+				if m.CreateSeq <= since {
+					r.Destroyed = append(r.Destroyed, emailID(m.ID))
+					n++
+				}
+			} else if m.CreateSeq > since {
+				r.Created = append(r.Created, emailID(m.ID))
+				n++
+			} else {
+				r.Updated = append(r.Updated, emailID(m.ID))
+				n++
+			}
+			return nil
+		})
+		xcheckf(err, "listing changed messages")
+		if tooMany {
+			panic(methodError{"cannotCalculateChanges", "more than maxChanges changes in a single state change"})
+		}
+	})
+	return r
+}
+
+type emailSetArgs struct {
+	AccountID string                                `json:"accountId"`
+	IfInState *string                               `json:"ifInState"`
+	Create    map[string]json.RawMessage            `json:"create"`
+	Update    map[string]map[string]json.RawMessage `json:"update"`
+	Destroy   []string                              `json:"destroy"`
+}
+
+type setError struct {
+	Type        string `json:"type"`
+	Description string `json:"description,omitempty"`
+}
+
+type setResult struct {
+	AccountID    string              `json:"accountId"`
+	OldState     string              `json:"oldState"`
+	NewState     string              `json:"newState"`
+	Created      map[string]any      `json:"created"`
+	Updated      map[string]any      `json:"updated"`
+	Destroyed    []string            `json:"destroyed"`
+	NotCreated   map[string]setError `json:"notCreated"`
+	NotUpdated   map[string]setError `json:"notUpdated"`
+	NotDestroyed map[string]setError `json:"notDestroyed"`
+}
+
+// trySet calls fn, turning method errors into a set error.
+func trySet(fn func()) (serr *setError) {
+	defer func() {
+		x := recover()
+		if x == nil {
+			return
+		}
+		merr, ok := x.(methodError)
+		if !ok || merr.Type == "serverFail" {
+			panic(x)
+		}
+		if merr.Type == "invalidArguments" {
+			merr.Type = "invalidProperties"
+		}
+		serr = &setError{merr.Type, merr.Description}
+	}()
+	fn()
+	return nil
+}
+
+// emailSet changes keywords and mailboxes of messages, and destroys messages.
+// Creating messages is not supported.
+func emailSet(c *call, a emailSetArgs) any {
+	c.xaccount(a.AccountID)
+	if len(a.Create)+len(a.Update)+len(a.Destroy) > maxObjectsInSet {
+		panic(methodError{"requestTooLarge", fmt.Sprintf("more than maximum of %d objects", maxObjectsInSet)})
+	}
+
+	r := setResult{AccountID: c.accountID}
+	c.xdbread(func(tx *bstore.Tx) {
+		_, r.OldState = xstate(c.acc, tx)
+	})
+	if a.IfInState != nil && *a.IfInState != r.OldState {
+		panic(methodError{Type: "stateMismatch"})
+	}
+
+	for id := range a.Create {
+		if r.NotCreated == nil {
+			r.NotCreated = map[string]setError{}
+		}
+		r.NotCreated[id] = setError{"forbidden", "creating emails is not supported"}
+	}
+
+	for id, patch := range a.Update {
+		serr := trySet(func() { c.xemailUpdate(id, patch) })
+		if serr != nil {
+			if r.NotUpdated == nil {
+				r.NotUpdated = map[string]setError{}
+			}
+			r.NotUpdated[id] = *serr
+		} else {
+			if r.Updated == nil {
+				r.Updated = map[string]any{}
+			}
+			r.Updated[id] = nil
+		}
+	}
+
+	for _, id := range a.Destroy {
+		serr := trySet(func() {
+			mid, ok := parseID("E", id)
+			if !ok {
+				panic(methodError{Type: "notFound"})
+			}
+			xops.MessageDelete(c.ctx, c.log, c.acc, []int64{mid})
+		})
+		if serr != nil {
+			if r.NotDestroyed == nil {
+				r.NotDestroyed = map[string]setError{}
+			}
+			r.NotDestroyed[id] = *serr
+		} else {
+			r.Destroyed = append(r.Destroyed, id)
+		}
+	}
+
+	c.xdbread(func(tx *bstore.Tx) {
+		_, r.NewState = xstate(c.acc, tx)
+	})
+	return r
+}
+
+// xemailUpdate applies a patch with keywords and/or mailboxIds to a message.
+func (c *call) xemailUpdate(id string, patch map[string]json.RawMessage) {
+	mid, ok := parseID("E", id)
+	if !ok {
+		panic(methodError{Type: "notFound"})
+	}
+	var m store.Message
+	c.xdbread(func(tx *bstore.Tx) {
+		m = store.Message{ID: mid}
+		err := tx.Get(&m)
+		if err == bstore.ErrAbsent || err == nil && m.Expunged {
+			panic(methodError{Type: "notFound"})
+		}
+		xcheckf(err, "get message")
+	})
+
+	xbool := func(k string, buf json.RawMessage) bool {
+		switch string(buf) {
+		case "true":
+			return true
+		case "null":
+			return false
+		}
+		xinvalidArgumentsf("value for %q must be true or null", k)
+		panic("not reached")
+	}
+	xmailboxID := func(s string) int64 {
+		mbID, ok := parseID("M", s)
+		if !ok {
+			xinvalidArgumentsf("bad mailbox id %q", s)
+		}
+		return mbID
+	}
+
+	cur := keywords(m)
+	target := maps.Clone(cur)
+	mailboxIDs := map[int64]bool{m.MailboxID: true}
+	for k, v := range patch {
+		if k == "keywords" {
+			var kw map[string]bool
+			if err := json.Unmarshal(v, &kw); err != nil {
+				xinvalidArgumentsf("parsing keywords: %v", err)
+			}
+			target = map[string]bool{}
+			for kw, set := range kw {
+				if !set {
+					xinvalidArgumentsf("keyword values must be true")
+				}
+				target[strings.ToLower(kw)] = true
+			}
+		} else if kw, ok := strings.CutPrefix(k, "keywords/"); ok {
+			if xbool(k, v) {
+				target[strings.ToLower(kw)] = true
+			} else {
+				delete(target, strings.ToLower(kw))
+			}
+		} else if k == "mailboxIds" {
+			var ids map[string]bool
+			if err := json.Unmarshal(v, &ids); err != nil {
+				xinvalidArgumentsf("parsing mailboxIds: %v", err)
+			}
+			mailboxIDs = map[int64]bool{}
+			for s, set := range ids {
+				if !set {
+					xinvalidArgumentsf("mailboxIds values must be true")
+				}
+				mailboxIDs[xmailboxID(s)] = true
+			}
+		} else if s, ok := strings.CutPrefix(k, "mailboxIds/"); ok {
+			if xbool(k, v) {
+				mailboxIDs[xmailboxID(s)] = true
+			} else {
+				delete(mailboxIDs, xmailboxID(s))
+			}
+		} else {
+			xinvalidArgumentsf("cannot update property %q", k)
+		}
+	}
+	if len(mailboxIDs) != 1 {
+		xinvalidArgumentsf("message must be in exactly one mailbox")
+	}
+
+	var add, clear []string
+	for kw := range target {
+		if !cur[kw] {
+			add = append(add, storeFlag(kw))
+		}
+	}
+	for kw := range cur {
+		if !target[kw] {
+			clear = append(clear, storeFlag(kw))
+		}
+	}
+	if len(add) > 0 {
+		xops.MessageFlagsAdd(c.ctx, c.log, c.acc, []int64{mid}, add)
+	}
+	if len(clear) > 0 {
+		xops.MessageFlagsClear(c.ctx, c.log, c.acc, []int64{mid}, clear)
+	}
+	for mbID := range mailboxIDs {
+		if mbID != m.MailboxID {
+			xops.MessageMove(c.ctx, c.log, c.acc, []int64{mid}, "", mbID)
+		}
+	}
+}
+
+// xthreadMessages returns the non-expunged messages in a thread, oldest first.
+// Messages without thread id, from before threading was added and not yet
+// upgraded, are their own thread.
+func xthreadMessages(tx *bstore.Tx, tid int64) []store.Message {
+	q := bstore.QueryTx[store.Message](tx)
+	q.FilterNonzero(store.Message{ThreadID: tid})
+	q.FilterEqual("Expunged", false)
+	q.SortAsc("Received", "ID")
+	msgs, err := q.List()
+	xcheckf(err, "listing messages in thread")
+	if len(msgs) == 0 {
+		m := store.Message{ID: tid}
+		err := tx.Get(&m)
+		if err == nil && m.ThreadID == 0 && !m.Expunged {
+			msgs = []store.Message{m}
+		} else if err != bstore.ErrAbsent {
+			xcheckf(err, "get message")
+		}
+	}
+	return msgs
+}
+
+func threadGet(c *call, a getArgs) any {
+	c.xaccount(a.AccountID)
+	xcheckGetIDs(a.IDs)
+	if a.IDs == nil {
+		xinvalidArgumentsf("ids required")
+	}
+	props := xproperties(a.Properties, []string{"emailIds"})
+
+	r := getResult{AccountID: c.accountID, List: []map[string]any{}, NotFound: []string{}}
+	c.xdbread(func(tx *bstore.Tx) {
+		_, r.State = xstate(c.acc, tx)
+
+		for _, id := range *a.IDs {
+			tid, ok := parseID("T", id)
+			if !ok {
+				r.NotFound = append(r.NotFound, id)
+				continue
+			}
+			msgs := xthreadMessages(tx, tid)
+			if len(msgs) == 0 {
+				r.NotFound = append(r.NotFound, id)
+				continue
+			}
+			emailIDs := make([]string, len(msgs))
+			for i, m := range msgs {
+				emailIDs[i] = emailID(m.ID)
+			}
+			r.List = append(r.List, filterProperties(map[string]any{"id": id, "emailIds": emailIDs}, props))
+		}
+	})
+	return r
+}
+
+// threadChanges returns threads with changed messages. A thread is created if
+// all its messages were created since the state, and destroyed if it no longer
+// has messages.
+func threadChanges(c *call, a changesArgs) any {
+	r := c.newChangesResult(a)
+	since := xparseState(a.SinceState)
+
+	c.xdbread(func(tx *bstore.Tx) {
+		var modseq store.ModSeq
+		modseq, r.NewState = xstate(c.acc, tx)
+		delModSeq, err := c.acc.HighestDeletedModSeq(tx)
+		xcheckf(err, "get highest deleted modseq")
+		if since < delModSeq || since > modseq {
+			panic(methodError{"cannotCalculateChanges", "changes since state no longer available"})
+		}
+
+		// Threads with changed messages, with whether they existed at the state.
+		existed := map[int64]bool{}
+		q := bstore.QueryTx[store.Message](tx)
+		q.FilterGreater("ModSeq", since)
+		err = q.ForEach(func(m store.Message) error {
+			tid := m.ThreadID
+			if tid == 0 {
+				tid = m.ID
+			}
+			existed[tid] = existed[tid] || m.CreateSeq <= since
+			return nil
+		})
+		xcheckf(err, "listing changed messages")
+		if a.MaxChanges != nil && len(existed) > *a.MaxChanges {
+			panic(methodError{"cannotCalculateChanges", "more than maxChanges changes"})
+		}
+
+		tids := make([]int64, 0, len(existed))
+		for tid := range existed {
+			tids = append(tids, tid)
+		}
+		slices.Sort(tids)
+		for _, tid := range tids {
+			msgs := xthreadMessages(tx, tid)
+			created := !existed[tid]
+			for _, m := range msgs {
+				if m.CreateSeq <= since {
+					created = false
+				}
+			}
+			if len(msgs) == 0 {
+				if existed[tid] {
+					r.Destroyed = append(r.Destroyed, threadID(tid))
+				}
+			} else if created {
+				r.Created = append(r.Created, threadID(tid))
+			} else {
+				r.Updated = append(r.Updated, threadID(tid))
+			}
+		}
+	})
+	return r
+}
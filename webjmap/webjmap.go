@@ -0,0 +1,824 @@
+// Package webjmap implements a JMAP server, for synchronizing email with JMAP
+// clients over HTTP, as alternative to IMAP.
+//
+// JMAP Core (RFC 8620) and JMAP Mail (RFC 8621) are partially implemented:
+// Mailbox/get, Mailbox/changes, Email/get, Email/query, Email/changes, Email/set
+// (changing keywords, moving to another mailbox and destroying), Thread/get,
+// Thread/changes and Core/echo. Raw messages can be downloaded as blobs. State
+// changes are pushed over an event source. Clients can download the raw message
+// through its blob id instead of requesting body part properties.
+//
+// This is enough for reading and organizing email. Clients that also compose,
+// send or import messages, or manage mailboxes, cannot be used fully yet. Not
+// implemented: uploading blobs (maxSizeUpload is 0), creating emails with
+// Email/set, Email/import, Mailbox/set, EmailSubmission (the submission
+// capability is not advertised), identities, search snippets, vacation responses
+// and body part properties. Unimplemented methods return an unknownMethod error.
+//
+// Ids are persistent, they don't change when a message is moved, and are never
+// reused: "M" followed by the database ID for mailboxes, "E" for emails, "T" for
+// threads and "B" for blobs (raw messages). States are the last modification
+// sequence (modseq) of the account, also used for IMAP CONDSTORE/QRESYNC.
+package webjmap
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net"
+	"net/http"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/mjl-/bstore"
+
+	"github.com/mjl-/mox/metrics"
+	"github.com/mjl-/mox/mlog"
+	"github.com/mjl-/mox/mox-"
+	"github.com/mjl-/mox/moxio"
+	"github.com/mjl-/mox/store"
+	"github.com/mjl-/mox/webauth"
+)
+
+var pkglog = mlog.New("webjmap", nil)
+
+var (
+	metricResults = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "mox_webjmap_results_total",
+			Help: "JMAP method call results by method and result.",
+		},
+		[]string{"method", "result"}, // result: "badauth", "ok", or error type
+	)
+	metricDuration = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "mox_webjmap_duration_seconds",
+			Help:    "JMAP HTTP request duration by endpoint.",
+			Buckets: []float64{0.01, 0.05, 0.1, 0.5, 1, 5, 10, 20, 30},
+		},
+		[]string{"endpoint"},
+	)
+)
+
+// Capabilities we implement.
+const (
+	capCore = "urn:ietf:params:jmap:core"
+	capMail = "urn:ietf:params:jmap:mail"
+)
+
+// Limits, announced in the session resource.
+const (
+	maxSizeRequest        = 10 * 1024 * 1024
+	maxConcurrentRequests = 4
+	maxCallsInRequest     = 16
+	maxObjectsInGet       = 500
+	maxObjectsInSet       = 500
+)
+
+// NewServer returns a new http.Handler for a JMAP server at path, typically
+// /jmap/. The session resource is at path "session".
+func NewServer(path string, isForwarded bool) http.Handler {
+	return server{path, isForwarded}
+}
+
+type server struct {
+	path        string // Path the JMAP server is configured under, typically /jmap/.
+	isForwarded bool   // Whether incoming requests are reverse-proxied. Used for getting remote IPs for rate limiting, and for the scheme of URLs.
+}
+
+// ServeHTTP implements http.Handler. The request path must have the configured
+// path stripped, except for the final slash.
+func (s server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	log := pkglog.WithContext(r.Context()) // Take cid from webserver.
+
+	var endpoint string
+	switch {
+	case r.URL.Path == "/":
+		if r.Method != "GET" {
+			http.Error(w, "405 - method not allowed - use get", http.StatusMethodNotAllowed)
+			return
+		}
+		http.Redirect(w, r, s.path+"session", http.StatusSeeOther)
+		return
+	case r.URL.Path == "/session":
+		endpoint = "session"
+	case r.URL.Path == "/api/":
+		endpoint = "api"
+	case strings.HasPrefix(r.URL.Path, "/download/"):
+		endpoint = "download"
+	case strings.HasPrefix(r.URL.Path, "/upload/"):
+		// We don't have anything to use uploaded blobs for.
+		http.Error(w, "501 - not implemented - uploading blobs not supported", http.StatusNotImplemented)
+		return
+	case r.URL.Path == "/eventsource/":
+		endpoint = "eventsource"
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	if endpoint == "api" && r.Method != "POST" {
+		http.Error(w, "405 - method not allowed - use post", http.StatusMethodNotAllowed)
+		return
+	} else if endpoint != "api" && r.Method != "GET" {
+		http.Error(w, "405 - method not allowed - use get", http.StatusMethodNotAllowed)
+		return
+	}
+
+	t0 := time.Now()
+	defer func() {
+		metricDuration.WithLabelValues(endpoint).Observe(float64(time.Since(t0)) / float64(time.Second))
+	}()
+
+	email, acc, ok := s.authenticate(log, w, r, endpoint)
+	if !ok {
+		return
+	}
+	defer func() {
+		err := acc.Close()
+		log.Check(err, "closing account")
+	}()
+	log = log.With(slog.String("account", acc.Name))
+
+	switch endpoint {
+	case "session":
+		s.serveSession(log, w, r, email, acc)
+	case "api":
+		s.serveAPI(log, w, r, acc)
+	case "download":
+		s.serveDownload(log, w, r, acc)
+	case "eventsource":
+		s.serveEventSource(log, w, r, acc)
+	}
+}
+
+// authenticate checks the http basic authentication credentials, returning the
+// opened account. If ok is false, a response has been written.
+func (s server) authenticate(log mlog.Log, w http.ResponseWriter, r *http.Request, endpoint string) (email string, acc *store.Account, ok bool) {
+	email, password, aok := r.BasicAuth()
+	if !aok {
+		metricResults.WithLabelValues(endpoint, "badauth").Inc()
+		log.Debug("missing http basic authentication credentials")
+		w.Header().Set("WWW-Authenticate", "Basic realm=jmap")
+		http.Error(w, "401 - unauthorized - use http basic auth with email address as username", http.StatusUnauthorized)
+		return "", nil, false
+	}
+	log = log.With(slog.String("username", email))
+
+	t0 := time.Now()
+
+	// If remote IP/network resulted in too many authentication failures, refuse to serve.
+	remoteIP := webauth.RemoteIP(log, s.isForwarded, r)
+	if remoteIP == nil {
+		metricResults.WithLabelValues(endpoint, "internal").Inc()
+		log.Debug("cannot find remote ip for rate limiter")
+		http.Error(w, "500 - internal server error - cannot find remote ip", http.StatusInternalServerError)
+		return "", nil, false
+	}
+	if !mox.LimiterFailedAuth.CanAdd(remoteIP, t0, 1) {
+		metrics.AuthenticationRatelimitedInc("webjmap")
+		log.Debug("refusing connection due to many auth failures", slog.Any("remoteip", remoteIP))
+		http.Error(w, "429 - too many auth attempts", http.StatusTooManyRequests)
+		return "", nil, false
+	}
+
+	la := loginAttempt(r, "webjmap", "httpbasic")
+	la.LoginAddress = email
+	defer func() {
+		store.LoginAttemptAdd(context.Background(), log, la)
+	}()
+
+	authLockedOut := func(err error) {
+		la.Result = store.AuthLockedOut
+		log.Infox("authentication refused due to lockout", err, slog.String("account", la.AccountName), slog.Any("remoteip", remoteIP))
+		metricResults.WithLabelValues(endpoint, "badauth").Inc()
+		http.Error(w, "429 - too many requests - "+err.Error(), http.StatusTooManyRequests)
+	}
+
+	err := store.AuthLockoutCheck(r.Context(), remoteIP, "")
+	if errors.Is(err, store.ErrAuthLockedOut) {
+		authLockedOut(err)
+		return "", nil, false
+	} else if err != nil {
+		log.Errorx("checking authentication lockout", err)
+		http.Error(w, "500 - internal server error - checking authentication lockout", http.StatusInternalServerError)
+		return "", nil, false
+	}
+
+	acc, la.AccountName, err = store.OpenEmailAuth(log, email, password, true)
+	if errors.Is(err, store.ErrAuthLockedOut) {
+		authLockedOut(err)
+		return "", nil, false
+	} else if err != nil {
+		mox.LimiterFailedAuth.Add(remoteIP, t0, 1)
+		if errors.Is(err, mox.ErrDomainNotFound) || errors.Is(err, mox.ErrAddressNotFound) || errors.Is(err, store.ErrUnknownCredentials) || errors.Is(err, store.ErrLoginDisabled) {
+			log.Debug("bad http basic authentication credentials")
+			metricResults.WithLabelValues(endpoint, "badauth").Inc()
+			la.Result = store.AuthBadCredentials
+			msg := "use http basic auth with email address as username"
+			if errors.Is(err, store.ErrLoginDisabled) {
+				la.Result = store.AuthLoginDisabled
+				msg = "login is disabled for this account"
+			}
+			w.Header().Set("WWW-Authenticate", "Basic realm=jmap")
+			http.Error(w, "401 - unauthorized - "+msg, http.StatusUnauthorized)
+			return "", nil, false
+		}
+		log.Errorx("verifying credentials", err)
+		http.Error(w, "500 - internal server error - verifying credentials", http.StatusInternalServerError)
+		return "", nil, false
+	}
+	la.AccountName = acc.Name
+	if accConf, ok := acc.Conf(); ok && !accConf.LoginNetworkAllowed(remoteIP) {
+		la.Result = store.AuthNetworkDenied
+		log.Info("account login from network not allowed", slog.String("account", acc.Name), slog.Any("remoteip", remoteIP))
+		metricResults.WithLabelValues(endpoint, "badauth").Inc()
+		err := acc.Close()
+		log.Check(err, "closing account")
+		http.Error(w, "403 - forbidden - "+store.ErrLoginNetwork.Error(), http.StatusForbidden)
+		return "", nil, false
+	}
+	la.Result = store.AuthSuccess
+	mox.LimiterFailedAuth.Reset(remoteIP, t0)
+	return email, acc, true
+}
+
+// loginAttempt initializes a store.LoginAttempt, for adding to the store after
+// filling in the results and other details.
+func loginAttempt(r *http.Request, protocol, authMech string) store.LoginAttempt {
+	remoteIP, _, _ := net.SplitHostPort(r.RemoteAddr)
+	if remoteIP == "" {
+		remoteIP = r.RemoteAddr
+	}
+
+	return store.LoginAttempt{
+		RemoteIP:  remoteIP,
+		TLS:       store.LoginAttemptTLS(r.TLS),
+		Protocol:  protocol,
+		AuthMech:  authMech,
+		UserAgent: r.UserAgent(),
+		Result:    store.AuthError, // Replaced by caller.
+	}
+}
+
+// accountID returns the JMAP account id for an account name. Account names can
+// contain characters not allowed in JMAP ids, so we encode them.
+func accountID(accName string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(accName))
+}
+
+// baseURL returns the absolute URL of the JMAP server, ending with a slash.
+func (s server) baseURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil || s.isForwarded && r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host + s.path
+}
+
+// serveSession serves the session resource, with capabilities, accounts and
+// URLs of the other endpoints. ../rfc/8620
+func (s server) serveSession(log mlog.Log, w http.ResponseWriter, r *http.Request, email string, acc *store.Account) {
+	id := accountID(acc.Name)
+	base := s.baseURL(r)
+	session := map[string]any{
+		"capabilities": map[string]any{
+			capCore: map[string]any{
+				"maxSizeUpload":         0,
+				"maxConcurrentUpload":   1,
+				"maxSizeRequest":        maxSizeRequest,
+				"maxConcurrentRequests": maxConcurrentRequests,
+				"maxCallsInRequest":     maxCallsInRequest,
+				"maxObjectsInGet":       maxObjectsInGet,
+				"maxObjectsInSet":       maxObjectsInSet,
+				"collationAlgorithms":   []string{},
+			},
+			capMail: map[string]any{},
+		},
+		"accounts": map[string]any{
+			id: map[string]any{
+				"name":       acc.Name,
+				"isPersonal": true,
+				"isReadOnly": false,
+				"accountCapabilities": map[string]any{
+					capMail: map[string]any{
+						"maxMailboxesPerEmail":       1,
+						"maxMailboxDepth":            nil,
+						"maxSizeMailboxName":         255,
+						"maxSizeAttachmentsPerEmail": 0,
+						"emailQuerySortOptions":      []string{"receivedAt", "size"},
+						"mayCreateTopLevelMailbox":   false,
+					},
+				},
+			},
+		},
+		"primaryAccounts": map[string]string{capMail: id},
+		"username":        email,
+		"apiUrl":          base + "api/",
+		"downloadUrl":     base + "download/{accountId}/{blobId}/{name}?type={type}",
+		"uploadUrl":       base + "upload/{accountId}/",
+		"eventSourceUrl":  base + "eventsource/?types={types}&closeafter={closeafter}&ping={ping}",
+		"state":           sessionState,
+	}
+	metricResults.WithLabelValues("session", "ok").Inc()
+	writeJSON(log, w, http.StatusOK, "application/json", session)
+}
+
+// The session only has the authenticated account, with fixed capabilities.
+const sessionState = "0"
+
+func writeJSON(log mlog.Log, w http.ResponseWriter, status int, contentType string, v any) {
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Cache-Control", "no-cache, no-store")
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil && !moxio.IsClosed(err) {
+		log.Infox("writing response", err)
+	}
+}
+
+// writeProblem writes a request-level error as problem details JSON. ../rfc/8620
+func writeProblem(log mlog.Log, w http.ResponseWriter, status int, typ, detail string) {
+	metricResults.WithLabelValues("api", typ).Inc()
+	log.Debug("jmap request error", slog.String("type", typ), slog.String("detail", detail))
+	problem := map[string]any{
+		"type":   "urn:ietf:params:jmap:error:" + typ,
+		"status": status,
+		"detail": detail,
+	}
+	writeJSON(log, w, status, "application/problem+json", problem)
+}
+
+// request is a JMAP API request. ../rfc/8620
+type request struct {
+	Using       []string          `json:"using"`
+	MethodCalls []invocation      `json:"methodCalls"`
+	CreatedIDs  map[string]string `json:"createdIds,omitempty"`
+}
+
+// response is a JMAP API response. ../rfc/8620
+type response struct {
+	MethodResponses []invocation      `json:"methodResponses"`
+	CreatedIDs      map[string]string `json:"createdIds,omitempty"`
+	SessionState    string            `json:"sessionState"`
+}
+
+// invocation is a method call or response, encoded as JSON array with name,
+// arguments and call id.
+type invocation struct {
+	Name   string
+	Args   any
+	CallID string
+}
+
+func (i invocation) MarshalJSON() ([]byte, error) {
+	return json.Marshal([]any{i.Name, i.Args, i.CallID})
+}
+
+func (i *invocation) UnmarshalJSON(buf []byte) error {
+	var l []json.RawMessage
+	if err := json.Unmarshal(buf, &l); err != nil {
+		return err
+	}
+	if len(l) != 3 {
+		return fmt.Errorf("invocation must have 3 elements, not %d", len(l))
+	}
+	var args map[string]any
+	dec := json.NewDecoder(bytes.NewReader(l[1]))
+	dec.UseNumber()
+	if err := json.Unmarshal(l[0], &i.Name); err != nil {
+		return fmt.Errorf("parsing method name: %v", err)
+	} else if err := dec.Decode(&args); err != nil || args == nil {
+		return fmt.Errorf("arguments must be an object")
+	} else if err := json.Unmarshal(l[2], &i.CallID); err != nil {
+		return fmt.Errorf("parsing call id: %v", err)
+	}
+	i.Args = args
+	return nil
+}
+
+// serveAPI handles a JMAP API request with method calls. ../rfc/8620
+func (s server) serveAPI(log mlog.Log, w http.ResponseWriter, r *http.Request, acc *store.Account) {
+	ct, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || ct != "application/json" {
+		writeProblem(log, w, http.StatusBadRequest, "notJSON", "content-type must be application/json")
+		return
+	}
+	buf, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxSizeRequest))
+	if err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			writeProblem(log, w, http.StatusBadRequest, "limit", "request too large")
+		} else {
+			log.Debugx("reading request", err)
+		}
+		return
+	}
+	if !json.Valid(buf) {
+		writeProblem(log, w, http.StatusBadRequest, "notJSON", "request is not valid json")
+		return
+	}
+	var req request
+	dec := json.NewDecoder(bytes.NewReader(buf))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		writeProblem(log, w, http.StatusBadRequest, "notRequest", "parsing request: "+err.Error())
+		return
+	}
+	using := map[string]bool{}
+	for _, c := range req.Using {
+		if c != capCore && c != capMail {
+			writeProblem(log, w, http.StatusBadRequest, "unknownCapability", "unknown capability "+c)
+			return
+		}
+		using[c] = true
+	}
+	if len(req.MethodCalls) > maxCallsInRequest {
+		writeProblem(log, w, http.StatusBadRequest, "limit", fmt.Sprintf("more than maximum of %d method calls", maxCallsInRequest))
+		return
+	}
+
+	c := &call{
+		ctx:        r.Context(),
+		log:        log,
+		acc:        acc,
+		accountID:  accountID(acc.Name),
+		createdIDs: req.CreatedIDs,
+	}
+	resp := response{MethodResponses: []invocation{}, SessionState: sessionState}
+	for _, inv := range req.MethodCalls {
+		resp.MethodResponses = append(resp.MethodResponses, c.invoke(inv, using, resp.MethodResponses)...)
+	}
+	if req.CreatedIDs != nil {
+		resp.CreatedIDs = c.createdIDs
+	}
+	writeJSON(log, w, http.StatusOK, "application/json", resp)
+}
+
+// call holds the state for method calls in an API request.
+type call struct {
+	ctx        context.Context
+	log        mlog.Log
+	acc        *store.Account
+	accountID  string
+	createdIDs map[string]string
+}
+
+// methodError is a method-level error, returned as "error" response. Method
+// implementations panic with a methodError, typically through xcheckf.
+type methodError struct {
+	Type        string `json:"type"`
+	Description string `json:"description,omitempty"`
+}
+
+func (e methodError) Error() string {
+	return e.Type + ": " + e.Description
+}
+
+func xcheckf(err error, format string, args ...any) {
+	if err != nil {
+		msg := fmt.Sprintf(format, args...)
+		panic(methodError{"serverFail", fmt.Sprintf("%s: %s", msg, err)})
+	}
+}
+
+func xinvalidArgumentsf(format string, args ...any) {
+	panic(methodError{"invalidArguments", fmt.Sprintf(format, args...)})
+}
+
+// invoke calls a method and returns the responses.
+func (c *call) invoke(inv invocation, using map[string]bool, prevResponses []invocation) (responses []invocation) {
+	t0 := time.Now()
+	result := "ok"
+	defer func() {
+		x := recover()
+		if x != nil {
+			merr, ok := x.(methodError)
+			if !ok {
+				c.log.Error("unhandled panic in jmap method call", slog.Any("x", x), slog.String("method", inv.Name))
+				metrics.PanicInc(metrics.Webjmap)
+				debug.PrintStack()
+				merr = methodError{"serverFail", "unhandled error"}
+			}
+			result = merr.Type
+			responses = []invocation{{"error", merr, inv.CallID}}
+		}
+		c.log.Debug("jmap method call", slog.String("method", inv.Name), slog.String("result", result), slog.Duration("duration", time.Since(t0)))
+		metricResults.WithLabelValues(inv.Name, result).Inc()
+	}()
+
+	m, ok := methods[inv.Name]
+	if !ok {
+		panic(methodError{Type: "unknownMethod"})
+	}
+	capability := capMail
+	if strings.HasPrefix(inv.Name, "Core/") {
+		capability = capCore
+	}
+	if !using[capability] {
+		panic(methodError{"unknownMethod", "capability " + capability + " not in using"})
+	}
+
+	args := c.xresolveReferences(inv.Args.(map[string]any), prevResponses)
+	buf, err := json.Marshal(args)
+	xcheckf(err, "marshal arguments")
+	resp := m(c, buf)
+	return []invocation{{inv.Name, resp, inv.CallID}}
+}
+
+// xresolveReferences replaces arguments with a "#" prefix by the values they
+// reference in earlier responses. ../rfc/8620
+func (c *call) xresolveReferences(args map[string]any, prevResponses []invocation) map[string]any {
+	nargs := map[string]any{}
+	for k, v := range args {
+		name, ok := strings.CutPrefix(k, "#")
+		if !ok {
+			nargs[k] = v
+			continue
+		}
+		if _, ok := args[name]; ok {
+			xinvalidArgumentsf("both %q and %q present", name, k)
+		}
+		var ref struct {
+			ResultOf string `json:"resultOf"`
+			Name     string `json:"name"`
+			Path     string `json:"path"`
+		}
+		buf, err := json.Marshal(v)
+		xcheckf(err, "marshal result reference")
+		dec := json.NewDecoder(bytes.NewReader(buf))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&ref); err != nil {
+			panic(methodError{"invalidResultReference", fmt.Sprintf("parsing result reference: %v", err)})
+		}
+		var found bool
+		for _, resp := range prevResponses {
+			if resp.CallID != ref.ResultOf {
+				continue
+			}
+			if resp.Name != ref.Name {
+				panic(methodError{"invalidResultReference", fmt.Sprintf("response for call id %q is %q, not %q", ref.ResultOf, resp.Name, ref.Name)})
+			}
+			// Turn typed response into plain JSON values for evaluating the pointer.
+			buf, err := json.Marshal(resp.Args)
+			xcheckf(err, "marshal response")
+			var x any
+			dec := json.NewDecoder(bytes.NewReader(buf))
+			dec.UseNumber()
+			err = dec.Decode(&x)
+			xcheckf(err, "unmarshal response")
+			nargs[name], err = evalPointer(x, ref.Path)
+			if err != nil {
+				panic(methodError{"invalidResultReference", fmt.Sprintf("evaluating path %q: %v", ref.Path, err)})
+			}
+			found = true
+			break
+		}
+		if !found {
+			panic(methodError{"invalidResultReference", fmt.Sprintf("no response for call id %q", ref.ResultOf)})
+		}
+	}
+	return nargs
+}
+
+// evalPointer evaluates a JSON pointer, with the JMAP extension that "*" maps
+// over arrays, flattening arrays of arrays. ../rfc/8620
+func evalPointer(v any, path string) (any, error) {
+	if path == "" {
+		return v, nil
+	}
+	if !strings.HasPrefix(path, "/") {
+		return nil, errors.New("path must start with slash")
+	}
+	token, rest, _ := strings.Cut(path[1:], "/")
+	if rest != "" || strings.HasSuffix(path, "/") {
+		rest = "/" + rest
+	}
+	token = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+	switch x := v.(type) {
+	case map[string]any:
+		e, ok := x[token]
+		if !ok {
+			return nil, fmt.Errorf("no member %q", token)
+		}
+		return evalPointer(e, rest)
+	case []any:
+		if token == "*" {
+			l := []any{}
+			for _, e := range x {
+				r, err := evalPointer(e, rest)
+				if err != nil {
+					return nil, err
+				}
+				if rl, ok := r.([]any); ok {
+					l = append(l, rl...)
+				} else {
+					l = append(l, r)
+				}
+			}
+			return l, nil
+		}
+		index, err := strconv.ParseUint(token, 10, 31)
+		if err != nil || int(index) >= len(x) {
+			return nil, fmt.Errorf("bad array index %q", token)
+		}
+		return evalPointer(x[index], rest)
+	}
+	return nil, fmt.Errorf("cannot evaluate %q on non-object/array", token)
+}
+
+// serveDownload serves a raw message as blob.
+func (s server) serveDownload(log mlog.Log, w http.ResponseWriter, r *http.Request, acc *store.Account) {
+	// Path: /download/{accountId}/{blobId}/{name}
+	t := strings.Split(strings.TrimPrefix(r.URL.Path, "/download/"), "/")
+	if len(t) != 3 || t[0] != accountID(acc.Name) {
+		metricResults.WithLabelValues("download", "notFound").Inc()
+		http.NotFound(w, r)
+		return
+	}
+	id, ok := parseID("B", t[1])
+	if !ok {
+		metricResults.WithLabelValues("download", "notFound").Inc()
+		http.NotFound(w, r)
+		return
+	}
+	m := store.Message{ID: id}
+	err := acc.DB.Get(r.Context(), &m)
+	if err == bstore.ErrAbsent || err == nil && m.Expunged {
+		metricResults.WithLabelValues("download", "notFound").Inc()
+		http.NotFound(w, r)
+		return
+	} else if err != nil {
+		log.Errorx("get message for download", err)
+		metricResults.WithLabelValues("download", "serverFail").Inc()
+		http.Error(w, "500 - internal server error - get message", http.StatusInternalServerError)
+		return
+	}
+
+	ct := r.URL.Query().Get("type")
+	if ct == "" {
+		ct = "message/rfc822"
+	} else if _, _, err := mime.ParseMediaType(ct); err != nil {
+		http.Error(w, "400 - bad request - bad type", http.StatusBadRequest)
+		return
+	}
+	h := w.Header()
+	h.Set("Content-Type", ct)
+	h.Set("Content-Length", fmt.Sprintf("%d", m.Size))
+	// Blobs are immutable.
+	h.Set("Cache-Control", "private, immutable, max-age=604800")
+	if cd := mime.FormatMediaType("attachment", map[string]string{"filename": t[2]}); cd != "" {
+		h.Set("Content-Disposition", cd)
+	}
+	metricResults.WithLabelValues("download", "ok").Inc()
+	mr := acc.MessageReader(m)
+	defer func() {
+		err := mr.Close()
+		log.Check(err, "closing message reader")
+	}()
+	if _, err := io.Copy(w, mr); err != nil && !moxio.IsClosed(err) {
+		log.Infox("writing message", err)
+	}
+}
+
+// accountState returns the current state for all types, the last modseq of the
+// account.
+func accountState(ctx context.Context, acc *store.Account) (string, error) {
+	var modseq store.ModSeq
+	err := acc.DB.Read(ctx, func(tx *bstore.Tx) (err error) {
+		modseq, err = acc.LastModSeq(tx)
+		return err
+	})
+	return fmt.Sprintf("%d", modseq), err
+}
+
+// serveEventSource pushes StateChange events when the state of the account
+// changes. ../rfc/8620
+func (s server) serveEventSource(log mlog.Log, w http.ResponseWriter, r *http.Request, acc *store.Account) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		log.Error("internal error: ResponseWriter not a http.Flusher")
+		http.Error(w, "500 - internal error - cannot access underlying connection", 500)
+		return
+	}
+
+	q := r.URL.Query()
+	types := map[string]bool{}
+	for _, t := range strings.Split(q.Get("types"), ",") {
+		if t == "*" {
+			types["Mailbox"] = true
+			types["Email"] = true
+			types["Thread"] = true
+		} else {
+			types[t] = true
+		}
+	}
+	closeAfterState := q.Get("closeafter") == "state"
+	var ping time.Duration
+	if x := q.Get("ping"); x != "" {
+		v, err := strconv.ParseUint(x, 10, 31)
+		if err != nil {
+			http.Error(w, "400 - bad request - bad ping", http.StatusBadRequest)
+			return
+		}
+		// We don't send pings more often than every 10 seconds.
+		if v > 0 && v < 10 {
+			v = 10
+		}
+		ping = time.Duration(v) * time.Second
+	}
+
+	comm := store.RegisterComm(acc)
+	defer comm.Unregister()
+
+	lastState, err := accountState(r.Context(), acc)
+	if err != nil {
+		log.Errorx("get state", err)
+		http.Error(w, "500 - internal server error - get state", http.StatusInternalServerError)
+		return
+	}
+
+	metricResults.WithLabelValues("eventsource", "ok").Inc()
+	h := w.Header()
+	h.Set("Content-Type", "text/event-stream")
+	h.Set("Cache-Control", "no-cache")
+	if _, err := w.Write([]byte(": keepalive\n\n")); err != nil {
+		return
+	}
+	flusher.Flush()
+
+	// Keep idle connections alive through proxies, with pings if requested.
+	interval := ping
+	if interval == 0 {
+		interval = time.Minute
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	id := accountID(acc.Name)
+	ctx := r.Context()
+	for {
+		select {
+		case <-comm.Pending:
+			comm.Get()
+			state, err := accountState(ctx, acc)
+			if err != nil {
+				log.Errorx("get state", err)
+				return
+			}
+			if state == lastState {
+				continue
+			}
+			lastState = state
+			changed := map[string]string{}
+			for _, t := range []string{"Mailbox", "Email", "Thread"} {
+				if types[t] {
+					changed[t] = state
+				}
+			}
+			if len(changed) == 0 {
+				continue
+			}
+			buf, err := json.Marshal(map[string]any{"@type": "StateChange", "changed": map[string]any{id: changed}})
+			if err != nil {
+				log.Errorx("marshal state change", err)
+				return
+			}
+			if _, err := fmt.Fprintf(w, "event: state\ndata: %s\n\n", buf); err != nil {
+				log.Debugx("writing state change event", err)
+				return
+			}
+			flusher.Flush()
+			if closeAfterState {
+				return
+			}
+
+		case <-ticker.C:
+			var err error
+			if ping > 0 {
+				_, err = fmt.Fprintf(w, "event: ping\ndata: {\"interval\":%d}\n\n", ping/time.Second)
+			} else {
+				_, err = w.Write([]byte(": keepalive\n\n"))
+			}
+			if err != nil {
+				log.Debugx("writing keepalive", err)
+				return
+			}
+			flusher.Flush()
+
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,324 @@
+package webjmap
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/mjl-/bstore"
+
+	"github.com/mjl-/mox/mlog"
+	"github.com/mjl-/mox/mox-"
+	"github.com/mjl-/mox/store"
+)
+
+var ctxbg = context.Background()
+
+func tcheck(t *testing.T, err error, msg string) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("%s: %s", msg, err)
+	}
+}
+
+func tcompare(t *testing.T, got, exp any) {
+	t.Helper()
+	if !reflect.DeepEqual(got, exp) {
+		t.Fatalf("got %#v, expected %#v", got, exp)
+	}
+}
+
+const msg1 = "From: <other@mox.example>\r\nTo: <mjl@mox.example>\r\nSubject: hello\r\nMessage-Id: <m1@mox.example>\r\nDate: Mon, 01 Jan 2024 10:00:00 +0100\r\n\r\nhi\r\n"
+const msg2 = "From: \"Other\" <other@mox.example>\r\nTo: <mjl@mox.example>\r\nSubject: Re: hello\r\nMessage-Id: <m2@mox.example>\r\nIn-Reply-To: <m1@mox.example>\r\n\r\nhi again\r\n"
+
+func TestServer(t *testing.T) {
+	mox.LimitersInit()
+	os.RemoveAll("../testdata/webjmap/data")
+	mox.Context = ctxbg
+	mox.ConfigStaticPath = filepath.FromSlash("../testdata/webjmap/mox.conf")
+	mox.MustLoadConfig(true, false)
+	err := store.Init(ctxbg)
+	tcheck(t, err, "store init")
+	defer func() {
+		err := store.Close()
+		tcheck(t, err, "store close")
+	}()
+	defer store.Switchboard()()
+
+	log := mlog.New("webjmap", nil)
+	acc, err := store.OpenAccount(log, "mjl", false)
+	tcheck(t, err, "open account")
+	err = acc.SetPassword(log, "test1234")
+	tcheck(t, err, "set password")
+	defer func() {
+		err := acc.Close()
+		log.Check(err, "closing account")
+		acc.CheckClosed()
+	}()
+
+	deliver := func(msg string) store.Message {
+		t.Helper()
+		f, err := store.CreateMessageTemp(log, "webjmap-test")
+		tcheck(t, err, "create temp file")
+		defer os.Remove(f.Name())
+		defer f.Close()
+		_, err = f.Write([]byte(msg))
+		tcheck(t, err, "write message")
+		m := store.Message{Size: int64(len(msg))}
+		acc.WithWLock(func() {
+			err = acc.DeliverMailbox(log, "Inbox", &m, f)
+		})
+		tcheck(t, err, "deliver message")
+		return m
+	}
+	m1 := deliver(msg1)
+	m2 := deliver(msg2)
+
+	s := NewServer("/jmap/", false)
+	id := accountID("mjl")
+
+	do := func(method, path, body string, auth bool) *http.Response {
+		t.Helper()
+		r := httptest.NewRequest(method, path, strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/json")
+		if auth {
+			r.SetBasicAuth("mjl@mox.example", "test1234")
+		}
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, r)
+		return w.Result()
+	}
+
+	// Session, requires authentication.
+	resp := do("GET", "/session", "", false)
+	tcompare(t, resp.StatusCode, http.StatusUnauthorized)
+	resp = do("GET", "/session", "", true)
+	tcompare(t, resp.StatusCode, http.StatusOK)
+	var session struct {
+		APIURL          string            `json:"apiUrl"`
+		PrimaryAccounts map[string]string `json:"primaryAccounts"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&session)
+	tcheck(t, err, "parse session")
+	tcompare(t, session.APIURL, "http://example.com/jmap/api/")
+	tcompare(t, session.PrimaryAccounts[capMail], id)
+
+	resp = do("GET", "/", "", false)
+	tcompare(t, resp.StatusCode, http.StatusSeeOther)
+	resp = do("GET", "/api/", "", true)
+	tcompare(t, resp.StatusCode, http.StatusMethodNotAllowed)
+
+	// Request-level errors.
+	resp = do("POST", "/api/", `bogus`, true)
+	tcompare(t, resp.StatusCode, http.StatusBadRequest)
+	resp = do("POST", "/api/", `{"using": ["urn:unknown"], "methodCalls": []}`, true)
+	tcompare(t, resp.StatusCode, http.StatusBadRequest)
+	tcompare(t, resp.Header.Get("Content-Type"), "application/problem+json")
+
+	// api makes a request and returns the method responses, as name and arguments.
+	api := func(calls string) [][2]any {
+		t.Helper()
+		body := fmt.Sprintf(`{"using": ["%s", "%s"], "methodCalls": %s}`, capCore, capMail, strings.ReplaceAll(calls, "ACCOUNT", id))
+		resp := do("POST", "/api/", body, true)
+		tcompare(t, resp.StatusCode, http.StatusOK)
+		var r struct {
+			MethodResponses [][]any `json:"methodResponses"`
+		}
+		err := json.NewDecoder(resp.Body).Decode(&r)
+		tcheck(t, err, "parse response")
+		var l [][2]any
+		for _, x := range r.MethodResponses {
+			l = append(l, [2]any{x[0], x[1]})
+		}
+		return l
+	}
+	// api1 makes a request with a single call, and returns its arguments.
+	api1 := func(expName, call string) map[string]any {
+		t.Helper()
+		l := api("[" + call + "]")
+		tcompare(t, len(l), 1)
+		if l[0][0] != expName {
+			t.Fatalf("got response %v, expected %s", l[0], expName)
+		}
+		return l[0][1].(map[string]any)
+	}
+
+	r := api1("Core/echo", `["Core/echo", {"hello": true}, "0"]`)
+	tcompare(t, r, map[string]any{"hello": true})
+	r = api1("error", `["Bogus/get", {}, "0"]`)
+	tcompare(t, r["type"], "unknownMethod")
+	r = api1("error", `["Mailbox/get", {"accountId": "other"}, "0"]`)
+	tcompare(t, r["type"], "accountNotFound")
+	r = api1("error", `["Mailbox/get", {"accountId": "ACCOUNT", "bogus": 1}, "0"]`)
+	tcompare(t, r["type"], "invalidArguments")
+
+	// Mailboxes.
+	r = api1("Mailbox/get", `["Mailbox/get", {"accountId": "ACCOUNT", "ids": null}, "0"]`)
+	var inboxID, archiveID string
+	for _, x := range r["list"].([]any) {
+		mb := x.(map[string]any)
+		switch mb["role"] {
+		case "inbox":
+			inboxID = mb["id"].(string)
+			tcompare(t, mb["totalEmails"], 2.0)
+			tcompare(t, mb["unreadEmails"], 2.0)
+		case "archive":
+			archiveID = mb["id"].(string)
+		}
+	}
+	if inboxID == "" || archiveID == "" {
+		t.Fatalf("missing inbox or archive in %v", r["list"])
+	}
+	state0 := r["state"].(string)
+	r = api1("Mailbox/get", `["Mailbox/get", {"accountId": "ACCOUNT", "ids": ["`+inboxID+`", "M999"], "properties": ["name"]}, "0"]`)
+	tcompare(t, r["list"], []any{map[string]any{"id": inboxID, "name": "Inbox"}})
+	tcompare(t, r["notFound"], []any{"M999"})
+	r = api1("Mailbox/changes", `["Mailbox/changes", {"accountId": "ACCOUNT", "sinceState": "`+state0+`"}, "0"]`)
+	tcompare(t, r["updated"], []any{})
+
+	// Query with back-reference to get emails.
+	l := api(`[
+		["Email/query", {"accountId": "ACCOUNT", "filter": {"inMailbox": "` + inboxID + `"}, "calculateTotal": true}, "0"],
+		["Email/get", {"accountId": "ACCOUNT", "#ids": {"resultOf": "0", "name": "Email/query", "path": "/ids"}, "properties": ["subject", "from", "messageId", "inReplyTo", "threadId", "keywords", "blobId"]}, "1"]
+	]`)
+	tcompare(t, len(l), 2)
+	qr := l[0][1].(map[string]any)
+	tcompare(t, qr["ids"], []any{emailID(m2.ID), emailID(m1.ID)})
+	tcompare(t, qr["total"], 2.0)
+	emails := l[1][1].(map[string]any)["list"].([]any)
+	e2 := emails[0].(map[string]any)
+	tcompare(t, e2["subject"], "Re: hello")
+	tcompare(t, e2["from"], []any{map[string]any{"name": "Other", "email": "other@mox.example"}})
+	tcompare(t, e2["messageId"], []any{"m2@mox.example"})
+	tcompare(t, e2["inReplyTo"], []any{"m1@mox.example"})
+	tcompare(t, e2["threadId"], threadID(m1.ID))
+	tcompare(t, e2["keywords"], map[string]any{})
+
+	r = api1("Thread/get", `["Thread/get", {"accountId": "ACCOUNT", "ids": ["`+threadID(m1.ID)+`"]}, "0"]`)
+	tcompare(t, r["list"], []any{map[string]any{"id": threadID(m1.ID), "emailIds": []any{emailID(m1.ID), emailID(m2.ID)}}})
+
+	r = api1("Email/query", `["Email/query", {"accountId": "ACCOUNT", "collapseThreads": true}, "0"]`)
+	tcompare(t, r["ids"], []any{emailID(m2.ID)})
+	r = api1("error", `["Email/query", {"accountId": "ACCOUNT", "filter": {"text": "hi"}}, "0"]`)
+	tcompare(t, r["type"], "unsupportedFilter")
+
+	// Download raw message.
+	resp = do("GET", "/download/"+id+"/"+e2["blobId"].(string)+"/msg.eml", "", true)
+	tcompare(t, resp.StatusCode, http.StatusOK)
+	buf, err := io.ReadAll(resp.Body)
+	tcheck(t, err, "read blob")
+	tcompare(t, string(buf), msg2)
+	tcompare(t, resp.Header.Get("Content-Type"), "message/rfc822")
+	resp = do("GET", "/download/"+id+"/B999/msg.eml", "", true)
+	tcompare(t, resp.StatusCode, http.StatusNotFound)
+
+	// Mark as read and move, then check changes.
+	r = api1("error", `["Email/set", {"accountId": "ACCOUNT", "ifInState": "1"}, "0"]`)
+	tcompare(t, r["type"], "stateMismatch")
+	r = api1("Email/set", `["Email/set", {"accountId": "ACCOUNT", "update": {
+		"`+emailID(m1.ID)+`": {"keywords/$seen": true, "keywords/custom": true, "mailboxIds/`+inboxID+`": null, "mailboxIds/`+archiveID+`": true},
+		"`+emailID(m2.ID)+`": {"mailboxIds": {}},
+		"E999": {"keywords/$seen": true}
+	}}, "0"]`)
+	tcompare(t, r["oldState"], state0)
+	tcompare(t, r["updated"], map[string]any{emailID(m1.ID): nil})
+	notUpdated := r["notUpdated"].(map[string]any)
+	tcompare(t, notUpdated[emailID(m2.ID)].(map[string]any)["type"], "invalidProperties")
+	tcompare(t, notUpdated["E999"].(map[string]any)["type"], "notFound")
+	state1 := r["newState"].(string)
+
+	r = api1("Email/get", `["Email/get", {"accountId": "ACCOUNT", "ids": ["`+emailID(m1.ID)+`"], "properties": ["mailboxIds", "keywords"]}, "0"]`)
+	tcompare(t, r["list"], []any{map[string]any{"id": emailID(m1.ID), "mailboxIds": map[string]any{archiveID: true}, "keywords": map[string]any{"$seen": true, "custom": true}}})
+
+	// Moving leaves an expunged copy with a new ID behind for IMAP, which is reported
+	// as destroyed.
+	r = api1("Email/changes", `["Email/changes", {"accountId": "ACCOUNT", "sinceState": "`+state0+`"}, "0"]`)
+	tcompare(t, r["updated"], []any{emailID(m1.ID)})
+	tcompare(t, len(r["destroyed"].([]any)), 1)
+	tcompare(t, r["newState"], state1)
+	r = api1("error", `["Mailbox/changes", {"accountId": "ACCOUNT", "sinceState": "`+state0+`"}, "0"]`)
+	tcompare(t, r["type"], "cannotCalculateChanges")
+
+	// Clearing a keyword.
+	r = api1("Email/set", `["Email/set", {"accountId": "ACCOUNT", "update": {"`+emailID(m1.ID)+`": {"keywords": {"$seen": true}}}}, "0"]`)
+	tcompare(t, r["updated"], map[string]any{emailID(m1.ID): nil})
+	r = api1("Email/get", `["Email/get", {"accountId": "ACCOUNT", "ids": ["`+emailID(m1.ID)+`"], "properties": ["keywords"]}, "0"]`)
+	tcompare(t, r["list"], []any{map[string]any{"id": emailID(m1.ID), "keywords": map[string]any{"$seen": true}}})
+
+	// Push, with a change made while listening.
+	hs := httptest.NewServer(s)
+	defer hs.Close()
+	req, err := http.NewRequest("GET", hs.URL+"/eventsource/?types=*&closeafter=state&ping=0", nil)
+	tcheck(t, err, "new request")
+	req.SetBasicAuth("mjl@mox.example", "test1234")
+	esresp, err := http.DefaultClient.Do(req)
+	tcheck(t, err, "eventsource request")
+	defer esresp.Body.Close()
+	tcompare(t, esresp.StatusCode, http.StatusOK)
+	br := bufio.NewReader(esresp.Body)
+	line, err := br.ReadString('\n')
+	tcheck(t, err, "read keepalive")
+	tcompare(t, line, ": keepalive\n")
+	line, err = br.ReadString('\n')
+	tcheck(t, err, "read keepalive")
+	tcompare(t, line, "\n")
+
+	// Destroy message, and check changes and push.
+	r = api1("Email/set", `["Email/set", {"accountId": "ACCOUNT", "destroy": ["`+emailID(m2.ID)+`", "E999"]}, "0"]`)
+	tcompare(t, r["destroyed"], []any{emailID(m2.ID)})
+	tcompare(t, r["notDestroyed"].(map[string]any)["E999"].(map[string]any)["type"], "notFound")
+	state2 := r["newState"].(string)
+
+	body, err := io.ReadAll(br)
+	tcheck(t, err, "read events")
+	exp := fmt.Sprintf(`event: state`+"\n"+`data: {"@type":"StateChange","changed":{"%s":{"Email":"%s","Mailbox":"%s","Thread":"%s"}}}`+"\n\n", id, state2, state2, state2)
+	tcompare(t, string(body), exp)
+
+	r = api1("Email/changes", `["Email/changes", {"accountId": "ACCOUNT", "sinceState": "`+state1+`"}, "0"]`)
+	tcompare(t, r["updated"], []any{emailID(m1.ID)})
+	tcompare(t, r["destroyed"], []any{emailID(m2.ID)})
+	r = api1("Email/changes", `["Email/changes", {"accountId": "ACCOUNT", "sinceState": "`+state1+`", "maxChanges": 1}, "0"]`)
+	tcompare(t, r["hasMoreChanges"], true)
+	tcompare(t, r["updated"], []any{emailID(m1.ID)})
+	tcompare(t, r["destroyed"], []any{})
+	for _, method := range []string{"Email/changes", "Mailbox/changes", "Thread/changes"} {
+		for _, v := range []string{"0", "-1"} {
+			r = api1("error", `["`+method+`", {"accountId": "ACCOUNT", "sinceState": "`+state1+`", "maxChanges": `+v+`}, "0"]`)
+			tcompare(t, r["type"], "invalidArguments")
+		}
+	}
+	r = api1("Thread/changes", `["Thread/changes", {"accountId": "ACCOUNT", "sinceState": "`+state0+`"}, "0"]`)
+	tcompare(t, r["updated"], []any{threadID(m1.ID)})
+	r = api1("Thread/get", `["Thread/get", {"accountId": "ACCOUNT", "ids": ["`+threadID(m1.ID)+`"]}, "0"]`)
+	tcompare(t, r["list"], []any{map[string]any{"id": threadID(m1.ID), "emailIds": []any{emailID(m1.ID)}}})
+
+	// Read-only mailbox, messages in it cannot be changed.
+	err = acc.DB.Write(ctxbg, func(tx *bstore.Tx) error {
+		mb, err := acc.MailboxFind(tx, "Archive")
+		if err != nil {
+			return err
+		}
+		mb.ReadOnly = true
+		return tx.Update(mb)
+	})
+	tcheck(t, err, "marking mailbox read-only")
+	r = api1("Mailbox/get", `["Mailbox/get", {"accountId": "ACCOUNT", "ids": ["`+archiveID+`"], "properties": ["myRights"]}, "0"]`)
+	rights := r["list"].([]any)[0].(map[string]any)["myRights"].(map[string]any)
+	tcompare(t, rights["mayReadItems"], true)
+	tcompare(t, rights["mayAddItems"], false)
+	tcompare(t, rights["mayRemoveItems"], false)
+	tcompare(t, rights["maySetSeen"], false)
+	tcompare(t, rights["maySetKeywords"], false)
+	r = api1("Email/set", `["Email/set", {"accountId": "ACCOUNT", "update": {"`+emailID(m1.ID)+`": {"keywords": {}}}, "destroy": ["`+emailID(m1.ID)+`"]}, "0"]`)
+	tcompare(t, r["notUpdated"].(map[string]any)[emailID(m1.ID)].(map[string]any)["type"], "forbidden")
+	tcompare(t, r["notDestroyed"].(map[string]any)[emailID(m1.ID)].(map[string]any)["type"], "forbidden")
+}
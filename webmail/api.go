@@ -231,6 +231,71 @@ func (Webmail) FromAddressSettingsSave(ctx context.Context, fas store.FromAddres
 	})
 }
 
+// IdentitySave saves the identity for an address of the account, used by the
+// webmail client when composing messages with that address as "From" address.
+// An existing identity for the address is replaced.
+func (Webmail) IdentitySave(ctx context.Context, ident store.Identity) {
+	reqInfo := ctx.Value(requestInfoCtxKey).(requestInfo)
+	acc := reqInfo.Account
+
+	addr, err := smtp.ParseAddress(ident.Address)
+	xcheckuserf(ctx, err, "parsing address")
+	if ok, _ := mox.AllowMsgFrom(acc.Name, addr); !ok {
+		xcheckuserf(ctx, errors.New("address not found"), "looking up address for account")
+	}
+	ident.Address = addr.Pack(true)
+
+	for _, l := range [][]string{ident.Cc, ident.Bcc, {ident.Name, ident.ReplyTo}} {
+		for _, s := range l {
+			for _, c := range s {
+				if c < 0x20 {
+					xcheckuserf(ctx, errors.New("control characters not allowed"), "checking identity")
+				}
+			}
+		}
+	}
+	for _, s := range ident.Cc {
+		_, err := parseAddress(s)
+		xcheckuserf(ctx, err, "parsing Cc address")
+	}
+	for _, s := range ident.Bcc {
+		_, err := parseAddress(s)
+		xcheckuserf(ctx, err, "parsing Bcc address")
+	}
+	if ident.ReplyTo != "" {
+		_, err := parseAddress(ident.ReplyTo)
+		xcheckuserf(ctx, err, "parsing Reply-To address")
+	}
+
+	xdbwrite(ctx, acc, func(tx *bstore.Tx) {
+		if tx.Get(&store.Identity{Address: ident.Address}) == nil {
+			err := tx.Update(&ident)
+			xcheckf(ctx, err, "updating identity")
+		} else {
+			err := tx.Insert(&ident)
+			xcheckf(ctx, err, "inserting identity")
+		}
+	})
+}
+
+// IdentityRemove removes the identity for an address. The defaults from the
+// account configuration and settings are used again for the address.
+func (Webmail) IdentityRemove(ctx context.Context, address string) {
+	reqInfo := ctx.Value(requestInfoCtxKey).(requestInfo)
+	acc := reqInfo.Account
+
+	addr, err := smtp.ParseAddress(address)
+	xcheckuserf(ctx, err, "parsing address")
+
+	xdbwrite(ctx, acc, func(tx *bstore.Tx) {
+		err := tx.Delete(&store.Identity{Address: addr.Pack(true)})
+		if err == bstore.ErrAbsent {
+			xcheckuserf(ctx, err, "removing identity")
+		}
+		xcheckf(ctx, err, "removing identity")
+	})
+}
+
 // MessageFindMessageID looks up a message by Message-Id header, and returns the ID
 // of the message in storage. Used when opening a previously saved draft message
 // for editing again.
@@ -415,6 +480,7 @@ func (w Webmail) MessageCompose(ctx context.Context, m ComposeMessage, mailboxID
 	xc.Flush()
 
 	var nm store.Message
+	var removeMessages []store.Message // Removed draft message.
 
 	// Remove previous draft message, append message to destination mailbox.
 	acc.WithRLock(func() {
@@ -425,7 +491,7 @@ func (w Webmail) MessageCompose(ctx context.Context, m ComposeMessage, mailboxID
 
 			if m.DraftMessageID > 0 {
 				var nchanges []store.Change
-				modseq, nchanges = xops.MessageDeleteTx(ctx, log, tx, acc, []int64{m.DraftMessageID}, modseq)
+				modseq, nchanges, removeMessages = xops.MessageDeleteTx(ctx, log, tx, acc, []int64{m.DraftMessageID}, modseq)
 				changes = append(changes, nchanges...)
 				// On-disk file is removed after lock.
 			}
@@ -437,6 +503,8 @@ func (w Webmail) MessageCompose(ctx context.Context, m ComposeMessage, mailboxID
 				xcheckuserf(ctx, err, "looking up mailbox")
 			}
 			xcheckf(ctx, err, "looking up mailbox")
+			err = mb.CheckWritable()
+			xcheckuserf(ctx, err, "checking mailbox")
 
 			if modseq == 0 {
 				modseq, err = acc.NextModSeq(tx)
@@ -473,8 +541,11 @@ func (w Webmail) MessageCompose(ctx context.Context, m ComposeMessage, mailboxID
 	})
 
 	// Remove on-disk file for removed draft message.
-	if m.DraftMessageID > 0 {
-		p := acc.MessagePath(m.DraftMessageID)
+	for _, rm := range removeMessages {
+		if rm.PackID != 0 {
+			continue
+		}
+		p := acc.MessagePath(rm.ID)
 		err := os.Remove(p)
 		log.Check(err, "removing draft message file")
 	}
@@ -515,6 +586,7 @@ type SubmitMessage struct {
 	ArchiveThread             bool       // If set, thread is archived after sending message.
 	ArchiveReferenceMailboxID int64      // If ArchiveThread is set, thread messages from this mailbox ID are moved to the archive mailbox ID. E.g. of Inbox.
 	DraftMessageID            int64      // If set, draft message that will be removed after sending.
+	RecipientsConfirmed       bool       // If set, the user confirmed sending to more recipients than the confirmation threshold of the account.
 }
 
 // ForwardAttachments references attachments by a list of message.Part paths.
@@ -669,7 +741,19 @@ func (w Webmail) MessageSubmit(ctx context.Context, m SubmitMessage) {
 		xcheckuserf(ctx, errors.New("no recipients"), "composing message")
 	}
 
-	// Check outgoing message rate limit.
+	accConf, _ := acc.Conf()
+	err = mox.SubmissionCheck(accConf.SubmissionChecks, len(toAddrs) > 0 || len(ccAddrs) > 0, m.Subject, len(recipients))
+	if err != nil {
+		metricSubmission.WithLabelValues("submissioncheck").Inc()
+	}
+	xcheckuserf(ctx, err, "checking message")
+	if sc := accConf.SubmissionChecks; sc != nil && sc.ConfirmRecipients > 0 && len(recipients) > sc.ConfirmRecipients && !m.RecipientsConfirmed {
+		// Error code used by the webmail frontend to ask for confirmation.
+		panic(&sherpa.Error{Code: "user:confirmRecipients", Message: fmt.Sprintf("message has %d recipients, confirm to send", len(recipients))})
+	}
+
+	// Check outgoing message rate limit, and whether the account appears compromised.
+	var holdReason string
 	xdbread(ctx, acc, func(tx *bstore.Tx) {
 		rcpts := make([]smtp.Path, len(recipients))
 		for i, r := range recipients {
@@ -684,7 +768,14 @@ func (w Webmail) MessageSubmit(ctx context.Context, m SubmitMessage) {
 			xcheckuserf(ctx, errors.New("recipient limit reached"), "checking outgoing rate")
 		}
 		xcheckf(ctx, err, "checking send limit")
+		holdReason, err = acc.OutgoingHoldCheck(ctx, tx, rcpts, webauth.RemoteIP(log, w.isForwarded, reqInfo.Request))
+		xcheckf(ctx, err, "checking outgoing hold heuristics")
 	})
+	if holdReason != "" {
+		// The hold rule applies to this message too when it is queued.
+		err := queue.HoldAccount(ctx, log, acc.Name, holdReason)
+		xcheckf(ctx, err, "holding outgoing messages of account")
+	}
 
 	// We only use smtputf8 if we have to, with a utf-8 localpart. For IDNA, we use ASCII domains.
 	smtputf8 := false
@@ -958,7 +1049,6 @@ func (w Webmail) MessageSubmit(ctx context.Context, m SubmitMessage) {
 		msgPrefix = dkimHeaders
 	}
 
-	accConf, _ := acc.Conf()
 	loginAddr, err := smtp.ParseAddress(reqInfo.LoginAddress)
 	xcheckf(ctx, err, "parsing login address")
 	useFromID := slices.Contains(accConf.ParsedFromIDLoginAddresses, loginAddr)
@@ -1012,7 +1102,8 @@ func (w Webmail) MessageSubmit(ctx context.Context, m SubmitMessage) {
 	xcheckf(ctx, err, "adding messages to the delivery queue")
 	metricSubmission.WithLabelValues("ok").Inc()
 
-	var modseq store.ModSeq // Only set if needed.
+	var modseq store.ModSeq            // Only set if needed.
+	var removeMessages []store.Message // Removed draft message.
 
 	// Append message to Sent mailbox, mark original messages as answered/forwarded,
 	// remove any draft message.
@@ -1031,7 +1122,7 @@ func (w Webmail) MessageSubmit(ctx context.Context, m SubmitMessage) {
 		xdbwrite(ctx, acc, func(tx *bstore.Tx) {
 			if m.DraftMessageID > 0 {
 				var nchanges []store.Change
-				modseq, nchanges = xops.MessageDeleteTx(ctx, log, tx, acc, []int64{m.DraftMessageID}, modseq)
+				modseq, nchanges, removeMessages = xops.MessageDeleteTx(ctx, log, tx, acc, []int64{m.DraftMessageID}, modseq)
 				changes = append(changes, nchanges...)
 				// On-disk file is removed after lock.
 			}
@@ -1140,8 +1231,11 @@ func (w Webmail) MessageSubmit(ctx context.Context, m SubmitMessage) {
 	})
 
 	// Remove on-disk file for removed draft message.
-	if m.DraftMessageID > 0 {
-		p := acc.MessagePath(m.DraftMessageID)
+	for _, rm := range removeMessages {
+		if rm.PackID != 0 {
+			continue
+		}
+		p := acc.MessagePath(rm.ID)
 		err := os.Remove(p)
 		log.Check(err, "removing draft message file")
 	}
@@ -1237,7 +1331,7 @@ func (Webmail) MailboxDelete(ctx context.Context, mailboxID int64) {
 	log := reqInfo.Log
 
 	// Messages to remove after having broadcasted the removal of messages.
-	var removeMessageIDs []int64
+	var removeMessages []store.Message
 
 	acc.WithWLock(func() {
 		var changes []store.Change
@@ -1251,9 +1345,11 @@ func (Webmail) MailboxDelete(ctx context.Context, mailboxID int64) {
 
 			var hasChildren bool
 			var err error
-			changes, removeMessageIDs, hasChildren, err = acc.MailboxDelete(ctx, log, tx, mb)
+			changes, removeMessages, hasChildren, err = acc.MailboxDelete(ctx, log, tx, mb)
 			if hasChildren {
 				xcheckuserf(ctx, errors.New("mailbox has children"), "deleting mailbox")
+			} else if errors.Is(err, store.ErrMailboxReadOnly) {
+				xcheckuserf(ctx, err, "deleting mailbox")
 			}
 			xcheckf(ctx, err, "deleting mailbox")
 		})
@@ -1261,8 +1357,11 @@ func (Webmail) MailboxDelete(ctx context.Context, mailboxID int64) {
 		store.BroadcastChanges(acc, changes)
 	})
 
-	for _, mID := range removeMessageIDs {
-		p := acc.MessagePath(mID)
+	for _, m := range removeMessages {
+		if m.PackID != 0 {
+			continue
+		}
+		p := acc.MessagePath(m.ID)
 		err := os.Remove(p)
 		log.Check(err, "removing message file for mailbox delete", slog.String("path", p))
 	}
@@ -1282,6 +1381,8 @@ func (Webmail) MailboxEmpty(ctx context.Context, mailboxID int64) {
 
 		xdbwrite(ctx, acc, func(tx *bstore.Tx) {
 			mb := xmailboxID(ctx, tx, mailboxID)
+			err := mb.CheckWritable()
+			xcheckuserf(ctx, err, "emptying mailbox")
 
 			modseq, err := acc.NextModSeq(tx)
 			xcheckf(ctx, err, "next modseq")
@@ -1309,6 +1410,11 @@ func (Webmail) MailboxEmpty(ctx context.Context, mailboxID int64) {
 			_, err = qmr.Delete()
 			xcheckf(ctx, err, "removing message recipients")
 
+			qti := bstore.QueryTx[store.TextIndex](tx)
+			qti.FilterEqual("ID", anyIDs...)
+			_, err = qti.Delete()
+			xcheckf(ctx, err, "removing text index")
+
 			// Adjust mailbox counts, gather UIDs for broadcasted change, prepare for untraining.
 			var totalSize int64
 			uids := make([]store.UID, len(expunged))
@@ -1339,6 +1445,9 @@ func (Webmail) MailboxEmpty(ctx context.Context, mailboxID int64) {
 	})
 
 	for _, m := range expunged {
+		if m.PackID != 0 {
+			continue
+		}
 		p := acc.MessagePath(m.ID)
 		err := os.Remove(p)
 		log.Check(err, "removing message file after emptying mailbox", slog.String("path", p))
@@ -1365,7 +1474,7 @@ func (Webmail) MailboxRename(ctx context.Context, mailboxID int64, newName strin
 			var err error
 			var isInbox, notExists, alreadyExists bool
 			changes, isInbox, notExists, alreadyExists, err = acc.MailboxRename(tx, mbsrc, newName)
-			if isInbox || notExists || alreadyExists {
+			if isInbox || notExists || alreadyExists || errors.Is(err, store.ErrMailboxReadOnly) {
 				xcheckuserf(ctx, err, "renaming mailbox")
 			}
 			xcheckf(ctx, err, "renaming mailbox")
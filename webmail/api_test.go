@@ -14,6 +14,7 @@ import (
 	"github.com/mjl-/bstore"
 	"github.com/mjl-/sherpa"
 
+	"github.com/mjl-/mox/config"
 	"github.com/mjl-/mox/dns"
 	"github.com/mjl-/mox/mlog"
 	"github.com/mjl-/mox/mox-"
@@ -249,6 +250,31 @@ func TestAPI(t *testing.T) {
 	tneedError(t, func() { api.MailboxRename(ctx, inbox.ID, "Binbox") })      // Inbox not allowed.
 	tneedError(t, func() { api.MailboxRename(ctx, testbox1.ID, "Archive") })  // Exists.
 
+	// Read-only mailbox, and its messages, cannot be changed.
+	setReadOnly := func(mbID int64, readOnly bool) {
+		t.Helper()
+		err := acc.DB.Write(ctx, func(tx *bstore.Tx) error {
+			mb := store.Mailbox{ID: mbID}
+			if err := tx.Get(&mb); err != nil {
+				return err
+			}
+			mb.ReadOnly = readOnly
+			return tx.Update(&mb)
+		})
+		tcheck(t, err, "setting mailbox read-only")
+	}
+	setReadOnly(testbox1.ID, true)
+	tneedError(t, func() { api.FlagsAdd(ctx, []int64{testbox1Alt.ID}, []string{`\seen`}) })
+	tneedError(t, func() { api.FlagsClear(ctx, []int64{testbox1Alt.ID}, []string{`\seen`}) })
+	tneedError(t, func() { api.MailboxesMarkRead(ctx, []int64{testbox1.ID}) })
+	tneedError(t, func() { api.MessageMove(ctx, []int64{testbox1Alt.ID}, inbox.ID) })
+	tneedError(t, func() { api.MessageMove(ctx, []int64{inboxText.ID}, testbox1.ID) })
+	tneedError(t, func() { api.MessageDelete(ctx, []int64{testbox1Alt.ID}) })
+	tneedError(t, func() { api.MailboxEmpty(ctx, testbox1.ID) })
+	tneedError(t, func() { api.MailboxRename(ctx, testbox1.ID, "Testbox2") })
+	tneedError(t, func() { api.MailboxDelete(ctx, testbox1.ID) })
+	setReadOnly(testbox1.ID, false)
+
 	// ParsedMessage
 	// todo: verify contents
 	api.ParsedMessage(ctx, inboxMinimal.ID)
@@ -265,6 +291,20 @@ func TestAPI(t *testing.T) {
 	pm = api.ParsedMessage(ctx, inboxText.ID)
 	tcompare(t, pm.ViewMode, store.ModeHTMLExt)
 
+	// IdentitySave, IdentityRemove
+	api.IdentitySave(ctx, store.Identity{Address: "mjl@mox.example", Name: "Mox Jl", Signature: "-- \nmjl", Bcc: []string{"Archive <mjl+archive@mox.example>"}})
+	api.IdentitySave(ctx, store.Identity{Address: "mjl@mox.example", Name: "Mjl", ReplyTo: "other@mox.example"}) // Replaces.
+	ident := store.Identity{Address: "mjl@mox.example"}
+	err = acc.DB.Get(ctx, &ident)
+	tcheck(t, err, "get identity")
+	tcompare(t, ident, store.Identity{Address: "mjl@mox.example", Name: "Mjl", ReplyTo: "other@mox.example"})
+	tneedError(t, func() { api.IdentitySave(ctx, store.Identity{Address: "bogus"}) })                                        // Bad address.
+	tneedError(t, func() { api.IdentitySave(ctx, store.Identity{Address: "other@mox.example"}) })                            // Not an address of account.
+	tneedError(t, func() { api.IdentitySave(ctx, store.Identity{Address: "mjl@mox.example", Cc: []string{"bad address"}}) }) // Bad Cc.
+	tneedError(t, func() { api.IdentitySave(ctx, store.Identity{Address: "mjl@mox.example", Name: "a\nb"}) })                // Control character.
+	api.IdentityRemove(ctx, "mjl@mox.example")
+	tneedError(t, func() { api.IdentityRemove(ctx, "mjl@mox.example") }) // Already removed.
+
 	// MailboxDelete
 	api.MailboxDelete(ctx, testbox1.ID)
 	testa, err := bstore.QueryDB[store.Mailbox](ctx, acc.DB).FilterEqual("Name", "Test/A").Get()
@@ -453,6 +493,24 @@ func TestAPI(t *testing.T) {
 		})
 	})
 
+	// Message with many recipients needs confirmation, and can fail submission checks.
+	accConf := mox.Conf.Dynamic.Accounts["mjl"]
+	accConf.SubmissionChecks = &config.SubmissionChecks{RequireSubject: true, ConfirmRecipients: 1}
+	mox.Conf.Dynamic.Accounts["mjl"] = accConf
+	manyrcpts := SubmitMessage{
+		From:     "mjl@mox.example",
+		To:       []string{"mjl+to@mox.example", "mjl+to2@mox.example"},
+		Subject:  "many recipients",
+		TextBody: "test",
+	}
+	tneedErrorCode(t, "user:confirmRecipients", func() { api.MessageSubmit(ctx, manyrcpts) })
+	manyrcpts.RecipientsConfirmed = true
+	api.MessageSubmit(ctx, manyrcpts)
+	manyrcpts.Subject = ""
+	tneedError(t, func() { api.MessageSubmit(ctx, manyrcpts) })
+	accConf.SubmissionChecks = nil
+	mox.Conf.Dynamic.Accounts["mjl"] = accConf
+
 	// Message from disabled domain.
 	tneedError(t, func() {
 		api.MessageSubmit(ctx, SubmitMessage{
@@ -220,7 +220,8 @@ type EventStart struct {
 	Mailboxes            []store.Mailbox
 	RejectsMailbox       string
 	Settings             store.Settings
-	AccountPath          string // If nonempty, the path on same host to webaccount interface.
+	Identities           []store.Identity // Per-address settings for composing messages.
+	AccountPath          string           // If nonempty, the path on same host to webaccount interface.
 	Version              string
 }
 
@@ -648,6 +649,9 @@ func serveEvents(ctx context.Context, log mlog.Log, accountPath string, w http.R
 	loginAddress := MessageAddress{Name: loginName, User: loginAddr.Localpart.String(), Domain: loginAddr.Domain}
 	var addresses []MessageAddress
 	for a, dest := range accConf.Destinations {
+		if dest.Disabled {
+			continue
+		}
 		name := dest.FullName
 		if name == "" {
 			name = accConf.FullName
@@ -700,6 +704,7 @@ func serveEvents(ctx context.Context, log mlog.Log, accountPath string, w http.R
 	}()
 
 	var mbl []store.Mailbox
+	var identities []store.Identity
 	settings := store.Settings{ID: 1}
 
 	// We only take the rlock when getting the tx.
@@ -713,6 +718,9 @@ func serveEvents(ctx context.Context, log mlog.Log, accountPath string, w http.R
 
 		err = qtx.Get(&settings)
 		xcheckf(ctx, err, "get settings")
+
+		identities, err = bstore.QueryTx[store.Identity](qtx).List()
+		xcheckf(ctx, err, "list identities")
 	})
 
 	// Find the designated mailbox if a mailbox name is set, or there are no filters at all.
@@ -760,6 +768,25 @@ func serveEvents(ctx context.Context, log mlog.Log, accountPath string, w http.R
 	sse := sseRegister(acc.Name)
 	defer sse.unregister()
 
+	// Display names from identities take precedence over the names from the account
+	// configuration.
+	identityName := func(ma *MessageAddress) {
+		lp, err := smtp.ParseLocalpart(ma.User)
+		if ma.User == "" || err != nil {
+			return
+		}
+		addr := smtp.NewAddress(lp, ma.Domain).Pack(true)
+		for _, ident := range identities {
+			if ident.Address == addr && ident.Name != "" {
+				ma.Name = ident.Name
+			}
+		}
+	}
+	identityName(&loginAddress)
+	for i := range addresses {
+		identityName(&addresses[i])
+	}
+
 	// Per-domain localpart config so webclient can decide if an address belongs to the account.
 	domainAddressConfigs := map[string]DomainAddressConfig{}
 	for _, a := range addresses {
@@ -768,7 +795,7 @@ func serveEvents(ctx context.Context, log mlog.Log, accountPath string, w http.R
 	}
 
 	// Write first event, allowing client to fill its UI with mailboxes.
-	start := EventStart{sse.ID, loginAddress, addresses, domainAddressConfigs, mailbox.Name, mbl, accConf.RejectsMailbox, settings, accountPath, moxvar.Version}
+	start := EventStart{sse.ID, loginAddress, addresses, domainAddressConfigs, mailbox.Name, mbl, accConf.RejectsMailbox, settings, identities, accountPath, moxvar.Version}
 	writer.xsendEvent(ctx, log, "start", start)
 
 	// The goroutine doing the querying will send messages on these channels, which
@@ -1240,7 +1267,7 @@ func (v view) matches(log mlog.Log, acc *store.Account, checkRange bool, message
 		return false, rerr
 	}
 
-	wordsFilter := q.wordsFilterFn(log, &state)
+	wordsFilter := q.wordsFilterFn(log, nil, &state)
 	if wordsFilter != nil && (!ensureMessage() || !wordsFilter(m)) {
 		return false, rerr
 	}
@@ -1487,7 +1514,7 @@ func queryMessages(ctx context.Context, log mlog.Log, acc *store.Account, tx *bs
 		q.FilterFn(headerFilter)
 	}
 
-	wordsFilter := query.wordsFilterFn(log, &state)
+	wordsFilter := query.wordsFilterFn(log, tx, &state)
 	if wordsFilter != nil {
 		q.FilterFn(wordsFilter)
 	}
@@ -2024,8 +2051,9 @@ func (q Query) headerFilterFn(log mlog.Log, state *msgState) func(m store.Messag
 }
 
 // wordFiltersFn returns a function that applies the word filters of the query. A
-// nil function is returned when query does not contain a word filter.
-func (q Query) wordsFilterFn(log mlog.Log, state *msgState) func(m store.Message) bool {
+// nil function is returned when query does not contain a word filter. If tx is
+// not nil, the text index is used to skip reading messages that cannot match.
+func (q Query) wordsFilterFn(log mlog.Log, tx *bstore.Tx, state *msgState) func(m store.Message) bool {
 	if len(q.Filter.Words) == 0 && len(q.NotFilter.Words) == 0 {
 		return nil
 	}
@@ -2033,6 +2061,15 @@ func (q Query) wordsFilterFn(log mlog.Log, state *msgState) func(m store.Message
 	ws := store.PrepareWordSearch(q.Filter.Words, q.NotFilter.Words)
 
 	return func(m store.Message) bool {
+		if tx != nil {
+			if ok, err := ws.MatchIndex(tx, m.ID); err != nil {
+				state.err = fmt.Errorf("checking text index for message %d: %w", m.ID, err)
+				return false
+			} else if !ok {
+				return false
+			}
+		}
+
 		if !state.ensurePart(m, true) {
 			return false
 		}
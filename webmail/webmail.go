@@ -85,7 +85,7 @@ var (
 	metricSubmission = promauto.NewCounterVec(
 		prometheus.CounterOpts{
 			Name: "mox_webmail_submission_total",
-			Help: "Webmail message submission results, known values (those ending with error are server errors): ok, badfrom, messagelimiterror, recipientlimiterror, queueerror, storesenterror, domaindisabled.",
+			Help: "Webmail message submission results, known values (those ending with error are server errors): ok, badfrom, submissioncheck, messagelimiterror, recipientlimiterror, queueerror, storesenterror, domaindisabled.",
 		},
 		[]string{
 			"result",
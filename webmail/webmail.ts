@@ -59,7 +59,7 @@ Enable consistency checking in UI updates:
 	settingsPut({...settings, checkConsistency: true})
 
 - todo: in msglistView, show names of people we have sent to, and address otherwise. or at don't show names for first-time senders.
-- todo: implement settings stored in the server, such as mailboxCollapsed, keyboard shortcuts. name to use for "From", optional default Reply-To and Bcc addresses, signatures (per address), configured labels/keywords with human-readable name, colors and toggling with shortcut keys 1-9.
+- todo: implement settings stored in the server, such as mailboxCollapsed, keyboard shortcuts, configured labels/keywords with human-readable name, colors and toggling with shortcut keys 1-9.
 - todo: automated tests? perhaps some unit tests, then ui scenario's.
 - todo: composing of html messages. possibly based on contenteditable. would be good if we can include original html, but quoted. must make sure to not include dangerous scripts/resources, or sandbox it.
 - todo: make alt up/down keys work on html iframe too. requires loading it from sameorigin, to get access to its inner document.
@@ -143,6 +143,10 @@ try {
 
 let accountSettings: api.Settings
 
+// Per-address settings for composing messages, stored in the account. Set when SSE
+// connection is initialized, and kept up to date when changed.
+let identities: api.Identity[] = []
+
 const defaultSettings = {
 	mailboxesWidth: 240,
 	layout: 'auto', // Automatic switching between left/right and top/bottom layout, based on screen width.
@@ -1218,6 +1222,16 @@ const cmdSettings = async () => {
 					}),
 				),
 
+				dom.div(
+					style({marginTop: '2ex'}),
+					'Name, signature and default Cc/Bcc/Reply-To addresses can be configured per address.',
+					dom.br(),
+					dom.clickbutton('Identities...', function click() {
+						remove()
+						cmdIdentities()
+					}),
+				),
+
 				dom.br(),
 				dom.div(
 					dom.submitbutton('Save'),
@@ -1227,6 +1241,119 @@ const cmdSettings = async () => {
 	)
 }
 
+// Find the identity for an email address of the account.
+const findIdentity = (email: string): api.Identity | undefined => identities.find(ident => ident.Address === email)
+
+// Show popup for editing the identities, i.e. per-address settings for composing messages.
+const cmdIdentities = async () => {
+	let fieldset: HTMLFieldSetElement
+	let address: HTMLSelectElement
+	let name: HTMLInputElement
+	let signature: HTMLTextAreaElement
+	let cc: HTMLTextAreaElement
+	let bcc: HTMLTextAreaElement
+	let replyTo: HTMLInputElement
+
+	const emails = accountAddresses.filter(a => a.User).map(a => formatEmail(a))
+	if (emails.length === 0) {
+		window.alert('No addresses to configure identities for.')
+		return
+	}
+
+	const lines = (s: string) => s.split('\n').map(s => s.trim()).filter(s => !!s)
+	const fill = () => {
+		const ident = findIdentity(address.value)
+		name.value = ident?.Name || ''
+		signature.value = ident?.Signature || ''
+		cc.value = (ident?.Cc || []).join('\n')
+		bcc.value = (ident?.Bcc || []).join('\n')
+		replyTo.value = ident?.ReplyTo || ''
+	}
+
+	const remove = popup(
+		css('popupIdentities', {minWidth: '30em'}),
+		style({maxWidth: '50em'}),
+		dom.h1('Identities'),
+		dom.p('Settings used when composing a message with an address as "From" address. Empty fields fall back to the account defaults.'),
+		dom.form(
+			async function submit(e: SubmitEvent) {
+				e.preventDefault()
+				e.stopPropagation()
+				const ident: api.Identity = {
+					Address: address.value,
+					Name: name.value.trim(),
+					Signature: signature.value,
+					Cc: lines(cc.value),
+					Bcc: lines(bcc.value),
+					ReplyTo: replyTo.value.trim(),
+				}
+				await withDisabled(fieldset, client.IdentitySave(ident))
+				identities = identities.filter(x => x.Address !== ident.Address)
+				identities.push(ident)
+				for (const a of accountAddresses) {
+					if (ident.Name && a.User && formatEmail(a) === ident.Address) {
+						a.Name = ident.Name
+					}
+				}
+				remove()
+			},
+			fieldset=dom.fieldset(
+				dom.label(
+					style({margin: '1ex 0', display: 'block'}),
+					dom.div('Address'),
+					address=dom.select(
+						emails.map(s => dom.option(s)),
+						function change() {
+							fill()
+						},
+					),
+				),
+				dom.label(
+					style({margin: '1ex 0', display: 'block'}),
+					dom.div('Name'),
+					name=dom.input(style({width: '100%'})),
+				),
+				dom.label(
+					style({margin: '1ex 0', display: 'block'}),
+					dom.div('Signature'),
+					signature=dom.textarea(style({width: '100%'}), attr.rows('4')),
+				),
+				dom.label(
+					style({margin: '1ex 0', display: 'block'}),
+					dom.div('Cc'),
+					cc=dom.textarea(style({width: '100%'}), attr.rows('2')),
+				),
+				dom.label(
+					style({margin: '1ex 0', display: 'block'}),
+					dom.div('Bcc'),
+					bcc=dom.textarea(style({width: '100%'}), attr.rows('2')),
+					dom.div(style({fontStyle: 'italic'}), 'One address per line, for example "Jane <jane@example.org>".'),
+				),
+				dom.label(
+					style({margin: '1ex 0', display: 'block'}),
+					dom.div('Reply-To'),
+					replyTo=dom.input(style({width: '100%'})),
+				),
+				dom.br(),
+				dom.div(
+					dom.submitbutton('Save'), ' ',
+					dom.clickbutton('Remove', attr.title('Remove identity, using the account defaults for this address again.'), async function click() {
+						if (!findIdentity(address.value)) {
+							remove()
+							return
+						}
+						const email = address.value
+						await withDisabled(fieldset, client.IdentityRemove(email))
+						identities = identities.filter(x => x.Address !== email)
+						remove()
+					}),
+				),
+			),
+		),
+	)
+	fill()
+}
+
 // Show help popup, with shortcuts and basic explanation.
 const cmdHelp = async () => {
 	popup(
@@ -1629,8 +1756,22 @@ const compose = (opts: ComposeOptions, listMailboxes: listMailboxes) => {
 			ArchiveThread: archive,
 			ArchiveReferenceMailboxID: opts.archiveReferenceMailboxID || 0,
 			DraftMessageID: draftMessageID,
+			RecipientsConfirmed: false,
+		}
+		try {
+			await client.MessageSubmit(message)
+		} catch (err) {
+			// Account can require confirmation for messages with many recipients.
+			if ((err as any).code !== 'user:confirmRecipients') {
+				throw err
+			}
+			const n = message.To.length + message.Cc.length + message.Bcc.length
+			if (!window.confirm('Message has ' + n + ' recipients. Send anyway?')) {
+				return
+			}
+			message.RecipientsConfirmed = true
+			await client.MessageSubmit(message)
 		}
-		await client.MessageSubmit(message)
 		composeElem.remove()
 		composeView = null
 	}
@@ -1903,6 +2044,38 @@ const compose = (opts: ComposeOptions, listMailboxes: listMailboxes) => {
 		return accountAddresses.find(a => a.Domain.ASCII === addr.Domain.ASCII && (a.User === '' || normalizeUser(a) === normalizeUser(addr)))
 	}
 
+	// Identity for the selected From address, if any.
+	const fromIdentity = (): api.Identity | undefined => {
+		if (customFrom) {
+			return undefined
+		}
+		const a = accountAddresses.find(a => a.User && formatAddress(a) === from.value)
+		return a ? findIdentity(formatEmail(a)) : undefined
+	}
+
+	// Apply the identity for a From address: Replace the signature of the previous
+	// identity (or account) and add its default Cc/Bcc/Reply-To addresses.
+	const applyIdentity = (prev: api.Identity | undefined, ident: api.Identity | undefined) => {
+		const prevSig = prev?.Signature || accountSettings?.Signature || ''
+		const sig = ident?.Signature || accountSettings?.Signature || ''
+		if (prevSig && prevSig !== sig && body.value.includes(prevSig)) {
+			body.value = body.value.replace(prevSig, () => sig)
+		}
+		for (const s of ident?.Cc || []) {
+			if (!ccViews.find(v => v.input.value === s)) {
+				newAddrView(s, true, ccViews, ccBtn, ccCell, ccRow)
+			}
+		}
+		for (const s of ident?.Bcc || []) {
+			if (!bccViews.find(v => v.input.value === s)) {
+				newAddrView(s, true, bccViews, bccBtn, bccCell, bccRow)
+			}
+		}
+		if (ident?.ReplyTo && replytoViews.length === 0) {
+			newAddrView(ident.ReplyTo, false, replytoViews, replyToBtn, replyToCell, replyToRow, true)
+		}
+	}
+
 	let haveFrom = false
 	const fromOptions = accountAddresses.filter(a => a.User).map(a => {
 		const selected = opts.from && opts.from.length === 1 && equalAddress(a, opts.from[0]) || loginAddress && equalAddress(a, loginAddress) && (!opts.from || envelopeIdentity(opts.from))
@@ -2016,6 +2189,12 @@ const compose = (opts: ComposeOptions, listMailboxes: listMailboxes) => {
 										attr.required(''),
 										style({width: 'auto'}),
 										fromOptions,
+										function change() {
+											const ident = fromIdentity()
+											applyIdentity(curIdentity, ident)
+											curIdentity = ident
+											from.focus()
+										},
 									),
 									' ',
 									toBtn=dom.clickbutton('To', clickCmd(cmdAddTo, shortcuts)), ' ',
@@ -2202,6 +2381,11 @@ const compose = (opts: ComposeOptions, listMailboxes: listMailboxes) => {
 	if (!opts.replyto) {
 		replyToRow.style.display = 'none'
 	}
+	// Drafts already have the identity applied when they were composed.
+	let curIdentity = fromIdentity()
+	if (!opts.draftMessageID) {
+		applyIdentity(undefined, curIdentity)
+	}
 
 	document.body.appendChild(composeElem)
 	if (toViews.length > 0 && !toViews[0].input.value) {
@@ -7376,6 +7560,7 @@ const init = async () => {
 			log('event start', start)
 
 			accountSettings = start.Settings
+			identities = start.Identities || []
 			connecting = false
 			sseID = start.SSEID
 			loginAddress = start.LoginAddress
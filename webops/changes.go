@@ -0,0 +1,99 @@
+package webops
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"time"
+
+	"github.com/mjl-/mox/mlog"
+	"github.com/mjl-/mox/store"
+)
+
+// ChangeEvent is a change to an account, as sent by ChangesStream in a
+// server-sent event of type "change".
+type ChangeEvent struct {
+	Account string       // Account name.
+	Type    string       // Type of change, e.g. "ChangeAddUID", "ChangeFlags", "ChangeRemoveUIDs".
+	Change  store.Change // One of the store.Change* types.
+}
+
+// ChangesStream is used by webapi and webadmin to stream changes to mailboxes and
+// messages as server-sent events, for external indexing, automation, etc. If acc
+// is nil, changes for all accounts are sent.
+func ChangesStream(log mlog.Log, acc *store.Account, w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "405 - method not allowed - use get", http.StatusMethodNotAllowed)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		log.Error("internal error: ResponseWriter not a http.Flusher")
+		http.Error(w, "500 - internal error - cannot access underlying connection", 500)
+		return
+	}
+
+	var pending chan struct{}
+	var get func() []store.AccountChanges
+	if acc != nil {
+		comm := store.RegisterComm(acc)
+		defer comm.Unregister()
+		pending = comm.Pending
+		get = func() []store.AccountChanges {
+			if l := comm.Get(); len(l) > 0 {
+				return []store.AccountChanges{{AccountName: acc.Name, Changes: l}}
+			}
+			return nil
+		}
+	} else {
+		comm := store.RegisterServerComm()
+		defer comm.Unregister()
+		pending = comm.Pending
+		get = comm.Get
+	}
+
+	h := w.Header()
+	h.Set("Content-Type", "text/event-stream")
+	h.Set("Cache-Control", "no-cache")
+	if _, err := w.Write([]byte(": keepalive\n\n")); err != nil {
+		return
+	}
+	flusher.Flush()
+
+	// Keep idle connections alive through proxies.
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	ctx := r.Context()
+	for {
+		select {
+		case <-pending:
+			for _, ac := range get() {
+				for _, ch := range ac.Changes {
+					buf, err := json.Marshal(ChangeEvent{ac.AccountName, reflect.TypeOf(ch).Name(), ch})
+					if err != nil {
+						log.Errorx("marshal change event", err)
+						continue
+					}
+					if _, err := fmt.Fprintf(w, "event: change\ndata: %s\n\n", buf); err != nil {
+						log.Debugx("writing change event", err)
+						return
+					}
+				}
+			}
+			flusher.Flush()
+
+		case <-ticker.C:
+			if _, err := w.Write([]byte(": keepalive\n\n")); err != nil {
+				log.Debugx("writing keepalive", err)
+				return
+			}
+			flusher.Flush()
+
+		case <-ctx.Done():
+			return
+		}
+	}
+}
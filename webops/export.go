@@ -15,20 +15,30 @@ import (
 )
 
 // Export is used by webmail and webaccount to export messages of one or
-// multiple mailboxes, in maildir or mbox format, in a tar/tgz/zip archive or
+// multiple mailboxes, in maildir, mbox or eml format, in a tar/tgz/zip archive or
 // direct mbox.
+//
+// Form field "mailbox" has the mailboxes to export, one per line, empty means
+// all. Messages can be filtered by received date with "since" and "before"
+// (yyyy-mm-dd), and by space-separated flags/keywords with "flags" (must all be
+// present) and "notflags" (must not be present).
 func Export(log mlog.Log, accName string, w http.ResponseWriter, r *http.Request) {
 	if r.Method != "POST" {
 		http.Error(w, "405 - method not allowed - use post", http.StatusMethodNotAllowed)
 		return
 	}
 
-	mailbox := r.FormValue("mailbox") // Empty means all.
-	format := r.FormValue("format")
+	var mailboxes []string
+	for _, s := range strings.Split(r.FormValue("mailbox"), "\n") {
+		if s = strings.TrimSpace(s); s != "" {
+			mailboxes = append(mailboxes, s)
+		}
+	}
+	format := store.ExportFormat(r.FormValue("format"))
 	archive := r.FormValue("archive")
 	recursive := r.FormValue("recursive") != ""
 	switch format {
-	case "maildir", "mbox":
+	case store.ExportMaildir, store.ExportMbox, store.ExportEML:
 	default:
 		http.Error(w, "400 - bad request - unknown format", http.StatusBadRequest)
 		return
@@ -39,8 +49,40 @@ func Export(log mlog.Log, accName string, w http.ResponseWriter, r *http.Request
 		http.Error(w, "400 - bad request - unknown archive", http.StatusBadRequest)
 		return
 	}
-	if archive == "none" && (format != "mbox" || recursive) {
-		http.Error(w, "400 - bad request - archive none can only be used with non-recursive mbox", http.StatusBadRequest)
+	if archive == "none" && (format != store.ExportMbox || recursive || len(mailboxes) != 1) {
+		http.Error(w, "400 - bad request - archive none can only be used with a single non-recursive mbox", http.StatusBadRequest)
+		return
+	}
+
+	var filter store.ExportFilter
+	parseDate := func(field string) (time.Time, bool) {
+		s := r.FormValue(field)
+		if s == "" {
+			return time.Time{}, true
+		}
+		t, err := time.ParseInLocation("2006-01-02", s, time.Local)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("400 - bad request - parsing %s: %v", field, err), http.StatusBadRequest)
+			return time.Time{}, false
+		}
+		return t, true
+	}
+	var ok bool
+	if filter.Since, ok = parseDate("since"); !ok {
+		return
+	}
+	if filter.Before, ok = parseDate("before"); !ok {
+		return
+	}
+	var err error
+	filter.Flags, filter.Keywords, err = store.ParseFlagsKeywords(strings.Fields(r.FormValue("flags")))
+	if err != nil {
+		http.Error(w, "400 - bad request - parsing flags: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	filter.NotFlags, filter.NotKeywords, err = store.ParseFlagsKeywords(strings.Fields(r.FormValue("notflags")))
+	if err != nil {
+		http.Error(w, "400 - bad request - parsing notflags: "+err.Error(), http.StatusBadRequest)
 		return
 	}
 
@@ -55,12 +97,14 @@ func Export(log mlog.Log, accName string, w http.ResponseWriter, r *http.Request
 		log.Check(err, "closing account")
 	}()
 
-	name := strings.ReplaceAll(mailbox, "/", "-")
-	if name == "" {
-		name = "all"
+	name := "all"
+	if len(mailboxes) == 1 {
+		name = strings.ReplaceAll(mailboxes[0], "/", "-")
+	} else if len(mailboxes) > 1 {
+		name = "selection"
 	}
 	filename := fmt.Sprintf("mailexport-%s-%s", name, time.Now().Format("20060102-150405"))
-	filename += "." + format
+	filename += "." + string(format)
 	var archiver store.Archiver
 	if archive == "none" {
 		w.Header().Set("Content-Type", "application/mbox")
@@ -90,7 +134,7 @@ func Export(log mlog.Log, accName string, w http.ResponseWriter, r *http.Request
 		log.Check(err, "exporting mail close")
 	}()
 	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
-	if err := store.ExportMessages(r.Context(), log, acc.DB, acc.Dir, archiver, format == "maildir", mailbox, recursive); err != nil {
+	if err := store.ExportMessages(r.Context(), log, acc.DB, acc.Dir, archiver, format, mailboxes, recursive, filter); err != nil {
 		log.Errorx("exporting mail", err)
 	}
 }
@@ -0,0 +1,130 @@
+package webops
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mjl-/mox/junk"
+	"github.com/mjl-/mox/mlog"
+	"github.com/mjl-/mox/store"
+)
+
+// JunkDecisionsExport is used by webaccount to export the recent junk decisions
+// of an account, for analysis of false positives/negatives.
+//
+// Form field "format" is "json" or "csv". Decisions can be filtered by time with
+// "since" and "before" (yyyy-mm-dd).
+func JunkDecisionsExport(log mlog.Log, accName string, w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "405 - method not allowed - use post", http.StatusMethodNotAllowed)
+		return
+	}
+
+	format := r.FormValue("format")
+	switch format {
+	case "json", "csv":
+	default:
+		http.Error(w, "400 - bad request - unknown format", http.StatusBadRequest)
+		return
+	}
+	parseDate := func(field string) (time.Time, bool) {
+		s := r.FormValue(field)
+		if s == "" {
+			return time.Time{}, true
+		}
+		t, err := time.ParseInLocation("2006-01-02", s, time.Local)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("400 - bad request - parsing %s: %v", field, err), http.StatusBadRequest)
+			return time.Time{}, false
+		}
+		return t, true
+	}
+	since, ok := parseDate("since")
+	if !ok {
+		return
+	}
+	before, ok := parseDate("before")
+	if !ok {
+		return
+	}
+
+	acc, err := store.OpenAccount(log, accName, false)
+	if err != nil {
+		log.Errorx("open account for junk decisions export", err)
+		http.Error(w, "500 - internal server error", http.StatusInternalServerError)
+		return
+	}
+	defer func() {
+		err := acc.Close()
+		log.Check(err, "closing account")
+	}()
+
+	l, err := acc.JunkDecisions(r.Context(), since, before, 0)
+	if err != nil {
+		log.Errorx("listing junk decisions", err)
+		http.Error(w, "500 - internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	filename := fmt.Sprintf("junkdecisions-%s.%s", time.Now().Format("20060102-150405"), format)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+	if format == "json" {
+		w.Header().Set("Content-Type", "application/json")
+		err = json.NewEncoder(w).Encode(l)
+	} else {
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		err = JunkDecisionsCSV(w, l)
+	}
+	log.Check(err, "writing junk decisions export")
+}
+
+// JunkDecisionsCSV writes junk decisions as CSV, with a header line. Lists are
+// joined with "; ", words are written with their score.
+func JunkDecisionsCSV(w io.Writer, l []store.JunkDecision) error {
+	cw := csv.NewWriter(w)
+	header := []string{
+		"Time", "MessageID", "MailFrom", "MsgFrom", "Recipient", "RemoteIP", "Subject",
+		"Accept", "Mailbox", "Reason",
+		"ReputationMethod", "ReputationJunk", "ReputationConclusive",
+		"ContentAnalyzed", "Probability", "Significant", "Threshold", "HamWords", "SpamWords",
+		"DNSBLZone", "ReasonText",
+	}
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+	formatFloat := func(f float64) string {
+		return strconv.FormatFloat(f, 'f', 3, 64)
+	}
+	words := func(l []junk.WordScore) string {
+		var r []string
+		for _, ws := range l {
+			r = append(r, ws.Word+" "+formatFloat(ws.Score))
+		}
+		return strings.Join(r, "; ")
+	}
+	for _, jd := range l {
+		var repJunk string
+		if jd.ReputationJunk != nil {
+			repJunk = strconv.FormatBool(*jd.ReputationJunk)
+		}
+		record := []string{
+			jd.Time.Format(time.RFC3339), jd.MessageID, jd.MailFrom, jd.MsgFrom, jd.Recipient, jd.RemoteIP, jd.Subject,
+			strconv.FormatBool(jd.Accept), jd.Mailbox, jd.Reason,
+			jd.ReputationMethod, repJunk, strconv.FormatBool(jd.ReputationConclusive),
+			strconv.FormatBool(jd.ContentAnalyzed), formatFloat(jd.Probability), strconv.FormatBool(jd.Significant), formatFloat(jd.Threshold), words(jd.HamWords), words(jd.SpamWords),
+			jd.DNSBLZone, strings.Join(jd.ReasonText, "; "),
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
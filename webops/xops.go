@@ -8,6 +8,7 @@ import (
 	"io"
 	"os"
 	"sort"
+	"time"
 
 	"golang.org/x/exp/maps"
 
@@ -39,6 +40,11 @@ func (x XOps) mailboxID(ctx context.Context, tx *bstore.Tx, mailboxID int64) sto
 	return mb
 }
 
+// checkWritable panics with a user error if mailbox mb is read-only.
+func (x XOps) checkWritable(ctx context.Context, mb store.Mailbox) {
+	x.Checkuserf(ctx, mb.CheckWritable(), "checking mailbox %q", mb.Name)
+}
+
 // messageID returns a non-expunged message or panics with a sherpa error.
 func (x XOps) messageID(ctx context.Context, tx *bstore.Tx, messageID int64) store.Message {
 	if messageID == 0 {
@@ -56,24 +62,32 @@ func (x XOps) messageID(ctx context.Context, tx *bstore.Tx, messageID int64) sto
 }
 
 func (x XOps) MessageDelete(ctx context.Context, log mlog.Log, acc *store.Account, messageIDs []int64) {
+	var removed []store.Message
+
 	acc.WithWLock(func() {
 		var changes []store.Change
 
 		x.DBWrite(ctx, acc, func(tx *bstore.Tx) {
-			_, changes = x.MessageDeleteTx(ctx, log, tx, acc, messageIDs, 0)
+			_, changes, removed = x.MessageDeleteTx(ctx, log, tx, acc, messageIDs, 0)
 		})
 
 		store.BroadcastChanges(acc, changes)
 	})
 
-	for _, mID := range messageIDs {
-		p := acc.MessagePath(mID)
+	for _, m := range removed {
+		if m.PackID != 0 {
+			continue
+		}
+		p := acc.MessagePath(m.ID)
 		err := os.Remove(p)
 		log.Check(err, "removing message file for expunge")
 	}
 }
 
-func (x XOps) MessageDeleteTx(ctx context.Context, log mlog.Log, tx *bstore.Tx, acc *store.Account, messageIDs []int64, modseq store.ModSeq) (store.ModSeq, []store.Change) {
+// MessageDeleteTx marks messages as expunged. The caller should broadcast the
+// changes and remove the on-disk files for the returned removed messages after the
+// transaction. Messages stored in a pack file have no file to remove.
+func (x XOps) MessageDeleteTx(ctx context.Context, log mlog.Log, tx *bstore.Tx, acc *store.Account, messageIDs []int64, modseq store.ModSeq) (store.ModSeq, []store.Change, []store.Message) {
 	removeChanges := map[int64]store.ChangeRemoveUIDs{}
 	changes := make([]store.Change, 0, len(messageIDs)+1) // n remove, 1 mailbox counts
 
@@ -92,6 +106,7 @@ func (x XOps) MessageDeleteTx(ctx context.Context, log mlog.Log, tx *bstore.Tx,
 				changes = append(changes, mb.ChangeCounts())
 			}
 			mb = x.mailboxID(ctx, tx, m.MailboxID)
+			x.checkWritable(ctx, mb)
 		}
 
 		qmr := bstore.QueryTx[store.Recipient](tx)
@@ -99,6 +114,11 @@ func (x XOps) MessageDeleteTx(ctx context.Context, log mlog.Log, tx *bstore.Tx,
 		_, err := qmr.Delete()
 		x.Checkf(ctx, err, "removing message recipients")
 
+		err = tx.Delete(&store.TextIndex{ID: m.ID})
+		if err != bstore.ErrAbsent {
+			x.Checkf(ctx, err, "removing text index")
+		}
+
 		mb.Sub(m.MailboxCounts())
 
 		if modseq == 0 {
@@ -143,7 +163,7 @@ func (x XOps) MessageDeleteTx(ctx context.Context, log mlog.Log, tx *bstore.Tx,
 		changes = append(changes, ch)
 	}
 
-	return modseq, changes
+	return modseq, changes, remove
 }
 
 func (x XOps) MessageFlagsAdd(ctx context.Context, log mlog.Log, acc *store.Account, messageIDs []int64, flaglist []string) {
@@ -173,6 +193,7 @@ func (x XOps) MessageFlagsAdd(ctx context.Context, log mlog.Log, acc *store.Acco
 						}
 					}
 					mb = x.mailboxID(ctx, tx, m.MailboxID)
+					x.checkWritable(ctx, mb)
 					origmb = mb
 				}
 				mb.Keywords, _ = store.MergeKeywords(mb.Keywords, keywords)
@@ -244,6 +265,7 @@ func (x XOps) MessageFlagsClear(ctx context.Context, log mlog.Log, acc *store.Ac
 						// note: cannot remove keywords from mailbox by removing keywords from message.
 					}
 					mb = x.mailboxID(ctx, tx, m.MailboxID)
+					x.checkWritable(ctx, mb)
 					origmb = mb
 				}
 
@@ -301,6 +323,7 @@ func (x XOps) MailboxesMarkRead(ctx context.Context, log mlog.Log, acc *store.Ac
 
 			for _, mbID := range mailboxIDs {
 				mb := x.mailboxID(ctx, tx, mbID)
+				x.checkWritable(ctx, mb)
 
 				// Find messages to update.
 				q := bstore.QueryTx[store.Message](tx)
@@ -373,6 +396,8 @@ func (x XOps) MessageMove(ctx context.Context, log mlog.Log, acc *store.Account,
 }
 
 func (x XOps) MessageMoveTx(ctx context.Context, log mlog.Log, acc *store.Account, tx *bstore.Tx, messageIDs []int64, mbDst store.Mailbox, modseq store.ModSeq) (store.ModSeq, []store.Change) {
+	x.checkWritable(ctx, mbDst)
+
 	retrain := make([]store.Message, 0, len(messageIDs))
 	removeChanges := map[int64]store.ChangeRemoveUIDs{}
 	// n adds, 1 remove, 2 mailboxcounts, optimistic and at least for a single message.
@@ -381,6 +406,7 @@ func (x XOps) MessageMoveTx(ctx context.Context, log mlog.Log, acc *store.Accoun
 	var mbSrc store.Mailbox
 
 	keywords := map[string]struct{}{}
+	now := time.Now()
 
 	for _, mid := range messageIDs {
 		m := x.messageID(ctx, tx, mid)
@@ -393,6 +419,7 @@ func (x XOps) MessageMoveTx(ctx context.Context, log mlog.Log, acc *store.Accoun
 				changes = append(changes, mbSrc.ChangeCounts())
 			}
 			mbSrc = x.mailboxID(ctx, tx, m.MailboxID)
+			x.checkWritable(ctx, mbSrc)
 		}
 
 		if mbSrc.ID == mbDst.ID {
@@ -434,6 +461,7 @@ func (x XOps) MessageMoveTx(ctx context.Context, log mlog.Log, acc *store.Accoun
 		}
 		m.UID = mbDst.UIDNext
 		m.ModSeq = modseq
+		m.SaveDate = &now
 		mbDst.UIDNext++
 		m.JunkFlagsForMailbox(mbDst, conf)
 		err = tx.Update(&m)
@@ -0,0 +1,246 @@
+// Package wkd implements helpers for serving OpenPGP public keys through the
+// Web Key Directory (WKD, draft-koch-openpgp-webkey-service).
+//
+// Mail clients look up the OpenPGP key for an email address with an HTTPS
+// request. With the "advanced method", the request is to
+// "https://openpgpkey.<domain>/.well-known/openpgpkey/<domain>/hu/<hash>", with
+// the "direct method" to "https://<domain>/.well-known/openpgpkey/hu/<hash>". The
+// hash is the z-base-32-encoded SHA-1 hash of the lower-cased localpart of the
+// address. The response is the binary (not ASCII-armored) OpenPGP key. A "policy"
+// file next to the "hu" directory indicates the domain supports WKD.
+package wkd
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// MaxKeySize is the maximum size of an OpenPGP key accepted by ParseKey.
+const MaxKeySize = 256 * 1024
+
+var (
+	ErrSecretKey   = errors.New("data contains secret key material")
+	ErrMultipleKey = errors.New("data contains multiple keys")
+)
+
+const zbase32Alphabet = "ybndrfg8ejkmcpqxot1uwisza345h769"
+
+// Hash returns the hash for the localpart of an email address as used in WKD
+// paths. Only ASCII upper case characters are lower-cased.
+func Hash(localpart string) string {
+	lp := strings.Map(func(c rune) rune {
+		if c >= 'A' && c <= 'Z' {
+			return c + ('a' - 'A')
+		}
+		return c
+	}, localpart)
+	h := sha1.Sum([]byte(lp))
+	return zbase32(h[:])
+}
+
+// zbase32 encodes buf, which must be a multiple of 5 bytes.
+func zbase32(buf []byte) string {
+	var s strings.Builder
+	for i := 0; i+5 <= len(buf); i += 5 {
+		v := uint64(buf[i])<<32 | uint64(buf[i+1])<<24 | uint64(buf[i+2])<<16 | uint64(buf[i+3])<<8 | uint64(buf[i+4])
+		for j := 7; j >= 0; j-- {
+			s.WriteByte(zbase32Alphabet[(v>>(5*j))&0x1f])
+		}
+	}
+	return s.String()
+}
+
+// Key is a parsed OpenPGP public key.
+type Key struct {
+	Data        []byte   // Binary transferable public key, as served over WKD.
+	Fingerprint string   // Upper-case hex.
+	UserIDs     []string // E.g. "Name <user@example.org>".
+}
+
+// HasAddress returns whether the key has a user ID with the email address,
+// compared case-insensitively.
+func (k Key) HasAddress(address string) bool {
+	for _, uid := range k.UserIDs {
+		addr := uid
+		if s, e := strings.LastIndex(uid, "<"), strings.LastIndex(uid, ">"); s >= 0 && e > s {
+			addr = uid[s+1 : e]
+		}
+		if strings.EqualFold(strings.TrimSpace(addr), address) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseKey parses an OpenPGP transferable public key, binary or ASCII-armored.
+// Keys with secret key material are rejected. Signatures are not verified.
+func ParseKey(buf []byte) (Key, error) {
+	if len(buf) > MaxKeySize {
+		return Key{}, fmt.Errorf("key larger than maximum size %d", MaxKeySize)
+	}
+	if bytes.Contains(buf, []byte("-----BEGIN PGP ")) {
+		var err error
+		buf, err = dearmor(buf)
+		if err != nil {
+			return Key{}, fmt.Errorf("ascii armor: %w", err)
+		}
+	}
+
+	var k Key
+	data := buf
+	for len(buf) > 0 {
+		tag, body, rest, err := nextPacket(buf)
+		if err != nil {
+			return Key{}, fmt.Errorf("parsing packet: %w", err)
+		}
+		buf = rest
+		switch tag {
+		case 5, 7:
+			return Key{}, ErrSecretKey
+		case 6:
+			if k.Fingerprint != "" {
+				return Key{}, ErrMultipleKey
+			}
+			k.Fingerprint, err = fingerprint(body)
+			if err != nil {
+				return Key{}, err
+			}
+		case 13:
+			if k.Fingerprint == "" {
+				return Key{}, fmt.Errorf("user id before public key")
+			}
+			k.UserIDs = append(k.UserIDs, string(body))
+		default:
+			if k.Fingerprint == "" {
+				return Key{}, fmt.Errorf("packet with tag %d before public key", tag)
+			}
+		}
+	}
+	if k.Fingerprint == "" {
+		return Key{}, fmt.Errorf("no public key")
+	}
+	k.Data = data
+	return k, nil
+}
+
+// nextPacket parses the first packet in buf, returning its tag, body and the
+// remaining data.
+func nextPacket(buf []byte) (tag int, body, rest []byte, rerr error) {
+	if len(buf) < 2 || buf[0]&0x80 == 0 {
+		return 0, nil, nil, fmt.Errorf("invalid packet header")
+	}
+	var n, o int
+	if buf[0]&0x40 != 0 {
+		// New format.
+		tag = int(buf[0] & 0x3f)
+		switch l := buf[1]; {
+		case l < 192:
+			n, o = int(l), 2
+		case l < 224:
+			if len(buf) < 3 {
+				return 0, nil, nil, fmt.Errorf("short packet length")
+			}
+			n, o = (int(l)-192)<<8+int(buf[2])+192, 3
+		case l == 255:
+			if len(buf) < 6 {
+				return 0, nil, nil, fmt.Errorf("short packet length")
+			}
+			n, o = int(binary.BigEndian.Uint32(buf[2:6])), 6
+		default:
+			return 0, nil, nil, fmt.Errorf("partial body length not allowed in keys")
+		}
+	} else {
+		// Old format.
+		tag = int(buf[0]>>2) & 0xf
+		switch buf[0] & 3 {
+		case 0:
+			n, o = int(buf[1]), 2
+		case 1:
+			if len(buf) < 3 {
+				return 0, nil, nil, fmt.Errorf("short packet length")
+			}
+			n, o = int(binary.BigEndian.Uint16(buf[1:3])), 3
+		case 2:
+			if len(buf) < 5 {
+				return 0, nil, nil, fmt.Errorf("short packet length")
+			}
+			n, o = int(binary.BigEndian.Uint32(buf[1:5])), 5
+		default:
+			return 0, nil, nil, fmt.Errorf("indeterminate packet length not allowed in keys")
+		}
+	}
+	if n < 0 || n > len(buf)-o {
+		return 0, nil, nil, fmt.Errorf("packet length %d beyond end of data", n)
+	}
+	return tag, buf[o : o+n], buf[o+n:], nil
+}
+
+// fingerprint returns the fingerprint for a public key packet body.
+func fingerprint(body []byte) (string, error) {
+	if len(body) == 0 {
+		return "", fmt.Errorf("empty public key packet")
+	}
+	switch body[0] {
+	case 4:
+		h := sha1.New()
+		h.Write([]byte{0x99, byte(len(body) >> 8), byte(len(body))})
+		h.Write(body)
+		return strings.ToUpper(hex.EncodeToString(h.Sum(nil))), nil
+	case 6:
+		h := sha256.New()
+		h.Write([]byte{0x9b})
+		h.Write(binary.BigEndian.AppendUint32(nil, uint32(len(body))))
+		h.Write(body)
+		return strings.ToUpper(hex.EncodeToString(h.Sum(nil))), nil
+	}
+	return "", fmt.Errorf("unsupported public key version %d", body[0])
+}
+
+// dearmor returns the binary data of an ASCII-armored public key block. The
+// checksum is not verified.
+func dearmor(buf []byte) ([]byte, error) {
+	lines := strings.Split(strings.ReplaceAll(string(buf), "\r\n", "\n"), "\n")
+	for len(lines) > 0 && strings.TrimSpace(lines[0]) != "-----BEGIN PGP PUBLIC KEY BLOCK-----" {
+		lines = lines[1:]
+	}
+	if len(lines) == 0 {
+		return nil, fmt.Errorf("no public key block")
+	}
+	lines = lines[1:]
+
+	// Skip armor headers, ending with an empty line.
+	for i, l := range lines {
+		l = strings.TrimSpace(l)
+		if l == "" {
+			lines = lines[i+1:]
+			break
+		} else if !strings.Contains(l, ": ") {
+			break
+		}
+	}
+
+	var b64 strings.Builder
+	for _, l := range lines {
+		l = strings.TrimSpace(l)
+		if l == "-----END PGP PUBLIC KEY BLOCK-----" {
+			data, err := base64.StdEncoding.DecodeString(b64.String())
+			if err != nil {
+				return nil, fmt.Errorf("decoding base64: %v", err)
+			}
+			return data, nil
+		}
+		if len(l) == 5 && strings.HasPrefix(l, "=") {
+			// Checksum.
+			continue
+		}
+		b64.WriteString(l)
+	}
+	return nil, fmt.Errorf("missing end of public key block")
+}
@@ -0,0 +1,78 @@
+package wkd
+
+import (
+	"encoding/base64"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestHash(t *testing.T) {
+	// Example from draft-koch-openpgp-webkey-service.
+	if h := Hash("Joe.Doe"); h != "iy9q119eutrkn8s1mk4r39qejnbu3n5q" {
+		t.Fatalf("got hash %q, expected iy9q119eutrkn8s1mk4r39qejnbu3n5q", h)
+	}
+}
+
+func packet(tag int, body string) []byte {
+	return append([]byte{0xc0 | byte(tag), byte(len(body))}, body...)
+}
+
+func TestParseKey(t *testing.T) {
+	pubkey := packet(6, "\x04\x00\x00\x00\x00\x16fake-key-material")
+	uid := packet(13, "Mox Jones <mjl@mox.example>")
+	oldUID := []byte{0x80 | 13<<2, byte(len("other@mox.example"))}
+	oldUID = append(oldUID, "other@mox.example"...)
+	sig := packet(2, "fake signature")
+
+	var data []byte
+	for _, p := range [][]byte{pubkey, uid, sig, oldUID, sig} {
+		data = append(data, p...)
+	}
+
+	k, err := ParseKey(data)
+	if err != nil {
+		t.Fatalf("parse key: %v", err)
+	}
+	if !reflect.DeepEqual(k.UserIDs, []string{"Mox Jones <mjl@mox.example>", "other@mox.example"}) {
+		t.Fatalf("unexpected user ids %q", k.UserIDs)
+	}
+	if len(k.Fingerprint) != 40 {
+		t.Fatalf("unexpected fingerprint %q", k.Fingerprint)
+	}
+	if !k.HasAddress("MJL@mox.example") || !k.HasAddress("other@mox.example") || k.HasAddress("bogus@mox.example") {
+		t.Fatalf("bad address matching")
+	}
+
+	// Armored, with headers and checksum.
+	b64 := base64.StdEncoding.EncodeToString(data)
+	armored := "-----BEGIN PGP PUBLIC KEY BLOCK-----\r\nComment: test\r\n\r\n" + b64[:20] + "\r\n" + b64[20:] + "\r\n=abcd\r\n-----END PGP PUBLIC KEY BLOCK-----\r\n"
+	ak, err := ParseKey([]byte(armored))
+	if err != nil {
+		t.Fatalf("parse armored key: %v", err)
+	}
+	if !reflect.DeepEqual(ak, k) {
+		t.Fatalf("armored key %#v, expected %#v", ak, k)
+	}
+
+	_, err = ParseKey(append(data, packet(7, "secret")...))
+	if !errors.Is(err, ErrSecretKey) {
+		t.Fatalf("got err %v, expected ErrSecretKey", err)
+	}
+	_, err = ParseKey(append(data, pubkey...))
+	if !errors.Is(err, ErrMultipleKey) {
+		t.Fatalf("got err %v, expected ErrMultipleKey", err)
+	}
+	bad := [][]byte{
+		nil,
+		uid,
+		data[:len(data)-1],
+		[]byte(strings.TrimSuffix(armored, "-----END PGP PUBLIC KEY BLOCK-----\r\n")),
+	}
+	for _, buf := range bad {
+		if _, err := ParseKey(buf); err == nil {
+			t.Fatalf("parsing %q: expected error", buf)
+		}
+	}
+}